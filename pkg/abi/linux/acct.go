@@ -0,0 +1,77 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Flags for AcctV3.Flag, from include/uapi/linux/acct.h.
+const (
+	// AFORK indicates that the process forked but did not exec.
+	AFORK = 0x01
+
+	// ASU indicates that the process used superuser privileges.
+	ASU = 0x02
+
+	// ACORE indicates that the process dumped core.
+	ACORE = 0x08
+
+	// AXSIG indicates that the process was killed by a signal.
+	AXSIG = 0x10
+)
+
+const (
+	// ACCT_VERSION is the version of the process accounting records written
+	// by acct(2).
+	ACCT_VERSION = 3
+
+	// ACCT_COMM is the size of AcctV3.Comm.
+	ACCT_COMM = 16
+
+	// AHZ is the frequency of the clock that AcctV3 times are expressed
+	// in.
+	AHZ = 100
+)
+
+// AcctV3 is equivalent to struct acct_v3, the process accounting record
+// written by acct(2) when a process exits.
+//
+// UTime through Swaps are comp_t values: a 13-bit mantissa and a 3-bit base 8
+// exponent.
+type AcctV3 struct {
+	Flag     uint8
+	Version  uint8
+	TTY      uint16
+	ExitCode uint32
+	UID      uint32
+	GID      uint32
+	PID      uint32
+	PPID     uint32
+	BTime    uint32
+
+	// ETime is the elapsed time in AHZ ticks, as the bits of an IEEE 754
+	// single precision float.
+	ETime uint32
+
+	UTime  uint16
+	STime  uint16
+	Mem    uint16
+	IO     uint16
+	RW     uint16
+	MinFlt uint16
+	MajFlt uint16
+	Swaps  uint16
+	Comm   [ACCT_COMM]byte
+}
+
+// SizeOfAcctV3 is the size of an AcctV3.
+const SizeOfAcctV3 = 64
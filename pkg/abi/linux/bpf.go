@@ -32,3 +32,20 @@ type BPFInstruction struct {
 	// K is a constant parameter. The meaning depends on the value of OpCode.
 	K uint32
 }
+
+// SockFprog is struct sock_fprog, from uapi/linux/filter.h, on amd64.
+type SockFprog struct {
+	// Len is the length of the filter in BPF instructions.
+	Len uint16
+
+	_ [6]byte // padding for alignment
+
+	// Filter is a user pointer to the struct sock_filter array that makes up
+	// the filter program. Filter is a uint64 rather than a usermem.Addr
+	// because usermem.Addr is actually uintptr, which is not a fixed-size
+	// type, and encoding/binary.Read objects to this.
+	Filter uint64
+}
+
+// SizeOfSockFprog is the size of a SockFprog struct.
+const SizeOfSockFprog = 16
@@ -34,16 +34,59 @@ const (
 	O_TRUNC     = 00001000
 	O_APPEND    = 00002000
 	O_NONBLOCK  = 00004000
+	O_DSYNC     = 00010000
 	O_ASYNC     = 00020000
 	O_DIRECT    = 00040000
 	O_LARGEFILE = 00100000
 	O_DIRECTORY = 00200000
 	O_NOFOLLOW  = 00400000
+	O_NOATIME   = 01000000
 	O_CLOEXEC   = 02000000
 	O_SYNC      = 04010000
 	O_PATH      = 010000000
+	O_TMPFILE   = 020000000 | O_DIRECTORY
 )
 
+// Constants for openat2(2) struct open_how.resolve.
+const (
+	RESOLVE_NO_XDEV       = 0x01
+	RESOLVE_NO_MAGICLINKS = 0x02
+	RESOLVE_NO_SYMLINKS   = 0x04
+	RESOLVE_BENEATH       = 0x08
+	RESOLVE_IN_ROOT       = 0x10
+	RESOLVE_CACHED        = 0x20
+)
+
+// OpenHow is struct open_how, the argument to openat2(2).
+type OpenHow struct {
+	Flags   uint64
+	Mode    uint64
+	Resolve uint64
+}
+
+// SizeOfOpenHow is the size of OpenHow, OPEN_HOW_SIZE_VER0 in Linux.
+const SizeOfOpenHow = 24
+
+// Constants for name_to_handle_at(2) and open_by_handle_at(2).
+const (
+	// MAX_HANDLE_SZ is the maximum size of the data of a file handle.
+	MAX_HANDLE_SZ = 128
+
+	// FILEID_INO64_GEN is the type of file handles that contain a 64-bit
+	// inode number followed by a 32-bit generation number.
+	FILEID_INO64_GEN = 0x81
+)
+
+// FileHandle is the header of struct file_handle, which is followed by
+// HandleBytes bytes of filesystem-specific handle data.
+type FileHandle struct {
+	HandleBytes uint32
+	HandleType  int32
+}
+
+// SizeOfFileHandle is the size of FileHandle.
+const SizeOfFileHandle = 8
+
 // Constants for fstatat(2).
 const (
 	AT_SYMLINK_NOFOLLOW = 0x100
@@ -103,6 +146,12 @@ const (
 	AT_FDCWD = -100
 )
 
+// Flags for close_range(2).
+const (
+	CLOSE_RANGE_UNSHARE = 1 << 1
+	CLOSE_RANGE_CLOEXEC = 1 << 2
+)
+
 // Special values for the ns field in utimensat(2).
 const (
 	UTIME_NOW  = ((1 << 30) - 1)
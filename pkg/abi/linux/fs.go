@@ -19,7 +19,9 @@ package linux
 // See linux/magic.h.
 const (
 	ANON_INODE_FS_MAGIC   = 0x09041934
+	BINFMTFS_MAGIC        = 0x42494e4d
 	DEVPTS_SUPER_MAGIC    = 0x00001cd1
+	HUGETLBFS_MAGIC       = 0x958458f6
 	OVERLAYFS_SUPER_MAGIC = 0x794c7630
 	PIPEFS_MAGIC          = 0x50495045
 	PROC_SUPER_MAGIC      = 0x9fa0
@@ -0,0 +1,75 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// GenericNetlinkMessage is struct genlmsghdr, from uapi/linux/genetlink.h.
+type GenericNetlinkMessage struct {
+	Command  uint8
+	Version  uint8
+	Reserved uint16
+}
+
+// GenericNetlinkMessageSize is the size of GenericNetlinkMessage.
+const GenericNetlinkMessageSize = 4
+
+// GENL_NAMSIZ is the maximum length of a generic netlink family name,
+// including the NUL terminator, from uapi/linux/genetlink.h.
+const GENL_NAMSIZ = 16
+
+// GENL_ID_CTRL is the family ID of the generic netlink controller, from
+// uapi/linux/genetlink.h.
+const GENL_ID_CTRL = NLMSG_MIN_TYPE
+
+// Generic netlink controller commands, from uapi/linux/genetlink.h.
+const (
+	CTRL_CMD_UNSPEC       = 0
+	CTRL_CMD_NEWFAMILY    = 1
+	CTRL_CMD_DELFAMILY    = 2
+	CTRL_CMD_GETFAMILY    = 3
+	CTRL_CMD_NEWOPS       = 4
+	CTRL_CMD_DELOPS       = 5
+	CTRL_CMD_GETOPS       = 6
+	CTRL_CMD_NEWMCAST_GRP = 7
+	CTRL_CMD_DELMCAST_GRP = 8
+	CTRL_CMD_GETMCAST_GRP = 9
+)
+
+// Generic netlink controller attributes, from uapi/linux/genetlink.h.
+const (
+	CTRL_ATTR_UNSPEC       = 0
+	CTRL_ATTR_FAMILY_ID    = 1
+	CTRL_ATTR_FAMILY_NAME  = 2
+	CTRL_ATTR_VERSION      = 3
+	CTRL_ATTR_HDRSIZE      = 4
+	CTRL_ATTR_MAXATTR      = 5
+	CTRL_ATTR_OPS          = 6
+	CTRL_ATTR_MCAST_GROUPS = 7
+)
+
+// Generic netlink controller operation attributes, nested in CTRL_ATTR_OPS,
+// from uapi/linux/genetlink.h.
+const (
+	CTRL_ATTR_OP_UNSPEC = 0
+	CTRL_ATTR_OP_ID     = 1
+	CTRL_ATTR_OP_FLAGS  = 2
+)
+
+// Generic netlink operation flags, from uapi/linux/genetlink.h.
+const (
+	GENL_ADMIN_PERM     = 0x01
+	GENL_CMD_CAP_DO     = 0x02
+	GENL_CMD_CAP_DUMP   = 0x04
+	GENL_CMD_CAP_HASPOL = 0x08
+)
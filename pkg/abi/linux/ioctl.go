@@ -39,6 +39,7 @@ const (
 	TIOCINQ     = 0x0000541b
 	FIONREAD    = TIOCINQ
 	FIONBIO     = 0x00005421
+	TIOCPKT     = 0x00005420
 	TIOCSETD    = 0x00005423
 	TIOCNOTTY   = 0x00005422
 	TIOCGETD    = 0x00005424
@@ -50,6 +51,7 @@ const (
 	TIOCSPTLCK  = 0x40045431
 	TIOCGDEV    = 0x80045432
 	TIOCVHANGUP = 0x00005437
+	TIOCGPKT    = 0x80045438
 	TCFLSH      = 0x0000540b
 	TIOCCONS    = 0x0000541d
 	TIOCSSERIAL = 0x0000541f
@@ -67,6 +69,8 @@ const (
 
 // ioctl(2) requests provided by uapi/linux/sockios.h
 const (
+	SIOCINQ       = FIONREAD
+	SIOCOUTQ      = TIOCOUTQ
 	SIOCGIFMEM    = 0x891f
 	SIOCGIFPFLAGS = 0x8935
 	SIOCGMIIPHY   = 0x8947
@@ -97,3 +101,11 @@ const (
 	AshmemGetPinStatusIoctl   = 0x00007709
 	AshmemPurgeAllCachesIoctl = 0x0000770a
 )
+
+// ioctl(2) requests provided by uapi/linux/fs.h
+const (
+	BLKGETSIZE   = 0x00001260
+	BLKSSZGET    = 0x00001268
+	BLKGETSIZE64 = 0x80081272
+	BLKPBSZGET   = 0x0000127b
+)
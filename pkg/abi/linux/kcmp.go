@@ -0,0 +1,27 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Resource types compared by kcmp(2), from include/uapi/linux/kcmp.h.
+const (
+	KCMP_FILE      = 0
+	KCMP_VM        = 1
+	KCMP_FILES     = 2
+	KCMP_FS        = 3
+	KCMP_SIGHAND   = 4
+	KCMP_IO        = 5
+	KCMP_SYSVSEM   = 6
+	KCMP_EPOLL_TFD = 7
+)
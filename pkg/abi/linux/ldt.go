@@ -0,0 +1,144 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// LDT limits, from arch/x86/include/uapi/asm/ldt.h.
+const (
+	// LDT_ENTRIES is the maximum number of LDT entries supported.
+	LDT_ENTRIES = 8192
+
+	// LDT_ENTRY_SIZE is the size of each LDT entry in bytes.
+	LDT_ENTRY_SIZE = 8
+)
+
+// modify_ldt(2) functions. These are unnamed in Linux; see
+// arch/x86/kernel/ldt.c:SYSCALL_DEFINE3(modify_ldt).
+const (
+	// MODIFY_LDT_READ copies out the LDT.
+	MODIFY_LDT_READ = 0
+
+	// MODIFY_LDT_WRITE_OLD writes an LDT entry using legacy semantics.
+	MODIFY_LDT_WRITE_OLD = 1
+
+	// MODIFY_LDT_READ_DEFAULT copies out the (zeroed) default LDT.
+	MODIFY_LDT_READ_DEFAULT = 2
+
+	// MODIFY_LDT_WRITE writes an LDT entry.
+	MODIFY_LDT_WRITE = 0x11
+)
+
+// Segment contents, for UserDesc.Contents().
+const (
+	MODIFY_LDT_CONTENTS_DATA  = 0
+	MODIFY_LDT_CONTENTS_STACK = 1
+	MODIFY_LDT_CONTENTS_CODE  = 2
+)
+
+// UserDesc is equivalent to struct user_desc, from
+// arch/x86/include/uapi/asm/ldt.h.
+type UserDesc struct {
+	EntryNumber uint32
+	BaseAddr    uint32
+	Limit       uint32
+
+	// Flags holds the bitfields following limit in struct user_desc; use the
+	// accessor methods below.
+	Flags uint32
+}
+
+// SizeOfUserDesc is the size of a UserDesc struct.
+const SizeOfUserDesc = 16
+
+// Bit positions of UserDesc.Flags fields.
+const (
+	userDescSeg32Bit      = 1 << 0
+	userDescContentsShift = 1
+	userDescContentsMask  = 0x3 << userDescContentsShift
+	userDescReadExecOnly  = 1 << 3
+	userDescLimitInPages  = 1 << 4
+	userDescSegNotPresent = 1 << 5
+	userDescUseable       = 1 << 6
+	userDescLM            = 1 << 7
+)
+
+// Seg32Bit returns the seg_32bit field.
+func (u *UserDesc) Seg32Bit() bool {
+	return u.Flags&userDescSeg32Bit != 0
+}
+
+// Contents returns the contents field.
+func (u *UserDesc) Contents() uint32 {
+	return (u.Flags & userDescContentsMask) >> userDescContentsShift
+}
+
+// ReadExecOnly returns the read_exec_only field.
+func (u *UserDesc) ReadExecOnly() bool {
+	return u.Flags&userDescReadExecOnly != 0
+}
+
+// LimitInPages returns the limit_in_pages field.
+func (u *UserDesc) LimitInPages() bool {
+	return u.Flags&userDescLimitInPages != 0
+}
+
+// SegNotPresent returns the seg_not_present field.
+func (u *UserDesc) SegNotPresent() bool {
+	return u.Flags&userDescSegNotPresent != 0
+}
+
+// Useable returns the useable field.
+func (u *UserDesc) Useable() bool {
+	return u.Flags&userDescUseable != 0
+}
+
+// LM returns the lm field.
+func (u *UserDesc) LM() bool {
+	return u.Flags&userDescLM != 0
+}
+
+// SetFlags sets all bitfields of u.
+func (u *UserDesc) SetFlags(seg32Bit bool, contents uint32, readExecOnly, limitInPages, segNotPresent, useable bool) {
+	var f uint32
+	if seg32Bit {
+		f |= userDescSeg32Bit
+	}
+	f |= (contents << userDescContentsShift) & userDescContentsMask
+	if readExecOnly {
+		f |= userDescReadExecOnly
+	}
+	if limitInPages {
+		f |= userDescLimitInPages
+	}
+	if segNotPresent {
+		f |= userDescSegNotPresent
+	}
+	if useable {
+		f |= userDescUseable
+	}
+	u.Flags = f
+}
+
+// Empty returns true if u describes an empty descriptor, as for Linux's
+// LDT_empty().
+func (u *UserDesc) Empty() bool {
+	return u.BaseAddr == 0 &&
+		u.Limit == 0 &&
+		u.Contents() == 0 &&
+		u.ReadExecOnly() &&
+		!u.Seg32Bit() &&
+		!u.LimitInPages() &&
+		u.SegNotPresent() &&
+		!u.Useable()
+}
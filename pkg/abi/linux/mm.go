@@ -29,6 +29,8 @@ const (
 const (
 	MAP_SHARED     = 1 << 0
 	MAP_PRIVATE    = 1 << 1
+	MAP_DROPPABLE  = 1 << 3
+	MAP_TYPE       = 0xf
 	MAP_FIXED      = 1 << 4
 	MAP_ANONYMOUS  = 1 << 5
 	MAP_32BIT      = 1 << 6 // arch/x86/include/uapi/asm/mman.h
@@ -41,12 +43,26 @@ const (
 	MAP_NONBLOCK   = 1 << 16
 	MAP_STACK      = 1 << 17
 	MAP_HUGETLB    = 1 << 18
+
+	MAP_FIXED_NOREPLACE = 1 << 20
+)
+
+// Huge page size encoding in mmap(2) flags, from
+// include/uapi/asm-generic/hugetlb_encode.h. The huge page size is
+// 1 << ((flags >> MAP_HUGE_SHIFT) & MAP_HUGE_MASK), or the default huge page
+// size if that field is 0.
+const (
+	MAP_HUGE_SHIFT = 26
+	MAP_HUGE_MASK  = 0x3f
+	MAP_HUGE_2MB   = 21 << MAP_HUGE_SHIFT
+	MAP_HUGE_1GB   = 30 << MAP_HUGE_SHIFT
 )
 
 // Flags for mremap(2).
 const (
-	MREMAP_MAYMOVE = 1 << 0
-	MREMAP_FIXED   = 1 << 1
+	MREMAP_MAYMOVE   = 1 << 0
+	MREMAP_FIXED     = 1 << 1
+	MREMAP_DONTUNMAP = 1 << 2
 )
 
 // Flags for mlock2(2).
@@ -68,6 +84,7 @@ const (
 	MADV_SEQUENTIAL   = 2
 	MADV_WILLNEED     = 3
 	MADV_DONTNEED     = 4
+	MADV_FREE         = 8
 	MADV_REMOVE       = 9
 	MADV_DONTFORK     = 10
 	MADV_DOFORK       = 11
@@ -90,7 +107,7 @@ const (
 	MS_SYNC       = 1 << 2
 )
 
-// Policies for get_mempolicy(2)/set_mempolicy(2).
+// Policies for get_mempolicy(2)/set_mempolicy(2)/mbind(2).
 const (
 	MPOL_DEFAULT    = 0
 	MPOL_PREFERRED  = 1
@@ -114,3 +131,12 @@ const (
 
 	MPOL_MODE_FLAGS = (MPOL_F_STATIC_NODES | MPOL_F_RELATIVE_NODES)
 )
+
+// Flags for mbind(2).
+const (
+	MPOL_MF_STRICT   = 1 << 0
+	MPOL_MF_MOVE     = 1 << 1
+	MPOL_MF_MOVE_ALL = 1 << 2
+
+	MPOL_MF_VALID = (MPOL_MF_STRICT | MPOL_MF_MOVE | MPOL_MF_MOVE_ALL)
+)
@@ -0,0 +1,46 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Socket options from uapi/linux/mptcp.h.
+const (
+	MPTCP_INFO = 1
+)
+
+// Flags of MPTCPInfo, from uapi/linux/mptcp.h.
+const (
+	MPTCP_INFO_FLAG_FALLBACK            = 1 << 0
+	MPTCP_INFO_FLAG_REMOTE_KEY_RECEIVED = 1 << 1
+)
+
+// MPTCPInfo is struct mptcp_info, from uapi/linux/mptcp.h.
+type MPTCPInfo struct {
+	Subflows           uint8
+	AddAddrSignal      uint8
+	AddAddrAccepted    uint8
+	SubflowsMax        uint8
+	AddAddrSignalMax   uint8
+	AddAddrAcceptedMax uint8
+	_                  [2]byte // Pad Flags to 32 bits.
+	Flags              uint32
+	Token              uint32
+	WriteSeq           uint64
+	SndUna             uint64
+	RcvNxt             uint64
+	LocalAddrUsed      uint8
+	LocalAddrMax       uint8
+	CsumEnabled        uint8
+	_                  [5]byte // Pad to sizeof(struct mptcp_info).
+}
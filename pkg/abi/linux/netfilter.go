@@ -0,0 +1,149 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// NetFilterGenericMessage is struct nfgenmsg, from
+// uapi/linux/netfilter/nfnetlink.h.
+type NetFilterGenericMessage struct {
+	Family  uint8
+	Version uint8
+
+	// ResID is the resource ID, in network byte order.
+	ResID uint16
+}
+
+// NetFilterGenericMessageSize is the size of NetFilterGenericMessage.
+const NetFilterGenericMessageSize = 4
+
+// NFNETLINK_V0 is the version of nfnetlink, from
+// uapi/linux/netfilter/nfnetlink.h.
+const NFNETLINK_V0 = 0
+
+// Subsystems of nfnetlink, from uapi/linux/netfilter/nfnetlink.h. The
+// subsystem is the high byte of the message type.
+const (
+	NFNL_SUBSYS_NONE          = 0
+	NFNL_SUBSYS_CTNETLINK     = 1
+	NFNL_SUBSYS_CTNETLINK_EXP = 2
+)
+
+// Conntrack messages of the NFNL_SUBSYS_CTNETLINK subsystem, the low byte of
+// the message type, from uapi/linux/netfilter/nfnetlink_conntrack.h.
+const (
+	IPCTNL_MSG_CT_NEW             = 0
+	IPCTNL_MSG_CT_GET             = 1
+	IPCTNL_MSG_CT_DELETE          = 2
+	IPCTNL_MSG_CT_GET_CTRZERO     = 3
+	IPCTNL_MSG_CT_GET_STATS_CPU   = 4
+	IPCTNL_MSG_CT_GET_STATS       = 5
+	IPCTNL_MSG_CT_GET_DYING       = 6
+	IPCTNL_MSG_CT_GET_UNCONFIRMED = 7
+)
+
+// Conntrack attributes, from uapi/linux/netfilter/nfnetlink_conntrack.h.
+const (
+	CTA_UNSPEC         = 0
+	CTA_TUPLE_ORIG     = 1
+	CTA_TUPLE_REPLY    = 2
+	CTA_STATUS         = 3
+	CTA_PROTOINFO      = 4
+	CTA_HELP           = 5
+	CTA_NAT_SRC        = 6
+	CTA_TIMEOUT        = 7
+	CTA_MARK           = 8
+	CTA_COUNTERS_ORIG  = 9
+	CTA_COUNTERS_REPLY = 10
+	CTA_USE            = 11
+	CTA_ID             = 12
+	CTA_NAT_DST        = 13
+	CTA_TUPLE_MASTER   = 14
+	CTA_SEQ_ADJ_ORIG   = 15
+	CTA_SEQ_ADJ_REPLY  = 16
+	CTA_SECMARK        = 17
+	CTA_ZONE           = 18
+)
+
+// Conntrack tuple attributes, nested in CTA_TUPLE_*, from
+// uapi/linux/netfilter/nfnetlink_conntrack.h.
+const (
+	CTA_TUPLE_UNSPEC = 0
+	CTA_TUPLE_IP     = 1
+	CTA_TUPLE_PROTO  = 2
+	CTA_TUPLE_ZONE   = 3
+)
+
+// Conntrack tuple address attributes, nested in CTA_TUPLE_IP, from
+// uapi/linux/netfilter/nfnetlink_conntrack.h.
+const (
+	CTA_IP_UNSPEC = 0
+	CTA_IP_V4_SRC = 1
+	CTA_IP_V4_DST = 2
+	CTA_IP_V6_SRC = 3
+	CTA_IP_V6_DST = 4
+)
+
+// Conntrack tuple protocol attributes, nested in CTA_TUPLE_PROTO, from
+// uapi/linux/netfilter/nfnetlink_conntrack.h.
+const (
+	CTA_PROTO_UNSPEC      = 0
+	CTA_PROTO_NUM         = 1
+	CTA_PROTO_SRC_PORT    = 2
+	CTA_PROTO_DST_PORT    = 3
+	CTA_PROTO_ICMP_ID     = 4
+	CTA_PROTO_ICMP_TYPE   = 5
+	CTA_PROTO_ICMP_CODE   = 6
+	CTA_PROTO_ICMPV6_ID   = 7
+	CTA_PROTO_ICMPV6_TYPE = 8
+	CTA_PROTO_ICMPV6_CODE = 9
+)
+
+// Conntrack protocol information attributes, nested in CTA_PROTOINFO, from
+// uapi/linux/netfilter/nfnetlink_conntrack.h.
+const (
+	CTA_PROTOINFO_UNSPEC = 0
+	CTA_PROTOINFO_TCP    = 1
+)
+
+// Conntrack TCP information attributes, nested in CTA_PROTOINFO_TCP, from
+// uapi/linux/netfilter/nfnetlink_conntrack.h.
+const (
+	CTA_PROTOINFO_TCP_UNSPEC          = 0
+	CTA_PROTOINFO_TCP_STATE           = 1
+	CTA_PROTOINFO_TCP_WSCALE_ORIGINAL = 2
+	CTA_PROTOINFO_TCP_WSCALE_REPLY    = 3
+	CTA_PROTOINFO_TCP_FLAGS_ORIGINAL  = 4
+	CTA_PROTOINFO_TCP_FLAGS_REPLY     = 5
+)
+
+// Conntrack status bits, from uapi/linux/netfilter/nf_conntrack_common.h.
+const (
+	IPS_EXPECTED   = 1 << 0
+	IPS_SEEN_REPLY = 1 << 1
+	IPS_ASSURED    = 1 << 2
+	IPS_CONFIRMED  = 1 << 3
+)
+
+// Conntrack TCP states, from uapi/linux/netfilter/nf_conntrack_tcp.h.
+const (
+	TCP_CONNTRACK_NONE        = 0
+	TCP_CONNTRACK_SYN_SENT    = 1
+	TCP_CONNTRACK_SYN_RECV    = 2
+	TCP_CONNTRACK_ESTABLISHED = 3
+	TCP_CONNTRACK_FIN_WAIT    = 4
+	TCP_CONNTRACK_CLOSE_WAIT  = 5
+	TCP_CONNTRACK_LAST_ACK    = 6
+	TCP_CONNTRACK_TIME_WAIT   = 7
+	TCP_CONNTRACK_CLOSE       = 8
+)
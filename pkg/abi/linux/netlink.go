@@ -90,6 +90,12 @@ const (
 	NLMSG_MIN_TYPE = 0x10
 )
 
+// NetlinkErrorMessage is struct nlmsgerr, from uapi/linux/netlink.h.
+type NetlinkErrorMessage struct {
+	Error  int32
+	Header NetlinkMessageHeader
+}
+
 // NLMSG_ALIGNTO is the alignment of netlink messages, from
 // uapi/linux/netlink.h.
 const NLMSG_ALIGNTO = 4
@@ -109,6 +115,15 @@ const NetlinkAttrHeaderSize = 4
 // uapi/linux/netlink.h.
 const NLA_ALIGNTO = 4
 
+// Netlink attribute type flags, from uapi/linux/netlink.h.
+const (
+	NLA_F_NESTED        = 1 << 15
+	NLA_F_NET_BYTEORDER = 1 << 14
+
+	// NLA_TYPE_MASK masks the flags out of attribute types.
+	NLA_TYPE_MASK = 0x3fff
+)
+
 // Socket options, from uapi/linux/netlink.h.
 const (
 	NETLINK_ADD_MEMBERSHIP   = 1
@@ -94,6 +94,9 @@ type InterfaceInfoMessage struct {
 	Change  uint32
 }
 
+// InterfaceInfoMessageSize is the size of InterfaceInfoMessage.
+const InterfaceInfoMessageSize = 16
+
 // Interface flags, from uapi/linux/if.h.
 const (
 	IFF_UP          = 1 << 0
@@ -163,6 +166,62 @@ const (
 	IFLA_GSO_MAX_SIZE    = 41
 )
 
+// Interface link info attributes, nested in IFLA_LINKINFO, from
+// uapi/linux/if_link.h.
+const (
+	IFLA_INFO_UNSPEC     = 0
+	IFLA_INFO_KIND       = 1
+	IFLA_INFO_DATA       = 2
+	IFLA_INFO_XSTATS     = 3
+	IFLA_INFO_SLAVE_KIND = 4
+	IFLA_INFO_SLAVE_DATA = 5
+)
+
+// GRE link attributes, nested in IFLA_INFO_DATA, from uapi/linux/if_tunnel.h.
+const (
+	IFLA_GRE_UNSPEC   = 0
+	IFLA_GRE_LINK     = 1
+	IFLA_GRE_IFLAGS   = 2
+	IFLA_GRE_OFLAGS   = 3
+	IFLA_GRE_IKEY     = 4
+	IFLA_GRE_OKEY     = 5
+	IFLA_GRE_LOCAL    = 6
+	IFLA_GRE_REMOTE   = 7
+	IFLA_GRE_TTL      = 8
+	IFLA_GRE_TOS      = 9
+	IFLA_GRE_PMTUDISC = 10
+)
+
+// GRE flags of IFLA_GRE_IFLAGS and IFLA_GRE_OFLAGS, in network byte order,
+// from uapi/linux/if_tunnel.h.
+const (
+	GRE_CSUM = 0x8000
+	GRE_KEY  = 0x2000
+	GRE_SEQ  = 0x1000
+)
+
+// VXLAN link attributes, nested in IFLA_INFO_DATA, from uapi/linux/if_link.h.
+const (
+	IFLA_VXLAN_UNSPEC     = 0
+	IFLA_VXLAN_ID         = 1
+	IFLA_VXLAN_GROUP      = 2
+	IFLA_VXLAN_LINK       = 3
+	IFLA_VXLAN_LOCAL      = 4
+	IFLA_VXLAN_TTL        = 5
+	IFLA_VXLAN_TOS        = 6
+	IFLA_VXLAN_LEARNING   = 7
+	IFLA_VXLAN_AGEING     = 8
+	IFLA_VXLAN_LIMIT      = 9
+	IFLA_VXLAN_PORT_RANGE = 10
+	IFLA_VXLAN_PROXY      = 11
+	IFLA_VXLAN_RSC        = 12
+	IFLA_VXLAN_L2MISS     = 13
+	IFLA_VXLAN_L3MISS     = 14
+	IFLA_VXLAN_PORT       = 15
+	IFLA_VXLAN_GROUP6     = 16
+	IFLA_VXLAN_LOCAL6     = 17
+)
+
 // InterfaceAddrMessage is struct ifaddrmsg, from uapi/linux/if_addr.h.
 type InterfaceAddrMessage struct {
 	Family    uint8
@@ -172,6 +231,9 @@ type InterfaceAddrMessage struct {
 	Index     uint32
 }
 
+// InterfaceAddrMessageSize is the size of InterfaceAddrMessage.
+const InterfaceAddrMessageSize = 8
+
 // Interface attributes, from uapi/linux/if_addr.h.
 const (
 	IFA_UNSPEC    = 0
@@ -187,5 +249,36 @@ const (
 
 // Device types, from uapi/linux/if_arp.h.
 const (
+	ARPHRD_ETHER    = 1
 	ARPHRD_LOOPBACK = 772
+	ARPHRD_IPGRE    = 778
+	ARPHRD_IP6GRE   = 823
+	ARPHRD_NONE     = 0xfffe
+)
+
+// TrafficControlMessage is struct tcmsg, from uapi/linux/rtnetlink.h.
+type TrafficControlMessage struct {
+	Family   uint8
+	Padding1 uint8
+	Padding2 uint16
+	Index    int32
+	Handle   uint32
+	Parent   uint32
+	Info     uint32
+}
+
+// TrafficControlMessageSize is the size of TrafficControlMessage.
+const TrafficControlMessageSize = 20
+
+// Traffic control attributes, from uapi/linux/rtnetlink.h.
+const (
+	TCA_UNSPEC  = 0
+	TCA_KIND    = 1
+	TCA_OPTIONS = 2
+	TCA_STATS   = 3
+	TCA_XSTATS  = 4
+	TCA_RATE    = 5
+	TCA_FCNT    = 6
+	TCA_STATS2  = 7
+	TCA_STAB    = 8
 )
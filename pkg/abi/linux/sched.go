@@ -28,3 +28,35 @@ const (
 	// reverted back to SCHED_NORMAL on fork.
 	SCHED_RESET_ON_FORK = 0x40000000
 )
+
+// I/O scheduling classes, exposed by ioprio_get(2)/ioprio_set(2).
+const (
+	IOPRIO_CLASS_NONE = 0
+	IOPRIO_CLASS_RT   = 1
+	IOPRIO_CLASS_BE   = 2
+	IOPRIO_CLASS_IDLE = 3
+)
+
+// I/O priority encoding, from include/linux/ioprio.h. An I/O priority is
+// the class shifted left by IOPRIO_CLASS_SHIFT, or'd with class-specific
+// data, which is a level between 0 (highest) and IOPRIO_BE_NR-1 (lowest)
+// for IOPRIO_CLASS_RT and IOPRIO_CLASS_BE.
+const (
+	IOPRIO_CLASS_SHIFT = 13
+	IOPRIO_PRIO_MASK   = (1 << IOPRIO_CLASS_SHIFT) - 1
+
+	// IOPRIO_BE_NR is the number of levels of IOPRIO_CLASS_RT and
+	// IOPRIO_CLASS_BE.
+	IOPRIO_BE_NR = 8
+
+	// IOPRIO_NORM is the level of IOPRIO_CLASS_BE that tasks without an
+	// explicit I/O priority are treated as.
+	IOPRIO_NORM = 4
+)
+
+// Targets of ioprio_get(2)/ioprio_set(2).
+const (
+	IOPRIO_WHO_PROCESS = 1
+	IOPRIO_WHO_PGRP    = 2
+	IOPRIO_WHO_USER    = 3
+)
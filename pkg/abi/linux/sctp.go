@@ -0,0 +1,64 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Socket options from uapi/linux/sctp.h.
+const (
+	SCTP_RTOINFO        = 0
+	SCTP_ASSOCINFO      = 1
+	SCTP_INITMSG        = 2
+	SCTP_NODELAY        = 3
+	SCTP_PR_SUPPORTED   = 113
+	SCTP_DEFAULT_PRINFO = 114
+)
+
+// PR-SCTP policies from uapi/linux/sctp.h.
+const (
+	SCTP_PR_SCTP_NONE = 0x0000
+	SCTP_PR_SCTP_TTL  = 0x0010
+	SCTP_PR_SCTP_RTX  = 0x0020
+)
+
+// SCTPRTOInfo is struct sctp_rtoinfo, from uapi/linux/sctp.h. Timeouts are in
+// milliseconds.
+type SCTPRTOInfo struct {
+	AssocID int32
+	Initial uint32
+	Max     uint32
+	Min     uint32
+}
+
+// SCTPInitMsg is struct sctp_initmsg, from uapi/linux/sctp.h. MaxInitTimeout
+// is in milliseconds.
+type SCTPInitMsg struct {
+	NumOstreams    uint16
+	MaxInstreams   uint16
+	MaxAttempts    uint16
+	MaxInitTimeout uint16
+}
+
+// SCTPAssocValue is struct sctp_assoc_value, from uapi/linux/sctp.h.
+type SCTPAssocValue struct {
+	AssocID int32
+	Value   uint32
+}
+
+// SCTPDefaultPRInfo is struct sctp_default_prinfo, from uapi/linux/sctp.h.
+type SCTPDefaultPRInfo struct {
+	AssocID int32
+	Value   uint32
+	Policy  uint16
+	_       [2]byte
+}
@@ -34,6 +34,22 @@ const (
 
 const SEM_UNDO = 0x1000
 
+// Semaphore defaults as specified by Linux. Source: include/uapi/linux/sem.h
+const (
+	SEMMNI = 32000
+	SEMMSL = 32000
+	SEMMNS = SEMMNI * SEMMSL
+	SEMOPM = 500
+	SEMVMX = 32767
+	SEMAEM = SEMVMX
+
+	// Unused.
+	SEMUME = SEMOPM
+	SEMMNU = SEMMNS
+	SEMMAP = SEMMNS
+	SEMUSZ = 20
+)
+
 // SemidDS is equivalent to struct semid64_ds.
 type SemidDS struct {
 	SemPerm  IPCPerm
@@ -44,6 +60,20 @@ type SemidDS struct {
 	unused4  uint64
 }
 
+// SemInfo is equivalent to struct seminfo.
+type SemInfo struct {
+	SemMap int32
+	SemMni int32
+	SemMns int32
+	SemMnu int32
+	SemMsl int32
+	SemOpm int32
+	SemUme int32
+	SemUsz int32
+	SemVmx int32
+	SemAem int32
+}
+
 // Sembuf is equivalent to struct sembuf.
 type Sembuf struct {
 	SemNum uint16
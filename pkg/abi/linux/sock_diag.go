@@ -0,0 +1,142 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Message types of NETLINK_SOCK_DIAG, from uapi/linux/sock_diag.h.
+const (
+	SOCK_DIAG_BY_FAMILY = 20
+	SOCK_DESTROY        = 21
+)
+
+// SockDiagRequest is the header shared by the requests of all families, struct
+// sock_diag_req from uapi/linux/sock_diag.h.
+type SockDiagRequest struct {
+	Family   uint8
+	Protocol uint8
+}
+
+// SockDiagRequestSize is the size of SockDiagRequest.
+const SockDiagRequestSize = 2
+
+// InetDiagSockID is struct inet_diag_sockid, from uapi/linux/inet_diag.h. Ports
+// and addresses are in network byte order; IPv4 addresses use the first four
+// bytes of Src and Dst.
+type InetDiagSockID struct {
+	SrcPort   [2]byte
+	DstPort   [2]byte
+	Src       [16]byte
+	Dst       [16]byte
+	Interface uint32
+	Cookie    [2]uint32
+}
+
+// InetDiagRequestV2 is struct inet_diag_req_v2, from uapi/linux/inet_diag.h.
+type InetDiagRequestV2 struct {
+	Family   uint8
+	Protocol uint8
+	Ext      uint8
+	Pad      uint8
+	States   uint32
+	ID       InetDiagSockID
+}
+
+// InetDiagRequestV2Size is the size of InetDiagRequestV2.
+const InetDiagRequestV2Size = 56
+
+// InetDiagMessage is struct inet_diag_msg, from uapi/linux/inet_diag.h.
+type InetDiagMessage struct {
+	Family  uint8
+	State   uint8
+	Timer   uint8
+	Retrans uint8
+	ID      InetDiagSockID
+	Expires uint32
+	RQueue  uint32
+	WQueue  uint32
+	UID     uint32
+	Inode   uint32
+}
+
+// Attributes of InetDiagMessage, from uapi/linux/inet_diag.h. Attribute
+// INET_DIAG_X is requested by bit 1<<(INET_DIAG_X-1) of
+// InetDiagRequestV2.Ext.
+const (
+	INET_DIAG_NONE      = 0
+	INET_DIAG_MEMINFO   = 1
+	INET_DIAG_INFO      = 2
+	INET_DIAG_VEGASINFO = 3
+	INET_DIAG_CONG      = 4
+	INET_DIAG_TOS       = 5
+	INET_DIAG_TCLASS    = 6
+	INET_DIAG_SKMEMINFO = 7
+	INET_DIAG_SHUTDOWN  = 8
+)
+
+// INET_DIAG_NOCOOKIE is the cookie of requests that don't match on cookies,
+// from uapi/linux/inet_diag.h.
+const INET_DIAG_NOCOOKIE = ^uint32(0)
+
+// UnixDiagRequest is struct unix_diag_req, from uapi/linux/unix_diag.h.
+type UnixDiagRequest struct {
+	Family   uint8
+	Protocol uint8
+	Pad      uint16
+	States   uint32
+	Inode    uint32
+	Show     uint32
+	Cookie   [2]uint32
+}
+
+// UnixDiagRequestSize is the size of UnixDiagRequest.
+const UnixDiagRequestSize = 24
+
+// Flags of UnixDiagRequest.Show, from uapi/linux/unix_diag.h.
+const (
+	UDIAG_SHOW_NAME    = 0x01
+	UDIAG_SHOW_VFS     = 0x02
+	UDIAG_SHOW_PEER    = 0x04
+	UDIAG_SHOW_ICONS   = 0x08
+	UDIAG_SHOW_RQLEN   = 0x10
+	UDIAG_SHOW_MEMINFO = 0x20
+	UDIAG_SHOW_UID     = 0x40
+)
+
+// UnixDiagMessage is struct unix_diag_msg, from uapi/linux/unix_diag.h.
+type UnixDiagMessage struct {
+	Family uint8
+	Type   uint8
+	State  uint8
+	Pad    uint8
+	Inode  uint32
+	Cookie [2]uint32
+}
+
+// Attributes of UnixDiagMessage, from uapi/linux/unix_diag.h.
+const (
+	UNIX_DIAG_NAME     = 0
+	UNIX_DIAG_VFS      = 1
+	UNIX_DIAG_PEER     = 2
+	UNIX_DIAG_ICONS    = 3
+	UNIX_DIAG_RQLEN    = 4
+	UNIX_DIAG_MEMINFO  = 5
+	UNIX_DIAG_SHUTDOWN = 6
+	UNIX_DIAG_UID      = 7
+)
+
+// UnixDiagRQLen is struct unix_diag_rqlen, from uapi/linux/unix_diag.h.
+type UnixDiagRQLen struct {
+	RQueue uint32
+	WQueue uint32
+}
@@ -97,9 +97,11 @@ const (
 	SOL_UDP     = 17
 	SOL_IPV6    = 41
 	SOL_ICMPV6  = 58
+	SOL_SCTP    = 132
 	SOL_RAW     = 255
 	SOL_PACKET  = 263
 	SOL_NETLINK = 270
+	SOL_MPTCP   = 284
 )
 
 // Socket types, from linux/net.h.
@@ -191,6 +193,22 @@ const (
 	SO_TXTIME                = 61
 )
 
+// Indices of the values returned by SO_MEMINFO, from uapi/linux/sock_diag.h.
+const (
+	SK_MEMINFO_RMEM_ALLOC  = 0
+	SK_MEMINFO_RCVBUF      = 1
+	SK_MEMINFO_WMEM_ALLOC  = 2
+	SK_MEMINFO_SNDBUF      = 3
+	SK_MEMINFO_FWD_ALLOC   = 4
+	SK_MEMINFO_WMEM_QUEUED = 5
+	SK_MEMINFO_OPTMEM      = 6
+	SK_MEMINFO_BACKLOG     = 7
+	SK_MEMINFO_DROPS       = 8
+
+	// SK_MEMINFO_VARS is the number of values returned by SO_MEMINFO.
+	SK_MEMINFO_VARS = 9
+)
+
 // enum socket_state, from uapi/linux/net.h.
 const (
 	SS_FREE          = 0 // Not allocated.
@@ -368,6 +386,30 @@ const SizeOfControlMessageRight = 4
 // From net/scm.h.
 const SCM_MAX_FD = 253
 
+// Origins of extended socket errors, from uapi/linux/errqueue.h.
+const (
+	SO_EE_ORIGIN_NONE  = 0
+	SO_EE_ORIGIN_LOCAL = 1
+	SO_EE_ORIGIN_ICMP  = 2
+	SO_EE_ORIGIN_ICMP6 = 3
+)
+
+// SockExtendedErr is the header of an IP_RECVERR or IPV6_RECVERR socket
+// control message, which is followed by the address of the node that
+// reported the error.
+//
+// SockExtendedErr represents struct sock_extended_err from
+// uapi/linux/errqueue.h.
+type SockExtendedErr struct {
+	Errno  uint32
+	Origin uint8
+	Type   uint8
+	Code   uint8
+	Pad    uint8
+	Info   uint32
+	Data   uint32
+}
+
 // SO_ACCEPTCON is defined as __SO_ACCEPTCON in
 // include/uapi/linux/net.h, which represents a listening socket
 // state. Note that this is distinct from SO_ACCEPTCONN, which is a
@@ -58,3 +58,57 @@ const (
 	MAX_TCP_KEEPIDLE  = 32767
 	MAX_TCP_KEEPINTVL = 32767
 )
+
+// TCP connection states, from include/net/tcp_states.h.
+const (
+	TCP_ESTABLISHED = 1
+	TCP_SYN_SENT    = 2
+	TCP_SYN_RECV    = 3
+	TCP_FIN_WAIT1   = 4
+	TCP_FIN_WAIT2   = 5
+	TCP_TIME_WAIT   = 6
+	TCP_CLOSE       = 7
+	TCP_CLOSE_WAIT  = 8
+	TCP_LAST_ACK    = 9
+	TCP_LISTEN      = 10
+	TCP_CLOSING     = 11
+)
+
+// Congestion avoidance states of TCPInfo.CaState, from uapi/linux/tcp.h.
+const (
+	TCP_CA_Open     = 0
+	TCP_CA_Disorder = 1
+	TCP_CA_CWR      = 2
+	TCP_CA_Recovery = 3
+	TCP_CA_Loss     = 4
+)
+
+// Flags of TCPInfo.Options, from uapi/linux/tcp.h.
+const (
+	TCPI_OPT_TIMESTAMPS = 1
+	TCPI_OPT_SACK       = 2
+	TCPI_OPT_WSCALE     = 4
+	TCPI_OPT_ECN        = 8
+	TCPI_OPT_ECN_SEEN   = 16
+	TCPI_OPT_SYN_DATA   = 32
+)
+
+// TCPMD5SigMaxKeyLen is the maximum length of a TCP MD5 signature key, from
+// uapi/linux/tcp.h.
+const TCPMD5SigMaxKeyLen = 80
+
+// Flags of TCPMD5Sig.Flags, from uapi/linux/tcp.h.
+const (
+	TCP_MD5SIG_FLAG_PREFIX  = 1
+	TCP_MD5SIG_FLAG_IFINDEX = 2
+)
+
+// TCPMD5Sig is struct tcp_md5sig, from uapi/linux/tcp.h.
+type TCPMD5Sig struct {
+	Addr      [SockAddrMax]byte
+	Flags     uint8
+	Prefixlen uint8
+	Keylen    uint16
+	Ifindex   int32
+	Key       [TCPMD5SigMaxKeyLen]byte
+}
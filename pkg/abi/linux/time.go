@@ -70,6 +70,8 @@ const (
 	CLOCK_BOOTTIME           = 7
 	CLOCK_REALTIME_ALARM     = 8
 	CLOCK_BOOTTIME_ALARM     = 9
+	CLOCK_SGI_CYCLE          = 10
+	CLOCK_TAI                = 11
 )
 
 // Flags for clock_nanosleep(2).
@@ -87,6 +89,9 @@ const (
 
 	// TFD_TIMER_ABSTIME is a timerfd_settime flag.
 	TFD_TIMER_ABSTIME = 1
+
+	// TFD_TIMER_CANCEL_ON_SET is a timerfd_settime flag.
+	TFD_TIMER_CANCEL_ON_SET = 2
 )
 
 // The safe number of seconds you can represent by int64.
@@ -280,6 +280,26 @@ const (
 	VEOL2    = 16
 )
 
+// Packet mode status bits, returned by reads from a pty master in packet mode
+// (TIOCPKT). From uapi/asm-generic/ioctls.h.
+const (
+	TIOCPKT_DATA       = 0
+	TIOCPKT_FLUSHREAD  = 1
+	TIOCPKT_FLUSHWRITE = 2
+	TIOCPKT_STOP       = 4
+	TIOCPKT_START      = 8
+	TIOCPKT_NOSTOP     = 16
+	TIOCPKT_DOSTOP     = 32
+	TIOCPKT_IOCTL      = 64
+)
+
+// Queue selectors for TCFLSH. From uapi/asm-generic/termbits.h.
+const (
+	TCIFLUSH  = 0
+	TCOFLUSH  = 1
+	TCIOFLUSH = 2
+)
+
 // ControlCharacter returns the termios-style control character for the passed
 // character.
 //
@@ -13,7 +13,8 @@
 // limitations under the License.
 
 // Package compressio provides parallel compression and decompression, as well
-// as optional SHA-256 hashing.
+// as optional SHA-256 hashing. Chunks are compressed with DEFLATE by default,
+// or with Zstandard. The algorithm is not recorded in the stream.
 //
 // The stream format is defined as follows.
 //
@@ -54,9 +55,23 @@ import (
 	"runtime"
 	"sync"
 
+	"github.com/klauspost/compress/zstd"
 	"gvisor.googlesource.com/gvisor/pkg/binary"
 )
 
+// Algorithm is a compression algorithm.
+type Algorithm int
+
+const (
+	// Flate compresses chunks with DEFLATE. Levels are those of
+	// compress/flate.
+	Flate Algorithm = iota
+
+	// Zstd compresses chunks with Zstandard, which is both faster and
+	// compresses better than Flate. Levels are zstd.EncoderLevel values.
+	Zstd
+)
+
 var bufPool = sync.Pool{
 	New: func() interface{} {
 		return bytes.NewBuffer(nil)
@@ -133,11 +148,36 @@ type worker struct {
 }
 
 // work is the main work routine; see worker.
-func (w *worker) work(compress bool, level int) {
+func (w *worker) work(compress bool, algorithm Algorithm, level int) {
 	defer close(w.output)
 
 	var h hash.Hash
 
+	// Zstandard encoders and decoders are expensive to create, and are
+	// reused for all chunks handled by this worker.
+	var (
+		zenc *zstd.Encoder
+		zdec *zstd.Decoder
+	)
+	if algorithm == Zstd {
+		var err error
+		if compress {
+			zenc, err = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstd.EncoderLevel(level)))
+		} else {
+			zdec, err = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		}
+		if err != nil {
+			// Fail every chunk.
+			for c := range w.input {
+				w.output <- result{c, err}
+			}
+			return
+		}
+		if zdec != nil {
+			defer zdec.Close()
+		}
+	}
+
 	for c := range w.input {
 		if h == nil && w.hashPool != nil {
 			h = w.hashPool.getHash()
@@ -149,20 +189,28 @@ func (w *worker) work(compress bool, level int) {
 			}
 
 			// Encode this slice.
-			fw, err := flate.NewWriter(mw, level)
-			if err != nil {
-				w.output <- result{c, err}
-				continue
-			}
+			if zenc != nil {
+				if _, err := mw.Write(zenc.EncodeAll(c.uncompressed.Bytes(), nil)); err != nil {
+					w.output <- result{c, err}
+					continue
+				}
+				c.uncompressed.Reset()
+			} else {
+				fw, err := flate.NewWriter(mw, level)
+				if err != nil {
+					w.output <- result{c, err}
+					continue
+				}
 
-			// Encode the input.
-			if _, err := io.CopyN(fw, c.uncompressed, int64(c.uncompressed.Len())); err != nil {
-				w.output <- result{c, err}
-				continue
-			}
-			if err := fw.Close(); err != nil {
-				w.output <- result{c, err}
-				continue
+				// Encode the input.
+				if _, err := io.CopyN(fw, c.uncompressed, int64(c.uncompressed.Len())); err != nil {
+					w.output <- result{c, err}
+					continue
+				}
+				if err := fw.Close(); err != nil {
+					w.output <- result{c, err}
+					continue
+				}
 			}
 
 			// Write the hash, if enabled.
@@ -187,12 +235,21 @@ func (w *worker) work(compress bool, level int) {
 			}
 
 			// Decode this slice.
-			fr := flate.NewReader(c.compressed)
+			if zdec != nil {
+				b, err := zdec.DecodeAll(c.compressed.Bytes(), nil)
+				if err != nil {
+					w.output <- result{c, err}
+					continue
+				}
+				c.uncompressed.Write(b)
+			} else {
+				fr := flate.NewReader(c.compressed)
 
-			// Decode the input.
-			if _, err := io.Copy(c.uncompressed, fr); err != nil {
-				w.output <- result{c, err}
-				continue
+				// Decode the input.
+				if _, err := io.Copy(c.uncompressed, fr); err != nil {
+					w.output <- result{c, err}
+					continue
+				}
 			}
 		}
 
@@ -272,7 +329,7 @@ type pool struct {
 // init initializes the worker pool.
 //
 // This should only be called once.
-func (p *pool) init(key []byte, workers int, compress bool, level int) {
+func (p *pool) init(key []byte, workers int, compress bool, algorithm Algorithm, level int) {
 	if key != nil {
 		p.hashPool = &hashPool{key: key}
 	}
@@ -283,7 +340,7 @@ func (p *pool) init(key []byte, workers int, compress bool, level int) {
 			input:    make(chan *chunk, 1),
 			output:   make(chan result, 1),
 		}
-		go p.workers[i].work(compress, level) // S/R-SAFE: In save path only.
+		go p.workers[i].work(compress, algorithm, level) // S/R-SAFE: In save path only.
 	}
 	runtime.SetFinalizer(p, (*pool).stop)
 }
@@ -359,12 +416,18 @@ type reader struct {
 // hash values computed from the compressed bytes. See package comments for
 // details.
 func NewReader(in io.Reader, key []byte) (io.Reader, error) {
+	return NewReaderAlgorithm(in, key, Flate)
+}
+
+// NewReaderAlgorithm is like NewReader, for a stream compressed with the
+// given algorithm.
+func NewReaderAlgorithm(in io.Reader, key []byte, algorithm Algorithm) (io.Reader, error) {
 	r := &reader{
 		in: in,
 	}
 
 	// Use double buffering for read.
-	r.init(key, 2*runtime.GOMAXPROCS(0), false, 0)
+	r.init(key, 2*runtime.GOMAXPROCS(0), false, algorithm, 0)
 
 	var err error
 	if r.chunkSize, err = binary.ReadUint32(in, binary.BigEndian); err != nil {
@@ -570,6 +633,12 @@ type writer struct {
 // buffered (in the form of read-ahead, or buffered writes), and is limited to
 // O(chunkSize * [1+GOMAXPROCS]).
 func NewWriter(out io.Writer, key []byte, chunkSize uint32, level int) (io.WriteCloser, error) {
+	return NewWriterAlgorithm(out, key, chunkSize, Flate, level)
+}
+
+// NewWriterAlgorithm is like NewWriter, but compresses with the given
+// algorithm. level is specific to the algorithm.
+func NewWriterAlgorithm(out io.Writer, key []byte, chunkSize uint32, algorithm Algorithm, level int) (io.WriteCloser, error) {
 	w := &writer{
 		pool: pool{
 			chunkSize: chunkSize,
@@ -577,7 +646,7 @@ func NewWriter(out io.Writer, key []byte, chunkSize uint32, level int) (io.Write
 		},
 		out: out,
 	}
-	w.init(key, 1+runtime.GOMAXPROCS(0), true, level)
+	w.init(key, 1+runtime.GOMAXPROCS(0), true, algorithm, level)
 
 	if err := binary.WriteUint32(w.out, binary.BigEndian, chunkSize); err != nil {
 		return nil, err
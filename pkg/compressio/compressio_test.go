@@ -24,6 +24,8 @@ import (
 	"runtime"
 	"testing"
 	"time"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 type harness interface {
@@ -188,6 +190,19 @@ func TestCompress(t *testing.T) {
 						},
 						CorruptData: corruptData,
 					})
+
+					// And with Zstandard.
+					doTest(t, testOpts{
+						Name: fmt.Sprintf("len(data)=%d, blockSize=%d, key=%s, corruptData=%v, zstd", len(data), blockSize, string(key), corruptData),
+						Data: data,
+						NewWriter: func(b *bytes.Buffer) (io.Writer, error) {
+							return NewWriterAlgorithm(b, key, blockSize, Zstd, int(zstd.SpeedFastest))
+						},
+						NewReader: func(b *bytes.Buffer) (io.Reader, error) {
+							return NewReaderAlgorithm(b, key, Zstd)
+						},
+						CorruptData: corruptData,
+					})
 				}
 			}
 		}
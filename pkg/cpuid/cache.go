@@ -0,0 +1,131 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build i386 amd64
+
+package cpuid
+
+// CacheType is the type of a cache, as reported by cpuid leaf 4.
+type CacheType uint8
+
+// Types of caches.
+const (
+	// CacheNull indicates that there are no more caches.
+	CacheNull CacheType = iota
+	CacheData
+	CacheInstruction
+	CacheUnified
+)
+
+// String implements fmt.Stringer. The names are the ones used in
+// /sys/devices/system/cpu/cpu*/cache/index*/type.
+func (t CacheType) String() string {
+	switch t {
+	case CacheData:
+		return "Data"
+	case CacheInstruction:
+		return "Instruction"
+	case CacheUnified:
+		return "Unified"
+	default:
+		return "Unknown"
+	}
+}
+
+// Cache describes a CPU cache.
+//
+// +stateify savable
+type Cache struct {
+	// Level is the cache level, starting at 1.
+	Level uint32
+
+	// Type is the cache type.
+	Type CacheType
+
+	// LineSize is the size of a cache line in bytes.
+	LineSize uint32
+
+	// Partitions is the number of physical line partitions.
+	Partitions uint32
+
+	// Ways is the number of ways of associativity.
+	Ways uint32
+
+	// Sets is the number of sets.
+	Sets uint32
+}
+
+// Size returns the size of the cache in bytes.
+func (c *Cache) Size() uint64 {
+	return uint64(c.LineSize) * uint64(c.Partitions) * uint64(c.Ways) * uint64(c.Sets)
+}
+
+// maxCaches bounds the number of cache descriptors read from the host, in case
+// the host never reports a null descriptor.
+const maxCaches = 16
+
+// hostCaches returns the caches of the host CPU. Intel CPUs report them in leaf
+// 4, and AMD CPUs with topology extensions in leaf 0x8000001d, both with the
+// same format. Other CPUs, or CPUs in virtual machines that hide these leaves,
+// report no caches.
+func hostCaches(fs *FeatureSet) []Cache {
+	var leaf uint32
+	switch {
+	case fs.Intel():
+		if ax, _, _, _ := HostID(uint32(vendorID), 0); ax < uint32(intelDeterministicCacheParams) {
+			return nil
+		}
+		leaf = uint32(intelDeterministicCacheParams)
+	case fs.AMD() && fs.HasFeature(X86FeatureTOPOLOGY):
+		if ax, _, _, _ := HostID(uint32(extendedFunctionInfo), 0); ax < uint32(amdCacheTopology) {
+			return nil
+		}
+		leaf = uint32(amdCacheTopology)
+	default:
+		return nil
+	}
+
+	var caches []Cache
+	for i := uint32(0); i < maxCaches; i++ {
+		ax, bx, cx, _ := HostID(leaf, i)
+		t := CacheType(ax & 0x1f)
+		if t == CacheNull {
+			break
+		}
+		caches = append(caches, Cache{
+			Level:      (ax >> 5) & 0x7,
+			Type:       t,
+			LineSize:   (bx & 0xfff) + 1,
+			Partitions: ((bx >> 12) & 0x3ff) + 1,
+			Ways:       ((bx >> 22) & 0x3ff) + 1,
+			Sets:       cx + 1,
+		})
+	}
+	return caches
+}
+
+// LastLevelCacheSize returns the size in bytes of the largest level cache, or
+// 0 if the caches are unknown.
+func (fs *FeatureSet) LastLevelCacheSize() uint64 {
+	var last *Cache
+	for i := range fs.Caches {
+		if c := &fs.Caches[i]; last == nil || c.Level > last.Level {
+			last = c
+		}
+	}
+	if last == nil {
+		return 0
+	}
+	return last.Size()
+}
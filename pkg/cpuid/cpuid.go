@@ -446,6 +446,10 @@ const (
 	extendedFeatures                                       // Returns some extended feature bits in edx and ecx.
 )
 
+// amdCacheTopology returns deterministic cache information in the same format
+// as intelDeterministicCacheParams. AMD only, requires topology extensions.
+const amdCacheTopology cpuidFunction = 0x8000001d
+
 var cpuFreqMHz float64
 
 // x86FeaturesFromString includes features from x86FeatureStrings and
@@ -507,6 +511,10 @@ type FeatureSet struct {
 
 	// SteppingID is part of the processor signature.
 	SteppingID uint8
+
+	// Caches are the caches of each CPU. They are empty if the caches are
+	// unknown.
+	Caches []Cache
 }
 
 // FlagsString prints out supported CPU flags. If cpuinfoOnly is true, it is
@@ -528,7 +536,9 @@ func (fs *FeatureSet) FlagsString(cpuinfoOnly bool) string {
 // CPUInfo is to generate a section of one cpu in /proc/cpuinfo. This is a
 // minimal /proc/cpuinfo, it is missing some fields like "microcode" that are
 // not always printed in Linux. The bogomips field is simply made up.
-func (fs FeatureSet) CPUInfo(cpu uint) string {
+//
+// The topology is a single socket of numCPU cores with one thread each.
+func (fs FeatureSet) CPUInfo(cpu, numCPU uint) string {
 	var b bytes.Buffer
 	fmt.Fprintf(&b, "processor\t: %d\n", cpu)
 	fmt.Fprintf(&b, "vendor_id\t: %s\n", fs.VendorID)
@@ -537,6 +547,15 @@ func (fs FeatureSet) CPUInfo(cpu uint) string {
 	fmt.Fprintf(&b, "model name\t: %s\n", "unknown") // Unknown for now.
 	fmt.Fprintf(&b, "stepping\t: %s\n", "unknown")   // Unknown for now.
 	fmt.Fprintf(&b, "cpu MHz\t\t: %.3f\n", cpuFreqMHz)
+	if size := fs.LastLevelCacheSize(); size > 0 {
+		fmt.Fprintf(&b, "cache size\t: %d KB\n", size/1024)
+	}
+	fmt.Fprintf(&b, "physical id\t: %d\n", 0)
+	fmt.Fprintf(&b, "siblings\t: %d\n", numCPU)
+	fmt.Fprintf(&b, "core id\t\t: %d\n", cpu)
+	fmt.Fprintf(&b, "cpu cores\t: %d\n", numCPU)
+	fmt.Fprintf(&b, "apicid\t\t: %d\n", cpu)
+	fmt.Fprintf(&b, "initial apicid\t: %d\n", cpu)
 	fmt.Fprintln(&b, "fpu\t\t: yes")
 	fmt.Fprintln(&b, "fpu_exception\t: yes")
 	fmt.Fprintf(&b, "cpuid level\t: %d\n", uint32(xSaveInfo)) // Same as ax in vendorID.
@@ -732,6 +751,46 @@ func (fs *FeatureSet) TakeFeatureIntersection(other *FeatureSet) {
 	}
 }
 
+// ApplySpec adds and removes features from fs according to spec, a
+// comma-separated list of feature names as they appear in /proc/cpuinfo. A
+// name prefixed with "-" removes the feature, and a name optionally prefixed
+// with "+" adds it. Features can only be added if they are supported by host,
+// since they cannot be emulated. Removing a feature does not remove the
+// features that depend on it; they must be listed as well (e.g.
+// "-avx512f,-avx512cd").
+//
+// On error, fs is left unchanged.
+func (fs *FeatureSet) ApplySpec(spec string, host *FeatureSet) error {
+	var add, remove []Feature
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		name := strings.TrimLeft(s, "+-")
+		f, ok := FeatureFromString(name)
+		if !ok {
+			return fmt.Errorf("unknown CPU feature %q", name)
+		}
+		if strings.HasPrefix(s, "-") {
+			remove = append(remove, f)
+			continue
+		}
+		if !host.HasFeature(f) {
+			return fmt.Errorf("CPU feature %q is not supported by the host", name)
+		}
+		add = append(add, f)
+	}
+
+	for _, f := range add {
+		fs.Add(f)
+	}
+	for _, f := range remove {
+		fs.Remove(f)
+	}
+	return nil
+}
+
 // EmulateID emulates a cpuid instruction based on the feature set.
 func (fs *FeatureSet) EmulateID(origAx, origCx uint32) (ax, bx, cx, dx uint32) {
 	switch cpuidFunction(origAx) {
@@ -840,7 +899,7 @@ func HostFeatureSet() *FeatureSet {
 	}
 
 	set := setFromBlockMasks(featureBlock0, featureBlock1, featureBlock2, featureBlock3, featureBlock4, featureBlock5, featureBlock6)
-	return &FeatureSet{
+	fs := &FeatureSet{
 		Set:            set,
 		VendorID:       vendorID,
 		ExtendedFamily: ef,
@@ -850,6 +909,8 @@ func HostFeatureSet() *FeatureSet {
 		Model:          m,
 		SteppingID:     sid,
 	}
+	fs.Caches = hostCaches(fs)
+	return fs
 }
 
 // Reads max cpu frequency from host /proc/cpuinfo. Must run before
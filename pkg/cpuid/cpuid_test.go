@@ -249,3 +249,39 @@ func TestEmulateIDExtended(t *testing.T) {
 		t.Errorf("extended feature emulation failed, got feature bits %x want %x", dx, testFeatures.blockMask(6))
 	}
 }
+
+// Checks that ApplySpec adds and removes features, and rejects unknown
+// features and features missing on the host.
+func TestApplySpec(t *testing.T) {
+	host := newEmptyFeatureSet()
+	host.Add(X86FeatureFPU)
+	host.Add(X86FeatureAVX)
+	host.Add(X86FeatureAVX512F)
+
+	fs := newEmptyFeatureSet()
+	fs.Add(X86FeatureFPU)
+	fs.Add(X86FeatureAVX512F)
+	if err := fs.ApplySpec("-avx512f, +avx,", host); err != nil {
+		t.Fatalf("ApplySpec failed: %v", err)
+	}
+	if fs.HasFeature(X86FeatureAVX512F) {
+		t.Errorf("avx512f was not removed")
+	}
+	if !fs.HasFeature(X86FeatureAVX) {
+		t.Errorf("avx was not added")
+	}
+	if !fs.HasFeature(X86FeatureFPU) {
+		t.Errorf("fpu was removed")
+	}
+
+	for _, spec := range []string{"-avx,sse4_2", "nosuchfeature"} {
+		fs := newEmptyFeatureSet()
+		fs.Add(X86FeatureAVX)
+		if err := fs.ApplySpec(spec, host); err == nil {
+			t.Errorf("ApplySpec(%q) succeeded, want error", spec)
+		}
+		if !fs.HasFeature(X86FeatureAVX) {
+			t.Errorf("ApplySpec(%q) modified the feature set on error", spec)
+		}
+	}
+}
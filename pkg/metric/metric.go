@@ -18,6 +18,7 @@ package metric
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"sync"
 	"sync/atomic"
 
@@ -45,8 +46,6 @@ var (
 // Metrics are not saved across save/restore and thus reset to zero on restore.
 //
 // TODO: Support non-cumulative metrics.
-// TODO: Support metric fields.
-//
 type Uint64Metric struct {
 	// value is the actual value of the metric. It must be accessed
 	// atomically.
@@ -65,8 +64,8 @@ var (
 // Initialize sends a metric registration event over the event channel.
 //
 // Precondition:
-//  * All metrics are registered.
-//  * Initialize/Disable has not been called.
+//   - All metrics are registered.
+//   - Initialize/Disable has not been called.
 func Initialize() {
 	if initialized {
 		panic("Initialize/Disable called more than once")
@@ -77,6 +76,12 @@ func Initialize() {
 	for _, v := range allMetrics.m {
 		m.Metrics = append(m.Metrics, v.metadata)
 	}
+	for _, v := range allMetrics.fieldMetrics {
+		m.Metrics = append(m.Metrics, v.metadata)
+	}
+	for _, v := range allMetrics.distributions {
+		m.Metrics = append(m.Metrics, v.metadata)
+	}
 	eventchannel.Emit(&m)
 }
 
@@ -84,8 +89,8 @@ func Initialize() {
 // disabling metric collection.
 //
 // Precondition:
-//  * All metrics are registered.
-//  * Initialize/Disable has not been called.
+//   - All metrics are registered.
+//   - Initialize/Disable has not been called.
 func Disable() {
 	if initialized {
 		panic("Initialize/Disable called more than once")
@@ -115,14 +120,14 @@ type customUint64Metric struct {
 // only increase over time.
 //
 // Preconditions:
-//  * name must be globally unique.
-//  * Initialize/Disable have not been called.
+//   - name must be globally unique.
+//   - Initialize/Disable have not been called.
 func RegisterCustomUint64Metric(name string, sync bool, description string, value func() uint64) error {
 	if initialized {
 		return ErrInitializationDone
 	}
 
-	if _, ok := allMetrics.m[name]; ok {
+	if allMetrics.contains(name) {
 		return ErrNameInUse
 	}
 
@@ -180,29 +185,275 @@ func (m *Uint64Metric) IncrementBy(v uint64) {
 	atomic.AddUint64(&m.value, v)
 }
 
+// Uint64FieldMetric is a set of Uint64Metrics distinguished by a field whose
+// values are small non-negative integers, such as syscall numbers. Values are
+// reported with the field set to the decimal representation of the integer.
+//
+// Only values that have been incremented at least once are reported.
+type Uint64FieldMetric struct {
+	// metadata describes the metric. It is immutable.
+	metadata *pb.MetricMetadata
+
+	// values are the values of the metric, indexed by field value. They
+	// must be accessed atomically. The slice is immutable.
+	values []uint64
+}
+
+// NewUint64FieldMetric creates and registers a new metric with the given name
+// and field. The field takes values in [0, size).
+//
+// Metrics must be statically defined (i.e., at init).
+func NewUint64FieldMetric(name string, sync bool, description, field string, size int) (*Uint64FieldMetric, error) {
+	if initialized {
+		return nil, ErrInitializationDone
+	}
+
+	if allMetrics.contains(name) {
+		return nil, ErrNameInUse
+	}
+
+	m := &Uint64FieldMetric{
+		metadata: &pb.MetricMetadata{
+			Name:        name,
+			Description: description,
+			Cumulative:  true,
+			Sync:        sync,
+			Type:        pb.MetricMetadata_UINT64,
+			FieldName:   field,
+		},
+		values: make([]uint64, size),
+	}
+	allMetrics.fieldMetrics[name] = m
+	return m, nil
+}
+
+// MustCreateNewUint64FieldMetric calls NewUint64FieldMetric and panics if it
+// returns an error.
+func MustCreateNewUint64FieldMetric(name string, sync bool, description, field string, size int) *Uint64FieldMetric {
+	m, err := NewUint64FieldMetric(name, sync, description, field, size)
+	if err != nil {
+		panic(fmt.Sprintf("Unable to create metric %q: %v", name, err))
+	}
+	return m
+}
+
+// Value returns the current value of the metric for the given field value.
+func (m *Uint64FieldMetric) Value(field int) uint64 {
+	return atomic.LoadUint64(&m.values[field])
+}
+
+// Increment increments the metric for the given field value by 1.
+//
+// Preconditions: 0 <= field < size.
+func (m *Uint64FieldMetric) Increment(field int) {
+	atomic.AddUint64(&m.values[field], 1)
+}
+
+// IncrementBy increments the metric for the given field value by v.
+//
+// Preconditions: 0 <= field < size.
+func (m *Uint64FieldMetric) IncrementBy(field int, v uint64) {
+	atomic.AddUint64(&m.values[field], v)
+}
+
+// DistributionMetric records the distribution of samples, such as latencies,
+// in a fixed set of buckets. Like Uint64FieldMetric, it may have a field
+// taking small non-negative integer values, in which case a separate
+// distribution is kept for each field value.
+//
+// Only distributions with at least one sample are reported.
+type DistributionMetric struct {
+	// metadata describes the metric. It is immutable.
+	metadata *pb.MetricMetadata
+
+	// bounds are the exclusive upper bounds of all but the last bucket. It
+	// is immutable.
+	bounds []int64
+
+	// counts are the number of samples in each bucket, indexed by
+	// field*(len(bounds)+1)+bucket. They must be accessed atomically.
+	counts []uint64
+
+	// sums are the sums of the samples, indexed by field. They must be
+	// accessed atomically.
+	sums []int64
+}
+
+// NewDistributionMetric creates and registers a new distribution metric with
+// the given name and bucket bounds, which must be in increasing order.
+//
+// If field is empty, the metric has no field and size must be 1. Otherwise,
+// the field takes values in [0, size).
+//
+// Metrics must be statically defined (i.e., at init).
+func NewDistributionMetric(name string, sync bool, description string, bounds []int64, field string, size int) (*DistributionMetric, error) {
+	if initialized {
+		return nil, ErrInitializationDone
+	}
+
+	if allMetrics.contains(name) {
+		return nil, ErrNameInUse
+	}
+
+	if field == "" && size != 1 {
+		return nil, fmt.Errorf("metric without field must have size 1, got %d", size)
+	}
+	for i := 1; i < len(bounds); i++ {
+		if bounds[i] <= bounds[i-1] {
+			return nil, fmt.Errorf("bucket bounds are not increasing: %v", bounds)
+		}
+	}
+
+	m := &DistributionMetric{
+		metadata: &pb.MetricMetadata{
+			Name:         name,
+			Description:  description,
+			Cumulative:   true,
+			Sync:         sync,
+			Type:         pb.MetricMetadata_DISTRIBUTION,
+			FieldName:    field,
+			BucketBounds: bounds,
+		},
+		bounds: bounds,
+		counts: make([]uint64, size*(len(bounds)+1)),
+		sums:   make([]int64, size),
+	}
+	allMetrics.distributions[name] = m
+	return m, nil
+}
+
+// MustCreateNewDistributionMetric calls NewDistributionMetric and panics if
+// it returns an error.
+func MustCreateNewDistributionMetric(name string, sync bool, description string, bounds []int64, field string, size int) *DistributionMetric {
+	m, err := NewDistributionMetric(name, sync, description, bounds, field, size)
+	if err != nil {
+		panic(fmt.Sprintf("Unable to create metric %q: %v", name, err))
+	}
+	return m
+}
+
+// ExponentialBounds returns n bucket bounds, starting at first and doubling
+// for each bucket.
+func ExponentialBounds(first int64, n int) []int64 {
+	bounds := make([]int64, n)
+	for i := range bounds {
+		bounds[i] = first << uint(i)
+	}
+	return bounds
+}
+
+// AddSample adds a sample to the distribution for the given field value.
+//
+// Preconditions: 0 <= field < size.
+func (m *DistributionMetric) AddSample(field int, sample int64) {
+	// Linear search is faster than binary search for the small number of
+	// buckets used in practice, since most samples fall in the first few.
+	b := 0
+	for b < len(m.bounds) && sample >= m.bounds[b] {
+		b++
+	}
+	atomic.AddUint64(&m.counts[field*(len(m.bounds)+1)+b], 1)
+	atomic.AddInt64(&m.sums[field], sample)
+}
+
+// Value returns a copy of the distribution for the given field value, as the
+// number of samples in each bucket and the sum of all samples.
+func (m *DistributionMetric) Value(field int) (counts []uint64, sum int64) {
+	n := len(m.bounds) + 1
+	counts = make([]uint64, n)
+	for i := range counts {
+		counts[i] = atomic.LoadUint64(&m.counts[field*n+i])
+	}
+	return counts, atomic.LoadInt64(&m.sums[field])
+}
+
+// Bounds returns the bucket bounds of the distribution. The caller must not
+// modify the returned slice.
+func (m *DistributionMetric) Bounds() []int64 {
+	return m.bounds
+}
+
 // metricSet holds named metrics.
 type metricSet struct {
-	m map[string]customUint64Metric
+	m             map[string]customUint64Metric
+	fieldMetrics  map[string]*Uint64FieldMetric
+	distributions map[string]*DistributionMetric
 }
 
 // makeMetricSet returns a new metricSet.
 func makeMetricSet() metricSet {
 	return metricSet{
-		m: make(map[string]customUint64Metric),
+		m:             make(map[string]customUint64Metric),
+		fieldMetrics:  make(map[string]*Uint64FieldMetric),
+		distributions: make(map[string]*DistributionMetric),
+	}
+}
+
+// contains returns true if a metric with the given name is in m.
+func (m *metricSet) contains(name string) bool {
+	if _, ok := m.m[name]; ok {
+		return true
+	}
+	if _, ok := m.fieldMetrics[name]; ok {
+		return true
 	}
+	_, ok := m.distributions[name]
+	return ok
 }
 
 // Values returns a snapshot of all values in m.
 func (m *metricSet) Values() metricValues {
 	vals := make(metricValues)
 	for k, v := range m.m {
-		vals[k] = v.value()
+		vals[metricKey{name: k}] = metricValue{uint64Value: v.value()}
+	}
+	for k, v := range m.fieldMetrics {
+		for f := range v.values {
+			if val := v.Value(f); val != 0 {
+				vals[metricKey{name: k, field: strconv.Itoa(f)}] = metricValue{uint64Value: val}
+			}
+		}
+	}
+	for k, v := range m.distributions {
+		for f := range v.sums {
+			counts, sum := v.Value(f)
+			var total uint64
+			for _, c := range counts {
+				total += c
+			}
+			if total != 0 {
+				vals[metricKey{name: k, field: strconv.Itoa(f)}] = metricValue{
+					uint64Value:  total,
+					distribution: &pb.Distribution{Counts: counts, Sum: sum},
+				}
+			}
+		}
 	}
 	return vals
 }
 
+// metricKey identifies a metric value.
+type metricKey struct {
+	// name is the name of the metric.
+	name string
+
+	// field is the field value, or empty if the metric has no field.
+	field string
+}
+
+// metricValue is the value of a metric.
+type metricValue struct {
+	// uint64Value is the value of a uint64 metric, or the total number of
+	// samples of a distribution. Since metrics are cumulative, a metric
+	// has changed iff uint64Value has.
+	uint64Value uint64
+
+	// distribution is the value of a distribution metric, or nil.
+	distribution *pb.Distribution
+}
+
 // metricValues contains a copy of the values of all metrics.
-type metricValues map[string]uint64
+type metricValues map[metricKey]metricValue
 
 var (
 	// emitMu protects metricsAtLastEmit and ensures that all emitted
@@ -221,7 +472,7 @@ var (
 // EmitMetricUpdate is thread-safe.
 //
 // Preconditions:
-//  * Initialize has been called.
+//   - Initialize has been called.
 func EmitMetricUpdate() {
 	emitMu.Lock()
 	defer emitMu.Unlock()
@@ -232,11 +483,17 @@ func EmitMetricUpdate() {
 	for k, v := range snapshot {
 		// On the first call metricsAtLastEmit will be empty. Include
 		// all metrics then.
-		if prev, ok := metricsAtLastEmit[k]; !ok || prev != v {
-			m.Metrics = append(m.Metrics, &pb.MetricValue{
-				Name:  k,
-				Value: &pb.MetricValue_Uint64Value{v},
-			})
+		if prev, ok := metricsAtLastEmit[k]; !ok || prev.uint64Value != v.uint64Value {
+			mv := &pb.MetricValue{
+				Name:       k.name,
+				FieldValue: k.field,
+			}
+			if v.distribution != nil {
+				mv.Value = &pb.MetricValue_DistributionValue{DistributionValue: v.distribution}
+			} else {
+				mv.Value = &pb.MetricValue_Uint64Value{v.uint64Value}
+			}
+			m.Metrics = append(m.Metrics, mv)
 		}
 	}
 
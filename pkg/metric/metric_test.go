@@ -250,3 +250,118 @@ func TestEmitMetricUpdate(t *testing.T) {
 		t.Errorf("%v: Value got %v want 1", m, uv.Uint64Value)
 	}
 }
+
+func TestEmitFieldMetricUpdate(t *testing.T) {
+	defer reset()
+
+	foo, err := NewUint64FieldMetric("/foo", false, fooDescription, "bar", 4)
+	if err != nil {
+		t.Fatalf("NewUint64FieldMetric got err %v want nil", err)
+	}
+
+	Initialize()
+
+	mr, ok := emitter[0].(*pb.MetricRegistration)
+	if !ok {
+		t.Fatalf("emitter %v got %T want pb.MetricRegistration", emitter[0], emitter[0])
+	}
+	if len(mr.Metrics) != 1 || mr.Metrics[0].FieldName != "bar" {
+		t.Errorf("MetricRegistration got %+v want one metric with field bar", mr.Metrics)
+	}
+
+	// Values that were never incremented are not included.
+	emitter.Reset()
+	EmitMetricUpdate()
+	if len(emitter) != 0 {
+		t.Fatalf("EmitMetricUpdate emitted %d events want 0", len(emitter))
+	}
+
+	foo.Increment(2)
+	foo.IncrementBy(2, 2)
+
+	emitter.Reset()
+	EmitMetricUpdate()
+	if len(emitter) != 1 {
+		t.Fatalf("EmitMetricUpdate emitted %d events want 1", len(emitter))
+	}
+	update, ok := emitter[0].(*pb.MetricUpdate)
+	if !ok {
+		t.Fatalf("emitter %v got %T want pb.MetricUpdate", emitter[0], emitter[0])
+	}
+	if len(update.Metrics) != 1 {
+		t.Fatalf("MetricUpdate got %d metrics want 1", len(update.Metrics))
+	}
+	m := update.Metrics[0]
+	if m.Name != "/foo" || m.FieldValue != "2" {
+		t.Errorf("Metric %+v got name %q field %q want '/foo' '2'", m, m.Name, m.FieldValue)
+	}
+	uv, ok := m.Value.(*pb.MetricValue_Uint64Value)
+	if !ok {
+		t.Fatalf("%+v: value %v got %T want pb.MetricValue_Uint64Value", m, m.Value, m.Value)
+	}
+	if uv.Uint64Value != 3 {
+		t.Errorf("%v: Value got %v want 3", m, uv.Uint64Value)
+	}
+}
+
+func TestEmitDistributionMetricUpdate(t *testing.T) {
+	defer reset()
+
+	if _, err := NewDistributionMetric("/bar", false, barDescription, []int64{2, 1}, "", 1); err == nil {
+		t.Errorf("NewDistributionMetric with decreasing bounds got nil err")
+	}
+	if _, err := NewDistributionMetric("/bar", false, barDescription, []int64{1}, "", 2); err == nil {
+		t.Errorf("NewDistributionMetric with size 2 and no field got nil err")
+	}
+
+	foo, err := NewDistributionMetric("/foo", false, fooDescription, ExponentialBounds(10, 2), "", 1)
+	if err != nil {
+		t.Fatalf("NewDistributionMetric got err %v want nil", err)
+	}
+	if _, err := NewUint64Metric("/foo", false, fooDescription); err != ErrNameInUse {
+		t.Errorf("NewUint64Metric with duplicate name got err %v want %v", err, ErrNameInUse)
+	}
+
+	Initialize()
+
+	mr, ok := emitter[0].(*pb.MetricRegistration)
+	if !ok {
+		t.Fatalf("emitter %v got %T want pb.MetricRegistration", emitter[0], emitter[0])
+	}
+	if len(mr.Metrics) != 1 || mr.Metrics[0].Type != pb.MetricMetadata_DISTRIBUTION {
+		t.Errorf("MetricRegistration got %+v want one distribution", mr.Metrics)
+	}
+
+	for _, s := range []int64{1, 10, 15, 20, 100} {
+		foo.AddSample(0, s)
+	}
+
+	emitter.Reset()
+	EmitMetricUpdate()
+	if len(emitter) != 1 {
+		t.Fatalf("EmitMetricUpdate emitted %d events want 1", len(emitter))
+	}
+	update, ok := emitter[0].(*pb.MetricUpdate)
+	if !ok {
+		t.Fatalf("emitter %v got %T want pb.MetricUpdate", emitter[0], emitter[0])
+	}
+	if len(update.Metrics) != 1 {
+		t.Fatalf("MetricUpdate got %d metrics want 1", len(update.Metrics))
+	}
+	m := update.Metrics[0]
+	dv, ok := m.Value.(*pb.MetricValue_DistributionValue)
+	if !ok {
+		t.Fatalf("%+v: value %v got %T want pb.MetricValue_DistributionValue", m, m.Value, m.Value)
+	}
+	want := &pb.Distribution{Counts: []uint64{1, 2, 2}, Sum: 146}
+	if !proto.Equal(dv.DistributionValue, want) {
+		t.Errorf("%v: Value got %v want %v", m, dv.DistributionValue, want)
+	}
+
+	// Unchanged distributions are not included.
+	emitter.Reset()
+	EmitMetricUpdate()
+	if len(emitter) != 0 {
+		t.Fatalf("EmitMetricUpdate emitted %d events want 0", len(emitter))
+	}
+}
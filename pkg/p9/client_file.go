@@ -148,6 +148,20 @@ func (c *clientFile) FSync() error {
 	return c.client.sendRecv(&Tfsync{FID: c.fid}, &Rfsync{})
 }
 
+// FDataSync implements File.FDataSync.
+func (c *clientFile) FDataSync() error {
+	if atomic.LoadUint32(&c.closed) != 0 {
+		return syscall.EBADF
+	}
+
+	if !versionSupportsTfdatasync(c.client.version) {
+		// A full sync is always sufficient.
+		return c.client.sendRecv(&Tfsync{FID: c.fid}, &Rfsync{})
+	}
+
+	return c.client.sendRecv(&Tfdatasync{FID: c.fid}, &Rfdatasync{})
+}
+
 // GetAttr implements File.GetAttr.
 func (c *clientFile) GetAttr(req AttrMask) (QID, AttrMask, Attr, error) {
 	if atomic.LoadUint32(&c.closed) != 0 {
@@ -135,6 +135,12 @@ type File interface {
 	// On the server, FSync has a read concurrency guarantee.
 	FSync() error
 
+	// FDataSync syncs this node's data, and only the metadata required to
+	// access it, as for fdatasync(2). Open must be called first.
+	//
+	// On the server, FDataSync has a read concurrency guarantee.
+	FDataSync() error
+
 	// Create creates a new regular file and opens it according to the
 	// flags given. This file is already Open.
 	//
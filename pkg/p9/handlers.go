@@ -961,6 +961,30 @@ func (t *Tfsync) handle(cs *connState) message {
 	return &Rfsync{}
 }
 
+// handle implements handler.handle.
+func (t *Tfdatasync) handle(cs *connState) message {
+	// Lookup the FID.
+	ref, ok := cs.LookupFID(t.FID)
+	if !ok {
+		return newErr(syscall.EBADF)
+	}
+	defer ref.DecRef()
+
+	if err := ref.safelyRead(func() (err error) {
+		// Has it been opened already?
+		if _, opened := ref.OpenFlags(); !opened {
+			return syscall.EINVAL
+		}
+
+		// Perform the sync.
+		return ref.file.FDataSync()
+	}); err != nil {
+		return newErr(err)
+	}
+
+	return &Rfdatasync{}
+}
+
 // handle implements handler.handle.
 func (t *Tstatfs) handle(cs *connState) message {
 	// Lookup the FID.
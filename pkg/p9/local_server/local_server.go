@@ -102,6 +102,11 @@ func (l *local) FSync() error {
 	return l.file.Sync()
 }
 
+// FDataSync implements p9.File.FDataSync.
+func (l *local) FDataSync() error {
+	return syscall.Fdatasync(int(l.file.Fd()))
+}
+
 // GetAttr implements p9.File.GetAttr.
 //
 // Not fully implemented.
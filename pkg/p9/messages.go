@@ -2139,6 +2139,54 @@ func (r *Rlconnect) String() string {
 	return fmt.Sprintf("Rlconnect{File: %v}", r.File)
 }
 
+// Tfdatasync is an fdatasync request.
+type Tfdatasync struct {
+	// FID is the fid to sync.
+	FID FID
+}
+
+// Decode implements encoder.Decode.
+func (t *Tfdatasync) Decode(b *buffer) {
+	t.FID = b.ReadFID()
+}
+
+// Encode implements encoder.Encode.
+func (t *Tfdatasync) Encode(b *buffer) {
+	b.WriteFID(t.FID)
+}
+
+// Type implements message.Type.
+func (*Tfdatasync) Type() MsgType {
+	return MsgTfdatasync
+}
+
+// String implements fmt.Stringer.
+func (t *Tfdatasync) String() string {
+	return fmt.Sprintf("Tfdatasync{FID: %d}", t.FID)
+}
+
+// Rfdatasync is an fdatasync response.
+type Rfdatasync struct {
+}
+
+// Decode implements encoder.Decode.
+func (*Rfdatasync) Decode(b *buffer) {
+}
+
+// Encode implements encoder.Encode.
+func (*Rfdatasync) Encode(b *buffer) {
+}
+
+// Type implements message.Type.
+func (*Rfdatasync) Type() MsgType {
+	return MsgRfdatasync
+}
+
+// String implements fmt.Stringer.
+func (r *Rfdatasync) String() string {
+	return fmt.Sprintf("Rfdatasync{}")
+}
+
 // messageRegistry indexes all messages by type.
 var messageRegistry = make(map[MsgType]func() message)
 
@@ -2266,6 +2314,8 @@ func init() {
 	register(&Rusymlink{})
 	register(&Tlconnect{})
 	register(&Rlconnect{})
+	register(&Tfdatasync{})
+	register(&Rfdatasync{})
 
 	calculateLargestFixedSize()
 }
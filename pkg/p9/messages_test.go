@@ -208,6 +208,10 @@ func TestEncodeDecode(t *testing.T) {
 			FID: 1,
 		},
 		&Rfsync{},
+		&Tfdatasync{
+			FID: 1,
+		},
+		&Rfdatasync{},
 		&Tlink{
 			Directory: 1,
 			Target:    2,
@@ -374,6 +374,8 @@ const (
 	MsgRusymlink            = 135
 	MsgTlconnect            = 136
 	MsgRlconnect            = 137
+	MsgTfdatasync           = 138
+	MsgRfdatasync           = 139
 )
 
 // QIDType represents the file type for QIDs.
@@ -1449,6 +1449,27 @@ func TestFSync(t *testing.T) {
 	}
 }
 
+func TestFDataSync(t *testing.T) {
+	for name := range newTypeMap(nil) {
+		for _, mode := range []p9.OpenFlags{p9.ReadOnly, p9.WriteOnly, p9.ReadWrite} {
+			t.Run(fmt.Sprintf("%s-%s", mode, name), func(t *testing.T) {
+				h, c := NewHarness(t)
+				defer h.Finish()
+
+				_, root := newRoot(h, c)
+				defer root.Close()
+
+				onlyWorksOnOpenThings(h, t, name, root, mode, nil, func(backend *Mock, f p9.File, shouldSucceed bool) error {
+					if shouldSucceed {
+						backend.EXPECT().FDataSync().Times(1)
+					}
+					return f.FDataSync()
+				})
+			})
+		}
+	}
+}
+
 func TestFlush(t *testing.T) {
 	for name := range newTypeMap(nil) {
 		t.Run(name, func(t *testing.T) {
@@ -26,7 +26,7 @@ const (
 	//
 	// Clients are expected to start requesting this version number and
 	// to continuously decrement it until a Tversion request succeeds.
-	highestSupportedVersion uint32 = 6
+	highestSupportedVersion uint32 = 7
 
 	// lowestSupportedVersion is the lowest supported version X in a
 	// version string of the format 9P2000.L.Google.X.
@@ -143,3 +143,11 @@ func VersionSupportsAnonymous(v uint32) bool {
 func VersionSupportsMultiUser(v uint32) bool {
 	return v >= 6
 }
+
+// versionSupportsTfdatasync returns true if version v supports the Tfdatasync
+// message. This predicate must be checked by clients before attempting to
+// make a Tfdatasync request. If Tfdatasync is not supported, Tfsync should be
+// used instead.
+func versionSupportsTfdatasync(v uint32) bool {
+	return v >= 7
+}
@@ -49,6 +49,19 @@ const (
 // However, it will leave a SECCOMP audit event trail behind. In any case, the
 // syscall is still blocked from executing.
 func Install(rules SyscallRules) error {
+	return InstallRuleSets([]RuleSet{
+		RuleSet{
+			Rules:  rules,
+			Action: linux.SECCOMP_RET_ALLOW,
+		},
+	})
+}
+
+// InstallRuleSets is like Install, but takes rule sets with their own
+// actions, e.g. to make a syscall fail instead of allowing it. Syscalls that
+// match none of the rule sets trigger the same action as violations in
+// Install.
+func InstallRuleSets(rules []RuleSet) error {
 	defaultAction, err := defaultAction()
 	if err != nil {
 		return err
@@ -57,14 +70,9 @@ func Install(rules SyscallRules) error {
 	// Uncomment to get stack trace when there is a violation.
 	// defaultAction = linux.BPFAction(linux.SECCOMP_RET_TRAP)
 
-	log.Infof("Installing seccomp filters for %d syscalls (action=%v)", len(rules), defaultAction)
+	log.Infof("Installing seccomp filters for %d rule sets (action=%v)", len(rules), defaultAction)
 
-	instrs, err := BuildProgram([]RuleSet{
-		RuleSet{
-			Rules:  rules,
-			Action: linux.SECCOMP_RET_ALLOW,
-		},
-	}, defaultAction)
+	instrs, err := BuildProgram(rules, defaultAction)
 	if log.IsLogging(log.Debug) {
 		programStr, errDecode := bpf.DecodeProgram(instrs)
 		if errDecode != nil {
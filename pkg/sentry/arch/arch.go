@@ -184,12 +184,13 @@ type Context interface {
 	// NewMmapLayout returns a layout for a new MM, where MinAddr for the
 	// returned layout must be no lower than min, and MaxAddr for the returned
 	// layout must be no higher than max. Repeated calls to NewMmapLayout may
-	// return different layouts.
-	NewMmapLayout(min, max usermem.Addr, limits *limits.LimitSet) (MmapLayout, error)
+	// return different layouts, unless opts.NoRandomize is true.
+	NewMmapLayout(min, max usermem.Addr, limits *limits.LimitSet, opts MmapLayoutOptions) (MmapLayout, error)
 
 	// PIELoadAddress returns a preferred load address for a
-	// position-independent executable within l.
-	PIELoadAddress(l MmapLayout) usermem.Addr
+	// position-independent executable within l, which was returned by
+	// NewMmapLayout with the same opts.
+	PIELoadAddress(l MmapLayout, opts MmapLayoutOptions) usermem.Addr
 
 	// FeatureSet returns the FeatureSet in use in this context.
 	FeatureSet() *cpuid.FeatureSet
@@ -256,6 +257,26 @@ const (
 	MmapTopDown
 )
 
+// MmapLayoutOptions controls the construction of an MmapLayout. The zero
+// value selects Linux's default behavior.
+//
+// +stateify savable
+type MmapLayoutOptions struct {
+	// If NoRandomize is true, the layout and the placement of position-
+	// independent executables are not randomized, as for Linux's
+	// ADDR_NO_RANDOMIZE personality.
+	NoRandomize bool
+
+	// RandBits is the number of bits of page-granular randomization to apply
+	// to the layout, as for Linux's vm.mmap_rnd_bits. If RandBits is 0, the
+	// architecture's default is used.
+	RandBits uint
+
+	// If Legacy is true, the layout's DefaultDirection is MmapBottomUp, as
+	// for Linux's vm.legacy_va_layout or ADDR_COMPAT_LAYOUT personality.
+	Legacy bool
+}
+
 // MmapLayout defines the layout of the user address space for a particular
 // MemoryManager.
 //
@@ -283,7 +304,8 @@ type MmapLayout struct {
 
 	// MaxStackRand is the maximum randomization to apply to stack
 	// allocations to maintain a proper gap between the stack and
-	// TopDownBase.
+	// TopDownBase. If MaxStackRand is 0, stack allocations are not
+	// randomized.
 	MaxStackRand uint64
 }
 
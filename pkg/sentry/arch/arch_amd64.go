@@ -205,8 +205,20 @@ func mmapRand(max uint64) usermem.Addr {
 	return usermem.Addr(rand.Int63n(int64(max))).RoundDown()
 }
 
+// maxMmapRand returns the maximum randomization to apply to the mmap layout
+// for opts. It is consistent with Linux's arch/x86/mm/mmap.c:arch_rnd().
+func maxMmapRand(opts MmapLayoutOptions) usermem.Addr {
+	if opts.NoRandomize {
+		return 0
+	}
+	if opts.RandBits == 0 {
+		return maxMmapRand64
+	}
+	return usermem.Addr(1<<opts.RandBits) * usermem.PageSize
+}
+
 // NewMmapLayout implements Context.NewMmapLayout consistently with Linux.
-func (c *context64) NewMmapLayout(min, max usermem.Addr, r *limits.LimitSet) (MmapLayout, error) {
+func (c *context64) NewMmapLayout(min, max usermem.Addr, r *limits.LimitSet, opts MmapLayoutOptions) (MmapLayout, error) {
 	min, ok := min.RoundUp()
 	if !ok {
 		return MmapLayout{}, syscall.EINVAL
@@ -232,13 +244,13 @@ func (c *context64) NewMmapLayout(min, max usermem.Addr, r *limits.LimitSet) (Mm
 		gap = maxGap
 	}
 	defaultDir := MmapTopDown
-	if stackSize.Cur == limits.Infinity {
+	if stackSize.Cur == limits.Infinity || opts.Legacy {
 		defaultDir = MmapBottomUp
 	}
 
-	topDownMin := max - gap - maxMmapRand64
-	maxRand := usermem.Addr(maxMmapRand64)
-	if topDownMin < preferredTopDownBaseMin {
+	maxRand := maxMmapRand(opts)
+	topDownMin := max - gap - maxRand
+	if topDownMin < preferredTopDownBaseMin && maxRand > minMmapRand64 {
 		// Try to keep TopDownBase above preferredTopDownBaseMin by
 		// shrinking maxRand.
 		maxAdjust := maxRand - minMmapRand64
@@ -248,7 +260,10 @@ func (c *context64) NewMmapLayout(min, max usermem.Addr, r *limits.LimitSet) (Mm
 		}
 	}
 
-	rnd := mmapRand(uint64(maxRand))
+	var rnd usermem.Addr
+	if maxRand != 0 {
+		rnd = mmapRand(uint64(maxRand))
+	}
 	l := MmapLayout{
 		MinAddr: min,
 		MaxAddr: max,
@@ -272,9 +287,10 @@ func (c *context64) NewMmapLayout(min, max usermem.Addr, r *limits.LimitSet) (Mm
 }
 
 // PIELoadAddress implements Context.PIELoadAddress.
-func (c *context64) PIELoadAddress(l MmapLayout) usermem.Addr {
+func (c *context64) PIELoadAddress(l MmapLayout, opts MmapLayoutOptions) usermem.Addr {
+	maxRand := maxMmapRand(opts)
 	base := preferredPIELoadAddr
-	max, ok := base.AddLength(maxMmapRand64)
+	max, ok := base.AddLength(uint64(maxRand))
 	if !ok {
 		panic(fmt.Sprintf("preferredPIELoadAddr %#x too large", base))
 	}
@@ -287,7 +303,10 @@ func (c *context64) PIELoadAddress(l MmapLayout) usermem.Addr {
 		base = l.TopDownBase / 3 * 2
 	}
 
-	return base + mmapRand(maxMmapRand64)
+	if maxRand == 0 {
+		return base
+	}
+	return base + mmapRand(uint64(maxRand))
 }
 
 // userStructSize is the size in bytes of Linux's struct user on amd64.
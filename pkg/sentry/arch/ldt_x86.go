@@ -0,0 +1,178 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build amd64 i386
+
+package arch
+
+import (
+	"encoding/binary"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+// Segment descriptor bits, in the upper 32 bits of a descriptor.
+const (
+	descTypeShift  = 8
+	descTypeMask   = 0xf << descTypeShift
+	descS          = 1 << 12
+	descDPL3       = 3 << 13
+	descPresent    = 1 << 15
+	descLimitShift = 16
+	descAVL        = 1 << 20
+	descDB         = 1 << 22
+	descG          = 1 << 23
+
+	// descTypeAccessed, descTypeWritable and descTypeContentsShift describe
+	// the type field.
+	descTypeAccessed      = 1 << 0
+	descTypeWritable      = 1 << 1
+	descTypeContentsShift = 2
+)
+
+// LDT is a local descriptor table, as manipulated by modify_ldt(2). An LDT is
+// not safe for concurrent use.
+//
+// +stateify savable
+type LDT struct {
+	// entries holds descriptors in hardware format, indexed by entry
+	// number. Entries beyond len(entries) are empty. A zero descriptor is
+	// empty.
+	entries []uint64
+}
+
+// Len returns the number of entries in the table, as Linux's
+// ldt_struct.nr_entries.
+func (l *LDT) Len() int {
+	return len(l.entries)
+}
+
+// Fork returns a copy of l, as for fork(2).
+func (l *LDT) Fork() LDT {
+	return LDT{entries: append([]uint64(nil), l.entries...)}
+}
+
+// Read implements modify_ldt(2) function 0 for a buffer of the given size. It
+// returns the bytes to copy out, whose length is the syscall's return value.
+//
+// If l has never been written, no bytes are returned. Otherwise, the returned
+// slice contains the table's descriptors, truncated or zero-padded to size.
+// This is consistent with Linux's arch/x86/kernel/ldt.c:read_ldt().
+func (l *LDT) Read(size uint64) []byte {
+	if len(l.entries) == 0 {
+		return nil
+	}
+	if max := uint64(linux.LDT_ENTRIES * linux.LDT_ENTRY_SIZE); size > max {
+		size = max
+	}
+	ents := make([]byte, len(l.entries)*linux.LDT_ENTRY_SIZE)
+	for i, desc := range l.entries {
+		binary.LittleEndian.PutUint64(ents[i*linux.LDT_ENTRY_SIZE:], desc)
+	}
+	buf := make([]byte, size)
+	copy(buf, ents)
+	return buf
+}
+
+// Write implements modify_ldt(2) functions 1 (oldMode) and 0x11 (!oldMode),
+// installing the descriptor described by info. It returns the resulting entry
+// in normalized form, suitable for installing in a host LDT.
+//
+// This is consistent with Linux's arch/x86/kernel/ldt.c:write_ldt().
+func (l *LDT) Write(info *linux.UserDesc, oldMode bool) (linux.UserDesc, error) {
+	if info.EntryNumber >= linux.LDT_ENTRIES {
+		return linux.UserDesc{}, syserror.EINVAL
+	}
+	if info.Contents() == 3 {
+		if oldMode || !info.SegNotPresent() {
+			return linux.UserDesc{}, syserror.EINVAL
+		}
+	}
+
+	var desc uint64
+	if !(oldMode && info.BaseAddr == 0 && info.Limit == 0) && !info.Empty() {
+		desc = encodeDescriptor(info)
+		if oldMode {
+			desc &^= descAVL << 32
+		}
+	}
+
+	if n := int(info.EntryNumber) + 1; n > len(l.entries) {
+		l.entries = append(l.entries, make([]uint64, n-len(l.entries))...)
+	}
+	l.entries[info.EntryNumber] = desc
+	return decodeDescriptor(info.EntryNumber, desc), nil
+}
+
+// Entries returns all entries in l in normalized form, suitable for
+// installing in a host LDT.
+func (l *LDT) Entries() []linux.UserDesc {
+	ents := make([]linux.UserDesc, 0, len(l.entries))
+	for i, desc := range l.entries {
+		ents = append(ents, decodeDescriptor(uint32(i), desc))
+	}
+	return ents
+}
+
+// encodeDescriptor returns the hardware descriptor for info, as for Linux's
+// arch/x86/include/asm/desc.h:fill_ldt(). The long mode bit is never set.
+func encodeDescriptor(info *linux.UserDesc) uint64 {
+	low := uint64(info.Limit&0xffff) | uint64(info.BaseAddr&0xffff)<<16
+
+	typ := uint64(descTypeAccessed) | uint64(info.Contents())<<descTypeContentsShift
+	if !info.ReadExecOnly() {
+		typ |= descTypeWritable
+	}
+	high := uint64((info.BaseAddr>>16)&0xff) |
+		typ<<descTypeShift |
+		descS | descDPL3 |
+		uint64((info.Limit>>16)&0xf)<<descLimitShift |
+		uint64(info.BaseAddr&0xff000000)
+	if !info.SegNotPresent() {
+		high |= descPresent
+	}
+	if info.Useable() {
+		high |= descAVL
+	}
+	if info.Seg32Bit() {
+		high |= descDB
+	}
+	if info.LimitInPages() {
+		high |= descG
+	}
+	return high<<32 | low
+}
+
+// decodeDescriptor returns the user_desc that, when written in new mode,
+// results in desc at the given entry number.
+func decodeDescriptor(entry uint32, desc uint64) linux.UserDesc {
+	u := linux.UserDesc{EntryNumber: entry}
+	if desc == 0 {
+		u.SetFlags(false, 0, true, false, true, false)
+		return u
+	}
+	low, high := uint32(desc), uint32(desc>>32)
+	u.BaseAddr = low>>16 | (high&0xff)<<16 | high&0xff000000
+	u.Limit = low&0xffff | ((high>>descLimitShift)&0xf)<<16
+	typ := (high & descTypeMask) >> descTypeShift
+	u.SetFlags(
+		high&descDB != 0,
+		typ>>descTypeContentsShift,
+		typ&descTypeWritable == 0,
+		high&descG != 0,
+		high&descPresent == 0,
+		high&descAVL != 0)
+	return u
+}
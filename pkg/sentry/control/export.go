@@ -0,0 +1,374 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"reflect"
+	"sort"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/proc"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/sys"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/tmpfs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/epsocket"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/urpc"
+)
+
+// ErrNoNetstack is returned by ExportNetstack if the sandbox does not use
+// netstack, e.g. because it uses the host network.
+var ErrNoNetstack = errors.New("sandbox does not use netstack")
+
+// ExportFilesystemOpts contains options for the ExportFilesystem call.
+type ExportFilesystemOpts struct {
+	// Path is the directory to export, resolved in the root mount
+	// namespace. If empty, the whole filesystem tree is exported.
+	Path string `json:"path"`
+
+	// FilePayload contains the destination for the tar archive.
+	urpc.FilePayload
+}
+
+// ExportFilesystem writes the contents of memory-backed filesystems under
+// o.Path as a tar archive to the donated file. Files in tmpfs mounts and files
+// in the upper layer of overlays (i.e. files that were created or modified
+// since the overlay was mounted) are exported; files that are only backed by
+// the gofer or the host are not. Files removed from the lower layer of an
+// overlay are not represented in the archive. /proc and /sys are skipped.
+//
+// The kernel is paused while the archive is written so that it is consistent.
+func ExportFilesystem(k *kernel.Kernel, o *ExportFilesystemOpts) error {
+	if len(o.FilePayload.Files) != 1 {
+		return ErrInvalidFiles
+	}
+	defer o.FilePayload.Files[0].Close()
+
+	p := o.Path
+	if p == "" {
+		p = "/"
+	}
+	if !path.IsAbs(p) {
+		return fmt.Errorf("path %q is not absolute", p)
+	}
+	p = path.Clean(p)
+
+	ctx := k.SupervisorContext()
+	mns := k.RootMountNamespace()
+	if mns == nil {
+		return fmt.Errorf("no root mount namespace")
+	}
+	root := mns.Root()
+	defer root.DecRef()
+
+	k.Pause()
+	defer k.Unpause()
+
+	maxTraversals := uint(linux.MaxSymlinkTraversals)
+	d, err := mns.FindInode(ctx, root, nil, p, &maxTraversals)
+	if err != nil {
+		return fmt.Errorf("failed to find %q: %v", p, err)
+	}
+	defer d.DecRef()
+	if !fs.IsDir(d.Inode.StableAttr) {
+		return fmt.Errorf("%q is not a directory", p)
+	}
+
+	e := &fsExporter{
+		ctx:  ctx,
+		root: root,
+		tw:   tar.NewWriter(o.FilePayload.Files[0]),
+	}
+	if err := e.exportDir(d, ""); err != nil {
+		return err
+	}
+	log.Infof("Exported %d files under %q", e.files, p)
+	return e.tw.Close()
+}
+
+// fsExporter writes a tar archive of memory-backed files.
+type fsExporter struct {
+	ctx  context.Context
+	root *fs.Dirent
+	tw   *tar.Writer
+
+	// files is the number of entries written so far.
+	files int
+}
+
+// inMemory returns true if the file backed by inode only exists in the
+// sandbox memory.
+func inMemory(inode *fs.Inode) bool {
+	if inode.InOverlayUpper() {
+		return true
+	}
+	fsys := inode.MountSource.Filesystem
+	return fsys != nil && fsys.Name() == tmpfs.FilesystemName
+}
+
+// skipDir returns true if the directory backed by inode should not be walked.
+func skipDir(inode *fs.Inode) bool {
+	fsys := inode.MountSource.Filesystem
+	if fsys == nil {
+		return false
+	}
+	switch fsys.Name() {
+	case proc.FilesystemName, sys.FilesystemName:
+		return true
+	}
+	return false
+}
+
+// exportDir exports the directory d, whose path in the archive is name, and
+// its children.
+func (e *fsExporter) exportDir(d *fs.Dirent, name string) error {
+	if skipDir(d.Inode) {
+		return nil
+	}
+	if name != "" && inMemory(d.Inode) {
+		if err := e.writeHeader(d.Inode, name+"/", tar.TypeDir, 0, ""); err != nil {
+			return err
+		}
+	}
+
+	dir, err := d.Inode.GetFile(e.ctx, d, fs.FileFlags{Read: true})
+	if err != nil {
+		return fmt.Errorf("failed to open %q: %v", name, err)
+	}
+	ser := &fs.CollectEntriesSerializer{}
+	err = dir.Readdir(e.ctx, ser)
+	dir.DecRef()
+	if err != nil {
+		return fmt.Errorf("failed to read directory %q: %v", name, err)
+	}
+
+	names := make([]string, 0, len(ser.Order))
+	for _, n := range ser.Order {
+		if n != "." && n != ".." {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		child, err := d.Walk(e.ctx, e.root, n)
+		if err != nil {
+			// The entry may be a whiteout or may have been removed
+			// by a gofer-backed filesystem.
+			log.Debugf("Skipping %q: %v", path.Join(name, n), err)
+			continue
+		}
+		err = e.exportChild(child, path.Join(name, n))
+		child.DecRef()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportChild exports the file d, whose path in the archive is name.
+func (e *fsExporter) exportChild(d *fs.Dirent, name string) error {
+	inode := d.Inode
+	switch {
+	case fs.IsDir(inode.StableAttr):
+		return e.exportDir(d, name)
+	case !inMemory(inode):
+		return nil
+	case fs.IsSymlink(inode.StableAttr):
+		target, err := inode.Readlink(e.ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read link %q: %v", name, err)
+		}
+		return e.writeHeader(inode, name, tar.TypeSymlink, 0, target)
+	case fs.IsRegular(inode.StableAttr):
+		return e.exportFile(d, name)
+	default:
+		// Pipes, sockets and devices have no content to export.
+		log.Debugf("Skipping %q of type %v", name, inode.StableAttr.Type)
+		return nil
+	}
+}
+
+// exportFile exports the content of the regular file d.
+func (e *fsExporter) exportFile(d *fs.Dirent, name string) error {
+	uattr, err := d.Inode.UnstableAttr(e.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to stat %q: %v", name, err)
+	}
+	f, err := d.Inode.GetFile(e.ctx, d, fs.FileFlags{Read: true, Pread: true})
+	if err != nil {
+		return fmt.Errorf("failed to open %q: %v", name, err)
+	}
+	defer f.DecRef()
+
+	if err := e.writeHeader(d.Inode, name, tar.TypeReg, uattr.Size, ""); err != nil {
+		return err
+	}
+	r := io.NewSectionReader(&fs.FileReader{Ctx: e.ctx, File: f}, 0, uattr.Size)
+	if _, err := io.CopyN(e.tw, r, uattr.Size); err != nil {
+		return fmt.Errorf("failed to copy %q: %v", name, err)
+	}
+	return nil
+}
+
+// writeHeader writes the tar header for inode.
+func (e *fsExporter) writeHeader(inode *fs.Inode, name string, typ byte, size int64, target string) error {
+	uattr, err := inode.UnstableAttr(e.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to stat %q: %v", name, err)
+	}
+	s, ns := uattr.ModificationTime.Unix()
+	hdr := &tar.Header{
+		Typeflag: typ,
+		Name:     name,
+		Linkname: target,
+		Size:     size,
+		Mode:     int64(uattr.Perms.LinuxMode()),
+		Uid:      int(uattr.Owner.UID),
+		Gid:      int(uattr.Owner.GID),
+		ModTime:  time.Unix(s, ns),
+	}
+	if err := e.tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write header for %q: %v", name, err)
+	}
+	e.files++
+	return nil
+}
+
+// NetstackInterface is the state of a network interface.
+type NetstackInterface struct {
+	// ID is the NIC ID.
+	ID int32 `json:"id"`
+
+	// Name is the name of the interface.
+	Name string `json:"name"`
+
+	// HardwareAddr is the link address of the interface.
+	HardwareAddr string `json:"hardware_addr"`
+
+	// MTU is the maximum transmission unit of the interface.
+	MTU uint32 `json:"mtu"`
+
+	// Flags are the interface flags, e.g. IFF_UP.
+	Flags uint32 `json:"flags"`
+
+	// Addresses are the addresses assigned to the interface, in CIDR
+	// notation.
+	Addresses []string `json:"addresses"`
+}
+
+// NetstackRoute is an entry of the route table.
+type NetstackRoute struct {
+	// Destination is the destination subnet in CIDR notation.
+	Destination string `json:"destination"`
+
+	// Gateway is the gateway address, if any.
+	Gateway string `json:"gateway,omitempty"`
+
+	// NIC is the ID of the interface used by the route.
+	NIC int32 `json:"nic"`
+}
+
+// NetstackState is the exported state of the sandbox network stack.
+type NetstackState struct {
+	// Interfaces are the network interfaces, ordered by ID.
+	Interfaces []NetstackInterface `json:"interfaces"`
+
+	// Routes is the route table, in order of precedence.
+	Routes []NetstackRoute `json:"routes"`
+
+	// Forwarding is true if packet forwarding between interfaces is
+	// enabled.
+	Forwarding bool `json:"forwarding"`
+
+	// Stats are the stack counters, keyed by their name in tcpip.Stats,
+	// e.g. "TCP.SegmentsSent".
+	Stats map[string]uint64 `json:"stats"`
+}
+
+// ExportNetstack returns the state of the network stack of the sandbox.
+func ExportNetstack(k *kernel.Kernel, out *NetstackState) error {
+	eps, ok := k.NetworkStack().(*epsocket.Stack)
+	if !ok {
+		return ErrNoNetstack
+	}
+
+	addrs := eps.InterfaceAddrs()
+	for id, iface := range eps.Interfaces() {
+		ni := NetstackInterface{
+			ID:           id,
+			Name:         iface.Name,
+			HardwareAddr: net.HardwareAddr(iface.Addr).String(),
+			MTU:          iface.MTU,
+			Flags:        iface.Flags,
+		}
+		for _, a := range addrs[id] {
+			ipn := net.IPNet{
+				IP:   net.IP(a.Addr),
+				Mask: net.CIDRMask(int(a.PrefixLen), len(a.Addr)*8),
+			}
+			ni.Addresses = append(ni.Addresses, ipn.String())
+		}
+		out.Interfaces = append(out.Interfaces, ni)
+	}
+	sort.Slice(out.Interfaces, func(i, j int) bool {
+		return out.Interfaces[i].ID < out.Interfaces[j].ID
+	})
+
+	for _, r := range eps.Stack.GetRouteTable() {
+		nr := NetstackRoute{
+			Destination: (&net.IPNet{
+				IP:   net.IP(r.Destination),
+				Mask: net.IPMask(r.Mask),
+			}).String(),
+			NIC: int32(r.NIC),
+		}
+		if r.Gateway != "" {
+			nr.Gateway = r.Gateway.String()
+		}
+		out.Routes = append(out.Routes, nr)
+	}
+
+	out.Forwarding = eps.Stack.Forwarding()
+	out.Stats = make(map[string]uint64)
+	flattenStats("", reflect.ValueOf(eps.Stack.Stats()), out.Stats)
+	return nil
+}
+
+// flattenStats adds the value of each tcpip.StatCounter in the struct v to
+// out, keyed by its dotted field path.
+func flattenStats(prefix string, v reflect.Value, out map[string]uint64) {
+	for i := 0; i < v.NumField(); i++ {
+		name := prefix + v.Type().Field(i).Name
+		switch f := v.Field(i); f.Kind() {
+		case reflect.Ptr:
+			if s, ok := f.Interface().(*tcpip.StatCounter); ok && s != nil {
+				out[name] = s.Value()
+			}
+		case reflect.Struct:
+			flattenStats(name+".", f, out)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"reflect"
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+)
+
+// Tests that flattenStats reports every counter under its dotted field path.
+func TestFlattenStats(t *testing.T) {
+	s := tcpip.Stats{}.FillIn()
+	s.DroppedPackets.Increment()
+	s.TCP.SegmentsSent.IncrementBy(3)
+	s.IP.PacketsReceived.IncrementBy(5)
+
+	got := make(map[string]uint64)
+	flattenStats("", reflect.ValueOf(s), got)
+
+	for name, want := range map[string]uint64{
+		"DroppedPackets":     1,
+		"TCP.SegmentsSent":   3,
+		"IP.PacketsReceived": 5,
+		"UDP.PacketsSent":    0,
+	} {
+		if v, ok := got[name]; !ok || v != want {
+			t.Errorf("stat %q got (%d, %t), want (%d, true)", name, v, ok, want)
+		}
+	}
+}
+
+// Tests that nil counters are omitted.
+func TestFlattenStatsNil(t *testing.T) {
+	got := make(map[string]uint64)
+	flattenStats("", reflect.ValueOf(tcpip.Stats{}), got)
+	if len(got) != 0 {
+		t.Errorf("got %v, want no stats", got)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"runtime"
 	"runtime/pprof"
 	"sync"
+	"time"
 
 	"gvisor.googlesource.com/gvisor/pkg/fd"
 	"gvisor.googlesource.com/gvisor/pkg/urpc"
@@ -31,6 +32,10 @@ type ProfileOpts struct {
 	// File is the filesystem path for the profile.
 	File string `json:"path"`
 
+	// Duration is the duration of the profile, for profiles that sample
+	// events over time (CPU, block and mutex profiles).
+	Duration time.Duration `json:"duration"`
+
 	// FilePayload is the destination for the profiling output.
 	urpc.FilePayload
 }
@@ -46,12 +51,21 @@ type ProfileOpts struct {
 //
 // - dump out the stack trace of current go routines.
 //   sentryctl -pid <pid> pprof-goroutine
+//
+// Profile is always available. Unless the sandbox was started with profiling
+// enabled, the sentry cannot read /proc/self/maps, so profiles do not include
+// memory mappings but are still symbolized.
 type Profile struct {
 	// mu protects the fields below.
 	mu sync.Mutex
 
 	// cpuFile is the current CPU profile output file.
 	cpuFile *fd.FD
+
+	// blockRunning and mutexRunning indicate whether a block or mutex
+	// profile is being collected.
+	blockRunning bool
+	mutexRunning bool
 }
 
 // StartCPUProfile is an RPC stub which starts recording the CPU profile in a
@@ -122,3 +136,74 @@ func (p *Profile) Goroutine(o *ProfileOpts, _ *struct{}) error {
 	}
 	return nil
 }
+
+// CPUProfile is an RPC stub which collects a CPU profile for o.Duration and
+// writes it to the output file.
+func (p *Profile) CPUProfile(o *ProfileOpts, _ *struct{}) error {
+	if err := p.StartCPUProfile(o, nil); err != nil {
+		return err
+	}
+	time.Sleep(o.Duration)
+	return p.StopCPUProfile(nil, nil)
+}
+
+// BlockProfile is an RPC stub which collects a profile of goroutines blocking
+// on synchronization primitives for o.Duration, and writes it to the output
+// file.
+func (p *Profile) BlockProfile(o *ProfileOpts, _ *struct{}) error {
+	if len(o.FilePayload.Files) < 1 {
+		return errNoOutput
+	}
+	output := o.FilePayload.Files[0]
+	defer output.Close()
+
+	p.mu.Lock()
+	if p.blockRunning {
+		p.mu.Unlock()
+		return errors.New("block profile already running")
+	}
+	p.blockRunning = true
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.blockRunning = false
+		p.mu.Unlock()
+	}()
+
+	// Profile all blocking events while the profile runs. The profile
+	// is cumulative, so events before the rate is set are not included.
+	runtime.SetBlockProfileRate(1)
+	time.Sleep(o.Duration)
+	err := pprof.Lookup("block").WriteTo(output, 0)
+	runtime.SetBlockProfileRate(0)
+	return err
+}
+
+// MutexProfile is an RPC stub which collects a profile of contended mutexes for
+// o.Duration, and writes it to the output file.
+func (p *Profile) MutexProfile(o *ProfileOpts, _ *struct{}) error {
+	if len(o.FilePayload.Files) < 1 {
+		return errNoOutput
+	}
+	output := o.FilePayload.Files[0]
+	defer output.Close()
+
+	p.mu.Lock()
+	if p.mutexRunning {
+		p.mu.Unlock()
+		return errors.New("mutex profile already running")
+	}
+	p.mutexRunning = true
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.mutexRunning = false
+		p.mu.Unlock()
+	}()
+
+	prev := runtime.SetMutexProfileFraction(1)
+	time.Sleep(o.Duration)
+	err := pprof.Lookup("mutex").WriteTo(output, 0)
+	runtime.SetMutexProfileFraction(prev)
+	return err
+}
@@ -0,0 +1,64 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/urpc"
+)
+
+func TestTimedProfiles(t *testing.T) {
+	var p Profile
+	for _, tc := range []struct {
+		name    string
+		collect func(*ProfileOpts, *struct{}) error
+	}{
+		{"CPU", p.CPUProfile},
+		{"Block", p.BlockProfile},
+		{"Mutex", p.MutexProfile},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "profile")
+			if err != nil {
+				t.Fatalf("TempFile failed: %v", err)
+			}
+			defer os.Remove(f.Name())
+
+			opts := ProfileOpts{
+				Duration:    10 * time.Millisecond,
+				FilePayload: urpc.FilePayload{Files: []*os.File{f}},
+			}
+			if err := tc.collect(&opts, nil); err != nil {
+				t.Fatalf("%s profile failed: %v", tc.name, err)
+			}
+			fi, err := os.Stat(f.Name())
+			if err != nil {
+				t.Fatalf("Stat failed: %v", err)
+			}
+			if fi.Size() == 0 {
+				t.Errorf("%s profile is empty", tc.name)
+			}
+
+			// The output file is required.
+			if err := tc.collect(&ProfileOpts{}, nil); err != errNoOutput {
+				t.Errorf("%s profile without output got error %v, want %v", tc.name, err, errNoOutput)
+			}
+		})
+	}
+}
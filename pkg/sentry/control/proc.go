@@ -185,7 +185,7 @@ func (proc *Proc) execAsync(args *ExecArgs) (*kernel.ThreadGroup, kernel.ThreadI
 			// Import the file as a host TTY file.
 			if ttyFile == nil {
 				var err error
-				appFile, err = host.ImportFile(ctx, int(hostFile.Fd()), mounter, true /* isTTY */)
+				appFile, err = host.ImportFile(ctx, "" /* key */, int(hostFile.Fd()), mounter, true /* isTTY */)
 				if err != nil {
 					return nil, 0, nil, err
 				}
@@ -204,7 +204,7 @@ func (proc *Proc) execAsync(args *ExecArgs) (*kernel.ThreadGroup, kernel.ThreadI
 		} else {
 			// Import the file as a regular host file.
 			var err error
-			appFile, err = host.ImportFile(ctx, int(hostFile.Fd()), mounter, false /* isTTY */)
+			appFile, err = host.ImportFile(ctx, "" /* key */, int(hostFile.Fd()), mounter, false /* isTTY */)
 			if err != nil {
 				return nil, 0, nil, err
 			}
@@ -0,0 +1,135 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"fmt"
+	"path"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+// UpdateResolverOpts contains options for the UpdateResolver call.
+type UpdateResolverOpts struct {
+	// Root is the root directory of the container whose files are updated,
+	// resolved in the root mount namespace. If empty, "/" is used.
+	Root string `json:"root"`
+
+	// Hosts is the new content of /etc/hosts. If nil, /etc/hosts is left
+	// unchanged.
+	Hosts []byte `json:"hosts"`
+
+	// ResolvConf is the new content of /etc/resolv.conf. If nil,
+	// /etc/resolv.conf is left unchanged.
+	ResolvConf []byte `json:"resolv_conf"`
+}
+
+// UpdateResolver replaces the contents of /etc/hosts and /etc/resolv.conf
+// under o.Root. Paths are resolved relative to o.Root, so symlinks such as
+// /etc/resolv.conf -> /run/resolvconf/resolv.conf are followed within the
+// container. Files that do not exist are created with mode 0644.
+//
+// Files are rewritten in place, so processes that already opened them see
+// the new contents. Note that files bind mounted from the host, as done by
+// Docker, are changed on the host as well.
+func UpdateResolver(k *kernel.Kernel, o *UpdateResolverOpts) error {
+	r := o.Root
+	if r == "" {
+		r = "/"
+	}
+	if !path.IsAbs(r) {
+		return fmt.Errorf("root %q is not absolute", r)
+	}
+
+	ctx := k.SupervisorContext()
+	mns := k.RootMountNamespace()
+	if mns == nil {
+		return fmt.Errorf("no root mount namespace")
+	}
+	mnsRoot := mns.Root()
+	defer mnsRoot.DecRef()
+
+	maxTraversals := uint(linux.MaxSymlinkTraversals)
+	root, err := mns.FindInode(ctx, mnsRoot, nil, path.Clean(r), &maxTraversals)
+	if err != nil {
+		return fmt.Errorf("failed to find root %q: %v", r, err)
+	}
+	defer root.DecRef()
+
+	if o.Hosts != nil {
+		if err := replaceFile(ctx, mns, root, "/etc/hosts", o.Hosts); err != nil {
+			return err
+		}
+	}
+	if o.ResolvConf != nil {
+		if err := replaceFile(ctx, mns, root, "/etc/resolv.conf", o.ResolvConf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceFile replaces the contents of the file at name, resolved relative to
+// root, with data. The file is created if it doesn't exist.
+//
+// The new contents are written over the old ones before the file is truncated
+// to their length, so that concurrent readers never see an empty file.
+func replaceFile(ctx context.Context, mns *fs.MountNamespace, root *fs.Dirent, name string, data []byte) error {
+	maxTraversals := uint(linux.MaxSymlinkTraversals)
+	dir, base := path.Split(name)
+	parent, err := mns.FindInode(ctx, root, nil, dir, &maxTraversals)
+	if err != nil {
+		return fmt.Errorf("failed to find %q: %v", dir, err)
+	}
+	defer parent.DecRef()
+
+	var f *fs.File
+	d, err := mns.FindInode(ctx, root, parent, base, &maxTraversals)
+	switch err {
+	case nil:
+		defer d.DecRef()
+		if !fs.IsRegular(d.Inode.StableAttr) {
+			return fmt.Errorf("%q is not a regular file", name)
+		}
+		f, err = d.Inode.GetFile(ctx, d, fs.FileFlags{Write: true, Pwrite: true})
+		if err != nil {
+			return fmt.Errorf("failed to open %q: %v", name, err)
+		}
+	case syserror.ENOENT:
+		perms := fs.FilePermsFromMode(0644)
+		f, err = parent.Create(ctx, root, base, fs.FileFlags{Write: true, Pwrite: true}, perms)
+		if err != nil {
+			return fmt.Errorf("failed to create %q: %v", name, err)
+		}
+	default:
+		return fmt.Errorf("failed to find %q: %v", name, err)
+	}
+	defer f.DecRef()
+
+	w := &fs.FileWriter{Ctx: ctx, File: f}
+	if _, err := w.WriteAt(data, 0); err != nil {
+		return fmt.Errorf("failed to write %q: %v", name, err)
+	}
+	if err := f.Dirent.Inode.Truncate(ctx, f.Dirent, int64(len(data))); err != nil {
+		return fmt.Errorf("failed to truncate %q: %v", name, err)
+	}
+	log.Infof("Replaced %q under %q (%d bytes)", name, root.BaseName(), len(data))
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"io"
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/tmpfs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/contexttest"
+)
+
+// readFile returns the contents of the file at name, resolved relative to
+// root.
+func readFile(ctx context.Context, mns *fs.MountNamespace, root *fs.Dirent, name string) (string, error) {
+	maxTraversals := uint(linux.MaxSymlinkTraversals)
+	d, err := mns.FindInode(ctx, root, nil, name, &maxTraversals)
+	if err != nil {
+		return "", err
+	}
+	defer d.DecRef()
+	f, err := d.Inode.GetFile(ctx, d, fs.FileFlags{Read: true, Pread: true})
+	if err != nil {
+		return "", err
+	}
+	defer f.DecRef()
+
+	uattr, err := d.Inode.UnstableAttr(ctx)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, uattr.Size)
+	r := &fs.FileReader{Ctx: ctx, File: f}
+	n, err := r.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return string(buf[:n]), nil
+}
+
+func TestReplaceFile(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		old  string
+		new  string
+	}{
+		{
+			name: "shrink",
+			old:  "127.0.0.1\tlocalhost\n::1\tlocalhost ip6-localhost\n",
+			new:  "127.0.0.1\tlocalhost\n",
+		},
+		{
+			name: "grow",
+			old:  "nameserver 8.8.8.8\n",
+			new:  "nameserver 8.8.8.8\nnameserver 8.8.4.4\n",
+		},
+		{
+			name: "same length",
+			old:  "nameserver 1.1.1.1\n",
+			new:  "nameserver 9.9.9.9\n",
+		},
+		{
+			name: "empty",
+			old:  "nameserver 1.1.1.1\n",
+			new:  "",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := contexttest.Context(t)
+			msrc := fs.NewCachingMountSource(&tmpfs.Filesystem{}, fs.MountSourceFlags{})
+			perms := fs.FilePermsFromMode(0755)
+			etc := tmpfs.NewDir(ctx, nil, fs.RootOwner, perms, msrc)
+			rootInode := tmpfs.NewDir(ctx, map[string]*fs.Inode{"etc": etc}, fs.RootOwner, perms, msrc)
+			mns, err := fs.NewMountNamespace(ctx, rootInode)
+			if err != nil {
+				t.Fatalf("NewMountNamespace failed: %v", err)
+			}
+			defer mns.DecRef()
+			root := mns.Root()
+			defer root.DecRef()
+
+			// The file doesn't exist yet, so it is created first.
+			if err := replaceFile(ctx, mns, root, "/etc/hosts", []byte(test.old)); err != nil {
+				t.Fatalf("replaceFile(%q) failed: %v", test.old, err)
+			}
+			if err := replaceFile(ctx, mns, root, "/etc/hosts", []byte(test.new)); err != nil {
+				t.Fatalf("replaceFile(%q) failed: %v", test.new, err)
+			}
+			got, err := readFile(ctx, mns, root, "/etc/hosts")
+			if err != nil {
+				t.Fatalf("readFile failed: %v", err)
+			}
+			if got != test.new {
+				t.Errorf("replaceFile(%q) over %q: got contents %q, want %q", test.new, test.old, got, test.new)
+			}
+		})
+	}
+}
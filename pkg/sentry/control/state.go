@@ -21,6 +21,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/state"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/watchdog"
+	"gvisor.googlesource.com/gvisor/pkg/state/statefile"
 	"gvisor.googlesource.com/gvisor/pkg/urpc"
 )
 
@@ -42,6 +43,10 @@ type SaveOpts struct {
 	// Metadata is the set of metadata to prepend to the state file.
 	Metadata map[string]string `json:"metadata"`
 
+	// Compression is the compression algorithm of the state file: "flate"
+	// (the default if empty) or "zstd".
+	Compression string `json:"compression"`
+
 	// FilePayload contains the destination for the state.
 	urpc.FilePayload
 }
@@ -59,6 +64,7 @@ func (s *State) Save(o *SaveOpts, _ *struct{}) error {
 		Destination: o.FilePayload.Files[0],
 		Key:         o.Key,
 		Metadata:    o.Metadata,
+		Compression: statefile.Compression(o.Compression),
 		Callback: func(err error) {
 			if err == nil {
 				log.Infof("Save succeeded: exiting...")
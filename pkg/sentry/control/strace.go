@@ -0,0 +1,111 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"fmt"
+
+	"gvisor.googlesource.com/gvisor/pkg/fd"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/strace"
+	"gvisor.googlesource.com/gvisor/pkg/urpc"
+)
+
+// StraceArgs are the arguments to the Strace.Configure RPC.
+type StraceArgs struct {
+	// Enable enables strace if true, and disables it otherwise. All other
+	// fields are ignored when disabling strace.
+	Enable bool `json:"enable"`
+
+	// Syscalls are the names of the syscalls to trace. If empty, all
+	// syscalls are traced.
+	Syscalls []string `json:"syscalls"`
+
+	// PIDs restricts tracing to the given thread groups, identified by
+	// their ID in the root PID namespace of the sandbox. If empty, all
+	// tasks are traced.
+	PIDs []int32 `json:"pids"`
+
+	// JSON emits straces as JSON lines instead of text.
+	JSON bool `json:"json"`
+
+	// FilePayload optionally contains a file receiving the JSON lines. If
+	// absent, straces are written to the sandbox log.
+	urpc.FilePayload
+}
+
+// Strace includes strace-related RPC stubs. It allows strace to be enabled,
+// reconfigured and disabled in a running sandbox.
+type Strace struct{}
+
+// Configure is an RPC stub which enables or disables strace to the log with
+// the given options.
+//
+// Preconditions: strace.Initialize has been called.
+func (s *Strace) Configure(args *StraceArgs, _ *struct{}) error {
+	var output *fd.FD
+	if len(args.FilePayload.Files) > 0 {
+		var err error
+		output, err = fd.NewFromFile(args.FilePayload.Files[0])
+		for _, f := range args.FilePayload.Files {
+			f.Close()
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if !args.Enable {
+		if output != nil {
+			output.Close()
+		}
+		log.Infof("Disabling strace")
+		strace.Disable(strace.SinkTypeLog)
+		strace.SetOptions(strace.Options{})
+		return nil
+	}
+
+	if output != nil && !args.JSON {
+		output.Close()
+		return fmt.Errorf("an output file is only supported with JSON output")
+	}
+	opts := strace.Options{
+		Format: strace.FormatText,
+	}
+	if args.JSON {
+		opts.Format = strace.FormatJSON
+	}
+	if output != nil {
+		opts.Output = output
+	}
+	for _, pid := range args.PIDs {
+		opts.PIDs = append(opts.PIDs, kernel.ThreadID(pid))
+	}
+
+	// Enable validates the syscall names, so do it before changing
+	// the options.
+	log.Infof("Enabling strace, syscalls: %v, pids: %v, json: %t", args.Syscalls, args.PIDs, args.JSON)
+	if len(args.Syscalls) == 0 {
+		strace.EnableAll(strace.SinkTypeLog)
+	} else if err := strace.Enable(args.Syscalls, strace.SinkTypeLog); err != nil {
+		if output != nil {
+			output.Close()
+		}
+		return err
+	}
+	strace.SetOptions(opts)
+	return nil
+}
@@ -0,0 +1,384 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package binfmtmisc implements the binfmt_misc filesystem, which registers
+// interpreters for binary formats that the loader does not otherwise support.
+// See Linux's Documentation/admin-guide/binfmt-misc.rst.
+package binfmtmisc
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/device"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/fsutil"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/ramfs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/loader"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+// binfmtMiscDevice is the binfmt_misc virtual device.
+var binfmtMiscDevice = device.NewAnonDevice()
+
+// maxRegisterLength is the maximum number of bytes written to the register
+// file that are considered, from fs/binfmt_misc.c:MAX_REGISTER_LENGTH.
+const maxRegisterLength = 1920
+
+func newInode(iops fs.InodeOperations, msrc *fs.MountSource, typ fs.InodeType) *fs.Inode {
+	return fs.NewInode(iops, msrc, fs.StableAttr{
+		DeviceID:  binfmtMiscDevice.DeviceID(),
+		InodeID:   binfmtMiscDevice.NextIno(),
+		BlockSize: usermem.PageSize,
+		Type:      typ,
+	})
+}
+
+// binfmtMisc returns the binfmt_misc entries of the kernel in ctx.
+func binfmtMisc(ctx context.Context) *loader.BinfmtMisc {
+	return kernel.KernelFromContext(ctx).BinfmtMisc()
+}
+
+// root is the root directory of a binfmt_misc mount. It contains the static
+// register and status files, and a file for each registered entry.
+//
+// +stateify savable
+type root struct {
+	ramfs.Dir
+}
+
+// New returns the root node of a binfmt_misc filesystem.
+func New(ctx context.Context, msrc *fs.MountSource) (*fs.Inode, error) {
+	if kernel.KernelFromContext(ctx) == nil {
+		return nil, fmt.Errorf("binfmt_misc requires a kernel")
+	}
+
+	register := &registerInode{
+		SimpleFileInode: *fsutil.NewSimpleFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(0200), linux.BINFMTFS_MAGIC),
+	}
+	status := &statusInode{
+		SimpleFileInode: *fsutil.NewSimpleFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(0644), linux.BINFMTFS_MAGIC),
+	}
+	contents := map[string]*fs.Inode{
+		"register": newInode(register, msrc, fs.SpecialFile),
+		"status":   newInode(status, msrc, fs.SpecialFile),
+	}
+	r := &root{
+		Dir: *ramfs.NewDir(ctx, contents, fs.RootOwner, fs.FilePermsFromMode(0755)),
+	}
+	return newInode(r, msrc, fs.SpecialDirectory), nil
+}
+
+// Lookup implements fs.InodeOperations.Lookup.
+func (r *root) Lookup(ctx context.Context, dir *fs.Inode, name string) (*fs.Dirent, error) {
+	dirent, walkErr := r.Dir.Lookup(ctx, dir, name)
+	if walkErr == nil {
+		return dirent, nil
+	}
+
+	for _, entry := range binfmtMisc(ctx).Names() {
+		if entry == name {
+			e := &entryInode{
+				SimpleFileInode: *fsutil.NewSimpleFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(0644), linux.BINFMTFS_MAGIC),
+				name:            name,
+			}
+			return fs.NewDirent(newInode(e, dir.MountSource, fs.SpecialFile), name), nil
+		}
+	}
+	return nil, walkErr
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (r *root) GetFile(ctx context.Context, dirent *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	return fs.NewFile(ctx, dirent, flags, &rootFile{iops: r}), nil
+}
+
+// rootFile implements fs.FileOperations for the root directory.
+//
+// +stateify savable
+type rootFile struct {
+	fsutil.DirFileOperations `state:"nosave"`
+
+	iops *root
+}
+
+var _ fs.FileOperations = (*rootFile)(nil)
+
+// Readdir implements fs.FileOperations.Readdir.
+func (rf *rootFile) Readdir(ctx context.Context, file *fs.File, ser fs.DentrySerializer) (int64, error) {
+	offset := file.Offset()
+	dirCtx := &fs.DirCtx{
+		Serializer: ser,
+	}
+
+	// Get the static files from the ramfs dir.
+	names, m := rf.iops.Dir.Children()
+
+	// Add dot and dotdot.
+	root := fs.RootFromContext(ctx)
+	if root != nil {
+		defer root.DecRef()
+	}
+	dot, dotdot := file.Dirent.GetDotAttrs(root)
+	names = append(names, ".", "..")
+	m["."] = dot
+	m[".."] = dotdot
+
+	// Add registered entries.
+	for _, name := range binfmtMisc(ctx).Names() {
+		if _, ok := m[name]; ok {
+			continue
+		}
+		m[name] = fs.GenericDentAttr(fs.SpecialFile, binfmtMiscDevice)
+		names = append(names, name)
+	}
+
+	if offset >= int64(len(m)) {
+		return offset, nil
+	}
+	sort.Strings(names)
+	names = names[offset:]
+	for _, name := range names {
+		if err := dirCtx.DirEmit(name, m[name]); err != nil {
+			return offset, err
+		}
+		offset++
+	}
+	return offset, nil
+}
+
+// parseCommand parses a command written to the status file or an entry file,
+// as in fs/binfmt_misc.c:parse_command. It returns 0 for "0" (disable), 1 for
+// "1" (enable) and -1 for "-1" (remove).
+func parseCommand(ctx context.Context, src usermem.IOSequence) (int, error) {
+	if src.NumBytes() > 3 {
+		return 0, syserror.EINVAL
+	}
+	buf := make([]byte, src.NumBytes())
+	if _, err := src.CopyIn(ctx, buf); err != nil {
+		return 0, err
+	}
+	if buf[len(buf)-1] == '\n' {
+		buf = buf[:len(buf)-1]
+	}
+	switch string(buf) {
+	case "0":
+		return 0, nil
+	case "1":
+		return 1, nil
+	case "-1":
+		return -1, nil
+	default:
+		return 0, syserror.EINVAL
+	}
+}
+
+// readString implements fs.FileOperations.Read for a file with contents s.
+func readString(ctx context.Context, dst usermem.IOSequence, s string, offset int64) (int64, error) {
+	if offset >= int64(len(s)) {
+		return 0, io.EOF
+	}
+	n, err := dst.CopyOut(ctx, []byte(s[offset:]))
+	return int64(n), err
+}
+
+// registerInode is the inode for the register file, to which entries are
+// written to register them.
+//
+// +stateify savable
+type registerInode struct {
+	fsutil.SimpleFileInode
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (*registerInode) GetFile(ctx context.Context, d *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	return fs.NewFile(ctx, d, flags, &registerFile{}), nil
+}
+
+var _ fs.InodeOperations = (*registerInode)(nil)
+
+// +stateify savable
+type registerFile struct {
+	waiter.AlwaysReady       `state:"nosave"`
+	fsutil.FileNoIoctl       `state:"nosave"`
+	fsutil.FileNoMMap        `state:"nosave"`
+	fsutil.FileNoRead        `state:"nosave"`
+	fsutil.FileNoSeek        `state:"nosave"`
+	fsutil.FileNoopFlush     `state:"nosave"`
+	fsutil.FileNoopFsync     `state:"nosave"`
+	fsutil.FileNoopRelease   `state:"nosave"`
+	fsutil.FileNotDirReaddir `state:"nosave"`
+}
+
+// Write implements fs.FileOperations.Write.
+func (*registerFile) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+	if src.NumBytes() > maxRegisterLength {
+		return 0, syserror.EINVAL
+	}
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		return 0, syserror.EPERM
+	}
+	buf := make([]byte, src.NumBytes())
+	n, err := src.CopyIn(ctx, buf)
+	if err != nil {
+		return 0, err
+	}
+
+	root := t.FSContext().RootDirectory()
+	defer root.DecRef()
+	wd := t.FSContext().WorkingDirectory()
+	defer wd.DecRef()
+	if err := binfmtMisc(ctx).Register(ctx, t.MountNamespace(), root, wd, string(buf[:n])); err != nil {
+		return 0, err
+	}
+	return int64(n), nil
+}
+
+var _ fs.FileOperations = (*registerFile)(nil)
+
+// statusInode is the inode for the status file, which enables, disables or
+// removes all entries.
+//
+// +stateify savable
+type statusInode struct {
+	fsutil.SimpleFileInode
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (*statusInode) GetFile(ctx context.Context, d *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	flags.Pread = true
+	return fs.NewFile(ctx, d, flags, &statusFile{}), nil
+}
+
+var _ fs.InodeOperations = (*statusInode)(nil)
+
+// +stateify savable
+type statusFile struct {
+	waiter.AlwaysReady       `state:"nosave"`
+	fsutil.FileGenericSeek   `state:"nosave"`
+	fsutil.FileNoIoctl       `state:"nosave"`
+	fsutil.FileNoMMap        `state:"nosave"`
+	fsutil.FileNoopFlush     `state:"nosave"`
+	fsutil.FileNoopFsync     `state:"nosave"`
+	fsutil.FileNoopRelease   `state:"nosave"`
+	fsutil.FileNotDirReaddir `state:"nosave"`
+}
+
+// Read implements fs.FileOperations.Read.
+func (*statusFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
+	s := "disabled\n"
+	if binfmtMisc(ctx).Enabled() {
+		s = "enabled\n"
+	}
+	return readString(ctx, dst, s, offset)
+}
+
+// Write implements fs.FileOperations.Write.
+func (*statusFile) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	cmd, err := parseCommand(ctx, src)
+	if err != nil {
+		return 0, err
+	}
+	b := binfmtMisc(ctx)
+	switch cmd {
+	case 0:
+		b.SetEnabled(false)
+	case 1:
+		b.SetEnabled(true)
+	case -1:
+		b.UnregisterAll()
+	}
+	return src.NumBytes(), nil
+}
+
+var _ fs.FileOperations = (*statusFile)(nil)
+
+// entryInode is the inode for the file of a registered entry, which describes
+// the entry and enables, disables or removes it.
+//
+// +stateify savable
+type entryInode struct {
+	fsutil.SimpleFileInode
+
+	// name is the name of the entry.
+	name string
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (e *entryInode) GetFile(ctx context.Context, d *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	flags.Pread = true
+	return fs.NewFile(ctx, d, flags, &entryFile{name: e.name}), nil
+}
+
+var _ fs.InodeOperations = (*entryInode)(nil)
+
+// +stateify savable
+type entryFile struct {
+	waiter.AlwaysReady       `state:"nosave"`
+	fsutil.FileGenericSeek   `state:"nosave"`
+	fsutil.FileNoIoctl       `state:"nosave"`
+	fsutil.FileNoMMap        `state:"nosave"`
+	fsutil.FileNoopFlush     `state:"nosave"`
+	fsutil.FileNoopFsync     `state:"nosave"`
+	fsutil.FileNoopRelease   `state:"nosave"`
+	fsutil.FileNotDirReaddir `state:"nosave"`
+
+	// name is the name of the entry.
+	name string
+}
+
+// Read implements fs.FileOperations.Read.
+func (f *entryFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
+	s, err := binfmtMisc(ctx).Status(f.name)
+	if err != nil {
+		return 0, err
+	}
+	return readString(ctx, dst, s, offset)
+}
+
+// Write implements fs.FileOperations.Write.
+func (f *entryFile) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	cmd, err := parseCommand(ctx, src)
+	if err != nil {
+		return 0, err
+	}
+	b := binfmtMisc(ctx)
+	switch cmd {
+	case 0:
+		err = b.SetEntryEnabled(f.name, false)
+	case 1:
+		err = b.SetEntryEnabled(f.name, true)
+	case -1:
+		err = b.Unregister(f.name)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return src.NumBytes(), nil
+}
+
+var _ fs.FileOperations = (*entryFile)(nil)
@@ -22,6 +22,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/ashmem"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/binder"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/host"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/ramfs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/tmpfs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
@@ -38,6 +39,7 @@ const (
 	fullDevMinor    uint32 = 7
 	randomDevMinor  uint32 = 8
 	urandomDevMinor uint32 = 9
+	kmsgDevMinor    uint32 = 11
 )
 
 func newCharacterDevice(iops fs.InodeOperations, msrc *fs.MountSource) *fs.Inode {
@@ -60,6 +62,17 @@ func newMemDevice(iops fs.InodeOperations, msrc *fs.MountSource, minor uint32) *
 	})
 }
 
+func newBlockDevice(ctx context.Context, d *host.BlockDevice, msrc *fs.MountSource) *fs.Inode {
+	return fs.NewInode(host.NewBlockDevice(ctx, d), msrc, fs.StableAttr{
+		DeviceID:        devDevice.DeviceID(),
+		InodeID:         devDevice.NextIno(),
+		BlockSize:       usermem.PageSize,
+		Type:            fs.BlockDevice,
+		DeviceFileMajor: d.Major,
+		DeviceFileMinor: d.Minor,
+	})
+}
+
 func newDirectory(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
 	iops := ramfs.NewDir(ctx, nil, fs.RootOwner, fs.FilePermsFromMode(0555))
 	return fs.NewInode(iops, msrc, fs.StableAttr{
@@ -80,8 +93,9 @@ func newSymlink(ctx context.Context, target string, msrc *fs.MountSource) *fs.In
 	})
 }
 
-// New returns the root node of a device filesystem.
-func New(ctx context.Context, msrc *fs.MountSource, binderEnabled bool, ashmemEnabled bool) *fs.Inode {
+// New returns the root node of a device filesystem. blockDevices are host
+// block devices added to the root of the filesystem.
+func New(ctx context.Context, msrc *fs.MountSource, binderEnabled bool, ashmemEnabled bool, blockDevices []host.BlockDevice) *fs.Inode {
 	contents := map[string]*fs.Inode{
 		"fd":     newSymlink(ctx, "/proc/self/fd", msrc),
 		"stdin":  newSymlink(ctx, "/proc/self/fd/0", msrc),
@@ -100,6 +114,10 @@ func New(ctx context.Context, msrc *fs.MountSource, binderEnabled bool, ashmemEn
 		"random":  newMemDevice(newRandomDevice(ctx, fs.RootOwner, 0444), msrc, randomDevMinor),
 		"urandom": newMemDevice(newRandomDevice(ctx, fs.RootOwner, 0444), msrc, urandomDevMinor),
 
+		// kmsg exposes the kernel log, including notices from the
+		// sentry about unsupported functionality.
+		"kmsg": newMemDevice(newKmsgDevice(ctx, fs.RootOwner, 0644), msrc, kmsgDevMinor),
+
 		"shm": tmpfs.NewDir(ctx, nil, fs.RootOwner, fs.FilePermsFromMode(0777), msrc),
 
 		// A devpts is typically mounted at /dev/pts to provide
@@ -128,6 +146,11 @@ func New(ctx context.Context, msrc *fs.MountSource, binderEnabled bool, ashmemEn
 		contents["ashmem"] = newCharacterDevice(ashmem, msrc)
 	}
 
+	for i := range blockDevices {
+		d := &blockDevices[i]
+		contents[d.Name] = newBlockDevice(ctx, d, msrc)
+	}
+
 	iops := ramfs.NewDir(ctx, contents, fs.RootOwner, fs.FilePermsFromMode(0555))
 	return fs.NewInode(iops, msrc, fs.StableAttr{
 		DeviceID:  devDevice.DeviceID(),
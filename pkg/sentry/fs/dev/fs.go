@@ -19,6 +19,7 @@ import (
 
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/host"
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
 )
 
@@ -66,7 +67,10 @@ func (*filesystem) Flags() fs.FilesystemFlags {
 }
 
 // Mount returns a devtmpfs root that can be positioned in the vfs.
-func (f *filesystem) Mount(ctx context.Context, device string, flags fs.MountSourceFlags, data string, _ interface{}) (*fs.Inode, error) {
+//
+// dataObj may be a []host.BlockDevice containing host block devices to add to
+// the filesystem.
+func (f *filesystem) Mount(ctx context.Context, device string, flags fs.MountSourceFlags, data string, dataObj interface{}) (*fs.Inode, error) {
 	// device is always ignored.
 	// devtmpfs backed by ramfs ignores bad options. See fs/ramfs/inode.c:ramfs_parse_options.
 	//  -> we should consider parsing the mode and backing devtmpfs by this.
@@ -94,6 +98,14 @@ func (f *filesystem) Mount(ctx context.Context, device string, flags fs.MountSou
 		}
 	}
 
+	var blockDevices []host.BlockDevice
+	if dataObj != nil {
+		var ok bool
+		if blockDevices, ok = dataObj.([]host.BlockDevice); !ok {
+			return nil, syserror.EINVAL
+		}
+	}
+
 	// Construct the devtmpfs root.
-	return New(ctx, fs.NewNonCachingMountSource(f, flags), binderEnabled, ashmemEnabled), nil
+	return New(ctx, fs.NewNonCachingMountSource(f, flags), binderEnabled, ashmemEnabled, blockDevices), nil
 }
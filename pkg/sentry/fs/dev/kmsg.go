@@ -0,0 +1,210 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dev
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/fsutil"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+// kmsgMaxWrite is the maximum length of a single message written to
+// /dev/kmsg, from Linux's LOG_LINE_MAX.
+const kmsgMaxWrite = 1024 - 32
+
+// kmsgDefaultPriority is the priority of messages written to /dev/kmsg
+// without a priority prefix: LOG_USER facility at the default message level.
+const kmsgDefaultPriority = 1<<3 | kernel.SyslogLevelWarning
+
+// kmsgDevice is used to implement /dev/kmsg.
+//
+// +stateify savable
+type kmsgDevice struct {
+	fsutil.InodeGenericChecker       `state:"nosave"`
+	fsutil.InodeNoExtendedAttributes `state:"nosave"`
+	fsutil.InodeNoopRelease          `state:"nosave"`
+	fsutil.InodeNoopTruncate         `state:"nosave"`
+	fsutil.InodeNoopWriteOut         `state:"nosave"`
+	fsutil.InodeNotDirectory         `state:"nosave"`
+	fsutil.InodeNotMappable          `state:"nosave"`
+	fsutil.InodeNotSocket            `state:"nosave"`
+	fsutil.InodeNotSymlink           `state:"nosave"`
+	fsutil.InodeVirtual              `state:"nosave"`
+
+	fsutil.InodeSimpleAttributes
+}
+
+var _ fs.InodeOperations = (*kmsgDevice)(nil)
+
+func newKmsgDevice(ctx context.Context, owner fs.FileOwner, mode linux.FileMode) *kmsgDevice {
+	return &kmsgDevice{
+		InodeSimpleAttributes: fsutil.NewInodeSimpleAttributes(ctx, owner, fs.FilePermsFromMode(mode), linux.TMPFS_MAGIC),
+	}
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (*kmsgDevice) GetFile(ctx context.Context, dirent *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	k := kernel.KernelFromContext(ctx)
+	if k == nil {
+		return nil, syserror.ENODEV
+	}
+	return fs.NewFile(ctx, dirent, flags, &kmsgFileOperations{
+		k:   k,
+		seq: k.Syslog().FirstSeq(),
+	}), nil
+}
+
+// kmsgFileOperations implements fs.FileOperations for /dev/kmsg. Each read
+// returns a single record, in the format described by
+// Documentation/ABI/testing/dev-kmsg.
+//
+// +stateify savable
+type kmsgFileOperations struct {
+	fsutil.FileNoIoctl       `state:"nosave"`
+	fsutil.FileNoMMap        `state:"nosave"`
+	fsutil.FileNoopFlush     `state:"nosave"`
+	fsutil.FileNoopFsync     `state:"nosave"`
+	fsutil.FileNoopRelease   `state:"nosave"`
+	fsutil.FileNotDirReaddir `state:"nosave"`
+
+	k *kernel.Kernel
+
+	// mu protects seq.
+	mu sync.Mutex `state:"nosave"`
+
+	// seq is the sequence number of the next record to read.
+	seq uint64
+}
+
+var _ fs.FileOperations = (*kmsgFileOperations)(nil)
+
+// Readiness implements waiter.Waitable.Readiness.
+func (f *kmsgFileOperations) Readiness(mask waiter.EventMask) waiter.EventMask {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ready := waiter.EventOut
+	if f.k.Syslog().Readable(f.seq) {
+		ready |= waiter.EventIn
+	}
+	return mask & ready
+}
+
+// EventRegister implements waiter.Waitable.EventRegister.
+func (f *kmsgFileOperations) EventRegister(e *waiter.Entry, mask waiter.EventMask) {
+	f.k.Syslog().EventRegister(e, mask)
+}
+
+// EventUnregister implements waiter.Waitable.EventUnregister.
+func (f *kmsgFileOperations) EventUnregister(e *waiter.Entry) {
+	f.k.Syslog().EventUnregister(e)
+}
+
+// Seek implements fs.FileOperations.Seek.
+//
+// Only seeking to the beginning or end of the log is supported.
+func (f *kmsgFileOperations) Seek(ctx context.Context, file *fs.File, whence fs.SeekWhence, offset int64) (int64, error) {
+	if offset != 0 {
+		return 0, syserror.ESPIPE
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch whence {
+	case fs.SeekSet:
+		f.seq = f.k.Syslog().FirstSeq()
+	case fs.SeekEnd:
+		f.seq = f.k.Syslog().NextSeq()
+	default:
+		return 0, syserror.EINVAL
+	}
+	return 0, nil
+}
+
+// Read implements fs.FileOperations.Read.
+func (f *kmsgFileOperations) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, _ int64) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	r, seq, err := f.k.Syslog().Record(f.seq)
+	if err == syserror.EPIPE {
+		// Records were overwritten since the last read. Like Linux,
+		// report this once and then continue from the oldest record.
+		f.seq = seq
+		return 0, err
+	}
+	if err != nil {
+		return 0, err
+	}
+	buf := []byte(r.KmsgString())
+	if dst.NumBytes() < int64(len(buf)) {
+		return 0, syserror.EINVAL
+	}
+	n, err := dst.CopyOut(ctx, buf)
+	if err != nil {
+		return int64(n), err
+	}
+	f.seq = r.Seq + 1
+	return int64(n), nil
+}
+
+// Write implements fs.FileOperations.Write.
+//
+// Each write adds a single message to the kernel log. The message may be
+// prefixed with "<N>" to specify its priority.
+func (f *kmsgFileOperations) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, _ int64) (int64, error) {
+	n := src.NumBytes()
+	if n == 0 {
+		return 0, nil
+	}
+	if n > kmsgMaxWrite {
+		return 0, syserror.EINVAL
+	}
+	buf := make([]byte, n)
+	if _, err := src.CopyIn(ctx, buf); err != nil {
+		return 0, err
+	}
+
+	priority, msg := parseKmsgPriority(strings.TrimRight(string(buf), "\n"))
+	f.k.Printk(priority, "%s", msg)
+	return n, nil
+}
+
+// parseKmsgPriority splits an optional "<N>" priority prefix from msg.
+func parseKmsgPriority(msg string) (int, string) {
+	if !strings.HasPrefix(msg, "<") {
+		return kmsgDefaultPriority, msg
+	}
+	end := strings.IndexByte(msg, '>')
+	if end < 0 {
+		return kmsgDefaultPriority, msg
+	}
+	p, err := strconv.ParseUint(msg[1:end], 10, 32)
+	if err != nil {
+		return kmsgDefaultPriority, msg
+	}
+	// Userspace may not log messages with the kernel facility.
+	if p>>3 == 0 {
+		p |= 1 << 3
+	}
+	return int(p), msg[end+1:]
+}
@@ -0,0 +1,147 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"gvisor.googlesource.com/gvisor/pkg/refs"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+// ExportableFilesystem is implemented by Filesystems whose inode IDs are
+// stable for the lifetime of the inode, such that their files may be referred
+// to by file handles, as with name_to_handle_at(2). It corresponds to a Linux
+// super_block with s_export_op set.
+type ExportableFilesystem interface {
+	Filesystem
+
+	// Exportable is a marker method; it does nothing.
+	Exportable()
+}
+
+// FileHandle identifies a file within a MountSource.
+type FileHandle struct {
+	// InodeID is the StableAttr.InodeID of the file.
+	InodeID uint64
+
+	// Generation distinguishes between distinct files that have had the
+	// same InodeID over the lifetime of the MountSource.
+	Generation uint32
+}
+
+// fileHandleEntry is a file that has been encoded as a file handle.
+//
+// +stateify savable
+type fileHandleEntry struct {
+	msrc *MountSource
+	ino  uint64
+	gen  uint32
+
+	// dirent is a weak reference on a Dirent for the file. File handles
+	// remain valid only for as long as some Dirent for the file is alive.
+	dirent *refs.WeakRef
+}
+
+// WeakRefGone implements refs.WeakRefUser.WeakRefGone.
+func (e *fileHandleEntry) WeakRefGone() {
+	e.msrc.handlesMu.Lock()
+	if e.msrc.handles[e.ino] == e {
+		delete(e.msrc.handles, e.ino)
+	}
+	e.msrc.handlesMu.Unlock()
+}
+
+// IsExportable returns true if files in msrc can be encoded as file handles.
+func (msrc *MountSource) IsExportable() bool {
+	_, ok := msrc.Filesystem.(ExportableFilesystem)
+	return ok
+}
+
+// EncodeFileHandle returns a file handle for d, which can later be passed to
+// DecodeFileHandle on d's MountSource to get a Dirent for the same file.
+//
+// Returns EOPNOTSUPP if d's filesystem does not support file handles.
+func (d *Dirent) EncodeFileHandle() (FileHandle, error) {
+	msrc := d.Inode.MountSource
+	if !msrc.IsExportable() {
+		return FileHandle{}, syserror.EOPNOTSUPP
+	}
+	ino := d.Inode.StableAttr.InodeID
+
+	// Dropping a reference on a Dirent may destroy it, which calls
+	// WeakRefGone, so must not be done with handlesMu held.
+	var prev refs.RefCounter
+	defer func() {
+		if prev != nil {
+			prev.DecRef()
+		}
+	}()
+
+	msrc.handlesMu.Lock()
+	defer msrc.handlesMu.Unlock()
+
+	e, ok := msrc.handles[ino]
+	if ok {
+		if prev = e.dirent.Get(); prev != nil && prev.(*Dirent).Inode == d.Inode {
+			// Hard links to the same Inode share a handle.
+			return FileHandle{InodeID: ino, Generation: e.gen}, nil
+		}
+		// The file previously encoded with this InodeID no longer
+		// exists, so its handles become stale.
+		e.dirent.Drop()
+	}
+
+	if msrc.handles == nil {
+		msrc.handles = make(map[uint64]*fileHandleEntry)
+	}
+	msrc.handleGen++
+	e = &fileHandleEntry{
+		msrc: msrc,
+		ino:  ino,
+		gen:  msrc.handleGen,
+	}
+	e.dirent = refs.NewWeakRef(d, e)
+	msrc.handles[ino] = e
+	return FileHandle{InodeID: ino, Generation: e.gen}, nil
+}
+
+// DecodeFileHandle returns a Dirent for the file identified by h, which must
+// have been returned by EncodeFileHandle for a Dirent in msrc. Callers must
+// call DecRef on the returned Dirent.
+//
+// Returns ESTALE if the file no longer exists.
+func (msrc *MountSource) DecodeFileHandle(h FileHandle) (*Dirent, error) {
+	msrc.handlesMu.Lock()
+	defer msrc.handlesMu.Unlock()
+
+	e, ok := msrc.handles[h.InodeID]
+	if !ok || e.gen != h.Generation {
+		return nil, syserror.ESTALE
+	}
+	rc := e.dirent.Get()
+	if rc == nil {
+		return nil, syserror.ESTALE
+	}
+	return rc.(*Dirent), nil
+}
+
+// dropFileHandles drops all weak references held by msrc for file handles.
+func (msrc *MountSource) dropFileHandles() {
+	msrc.handlesMu.Lock()
+	defer msrc.handlesMu.Unlock()
+	for _, e := range msrc.handles {
+		e.dirent.Drop()
+	}
+	msrc.handles = nil
+}
@@ -104,3 +104,10 @@ type FileOperations interface {
 	// Preconditions: The AddressSpace (if any) that io refers to is activated.
 	Ioctl(ctx context.Context, io usermem.IO, args arch.SyscallArguments) (uintptr, error)
 }
+
+// FdInfoer is implemented by FileOperations that report information specific
+// to their type in /proc/[pid]/fdinfo, following the common fields.
+type FdInfoer interface {
+	// FdInfo returns the lines to report, each terminated by a newline.
+	FdInfo(ctx context.Context) string
+}
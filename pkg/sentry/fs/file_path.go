@@ -0,0 +1,92 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/memmap"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+// NewPathFile returns a File that refers to dirent without opening it, as
+// created by open(2) with O_PATH.
+//
+// The returned File can be used to refer to dirent, e.g. as the directory
+// of *at(2) syscalls, but all operations on the file itself fail with EBADF.
+// Unlike Inode.GetFile, NewPathFile never opens the underlying file, so it
+// may be used on any kind of inode, including symlinks, sockets and devices.
+func NewPathFile(ctx context.Context, dirent *Dirent, flags FileFlags) *File {
+	flags = FileFlags{
+		Directory: flags.Directory,
+		LargeFile: flags.LargeFile,
+		Path:      true,
+	}
+	return NewFile(ctx, dirent, flags, &pathFileOperations{})
+}
+
+// pathFileOperations implements FileOperations for O_PATH files.
+//
+// +stateify savable
+type pathFileOperations struct {
+	waiter.AlwaysReady `state:"nosave"`
+}
+
+var _ FileOperations = (*pathFileOperations)(nil)
+
+// Release implements FileOperations.Release.
+func (*pathFileOperations) Release() {}
+
+// Seek implements FileOperations.Seek.
+func (*pathFileOperations) Seek(context.Context, *File, SeekWhence, int64) (int64, error) {
+	return 0, syserror.EBADF
+}
+
+// Readdir implements FileOperations.Readdir.
+func (*pathFileOperations) Readdir(context.Context, *File, DentrySerializer) (int64, error) {
+	return 0, syserror.EBADF
+}
+
+// Read implements FileOperations.Read.
+func (*pathFileOperations) Read(context.Context, *File, usermem.IOSequence, int64) (int64, error) {
+	return 0, syserror.EBADF
+}
+
+// Write implements FileOperations.Write.
+func (*pathFileOperations) Write(context.Context, *File, usermem.IOSequence, int64) (int64, error) {
+	return 0, syserror.EBADF
+}
+
+// Fsync implements FileOperations.Fsync.
+func (*pathFileOperations) Fsync(context.Context, *File, int64, int64, SyncType) error {
+	return syserror.EBADF
+}
+
+// Flush implements FileOperations.Flush.
+func (*pathFileOperations) Flush(context.Context, *File) error {
+	return nil
+}
+
+// ConfigureMMap implements FileOperations.ConfigureMMap.
+func (*pathFileOperations) ConfigureMMap(context.Context, *File, *memmap.MMapOpts) error {
+	return syserror.EBADF
+}
+
+// Ioctl implements FileOperations.Ioctl.
+func (*pathFileOperations) Ioctl(context.Context, usermem.IO, arch.SyscallArguments) (uintptr, error) {
+	return 0, syserror.EBADF
+}
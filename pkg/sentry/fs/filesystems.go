@@ -61,6 +61,18 @@ type Filesystem interface {
 	AllowUserList() bool
 }
 
+// Remounter is implemented by Filesystems whose mounts can be reconfigured by
+// mount(2) with MS_REMOUNT.
+type Remounter interface {
+	// Remount reconfigures the mount with root inode root using file system
+	// dependent data options, which are the same as those accepted by
+	// Filesystem.Mount.
+	//
+	// Remount may return arbitrary errors. They do not need syserr
+	// translations.
+	Remount(ctx context.Context, root *Inode, data string) error
+}
+
 // filesystems is the global set of registered file systems. It does not need
 // to be saved. Packages registering and unregistering file systems must do so
 // before calling save/restore methods.
@@ -57,6 +57,10 @@ type FileFlags struct {
 	// Linux sets this flag for all files. Since gVisor is only compatible
 	// with 64-bit Linux, it also sets this flag for all files.
 	LargeFile bool
+
+	// Path indicates that this file was opened with O_PATH. It only refers
+	// to a location in the filesystem and cannot be used for I/O.
+	Path bool
 }
 
 // SettableFileFlags is a subset of FileFlags above that can be changed
@@ -108,6 +112,9 @@ func (f FileFlags) ToLinux() (mask uint) {
 	if f.LargeFile {
 		mask |= linux.O_LARGEFILE
 	}
+	if f.Path {
+		mask |= linux.O_PATH
+	}
 
 	switch {
 	case f.Read && f.Write:
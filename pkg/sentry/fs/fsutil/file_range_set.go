@@ -207,3 +207,22 @@ func (frs *FileRangeSet) Truncate(end uint64, mf *pgalloc.MemoryFile) {
 		}
 	}
 }
+
+// Residency sets dst[i] to 1 if the page at offset mr.Start +
+// i*usermem.PageSize is cached in frs and committed in mf, and 0 otherwise.
+//
+// Preconditions: mr must be page-aligned and non-empty. len(dst) must be at
+// least mr.Length() / usermem.PageSize.
+func (frs *FileRangeSet) Residency(mr memmap.MappableRange, mf *pgalloc.MemoryFile, dst []byte) error {
+	dst = dst[:mr.Length()/usermem.PageSize]
+	for i := range dst {
+		dst[i] = 0
+	}
+	for seg := frs.LowerBoundSegment(mr.Start); seg.Ok() && seg.Start() < mr.End; seg = seg.NextSegment() {
+		segMR := seg.Range().Intersect(mr)
+		if err := mf.Residency(seg.FileRangeOf(segMR), dst[(segMR.Start-mr.Start)/usermem.PageSize:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -17,9 +17,11 @@ package fsutil
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"syscall"
 
 	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/metric"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/memmap"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/safemem"
@@ -48,8 +50,56 @@ type HostFileMapper struct {
 	// obtained by calling syscall.Mmap. mappings is protected by
 	// mapsMu.
 	mappings map[uint64]mapping `state:"nosave"`
+
+	// useGen is incremented by each call to MapInternal, and is used to
+	// record when each chunk mapping was last used. reclaimGen is the value
+	// of useGen at the end of the previous call to reclaimIdle; chunks whose
+	// mappings have not been used since are idle. Both are protected by
+	// mapsMu.
+	useGen     uint64 `state:"nosave"`
+	reclaimGen uint64 `state:"nosave"`
+
+	// invalidator is used by reclaimIdle to stop all users of chunk mappings.
+	// If invalidator is nil, chunk mappings are never reclaimed. invalidator
+	// is immutable.
+	invalidator internalMappingsInvalidator
+}
+
+// internalMappingsInvalidator is implemented by users of HostFileMapper that
+// support reclaiming idle chunk mappings.
+type internalMappingsInvalidator interface {
+	// invalidateInternalMappings ensures that safemem.BlockSeqs previously
+	// returned by HostFileMapper.MapInternal for offsets in mr are no longer
+	// in use, by invalidating all memmap.MappingSpace mappings of mr.
+	//
+	// invalidateInternalMappings is called without HostFileMapper locks held.
+	invalidateInternalMappings(mr memmap.MappableRange)
+}
+
+var (
+	// mappedChunks is the number of chunks mapped by all HostFileMappers.
+	// mappedChunks is accessed using atomic memory operations.
+	mappedChunks int64
+
+	reclaimedChunks = metric.MustCreateNewUint64Metric("/fs/host_file_mapper/reclaimed_chunks", false /* sync */, "Number of idle host file chunk mappings unmapped by the sentry.")
+)
+
+func init() {
+	metric.MustRegisterCustomUint64Metric("/fs/host_file_mapper/mapped_chunks", false /* sync */, "Number of host file chunks currently mapped by the sentry.", func() uint64 {
+		return uint64(atomic.LoadInt64(&mappedChunks))
+	})
 }
 
+// activeMappers contains all HostFileMappers that have a non-nil invalidator
+// and at least one chunk mapping. activeMappers is protected by
+// activeMappersMu.
+//
+// Lock order: HostFileMapper.mapsMu -> activeMappersMu.
+var (
+	activeMappersMu sync.Mutex
+	activeMappers   = make(map[*HostFileMapper]struct{})
+)
+
 const (
 	chunkShift = usermem.HugePageShift
 	chunkSize  = 1 << chunkShift
@@ -63,6 +113,10 @@ func pagesInChunk(mr memmap.MappableRange, chunkStart uint64) int32 {
 type mapping struct {
 	addr     uintptr
 	writable bool
+
+	// lastUse is the value of HostFileMapper.useGen when the mapping was
+	// last used by MapInternal.
+	lastUse uint64
 }
 
 // NewHostFileMapper returns a HostFileMapper with no references or cached
@@ -125,6 +179,7 @@ func (f *HostFileMapper) MapInternal(fr platform.FileRange, fd int, write bool)
 	chunks := ((fr.End + chunkMask) >> chunkShift) - (fr.Start >> chunkShift)
 	f.mapsMu.Lock()
 	defer f.mapsMu.Unlock()
+	f.useGen++
 	if chunks == 1 {
 		// Avoid an unnecessary slice allocation.
 		var seq safemem.BlockSeq
@@ -160,8 +215,8 @@ func (f *HostFileMapper) forEachMappingBlockLocked(fr platform.FileRange, fd int
 			if errno != 0 {
 				return errno
 			}
-			m = mapping{addr, write}
-			f.mappings[chunkStart] = m
+			m = mapping{addr: addr, writable: write}
+			f.addMappingLocked(chunkStart, m)
 		} else if write && !m.writable {
 			addr, _, errno := syscall.Syscall6(
 				syscall.SYS_MMAP,
@@ -174,9 +229,10 @@ func (f *HostFileMapper) forEachMappingBlockLocked(fr platform.FileRange, fd int
 			if errno != 0 {
 				return errno
 			}
-			m = mapping{addr, write}
-			f.mappings[chunkStart] = m
+			m = mapping{addr: addr, writable: write}
 		}
+		m.lastUse = f.useGen
+		f.mappings[chunkStart] = m
 		var startOff uint64
 		if chunkStart < fr.Start {
 			startOff = fr.Start - chunkStart
@@ -200,6 +256,18 @@ func (f *HostFileMapper) UnmapAll() {
 	}
 }
 
+// Preconditions: f.mapsMu must be locked. f.mappings[chunkStart] does not
+// exist.
+func (f *HostFileMapper) addMappingLocked(chunkStart uint64, m mapping) {
+	if len(f.mappings) == 0 && f.invalidator != nil {
+		activeMappersMu.Lock()
+		activeMappers[f] = struct{}{}
+		activeMappersMu.Unlock()
+	}
+	f.mappings[chunkStart] = m
+	atomic.AddInt64(&mappedChunks, 1)
+}
+
 // Preconditions: f.mapsMu must be locked. f.mappings[chunkStart] == m.
 func (f *HostFileMapper) unmapAndRemoveLocked(chunkStart uint64, m mapping) {
 	if _, _, errno := syscall.Syscall(syscall.SYS_MUNMAP, m.addr, chunkSize, 0); errno != 0 {
@@ -208,4 +276,76 @@ func (f *HostFileMapper) unmapAndRemoveLocked(chunkStart uint64, m mapping) {
 		log.Warningf("HostFileMapper: failed to unmap mapping %#x for chunk %#x: %v", m.addr, chunkStart, errno)
 	}
 	delete(f.mappings, chunkStart)
+	atomic.AddInt64(&mappedChunks, -1)
+	if len(f.mappings) == 0 && f.invalidator != nil {
+		activeMappersMu.Lock()
+		delete(activeMappers, f)
+		activeMappersMu.Unlock()
+	}
+}
+
+// ReclaimIdleMappings unmaps chunk mappings, of all HostFileMappers that
+// support doing so, that have not been used since the previous call to
+// ReclaimIdleMappings. Chunk mappings are otherwise retained for as long as
+// any offset in the chunk is referenced, so calling ReclaimIdleMappings
+// periodically bounds the sentry address space consumed by rarely-used
+// mappings of host files. It returns the number of chunks unmapped.
+//
+// Since reclaiming a chunk mapping invalidates application mappings of the
+// chunk, ReclaimIdleMappings should be called infrequently.
+//
+// Preconditions: No locks may be held; in particular, ReclaimIdleMappings
+// takes mm.MemoryManager.activeMu.
+func ReclaimIdleMappings() int {
+	activeMappersMu.Lock()
+	mappers := make([]*HostFileMapper, 0, len(activeMappers))
+	for f := range activeMappers {
+		mappers = append(mappers, f)
+	}
+	activeMappersMu.Unlock()
+
+	var reclaimed int
+	for _, f := range mappers {
+		reclaimed += f.reclaimIdle()
+	}
+	reclaimedChunks.IncrementBy(uint64(reclaimed))
+	return reclaimed
+}
+
+// reclaimIdle unmaps chunk mappings in f that have not been used since the
+// previous call to reclaimIdle, and returns the number of chunks unmapped.
+//
+// Preconditions: f.invalidator != nil.
+func (f *HostFileMapper) reclaimIdle() int {
+	f.mapsMu.Lock()
+	idle := make(map[uint64]uint64) // chunkStart -> lastUse
+	for chunkStart, m := range f.mappings {
+		if m.lastUse <= f.reclaimGen {
+			idle[chunkStart] = m.lastUse
+		}
+	}
+	f.reclaimGen = f.useGen
+	f.mapsMu.Unlock()
+	if len(idle) == 0 {
+		return 0
+	}
+
+	// Invalidating application mappings of idle chunks stops all uses of
+	// their existing mappings. MapInternal may be called again concurrently,
+	// but will then update the chunk's lastUse, preventing it from being
+	// unmapped below.
+	for chunkStart := range idle {
+		f.invalidator.invalidateInternalMappings(memmap.MappableRange{chunkStart, chunkStart + chunkSize})
+	}
+
+	var reclaimed int
+	f.mapsMu.Lock()
+	defer f.mapsMu.Unlock()
+	for chunkStart, lastUse := range idle {
+		if m, ok := f.mappings[chunkStart]; ok && m.lastUse == lastUse {
+			f.unmapAndRemoveLocked(chunkStart, m)
+			reclaimed++
+		}
+	}
+	return reclaimed
 }
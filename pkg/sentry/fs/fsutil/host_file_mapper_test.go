@@ -0,0 +1,86 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsutil
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/memmap"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
+)
+
+type recordingInvalidator struct {
+	inv []memmap.MappableRange
+}
+
+func (r *recordingInvalidator) invalidateInternalMappings(mr memmap.MappableRange) {
+	r.inv = append(r.inv, mr)
+}
+
+func TestHostFileMapperReclaimIdle(t *testing.T) {
+	file, err := ioutil.TempFile("", "host_file_mapper_test")
+	if err != nil {
+		t.Fatalf("TempFile failed: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	if err := file.Truncate(2 * chunkSize); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+	fd := int(file.Fd())
+
+	var ri recordingInvalidator
+	f := NewHostFileMapper()
+	f.invalidator = &ri
+	all := memmap.MappableRange{0, 2 * chunkSize}
+	f.IncRefOn(all)
+	defer f.DecRefOn(all)
+
+	for _, fr := range []platform.FileRange{{0, chunkSize}, {chunkSize, 2 * chunkSize}} {
+		if _, err := f.MapInternal(fr, fd, false /* write */); err != nil {
+			t.Fatalf("MapInternal(%v) failed: %v", fr, err)
+		}
+	}
+
+	// Both chunks were used since the last (nonexistent) reclaim.
+	if got := ReclaimIdleMappings(); got != 0 {
+		t.Errorf("first ReclaimIdleMappings: got %d, wanted 0", got)
+	}
+
+	// Use only the second chunk, so that only the first is idle.
+	if _, err := f.MapInternal(platform.FileRange{chunkSize, 2 * chunkSize}, fd, false /* write */); err != nil {
+		t.Fatalf("MapInternal failed: %v", err)
+	}
+	if got := ReclaimIdleMappings(); got != 1 {
+		t.Errorf("second ReclaimIdleMappings: got %d, wanted 1", got)
+	}
+	if got, want := ri.inv, []memmap.MappableRange{{0, chunkSize}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("invalidations: got %v, wanted %v", got, want)
+	}
+	if _, ok := f.mappings[0]; ok {
+		t.Errorf("first chunk is still mapped")
+	}
+	if _, ok := f.mappings[chunkSize]; !ok {
+		t.Errorf("second chunk is not mapped")
+	}
+
+	// The reclaimed chunk can be mapped again.
+	if _, err := f.MapInternal(platform.FileRange{0, chunkSize}, fd, false /* write */); err != nil {
+		t.Fatalf("MapInternal after reclaim failed: %v", err)
+	}
+}
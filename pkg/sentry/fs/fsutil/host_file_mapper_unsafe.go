@@ -15,9 +15,13 @@
 package fsutil
 
 import (
+	"syscall"
 	"unsafe"
 
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/safemem"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
 )
 
 func (*HostFileMapper) unsafeBlockFromChunkMapping(addr uintptr) safemem.Block {
@@ -25,3 +29,44 @@ func (*HostFileMapper) unsafeBlockFromChunkMapping(addr uintptr) safemem.Block {
 	// raise SIGBUS. Thus accesses to it must use safecopy.
 	return safemem.BlockFromUnsafePointer((unsafe.Pointer)(addr), chunkSize)
 }
+
+// hostFileResidency sets dst[i] to 1 if the page at offset fr.Start +
+// i*usermem.PageSize in the host file represented by fd is resident in the
+// host page cache, and 0 otherwise.
+//
+// Preconditions: fr must be page-aligned and non-empty. len(dst) must be at
+// least fr.Length() / usermem.PageSize.
+func hostFileResidency(fd int, fr platform.FileRange, dst []byte) error {
+	// mincore(2) reports page cache residency for shared file mappings
+	// regardless of the mapping's protection, so a temporary inaccessible
+	// mapping suffices.
+	addr, _, errno := syscall.Syscall6(
+		syscall.SYS_MMAP,
+		0,
+		uintptr(fr.Length()),
+		syscall.PROT_NONE,
+		syscall.MAP_SHARED,
+		uintptr(fd),
+		uintptr(fr.Start))
+	if errno != 0 {
+		return errno
+	}
+	defer func() {
+		if _, _, errno := syscall.Syscall(syscall.SYS_MUNMAP, addr, uintptr(fr.Length()), 0); errno != 0 {
+			log.Warningf("Failed to unmap temporary mapping %#x of host file: %v", addr, errno)
+		}
+	}()
+	dst = dst[:fr.Length()/usermem.PageSize]
+	if _, _, errno := syscall.Syscall(
+		syscall.SYS_MINCORE,
+		addr,
+		uintptr(fr.Length()),
+		uintptr(unsafe.Pointer(&dst[0]))); errno != 0 {
+		return errno
+	}
+	// Bits other than the least significant are reserved by mincore(2).
+	for i := range dst {
+		dst[i] &= 1
+	}
+	return nil
+}
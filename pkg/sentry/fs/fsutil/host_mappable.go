@@ -53,10 +53,12 @@ type HostMappable struct {
 
 // NewHostMappable creates a new mappable that maps directly to host FD.
 func NewHostMappable(backingFile CachedFileObject) *HostMappable {
-	return &HostMappable{
+	h := &HostMappable{
 		hostFileMapper: NewHostFileMapper(),
 		backingFile:    backingFile,
 	}
+	h.hostFileMapper.invalidator = h
+	return h
 }
 
 // AddMapping implements memmap.Mappable.AddMapping.
@@ -107,6 +109,19 @@ func (h *HostMappable) InvalidateUnsavable(ctx context.Context) error {
 	return nil
 }
 
+// invalidateInternalMappings implements
+// internalMappingsInvalidator.invalidateInternalMappings.
+func (h *HostMappable) invalidateInternalMappings(mr memmap.MappableRange) {
+	h.mu.Lock()
+	h.mappings.Invalidate(mr, memmap.InvalidateOpts{})
+	h.mu.Unlock()
+}
+
+// Residency implements memmap.ResidencyMappable.Residency.
+func (h *HostMappable) Residency(ctx context.Context, mr memmap.MappableRange, dst []byte) error {
+	return hostFileResidency(h.backingFile.FD(), platform.FileRange{mr.Start, mr.End}, dst)
+}
+
 // MapInternal implements platform.File.MapInternal.
 func (h *HostMappable) MapInternal(fr platform.FileRange, at usermem.AccessType) (safemem.BlockSeq, error) {
 	return h.hostFileMapper.MapInternal(fr, h.backingFile.FD(), at.Write)
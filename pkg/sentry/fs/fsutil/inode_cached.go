@@ -34,10 +34,11 @@ import (
 
 // Lock order (compare the lock order model in mm/mm.go):
 //
-// CachingInodeOperations.attrMu ("fs locks")
-//   CachingInodeOperations.mapsMu ("memmap.Mappable locks not taken by Translate")
-//     CachingInodeOperations.dataMu ("memmap.Mappable locks taken by Translate")
-//       CachedFileObject locks
+// CachingInodeOperations.rangeMu ("fs locks")
+//   CachingInodeOperations.attrMu ("fs locks")
+//     CachingInodeOperations.mapsMu ("memmap.Mappable locks not taken by Translate")
+//       CachingInodeOperations.dataMu ("memmap.Mappable locks taken by Translate")
+//         CachedFileObject locks
 
 // CachingInodeOperations caches the metadata and content of a CachedFileObject.
 // It implements a subset of InodeOperations. As a utility it can be used to
@@ -71,6 +72,11 @@ type CachingInodeOperations struct {
 	// modified after inode creation.
 	forcePageCache bool
 
+	// rangeMu serializes writes to overlapping ranges of the file, and
+	// excludes writes during changes to the file's size. Writes to disjoint
+	// ranges may proceed concurrently.
+	rangeMu rangeLock `state:"nosave"`
+
 	attrMu sync.Mutex `state:"nosave"`
 
 	// attr is unstable cached metadata.
@@ -160,13 +166,35 @@ func NewCachingInodeOperations(ctx context.Context, backingFile CachedFileObject
 	if mfp == nil {
 		panic(fmt.Sprintf("context.Context %T lacks non-nil value for key %T", ctx, pgalloc.CtxMemoryFileProvider))
 	}
-	return &CachingInodeOperations{
+	c := &CachingInodeOperations{
 		backingFile:    backingFile,
 		mfp:            mfp,
 		forcePageCache: forcePageCache,
 		attr:           uattr,
 		hostFileMapper: NewHostFileMapper(),
 	}
+	c.hostFileMapper.invalidator = c
+	return c
+}
+
+// readBackingAt reads from the backing file, and accounts the bytes read to
+// ctx.
+func (c *CachingInodeOperations) readBackingAt(ctx context.Context, dsts safemem.BlockSeq, offset uint64) (uint64, error) {
+	n, err := c.backingFile.ReadToBlocksAt(ctx, dsts, offset)
+	if io := usage.IOFromContext(ctx); io != nil {
+		io.AccountReadIO(int64(n))
+	}
+	return n, err
+}
+
+// writeBackingAt writes to the backing file, and accounts the bytes written to
+// ctx.
+func (c *CachingInodeOperations) writeBackingAt(ctx context.Context, srcs safemem.BlockSeq, offset uint64) (uint64, error) {
+	n, err := c.backingFile.WriteFromBlocksAt(ctx, srcs, offset)
+	if io := usage.IOFromContext(ctx); io != nil {
+		io.AccountWriteIO(int64(n))
+	}
+	return n, err
 }
 
 // Release implements fs.InodeOperations.Release.
@@ -270,6 +298,9 @@ func (c *CachingInodeOperations) SetTimestamps(ctx context.Context, inode *fs.In
 
 // Truncate implements fs.InodeOperations.Truncate.
 func (c *CachingInodeOperations) Truncate(ctx context.Context, inode *fs.Inode, size int64) error {
+	// Exclude in-progress writes, which may grow the file.
+	c.rangeMu.Lock(wholeFile)
+	defer c.rangeMu.Unlock(wholeFile)
 	c.attrMu.Lock()
 	defer c.attrMu.Unlock()
 
@@ -290,7 +321,7 @@ func (c *CachingInodeOperations) Truncate(ctx context.Context, inode *fs.Inode,
 	// mappings below. This allows concurrent calls to Read/Translate/etc.
 	// These functions synchronize with an in-progress Truncate by refusing to
 	// use cache contents beyond the new c.attr.Size. (We are still holding
-	// c.attrMu, so we can't race with Truncate/Write.)
+	// c.rangeMu and c.attrMu, so we can't race with Truncate/Write.)
 	c.dataMu.Unlock()
 
 	// Nothing left to do unless shrinking the file.
@@ -320,7 +351,15 @@ func (c *CachingInodeOperations) Truncate(ctx context.Context, inode *fs.Inode,
 	c.dataMu.Lock()
 	defer c.dataMu.Unlock()
 	c.cache.Truncate(uint64(size), c.mfp.MemoryFile())
-	c.dirty.KeepClean(memmap.MappableRange{uint64(size), oldpgend})
+	truncated := memmap.MappableRange{uint64(size), oldpgend}
+	if io := usage.IOFromContext(ctx); io != nil {
+		var cancelled uint64
+		for seg := c.dirty.LowerBoundSegment(truncated.Start); seg.Ok() && seg.Start() < truncated.End; seg = seg.NextSegment() {
+			cancelled += seg.Range().Intersect(truncated).Length()
+		}
+		io.AccountCancelledWriteIO(int64(cancelled))
+	}
+	c.dirty.KeepClean(truncated)
 
 	return nil
 }
@@ -331,7 +370,7 @@ func (c *CachingInodeOperations) WriteOut(ctx context.Context, inode *fs.Inode)
 
 	// Write dirty pages back.
 	c.dataMu.Lock()
-	err := SyncDirtyAll(ctx, &c.cache, &c.dirty, uint64(c.attr.Size), c.mfp.MemoryFile(), c.backingFile.WriteFromBlocksAt)
+	err := SyncDirtyAll(ctx, &c.cache, &c.dirty, uint64(c.attr.Size), c.mfp.MemoryFile(), c.writeBackingAt)
 	c.dataMu.Unlock()
 	if err != nil {
 		c.attrMu.Unlock()
@@ -355,6 +394,24 @@ func (c *CachingInodeOperations) WriteOut(ctx context.Context, inode *fs.Inode)
 	return c.backingFile.Sync(ctx)
 }
 
+// WriteDirty writes cached pages in mr that have been dirtied, including
+// through shared mappings, back to the backing file. Unlike WriteOut, it
+// does not write back cached attributes or sync the backing file.
+func (c *CachingInodeOperations) WriteDirty(ctx context.Context, mr memmap.MappableRange) error {
+	// SyncDirty requires a page-aligned range.
+	mr.Start = uint64(usermem.Addr(mr.Start).RoundDown())
+	if end, ok := usermem.Addr(mr.End).RoundUp(); ok {
+		mr.End = uint64(end)
+	} else {
+		mr.End = uint64(usermem.Addr(mr.End).RoundDown())
+	}
+
+	c.dataMu.Lock()
+	err := SyncDirty(ctx, mr, &c.cache, &c.dirty, uint64(c.attr.Size), c.mfp.MemoryFile(), c.writeBackingAt)
+	c.dataMu.Unlock()
+	return err
+}
+
 // IncLinks increases the link count and updates cached access time.
 func (c *CachingInodeOperations) IncLinks(ctx context.Context) {
 	c.attrMu.Lock()
@@ -505,11 +562,14 @@ func (c *CachingInodeOperations) Write(ctx context.Context, src usermem.IOSequen
 		return 0, nil
 	}
 
+	mr := memmap.MappableRange{uint64(offset), uint64(fs.WriteEndOffset(offset, src.NumBytes()))}
+	c.rangeMu.Lock(mr)
 	c.attrMu.Lock()
 	// Compare Linux's mm/filemap.c:__generic_file_write_iter() => file_update_time().
 	c.touchModificationTimeLocked(ktime.NowFromContext(ctx))
-	n, err := src.CopyInTo(ctx, &inodeReadWriter{ctx, c, offset})
 	c.attrMu.Unlock()
+	n, err := src.CopyInTo(ctx, &inodeReadWriter{ctx, c, offset})
+	c.rangeMu.Unlock(mr)
 	return n, err
 }
 
@@ -566,7 +626,7 @@ func (rw *inodeReadWriter) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error) {
 			// Read directly from the backing file.
 			gapmr := gap.Range().Intersect(mr)
 			dst := dsts.TakeFirst64(gapmr.Length())
-			n, err := rw.c.backingFile.ReadToBlocksAt(rw.ctx, dst, gapmr.Start)
+			n, err := rw.c.readBackingAt(rw.ctx, dst, gapmr.Start)
 			done += n
 			rw.offset += int64(n)
 			dsts = dsts.DropFirst64(n)
@@ -590,8 +650,10 @@ func (rw *inodeReadWriter) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error) {
 // maybeGrowFile grows the file's size if data has been written past the old
 // size.
 //
-// Preconditions: rw.c.attrMu and rw.c.dataMu bust be locked.
+// Preconditions: rw.c.attrMu and rw.c.dataMu must not be locked.
 func (rw *inodeReadWriter) maybeGrowFile() {
+	rw.c.attrMu.Lock()
+	rw.c.dataMu.Lock()
 	// If the write ends beyond the file's previous size, it causes the
 	// file to grow.
 	if rw.offset > rw.c.attr.Size {
@@ -605,77 +667,84 @@ func (rw *inodeReadWriter) maybeGrowFile() {
 		rw.c.attr.Usage = rw.offset
 		rw.c.dirtyAttr.Usage = true
 	}
+	rw.c.dataMu.Unlock()
+	rw.c.attrMu.Unlock()
 }
 
 // WriteFromBlocks implements safemem.Writer.WriteFromBlocks.
 //
-// Preconditions: rw.c.attrMu must be locked.
+// Writes to the backing file are performed with rw.c.dataMu read-locked
+// rather than write-locked, so that writes to disjoint ranges of the file may
+// proceed concurrently. This still excludes concurrent cache fills, which
+// would otherwise be able to observe the backing file before the write.
+//
+// Preconditions: rw.c.rangeMu must be locked for the range being written.
+// rw.c.attrMu and rw.c.dataMu must not be locked.
 func (rw *inodeReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64, error) {
 	// Hot path. Avoid defers.
-	rw.c.dataMu.Lock()
 
 	// Compute the range to write.
 	end := fs.WriteEndOffset(rw.offset, int64(srcs.NumBytes()))
 	if end == rw.offset { // srcs.NumBytes() == 0?
-		rw.c.dataMu.Unlock()
 		return 0, nil
 	}
 
 	mf := rw.c.mfp.MemoryFile()
 	var done uint64
-	seg, gap := rw.c.cache.Find(uint64(rw.offset))
 	for rw.offset < end {
 		mr := memmap.MappableRange{uint64(rw.offset), uint64(end)}
-		switch {
-		case seg.Ok() && seg.Start() < mr.End:
-			// Get internal mappings from the cache.
-			segMR := seg.Range().Intersect(mr)
-			ims, err := mf.MapInternal(seg.FileRangeOf(segMR), usermem.Write)
-			if err != nil {
-				rw.maybeGrowFile()
-				rw.c.dataMu.Unlock()
-				return done, err
-			}
-
-			// Copy to internal mappings.
-			n, err := safemem.CopySeq(ims, srcs)
-			done += n
-			rw.offset += int64(n)
-			srcs = srcs.DropFirst64(n)
-			rw.c.dirty.MarkDirty(segMR)
-			if err != nil {
-				rw.maybeGrowFile()
-				rw.c.dataMu.Unlock()
-				return done, err
-			}
-
-			// Continue.
-			seg, gap = seg.NextNonEmpty()
-
-		case gap.Ok() && gap.Start() < mr.End:
+		rw.c.dataMu.RLock()
+		seg, gap := rw.c.cache.Find(uint64(rw.offset))
+		if gap.Ok() {
 			// Write directly to the backing file.
 			gapmr := gap.Range().Intersect(mr)
 			src := srcs.TakeFirst64(gapmr.Length())
-			n, err := rw.c.backingFile.WriteFromBlocksAt(rw.ctx, src, gapmr.Start)
+			n, err := rw.c.writeBackingAt(rw.ctx, src, gapmr.Start)
+			rw.c.dataMu.RUnlock()
 			done += n
 			rw.offset += int64(n)
 			srcs = srcs.DropFirst64(n)
 			// Partial writes are fine. But we must stop writing.
 			if n != src.NumBytes() || err != nil {
 				rw.maybeGrowFile()
-				rw.c.dataMu.Unlock()
 				return done, err
 			}
+			continue
+		}
+		rw.c.dataMu.RUnlock()
 
-			// Continue.
-			seg, gap = gap.NextSegment(), FileRangeGapIterator{}
+		// Marking cached data dirty requires locking rw.c.dataMu for
+		// writing. Since rw.c.dataMu was unlocked, the cache may have
+		// changed; look up the segment again.
+		rw.c.dataMu.Lock()
+		seg, _ = rw.c.cache.Find(uint64(rw.offset))
+		if !seg.Ok() {
+			rw.c.dataMu.Unlock()
+			continue
+		}
 
-		default:
-			break
+		// Get internal mappings from the cache.
+		segMR := seg.Range().Intersect(mr)
+		ims, err := mf.MapInternal(seg.FileRangeOf(segMR), usermem.Write)
+		if err != nil {
+			rw.c.dataMu.Unlock()
+			rw.maybeGrowFile()
+			return done, err
+		}
+
+		// Copy to internal mappings.
+		n, err := safemem.CopySeq(ims, srcs)
+		done += n
+		rw.offset += int64(n)
+		srcs = srcs.DropFirst64(n)
+		rw.c.dirty.MarkDirty(segMR)
+		rw.c.dataMu.Unlock()
+		if err != nil {
+			rw.maybeGrowFile()
+			return done, err
 		}
 	}
 	rw.maybeGrowFile()
-	rw.c.dataMu.Unlock()
 	return done, nil
 }
 
@@ -722,7 +791,7 @@ func (c *CachingInodeOperations) RemoveMapping(ctx context.Context, ms memmap.Ma
 	mf := c.mfp.MemoryFile()
 	c.dataMu.Lock()
 	for _, r := range unmapped {
-		if err := SyncDirty(ctx, r, &c.cache, &c.dirty, uint64(c.attr.Size), mf, c.backingFile.WriteFromBlocksAt); err != nil {
+		if err := SyncDirty(ctx, r, &c.cache, &c.dirty, uint64(c.attr.Size), mf, c.writeBackingAt); err != nil {
 			log.Warningf("Failed to writeback cached data %v: %v", r, err)
 		}
 		c.cache.Drop(r, mf)
@@ -732,6 +801,13 @@ func (c *CachingInodeOperations) RemoveMapping(ctx context.Context, ms memmap.Ma
 	c.mapsMu.Unlock()
 }
 
+// IsMapped returns true if any part of the file is currently mapped.
+func (c *CachingInodeOperations) IsMapped() bool {
+	c.mapsMu.Lock()
+	defer c.mapsMu.Unlock()
+	return !c.mappings.IsEmpty()
+}
+
 // CopyMapping implements memmap.Mappable.CopyMapping.
 func (c *CachingInodeOperations) CopyMapping(ctx context.Context, ms memmap.MappingSpace, srcAR, dstAR usermem.AddrRange, offset uint64, writable bool) error {
 	return c.AddMapping(ctx, ms, dstAR, offset, writable)
@@ -770,7 +846,7 @@ func (c *CachingInodeOperations) Translate(ctx context.Context, required, option
 	}
 
 	mf := c.mfp.MemoryFile()
-	cerr := c.cache.Fill(ctx, required, maxFillRange(required, optional), mf, usage.PageCache, c.backingFile.ReadToBlocksAt)
+	cerr := c.cache.Fill(ctx, required, maxFillRange(required, optional), mf, usage.PageCache, c.readBackingAt)
 
 	var ts []memmap.Translation
 	var translatedEnd uint64
@@ -810,6 +886,17 @@ func (c *CachingInodeOperations) Translate(ctx context.Context, required, option
 	return ts, nil
 }
 
+// Residency implements memmap.ResidencyMappable.Residency.
+func (c *CachingInodeOperations) Residency(ctx context.Context, mr memmap.MappableRange, dst []byte) error {
+	if !c.forcePageCache && c.backingFile.FD() >= 0 {
+		return hostFileResidency(c.backingFile.FD(), platform.FileRange{mr.Start, mr.End}, dst)
+	}
+
+	c.dataMu.RLock()
+	defer c.dataMu.RUnlock()
+	return c.cache.Residency(mr, c.mfp.MemoryFile(), dst)
+}
+
 func maxFillRange(required, optional memmap.MappableRange) memmap.MappableRange {
 	const maxReadahead = 64 << 10 // 64 KB, chosen arbitrarily
 	if required.Length() >= maxReadahead {
@@ -840,7 +927,7 @@ func (c *CachingInodeOperations) InvalidateUnsavable(ctx context.Context) error
 	mf := c.mfp.MemoryFile()
 	c.dataMu.Lock()
 	defer c.dataMu.Unlock()
-	if err := SyncDirtyAll(ctx, &c.cache, &c.dirty, uint64(c.attr.Size), mf, c.backingFile.WriteFromBlocksAt); err != nil {
+	if err := SyncDirtyAll(ctx, &c.cache, &c.dirty, uint64(c.attr.Size), mf, c.writeBackingAt); err != nil {
 		return err
 	}
 
@@ -905,6 +992,14 @@ func (c *CachingInodeOperations) DecRef(fr platform.FileRange) {
 
 }
 
+// invalidateInternalMappings implements
+// internalMappingsInvalidator.invalidateInternalMappings.
+func (c *CachingInodeOperations) invalidateInternalMappings(mr memmap.MappableRange) {
+	c.mapsMu.Lock()
+	c.mappings.Invalidate(mr, memmap.InvalidateOpts{})
+	c.mapsMu.Unlock()
+}
+
 // MapInternal implements platform.File.MapInternal. This is used when we
 // directly map an underlying host fd and CachingInodeOperations is used as the
 // platform.File during translation.
@@ -243,6 +243,10 @@ type noopMappingSpace struct{}
 func (noopMappingSpace) Invalidate(ar usermem.AddrRange, opts memmap.InvalidateOpts) {
 }
 
+// InvalidateRanges implements memmap.MappingSpace.InvalidateRanges.
+func (noopMappingSpace) InvalidateRanges(ars []usermem.AddrRange, opts memmap.InvalidateOpts) {
+}
+
 func anonInode(ctx context.Context) *fs.Inode {
 	return fs.NewInode(&SimpleFileInode{
 		InodeSimpleAttributes: NewInodeSimpleAttributes(ctx, fs.FileOwnerFromContext(ctx), fs.FilePermissions{
@@ -0,0 +1,81 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsutil
+
+import (
+	"math"
+	"sync"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/memmap"
+)
+
+// rangeLock provides mutual exclusion between holders of overlapping ranges
+// of a file. Holders of disjoint ranges do not block each other.
+//
+// The zero value of rangeLock is an unlocked rangeLock.
+type rangeLock struct {
+	mu sync.Mutex
+
+	// cond is signaled when a range is unlocked. cond is lazily initialized
+	// and protected by mu.
+	cond *sync.Cond
+
+	// held contains all currently locked ranges. held is protected by mu.
+	held []memmap.MappableRange
+}
+
+// wholeFile is the range of offsets covering an entire file.
+var wholeFile = memmap.MappableRange{0, math.MaxUint64}
+
+// Lock blocks until no locked range overlaps mr, then locks mr.
+func (l *rangeLock) Lock(mr memmap.MappableRange) {
+	l.mu.Lock()
+	for l.overlapsLocked(mr) {
+		if l.cond == nil {
+			l.cond = sync.NewCond(&l.mu)
+		}
+		l.cond.Wait()
+	}
+	l.held = append(l.held, mr)
+	l.mu.Unlock()
+}
+
+// Unlock unlocks mr, which must have been previously passed to Lock.
+func (l *rangeLock) Unlock(mr memmap.MappableRange) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, h := range l.held {
+		if h == mr {
+			last := len(l.held) - 1
+			l.held[i] = l.held[last]
+			l.held = l.held[:last]
+			if l.cond != nil {
+				l.cond.Broadcast()
+			}
+			return
+		}
+	}
+	panic("unlock of unlocked range")
+}
+
+// Preconditions: l.mu must be locked.
+func (l *rangeLock) overlapsLocked(mr memmap.MappableRange) bool {
+	for _, h := range l.held {
+		if h.Overlaps(mr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsutil
+
+import (
+	"testing"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/memmap"
+)
+
+func TestRangeLockDisjoint(t *testing.T) {
+	var l rangeLock
+	a := memmap.MappableRange{0, 0x1000}
+	b := memmap.MappableRange{0x1000, 0x2000}
+	l.Lock(a)
+	// This would deadlock if disjoint ranges excluded each other.
+	l.Lock(b)
+	l.Unlock(a)
+	l.Unlock(b)
+}
+
+func TestRangeLockOverlapping(t *testing.T) {
+	var l rangeLock
+	a := memmap.MappableRange{0, 0x2000}
+	l.Lock(a)
+
+	locked := make(chan struct{})
+	go func() {
+		l.Lock(wholeFile)
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		t.Fatalf("Lock of overlapping range succeeded while %v was held", a)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	l.Unlock(a)
+	<-locked
+	l.Unlock(wholeFile)
+}
@@ -100,6 +100,13 @@ func (c *contextFile) fsync(ctx context.Context) error {
 	return c.file.FSync()
 }
 
+func (c *contextFile) fdatasync(ctx context.Context) error {
+	ctx.UninterruptibleSleepStart(false)
+	defer ctx.UninterruptibleSleepFinish(false)
+
+	return c.file.FDataSync()
+}
+
 func (c *contextFile) create(ctx context.Context, name string, flags p9.OpenFlags, permissions p9.FileMode, uid p9.UID, gid p9.GID) (*fd.FD, error) {
 	ctx.UninterruptibleSleepStart(false)
 	defer ctx.UninterruptibleSleepFinish(false)
@@ -117,6 +117,14 @@ func (f *fileOperations) Release() {
 	f.handles.DecRef()
 }
 
+// HostFD implements host.HostFileDescriptor.HostFD.
+func (f *fileOperations) HostFD() int {
+	if f.handles.Host == nil {
+		return -1
+	}
+	return f.handles.Host.FD()
+}
+
 // Readdir implements fs.FileOperations.Readdir.
 func (f *fileOperations) Readdir(ctx context.Context, file *fs.File, serializer fs.DentrySerializer) (int64, error) {
 	root := fs.RootFromContext(ctx)
@@ -229,6 +237,17 @@ func (f *fileOperations) Write(ctx context.Context, file *fs.File, src usermem.I
 		}
 		return n, err
 	}
+	if f.inodeOperations.isMMapCached() {
+		// Write back the written range, so that the remote file remains up
+		// to date for uncached accesses. Parts of the range that aren't
+		// cached were already written directly to the remote file.
+		f.inodeOperations.fileState.shareHandles(file.Flags(), f.handles)
+		n, err := f.inodeOperations.cachingInodeOps.Write(ctx, src, offset)
+		if err != nil {
+			return n, err
+		}
+		return n, f.inodeOperations.cachingInodeOps.WriteDirty(ctx, memmap.MappableRange{uint64(offset), uint64(offset + n)})
+	}
 	if f.inodeOperations.fileState.hostMappable != nil {
 		return f.inodeOperations.fileState.hostMappable.Write(ctx, src, offset)
 	}
@@ -264,6 +283,18 @@ func (f *fileOperations) Read(ctx context.Context, file *fs.File, dst usermem.IO
 		f.incrementReadCounters(start)
 		return n, err
 	}
+	if f.inodeOperations.isMMapCached() {
+		// The file may have been changed remotely, so refresh its size
+		// before reading through the cache.
+		f.inodeOperations.fileState.shareHandles(file.Flags(), f.handles)
+		if err := f.inodeOperations.refreshMMapCache(ctx); err != nil {
+			f.incrementReadCounters(start)
+			return 0, err
+		}
+		n, err := f.inodeOperations.cachingInodeOps.Read(ctx, file, dst, offset)
+		f.incrementReadCounters(start)
+		return n, err
+	}
 	n, err := dst.CopyOutFrom(ctx, f.handles.readWriterAt(ctx, offset))
 	f.incrementReadCounters(start)
 	return n, err
@@ -272,21 +303,47 @@ func (f *fileOperations) Read(ctx context.Context, file *fs.File, dst usermem.IO
 // Fsync implements fs.FileOperations.Fsync.
 func (f *fileOperations) Fsync(ctx context.Context, file *fs.File, start int64, end int64, syncType fs.SyncType) error {
 	switch syncType {
-	case fs.SyncAll, fs.SyncData:
+	case fs.SyncAll:
 		if err := file.Dirent.Inode.WriteOut(ctx); err != nil {
 			return err
 		}
-		fallthrough
+	case fs.SyncData:
+		// Only write back data in the requested range; this is the common
+		// case for msync(MS_SYNC) of part of a large shared mapping.
+		if err := f.inodeOperations.writeDirty(ctx, file.Dirent.Inode, start, end); err != nil {
+			return err
+		}
 	case fs.SyncBackingStorage:
-		// Sync remote caches.
+	default:
+		panic("invalid sync type")
+	}
+
+	// Sync remote caches. Cached data and metadata written back above are
+	// only durable once this completes.
+	return f.syncRemote(ctx, syncType == fs.SyncData)
+}
+
+// syncRemote syncs the remote file, as for fsync(2), or fdatasync(2) if
+// datasync is true.
+func (f *fileOperations) syncRemote(ctx context.Context, datasync bool) error {
+	sync := func(datasync bool) error {
 		if f.handles.Host != nil {
 			// Sync the host fd directly.
+			if datasync {
+				return syscall.Fdatasync(f.handles.Host.FD())
+			}
 			return syscall.Fsync(f.handles.Host.FD())
 		}
 		// Otherwise sync on the p9.File handle.
+		if datasync {
+			return f.handles.File.fdatasync(ctx)
+		}
 		return f.handles.File.fsync(ctx)
 	}
-	panic("invalid sync type")
+	if !f.inodeOperations.session().coalesceSyncs {
+		return sync(datasync)
+	}
+	return f.inodeOperations.fileState.syncs.sync(ctx, datasync, sync)
 }
 
 // Flush implements fs.FileOperations.Flush.
@@ -305,7 +362,7 @@ func (f *fileOperations) Flush(ctx context.Context, file *fs.File) error {
 
 // ConfigureMMap implements fs.FileOperations.ConfigureMMap.
 func (f *fileOperations) ConfigureMMap(ctx context.Context, file *fs.File, opts *memmap.MMapOpts) error {
-	return f.inodeOperations.configureMMap(file, opts)
+	return f.inodeOperations.configureMMap(ctx, file, f.handles, opts)
 }
 
 // Seek implements fs.FileOperations.Seek.
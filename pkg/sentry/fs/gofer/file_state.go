@@ -33,6 +33,11 @@ func (f *fileOperations) afterLoad() {
 		if err != nil {
 			return fmt.Errorf("failed to re-open handle: %v", err)
 		}
+		if f.inodeOperations.isMMapCached() {
+			// Make the new handles available to the page cache; see
+			// inodeOperations.mmapCached.
+			f.inodeOperations.fileState.shareHandles(f.flags, f.handles)
+		}
 		return nil
 	}
 	fs.Async(fs.CatchError(load))
@@ -54,6 +54,21 @@ const (
 	// sandbox using files backed by the gofer. If set to false, unix sockets
 	// cannot be bound to gofer files without an overlay on top.
 	privateUnixSocketKey = "privateunixsocket"
+
+	// If set to true allows receiving file descriptors over host unix domain
+	// sockets connected through the gofer. If set to false, they are closed
+	// upon receipt.
+	hostUnixSocketFDsKey = "hostunixsocketfds"
+
+	// If set to true allows sending regular files backed by host file
+	// descriptors and sealed memfds over host unix domain sockets connected
+	// through the gofer. If set to false, sending file descriptors fails.
+	hostUnixSocketSendFDsKey = "hostunixsocketsendfds"
+
+	// If set to true, concurrent syncs of the same file are coalesced into
+	// a single sync of the remote file, trading sync latency for
+	// throughput.
+	coalesceSyncKey = "coalescesync"
 )
 
 // defaultAname is the default attach name.
@@ -119,6 +134,12 @@ func (*filesystem) Flags() fs.FilesystemFlags {
 	return 0
 }
 
+// Exportable implements fs.ExportableFilesystem.Exportable.
+//
+// Inode IDs are derived from the host's device and inode numbers, so are
+// stable for as long as the host file exists.
+func (*filesystem) Exportable() {}
+
 // Mount returns an attached 9p client that can be positioned in the vfs.
 func (f *filesystem) Mount(ctx context.Context, device string, flags fs.MountSourceFlags, data string, _ interface{}) (*fs.Inode, error) {
 	// Parse and validate the mount options.
@@ -134,12 +155,15 @@ func (f *filesystem) Mount(ctx context.Context, device string, flags fs.MountSou
 
 // opts are parsed 9p mount options.
 type opts struct {
-	fd                int
-	aname             string
-	policy            cachePolicy
-	msize             uint32
-	version           string
-	privateunixsocket bool
+	fd                    int
+	aname                 string
+	policy                cachePolicy
+	msize                 uint32
+	version               string
+	privateunixsocket     bool
+	hostunixsocketfds     bool
+	hostunixsocketsendfds bool
+	coalescesync          bool
 }
 
 // options parses mount(2) data into structured options.
@@ -237,6 +261,34 @@ func options(data string) (opts, error) {
 		delete(options, privateUnixSocketKey)
 	}
 
+	// Parse the host unix socket FD policy. Reject non-booleans.
+	if v, ok := options[hostUnixSocketFDsKey]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return o, fmt.Errorf("invalid boolean value for '%s=%s': %v", hostUnixSocketFDsKey, v, err)
+		}
+		o.hostunixsocketfds = b
+		delete(options, hostUnixSocketFDsKey)
+	}
+	if v, ok := options[hostUnixSocketSendFDsKey]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return o, fmt.Errorf("invalid boolean value for '%s=%s': %v", hostUnixSocketSendFDsKey, v, err)
+		}
+		o.hostunixsocketsendfds = b
+		delete(options, hostUnixSocketSendFDsKey)
+	}
+
+	// Parse the sync coalescing policy. Reject non-booleans.
+	if v, ok := options[coalesceSyncKey]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return o, fmt.Errorf("invalid boolean value for '%s=%s': %v", coalesceSyncKey, v, err)
+		}
+		o.coalescesync = b
+		delete(options, coalesceSyncKey)
+	}
+
 	// Fail to attach if the caller wanted us to do something that we
 	// don't support.
 	if len(options) > 0 {
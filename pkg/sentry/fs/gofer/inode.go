@@ -17,6 +17,7 @@ package gofer
 import (
 	"errors"
 	"sync"
+	"sync/atomic"
 	"syscall"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
@@ -31,6 +32,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/host"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/memmap"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/safemem"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
 )
 
@@ -49,6 +51,19 @@ type inodeOperations struct {
 	// cachingInodeOps implement memmap.Mappable for inodeOperations.
 	cachingInodeOps *fsutil.CachingInodeOperations
 
+	// mmapCached is set to 1 when the file is mapped while its cache policy
+	// does not cache file contents and no host FD is available to map it
+	// directly. While it is set, cachingInodeOps serves as a write-back page
+	// cache for mapped pages, and reads, writes and truncations go through it
+	// to stay coherent with mappings. It is cleared once the last such
+	// mapping is removed; see mmapCacheMappable. mmapCached is accessed using
+	// atomic memory operations.
+	mmapCached uint32
+
+	// mmapMu serializes changes to mmapCached with changes to the mappings
+	// of cachingInodeOps.
+	mmapMu sync.Mutex `state:"nosave"`
+
 	// readdirMu protects readdirCache and concurrent Readdirs.
 	readdirMu sync.Mutex `state:"nosave"`
 
@@ -131,6 +146,10 @@ type inodeFileState struct {
 	// hostMappable is created when using 'cacheRemoteRevalidating' to map pages
 	// directly from host.
 	hostMappable *fsutil.HostMappable
+
+	// syncs coalesces concurrent syncs of the remote file if the session
+	// has coalesceSyncs set.
+	syncs syncBatcher `state:"nosave"`
 }
 
 // Release releases file handles.
@@ -173,6 +192,16 @@ func (i *inodeFileState) setSharedHandlesLocked(flags fs.FileFlags, h *handles)
 	}
 }
 
+// shareHandles makes h available to cachingInodeOps, if no suitable handles
+// are already shared. This is used when cachingInodeOps caches mapped pages
+// of files whose handles aren't otherwise shared; see
+// inodeOperations.mmapCached.
+func (i *inodeFileState) shareHandles(flags fs.FileFlags, h *handles) {
+	i.handlesMu.Lock()
+	i.setSharedHandlesLocked(flags, h)
+	i.handlesMu.Unlock()
+}
+
 // getHandles returns a set of handles for a new file using i opened with the
 // given flags.
 func (i *inodeFileState) getHandles(ctx context.Context, flags fs.FileFlags) (*handles, error) {
@@ -340,11 +369,86 @@ func (i *inodeOperations) Release(ctx context.Context) {
 	fs.AsyncWithContext(ctx, i.fileState.Release)
 }
 
+// isMMapCached returns true if cachingInodeOps caches mapped pages of a file
+// whose cache policy does not otherwise cache file contents. See
+// inodeOperations.mmapCached.
+func (i *inodeOperations) isMMapCached() bool {
+	return atomic.LoadUint32(&i.mmapCached) != 0
+}
+
+// refreshMMapCache updates the attributes cached by cachingInodeOps from the
+// remote file, for use when isMMapCached is true. Since cached file
+// attributes are otherwise not used, they may be stale, and the file size
+// determines what cachingInodeOps considers EOF.
+func (i *inodeOperations) refreshMMapCache(ctx context.Context) error {
+	uattr, err := i.fileState.unstableAttr(ctx)
+	if err != nil {
+		return err
+	}
+	i.cachingInodeOps.UpdateUnstable(uattr)
+	return nil
+}
+
+// mmapCacheMappable implements memmap.Mappable for files whose mapped pages
+// are cached by inodeOperations.cachingInodeOps only while they are mapped.
+// It tracks when inodeOperations.mmapCached needs to be set or cleared.
+//
+// +stateify savable
+type mmapCacheMappable struct {
+	i *inodeOperations
+}
+
+// AddMapping implements memmap.Mappable.AddMapping.
+func (m mmapCacheMappable) AddMapping(ctx context.Context, ms memmap.MappingSpace, ar usermem.AddrRange, offset uint64, writable bool) error {
+	m.i.mmapMu.Lock()
+	defer m.i.mmapMu.Unlock()
+	if !m.i.isMMapCached() {
+		// The last mapping was removed between configureMMap and now, so
+		// the cached attributes may be stale again.
+		if err := m.i.refreshMMapCache(ctx); err != nil {
+			return err
+		}
+		atomic.StoreUint32(&m.i.mmapCached, 1)
+	}
+	return m.i.cachingInodeOps.AddMapping(ctx, ms, ar, offset, writable)
+}
+
+// RemoveMapping implements memmap.Mappable.RemoveMapping.
+func (m mmapCacheMappable) RemoveMapping(ctx context.Context, ms memmap.MappingSpace, ar usermem.AddrRange, offset uint64, writable bool) {
+	m.i.mmapMu.Lock()
+	defer m.i.mmapMu.Unlock()
+	// cachingInodeOps writes back and drops cached pages as they are
+	// unmapped, so once nothing is mapped there is nothing left to keep
+	// coherent and reads and writes can go directly to the remote file.
+	m.i.cachingInodeOps.RemoveMapping(ctx, ms, ar, offset, writable)
+	if !m.i.cachingInodeOps.IsMapped() {
+		atomic.StoreUint32(&m.i.mmapCached, 0)
+	}
+}
+
+// CopyMapping implements memmap.Mappable.CopyMapping.
+func (m mmapCacheMappable) CopyMapping(ctx context.Context, ms memmap.MappingSpace, srcAR, dstAR usermem.AddrRange, offset uint64, writable bool) error {
+	return m.AddMapping(ctx, ms, dstAR, offset, writable)
+}
+
+// Translate implements memmap.Mappable.Translate.
+func (m mmapCacheMappable) Translate(ctx context.Context, required, optional memmap.MappableRange, at usermem.AccessType) ([]memmap.Translation, error) {
+	return m.i.cachingInodeOps.Translate(ctx, required, optional, at)
+}
+
+// InvalidateUnsavable implements memmap.Mappable.InvalidateUnsavable.
+func (m mmapCacheMappable) InvalidateUnsavable(ctx context.Context) error {
+	return m.i.cachingInodeOps.InvalidateUnsavable(ctx)
+}
+
 // Mappable implements fs.InodeOperations.Mappable.
 func (i *inodeOperations) Mappable(inode *fs.Inode) memmap.Mappable {
 	if i.session().cachePolicy.useCachingInodeOps(inode) {
 		return i.cachingInodeOps
 	}
+	if i.isMMapCached() {
+		return mmapCacheMappable{i}
+	}
 	// This check is necessary because it's returning an interface type.
 	if i.fileState.hostMappable != nil {
 		return i.fileState.hostMappable
@@ -488,7 +592,7 @@ func (i *inodeOperations) SetTimestamps(ctx context.Context, inode *fs.Inode, ts
 // Truncate implements fs.InodeOperations.Truncate.
 func (i *inodeOperations) Truncate(ctx context.Context, inode *fs.Inode, length int64) error {
 	// This can only be called for files anyway.
-	if i.session().cachePolicy.useCachingInodeOps(inode) {
+	if i.session().cachePolicy.useCachingInodeOps(inode) || i.isMMapCached() {
 		return i.cachingInodeOps.Truncate(ctx, inode, length)
 	}
 	if i.session().cachePolicy == cacheRemoteRevalidating {
@@ -500,13 +604,22 @@ func (i *inodeOperations) Truncate(ctx context.Context, inode *fs.Inode, length
 
 // WriteOut implements fs.InodeOperations.WriteOut.
 func (i *inodeOperations) WriteOut(ctx context.Context, inode *fs.Inode) error {
-	if !i.session().cachePolicy.cacheUAttrs(inode) {
+	if !i.session().cachePolicy.cacheUAttrs(inode) && !i.isMMapCached() {
 		return nil
 	}
 
 	return i.cachingInodeOps.WriteOut(ctx, inode)
 }
 
+// writeDirty writes back cached file data in the inclusive range [start, end]
+// that has been dirtied by writes or through shared mappings.
+func (i *inodeOperations) writeDirty(ctx context.Context, inode *fs.Inode, start, end int64) error {
+	if !i.session().cachePolicy.useCachingInodeOps(inode) && !i.isMMapCached() {
+		return nil
+	}
+	return i.cachingInodeOps.WriteDirty(ctx, memmap.MappableRange{uint64(start), uint64(end) + 1})
+}
+
 // Readlink implements fs.InodeOperations.Readlink.
 func (i *inodeOperations) Readlink(ctx context.Context, inode *fs.Inode) (string, error) {
 	if !fs.IsSymlink(inode.StableAttr) {
@@ -549,14 +662,31 @@ func (i *inodeOperations) StatFS(ctx context.Context) (fs.Info, error) {
 	return info, nil
 }
 
-func (i *inodeOperations) configureMMap(file *fs.File, opts *memmap.MMapOpts) error {
+func (i *inodeOperations) configureMMap(ctx context.Context, file *fs.File, h *handles, opts *memmap.MMapOpts) error {
 	if i.session().cachePolicy.useCachingInodeOps(file.Dirent.Inode) {
 		return fsutil.GenericConfigureMMap(file, i.cachingInodeOps, opts)
 	}
-	if i.fileState.hostMappable != nil {
+	if i.fileState.hostMappable != nil && i.fileState.FD() >= 0 {
 		return fsutil.GenericConfigureMMap(file, i.fileState.hostMappable, opts)
 	}
-	return syserror.ENODEV
+	if !fs.IsFile(file.Dirent.Inode.StableAttr) {
+		return syserror.ENODEV
+	}
+
+	// There is no host FD to map, so cache mapped pages in the sentry
+	// instead. Start with up-to-date attributes, since they haven't been
+	// cached while the file wasn't mapped.
+	i.mmapMu.Lock()
+	if !i.isMMapCached() {
+		if err := i.refreshMMapCache(ctx); err != nil {
+			i.mmapMu.Unlock()
+			return err
+		}
+		atomic.StoreUint32(&i.mmapCached, 1)
+	}
+	i.mmapMu.Unlock()
+	i.fileState.shareHandles(file.Flags(), h)
+	return fsutil.GenericConfigureMMap(file, mmapCacheMappable{i}, opts)
 }
 
 func init() {
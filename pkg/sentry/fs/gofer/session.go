@@ -134,6 +134,19 @@ type session struct {
 	// file and another deleting it concurrently, where the file will not be
 	// reported as socket file.
 	endpoints *endpointMaps `state:"wait"`
+
+	// hostUDSFDs is the value of the hostunixsocketfds mount option, see
+	// fs/gofer/fs.go. As host sockets can't be saved, it is taken from the
+	// options of the restored mount.
+	hostUDSFDs bool `state:"nosave"`
+
+	// hostUDSSendFDs is the value of the hostunixsocketsendfds mount
+	// option. Like hostUDSFDs, it is taken from the restored mount.
+	hostUDSSendFDs bool `state:"nosave"`
+
+	// coalesceSyncs is the value of the coalescesync mount option. Like
+	// hostUDSFDs, it is taken from the options of the restored mount.
+	coalesceSyncs bool `state:"nosave"`
 }
 
 // Destroy tears down the session.
@@ -240,6 +253,9 @@ func Root(ctx context.Context, dev string, filesystem fs.Filesystem, superBlockF
 		aname:           o.aname,
 		superBlockFlags: superBlockFlags,
 		mounter:         mounter,
+		hostUDSFDs:      o.hostunixsocketfds,
+		hostUDSSendFDs:  o.hostunixsocketsendfds,
+		coalesceSyncs:   o.coalescesync,
 	}
 
 	if o.privateunixsocket {
@@ -82,6 +82,9 @@ func (s *session) afterLoad() {
 	if args.Flags != s.superBlockFlags {
 		panic(fmt.Sprintf("new mount flags %v, want %v", args.Flags, s.superBlockFlags))
 	}
+	s.hostUDSFDs = opts.hostunixsocketfds
+	s.hostUDSSendFDs = opts.hostunixsocketsendfds
+	s.coalesceSyncs = opts.coalescesync
 
 	// Manually restore the connection.
 	conn, err := unet.NewSocket(opts.fd)
@@ -42,7 +42,7 @@ func (i *inodeOperations) BoundEndpoint(inode *fs.Inode, path string) transport.
 	}
 
 	inode.IncRef()
-	return &endpoint{inode, i.fileState.file.file, path}
+	return &endpoint{inode, i.fileState.file.file, path, i.session().hostUDSFDs, i.session().hostUDSSendFDs}
 }
 
 // endpoint is a Gofer-backed transport.BoundEndpoint.
@@ -59,6 +59,14 @@ type endpoint struct {
 
 	// path is the sentry path where this endpoint is bound.
 	path string
+
+	// recvFDs is true if file descriptors may be received over connections
+	// to the host socket.
+	recvFDs bool
+
+	// sendFDs is true if file descriptors may be sent over connections to
+	// the host socket.
+	sendFDs bool
 }
 
 func unixSockToP9(t transport.SockType) (p9.ConnectFlags, bool) {
@@ -74,7 +82,10 @@ func unixSockToP9(t transport.SockType) (p9.ConnectFlags, bool) {
 }
 
 // BidirectionalConnect implements ConnectableEndpoint.BidirectionalConnect.
-func (e *endpoint) BidirectionalConnect(ce transport.ConnectingEndpoint, returnConnect func(transport.Receiver, transport.ConnectedEndpoint)) *syserr.Error {
+//
+// The credentials of ce aren't passed to the host, whose peer sees those of
+// the gofer instead.
+func (e *endpoint) BidirectionalConnect(ce transport.ConnectingEndpoint, creds transport.PeerCredentials, returnConnect func(transport.Receiver, transport.ConnectedEndpoint, transport.PeerCredentials)) *syserr.Error {
 	cf, ok := unixSockToP9(ce.Type())
 	if !ok {
 		return syserr.ErrConnectionRefused
@@ -105,8 +116,14 @@ func (e *endpoint) BidirectionalConnect(ce transport.ConnectingEndpoint, returnC
 		log.Warningf("Gofer returned invalid host socket for BidirectionalConnect; file %+v flags %+v: %v", e.file, cf, serr)
 		return serr
 	}
+	if !e.recvFDs {
+		c.DropRights()
+	}
+	if e.sendFDs {
+		c.AllowSendRights()
+	}
 
-	returnConnect(c, c)
+	returnConnect(c, c, c.PeerCredentials())
 	ce.Unlock()
 	c.Init()
 
@@ -126,6 +143,9 @@ func (e *endpoint) UnidirectionalConnect() (transport.ConnectedEndpoint, *syserr
 		log.Warningf("Gofer returned invalid host socket for UnidirectionalConnect; file %+v: %v", e.file, serr)
 		return nil, serr
 	}
+	if e.sendFDs {
+		c.AllowSendRights()
+	}
 	c.Init()
 
 	// We don't need the receiver.
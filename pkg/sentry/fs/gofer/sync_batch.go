@@ -0,0 +1,101 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"sync"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+)
+
+// syncBatcher coalesces concurrent syncs of a remote file, as enabled by the
+// coalescesync mount option.
+//
+// At most one sync is in progress at a time. Callers that arrive while a sync
+// is in progress join a single pending batch, which is synced once by its
+// first caller after the in-progress sync completes. Since the pending batch's
+// sync starts after all of its callers arrived, it is a barrier for all
+// writes they completed before calling syncBatcher.sync.
+//
+// The zero value of syncBatcher is ready for use.
+type syncBatcher struct {
+	mu sync.Mutex
+
+	// cur is the batch currently being synced, or nil if no sync is in
+	// progress. cur is protected by mu.
+	cur *syncBatch
+
+	// next is the batch whose callers are waiting for cur to complete, or nil
+	// if there are no such callers. next is protected by mu.
+	next *syncBatch
+}
+
+// syncBatch is a set of callers that share the result of a single sync.
+type syncBatch struct {
+	// done is closed when the batch's sync completes.
+	done chan struct{}
+
+	// datasync is true if no caller in the batch requires a full sync.
+	// datasync is protected by syncBatcher.mu until the batch's sync begins.
+	datasync bool
+
+	// err is the result of the batch's sync. err is immutable after done is
+	// closed.
+	err error
+}
+
+// sync calls fn, or waits for a call to fn made on its behalf by another
+// caller, such that fn begins after sync was called. datasync is passed to
+// fn; callers coalesced into a single call to fn only receive datasync ==
+// true if all of them requested it.
+func (b *syncBatcher) sync(ctx context.Context, datasync bool, fn func(datasync bool) error) error {
+	b.mu.Lock()
+	if nb := b.next; nb != nil {
+		// Join the pending batch.
+		nb.datasync = nb.datasync && datasync
+		b.mu.Unlock()
+		ctx.UninterruptibleSleepStart(false)
+		<-nb.done
+		ctx.UninterruptibleSleepFinish(false)
+		return nb.err
+	}
+
+	nb := &syncBatch{
+		done:     make(chan struct{}),
+		datasync: datasync,
+	}
+	if prev := b.cur; prev != nil {
+		// Wait for the in-progress sync, which may have started before our
+		// caller's writes completed.
+		b.next = nb
+		b.mu.Unlock()
+		ctx.UninterruptibleSleepStart(false)
+		<-prev.done
+		ctx.UninterruptibleSleepFinish(false)
+		b.mu.Lock()
+		b.next = nil
+	}
+	b.cur = nb
+	datasync = nb.datasync
+	b.mu.Unlock()
+
+	nb.err = fn(datasync)
+
+	b.mu.Lock()
+	b.cur = nil
+	b.mu.Unlock()
+	close(nb.done)
+	return nb.err
+}
@@ -0,0 +1,235 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package host
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/safemem"
+)
+
+// maxAIOEvents is the capacity of the host AIO context shared by all host
+// AIO requests.
+const maxAIOEvents = 1024
+
+// Host AIO commands, from include/uapi/linux/aio_abi.h.
+const (
+	iocbCmdPreadv  = 7
+	iocbCmdPwritev = 8
+)
+
+// iocb is equivalent to struct iocb, from include/uapi/linux/aio_abi.h.
+type iocb struct {
+	Data      uint64
+	Key       uint32
+	RWFlags   uint32
+	OpCode    uint16
+	ReqPrio   int16
+	FD        uint32
+	Buf       uint64
+	Bytes     uint64
+	Offset    int64
+	Reserved2 uint64
+	Flags     uint32
+	ResFD     uint32
+}
+
+// ioEvent is equivalent to struct io_event, from
+// include/uapi/linux/aio_abi.h.
+type ioEvent struct {
+	Data uint64
+	Obj  uint64
+	Res  int64
+	Res2 int64
+}
+
+// AIORequest is a read or write of a host FD performed by host AIO.
+type AIORequest struct {
+	// FD is the host FD to read from or write to. It must remain open until
+	// Done is called.
+	FD int
+
+	// Write is true if the request is a write, and false if it is a read.
+	Write bool
+
+	// Offset is the offset into FD at which I/O begins.
+	Offset int64
+
+	// Blocks is the memory to read into or write from. It must remain valid
+	// until Done is called.
+	Blocks safemem.BlockSeq
+
+	// Done is called with the result of the request when it completes. Done
+	// is called from a goroutine shared by all host AIO requests, and must
+	// not block.
+	Done func(n int64, err error)
+}
+
+// aioContext is a host AIO context.
+type aioContext struct {
+	// id is the host aio_context_t. id is immutable.
+	id uintptr
+
+	mu sync.Mutex
+
+	// nextID is the identifier assigned to the next submitted request.
+	// nextID is protected by mu.
+	nextID uint64
+
+	// pending maps the identifiers of submitted requests to those requests.
+	// pending is protected by mu.
+	pending map[uint64]*AIORequest
+}
+
+var (
+	aioOnce sync.Once
+
+	// aio is the host AIO context. It is nil if aioErr is non-nil.
+	aio    *aioContext
+	aioErr error
+)
+
+// getAIOContext returns the host AIO context, creating it if necessary.
+func getAIOContext() (*aioContext, error) {
+	aioOnce.Do(func() {
+		var id uintptr
+		if _, _, errno := syscall.Syscall(syscall.SYS_IO_SETUP, maxAIOEvents, uintptr(unsafe.Pointer(&id)), 0); errno != 0 {
+			log.Infof("Host AIO is unavailable: io_setup failed: %v", errno)
+			aioErr = errno
+			return
+		}
+		aio = &aioContext{
+			id:      id,
+			pending: make(map[uint64]*AIORequest),
+		}
+		// Requests are only pending while their submitters wait for them to
+		// complete, and submitters must take care to be waited for by
+		// save/restore.
+		go aio.reap() // S/R-SAFE: see above.
+	})
+	return aio, aioErr
+}
+
+// AIOFD returns the host FD on which reads and writes of file may be
+// performed by SubmitAIO, or -1 if there is none.
+//
+// This is only the case for regular files whose I/O bypasses the sentry page
+// cache, and for host block devices, which were opened with O_DIRECT both in
+// the sandbox and on the host. Host AIO on files not opened with O_DIRECT
+// blocks in io_submit(2).
+func AIOFD(file *fs.File) int {
+	if !file.Flags().Direct {
+		return -1
+	}
+	var fd int
+	switch f := file.FileOperations.(type) {
+	case *fileOperations:
+		if f.iops.ReturnsWouldBlock() || file.Dirent.Inode.MountSource.Flags.ForcePageCache {
+			return -1
+		}
+		fd = f.iops.fileState.FD()
+	case *blockDeviceFileOperations:
+		fd = f.dev.directFD
+	default:
+		return -1
+	}
+	flags, _, errno := syscall.RawSyscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_GETFL, 0)
+	if errno != 0 || flags&syscall.O_DIRECT == 0 {
+		return -1
+	}
+	return fd
+}
+
+// SubmitAIO submits r to host AIO. If SubmitAIO returns a non-nil error, r was
+// not submitted, and r.Done will not be called.
+func SubmitAIO(r *AIORequest) error {
+	iovs := make([]syscall.Iovec, 0, r.Blocks.NumBlocks())
+	for bs := r.Blocks; !bs.IsEmpty(); bs = bs.Tail() {
+		b := bs.Head()
+		if b.Len() == 0 {
+			continue
+		}
+		iovs = append(iovs, syscall.Iovec{
+			Base: &b.ToSlice()[0],
+			Len:  uint64(b.Len()),
+		})
+	}
+	if len(iovs) == 0 {
+		return syscall.EINVAL
+	}
+	a, err := getAIOContext()
+	if err != nil {
+		return err
+	}
+
+	cb := &iocb{
+		OpCode: iocbCmdPreadv,
+		FD:     uint32(r.FD),
+		Buf:    uint64(uintptr(unsafe.Pointer(&iovs[0]))),
+		Bytes:  uint64(len(iovs)),
+		Offset: r.Offset,
+	}
+	if r.Write {
+		cb.OpCode = iocbCmdPwritev
+	}
+
+	a.mu.Lock()
+	cb.Data = a.nextID
+	a.nextID++
+	a.pending[cb.Data] = r
+	a.mu.Unlock()
+
+	// The host copies in cb and iovs during io_submit.
+	_, _, errno := syscall.Syscall(syscall.SYS_IO_SUBMIT, a.id, 1, uintptr(unsafe.Pointer(&cb)))
+	runtime.KeepAlive(iovs)
+	if errno != 0 {
+		a.mu.Lock()
+		delete(a.pending, cb.Data)
+		a.mu.Unlock()
+		return errno
+	}
+	return nil
+}
+
+// reap completes host AIO requests.
+func (a *aioContext) reap() {
+	events := make([]ioEvent, maxAIOEvents)
+	for {
+		n, _, errno := syscall.Syscall6(syscall.SYS_IO_GETEVENTS, a.id, 1, uintptr(len(events)), uintptr(unsafe.Pointer(&events[0])), 0, 0)
+		if errno != 0 {
+			if errno == syscall.EINTR {
+				continue
+			}
+			panic(fmt.Sprintf("io_getevents failed: %v", errno))
+		}
+		for _, ev := range events[:n] {
+			a.mu.Lock()
+			r := a.pending[ev.Data]
+			delete(a.pending, ev.Data)
+			a.mu.Unlock()
+			if ev.Res < 0 {
+				r.Done(0, syscall.Errno(-ev.Res))
+			} else {
+				r.Done(ev.Res, nil)
+			}
+		}
+	}
+}
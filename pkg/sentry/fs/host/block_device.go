@@ -0,0 +1,245 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package host
+
+import (
+	"syscall"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/fsutil"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/safemem"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+// BlockDevice describes a host block device donated to the sandbox.
+//
+// +stateify savable
+type BlockDevice struct {
+	// Name is the name of the device in /dev.
+	Name string
+
+	// FD is a host FD for the device, used by files opened without
+	// O_DIRECT.
+	FD int
+
+	// DirectFD is a host FD for the device opened with O_DIRECT, used by
+	// files opened with O_DIRECT. DirectFD may be equal to FD if the host
+	// device does not support O_DIRECT.
+	DirectFD int
+
+	// Major and Minor are the device numbers reported for the device.
+	Major uint16
+	Minor uint32
+
+	// Owner and Perms are the device's initial owner and permissions.
+	Owner fs.FileOwner
+	Perms fs.FilePermissions
+}
+
+// Size returns the size of the device in bytes.
+func (d *BlockDevice) Size() (uint64, error) {
+	return ioctlGetBlockDeviceSize(d.FD)
+}
+
+// SectorSizes returns the logical and physical sector sizes of the device.
+func (d *BlockDevice) SectorSizes() (logical, physical int32, err error) {
+	if logical, err = ioctlGetBlockDeviceInt(d.FD, linux.BLKSSZGET); err != nil {
+		return 0, 0, err
+	}
+	if physical, err = ioctlGetBlockDeviceInt(d.FD, linux.BLKPBSZGET); err != nil {
+		return 0, 0, err
+	}
+	return logical, physical, nil
+}
+
+// blockDevice implements fs.InodeOperations for a host block device.
+//
+// Reads and writes of the device are passed through to the host without
+// caching in the sentry, so that applications that manage raw devices (e.g.
+// databases) observe the durability semantics they expect.
+//
+// +stateify savable
+type blockDevice struct {
+	fsutil.InodeGenericChecker       `state:"nosave"`
+	fsutil.InodeNoExtendedAttributes `state:"nosave"`
+	fsutil.InodeNoopRelease          `state:"nosave"`
+	fsutil.InodeNoopTruncate         `state:"nosave"`
+	fsutil.InodeNoopWriteOut         `state:"nosave"`
+	fsutil.InodeNotDirectory         `state:"nosave"`
+	fsutil.InodeNotMappable          `state:"nosave"`
+	fsutil.InodeNotSocket            `state:"nosave"`
+	fsutil.InodeNotSymlink           `state:"nosave"`
+	fsutil.InodeVirtual              `state:"nosave"`
+
+	fsutil.InodeSimpleAttributes
+
+	// fd and directFD are the host FDs described by BlockDevice. They are
+	// immutable.
+	fd       int
+	directFD int
+}
+
+var _ fs.InodeOperations = (*blockDevice)(nil)
+
+// NewBlockDevice returns fs.InodeOperations for the host block device d. The
+// caller is responsible for creating an fs.Inode of type fs.BlockDevice with
+// d's device numbers.
+func NewBlockDevice(ctx context.Context, d *BlockDevice) fs.InodeOperations {
+	return &blockDevice{
+		InodeSimpleAttributes: fsutil.NewInodeSimpleAttributes(ctx, d.Owner, d.Perms, linux.TMPFS_MAGIC),
+		fd:                    d.FD,
+		directFD:              d.DirectFD,
+	}
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (b *blockDevice) GetFile(ctx context.Context, dirent *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	flags.Pread = true
+	flags.Pwrite = true
+
+	return fs.NewFile(ctx, dirent, flags, &blockDeviceFileOperations{dev: b}), nil
+}
+
+// size returns the size of the device in bytes.
+func (b *blockDevice) size() (int64, error) {
+	size, err := ioctlGetBlockDeviceSize(b.fd)
+	return int64(size), err
+}
+
+// blockDeviceFileOperations implements fs.FileOperations for a host block
+// device.
+//
+// +stateify savable
+type blockDeviceFileOperations struct {
+	waiter.AlwaysReady       `state:"nosave"`
+	fsutil.FileNoMMap        `state:"nosave"`
+	fsutil.FileNoopFlush     `state:"nosave"`
+	fsutil.FileNoopRelease   `state:"nosave"`
+	fsutil.FileNotDirReaddir `state:"nosave"`
+
+	dev *blockDevice
+}
+
+var _ fs.FileOperations = (*blockDeviceFileOperations)(nil)
+
+// hostFD returns the host FD used for I/O on file.
+func (f *blockDeviceFileOperations) hostFD(file *fs.File) int {
+	if file.Flags().Direct {
+		return f.dev.directFD
+	}
+	return f.dev.fd
+}
+
+// Read implements fs.FileOperations.Read.
+func (f *blockDeviceFileOperations) Read(ctx context.Context, file *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
+	fd := f.hostFD(file)
+	// Pass the destination blocks directly to the host, rather than buffering
+	// them as safemem.FromIOReader would, to preserve the alignment required
+	// by O_DIRECT.
+	return dst.CopyOutFrom(ctx, safemem.ReaderFunc(func(dsts safemem.BlockSeq) (uint64, error) {
+		return preadvBlocks(fd, dsts, offset)
+	}))
+}
+
+// Write implements fs.FileOperations.Write.
+func (f *blockDeviceFileOperations) Write(ctx context.Context, file *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+	fd := f.hostFD(file)
+	return src.CopyInTo(ctx, safemem.WriterFunc(func(srcs safemem.BlockSeq) (uint64, error) {
+		return pwritevBlocks(fd, srcs, offset)
+	}))
+}
+
+// Fsync implements fs.FileOperations.Fsync.
+func (f *blockDeviceFileOperations) Fsync(ctx context.Context, file *fs.File, start, end int64, syncType fs.SyncType) error {
+	// Both host FDs refer to the same device, so syncing either is
+	// sufficient.
+	if syncType == fs.SyncData {
+		return syscall.Fdatasync(f.dev.fd)
+	}
+	return syscall.Fsync(f.dev.fd)
+}
+
+// Seek implements fs.FileOperations.Seek.
+func (f *blockDeviceFileOperations) Seek(ctx context.Context, file *fs.File, whence fs.SeekWhence, offset int64) (int64, error) {
+	if whence != fs.SeekEnd {
+		return fsutil.SeekWithDirCursor(ctx, file, whence, offset, nil)
+	}
+	// The end of a block device is its size, which is not reflected in its
+	// attributes.
+	current := file.Offset()
+	size, err := f.dev.size()
+	if err != nil {
+		return current, err
+	}
+	if size+offset < 0 {
+		return current, syserror.EINVAL
+	}
+	return size + offset, nil
+}
+
+// Ioctl implements fs.FileOperations.Ioctl.
+func (f *blockDeviceFileOperations) Ioctl(ctx context.Context, io usermem.IO, args arch.SyscallArguments) (uintptr, error) {
+	var val interface{}
+	switch args[1].Uint() {
+	case linux.BLKGETSIZE64:
+		// Args: u64 *argp
+		// Get the device size in bytes.
+		size, err := ioctlGetBlockDeviceSize(f.dev.fd)
+		if err != nil {
+			return 0, err
+		}
+		val = size
+
+	case linux.BLKGETSIZE:
+		// Args: unsigned long *argp
+		// Get the device size in 512-byte sectors.
+		size, err := ioctlGetBlockDeviceSize(f.dev.fd)
+		if err != nil {
+			return 0, err
+		}
+		val = size >> 9
+
+	case linux.BLKSSZGET:
+		// Args: int *argp
+		// Get the logical sector size.
+		n, err := ioctlGetBlockDeviceInt(f.dev.fd, linux.BLKSSZGET)
+		if err != nil {
+			return 0, err
+		}
+		val = n
+
+	case linux.BLKPBSZGET:
+		// Args: unsigned int *argp
+		// Get the physical sector size.
+		n, err := ioctlGetBlockDeviceInt(f.dev.fd, linux.BLKPBSZGET)
+		if err != nil {
+			return 0, err
+		}
+		val = uint32(n)
+
+	default:
+		return 0, syserror.ENOTTY
+	}
+
+	_, err := usermem.CopyObjectOut(ctx, io, args[2].Pointer(), val, usermem.IOOpts{
+		AddressSpaceActive: true,
+	})
+	return 0, err
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package host
+
+import (
+	"syscall"
+	"unsafe"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/safemem"
+)
+
+// preadvBlocks reads from the host FD fd at offset into dsts.
+func preadvBlocks(fd int, dsts safemem.BlockSeq, offset int64) (uint64, error) {
+	return rwvBlocks(syscall.SYS_PREADV, fd, dsts, offset)
+}
+
+// pwritevBlocks writes srcs to the host FD fd at offset.
+func pwritevBlocks(fd int, srcs safemem.BlockSeq, offset int64) (uint64, error) {
+	return rwvBlocks(syscall.SYS_PWRITEV, fd, srcs, offset)
+}
+
+func rwvBlocks(sysno uintptr, fd int, bs safemem.BlockSeq, offset int64) (uint64, error) {
+	if bs.IsEmpty() {
+		return 0, nil
+	}
+	iovs := make([]syscall.Iovec, 0, bs.NumBlocks())
+	for ; !bs.IsEmpty(); bs = bs.Tail() {
+		b := bs.Head()
+		iovs = append(iovs, syscall.Iovec{
+			Base: &b.ToSlice()[0],
+			Len:  uint64(b.Len()),
+		})
+		// We don't need to care about b.NeedSafecopy(), because the host
+		// kernel will handle such address ranges just fine (by returning
+		// EFAULT).
+	}
+	n, _, errno := syscall.Syscall6(sysno, uintptr(fd), uintptr(unsafe.Pointer(&iovs[0])), uintptr(len(iovs)), uintptr(offset), 0 /* pos_h */, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return uint64(n), nil
+}
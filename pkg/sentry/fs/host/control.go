@@ -17,12 +17,24 @@ package host
 import (
 	"syscall"
 
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/fd"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/tmpfs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/memutil"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/control"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/unix/transport"
+	"gvisor.googlesource.com/gvisor/pkg/syserr"
 )
 
+// HostFileDescriptor is implemented by fs.FileOperations backed by a host FD.
+type HostFileDescriptor interface {
+	// HostFD returns the host FD backing the file, or -1 if there is none.
+	// The FD remains owned by the file.
+	HostFD() int
+}
+
 type scmRights struct {
 	fds []int
 }
@@ -88,3 +100,77 @@ func fdsToFiles(ctx context.Context, fds []int) []*fs.File {
 	}
 	return files
 }
+
+// filesToFDs returns host FDs that stand in for files when they are sent to a
+// host peer. Only regular files can be sent. Files backed by a host FD opened
+// with the same access mode are sent as that FD; note that, unlike in the
+// sandbox, the host peer doesn't share the file offset. Memfds sealed against
+// modification are sent as a host memfd holding a copy of their contents,
+// with the same seals. Any other file makes filesToFDs fail with EPERM.
+//
+// The returned copies must be closed once the FDs have been sent.
+func filesToFDs(files control.RightsFiles) ([]int, []*fd.FD, *syserr.Error) {
+	var (
+		fds    []int
+		copies []*fd.FD
+	)
+	for _, file := range files {
+		if !fs.IsRegular(file.Dirent.Inode.StableAttr) {
+			break
+		}
+
+		if hf, ok := file.FileOperations.(HostFileDescriptor); ok {
+			if hostFD := hf.HostFD(); hostFD >= 0 && hostAccessMode(hostFD) == file.Flags().ToLinux()&linux.O_ACCMODE {
+				fds = append(fds, hostFD)
+				continue
+			}
+			break
+		}
+
+		memfd, err := copySealedMemfd(file.Dirent.Inode)
+		if err != nil {
+			break
+		}
+		fds = append(fds, memfd.FD())
+		copies = append(copies, memfd)
+	}
+
+	if len(fds) < len(files) {
+		for _, c := range copies {
+			c.Close()
+		}
+		return nil, nil, syserr.ErrNotPermitted
+	}
+	return fds, copies, nil
+}
+
+// hostAccessMode returns the access mode of a host FD, or an invalid one if
+// it can't be determined.
+func hostAccessMode(fd int) uint {
+	flags, _, errno := syscall.RawSyscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_GETFL, 0)
+	if errno != 0 {
+		return linux.O_ACCMODE
+	}
+	return uint(flags) & linux.O_ACCMODE
+}
+
+// copySealedMemfd returns a host memfd with the contents and seals of a
+// sentry memfd, which must be sealed against modification.
+func copySealedMemfd(inode *fs.Inode) (*fd.FD, error) {
+	hostFD, err := memutil.CreateMemFD("sentry-memfd", linux.MFD_CLOEXEC|linux.MFD_ALLOW_SEALING)
+	if err != nil {
+		return nil, err
+	}
+	memfd := fd.New(hostFD)
+
+	seals, err := tmpfs.CopySealed(inode, memfd)
+	if err != nil {
+		memfd.Close()
+		return nil, err
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_FCNTL, uintptr(hostFD), linux.F_ADD_SEALS, uintptr(seals)); errno != 0 {
+		memfd.Close()
+		return nil, errno
+	}
+	return memfd, nil
+}
@@ -21,6 +21,7 @@ import (
 
 	"gvisor.googlesource.com/gvisor/pkg/fdnotifier"
 	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
 	"gvisor.googlesource.com/gvisor/pkg/waiter"
 )
 
@@ -36,6 +37,10 @@ type descriptor struct {
 	// after descriptor is created. Only set if donated is true.
 	origFD int
 
+	// key identifies the donated fd, so that an equivalent fd may be
+	// donated to the restoring sentry instead of origFD.
+	key string
+
 	// wouldBlock is true if value (below) points to a file that can
 	// return EWOULDBLOCK for operations that would block.
 	wouldBlock bool
@@ -80,9 +85,10 @@ func newDescriptor(fd int, donated bool, saveable bool, wouldBlock bool, queue *
 func (d *descriptor) initAfterLoad(mo *superOperations, id uint64, queue *waiter.Queue) error {
 	if d.donated {
 		var err error
-		d.value, err = syscall.Dup(d.origFD)
+		fd := donatedFD(d.key, d.origFD)
+		d.value, err = syscall.Dup(fd)
 		if err != nil {
-			return fmt.Errorf("failed to dup restored fd %d: %v", d.origFD, err)
+			return fmt.Errorf("failed to dup restored fd %d: %v", fd, err)
 		}
 	} else {
 		name, ok := mo.inodeMappings[id]
@@ -108,6 +114,20 @@ func (d *descriptor) initAfterLoad(mo *superOperations, id uint64, queue *waiter
 	return nil
 }
 
+// donatedFD returns the host fd that a donated fd is restored from: the fd
+// donated to the restoring sentry under key if any, or else origFD.
+func donatedFD(key string, origFD int) int {
+	if key == "" {
+		return origFD
+	}
+	if env, ok := fs.CurrentRestoreEnvironment(); ok {
+		if fd, ok := env.DonatedFDs[key]; ok {
+			return fd
+		}
+	}
+	return origFD
+}
+
 // Release releases all resources held by descriptor.
 func (d *descriptor) Release() {
 	if d.wouldBlock {
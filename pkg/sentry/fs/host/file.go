@@ -59,7 +59,7 @@ var _ fs.FileOperations = (*fileOperations)(nil)
 // FD will exist or represent the same file at time of restore. If such a
 // guarantee does exist, use ImportFile instead.
 func NewFile(ctx context.Context, fd int, mounter fs.FileOwner) (*fs.File, error) {
-	return newFileFromDonatedFD(ctx, fd, mounter, false, false)
+	return newFileFromDonatedFD(ctx, fd, "" /* key */, mounter, false, false)
 }
 
 // ImportFile creates a new File backed by the provided host file descriptor.
@@ -67,15 +67,17 @@ func NewFile(ctx context.Context, fd int, mounter fs.FileOwner) (*fs.File, error
 // ensure that later changes to FD are not reflected by the fs.File.
 //
 // If the returned file is saved, it will be restored by re-importing the FD
-// originally passed to ImportFile. It is the restorer's responsibility to
-// ensure that the FD represents the same file.
-func ImportFile(ctx context.Context, fd int, mounter fs.FileOwner, isTTY bool) (*fs.File, error) {
-	return newFileFromDonatedFD(ctx, fd, mounter, true, isTTY)
+// donated to the restoring sentry under key, see
+// fs.RestoreEnvironment.DonatedFDs, or if there is none, the FD originally
+// passed to ImportFile. It is the restorer's responsibility to ensure that the
+// FD represents the same file.
+func ImportFile(ctx context.Context, key string, fd int, mounter fs.FileOwner, isTTY bool) (*fs.File, error) {
+	return newFileFromDonatedFD(ctx, fd, key, mounter, true, isTTY)
 }
 
 // newFileFromDonatedFD returns an fs.File from a donated FD. If the FD is
-// saveable, then saveable is true.
-func newFileFromDonatedFD(ctx context.Context, donated int, mounter fs.FileOwner, saveable, isTTY bool) (*fs.File, error) {
+// saveable, then saveable is true and key identifies the FD at restore.
+func newFileFromDonatedFD(ctx context.Context, donated int, key string, mounter fs.FileOwner, saveable, isTTY bool) (*fs.File, error) {
 	var s syscall.Stat_t
 	if err := syscall.Fstat(donated, &s); err != nil {
 		return nil, err
@@ -90,7 +92,7 @@ func newFileFromDonatedFD(ctx context.Context, donated int, mounter fs.FileOwner
 			return nil, fmt.Errorf("cannot import host socket as TTY")
 		}
 
-		s, err := newSocket(ctx, donated, saveable)
+		s, err := newSocket(ctx, donated, key, saveable)
 		if err != nil {
 			return nil, err
 		}
@@ -105,6 +107,7 @@ func newFileFromDonatedFD(ctx context.Context, donated int, mounter fs.FileOwner
 			return nil, err
 		}
 		iops := inode.InodeOperations.(*inodeOperations)
+		iops.fileState.descriptor.key = key
 
 		name := fmt.Sprintf("host:[%d]", inode.StableAttr.InodeID)
 		dirent := fs.NewDirent(inode, name)
@@ -163,6 +166,11 @@ func (f *fileOperations) Readiness(mask waiter.EventMask) waiter.EventMask {
 	return fdnotifier.NonBlockingPoll(int32(f.iops.fileState.FD()), mask)
 }
 
+// HostFD implements HostFileDescriptor.HostFD.
+func (f *fileOperations) HostFD() int {
+	return f.iops.fileState.FD()
+}
+
 // Readdir implements fs.FileOperations.Readdir.
 func (f *fileOperations) Readdir(ctx context.Context, file *fs.File, serializer fs.DentrySerializer) (int64, error) {
 	root := fs.RootFromContext(ctx)
@@ -16,8 +16,10 @@ package host
 
 import (
 	"sync"
+	"sync/atomic"
 	"syscall"
 
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/fd"
 	"gvisor.googlesource.com/gvisor/pkg/fdnotifier"
 	"gvisor.googlesource.com/gvisor/pkg/log"
@@ -68,9 +70,26 @@ type ConnectedEndpoint struct {
 	// If srfd >= 0, it is the host FD that file was imported from.
 	srfd int `state:"wait"`
 
+	// key identifies srfd, so that an equivalent FD may be donated to the
+	// restoring sentry instead.
+	key string
+
 	// stype is the type of Unix socket.
 	stype transport.SockType
 
+	// dropRights is true if the file descriptors sent by the host peer
+	// (SCM_RIGHTS) aren't received, which makes the host close them.
+	dropRights bool
+
+	// sendRights is true if files may be sent to the host peer (SCM_RIGHTS),
+	// subject to the restrictions of filesToFDs.
+	sendRights bool
+
+	// passcred is 1 if SO_PASSCRED has been enabled on the host FD. It is
+	// enabled once credentials are first requested, and again after
+	// restore. Must be accessed atomically.
+	passcred int32 `state:"nosave"`
+
 	// sndbuf is the size of the send buffer.
 	//
 	// N.B. When this is smaller than the host size, we present it via
@@ -141,6 +160,21 @@ func NewConnectedEndpoint(file *fd.FD, queue *waiter.Queue, path string) (*Conne
 	return &e, nil
 }
 
+// DropRights makes the endpoint drop the file descriptors sent by the host
+// peer rather than passing them to the application. It must be called before
+// the endpoint is used.
+func (c *ConnectedEndpoint) DropRights() {
+	c.dropRights = true
+}
+
+// AllowSendRights allows sending files to the host peer, which is otherwise
+// rejected. Only files that can be represented by a host file descriptor
+// without widening the peer's access are allowed; see filesToFDs. It must be
+// called before the endpoint is used.
+func (c *ConnectedEndpoint) AllowSendRights() {
+	c.sendRights = true
+}
+
 // Init will do initialization required without holding other locks.
 func (c *ConnectedEndpoint) Init() {
 	if err := fdnotifier.AddFD(int32(c.file.FD()), c.queue); err != nil {
@@ -167,13 +201,14 @@ func NewSocketWithDirent(ctx context.Context, d *fs.Dirent, f *fd.FD, flags fs.F
 
 	e.Init()
 
-	ep := transport.NewExternal(e.stype, uniqueid.GlobalProviderFromContext(ctx), &q, e, e)
+	ep := transport.NewExternal(e.stype, uniqueid.GlobalProviderFromContext(ctx), &q, e, e, e.PeerCredentials())
 
 	return unixsocket.NewWithDirent(ctx, d, ep, e.stype != transport.SockStream, flags), nil
 }
 
-// newSocket allocates a new unix socket with host endpoint.
-func newSocket(ctx context.Context, orgfd int, saveable bool) (*fs.File, error) {
+// newSocket allocates a new unix socket with host endpoint. If saveable is
+// true, key identifies orgfd at restore.
+func newSocket(ctx context.Context, orgfd int, key string, saveable bool) (*fs.File, error) {
 	ownedfd := orgfd
 	srfd := -1
 	if saveable {
@@ -197,9 +232,10 @@ func newSocket(ctx context.Context, orgfd int, saveable bool) (*fs.File, error)
 	}
 
 	e.srfd = srfd
+	e.key = key
 	e.Init()
 
-	ep := transport.NewExternal(e.stype, uniqueid.GlobalProviderFromContext(ctx), &q, e, e)
+	ep := transport.NewExternal(e.stype, uniqueid.GlobalProviderFromContext(ctx), &q, e, e, e.PeerCredentials())
 
 	return unixsocket.New(ctx, ep, e.stype != transport.SockStream), nil
 }
@@ -212,15 +248,30 @@ func (c *ConnectedEndpoint) Send(data [][]byte, controlMessages transport.Contro
 		return 0, false, syserr.ErrClosedForSend
 	}
 
-	if !controlMessages.Empty() {
-		return 0, false, syserr.ErrInvalidEndpointState
+	// Credentials are dropped rather than rejected: the host only accepts
+	// the sentry's own, which it passes on by itself if the peer enabled
+	// SO_PASSCRED. Rights are only sent if allowed by AllowSendRights.
+	var ctrl []byte
+	if controlMessages.Rights != nil {
+		rights, ok := controlMessages.Rights.(*control.RightsFiles)
+		if !c.sendRights || !ok {
+			return 0, false, syserr.ErrInvalidEndpointState
+		}
+		fds, copies, serr := filesToFDs(*rights)
+		if serr != nil {
+			return 0, false, serr
+		}
+		for _, f := range copies {
+			defer f.Close()
+		}
+		ctrl = syscall.UnixRights(fds...)
 	}
 
 	// Since stream sockets don't preserve message boundaries, we can write
 	// only as much of the message as fits in the send buffer.
 	truncate := c.stype == transport.SockStream
 
-	n, totalLen, err := fdWriteVec(c.file.FD(), data, c.sndbuf, truncate)
+	n, totalLen, err := fdWriteVec(c.file.FD(), data, ctrl, c.sndbuf, truncate)
 	if n < totalLen && err == nil {
 		// The host only returns a short write if it would otherwise
 		// block (and only for stream sockets).
@@ -263,10 +314,46 @@ func (c *ConnectedEndpoint) Writable() bool {
 
 // Passcred implements transport.ConnectedEndpoint.Passcred.
 func (c *ConnectedEndpoint) Passcred() bool {
-	// We don't support credential passing for host sockets.
+	// Whether the host peer enabled SO_PASSCRED isn't known, and any
+	// credentials sent to it are dropped anyway.
 	return false
 }
 
+// PeerCredentials returns the credentials of the host peer, or nil if the host
+// doesn't report them.
+func (c *ConnectedEndpoint) PeerCredentials() transport.PeerCredentials {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ucred, err := syscall.GetsockoptUcred(c.file.FD(), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	if err != nil {
+		return nil
+	}
+	groups, err := getPeerGroups(c.file.FD())
+	if err != nil {
+		// SO_PEERGROUPS is only available on Linux 4.13 and later.
+		log.Debugf("Failed to get the host peer groups: %v", err)
+	}
+	return control.NewHostPeerCredentials(linux.ControlMessageCredentials{
+		PID: ucred.Pid,
+		UID: ucred.Uid,
+		GID: ucred.Gid,
+	}, groups)
+}
+
+// enablePasscred enables SO_PASSCRED on the host FD, so that received
+// messages carry the credentials of their sender. Messages already queued on
+// the host aren't affected.
+func (c *ConnectedEndpoint) enablePasscred() {
+	if atomic.LoadInt32(&c.passcred) != 0 {
+		return
+	}
+	if err := syscall.SetsockoptInt(c.file.FD(), syscall.SOL_SOCKET, syscall.SO_PASSCRED, 1); err != nil {
+		log.Warningf("Failed to enable SO_PASSCRED on host socket: %v", err)
+		return
+	}
+	atomic.StoreInt32(&c.passcred, 1)
+}
+
 // GetLocalAddress implements transport.ConnectedEndpoint.GetLocalAddress.
 func (c *ConnectedEndpoint) GetLocalAddress() (tcpip.FullAddress, *tcpip.Error) {
 	return tcpip.FullAddress{Addr: tcpip.Address(c.path)}, nil
@@ -290,9 +377,13 @@ func (c *ConnectedEndpoint) Recv(data [][]byte, creds bool, numRights uintptr, p
 	}
 
 	var cm unet.ControlMessage
-	if numRights > 0 {
+	if numRights > 0 && !c.dropRights {
 		cm.EnableFDs(int(numRights))
 	}
+	if creds {
+		c.enablePasscred()
+		cm = append(cm, make([]byte, syscall.CmsgSpace(syscall.SizeofUcred))...)
+	}
 
 	// N.B. Unix sockets don't have a receive buffer, the send buffer
 	// serves both purposes.
@@ -320,15 +411,57 @@ func (c *ConnectedEndpoint) Recv(data [][]byte, creds bool, numRights uintptr, p
 		return rl, ml, transport.ControlMessages{}, tcpip.FullAddress{Addr: tcpip.Address(c.path)}, false, nil
 	}
 
-	fds, err := cm.ExtractFDs()
+	fds, ucred, err := parseControlMessages(cm)
 	if err != nil {
 		return 0, 0, transport.ControlMessages{}, tcpip.FullAddress{}, false, syserr.FromError(err)
 	}
 
-	if len(fds) == 0 {
-		return rl, ml, transport.ControlMessages{}, tcpip.FullAddress{Addr: tcpip.Address(c.path)}, false, nil
+	var cms transport.ControlMessages
+	if len(fds) > 0 {
+		cms.Rights = newSCMRights(fds)
+	}
+	if ucred != nil {
+		cms.Credentials = control.NewHostSCMCredentials(linux.ControlMessageCredentials{
+			PID: ucred.Pid,
+			UID: ucred.Uid,
+			GID: ucred.Gid,
+		})
+	}
+	return rl, ml, cms, tcpip.FullAddress{Addr: tcpip.Address(c.path)}, false, nil
+}
+
+// parseControlMessages extracts the FDs and the credentials from control
+// messages received from the host.
+func parseControlMessages(b []byte) ([]int, *syscall.Ucred, error) {
+	msgs, err := syscall.ParseSocketControlMessage(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	var fds []int
+	var ucred *syscall.Ucred
+	for i := range msgs {
+		msg := &msgs[i]
+		if msg.Header.Level != syscall.SOL_SOCKET {
+			continue
+		}
+		switch msg.Header.Type {
+		case syscall.SCM_RIGHTS:
+			msgFDs, err := syscall.ParseUnixRights(msg)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, fd := range msgFDs {
+				if fd >= 0 {
+					fds = append(fds, fd)
+				}
+			}
+		case syscall.SCM_CREDENTIALS:
+			if ucred, err = syscall.ParseUnixCredentials(msg); err != nil {
+				return nil, nil, err
+			}
+		}
 	}
-	return rl, ml, control.New(nil, nil, newSCMRights(fds)), tcpip.FullAddress{Addr: tcpip.Address(c.path)}, false, nil
+	return fds, ucred, nil
 }
 
 // close releases all resources related to the endpoint.
@@ -30,9 +30,10 @@ func (c *ConnectedEndpoint) beforeSave() {
 
 // afterLoad is invoked by stateify.
 func (c *ConnectedEndpoint) afterLoad() {
-	f, err := syscall.Dup(c.srfd)
+	srfd := donatedFD(c.key, c.srfd)
+	f, err := syscall.Dup(srfd)
 	if err != nil {
-		panic(fmt.Sprintf("failed to dup restored FD %d: %v", c.srfd, err))
+		panic(fmt.Sprintf("failed to dup restored FD %d: %v", srfd, err))
 	}
 	c.file = fd.New(f)
 	if err := c.init(); err != nil {
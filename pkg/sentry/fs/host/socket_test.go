@@ -15,15 +15,20 @@
 package host
 
 import (
+	"io/ioutil"
+	"os"
 	"reflect"
 	"syscall"
 	"testing"
 
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/fd"
 	"gvisor.googlesource.com/gvisor/pkg/fdnotifier"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context/contexttest"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
 	ktime "gvisor.googlesource.com/gvisor/pkg/sentry/kernel/time"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/socket"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/control"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/unix/transport"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
 	"gvisor.googlesource.com/gvisor/pkg/syserr"
@@ -67,7 +72,7 @@ func TestSocketIsBlocking(t *testing.T) {
 	if fl&syscall.O_NONBLOCK == syscall.O_NONBLOCK {
 		t.Fatalf("Expected socket %v to be blocking", pair[1])
 	}
-	sock, err := newSocket(contexttest.Context(t), pair[0], false)
+	sock, err := newSocket(contexttest.Context(t), pair[0], "" /* key */, false)
 	if err != nil {
 		t.Fatalf("newSocket(%v) failed => %v", pair[0], err)
 	}
@@ -93,7 +98,7 @@ func TestSocketWritev(t *testing.T) {
 	if err != nil {
 		t.Fatalf("host socket creation failed: %v", err)
 	}
-	socket, err := newSocket(contexttest.Context(t), pair[0], false)
+	socket, err := newSocket(contexttest.Context(t), pair[0], "" /* key */, false)
 	if err != nil {
 		t.Fatalf("newSocket(%v) => %v", pair[0], err)
 	}
@@ -115,7 +120,7 @@ func TestSocketWritevLen0(t *testing.T) {
 	if err != nil {
 		t.Fatalf("host socket creation failed: %v", err)
 	}
-	socket, err := newSocket(contexttest.Context(t), pair[0], false)
+	socket, err := newSocket(contexttest.Context(t), pair[0], "" /* key */, false)
 	if err != nil {
 		t.Fatalf("newSocket(%v) => %v", pair[0], err)
 	}
@@ -136,7 +141,7 @@ func TestSocketSendMsgLen0(t *testing.T) {
 	if err != nil {
 		t.Fatalf("host socket creation failed: %v", err)
 	}
-	sfile, err := newSocket(contexttest.Context(t), pair[0], false)
+	sfile, err := newSocket(contexttest.Context(t), pair[0], "" /* key */, false)
 	if err != nil {
 		t.Fatalf("newSocket(%v) => %v", pair[0], err)
 	}
@@ -158,14 +163,14 @@ func TestListen(t *testing.T) {
 	if err != nil {
 		t.Fatalf("syscall.Socket(syscall.AF_UNIX, syscall.SOCK_STREAM, 0) => %v", err)
 	}
-	sfile1, err := newSocket(contexttest.Context(t), pair[0], false)
+	sfile1, err := newSocket(contexttest.Context(t), pair[0], "" /* key */, false)
 	if err != nil {
 		t.Fatalf("newSocket(%v) => %v", pair[0], err)
 	}
 	defer sfile1.DecRef()
 	socket1 := sfile1.FileOperations.(socket.Socket)
 
-	sfile2, err := newSocket(contexttest.Context(t), pair[1], false)
+	sfile2, err := newSocket(contexttest.Context(t), pair[1], "" /* key */, false)
 	if err != nil {
 		t.Fatalf("newSocket(%v) => %v", pair[1], err)
 	}
@@ -185,7 +190,7 @@ func TestListen(t *testing.T) {
 	if err != nil {
 		t.Fatalf("syscall.Socket(syscall.AF_UNIX, syscall.SOCK_STREAM, 0) => %v", err)
 	}
-	sfile3, err := newSocket(contexttest.Context(t), sock, false)
+	sfile3, err := newSocket(contexttest.Context(t), sock, "" /* key */, false)
 	if err != nil {
 		t.Fatalf("newSocket(%v) => %v", sock, err)
 	}
@@ -219,6 +224,161 @@ func TestPasscred(t *testing.T) {
 	}
 }
 
+func TestRecvCredentials(t *testing.T) {
+	pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_NONBLOCK, 0)
+	if err != nil {
+		t.Fatalf("host socket creation failed: %v", err)
+	}
+	defer syscall.Close(pair[1])
+	e := ConnectedEndpoint{file: fd.New(pair[0]), stype: transport.SockStream, sndbuf: 1 << 16}
+	defer e.file.Close()
+
+	// The first request for credentials enables SO_PASSCRED on the host.
+	buf := make([]byte, 4)
+	if _, _, _, _, _, err := e.Recv([][]byte{buf}, true, 0, false); err != syserr.ErrTryAgain {
+		t.Fatalf("Got %#v.Recv() = %v, want = %v", e, err, syserr.ErrTryAgain)
+	}
+
+	if _, err := syscall.Write(pair[1], []byte("test")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	n, _, cms, _, _, serr := e.Recv([][]byte{buf}, true, 0, false)
+	if serr != nil || n != 4 {
+		t.Fatalf("Got %#v.Recv() = %d, %v, want = 4, nil", e, n, serr)
+	}
+	if cms.Credentials == nil {
+		t.Errorf("Got %#v.Recv() without credentials", e)
+	}
+}
+
+func TestSendCredentials(t *testing.T) {
+	pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_NONBLOCK, 0)
+	if err != nil {
+		t.Fatalf("host socket creation failed: %v", err)
+	}
+	defer syscall.Close(pair[1])
+	e := ConnectedEndpoint{file: fd.New(pair[0]), stype: transport.SockStream, sndbuf: 1 << 16}
+	defer e.file.Close()
+
+	// Credentials can't be passed to the host and are dropped.
+	cms := transport.ControlMessages{Credentials: control.NewHostSCMCredentials(linux.ControlMessageCredentials{})}
+	if n, _, err := e.Send([][]byte{[]byte("test")}, cms, tcpip.FullAddress{}); err != nil || n != 4 {
+		t.Errorf("Got %#v.Send() = %d, %v, want = 4, nil", e, n, err)
+	}
+}
+
+func TestRecvDropRights(t *testing.T) {
+	pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatalf("host socket creation failed: %v", err)
+	}
+	defer syscall.Close(pair[1])
+	e := ConnectedEndpoint{file: fd.New(pair[0]), stype: transport.SockStream, sndbuf: 1 << 16}
+	defer e.file.Close()
+	e.DropRights()
+
+	if err := syscall.Sendmsg(pair[1], []byte("test"), syscall.UnixRights(pair[1]), nil, 0); err != nil {
+		t.Fatalf("sendmsg failed: %v", err)
+	}
+	buf := make([]byte, 4)
+	n, _, cms, _, _, serr := e.Recv([][]byte{buf}, false, 1, false)
+	if serr != nil || n != 4 {
+		t.Fatalf("Got %#v.Recv() = %d, %v, want = 4, nil", e, n, serr)
+	}
+	if cms.Rights != nil {
+		t.Errorf("Got %#v.Recv() with rights, want none", e)
+	}
+}
+
+func TestSendRightsDisallowed(t *testing.T) {
+	pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatalf("host socket creation failed: %v", err)
+	}
+	defer syscall.Close(pair[1])
+	e := ConnectedEndpoint{file: fd.New(pair[0]), stype: transport.SockStream, sndbuf: 1 << 16}
+	defer e.file.Close()
+
+	cms := transport.ControlMessages{Rights: &control.RightsFiles{}}
+	if _, _, err := e.Send([][]byte{[]byte("test")}, cms, tcpip.FullAddress{}); err != syserr.ErrInvalidEndpointState {
+		t.Errorf("Got %#v.Send() = %v, want = %v", e, err, syserr.ErrInvalidEndpointState)
+	}
+}
+
+func TestSendRights(t *testing.T) {
+	pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatalf("host socket creation failed: %v", err)
+	}
+	defer syscall.Close(pair[1])
+	e := ConnectedEndpoint{file: fd.New(pair[0]), stype: transport.SockStream, sndbuf: 1 << 16}
+	defer e.file.Close()
+	e.AllowSendRights()
+
+	tmp, err := ioutil.TempFile("", "send_rights")
+	if err != nil {
+		t.Fatalf("TempFile failed: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	hostFD, err := syscall.Open(tmp.Name(), syscall.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	file, err := NewFile(contexttest.Context(t), hostFD, fs.RootOwner)
+	if err != nil {
+		syscall.Close(hostFD)
+		t.Fatalf("NewFile failed: %v", err)
+	}
+	defer file.DecRef()
+
+	cms := transport.ControlMessages{Rights: &control.RightsFiles{file}}
+	if n, _, err := e.Send([][]byte{[]byte("test")}, cms, tcpip.FullAddress{}); err != nil || n != 4 {
+		t.Fatalf("Got %#v.Send() = %d, %v, want = 4, nil", e, n, err)
+	}
+
+	buf := make([]byte, 4)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	_, oobn, _, _, err := syscall.Recvmsg(pair[1], buf, oob, 0)
+	if err != nil {
+		t.Fatalf("recvmsg failed: %v", err)
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("Got control messages %v, %v, want one", msgs, err)
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		t.Fatalf("Got rights %v, %v, want one FD", fds, err)
+	}
+	defer syscall.Close(fds[0])
+
+	var got, want syscall.Stat_t
+	if err := syscall.Fstat(fds[0], &got); err != nil {
+		t.Fatalf("fstat failed: %v", err)
+	}
+	if err := syscall.Fstat(hostFD, &want); err != nil {
+		t.Fatalf("fstat failed: %v", err)
+	}
+	if got.Dev != want.Dev || got.Ino != want.Ino {
+		t.Errorf("Got file %d:%d, want %d:%d", got.Dev, got.Ino, want.Dev, want.Ino)
+	}
+}
+
+func TestPeerCredentials(t *testing.T) {
+	pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatalf("host socket creation failed: %v", err)
+	}
+	defer syscall.Close(pair[1])
+	e := ConnectedEndpoint{file: fd.New(pair[0])}
+	defer e.file.Close()
+
+	if e.PeerCredentials() == nil {
+		t.Errorf("Got %#v.PeerCredentials() = nil, want non-nil", e)
+	}
+}
+
 func TestGetLocalAddress(t *testing.T) {
 	e := ConnectedEndpoint{path: "foo"}
 	want := tcpip.FullAddress{Addr: tcpip.Address("foo")}
@@ -17,6 +17,8 @@ package host
 import (
 	"syscall"
 	"unsafe"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 )
 
 // fdReadVec receives from fd to bufs.
@@ -66,11 +68,11 @@ func fdReadVec(fd int, bufs [][]byte, control []byte, peek bool, maxlen int) (re
 	return n, n, msg.Controllen, err
 }
 
-// fdWriteVec sends from bufs to fd.
+// fdWriteVec sends from bufs and control to fd.
 //
 // If the total length of bufs is > maxlen && truncate, fdWriteVec will do a
 // partial write and err will indicate why the message was truncated.
-func fdWriteVec(fd int, bufs [][]byte, maxlen int, truncate bool) (uintptr, uintptr, error) {
+func fdWriteVec(fd int, bufs [][]byte, control []byte, maxlen int, truncate bool) (uintptr, uintptr, error) {
 	length, iovecs, intermediate, err := buildIovec(bufs, maxlen, truncate)
 	if err != nil && len(iovecs) == 0 {
 		// No partial write to do, return error immediately.
@@ -83,6 +85,11 @@ func fdWriteVec(fd int, bufs [][]byte, maxlen int, truncate bool) (uintptr, uint
 	}
 
 	var msg syscall.Msghdr
+	if len(control) != 0 {
+		msg.Control = &control[0]
+		msg.Controllen = uint64(len(control))
+	}
+
 	if len(iovecs) > 0 {
 		msg.Iov = &iovecs[0]
 		msg.Iovlen = uint64(len(iovecs))
@@ -96,3 +103,22 @@ func fdWriteVec(fd int, bufs [][]byte, maxlen int, truncate bool) (uintptr, uint
 
 	return n, length, err
 }
+
+// getPeerGroups returns the supplementary groups of the peer of fd, as reported
+// by SO_PEERGROUPS.
+func getPeerGroups(fd int) ([]uint32, error) {
+	groups := make([]uint32, 16)
+	for {
+		optlen := uint32(4 * len(groups))
+		_, _, e := syscall.RawSyscall6(syscall.SYS_GETSOCKOPT, uintptr(fd), syscall.SOL_SOCKET, linux.SO_PEERGROUPS, uintptr(unsafe.Pointer(&groups[0])), uintptr(unsafe.Pointer(&optlen)), 0)
+		if e == syscall.ERANGE {
+			// optlen is the length required.
+			groups = make([]uint32, optlen/4)
+			continue
+		}
+		if e != 0 {
+			return nil, e
+		}
+		return groups[:optlen/4], nil
+	}
+}
@@ -388,6 +388,18 @@ func (i *Inode) IsVirtual() bool {
 	return i.InodeOperations.IsVirtual()
 }
 
+// InOverlayUpper returns true if i is an overlay Inode whose file exists in
+// the upper filesystem, i.e. it was created or copied up after the overlay was
+// mounted.
+func (i *Inode) InOverlayUpper() bool {
+	if i.overlay == nil {
+		return false
+	}
+	i.overlay.copyMu.RLock()
+	defer i.overlay.copyMu.RUnlock()
+	return i.overlay.upper != nil
+}
+
 // StatFS calls i.InodeOperations.StatFS.
 func (i *Inode) StatFS(ctx context.Context) (Info, error) {
 	if i.overlay != nil {
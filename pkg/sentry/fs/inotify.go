@@ -15,6 +15,9 @@
 package fs
 
 import (
+	"bytes"
+	"fmt"
+	"sort"
 	"sync"
 	"sync/atomic"
 
@@ -96,6 +99,26 @@ func (i *Inotify) Release() {
 	}
 }
 
+// FdInfo implements FdInfoer.FdInfo. It reports the watches, as in Linux's
+// fs/notify/fdinfo.c:inotify_show_fdinfo.
+func (i *Inotify) FdInfo(ctx context.Context) string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	wds := make([]int32, 0, len(i.watches))
+	for wd := range i.watches {
+		wds = append(wds, wd)
+	}
+	sort.Slice(wds, func(a, b int) bool { return wds[a] < wds[b] })
+
+	var buf bytes.Buffer
+	for _, wd := range wds {
+		w := i.watches[wd]
+		fmt.Fprintf(&buf, "inotify wd:%x ino:%x sdev:%x mask:%x ignored_mask:0\n", wd, w.target.StableAttr.InodeID, w.target.StableAttr.DeviceID, atomic.LoadUint32(&w.mask))
+	}
+	return buf.String()
+}
+
 // Readiness implements waiter.Waitable.Readiness.
 //
 // Readiness indicates whether there are pending events for an inotify instance.
@@ -0,0 +1,230 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernfs
+
+import (
+	"sync"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/fsutil"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/ramfs"
+)
+
+// maxCachedChildren is the maximum number of dynamic children that a Dir
+// caches.
+const maxCachedChildren = 256
+
+// A DirSource provides the dynamic children of a Dir, such as the per-task
+// directories in /proc.
+type DirSource interface {
+	// Lookup returns a new reference on the dynamic child called name, or
+	// syserror.ENOENT if there is no such child. dir is the Inode of the
+	// Dir.
+	Lookup(ctx context.Context, dir *fs.Inode, name string) (*fs.Inode, error)
+
+	// Children returns the names and attributes of the dynamic children to
+	// be listed by readdir. Children that can be looked up need not be
+	// listed.
+	Children(ctx context.Context) map[string]fs.DentAttr
+}
+
+// A Revalidator is a DirSource whose dynamic children may be cached by the
+// Dir between lookups, avoiding the cost of constructing them again.
+type Revalidator interface {
+	DirSource
+
+	// Revalidate returns true if child, which was returned by Lookup for
+	// name, can still be used. Revalidate must not call into the Dir.
+	Revalidate(ctx context.Context, name string, child *fs.Inode) bool
+}
+
+// Dir implements fs.InodeOperations for a directory with a fixed set of
+// children, and optionally dynamic children provided by a DirSource.
+//
+// +stateify savable
+type Dir struct {
+	ramfs.Dir
+
+	// filesystem is the Filesystem containing the Dir. filesystem is
+	// immutable.
+	filesystem *Filesystem
+
+	// src provides the dynamic children of the Dir. src is immutable, and
+	// may be nil.
+	src DirSource
+
+	// mu protects cache.
+	mu sync.Mutex `state:"nosave"`
+
+	// cache maps names to dynamic children returned by src.Lookup, if src
+	// is a Revalidator. A reference is held on each cached Inode.
+	cache map[string]*fs.Inode
+}
+
+var _ fs.InodeOperations = (*Dir)(nil)
+
+func newDir(ctx context.Context, f *Filesystem, contents map[string]*fs.Inode, src DirSource) *Dir {
+	return &Dir{
+		Dir:        *ramfs.NewDir(ctx, contents, fs.RootOwner, fs.FilePermsFromMode(0555)),
+		filesystem: f,
+		src:        src,
+	}
+}
+
+// StatFS implements fs.InodeOperations.StatFS.
+func (d *Dir) StatFS(context.Context) (fs.Info, error) {
+	return fs.Info{Type: d.filesystem.magic}, nil
+}
+
+// Release implements fs.InodeOperations.Release.
+func (d *Dir) Release(ctx context.Context) {
+	d.mu.Lock()
+	cache := d.cache
+	d.cache = nil
+	d.mu.Unlock()
+	for _, child := range cache {
+		child.DecRef()
+	}
+	d.Dir.Release(ctx)
+}
+
+// Lookup implements fs.InodeOperations.Lookup.
+func (d *Dir) Lookup(ctx context.Context, dir *fs.Inode, name string) (*fs.Dirent, error) {
+	dirent, err := d.Dir.Lookup(ctx, dir, name)
+	if err == nil || d.src == nil {
+		return dirent, err
+	}
+	child, err := d.lookupDynamic(ctx, dir, name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.NewDirent(child, name), nil
+}
+
+// lookupDynamic returns a new reference on the dynamic child called name.
+func (d *Dir) lookupDynamic(ctx context.Context, dir *fs.Inode, name string) (*fs.Inode, error) {
+	rv, ok := d.src.(Revalidator)
+	if !ok {
+		return d.src.Lookup(ctx, dir, name)
+	}
+
+	// References are dropped without d.mu locked, since releasing an Inode
+	// may do arbitrary work.
+	var drop []*fs.Inode
+	defer func() {
+		for _, child := range drop {
+			child.DecRef()
+		}
+	}()
+
+	d.mu.Lock()
+	if child, ok := d.cache[name]; ok {
+		if rv.Revalidate(ctx, name, child) {
+			child.IncRef()
+			d.mu.Unlock()
+			return child, nil
+		}
+		delete(d.cache, name)
+		drop = append(drop, child)
+	}
+	d.mu.Unlock()
+
+	child, err := d.src.Lookup(ctx, dir, name)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if old, ok := d.cache[name]; ok {
+		// Raced with another lookup.
+		drop = append(drop, old)
+	} else if len(d.cache) >= maxCachedChildren {
+		// Evict stale children, or an arbitrary one if there are none.
+		for n, c := range d.cache {
+			if !rv.Revalidate(ctx, n, c) {
+				delete(d.cache, n)
+				drop = append(drop, c)
+			}
+		}
+		for n, c := range d.cache {
+			if len(d.cache) < maxCachedChildren {
+				break
+			}
+			delete(d.cache, n)
+			drop = append(drop, c)
+		}
+	}
+	if d.cache == nil {
+		d.cache = make(map[string]*fs.Inode)
+	}
+	child.IncRef()
+	d.cache[name] = child
+	return child, nil
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (d *Dir) GetFile(ctx context.Context, dirent *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	flags.Pread = true
+	return fs.NewFile(ctx, dirent, flags, &dirFileOperations{dir: d}), nil
+}
+
+// dirFileOperations implements fs.FileOperations for a Dir.
+//
+// +stateify savable
+type dirFileOperations struct {
+	fsutil.DirFileOperations `state:"nosave"`
+
+	// dirCursor contains the name of the last directory entry that was
+	// serialized.
+	dirCursor string
+
+	// dir is the Dir that this file corresponds to.
+	dir *Dir
+}
+
+var _ fs.FileOperations = (*dirFileOperations)(nil)
+
+// Seek implements fs.FileOperations.Seek.
+func (dfo *dirFileOperations) Seek(ctx context.Context, file *fs.File, whence fs.SeekWhence, offset int64) (int64, error) {
+	return fsutil.SeekWithDirCursor(ctx, file, whence, offset, &dfo.dirCursor)
+}
+
+// IterateDir implements fs.DirIterator.IterateDir.
+func (dfo *dirFileOperations) IterateDir(ctx context.Context, dirCtx *fs.DirCtx, offset int) (int, error) {
+	_, entries := dfo.dir.Children()
+	if dfo.dir.src != nil {
+		for name, attr := range dfo.dir.src.Children(ctx) {
+			if _, ok := entries[name]; !ok {
+				entries[name] = attr
+			}
+		}
+	}
+	n, err := fs.GenericReaddir(dirCtx, fs.NewSortedDentryMap(entries))
+	return offset + n, err
+}
+
+// Readdir implements fs.FileOperations.Readdir.
+func (dfo *dirFileOperations) Readdir(ctx context.Context, file *fs.File, serializer fs.DentrySerializer) (int64, error) {
+	root := fs.RootFromContext(ctx)
+	defer root.DecRef()
+	dirCtx := &fs.DirCtx{
+		Serializer: serializer,
+		DirCursor:  &dfo.dirCursor,
+	}
+	dfo.dir.NotifyAccess(ctx)
+	return fs.DirentReaddir(ctx, file.Dirent, dfo, root, dirCtx, file.Offset())
+}
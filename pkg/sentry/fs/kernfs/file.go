@@ -0,0 +1,187 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernfs
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/fsutil"
+	ktime "gvisor.googlesource.com/gvisor/pkg/sentry/kernel/time"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+// StaticFile implements fs.InodeOperations for a read-only file whose contents
+// never change.
+//
+// +stateify savable
+type StaticFile struct {
+	fsutil.InodeGenericChecker       `state:"nosave"`
+	fsutil.InodeNoExtendedAttributes `state:"nosave"`
+	fsutil.InodeNoopRelease          `state:"nosave"`
+	fsutil.InodeNoopTruncate         `state:"nosave"`
+	fsutil.InodeNoopWriteOut         `state:"nosave"`
+	fsutil.InodeNotDirectory         `state:"nosave"`
+	fsutil.InodeNotMappable          `state:"nosave"`
+	fsutil.InodeNotSocket            `state:"nosave"`
+	fsutil.InodeNotSymlink           `state:"nosave"`
+	fsutil.InodeVirtual              `state:"nosave"`
+
+	fsutil.InodeSimpleAttributes
+	fsutil.InodeStaticFileGetter
+}
+
+var _ fs.InodeOperations = (*StaticFile)(nil)
+
+func newStaticFile(ctx context.Context, magic uint64, contents []byte) *StaticFile {
+	return &StaticFile{
+		InodeSimpleAttributes: fsutil.NewInodeSimpleAttributes(ctx, fs.RootOwner, fs.FilePermsFromMode(0444), magic),
+		InodeStaticFileGetter: fsutil.InodeStaticFileGetter{
+			Contents: contents,
+		},
+	}
+}
+
+// A Generator produces the contents of a generated file.
+type Generator interface {
+	// Generate writes the contents of the file to buf.
+	Generate(ctx context.Context, buf *bytes.Buffer) error
+}
+
+// A WritableGenerator is a Generator for a file that can also be written.
+type WritableGenerator interface {
+	Generator
+
+	// Write handles a write of src to the file at offset.
+	Write(ctx context.Context, src usermem.IOSequence, offset int64) (int64, error)
+}
+
+// GeneratedFile implements fs.InodeOperations for a file whose contents are
+// produced by a Generator.
+//
+// Each open file description holds a snapshot of the contents, which is taken
+// on the first read and retaken by every read at offset 0, so that a reader
+// sees consistent contents while reading sequentially.
+//
+// +stateify savable
+type GeneratedFile struct {
+	fsutil.InodeGenericChecker       `state:"nosave"`
+	fsutil.InodeNoExtendedAttributes `state:"nosave"`
+	fsutil.InodeNoopRelease          `state:"nosave"`
+	fsutil.InodeNoopTruncate         `state:"nosave"`
+	fsutil.InodeNoopWriteOut         `state:"nosave"`
+	fsutil.InodeNotDirectory         `state:"nosave"`
+	fsutil.InodeNotMappable          `state:"nosave"`
+	fsutil.InodeNotSocket            `state:"nosave"`
+	fsutil.InodeNotSymlink           `state:"nosave"`
+	fsutil.InodeVirtual              `state:"nosave"`
+
+	fsutil.InodeSimpleAttributes
+
+	// gen produces the contents of the file. gen is immutable.
+	gen Generator
+}
+
+var _ fs.InodeOperations = (*GeneratedFile)(nil)
+
+func newGeneratedFile(ctx context.Context, magic uint64, gen Generator) *GeneratedFile {
+	perms := fs.FilePermsFromMode(0444)
+	if _, ok := gen.(WritableGenerator); ok {
+		perms = fs.FilePermsFromMode(0644)
+	}
+	return &GeneratedFile{
+		InodeSimpleAttributes: fsutil.NewInodeSimpleAttributes(ctx, fs.RootOwner, perms, magic),
+		gen:                   gen,
+	}
+}
+
+// UnstableAttr implements fs.InodeOperations.UnstableAttr.
+func (g *GeneratedFile) UnstableAttr(ctx context.Context, inode *fs.Inode) (fs.UnstableAttr, error) {
+	uattr, err := g.InodeSimpleAttributes.UnstableAttr(ctx, inode)
+	if err != nil {
+		return fs.UnstableAttr{}, err
+	}
+	// The contents may change at any time.
+	uattr.ModificationTime = ktime.NowFromContext(ctx)
+	return uattr, nil
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (g *GeneratedFile) GetFile(ctx context.Context, dirent *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	return fs.NewFile(ctx, dirent, flags, &generatedFileOperations{gen: g.gen}), nil
+}
+
+// generatedFileOperations implements fs.FileOperations for a GeneratedFile.
+//
+// +stateify savable
+type generatedFileOperations struct {
+	waiter.AlwaysReady       `state:"nosave"`
+	fsutil.FileGenericSeek   `state:"nosave"`
+	fsutil.FileNoIoctl       `state:"nosave"`
+	fsutil.FileNoMMap        `state:"nosave"`
+	fsutil.FileNoopFlush     `state:"nosave"`
+	fsutil.FileNoopFsync     `state:"nosave"`
+	fsutil.FileNoopRelease   `state:"nosave"`
+	fsutil.FileNotDirReaddir `state:"nosave"`
+
+	// gen produces the contents of the file. gen is immutable.
+	gen Generator
+
+	// mu protects the fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// generated is true if data holds a snapshot of the contents.
+	generated bool
+
+	// data is the last snapshot of the contents.
+	data []byte
+}
+
+var _ fs.FileOperations = (*generatedFileOperations)(nil)
+
+// Read implements fs.FileOperations.Read.
+func (g *generatedFileOperations) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if offset == 0 || !g.generated {
+		var buf bytes.Buffer
+		if err := g.gen.Generate(ctx, &buf); err != nil {
+			return 0, err
+		}
+		g.data = buf.Bytes()
+		g.generated = true
+	}
+
+	if offset >= int64(len(g.data)) {
+		return 0, io.EOF
+	}
+	n, err := dst.CopyOut(ctx, g.data[offset:])
+	return int64(n), err
+}
+
+// Write implements fs.FileOperations.Write.
+func (g *generatedFileOperations) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+	w, ok := g.gen.(WritableGenerator)
+	if !ok {
+		return 0, syserror.EACCES
+	}
+	return w.Write(ctx, src, offset)
+}
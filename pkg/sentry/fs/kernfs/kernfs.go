@@ -0,0 +1,135 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kernfs provides the building blocks of synthetic filesystems whose
+// contents are generated by the kernel, such as procfs and sysfs.
+//
+// A Filesystem creates inodes of the following kinds:
+//
+// * Static files, whose contents never change.
+//
+// * Generated files, whose contents are produced by a Generator when the file
+// is read, in the manner of Linux's seq_file single_open.
+//
+// * Directories, which have a fixed set of children and, optionally, children
+// that are looked up and listed dynamically by a DirSource. Dynamic children
+// may be cached between lookups if the DirSource can revalidate them.
+//
+// * Symlinks.
+package kernfs
+
+import (
+	"fmt"
+	"sync"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/device"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/ramfs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+)
+
+// Filesystem holds the properties shared by all inodes of a synthetic
+// filesystem.
+//
+// Filesystems should be created during package initialization, since they are
+// identified by name across save/restore.
+//
+// +stateify savable
+type Filesystem struct {
+	// name is the unique name of the Filesystem. name is immutable.
+	name string
+
+	// magic is the filesystem type reported by statfs(2). magic is
+	// immutable.
+	magic uint64
+
+	// device is the device of the Filesystem's inodes. It is not saved,
+	// since it is shared with the rest of the sentry; it is found again by
+	// name after restore.
+	device *device.Device `state:"nosave"`
+}
+
+var (
+	// devicesMu protects devices.
+	devicesMu sync.Mutex
+
+	// devices maps Filesystem names to their devices.
+	devices = make(map[string]*device.Device)
+)
+
+// NewFilesystem returns a new Filesystem whose inodes are on dev and have type
+// magic. name must be unique.
+func NewFilesystem(name string, magic uint64, dev *device.Device) *Filesystem {
+	devicesMu.Lock()
+	defer devicesMu.Unlock()
+	if _, ok := devices[name]; ok {
+		panic(fmt.Sprintf("kernfs filesystem %q created twice", name))
+	}
+	devices[name] = dev
+	return &Filesystem{
+		name:   name,
+		magic:  magic,
+		device: dev,
+	}
+}
+
+// Device returns the device of f's inodes.
+func (f *Filesystem) Device() *device.Device {
+	return f.device
+}
+
+// Magic returns the filesystem type of f's inodes.
+func (f *Filesystem) Magic() uint64 {
+	return f.magic
+}
+
+// NewInode returns a new Inode in msrc with the given InodeOperations and
+// type.
+func (f *Filesystem) NewInode(iops fs.InodeOperations, msrc *fs.MountSource, typ fs.InodeType) *fs.Inode {
+	return fs.NewInode(iops, msrc, fs.StableAttr{
+		DeviceID:  f.device.DeviceID(),
+		InodeID:   f.device.NextIno(),
+		BlockSize: usermem.PageSize,
+		Type:      typ,
+	})
+}
+
+// NewStaticFile returns a new read-only file with the given contents.
+func (f *Filesystem) NewStaticFile(ctx context.Context, msrc *fs.MountSource, contents []byte) *fs.Inode {
+	return f.NewInode(newStaticFile(ctx, f.magic, contents), msrc, fs.SpecialFile)
+}
+
+// NewGeneratedFile returns a new file whose contents are produced by gen. If
+// gen is a WritableGenerator, the file is writable by its owner.
+func (f *Filesystem) NewGeneratedFile(ctx context.Context, msrc *fs.MountSource, gen Generator) *fs.Inode {
+	return f.NewInode(newGeneratedFile(ctx, f.magic, gen), msrc, fs.SpecialFile)
+}
+
+// NewDir returns a new directory with the given children.
+func (f *Filesystem) NewDir(ctx context.Context, msrc *fs.MountSource, contents map[string]*fs.Inode) *fs.Inode {
+	return f.NewDynamicDir(ctx, msrc, contents, nil)
+}
+
+// NewDynamicDir returns a new directory with the given children, and the
+// dynamic children provided by src. Children in contents hide dynamic children
+// with the same name.
+func (f *Filesystem) NewDynamicDir(ctx context.Context, msrc *fs.MountSource, contents map[string]*fs.Inode, src DirSource) *fs.Inode {
+	return f.NewInode(newDir(ctx, f, contents, src), msrc, fs.SpecialDirectory)
+}
+
+// NewSymlink returns a new symlink to target.
+func (f *Filesystem) NewSymlink(ctx context.Context, msrc *fs.MountSource, target string) *fs.Inode {
+	return f.NewInode(ramfs.NewSymlink(ctx, fs.RootOwner, target), msrc, fs.Symlink)
+}
@@ -0,0 +1,30 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernfs
+
+import (
+	"fmt"
+)
+
+// afterLoad is invoked by stateify.
+func (f *Filesystem) afterLoad() {
+	devicesMu.Lock()
+	defer devicesMu.Unlock()
+	dev, ok := devices[f.name]
+	if !ok {
+		panic(fmt.Sprintf("kernfs filesystem %q not found after restore", f.name))
+	}
+	f.device = dev
+}
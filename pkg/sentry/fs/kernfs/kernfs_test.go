@@ -0,0 +1,171 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernfs
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context/contexttest"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/device"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+var testFS = NewFilesystem("test", 0x1234, device.NewAnonDevice())
+
+// counter generates its generation number, which increases each time it is
+// generated.
+type counter struct {
+	gen int
+}
+
+func (c *counter) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	c.gen++
+	fmt.Fprintf(buf, "gen %d\n", c.gen)
+	return nil
+}
+
+func readAt(t *testing.T, ctx context.Context, file *fs.File, n int, offset int64) string {
+	buf := make([]byte, n)
+	read, err := file.FileOperations.Read(ctx, file, usermem.BytesIOSequence(buf), offset)
+	if err != nil {
+		t.Fatalf("Read(%d bytes at %d) failed: %v", n, offset, err)
+	}
+	return string(buf[:read])
+}
+
+func TestGeneratedFileSnapshot(t *testing.T) {
+	ctx := contexttest.Context(t)
+	inode := testFS.NewGeneratedFile(ctx, fs.NewPseudoMountSource(), &counter{})
+	dirent := fs.NewDirent(inode, "counter")
+	defer dirent.DecRef()
+	file, err := inode.GetFile(ctx, dirent, fs.FileFlags{Read: true})
+	if err != nil {
+		t.Fatalf("GetFile failed: %v", err)
+	}
+	defer file.DecRef()
+
+	// A sequential read sees a single snapshot.
+	if got, want := readAt(t, ctx, file, 4, 0), "gen "; got != want {
+		t.Errorf("first read got %q, want %q", got, want)
+	}
+	if got, want := readAt(t, ctx, file, 10, 4), "1\n"; got != want {
+		t.Errorf("second read got %q, want %q", got, want)
+	}
+
+	// Reading from the beginning takes a new snapshot.
+	if got, want := readAt(t, ctx, file, 10, 0), "gen 2\n"; got != want {
+		t.Errorf("reread got %q, want %q", got, want)
+	}
+}
+
+// source provides dynamic children named by valid, which are files containing
+// their names.
+type source struct {
+	lookups int
+	valid   map[string]bool
+}
+
+func (s *source) Lookup(ctx context.Context, dir *fs.Inode, name string) (*fs.Inode, error) {
+	if !s.valid[name] {
+		return nil, syserror.ENOENT
+	}
+	s.lookups++
+	return testFS.NewStaticFile(ctx, dir.MountSource, []byte(name)), nil
+}
+
+func (s *source) Children(ctx context.Context) map[string]fs.DentAttr {
+	m := make(map[string]fs.DentAttr)
+	for name := range s.valid {
+		m[name] = fs.GenericDentAttr(fs.SpecialFile, testFS.Device())
+	}
+	return m
+}
+
+func (s *source) Revalidate(ctx context.Context, name string, child *fs.Inode) bool {
+	return s.valid[name]
+}
+
+func TestDirLookupCache(t *testing.T) {
+	ctx := contexttest.Context(t)
+	src := &source{valid: map[string]bool{"a": true}}
+	dir := testFS.NewDynamicDir(ctx, fs.NewPseudoMountSource(), map[string]*fs.Inode{
+		"static": testFS.NewStaticFile(ctx, fs.NewPseudoMountSource(), nil),
+	}, src)
+	defer dir.DecRef()
+
+	lookup := func(name string) (*fs.Inode, error) {
+		d, err := dir.InodeOperations.Lookup(ctx, dir, name)
+		if err != nil {
+			return nil, err
+		}
+		defer d.DecRef()
+		return d.Inode, nil
+	}
+
+	if _, err := lookup("static"); err != nil {
+		t.Fatalf("Lookup(static) failed: %v", err)
+	}
+	if src.lookups != 0 {
+		t.Errorf("Lookup(static) consulted the source")
+	}
+
+	first, err := lookup("a")
+	if err != nil {
+		t.Fatalf("Lookup(a) failed: %v", err)
+	}
+	second, err := lookup("a")
+	if err != nil {
+		t.Fatalf("second Lookup(a) failed: %v", err)
+	}
+	if first != second || src.lookups != 1 {
+		t.Errorf("second Lookup(a) wasn't cached: got %d lookups", src.lookups)
+	}
+
+	// Once the child is invalid, it is no longer returned.
+	src.valid["a"] = false
+	if _, err := lookup("a"); err != syserror.ENOENT {
+		t.Errorf("Lookup(a) of invalid child got error %v, want %v", err, syserror.ENOENT)
+	}
+	src.valid["a"] = true
+	third, err := lookup("a")
+	if err != nil {
+		t.Fatalf("third Lookup(a) failed: %v", err)
+	}
+	if third == first || src.lookups != 2 {
+		t.Errorf("Lookup(a) after revalidation failure returned cached child")
+	}
+
+	if _, err := lookup("b"); err != syserror.ENOENT {
+		t.Errorf("Lookup(b) got error %v, want %v", err, syserror.ENOENT)
+	}
+}
+
+func TestDirStatFS(t *testing.T) {
+	ctx := contexttest.Context(t)
+	dir := testFS.NewDir(ctx, fs.NewPseudoMountSource(), nil)
+	defer dir.DecRef()
+	info, err := dir.StatFS(ctx)
+	if err != nil {
+		t.Fatalf("StatFS failed: %v", err)
+	}
+	if info.Type != testFS.Magic() {
+		t.Errorf("StatFS got type %#x, want %#x", info.Type, testFS.Magic())
+	}
+}
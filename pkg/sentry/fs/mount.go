@@ -149,6 +149,16 @@ type MountSource struct {
 
 	// children are the child MountSources of this MountSource.
 	children map[*MountSource]struct{}
+
+	// handlesMu protects the fields below.
+	handlesMu sync.Mutex `state:"nosave"`
+
+	// handles maps InodeIDs to files that have been encoded as file
+	// handles, see EncodeFileHandle.
+	handles map[uint64]*fileHandleEntry
+
+	// handleGen is the generation of the last file handle created.
+	handleGen uint32
 }
 
 // defaultDirentCacheSize is the number of Dirents that the VFS can hold an extra
@@ -233,6 +243,7 @@ func (msrc *MountSource) destroy() {
 	if c := msrc.DirentRefs(); c != 0 {
 		panic(fmt.Sprintf("MountSource with non-zero direntRefs is being destroyed: %d", c))
 	}
+	msrc.dropFileHandles()
 	msrc.MountSourceOperations.Destroy()
 }
 
@@ -111,6 +111,9 @@ func (ofs *overlayFilesystem) Flags() FilesystemFlags {
 	return 0
 }
 
+// Exportable implements ExportableFilesystem.Exportable.
+func (*overlayFilesystem) Exportable() {}
+
 // AllowUserMount implements Filesystem.AllowUserMount.
 func (ofs *overlayFilesystem) AllowUserMount() bool {
 	return false
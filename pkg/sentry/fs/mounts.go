@@ -338,6 +338,34 @@ func (mns *MountNamespace) Unmount(ctx context.Context, node *Dirent, detachOnly
 	})
 }
 
+// ResolveFlags restrict path resolution, as for openat2(2)'s resolve flags.
+// The zero value imposes no restrictions.
+type ResolveFlags struct {
+	// NoXDev disallows crossing mount points, including by following
+	// symlinks.
+	NoXDev bool
+
+	// NoMagicLinks disallows following magic links, such as
+	// /proc/[pid]/fd/*, which are resolved by Inode.Getlink.
+	NoMagicLinks bool
+
+	// NoSymlinks disallows following any symlink, including magic links.
+	NoSymlinks bool
+
+	// Beneath disallows resolution from escaping the root, by absolute
+	// paths, ".." or symlinks.
+	Beneath bool
+
+	// InRoot resolves absolute paths and ".." as if the root were the
+	// filesystem root. Resolution can't escape the root, as for chroot(2).
+	InRoot bool
+}
+
+// scoped returns true if resolution may not leave the root.
+func (f ResolveFlags) scoped() bool {
+	return f.Beneath || f.InRoot
+}
+
 // FindLink returns an Dirent from a given node, which may be a symlink.
 //
 // The root argument is treated as the root directory, and FindLink will not
@@ -351,6 +379,15 @@ func (mns *MountNamespace) Unmount(ctx context.Context, node *Dirent, detachOnly
 // Precondition: root must be non-nil.
 // Precondition: the path must be non-empty.
 func (mns *MountNamespace) FindLink(ctx context.Context, root, wd *Dirent, path string, remainingTraversals *uint) (*Dirent, error) {
+	return mns.FindLinkWithFlags(ctx, root, wd, path, remainingTraversals, ResolveFlags{})
+}
+
+// FindLinkWithFlags is identical to FindLink, except that resolution is
+// restricted by flags.
+//
+// If flags.Beneath or flags.InRoot is set, root should be the directory that
+// resolution is confined to.
+func (mns *MountNamespace) FindLinkWithFlags(ctx context.Context, root, wd *Dirent, path string, remainingTraversals *uint, flags ResolveFlags) (*Dirent, error) {
 	if root == nil {
 		panic("MountNamespace.FindLink: root must not be nil")
 	}
@@ -367,6 +404,15 @@ func (mns *MountNamespace) FindLink(ctx context.Context, root, wd *Dirent, path
 		current = root
 	}
 	for first == "/" {
+		// Absolute paths escape the root with Beneath, and may cross a
+		// mount with NoXDev.
+		if flags.Beneath {
+			return nil, syscall.EXDEV
+		}
+		if flags.NoXDev && root.Inode.MountSource != current.Inode.MountSource {
+			return nil, syscall.EXDEV
+		}
+
 		// Special case: it's possible that we have nothing to walk at
 		// all. This is necessary since we're resplitting the path.
 		if remainder == "" {
@@ -399,6 +445,10 @@ func (mns *MountNamespace) FindLink(ctx context.Context, root, wd *Dirent, path
 				current.DecRef() // Drop reference from above.
 				return nil, err
 			}
+		} else if first == ".." && flags.Beneath {
+			// ".." would escape the root.
+			current.DecRef() // Drop reference from above.
+			return nil, syscall.EXDEV
 		}
 
 		// Move to the next level.
@@ -411,6 +461,12 @@ func (mns *MountNamespace) FindLink(ctx context.Context, root, wd *Dirent, path
 			return nil, err
 		}
 
+		if flags.NoXDev && next.Inode.MountSource != current.Inode.MountSource {
+			next.DecRef()
+			current.DecRef()
+			return nil, syscall.EXDEV
+		}
+
 		// Drop old reference.
 		current.DecRef()
 
@@ -419,7 +475,7 @@ func (mns *MountNamespace) FindLink(ctx context.Context, root, wd *Dirent, path
 			//
 			// See resolve for reference semantics; on err next
 			// will have one dropped.
-			current, err = mns.resolve(ctx, root, next, remainingTraversals)
+			current, err = mns.resolve(ctx, root, next, remainingTraversals, flags)
 			if err != nil {
 				return nil, err
 			}
@@ -440,14 +496,20 @@ func (mns *MountNamespace) FindLink(ctx context.Context, root, wd *Dirent, path
 //
 //go:nosplit
 func (mns *MountNamespace) FindInode(ctx context.Context, root, wd *Dirent, path string, remainingTraversals *uint) (*Dirent, error) {
-	d, err := mns.FindLink(ctx, root, wd, path, remainingTraversals)
+	return mns.FindInodeWithFlags(ctx, root, wd, path, remainingTraversals, ResolveFlags{})
+}
+
+// FindInodeWithFlags is identical to FindLinkWithFlags except the return value
+// is resolved.
+func (mns *MountNamespace) FindInodeWithFlags(ctx context.Context, root, wd *Dirent, path string, remainingTraversals *uint, flags ResolveFlags) (*Dirent, error) {
+	d, err := mns.FindLinkWithFlags(ctx, root, wd, path, remainingTraversals, flags)
 	if err != nil {
 		return nil, err
 	}
 
 	// See resolve for reference semantics; on err d will have the
 	// reference dropped.
-	return mns.resolve(ctx, root, d, remainingTraversals)
+	return mns.resolve(ctx, root, d, remainingTraversals, flags)
 }
 
 // resolve resolves the given link.
@@ -458,12 +520,29 @@ func (mns *MountNamespace) FindInode(ctx context.Context, root, wd *Dirent, path
 // If not successful, a reference is _also_ dropped on the node and an error
 // returned. This is for convenience in using resolve directly as a return
 // value.
-func (mns *MountNamespace) resolve(ctx context.Context, root, node *Dirent, remainingTraversals *uint) (*Dirent, error) {
+func (mns *MountNamespace) resolve(ctx context.Context, root, node *Dirent, remainingTraversals *uint, flags ResolveFlags) (*Dirent, error) {
 	// Resolve the path.
 	target, err := node.Inode.Getlink(ctx)
 
 	switch err {
 	case nil:
+		// This is a magic link, which jumps directly to target.
+		var restricted error
+		switch {
+		case flags.NoSymlinks || flags.NoMagicLinks:
+			restricted = syscall.ELOOP
+		case flags.scoped():
+			// The target may be anywhere.
+			restricted = syscall.EXDEV
+		case flags.NoXDev && target.Inode.MountSource != node.Inode.MountSource:
+			restricted = syscall.EXDEV
+		}
+		if restricted != nil {
+			target.DecRef()
+			node.DecRef()
+			return nil, restricted
+		}
+
 		// Make sure we didn't exhaust the traversal budget.
 		if *remainingTraversals == 0 {
 			target.DecRef()
@@ -480,6 +559,10 @@ func (mns *MountNamespace) resolve(ctx context.Context, root, node *Dirent, rema
 	case ErrResolveViaReadlink:
 		defer node.DecRef() // See above.
 
+		if flags.NoSymlinks {
+			return nil, syscall.ELOOP
+		}
+
 		// First, check if we should traverse.
 		if *remainingTraversals == 0 {
 			return nil, syscall.ELOOP
@@ -493,7 +576,7 @@ func (mns *MountNamespace) resolve(ctx context.Context, root, node *Dirent, rema
 
 		// Find the node; we resolve relative to the current symlink's parent.
 		*remainingTraversals--
-		d, err := mns.FindInode(ctx, root, node.parent, targetPath, remainingTraversals)
+		d, err := mns.FindInodeWithFlags(ctx, root, node.parent, targetPath, remainingTraversals, flags)
 		if err != nil {
 			return nil, err
 		}
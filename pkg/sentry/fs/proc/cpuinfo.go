@@ -29,7 +29,7 @@ func newCPUInfo(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
 	}
 	contents := make([]byte, 0, 1024)
 	for i, max := uint(0), k.ApplicationCores(); i < max; i++ {
-		contents = append(contents, []byte(features.CPUInfo(i))...)
+		contents = append(contents, []byte(features.CPUInfo(i, max))...)
 	}
 	return newStaticProcInode(ctx, msrc, contents)
 }
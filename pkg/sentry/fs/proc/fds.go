@@ -22,6 +22,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/fsutil"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/kernfs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/proc/device"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/ramfs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
@@ -237,7 +238,7 @@ func (f *fdDirFile) Readdir(ctx context.Context, file *fs.File, ser fs.DentrySer
 //
 // +stateify savable
 type fdInfoInode struct {
-	staticFileInodeOps
+	kernfs.StaticFile
 
 	file    *fs.File
 	flags   fs.FileFlags
@@ -276,12 +277,15 @@ func (fdid *fdInfoDir) Lookup(ctx context.Context, dir *fs.Inode, p string) (*fs
 		// TODO: Using a static inode here means that the
 		// data can be out-of-date if, for instance, the flags on the
 		// FD change before we read this file. We should switch to
-		// generating the data on Read(). Also, we should include pos,
-		// locks, and other data.  For now we only have flags.
+		// generating the data on Read(). Also, we should include
+		// mnt_id, locks, and other data.
 		// See https://www.kernel.org/doc/Documentation/filesystems/proc.txt
 		flags := file.Flags().ToLinux() | fdFlags.ToLinuxFileFlags()
-		contents := []byte(fmt.Sprintf("flags:\t0%o\n", flags))
-		return newStaticProcInode(ctx, dir.MountSource, contents)
+		contents := fmt.Sprintf("pos:\t%d\nflags:\t0%o\n", file.Offset(), flags)
+		if fi, ok := file.FileOperations.(fs.FdInfoer); ok {
+			contents += fi.FdInfo(ctx)
+		}
+		return newStaticProcInode(ctx, dir.MountSource, []byte(contents))
 	})
 	if err != nil {
 		return nil, err
@@ -18,12 +18,14 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
-	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/fsutil"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/kernfs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/proc/device"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
-	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
 )
 
+// procfs is the proc filesystem.
+var procfs = kernfs.NewFilesystem("proc", linux.PROC_SUPER_MAGIC, device.ProcDevice)
+
 // taskOwnedInodeOps wraps an fs.InodeOperations and overrides the UnstableAttr
 // method to return the task as the owner.
 //
@@ -47,50 +49,15 @@ func (i *taskOwnedInodeOps) UnstableAttr(ctx context.Context, inode *fs.Inode) (
 	return uattr, nil
 }
 
-// staticFileInodeOps is an InodeOperations implementation that can be used to
-// return file contents which are constant. This file is not writable and will
-// always have mode 0444.
-//
-// +stateify savable
-type staticFileInodeOps struct {
-	fsutil.InodeGenericChecker       `state:"nosave"`
-	fsutil.InodeNoExtendedAttributes `state:"nosave"`
-	fsutil.InodeNoopRelease          `state:"nosave"`
-	fsutil.InodeNoopTruncate         `state:"nosave"`
-	fsutil.InodeNoopWriteOut         `state:"nosave"`
-	fsutil.InodeNotDirectory         `state:"nosave"`
-	fsutil.InodeNotMappable          `state:"nosave"`
-	fsutil.InodeNotSocket            `state:"nosave"`
-	fsutil.InodeNotSymlink           `state:"nosave"`
-	fsutil.InodeVirtual              `state:"nosave"`
-
-	fsutil.InodeSimpleAttributes
-	fsutil.InodeStaticFileGetter
-}
-
-var _ fs.InodeOperations = (*staticFileInodeOps)(nil)
-
-// newStaticFileInode returns a procfs InodeOperations with static contents.
+// newStaticProcInode returns a procfs Inode with static contents.
 func newStaticProcInode(ctx context.Context, msrc *fs.MountSource, contents []byte) *fs.Inode {
-	iops := &staticFileInodeOps{
-		InodeSimpleAttributes: fsutil.NewInodeSimpleAttributes(ctx, fs.RootOwner, fs.FilePermsFromMode(0444), linux.PROC_SUPER_MAGIC),
-		InodeStaticFileGetter: fsutil.InodeStaticFileGetter{
-			Contents: contents,
-		},
-	}
-	return newProcInode(iops, msrc, fs.SpecialFile, nil)
+	return procfs.NewStaticFile(ctx, msrc, contents)
 }
 
 // newProcInode creates a new inode from the given inode operations.
 func newProcInode(iops fs.InodeOperations, msrc *fs.MountSource, typ fs.InodeType, t *kernel.Task) *fs.Inode {
-	sattr := fs.StableAttr{
-		DeviceID:  device.ProcDevice.DeviceID(),
-		InodeID:   device.ProcDevice.NextIno(),
-		BlockSize: usermem.PageSize,
-		Type:      typ,
-	}
 	if t != nil {
 		iops = &taskOwnedInodeOps{iops, t}
 	}
-	return fs.NewInode(iops, msrc, sattr)
+	return procfs.NewInode(iops, msrc, typ)
 }
@@ -17,6 +17,9 @@ package proc
 import (
 	"bytes"
 	"fmt"
+	"net"
+	"sort"
+	"strings"
 	"time"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
@@ -27,8 +30,13 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/ramfs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/inet"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/epsocket"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/unix"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/unix/transport"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
 )
 
 // newNet creates a new proc net entry.
@@ -54,18 +62,24 @@ func (p *proc) newNetDir(ctx context.Context, k *kernel.Kernel, msrc *fs.MountSo
 			"psched": newStaticProcInode(ctx, msrc, []byte(fmt.Sprintf("%08x %08x %08x %08x\n", uint64(time.Microsecond/time.Nanosecond), 64, 1000000, uint64(time.Second/time.Nanosecond)))),
 			"ptype":  newStaticProcInode(ctx, msrc, []byte("Type Device      Function")),
 			"route":  newStaticProcInode(ctx, msrc, []byte("Iface   Destination     Gateway         Flags   RefCnt  Use     Metric  Mask            MTU     Window  IRTT")),
-			"tcp":    newStaticProcInode(ctx, msrc, []byte("  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode")),
-
-			"udp": newStaticProcInode(ctx, msrc, []byte("  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops")),
+			"tcp":    seqfile.NewSeqFileInode(ctx, &netTCP{k: k, family: linux.AF_INET}, msrc),
+			"udp":    seqfile.NewSeqFileInode(ctx, &netUDP{k: k, family: linux.AF_INET}, msrc),
 
 			"unix": seqfile.NewSeqFileInode(ctx, &netUnix{k: k}, msrc),
+
+			"sockstat": seqfile.NewSeqFileInode(ctx, &netSockstat{k: k}, msrc),
+		}
+
+		if s.SupportsConnTrack() {
+			contents["nf_conntrack"] = seqfile.NewSeqFileInode(ctx, &netConnTrack{s: s}, msrc)
 		}
 
 		if s.SupportsIPv6() {
 			contents["if_inet6"] = seqfile.NewSeqFileInode(ctx, &ifinet6{s: s}, msrc)
 			contents["ipv6_route"] = newStaticProcInode(ctx, msrc, []byte(""))
-			contents["tcp6"] = newStaticProcInode(ctx, msrc, []byte("  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode"))
-			contents["udp6"] = newStaticProcInode(ctx, msrc, []byte("  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode"))
+			contents["tcp6"] = seqfile.NewSeqFileInode(ctx, &netTCP{k: k, family: linux.AF_INET6}, msrc)
+			contents["udp6"] = seqfile.NewSeqFileInode(ctx, &netUDP{k: k, family: linux.AF_INET6}, msrc)
+			contents["sockstat6"] = seqfile.NewSeqFileInode(ctx, &netSockstat{k: k, v6: true}, msrc)
 		}
 	}
 	d := ramfs.NewDir(ctx, contents, fs.RootOwner, fs.FilePermsFromMode(0555))
@@ -148,37 +162,37 @@ func (n *netDev) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]se
 	}
 
 	interfaces := n.s.Interfaces()
+	stats := n.s.InterfaceStatistics()
 	contents := make([]string, 2, 2+len(interfaces))
 	// Add the table header. From net/core/net-procfs.c:dev_seq_show.
 	contents[0] = "Inter-|   Receive                                                |  Transmit\n"
 	contents[1] = " face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed\n"
 
-	for _, i := range interfaces {
-		// TODO: Collect stats from each inet.Stack
-		// implementation (hostinet, epsocket, and rpcinet).
+	for idx, i := range interfaces {
+		st := stats[idx]
 
 		// Implements the same format as
 		// net/core/net-procfs.c:dev_seq_printf_stats.
 		l := fmt.Sprintf("%6s: %7d %7d %4d %4d %4d %5d %10d %9d %8d %7d %4d %4d %4d %5d %7d %10d\n",
 			i.Name,
 			// Received
-			0, // bytes
-			0, // packets
-			0, // errors
-			0, // dropped
-			0, // fifo
-			0, // frame
-			0, // compressed
-			0, // multicast
+			st.RxBytes,   // bytes
+			st.RxPackets, // packets
+			0,            // errors
+			0,            // dropped
+			0,            // fifo
+			0,            // frame
+			0,            // compressed
+			0,            // multicast
 			// Transmitted
-			0, // bytes
-			0, // packets
-			0, // errors
-			0, // dropped
-			0, // fifo
-			0, // frame
-			0, // compressed
-			0) // multicast
+			st.TxBytes,   // bytes
+			st.TxPackets, // packets
+			0,            // errors
+			st.TxDropped, // dropped
+			0,            // fifo
+			0,            // frame
+			0,            // compressed
+			0)            // multicast
 		contents = append(contents, l)
 	}
 
@@ -243,9 +257,11 @@ func (n *netUnix) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]s
 		var sockState int
 		switch sops.Endpoint().Type() {
 		case linux.SOCK_DGRAM:
-			sockState = linux.SS_CONNECTING
-			// Unlike Linux, we don't have unbound connection-less sockets,
-			// so no SS_DISCONNECTING.
+			if _, err := sops.Endpoint().GetRemoteAddress(); err == nil {
+				sockState = linux.SS_CONNECTED
+			} else {
+				sockState = linux.SS_UNCONNECTED
+			}
 
 		case linux.SOCK_SEQPACKET:
 			fallthrough
@@ -306,3 +322,429 @@ func (n *netUnix) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]s
 	}}
 	return data, 0
 }
+
+// netConnTrack implements seqfile.SeqSource for /proc/net/nf_conntrack.
+//
+// +stateify savable
+type netConnTrack struct {
+	s inet.Stack
+}
+
+// NeedsUpdate implements seqfile.SeqSource.NeedsUpdate.
+func (*netConnTrack) NeedsUpdate(generation int64) bool {
+	return true
+}
+
+// ReadSeqFileData implements seqfile.SeqSource.ReadSeqFileData. See Linux's
+// net/netfilter/nf_conntrack_standalone.c:ct_seq_show.
+func (n *netConnTrack) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
+	if h != nil {
+		return nil, 0
+	}
+
+	entries := n.s.ConnTrack()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+
+	var buf bytes.Buffer
+	for _, e := range entries {
+		l3Name := "ipv4"
+		if e.Original.Family == linux.AF_INET6 {
+			l3Name = "ipv6"
+		}
+		fmt.Fprintf(&buf, "%-8s %d %-8s %d %d ", l3Name, e.Original.Family, connTrackProtocolName(e.Original.Protocol), e.Original.Protocol, int64(e.Timeout/time.Second))
+		if e.Original.Protocol == linux.IPPROTO_TCP {
+			fmt.Fprintf(&buf, "%s ", connTrackTCPStateName(e.TCPState))
+		}
+		printConnTrackTuple(&buf, &e.Original, false /* reply */)
+		if !e.SeenReply {
+			buf.WriteString("[UNREPLIED] ")
+		}
+		printConnTrackTuple(&buf, &e.Reply, true /* reply */)
+		if e.Assured {
+			buf.WriteString("[ASSURED] ")
+		}
+		buf.WriteString("mark=0 use=2\n")
+	}
+
+	return []seqfile.SeqData{{Buf: buf.Bytes(), Handle: (*netConnTrack)(nil)}}, 0
+}
+
+// printConnTrackTuple writes the tuple t to buf, as Linux's
+// net/netfilter/nf_conntrack_standalone.c:print_tuple. reply is whether t is
+// the tuple of the reply direction.
+func printConnTrackTuple(buf *bytes.Buffer, t *inet.ConnTrackTuple, reply bool) {
+	fmt.Fprintf(buf, "src=%s dst=%s ", connTrackAddr(t.Src), connTrackAddr(t.Dst))
+	switch t.Protocol {
+	case linux.IPPROTO_TCP, linux.IPPROTO_UDP:
+		fmt.Fprintf(buf, "sport=%d dport=%d ", t.SrcPort, t.DstPort)
+	case linux.IPPROTO_ICMP, linux.IPPROTO_ICMPV6:
+		// Only echo requests and their replies are tracked.
+		var typ int
+		switch {
+		case t.Protocol == linux.IPPROTO_ICMP && !reply:
+			typ = 8 // ICMP_ECHO
+		case t.Protocol == linux.IPPROTO_ICMP && reply:
+			typ = 0 // ICMP_ECHOREPLY
+		case !reply:
+			typ = 128 // ICMPV6_ECHO_REQUEST
+		default:
+			typ = 129 // ICMPV6_ECHO_REPLY
+		}
+		fmt.Fprintf(buf, "type=%d code=0 id=%d ", typ, t.SrcPort)
+	}
+}
+
+// connTrackAddr formats addr as Linux's %pI4 and %pI6 formats do, the latter
+// without zero compression.
+func connTrackAddr(addr []byte) string {
+	if len(addr) != 16 {
+		return net.IP(addr).String()
+	}
+	groups := make([]string, 8)
+	for i := range groups {
+		groups[i] = fmt.Sprintf("%02x%02x", addr[2*i], addr[2*i+1])
+	}
+	return strings.Join(groups, ":")
+}
+
+// connTrackProtocolName returns the name of the transport protocol proto, as
+// shown by Linux.
+func connTrackProtocolName(proto uint8) string {
+	switch proto {
+	case linux.IPPROTO_TCP:
+		return "tcp"
+	case linux.IPPROTO_UDP:
+		return "udp"
+	case linux.IPPROTO_ICMP:
+		return "icmp"
+	case linux.IPPROTO_ICMPV6:
+		return "icmpv6"
+	default:
+		return "unknown"
+	}
+}
+
+// connTrackTCPStateName returns the name of the TCP_CONNTRACK_* state, as
+// shown by Linux.
+func connTrackTCPStateName(state uint8) string {
+	names := [...]string{
+		linux.TCP_CONNTRACK_NONE:        "NONE",
+		linux.TCP_CONNTRACK_SYN_SENT:    "SYN_SENT",
+		linux.TCP_CONNTRACK_SYN_RECV:    "SYN_RECV",
+		linux.TCP_CONNTRACK_ESTABLISHED: "ESTABLISHED",
+		linux.TCP_CONNTRACK_FIN_WAIT:    "FIN_WAIT",
+		linux.TCP_CONNTRACK_CLOSE_WAIT:  "CLOSE_WAIT",
+		linux.TCP_CONNTRACK_LAST_ACK:    "LAST_ACK",
+		linux.TCP_CONNTRACK_TIME_WAIT:   "TIME_WAIT",
+		linux.TCP_CONNTRACK_CLOSE:       "CLOSE",
+	}
+	if int(state) < len(names) {
+		return names[state]
+	}
+	return "UNKNOWN"
+}
+
+// sockUsage is the number of sockets of a protocol and the memory used by
+// their buffers, in bytes.
+type sockUsage struct {
+	inuse int
+	mem   int
+}
+
+// pages returns the memory used in pages, as /proc/net/sockstat reports it.
+func (u *sockUsage) pages() int {
+	return (u.mem + usermem.PageSize - 1) / usermem.PageSize
+}
+
+// netSockstat implements seqfile.SeqSource for /proc/net/sockstat and
+// /proc/net/sockstat6.
+//
+// +stateify savable
+type netSockstat struct {
+	k *kernel.Kernel
+
+	// v6 is set for /proc/net/sockstat6, which reports IPv6 sockets
+	// instead of IPv4 ones.
+	v6 bool
+}
+
+// NeedsUpdate implements seqfile.SeqSource.NeedsUpdate.
+func (*netSockstat) NeedsUpdate(generation int64) bool {
+	return true
+}
+
+// usage returns the usage of the TCP, UDP and raw netstack sockets of the
+// given family.
+func (n *netSockstat) usage(family int) (tcp, udp, raw sockUsage) {
+	forEachEpsocket(n.k, family, func(_ *fs.File, sops *epsocket.SocketOperations) {
+		var u *sockUsage
+		switch _, skType, protocol := sops.Type(); {
+		case skType == linux.SOCK_RAW:
+			u = &raw
+		case protocol == header.TCPProtocolNumber:
+			u = &tcp
+		case protocol == header.UDPProtocolNumber:
+			u = &udp
+		}
+		if u != nil {
+			var mi tcpip.MemInfoOption
+			if err := sops.Endpoint.GetSockOpt(&mi); err == nil {
+				u.mem += mi.RcvQueued + mi.SndQueued
+			}
+			u.inuse++
+		}
+	})
+	return tcp, udp, raw
+}
+
+// ReadSeqFileData implements seqfile.SeqSource.ReadSeqFileData. See Linux's
+// net/ipv4/proc.c:sockstat_seq_show and net/ipv6/proc.c:sockstat6_seq_show.
+func (n *netSockstat) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
+	if h != nil {
+		return nil, 0
+	}
+
+	var buf bytes.Buffer
+	if n.v6 {
+		tcp, udp, raw := n.usage(linux.AF_INET6)
+		fmt.Fprintf(&buf, "TCP6: inuse %d\n", tcp.inuse)
+		fmt.Fprintf(&buf, "UDP6: inuse %d\n", udp.inuse)
+		fmt.Fprintf(&buf, "UDPLITE6: inuse 0\n")
+		fmt.Fprintf(&buf, "RAW6: inuse %d\n", raw.inuse)
+		fmt.Fprintf(&buf, "FRAG6: inuse 0 memory 0\n")
+	} else {
+		// Unlike Linux, where the memory of both families is reported
+		// here, only the memory of IPv4 sockets is reported.
+		tcp, udp, raw := n.usage(linux.AF_INET)
+
+		// Closed sockets are released immediately, so there are
+		// never orphaned or TIME_WAIT sockets.
+		fmt.Fprintf(&buf, "sockets: used %d\n", n.k.SocketCount())
+		fmt.Fprintf(&buf, "TCP: inuse %d orphan 0 tw 0 alloc %d mem %d\n", tcp.inuse, tcp.inuse, tcp.pages())
+		fmt.Fprintf(&buf, "UDP: inuse %d mem %d\n", udp.inuse, udp.pages())
+		fmt.Fprintf(&buf, "UDPLITE: inuse 0\n")
+		fmt.Fprintf(&buf, "RAW: inuse %d\n", raw.inuse)
+		fmt.Fprintf(&buf, "FRAG: inuse 0 memory 0\n")
+	}
+
+	return []seqfile.SeqData{{Buf: buf.Bytes(), Handle: (*netSockstat)(nil)}}, 0
+}
+
+// forEachEpsocket calls fn for each netstack socket of the given family, in
+// the order of their inode numbers. Sockets of other stacks are skipped.
+func forEachEpsocket(k *kernel.Kernel, family int, fn func(sfile *fs.File, sops *epsocket.SocketOperations)) {
+	var files []*fs.File
+	for _, sref := range k.ListSockets(family) {
+		s := sref.Get()
+		if s == nil {
+			log.Debugf("Couldn't resolve weakref %v in socket table, racing with destruction?", sref)
+			continue
+		}
+		sfile := s.(*fs.File)
+		if _, ok := sfile.FileOperations.(*epsocket.SocketOperations); !ok {
+			sfile.DecRef()
+			continue
+		}
+		files = append(files, sfile)
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].InodeID() < files[j].InodeID() })
+	for _, sfile := range files {
+		fn(sfile, sfile.FileOperations.(*epsocket.SocketOperations))
+		sfile.DecRef()
+	}
+}
+
+// inetAddr formats addr as in /proc/net/tcp for IPv4 sockets, or as in
+// /proc/net/tcp6 for IPv6 sockets: each 32-bit word of the address in host
+// byte order, followed by the port.
+func inetAddr(family int, addr tcpip.FullAddress) string {
+	a := []byte(addr.Addr)
+	if family == linux.AF_INET6 && len(a) == header.IPv4AddressSize {
+		// IPv4 addresses of IPv6 sockets are shown v4-mapped.
+		a = append([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff}, a...)
+	}
+	size := header.IPv4AddressSize
+	if family == linux.AF_INET6 {
+		size = header.IPv6AddressSize
+	}
+	if len(a) != size {
+		// Unspecified address.
+		a = make([]byte, size)
+	}
+
+	var buf bytes.Buffer
+	for i := 0; i < len(a); i += 4 {
+		fmt.Fprintf(&buf, "%08X", usermem.ByteOrder.Uint32(a[i:]))
+	}
+	fmt.Fprintf(&buf, ":%04X", addr.Port)
+	return buf.String()
+}
+
+// sockUID returns the owner of the socket file, in the user namespace of ctx.
+func sockUID(ctx context.Context, sfile *fs.File) uint32 {
+	uattr, err := sfile.Dirent.Inode.UnstableAttr(ctx)
+	if err != nil {
+		return uint32(auth.OverflowUID)
+	}
+	return uint32(uattr.Owner.UID.In(auth.CredentialsFromContext(ctx).UserNamespace).OrOverflow())
+}
+
+// netTCP implements seqfile.SeqSource for /proc/net/tcp and /proc/net/tcp6.
+//
+// +stateify savable
+type netTCP struct {
+	k      *kernel.Kernel
+	family int
+}
+
+// NeedsUpdate implements seqfile.SeqSource.NeedsUpdate.
+func (*netTCP) NeedsUpdate(generation int64) bool {
+	return true
+}
+
+// ReadSeqFileData implements seqfile.SeqSource.ReadSeqFileData. See Linux's
+// net/ipv4/tcp_ipv4.c:tcp4_seq_show and net/ipv6/tcp_ipv6.c:tcp6_seq_show.
+func (n *netTCP) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
+	if h != nil {
+		return nil, 0
+	}
+
+	var buf bytes.Buffer
+	if n.family == linux.AF_INET {
+		// IPv4 lines are padded to a fixed width.
+		fmt.Fprintf(&buf, "%-149s\n", "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode")
+	} else {
+		fmt.Fprintf(&buf, "  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n")
+	}
+
+	sl := 0
+	forEachEpsocket(n.k, n.family, func(sfile *fs.File, sops *epsocket.SocketOperations) {
+		if _, skType, protocol := sops.Type(); skType != linux.SOCK_STREAM || protocol != header.TCPProtocolNumber {
+			return
+		}
+		ep := sops.Endpoint
+
+		var info tcpip.TCPInfoOption
+		if err := ep.GetSockOpt(&info); err != nil {
+			return
+		}
+		local, _ := ep.GetLocalAddress()
+		remote, _ := ep.GetRemoteAddress()
+
+		// Listening sockets report no queue sizes.
+		var txQueue tcpip.SendQueueSizeOption
+		var rxQueue tcpip.ReceiveQueueSizeOption
+		ep.GetSockOpt(&txQueue)
+		ep.GetSockOpt(&rxQueue)
+
+		ssthresh := info.SndSsthresh
+		if ssthresh >= 0xffff {
+			// The initial slow start threshold is shown as -1.
+			ssthresh = -1
+		}
+
+		line := fmt.Sprintf("%4d: %s %s %02X %08X:%08X %02X:%08X %08X %5d %8d %d %d %#016p %d %d %d %d %d",
+			sl,
+			inetAddr(n.family, local),          // local_address
+			inetAddr(n.family, remote),         // rem_address
+			info.State,                         // st
+			txQueue,                            // tx_queue
+			rxQueue,                            // rx_queue
+			0,                                  // tr, timers aren't reported.
+			0,                                  // tm->when
+			info.Timeouts,                      // retrnsmt
+			sockUID(ctx, sfile),                // uid
+			0,                                  // timeout, zero window probes.
+			sfile.InodeID(),                    // inode
+			sfile.ReadRefs()-1,                 // refcount, don't count our own ref.
+			(*epsocket.SocketOperations)(nil),  // pointer to kernel socket struct, always redacted.
+			linux.ClockTFromDuration(info.RTO), // rto
+			0,                                  // ato
+			0,                                  // quick ack count and pingpong mode.
+			info.SndCwnd,                       // cwnd
+			ssthresh,                           // ssthresh
+		)
+		if n.family == linux.AF_INET {
+			fmt.Fprintf(&buf, "%-149s\n", line)
+		} else {
+			fmt.Fprintf(&buf, "%s\n", line)
+		}
+		sl++
+	})
+
+	return []seqfile.SeqData{{Buf: buf.Bytes(), Handle: (*netTCP)(nil)}}, 0
+}
+
+// netUDP implements seqfile.SeqSource for /proc/net/udp and /proc/net/udp6.
+//
+// +stateify savable
+type netUDP struct {
+	k      *kernel.Kernel
+	family int
+}
+
+// NeedsUpdate implements seqfile.SeqSource.NeedsUpdate.
+func (*netUDP) NeedsUpdate(generation int64) bool {
+	return true
+}
+
+// ReadSeqFileData implements seqfile.SeqSource.ReadSeqFileData. See Linux's
+// net/ipv4/udp.c:udp4_seq_show and net/ipv6/udp.c:udp6_seq_show.
+func (n *netUDP) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
+	if h != nil {
+		return nil, 0
+	}
+
+	var buf bytes.Buffer
+	if n.family == linux.AF_INET {
+		// IPv4 lines are padded to a fixed width.
+		fmt.Fprintf(&buf, "%-127s\n", "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops")
+	} else {
+		fmt.Fprintf(&buf, "  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops\n")
+	}
+
+	sl := 0
+	forEachEpsocket(n.k, n.family, func(sfile *fs.File, sops *epsocket.SocketOperations) {
+		if _, skType, protocol := sops.Type(); skType != linux.SOCK_DGRAM || protocol != header.UDPProtocolNumber {
+			return
+		}
+		ep := sops.Endpoint
+
+		local, _ := ep.GetLocalAddress()
+		state := tcpip.TCPStateClose
+		remote, err := ep.GetRemoteAddress()
+		if err == nil {
+			state = tcpip.TCPStateEstablished
+		}
+
+		var mi tcpip.MemInfoOption
+		ep.GetSockOpt(&mi)
+
+		line := fmt.Sprintf("%5d: %s %s %02X %08X:%08X %02X:%08X %08X %5d %8d %d %d %#016p %d",
+			sl,
+			inetAddr(n.family, local),         // local_address
+			inetAddr(n.family, remote),        // rem_address
+			state,                             // st
+			mi.SndQueued,                      // tx_queue
+			mi.RcvQueued,                      // rx_queue
+			0,                                 // tr
+			0,                                 // tm->when
+			0,                                 // retrnsmt
+			sockUID(ctx, sfile),               // uid
+			0,                                 // timeout
+			sfile.InodeID(),                   // inode
+			sfile.ReadRefs()-1,                // ref, don't count our own ref.
+			(*epsocket.SocketOperations)(nil), // pointer to kernel socket struct, always redacted.
+			0,                                 // drops
+		)
+		if n.family == linux.AF_INET {
+			fmt.Fprintf(&buf, "%-127s\n", line)
+		} else {
+			fmt.Fprintf(&buf, "%s\n", line)
+		}
+		sl++
+	})
+
+	return []seqfile.SeqData{{Buf: buf.Bytes(), Handle: (*netUDP)(nil)}}, 0
+}
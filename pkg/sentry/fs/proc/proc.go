@@ -17,12 +17,11 @@ package proc
 
 import (
 	"fmt"
-	"sort"
 	"strconv"
 
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
-	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/fsutil"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/kernfs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/proc/device"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/proc/seqfile"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/ramfs"
@@ -31,12 +30,10 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
 )
 
-// proc is a root proc node.
+// proc provides the per-task directories of the root proc directory.
 //
 // +stateify savable
 type proc struct {
-	ramfs.Dir
-
 	// k is the Kernel containing this proc node.
 	k *kernel.Kernel
 
@@ -45,6 +42,8 @@ type proc struct {
 	pidns *kernel.PIDNamespace
 }
 
+var _ kernfs.Revalidator = (*proc)(nil)
+
 // New returns the root node of a partial simple procfs.
 func New(ctx context.Context, msrc *fs.MountSource) (*fs.Inode, error) {
 	k := kernel.KernelFromContext(ctx)
@@ -55,40 +54,36 @@ func New(ctx context.Context, msrc *fs.MountSource) (*fs.Inode, error) {
 	if pidns == nil {
 		return nil, fmt.Errorf("procfs requires a PID namespace")
 	}
+	p := &proc{
+		k:     k,
+		pidns: pidns,
+	}
 
 	// Note that these are just the static members. There are dynamic
-	// members populated in Readdir and Lookup below.
+	// members provided by p.
 	contents := map[string]*fs.Inode{
 		"cpuinfo":     newCPUInfo(ctx, msrc),
 		"filesystems": seqfile.NewSeqFileInode(ctx, &filesystemsData{}, msrc),
 		"loadavg":     seqfile.NewSeqFileInode(ctx, &loadavgData{}, msrc),
 		"meminfo":     seqfile.NewSeqFileInode(ctx, &meminfoData{k}, msrc),
-		"mounts":      newProcInode(ramfs.NewSymlink(ctx, fs.RootOwner, "self/mounts"), msrc, fs.Symlink, nil),
+		"mounts":      procfs.NewSymlink(ctx, msrc, "self/mounts"),
 		"self":        newSelf(ctx, pidns, msrc),
 		"stat":        seqfile.NewSeqFileInode(ctx, &statData{k}, msrc),
+		"sys":         p.newSysDir(ctx, msrc),
+		"sysvipc":     p.newSysVIPCDir(ctx, msrc),
 		"thread-self": newThreadSelf(ctx, pidns, msrc),
 		"uptime":      newUptime(ctx, msrc),
 		"version":     seqfile.NewSeqFileInode(ctx, &versionData{k}, msrc),
 	}
 
-	// Construct the proc InodeOperations.
-	p := &proc{
-		Dir:   *ramfs.NewDir(ctx, contents, fs.RootOwner, fs.FilePermsFromMode(0555)),
-		k:     k,
-		pidns: pidns,
-	}
-
-	// Add more contents that need proc to be initialized.
-	p.AddChild(ctx, "sys", p.newSysDir(ctx, msrc))
-
 	// If we're using rpcinet we will let it manage /proc/net.
 	if _, ok := p.k.NetworkStack().(*rpcinet.Stack); ok {
-		p.AddChild(ctx, "net", newRPCInetProcNet(ctx, msrc))
+		contents["net"] = newRPCInetProcNet(ctx, msrc)
 	} else {
-		p.AddChild(ctx, "net", p.newNetDir(ctx, k, msrc))
+		contents["net"] = p.newNetDir(ctx, k, msrc)
 	}
 
-	return newProcInode(p, msrc, fs.SpecialDirectory, nil), nil
+	return procfs.NewDynamicDir(ctx, msrc, contents, p), nil
 }
 
 // self is a magical link.
@@ -156,87 +151,48 @@ func (s *threadSelf) Readlink(ctx context.Context, inode *fs.Inode) (string, err
 	return "", syserror.EINVAL
 }
 
-// Lookup loads an Inode at name into a Dirent.
-func (p *proc) Lookup(ctx context.Context, dir *fs.Inode, name string) (*fs.Dirent, error) {
-	dirent, walkErr := p.Dir.Lookup(ctx, dir, name)
-	if walkErr == nil {
-		return dirent, nil
-	}
-
+// Lookup implements kernfs.DirSource.Lookup.
+func (p *proc) Lookup(ctx context.Context, dir *fs.Inode, name string) (*fs.Inode, error) {
 	// Try to lookup a corresponding task.
 	tid, err := strconv.ParseUint(name, 10, 64)
 	if err != nil {
-		// Ignore the parse error and return the original.
-		return nil, walkErr
+		return nil, syserror.ENOENT
 	}
 
 	// Grab the other task.
 	otherTask := p.pidns.TaskWithID(kernel.ThreadID(tid))
 	if otherTask == nil {
-		// Per above.
-		return nil, walkErr
+		return nil, syserror.ENOENT
 	}
 
 	// Wrap it in a taskDir.
-	td := newTaskDir(otherTask, dir.MountSource, p.pidns, true)
-	return fs.NewDirent(td, name), nil
-}
-
-// GetFile implements fs.InodeOperations.
-func (p *proc) GetFile(ctx context.Context, dirent *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
-	return fs.NewFile(ctx, dirent, flags, &rootProcFile{iops: p}), nil
+	return newTaskDir(otherTask, dir.MountSource, p.pidns, true), nil
 }
 
-// rootProcFile implements fs.FileOperations for the proc directory.
-//
-// +stateify savable
-type rootProcFile struct {
-	fsutil.DirFileOperations `state:"nosave"`
-
-	iops *proc
-}
-
-var _ fs.FileOperations = (*rootProcFile)(nil)
-
-// Readdir implements fs.FileOperations.Readdir.
-func (rpf *rootProcFile) Readdir(ctx context.Context, file *fs.File, ser fs.DentrySerializer) (int64, error) {
-	offset := file.Offset()
-	dirCtx := &fs.DirCtx{
-		Serializer: ser,
+// Revalidate implements kernfs.Revalidator.Revalidate. A cached taskDir can be
+// reused until its task is reaped, and its TID possibly reused.
+func (p *proc) Revalidate(ctx context.Context, name string, child *fs.Inode) bool {
+	td, ok := child.InodeOperations.(*taskOwnedInodeOps)
+	if !ok {
+		return false
 	}
+	tid, err := strconv.ParseUint(name, 10, 64)
+	if err != nil {
+		return false
+	}
+	return p.pidns.TaskWithID(kernel.ThreadID(tid)) == td.t
+}
 
-	// Get normal directory contents from ramfs dir.
-	names, m := rpf.iops.Dir.Children()
-
-	// Add dot and dotdot.
-	root := fs.RootFromContext(ctx)
-	defer root.DecRef()
-	dot, dotdot := file.Dirent.GetDotAttrs(root)
-	names = append(names, ".", "..")
-	m["."] = dot
-	m[".."] = dotdot
-
-	// Collect tasks.
+// Children implements kernfs.DirSource.Children.
+func (p *proc) Children(ctx context.Context) map[string]fs.DentAttr {
 	// Per linux we only include it in directory listings if it's the leader.
 	// But for whatever crazy reason, you can still walk to the given node.
-	for _, tg := range rpf.iops.pidns.ThreadGroups() {
+	m := make(map[string]fs.DentAttr)
+	for _, tg := range p.pidns.ThreadGroups() {
 		if leader := tg.Leader(); leader != nil {
 			name := strconv.FormatUint(uint64(tg.ID()), 10)
 			m[name] = fs.GenericDentAttr(fs.SpecialDirectory, device.ProcDevice)
-			names = append(names, name)
-		}
-	}
-
-	if offset >= int64(len(m)) {
-		return offset, nil
-	}
-	sort.Strings(names)
-	names = names[offset:]
-	for _, name := range names {
-		if err := dirCtx.DirEmit(name, m[name]); err != nil {
-			return offset, err
 		}
-		offset++
 	}
-	return offset, nil
+	return m
 }
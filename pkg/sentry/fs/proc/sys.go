@@ -56,37 +56,23 @@ func (d *mmapMinAddrData) ReadSeqFileData(ctx context.Context, h seqfile.SeqHand
 	}, 0
 }
 
-// +stateify savable
-type overcommitMemory struct{}
-
-func (*overcommitMemory) NeedsUpdate(generation int64) bool {
-	return true
-}
-
-// ReadSeqFileData implements seqfile.SeqSource.
-func (*overcommitMemory) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
-	if h != nil {
-		return nil, 0
-	}
-	return []seqfile.SeqData{
-		{
-			Buf:    []byte("0\n"),
-			Handle: (*overcommitMemory)(nil),
-		},
-	}, 0
-}
-
 func (p *proc) newKernelDir(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
 	h := hostname{
 		SimpleFileInode: *fsutil.NewSimpleFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(0444), linux.PROC_SUPER_MAGIC),
 	}
+	sl := semLimits{
+		SimpleFileInode: *fsutil.NewSimpleFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(0644), linux.PROC_SUPER_MAGIC),
+		k:               p.k,
+	}
 
 	children := map[string]*fs.Inode{
 		"hostname": newProcInode(&h, msrc, fs.SpecialFile, nil),
+		"sem":      newProcInode(&sl, msrc, fs.SpecialFile, nil),
 		"shmall":   newStaticProcInode(ctx, msrc, []byte(strconv.FormatUint(linux.SHMALL, 10))),
 		"shmmax":   newStaticProcInode(ctx, msrc, []byte(strconv.FormatUint(linux.SHMMAX, 10))),
 		"shmmni":   newStaticProcInode(ctx, msrc, []byte(strconv.FormatUint(linux.SHMMNI, 10))),
 	}
+	addSysctls(ctx, msrc, p.k, "kernel", children)
 
 	d := ramfs.NewDir(ctx, children, fs.RootOwner, fs.FilePermsFromMode(0555))
 	return newProcInode(d, msrc, fs.SpecialDirectory, nil)
@@ -94,8 +80,32 @@ func (p *proc) newKernelDir(ctx context.Context, msrc *fs.MountSource) *fs.Inode
 
 func (p *proc) newVMDir(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
 	children := map[string]*fs.Inode{
-		"mmap_min_addr":     seqfile.NewSeqFileInode(ctx, &mmapMinAddrData{p.k}, msrc),
-		"overcommit_memory": seqfile.NewSeqFileInode(ctx, &overcommitMemory{}, msrc),
+		"mmap_min_addr": seqfile.NewSeqFileInode(ctx, &mmapMinAddrData{p.k}, msrc),
+	}
+	addSysctls(ctx, msrc, p.k, "vm", children)
+	d := ramfs.NewDir(ctx, children, fs.RootOwner, fs.FilePermsFromMode(0555))
+	return newProcInode(d, msrc, fs.SpecialDirectory, nil)
+}
+
+func (p *proc) newDevDir(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
+	ttyChildren := map[string]*fs.Inode{}
+	addSysctls(ctx, msrc, p.k, "dev.tty", ttyChildren)
+	tty := ramfs.NewDir(ctx, ttyChildren, fs.RootOwner, fs.FilePermsFromMode(0555))
+
+	children := map[string]*fs.Inode{
+		"tty": newProcInode(tty, msrc, fs.SpecialDirectory, nil),
+	}
+	d := ramfs.NewDir(ctx, children, fs.RootOwner, fs.FilePermsFromMode(0555))
+	return newProcInode(d, msrc, fs.SpecialDirectory, nil)
+}
+
+func (p *proc) newFSDir(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
+	// binfmt_misc is an empty directory on which the binfmt_misc filesystem
+	// is mounted, as in Linux.
+	binfmtMisc := ramfs.NewDir(ctx, nil, fs.RootOwner, fs.FilePermsFromMode(0555))
+
+	children := map[string]*fs.Inode{
+		"binfmt_misc": newProcInode(binfmtMisc, msrc, fs.SpecialDirectory, nil),
 	}
 	d := ramfs.NewDir(ctx, children, fs.RootOwner, fs.FilePermsFromMode(0555))
 	return newProcInode(d, msrc, fs.SpecialDirectory, nil)
@@ -103,6 +113,8 @@ func (p *proc) newVMDir(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
 
 func (p *proc) newSysDir(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
 	children := map[string]*fs.Inode{
+		"dev":    p.newDevDir(ctx, msrc),
+		"fs":     p.newFSDir(ctx, msrc),
 		"kernel": p.newKernelDir(ctx, msrc),
 		"vm":     p.newVMDir(ctx, msrc),
 	}
@@ -158,3 +170,70 @@ func (hf *hostnameFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequ
 }
 
 var _ fs.FileOperations = (*hostnameFile)(nil)
+
+// semLimits is the inode for /proc/sys/kernel/sem, which contains the
+// semaphore limits of the IPC namespace of the task accessing it.
+//
+// +stateify savable
+type semLimits struct {
+	fsutil.SimpleFileInode
+
+	k *kernel.Kernel
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (s *semLimits) GetFile(ctx context.Context, d *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	flags.Pread = true
+	return fs.NewFile(ctx, d, flags, &semLimitsFile{k: s.k}), nil
+}
+
+var _ fs.InodeOperations = (*semLimits)(nil)
+
+// +stateify savable
+type semLimitsFile struct {
+	waiter.AlwaysReady       `state:"nosave"`
+	fsutil.FileGenericSeek   `state:"nosave"`
+	fsutil.FileNoIoctl       `state:"nosave"`
+	fsutil.FileNoMMap        `state:"nosave"`
+	fsutil.FileNoopFlush     `state:"nosave"`
+	fsutil.FileNoopFsync     `state:"nosave"`
+	fsutil.FileNoopRelease   `state:"nosave"`
+	fsutil.FileNotDirReaddir `state:"nosave"`
+
+	k *kernel.Kernel
+}
+
+// Read implements fs.FileOperations.Read.
+func (f *semLimitsFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
+	l := ipcNamespace(ctx, f.k).SemaphoreRegistry().Limits()
+	contents := []byte(fmt.Sprintf("%d\t%d\t%d\t%d\n", l.SemaphoresMax, l.SemaphoresTotalMax, l.OpsMax, l.SetsMax))
+	if offset >= int64(len(contents)) {
+		return 0, io.EOF
+	}
+	n, err := dst.CopyOut(ctx, contents[offset:])
+	return int64(n), err
+}
+
+// Write implements fs.FileOperations.Write.
+func (f *semLimitsFile) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	src = src.TakeFirst(usermem.PageSize - 1)
+
+	// As in Linux, values that are not written are left unchanged.
+	r := ipcNamespace(ctx, f.k).SemaphoreRegistry()
+	l := r.Limits()
+	vals := []int32{l.SemaphoresMax, l.SemaphoresTotalMax, l.OpsMax, l.SetsMax}
+	n, err := usermem.CopyInt32StringsInVec(ctx, src.IO, src.Addrs, vals, src.Opts)
+	if err != nil {
+		return n, err
+	}
+	l.SemaphoresMax, l.SemaphoresTotalMax, l.OpsMax, l.SetsMax = vals[0], vals[1], vals[2], vals[3]
+	if err := r.SetLimits(l); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+var _ fs.FileOperations = (*semLimitsFile)(nil)
@@ -0,0 +1,123 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proc
+
+import (
+	"fmt"
+	"io"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/fsutil"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+// sysctlInode is a file under /proc/sys backed by a sysctl registered with
+// kernel.RegisterSysctl. The value itself is stored in the Kernel, so that
+// all proc mounts observe the same value.
+//
+// +stateify savable
+type sysctlInode struct {
+	fsutil.SimpleFileInode
+
+	k *kernel.Kernel
+
+	// name is the dotted name of the sysctl, e.g. "vm.max_map_count".
+	name string
+}
+
+var _ fs.InodeOperations = (*sysctlInode)(nil)
+
+func newSysctlInode(ctx context.Context, msrc *fs.MountSource, k *kernel.Kernel, name string) *fs.Inode {
+	s, ok := kernel.LookupSysctl(name)
+	if !ok {
+		panic(fmt.Sprintf("sysctl %q not registered", name))
+	}
+	mode := linux.FileMode(0444)
+	if s.Writable {
+		mode = 0644
+	}
+	si := &sysctlInode{
+		SimpleFileInode: *fsutil.NewSimpleFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(mode), linux.PROC_SUPER_MAGIC),
+		k:               k,
+		name:            name,
+	}
+	return newProcInode(si, msrc, fs.SpecialFile, nil)
+}
+
+// addSysctls adds inodes for all sysctls registered in the dotted directory
+// dir to children.
+func addSysctls(ctx context.Context, msrc *fs.MountSource, k *kernel.Kernel, dir string, children map[string]*fs.Inode) {
+	for _, name := range kernel.SysctlsIn(dir) {
+		children[name] = newSysctlInode(ctx, msrc, k, dir+"."+name)
+	}
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (s *sysctlInode) GetFile(ctx context.Context, dirent *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	flags.Pread = true
+	return fs.NewFile(ctx, dirent, flags, &sysctlFile{sysctlInode: s}), nil
+}
+
+// +stateify savable
+type sysctlFile struct {
+	waiter.AlwaysReady       `state:"nosave"`
+	fsutil.FileGenericSeek   `state:"nosave"`
+	fsutil.FileNoIoctl       `state:"nosave"`
+	fsutil.FileNoMMap        `state:"nosave"`
+	fsutil.FileNoopRelease   `state:"nosave"`
+	fsutil.FileNoopFlush     `state:"nosave"`
+	fsutil.FileNoopFsync     `state:"nosave"`
+	fsutil.FileNotDirReaddir `state:"nosave"`
+
+	sysctlInode *sysctlInode
+}
+
+var _ fs.FileOperations = (*sysctlFile)(nil)
+
+// Read implements fs.FileOperations.Read.
+func (f *sysctlFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
+	v, err := f.sysctlInode.k.Sysctl(f.sysctlInode.name)
+	if err != nil {
+		return 0, err
+	}
+	buf := []byte(fmt.Sprintf("%d\n", v))
+	if offset >= int64(len(buf)) {
+		return 0, io.EOF
+	}
+	n, err := dst.CopyOut(ctx, buf[offset:])
+	return int64(n), err
+}
+
+// Write implements fs.FileOperations.Write.
+func (f *sysctlFile) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	src = src.TakeFirst(usermem.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return n, err
+	}
+	if err := f.sysctlInode.k.SetSysctl(f.sysctlInode.name, int64(v)); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
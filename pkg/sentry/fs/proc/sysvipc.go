@@ -0,0 +1,147 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proc
+
+import (
+	"bytes"
+	"fmt"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/proc/seqfile"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/ramfs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
+)
+
+// newSysVIPCDir returns the inode for /proc/sysvipc.
+func (p *proc) newSysVIPCDir(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
+	contents := map[string]*fs.Inode{
+		"msg": seqfile.NewSeqFileInode(ctx, &sysVIPCMsgData{}, msrc),
+		"sem": seqfile.NewSeqFileInode(ctx, &sysVIPCSemData{p.k}, msrc),
+		"shm": seqfile.NewSeqFileInode(ctx, &sysVIPCShmData{p.k}, msrc),
+	}
+	d := ramfs.NewDir(ctx, contents, fs.RootOwner, fs.FilePermsFromMode(0555))
+	return newProcInode(d, msrc, fs.SpecialDirectory, nil)
+}
+
+// ipcNamespace returns the IPC namespace of the task reading a /proc/sysvipc
+// file, or the root IPC namespace if there is no such task.
+func ipcNamespace(ctx context.Context, k *kernel.Kernel) *kernel.IPCNamespace {
+	if t := kernel.TaskFromContext(ctx); t != nil {
+		return t.IPCNamespace()
+	}
+	return k.RootIPCNamespace()
+}
+
+// sysVIPCShmData backs /proc/sysvipc/shm.
+//
+// +stateify savable
+type sysVIPCShmData struct {
+	k *kernel.Kernel
+}
+
+// NeedsUpdate implements seqfile.SeqSource.NeedsUpdate.
+func (*sysVIPCShmData) NeedsUpdate(generation int64) bool {
+	return true
+}
+
+// ReadSeqFileData implements seqfile.SeqSource.ReadSeqFileData.
+func (d *sysVIPCShmData) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
+	if h != nil {
+		return nil, 0
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "       key      shmid perms                  size  cpid  lpid nattch   uid   gid  cuid  cgid      atime      dtime      ctime                   rss                  swap\n")
+	for _, s := range ipcNamespace(ctx, d.k).ShmRegistry().Segments() {
+		ds := s.IPCStatAny(ctx)
+		// The sentry doesn't implement swap, so all of a segment's memory is
+		// resident.
+		fmt.Fprintf(&buf, "%10d %10d  %4o %21d %5d %5d  %5d %5d %5d %5d %5d %10d %10d %10d %21d %21d\n",
+			int32(ds.ShmPerm.Key), s.ID, ds.ShmPerm.Mode, ds.ShmSegsz, ds.ShmCpid, ds.ShmLpid, ds.ShmNattach,
+			ds.ShmPerm.UID, ds.ShmPerm.GID, ds.ShmPerm.CUID, ds.ShmPerm.CGID,
+			ds.ShmAtime, ds.ShmDtime, ds.ShmCtime, s.EffectiveSize(), 0)
+	}
+
+	return []seqfile.SeqData{
+		{
+			Buf:    buf.Bytes(),
+			Handle: (*sysVIPCShmData)(nil),
+		},
+	}, 0
+}
+
+// sysVIPCSemData backs /proc/sysvipc/sem.
+//
+// +stateify savable
+type sysVIPCSemData struct {
+	k *kernel.Kernel
+}
+
+// NeedsUpdate implements seqfile.SeqSource.NeedsUpdate.
+func (*sysVIPCSemData) NeedsUpdate(generation int64) bool {
+	return true
+}
+
+// ReadSeqFileData implements seqfile.SeqSource.ReadSeqFileData.
+func (d *sysVIPCSemData) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
+	if h != nil {
+		return nil, 0
+	}
+
+	creds := auth.CredentialsFromContext(ctx)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "       key      semid perms      nsems   uid   gid  cuid  cgid      otime      ctime\n")
+	for _, s := range ipcNamespace(ctx, d.k).SemaphoreRegistry().Sets() {
+		ds := s.Stat(creds)
+		fmt.Fprintf(&buf, "%10d %10d  %4o %10d %5d %5d %5d %5d %10d %10d\n",
+			int32(ds.SemPerm.Key), s.ID, ds.SemPerm.Mode, ds.SemNSems,
+			ds.SemPerm.UID, ds.SemPerm.GID, ds.SemPerm.CUID, ds.SemPerm.CGID,
+			ds.SemOTime, ds.SemCTime)
+	}
+
+	return []seqfile.SeqData{
+		{
+			Buf:    buf.Bytes(),
+			Handle: (*sysVIPCSemData)(nil),
+		},
+	}, 0
+}
+
+// sysVIPCMsgData backs /proc/sysvipc/msg. System V message queues are not
+// implemented, so it only contains the header.
+//
+// +stateify savable
+type sysVIPCMsgData struct{}
+
+// NeedsUpdate implements seqfile.SeqSource.NeedsUpdate.
+func (*sysVIPCMsgData) NeedsUpdate(generation int64) bool {
+	return true
+}
+
+// ReadSeqFileData implements seqfile.SeqSource.ReadSeqFileData.
+func (*sysVIPCMsgData) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
+	if h != nil {
+		return nil, 0
+	}
+
+	return []seqfile.SeqData{
+		{
+			Buf:    []byte("       key      msqid perms      cbytes       qnum lspid lrpid   uid   gid  cuid  cgid      stime      rtime      ctime\n"),
+			Handle: (*sysVIPCMsgData)(nil),
+		},
+	}, 0
+}
@@ -283,6 +283,18 @@ func (e *exe) Readlink(ctx context.Context, inode *fs.Inode) (string, error) {
 	return n, nil
 }
 
+// Getlink implements fs.InodeOperations.Getlink.
+//
+// Following the link yields the executable itself, rather than the file at its
+// path, so that it may be re-executed even if it is unreachable by path, e.g.
+// because it is a memfd or was loaded by file descriptor with execveat(2).
+func (e *exe) Getlink(ctx context.Context, inode *fs.Inode) (*fs.Dirent, error) {
+	if !kernel.ContextCanTrace(ctx, e.t, false) {
+		return nil, syserror.EACCES
+	}
+	return e.executable()
+}
+
 // namespaceSymlink represents a symlink in the namespacefs, such as the files
 // in /proc/<pid>/ns.
 //
@@ -450,16 +462,16 @@ func (s *taskStatData) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle)
 	fmt.Fprintf(&buf, "%d ", s.pidns.IDOfSession(s.t.ThreadGroup().Session()))
 	fmt.Fprintf(&buf, "0 0 " /* tty_nr tpgid */)
 	fmt.Fprintf(&buf, "0 " /* flags */)
-	fmt.Fprintf(&buf, "0 0 0 0 " /* minflt cminflt majflt cmajflt */)
 	var cputime usage.CPUStats
 	if s.tgstats {
 		cputime = s.t.ThreadGroup().CPUStats()
 	} else {
 		cputime = s.t.CPUStats()
 	}
+	childtime := s.t.ThreadGroup().JoinedChildCPUStats()
+	fmt.Fprintf(&buf, "%d %d %d %d ", cputime.MinorFaults, childtime.MinorFaults, cputime.MajorFaults, childtime.MajorFaults)
 	fmt.Fprintf(&buf, "%d %d ", linux.ClockTFromDuration(cputime.UserTime), linux.ClockTFromDuration(cputime.SysTime))
-	cputime = s.t.ThreadGroup().JoinedChildCPUStats()
-	fmt.Fprintf(&buf, "%d %d ", linux.ClockTFromDuration(cputime.UserTime), linux.ClockTFromDuration(cputime.SysTime))
+	fmt.Fprintf(&buf, "%d %d ", linux.ClockTFromDuration(childtime.UserTime), linux.ClockTFromDuration(childtime.SysTime))
 	fmt.Fprintf(&buf, "%d %d ", s.t.Priority(), s.t.Niceness())
 	fmt.Fprintf(&buf, "%d ", s.t.ThreadGroup().Count())
 
@@ -573,18 +585,20 @@ func (s *statusData) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) (
 	}
 	fmt.Fprintf(&buf, "TracerPid:\t%d\n", tpid)
 	var fds int
-	var vss, rss uint64
+	var vss, lck, rss uint64
 	s.t.WithMuLocked(func(t *kernel.Task) {
 		if fdm := t.FDMap(); fdm != nil {
 			fds = fdm.Size()
 		}
 		if mm := t.MemoryManager(); mm != nil {
 			vss = mm.VirtualMemorySize()
+			lck = mm.LockedMemorySize()
 			rss = mm.ResidentSetSize()
 		}
 	})
 	fmt.Fprintf(&buf, "FDSize:\t%d\n", fds)
 	fmt.Fprintf(&buf, "VmSize:\t%d kB\n", vss>>10)
+	fmt.Fprintf(&buf, "VmLck:\t%d kB\n", lck>>10)
 	fmt.Fprintf(&buf, "VmRSS:\t%d kB\n", rss>>10)
 	fmt.Fprintf(&buf, "Threads:\t%d\n", s.t.ThreadGroup().Count())
 	creds := s.t.Credentials()
@@ -627,7 +641,7 @@ func (i *ioData) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]se
 	io.Accumulate(i.IOUsage())
 
 	var buf bytes.Buffer
-	fmt.Fprintf(&buf, "char: %d\n", io.CharsRead)
+	fmt.Fprintf(&buf, "rchar: %d\n", io.CharsRead)
 	fmt.Fprintf(&buf, "wchar: %d\n", io.CharsWritten)
 	fmt.Fprintf(&buf, "syscr: %d\n", io.ReadSyscalls)
 	fmt.Fprintf(&buf, "syscw: %d\n", io.WriteSyscalls)
@@ -31,6 +31,12 @@ type RestoreEnvironment struct {
 	// ValidateFileTimestamp indicates file modification timestamp should
 	// not change across S/R.
 	ValidateFileTimestamp bool
+
+	// DonatedFDs maps the keys of host FDs imported when the sentry was
+	// started (see host.ImportFile) to the equivalent FDs donated to the
+	// restoring sentry. Imported FDs without an entry are restored from the
+	// FD numbers they were originally imported from.
+	DonatedFDs map[string]int
 }
 
 // MountArgs holds arguments to Mount.
@@ -0,0 +1,78 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sys
+
+import (
+	"bytes"
+	"fmt"
+
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/host"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/kernfs"
+)
+
+// blockSize backs the size attribute of a block device, its size in 512-byte
+// sectors.
+//
+// +stateify savable
+type blockSize struct {
+	dev host.BlockDevice
+}
+
+var _ kernfs.Generator = (*blockSize)(nil)
+
+// Generate implements kernfs.Generator.Generate.
+func (b *blockSize) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	size, err := b.dev.Size()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(buf, "%d\n", size>>9)
+	return nil
+}
+
+// newBlockDevices returns the devices of the block class for the host block
+// devices donated to the sandbox.
+func newBlockDevices(ctx context.Context, msrc *fs.MountSource, blockDevices []host.BlockDevice) []virtualDevice {
+	devs := make([]virtualDevice, 0, len(blockDevices))
+	for _, d := range blockDevices {
+		logical, physical, err := d.SectorSizes()
+		if err != nil {
+			log.Warningf("Failed to get sector sizes of block device %q: %v", d.Name, err)
+			logical, physical = 512, 512
+		}
+		devs = append(devs, virtualDevice{
+			class: "block",
+			name:  d.Name,
+			block: true,
+			major: d.Major,
+			minor: d.Minor,
+			attrs: map[string]*fs.Inode{
+				"queue": sysfs.NewDir(ctx, msrc, map[string]*fs.Inode{
+					"hw_sector_size":      newStaticFile(ctx, msrc, fmt.Sprintf("%d\n", logical)),
+					"logical_block_size":  newStaticFile(ctx, msrc, fmt.Sprintf("%d\n", logical)),
+					"physical_block_size": newStaticFile(ctx, msrc, fmt.Sprintf("%d\n", physical)),
+					"rotational":          newStaticFile(ctx, msrc, "0\n"),
+				}),
+				"removable": newStaticFile(ctx, msrc, "0\n"),
+				"ro":        newStaticFile(ctx, msrc, "0\n"),
+				"size":      sysfs.NewGeneratedFile(ctx, msrc, &blockSize{dev: d}),
+			},
+		})
+	}
+	return devs
+}
@@ -14,7 +14,11 @@
 
 package sys
 
-import "gvisor.googlesource.com/gvisor/pkg/sentry/device"
+import (
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/device"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/kernfs"
+)
 
-// sysfsDevice is the sysfs virtual device.
-var sysfsDevice = device.NewAnonDevice()
+// sysfs is the sysfs filesystem, on its own virtual device.
+var sysfs = kernfs.NewFilesystem("sysfs", linux.SYSFS_MAGIC, device.NewAnonDevice())
@@ -15,36 +15,50 @@
 package sys
 
 import (
+	"bytes"
 	"fmt"
 
-	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/cpuid"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
-	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/fsutil"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
 )
 
-// +stateify savable
-type cpunum struct {
-	fsutil.InodeGenericChecker       `state:"nosave"`
-	fsutil.InodeNoExtendedAttributes `state:"nosave"`
-	fsutil.InodeNoopRelease          `state:"nosave"`
-	fsutil.InodeNoopWriteOut         `state:"nosave"`
-	fsutil.InodeNotDirectory         `state:"nosave"`
-	fsutil.InodeNotMappable          `state:"nosave"`
-	fsutil.InodeNotSocket            `state:"nosave"`
-	fsutil.InodeNotSymlink           `state:"nosave"`
-	fsutil.InodeNotVirtual           `state:"nosave"`
-	fsutil.InodeNotTruncatable       `state:"nosave"`
-
-	fsutil.InodeSimpleAttributes
-	fsutil.InodeStaticFileGetter
+// newStaticFile returns a read-only file with the given contents.
+func newStaticFile(ctx context.Context, msrc *fs.MountSource, contents string) *fs.Inode {
+	return sysfs.NewStaticFile(ctx, msrc, []byte(contents))
+}
 
-	// k is the system kernel.
-	k *kernel.Kernel
+// cpuList formats the CPUs first to last as a Linux CPU list, e.g. "0-3".
+func cpuList(first, last uint) string {
+	if first == last {
+		return fmt.Sprintf("%d\n", first)
+	}
+	return fmt.Sprintf("%d-%d\n", first, last)
 }
 
-var _ fs.InodeOperations = (*cpunum)(nil)
+// cpuMask formats the CPUs first to last as a Linux CPU mask of numCPU bits,
+// e.g. "0f" or "ff,ffffffff": hexadecimal words of 32 bits separated by
+// commas, with the first word only as wide as needed for numCPU bits. The mask
+// is empty if first > last.
+func cpuMask(first, last, numCPU uint) string {
+	words := make([]uint32, (numCPU+31)/32)
+	for cpu := first; cpu <= last; cpu++ {
+		words[cpu/32] |= 1 << (cpu % 32)
+	}
+	var b bytes.Buffer
+	for i := len(words) - 1; i >= 0; i-- {
+		width := 8
+		if i == len(words)-1 {
+			width = int((numCPU - uint(i)*32 + 3) / 4)
+		} else {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%0*x", width, words[i])
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
 
 func newPossible(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
 	var maxCore uint
@@ -52,15 +66,51 @@ func newPossible(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
 	if k != nil {
 		maxCore = k.ApplicationCores() - 1
 	}
-	contents := []byte(fmt.Sprintf("0-%d\n", maxCore))
+	return newStaticFile(ctx, msrc, cpuList(0, maxCore))
+}
+
+// newTopology returns the topology directory of cpu. The topology is a single
+// socket of numCPU cores with one thread each, consistent with /proc/cpuinfo.
+func newTopology(ctx context.Context, msrc *fs.MountSource, cpu, numCPU uint) *fs.Inode {
+	return sysfs.NewDir(ctx, msrc, map[string]*fs.Inode{
+		"core_id":              newStaticFile(ctx, msrc, fmt.Sprintf("%d\n", cpu)),
+		"core_siblings":        newStaticFile(ctx, msrc, cpuMask(0, numCPU-1, numCPU)),
+		"core_siblings_list":   newStaticFile(ctx, msrc, cpuList(0, numCPU-1)),
+		"physical_package_id":  newStaticFile(ctx, msrc, "0\n"),
+		"thread_siblings":      newStaticFile(ctx, msrc, cpuMask(cpu, cpu, numCPU)),
+		"thread_siblings_list": newStaticFile(ctx, msrc, cpuList(cpu, cpu)),
+	})
+}
+
+// newCache returns the cache directory of cpu. Caches below the last level are
+// private to each CPU, and last level caches are shared by all CPUs.
+func newCache(ctx context.Context, msrc *fs.MountSource, caches []cpuid.Cache, cpu, numCPU uint) *fs.Inode {
+	var lastLevel uint32
+	for _, c := range caches {
+		if c.Level > lastLevel {
+			lastLevel = c.Level
+		}
+	}
 
-	c := &cpunum{
-		InodeSimpleAttributes: fsutil.NewInodeSimpleAttributes(ctx, fs.RootOwner, fs.FilePermsFromMode(0444), linux.SYSFS_MAGIC),
-		InodeStaticFileGetter: fsutil.InodeStaticFileGetter{
-			Contents: contents,
-		},
+	m := make(map[string]*fs.Inode, len(caches))
+	for i, c := range caches {
+		first, last := cpu, cpu
+		if c.Level == lastLevel && c.Level > 1 {
+			first, last = 0, numCPU-1
+		}
+		m[fmt.Sprintf("index%d", i)] = sysfs.NewDir(ctx, msrc, map[string]*fs.Inode{
+			"coherency_line_size":     newStaticFile(ctx, msrc, fmt.Sprintf("%d\n", c.LineSize)),
+			"level":                   newStaticFile(ctx, msrc, fmt.Sprintf("%d\n", c.Level)),
+			"number_of_sets":          newStaticFile(ctx, msrc, fmt.Sprintf("%d\n", c.Sets)),
+			"physical_line_partition": newStaticFile(ctx, msrc, fmt.Sprintf("%d\n", c.Partitions)),
+			"shared_cpu_list":         newStaticFile(ctx, msrc, cpuList(first, last)),
+			"shared_cpu_map":          newStaticFile(ctx, msrc, cpuMask(first, last, numCPU)),
+			"size":                    newStaticFile(ctx, msrc, fmt.Sprintf("%dK\n", c.Size()/1024)),
+			"type":                    newStaticFile(ctx, msrc, c.Type.String()+"\n"),
+			"ways_of_associativity":   newStaticFile(ctx, msrc, fmt.Sprintf("%d\n", c.Ways)),
+		})
 	}
-	return newFile(c, msrc)
+	return sysfs.NewDir(ctx, msrc, m)
 }
 
 func newCPU(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
@@ -72,22 +122,32 @@ func newCPU(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
 
 	// Add directories for each of the cpus.
 	if k := kernel.KernelFromContext(ctx); k != nil {
-		for i := 0; uint(i) < k.ApplicationCores(); i++ {
-			m[fmt.Sprintf("cpu%d", i)] = newDir(ctx, msrc, nil)
+		var caches []cpuid.Cache
+		if features := k.FeatureSet(); features != nil {
+			caches = features.Caches
+		}
+		numCPU := k.ApplicationCores()
+		for i := uint(0); i < numCPU; i++ {
+			m[fmt.Sprintf("cpu%d", i)] = sysfs.NewDir(ctx, msrc, map[string]*fs.Inode{
+				"cache":    newCache(ctx, msrc, caches, i, numCPU),
+				"topology": newTopology(ctx, msrc, i, numCPU),
+			})
 		}
 	}
 
-	return newDir(ctx, msrc, m)
+	return sysfs.NewDir(ctx, msrc, m)
 }
 
 func newSystemDir(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
-	return newDir(ctx, msrc, map[string]*fs.Inode{
-		"cpu": newCPU(ctx, msrc),
+	return sysfs.NewDir(ctx, msrc, map[string]*fs.Inode{
+		"cpu":  newCPU(ctx, msrc),
+		"node": newNode(ctx, msrc),
 	})
 }
 
-func newDevicesDir(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
-	return newDir(ctx, msrc, map[string]*fs.Inode{
-		"system": newSystemDir(ctx, msrc),
+func newDevicesDir(ctx context.Context, msrc *fs.MountSource, virtual *fs.Inode) *fs.Inode {
+	return sysfs.NewDir(ctx, msrc, map[string]*fs.Inode{
+		"system":  newSystemDir(ctx, msrc),
+		"virtual": virtual,
 	})
 }
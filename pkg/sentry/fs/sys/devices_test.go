@@ -0,0 +1,52 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sys
+
+import (
+	"testing"
+)
+
+func TestCPUList(t *testing.T) {
+	for _, tc := range []struct {
+		first, last uint
+		want        string
+	}{
+		{0, 0, "0\n"},
+		{3, 3, "3\n"},
+		{0, 7, "0-7\n"},
+	} {
+		if got := cpuList(tc.first, tc.last); got != tc.want {
+			t.Errorf("cpuList(%d, %d) = %q, want %q", tc.first, tc.last, got, tc.want)
+		}
+	}
+}
+
+func TestCPUMask(t *testing.T) {
+	for _, tc := range []struct {
+		first, last, numCPU uint
+		want                string
+	}{
+		{0, 0, 1, "1\n"},
+		{0, 3, 4, "f\n"},
+		{2, 2, 8, "04\n"},
+		{0, 39, 40, "ff,ffffffff\n"},
+		{33, 33, 64, "00000002,00000000\n"},
+		{1, 0, 8, "00\n"},
+	} {
+		if got := cpuMask(tc.first, tc.last, tc.numCPU); got != tc.want {
+			t.Errorf("cpuMask(%d, %d, %d) = %q, want %q", tc.first, tc.last, tc.numCPU, got, tc.want)
+		}
+	}
+}
@@ -17,6 +17,8 @@ package sys
 import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/host"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
 )
 
 // filesystem is a sysfs.
@@ -57,9 +59,20 @@ func (*filesystem) Flags() fs.FilesystemFlags {
 }
 
 // Mount returns a sysfs root which can be positioned in the vfs.
-func (f *filesystem) Mount(ctx context.Context, device string, flags fs.MountSourceFlags, data string, _ interface{}) (*fs.Inode, error) {
+//
+// dataObj may be a []host.BlockDevice containing host block devices to add to
+// the filesystem.
+func (f *filesystem) Mount(ctx context.Context, device string, flags fs.MountSourceFlags, data string, dataObj interface{}) (*fs.Inode, error) {
 	// device is always ignored.
 	// sysfs ignores data, see fs/sysfs/mount.c:sysfs_mount.
 
-	return New(ctx, fs.NewNonCachingMountSource(f, flags)), nil
+	var blockDevices []host.BlockDevice
+	if dataObj != nil {
+		var ok bool
+		if blockDevices, ok = dataObj.([]host.BlockDevice); !ok {
+			return nil, syserror.EINVAL
+		}
+	}
+
+	return New(ctx, fs.NewNonCachingMountSource(f, flags), blockDevices), nil
 }
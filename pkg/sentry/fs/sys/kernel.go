@@ -0,0 +1,51 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sys
+
+import (
+	"fmt"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+)
+
+// newTransparentHugepage returns /sys/kernel/mm/transparent_hugepage.
+//
+// The sentry ignores madvise(MADV_HUGEPAGE) and never collapses application
+// memory into huge pages itself, whatever the host does with the memory file,
+// so transparent huge pages are reported as disabled.
+func newTransparentHugepage(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
+	return sysfs.NewDir(ctx, msrc, map[string]*fs.Inode{
+		"defrag":         newStaticFile(ctx, msrc, "always defer defer+madvise madvise [never]\n"),
+		"enabled":        newStaticFile(ctx, msrc, "always madvise [never]\n"),
+		"hpage_pmd_size": newStaticFile(ctx, msrc, fmt.Sprintf("%d\n", usermem.HugePageSize)),
+		"khugepaged": sysfs.NewDir(ctx, msrc, map[string]*fs.Inode{
+			"defrag":          newStaticFile(ctx, msrc, "0\n"),
+			"full_scans":      newStaticFile(ctx, msrc, "0\n"),
+			"pages_collapsed": newStaticFile(ctx, msrc, "0\n"),
+		}),
+		"shmem_enabled": newStaticFile(ctx, msrc, "always within_size advise [never] deny force\n"),
+		"use_zero_page": newStaticFile(ctx, msrc, "0\n"),
+	})
+}
+
+func newKernelDir(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
+	return sysfs.NewDir(ctx, msrc, map[string]*fs.Inode{
+		"mm": sysfs.NewDir(ctx, msrc, map[string]*fs.Inode{
+			"transparent_hugepage": newTransparentHugepage(ctx, msrc),
+		}),
+	})
+}
@@ -0,0 +1,300 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sys
+
+import (
+	"bytes"
+	"fmt"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/kernfs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/inet"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+// Network interfaces are identified by name in sysfs: the directory of an
+// interface shows the current state of the interface with its name, and
+// attributes of interfaces that no longer exist fail with ENODEV.
+
+// findInterface returns the index and properties of the interface called
+// name.
+func findInterface(s inet.Stack, name string) (int32, inet.Interface, bool) {
+	for idx, i := range s.Interfaces() {
+		if i.Name == name {
+			return idx, i, true
+		}
+	}
+	return 0, inet.Interface{}, false
+}
+
+// netUevent returns the variables of the uevent file of the interface i with
+// index idx.
+func netUevent(i inet.Interface, idx int32) []string {
+	return []string{
+		"INTERFACE=" + i.Name,
+		fmt.Sprintf("IFINDEX=%d", idx),
+	}
+}
+
+// netAttrs are the attributes of a network interface backed by netAttr.
+var netAttrs = []string{
+	"addr_len",
+	"address",
+	"carrier",
+	"flags",
+	"ifindex",
+	"iflink",
+	"mtu",
+	"operstate",
+	"type",
+	"uevent",
+}
+
+// netAttr backs an attribute of a network interface. See Linux's
+// net/core/net-sysfs.c.
+//
+// +stateify savable
+type netAttr struct {
+	s    inet.Stack
+	name string
+	attr string
+}
+
+var _ kernfs.Generator = (*netAttr)(nil)
+
+// Generate implements kernfs.Generator.Generate.
+func (n *netAttr) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	idx, i, ok := findInterface(n.s, n.name)
+	if !ok {
+		return syserror.ENODEV
+	}
+	switch n.attr {
+	case "addr_len":
+		fmt.Fprintf(buf, "%d\n", len(i.Addr))
+	case "address":
+		for j, b := range i.Addr {
+			if j > 0 {
+				buf.WriteByte(':')
+			}
+			fmt.Fprintf(buf, "%02x", b)
+		}
+		buf.WriteByte('\n')
+	case "carrier":
+		if i.Flags&linux.IFF_UP == 0 {
+			return syserror.EINVAL
+		}
+		if i.Flags&linux.IFF_RUNNING != 0 {
+			buf.WriteString("1\n")
+		} else {
+			buf.WriteString("0\n")
+		}
+	case "flags":
+		fmt.Fprintf(buf, "%#x\n", i.Flags)
+	case "ifindex", "iflink":
+		fmt.Fprintf(buf, "%d\n", idx)
+	case "mtu":
+		fmt.Fprintf(buf, "%d\n", i.MTU)
+	case "operstate":
+		switch {
+		case i.Flags&linux.IFF_LOOPBACK != 0:
+			// The loopback device doesn't report its state.
+			buf.WriteString("unknown\n")
+		case i.Flags&linux.IFF_UP != 0 && i.Flags&linux.IFF_RUNNING != 0:
+			buf.WriteString("up\n")
+		default:
+			buf.WriteString("down\n")
+		}
+	case "type":
+		fmt.Fprintf(buf, "%d\n", i.DeviceType)
+	case "uevent":
+		buf.WriteString(ueventFile(netUevent(i, idx)))
+	}
+	return nil
+}
+
+// netStats are the statistics of a network interface, from
+// Documentation/ABI/testing/sysfs-class-net-statistics. Statistics not kept by
+// the stack are zero.
+var netStats = []string{
+	"collisions",
+	"multicast",
+	"rx_bytes",
+	"rx_compressed",
+	"rx_crc_errors",
+	"rx_dropped",
+	"rx_errors",
+	"rx_fifo_errors",
+	"rx_frame_errors",
+	"rx_length_errors",
+	"rx_missed_errors",
+	"rx_nohandler",
+	"rx_over_errors",
+	"rx_packets",
+	"tx_aborted_errors",
+	"tx_bytes",
+	"tx_carrier_errors",
+	"tx_compressed",
+	"tx_dropped",
+	"tx_errors",
+	"tx_fifo_errors",
+	"tx_heartbeat_errors",
+	"tx_packets",
+	"tx_window_errors",
+}
+
+// netStat backs a file in the statistics directory of a network interface.
+//
+// +stateify savable
+type netStat struct {
+	s    inet.Stack
+	name string
+	stat string
+}
+
+var _ kernfs.Generator = (*netStat)(nil)
+
+// Generate implements kernfs.Generator.Generate.
+func (n *netStat) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	idx, _, ok := findInterface(n.s, n.name)
+	if !ok {
+		return syserror.ENODEV
+	}
+	st := n.s.InterfaceStatistics()[idx]
+	var v uint64
+	switch n.stat {
+	case "rx_bytes":
+		v = st.RxBytes
+	case "rx_packets":
+		v = st.RxPackets
+	case "tx_bytes":
+		v = st.TxBytes
+	case "tx_dropped":
+		v = st.TxDropped
+	case "tx_packets":
+		v = st.TxPackets
+	}
+	fmt.Fprintf(buf, "%d\n", v)
+	return nil
+}
+
+// newNetQueues returns the queues directory of a network interface. Each
+// interface has a single receive and transmit queue, without receive packet
+// steering or transmit packet steering.
+func newNetQueues(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
+	numCPU := uint(1)
+	if k := kernel.KernelFromContext(ctx); k != nil {
+		numCPU = k.ApplicationCores()
+	}
+	noCPUs := cpuMask(1, 0, numCPU)
+	return sysfs.NewDir(ctx, msrc, map[string]*fs.Inode{
+		"rx-0": sysfs.NewDir(ctx, msrc, map[string]*fs.Inode{
+			"rps_cpus":     newStaticFile(ctx, msrc, noCPUs),
+			"rps_flow_cnt": newStaticFile(ctx, msrc, "0\n"),
+		}),
+		"tx-0": sysfs.NewDir(ctx, msrc, map[string]*fs.Inode{
+			"tx_maxrate": newStaticFile(ctx, msrc, "0\n"),
+			"tx_timeout": newStaticFile(ctx, msrc, "0\n"),
+			"xps_cpus":   newStaticFile(ctx, msrc, noCPUs),
+		}),
+	})
+}
+
+// netDevices provides the directories of network interfaces in
+// /sys/devices/virtual/net.
+//
+// +stateify savable
+type netDevices struct {
+	s inet.Stack
+}
+
+var _ kernfs.Revalidator = (*netDevices)(nil)
+
+// Lookup implements kernfs.DirSource.Lookup.
+func (n *netDevices) Lookup(ctx context.Context, dir *fs.Inode, name string) (*fs.Inode, error) {
+	if _, _, ok := findInterface(n.s, name); !ok {
+		return nil, syserror.ENOENT
+	}
+	msrc := dir.MountSource
+	contents := make(map[string]*fs.Inode, len(netAttrs)+2)
+	for _, attr := range netAttrs {
+		contents[attr] = sysfs.NewGeneratedFile(ctx, msrc, &netAttr{s: n.s, name: name, attr: attr})
+	}
+	stats := make(map[string]*fs.Inode, len(netStats))
+	for _, stat := range netStats {
+		stats[stat] = sysfs.NewGeneratedFile(ctx, msrc, &netStat{s: n.s, name: name, stat: stat})
+	}
+	contents["queues"] = newNetQueues(ctx, msrc)
+	contents["statistics"] = sysfs.NewDir(ctx, msrc, stats)
+	contents["tx_queue_len"] = newStaticFile(ctx, msrc, "1000\n")
+	return sysfs.NewDir(ctx, msrc, contents), nil
+}
+
+// Children implements kernfs.DirSource.Children.
+func (n *netDevices) Children(ctx context.Context) map[string]fs.DentAttr {
+	m := make(map[string]fs.DentAttr)
+	for _, i := range n.s.Interfaces() {
+		m[i.Name] = fs.GenericDentAttr(fs.SpecialDirectory, sysfs.Device())
+	}
+	return m
+}
+
+// Revalidate implements kernfs.Revalidator.Revalidate.
+func (n *netDevices) Revalidate(ctx context.Context, name string, child *fs.Inode) bool {
+	_, _, ok := findInterface(n.s, name)
+	return ok
+}
+
+// netClass provides the symlinks to the directories of network interfaces in
+// /sys/class/net.
+//
+// +stateify savable
+type netClass struct {
+	s inet.Stack
+}
+
+var _ kernfs.DirSource = (*netClass)(nil)
+
+// Lookup implements kernfs.DirSource.Lookup.
+func (n *netClass) Lookup(ctx context.Context, dir *fs.Inode, name string) (*fs.Inode, error) {
+	if _, _, ok := findInterface(n.s, name); !ok {
+		return nil, syserror.ENOENT
+	}
+	return sysfs.NewSymlink(ctx, dir.MountSource, "../../devices/virtual/net/"+name), nil
+}
+
+// Children implements kernfs.DirSource.Children.
+func (n *netClass) Children(ctx context.Context) map[string]fs.DentAttr {
+	m := make(map[string]fs.DentAttr)
+	for _, i := range n.s.Interfaces() {
+		m[i.Name] = fs.GenericDentAttr(fs.Symlink, sysfs.Device())
+	}
+	return m
+}
+
+// newNetDirs returns /sys/devices/virtual/net and /sys/class/net. They are
+// empty if there is no network stack.
+func newNetDirs(ctx context.Context, msrc *fs.MountSource) (devices, class *fs.Inode) {
+	var s inet.Stack
+	if k := kernel.KernelFromContext(ctx); k != nil {
+		s = k.NetworkStack()
+	}
+	if s == nil {
+		return sysfs.NewDir(ctx, msrc, nil), sysfs.NewDir(ctx, msrc, nil)
+	}
+	return sysfs.NewDynamicDir(ctx, msrc, nil, &netDevices{s: s}), sysfs.NewDynamicDir(ctx, msrc, nil, &netClass{s: s})
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sys
+
+import (
+	"bytes"
+	"fmt"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/kernfs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
+)
+
+// nodeMeminfo backs /sys/devices/system/node/node0/meminfo.
+//
+// +stateify savable
+type nodeMeminfo struct {
+	// k is the owning Kernel.
+	k *kernel.Kernel
+}
+
+var _ kernfs.Generator = (*nodeMeminfo)(nil)
+
+// Generate implements kernfs.Generator.Generate.
+func (n *nodeMeminfo) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	// All memory is on node 0, so this is a subset of /proc/meminfo.
+	mf := n.k.MemoryFile()
+	mf.UpdateUsage()
+	snapshot, totalUsage := usage.MemoryAccounting.Copy()
+	totalSize := usage.TotalMemory(mf.TotalSize(), totalUsage)
+	file := snapshot.PageCache + snapshot.Mapped
+
+	fmt.Fprintf(buf, "Node 0 MemTotal:       %8d kB\n", totalSize/1024)
+	fmt.Fprintf(buf, "Node 0 MemFree:        %8d kB\n", (totalSize-totalUsage)/1024)
+	fmt.Fprintf(buf, "Node 0 MemUsed:        %8d kB\n", totalUsage/1024)
+	fmt.Fprintf(buf, "Node 0 FilePages:      %8d kB\n", (file+snapshot.Tmpfs)/1024)
+	fmt.Fprintf(buf, "Node 0 Mapped:         %8d kB\n", snapshot.Mapped/1024)
+	fmt.Fprintf(buf, "Node 0 AnonPages:      %8d kB\n", snapshot.Anonymous/1024)
+	fmt.Fprintf(buf, "Node 0 Shmem:          %8d kB\n", snapshot.Tmpfs/1024)
+	return nil
+}
+
+// newNode returns /sys/devices/system/node. The sandbox has a single NUMA
+// node, node 0, containing all CPUs and memory, consistent with
+// get_mempolicy(2).
+func newNode(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
+	node0 := map[string]*fs.Inode{
+		"distance": newStaticFile(ctx, msrc, "10\n"),
+	}
+	if k := kernel.KernelFromContext(ctx); k != nil {
+		numCPU := k.ApplicationCores()
+		node0["cpulist"] = newStaticFile(ctx, msrc, cpuList(0, numCPU-1))
+		node0["cpumap"] = newStaticFile(ctx, msrc, cpuMask(0, numCPU-1, numCPU))
+		node0["meminfo"] = sysfs.NewGeneratedFile(ctx, msrc, &nodeMeminfo{k: k})
+	}
+
+	return sysfs.NewDir(ctx, msrc, map[string]*fs.Inode{
+		"has_cpu":           newStaticFile(ctx, msrc, "0\n"),
+		"has_memory":        newStaticFile(ctx, msrc, "0\n"),
+		"has_normal_memory": newStaticFile(ctx, msrc, "0\n"),
+		"node0":             sysfs.NewDir(ctx, msrc, node0),
+		"online":            newStaticFile(ctx, msrc, "0\n"),
+		"possible":          newStaticFile(ctx, msrc, "0\n"),
+	})
+}
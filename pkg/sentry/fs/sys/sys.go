@@ -18,47 +18,39 @@ package sys
 import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
-	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/ramfs"
-	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/host"
 )
 
-func newFile(node fs.InodeOperations, msrc *fs.MountSource) *fs.Inode {
-	sattr := fs.StableAttr{
-		DeviceID:  sysfsDevice.DeviceID(),
-		InodeID:   sysfsDevice.NextIno(),
-		BlockSize: usermem.PageSize,
-		Type:      fs.SpecialFile,
-	}
-	return fs.NewInode(node, msrc, sattr)
-}
+// New returns the root node of a partial simple sysfs. blockDevices are host
+// block devices to add to the filesystem.
+func New(ctx context.Context, msrc *fs.MountSource, blockDevices []host.BlockDevice) *fs.Inode {
+	devs := append(newMemDevices(), newBlockDevices(ctx, msrc, blockDevices)...)
+	t := newDeviceTree(ctx, msrc, devs)
+	netDevices, netClass := newNetDirs(ctx, msrc)
 
-func newDir(ctx context.Context, msrc *fs.MountSource, contents map[string]*fs.Inode) *fs.Inode {
-	d := ramfs.NewDir(ctx, contents, fs.RootOwner, fs.FilePermsFromMode(0555))
-	return fs.NewInode(d, msrc, fs.StableAttr{
-		DeviceID:  sysfsDevice.DeviceID(),
-		InodeID:   sysfsDevice.NextIno(),
-		BlockSize: usermem.PageSize,
-		Type:      fs.SpecialDirectory,
-	})
-}
-
-// New returns the root node of a partial simple sysfs.
-func New(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
-	return newDir(ctx, msrc, map[string]*fs.Inode{
+	return sysfs.NewDir(ctx, msrc, map[string]*fs.Inode{
 		// Add a basic set of top-level directories. In Linux, these
 		// are dynamically added depending on the KConfig. Here we just
 		// add the most common ones.
-		"block": newDir(ctx, msrc, nil),
-		"bus":   newDir(ctx, msrc, nil),
-		"class": newDir(ctx, msrc, map[string]*fs.Inode{
-			"power_supply": newDir(ctx, msrc, nil),
+		"block": sysfs.NewDir(ctx, msrc, t.block),
+		"bus":   sysfs.NewDir(ctx, msrc, nil),
+		"class": sysfs.NewDir(ctx, msrc, map[string]*fs.Inode{
+			"block":        t.classDir(ctx, msrc, "block"),
+			"mem":          t.classDir(ctx, msrc, "mem"),
+			"net":          netClass,
+			"power_supply": sysfs.NewDir(ctx, msrc, nil),
+		}),
+		"dev": sysfs.NewDir(ctx, msrc, map[string]*fs.Inode{
+			"block": sysfs.NewDir(ctx, msrc, t.devBlock),
+			"char":  sysfs.NewDir(ctx, msrc, t.devChar),
 		}),
-		"dev":      newDir(ctx, msrc, nil),
-		"devices":  newDevicesDir(ctx, msrc),
-		"firmware": newDir(ctx, msrc, nil),
-		"fs":       newDir(ctx, msrc, nil),
-		"kernel":   newDir(ctx, msrc, nil),
-		"module":   newDir(ctx, msrc, nil),
-		"power":    newDir(ctx, msrc, nil),
+		"devices": newDevicesDir(ctx, msrc, t.virtualDir(ctx, msrc, map[string]*fs.Inode{
+			"net": netDevices,
+		})),
+		"firmware": sysfs.NewDir(ctx, msrc, nil),
+		"fs":       sysfs.NewDir(ctx, msrc, nil),
+		"kernel":   newKernelDir(ctx, msrc),
+		"module":   sysfs.NewDir(ctx, msrc, nil),
+		"power":    sysfs.NewDir(ctx, msrc, nil),
 	})
 }
@@ -0,0 +1,75 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sys
+
+import (
+	"sort"
+	"strings"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+)
+
+// Device is a device in sysfs, as announced by uevents.
+type Device struct {
+	// Path is the path of the directory of the device relative to /sys,
+	// the DEVPATH of its uevents.
+	Path string
+
+	// Subsystem is the class of the device.
+	Subsystem string
+
+	// Env holds the variables of the uevent file of the device, as
+	// KEY=value strings.
+	Env []string
+}
+
+// ueventFile returns the contents of a uevent file with the variables env.
+func ueventFile(env []string) string {
+	return strings.Join(env, "\n") + "\n"
+}
+
+// Devices returns the devices of the mem and net classes. Block devices are
+// only known to the sysfs mounts they are passed to, so they aren't included.
+func Devices(ctx context.Context) []Device {
+	var devs []Device
+	for _, d := range newMemDevices() {
+		devs = append(devs, Device{
+			Path:      "/devices/virtual/" + d.class + "/" + d.name,
+			Subsystem: d.class,
+			Env:       d.uevent(),
+		})
+	}
+
+	k := kernel.KernelFromContext(ctx)
+	if k == nil || k.NetworkStack() == nil {
+		return devs
+	}
+	ifaces := k.NetworkStack().Interfaces()
+	idxs := make([]int, 0, len(ifaces))
+	for idx := range ifaces {
+		idxs = append(idxs, int(idx))
+	}
+	sort.Ints(idxs)
+	for _, idx := range idxs {
+		i := ifaces[int32(idx)]
+		devs = append(devs, Device{
+			Path:      "/devices/virtual/net/" + i.Name,
+			Subsystem: "net",
+			Env:       netUevent(i, int32(idx)),
+		})
+	}
+	return devs
+}
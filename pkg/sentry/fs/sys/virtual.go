@@ -0,0 +1,146 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sys
+
+import (
+	"fmt"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+)
+
+// virtualDevice describes a device in /sys/devices/virtual/<class>/<name>.
+// The device is also linked from /sys/class/<class>/<name> and from
+// /sys/dev/{block,char}/<major>:<minor>.
+type virtualDevice struct {
+	class string
+	name  string
+	block bool
+	major uint16
+	minor uint32
+
+	// attrs are the attributes of the device other than dev and uevent.
+	attrs map[string]*fs.Inode
+}
+
+// memDevices are the devices of the mem class provided by the sentry's
+// devtmpfs, see fs/dev.
+var memDevices = []struct {
+	name  string
+	minor uint32
+}{
+	{"null", 3},
+	{"zero", 5},
+	{"full", 7},
+	{"random", 8},
+	{"urandom", 9},
+	{"kmsg", 11},
+}
+
+// uevent returns the variables of the uevent file of the device.
+func (d *virtualDevice) uevent() []string {
+	env := []string{
+		fmt.Sprintf("MAJOR=%d", d.major),
+		fmt.Sprintf("MINOR=%d", d.minor),
+		"DEVNAME=" + d.name,
+	}
+	if d.block {
+		env = append(env, "DEVTYPE=disk")
+	}
+	return env
+}
+
+func newMemDevices() []virtualDevice {
+	devs := make([]virtualDevice, 0, len(memDevices))
+	for _, d := range memDevices {
+		devs = append(devs, virtualDevice{
+			class: "mem",
+			name:  d.name,
+			major: 1,
+			minor: d.minor,
+		})
+	}
+	return devs
+}
+
+// deviceTree holds the sysfs entries of a set of virtual devices.
+type deviceTree struct {
+	// virtual maps classes to the device directories in
+	// /sys/devices/virtual/<class>.
+	virtual map[string]map[string]*fs.Inode
+
+	// class maps classes to the symlinks in /sys/class/<class>.
+	class map[string]map[string]*fs.Inode
+
+	// block, devBlock and devChar are the symlinks in /sys/block,
+	// /sys/dev/block and /sys/dev/char.
+	block    map[string]*fs.Inode
+	devBlock map[string]*fs.Inode
+	devChar  map[string]*fs.Inode
+}
+
+func newDeviceTree(ctx context.Context, msrc *fs.MountSource, devs []virtualDevice) *deviceTree {
+	t := &deviceTree{
+		virtual:  make(map[string]map[string]*fs.Inode),
+		class:    make(map[string]map[string]*fs.Inode),
+		block:    make(map[string]*fs.Inode),
+		devBlock: make(map[string]*fs.Inode),
+		devChar:  make(map[string]*fs.Inode),
+	}
+	for _, d := range devs {
+		number := fmt.Sprintf("%d:%d", d.major, d.minor)
+		contents := map[string]*fs.Inode{
+			"dev":    newStaticFile(ctx, msrc, number+"\n"),
+			"uevent": newStaticFile(ctx, msrc, ueventFile(d.uevent())),
+		}
+		for name, attr := range d.attrs {
+			contents[name] = attr
+		}
+
+		if t.virtual[d.class] == nil {
+			t.virtual[d.class] = make(map[string]*fs.Inode)
+			t.class[d.class] = make(map[string]*fs.Inode)
+		}
+		t.virtual[d.class][d.name] = sysfs.NewDir(ctx, msrc, contents)
+
+		target := fmt.Sprintf("devices/virtual/%s/%s", d.class, d.name)
+		t.class[d.class][d.name] = sysfs.NewSymlink(ctx, msrc, "../../"+target)
+		if d.block {
+			t.block[d.name] = sysfs.NewSymlink(ctx, msrc, "../"+target)
+			t.devBlock[number] = sysfs.NewSymlink(ctx, msrc, "../../"+target)
+		} else {
+			t.devChar[number] = sysfs.NewSymlink(ctx, msrc, "../../"+target)
+		}
+	}
+	return t
+}
+
+// classDir returns the directory /sys/class/<class>.
+func (t *deviceTree) classDir(ctx context.Context, msrc *fs.MountSource, class string) *fs.Inode {
+	return sysfs.NewDir(ctx, msrc, t.class[class])
+}
+
+// virtualDir returns /sys/devices/virtual, including extra, which maps
+// classes to directories not in t.
+func (t *deviceTree) virtualDir(ctx context.Context, msrc *fs.MountSource, extra map[string]*fs.Inode) *fs.Inode {
+	m := make(map[string]*fs.Inode, len(t.virtual)+len(extra))
+	for class, devs := range t.virtual {
+		m[class] = sysfs.NewDir(ctx, msrc, devs)
+	}
+	for class, dir := range extra {
+		m[class] = dir
+	}
+	return sysfs.NewDir(ctx, msrc, m)
+}
@@ -17,8 +17,11 @@
 package timerfd
 
 import (
+	"fmt"
+	"sync"
 	"sync/atomic"
 
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/anon"
@@ -47,12 +50,67 @@ type TimerOperations struct {
 	// Readv, Preadv, or SetTime. val is accessed using atomic memory
 	// operations.
 	val uint64
+
+	// clockID is the ID of the clock c passed to NewFile.
+	clockID int32
+
+	// setFlags are the flags passed to the last call to SetTime. setFlags
+	// is accessed using atomic memory operations.
+	setFlags int32
+
+	// mu protects mightCancel and the registration of cancelEntry.
+	mu sync.Mutex `state:"nosave"`
+
+	// mightCancel is true if the timer was last armed with an absolute
+	// CLOCK_REALTIME expiration and TFD_TIMER_CANCEL_ON_SET, such that
+	// discontinuous changes to the clock cancel it. If mightCancel is true,
+	// cancelEntry is registered for ktime.ClockEventSet on the timer's
+	// clock.
+	mightCancel bool
+
+	// canceled is non-zero if the clock was set since the timer was armed
+	// with mightCancel, and the cancellation has not yet been reported by
+	// Read. canceled is accessed using atomic memory operations.
+	canceled uint32
+
+	// cancelEntry receives ktime.ClockEventSet events from the timer's
+	// clock.
+	cancelEntry waiter.Entry `state:"nosave"`
+}
+
+// cancelCallback implements waiter.EntryCallback for
+// TimerOperations.cancelEntry.
+type cancelCallback struct {
+	t *TimerOperations
+}
+
+// Callback implements waiter.EntryCallback.Callback.
+//
+// Callback is only called while cancelEntry is registered, i.e. while
+// mightCancel is true.
+func (c *cancelCallback) Callback(*waiter.Entry) {
+	t := c.t
+	atomic.StoreUint32(&t.canceled, 1)
+	// As in Linux, cancellation counts as an expiration so that the timerfd
+	// becomes readable.
+	atomic.AddUint64(&t.val, 1)
+	t.events.Notify(waiter.EventIn)
+}
+
+// afterLoad is invoked by stateify.
+func (t *TimerOperations) afterLoad() {
+	t.cancelEntry.Callback = &cancelCallback{t}
+	if t.mightCancel {
+		t.timer.Clock().EventRegister(&t.cancelEntry, ktime.ClockEventSet)
+	}
 }
 
-// NewFile returns a timerfd File that receives time from c.
-func NewFile(ctx context.Context, c ktime.Clock) *fs.File {
+// NewFile returns a timerfd File that receives time from c, the clock
+// identified by clockID.
+func NewFile(ctx context.Context, clockID int32, c ktime.Clock) *fs.File {
 	dirent := fs.NewDirent(anon.NewInode(ctx), "anon_inode:[timerfd]")
-	tops := &TimerOperations{}
+	tops := &TimerOperations{clockID: clockID}
+	tops.cancelEntry.Callback = &cancelCallback{tops}
 	tops.timer = ktime.NewTimer(c, tops)
 	// Timerfds reject writes, but the Write flag must be set in order to
 	// ensure that our Writev/Pwritev methods actually get called to return
@@ -62,6 +120,7 @@ func NewFile(ctx context.Context, c ktime.Clock) *fs.File {
 
 // Release implements fs.FileOperations.Release.
 func (t *TimerOperations) Release() {
+	t.setMightCancel(false)
 	t.timer.Destroy()
 }
 
@@ -88,9 +147,51 @@ func (t *TimerOperations) GetTime() (ktime.Time, ktime.Setting) {
 
 // SetTime atomically changes the associated Timer's setting, resets the number
 // of expirations to 0, and returns the previous setting and the time at which
-// it was observed.
-func (t *TimerOperations) SetTime(s ktime.Setting) (ktime.Time, ktime.Setting) {
-	return t.timer.SwapAnd(s, func() { atomic.StoreUint64(&t.val, 0) })
+// it was observed. flags are the flags passed to timerfd_settime(2).
+func (t *TimerOperations) SetTime(s ktime.Setting, flags int32) (ktime.Time, ktime.Setting) {
+	// "If the TFD_TIMER_CANCEL_ON_SET flag is specified along with
+	// TFD_TIMER_ABSTIME and the clock for this timer is CLOCK_REALTIME or
+	// CLOCK_REALTIME_ALARM, then mark this timer as cancelable if the
+	// real-time clock undergoes a discontinuous change" - timerfd_create(2)
+	t.setMightCancel(t.clockID == linux.CLOCK_REALTIME &&
+		flags&linux.TFD_TIMER_ABSTIME != 0 &&
+		flags&linux.TFD_TIMER_CANCEL_ON_SET != 0)
+	return t.timer.SwapAnd(s, func() {
+		atomic.StoreUint64(&t.val, 0)
+		atomic.StoreInt32(&t.setFlags, flags)
+	})
+}
+
+// setMightCancel sets t.mightCancel, (un)registering for clock events as
+// needed, and clears any pending cancellation.
+func (t *TimerOperations) setMightCancel(mightCancel bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if mightCancel != t.mightCancel {
+		t.mightCancel = mightCancel
+		if mightCancel {
+			t.timer.Clock().EventRegister(&t.cancelEntry, ktime.ClockEventSet)
+		} else {
+			// EventUnregister waits for concurrent calls to
+			// cancelCallback.Callback, so the store below can't be
+			// overwritten.
+			t.timer.Clock().EventUnregister(&t.cancelEntry)
+		}
+	}
+	atomic.StoreUint32(&t.canceled, 0)
+}
+
+// FdInfo implements fs.FdInfoer.FdInfo. It reports the timer's setting, as in
+// Linux's fs/timerfd.c:timerfd_show.
+func (t *TimerOperations) FdInfo(ctx context.Context) string {
+	tm, s := t.GetTime()
+	its := ktime.ItimerspecFromSetting(tm, s)
+	return fmt.Sprintf("clockid: %d\nticks: %d\nsettime flags: 0%o\nit_value: (%d, %d)\nit_interval: (%d, %d)\n",
+		t.clockID,
+		atomic.LoadUint64(&t.val),
+		atomic.LoadInt32(&t.setFlags),
+		its.Value.Sec, its.Value.Nsec,
+		its.Interval.Sec, its.Interval.Nsec)
 }
 
 // Readiness implements waiter.Waitable.Readiness.
@@ -118,6 +219,12 @@ func (t *TimerOperations) Read(ctx context.Context, file *fs.File, dst usermem.I
 	if dst.NumBytes() < sizeofUint64 {
 		return 0, syserror.EINVAL
 	}
+	if atomic.SwapUint32(&t.canceled, 0) != 0 {
+		// "If the associated clock is ... set ... then read(2) fails with
+		// the error ECANCELED." - timerfd_create(2)
+		atomic.StoreUint64(&t.val, 0)
+		return 0, syserror.ECANCELED
+	}
 	if val := atomic.SwapUint64(&t.val, 0); val != 0 {
 		var buf [sizeofUint64]byte
 		usermem.ByteOrder.PutUint64(buf[:], val)
@@ -54,5 +54,10 @@ func (r *regularFileOperations) Write(ctx context.Context, file *fs.File, src us
 
 // ConfigureMMap implements fs.FileOperations.ConfigureMMap.
 func (r *regularFileOperations) ConfigureMMap(ctx context.Context, file *fs.File, opts *memmap.MMapOpts) error {
+	if r.iops.hugetlb {
+		if err := r.iops.configureHugetlbMMap(opts); err != nil {
+			return err
+		}
+	}
 	return fsutil.GenericConfigureMMap(file, r.iops, opts)
 }
@@ -17,11 +17,15 @@ package tmpfs
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
 )
 
 const (
@@ -34,8 +38,13 @@ const (
 	// GID for the root directory.
 	rootGIDKey = "gid"
 
-	// TODO: support a tmpfs size limit.
-	// size = "size"
+	// Huge page size of a hugetlbfs mount. Only usermem.HugePageSize is
+	// supported.
+	pageSizeKey = "pagesize"
+
+	// Maximum size of file contents in a tmpfs mount, in bytes or as a
+	// percentage of total memory. 0 means unlimited.
+	sizeKey = "size"
 
 	// Permissions that exceed modeMask will be rejected.
 	modeMask = 01777
@@ -53,6 +62,7 @@ var _ fs.Filesystem = (*Filesystem)(nil)
 
 func init() {
 	fs.RegisterFilesystem(&Filesystem{})
+	fs.RegisterFilesystem(&HugetlbfsFilesystem{})
 }
 
 // FilesystemName is the name underwhich the filesystem is registered.
@@ -81,10 +91,152 @@ func (*Filesystem) Flags() fs.FilesystemFlags {
 	return 0
 }
 
+// Exportable implements fs.ExportableFilesystem.Exportable.
+func (*Filesystem) Exportable() {}
+
 // Mount returns a tmpfs root that can be positioned in the vfs.
 func (f *Filesystem) Mount(ctx context.Context, device string, flags fs.MountSourceFlags, data string, _ interface{}) (*fs.Inode, error) {
 	// device is always ignored.
+	return mount(ctx, f, flags, data, false /* hugetlb */)
+}
+
+// Remount implements fs.Remounter.Remount.
+//
+// As in Linux, only the size limit can be changed, and only on mounts that
+// were mounted with one. The mode, uid and gid options are ignored.
+func (*Filesystem) Remount(ctx context.Context, root *fs.Inode, data string) error {
+	d, ok := root.InodeOperations.(*Dir)
+	if !ok {
+		return fmt.Errorf("unexpected tmpfs root %T", root.InodeOperations)
+	}
+	options := fs.GenericMountSourceOptions(data)
+	delete(options, modeKey)
+	delete(options, rootUIDKey)
+	delete(options, rootGIDKey)
+
+	var (
+		size    uint64
+		setSize bool
+	)
+	if sz, ok := options[sizeKey]; ok {
+		var err error
+		if size, err = parseSize(ctx, sz); err != nil {
+			return fmt.Errorf("size value not parsable 'size=%s': %v", sz, err)
+		}
+		setSize = true
+		delete(options, sizeKey)
+	}
+	if len(options) > 0 {
+		return fmt.Errorf("unsupported mount options: %v", options)
+	}
+	if !setSize {
+		return nil
+	}
 
+	// Compare Linux's mm/shmem.c:shmem_reconfigure().
+	if d.limit == nil {
+		if size != 0 {
+			return fmt.Errorf("cannot retroactively limit size of unlimited tmpfs mount")
+		}
+		return nil
+	}
+	return d.limit.setLimit(size)
+}
+
+// HugetlbfsFilesystem is a hugetlbfs: a tmpfs whose files may only be
+// mapped, and whose memory is allocated in huge page units.
+//
+// +stateify savable
+type HugetlbfsFilesystem struct{}
+
+var _ fs.Filesystem = (*HugetlbfsFilesystem)(nil)
+
+// HugetlbfsFilesystemName is the name under which the hugetlbfs filesystem is
+// registered. Name matches fs/hugetlbfs/inode.c:hugetlbfs_fs_type.name.
+const HugetlbfsFilesystemName = "hugetlbfs"
+
+// Name is the name of the file system.
+func (*HugetlbfsFilesystem) Name() string {
+	return HugetlbfsFilesystemName
+}
+
+// AllowUserMount prohibits users from using mount(2) with this file system.
+//
+// In Linux, hugetlbfs does not set FS_USERNS_MOUNT.
+func (*HugetlbfsFilesystem) AllowUserMount() bool {
+	return false
+}
+
+// AllowUserList allows this filesystem to be listed in /proc/filesystems.
+func (*HugetlbfsFilesystem) AllowUserList() bool {
+	return true
+}
+
+// Flags returns that there is nothing special about this file system.
+func (*HugetlbfsFilesystem) Flags() fs.FilesystemFlags {
+	return 0
+}
+
+// Mount returns a hugetlbfs root that can be positioned in the vfs.
+func (f *HugetlbfsFilesystem) Mount(ctx context.Context, device string, flags fs.MountSourceFlags, data string, _ interface{}) (*fs.Inode, error) {
+	// device is always ignored.
+	return mount(ctx, f, flags, data, true /* hugetlb */)
+}
+
+// parsePageSize parses a size, such as a hugetlbfs pagesize option, which may
+// carry a K, M or G suffix as for Linux's lib/cmdline.c:memparse().
+func parsePageSize(s string) (uint64, error) {
+	shift := uint(0)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'k', 'K':
+			shift = 10
+		case 'm', 'M':
+			shift = 20
+		case 'g', 'G':
+			shift = 30
+		}
+		if shift != 0 {
+			s = s[:n-1]
+		}
+	}
+	v, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return 0, err
+	}
+	return v << shift, nil
+}
+
+// parseSize parses a tmpfs size option, which is either a size in bytes as for
+// parsePageSize or a percentage of total memory, rounded up to a page
+// boundary. Compare Linux's mm/shmem.c:shmem_parse_one().
+func parseSize(ctx context.Context, s string) (uint64, error) {
+	var size uint64
+	if strings.HasSuffix(s, "%") {
+		pct, err := strconv.ParseUint(s[:len(s)-1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		total := usage.MinimumTotalMemoryBytes
+		if k := kernel.KernelFromContext(ctx); k != nil {
+			total = usage.TotalMemory(k.MemoryFile().TotalSize(), 0)
+		}
+		size = total / 100 * pct
+	} else {
+		var err error
+		if size, err = parsePageSize(s); err != nil {
+			return 0, err
+		}
+	}
+	end, ok := usermem.Addr(size).RoundUp()
+	if !ok {
+		return 0, fmt.Errorf("size %d overflows", size)
+	}
+	return uint64(end), nil
+}
+
+// mount returns a tmpfs or hugetlbfs root, depending on hugetlb.
+func mount(ctx context.Context, f fs.Filesystem, flags fs.MountSourceFlags, data string, hugetlb bool) (*fs.Inode, error) {
 	// Parse generic comma-separated key=value options, this file system expects them.
 	options := fs.GenericMountSourceOptions(data)
 
@@ -122,6 +274,31 @@ func (f *Filesystem) Mount(ctx context.Context, device string, flags fs.MountSou
 		delete(options, rootGIDKey)
 	}
 
+	if hugetlb {
+		if ps, ok := options[pageSizeKey]; ok {
+			size, err := parsePageSize(ps)
+			if err != nil {
+				return nil, fmt.Errorf("pagesize value not parsable 'pagesize=%s': %v", ps, err)
+			}
+			if size != usermem.HugePageSize {
+				return nil, fmt.Errorf("unsupported pagesize %q: only %d is supported", ps, usermem.HugePageSize)
+			}
+			delete(options, pageSizeKey)
+		}
+	}
+
+	var limit *sizeLimit
+	if sz, ok := options[sizeKey]; ok && !hugetlb {
+		size, err := parseSize(ctx, sz)
+		if err != nil {
+			return nil, fmt.Errorf("size value not parsable 'size=%s': %v", sz, err)
+		}
+		if size != 0 {
+			limit = &sizeLimit{limit: size}
+		}
+		delete(options, sizeKey)
+	}
+
 	// Fail if the caller passed us more options than we can parse. They may be
 	// expecting us to set something we can't set.
 	if len(options) > 0 {
@@ -131,6 +308,6 @@ func (f *Filesystem) Mount(ctx context.Context, device string, flags fs.MountSou
 	// Construct a mount which will cache dirents.
 	msrc := fs.NewCachingMountSource(f, flags)
 
-	// Construct the tmpfs root.
-	return NewDir(ctx, nil, owner, perms, msrc), nil
+	// Construct the root.
+	return newDir(ctx, nil, owner, perms, msrc, hugetlb, limit), nil
 }
@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/log"
 	"gvisor.googlesource.com/gvisor/pkg/metric"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
@@ -102,6 +103,17 @@ type fileInodeOperations struct {
 	//
 	// Protected by dataMu.
 	seals uint32
+
+	// hugetlb is true if this is a hugetlbfs file. hugetlbfs files may not be
+	// written with write(2), their size is always a multiple of
+	// usermem.HugePageSize, and their memory is allocated in huge page
+	// units. hugetlb is immutable.
+	hugetlb bool
+
+	// limit is the size limit of the mount containing the file, or nil if
+	// the mount has no size limit. Memory allocated to store the file's
+	// contents is charged against limit. limit is immutable.
+	limit *sizeLimit
 }
 
 var _ fs.InodeOperations = (*fileInodeOperations)(nil)
@@ -140,9 +152,38 @@ func NewMemfdInode(ctx context.Context, allowSeals bool) *fs.Inode {
 func (f *fileInodeOperations) Release(context.Context) {
 	f.dataMu.Lock()
 	defer f.dataMu.Unlock()
+	if f.limit != nil {
+		f.limit.uncharge(f.data.Span())
+	}
 	f.data.DropAll(f.kernel.MemoryFile())
 }
 
+// charge charges n bytes of memory to be allocated for the file's contents
+// against the file's size limit. It returns false if this would exceed the
+// limit.
+func (f *fileInodeOperations) charge(n uint64) bool {
+	return f.limit == nil || f.limit.charge(n)
+}
+
+// uncharge reverses a previous call to charge(n).
+func (f *fileInodeOperations) uncharge(n uint64) {
+	if f.limit != nil {
+		f.limit.uncharge(n)
+	}
+}
+
+// gapBytesLocked returns the number of bytes in mr that are not backed by
+// memory.
+//
+// Preconditions: f.dataMu must be locked.
+func (f *fileInodeOperations) gapBytesLocked(mr memmap.MappableRange) uint64 {
+	var n uint64
+	for gap := f.data.LowerBoundGap(mr.Start); gap.Ok() && gap.Start() < mr.End; gap = gap.NextGap() {
+		n += gap.Range().Intersect(mr).Length()
+	}
+	return n
+}
+
 // Mappable implements fs.InodeOperations.Mappable.
 func (f *fileInodeOperations) Mappable(*fs.Inode) memmap.Mappable {
 	return f
@@ -210,6 +251,11 @@ func (f *fileInodeOperations) Truncate(ctx context.Context, _ *fs.Inode, size in
 	f.attrMu.Lock()
 	defer f.attrMu.Unlock()
 
+	// Compare Linux's fs/hugetlbfs/inode.c:hugetlbfs_setattr().
+	if f.hugetlb && size%usermem.HugePageSize != 0 {
+		return syserror.EINVAL
+	}
+
 	f.dataMu.Lock()
 	oldSize := f.attr.Size
 
@@ -254,7 +300,14 @@ func (f *fileInodeOperations) Truncate(ctx context.Context, _ *fs.Inode, size in
 	// and can remove them.
 	f.dataMu.Lock()
 	defer f.dataMu.Unlock()
+	var before uint64
+	if f.limit != nil {
+		before = f.data.Span()
+	}
 	f.data.Truncate(uint64(size), f.kernel.MemoryFile())
+	if f.limit != nil {
+		f.limit.uncharge(before - f.data.Span())
+	}
 
 	return nil
 }
@@ -286,7 +339,10 @@ func (*fileInodeOperations) IsVirtual() bool {
 }
 
 // StatFS implements fs.InodeOperations.StatFS.
-func (*fileInodeOperations) StatFS(context.Context) (fs.Info, error) {
+func (f *fileInodeOperations) StatFS(context.Context) (fs.Info, error) {
+	if f.limit != nil {
+		return f.limit.info(), nil
+	}
 	return fsInfo, nil
 }
 
@@ -331,6 +387,13 @@ func (f *fileInodeOperations) read(ctx context.Context, file *fs.File, dst userm
 }
 
 func (f *fileInodeOperations) write(ctx context.Context, src usermem.IOSequence, offset int64) (int64, error) {
+	// hugetlbfs files can only be modified through mappings. Compare Linux's
+	// fs/hugetlbfs/inode.c:hugetlbfs_file_operations, which has no write
+	// operation.
+	if f.hugetlb {
+		return 0, syserror.EINVAL
+	}
+
 	// Zero length writes for tmpfs are no-ops.
 	if src.NumBytes() == 0 {
 		return 0, nil
@@ -492,8 +555,12 @@ func (rw *fileReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64, error)
 		case gap.Ok():
 			// Allocate memory for the write.
 			gapMR := gap.Range().Intersect(pgMR)
+			if !rw.f.charge(gapMR.Length()) {
+				return done, syserror.ENOSPC
+			}
 			fr, err := mf.Allocate(gapMR.Length(), rw.f.memUsage)
 			if err != nil {
+				rw.f.uncharge(gapMR.Length())
 				return done, err
 			}
 
@@ -559,6 +626,13 @@ func (f *fileInodeOperations) CopyMapping(ctx context.Context, ms memmap.Mapping
 	return f.AddMapping(ctx, ms, dstAR, offset, writable)
 }
 
+// Residency implements memmap.ResidencyMappable.Residency.
+func (f *fileInodeOperations) Residency(ctx context.Context, mr memmap.MappableRange, dst []byte) error {
+	f.dataMu.RLock()
+	defer f.dataMu.RUnlock()
+	return f.data.Residency(mr, f.kernel.MemoryFile(), dst)
+}
+
 // Translate implements memmap.Mappable.Translate.
 func (f *fileInodeOperations) Translate(ctx context.Context, required, optional memmap.MappableRange, at usermem.AccessType) ([]memmap.Translation, error) {
 	f.dataMu.Lock()
@@ -579,11 +653,43 @@ func (f *fileInodeOperations) Translate(ctx context.Context, required, optional
 		optional.End = pgend
 	}
 
+	// hugetlbfs files are allocated in whole huge pages. f.attr.Size is
+	// huge-page-aligned, so this never extends past pgend.
+	if f.hugetlb {
+		required.Start = required.Start &^ (usermem.HugePageSize - 1)
+		required.End = hugeRoundUp(required.End)
+		if optional.Start > required.Start {
+			optional.Start = required.Start
+		}
+		if optional.End < required.End {
+			optional.End = required.End
+		}
+	}
+
+	// Charge memory allocated for the translation against the size limit.
+	// Only allocate required pages, so that optional ones aren't charged.
+	var charged uint64
+	if f.limit != nil {
+		optional = required
+		charged = f.gapBytesLocked(required)
+		if !f.limit.charge(charged) {
+			return nil, &memmap.BusError{syserror.ENOSPC}
+		}
+	}
+
 	mf := f.kernel.MemoryFile()
+	var allocated bool
+	var allocatedBytes uint64
 	cerr := f.data.Fill(ctx, required, optional, mf, f.memUsage, func(_ context.Context, dsts safemem.BlockSeq, _ uint64) (uint64, error) {
 		// Newly-allocated pages are zeroed, so we don't need to do anything.
+		allocated = true
+		allocatedBytes += dsts.NumBytes()
 		return dsts.NumBytes(), nil
 	})
+	f.uncharge(charged - allocatedBytes)
+	if f.hugetlb && allocated {
+		f.adviseHugePagesLocked(required)
+	}
 
 	var ts []memmap.Translation
 	var translatedEnd uint64
@@ -609,6 +715,59 @@ func (f *fileInodeOperations) Translate(ctx context.Context, required, optional
 	return ts, nil
 }
 
+// configureHugetlbMMap adjusts opts for a mapping of a hugetlbfs file, as for
+// Linux's fs/hugetlbfs/inode.c:hugetlbfs_file_mmap().
+//
+// Preconditions: f.hugetlb is true.
+func (f *fileInodeOperations) configureHugetlbMMap(opts *memmap.MMapOpts) error {
+	if opts.Offset%usermem.HugePageSize != 0 {
+		return syserror.EINVAL
+	}
+	length := hugeRoundUp(opts.Length)
+	end := opts.Offset + length
+	if length < opts.Length || end < opts.Offset || int64(end) < 0 {
+		return syserror.ENOMEM
+	}
+	opts.Length = length
+	opts.Hugetlb = true
+
+	// Writable mappings extend the file to cover the mapping.
+	if opts.Perms.Write {
+		f.attrMu.Lock()
+		f.dataMu.Lock()
+		if f.attr.Size < int64(end) {
+			f.attr.Size = int64(end)
+		}
+		f.dataMu.Unlock()
+		f.attrMu.Unlock()
+	}
+	return nil
+}
+
+// hugeRoundUp returns off rounded up to a multiple of usermem.HugePageSize.
+func hugeRoundUp(off uint64) uint64 {
+	return (off + usermem.HugePageSize - 1) &^ (usermem.HugePageSize - 1)
+}
+
+// adviseHugePagesLocked asks the host to back the huge-page-aligned parts of
+// the memory storing mr with huge pages. Failure is not fatal; the file is
+// then backed by small pages.
+//
+// Preconditions: f.dataMu must be locked.
+func (f *fileInodeOperations) adviseHugePagesLocked(mr memmap.MappableRange) {
+	mf := f.kernel.MemoryFile()
+	for seg := f.data.LowerBoundSegment(mr.Start); seg.Ok() && seg.Start() < mr.End; seg = seg.NextSegment() {
+		fr := seg.FileRange()
+		if fr.Start%usermem.HugePageSize != 0 || fr.End%usermem.HugePageSize != 0 {
+			continue
+		}
+		if err := mf.AdviseHugePages(fr); err != nil {
+			log.Debugf("Failed to advise huge pages for %v: %v", fr, err)
+			return
+		}
+	}
+}
+
 // InvalidateUnsavable implements memmap.Mappable.InvalidateUnsavable.
 func (f *fileInodeOperations) InvalidateUnsavable(ctx context.Context) error {
 	return nil
@@ -652,3 +811,32 @@ func AddSeals(inode *fs.Inode, val uint32) error {
 	// Not a memfd inode.
 	return syserror.EINVAL
 }
+
+// immutableSeals are the seals that prevent any change to the contents of a
+// memfd.
+const immutableSeals = linux.F_SEAL_WRITE | linux.F_SEAL_SHRINK | linux.F_SEAL_GROW
+
+// CopySealed writes the contents of a memfd inode to w and returns the seals
+// on the inode. Since a copy is only indistinguishable from the original if
+// neither can change, the inode must be sealed against writes, shrinking and
+// growing; otherwise CopySealed returns EPERM.
+func CopySealed(inode *fs.Inode, w io.Writer) (uint32, error) {
+	f, ok := inode.InodeOperations.(*fileInodeOperations)
+	if !ok {
+		// Not a memfd inode.
+		return 0, syserror.EINVAL
+	}
+
+	f.dataMu.RLock()
+	seals := f.seals
+	f.dataMu.RUnlock()
+	if seals&immutableSeals != immutableSeals {
+		return 0, syserror.EPERM
+	}
+
+	// Seals can't be removed, so the contents can't change from here on.
+	if _, err := io.Copy(w, safemem.ToIOReader{Reader: &fileReadWriter{f, 0}}); err != nil {
+		return 0, err
+	}
+	return seals, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmpfs
+
+import (
+	"sync"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+// sizeLimit limits the memory used by the contents of files in a tmpfs mount,
+// as configured by the size mount option. It is shared by all inodes in the
+// mount.
+//
+// +stateify savable
+type sizeLimit struct {
+	mu sync.Mutex `state:"nosave"`
+
+	// limit is the maximum number of bytes of file contents in the mount. If
+	// limit is 0, the mount is unlimited, as in Linux. limit is protected by
+	// mu.
+	limit uint64
+
+	// used is the number of bytes of file contents in the mount. used is
+	// protected by mu.
+	used uint64
+}
+
+// charge accounts for the allocation of n bytes of file contents. It returns
+// false, without charging, if doing so would exceed the limit.
+func (l *sizeLimit) charge(n uint64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit != 0 && (l.used+n < l.used || l.used+n > l.limit) {
+		return false
+	}
+	l.used += n
+	return true
+}
+
+// uncharge accounts for the release of n bytes of file contents.
+func (l *sizeLimit) uncharge(n uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n > l.used {
+		panic("tmpfs size limit underflow")
+	}
+	l.used -= n
+}
+
+// setLimit changes the limit. As in Linux, the limit may not be reduced
+// below the memory already in use.
+func (l *sizeLimit) setLimit(limit uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if limit != 0 && limit < l.used {
+		return syserror.EINVAL
+	}
+	l.limit = limit
+	return nil
+}
+
+// info returns fsInfo with block counts reflecting the limit.
+func (l *sizeLimit) info() fs.Info {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	info := fsInfo
+	if l.limit != 0 {
+		info.TotalBlocks = l.limit / usermem.PageSize
+		info.FreeBlocks = (l.limit - l.used) / usermem.PageSize
+	}
+	return info
+}
@@ -32,7 +32,16 @@ import (
 var fsInfo = fs.Info{
 	Type: linux.TMPFS_MAGIC,
 
-	// TODO: allow configuring a tmpfs size and enforce it.
+	// Like Linux without a size= mount option, report no block limits.
+	// Mounts with a size limit report it instead; see sizeLimit.info.
+	TotalBlocks: 0,
+	FreeBlocks:  0,
+}
+
+var hugetlbfsInfo = fs.Info{
+	Type: linux.HUGETLBFS_MAGIC,
+
+	// Like Linux without a size= mount option, report no block limits.
 	TotalBlocks: 0,
 	FreeBlocks:  0,
 }
@@ -76,24 +85,45 @@ type Dir struct {
 
 	// kernel is used to allocate memory as storage for tmpfs Files.
 	kernel *kernel.Kernel
+
+	// hugetlb is true if this directory belongs to a hugetlbfs mount, in
+	// which case files created in it are hugetlbfs files.
+	hugetlb bool
+
+	// limit is the size limit of the mount containing this directory, or nil
+	// if the mount has no size limit. limit is shared with files created in
+	// this directory.
+	limit *sizeLimit
 }
 
 var _ fs.InodeOperations = (*Dir)(nil)
 
 // NewDir returns a new directory.
 func NewDir(ctx context.Context, contents map[string]*fs.Inode, owner fs.FileOwner, perms fs.FilePermissions, msrc *fs.MountSource) *fs.Inode {
+	return newDir(ctx, contents, owner, perms, msrc, false /* hugetlb */, nil /* limit */)
+}
+
+// newDir returns a new tmpfs or hugetlbfs directory. If limit is not nil,
+// files in the directory are subject to it.
+func newDir(ctx context.Context, contents map[string]*fs.Inode, owner fs.FileOwner, perms fs.FilePermissions, msrc *fs.MountSource, hugetlb bool, limit *sizeLimit) *fs.Inode {
 	d := &Dir{
 		ramfsDir: ramfs.NewDir(ctx, contents, owner, perms),
 		kernel:   kernel.KernelFromContext(ctx),
+		hugetlb:  hugetlb,
+		limit:    limit,
 	}
 
 	// Manually set the CreateOps.
 	d.ramfsDir.CreateOps = d.newCreateOps()
 
+	blockSize := int64(usermem.PageSize)
+	if hugetlb {
+		blockSize = usermem.HugePageSize
+	}
 	return fs.NewInode(d, msrc, fs.StableAttr{
 		DeviceID:  tmpfsDevice.DeviceID(),
 		InodeID:   tmpfsDevice.NextIno(),
-		BlockSize: usermem.PageSize,
+		BlockSize: blockSize,
 		Type:      fs.Directory,
 	})
 }
@@ -208,7 +238,7 @@ func (d *Dir) SetTimestamps(ctx context.Context, i *fs.Inode, ts fs.TimeSpec) er
 func (d *Dir) newCreateOps() *ramfs.CreateOps {
 	return &ramfs.CreateOps{
 		NewDir: func(ctx context.Context, dir *fs.Inode, perms fs.FilePermissions) (*fs.Inode, error) {
-			return NewDir(ctx, nil, fs.FileOwnerFromContext(ctx), perms, dir.MountSource), nil
+			return newDir(ctx, nil, fs.FileOwnerFromContext(ctx), perms, dir.MountSource, d.hugetlb, d.limit), nil
 		},
 		NewFile: func(ctx context.Context, dir *fs.Inode, perms fs.FilePermissions) (*fs.Inode, error) {
 			uattr := fs.WithCurrentTime(ctx, fs.UnstableAttr{
@@ -218,10 +248,16 @@ func (d *Dir) newCreateOps() *ramfs.CreateOps {
 				Links: 0,
 			})
 			iops := NewInMemoryFile(ctx, usage.Tmpfs, uattr)
+			iops.(*fileInodeOperations).limit = d.limit
+			blockSize := int64(usermem.PageSize)
+			if d.hugetlb {
+				iops.(*fileInodeOperations).hugetlb = true
+				blockSize = usermem.HugePageSize
+			}
 			return fs.NewInode(iops, dir.MountSource, fs.StableAttr{
 				DeviceID:  tmpfsDevice.DeviceID(),
 				InodeID:   tmpfsDevice.NextIno(),
-				BlockSize: usermem.PageSize,
+				BlockSize: blockSize,
 				Type:      fs.RegularFile,
 			}), nil
 		},
@@ -243,7 +279,13 @@ func (d *Dir) Rename(ctx context.Context, oldParent *fs.Inode, oldName string, n
 }
 
 // StatFS implments fs.InodeOperations.StatFS.
-func (*Dir) StatFS(context.Context) (fs.Info, error) {
+func (d *Dir) StatFS(context.Context) (fs.Info, error) {
+	if d.hugetlb {
+		return hugetlbfsInfo, nil
+	}
+	if d.limit != nil {
+		return d.limit.info(), nil
+	}
 	return fsInfo, nil
 }
 
@@ -73,6 +73,12 @@ const (
 //  termiosMu
 //    inQueue.mu
 //      outQueue.mu
+//        ctrlMu
+//    sizeMu
+//      Terminal.jobMu
+//
+// Terminal.jobMu may also be acquired while holding inQueue.mu, in order to
+// signal the foreground process group.
 //
 // +stateify savable
 type lineDiscipline struct {
@@ -103,6 +109,26 @@ type lineDiscipline struct {
 
 	// slaveWaiter is used to wait on the slave end of the TTY.
 	slaveWaiter waiter.Queue `state:"zerovalue"`
+
+	// terminal is the Terminal whose I/O is handled by this
+	// lineDiscipline. It is used to send job control signals to the
+	// foreground process group, and may be nil if the lineDiscipline is
+	// not part of a Terminal.
+	terminal *Terminal
+
+	// ctrlMu protects packet, packetStatus and stopped.
+	ctrlMu sync.Mutex `state:"nosave"`
+
+	// packet is true if the master end is in packet mode (TIOCPKT).
+	packet bool
+
+	// packetStatus is the set of pending TIOCPKT_* status bits, which are
+	// returned by the next read of the master in packet mode.
+	packetStatus uint8
+
+	// stopped is true if output has been suspended by the VSTOP character
+	// (see IXON in termios(3)).
+	stopped bool
 }
 
 func newLineDiscipline(termios linux.KernelTermios) *lineDiscipline {
@@ -129,13 +155,32 @@ func (l *lineDiscipline) setTermios(ctx context.Context, io usermem.IO, args arc
 	l.termiosMu.Lock()
 	defer l.termiosMu.Unlock()
 	oldCanonEnabled := l.termios.LEnabled(linux.ICANON)
+	oldIXON := l.termios.IEnabled(linux.IXON)
+	oldFlow := l.flowControlLocked()
 	// We must copy a Termios struct, not KernelTermios.
 	var t linux.Termios
-	_, err := usermem.CopyObjectIn(ctx, io, args[2].Pointer(), &t, usermem.IOOpts{
+	if _, err := usermem.CopyObjectIn(ctx, io, args[2].Pointer(), &t, usermem.IOOpts{
 		AddressSpaceActive: true,
-	})
+	}); err != nil {
+		return 0, err
+	}
 	l.termios.FromTermios(t)
 
+	// Report changes to XON/XOFF flow control to a master in packet mode.
+	// See drivers/tty/pty.c:pty_set_termios.
+	if newFlow := l.flowControlLocked(); newFlow != oldFlow {
+		if newFlow {
+			l.setPacketStatus(linux.TIOCPKT_DOSTOP, linux.TIOCPKT_NOSTOP)
+		} else {
+			l.setPacketStatus(linux.TIOCPKT_NOSTOP, linux.TIOCPKT_DOSTOP)
+		}
+	}
+
+	// Disabling IXON restarts output stopped by VSTOP.
+	if oldIXON && !l.termios.IEnabled(linux.IXON) {
+		l.startOutput()
+	}
+
 	// If canonical mode is turned off, move bytes from inQueue's wait
 	// buffer to its read buffer. Anything already in the read buffer is
 	// now readable.
@@ -145,7 +190,25 @@ func (l *lineDiscipline) setTermios(ctx context.Context, io usermem.IO, args arc
 		l.slaveWaiter.Notify(waiter.EventIn)
 	}
 
-	return 0, err
+	return 0, nil
+}
+
+// flowControlLocked returns true if the terminal uses the standard XON/XOFF
+// characters for flow control.
+//
+// Preconditions: l.termiosMu must be held.
+func (l *lineDiscipline) flowControlLocked() bool {
+	return l.termios.IEnabled(linux.IXON) &&
+		l.termios.ControlCharacters[linux.VSTOP] == linux.ControlCharacter('S') &&
+		l.termios.ControlCharacters[linux.VSTART] == linux.ControlCharacter('Q')
+}
+
+// lEnabled returns whether the given local flag is set in the terminal's
+// termios.
+func (l *lineDiscipline) lEnabled(flag uint32) bool {
+	l.termiosMu.RLock()
+	defer l.termiosMu.RUnlock()
+	return l.termios.LEnabled(flag)
 }
 
 func (l *lineDiscipline) windowSize(ctx context.Context, io usermem.IO, args arch.SyscallArguments) error {
@@ -160,16 +223,41 @@ func (l *lineDiscipline) windowSize(ctx context.Context, io usermem.IO, args arc
 func (l *lineDiscipline) setWindowSize(ctx context.Context, io usermem.IO, args arch.SyscallArguments) error {
 	l.sizeMu.Lock()
 	defer l.sizeMu.Unlock()
-	_, err := usermem.CopyObjectIn(ctx, io, args[2].Pointer(), &l.size, usermem.IOOpts{
+	var size linux.WindowSize
+	if _, err := usermem.CopyObjectIn(ctx, io, args[2].Pointer(), &size, usermem.IOOpts{
 		AddressSpaceActive: true,
-	})
-	return err
+	}); err != nil {
+		return err
+	}
+
+	// Like Linux, only notify the foreground process group if the size
+	// actually changed. See drivers/tty/tty_io.c:tty_do_resize.
+	if size == l.size {
+		return nil
+	}
+	l.size = size
+	if l.terminal != nil {
+		l.terminal.signalForeground(linux.SIGWINCH)
+	}
+	return nil
 }
 
 func (l *lineDiscipline) masterReadiness() waiter.EventMask {
+	l.ctrlMu.Lock()
+	pending := l.packet && l.packetStatus != 0
+	stopped := l.stopped
+	l.ctrlMu.Unlock()
+
 	// We don't have to lock a termios because the default master termios
 	// is immutable.
-	return l.inQueue.writeReadiness(&linux.MasterTermios) | l.outQueue.readReadiness(&linux.MasterTermios)
+	mask := l.inQueue.writeReadiness(&linux.MasterTermios)
+	if !stopped {
+		mask |= l.outQueue.readReadiness(&linux.MasterTermios)
+	}
+	if pending {
+		mask |= waiter.EventIn | waiter.EventPri
+	}
+	return mask
 }
 
 func (l *lineDiscipline) slaveReadiness() waiter.EventMask {
@@ -220,16 +308,49 @@ func (l *lineDiscipline) outputQueueReadSize(ctx context.Context, io usermem.IO,
 func (l *lineDiscipline) outputQueueRead(ctx context.Context, dst usermem.IOSequence) (int64, error) {
 	l.termiosMu.RLock()
 	defer l.termiosMu.RUnlock()
-	n, pushed, err := l.outQueue.read(ctx, dst, l)
+
+	l.ctrlMu.Lock()
+	packet := l.packet
+	if packet && l.packetStatus != 0 {
+		// In packet mode, pending status is returned by itself in
+		// place of data. See drivers/tty/n_tty.c:n_tty_read.
+		defer l.ctrlMu.Unlock()
+		if _, err := dst.CopyOut(ctx, []byte{l.packetStatus}); err != nil {
+			return 0, err
+		}
+		l.packetStatus = 0
+		return 1, nil
+	}
+	stopped := l.stopped
+	l.ctrlMu.Unlock()
+
+	if stopped {
+		return 0, syserror.ErrWouldBlock
+	}
+
+	// In packet mode, data is preceded by a TIOCPKT_DATA byte.
+	var hdr int64
+	data := dst
+	if packet {
+		hdr = 1
+		data = dst.DropFirst(1)
+	}
+
+	n, pushed, err := l.outQueue.read(ctx, data, l)
 	if err != nil {
 		return 0, err
 	}
 	if n > 0 {
+		if packet {
+			if _, err := dst.CopyOut(ctx, []byte{linux.TIOCPKT_DATA}); err != nil {
+				return 0, err
+			}
+		}
 		l.slaveWaiter.Notify(waiter.EventOut)
 		if pushed {
 			l.masterWaiter.Notify(waiter.EventIn)
 		}
-		return n, nil
+		return hdr + n, nil
 	}
 	return 0, syserror.ErrWouldBlock
 }
@@ -248,6 +369,121 @@ func (l *lineDiscipline) outputQueueWrite(ctx context.Context, src usermem.IOSeq
 	return 0, syserror.ErrWouldBlock
 }
 
+// flush implements TCFLSH for the slave end if slave is true, or the master
+// end otherwise. TCIFLUSH discards data received but not yet read by that end,
+// and TCOFLUSH discards data written by that end but not yet read by the
+// other.
+func (l *lineDiscipline) flush(arg int32, slave bool) error {
+	var in, out bool
+	switch arg {
+	case linux.TCIFLUSH:
+		in = true
+	case linux.TCOFLUSH:
+		out = true
+	case linux.TCIOFLUSH:
+		in, out = true, true
+	default:
+		return syserror.EINVAL
+	}
+
+	readQueue, writeQueue := &l.inQueue, &l.outQueue
+	if !slave {
+		readQueue, writeQueue = &l.outQueue, &l.inQueue
+	}
+	var status uint8
+	if in {
+		readQueue.flush()
+		status |= linux.TIOCPKT_FLUSHREAD
+	}
+	if out {
+		writeQueue.flush()
+		status |= linux.TIOCPKT_FLUSHWRITE
+	}
+
+	// Flushes of the slave are reported to a master in packet mode. See
+	// drivers/tty/n_tty.c:n_tty_flush_buffer and
+	// drivers/tty/pty.c:pty_flush_buffer.
+	if slave {
+		l.setPacketStatus(status, 0)
+	}
+	l.masterWaiter.Notify(waiter.EventOut)
+	l.slaveWaiter.Notify(waiter.EventOut)
+	return nil
+}
+
+// setPacketMode implements TIOCPKT.
+func (l *lineDiscipline) setPacketMode(ctx context.Context, io usermem.IO, args arch.SyscallArguments) error {
+	var enable int32
+	if _, err := usermem.CopyObjectIn(ctx, io, args[2].Pointer(), &enable, usermem.IOOpts{
+		AddressSpaceActive: true,
+	}); err != nil {
+		return err
+	}
+
+	l.ctrlMu.Lock()
+	defer l.ctrlMu.Unlock()
+	if enable == 0 {
+		l.packet = false
+	} else if !l.packet {
+		l.packetStatus = 0
+		l.packet = true
+	}
+	return nil
+}
+
+// packetMode implements TIOCGPKT.
+func (l *lineDiscipline) packetMode(ctx context.Context, io usermem.IO, args arch.SyscallArguments) error {
+	l.ctrlMu.Lock()
+	var enabled int32
+	if l.packet {
+		enabled = 1
+	}
+	l.ctrlMu.Unlock()
+
+	_, err := usermem.CopyObjectOut(ctx, io, args[2].Pointer(), enabled, usermem.IOOpts{
+		AddressSpaceActive: true,
+	})
+	return err
+}
+
+// setPacketStatus adds set to and removes clear from the pending packet mode
+// status, if the master is in packet mode.
+func (l *lineDiscipline) setPacketStatus(set, clear uint8) {
+	l.ctrlMu.Lock()
+	if !l.packet {
+		l.ctrlMu.Unlock()
+		return
+	}
+	l.packetStatus = l.packetStatus&^clear | set
+	l.ctrlMu.Unlock()
+	l.masterWaiter.Notify(waiter.EventIn | waiter.EventPri)
+}
+
+// stopOutput suspends output to the master, as for VSTOP.
+func (l *lineDiscipline) stopOutput() {
+	l.ctrlMu.Lock()
+	if l.stopped {
+		l.ctrlMu.Unlock()
+		return
+	}
+	l.stopped = true
+	l.ctrlMu.Unlock()
+	l.setPacketStatus(linux.TIOCPKT_STOP, linux.TIOCPKT_START)
+}
+
+// startOutput resumes output to the master, as for VSTART.
+func (l *lineDiscipline) startOutput() {
+	l.ctrlMu.Lock()
+	if !l.stopped {
+		l.ctrlMu.Unlock()
+		return
+	}
+	l.stopped = false
+	l.ctrlMu.Unlock()
+	l.setPacketStatus(linux.TIOCPKT_START, linux.TIOCPKT_STOP)
+	l.masterWaiter.Notify(waiter.EventIn)
+}
+
 // transformer is a helper interface to make it easier to stateify queue.
 type transformer interface {
 	// transform functions require queue's mutex to be held.
@@ -319,6 +555,9 @@ func (*outputQueueTransformer) transform(l *lineDiscipline, q *queue, buf []byte
 				l.column--
 			}
 		default:
+			if l.termios.OEnabled(linux.OLCUC) && 'a' <= cBytes[0] && cBytes[0] <= 'z' {
+				cBytes[0] -= 'a' - 'A'
+			}
 			l.column++
 		}
 		q.readBuf = append(q.readBuf, cBytes...)
@@ -358,7 +597,14 @@ func (*inputQueueTransformer) transform(l *lineDiscipline, q *queue, buf []byte)
 	var ret int
 	for len(buf) > 0 && len(q.readBuf) < canonMaxBytes {
 		size := l.peek(buf)
+		if l.termios.IEnabled(linux.ISTRIP) {
+			// Stripped bytes are never part of a multi-byte rune.
+			size = 1
+		}
 		cBytes := append([]byte{}, buf[:size]...)
+		if l.termios.IEnabled(linux.ISTRIP) {
+			cBytes[0] &= 0x7f
+		}
 		// We're guaranteed that cBytes has at least one element.
 		switch cBytes[0] {
 		case '\r':
@@ -375,6 +621,17 @@ func (*inputQueueTransformer) transform(l *lineDiscipline, q *queue, buf []byte)
 				cBytes[0] = '\r'
 			}
 		}
+		if l.termios.IEnabled(linux.IUCLC) && l.termios.LEnabled(linux.IEXTEN) && 'A' <= cBytes[0] && cBytes[0] <= 'Z' {
+			cBytes[0] += 'a' - 'A'
+		}
+
+		// Handle special characters, which are consumed rather than
+		// placed in the read buffer.
+		if l.special(q, cBytes) {
+			buf = buf[size:]
+			ret += size
+			continue
+		}
 
 		// In canonical mode, we discard non-terminating characters
 		// after the first 4095.
@@ -401,8 +658,9 @@ func (*inputQueueTransformer) transform(l *lineDiscipline, q *queue, buf []byte)
 
 		// Anything written to the readBuf will have to be echoed.
 		if l.termios.LEnabled(linux.ECHO) {
-			l.outQueue.writeBytes(cBytes, l)
-			l.masterWaiter.Notify(waiter.EventIn)
+			l.echo(cBytes)
+		} else if cBytes[0] == '\n' && l.termios.LEnabled(linux.ICANON) && l.termios.LEnabled(linux.ECHONL) {
+			l.echo(cBytes)
 		}
 
 		// If we finish a line, make it available for reading.
@@ -420,6 +678,201 @@ func (*inputQueueTransformer) transform(l *lineDiscipline, q *queue, buf []byte)
 	return ret
 }
 
+// isChar returns whether c is the control character at index cc of the
+// terminal's control characters, and that control character is not disabled.
+//
+// Preconditions: l.termiosMu must be held for reading.
+func (l *lineDiscipline) isChar(c byte, cc int) bool {
+	// _POSIX_VDISABLE is 0.
+	v := l.termios.ControlCharacters[cc]
+	return v != 0 && c == v
+}
+
+// special handles flow control, signal generating and line editing
+// characters in the input queue. It returns true if cBytes was consumed. See
+// drivers/tty/n_tty.c:n_tty_receive_char_special.
+//
+// Preconditions:
+// * l.termiosMu must be held for reading.
+// * q.mu must be held.
+func (l *lineDiscipline) special(q *queue, cBytes []byte) bool {
+	if len(cBytes) != 1 {
+		return false
+	}
+	c := cBytes[0]
+
+	if l.termios.IEnabled(linux.IXON) {
+		switch {
+		case l.isChar(c, linux.VSTART):
+			l.startOutput()
+			return true
+		case l.isChar(c, linux.VSTOP):
+			l.stopOutput()
+			return true
+		}
+		l.ctrlMu.Lock()
+		stopped := l.stopped
+		l.ctrlMu.Unlock()
+		if stopped && l.termios.IEnabled(linux.IXANY) {
+			l.startOutput()
+		}
+	}
+
+	if l.termios.LEnabled(linux.ISIG) {
+		var sig linux.Signal
+		switch {
+		case l.isChar(c, linux.VINTR):
+			sig = linux.SIGINT
+		case l.isChar(c, linux.VQUIT):
+			sig = linux.SIGQUIT
+		case l.isChar(c, linux.VSUSP):
+			sig = linux.SIGTSTP
+		}
+		if sig != 0 {
+			l.isig(q, cBytes, sig)
+			return true
+		}
+	}
+
+	if l.termios.LEnabled(linux.ICANON) {
+		switch {
+		case l.isChar(c, linux.VERASE):
+			l.erase(q, c, linux.VERASE)
+			return true
+		case l.isChar(c, linux.VKILL):
+			l.erase(q, c, linux.VKILL)
+			return true
+		case l.isChar(c, linux.VWERASE) && l.termios.LEnabled(linux.IEXTEN):
+			l.erase(q, c, linux.VWERASE)
+			return true
+		}
+	}
+
+	return false
+}
+
+// isig handles a signal generating character. Unless NOFLSH is set, the input
+// and output queues are flushed. See drivers/tty/n_tty.c:n_tty_receive_signal_char.
+//
+// Preconditions:
+// * l.termiosMu must be held for reading.
+// * q.mu must be held.
+func (l *lineDiscipline) isig(q *queue, cBytes []byte, sig linux.Signal) {
+	if !l.termios.LEnabled(linux.NOFLSH) {
+		// Only the read buffer is discarded, since the wait buffer
+		// is being processed by our caller.
+		q.readBuf = q.readBuf[:0]
+		q.readable = false
+		l.outQueue.flush()
+		l.setPacketStatus(linux.TIOCPKT_FLUSHREAD|linux.TIOCPKT_FLUSHWRITE, 0)
+		l.slaveWaiter.Notify(waiter.EventOut)
+	}
+	if l.termios.IEnabled(linux.IXON) {
+		l.startOutput()
+	}
+	if l.termios.LEnabled(linux.ECHO) {
+		l.echo(cBytes)
+	}
+	if l.terminal != nil {
+		l.terminal.signalForeground(sig)
+	}
+}
+
+// erase removes characters from the end of the current line in response to
+// the VERASE, VWERASE or VKILL character c, as indicated by cc. See
+// drivers/tty/n_tty.c:eraser.
+//
+// Preconditions:
+// * l.termiosMu must be held for reading.
+// * q.mu must be held.
+func (l *lineDiscipline) erase(q *queue, c byte, cc int) {
+	if len(q.readBuf) == 0 {
+		return
+	}
+	echo := l.termios.LEnabled(linux.ECHO)
+	if cc == linux.VKILL {
+		if !echo {
+			q.readBuf = q.readBuf[:0]
+			return
+		}
+		if !l.termios.LEnabled(linux.ECHOK) || !l.termios.LEnabled(linux.ECHOKE) || !l.termios.LEnabled(linux.ECHOE) {
+			q.readBuf = q.readBuf[:0]
+			l.echo([]byte{c})
+			if l.termios.LEnabled(linux.ECHOK) {
+				l.echo([]byte{'\n'})
+			}
+			return
+		}
+	}
+
+	var seenAlnums int
+	for len(q.readBuf) > 0 {
+		// Find the start of the last character.
+		i := len(q.readBuf) - 1
+		if l.termios.IEnabled(linux.IUTF8) {
+			for i > 0 && !utf8.RuneStart(q.readBuf[i]) {
+				i--
+			}
+		}
+		last := q.readBuf[i]
+
+		if cc == linux.VWERASE {
+			// Erase trailing whitespace, then a word.
+			if isWordChar(last) {
+				seenAlnums++
+			} else if seenAlnums > 0 {
+				break
+			}
+		}
+		q.readBuf = q.readBuf[:i]
+
+		if echo {
+			switch {
+			case cc == linux.VERASE && !l.termios.LEnabled(linux.ECHOE):
+				l.echo([]byte{c})
+			case isControl(last) && last != '\t':
+				// Control characters echoed as ^X occupy two
+				// columns.
+				if l.termios.LEnabled(linux.ECHOCTL) {
+					l.echo([]byte("\b \b\b \b"))
+				}
+			default:
+				l.echo([]byte("\b \b"))
+			}
+		}
+
+		if cc == linux.VERASE {
+			break
+		}
+	}
+}
+
+// echo writes cBytes to the output queue. If ECHOCTL is set, control
+// characters other than tab and newline are echoed as ^X. See
+// drivers/tty/n_tty.c:echo_char.
+//
+// Preconditions: l.termiosMu must be held for reading.
+func (l *lineDiscipline) echo(cBytes []byte) {
+	if len(cBytes) == 1 && l.termios.LEnabled(linux.ECHOCTL) {
+		if c := cBytes[0]; isControl(c) && c != '\t' && c != '\n' {
+			cBytes = []byte{'^', c ^ 0100}
+		}
+	}
+	l.outQueue.writeBytes(cBytes, l)
+	l.masterWaiter.Notify(waiter.EventIn)
+}
+
+// isControl returns whether c is an ASCII control character.
+func isControl(c byte) bool {
+	return c < ' ' || c == 0x7f
+}
+
+// isWordChar returns whether c is part of a word for the purposes of
+// VWERASE.
+func isWordChar(c byte) bool {
+	return c == '_' || c >= 0x80 || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
 // shouldDiscard returns whether c should be discarded. In canonical mode, if
 // too many bytes are enqueued, we keep reading input and discarding it until
 // we find a terminating character. Signal/echo processing still occurs.
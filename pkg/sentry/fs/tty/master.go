@@ -158,6 +158,17 @@ func (mf *masterFileOperations) Ioctl(ctx context.Context, io usermem.IO, args a
 	case linux.TCSETSW:
 		// TODO: This should drain the output queue first.
 		return mf.t.ld.setTermios(ctx, io, args)
+	case linux.TCSETSF:
+		if err := mf.t.ld.flush(linux.TCIFLUSH, true /* slave */); err != nil {
+			return 0, err
+		}
+		return mf.t.ld.setTermios(ctx, io, args)
+	case linux.TCFLSH:
+		return 0, mf.t.ld.flush(args[2].Int(), false /* slave */)
+	case linux.TIOCPKT:
+		return 0, mf.t.ld.setPacketMode(ctx, io, args)
+	case linux.TIOCGPKT:
+		return 0, mf.t.ld.packetMode(ctx, io, args)
 	case linux.TIOCGPTN:
 		_, err := usermem.CopyObjectOut(ctx, io, args[2].Pointer(), uint32(mf.t.n), usermem.IOOpts{
 			AddressSpaceActive: true,
@@ -170,6 +181,12 @@ func (mf *masterFileOperations) Ioctl(ctx context.Context, io usermem.IO, args a
 		return 0, mf.t.ld.windowSize(ctx, io, args)
 	case linux.TIOCSWINSZ:
 		return 0, mf.t.ld.setWindowSize(ctx, io, args)
+	case linux.TIOCGPGRP:
+		return 0, mf.t.foregroundProcessGroup(ctx, io, args, true /* master */)
+	case linux.TIOCSPGRP:
+		return 0, mf.t.setForegroundProcessGroup(ctx, io, args)
+	case linux.TIOCGSID:
+		return 0, mf.t.sessionID(ctx, io, args, true /* master */)
 	default:
 		maybeEmitUnimplementedEvent(ctx, cmd)
 		return 0, syserror.ENOTTY
@@ -182,9 +199,6 @@ func maybeEmitUnimplementedEvent(ctx context.Context, cmd uint32) {
 	case linux.TCGETS,
 		linux.TCSETS,
 		linux.TCSETSW,
-		linux.TCSETSF,
-		linux.TIOCGPGRP,
-		linux.TIOCSPGRP,
 		linux.TIOCGWINSZ,
 		linux.TIOCSWINSZ,
 		linux.TIOCSETD,
@@ -198,9 +212,6 @@ func maybeEmitUnimplementedEvent(ctx context.Context, cmd uint32) {
 		linux.TIOCEXCL,
 		linux.TIOCNXCL,
 		linux.TIOCGEXCL,
-		linux.TIOCNOTTY,
-		linux.TIOCSCTTY,
-		linux.TIOCGSID,
 		linux.TIOCGETD,
 		linux.TIOCVHANGUP,
 		linux.TIOCGDEV,
@@ -209,7 +220,6 @@ func maybeEmitUnimplementedEvent(ctx context.Context, cmd uint32) {
 		linux.TIOCMBIC,
 		linux.TIOCMBIS,
 		linux.TIOCGICOUNT,
-		linux.TCFLSH,
 		linux.TIOCSSERIAL,
 		linux.TIOCGPTPEER:
 
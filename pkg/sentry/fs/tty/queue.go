@@ -237,6 +237,16 @@ func (q *queue) pushWaitBufLocked(l *lineDiscipline) int {
 	return total
 }
 
+// flush discards all data in q.
+func (q *queue) flush() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.readBuf = nil
+	q.waitBuf = nil
+	q.waitBufLen = 0
+	q.readable = false
+}
+
 // Precondition: q.mu must be locked.
 func (q *queue) waitBufAppend(b []byte) {
 	q.waitBuf = append(q.waitBuf, b)
@@ -117,11 +117,22 @@ func (sf *slaveFileOperations) Readiness(mask waiter.EventMask) waiter.EventMask
 
 // Read implements fs.FileOperations.Read.
 func (sf *slaveFileOperations) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, _ int64) (int64, error) {
+	// Background process groups may not read from the terminal.
+	if err := sf.si.t.checkChange(ctx, linux.SIGTTIN); err != nil {
+		return 0, err
+	}
 	return sf.si.t.ld.inputQueueRead(ctx, dst)
 }
 
 // Write implements fs.FileOperations.Write.
 func (sf *slaveFileOperations) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, _ int64) (int64, error) {
+	// If TOSTOP is set, background process groups may not write to the
+	// terminal.
+	if sf.si.t.ld.lEnabled(linux.TOSTOP) {
+		if err := sf.si.t.checkChange(ctx, linux.SIGTTOU); err != nil {
+			return 0, err
+		}
+	}
 	return sf.si.t.ld.outputQueueWrite(ctx, src)
 }
 
@@ -131,13 +142,35 @@ func (sf *slaveFileOperations) Ioctl(ctx context.Context, io usermem.IO, args ar
 	case linux.FIONREAD: // linux.FIONREAD == linux.TIOCINQ
 		// Get the number of bytes in the input queue read buffer.
 		return 0, sf.si.t.ld.inputQueueReadSize(ctx, io, args)
+	case linux.TIOCOUTQ:
+		// Get the number of bytes in the output queue read buffer.
+		return 0, sf.si.t.ld.outputQueueReadSize(ctx, io, args)
 	case linux.TCGETS:
 		return sf.si.t.ld.getTermios(ctx, io, args)
 	case linux.TCSETS:
+		if err := sf.si.t.checkChange(ctx, linux.SIGTTOU); err != nil {
+			return 0, err
+		}
 		return sf.si.t.ld.setTermios(ctx, io, args)
 	case linux.TCSETSW:
 		// TODO: This should drain the output queue first.
+		if err := sf.si.t.checkChange(ctx, linux.SIGTTOU); err != nil {
+			return 0, err
+		}
+		return sf.si.t.ld.setTermios(ctx, io, args)
+	case linux.TCSETSF:
+		if err := sf.si.t.checkChange(ctx, linux.SIGTTOU); err != nil {
+			return 0, err
+		}
+		if err := sf.si.t.ld.flush(linux.TCIFLUSH, true /* slave */); err != nil {
+			return 0, err
+		}
 		return sf.si.t.ld.setTermios(ctx, io, args)
+	case linux.TCFLSH:
+		if err := sf.si.t.checkChange(ctx, linux.SIGTTOU); err != nil {
+			return 0, err
+		}
+		return 0, sf.si.t.ld.flush(args[2].Int(), true /* slave */)
 	case linux.TIOCGPTN:
 		_, err := usermem.CopyObjectOut(ctx, io, args[2].Pointer(), uint32(sf.si.t.n), usermem.IOOpts{
 			AddressSpaceActive: true,
@@ -150,9 +183,18 @@ func (sf *slaveFileOperations) Ioctl(ctx context.Context, io usermem.IO, args ar
 	case linux.TIOCSCTTY:
 		// Make the given terminal the controlling terminal of the
 		// calling process.
-		// TODO: Implement once we have support for job
-		// control.
-		return 0, nil
+		return 0, sf.si.t.setControllingTTY(ctx, args)
+	case linux.TIOCNOTTY:
+		// Give up the controlling terminal of the calling process.
+		return 0, sf.si.t.releaseControllingTTY(ctx)
+	case linux.TIOCGPGRP:
+		return 0, sf.si.t.foregroundProcessGroup(ctx, io, args, false /* master */)
+	case linux.TIOCSPGRP:
+		return 0, sf.si.t.setForegroundProcessGroup(ctx, io, args)
+	case linux.TIOCGSID:
+		return 0, sf.si.t.sessionID(ctx, io, args, false /* master */)
+	case linux.TIOCSTI:
+		return 0, sf.si.t.simulateInput(ctx, io, args)
 	default:
 		maybeEmitUnimplementedEvent(ctx, cmd)
 		return 0, syserror.ENOTTY
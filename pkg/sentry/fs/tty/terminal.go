@@ -15,11 +15,30 @@
 package tty
 
 import (
+	"sync"
+
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/refs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
 )
 
+// legacyTIOCSTISysctl is the sysctl controlling whether unprivileged
+// processes may use TIOCSTI, exposed as /proc/sys/dev/tty/legacy_tiocsti.
+const legacyTIOCSTISysctl = "dev.tty.legacy_tiocsti"
+
+func init() {
+	kernel.RegisterSysctl(legacyTIOCSTISysctl, kernel.Sysctl{
+		Default:  1,
+		Min:      0,
+		Max:      1,
+		Writable: true,
+	})
+}
+
 // Terminal is a pseudoterminal.
 //
 // +stateify savable
@@ -34,13 +53,351 @@ type Terminal struct {
 
 	// ld is the line discipline of the terminal.
 	ld *lineDiscipline
+
+	// jobMu protects session and fgProcessGroup.
+	jobMu sync.Mutex `state:"nosave"`
+
+	// session is the session for which this terminal is the controlling
+	// terminal, or nil if it is not a controlling terminal.
+	session *kernel.Session
+
+	// fgProcessGroup is the foreground process group of the terminal. It
+	// is nil iff session is nil.
+	fgProcessGroup *kernel.ProcessGroup
 }
 
 func newTerminal(ctx context.Context, d *dirInodeOperations, n uint32) *Terminal {
 	termios := linux.DefaultSlaveTermios
-	return &Terminal{
+	t := &Terminal{
 		d:  d,
 		n:  n,
 		ld: newLineDiscipline(termios),
 	}
+	t.ld.terminal = t
+	return t
+}
+
+// setControllingTTY makes t the controlling terminal of the calling process,
+// which must be a session leader. If t is already the controlling terminal of
+// another session, it is only stolen if steal is set and the caller has
+// CAP_SYS_ADMIN.
+//
+// See drivers/tty/tty_io.c:tiocsctty().
+func (t *Terminal) setControllingTTY(ctx context.Context, args arch.SyscallArguments) error {
+	task := kernel.TaskFromContext(ctx)
+	if task == nil {
+		return syserror.ENOTTY
+	}
+
+	t.jobMu.Lock()
+	defer t.jobMu.Unlock()
+
+	tg := task.ThreadGroup()
+	s := tg.Session()
+	pidns := task.PIDNamespace()
+	if pidns.IDOfSession(s) != kernel.SessionID(pidns.IDOfThreadGroup(tg)) {
+		// Only session leaders may acquire a controlling terminal.
+		return syserror.EPERM
+	}
+	if t.session == s {
+		return nil
+	}
+	if t.session != nil {
+		steal := args[2].Int() == 1
+		if !steal || !task.HasCapability(linux.CAP_SYS_ADMIN) {
+			return syserror.EPERM
+		}
+	}
+
+	// A session has at most one controlling terminal.
+	if !s.SetControllingTerminal(t) {
+		return syserror.EPERM
+	}
+	if t.session != nil {
+		t.session.ClearControllingTerminal(t)
+	}
+	t.session = s
+	t.fgProcessGroup = tg.ProcessGroup()
+	return nil
+}
+
+// releaseControllingTTY disassociates t from the calling process's session.
+//
+// See drivers/tty/tty_io.c:tiocnotty().
+func (t *Terminal) releaseControllingTTY(ctx context.Context) error {
+	task := kernel.TaskFromContext(ctx)
+	if task == nil {
+		return syserror.ENOTTY
+	}
+
+	t.jobMu.Lock()
+	defer t.jobMu.Unlock()
+
+	tg := task.ThreadGroup()
+	if t.session == nil || t.session != tg.Session() {
+		return syserror.ENOTTY
+	}
+
+	// If the caller is the session leader, the foreground process group
+	// is sent SIGHUP and SIGCONT, and the session loses its controlling
+	// terminal.
+	pidns := task.PIDNamespace()
+	if pidns.IDOfSession(t.session) == kernel.SessionID(pidns.IDOfThreadGroup(tg)) {
+		t.session.ClearControllingTerminal(t)
+		t.hangupLocked()
+	}
+	return nil
+}
+
+// SessionLeaderExited implements kernel.ControllingTerminal.SessionLeaderExited.
+func (t *Terminal) SessionLeaderExited(s *kernel.Session) {
+	t.jobMu.Lock()
+	defer t.jobMu.Unlock()
+	if t.session != s {
+		// t was stolen by another session in the meantime.
+		return
+	}
+	t.hangupLocked()
+}
+
+// hangupLocked makes t stop being a controlling terminal, after sending SIGHUP
+// and SIGCONT to its foreground process group.
+//
+// Preconditions: t.jobMu must be locked. t.session must not be nil.
+func (t *Terminal) hangupLocked() {
+	fg := t.fgProcessGroup
+	t.session = nil
+	t.fgProcessGroup = nil
+	fg.SendSignal(&arch.SignalInfo{Code: arch.SignalInfoKernel, Signo: int32(linux.SIGHUP)})
+	fg.SendSignal(&arch.SignalInfo{Code: arch.SignalInfoKernel, Signo: int32(linux.SIGCONT)})
+}
+
+// isControllingTTY returns true if t is the controlling terminal of the
+// calling process.
+func (t *Terminal) isControllingTTY(ctx context.Context) bool {
+	task := kernel.TaskFromContext(ctx)
+	if task == nil {
+		return false
+	}
+
+	t.jobMu.Lock()
+	defer t.jobMu.Unlock()
+	return t.session != nil && t.session == task.ThreadGroup().Session()
+}
+
+// foregroundProcessGroup implements TIOCGPGRP. If master is true, the ioctl
+// was issued on the master end, which may query the foreground process group
+// of the slave without it being the caller's controlling terminal.
+func (t *Terminal) foregroundProcessGroup(ctx context.Context, io usermem.IO, args arch.SyscallArguments, master bool) error {
+	task := kernel.TaskFromContext(ctx)
+	if task == nil {
+		return syserror.ENOTTY
+	}
+
+	t.jobMu.Lock()
+	defer t.jobMu.Unlock()
+
+	if !master && (t.session == nil || t.session != task.ThreadGroup().Session()) {
+		return syserror.ENOTTY
+	}
+
+	// Map the ProcessGroup into a ProcessGroupID in the task's PID
+	// namespace. If there is no foreground process group, this is 0.
+	var pgID kernel.ProcessGroupID
+	if t.fgProcessGroup != nil {
+		pgID = task.PIDNamespace().IDOfProcessGroup(t.fgProcessGroup)
+	}
+	_, err := usermem.CopyObjectOut(ctx, io, args[2].Pointer(), &pgID, usermem.IOOpts{
+		AddressSpaceActive: true,
+	})
+	return err
+}
+
+// setForegroundProcessGroup implements TIOCSPGRP.
+func (t *Terminal) setForegroundProcessGroup(ctx context.Context, io usermem.IO, args arch.SyscallArguments) error {
+	task := kernel.TaskFromContext(ctx)
+	if task == nil {
+		return syserror.ENOTTY
+	}
+
+	t.jobMu.Lock()
+	defer t.jobMu.Unlock()
+
+	// Check that we are allowed to set the process group.
+	if err := t.checkChangeLocked(ctx, linux.SIGTTOU); err != nil {
+		// drivers/tty/tty_io.c:tiocspgrp() converts -EIO from
+		// tty_check_change() to -ENOTTY.
+		if err == syserror.EIO {
+			return syserror.ENOTTY
+		}
+		return err
+	}
+
+	// Check that calling task's process group is in the TTY session.
+	if t.session == nil || task.ThreadGroup().Session() != t.session {
+		return syserror.ENOTTY
+	}
+
+	var pgID kernel.ProcessGroupID
+	if _, err := usermem.CopyObjectIn(ctx, io, args[2].Pointer(), &pgID, usermem.IOOpts{
+		AddressSpaceActive: true,
+	}); err != nil {
+		return err
+	}
+
+	// pgID must be non-negative.
+	if pgID < 0 {
+		return syserror.EINVAL
+	}
+
+	// Process group with pgID must exist in this PID namespace.
+	pg := task.PIDNamespace().ProcessGroupWithID(pgID)
+	if pg == nil {
+		return syserror.ESRCH
+	}
+
+	// Check that new process group is in the TTY session.
+	if pg.Session() != t.session {
+		return syserror.EPERM
+	}
+
+	t.fgProcessGroup = pg
+	return nil
+}
+
+// sessionID implements TIOCGSID. As for foregroundProcessGroup, master
+// indicates that the ioctl was issued on the master end.
+func (t *Terminal) sessionID(ctx context.Context, io usermem.IO, args arch.SyscallArguments, master bool) error {
+	task := kernel.TaskFromContext(ctx)
+	if task == nil {
+		return syserror.ENOTTY
+	}
+
+	t.jobMu.Lock()
+	defer t.jobMu.Unlock()
+
+	if t.session == nil || (!master && t.session != task.ThreadGroup().Session()) {
+		return syserror.ENOTTY
+	}
+
+	sid := task.PIDNamespace().IDOfSession(t.session)
+	_, err := usermem.CopyObjectOut(ctx, io, args[2].Pointer(), &sid, usermem.IOOpts{
+		AddressSpaceActive: true,
+	})
+	return err
+}
+
+// simulateInput implements TIOCSTI, which inserts a byte into the input
+// queue as if it were typed at the terminal. Unprivileged callers may only do
+// so on their controlling terminal, and only if the dev.tty.legacy_tiocsti
+// sysctl is enabled. See drivers/tty/tty_io.c:tiocsti.
+func (t *Terminal) simulateInput(ctx context.Context, io usermem.IO, args arch.SyscallArguments) error {
+	task := kernel.TaskFromContext(ctx)
+	if task == nil {
+		return syserror.ENOTTY
+	}
+
+	admin := task.HasCapability(linux.CAP_SYS_ADMIN)
+	legacy, err := task.Kernel().Sysctl(legacyTIOCSTISysctl)
+	if err != nil {
+		return err
+	}
+	if legacy == 0 && !admin {
+		return syserror.EIO
+	}
+	if !t.isControllingTTY(ctx) && !admin {
+		return syserror.EPERM
+	}
+
+	var c byte
+	if _, err := usermem.CopyObjectIn(ctx, io, args[2].Pointer(), &c, usermem.IOOpts{
+		AddressSpaceActive: true,
+	}); err != nil {
+		return err
+	}
+
+	// Like Linux, silently drop the byte if the input queue is full.
+	if _, err := t.ld.inputQueueWrite(ctx, usermem.BytesIOSequence([]byte{c})); err != nil && err != syserror.ErrWouldBlock {
+		return err
+	}
+	return nil
+}
+
+// checkChange checks that the calling process is allowed to read, write, or
+// change the state of the terminal. It returns nil if the operation may
+// proceed.
+func (t *Terminal) checkChange(ctx context.Context, sig linux.Signal) error {
+	t.jobMu.Lock()
+	defer t.jobMu.Unlock()
+	return t.checkChangeLocked(ctx, sig)
+}
+
+// checkChangeLocked is equivalent to checkChange.
+//
+// This corresponds to Linux drivers/tty/tty_io.c:tty_check_change(), and
+// behaves like the host TTY implementation in fs/host.
+//
+// Preconditions: t.jobMu must be locked.
+func (t *Terminal) checkChangeLocked(ctx context.Context, sig linux.Signal) error {
+	task := kernel.TaskFromContext(ctx)
+	if task == nil || t.session == nil {
+		// No task, or no job control on this terminal.
+		return nil
+	}
+
+	tg := task.ThreadGroup()
+	pg := tg.ProcessGroup()
+
+	// Processes in other sessions are not subject to job control on this
+	// terminal.
+	if tg.Session() != t.session {
+		return nil
+	}
+
+	// If we are the foreground process group, then the change is allowed.
+	if pg == t.fgProcessGroup {
+		return nil
+	}
+
+	// Is the provided signal blocked or ignored?
+	if (task.SignalMask()&linux.SignalSetOf(sig) != 0) || tg.SignalHandlers().IsIgnored(sig) {
+		// If the signal is SIGTTIN, then we are attempting to read
+		// from the TTY. Don't send the signal and return EIO.
+		if sig == linux.SIGTTIN {
+			return syserror.EIO
+		}
+
+		// Otherwise, we are writing or changing terminal state. This is allowed.
+		return nil
+	}
+
+	// If the process group is an orphan, return EIO.
+	if pg.IsOrphan() {
+		return syserror.EIO
+	}
+
+	// Otherwise, send the signal to the process group and return
+	// ERESTARTSYS.
+	si := arch.SignalInfo{
+		Code:  arch.SignalInfoKernel,
+		Signo: int32(sig),
+	}
+	// Linux ignores the result of kill_pgrp().
+	_ = pg.SendSignal(&si)
+	return kernel.ERESTARTSYS
+}
+
+// signalForeground sends sig to the foreground process group of t, if any.
+func (t *Terminal) signalForeground(sig linux.Signal) {
+	t.jobMu.Lock()
+	fg := t.fgProcessGroup
+	t.jobMu.Unlock()
+	if fg == nil {
+		return
+	}
+	// Linux ignores the result of kill_pgrp().
+	_ = fg.SendSignal(&arch.SignalInfo{
+		Code:  arch.SignalInfoKernel,
+		Signo: int32(sig),
+	})
 }
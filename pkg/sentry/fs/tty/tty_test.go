@@ -54,3 +54,53 @@ func TestSimpleMasterToSlave(t *testing.T) {
 		t.Fatalf("written and read strings do not match: got %q, want %q", outStr, inStr)
 	}
 }
+
+func TestCanonicalErase(t *testing.T) {
+	ld := newLineDiscipline(linux.DefaultSlaveTermios)
+	ctx := contexttest.Context(t)
+
+	// "helo", VERASE, "lo world", VWERASE, "there", VKILL, "hello\n".
+	in := "helo\x7flo world\x17there\x15hello\n"
+	if _, err := ld.inputQueueWrite(ctx, usermem.BytesIOSequence([]byte(in))); err != nil {
+		t.Fatalf("error writing to input queue: %v", err)
+	}
+
+	outBytes := make([]byte, 32)
+	n, err := ld.inputQueueRead(ctx, usermem.BytesIOSequence(outBytes))
+	if err != nil {
+		t.Fatalf("error reading from input queue: %v", err)
+	}
+	if got, want := string(outBytes[:n]), "hello\n"; got != want {
+		t.Fatalf("read wrong line: got %q, want %q", got, want)
+	}
+}
+
+func TestPacketMode(t *testing.T) {
+	ld := newLineDiscipline(linux.DefaultSlaveTermios)
+	ctx := contexttest.Context(t)
+	ld.packet = true
+
+	if _, err := ld.outputQueueWrite(ctx, usermem.BytesIOSequence([]byte("hi"))); err != nil {
+		t.Fatalf("error writing to output queue: %v", err)
+	}
+	outBytes := make([]byte, 32)
+	n, err := ld.outputQueueRead(ctx, usermem.BytesIOSequence(outBytes))
+	if err != nil {
+		t.Fatalf("error reading from output queue: %v", err)
+	}
+	if got, want := string(outBytes[:n]), "\x00hi"; got != want {
+		t.Fatalf("read wrong data: got %q, want %q", got, want)
+	}
+
+	// Flushing the slave's input is reported as status.
+	if err := ld.flush(linux.TCIFLUSH, true /* slave */); err != nil {
+		t.Fatalf("error flushing: %v", err)
+	}
+	n, err = ld.outputQueueRead(ctx, usermem.BytesIOSequence(outBytes))
+	if err != nil {
+		t.Fatalf("error reading status: %v", err)
+	}
+	if got, want := outBytes[:n], []byte{linux.TIOCPKT_FLUSHREAD}; string(got) != string(want) {
+		t.Fatalf("read wrong status: got %v, want %v", got, want)
+	}
+}
@@ -15,6 +15,11 @@
 // Package inet defines semantics for IP stacks.
 package inet
 
+import (
+	"io"
+	"time"
+)
+
 // Stack represents a TCP/IP stack.
 type Stack interface {
 	// Interfaces returns all network interfaces as a mapping from interface
@@ -26,6 +31,11 @@ type Stack interface {
 	// interface indexes to a slice of associated interface address properties.
 	InterfaceAddrs() map[int32][]InterfaceAddr
 
+	// InterfaceStatistics returns the statistics of network interfaces as a
+	// mapping from interface indexes to their counters. Interfaces without
+	// statistics may be omitted.
+	InterfaceStatistics() map[int32]InterfaceStatistics
+
 	// SupportsIPv6 returns true if the stack supports IPv6 connectivity.
 	SupportsIPv6() bool
 
@@ -49,6 +59,149 @@ type Stack interface {
 	// SetTCPSACKEnabled attempts to change TCP selective acknowledgement
 	// settings.
 	SetTCPSACKEnabled(enabled bool) error
+
+	// QueueingDisciplines returns the queueing disciplines attached to
+	// network interfaces as a mapping from interface indexes to their
+	// settings.
+	QueueingDisciplines() map[int32]QueueingDiscipline
+
+	// SetQueueingDiscipline attempts to attach a queueing discipline with
+	// settings q to interface idx, replacing the one attached to it.
+	SetQueueingDiscipline(idx int32, q QueueingDiscipline) error
+
+	// RemoveQueueingDiscipline attempts to detach the queueing discipline
+	// of interface idx.
+	RemoveQueueingDiscipline(idx int32) error
+
+	// AddInterfaceAddr attempts to add addr to interface idx, along with a
+	// route to its subnet through the interface.
+	AddInterfaceAddr(idx int32, addr InterfaceAddr) error
+
+	// NewWireGuardInterface attempts to create a WireGuard interface named
+	// name, and returns its index.
+	NewWireGuardInterface(name string) (int32, error)
+
+	// WireGuardInterfaces returns the WireGuard interfaces as a mapping
+	// from interface indexes to their devices.
+	WireGuardInterfaces() map[int32]WireGuardDevice
+
+	// NewTunnelInterface attempts to create a tunnel interface named name
+	// with the settings t, and returns its index.
+	NewTunnelInterface(name string, t Tunnel) (int32, error)
+
+	// Tunnels returns the settings of the tunnel interfaces, as a mapping
+	// from interface indexes to their settings.
+	Tunnels() map[int32]Tunnel
+
+	// SupportsConnTrack returns true if the stack tracks connections.
+	SupportsConnTrack() bool
+
+	// ConnTrack returns the connections tracked by the stack.
+	ConnTrack() []ConnTrackEntry
+
+	// DeleteConnTrack attempts to stop tracking the connection with the
+	// tuple t in either direction.
+	DeleteConnTrack(t ConnTrackTuple) error
+
+	// FlushConnTrack attempts to stop tracking the connections of the
+	// address family family, a Linux AF_* constant, or of all families if
+	// it is AF_UNSPEC.
+	FlushConnTrack(family uint8) error
+}
+
+// WireGuardDevice is the device of a WireGuard interface.
+type WireGuardDevice interface {
+	// IpcGet writes the configuration and the state of the device to w,
+	// in the format of the "get=1" operation of the cross-platform
+	// userspace API of wg(8).
+	IpcGet(w io.Writer) error
+
+	// IpcSet reads a configuration change from r, in the format of the
+	// "set=1" operation of the cross-platform userspace API of wg(8), and
+	// attempts to apply it to the device.
+	IpcSet(r io.Reader) error
+}
+
+// Tunnel kinds, as named by ip-link(8).
+const (
+	TunnelKindGRE   = "gre"
+	TunnelKindVXLAN = "vxlan"
+)
+
+// Tunnel contains the settings of a tunnel interface. The settings which don't
+// apply to its kind are ignored.
+type Tunnel struct {
+	// Kind is the kind of the tunnel, a TunnelKind* constant.
+	Kind string
+
+	// Local is the address the encapsulating packets are sent from, or
+	// empty to pick it from the route to the remote end.
+	Local []byte
+
+	// Remote is the address of the remote end of the tunnel. It is
+	// required by gre, and the default destination of vxlan.
+	Remote []byte
+
+	// TTL is the TTL of the encapsulating packets, or zero to inherit the
+	// default one.
+	TTL uint8
+
+	// InputKey and OutputKey are the keys of the packets received and sent
+	// by gre, if HasInputKey and HasOutputKey are set.
+	InputKey     uint32
+	HasInputKey  bool
+	OutputKey    uint32
+	HasOutputKey bool
+
+	// VNI is the VXLAN network identifier of vxlan.
+	VNI uint32
+
+	// Port is the UDP port of vxlan, or zero for the one assigned by IANA.
+	Port uint16
+
+	// Learning is whether vxlan learns the remote ends of link addresses.
+	Learning bool
+}
+
+// ConnTrackTuple identifies one direction of a tracked connection.
+type ConnTrackTuple struct {
+	// Family is the address family, a Linux AF_* constant.
+	Family uint8
+
+	// Protocol is the transport protocol, a Linux IPPROTO_* constant.
+	Protocol uint8
+
+	// Src and Dst are the source and destination addresses.
+	Src []byte
+	Dst []byte
+
+	// SrcPort and DstPort are the ports of TCP and UDP, and both the
+	// identifier of ICMP echo requests.
+	SrcPort uint16
+	DstPort uint16
+}
+
+// ConnTrackEntry describes a tracked connection.
+type ConnTrackEntry struct {
+	// ID identifies the connection for as long as it is tracked.
+	ID uint32
+
+	// Original is the tuple of the direction the connection was initiated
+	// in, and Reply the one of the other direction.
+	Original ConnTrackTuple
+	Reply    ConnTrackTuple
+
+	// TCPState is the state of TCP connections, a Linux TCP_CONNTRACK_*
+	// constant.
+	TCPState uint8
+
+	// SeenReply is whether packets were seen in the reply direction, and
+	// Assured whether the connection is established.
+	SeenReply bool
+	Assured   bool
+
+	// Timeout is the time left before the connection expires.
+	Timeout time.Duration
 }
 
 // Interface contains information about a network interface.
@@ -89,6 +242,21 @@ type InterfaceAddr struct {
 	Addr []byte
 }
 
+// InterfaceStatistics contains the packet counters of a network interface.
+type InterfaceStatistics struct {
+	// RxPackets and RxBytes count the packets received by the interface.
+	RxPackets uint64
+	RxBytes   uint64
+
+	// TxPackets and TxBytes count the packets sent by the interface.
+	TxPackets uint64
+	TxBytes   uint64
+
+	// TxDropped counts the packets dropped by the interface's queueing
+	// discipline before being sent.
+	TxDropped uint64
+}
+
 // TCPBufferSize contains settings controlling TCP buffer sizing.
 //
 // +stateify savable
@@ -102,3 +270,60 @@ type TCPBufferSize struct {
 	// Max is the maximum size.
 	Max int
 }
+
+// Queueing discipline kinds, as named by tc(8).
+const (
+	QueueingDisciplineFQ    = "fq"
+	QueueingDisciplineTBF   = "tbf"
+	QueueingDisciplineNetem = "netem"
+)
+
+// QueueingDiscipline contains the settings and statistics of the queueing
+// discipline of a network interface. The settings which don't apply to its
+// kind are ignored.
+type QueueingDiscipline struct {
+	// Kind is the kind of the queueing discipline, a QueueingDiscipline*
+	// constant.
+	Kind string
+
+	// Limit is the maximum number of packets queued, in bytes for tbf.
+	// Zero stands for the default.
+	Limit uint32
+
+	// FlowLimit is the maximum number of packets queued per flow by fq.
+	FlowLimit uint32
+
+	// Quantum and InitialQuantum are the number of bytes a flow may send
+	// per round, and in its first round, with fq.
+	Quantum        uint32
+	InitialQuantum uint32
+
+	// MaxRate is the maximum rate of a flow with fq, in bytes per second.
+	MaxRate uint64
+
+	// Rate and Burst are the rate, in bytes per second, and the bucket
+	// size, in bytes, of tbf.
+	Rate  uint64
+	Burst uint32
+
+	// Latency, Jitter and Loss are the delay added to the packets, its
+	// variation, and the probability of dropping a packet scaled to
+	// math.MaxUint32, with netem.
+	Latency time.Duration
+	Jitter  time.Duration
+	Loss    uint32
+
+	// Stats is the statistics of the queueing discipline. It is ignored by
+	// SetQueueingDiscipline.
+	Stats QueueingDisciplineStats
+}
+
+// QueueingDisciplineStats contains the statistics of a queueing discipline.
+type QueueingDisciplineStats struct {
+	Packets    uint64
+	Bytes      uint64
+	Drops      uint64
+	Overlimits uint64
+	QueueLen   uint32
+	Backlog    uint32
+}
@@ -14,14 +14,21 @@
 
 package inet
 
+import "bytes"
+
 // TestStack is a dummy implementation of Stack for tests.
 type TestStack struct {
 	InterfacesMap     map[int32]Interface
 	InterfaceAddrsMap map[int32][]InterfaceAddr
+	InterfaceStatsMap map[int32]InterfaceStatistics
 	SupportsIPv6Flag  bool
 	TCPRecvBufSize    TCPBufferSize
 	TCPSendBufSize    TCPBufferSize
 	TCPSACKFlag       bool
+	QdiscsMap         map[int32]QueueingDiscipline
+	WireGuardMap      map[int32]WireGuardDevice
+	TunnelsMap        map[int32]Tunnel
+	ConnTrackEntries  []ConnTrackEntry
 }
 
 // NewTestStack returns a TestStack with no network interfaces. The value of
@@ -31,6 +38,10 @@ func NewTestStack() *TestStack {
 	return &TestStack{
 		InterfacesMap:     make(map[int32]Interface),
 		InterfaceAddrsMap: make(map[int32][]InterfaceAddr),
+		InterfaceStatsMap: make(map[int32]InterfaceStatistics),
+		QdiscsMap:         make(map[int32]QueueingDiscipline),
+		WireGuardMap:      make(map[int32]WireGuardDevice),
+		TunnelsMap:        make(map[int32]Tunnel),
 	}
 }
 
@@ -44,6 +55,11 @@ func (s *TestStack) InterfaceAddrs() map[int32][]InterfaceAddr {
 	return s.InterfaceAddrsMap
 }
 
+// InterfaceStatistics implements Stack.InterfaceStatistics.
+func (s *TestStack) InterfaceStatistics() map[int32]InterfaceStatistics {
+	return s.InterfaceStatsMap
+}
+
 // SupportsIPv6 implements Stack.SupportsIPv6.
 func (s *TestStack) SupportsIPv6() bool {
 	return s.SupportsIPv6Flag
@@ -81,3 +97,101 @@ func (s *TestStack) SetTCPSACKEnabled(enabled bool) error {
 	s.TCPSACKFlag = enabled
 	return nil
 }
+
+// QueueingDisciplines implements Stack.QueueingDisciplines.
+func (s *TestStack) QueueingDisciplines() map[int32]QueueingDiscipline {
+	return s.QdiscsMap
+}
+
+// SetQueueingDiscipline implements Stack.SetQueueingDiscipline.
+func (s *TestStack) SetQueueingDiscipline(idx int32, q QueueingDiscipline) error {
+	s.QdiscsMap[idx] = q
+	return nil
+}
+
+// RemoveQueueingDiscipline implements Stack.RemoveQueueingDiscipline.
+func (s *TestStack) RemoveQueueingDiscipline(idx int32) error {
+	delete(s.QdiscsMap, idx)
+	return nil
+}
+
+// AddInterfaceAddr implements Stack.AddInterfaceAddr.
+func (s *TestStack) AddInterfaceAddr(idx int32, addr InterfaceAddr) error {
+	s.InterfaceAddrsMap[idx] = append(s.InterfaceAddrsMap[idx], addr)
+	return nil
+}
+
+// NewWireGuardInterface implements Stack.NewWireGuardInterface. The
+// interface is added without a device; tests that need one must add it to
+// WireGuardMap.
+func (s *TestStack) NewWireGuardInterface(name string) (int32, error) {
+	return s.newInterface(name), nil
+}
+
+// WireGuardInterfaces implements Stack.WireGuardInterfaces.
+func (s *TestStack) WireGuardInterfaces() map[int32]WireGuardDevice {
+	return s.WireGuardMap
+}
+
+// NewTunnelInterface implements Stack.NewTunnelInterface.
+func (s *TestStack) NewTunnelInterface(name string, t Tunnel) (int32, error) {
+	idx := s.newInterface(name)
+	s.TunnelsMap[idx] = t
+	return idx, nil
+}
+
+// Tunnels implements Stack.Tunnels.
+func (s *TestStack) Tunnels() map[int32]Tunnel {
+	return s.TunnelsMap
+}
+
+// SupportsConnTrack implements Stack.SupportsConnTrack.
+func (s *TestStack) SupportsConnTrack() bool {
+	return s.ConnTrackEntries != nil
+}
+
+// ConnTrack implements Stack.ConnTrack.
+func (s *TestStack) ConnTrack() []ConnTrackEntry {
+	return s.ConnTrackEntries
+}
+
+// DeleteConnTrack implements Stack.DeleteConnTrack.
+func (s *TestStack) DeleteConnTrack(t ConnTrackTuple) error {
+	for i, e := range s.ConnTrackEntries {
+		if connTrackTupleEqual(&e.Original, &t) || connTrackTupleEqual(&e.Reply, &t) {
+			s.ConnTrackEntries = append(s.ConnTrackEntries[:i], s.ConnTrackEntries[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// FlushConnTrack implements Stack.FlushConnTrack.
+func (s *TestStack) FlushConnTrack(family uint8) error {
+	es := s.ConnTrackEntries[:0]
+	for _, e := range s.ConnTrackEntries {
+		if family != 0 && e.Original.Family != family {
+			es = append(es, e)
+		}
+	}
+	s.ConnTrackEntries = es
+	return nil
+}
+
+// connTrackTupleEqual returns whether a and b are equal.
+func connTrackTupleEqual(a, b *ConnTrackTuple) bool {
+	return a.Family == b.Family && a.Protocol == b.Protocol && bytes.Equal(a.Src, b.Src) && bytes.Equal(a.Dst, b.Dst) && a.SrcPort == b.SrcPort && a.DstPort == b.DstPort
+}
+
+// newInterface adds an interface named name, after the existing ones, and
+// returns its index.
+func (s *TestStack) newInterface(name string) int32 {
+	idx := int32(1)
+	for i := range s.InterfacesMap {
+		if i >= idx {
+			idx = i + 1
+		}
+	}
+	s.InterfacesMap[idx] = Interface{Name: name}
+	return idx
+}
@@ -0,0 +1,162 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+// BSD process accounting, as configured by acct(2).
+
+import (
+	"math"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/binary"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+)
+
+// SetAcctFile sets the file that process accounting records for processes in
+// ns are written to. If f is nil, process accounting is disabled. A reference
+// is taken on f.
+func (ns *PIDNamespace) SetAcctFile(f *fs.File) {
+	if f != nil {
+		f.IncRef()
+	}
+	ns.acctMu.Lock()
+	old := ns.acctFile
+	ns.acctFile = f
+	ns.acctMu.Unlock()
+	if old != nil {
+		old.DecRef()
+	}
+}
+
+// encodeCompT encodes v as a comp_t. See kernel/acct.c:encode_comp_t.
+func encodeCompT(v uint64) uint16 {
+	const (
+		mantSize = 13
+		expSize  = 3
+		maxFract = (1 << mantSize) - 1
+	)
+	var exp, rnd uint64
+	for v > maxFract {
+		// Round up?
+		rnd = v & (1 << (expSize - 1))
+		v >>= expSize
+		exp++
+	}
+	if rnd != 0 {
+		v++
+		if v > maxFract {
+			v >>= expSize
+			exp++
+		}
+	}
+	if exp >= 1<<expSize {
+		// Overflow; saturate.
+		return math.MaxUint16
+	}
+	return uint16(exp<<mantSize | v)
+}
+
+// ahzTicks returns d in units of linux.AHZ ticks.
+func ahzTicks(d time.Duration) uint64 {
+	if d < 0 {
+		return 0
+	}
+	return uint64(d / (time.Second / linux.AHZ))
+}
+
+// acctProcess writes a process accounting record for t's thread group to the
+// accounting files of t's PID namespace and all of its ancestors. This is
+// analogous to Linux's kernel/acct.c:acct_process.
+//
+// Preconditions: The caller must be running on the task goroutine. t must be
+// the last task in its thread group to exit, and must not have released its
+// MemoryManager yet.
+func (t *Task) acctProcess() {
+	// Check whether accounting is enabled anywhere before collecting
+	// statistics.
+	enabled := false
+	for ns := t.tg.pidns; ns != nil; ns = ns.parent {
+		ns.acctMu.Lock()
+		enabled = ns.acctFile != nil
+		ns.acctMu.Unlock()
+		if enabled {
+			break
+		}
+	}
+	if !enabled {
+		return
+	}
+
+	es := t.tg.ExitStatus()
+	cpu := t.tg.CPUStats()
+	var vsize uint64
+	if mm := t.MemoryManager(); mm != nil {
+		vsize = mm.VirtualMemorySize()
+	}
+	creds := t.Credentials()
+
+	t.tg.pidns.owner.mu.RLock()
+	leader := t.tg.leader
+	var parent *ThreadGroup
+	if leader.parent != nil {
+		parent = leader.parent.tg
+	}
+	forkedNoExec := t.tg.forkedNoExec
+	t.tg.pidns.owner.mu.RUnlock()
+
+	start := leader.StartTime()
+	elapsed := t.k.RealtimeClock().Now().Sub(start)
+
+	rec := linux.AcctV3{
+		Version:  linux.ACCT_VERSION,
+		ExitCode: es.Status(),
+		BTime:    uint32(start.Seconds()),
+		ETime:    math.Float32bits(float32(elapsed) / float32(time.Second/linux.AHZ)),
+		UTime:    encodeCompT(ahzTicks(cpu.UserTime)),
+		STime:    encodeCompT(ahzTicks(cpu.SysTime)),
+		Mem:      encodeCompT(vsize / 1024),
+		MinFlt:   encodeCompT(cpu.MinorFaults),
+		MajFlt:   encodeCompT(cpu.MajorFaults),
+	}
+	if forkedNoExec {
+		rec.Flag |= linux.AFORK
+	}
+	if es.Signaled() {
+		rec.Flag |= linux.AXSIG
+	}
+	// Leave room for the NUL terminator, like Linux's strlcpy.
+	copy(rec.Comm[:linux.ACCT_COMM-1], t.Name())
+
+	for ns := t.tg.pidns; ns != nil; ns = ns.parent {
+		rec.PID = uint32(ns.IDOfThreadGroup(t.tg))
+		rec.PPID = 0
+		if parent != nil {
+			rec.PPID = uint32(ns.IDOfThreadGroup(parent))
+		}
+		rec.UID = uint32(ns.userns.MapFromKUID(creds.RealKUID).OrOverflow())
+		rec.GID = uint32(ns.userns.MapFromKGID(creds.RealKGID).OrOverflow())
+		buf := binary.Marshal(nil, usermem.ByteOrder, &rec)
+
+		ns.acctMu.Lock()
+		if ns.acctFile != nil {
+			if _, err := ns.acctFile.Writev(t, usermem.BytesIOSequence(buf)); err != nil {
+				t.Debugf("Failed to write process accounting record: %v", err)
+			}
+		}
+		ns.acctMu.Unlock()
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/binary"
+)
+
+func TestEncodeCompT(t *testing.T) {
+	for _, test := range []struct {
+		v    uint64
+		want uint16
+	}{
+		{0, 0},
+		{1, 1},
+		{8191, 8191},
+		// 8192 = 1024 * 8^1.
+		{8192, 1<<13 | 1024},
+		// 8196 rounds up to 1025 * 8^1.
+		{8196, 1<<13 | 1025},
+		// 65535 rounds up to 8192 * 8^1, which is renormalized.
+		{65535, 2<<13 | 1024},
+		{1 << 50, 0xffff},
+	} {
+		if got := encodeCompT(test.v); got != test.want {
+			t.Errorf("encodeCompT(%d) = %#x, want %#x", test.v, got, test.want)
+		}
+	}
+}
+
+func TestAcctV3Size(t *testing.T) {
+	if got := binary.Size(linux.AcctV3{}); got != linux.SizeOfAcctV3 {
+		t.Errorf("binary.Size(AcctV3{}) = %d, want %d", got, linux.SizeOfAcctV3)
+	}
+}
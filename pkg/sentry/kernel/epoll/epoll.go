@@ -17,8 +17,11 @@
 package epoll
 
 import (
+	"bytes"
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"syscall"
 
 	"gvisor.googlesource.com/gvisor/pkg/refs"
@@ -64,6 +67,30 @@ type FileIdentifier struct {
 	Fd   kdefs.FD
 }
 
+// Entry states. See pollEntry.state.
+const (
+	// entryWaiting indicates that the entry is in no list, and is waiting
+	// for readyCallback to be called on it.
+	entryWaiting uint32 = iota
+
+	// entryPending indicates that readyCallback has been called on the
+	// entry, and that it is in EventPoll.pending.
+	entryPending
+
+	// entryReady indicates that the entry is in EventPoll.readyList.
+	entryReady
+
+	// entryReadyNotified is the same as entryReady, except that
+	// readyCallback has been called on the entry since its state was last
+	// set to entryReady.
+	entryReadyNotified
+
+	// entryDisabled indicates that the entry is in no list, and that
+	// readyCallback will not move it to one. This happens when a one-shot
+	// entry gets delivered via ReadEvents().
+	entryDisabled
+)
+
 // pollEntry holds all the state associated with an event poll entry, that is,
 // a file being observed by an event poll object.
 //
@@ -79,11 +106,15 @@ type pollEntry struct {
 
 	epoll *EventPoll
 
-	// We cannot save the current list pointer as it points into EventPoll
-	// struct, while state framework currently does not support such
-	// in-struct pointers. Instead, EventPoll will properly set this field
-	// in its loading logic.
-	curList *pollEntryList `state:"nosave"`
+	// state is one of the entry states above, and is accessed using atomic
+	// memory operations. readyCallback may move the entry out of
+	// entryWaiting or entryReady without holding any lock; all other
+	// transitions require epoll.listsMu.
+	state uint32
+
+	// pendingNext is the next entry in epoll.pending. It is only meaningful
+	// while state is entryPending.
+	pendingNext *pollEntry `state:"nosave"`
 }
 
 // WeakRefGone implements refs.WeakRefUser.WeakRefGone.
@@ -93,6 +124,43 @@ func (p *pollEntry) WeakRefGone() {
 	p.epoll.RemoveEntry(p.id)
 }
 
+// numFileShards is the number of shards between which an EventPoll divides
+// the files it observes.
+const numFileShards = 16
+
+// fileShard holds a subset of the files observed by an event poll object.
+// Sharding allows files with different FDs to be added, updated and removed
+// concurrently.
+//
+// +stateify savable
+type fileShard struct {
+	// mu protects files.
+	mu sync.Mutex `state:"nosave"`
+
+	// files maps the files in this shard to their entries. It is allocated
+	// when the first file is added.
+	files map[FileIdentifier]*pollEntry
+}
+
+// observes checks if any file in s is or observes event poll object ep.
+func (s *fileShard) observes(ep *EventPoll, depthLeft int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id := range s.files {
+		f, ok := id.File.FileOperations.(*EventPoll)
+		if !ok {
+			continue
+		}
+
+		if f == ep || f.observes(ep, depthLeft-1) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // EventPoll holds all the state associated with an event poll object, that is,
 // collection of files to observe and their current state.
 //
@@ -109,32 +177,29 @@ type EventPoll struct {
 	// object itself becomes readable or writable.
 	waiter.Queue `state:"zerovalue"`
 
-	// files is the map of all the files currently being observed, it is
-	// protected by mu.
-	mu    sync.Mutex `state:"nosave"`
-	files map[FileIdentifier]*pollEntry
-
-	// listsMu protects manipulation of the lists below. It needs to be a
-	// different lock to avoid circular lock acquisition order involving
-	// the wait queue mutexes and mu. The full order is mu, observed file
-	// wait queue mutex, then listsMu; this allows listsMu to be acquired
-	// when readyCallback is called.
-	//
-	// An entry is always in one of the following lists:
-	//	readyList -- when there's a chance that it's ready to have
-	//		events delivered to epoll waiters. Given that being
-	//		ready is a transient state, the Readiness() and
-	//		readEvents() functions always call the entry's file
-	//		Readiness() function to confirm it's ready.
-	//	waitingList -- when there's no chance that the entry is ready,
-	//		so it's waiting for the readyCallback to be called
-	//		on it before it gets moved to the readyList.
-	//	disabledList -- when the entry is disabled. This happens when
-	//		a one-shot entry gets delivered via readEvents().
-	listsMu      sync.Mutex `state:"nosave"`
-	readyList    pollEntryList
-	waitingList  pollEntryList
-	disabledList pollEntryList
+	// shards hold all the files currently being observed, indexed by FD
+	// modulo numFileShards.
+	shards [numFileShards]fileShard
+
+	// pending holds entries that readyCallback has moved out of
+	// entryWaiting, but that haven't yet been moved to readyList. It is
+	// lock-free so that readiness notifications from observed files don't
+	// contend with each other or with ReadEvents().
+	pending pendingStack `state:"nosave"`
+
+	// listsMu protects readyList and the entry state transitions not made
+	// by readyCallback. It needs to be a different lock from the shard
+	// mutexes to avoid circular lock acquisition order involving the wait
+	// queue mutexes. The full order is shard mutex, observed file wait
+	// queue mutex, then listsMu.
+	listsMu sync.Mutex `state:"nosave"`
+
+	// readyList holds entries for which there's a chance that they're
+	// ready to have events delivered to epoll waiters. Given that being
+	// ready is a transient state, the Readiness() and ReadEvents()
+	// functions always call the entry's file Readiness() function to
+	// confirm it's ready.
+	readyList pollEntryList
 }
 
 // cycleMu is used to serialize all the cycle checks. This is only used when
@@ -154,22 +219,30 @@ var cycleMu sync.Mutex
 func NewEventPoll(ctx context.Context) *fs.File {
 	// name matches fs/eventpoll.c:epoll_create1.
 	dirent := fs.NewDirent(anon.NewInode(ctx), fmt.Sprintf("anon_inode:[eventpoll]"))
-	return fs.NewFile(ctx, dirent, fs.FileFlags{}, &EventPoll{
-		files: make(map[FileIdentifier]*pollEntry),
-	})
+	return fs.NewFile(ctx, dirent, fs.FileFlags{}, &EventPoll{})
+}
+
+// shard returns the shard holding the file identified by id.
+func (e *EventPoll) shard(id FileIdentifier) *fileShard {
+	return &e.shards[uint(id.Fd)%numFileShards]
 }
 
 // Release implements fs.FileOperations.Release.
 func (e *EventPoll) Release() {
-	// We need to take the lock now because files may be attempting to
-	// remove entries in parallel if they get destroyed.
-	e.mu.Lock()
-	defer e.mu.Unlock()
-
-	// Go through all entries and clean up.
-	for _, entry := range e.files {
-		entry.id.File.EventUnregister(&entry.waiter)
-		entry.file.Drop()
+	for i := range e.shards {
+		s := &e.shards[i]
+
+		// We need to take the lock now because files may be attempting
+		// to remove entries in parallel if they get destroyed.
+		s.mu.Lock()
+
+		// Go through all entries and clean up.
+		for _, entry := range s.files {
+			entry.id.File.EventUnregister(&entry.waiter)
+			entry.file.Drop()
+		}
+
+		s.mu.Unlock()
 	}
 }
 
@@ -183,30 +256,60 @@ func (*EventPoll) Write(context.Context, *fs.File, usermem.IOSequence, int64) (i
 	return 0, syscall.ENOSYS
 }
 
+// drainPending moves all entries in e.pending to e.readyList.
+//
+// Preconditions: e.listsMu must be locked.
+func (e *EventPoll) drainPending() {
+	for entry := e.pending.popAll(); entry != nil; {
+		next := entry.pendingNext
+		entry.pendingNext = nil
+
+		// Pending entries are ignored by readyCallback, so this can't
+		// race with it.
+		atomic.StoreUint32(&entry.state, entryReady)
+		e.readyList.PushBack(entry)
+
+		entry = next
+	}
+}
+
+// checkReadiness returns the events in mask for which entry's file is ready.
+// If it isn't ready for any of them, the entry is moved out of the ready list
+// unless readyCallback is called on it concurrently.
+//
+// Preconditions: e.listsMu must be locked. entry must be in e.readyList.
+func (e *EventPoll) checkReadiness(entry *pollEntry, mask waiter.EventMask) waiter.EventMask {
+	// Consume earlier notifications before checking readiness, so that
+	// notifications racing with the check keep the entry in the list.
+	atomic.StoreUint32(&entry.state, entryReady)
+
+	ready := entry.id.File.Readiness(entry.mask) & mask
+	if ready == 0 && atomic.CompareAndSwapUint32(&entry.state, entryReady, entryWaiting) {
+		// readyCallback may push the entry to e.pending as soon as it's
+		// waiting, but it only touches pendingNext, and e.pending is
+		// only drained with e.listsMu locked.
+		e.readyList.Remove(entry)
+	}
+	return ready
+}
+
 // eventsAvailable determines if 'e' has events available for delivery.
 func (e *EventPoll) eventsAvailable() bool {
 	e.listsMu.Lock()
+	defer e.listsMu.Unlock()
 
+	e.drainPending()
 	for it := e.readyList.Front(); it != nil; {
 		entry := it
 		it = it.Next()
 
 		// If the entry is ready, we know 'e' has at least one entry
 		// ready for delivery.
-		ready := entry.id.File.Readiness(entry.mask)
-		if ready != 0 {
-			e.listsMu.Unlock()
+		if e.checkReadiness(entry, ^waiter.EventMask(0)) != 0 {
 			return true
 		}
-
-		// Entry is not ready, so move it to waiting list.
-		e.readyList.Remove(entry)
-		e.waitingList.PushBack(entry)
-		entry.curList = &e.waitingList
 	}
 
-	e.listsMu.Unlock()
-
 	return false
 }
 
@@ -230,19 +333,15 @@ func (e *EventPoll) ReadEvents(max int) []Event {
 	e.listsMu.Lock()
 
 	// Go through all entries we believe may be ready.
+	e.drainPending()
 	for it := e.readyList.Front(); it != nil && len(ret) < max; {
 		entry := it
 		it = it.Next()
 
 		// Check the entry's readiness. It it's not really ready, we
-		// just put it back in the waiting list and move on to the next
-		// entry.
-		ready := entry.id.File.Readiness(entry.mask) & entry.mask
+		// just move on to the next entry.
+		ready := e.checkReadiness(entry, entry.mask)
 		if ready == 0 {
-			e.readyList.Remove(entry)
-			e.waitingList.PushBack(entry)
-			entry.curList = &e.waitingList
-
 			continue
 		}
 
@@ -252,20 +351,17 @@ func (e *EventPoll) ReadEvents(max int) []Event {
 			Data:   entry.userData,
 		})
 
-		// The entry is consumed, so we must move it to the disabled
-		// list in case it's one-shot, or back to the wait list if it's
-		// edge-triggered. If it's neither, we leave it in the ready
-		// list so that its readiness can be checked the next time
-		// around; however, we must move it to the end of the list so
-		// that other events can be delivered as well.
+		// The entry is consumed, so we must disable it in case it's
+		// one-shot, or make it wait if it's edge-triggered. If it's
+		// neither, or an edge-triggered entry was notified again
+		// while we were checking it, we leave it in the ready list so
+		// that its readiness can be checked the next time around;
+		// however, we must move it to the end of the list so that
+		// other events can be delivered as well.
 		e.readyList.Remove(entry)
 		if entry.flags&OneShot != 0 {
-			e.disabledList.PushBack(entry)
-			entry.curList = &e.disabledList
-		} else if entry.flags&EdgeTriggered != 0 {
-			e.waitingList.PushBack(entry)
-			entry.curList = &e.waitingList
-		} else {
+			atomic.StoreUint32(&entry.state, entryDisabled)
+		} else if entry.flags&EdgeTriggered == 0 || !atomic.CompareAndSwapUint32(&entry.state, entryReady, entryWaiting) {
 			local.PushBack(entry)
 		}
 	}
@@ -278,7 +374,7 @@ func (e *EventPoll) ReadEvents(max int) []Event {
 }
 
 // readyCallback is called when one of the files we're polling becomes ready. It
-// moves said file to the readyList if it's currently in the waiting list.
+// moves said file to the pending stack if it's currently waiting.
 type readyCallback struct{}
 
 // Callback implements waiter.EntryCallback.Callback.
@@ -286,29 +382,32 @@ func (*readyCallback) Callback(w *waiter.Entry) {
 	entry := w.Context.(*pollEntry)
 	e := entry.epoll
 
-	e.listsMu.Lock()
-
-	if entry.curList == &e.waitingList {
-		e.waitingList.Remove(entry)
-		e.readyList.PushBack(entry)
-		entry.curList = &e.readyList
-
-		e.Notify(waiter.EventIn)
+	for {
+		switch atomic.LoadUint32(&entry.state) {
+		case entryWaiting:
+			if atomic.CompareAndSwapUint32(&entry.state, entryWaiting, entryPending) {
+				e.pending.push(entry)
+				e.Notify(waiter.EventIn)
+				return
+			}
+		case entryReady:
+			if atomic.CompareAndSwapUint32(&entry.state, entryReady, entryReadyNotified) {
+				return
+			}
+		default:
+			// The entry is already pending, has already been
+			// notified, or is disabled.
+			return
+		}
 	}
-
-	e.listsMu.Unlock()
 }
 
 // initEntryReadiness initializes the entry's state with regards to its
-// readiness by placing it in the appropriate list and registering for
+// readiness by registering for notifications.
+//
+// Preconditions: entry must be waiting, and must not be registered for
 // notifications.
 func (e *EventPoll) initEntryReadiness(entry *pollEntry) {
-	// A new entry starts off in the waiting list.
-	e.listsMu.Lock()
-	e.waitingList.PushBack(entry)
-	entry.curList = &e.waitingList
-	e.listsMu.Unlock()
-
 	// Register for event notifications.
 	f := entry.id.File
 	f.EventRegister(&entry.waiter, entry.mask)
@@ -320,6 +419,55 @@ func (e *EventPoll) initEntryReadiness(entry *pollEntry) {
 	}
 }
 
+// resetEntryReadiness removes the entry from whatever list it's in, and makes
+// it wait.
+//
+// Preconditions: entry must not be registered for notifications, so that
+// readyCallback is guaranteed to not be called on it.
+func (e *EventPoll) resetEntryReadiness(entry *pollEntry) {
+	e.listsMu.Lock()
+
+	// The entry may be pending, in which case it must be moved to the
+	// ready list before it can be removed.
+	e.drainPending()
+	switch atomic.LoadUint32(&entry.state) {
+	case entryReady, entryReadyNotified:
+		e.readyList.Remove(entry)
+	}
+	atomic.StoreUint32(&entry.state, entryWaiting)
+
+	e.listsMu.Unlock()
+}
+
+// FdInfo implements fs.FdInfoer.FdInfo. It reports the observed files, as in
+// Linux's fs/eventpoll.c:ep_show_fdinfo.
+func (e *EventPoll) FdInfo(ctx context.Context) string {
+	var entries []*pollEntry
+	for i := range e.shards {
+		e.shards[i].mu.Lock()
+		defer e.shards[i].mu.Unlock()
+		for _, entry := range e.shards[i].files {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].id.Fd < entries[j].id.Fd })
+
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		events := uint32(entry.mask)
+		if entry.flags&OneShot != 0 {
+			events |= syscall.EPOLLONESHOT
+		}
+		if entry.flags&EdgeTriggered != 0 {
+			events |= -syscall.EPOLLET
+		}
+		data := uint64(uint32(entry.userData[0])) | uint64(uint32(entry.userData[1]))<<32
+		f := entry.id.File
+		fmt.Fprintf(&buf, "tfd: %8d events: %8x data: %16x  pos:%d ino:%x sdev:%x\n", entry.id.Fd, events, data, f.Offset(), f.Dirent.Inode.StableAttr.InodeID, f.Dirent.Inode.StableAttr.DeviceID)
+	}
+	return buf.String()
+}
+
 // observes checks if event poll object e is directly or indirectly observing
 // event poll object ep. It uses a bounded recursive depth-first search.
 func (e *EventPoll) observes(ep *EventPoll, depthLeft int) bool {
@@ -329,17 +477,9 @@ func (e *EventPoll) observes(ep *EventPoll, depthLeft int) bool {
 		return true
 	}
 
-	e.mu.Lock()
-	defer e.mu.Unlock()
-
 	// Go through each observed file and check if it is or observes ep.
-	for id := range e.files {
-		f, ok := id.File.FileOperations.(*EventPoll)
-		if !ok {
-			continue
-		}
-
-		if f == ep || f.observes(ep, depthLeft-1) {
+	for i := range e.shards {
+		if e.shards[i].observes(ep, depthLeft) {
 			return true
 		}
 	}
@@ -356,11 +496,12 @@ func (e *EventPoll) AddEntry(id FileIdentifier, flags EntryFlags, mask waiter.Ev
 		defer cycleMu.Unlock()
 	}
 
-	e.mu.Lock()
-	defer e.mu.Unlock()
+	s := e.shard(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	// Fail if the file already has an entry.
-	if _, ok := e.files[id]; ok {
+	if _, ok := s.files[id]; ok {
 		return syscall.EEXIST
 	}
 
@@ -388,9 +529,13 @@ func (e *EventPoll) AddEntry(id FileIdentifier, flags EntryFlags, mask waiter.Ev
 		flags:    flags,
 		waiter:   waiter.Entry{Callback: &readyCallback{}},
 		mask:     mask,
+		state:    entryWaiting,
 	}
 	entry.waiter.Context = entry
-	e.files[id] = entry
+	if s.files == nil {
+		s.files = make(map[FileIdentifier]*pollEntry)
+	}
+	s.files[id] = entry
 	entry.file = refs.NewWeakRef(id.File, entry)
 
 	// Initialize the readiness state of the new entry.
@@ -402,25 +547,24 @@ func (e *EventPoll) AddEntry(id FileIdentifier, flags EntryFlags, mask waiter.Ev
 // UpdateEntry updates the flags, mask and user data associated with a file that
 // is already part of the collection of observed files.
 func (e *EventPoll) UpdateEntry(id FileIdentifier, flags EntryFlags, mask waiter.EventMask, data [2]int32) error {
-	e.mu.Lock()
-	defer e.mu.Unlock()
+	s := e.shard(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	// Fail if the file doesn't have an entry.
-	entry, ok := e.files[id]
+	entry, ok := s.files[id]
 	if !ok {
 		return syscall.ENOENT
 	}
 
-	// Unregister the old mask and remove entry from the list it's in, so
-	// readyCallback is guaranteed to not be called on this entry anymore.
+	// Unregister the old mask, so readyCallback is guaranteed to not be
+	// called on this entry anymore.
 	entry.id.File.EventUnregister(&entry.waiter)
 
 	// Remove entry from whatever list it's in. This ensure that no other
 	// threads have access to this entry as the only way left to find it
-	// is via e.files, but we hold e.mu, which prevents that.
-	e.listsMu.Lock()
-	entry.curList.Remove(entry)
-	e.listsMu.Unlock()
+	// is via s.files, but we hold s.mu, which prevents that.
+	e.resetEntryReadiness(entry)
 
 	// Initialize new readiness state.
 	entry.flags = flags
@@ -433,11 +577,12 @@ func (e *EventPoll) UpdateEntry(id FileIdentifier, flags EntryFlags, mask waiter
 
 // RemoveEntry a files from the collection of observed files.
 func (e *EventPoll) RemoveEntry(id FileIdentifier) error {
-	e.mu.Lock()
-	defer e.mu.Unlock()
+	s := e.shard(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	// Fail if the file doesn't have an entry.
-	entry, ok := e.files[id]
+	entry, ok := s.files[id]
 	if !ok {
 		return syscall.ENOENT
 	}
@@ -447,13 +592,10 @@ func (e *EventPoll) RemoveEntry(id FileIdentifier) error {
 	entry.id.File.EventUnregister(&entry.waiter)
 
 	// Remove from the current list.
-	e.listsMu.Lock()
-	entry.curList.Remove(entry)
-	entry.curList = nil
-	e.listsMu.Unlock()
+	e.resetEntryReadiness(entry)
 
 	// Remove file from map, and drop weak reference.
-	delete(e.files, id)
+	delete(s.files, id)
 	entry.file.Drop()
 
 	return nil
@@ -462,10 +604,12 @@ func (e *EventPoll) RemoveEntry(id FileIdentifier) error {
 // UnregisterEpollWaiters removes the epoll waiter objects from the waiting
 // queues. This is different from Release() as the file is not dereferenced.
 func (e *EventPoll) UnregisterEpollWaiters() {
-	e.mu.Lock()
-	defer e.mu.Unlock()
-
-	for _, entry := range e.files {
-		entry.id.File.EventUnregister(&entry.waiter)
+	for i := range e.shards {
+		s := &e.shards[i]
+		s.mu.Lock()
+		for _, entry := range s.files {
+			entry.id.File.EventUnregister(&entry.waiter)
+		}
+		s.mu.Unlock()
 	}
 }
@@ -27,23 +27,22 @@ func (p *pollEntry) afterLoad() {
 	p.id.File.EventRegister(&p.waiter, p.mask)
 }
 
-// afterLoad is invoked by stateify.
-func (e *EventPoll) afterLoad() {
+// beforeSave is invoked by stateify.
+func (e *EventPoll) beforeSave() {
+	// Pending entries must be moved to the ready list, as the pending stack
+	// isn't saved.
 	e.listsMu.Lock()
-	defer e.listsMu.Unlock()
-
-	for _, ls := range []*pollEntryList{&e.waitingList, &e.readyList, &e.disabledList} {
-		for it := ls.Front(); it != nil; it = it.Next() {
-			it.curList = ls
-		}
-	}
+	e.drainPending()
+	e.listsMu.Unlock()
+}
 
-	for it := e.waitingList.Front(); it != nil; it = it.Next() {
-		if it.id.File.Readiness(it.mask) != 0 {
-			e.waitingList.Remove(it)
-			e.readyList.PushBack(it)
-			it.curList = &e.readyList
-			e.Notify(waiter.EventIn)
+// afterLoad is invoked by stateify.
+func (e *EventPoll) afterLoad() {
+	for i := range e.shards {
+		for _, entry := range e.shards[i].files {
+			if entry.state == entryWaiting && entry.id.File.Readiness(entry.mask) != 0 {
+				(*readyCallback).Callback(nil, &entry.waiter)
+			}
 		}
 	}
 }
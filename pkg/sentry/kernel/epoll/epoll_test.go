@@ -15,10 +15,12 @@
 package epoll
 
 import (
+	"sync"
 	"testing"
 
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context/contexttest"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/filetest"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/kdefs"
 	"gvisor.googlesource.com/gvisor/pkg/waiter"
 )
 
@@ -52,3 +54,56 @@ func TestFileDestroyed(t *testing.T) {
 	}
 
 }
+
+func TestEdgeTriggeredNotify(t *testing.T) {
+	const numFiles = 100
+
+	efile := NewEventPoll(contexttest.Context(t))
+	e := efile.FileOperations.(*EventPoll)
+
+	var entries []*pollEntry
+	for i := 0; i < numFiles; i++ {
+		f := filetest.NewTestFile(t)
+		defer f.DecRef()
+		id := FileIdentifier{f, kdefs.FD(i)}
+		if err := e.AddEntry(id, EdgeTriggered, waiter.EventIn, [2]int32{int32(i)}); err != nil {
+			t.Fatalf("addEntry failed: %v", err)
+		}
+		entries = append(entries, e.shard(id).files[id])
+	}
+
+	// Test files are always ready, so every entry is reported once.
+	if evt := e.ReadEvents(numFiles + 1); len(evt) != numFiles {
+		t.Fatalf("Unexpected number of ready events: want %v, got %v", numFiles, len(evt))
+	}
+	if evt := e.ReadEvents(numFiles + 1); len(evt) != 0 {
+		t.Fatalf("Unexpected number of ready events: want %v, got %v", 0, len(evt))
+	}
+
+	// Notify every other entry several times concurrently. Each is then
+	// reported exactly once.
+	var wg sync.WaitGroup
+	for i := 0; i < numFiles; i += 2 {
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func(entry *pollEntry) {
+				defer wg.Done()
+				entry.waiter.Callback.Callback(&entry.waiter)
+			}(entries[i])
+		}
+	}
+	wg.Wait()
+
+	evt := e.ReadEvents(numFiles + 1)
+	if len(evt) != numFiles/2 {
+		t.Fatalf("Unexpected number of ready events: want %v, got %v", numFiles/2, len(evt))
+	}
+	for _, ev := range evt {
+		if ev.Data[0]%2 != 0 {
+			t.Errorf("Unexpected event for entry %d", ev.Data[0])
+		}
+	}
+	if evt := e.ReadEvents(numFiles + 1); len(evt) != 0 {
+		t.Fatalf("Unexpected number of ready events: want %v, got %v", 0, len(evt))
+	}
+}
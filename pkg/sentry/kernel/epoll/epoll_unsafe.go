@@ -0,0 +1,58 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package epoll
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// pendingStack is a lock-free stack of entries linked by pollEntry.pendingNext.
+// Entries may be pushed concurrently, but can only be popped all at once.
+// Since entries are never popped individually, the stack is not subject to
+// the ABA problem.
+//
+// The zero value for pendingStack is an empty stack ready for use.
+type pendingStack struct {
+	// head is the *pollEntry at the top of the stack, or nil if the stack
+	// is empty.
+	head unsafe.Pointer
+}
+
+// push pushes entry onto the stack.
+//
+// Preconditions: entry must not be in the stack.
+func (s *pendingStack) push(entry *pollEntry) {
+	for {
+		head := atomic.LoadPointer(&s.head)
+		entry.pendingNext = (*pollEntry)(head)
+		if atomic.CompareAndSwapPointer(&s.head, head, unsafe.Pointer(entry)) {
+			return
+		}
+	}
+}
+
+// popAll empties the stack, and returns its former entries linked by
+// pollEntry.pendingNext, in the order in which they were pushed.
+func (s *pendingStack) popAll() *pollEntry {
+	var first *pollEntry
+	for entry := (*pollEntry)(atomic.SwapPointer(&s.head, nil)); entry != nil; {
+		next := entry.pendingNext
+		entry.pendingNext = first
+		first = entry
+		entry = next
+	}
+	return first
+}
@@ -17,6 +17,7 @@
 package eventfd
 
 import (
+	"fmt"
 	"math"
 	"sync"
 	"syscall"
@@ -101,6 +102,16 @@ func (e *EventOperations) HostFD() (int, error) {
 	return e.hostfd, nil
 }
 
+// FdInfo implements fs.FdInfoer.FdInfo. It reports the counter, as in Linux's
+// fs/eventfd.c:eventfd_show_fdinfo. The counter of an eventfd passed through
+// to the host can't be read without consuming it, so the value it had when it
+// was passed through is reported.
+func (e *EventOperations) FdInfo(ctx context.Context) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return fmt.Sprintf("eventfd-count: %16x\n", e.val)
+}
+
 // Release implements fs.FileOperations.Release.
 func (e *EventOperations) Release() {
 	e.mu.Lock()
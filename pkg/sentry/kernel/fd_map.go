@@ -17,7 +17,6 @@ package kernel
 import (
 	"bytes"
 	"fmt"
-	"sort"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -82,13 +81,20 @@ type descriptor struct {
 
 // FDMap is used to manage File references and flags.
 //
+// Lookups (GetFile, GetDescriptor) do not take any locks, so that tasks
+// sharing an FDMap don't contend on it. Changes to the map are serialized by
+// mu.
+//
 // +stateify savable
 type FDMap struct {
 	refs.AtomicRefCount
-	k     *Kernel
-	files map[kdefs.FD]descriptor
-	mu    sync.RWMutex `state:"nosave"`
-	uid   uint64
+	k   *Kernel
+	uid uint64
+
+	// mu serializes changes to descriptorTable.
+	mu sync.Mutex `state:"nosave"`
+
+	descriptorTable
 }
 
 // ID returns a unique identifier for this FDMap.
@@ -98,11 +104,12 @@ func (f *FDMap) ID() uint64 {
 
 // NewFDMap allocates a new FDMap that may be used by tasks in k.
 func (k *Kernel) NewFDMap() *FDMap {
-	return &FDMap{
-		k:     k,
-		files: make(map[kdefs.FD]descriptor),
-		uid:   atomic.AddUint64(&k.fdMapUids, 1),
+	f := &FDMap{
+		k:   k,
+		uid: atomic.AddUint64(&k.fdMapUids, 1),
 	}
+	f.init()
+	return f
 }
 
 // destroy removes all of the file descriptors from the map.
@@ -119,22 +126,22 @@ func (f *FDMap) DecRef() {
 
 // Size returns the number of file descriptor slots currently allocated.
 func (f *FDMap) Size() int {
-	f.mu.RLock()
-	defer f.mu.RUnlock()
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-	return len(f.files)
+	return f.count
 }
 
 // String is a stringer for FDMap.
 func (f *FDMap) String() string {
-	f.mu.RLock()
-	defer f.mu.RUnlock()
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
 	var b bytes.Buffer
-	for k, v := range f.files {
-		n, _ := v.file.Dirent.FullName(nil /* root */)
-		b.WriteString(fmt.Sprintf("\tfd:%d => name %s\n", k, n))
-	}
+	f.forEach(func(fd kdefs.FD, file *fs.File, flags FDFlags) {
+		n, _ := file.Dirent.FullName(nil /* root */)
+		b.WriteString(fmt.Sprintf("\tfd:%d => name %s\n", fd, n))
+	})
 	return b.String()
 }
 
@@ -150,17 +157,14 @@ func (f *FDMap) NewFDFrom(fd kdefs.FD, file *fs.File, flags FDFlags, limitSet *l
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	// Finds the lowest fd not in the handles map.
-	lim := limitSet.Get(limits.NumberOfFiles)
-	for i := fd; lim.Cur == limits.Infinity || i < kdefs.FD(lim.Cur); i++ {
-		if _, ok := f.files[i]; !ok {
-			file.IncRef()
-			f.files[i] = descriptor{file, flags}
-			return i, nil
-		}
+	// Finds the lowest unused fd.
+	i := f.firstFree(fd)
+	if lim := limitSet.Get(limits.NumberOfFiles); lim.Cur != limits.Infinity && uint64(i) >= lim.Cur {
+		return -1, syscall.EMFILE
 	}
-
-	return -1, syscall.EMFILE
+	file.IncRef()
+	f.set(i, file, flags)
+	return i, nil
 }
 
 // NewFDAt sets the file reference for the given FD. If there is an
@@ -187,24 +191,24 @@ func (f *FDMap) NewFDAt(fd kdefs.FD, file *fs.File, flags FDFlags, limitSet *lim
 	// time, it's best to first call f.muUnlock beore so we are
 	// not blocking other uses of this FDMap on the DecRef() call.
 	f.mu.Lock()
-	oldDesc, oldExists := f.files[fd]
+	oldFile, _ := f.get(fd)
 	lim := limitSet.Get(limits.NumberOfFiles).Cur
 	// if we're closing one then the effective limit is one
 	// more than the actual limit.
-	if oldExists && lim != limits.Infinity {
+	if oldFile != nil && lim != limits.Infinity {
 		lim++
 	}
-	if lim != limits.Infinity && fd >= kdefs.FD(lim) {
+	if lim != limits.Infinity && uint64(fd) >= lim {
 		f.mu.Unlock()
 		return syscall.EMFILE
 	}
 
 	file.IncRef()
-	f.files[fd] = descriptor{file, flags}
+	f.set(fd, file, flags)
 	f.mu.Unlock()
 
-	if oldExists {
-		oldDesc.file.DecRef()
+	if oldFile != nil {
+		oldFile.DecRef()
 	}
 	return nil
 }
@@ -214,12 +218,22 @@ func (f *FDMap) SetFlags(fd kdefs.FD, flags FDFlags) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	desc, ok := f.files[fd]
-	if !ok {
-		return
+	if file, _ := f.get(fd); file != nil {
+		f.set(fd, file, flags)
 	}
+}
+
+// SetFlagsRange sets the flags for all valid file descriptors in the
+// inclusive range [first, last].
+func (f *FDMap) SetFlagsRange(first, last kdefs.FD, flags FDFlags) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-	f.files[fd] = descriptor{desc.file, flags}
+	f.forEach(func(fd kdefs.FD, file *fs.File, _ FDFlags) {
+		if fd >= first && fd <= last {
+			f.set(fd, file, flags)
+		}
+	})
 }
 
 // GetDescriptor returns a reference to the file and the flags for the FD. It
@@ -227,14 +241,17 @@ func (f *FDMap) SetFlags(fd kdefs.FD, flags FDFlags) {
 // for the FD, i.e. if the FD is invalid. The caller must use DecRef
 // when they are done.
 func (f *FDMap) GetDescriptor(fd kdefs.FD) (*fs.File, FDFlags) {
-	f.mu.RLock()
-	defer f.mu.RUnlock()
-
-	if desc, ok := f.files[fd]; ok {
-		desc.file.IncRef()
-		return desc.file, desc.flags
+	for {
+		file, flags := f.get(fd)
+		if file == nil {
+			return nil, FDFlags{}
+		}
+		// The file may be concurrently removed from the map and released,
+		// in which case the FD has changed, so try again.
+		if file.TryIncRef() {
+			return file, flags
+		}
 	}
-	return nil, FDFlags{}
 }
 
 // GetFile returns a reference to the File for the FD and bumps
@@ -242,62 +259,46 @@ func (f *FDMap) GetDescriptor(fd kdefs.FD) (*fs.File, FDFlags) {
 // for the FD, i.e. if the FD is invalid. The caller must use DecRef
 // when they are done.
 func (f *FDMap) GetFile(fd kdefs.FD) *fs.File {
-	f.mu.RLock()
-	if desc, ok := f.files[fd]; ok {
-		desc.file.IncRef()
-		f.mu.RUnlock()
-		return desc.file
-	}
-	f.mu.RUnlock()
-	return nil
-}
-
-// fds returns an ordering of FDs.
-func (f *FDMap) fds() FDs {
-	fds := make(FDs, 0, len(f.files))
-	for fd := range f.files {
-		fds = append(fds, fd)
-	}
-	sort.Sort(fds)
-	return fds
+	file, _ := f.GetDescriptor(fd)
+	return file
 }
 
 // GetFDs returns a list of valid fds.
 func (f *FDMap) GetFDs() FDs {
-	f.mu.RLock()
-	defer f.mu.RUnlock()
-	return f.fds()
+	var fds FDs
+	f.forEach(func(fd kdefs.FD, _ *fs.File, _ FDFlags) {
+		fds = append(fds, fd)
+	})
+	return fds
 }
 
 // GetRefs returns a stable slice of references to all files and bumps the
 // reference count on each.  The caller must use DecRef on each reference when
 // they're done using the slice.
 func (f *FDMap) GetRefs() []*fs.File {
-	f.mu.RLock()
-	defer f.mu.RUnlock()
-
-	fds := f.fds()
-	fs := make([]*fs.File, 0, len(fds))
-	for _, fd := range fds {
-		desc := f.files[fd]
-		desc.file.IncRef()
-		fs = append(fs, desc.file)
-	}
-	return fs
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var files []*fs.File
+	f.forEach(func(_ kdefs.FD, file *fs.File, _ FDFlags) {
+		file.IncRef()
+		files = append(files, file)
+	})
+	return files
 }
 
 // Fork returns an independent FDMap pointing to the same descriptors.
 func (f *FDMap) Fork() *FDMap {
-	f.mu.RLock()
-	defer f.mu.RUnlock()
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
 	clone := f.k.NewFDMap()
 
 	// Grab a extra reference for every file.
-	for fd, desc := range f.files {
-		desc.file.IncRef()
-		clone.files[fd] = desc
-	}
+	f.forEach(func(fd kdefs.FD, file *fs.File, flags FDFlags) {
+		file.IncRef()
+		clone.set(fd, file, flags)
+	})
 
 	// That's it!
 	return clone
@@ -332,33 +333,55 @@ func inotifyFileClose(f *fs.File) {
 // one was found. Callers are expected to decrement the reference count on
 // the File. Otherwise returns (nil, false).
 func (f *FDMap) Remove(fd kdefs.FD) (*fs.File, bool) {
+	if fd < 0 {
+		return nil, false
+	}
 	f.mu.Lock()
-	desc := f.files[fd]
-	delete(f.files, fd)
+	file := f.set(fd, nil, FDFlags{})
 	f.mu.Unlock()
-	if desc.file != nil {
-		f.unlock(desc.file)
-		inotifyFileClose(desc.file)
-		return desc.file, true
+	if file != nil {
+		f.unlock(file)
+		inotifyFileClose(file)
+		return file, true
 	}
 	return nil, false
 }
 
+// RemoveRange removes all FDs in the inclusive range [first, last], and
+// returns the removed Files. Callers are expected to decrement the reference
+// count on each File.
+func (f *FDMap) RemoveRange(first, last kdefs.FD) []*fs.File {
+	return f.remove(func(fd kdefs.FD, _ *fs.File, _ FDFlags) bool {
+		return fd >= first && fd <= last
+	})
+}
+
 // RemoveIf removes all FDs where cond is true.
 func (f *FDMap) RemoveIf(cond func(*fs.File, FDFlags) bool) {
+	removed := f.remove(func(_ kdefs.FD, file *fs.File, flags FDFlags) bool {
+		return cond(file, flags)
+	})
+	for _, file := range removed {
+		file.DecRef()
+	}
+}
+
+// remove removes all FDs where cond is true, and returns the removed Files.
+// Callers are expected to decrement the reference count on each File.
+func (f *FDMap) remove(cond func(kdefs.FD, *fs.File, FDFlags) bool) []*fs.File {
 	var removed []*fs.File
 	f.mu.Lock()
-	for fd, desc := range f.files {
-		if desc.file != nil && cond(desc.file, desc.flags) {
-			delete(f.files, fd)
-			removed = append(removed, desc.file)
+	f.forEach(func(fd kdefs.FD, file *fs.File, flags FDFlags) {
+		if cond(fd, file, flags) {
+			f.set(fd, nil, FDFlags{})
+			removed = append(removed, file)
 		}
-	}
+	})
 	f.mu.Unlock()
 
 	for _, file := range removed {
 		f.unlock(file)
 		inotifyFileClose(file)
-		file.DecRef()
 	}
+	return removed
 }
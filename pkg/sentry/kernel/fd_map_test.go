@@ -29,9 +29,9 @@ const (
 )
 
 func newTestFDMap() *FDMap {
-	return &FDMap{
-		files: make(map[kdefs.FD]descriptor),
-	}
+	f := &FDMap{}
+	f.init()
+	return f
 }
 
 // TestFDMapMany allocates maxFD FDs, i.e. maxes out the FDMap,
@@ -134,3 +134,69 @@ func TestDescriptorFlags(t *testing.T) {
 		t.Fatalf("new File flags %+v don't match original %+v", newFlags, origFlags)
 	}
 }
+
+func TestFDMapRange(t *testing.T) {
+	file := filetest.NewTestFile(t)
+	f := newTestFDMap()
+	limitSet := limits.NewLimitSet()
+	limitSet.Set(limits.NumberOfFiles, limits.Limit{maxFD, maxFD})
+
+	for i := 0; i < 10; i++ {
+		if _, err := f.NewFDFrom(0, file, FDFlags{}, limitSet); err != nil {
+			t.Fatalf("f.NewFDFrom(0, r, FDFlags{}): got %v, wanted nil", err)
+		}
+	}
+
+	f.SetFlagsRange(2, 4, FDFlags{CloseOnExec: true})
+	for fd := kdefs.FD(0); fd < 10; fd++ {
+		_, flags := f.GetDescriptor(fd)
+		if want := fd >= 2 && fd <= 4; flags.CloseOnExec != want {
+			t.Errorf("FD %d: got CloseOnExec %t, want %t", fd, flags.CloseOnExec, want)
+		}
+	}
+
+	removed := f.RemoveRange(5, 7)
+	if len(removed) != 3 {
+		t.Errorf("f.RemoveRange(5, 7): removed %d FDs, want 3", len(removed))
+	}
+	for _, ref := range removed {
+		ref.DecRef()
+	}
+	for fd := kdefs.FD(0); fd < 10; fd++ {
+		ref := f.GetFile(fd)
+		if want := fd < 5 || fd > 7; (ref != nil) != want {
+			t.Errorf("f.GetFile(%d): got %v, want valid %t", fd, ref, want)
+		}
+	}
+}
+
+// TestFDMapLowestFree checks that NewFDFrom always allocates the lowest free
+// FD, as FDs are removed from across a large map.
+func TestFDMapLowestFree(t *testing.T) {
+	file := filetest.NewTestFile(t)
+	limitSet := limits.NewLimitSet()
+	limitSet.Set(limits.NumberOfFiles, limits.Limit{maxFD, maxFD})
+
+	f := newTestFDMap()
+	for i := 0; i < maxFD; i++ {
+		if _, err := f.NewFDFrom(0, file, FDFlags{}, limitSet); err != nil {
+			t.Fatalf("f.NewFDFrom(0, r, FDFlags{}): got %v, wanted nil", err)
+		}
+	}
+
+	for _, fd := range []kdefs.FD{1500, 70, 64, 63, 1} {
+		ref, ok := f.Remove(fd)
+		if !ok {
+			t.Fatalf("f.Remove(%d) for an existing FD: failed, want success", fd)
+		}
+		ref.DecRef()
+	}
+	for _, want := range []kdefs.FD{1, 63, 64, 70, 1500} {
+		if fd, err := f.NewFDFrom(0, file, FDFlags{}, limitSet); err != nil || fd != want {
+			t.Errorf("f.NewFDFrom(0, r, FDFlags{}): got (%d, %v), want (%d, nil)", fd, err, want)
+		}
+	}
+	if size := f.Size(); size != maxFD {
+		t.Errorf("f.Size(): got %d, want %d", size, maxFD)
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"unsafe"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/kdefs"
+)
+
+// descriptorTable is a table of descriptors indexed by FD.
+//
+// Lookups are lock-free: the table is an atomically-published slice of
+// atomically-updated pointers to immutable descriptors. Mutations must be
+// serialized by the caller.
+//
+// +stateify savable
+type descriptorTable struct {
+	// slice is a *[]unsafe.Pointer, where each element is a *descriptor, or
+	// nil if the FD is unused. The slice is only ever grown, by publishing
+	// a new copy.
+	slice unsafe.Pointer `state:".(map[kdefs.FD]descriptor)"`
+
+	// used has bit i%64 of element i/64 set if FD i is in use.
+	used []uint64 `state:"nosave"`
+
+	// full has bit i%64 of element i/64 set if used[i] has all bits set.
+	// Together, used and full allow the lowest free FD to be found without
+	// scanning every FD in use.
+	full []uint64 `state:"nosave"`
+
+	// count is the number of FDs in use.
+	count int `state:"nosave"`
+}
+
+// init initializes the table to be empty.
+func (d *descriptorTable) init() {
+	var slice []unsafe.Pointer
+	atomic.StorePointer(&d.slice, unsafe.Pointer(&slice))
+}
+
+// get returns the file and flags for fd. The file is nil if fd is unused.
+//
+// get does not take a reference on the returned file, which may be
+// concurrently released if fd is changed.
+func (d *descriptorTable) get(fd kdefs.FD) (*fs.File, FDFlags) {
+	slice := *(*[]unsafe.Pointer)(atomic.LoadPointer(&d.slice))
+	if fd < 0 || int(fd) >= len(slice) {
+		return nil, FDFlags{}
+	}
+	desc := (*descriptor)(atomic.LoadPointer(&slice[fd]))
+	if desc == nil {
+		return nil, FDFlags{}
+	}
+	return desc.file, desc.flags
+}
+
+// set sets the file and flags for fd, or marks fd unused if file is nil. It
+// returns the file previously at fd, if any. set does not change reference
+// counts.
+//
+// Preconditions: Mutations of d must be serialized. fd must be non-negative.
+func (d *descriptorTable) set(fd kdefs.FD, file *fs.File, flags FDFlags) *fs.File {
+	slice := *(*[]unsafe.Pointer)(atomic.LoadPointer(&d.slice))
+	if int(fd) >= len(slice) {
+		if file == nil {
+			// Nothing to clear.
+			return nil
+		}
+		// Grow geometrically to amortize copies.
+		size := 2 * len(slice)
+		if size < 8 {
+			size = 8
+		}
+		for size <= int(fd) {
+			size *= 2
+		}
+		newSlice := make([]unsafe.Pointer, size)
+		for i := range slice {
+			newSlice[i] = atomic.LoadPointer(&slice[i])
+		}
+		slice = newSlice
+		atomic.StorePointer(&d.slice, unsafe.Pointer(&slice))
+	}
+
+	var desc *descriptor
+	if file != nil {
+		desc = &descriptor{file: file, flags: flags}
+	}
+	old := (*descriptor)(atomic.SwapPointer(&slice[fd], unsafe.Pointer(desc)))
+
+	switch {
+	case old == nil && desc != nil:
+		d.markUsed(int(fd))
+		d.count++
+	case old != nil && desc == nil:
+		d.markFree(int(fd))
+		d.count--
+	}
+	if old == nil {
+		return nil
+	}
+	return old.file
+}
+
+// markUsed marks fd as used in the bitmaps.
+func (d *descriptorTable) markUsed(fd int) {
+	i := fd / 64
+	for i >= len(d.used) {
+		d.used = append(d.used, 0)
+	}
+	for i/64 >= len(d.full) {
+		d.full = append(d.full, 0)
+	}
+	d.used[i] |= 1 << uint(fd%64)
+	if d.used[i] == ^uint64(0) {
+		d.full[i/64] |= 1 << uint(i%64)
+	}
+}
+
+// markFree marks fd as unused in the bitmaps.
+func (d *descriptorTable) markFree(fd int) {
+	i := fd / 64
+	d.used[i] &^= 1 << uint(fd%64)
+	d.full[i/64] &^= 1 << uint(i%64)
+}
+
+// firstFree returns the lowest unused FD greater than or equal to from.
+//
+// Preconditions: Mutations of d must be serialized. from must be
+// non-negative.
+func (d *descriptorTable) firstFree(from kdefs.FD) kdefs.FD {
+	i := int(from) / 64
+	if i >= len(d.used) {
+		return from
+	}
+
+	// Check the word containing from, ignoring lower FDs.
+	if w := d.used[i] | (1<<uint(from%64) - 1); w != ^uint64(0) {
+		return kdefs.FD(i*64 + bits.TrailingZeros64(^w))
+	}
+
+	// Find the next word with a free FD, skipping full words 64 at a time.
+	for i++; i < len(d.used); {
+		j := i / 64
+		s := d.full[j] | (1<<uint(i%64) - 1)
+		if s == ^uint64(0) {
+			i = (j + 1) * 64
+			continue
+		}
+		i = j*64 + bits.TrailingZeros64(^s)
+		if i >= len(d.used) {
+			break
+		}
+		return kdefs.FD(i*64 + bits.TrailingZeros64(^d.used[i]))
+	}
+	return kdefs.FD(len(d.used) * 64)
+}
+
+// forEach calls fn for every FD in use, in increasing order.
+//
+// forEach does not take references on files passed to fn, which may be
+// concurrently released if the table is changed.
+func (d *descriptorTable) forEach(fn func(fd kdefs.FD, file *fs.File, flags FDFlags)) {
+	slice := *(*[]unsafe.Pointer)(atomic.LoadPointer(&d.slice))
+	for fd := range slice {
+		if desc := (*descriptor)(atomic.LoadPointer(&slice[fd])); desc != nil {
+			fn(kdefs.FD(fd), desc.file, desc.flags)
+		}
+	}
+}
+
+// saveSlice is invoked by stateify.
+func (d *descriptorTable) saveSlice() map[kdefs.FD]descriptor {
+	m := make(map[kdefs.FD]descriptor)
+	d.forEach(func(fd kdefs.FD, file *fs.File, flags FDFlags) {
+		m[fd] = descriptor{file: file, flags: flags}
+	})
+	return m
+}
+
+// loadSlice is invoked by stateify.
+func (d *descriptorTable) loadSlice(m map[kdefs.FD]descriptor) {
+	d.init()
+	for fd, desc := range m {
+		d.set(fd, desc.file, desc.flags)
+	}
+}
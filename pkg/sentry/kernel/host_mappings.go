@@ -0,0 +1,48 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"sync/atomic"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/fsutil"
+)
+
+// hostMappingsReclaimTicks is the number of CPU clock ticks between attempts
+// to reclaim idle sentry mappings of host files. A chunk mapping is reclaimed
+// if it is unused for between one and two such periods.
+const hostMappingsReclaimTicks = uint64(30 * time.Second / linux.ClockTick)
+
+// checkHostMappings is called by kernelCPUClockTicker.Notify on every CPU
+// clock tick. Periodically, it reclaims idle sentry mappings of host files
+// asynchronously.
+func (k *Kernel) checkHostMappings(now uint64) {
+	if now%hostMappingsReclaimTicks != 0 {
+		return
+	}
+	if !atomic.CompareAndSwapUint32(&k.reclaimingHostMappings, 0, 1) {
+		// A previous reclaim is still running.
+		return
+	}
+	go func() { // S/R-SAFE: reclaimed mappings are not saved.
+		defer atomic.StoreUint32(&k.reclaimingHostMappings, 0)
+		if n := fsutil.ReclaimIdleMappings(); n != 0 {
+			log.Debugf("Reclaimed %d idle host file chunk mappings", n)
+		}
+	}()
+}
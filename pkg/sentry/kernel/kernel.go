@@ -53,6 +53,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/epoll"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/futex"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/kdefs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/sched"
 	ktime "gvisor.googlesource.com/gvisor/pkg/sentry/kernel/time"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/limits"
@@ -88,6 +89,10 @@ type Kernel struct {
 	// all Kernel fields become immutable once started becomes true.
 	started bool `state:"nosave"`
 
+	// timeSuspended is true between SuspendTime and ResumeTime. It is
+	// protected by extMu.
+	timeSuspended bool `state:"nosave"`
+
 	// All of the following fields are immutable unless otherwise specified.
 
 	// Platform is the platform that is used to execute tasks in the created
@@ -108,6 +113,8 @@ type Kernel struct {
 	useHostCores                bool
 	extraAuxv                   []arch.AuxEntry
 	vdso                        *loader.VDSO
+	disableVsyscall             bool
+	hostMLock                   bool
 	rootUTSNamespace            *UTSNamespace
 	rootIPCNamespace            *IPCNamespace
 	rootAbstractSocketNamespace *AbstractSocketNamespace
@@ -122,6 +129,10 @@ type Kernel struct {
 	// tasks, including those created by CreateProcess.
 	futexes *futex.Manager
 
+	// binfmtMisc holds the binfmt_misc entries used to execute binaries
+	// that cannot otherwise be loaded. binfmtMisc is immutable.
+	binfmtMisc *loader.BinfmtMisc
+
 	// globalInit is the thread group whose leader has ID 1 in the root PID
 	// namespace. globalInit is stored separately so that it is accessible even
 	// after all tasks in the thread group have exited, such that ID 1 is no
@@ -140,6 +151,9 @@ type Kernel struct {
 	// syslog is the kernel log.
 	syslog syslog
 
+	// sysctls holds the values of written sysctls.
+	sysctls sysctlValues
+
 	// cpuClock is incremented every linux.ClockTick. cpuClock is used to
 	// measure task CPU usage, since sampling monotonicClock twice on every
 	// syscall turns out to be unreasonably expensive. This is similar to how
@@ -155,6 +169,18 @@ type Kernel struct {
 	// cpuClockTicker increments cpuClock.
 	cpuClockTicker *ktime.Timer `state:"nosave"`
 
+	// reclaimingLazyFree is 1 if memory freed by madvise(MADV_FREE) is being
+	// reclaimed due to memory pressure, and 0 otherwise.
+	//
+	// reclaimingLazyFree is accessed using atomic memory operations.
+	reclaimingLazyFree uint32 `state:"nosave"`
+
+	// reclaimingHostMappings is 1 if idle sentry mappings of host files are
+	// being reclaimed, and 0 otherwise.
+	//
+	// reclaimingHostMappings is accessed using atomic memory operations.
+	reclaimingHostMappings uint32 `state:"nosave"`
+
 	// fdMapUids is an ever-increasing counter for generating FDMap uids.
 	//
 	// fdMapUids is mutable, and is accessed using atomic memory operations.
@@ -188,6 +214,14 @@ type Kernel struct {
 
 	// deviceRegistry is used to save/restore device.SimpleDevices.
 	deviceRegistry struct{} `state:".(*device.Registry)"`
+
+	// unimplementedMu protects unimplemented.
+	unimplementedMu sync.Mutex `state:"nosave"`
+
+	// unimplemented counts the unimplemented syscalls invoked by the
+	// application, by container ID. Like metrics, the counts are not
+	// saved and restart from zero on restore.
+	unimplemented map[string]map[UnimplementedSyscall]uint64 `state:"nosave"`
 }
 
 // InitKernelArgs holds arguments to Init.
@@ -223,6 +257,22 @@ type InitKernelArgs struct {
 	// Vdso holds the VDSO and its parameter page.
 	Vdso *loader.VDSO
 
+	// If DisableVsyscall is true, calls to the legacy vsyscall page are not
+	// emulated and fault instead, as on Linux booted with vsyscall=none.
+	DisableVsyscall bool
+
+	// If HostMLock is true, application memory locked by mlock(2),
+	// mlockall(2), or MAP_LOCKED is also locked into host memory.
+	HostMLock bool
+
+	// MmapRandBits is the initial value of vm.mmap_rnd_bits. If MmapRandBits
+	// is 0, Linux's default is used.
+	MmapRandBits uint
+
+	// If LegacyMmapLayout is true, vm.legacy_va_layout is initially set,
+	// causing new address spaces to allocate mappings bottom-up.
+	LegacyMmapLayout bool
+
 	// RootUTSNamespace is the root UTS namespace.
 	RootUTSNamespace *UTSNamespace
 
@@ -274,9 +324,22 @@ func (k *Kernel) Init(args InitKernelArgs) error {
 	}
 	k.extraAuxv = args.ExtraAuxv
 	k.vdso = args.Vdso
+	k.disableVsyscall = args.DisableVsyscall
+	k.hostMLock = args.HostMLock
+	if args.MmapRandBits != 0 {
+		if err := k.SetSysctl("vm.mmap_rnd_bits", int64(args.MmapRandBits)); err != nil {
+			return fmt.Errorf("invalid MmapRandBits %d: %v", args.MmapRandBits, err)
+		}
+	}
+	if args.LegacyMmapLayout {
+		if err := k.SetSysctl("vm.legacy_va_layout", 1); err != nil {
+			return fmt.Errorf("failed to set vm.legacy_va_layout: %v", err)
+		}
+	}
 	k.realtimeClock = &timekeeperClock{tk: args.Timekeeper, c: sentrytime.Realtime}
 	k.monotonicClock = &timekeeperClock{tk: args.Timekeeper, c: sentrytime.Monotonic}
 	k.futexes = futex.NewManager()
+	k.binfmtMisc = loader.NewBinfmtMisc()
 	k.netlinkPorts = port.New()
 	k.socketTable = make(map[int]map[*refs.WeakRef]struct{})
 
@@ -294,9 +357,11 @@ func (k *Kernel) SaveTo(w io.Writer) error {
 	k.extMu.Lock()
 	defer k.extMu.Unlock()
 
-	// Stop time.
-	k.pauseTimeLocked()
-	defer k.resumeTimeLocked()
+	// Stop time, unless SuspendTime already did.
+	if !k.timeSuspended {
+		k.pauseTimeLocked()
+		defer k.resumeTimeLocked()
+	}
 
 	// Flush write operations on open files so data reaches backing storage.
 	if err := k.tasks.flushWritesToFiles(ctx); err != nil {
@@ -357,27 +422,34 @@ func (ts *TaskSet) flushWritesToFiles(ctx context.Context) error {
 	for t := range ts.Root.tids {
 		// We can skip locking Task.mu here since the kernel is paused.
 		if fdmap := t.fds; fdmap != nil {
-			for _, desc := range fdmap.files {
-				if flags := desc.file.Flags(); !flags.Write {
-					continue
+			var lastErr error
+			fdmap.forEach(func(_ kdefs.FD, file *fs.File, _ FDFlags) {
+				if lastErr != nil {
+					return
+				}
+				if flags := file.Flags(); !flags.Write {
+					return
 				}
-				if sattr := desc.file.Dirent.Inode.StableAttr; !fs.IsFile(sattr) && !fs.IsDir(sattr) {
-					continue
+				if sattr := file.Dirent.Inode.StableAttr; !fs.IsFile(sattr) && !fs.IsDir(sattr) {
+					return
 				}
 				// Here we need all metadata synced.
-				syncErr := desc.file.Fsync(ctx, 0, fs.FileMaxOffset, fs.SyncAll)
+				syncErr := file.Fsync(ctx, 0, fs.FileMaxOffset, fs.SyncAll)
 				if err := fs.SaveFileFsyncError(syncErr); err != nil {
-					name, _ := desc.file.Dirent.FullName(nil /* root */)
+					name, _ := file.Dirent.FullName(nil /* root */)
 					// Wrap this error in ErrSaveRejection
 					// so that it will trigger a save
 					// error, rather than a panic. This
 					// also allows us to distinguish Fsync
 					// errors from state file errors in
 					// state.Save.
-					return fs.ErrSaveRejection{
+					lastErr = fs.ErrSaveRejection{
 						Err: fmt.Errorf("%q was not sufficiently synced: %v", name, err),
 					}
 				}
+			})
+			if lastErr != nil {
+				return lastErr
 			}
 		}
 	}
@@ -415,13 +487,11 @@ func (ts *TaskSet) unregisterEpollWaiters() {
 	for t := range ts.Root.tids {
 		// We can skip locking Task.mu here since the kernel is paused.
 		if fdmap := t.fds; fdmap != nil {
-			for _, desc := range fdmap.files {
-				if desc.file != nil {
-					if e, ok := desc.file.FileOperations.(*epoll.EventPoll); ok {
-						e.UnregisterEpollWaiters()
-					}
+			fdmap.forEach(func(_ kdefs.FD, file *fs.File, _ FDFlags) {
+				if e, ok := file.FileOperations.(*epoll.EventPoll); ok {
+					e.UnregisterEpollWaiters()
 				}
-			}
+			})
 		}
 	}
 }
@@ -471,6 +541,13 @@ func (k *Kernel) LoadFrom(r io.Reader, net inet.Stack) error {
 		return fmt.Errorf("UseHostCores enabled: can't increase ApplicationCores from %d to %d after restore", k.applicationCores, initAppCores)
 	}
 
+	// Applications may have selected code paths based on the CPU features
+	// exposed before the checkpoint, so they must all be available on
+	// this host.
+	if diff := k.featureSet.Subtract(cpuid.HostFeatureSet()); diff != nil {
+		return fmt.Errorf("CPU features %v exposed before checkpoint are not supported by the host", diff)
+	}
+
 	return nil
 }
 
@@ -675,7 +752,18 @@ func (k *Kernel) CreateProcess(args CreateProcessArgs) (*ThreadGroup, ThreadID,
 
 	// Create a fresh task context.
 	remainingTraversals = uint(args.MaxSymlinkTraversals)
-	tc, se := k.LoadTaskImage(ctx, k.mounts, root, wd, &remainingTraversals, args.Filename, args.Argv, args.Envv, k.featureSet)
+	loadArgs := loader.LoadArgs{
+		Mounts:              k.mounts,
+		Root:                root,
+		WorkingDirectory:    wd,
+		RemainingTraversals: &remainingTraversals,
+		ResolveFinal:        true,
+		Filename:            args.Filename,
+		Argv:                args.Argv,
+		Envv:                args.Envv,
+		Features:            k.featureSet,
+	}
+	tc, se := k.LoadTaskImage(ctx, loadArgs, linux.PER_LINUX)
 	if se != nil {
 		return nil, 0, errors.New(se.String())
 	}
@@ -762,7 +850,7 @@ func (k *Kernel) pauseTimeLocked() {
 	}
 
 	// By precondition, nothing else can be interacting with PIDNamespace.tids
-	// or FDMap.files, so we can iterate them without synchronization. (We
+	// or FDMaps, so we can iterate them without synchronization. (We
 	// can't hold the TaskSet mutex when pausing thread group timers because
 	// thread group timers call ThreadGroup.SendSignal, which takes the TaskSet
 	// mutex, while holding the Timer mutex.)
@@ -776,11 +864,11 @@ func (k *Kernel) pauseTimeLocked() {
 		// This means we'll iterate FDMaps shared by multiple tasks repeatedly,
 		// but ktime.Timer.Pause is idempotent so this is harmless.
 		if fdm := t.fds; fdm != nil {
-			for _, desc := range fdm.files {
-				if tfd, ok := desc.file.FileOperations.(*timerfd.TimerOperations); ok {
+			fdm.forEach(func(_ kdefs.FD, file *fs.File, _ FDFlags) {
+				if tfd, ok := file.FileOperations.(*timerfd.TimerOperations); ok {
 					tfd.PauseTimer()
 				}
-			}
+			})
 		}
 	}
 	k.timekeeper.PauseUpdates()
@@ -806,11 +894,11 @@ func (k *Kernel) resumeTimeLocked() {
 			}
 		}
 		if fdm := t.fds; fdm != nil {
-			for _, desc := range fdm.files {
-				if tfd, ok := desc.file.FileOperations.(*timerfd.TimerOperations); ok {
+			fdm.forEach(func(_ kdefs.FD, file *fs.File, _ FDFlags) {
+				if tfd, ok := file.FileOperations.(*timerfd.TimerOperations); ok {
 					tfd.ResumeTimer()
 				}
-			}
+			})
 		}
 	}
 }
@@ -846,6 +934,36 @@ func (k *Kernel) Unpause() {
 	k.tasks.EndExternalStop()
 }
 
+// SuspendTime stops time in k as Linux system suspend does: timers are paused
+// and the monotonic clock is frozen, while the realtime clock keeps advancing.
+// It has no effect if time is already suspended.
+//
+// Preconditions: k must be paused, and must stay paused until ResumeTime.
+func (k *Kernel) SuspendTime() {
+	k.extMu.Lock()
+	defer k.extMu.Unlock()
+	if k.timeSuspended {
+		return
+	}
+	k.timeSuspended = true
+	k.pauseTimeLocked()
+	k.timekeeper.SuspendMonotonic()
+}
+
+// ResumeTime ends the effect of a previous call to SuspendTime. The monotonic
+// clock resumes from the value it was frozen at, and timers based on the
+// realtime clock that expired in the meantime fire.
+func (k *Kernel) ResumeTime() {
+	k.extMu.Lock()
+	defer k.extMu.Unlock()
+	if !k.timeSuspended {
+		return
+	}
+	k.timeSuspended = false
+	k.timekeeper.ResumeMonotonic()
+	k.resumeTimeLocked()
+}
+
 // SendExternalSignal injects a signal into the kernel.
 //
 // context is used only for debugging to describe how the signal was received.
@@ -909,6 +1027,11 @@ func (k *Kernel) RootIPCNamespace() *IPCNamespace {
 	return k.rootIPCNamespace
 }
 
+// BinfmtMisc returns the binfmt_misc entries used by the loader.
+func (k *Kernel) BinfmtMisc() *loader.BinfmtMisc {
+	return k.binfmtMisc
+}
+
 // RootAbstractSocketNamespace returns the root AbstractSocketNamespace.
 func (k *Kernel) RootAbstractSocketNamespace() *AbstractSocketNamespace {
 	return k.rootAbstractSocketNamespace
@@ -1050,13 +1173,20 @@ func (k *Kernel) SupervisorContext() context.Context {
 }
 
 // EmitUnimplementedEvent emits an UnimplementedSyscall event via the event
-// channel.
+// channel, counts the syscall for the task's container (see
+// UnimplementedSyscalls), and notes the syscall in the kernel log so that it
+// is visible to the application via dmesg.
 func (k *Kernel) EmitUnimplementedEvent(ctx context.Context) {
 	t := TaskFromContext(ctx)
 	eventchannel.Emit(&uspb.UnimplementedSyscall{
 		Tid:       int32(t.ThreadID()),
 		Registers: t.Arch().StateData().Proto(),
 	})
+
+	sysno := t.Arch().SyscallNo()
+	k.countUnimplemented(t.ContainerID(), newUnimplementedSyscall(sysno, t.Arch().SyscallArgs()))
+	k.syslog.AppendOnce(fmt.Sprintf("unimplemented-syscall-%d", sysno), k.MonotonicClock().Now().Nanoseconds(), SyslogLevelWarning,
+		fmt.Sprintf("gVisor: %s[%d]: unsupported syscall %d", t.Name(), t.ThreadID(), sysno))
 }
 
 // socketEntry represents a socket recorded in Kernel.socketTable. It implements
@@ -1109,6 +1239,18 @@ func (k *Kernel) ListSockets(family int) []*refs.WeakRef {
 	return socks
 }
 
+// SocketCount returns the number of sockets in the system-wide socket table,
+// across all families.
+func (k *Kernel) SocketCount() int {
+	k.extMu.Lock()
+	n := 0
+	for _, table := range k.socketTable {
+		n += len(table)
+	}
+	k.extMu.Unlock()
+	return n
+}
+
 type supervisorContext struct {
 	context.NoopSleeper
 	log.Logger
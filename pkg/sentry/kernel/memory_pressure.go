@@ -0,0 +1,101 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"sync/atomic"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/mm"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
+)
+
+const (
+	// memoryPressureCheckTicks is the number of CPU clock ticks between
+	// checks for memory pressure.
+	memoryPressureCheckTicks = uint64(time.Second / linux.ClockTick)
+
+	// memoryPressureFreeDivisor determines the memory pressure threshold: the
+	// kernel is under memory pressure when less than
+	// 1/memoryPressureFreeDivisor of total memory is free.
+	memoryPressureFreeDivisor = 16
+)
+
+// underMemoryPressure returns true if application memory usage is close to
+// the sandbox's total memory.
+func (k *Kernel) underMemoryPressure() bool {
+	used, err := k.mf.TotalUsage()
+	if err != nil {
+		log.Warningf("Failed to fetch memory usage: %v", err)
+		return false
+	}
+	total := usage.MinimumTotalMemoryBytes
+	return used > total-total/memoryPressureFreeDivisor
+}
+
+// checkMemoryPressure is called by kernelCPUClockTicker.Notify on every CPU
+// clock tick. If the kernel is under memory pressure, it reclaims memory
+// freed by madvise(MADV_FREE) asynchronously.
+func (k *Kernel) checkMemoryPressure(now uint64) {
+	if now%memoryPressureCheckTicks != 0 || !k.underMemoryPressure() {
+		return
+	}
+	if !atomic.CompareAndSwapUint32(&k.reclaimingLazyFree, 0, 1) {
+		// A previous reclaim is still running.
+		return
+	}
+	go func() { // S/R-SAFE: ReclaimLazyFree locks k.extMu.
+		defer atomic.StoreUint32(&k.reclaimingLazyFree, 0)
+		if n := k.ReclaimLazyFree(); n != 0 {
+			log.Debugf("Reclaimed %d bytes of lazily-freed memory under memory pressure", n)
+		}
+	}()
+}
+
+// ReclaimLazyFree discards memory freed by madvise(MADV_FREE), and not
+// written since, in all MemoryManagers in k. It returns the number of bytes
+// reclaimed.
+func (k *Kernel) ReclaimLazyFree() uint64 {
+	k.extMu.Lock()
+	defer k.extMu.Unlock()
+
+	mms := make(map[*mm.MemoryManager]struct{})
+	k.tasks.mu.RLock()
+	for t := range k.tasks.Root.tids {
+		t.mu.Lock()
+		m := t.MemoryManager()
+		t.mu.Unlock()
+		if m == nil {
+			continue
+		}
+		if _, ok := mms[m]; ok {
+			continue
+		}
+		if m.IncUsers() {
+			mms[m] = struct{}{}
+		}
+	}
+	k.tasks.mu.RUnlock()
+
+	ctx := k.SupervisorContext()
+	var reclaimed uint64
+	for m := range mms {
+		reclaimed += m.ReclaimLazyFree()
+		m.DecUsers(ctx)
+	}
+	return reclaimed
+}
@@ -14,35 +14,102 @@
 
 package pipe
 
-// Buffer encapsulates a queueable byte buffer that can
-// easily be truncated.  It is designed only for use with pipes.
+import (
+	"gvisor.googlesource.com/gvisor/pkg/sentry/safemem"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+)
+
+// buffer is a ring buffer that holds data written to a pipe until it is read.
+// It grows as needed, so pipes that never hold much data don't use much
+// memory.
 //
 // +stateify savable
-type Buffer struct {
-	bufferEntry
+type buffer struct {
+	// data holds size bytes starting at data[head], wrapping around to
+	// data[0].
 	data []byte
+	head int
+	size int
 }
 
-// newBuffer initializes a Buffer.
-func newBuffer(buf []byte) *Buffer {
-	return &Buffer{data: buf}
+// blocks returns a BlockSeq for the n bytes starting at offset off from the
+// beginning of the buffered data, which may be past the end of the buffered
+// data.
+//
+// Preconditions: off+n <= len(b.data).
+func (b *buffer) blocks(off, n int) safemem.BlockSeq {
+	if n == 0 {
+		return safemem.BlockSeq{}
+	}
+	start := (b.head + off) % len(b.data)
+	if start+n <= len(b.data) {
+		return safemem.BlockSeqOf(safemem.BlockFromSafeSlice(b.data[start : start+n]))
+	}
+	return safemem.BlockSeqFromSlice([]safemem.Block{
+		safemem.BlockFromSafeSlice(b.data[start:]),
+		safemem.BlockFromSafeSlice(b.data[:start+n-len(b.data)]),
+	})
 }
 
-// bytes returns the bytes contained in the buffer.
-func (b *Buffer) bytes() []byte {
-	return b.data
+// readBlocks returns a BlockSeq for the first n buffered bytes.
+//
+// Preconditions: n <= b.size.
+func (b *buffer) readBlocks(n int) safemem.BlockSeq {
+	return b.blocks(0, n)
 }
 
-// size returns the number of bytes contained in the buffer.
-func (b *Buffer) size() int {
-	return len(b.data)
+// writeBlocks returns a BlockSeq for n bytes of free space following the
+// buffered bytes.
+//
+// Preconditions: b.reserve(n, max) must have been called since data was last
+// appended.
+func (b *buffer) writeBlocks(n int) safemem.BlockSeq {
+	return b.blocks(b.size, n)
 }
 
-// truncate removes the first n bytes from the buffer.
-func (b *Buffer) truncate(n int) int {
-	if n > len(b.data) {
-		panic("Trying to truncate past end of array.")
+// consume removes the first n buffered bytes.
+//
+// Preconditions: n <= b.size.
+func (b *buffer) consume(n int) {
+	b.size -= n
+	if b.size == 0 {
+		// Start over at the beginning of data, so that the next write is
+		// more likely to be contiguous.
+		b.head = 0
+		return
+	}
+	b.head = (b.head + n) % len(b.data)
+}
+
+// commit appends n bytes, which must have been copied to the BlockSeq returned
+// by b.writeBlocks, to the buffered bytes.
+func (b *buffer) commit(n int) {
+	b.size += n
+}
+
+// reserve ensures that there is free space for at least n bytes following the
+// buffered bytes, growing data up to max bytes if necessary.
+//
+// Preconditions: b.size+n <= max.
+func (b *buffer) reserve(n, max int) {
+	want := b.size + n
+	if want <= len(b.data) {
+		return
+	}
+	size := len(b.data)
+	if size < usermem.PageSize {
+		size = usermem.PageSize
+	}
+	for size < want {
+		size *= 2
+	}
+	if size > max {
+		size = max
+	}
+	data := make([]byte, size)
+	if b.size != 0 {
+		safemem.CopySeq(safemem.BlockSeqOf(safemem.BlockFromSafeSlice(data[:b.size])), b.readBlocks(b.size))
 	}
-	b.data = b.data[n:]
-	return len(b.data)
+	b.data = data
+	b.head = 0
 }
@@ -27,6 +27,7 @@ import (
 
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/safemem"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
 	"gvisor.googlesource.com/gvisor/pkg/waiter"
@@ -50,15 +51,12 @@ type Pipe struct {
 	Dirent *fs.Dirent
 
 	// The buffered byte queue.
-	data bufferList
+	buf buffer
 
 	// Max size of the pipe in bytes.  When this max has been reached,
 	// writers will get EWOULDBLOCK.
 	max int
 
-	// Current size of the pipe in bytes.
-	size int
-
 	// Max number of bytes the pipe can guarantee to read or write
 	// atomically.
 	atomicIOBytes int
@@ -76,6 +74,13 @@ type Pipe struct {
 	// Protected by mu.
 	hadWriter bool
 
+	// This flag indicates if the read end of this pipe has ever been polled.
+	// Writes to a pipe that isn't empty only notify readers if it has, as
+	// edge-triggered epoll waiters may expect to be notified of every write.
+	//
+	// Protected by mu.
+	polled bool
+
 	// Lock protecting all pipe internal state.
 	mu sync.Mutex `state:"nosave"`
 }
@@ -158,30 +163,41 @@ func (p *Pipe) read(ctx context.Context, dst usermem.IOSequence) (int64, error)
 	}
 
 	p.mu.Lock()
-	defer p.mu.Unlock()
+	n, err := p.readLocked(ctx, dst)
+	p.mu.Unlock()
+
+	// Writers may block even if the pipe has free space, since a write that
+	// doesn't fit only writes atomicIOBytes at a time, so they must be
+	// notified whenever space is freed.
+	if n > 0 {
+		p.Notify(waiter.EventOut)
+	}
+	return n, err
+}
+
+// Preconditions: p.mu must be locked.
+func (p *Pipe) readLocked(ctx context.Context, dst usermem.IOSequence) (int64, error) {
 	// If there is nothing to read at the moment but there is a writer, tell the
 	// caller to block.
-	if p.size == 0 {
+	if p.buf.size == 0 {
 		if !p.HasWriters() {
 			// There are no writers, return EOF.
 			return 0, nil
 		}
 		return 0, syserror.ErrWouldBlock
 	}
-	var n int64
-	for buffer := p.data.Front(); buffer != nil; buffer = p.data.Front() {
-		n0, err := dst.CopyOut(ctx, buffer.bytes())
-		n += int64(n0)
-		p.size -= n0
-		if buffer.truncate(n0) == 0 {
-			p.data.Remove(buffer)
-		}
-		dst = dst.DropFirst(n0)
-		if dst.NumBytes() == 0 || err != nil {
-			return n, err
-		}
+
+	// Copy data directly from the pipe's buffer into dst, which may
+	// consist of many iovecs.
+	toRead := dst.NumBytes()
+	if toRead > int64(p.buf.size) {
+		toRead = int64(p.buf.size)
 	}
-	return n, nil
+	n, err := dst.TakeFirst64(toRead).CopyOutFrom(ctx, safemem.ReaderFunc(func(dsts safemem.BlockSeq) (uint64, error) {
+		return safemem.CopySeq(dsts, p.buf.readBlocks(int(toRead)))
+	}))
+	p.buf.consume(int(n))
+	return n, err
 }
 
 // write writes data from sv into the pipe and returns the number of bytes
@@ -189,8 +205,21 @@ func (p *Pipe) read(ctx context.Context, dst usermem.IOSequence) (int64, error)
 // atomicIOBytes free capacity), write returns ErrWouldBlock.
 func (p *Pipe) write(ctx context.Context, src usermem.IOSequence) (int64, error) {
 	p.mu.Lock()
-	defer p.mu.Unlock()
+	// Readers only block if the pipe is empty, so they only need to be
+	// notified if that was the case before writing, unless they may be
+	// waiting via epoll.
+	wake := p.buf.size == 0 || p.polled
+	n, err := p.writeLocked(ctx, src)
+	p.mu.Unlock()
+
+	if n > 0 && wake {
+		p.Notify(waiter.EventIn)
+	}
+	return n, err
+}
 
+// Preconditions: p.mu must be locked.
+func (p *Pipe) writeLocked(ctx context.Context, src usermem.IOSequence) (int64, error) {
 	if !p.HasWriters() {
 		return 0, syscall.EBADF
 	}
@@ -206,26 +235,26 @@ func (p *Pipe) write(ctx context.Context, src usermem.IOSequence) (int64, error)
 	// this by writing at most atomicIOBytes at a time if we can't service the
 	// write in its entirety.
 	canWrite := src.NumBytes()
-	if canWrite > int64(p.max-p.size) {
-		if p.max-p.size >= p.atomicIOBytes {
+	if canWrite > int64(p.max-p.buf.size) {
+		if p.max-p.buf.size >= p.atomicIOBytes {
 			canWrite = int64(p.atomicIOBytes)
 		} else {
 			return 0, syserror.ErrWouldBlock
 		}
 	}
 
-	// Copy data from user memory into a pipe-owned buffer.
-	buf := make([]byte, canWrite)
-	n, err := src.CopyIn(ctx, buf)
-	if n > 0 {
-		p.data.PushBack(newBuffer(buf[:n]))
-		p.size += n
-	}
-	if int64(n) < src.NumBytes() && err == nil {
+	// Copy data directly from src, which may consist of many iovecs, into
+	// the pipe's buffer.
+	p.buf.reserve(int(canWrite), p.max)
+	n, err := src.TakeFirst64(canWrite).CopyInTo(ctx, safemem.WriterFunc(func(srcs safemem.BlockSeq) (uint64, error) {
+		return safemem.CopySeq(p.buf.writeBlocks(int(canWrite)), srcs)
+	}))
+	p.buf.commit(int(n))
+	if n < src.NumBytes() && err == nil {
 		// Partial write due to full pipe.
 		err = syserror.ErrWouldBlock
 	}
-	return int64(n), err
+	return n, err
 }
 
 // rOpen signals a new reader of the pipe.
@@ -269,7 +298,7 @@ func (p *Pipe) HasWriters() bool {
 
 func (p *Pipe) rReadinessLocked() waiter.EventMask {
 	ready := waiter.EventMask(0)
-	if p.HasReaders() && p.data.Front() != nil {
+	if p.HasReaders() && p.buf.size > 0 {
 		ready |= waiter.EventIn
 	}
 	if !p.HasWriters() && p.hadWriter {
@@ -287,12 +316,13 @@ func (p *Pipe) rReadinessLocked() waiter.EventMask {
 func (p *Pipe) rReadiness() waiter.EventMask {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	p.polled = true
 	return p.rReadinessLocked()
 }
 
 func (p *Pipe) wReadinessLocked() waiter.EventMask {
 	ready := waiter.EventMask(0)
-	if p.HasWriters() && p.size < p.max {
+	if p.HasWriters() && p.buf.size < p.max {
 		ready |= waiter.EventOut
 	}
 	if !p.HasReaders() {
@@ -314,11 +344,12 @@ func (p *Pipe) wReadiness() waiter.EventMask {
 func (p *Pipe) rwReadiness() waiter.EventMask {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	p.polled = true
 	return p.rReadinessLocked() | p.wReadinessLocked()
 }
 
 func (p *Pipe) queuedSize() int {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	return p.size
+	return p.buf.size
 }
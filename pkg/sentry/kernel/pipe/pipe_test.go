@@ -17,6 +17,7 @@ package pipe
 import (
 	"bytes"
 	"testing"
+	"time"
 
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context/contexttest"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
@@ -136,3 +137,111 @@ func TestPipeWriteUntilEnd(t *testing.T) {
 		}
 	}
 }
+
+func TestPipeWriteLargerThanCapacity(t *testing.T) {
+	const (
+		sizeBytes     = 65536
+		atomicIOBytes = 4096
+	)
+
+	ctx := contexttest.Context(t)
+	r, w := NewConnectedPipe(ctx, sizeBytes, atomicIOBytes)
+	defer r.DecRef()
+	defer w.DecRef()
+
+	msg := make([]byte, 2*sizeBytes)
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+
+	rDone := make(chan []byte)
+	go func() {
+		// Read from r until all of msg is read.
+		ctx := contexttest.Context(t)
+		var got []byte
+		buf := make([]byte, atomicIOBytes)
+		e, ch := waiter.NewChannelEntry(nil)
+		r.EventRegister(&e, waiter.EventIn)
+		defer r.EventUnregister(&e)
+		for len(got) < len(msg) {
+			n, err := r.Readv(ctx, usermem.BytesIOSequence(buf))
+			got = append(got, buf[:n]...)
+			if err == syserror.ErrWouldBlock {
+				<-ch
+				continue
+			}
+			if err != nil {
+				t.Errorf("Readv: got unexpected error %v", err)
+				break
+			}
+		}
+		rDone <- got
+	}()
+
+	// Write msg in full as a blocking writev does, waiting for the reader
+	// to make room whenever the write would block.
+	src := usermem.BytesIOSequence(msg)
+	e, ch := waiter.NewChannelEntry(nil)
+	w.EventRegister(&e, waiter.EventOut)
+	defer w.EventUnregister(&e)
+	for src.NumBytes() != 0 {
+		n, err := w.Writev(ctx, src)
+		src = src.DropFirst64(n)
+		if err == syserror.ErrWouldBlock {
+			select {
+			case <-ch:
+			case <-time.After(10 * time.Second):
+				t.Fatalf("Writer blocked with %d bytes left to write was never woken", src.NumBytes())
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Writev: got (%d, %v)", n, err)
+		}
+	}
+
+	if got := <-rDone; !bytes.Equal(got, msg) {
+		t.Errorf("Read %d bytes that differ from the %d bytes written", len(got), len(msg))
+	}
+}
+
+func TestPipeWrapAround(t *testing.T) {
+	ctx := contexttest.Context(t)
+	r, w := NewConnectedPipe(ctx, 65536, 4096)
+	defer r.DecRef()
+	defer w.DecRef()
+
+	// Interleave writes and reads of different sizes, so that data wraps
+	// around the end of the pipe's buffer and the buffer grows while it
+	// contains wrapped data.
+	var want, got []byte
+	for i := 0; i < 64; i++ {
+		msg := bytes.Repeat([]byte{byte(i)}, 1000+i*100)
+		n, err := w.Writev(ctx, usermem.BytesIOSequence(msg))
+		if n != int64(len(msg)) || err != nil {
+			t.Fatalf("Writev: got (%d, %v), wanted (%d, nil)", n, err, len(msg))
+		}
+		want = append(want, msg...)
+
+		buf := make([]byte, 900+i*90)
+		n, err = r.Readv(ctx, usermem.BytesIOSequence(buf))
+		if err != nil {
+			t.Fatalf("Readv: got (%d, %v), wanted (%d, nil)", n, err, len(buf))
+		}
+		got = append(got, buf[:n]...)
+	}
+	for {
+		buf := make([]byte, 4096)
+		n, err := r.Readv(ctx, usermem.BytesIOSequence(buf))
+		if err == syserror.ErrWouldBlock {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Readv: got (%d, %v)", n, err)
+		}
+		got = append(got, buf[:n]...)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Read %d bytes that differ from the %d bytes written", len(got), len(want))
+	}
+}
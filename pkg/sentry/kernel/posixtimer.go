@@ -298,6 +298,23 @@ func (t *Task) IntervalTimerGetoverrun(id linux.TimerID) (int32, error) {
 	return saturateI32FromU64(it.overrunLast), nil
 }
 
+// disarmCPUClockIntervalTimers disarms all POSIX interval timers in t's
+// thread group that are driven by t's CPU clocks, since those clocks stop
+// advancing once t exits. Timers that merely direct signals to t
+// (SIGEV_THREAD_ID) are unaffected. This is consistent with Linux's
+// kernel/time/posix-cpu-timers.c:posix_cpu_timers_exit().
+//
+// Preconditions: t must be exiting.
+func (t *Task) disarmCPUClockIntervalTimers() {
+	t.tg.timerMu.Lock()
+	defer t.tg.timerMu.Unlock()
+	for _, it := range t.tg.timers {
+		if tc, ok := it.timer.Clock().(*taskClock); ok && tc.t == t {
+			it.timer.Swap(ktime.Setting{})
+		}
+	}
+}
+
 func saturateI32FromU64(x uint64) int32 {
 	if x > math.MaxInt32 {
 		return math.MaxInt32
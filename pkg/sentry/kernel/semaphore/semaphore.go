@@ -17,6 +17,7 @@ package semaphore
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
@@ -29,19 +30,46 @@ import (
 )
 
 const (
-	valueMax = 32767 // SEMVMX
+	valueMax = linux.SEMVMX
 
 	// semaphoresMax is "maximum number of semaphores per semaphore ID" (SEMMSL).
-	semaphoresMax = 32000
+	semaphoresMax = linux.SEMMSL
 
 	// setMax is "system-wide limit on the number of semaphore sets" (SEMMNI).
-	setsMax = 32000
+	setsMax = linux.SEMMNI
 
 	// semaphoresTotalMax is "system-wide limit on the number of semaphores"
 	// (SEMMNS = SEMMNI*SEMMSL).
-	semaphoresTotalMax = 1024000000
+	semaphoresTotalMax = linux.SEMMNS
+
+	// opsMax is "maximum number of operations that may be specified in a
+	// semop(2) call" (SEMOPM).
+	opsMax = linux.SEMOPM
+
+	// ipcMNI is the maximum number of IPC identifiers of each type, and thus
+	// the largest value that SEMMNI may be set to. See IPCMNI in Linux.
+	ipcMNI = 32768
 )
 
+// Limits are the tunable limits on the semaphores in a registry, which are
+// exposed through /proc/sys/kernel/sem.
+//
+// +stateify savable
+type Limits struct {
+	// SemaphoresMax is the maximum number of semaphores per set (SEMMSL).
+	SemaphoresMax int32
+
+	// SemaphoresTotalMax is the limit on the number of semaphores in all sets
+	// in the registry (SEMMNS).
+	SemaphoresTotalMax int32
+
+	// OpsMax is the maximum number of operations per semop(2) call (SEMOPM).
+	OpsMax int32
+
+	// SetsMax is the limit on the number of sets in the registry (SEMMNI).
+	SetsMax int32
+}
+
 // Registry maintains a set of semaphores that can be found by key or ID.
 //
 // +stateify savable
@@ -52,6 +80,7 @@ type Registry struct {
 	mu         sync.Mutex `state:"nosave"`
 	semaphores map[int32]*Set
 	lastIDUsed int32
+	limits     Limits
 }
 
 // Set represents a set of semaphores that can be operated atomically.
@@ -81,6 +110,10 @@ type Set struct {
 	// it's been set, however each 'sem' object in the slice requires 'mu' lock.
 	sems []sem
 
+	// undo maps the undo lists of processes that operated on the set with
+	// SEM_UNDO to their adjustments for each semaphore in the set.
+	undo map[*UndoList][]int16
+
 	// dead is set to true when the set is removed and can't be reached anymore.
 	// All waiters must wake up and fail when set is dead.
 	dead bool
@@ -112,7 +145,71 @@ func NewRegistry(userNS *auth.UserNamespace) *Registry {
 	return &Registry{
 		userNS:     userNS,
 		semaphores: make(map[int32]*Set),
+		limits: Limits{
+			SemaphoresMax:      semaphoresMax,
+			SemaphoresTotalMax: semaphoresTotalMax,
+			OpsMax:             opsMax,
+			SetsMax:            setsMax,
+		},
+	}
+}
+
+// Limits returns the registry's limits.
+func (r *Registry) Limits() Limits {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.limits
+}
+
+// SetLimits changes the registry's limits. Existing sets are not affected.
+func (r *Registry) SetLimits(l Limits) error {
+	if l.SemaphoresMax < 0 || l.SemaphoresTotalMax < 0 || l.OpsMax < 0 || l.SetsMax < 0 || l.SetsMax > ipcMNI {
+		return syserror.EINVAL
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limits = l
+	return nil
+}
+
+// IPCInfo reports the registry's limits. If used is true, the number of sets
+// and semaphores in use are reported as well. See semctl(IPC_INFO) and
+// semctl(SEM_INFO).
+func (r *Registry) IPCInfo(used bool) *linux.SemInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info := &linux.SemInfo{
+		SemMap: linux.SEMMAP,
+		SemMni: r.limits.SetsMax,
+		SemMns: r.limits.SemaphoresTotalMax,
+		SemMnu: linux.SEMMNU,
+		SemMsl: r.limits.SemaphoresMax,
+		SemOpm: r.limits.OpsMax,
+		SemUme: linux.SEMUME,
+		SemUsz: linux.SEMUSZ,
+		SemVmx: linux.SEMVMX,
+		SemAem: linux.SEMAEM,
+	}
+	if used {
+		info.SemUsz = int32(len(r.semaphores))
+		info.SemAem = int32(r.totalSems())
+	}
+	return info
+}
+
+// HighestID returns the highest ID of any set in the registry, or 0 if there
+// are none. Since set IDs are used as indices into the registry, this is the
+// value returned by semctl(IPC_INFO) and semctl(SEM_INFO).
+func (r *Registry) HighestID() int32 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var highest int32
+	for id := range r.semaphores {
+		if id > highest {
+			highest = id
+		}
 	}
+	return highest
 }
 
 // FindOrCreate searches for a semaphore set that matches 'key'. If not found,
@@ -121,13 +218,17 @@ func NewRegistry(userNS *auth.UserNamespace) *Registry {
 // be found. If exclusive is true, it fails if a set with the same key already
 // exists.
 func (r *Registry) FindOrCreate(ctx context.Context, key, nsems int32, mode linux.FileMode, private, create, exclusive bool) (*Set, error) {
-	if nsems < 0 || nsems > semaphoresMax {
+	if nsems < 0 {
 		return nil, syserror.EINVAL
 	}
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if nsems > r.limits.SemaphoresMax {
+		return nil, syserror.EINVAL
+	}
+
 	if !private {
 		// Look up an existing semaphore.
 		if set := r.findByKey(key); set != nil {
@@ -162,11 +263,15 @@ func (r *Registry) FindOrCreate(ctx context.Context, key, nsems int32, mode linu
 	}
 
 	// Apply system limits.
-	if len(r.semaphores) >= setsMax {
-		return nil, syserror.EINVAL
+	//
+	// "A semaphore set has to be created but the system limit for the maximum
+	// number of semaphore sets (SEMMNI), or the system wide maximum number of
+	// semaphores (SEMMNS), would be exceeded." - man semget(2)
+	if len(r.semaphores) >= int(r.limits.SetsMax) {
+		return nil, syserror.ENOSPC
 	}
-	if r.totalSems() > int(semaphoresTotalMax-nsems) {
-		return nil, syserror.EINVAL
+	if r.totalSems() > int(r.limits.SemaphoresTotalMax-nsems) {
+		return nil, syserror.ENOSPC
 	}
 
 	// Finally create a new set.
@@ -209,6 +314,7 @@ func (r *Registry) newSet(ctx context.Context, key int32, owner, creator fs.File
 		perms:      perms,
 		changeTime: ktime.NowFromContext(ctx),
 		sems:       make([]sem, nsems),
+		undo:       make(map[*UndoList][]int16),
 	}
 
 	// Find the next available ID.
@@ -237,6 +343,18 @@ func (r *Registry) FindByID(id int32) *Set {
 	return r.semaphores[id]
 }
 
+// Sets returns all sets in the registry, ordered by ID.
+func (r *Registry) Sets() []*Set {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sets := make([]*Set, 0, len(r.semaphores))
+	for _, s := range r.semaphores {
+		sets = append(sets, s)
+	}
+	sort.Slice(sets, func(i, j int) bool { return sets[i].ID < sets[j].ID })
+	return sets
+}
+
 func (r *Registry) findByKey(key int32) *Set {
 	for _, v := range r.semaphores {
 		if v.key == key {
@@ -283,6 +401,47 @@ func (s *Set) Change(ctx context.Context, creds *auth.Credentials, owner fs.File
 	return nil
 }
 
+// Stat returns information about the set, with user and group IDs mapped
+// into the user namespace of creds. Stat doesn't check that creds may read
+// the set.
+func (s *Set) Stat(creds *auth.Credentials) *linux.SemidDS {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.statLocked(creds)
+}
+
+// GetStat returns information about the set, as Stat, after checking that
+// creds may read the set. See semctl(IPC_STAT).
+func (s *Set) GetStat(creds *auth.Credentials) (*linux.SemidDS, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// "The calling process must have read permission on the semaphore set."
+	if !s.checkPerms(creds, fs.PermMask{Read: true}) {
+		return nil, syserror.EACCES
+	}
+	return s.statLocked(creds), nil
+}
+
+// statLocked implements Stat.
+//
+// Precondition: Caller must hold s.mu.
+func (s *Set) statLocked(creds *auth.Credentials) *linux.SemidDS {
+	return &linux.SemidDS{
+		SemPerm: linux.IPCPerm{
+			Key:  uint32(s.key),
+			UID:  uint32(creds.UserNamespace.MapFromKUID(s.owner.UID)),
+			GID:  uint32(creds.UserNamespace.MapFromKGID(s.owner.GID)),
+			CUID: uint32(creds.UserNamespace.MapFromKUID(s.creator.UID)),
+			CGID: uint32(creds.UserNamespace.MapFromKGID(s.creator.GID)),
+			Mode: uint16(s.perms.LinuxMode()),
+		},
+		SemOTime: s.opTime.TimeT(),
+		SemCTime: s.changeTime.TimeT(),
+		SemNSems: uint64(s.Size()),
+	}
+}
+
 // SetVal overrides a semaphore value, waking up waiters as needed.
 func (s *Set) SetVal(ctx context.Context, num int32, val int16, creds *auth.Credentials, pid int32) error {
 	if val < 0 || val > valueMax {
@@ -302,7 +461,12 @@ func (s *Set) SetVal(ctx context.Context, num int32, val int16, creds *auth.Cred
 		return syserror.ERANGE
 	}
 
-	// TODO: Clear undo entries in all processes
+	// "When a semaphore value is changed directly using the SETVAL or SETALL
+	// commands to semctl(2), the corresponding semadj values in all processes
+	// are cleared." - man semop(2)
+	for _, adjs := range s.undo {
+		adjs[num] = 0
+	}
 	sem.value = val
 	sem.pid = pid
 	s.changeTime = ktime.NowFromContext(ctx)
@@ -333,10 +497,14 @@ func (s *Set) SetValAll(ctx context.Context, vals []uint16, creds *auth.Credenti
 		return syserror.EACCES
 	}
 
+	// See SetVal.
+	for _, adjs := range s.undo {
+		for i := range adjs {
+			adjs[i] = 0
+		}
+	}
 	for i, val := range vals {
 		sem := &s.sems[i]
-
-		// TODO: Clear undo entries in all processes
 		sem.value = int16(val)
 		sem.pid = pid
 		sem.wakeWaiters()
@@ -396,12 +564,47 @@ func (s *Set) GetPID(num int32, creds *auth.Credentials) (int32, error) {
 	return sem.pid, nil
 }
 
+// GetNCnt returns the number of tasks waiting for the value of a semaphore to
+// increase.
+func (s *Set) GetNCnt(num int32, creds *auth.Credentials) (int32, error) {
+	return s.countWaiters(num, creds, func(w *waiter) bool { return w.value < 0 })
+}
+
+// GetZCnt returns the number of tasks waiting for the value of a semaphore to
+// become zero.
+func (s *Set) GetZCnt(num int32, creds *auth.Credentials) (int32, error) {
+	return s.countWaiters(num, creds, func(w *waiter) bool { return w.value == 0 })
+}
+
+func (s *Set) countWaiters(num int32, creds *auth.Credentials, match func(*waiter) bool) (int32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// "The calling process must have read permission on the semaphore set."
+	if !s.checkPerms(creds, fs.PermMask{Read: true}) {
+		return 0, syserror.EACCES
+	}
+
+	sem := s.findSem(num)
+	if sem == nil {
+		return 0, syserror.EINVAL
+	}
+	var n int32
+	for w := sem.waiters.Front(); w != nil; w = w.Next() {
+		if match(w) {
+			n++
+		}
+	}
+	return n, nil
+}
+
 // ExecuteOps attempts to execute a list of operations to the set. It only
 // succeeds when all operations can be applied. No changes are made if it fails.
+// Adjustments for operations with SEM_UNDO are recorded in undo.
 //
 // On failure, it may return an error (retries are hopeless) or it may return
 // a channel that can be waited on before attempting again.
-func (s *Set) ExecuteOps(ctx context.Context, ops []linux.Sembuf, creds *auth.Credentials, pid int32) (chan struct{}, int32, error) {
+func (s *Set) ExecuteOps(ctx context.Context, ops []linux.Sembuf, creds *auth.Credentials, pid int32, undo *UndoList) (chan struct{}, int32, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -425,20 +628,24 @@ func (s *Set) ExecuteOps(ctx context.Context, ops []linux.Sembuf, creds *auth.Cr
 		return nil, 0, syserror.EACCES
 	}
 
-	ch, num, err := s.executeOps(ctx, ops, pid)
+	ch, num, err := s.executeOps(ctx, ops, pid, undo)
 	if err != nil {
 		return nil, 0, err
 	}
 	return ch, num, nil
 }
 
-func (s *Set) executeOps(ctx context.Context, ops []linux.Sembuf, pid int32) (chan struct{}, int32, error) {
+func (s *Set) executeOps(ctx context.Context, ops []linux.Sembuf, pid int32, undo *UndoList) (chan struct{}, int32, error) {
 	// Changes to semaphores go to this slice temporarily until they all succeed.
 	tmpVals := make([]int16, len(s.sems))
 	for i := range s.sems {
 		tmpVals[i] = s.sems[i].value
 	}
 
+	// Likewise for changes to the SEM_UNDO adjustments of undo, if there are
+	// any.
+	var tmpAdjs []int16
+
 	for _, op := range ops {
 		sem := &s.sems[op.SemNum]
 		if op.SemOp == 0 {
@@ -476,17 +683,33 @@ func (s *Set) executeOps(ctx context.Context, ops []linux.Sembuf, pid int32) (ch
 				}
 			}
 
+			if op.SemFlg&linux.SEM_UNDO != 0 {
+				if tmpAdjs == nil {
+					tmpAdjs = make([]int16, len(s.sems))
+					copy(tmpAdjs, s.undo[undo])
+				}
+				// The adjustment undoes the operation when the process exits.
+				adj := int32(tmpAdjs[op.SemNum]) - int32(op.SemOp)
+				if adj < -linux.SEMAEM-1 || adj > linux.SEMAEM {
+					return nil, 0, syserror.ERANGE
+				}
+				tmpAdjs[op.SemNum] = int16(adj)
+			}
+
 			tmpVals[op.SemNum] += op.SemOp
 		}
 	}
 
 	// All operations succeeded, apply them.
-	// TODO: handle undo operations.
 	for i, v := range tmpVals {
 		s.sems[i].value = v
 		s.sems[i].wakeWaiters()
 		s.sems[i].pid = pid
 	}
+	if tmpAdjs != nil {
+		s.undo[undo] = tmpAdjs
+		undo.add(s)
+	}
 	s.opTime = ktime.NowFromContext(ctx)
 	return nil, 0, nil
 }
@@ -546,6 +769,40 @@ func (s *Set) destroy() {
 		}
 		s.waiters.Reset()
 	}
+
+	// Adjustments to removed sets are never undone.
+	for u := range s.undo {
+		u.remove(s)
+	}
+	s.undo = make(map[*UndoList][]int16)
+}
+
+// undoAdjustments applies the adjustments recorded by u to the set.
+func (s *Set) undoAdjustments(u *UndoList, pid int32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	adjs, ok := s.undo[u]
+	if !ok {
+		return
+	}
+	delete(s.undo, u)
+	for i, adj := range adjs {
+		if adj == 0 {
+			continue
+		}
+		// As in Linux, adjustments that would take the semaphore out of range
+		// are clamped rather than failing.
+		v := int32(s.sems[i].value) + int32(adj)
+		if v < 0 {
+			v = 0
+		} else if v > valueMax {
+			v = valueMax
+		}
+		s.sems[i].value = int16(v)
+		s.sems[i].pid = pid
+		s.sems[i].wakeWaiters()
+	}
 }
 
 // wakeWaiters goes over all waiters and checks which of them can be notified.
@@ -554,6 +811,7 @@ func (s *sem) wakeWaiters() {
 	for w := s.waiters.Front(); w != nil; {
 		if s.value < w.value {
 			// Still blocked, skip it.
+			w = w.Next()
 			continue
 		}
 		w.ch <- struct{}{}
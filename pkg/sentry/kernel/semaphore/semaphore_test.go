@@ -25,7 +25,7 @@ import (
 )
 
 func executeOps(ctx context.Context, t *testing.T, set *Set, ops []linux.Sembuf, block bool) chan struct{} {
-	ch, _, err := set.executeOps(ctx, ops, 123)
+	ch, _, err := set.executeOps(ctx, ops, 123, nil)
 	if err != nil {
 		t.Fatalf("ExecuteOps(ops) failed, err: %v, ops: %+v", err, ops)
 	}
@@ -123,13 +123,13 @@ func TestNoWait(t *testing.T) {
 
 	ops[0].SemOp = -2
 	ops[0].SemFlg = linux.IPC_NOWAIT
-	if _, _, err := set.executeOps(ctx, ops, 123); err != syserror.ErrWouldBlock {
+	if _, _, err := set.executeOps(ctx, ops, 123, nil); err != syserror.ErrWouldBlock {
 		t.Fatalf("ExecuteOps(ops) wrong result, got: %v, expected: %v", err, syserror.ErrWouldBlock)
 	}
 
 	ops[0].SemOp = 0
 	ops[0].SemFlg = linux.IPC_NOWAIT
-	if _, _, err := set.executeOps(ctx, ops, 123); err != syserror.ErrWouldBlock {
+	if _, _, err := set.executeOps(ctx, ops, 123, nil); err != syserror.ErrWouldBlock {
 		t.Fatalf("ExecuteOps(ops) wrong result, got: %v, expected: %v", err, syserror.ErrWouldBlock)
 	}
 }
@@ -170,3 +170,92 @@ func TestUnregister(t *testing.T) {
 		}
 	}
 }
+
+func TestUndo(t *testing.T) {
+	ctx := contexttest.Context(t)
+	r := NewRegistry(auth.NewRootUserNamespace())
+	set, err := r.FindOrCreate(ctx, 123, 2, linux.FileMode(0x600), true, true, true)
+	if err != nil {
+		t.Fatalf("FindOrCreate() failed, err: %v", err)
+	}
+	u := NewUndoList()
+
+	ops := []linux.Sembuf{
+		{SemNum: 0, SemOp: 3, SemFlg: linux.SEM_UNDO},
+		{SemNum: 1, SemOp: 2},
+	}
+	if _, _, err := set.executeOps(ctx, ops, 123, u); err != nil {
+		t.Fatalf("ExecuteOps(%+v) failed, err: %v", ops, err)
+	}
+	ops = []linux.Sembuf{
+		{SemNum: 0, SemOp: -1, SemFlg: linux.SEM_UNDO},
+		{SemNum: 1, SemOp: -1, SemFlg: linux.SEM_UNDO},
+	}
+	if _, _, err := set.executeOps(ctx, ops, 123, u); err != nil {
+		t.Fatalf("ExecuteOps(%+v) failed, err: %v", ops, err)
+	}
+
+	u.Release(456)
+	if got := set.sems[0].value; got != 0 {
+		t.Errorf("sems[0].value after Release got: %d, expected: 0", got)
+	}
+	if got := set.sems[1].value; got != 2 {
+		t.Errorf("sems[1].value after Release got: %d, expected: 2", got)
+	}
+	if got := set.sems[0].pid; got != 456 {
+		t.Errorf("sems[0].pid after Release got: %d, expected: 456", got)
+	}
+	if len(set.undo) != 0 {
+		t.Errorf("set.undo after Release got: %+v, expected: empty", set.undo)
+	}
+}
+
+func TestUndoClearedBySetVal(t *testing.T) {
+	ctx := contexttest.Context(t)
+	r := NewRegistry(auth.NewRootUserNamespace())
+	set, err := r.FindOrCreate(ctx, 123, 1, linux.FileMode(0x600), true, true, true)
+	if err != nil {
+		t.Fatalf("FindOrCreate() failed, err: %v", err)
+	}
+	u := NewUndoList()
+
+	ops := []linux.Sembuf{
+		{SemOp: 3, SemFlg: linux.SEM_UNDO},
+	}
+	if _, _, err := set.executeOps(ctx, ops, 123, u); err != nil {
+		t.Fatalf("ExecuteOps(%+v) failed, err: %v", ops, err)
+	}
+	creds := auth.CredentialsFromContext(ctx)
+	if err := set.SetVal(ctx, 0, 5, creds, 123); err != nil {
+		t.Fatalf("SetVal() failed, err: %v", err)
+	}
+
+	u.Release(456)
+	if got := set.sems[0].value; got != 5 {
+		t.Errorf("sems[0].value after Release got: %d, expected: 5", got)
+	}
+}
+
+func TestUndoRemovedSet(t *testing.T) {
+	ctx := contexttest.Context(t)
+	r := NewRegistry(auth.NewRootUserNamespace())
+	set, err := r.FindOrCreate(ctx, 123, 1, linux.FileMode(0x600), true, true, true)
+	if err != nil {
+		t.Fatalf("FindOrCreate() failed, err: %v", err)
+	}
+	u := NewUndoList()
+
+	ops := []linux.Sembuf{
+		{SemOp: 1, SemFlg: linux.SEM_UNDO},
+	}
+	if _, _, err := set.executeOps(ctx, ops, 123, u); err != nil {
+		t.Fatalf("ExecuteOps(%+v) failed, err: %v", ops, err)
+	}
+	creds := auth.CredentialsFromContext(ctx)
+	if err := r.RemoveID(set.ID, creds); err != nil {
+		t.Fatalf("RemoveID(%d) failed, err: %v", set.ID, err)
+	}
+	if len(u.sets) != 0 {
+		t.Errorf("UndoList.sets after RemoveID got: %+v, expected: empty", u.sets)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package semaphore
+
+import (
+	"sync"
+)
+
+// UndoList tracks the sets on which a process performed operations with
+// SEM_UNDO, so that the adjustments made by those operations can be undone
+// when the process exits. The adjustments themselves are stored in each Set.
+//
+// Lock ordering: Set.mu -> UndoList.mu
+//
+// +stateify savable
+type UndoList struct {
+	mu sync.Mutex `state:"nosave"`
+
+	// sets is the set of Sets with adjustments recorded for this list. sets
+	// is protected by mu.
+	sets map[*Set]struct{}
+}
+
+// NewUndoList returns an empty UndoList.
+func NewUndoList() *UndoList {
+	return &UndoList{
+		sets: make(map[*Set]struct{}),
+	}
+}
+
+// add records that s holds adjustments for u.
+func (u *UndoList) add(s *Set) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.sets[s] = struct{}{}
+}
+
+// remove records that s no longer holds adjustments for u.
+func (u *UndoList) remove(s *Set) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.sets, s)
+}
+
+// Release undoes all adjustments recorded for u, as when the process owning u
+// exits. pid is the ID of that process in the root PID namespace, which
+// becomes the PID of the last process to operate on the adjusted semaphores.
+func (u *UndoList) Release(pid int32) {
+	u.mu.Lock()
+	sets := u.sets
+	u.sets = make(map[*Set]struct{})
+	u.mu.Unlock()
+
+	// Set.mu must be locked without u.mu held.
+	for s := range sets {
+		s.undoAdjustments(u, pid)
+	}
+}
@@ -15,6 +15,8 @@
 package kernel
 
 import (
+	"sync"
+
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/refs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
@@ -54,6 +56,71 @@ type Session struct {
 	// sessionEntry is the embed for TaskSet.sessions. This is protected by
 	// TaskSet.mu.
 	sessionEntry
+
+	// ttyMu protects tty.
+	ttyMu sync.Mutex `state:"nosave"`
+
+	// tty is the controlling terminal of the Session, or nil if it has
+	// none.
+	tty ControllingTerminal
+}
+
+// ControllingTerminal is a terminal which may be the controlling terminal of
+// a Session.
+type ControllingTerminal interface {
+	// SessionLeaderExited is called when the leader of s exits while the
+	// terminal is the controlling terminal of s, which it no longer is.
+	// The terminal must send SIGHUP and SIGCONT to its foreground process
+	// group and forget s.
+	SessionLeaderExited(s *Session)
+}
+
+// ControllingTerminal returns the controlling terminal of s, or nil if it has
+// none.
+func (s *Session) ControllingTerminal() ControllingTerminal {
+	s.ttyMu.Lock()
+	defer s.ttyMu.Unlock()
+	return s.tty
+}
+
+// SetControllingTerminal makes tty the controlling terminal of s. It returns
+// false if s already has another controlling terminal.
+func (s *Session) SetControllingTerminal(tty ControllingTerminal) bool {
+	s.ttyMu.Lock()
+	defer s.ttyMu.Unlock()
+	if s.tty != nil && s.tty != tty {
+		return false
+	}
+	s.tty = tty
+	return true
+}
+
+// ClearControllingTerminal detaches s from its controlling terminal, if it is
+// tty.
+func (s *Session) ClearControllingTerminal(tty ControllingTerminal) {
+	s.ttyMu.Lock()
+	defer s.ttyMu.Unlock()
+	if s.tty == tty {
+		s.tty = nil
+	}
+}
+
+// releaseControllingTerminal detaches the Session led by tg, if any, from its
+// controlling terminal. It is called when tg exits.
+//
+// See drivers/tty/tty_jobctrl.c:disassociate_ctty().
+func (tg *ThreadGroup) releaseControllingTerminal() {
+	s := tg.Session()
+	if s == nil || s.leader != tg {
+		return
+	}
+	s.ttyMu.Lock()
+	tty := s.tty
+	s.tty = nil
+	s.ttyMu.Unlock()
+	if tty != nil {
+		tty.SessionLeaderExited(s)
+	}
 }
 
 // incRef grabs a reference.
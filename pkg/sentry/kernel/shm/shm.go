@@ -16,8 +16,8 @@
 //
 // Known missing features:
 //
-// - SHM_LOCK/SHM_UNLOCK are no-ops. The sentry currently doesn't implement
-//   memory locking in general.
+// - SHM_LOCK/SHM_UNLOCK only mark the segment as locked. The sentry doesn't
+//   implement swap, so segment memory is never swapped out anyways.
 //
 // - SHM_HUGETLB and related flags for shmget(2) are ignored. There's no easy
 //   way to implement hugetlb support on a per-map basis, and it has no impact
@@ -35,6 +35,7 @@ package shm
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
@@ -44,6 +45,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
 	ktime "gvisor.googlesource.com/gvisor/pkg/sentry/kernel/time"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/limits"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/memmap"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/pgalloc"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
@@ -101,6 +103,33 @@ func (r *Registry) FindByID(id ID) *Shm {
 	return r.shms[id]
 }
 
+// Segments returns all segments in the registry, ordered by ID.
+func (r *Registry) Segments() []*Shm {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	segments := make([]*Shm, 0, len(r.shms))
+	for _, s := range r.shms {
+		segments = append(segments, s)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].ID < segments[j].ID })
+	return segments
+}
+
+// HighestID returns the highest ID of any segment in the registry, or 0 if
+// there are none. Since segment IDs are used as indices into the registry,
+// this is the value returned by shmctl(IPC_INFO) and shmctl(SHM_INFO).
+func (r *Registry) HighestID() ID {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var highest ID
+	for id := range r.shms {
+		if id > highest {
+			highest = id
+		}
+	}
+	return highest
+}
+
 // dissociateKey removes the association between a segment and its key,
 // preventing it from being discovered in the registry. This doesn't necessarily
 // mean the segment is about to be destroyed. This is analogous to unlinking a
@@ -268,7 +297,7 @@ func (r *Registry) ShmInfo() *linux.ShmInfo {
 	defer r.mu.Unlock()
 
 	return &linux.ShmInfo{
-		UsedIDs: int32(r.lastIDUsed),
+		UsedIDs: int32(len(r.shms)),
 		ShmTot:  r.totalPages,
 		ShmRss:  r.totalPages, // We could probably get a better estimate from memory accounting.
 		ShmSwp:  0,            // No reclaim at the moment.
@@ -368,6 +397,9 @@ type Shm struct {
 	// in the registry and can no longer be attached. When the last user
 	// detaches from the segment, it is destroyed.
 	pendingDestruction bool
+
+	// locked indicates the segment was locked through shmctl(SHM_LOCK).
+	locked bool
 }
 
 // Precondition: Caller must hold s.mu.
@@ -468,6 +500,19 @@ func (s *Shm) Translate(ctx context.Context, required, optional memmap.MappableR
 	return nil, err
 }
 
+// Residency implements memmap.ResidencyMappable.Residency.
+func (s *Shm) Residency(ctx context.Context, mr memmap.MappableRange, dst []byte) error {
+	dst = dst[:mr.Length()/usermem.PageSize]
+	for i := range dst {
+		dst[i] = 0
+	}
+	if source := mr.Intersect(memmap.MappableRange{0, s.fr.Length()}); source.Length() != 0 {
+		fr := platform.FileRange{s.fr.Start + source.Start, s.fr.Start + source.End}
+		return s.mfp.MemoryFile().Residency(fr, dst[(source.Start-mr.Start)/usermem.PageSize:])
+	}
+	return nil
+}
+
 // InvalidateUnsavable implements memmap.Mappable.InvalidateUnsavable.
 func (s *Shm) InvalidateUnsavable(ctx context.Context) error {
 	return nil
@@ -541,11 +586,28 @@ func (s *Shm) IPCStat(ctx context.Context) (*linux.ShmidDS, error) {
 		// namespace." - man shmctl(2)
 		return nil, syserror.EACCES
 	}
+	return s.statLocked(ctx), nil
+}
 
+// IPCStatAny returns information about a shm without checking that the caller
+// may read the segment. See shmctl(SHM_STAT_ANY).
+func (s *Shm) IPCStatAny(ctx context.Context) *linux.ShmidDS {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.statLocked(ctx)
+}
+
+// statLocked returns information about a shm.
+//
+// Precondition: Caller must hold s.mu.
+func (s *Shm) statLocked(ctx context.Context) *linux.ShmidDS {
 	var mode uint16
 	if s.pendingDestruction {
 		mode |= linux.SHM_DEST
 	}
+	if s.locked {
+		mode |= linux.SHM_LOCKED
+	}
 	creds := auth.CredentialsFromContext(ctx)
 
 	nattach := uint64(s.ReadRefs())
@@ -575,7 +637,30 @@ func (s *Shm) IPCStat(ctx context.Context) (*linux.ShmidDS, error) {
 		ShmNattach: nattach,
 	}
 
-	return ds, nil
+	return ds
+}
+
+// SetLocked locks or unlocks a segment. See shmctl(SHM_LOCK) and
+// shmctl(SHM_UNLOCK).
+func (s *Shm) SetLocked(ctx context.Context, locked bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	creds := auth.CredentialsFromContext(ctx)
+	if !creds.HasCapabilityIn(linux.CAP_IPC_LOCK, s.registry.userNS) {
+		// Unprivileged callers must own or have created the segment, and may
+		// only lock it if they may lock any memory at all. See
+		// ipc/shm.c:shmctl_do_lock() in Linux.
+		if s.owner.UID != creds.EffectiveKUID && s.creator.UID != creds.EffectiveKUID {
+			return syserror.EPERM
+		}
+		if locked && limits.FromContext(ctx).Get(limits.MemoryLocked).Cur == 0 {
+			return syserror.EPERM
+		}
+	}
+
+	s.locked = locked
+	return nil
 }
 
 // Set modifies attributes for a segment. See shmctl(IPC_SET).
@@ -56,6 +56,9 @@ const (
 
 	// ExternalAfterEnable enables the external hook after syscall execution.
 	ExternalAfterEnable
+
+	// SyscallMetricsEnable enables recording of syscall metrics.
+	SyscallMetricsEnable
 )
 
 // StraceEnableBits combines both strace log and event flags.
@@ -0,0 +1,198 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+// Sysctl describes an integer-valued kernel parameter, as exposed under
+// /proc/sys. Sysctls are identified by their dotted name, e.g.
+// "vm.max_map_count", which corresponds to the file /proc/sys/vm/max_map_count.
+type Sysctl struct {
+	// Default is the value of the sysctl until it is first written.
+	Default int64
+
+	// Min and Max are the inclusive bounds of values that may be written.
+	Min int64
+	Max int64
+
+	// Writable is true if the value may be changed by the application.
+	Writable bool
+}
+
+// sysctlRegistry holds all registered sysctls, keyed by dotted name. It is
+// populated during package initialization and immutable afterwards.
+var sysctlRegistry = make(map[string]Sysctl)
+
+// RegisterSysctl registers a sysctl with the given dotted name.
+//
+// RegisterSysctl must only be called during package initialization.
+func RegisterSysctl(name string, s Sysctl) {
+	if _, ok := sysctlRegistry[name]; ok {
+		panic(fmt.Sprintf("sysctl %q registered twice", name))
+	}
+	if s.Default < s.Min || s.Default > s.Max {
+		panic(fmt.Sprintf("sysctl %q default %d outside of [%d, %d]", name, s.Default, s.Min, s.Max))
+	}
+	sysctlRegistry[name] = s
+}
+
+// LookupSysctl returns the registered sysctl with the given dotted name.
+func LookupSysctl(name string) (Sysctl, bool) {
+	s, ok := sysctlRegistry[name]
+	return s, ok
+}
+
+// SysctlsIn returns the sorted names, relative to dir, of all registered
+// sysctls directly within the dotted directory dir (e.g. "vm").
+func SysctlsIn(dir string) []string {
+	prefix := dir + "."
+	var names []string
+	for name := range sysctlRegistry {
+		if rest := strings.TrimPrefix(name, prefix); rest != name && !strings.Contains(rest, ".") {
+			names = append(names, rest)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterSysctl("kernel.pid_max", Sysctl{
+		Default: TasksLimit,
+		// Linux's minimum is RESERVED_PIDS + 1.
+		Min:      301,
+		Max:      TasksLimit,
+		Writable: true,
+	})
+	RegisterSysctl("kernel.threads-max", Sysctl{
+		Default: TasksLimit,
+		Min:     TasksLimit,
+		Max:     TasksLimit,
+	})
+	RegisterSysctl("vm.max_map_count", Sysctl{
+		// DEFAULT_MAX_MAP_COUNT in include/linux/mm.h.
+		Default:  65530,
+		Min:      0,
+		Max:      math.MaxInt32,
+		Writable: true,
+	})
+	RegisterSysctl("vm.mmap_rnd_bits", Sysctl{
+		// CONFIG_ARCH_MMAP_RND_BITS_{MIN,MAX} for x86_64 in Linux.
+		Default:  28,
+		Min:      28,
+		Max:      32,
+		Writable: true,
+	})
+	RegisterSysctl("vm.legacy_va_layout", Sysctl{
+		Default:  0,
+		Min:      0,
+		Max:      math.MaxInt32,
+		Writable: true,
+	})
+	RegisterSysctl("vm.overcommit_memory", Sysctl{
+		// We always behave as if overcommit is in heuristic mode
+		// (OVERCOMMIT_GUESS), but accept the other modes so that
+		// applications that tune this succeed.
+		Default:  0,
+		Min:      0,
+		Max:      2,
+		Writable: true,
+	})
+}
+
+// sysctlValues holds the values of sysctls that have been written.
+//
+// +stateify savable
+type sysctlValues struct {
+	mu sync.Mutex `state:"nosave"`
+
+	// values maps dotted sysctl names to their current values. Sysctls not
+	// in values have their default value. values is protected by mu and
+	// lazily initialized.
+	values map[string]int64
+}
+
+// Sysctl returns the current value of the sysctl with the given dotted name.
+func (k *Kernel) Sysctl(name string) (int64, error) {
+	s, ok := sysctlRegistry[name]
+	if !ok {
+		return 0, syserror.ENOENT
+	}
+	k.sysctls.mu.Lock()
+	defer k.sysctls.mu.Unlock()
+	if v, ok := k.sysctls.values[name]; ok {
+		return v, nil
+	}
+	return s.Default, nil
+}
+
+// SetSysctl changes the value of the sysctl with the given dotted name.
+func (k *Kernel) SetSysctl(name string, v int64) error {
+	s, ok := sysctlRegistry[name]
+	if !ok {
+		return syserror.ENOENT
+	}
+	if !s.Writable {
+		return syserror.EPERM
+	}
+	if v < s.Min || v > s.Max {
+		return syserror.EINVAL
+	}
+	k.sysctls.mu.Lock()
+	defer k.sysctls.mu.Unlock()
+	if k.sysctls.values == nil {
+		k.sysctls.values = make(map[string]int64)
+	}
+	k.sysctls.values[name] = v
+	return nil
+}
+
+// pidMax returns the current value of kernel.pid_max.
+func (k *Kernel) pidMax() ThreadID {
+	v, err := k.Sysctl("kernel.pid_max")
+	if err != nil {
+		panic(fmt.Sprintf("kernel.pid_max not registered: %v", err))
+	}
+	return ThreadID(v)
+}
+
+// mmapLayoutOptions returns the options used to construct the mmap layout of
+// a new image loaded by a task with the given personality.
+func (k *Kernel) mmapLayoutOptions(personality uint32) arch.MmapLayoutOptions {
+	randBits, err := k.Sysctl("vm.mmap_rnd_bits")
+	if err != nil {
+		panic(fmt.Sprintf("vm.mmap_rnd_bits not registered: %v", err))
+	}
+	legacy, err := k.Sysctl("vm.legacy_va_layout")
+	if err != nil {
+		panic(fmt.Sprintf("vm.legacy_va_layout not registered: %v", err))
+	}
+	return arch.MmapLayoutOptions{
+		NoRandomize: personality&linux.ADDR_NO_RANDOMIZE != 0,
+		RandBits:    uint(randBits),
+		// As for Linux's arch/x86/mm/mmap.c:mmap_is_legacy().
+		Legacy: legacy != 0 || personality&linux.ADDR_COMPAT_LAYOUT != 0,
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"reflect"
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+func TestSysctlsIn(t *testing.T) {
+	got := SysctlsIn("vm")
+	want := []string{"legacy_va_layout", "max_map_count", "mmap_rnd_bits", "overcommit_memory"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SysctlsIn(vm) got %v want %v", got, want)
+	}
+}
+
+func TestSetSysctl(t *testing.T) {
+	var k Kernel
+
+	if v, err := k.Sysctl("vm.max_map_count"); err != nil || v != 65530 {
+		t.Errorf("Sysctl(vm.max_map_count) got (%d, %v) want (65530, nil)", v, err)
+	}
+	if err := k.SetSysctl("vm.max_map_count", 262144); err != nil {
+		t.Fatalf("SetSysctl(vm.max_map_count) failed: %v", err)
+	}
+	if v, err := k.Sysctl("vm.max_map_count"); err != nil || v != 262144 {
+		t.Errorf("Sysctl(vm.max_map_count) got (%d, %v) want (262144, nil)", v, err)
+	}
+
+	for _, test := range []struct {
+		name string
+		v    int64
+		want error
+	}{
+		{"vm.overcommit_memory", 3, syserror.EINVAL},
+		{"vm.overcommit_memory", -1, syserror.EINVAL},
+		{"vm.mmap_rnd_bits", 27, syserror.EINVAL},
+		{"vm.mmap_rnd_bits", 33, syserror.EINVAL},
+		{"kernel.threads-max", TasksLimit, syserror.EPERM},
+		{"kernel.nonexistent", 0, syserror.ENOENT},
+	} {
+		if err := k.SetSysctl(test.name, test.v); err != test.want {
+			t.Errorf("SetSysctl(%s, %d) got %v want %v", test.name, test.v, err, test.want)
+		}
+	}
+}
+
+func TestMmapLayoutOptions(t *testing.T) {
+	var k Kernel
+
+	if got, want := k.mmapLayoutOptions(linux.PER_LINUX), (arch.MmapLayoutOptions{RandBits: 28}); got != want {
+		t.Errorf("mmapLayoutOptions(PER_LINUX) got %+v want %+v", got, want)
+	}
+	if got, want := k.mmapLayoutOptions(linux.ADDR_NO_RANDOMIZE|linux.ADDR_COMPAT_LAYOUT), (arch.MmapLayoutOptions{NoRandomize: true, RandBits: 28, Legacy: true}); got != want {
+		t.Errorf("mmapLayoutOptions(ADDR_NO_RANDOMIZE|ADDR_COMPAT_LAYOUT) got %+v want %+v", got, want)
+	}
+
+	if err := k.SetSysctl("vm.mmap_rnd_bits", 32); err != nil {
+		t.Fatalf("SetSysctl(vm.mmap_rnd_bits) failed: %v", err)
+	}
+	if err := k.SetSysctl("vm.legacy_va_layout", 1); err != nil {
+		t.Fatalf("SetSysctl(vm.legacy_va_layout) failed: %v", err)
+	}
+	if got, want := k.mmapLayoutOptions(linux.PER_LINUX), (arch.MmapLayoutOptions{RandBits: 32, Legacy: true}); got != want {
+		t.Errorf("mmapLayoutOptions(PER_LINUX) got %+v want %+v", got, want)
+	}
+}
@@ -18,34 +18,106 @@ import (
 	"fmt"
 	"math/rand"
 	"sync"
+
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+// Syslog levels, from include/linux/kern_levels.h.
+const (
+	SyslogLevelEmerg   = 0
+	SyslogLevelAlert   = 1
+	SyslogLevelCrit    = 2
+	SyslogLevelErr     = 3
+	SyslogLevelWarning = 4
+	SyslogLevelNotice  = 5
+	SyslogLevelInfo    = 6
+	SyslogLevelDebug   = 7
 )
 
+// SyslogBufferSize is the maximum number of message bytes retained in the
+// kernel log, matching the default Linux log buffer size.
+const SyslogBufferSize = 1 << 17
+
+// SyslogRecord is a single message in the kernel log.
+//
+// +stateify savable
+type SyslogRecord struct {
+	// Seq is the sequence number of the record. Sequence numbers are
+	// assigned in increasing order starting at 0.
+	Seq uint64
+
+	// Priority is the syslog priority of the message: the facility shifted
+	// left by 3, ORed with the level.
+	Priority int
+
+	// Timestamp is the time at which the message was logged, in
+	// nanoseconds since boot.
+	Timestamp int64
+
+	// Message is the message text, without a trailing newline.
+	Message string
+}
+
+// String formats the record in the format used by syslog(2).
+func (r *SyslogRecord) String() string {
+	return fmt.Sprintf("<%d>[%11.6f] %s\n", r.Priority, float64(r.Timestamp)/1e9, r.Message)
+}
+
+// KmsgString formats the record in the format used by /dev/kmsg. See
+// Documentation/ABI/testing/dev-kmsg.
+func (r *SyslogRecord) KmsgString() string {
+	return fmt.Sprintf("%d,%d,%d,-;%s\n", r.Priority, r.Seq, r.Timestamp/1000, r.Message)
+}
+
 // syslog represents a sentry-global kernel log.
 //
-// Currently, it contains only fun messages for a dmesg easter egg.
+// It initially contains fun messages for a dmesg easter egg, followed by
+// any messages logged by the sentry (e.g. notices about unsupported
+// syscalls) or written by the application to /dev/kmsg.
 //
 // +stateify savable
 type syslog struct {
 	// mu protects the below.
 	mu sync.Mutex `state:"nosave"`
 
-	// msg is the syslog message buffer. It is lazily initialized.
-	msg []byte
-}
+	// initialized is true once the easter egg messages have been added.
+	initialized bool
 
-// Log returns a copy of the syslog.
-func (s *syslog) Log() []byte {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	// records holds the retained messages in order of increasing sequence
+	// number.
+	records []SyslogRecord
+
+	// size is the total length of the messages in records.
+	size int
+
+	// nextSeq is the sequence number of the next record.
+	nextSeq uint64
+
+	// clearSeq is the sequence number of the first record returned by
+	// Log; records before it were cleared by SYSLOG_ACTION_CLEAR.
+	clearSeq uint64
+
+	// readSeq is the sequence number of the next record that will be
+	// returned by a destructive read (SYSLOG_ACTION_READ).
+	readSeq uint64
+
+	// once records the keys passed to AppendOnce.
+	once map[string]struct{}
+
+	// queue is notified when new records are appended.
+	queue waiter.Queue `state:"nosave"`
+}
 
-	if s.msg != nil {
-		// Already initialized, just return a copy.
-		o := make([]byte, len(s.msg))
-		copy(o, s.msg)
-		return o
+// initLocked adds the easter egg messages if they have not been added yet.
+//
+// Preconditions: s.mu must be locked.
+func (s *syslog) initLocked() {
+	if s.initialized {
+		return
 	}
+	s.initialized = true
 
-	// Not initialized, create message.
 	allMessages := []string{
 		"Synthesizing system calls...",
 		"Mounting deweydecimalfs...",
@@ -86,21 +158,211 @@ func (s *syslog) Log() []byte {
 		return m
 	}
 
-	const format = "<6>[%11.6f] %s\n"
-
-	s.msg = append(s.msg, []byte(fmt.Sprintf(format, 0.0, "Starting gVisor..."))...)
+	s.appendLocked(0, SyslogLevelInfo, "Starting gVisor...")
 
 	time := 0.1
 	for i := 0; i < 10; i++ {
 		time += rand.Float64() / 2
-		s.msg = append(s.msg, []byte(fmt.Sprintf(format, time, selectMessage()))...)
+		s.appendLocked(int64(time*1e9), SyslogLevelInfo, selectMessage())
 	}
 
 	time += rand.Float64() / 2
-	s.msg = append(s.msg, []byte(fmt.Sprintf(format, time, "Ready!"))...)
+	s.appendLocked(int64(time*1e9), SyslogLevelInfo, "Ready!")
+}
+
+// appendLocked adds a record to the log, discarding the oldest records if
+// the log is full.
+//
+// Preconditions: s.mu must be locked.
+func (s *syslog) appendLocked(ts int64, priority int, msg string) {
+	s.records = append(s.records, SyslogRecord{
+		Seq:       s.nextSeq,
+		Priority:  priority,
+		Timestamp: ts,
+		Message:   msg,
+	})
+	s.nextSeq++
+	s.size += len(msg)
+	for s.size > SyslogBufferSize && len(s.records) > 1 {
+		s.size -= len(s.records[0].Message)
+		s.records = s.records[1:]
+	}
+}
+
+// firstSeqLocked returns the sequence number of the oldest retained record.
+//
+// Preconditions: s.mu must be locked.
+func (s *syslog) firstSeqLocked() uint64 {
+	if len(s.records) == 0 {
+		return s.nextSeq
+	}
+	return s.records[0].Seq
+}
+
+// Append adds a message with the given priority to the log. ts is the time of
+// the message in nanoseconds since boot.
+func (s *syslog) Append(ts int64, priority int, msg string) {
+	s.mu.Lock()
+	s.initLocked()
+	s.appendLocked(ts, priority, msg)
+	s.mu.Unlock()
+	s.queue.Notify(waiter.EventIn)
+}
+
+// AppendOnce is equivalent to Append, except that only the first message for
+// each key is added to the log.
+func (s *syslog) AppendOnce(key string, ts int64, priority int, msg string) {
+	s.mu.Lock()
+	if _, ok := s.once[key]; ok {
+		s.mu.Unlock()
+		return
+	}
+	if s.once == nil {
+		s.once = make(map[string]struct{})
+	}
+	s.once[key] = struct{}{}
+	s.mu.Unlock()
+	s.Append(ts, priority, msg)
+}
+
+// Log returns the contents of the log, in the format used by syslog(2).
+func (s *syslog) Log() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.initLocked()
+
+	var b []byte
+	for i := range s.records {
+		if s.records[i].Seq >= s.clearSeq {
+			b = append(b, s.records[i].String()...)
+		}
+	}
+	return b
+}
+
+// Clear causes subsequent calls to Log to omit all current records.
+func (s *syslog) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.initLocked()
+	s.clearSeq = s.nextSeq
+}
+
+// Unread returns the number of bytes that would be returned by ReadUnread.
+func (s *syslog) Unread() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.initLocked()
+
+	n := 0
+	for i := range s.records {
+		if s.records[i].Seq >= s.readSeq {
+			n += len(s.records[i].String())
+		}
+	}
+	return n
+}
+
+// ReadUnread returns up to max bytes of complete records that have not yet
+// been returned by ReadUnread, and marks them read. If no records are
+// unread, it returns syserror.ErrWouldBlock.
+func (s *syslog) ReadUnread(max int) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.initLocked()
+
+	if s.readSeq < s.firstSeqLocked() {
+		s.readSeq = s.firstSeqLocked()
+	}
+	if s.readSeq == s.nextSeq {
+		return nil, syserror.ErrWouldBlock
+	}
+	var b []byte
+	for i := range s.records {
+		r := &s.records[i]
+		if r.Seq < s.readSeq {
+			continue
+		}
+		str := r.String()
+		if len(b)+len(str) > max {
+			break
+		}
+		b = append(b, str...)
+		s.readSeq = r.Seq + 1
+	}
+	return b, nil
+}
+
+// Record returns the first retained record with sequence number at least
+// seq.
+//
+// If the record with sequence number seq has been discarded, Record returns
+// syserror.EPIPE and the sequence number of the oldest retained record. If
+// there is no such record yet, Record returns syserror.ErrWouldBlock.
+func (s *syslog) Record(seq uint64) (SyslogRecord, uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.initLocked()
+
+	if first := s.firstSeqLocked(); seq < first {
+		return SyslogRecord{}, first, syserror.EPIPE
+	}
+	if seq >= s.nextSeq {
+		return SyslogRecord{}, seq, syserror.ErrWouldBlock
+	}
+	return s.records[seq-s.firstSeqLocked()], seq, nil
+}
+
+// FirstSeq returns the sequence number of the oldest retained record.
+func (s *syslog) FirstSeq() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.initLocked()
+	return s.firstSeqLocked()
+}
+
+// NextSeq returns the sequence number that will be assigned to the next
+// record.
+func (s *syslog) NextSeq() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.initLocked()
+	return s.nextSeq
+}
+
+// ClearSeq returns the sequence number of the first record not cleared by
+// Clear.
+func (s *syslog) ClearSeq() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.initLocked()
+	if first := s.firstSeqLocked(); s.clearSeq < first {
+		return first
+	}
+	return s.clearSeq
+}
+
+// Readable returns true if a record with sequence number at least seq
+// exists.
+func (s *syslog) Readable(seq uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.initLocked()
+	return seq < s.nextSeq
+}
+
+// EventRegister registers e for notification when records are appended.
+func (s *syslog) EventRegister(e *waiter.Entry, mask waiter.EventMask) {
+	s.queue.EventRegister(e, mask)
+}
+
+// EventUnregister unregisters e.
+func (s *syslog) EventUnregister(e *waiter.Entry) {
+	s.queue.EventUnregister(e)
+}
 
-	// Return a copy.
-	o := make([]byte, len(s.msg))
-	copy(o, s.msg)
-	return o
+// Printk adds a message to the kernel log, timestamped with the current
+// monotonic time.
+func (k *Kernel) Printk(priority int, format string, v ...interface{}) {
+	k.syslog.Append(k.MonotonicClock().Now().Nanoseconds(), priority, fmt.Sprintf(format, v...))
 }
@@ -0,0 +1,68 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"strings"
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+func TestSyslogRecords(t *testing.T) {
+	var s syslog
+	next := s.NextSeq()
+	s.Append(1e9, SyslogLevelWarning, "hello")
+
+	r, _, err := s.Record(next)
+	if err != nil {
+		t.Fatalf("Record(%d) failed: %v", next, err)
+	}
+	if got := r.KmsgString(); !strings.HasPrefix(got, "4,") || !strings.HasSuffix(got, ";hello\n") {
+		t.Errorf("KmsgString got %q", got)
+	}
+	if _, _, err := s.Record(next + 1); err != syserror.ErrWouldBlock {
+		t.Errorf("Record(%d) got %v want %v", next+1, err, syserror.ErrWouldBlock)
+	}
+	if !strings.Contains(string(s.Log()), "hello") {
+		t.Errorf("Log() missing appended message")
+	}
+
+	s.Clear()
+	if log := s.Log(); len(log) != 0 {
+		t.Errorf("Log() after Clear got %q want empty", log)
+	}
+
+	s.AppendOnce("key", 0, SyslogLevelWarning, "once")
+	s.AppendOnce("key", 0, SyslogLevelWarning, "once")
+	if got := strings.Count(string(s.Log()), "once"); got != 1 {
+		t.Errorf("AppendOnce logged %d messages want 1", got)
+	}
+}
+
+func TestSyslogOverflow(t *testing.T) {
+	var s syslog
+	msg := strings.Repeat("x", 1024)
+	for i := 0; i < 2*SyslogBufferSize/len(msg); i++ {
+		s.Append(0, SyslogLevelInfo, msg)
+	}
+	first := s.FirstSeq()
+	if first == 0 {
+		t.Fatalf("FirstSeq() got 0, want records to be discarded")
+	}
+	if _, seq, err := s.Record(0); err != syserror.EPIPE || seq != first {
+		t.Errorf("Record(0) got (%d, %v) want (%d, %v)", seq, err, first, syserror.EPIPE)
+	}
+}
@@ -93,6 +93,15 @@ type Task struct {
 	// owned by the task goroutine.
 	yieldCount uint64
 
+	// minorFaults and majorFaults are the number of application page faults
+	// handled by the task goroutine that did not and did, respectively,
+	// require reading from a file.
+	//
+	// minorFaults and majorFaults are accessed using atomic memory
+	// operations, and are owned by the task goroutine.
+	minorFaults uint64
+	majorFaults uint64
+
 	// pendingSignals is the set of pending signals that may be handled only by
 	// this task.
 	//
@@ -450,6 +459,20 @@ type Task struct {
 	// niceness is protected by mu.
 	niceness int
 
+	// ioPriority is the I/O priority set by ioprio_set(2), encoded as in
+	// Linux. We do not actually prioritize I/O; this is only reported back
+	// by ioprio_get(2).
+	//
+	// ioPriority is protected by mu.
+	ioPriority int32
+
+	// personality is the execution domain and flags set by personality(2),
+	// encoded as in Linux. Only ADDR_NO_RANDOMIZE has any effect, on
+	// subsequent execve(2)s.
+	//
+	// personality is protected by mu.
+	personality uint32
+
 	// This is used to track the numa policy for the current thread. This can be
 	// modified through a set_mempolicy(2) syscall. Since we always report a
 	// single numa node, all policies are no-ops. We only track this information
@@ -546,6 +569,7 @@ func (t *Task) afterLoad() {
 	}
 	t.endStopCond.L = &t.tg.signalHandlers.mu
 	t.p = t.k.Platform.NewContext()
+	t.updatePlatformCPUMaskLocked()
 	t.rseqPreempted = true
 	t.futexWaiter = futex.NewWaiter()
 }
@@ -621,6 +645,8 @@ func (t *Task) Value(key interface{}) interface{} {
 		return t.k.GenerateInotifyCookie()
 	case unimpl.CtxEvents:
 		return t.k
+	case usage.CtxIO:
+		return t.ioUsage
 	default:
 		return nil
 	}
@@ -719,3 +745,17 @@ func (t *Task) AbstractSockets() *AbstractSocketNamespace {
 func (t *Task) ContainerID() string {
 	return t.containerID
 }
+
+// Personality returns t's personality.
+func (t *Task) Personality() uint32 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.personality
+}
+
+// SetPersonality sets t's personality to p.
+func (t *Task) SetPersonality(p uint32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.personality = p
+}
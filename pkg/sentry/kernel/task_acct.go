@@ -132,6 +132,14 @@ func (tg *ThreadGroup) IOUsage() *usage.IO {
 	return &io
 }
 
+// JoinedChildIOUsage returns the io usage of all children of tg that have
+// terminated and been waited for, as for JoinedChildCPUStats.
+func (tg *ThreadGroup) JoinedChildIOUsage() *usage.IO {
+	var io usage.IO
+	io.Accumulate(tg.childIOUsage)
+	return &io
+}
+
 // Name returns t's name.
 func (t *Task) Name() string {
 	t.mu.Lock()
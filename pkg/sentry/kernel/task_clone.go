@@ -243,6 +243,7 @@ func (t *Task) Clone(opts *CloneOptions) (ThreadID, *SyscallControl, error) {
 			sh = sh.Fork()
 		}
 		tg = t.k.newThreadGroup(pidns, sh, opts.TerminationSignal, tg.limits.GetCopy(), t.k.monotonicClock)
+		tg.forkedNoExec = true
 	}
 
 	cfg := &TaskConfig{
@@ -254,6 +255,8 @@ func (t *Task) Clone(opts *CloneOptions) (ThreadID, *SyscallControl, error) {
 		FDMap:                   fds,
 		Credentials:             creds,
 		Niceness:                t.Niceness(),
+		IOPriority:              t.IOPriority(),
+		Personality:             t.Personality(),
 		NetworkNamespaced:       t.netns,
 		AllowedCPUMask:          t.CPUMask(),
 		UTSNamespace:            utsns,
@@ -135,6 +135,7 @@ func (r *runSyscallAfterExecStop) execute(t *Task) taskRunState {
 		r.tc.release()
 		return (*runInterrupt)(nil)
 	}
+	t.tg.forkedNoExec = false
 	// We are the thread group leader now. Save our old thread ID for
 	// PTRACE_EVENT_EXEC. This is racy in that if a tracer attaches after this
 	// point it will get a PID of 0, but this is consistent with Linux.
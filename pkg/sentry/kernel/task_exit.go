@@ -238,6 +238,22 @@ type runExitMain struct{}
 func (*runExitMain) execute(t *Task) taskRunState {
 	lastExiter := t.exitThreadGroup()
 
+	// Write the thread group's process accounting record while its MM is
+	// still available.
+	if lastExiter {
+		t.acctProcess()
+
+		// Undo the thread group's SEM_UNDO semaphore adjustments.
+		t.tg.semUndo.Release(int32(t.k.tasks.Root.IDOfThreadGroup(t.tg)))
+
+		// A session whose leader exits loses its controlling terminal.
+		t.tg.releaseControllingTerminal()
+	}
+
+	// Stop timers driven by the task's CPU clocks before the task's exit
+	// becomes observable through its cleartid.
+	t.disarmCPUClockIntervalTimers()
+
 	// If the task has a cleartid, and the thread group wasn't killed by a
 	// signal, handle that before releasing the MM.
 	if t.cleartid != 0 {
@@ -376,6 +392,17 @@ func (t *Task) findReparentTargetLocked() *Task {
 	if t2 := t.tg.anyNonExitingTaskLocked(); t2 != nil {
 		return t2
 	}
+
+	// Reparent to the closest ancestor in the same PID namespace that is a
+	// child subreaper, if any. See Linux's kernel/exit.c:find_new_reaper().
+	for reaper := t.parent; reaper != nil && reaper.tg.pidns == t.tg.pidns; reaper = reaper.parent {
+		if !reaper.tg.childSubreaper {
+			continue
+		}
+		if t2 := reaper.tg.anyNonExitingTaskLocked(); t2 != nil {
+			return t2
+		}
+	}
 	// "A child process that is orphaned within the namespace will be
 	// reparented to [the init process for the namespace] ..." -
 	// pid_namespaces(7)
@@ -1006,6 +1033,9 @@ func (t *Task) waitCollectZombieLocked(target *Task, opts *WaitOptions, asPtrace
 			t.tg.childCPUStats.Accumulate(target.CPUStats())
 			t.tg.childCPUStats.Accumulate(target.tg.exitedCPUStats)
 			t.tg.childCPUStats.Accumulate(target.tg.childCPUStats)
+			t.tg.childIOUsage.Accumulate(target.ioUsage)
+			t.tg.childIOUsage.Accumulate(target.tg.ioUsage)
+			t.tg.childIOUsage.Accumulate(target.tg.childIOUsage)
 			// Update t's child max resident set size. The size will be the maximum
 			// of this thread's size and all its childrens' sizes.
 			if t.tg.childMaxRSS < target.tg.maxRSS {
@@ -253,15 +253,24 @@ func (*runApp) execute(t *Task) taskRunState {
 		// normally.
 		if at.Any() {
 			addr := usermem.Addr(info.Addr())
+			bytesRead := atomic.LoadUint64(&t.ioUsage.BytesRead)
 			err := t.MemoryManager().HandleUserFault(t, addr, at, usermem.Addr(t.Arch().Stack()))
 			if err == nil {
+				// Faults that had to read file data into the page
+				// cache are major faults.
+				if atomic.LoadUint64(&t.ioUsage.BytesRead) != bytesRead {
+					atomic.AddUint64(&t.majorFaults, 1)
+				} else {
+					atomic.AddUint64(&t.minorFaults, 1)
+				}
+
 				// The fault was handled appropriately.
 				// We can resume running the application.
 				return (*runApp)(nil)
 			}
 
 			// Is this a vsyscall that we need emulate?
-			if at.Execute {
+			if at.Execute && t.MemoryManager().VsyscallEnabled() {
 				if sysno, ok := t.tc.st.LookupEmulate(addr); ok {
 					return t.doVsyscall(addr, sysno)
 				}
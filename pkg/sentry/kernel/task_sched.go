@@ -27,6 +27,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/sched"
 	ktime "gvisor.googlesource.com/gvisor/pkg/sentry/kernel/time"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/limits"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
 )
@@ -164,6 +165,8 @@ func (t *Task) cpuStatsAt(now uint64) usage.CPUStats {
 		UserTime:          time.Duration(tsched.userTicksAt(now) * uint64(linux.ClockTick)),
 		SysTime:           time.Duration(tsched.sysTicksAt(now) * uint64(linux.ClockTick)),
 		VoluntarySwitches: atomic.LoadUint64(&t.yieldCount),
+		MinorFaults:       atomic.LoadUint64(&t.minorFaults),
+		MajorFaults:       atomic.LoadUint64(&t.majorFaults),
 	}
 }
 
@@ -426,6 +429,9 @@ func (ticker *kernelCPUClockTicker) Notify(exp uint64) {
 		tgs[i] = nil
 	}
 	ticker.tgs = tgs[:0]
+
+	ticker.k.checkMemoryPressure(now)
+	ticker.k.checkHostMappings(now)
 }
 
 // Destroy implements ktime.TimerListener.Destroy.
@@ -573,9 +579,24 @@ func (t *Task) SetCPUMask(mask sched.CPUSet) error {
 	defer t.mu.Unlock()
 	t.allowedCPUMask = mask
 	atomic.StoreInt32(&t.cpu, assignCPU(mask, rootTID))
+	t.updatePlatformCPUMaskLocked()
 	return nil
 }
 
+// updatePlatformCPUMaskLocked informs t's platform.Context of t's CPU mask, if
+// the platform supports pinning to host CPUs.
+//
+// Preconditions: t.mu must be locked, or t must not yet be visible to other
+// tasks.
+func (t *Task) updatePlatformCPUMaskLocked() {
+	if t.k.useHostCores {
+		return
+	}
+	if p, ok := t.p.(platform.HostCPUPinningContext); ok {
+		p.SetCPUMask(t.allowedCPUMask)
+	}
+}
+
 // CPU returns the cpu id for a given task.
 func (t *Task) CPU() int32 {
 	if t.k.useHostCores {
@@ -621,6 +642,20 @@ func (t *Task) SetNiceness(n int) {
 	t.niceness = n
 }
 
+// IOPriority returns t's I/O priority.
+func (t *Task) IOPriority() int32 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.ioPriority
+}
+
+// SetIOPriority sets t's I/O priority to p.
+func (t *Task) SetIOPriority(p int32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ioPriority = p
+}
+
 // NumaPolicy returns t's current numa policy.
 func (t *Task) NumaPolicy() (policy int32, nodeMask uint32) {
 	t.mu.Lock()
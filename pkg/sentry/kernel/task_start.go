@@ -62,6 +62,12 @@ type TaskConfig struct {
 	// Niceness is the niceness of the new task.
 	Niceness int
 
+	// IOPriority is the I/O priority of the new task.
+	IOPriority int32
+
+	// Personality is the personality of the new task.
+	Personality uint32
+
 	// If NetworkNamespaced is true, the new task should observe a non-root
 	// network namespace.
 	NetworkNamespaced bool
@@ -121,6 +127,8 @@ func (ts *TaskSet) newTask(cfg *TaskConfig) (*Task, error) {
 		ioUsage:         &usage.IO{},
 		creds:           cfg.Credentials,
 		niceness:        cfg.Niceness,
+		ioPriority:      cfg.IOPriority,
+		personality:     cfg.Personality,
 		netns:           cfg.NetworkNamespaced,
 		utsns:           cfg.UTSNamespace,
 		ipcns:           cfg.IPCNamespace,
@@ -131,6 +139,7 @@ func (ts *TaskSet) newTask(cfg *TaskConfig) (*Task, error) {
 	}
 	t.endStopCond.L = &t.tg.signalHandlers.mu
 	t.ptraceTracer.Store((*Task)(nil))
+	t.updatePlatformCPUMaskLocked()
 	// We don't construct t.blockingTimer until Task.run(); see that function
 	// for justification.
 
@@ -205,7 +214,7 @@ func (ts *TaskSet) assignTIDsLocked(t *Task) error {
 	}
 	var allocatedTIDs []allocatedTID
 	for ns := t.tg.pidns; ns != nil; ns = ns.parent {
-		tid, err := ns.allocateTID()
+		tid, err := ns.allocateTID(t.k.pidMax())
 		if err != nil {
 			// Failure. Remove the tids we already allocated in descendant
 			// namespaces.
@@ -229,10 +238,11 @@ func (ts *TaskSet) assignTIDsLocked(t *Task) error {
 	return nil
 }
 
-// allocateTID returns an unused ThreadID from ns.
+// allocateTID returns an unused ThreadID from ns that is no greater than
+// pidMax.
 //
 // Preconditions: ns.owner.mu must be locked for writing.
-func (ns *PIDNamespace) allocateTID() (ThreadID, error) {
+func (ns *PIDNamespace) allocateTID(pidMax ThreadID) (ThreadID, error) {
 	if ns.exiting {
 		// "In this case, a subsequent fork(2) into this PID namespace will
 		// fail with the error ENOMEM; it is not possible to create a new
@@ -241,10 +251,16 @@ func (ns *PIDNamespace) allocateTID() (ThreadID, error) {
 		return 0, syserror.ENOMEM
 	}
 	tid := ns.last
+	if tid > pidMax {
+		// pid_max was lowered since the last allocation; restart the
+		// search from the bottom of the range.
+		tid = pidMax
+	}
+	start := tid
 	for {
 		// Next.
 		tid++
-		if tid > TasksLimit {
+		if tid > pidMax {
 			tid = InitTID + 1
 		}
 
@@ -256,7 +272,7 @@ func (ns *PIDNamespace) allocateTID() (ThreadID, error) {
 		}
 
 		// Did we do a full cycle?
-		if tid == ns.last {
+		if tid == start {
 			// No tid available.
 			return 0, syserror.EAGAIN
 		}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"os"
 	"syscall"
+	"time"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/bits"
@@ -63,6 +64,66 @@ const (
 
 var vsyscallCount = metric.MustCreateNewUint64Metric("/kernel/vsyscall_count", false /* sync */, "Number of times vsyscalls were invoked by the application")
 
+// maxSyscallMetric is the number of syscall numbers for which syscall metrics
+// are recorded. Syscalls with larger numbers are not recorded.
+const maxSyscallMetric = 512
+
+var (
+	syscallCount   = metric.MustCreateNewUint64FieldMetric("/kernel/syscalls", false /* sync */, "Number of times each syscall was invoked by the application", "sysno", maxSyscallMetric)
+	syscallLatency = metric.MustCreateNewDistributionMetric("/kernel/syscall_latency", false /* sync */, "Time spent executing each syscall, including time blocked, in nanoseconds", metric.ExponentialBounds(256, 22), "sysno", maxSyscallMetric)
+)
+
+// EnableSyscallMetrics enables recording of the count and latency of all
+// syscalls, in the /kernel/syscalls and /kernel/syscall_latency metrics.
+// They are not recorded by default, since doing so slows down every syscall.
+func EnableSyscallMetrics() {
+	for _, table := range SyscallTables() {
+		table.FeatureEnable.EnableAll(SyscallMetricsEnable)
+	}
+}
+
+// SyscallStat contains statistics about the invocations of a syscall.
+type SyscallStat struct {
+	// Count is the number of invocations.
+	Count uint64
+
+	// LatencyCounts are the number of invocations in each latency bucket of
+	// SyscallLatencyBounds, with a final bucket for larger latencies.
+	LatencyCounts []uint64
+
+	// TotalLatency is the sum of the latency of all invocations.
+	TotalLatency time.Duration
+}
+
+// SyscallLatencyBounds returns the exclusive upper bounds of the latency
+// buckets of SyscallStat.LatencyCounts.
+func SyscallLatencyBounds() []time.Duration {
+	var bounds []time.Duration
+	for _, b := range syscallLatency.Bounds() {
+		bounds = append(bounds, time.Duration(b))
+	}
+	return bounds
+}
+
+// SyscallStats returns the statistics of all syscalls invoked at least once
+// while syscall metrics were enabled, by syscall number.
+func SyscallStats() map[uintptr]SyscallStat {
+	stats := make(map[uintptr]SyscallStat)
+	for sysno := 0; sysno < maxSyscallMetric; sysno++ {
+		count := syscallCount.Value(sysno)
+		if count == 0 {
+			continue
+		}
+		counts, sum := syscallLatency.Value(sysno)
+		stats[uintptr(sysno)] = SyscallStat{
+			Count:         count,
+			LatencyCounts: counts,
+			TotalLatency:  time.Duration(sum),
+		}
+	}
+	return stats
+}
+
 // Error implements error.Error.
 func (e SyscallRestartErrno) Error() string {
 	// Descriptions are borrowed from strace.
@@ -159,6 +220,11 @@ func (t *Task) executeSyscall(sysno uintptr, args arch.SyscallArguments) (rval u
 		// Ensure we check for stops, then invoke the syscall again.
 		ctrl = ctrlStopAndReinvokeSyscall
 	} else {
+		metrics := bits.IsOn32(fe, SyscallMetricsEnable) && sysno < maxSyscallMetric
+		var start time.Time
+		if metrics {
+			start = time.Now()
+		}
 		fn := s.Lookup(sysno)
 		if fn != nil {
 			// Call our syscall implementation.
@@ -167,6 +233,10 @@ func (t *Task) executeSyscall(sysno uintptr, args arch.SyscallArguments) (rval u
 			// Use the missing function if not found.
 			rval, err = t.SyscallTable().Missing(t, sysno, args)
 		}
+		if metrics {
+			syscallCount.Increment(int(sysno))
+			syscallLatency.AddSample(int(sysno), int64(time.Since(start)))
+		}
 	}
 
 	if bits.IsOn32(fe, ExternalAfterEnable) && (s.ExternalFilterAfter == nil || s.ExternalFilterAfter(t, sysno, args)) {
@@ -19,6 +19,7 @@ import (
 	"sync/atomic"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/semaphore"
 	ktime "gvisor.googlesource.com/gvisor/pkg/sentry/kernel/time"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/limits"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
@@ -202,6 +203,10 @@ type ThreadGroup struct {
 	// The ioUsage pointer is immutable.
 	ioUsage *usage.IO
 
+	// childIOUsage is the I/O usage of all joined descendants of this thread
+	// group. The childIOUsage pointer is immutable.
+	childIOUsage *usage.IO
+
 	// maxRSS is the historical maximum resident set size of the thread group, updated when:
 	//
 	// - A task in the thread group exits, since after all tasks have
@@ -236,6 +241,12 @@ type ThreadGroup struct {
 
 	// rscr is the thread group's RSEQ critical region.
 	rscr atomic.Value `state:".(*RSEQCriticalRegion)"`
+
+	// semUndo records the thread group's SEM_UNDO semaphore adjustments,
+	// which are undone when the thread group exits. Unlike Linux, where the
+	// list is shared only between tasks created with CLONE_SYSVSEM, all
+	// tasks in a thread group share it. semUndo is immutable.
+	semUndo *semaphore.UndoList
 }
 
 // newThreadGroup returns a new, empty thread group in PID namespace ns. The
@@ -250,11 +261,13 @@ func (k *Kernel) newThreadGroup(ns *PIDNamespace, sh *SignalHandlers, terminatio
 		signalHandlers:    sh,
 		terminationSignal: terminationSignal,
 		ioUsage:           &usage.IO{},
+		childIOUsage:      &usage.IO{},
 		limits:            limits,
 	}
 	tg.itimerRealTimer = ktime.NewTimer(k.monotonicClock, &itimerRealListener{tg: tg})
 	tg.timers = make(map[linux.TimerID]*IntervalTimer)
 	tg.rscr.Store(&RSEQCriticalRegion{})
+	tg.semUndo = semaphore.NewUndoList()
 	return tg
 }
 
@@ -268,6 +281,11 @@ func (tg *ThreadGroup) loadRscr(rscr *RSEQCriticalRegion) {
 	tg.rscr.Store(rscr)
 }
 
+// SemUndoList returns the list of tg's SEM_UNDO semaphore adjustments.
+func (tg *ThreadGroup) SemUndoList() *semaphore.UndoList {
+	return tg.semUndo
+}
+
 // SignalHandlers returns the signal handlers used by tg.
 //
 // Preconditions: The caller must provide the synchronization required to read
@@ -276,6 +294,13 @@ func (tg *ThreadGroup) SignalHandlers() *SignalHandlers {
 	return tg.signalHandlers
 }
 
+// SignalHandlers returns the signal handlers used by t's thread group.
+func (t *Task) SignalHandlers() *SignalHandlers {
+	t.tg.pidns.owner.mu.RLock()
+	defer t.tg.pidns.owner.mu.RUnlock()
+	return t.tg.signalHandlers
+}
+
 // Limits returns tg's limits.
 func (tg *ThreadGroup) Limits() *limits.LimitSet {
 	return tg.limits
@@ -328,3 +353,18 @@ func (l *itimerRealListener) Notify(exp uint64) {
 // Destroy implements ktime.TimerListener.Destroy.
 func (l *itimerRealListener) Destroy() {
 }
+
+// SetChildSubreaper sets whether tg is a child subreaper, to which orphaned
+// descendants are reparented.
+func (tg *ThreadGroup) SetChildSubreaper(isSubreaper bool) {
+	tg.pidns.owner.mu.Lock()
+	defer tg.pidns.owner.mu.Unlock()
+	tg.childSubreaper = isSubreaper
+}
+
+// IsChildSubreaper returns true if tg is a child subreaper.
+func (tg *ThreadGroup) IsChildSubreaper() bool {
+	tg.pidns.owner.mu.RLock()
+	defer tg.pidns.owner.mu.RUnlock()
+	return tg.childSubreaper
+}
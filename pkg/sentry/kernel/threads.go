@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"sync"
 
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.googlesource.com/gvisor/pkg/waiter"
 )
@@ -169,6 +170,16 @@ type PIDNamespace struct {
 	// exiting indicates that the namespace's init process is exiting or has
 	// exited.
 	exiting bool
+
+	// acctMu serializes process accounting records written to acctFile.
+	acctMu sync.Mutex `state:"nosave"`
+
+	// acctFile is the file that process accounting records for processes in
+	// this namespace are written to, as set by acct(2), or nil if process
+	// accounting is disabled.
+	//
+	// acctFile is protected by acctMu.
+	acctFile *fs.File
 }
 
 func newPIDNamespace(ts *TaskSet, parent *PIDNamespace, userns *auth.UserNamespace) *PIDNamespace {
@@ -317,6 +328,20 @@ type threadGroupNode struct {
 	// execing is protected by the TaskSet mutex.
 	execing *Task
 
+	// forkedNoExec is true if the thread group was created by fork() or
+	// clone() and has not since called execve(). It is reported by process
+	// accounting.
+	//
+	// forkedNoExec is protected by the TaskSet mutex.
+	forkedNoExec bool
+
+	// If childSubreaper is true, orphaned descendants of the thread group are
+	// reparented to it rather than to the init process of its PID namespace,
+	// as set by prctl(PR_SET_CHILD_SUBREAPER).
+	//
+	// childSubreaper is protected by the TaskSet mutex.
+	childSubreaper bool
+
 	// tasks is all tasks in the thread group that have not yet been reaped.
 	//
 	// tasks is protected by both the TaskSet mutex and the signal mutex:
@@ -222,7 +222,7 @@ type Clock interface {
 	//
 	// WallTimeUntil is used to determine when associated Timers should next
 	// check for expirations. Returning too small a value may result in
-	// spurious Timer goroutine wakeups, while returning too large a value may
+	// spurious Timer ticks, while returning too large a value may
 	// result in late expirations. Implementations should usually err on the
 	// side of underestimating.
 	WallTimeUntil(t, now Time) time.Duration
@@ -418,26 +418,34 @@ type Timer struct {
 	// paused is true if the Timer is paused. paused is protected by mu.
 	paused bool
 
-	// kicker is used to wake the Timer goroutine. The kicker pointer is
-	// immutable, but its state is protected by mu.
-	kicker *time.Timer `state:"nosave"`
+	// wheel is the timer wheel that ticks the Timer when it expires. wheel
+	// is immutable after the Timer is initialized.
+	wheel *timerWheel `state:"nosave"`
+
+	// wheelEntry is the Timer's entry in wheel. wheelEntry is protected by
+	// wheel.mu.
+	wheelEntry wheelEntry `state:"nosave"`
 
 	// entry is registered with clock.EventRegister. entry is immutable.
 	//
 	// Per comment in Clock, entry must be re-registered after restore; per
 	// comment in Timer.Load, this is done in Timer.Resume.
 	entry waiter.Entry `state:"nosave"`
-
-	// events is the channel that will be notified whenever entry receives an
-	// event. It is also closed by Timer.Destroy to instruct the Timer
-	// goroutine to exit.
-	events chan struct{} `state:"nosave"`
 }
 
-// timerTickEvents are Clock events that require the Timer goroutine to Tick
-// prematurely.
+// timerTickEvents are Clock events that require the Timer to Tick prematurely.
 const timerTickEvents = ClockEventSet | ClockEventRateIncrease
 
+// timerClockCallback schedules a Timer to Tick immediately when its Clock
+// generates timerTickEvents.
+type timerClockCallback struct{}
+
+// Callback implements waiter.EntryCallback.Callback.
+func (*timerClockCallback) Callback(e *waiter.Entry) {
+	t := e.Context.(*Timer)
+	t.wheel.add(&t.wheelEntry, 0)
+}
+
 // NewTimer returns a new Timer that will obtain time from clock and send
 // expirations to listener. The Timer is initially stopped and has no first
 // expiration or period configured.
@@ -475,47 +483,32 @@ func After(clock Clock, duration time.Duration) (*Timer, Time, <-chan struct{})
 // Preconditions: t.mu must be locked, or the caller must have exclusive access
 // to t.
 func (t *Timer) init() {
-	if t.kicker != nil {
+	if t.wheel != nil {
 		return
 	}
-	// If t.kicker is nil, the Timer goroutine can't be running, so we can't
-	// race with it.
-	t.kicker = time.NewTimer(0)
-	t.entry, t.events = waiter.NewChannelEntry(nil)
+	// If t.wheel is nil, t can't be in a timer wheel, so we can't race with
+	// it.
+	t.wheel = getWheel()
+	t.wheelEntry.timer = t
+	t.entry = waiter.Entry{Context: t, Callback: &timerClockCallback{}}
 	t.clock.EventRegister(&t.entry, timerTickEvents)
-	go t.runGoroutine() // S/R-SAFE: synchronized by t.mu
+	t.wheel.add(&t.wheelEntry, 0)
 }
 
 // Destroy releases resources owned by the Timer. A Destroyed Timer must not be
 // used again; in particular, a Destroyed Timer should not be Saved.
 func (t *Timer) Destroy() {
-	// Stop the Timer, ensuring that the Timer goroutine will not call
-	// t.kicker.Reset, before calling t.kicker.Stop.
+	// Stop the Timer, ensuring that Tick will not add it to t.wheel.
 	t.mu.Lock()
 	t.setting.Enabled = false
 	t.mu.Unlock()
-	t.kicker.Stop()
-	// Unregister t.entry, ensuring that the Clock will not send to t.events,
-	// before closing t.events to instruct the Timer goroutine to exit.
+	// Unregister t.entry, ensuring that the Clock will not add t to t.wheel,
+	// before removing t from t.wheel.
 	t.clock.EventUnregister(&t.entry)
-	close(t.events)
+	t.wheel.remove(&t.wheelEntry)
 	t.listener.Destroy()
 }
 
-func (t *Timer) runGoroutine() {
-	for {
-		select {
-		case <-t.kicker.C:
-		case _, ok := <-t.events:
-			if !ok {
-				// Channel closed by Destroy.
-				return
-			}
-		}
-		t.Tick()
-	}
-}
-
 // Tick requests that the Timer immediately check for expirations and
 // re-evaluate when it should next check for expirations.
 func (t *Timer) Tick() {
@@ -530,7 +523,7 @@ func (t *Timer) Tick() {
 	if exp > 0 {
 		t.listener.Notify(exp)
 	}
-	t.resetKickerLocked(now)
+	t.scheduleLocked(now)
 }
 
 // Pause pauses the Timer, ensuring that it does not generate any further
@@ -540,9 +533,9 @@ func (t *Timer) Pause() {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	t.paused = true
-	// t.kicker may be nil if we were restored but never resumed.
-	if t.kicker != nil {
-		t.kicker.Stop()
+	// t.wheel may be nil if we were restored but never resumed.
+	if t.wheel != nil {
+		t.wheel.remove(&t.wheelEntry)
 	}
 }
 
@@ -559,13 +552,13 @@ func (t *Timer) Resume() {
 	// Lazily initialize the Timer. We can't call Timer.init until Timer.Resume
 	// because save/restore will restore Timers before
 	// kernel.Timekeeper.SetClocks() has been called, so if t.clock is backed
-	// by a kernel.Timekeeper then the Timer goroutine will panic if it calls
-	// t.clock.Now().
+	// by a kernel.Timekeeper then the timer wheel will panic if it ticks t,
+	// since Tick calls t.clock.Now().
 	t.init()
 
-	// Kick the Timer goroutine in case it was already initialized, but the
-	// Timer goroutine was sleeping.
-	t.kicker.Reset(0)
+	// Tick the Timer in case it was already initialized, and was therefore
+	// removed from t.wheel by Pause.
+	t.wheel.add(&t.wheelEntry, 0)
 }
 
 // Get returns a snapshot of the Timer's current Setting and the time
@@ -585,7 +578,7 @@ func (t *Timer) Get() (Time, Setting) {
 	if exp > 0 {
 		t.listener.Notify(exp)
 	}
-	t.resetKickerLocked(now)
+	t.scheduleLocked(now)
 	return now, s
 }
 
@@ -625,7 +618,7 @@ func (t *Timer) SwapAnd(s Setting, f func()) (Time, Setting) {
 	if newExp > 0 {
 		t.listener.Notify(newExp)
 	}
-	t.resetKickerLocked(now)
+	t.scheduleLocked(now)
 	return now, oldS
 }
 
@@ -640,18 +633,19 @@ func (t *Timer) Atomically(f func()) {
 	f()
 }
 
+// scheduleLocked schedules t to Tick when its next expiration is due.
+//
 // Preconditions: t.mu must be locked.
-func (t *Timer) resetKickerLocked(now Time) {
+func (t *Timer) scheduleLocked(now Time) {
 	if t.setting.Enabled {
 		// Clock.WallTimeUntil may return a negative value. This is fine;
-		// time.when treats negative Durations as 0.
-		t.kicker.Reset(t.clock.WallTimeUntil(t.setting.Next, now))
+		// timerWheel.add treats non-positive Durations as 0.
+		t.wheel.add(&t.wheelEntry, t.clock.WallTimeUntil(t.setting.Next, now))
+	} else {
+		// Removing t from t.wheel is cheap, and prevents the timer wheel
+		// from ticking t needlessly.
+		t.wheel.remove(&t.wheelEntry)
 	}
-	// We don't call t.kicker.Stop if !t.setting.Enabled because in most cases
-	// resetKickerLocked will be called from the Timer goroutine itself, in
-	// which case t.kicker has already fired and t.kicker.Stop will be an
-	// expensive no-op (time.Timer.Stop => time.stopTimer => runtime.stopTimer
-	// => runtime.deltimer).
 }
 
 // Clock returns the Clock used by t.
@@ -0,0 +1,318 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package time
+
+import (
+	"math"
+	"math/bits"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// wheelTickShift is log2 of the duration of a timer wheel tick in
+	// nanoseconds. Timers are ticked at the end of the wheel tick in which
+	// they expire, so this bounds the latency added by the timer wheel;
+	// 2^15 ns is slightly less than Linux's default timer slack of 50
+	// microseconds.
+	wheelTickShift = 15
+
+	// wheelLevelShift is log2 of the number of slots in each level of a
+	// timer wheel.
+	wheelLevelShift = 6
+
+	// wheelLevelSlots is the number of slots in each level of a timer wheel.
+	wheelLevelSlots = 1 << wheelLevelShift
+
+	// wheelLevels is the number of levels in a timer wheel, which is
+	// enough to represent any 64-bit tick.
+	wheelLevels = (64 + wheelLevelShift - 1) / wheelLevelShift
+)
+
+// wheelEpoch is the origin of timer wheel ticks.
+var wheelEpoch = time.Now()
+
+// wheelNow returns the current timer wheel tick, rounded down.
+func wheelNow() uint64 {
+	return uint64(time.Since(wheelEpoch)) >> wheelTickShift
+}
+
+// wheelAfter returns the timer wheel tick at which d will have elapsed,
+// rounded up.
+func wheelAfter(d time.Duration) uint64 {
+	ns := time.Since(wheelEpoch)
+	if d > math.MaxInt64-ns {
+		return math.MaxUint64
+	}
+	return (uint64(ns+d) + (1 << wheelTickShift) - 1) >> wheelTickShift
+}
+
+// wheelEntry is a Timer's entry in a timerWheel.
+type wheelEntry struct {
+	wheelEntryEntry
+
+	// timer is the Timer to tick when the entry expires. timer is
+	// immutable.
+	timer *Timer
+
+	// The following fields are protected by the timerWheel's mutex.
+
+	// when is the tick at which the entry expires.
+	when uint64
+
+	// list is the list containing the entry, or nil if the entry is not in
+	// the timerWheel.
+	list *wheelEntryList
+
+	// level and slot locate list in timerWheel.slots. level is -1 if list
+	// is timerWheel.expired.
+	level int
+	slot  int
+}
+
+// timerWheel is a hierarchical timing wheel that ticks Timers when they
+// expire. All Timers in a timerWheel are ticked by a single goroutine, which
+// sleeps until the wheel's earliest expiration. This avoids the overhead of a
+// goroutine and a runtime timer for every Timer, and batches expirations that
+// occur at the same time.
+//
+// Level k of the wheel holds entries that expire within the current level k+1
+// slot, but not within the current level k slot. Entries are thus cascaded to
+// lower levels as time advances, and each entry is cascaded at most
+// wheelLevels times.
+type timerWheel struct {
+	// mu protects the following fields, and all wheelEntry fields that are
+	// not immutable.
+	mu sync.Mutex
+
+	// now is the tick at which the wheel was last advanced. All entries in
+	// slots expire after now.
+	now uint64
+
+	// slots holds entries that haven't yet expired. An entry with
+	// expiration tick when is in level k = (bits.Len64(when^now)-1) /
+	// wheelLevelShift, at slot (when >> (k*wheelLevelShift)) %
+	// wheelLevelSlots.
+	slots [wheelLevels][wheelLevelSlots]wheelEntryList
+
+	// occupied has bit i of element k set if slots[k][i] is non-empty.
+	occupied [wheelLevels]uint64
+
+	// expired holds entries that have expired, but whose Timers haven't
+	// yet been ticked.
+	expired wheelEntryList
+
+	// wakeTick is the tick at which the wheel goroutine will wake if it is
+	// sleeping, math.MaxUint64 if it is sleeping indefinitely, and 0 if it
+	// is not sleeping.
+	wakeTick uint64
+
+	// kicker wakes the wheel goroutine. Its state is protected by mu.
+	kicker *time.Timer
+}
+
+var (
+	// wheels are the timerWheels used by Timers. Timers are spread across
+	// multiple timerWheels to reduce contention on their mutexes.
+	wheels     []*timerWheel
+	wheelsOnce sync.Once
+
+	// nextWheel is the index into wheels of the timerWheel that will be
+	// used by the next Timer, and is accessed using atomic memory
+	// operations.
+	nextWheel uint32
+)
+
+// getWheel returns the timerWheel to be used by a new Timer.
+func getWheel() *timerWheel {
+	wheelsOnce.Do(func() {
+		wheels = make([]*timerWheel, runtime.GOMAXPROCS(0))
+		for i := range wheels {
+			w := &timerWheel{
+				now:    wheelNow(),
+				kicker: time.NewTimer(time.Duration(math.MaxInt64)),
+			}
+			wheels[i] = w
+			go w.run() // S/R-SAFE: Timers are paused during save.
+		}
+	})
+	i := atomic.AddUint32(&nextWheel, 1)
+	return wheels[i%uint32(len(wheels))]
+}
+
+// add schedules the Timer owning e to be ticked after d elapses. If d is not
+// positive, the Timer is ticked as soon as possible. If e is already in the
+// wheel, it is rescheduled.
+func (w *timerWheel) add(e *wheelEntry, d time.Duration) {
+	var when uint64
+	if d > 0 {
+		when = wheelAfter(d)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.removeLocked(e)
+	w.insertLocked(e, when)
+	if when < w.wakeTick {
+		w.wakeTick = when
+		w.kicker.Reset(wheelUntil(when))
+	}
+}
+
+// remove removes e from the wheel, if it is in it.
+func (w *timerWheel) remove(e *wheelEntry) {
+	w.mu.Lock()
+	w.removeLocked(e)
+	w.mu.Unlock()
+}
+
+// wheelUntil returns the duration until tick begins.
+func wheelUntil(tick uint64) time.Duration {
+	if tick > math.MaxInt64>>wheelTickShift {
+		return math.MaxInt64
+	}
+	return time.Duration(tick<<wheelTickShift) - time.Since(wheelEpoch)
+}
+
+// Preconditions: w.mu must be locked. e must not be in the wheel.
+func (w *timerWheel) insertLocked(e *wheelEntry, when uint64) {
+	e.when = when
+	if when <= w.now {
+		e.list = &w.expired
+		e.level = -1
+		w.expired.PushBack(e)
+		return
+	}
+	level := (bits.Len64(when^w.now) - 1) / wheelLevelShift
+	slot := int((when >> uint(level*wheelLevelShift)) % wheelLevelSlots)
+	e.list = &w.slots[level][slot]
+	e.level = level
+	e.slot = slot
+	e.list.PushBack(e)
+	w.occupied[level] |= 1 << uint(slot)
+}
+
+// Preconditions: w.mu must be locked.
+func (w *timerWheel) removeLocked(e *wheelEntry) {
+	if e.list == nil {
+		return
+	}
+	e.list.Remove(e)
+	if e.level >= 0 && e.list.Empty() {
+		w.occupied[e.level] &^= 1 << uint(e.slot)
+	}
+	e.list = nil
+}
+
+// nextTickLocked returns the earliest tick after w.now at which the wheel must
+// be advanced, either because entries expire or because entries must be
+// cascaded to lower levels. If the wheel is empty, nextTickLocked returns
+// false.
+//
+// Preconditions: w.mu must be locked.
+func (w *timerWheel) nextTickLocked() (uint64, bool) {
+	next := uint64(math.MaxUint64)
+	ok := false
+	for level := 0; level < wheelLevels; level++ {
+		occupied := w.occupied[level]
+		if occupied == 0 {
+			continue
+		}
+		// All occupied slots come after the current one, so the first
+		// is reached when now advances to its start.
+		shift := uint(level * wheelLevelShift)
+		upper := shift + wheelLevelShift
+		slot := uint64(bits.TrailingZeros64(occupied))
+		if tick := (w.now>>upper)<<upper | slot<<shift; !ok || tick < next {
+			next = tick
+			ok = true
+		}
+	}
+	return next, ok
+}
+
+// advanceLocked advances the wheel to tick now, moving expired entries to
+// w.expired.
+//
+// Preconditions: w.mu must be locked.
+func (w *timerWheel) advanceLocked(now uint64) {
+	for {
+		next, ok := w.nextTickLocked()
+		if !ok || next > now {
+			break
+		}
+		w.now = next
+
+		// Go through levels from highest to lowest, so that entries
+		// cascaded into the current slot of a lower level are processed
+		// in the same pass. Reinserting entries relative to the new
+		// value of w.now always places them in a lower level, or in
+		// w.expired.
+		for level := wheelLevels - 1; level >= 0; level-- {
+			slot := int((next >> uint(level*wheelLevelShift)) % wheelLevelSlots)
+			if w.occupied[level]&(1<<uint(slot)) == 0 {
+				continue
+			}
+			w.occupied[level] &^= 1 << uint(slot)
+			list := &w.slots[level][slot]
+			for e := list.Front(); e != nil; e = list.Front() {
+				list.Remove(e)
+				w.insertLocked(e, e.when)
+			}
+		}
+	}
+	if now > w.now {
+		w.now = now
+	}
+}
+
+// run is the wheel goroutine, which ticks the Timers of expired entries.
+func (w *timerWheel) run() {
+	var timers []*Timer
+	for {
+		w.mu.Lock()
+		w.wakeTick = 0
+		w.advanceLocked(wheelNow())
+		for e := w.expired.Front(); e != nil; e = w.expired.Front() {
+			w.removeLocked(e)
+			timers = append(timers, e.timer)
+		}
+		if len(timers) == 0 {
+			// Sleep until the wheel must next be advanced, or until
+			// add schedules an earlier expiration.
+			w.wakeTick = math.MaxUint64
+			if next, ok := w.nextTickLocked(); ok {
+				w.wakeTick = next
+				w.kicker.Reset(wheelUntil(next))
+			}
+			w.mu.Unlock()
+			<-w.kicker.C
+			continue
+		}
+		w.mu.Unlock()
+
+		// Timers are ticked without w.mu locked, since Timer.Tick locks
+		// Timer.mu, which precedes w.mu in lock order. A Timer may thus
+		// be rescheduled or destroyed concurrently, in which case
+		// ticking it is harmless.
+		for i, t := range timers {
+			t.Tick()
+			timers[i] = nil
+		}
+		timers = timers[:0]
+	}
+}
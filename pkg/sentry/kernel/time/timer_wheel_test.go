@@ -0,0 +1,298 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package time
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+	"testing"
+	"time"
+)
+
+// drainExpired removes and returns the entries in w.expired.
+func drainExpired(w *timerWheel) []*wheelEntry {
+	var es []*wheelEntry
+	for e := w.expired.Front(); e != nil; e = w.expired.Front() {
+		w.removeLocked(e)
+		es = append(es, e)
+	}
+	return es
+}
+
+// checkWheel checks that the entries of w that aren't expired are in the slot
+// given by their expiration tick, and that w.occupied matches w.slots.
+func checkWheel(t *testing.T, w *timerWheel, es []*wheelEntry) {
+	t.Helper()
+	for _, e := range es {
+		if e.list == nil || e.level < 0 {
+			continue
+		}
+		if e.when <= w.now {
+			t.Errorf("entry with when %#x is in level %d at now %#x", e.when, e.level, w.now)
+			continue
+		}
+		level := (bits.Len64(e.when^w.now) - 1) / wheelLevelShift
+		slot := int((e.when >> uint(level*wheelLevelShift)) % wheelLevelSlots)
+		if e.level != level || e.slot != slot || e.list != &w.slots[level][slot] {
+			t.Errorf("entry with when %#x at now %#x: got level %d slot %d, want level %d slot %d", e.when, w.now, e.level, e.slot, level, slot)
+		}
+	}
+	for level := range w.slots {
+		for slot := range w.slots[level] {
+			occupied := w.occupied[level]&(1<<uint(slot)) != 0
+			if empty := w.slots[level][slot].Empty(); occupied == empty {
+				t.Errorf("level %d slot %d: occupied %t, empty %t", level, slot, occupied, empty)
+			}
+		}
+	}
+}
+
+func TestWheelExpire(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		now   uint64
+		whens []uint64
+	}{
+		{
+			name:  "level 0",
+			now:   0,
+			whens: []uint64{1, 2, 2, 62, 63},
+		},
+		{
+			name:  "level boundaries",
+			now:   0,
+			whens: []uint64{63, 64, 65, 127, 128, 4095, 4096, 4097, 1<<18 - 1, 1 << 18, 1<<18 + 5, 1<<30 + 1<<12 + 3},
+		},
+		{
+			name:  "across slot from near boundary",
+			now:   60,
+			whens: []uint64{61, 63, 64, 65, 4096, 4160},
+		},
+		{
+			name:  "unaligned now",
+			now:   1<<20 + 12345,
+			whens: []uint64{1<<20 + 12346, 1<<21 - 1, 1 << 21, 1<<21 + 1, 1<<40 + 7},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := &timerWheel{now: tc.now}
+			var es []*wheelEntry
+			for _, when := range tc.whens {
+				e := &wheelEntry{}
+				w.insertLocked(e, when)
+				es = append(es, e)
+			}
+			checkWheel(t, w, es)
+
+			ticks := append([]uint64(nil), tc.whens...)
+			sort.Slice(ticks, func(i, j int) bool { return ticks[i] < ticks[j] })
+			for i, tick := range ticks {
+				if i > 0 && tick == ticks[i-1] {
+					continue
+				}
+				if next, ok := w.nextTickLocked(); !ok || next > tick {
+					t.Errorf("nextTickLocked() at now %#x: got (%#x, %t), want at most %#x", w.now, next, ok, tick)
+				}
+
+				w.advanceLocked(tick - 1)
+				if got := drainExpired(w); len(got) != 0 {
+					t.Errorf("advanceLocked(%#x): got %d expired entries, want 0", tick-1, len(got))
+				}
+				checkWheel(t, w, es)
+
+				w.advanceLocked(tick)
+				want := 0
+				for _, when := range tc.whens {
+					if when == tick {
+						want++
+					}
+				}
+				got := drainExpired(w)
+				if len(got) != want {
+					t.Errorf("advanceLocked(%#x): got %d expired entries, want %d", tick, len(got), want)
+				}
+				for _, e := range got {
+					if e.when != tick {
+						t.Errorf("advanceLocked(%#x): expired entry with when %#x", tick, e.when)
+					}
+				}
+				checkWheel(t, w, es)
+			}
+			if next, ok := w.nextTickLocked(); ok {
+				t.Errorf("nextTickLocked() on empty wheel: got (%#x, true), want false", next)
+			}
+		})
+	}
+}
+
+func TestWheelReschedule(t *testing.T) {
+	w := &timerWheel{}
+	e := &wheelEntry{}
+
+	// Reschedule to an earlier tick, in another level.
+	w.insertLocked(e, 5000)
+	w.removeLocked(e)
+	w.insertLocked(e, 10)
+	checkWheel(t, w, []*wheelEntry{e})
+	if w.occupied[1] != 0 {
+		t.Errorf("occupied[1] after rescheduling: got %#x, want 0", w.occupied[1])
+	}
+	w.advanceLocked(10)
+	if got := drainExpired(w); len(got) != 1 || got[0] != e {
+		t.Fatalf("advanceLocked(10): got %d expired entries, want e", len(got))
+	}
+
+	// Reschedule an expired entry.
+	w.insertLocked(e, 20)
+	w.advanceLocked(20)
+	if e.list != &w.expired {
+		t.Fatalf("advanceLocked(20): entry not expired")
+	}
+	w.removeLocked(e)
+	w.insertLocked(e, 5000)
+	if !w.expired.Empty() {
+		t.Errorf("expired not empty after rescheduling expired entry")
+	}
+	checkWheel(t, w, []*wheelEntry{e})
+	w.advanceLocked(4999)
+	if got := drainExpired(w); len(got) != 0 {
+		t.Errorf("advanceLocked(4999): got %d expired entries, want 0", len(got))
+	}
+	w.advanceLocked(5000)
+	if got := drainExpired(w); len(got) != 1 || got[0] != e {
+		t.Errorf("advanceLocked(5000): got %d expired entries, want e", len(got))
+	}
+}
+
+func TestWheelAddReschedules(t *testing.T) {
+	w := &timerWheel{
+		now:      wheelNow(),
+		wakeTick: math.MaxUint64,
+		kicker:   time.NewTimer(time.Duration(math.MaxInt64)),
+	}
+	defer w.kicker.Stop()
+	e := &wheelEntry{}
+
+	w.add(e, time.Hour)
+	hour := e.when
+	w.add(e, time.Minute)
+	if e.when >= hour {
+		t.Errorf("add(e, time.Minute) after add(e, time.Hour): got when %#x, want less than %#x", e.when, hour)
+	}
+	if w.wakeTick != e.when {
+		t.Errorf("wakeTick: got %#x, want %#x", w.wakeTick, e.when)
+	}
+	entries := 0
+	for level := range w.slots {
+		for slot := range w.slots[level] {
+			for le := w.slots[level][slot].Front(); le != nil; le = le.Next() {
+				entries++
+			}
+		}
+	}
+	if entries != 1 {
+		t.Errorf("got %d entries in the wheel, want 1", entries)
+	}
+	checkWheel(t, w, []*wheelEntry{e})
+
+	w.add(e, 0)
+	if e.list != &w.expired {
+		t.Errorf("add(e, 0): entry not expired")
+	}
+	w.remove(e)
+	if e.list != nil || !w.expired.Empty() {
+		t.Errorf("remove(e): entry still in the wheel")
+	}
+}
+
+func TestWheelRemoveDuringExpiry(t *testing.T) {
+	w := &timerWheel{}
+	a, b, c := &wheelEntry{}, &wheelEntry{}, &wheelEntry{}
+	for _, e := range []*wheelEntry{a, b, c} {
+		w.insertLocked(e, 100)
+	}
+	w.advanceLocked(100)
+
+	// b is removed after it expired, but before its Timer was ticked, as
+	// by Timer.Destroy or a concurrent Timer.Swap.
+	w.removeLocked(b)
+	if b.list != nil {
+		t.Errorf("removeLocked(b): b.list not nil")
+	}
+	w.removeLocked(b)
+	got := drainExpired(w)
+	if len(got) != 2 || got[0] != a || got[1] != c {
+		t.Errorf("expired entries after removing b: got %v, want [a c]", got)
+	}
+
+	// An entry removed from a slot shared with another entry leaves the
+	// slot occupied until the other entry is removed too.
+	w.insertLocked(a, 5000)
+	w.insertLocked(b, 5000)
+	w.removeLocked(a)
+	checkWheel(t, w, []*wheelEntry{a, b})
+	w.removeLocked(b)
+	checkWheel(t, w, []*wheelEntry{a, b})
+	if next, ok := w.nextTickLocked(); ok {
+		t.Errorf("nextTickLocked() on empty wheel: got (%#x, true), want false", next)
+	}
+	w.advanceLocked(5000)
+	if got := drainExpired(w); len(got) != 0 {
+		t.Errorf("advanceLocked(5000): got %d expired entries, want 0", len(got))
+	}
+}
+
+func TestWheelLargeWhen(t *testing.T) {
+	if got := wheelAfter(time.Duration(math.MaxInt64)); got != math.MaxUint64 {
+		t.Errorf("wheelAfter(MaxInt64): got %#x, want MaxUint64", got)
+	}
+	if got := wheelAfter(time.Duration(math.MaxInt64) - time.Nanosecond); got != math.MaxUint64 {
+		t.Errorf("wheelAfter(MaxInt64-1): got %#x, want MaxUint64", got)
+	}
+	if got := wheelAfter(time.Hour); got <= wheelNow() || got == math.MaxUint64 {
+		t.Errorf("wheelAfter(time.Hour): got %#x, want after %#x and before MaxUint64", got, wheelNow())
+	}
+	if got := wheelUntil(math.MaxUint64); got != math.MaxInt64 {
+		t.Errorf("wheelUntil(MaxUint64): got %v, want MaxInt64", got)
+	}
+
+	for _, now := range []uint64{0, 12345, math.MaxUint64 - 100} {
+		w := &timerWheel{now: now}
+		e, f := &wheelEntry{}, &wheelEntry{}
+		w.insertLocked(e, math.MaxUint64)
+		w.insertLocked(f, math.MaxUint64-1)
+		es := []*wheelEntry{e, f}
+		checkWheel(t, w, es)
+
+		w.advanceLocked(math.MaxUint64 - 2)
+		if got := drainExpired(w); len(got) != 0 {
+			t.Errorf("now %#x: advanceLocked(MaxUint64-2): got %d expired entries, want 0", now, len(got))
+		}
+		checkWheel(t, w, es)
+		w.advanceLocked(math.MaxUint64 - 1)
+		if got := drainExpired(w); len(got) != 1 || got[0] != f {
+			t.Errorf("now %#x: advanceLocked(MaxUint64-1): got %d expired entries, want f", now, len(got))
+		}
+		checkWheel(t, w, es)
+		w.advanceLocked(math.MaxUint64)
+		if got := drainExpired(w); len(got) != 1 || got[0] != e {
+			t.Errorf("now %#x: advanceLocked(MaxUint64): got %d expired entries, want e", now, len(got))
+		}
+		if next, ok := w.nextTickLocked(); ok {
+			t.Errorf("now %#x: nextTickLocked() on empty wheel: got (%#x, true), want false", now, next)
+		}
+	}
+}
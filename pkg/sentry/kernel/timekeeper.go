@@ -17,6 +17,7 @@ package kernel
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"gvisor.googlesource.com/gvisor/pkg/log"
@@ -24,6 +25,8 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/pgalloc"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
 	sentrytime "gvisor.googlesource.com/gvisor/pkg/sentry/time"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+	"gvisor.googlesource.com/gvisor/third_party/gvsync"
 )
 
 // Timekeeper manages all of the kernel clocks.
@@ -42,12 +45,21 @@ type Timekeeper struct {
 	// SetClocks was called in the initial (not restored) run.
 	bootTime ktime.Time
 
+	// monotonicSeq protects the fields below it, which are written only
+	// with mu held, and read using atomic memory operations by GetTime.
+	monotonicSeq gvsync.SeqCount `state:"nosave"`
+
 	// monotonicOffset is the offset to apply to the monotonic clock output
 	// from clocks.
 	//
-	// It is set only once, by SetClocks.
+	// It is set by SetClocks, and decreased by ResumeMonotonic.
 	monotonicOffset int64 `state:"nosave"`
 
+	// suspended is non-zero between SuspendMonotonic and ResumeMonotonic,
+	// while the monotonic clock is frozen at suspendMonotonic.
+	suspended        int32 `state:"nosave"`
+	suspendMonotonic int64 `state:"nosave"`
+
 	// restored, if non-nil, indicates that this Timekeeper was restored
 	// from a state file. The clocks are not set until restored is closed.
 	restored chan struct{} `state:"nosave"`
@@ -69,9 +81,23 @@ type Timekeeper struct {
 	// monotonicOffset.
 	saveRealtime int64
 
+	// rngGeneration is the generation of the random number generator
+	// state exposed to the VDSO. It is incremented on restore, so that
+	// the VDSO rekeys any getrandom state that was saved, ensuring that
+	// multiple restores of the same state file do not produce the same
+	// random numbers.
+	//
+	// It is only modified by SetClocks.
+	rngGeneration uint64
+
 	// params manages the parameter page.
 	params *VDSOParamPage
 
+	// realtimeEvents is notified of ktime.ClockEventSet when the realtime
+	// clock undergoes a discontinuous change relative to the monotonic
+	// clock.
+	realtimeEvents ktime.ClockEventsQueue `state:"nosave"`
+
 	// mu protects destruction with stop and wg.
 	mu sync.Mutex `state:"nosave"`
 
@@ -103,8 +129,11 @@ func (t *Timekeeper) SetClocks(c sentrytime.Clocks) {
 	// Update the params, marking them "not ready", as we may need to
 	// restart calibration on this new machine.
 	if t.restored != nil {
+		t.rngGeneration++
 		if err := t.params.Write(func() vdsoParams {
-			return vdsoParams{}
+			return vdsoParams{
+				rngGeneration: t.rngGeneration,
+			}
 		}); err != nil {
 			panic("unable to reset VDSO params: " + err.Error())
 		}
@@ -139,11 +168,17 @@ func (t *Timekeeper) SetClocks(c sentrytime.Clocks) {
 		panic("Unable to get current realtime: " + err.Error())
 	}
 
+	// realtimeSet is true if real time was changed relative to monotonic
+	// time, which only happens if real time went backwards across save and
+	// restore.
+	realtimeSet := false
 	if t.restored != nil {
 		wantMonotonic = t.saveMonotonic
 		elapsed := nowRealtime - t.saveRealtime
 		if elapsed > 0 {
 			wantMonotonic += elapsed
+		} else if elapsed < 0 {
+			realtimeSet = true
 		}
 	}
 
@@ -161,6 +196,10 @@ func (t *Timekeeper) SetClocks(c sentrytime.Clocks) {
 	if t.restored != nil {
 		close(t.restored)
 	}
+
+	if realtimeSet {
+		t.realtimeEvents.Notify(ktime.ClockEventSet)
+	}
 }
 
 // startUpdater starts an update goroutine that keeps the clocks updated.
@@ -192,7 +231,9 @@ func (t *Timekeeper) startUpdater() {
 			if err := t.params.Write(func() vdsoParams {
 				monotonicParams, monotonicOk, realtimeParams, realtimeOk := t.clocks.Update()
 
-				var p vdsoParams
+				p := vdsoParams{
+					rngGeneration: t.rngGeneration,
+				}
 				if monotonicOk {
 					p.monotonicReady = 1
 					p.monotonicBaseCycles = int64(monotonicParams.BaseCycles)
@@ -260,6 +301,69 @@ func (t *Timekeeper) ResumeUpdates() {
 	t.startUpdater()
 }
 
+// SuspendMonotonic freezes the monotonic clock until ResumeMonotonic, from
+// which point it advances again from the frozen value. In effect, monotonic
+// time doesn't advance in the meantime while real time does, as for Linux
+// system suspend. This keeps timers and timeouts based on monotonic time from
+// all expiring at once after a long pause.
+//
+// Tasks must not run until ResumeMonotonic is called, since the VDSO keeps
+// reading the unfrozen clock.
+func (t *Timekeeper) SuspendMonotonic() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if atomic.LoadInt32(&t.suspended) != 0 {
+		return
+	}
+
+	// The clock is read in the writer critical section, so that readers
+	// that got the time before the clock is frozen got an earlier time.
+	t.monotonicSeq.BeginWrite()
+	defer t.monotonicSeq.EndWrite()
+	now, err := t.clocks.GetTime(sentrytime.Monotonic)
+	if err != nil {
+		log.Warningf("Unable to get monotonic time to suspend: %v", err)
+		return
+	}
+	atomic.StoreInt64(&t.suspendMonotonic, now+atomic.LoadInt64(&t.monotonicOffset))
+	atomic.StoreInt32(&t.suspended, 1)
+}
+
+// ResumeMonotonic ends the effect of a previous call to SuspendMonotonic.
+//
+// Since real time changes relative to monotonic time, the realtime clock
+// reports ClockEventSet, as Linux does on resume.
+func (t *Timekeeper) ResumeMonotonic() {
+	t.mu.Lock()
+	if atomic.LoadInt32(&t.suspended) == 0 {
+		t.mu.Unlock()
+		return
+	}
+
+	// Restart the updater, if running, so that the VDSO parameters reflect
+	// the new offset.
+	running := t.stop != nil
+	t.stopUpdater()
+
+	t.monotonicSeq.BeginWrite()
+	now, err := t.clocks.GetTime(sentrytime.Monotonic)
+	if err != nil {
+		// Leave the offset as is rather than let the clock go back.
+		log.Warningf("Unable to get monotonic time to resume: %v", err)
+	} else if elapsed := now + atomic.LoadInt64(&t.monotonicOffset) - atomic.LoadInt64(&t.suspendMonotonic); elapsed > 0 {
+		atomic.AddInt64(&t.monotonicOffset, -elapsed)
+	}
+	atomic.StoreInt32(&t.suspended, 0)
+	t.monotonicSeq.EndWrite()
+
+	if running {
+		t.startUpdater()
+	}
+	t.mu.Unlock()
+
+	t.realtimeEvents.Notify(ktime.ClockEventSet)
+}
+
 // GetTime returns the current time in nanoseconds.
 func (t *Timekeeper) GetTime(c sentrytime.ClockID) (int64, error) {
 	if t.clocks == nil {
@@ -268,11 +372,24 @@ func (t *Timekeeper) GetTime(c sentrytime.ClockID) (int64, error) {
 		}
 		<-t.restored
 	}
-	now, err := t.clocks.GetTime(c)
-	if err == nil && c == sentrytime.Monotonic {
-		now += t.monotonicOffset
+	if c != sentrytime.Monotonic {
+		return t.clocks.GetTime(c)
+	}
+	for {
+		epoch := t.monotonicSeq.BeginRead()
+		if atomic.LoadInt32(&t.suspended) != 0 {
+			now := atomic.LoadInt64(&t.suspendMonotonic)
+			if t.monotonicSeq.ReadOk(epoch) {
+				return now, nil
+			}
+			continue
+		}
+		now, err := t.clocks.GetTime(c)
+		now += atomic.LoadInt64(&t.monotonicOffset)
+		if t.monotonicSeq.ReadOk(epoch) {
+			return now, err
+		}
 	}
-	return now, err
 }
 
 // BootTime returns the system boot real time.
@@ -291,11 +408,27 @@ type timekeeperClock struct {
 	// Implements ktime.Clock.WallTimeUntil.
 	ktime.WallRateClock `state:"nosave"`
 
-	// Implements waiter.Waitable. (We have no ability to detect
-	// discontinuities from external changes to CLOCK_REALTIME).
+	// Implements waiter.Waitable.Readiness. EventRegister and
+	// EventUnregister are implemented below. (We have no ability to detect
+	// discontinuities from external changes to CLOCK_REALTIME, but
+	// discontinuities caused by restore are reported.)
 	ktime.NoClockEvents `state:"nosave"`
 }
 
+// EventRegister implements waiter.Waitable.EventRegister.
+func (tc *timekeeperClock) EventRegister(e *waiter.Entry, mask waiter.EventMask) {
+	if tc.c == sentrytime.Realtime {
+		tc.tk.realtimeEvents.EventRegister(e, mask)
+	}
+}
+
+// EventUnregister implements waiter.Waitable.EventUnregister.
+func (tc *timekeeperClock) EventUnregister(e *waiter.Entry) {
+	if tc.c == sentrytime.Realtime {
+		tc.tk.realtimeEvents.EventUnregister(e)
+	}
+}
+
 // Now implements ktime.Clock.Now.
 func (tc *timekeeperClock) Now() ktime.Time {
 	now, err := tc.tk.GetTime(tc.c)
@@ -18,11 +18,13 @@ import (
 	"testing"
 
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context/contexttest"
+	ktime "gvisor.googlesource.com/gvisor/pkg/sentry/kernel/time"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/pgalloc"
 	sentrytime "gvisor.googlesource.com/gvisor/pkg/sentry/time"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
 )
 
 // mockClocks is a sentrytime.Clocks that simply returns the times in the
@@ -154,3 +156,141 @@ func TestTimekeeperMonotonicJumpBackwards(t *testing.T) {
 		t.Errorf("GetTime got %d want 100000", now)
 	}
 }
+
+// TestTimekeeperRealtimeSetOnRestore tests that the realtime clock reports
+// ClockEventSet when realtime goes backwards across restore, but not when it
+// goes forwards.
+func TestTimekeeperRealtimeSetOnRestore(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		realtime int64
+		wantSet  bool
+	}{
+		{name: "forward", realtime: 600000, wantSet: false},
+		{name: "backward", realtime: 300000, wantSet: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := &mockClocks{
+				monotonic: 900000,
+				realtime:  test.realtime,
+			}
+
+			tk := stateTestClocklessTimekeeper(t)
+			tk.restored = make(chan struct{})
+			tk.saveMonotonic = 100000
+			tk.saveRealtime = 400000
+
+			clock := &timekeeperClock{tk: tk, c: sentrytime.Realtime}
+			e, ch := waiter.NewChannelEntry(nil)
+			clock.EventRegister(&e, ktime.ClockEventSet)
+			defer clock.EventUnregister(&e)
+
+			tk.SetClocks(c)
+			defer tk.Destroy()
+
+			select {
+			case <-ch:
+				if !test.wantSet {
+					t.Errorf("got unexpected ClockEventSet")
+				}
+			default:
+				if test.wantSet {
+					t.Errorf("got no ClockEventSet, want one")
+				}
+			}
+		})
+	}
+}
+
+// TestTimekeeperSuspendMonotonic tests that monotonic time doesn't advance
+// between SuspendMonotonic and ResumeMonotonic, and that the realtime clock
+// then reports ClockEventSet.
+func TestTimekeeperSuspendMonotonic(t *testing.T) {
+	c := &mockClocks{
+		monotonic: 100000,
+		realtime:  400000,
+	}
+
+	tk := stateTestClocklessTimekeeper(t)
+	tk.SetClocks(c)
+	defer tk.Destroy()
+
+	clock := &timekeeperClock{tk: tk, c: sentrytime.Realtime}
+	e, ch := waiter.NewChannelEntry(nil)
+	clock.EventRegister(&e, ktime.ClockEventSet)
+	defer clock.EventUnregister(&e)
+
+	c.monotonic += 10
+	tk.SuspendMonotonic()
+	c.monotonic += 200000
+	c.realtime += 200000
+	tk.ResumeMonotonic()
+
+	// The monotonic clock should remain at 10, though real time advanced.
+	now, err := tk.GetTime(sentrytime.Monotonic)
+	if err != nil {
+		t.Errorf("GetTime err got %v want nil", err)
+	}
+	if now != 10 {
+		t.Errorf("GetTime got %d want 10", now)
+	}
+
+	select {
+	case <-ch:
+	default:
+		t.Errorf("got no ClockEventSet, want one")
+	}
+
+	c.monotonic += 10
+	now, err = tk.GetTime(sentrytime.Monotonic)
+	if err != nil {
+		t.Errorf("GetTime err got %v want nil", err)
+	}
+	if now != 20 {
+		t.Errorf("GetTime got %d want 20", now)
+	}
+}
+
+// TestTimekeeperSuspendMonotonicNeverDecreases tests that monotonic time is
+// frozen between SuspendMonotonic and ResumeMonotonic, and never goes back
+// across them.
+func TestTimekeeperSuspendMonotonicNeverDecreases(t *testing.T) {
+	c := &mockClocks{
+		monotonic: 100000,
+		realtime:  400000,
+	}
+
+	tk := stateTestClocklessTimekeeper(t)
+	tk.SetClocks(c)
+	defer tk.Destroy()
+
+	var last int64
+	check := func(desc string, want int64) {
+		now, err := tk.GetTime(sentrytime.Monotonic)
+		if err != nil {
+			t.Fatalf("GetTime %s: err got %v want nil", desc, err)
+		}
+		if now != want {
+			t.Errorf("GetTime %s: got %d want %d", desc, now, want)
+		}
+		if now < last {
+			t.Errorf("GetTime %s: got %d, which is before %d", desc, now, last)
+		}
+		last = now
+	}
+
+	c.monotonic += 10
+	check("before suspend", 10)
+	for i := 0; i < 3; i++ {
+		tk.SuspendMonotonic()
+		check("at suspend", 10+int64(i)*5)
+		c.monotonic += 1000
+		check("during suspend", 10+int64(i)*5)
+		c.monotonic += 1000
+		check("during suspend", 10+int64(i)*5)
+		tk.ResumeMonotonic()
+		check("at resume", 10+int64(i)*5)
+		c.monotonic += 5
+		check("after resume", 15+int64(i)*5)
+	}
+}
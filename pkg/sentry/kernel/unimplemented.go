@@ -0,0 +1,116 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"strconv"
+	"strings"
+	"syscall"
+
+	"gvisor.googlesource.com/gvisor/pkg/metric"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+)
+
+// maxUnimplementedSyscalls is the maximum number of distinct
+// UnimplementedSyscalls counted per container, which bounds memory use if the
+// application passes many different arguments to unimplemented syscalls.
+// Further combinations are only counted by the metric.
+const maxUnimplementedSyscalls = 1024
+
+var unimplementedSyscallCount = metric.MustCreateNewUint64FieldMetric("/kernel/unimplemented_syscalls", false /* sync */, "Number of times each syscall was invoked by the application and found unimplemented, in whole or for the given arguments", "sysno", maxSyscallMetric)
+
+// UnimplementedSyscall identifies an unimplemented syscall, or an
+// unimplemented feature of a syscall, invoked by the application.
+type UnimplementedSyscall struct {
+	// Sysno is the syscall number.
+	Sysno uintptr
+
+	// Args are the values of the arguments of the syscall returned by
+	// UnimplementedSyscallArgs, in decimal and separated by commas, e.g.
+	// "6,13" for setsockopt(fd, SOL_TCP, TCP_MAXSEG, ...). Args is empty
+	// for syscalls that are identified by number alone.
+	Args string
+}
+
+// UnimplementedSyscallArgs returns the indices of the arguments of syscall
+// sysno that select its feature, e.g. the command of ioctl(2), so that
+// invocations of different unimplemented features can be told apart.
+func UnimplementedSyscallArgs(sysno uintptr) []int {
+	switch sysno {
+	case syscall.SYS_PRCTL, syscall.SYS_ARCH_PRCTL:
+		// args: cmd, ...
+		return []int{0}
+
+	case syscall.SYS_IOCTL, syscall.SYS_EPOLL_CTL, syscall.SYS_SHMCTL, syscall.SYS_FUTEX:
+		// args: fd/addr, cmd, ...
+		return []int{1}
+
+	case syscall.SYS_GETSOCKOPT, syscall.SYS_SETSOCKOPT:
+		// args: fd, level, name, ...
+		return []int{1, 2}
+
+	case syscall.SYS_SEMCTL:
+		// args: semid, semnum, cmd, ...
+		return []int{2}
+	}
+	return nil
+}
+
+// newUnimplementedSyscall returns the UnimplementedSyscall for an invocation
+// of syscall sysno with args.
+func newUnimplementedSyscall(sysno uintptr, args arch.SyscallArguments) UnimplementedSyscall {
+	var vals []string
+	for _, idx := range UnimplementedSyscallArgs(sysno) {
+		vals = append(vals, strconv.FormatUint(uint64(args[idx].Uint()), 10))
+	}
+	return UnimplementedSyscall{
+		Sysno: sysno,
+		Args:  strings.Join(vals, ","),
+	}
+}
+
+// countUnimplemented counts an invocation of us by a process of container cid.
+func (k *Kernel) countUnimplemented(cid string, us UnimplementedSyscall) {
+	if us.Sysno < maxSyscallMetric {
+		unimplementedSyscallCount.Increment(int(us.Sysno))
+	}
+
+	k.unimplementedMu.Lock()
+	defer k.unimplementedMu.Unlock()
+	if k.unimplemented == nil {
+		k.unimplemented = make(map[string]map[UnimplementedSyscall]uint64)
+	}
+	counts := k.unimplemented[cid]
+	if counts == nil {
+		counts = make(map[UnimplementedSyscall]uint64)
+		k.unimplemented[cid] = counts
+	}
+	if _, ok := counts[us]; !ok && len(counts) >= maxUnimplementedSyscalls {
+		return
+	}
+	counts[us]++
+}
+
+// UnimplementedSyscalls returns the number of invocations of each
+// unimplemented syscall by the processes of container cid.
+func (k *Kernel) UnimplementedSyscalls(cid string) map[UnimplementedSyscall]uint64 {
+	k.unimplementedMu.Lock()
+	defer k.unimplementedMu.Unlock()
+	counts := make(map[UnimplementedSyscall]uint64, len(k.unimplemented[cid]))
+	for us, n := range k.unimplemented[cid] {
+		counts[us] = n
+	}
+	return counts
+}
@@ -0,0 +1,80 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"strconv"
+	"syscall"
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+)
+
+func TestNewUnimplementedSyscall(t *testing.T) {
+	var args arch.SyscallArguments
+	args[0].Value = 3
+	args[1].Value = 0xdead00000006 // Only the low 32 bits are used.
+	args[2].Value = 13
+
+	for _, tc := range []struct {
+		sysno uintptr
+		want  string
+	}{
+		{sysno: syscall.SYS_MBIND, want: ""},
+		{sysno: syscall.SYS_PRCTL, want: "3"},
+		{sysno: syscall.SYS_IOCTL, want: "6"},
+		{sysno: syscall.SYS_SETSOCKOPT, want: "6,13"},
+		{sysno: syscall.SYS_SEMCTL, want: "13"},
+	} {
+		got := newUnimplementedSyscall(tc.sysno, args)
+		if want := (UnimplementedSyscall{Sysno: tc.sysno, Args: tc.want}); got != want {
+			t.Errorf("newUnimplementedSyscall(%d) got %+v want %+v", tc.sysno, got, want)
+		}
+	}
+}
+
+func TestCountUnimplemented(t *testing.T) {
+	var k Kernel
+	mbind := UnimplementedSyscall{Sysno: syscall.SYS_MBIND}
+	ioctl := UnimplementedSyscall{Sysno: syscall.SYS_IOCTL, Args: "6"}
+	k.countUnimplemented("a", mbind)
+	k.countUnimplemented("a", mbind)
+	k.countUnimplemented("a", ioctl)
+	k.countUnimplemented("b", ioctl)
+
+	got := k.UnimplementedSyscalls("a")
+	if len(got) != 2 || got[mbind] != 2 || got[ioctl] != 1 {
+		t.Errorf("UnimplementedSyscalls(a) got %v want map[%v:2 %v:1]", got, mbind, ioctl)
+	}
+	if got := k.UnimplementedSyscalls("c"); len(got) != 0 {
+		t.Errorf("UnimplementedSyscalls(c) got %v want empty", got)
+	}
+
+	// Returned counts are a copy.
+	got[mbind] = 100
+	if got := k.UnimplementedSyscalls("a"); got[mbind] != 2 {
+		t.Errorf("UnimplementedSyscalls(a) after modifying copy got %d want 2", got[mbind])
+	}
+
+	// Only maxUnimplementedSyscalls distinct syscalls are counted per
+	// container, further invocations of counted ones are still counted.
+	for i := 0; i < maxUnimplementedSyscalls; i++ {
+		k.countUnimplemented("b", UnimplementedSyscall{Sysno: syscall.SYS_SETSOCKOPT, Args: strconv.Itoa(i)})
+	}
+	k.countUnimplemented("b", ioctl)
+	if got := k.UnimplementedSyscalls("b"); len(got) != maxUnimplementedSyscalls || got[ioctl] != 2 {
+		t.Errorf("UnimplementedSyscalls(b) got %d syscalls, ioctl count %d, want %d syscalls, ioctl count 2", len(got), got[ioctl], maxUnimplementedSyscalls)
+	}
+}
@@ -38,6 +38,8 @@ type vdsoParams struct {
 	realtimeBaseCycles int64
 	realtimeBaseRef    int64
 	realtimeFrequency  uint64
+
+	rngGeneration uint64
 }
 
 // VDSOParamPage manages a VDSO parameter page.
@@ -52,7 +54,7 @@ type vdsoParams struct {
 //
 // Everything in the struct is 8 bytes for easy alignment.
 //
-// It must be kept in sync with params in vdso/vdso_time.cc.
+// It must be kept in sync with params in vdso/params.h.
 //
 // +stateify savable
 type VDSOParamPage struct {
@@ -0,0 +1,448 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+const (
+	// binprmBufSize is the number of bytes at the start of a binary that
+	// binfmt_misc magic may match against. It matches Linux's
+	// include/uapi/linux/binfmts.h:BINPRM_BUF_SIZE.
+	binprmBufSize = 256
+
+	// binfmtMiscMinRegister and binfmtMiscMaxRegister bound the length of
+	// a registration string, as in Linux's fs/binfmt_misc.c:create_entry.
+	binfmtMiscMinRegister = 11
+	binfmtMiscMaxRegister = 1920
+)
+
+// BinfmtMiscEntry is a binfmt_misc binary format, which executes matching
+// files with an interpreter. See Linux's
+// Documentation/admin-guide/binfmt-misc.rst.
+//
+// All fields other than enabled are immutable.
+//
+// +stateify savable
+type BinfmtMiscEntry struct {
+	// name is the name of the entry's file in the binfmt_misc filesystem.
+	name string
+
+	// enabled is true if the entry may be used. enabled is protected by
+	// BinfmtMisc.mu.
+	enabled bool
+
+	// extension is true if the entry matches files by filename extension
+	// (type 'E') rather than by magic (type 'M').
+	extension bool
+
+	// offset is the offset of magic in the file.
+	offset int
+
+	// magic is the byte sequence matched by the entry, or the filename
+	// extension if extension is true.
+	magic []byte
+
+	// mask, if not nil, selects the bits of magic that must match the file
+	// contents. len(mask) == len(magic).
+	mask []byte
+
+	// interpreter is the path of the interpreter.
+	interpreter string
+
+	// preserveArgv0 corresponds to flag 'P'. If set, the original argv[0]
+	// is passed to the interpreter after the path of the binary.
+	preserveArgv0 bool
+
+	// openBinary corresponds to flag 'O'. Linux passes the binary to the
+	// interpreter as an open file descriptor in AT_EXECFD; we only record
+	// the flag, and interpreters open the binary at the path in argv[1]
+	// instead.
+	openBinary bool
+
+	// credentials corresponds to flag 'C', which computes credentials from
+	// the binary rather than the interpreter. It implies openBinary. Since
+	// set-user-ID and set-group-ID binaries are not supported, it has no
+	// further effect.
+	credentials bool
+
+	// fixBinary corresponds to flag 'F'. If set, the interpreter was opened
+	// at registration, and interp holds a reference on it.
+	fixBinary bool
+
+	// interp is the interpreter opened at registration if fixBinary is set,
+	// or nil otherwise.
+	interp *fs.Dirent
+}
+
+// BinfmtMisc is the set of binfmt_misc entries consulted by the loader for
+// binaries that it cannot otherwise execute.
+//
+// +stateify savable
+type BinfmtMisc struct {
+	mu sync.Mutex `state:"nosave"`
+
+	// disabled is true if no entries may be used. disabled is protected by
+	// mu.
+	disabled bool
+
+	// entries holds the registered entries, in order of registration.
+	// Later entries take precedence. entries is protected by mu.
+	entries []*BinfmtMiscEntry
+}
+
+// NewBinfmtMisc returns an empty, enabled BinfmtMisc.
+func NewBinfmtMisc() *BinfmtMisc {
+	return &BinfmtMisc{}
+}
+
+// unescapeHex replaces "\xHH" escape sequences in s, where HH is one or two
+// hexadecimal digits, with the bytes they represent. Other characters are
+// copied unchanged, as in Linux's string_unescape with UNESCAPE_HEX.
+func unescapeHex(s string) []byte {
+	var out []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+2 < len(s) && s[i+1] == 'x' {
+			if v, err := strconv.ParseUint(s[i+2:i+3], 16, 8); err == nil {
+				i += 2
+				if i+1 < len(s) {
+					if d, err := strconv.ParseUint(s[i+1:i+2], 16, 8); err == nil {
+						v = v<<4 | d
+						i++
+					}
+				}
+				out = append(out, byte(v))
+				continue
+			}
+		}
+		out = append(out, s[i])
+	}
+	return out
+}
+
+// parseBinfmtMiscEntry parses a registration string of the form
+// :name:type:offset:magic:mask:interpreter:flags, where ':' may be any
+// delimiter, into a new enabled entry.
+func parseBinfmtMiscEntry(spec string) (*BinfmtMiscEntry, error) {
+	if len(spec) < binfmtMiscMinRegister || len(spec) > binfmtMiscMaxRegister {
+		return nil, syserror.EINVAL
+	}
+	spec = strings.TrimSuffix(spec, "\n")
+	fields := strings.SplitN(spec[1:], spec[:1], 7)
+	if len(fields) != 7 {
+		return nil, syserror.EINVAL
+	}
+	name, typ, offset, magic, mask, interpreter, flags := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5], fields[6]
+
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return nil, syserror.EINVAL
+	}
+	e := &BinfmtMiscEntry{
+		name:        name,
+		enabled:     true,
+		interpreter: interpreter,
+	}
+
+	switch typ {
+	case "M":
+		if offset != "" {
+			off, err := strconv.ParseUint(offset, 10, 32)
+			if err != nil {
+				return nil, syserror.EINVAL
+			}
+			e.offset = int(off)
+		}
+		if magic == "" {
+			return nil, syserror.EINVAL
+		}
+		e.magic = unescapeHex(magic)
+		if mask != "" {
+			e.mask = unescapeHex(mask)
+			if len(e.mask) != len(e.magic) {
+				return nil, syserror.EINVAL
+			}
+		}
+		if len(e.magic) > binprmBufSize || binprmBufSize-len(e.magic) < e.offset {
+			return nil, syserror.EINVAL
+		}
+	case "E":
+		if offset != "" || mask != "" {
+			return nil, syserror.EINVAL
+		}
+		if magic == "" || strings.Contains(magic, "/") {
+			return nil, syserror.EINVAL
+		}
+		e.extension = true
+		e.magic = []byte(magic)
+	default:
+		return nil, syserror.EINVAL
+	}
+
+	if interpreter == "" {
+		return nil, syserror.EINVAL
+	}
+
+	for _, c := range flags {
+		switch c {
+		case 'P':
+			e.preserveArgv0 = true
+		case 'O':
+			e.openBinary = true
+		case 'C':
+			e.credentials = true
+			e.openBinary = true
+		case 'F':
+			e.fixBinary = true
+		default:
+			return nil, syserror.EINVAL
+		}
+	}
+	return e, nil
+}
+
+// Register adds the entry described by spec. If the entry has the 'F' flag,
+// its interpreter is opened immediately, by looking it up in mounts relative
+// to root and wd.
+func (b *BinfmtMisc) Register(ctx context.Context, mounts *fs.MountNamespace, root, wd *fs.Dirent, spec string) error {
+	e, err := parseBinfmtMiscEntry(spec)
+	if err != nil {
+		return err
+	}
+	if e.fixBinary {
+		remainingTraversals := uint(linux.MaxSymlinkTraversals)
+		d, f, err := openPath(ctx, mounts, root, wd, &remainingTraversals, e.interpreter, true /* resolveFinal */)
+		if err != nil {
+			return err
+		}
+		f.DecRef()
+		e.interp = d
+	}
+
+	b.mu.Lock()
+	if b.findLocked(e.name) >= 0 {
+		b.mu.Unlock()
+		e.release()
+		return syserror.EEXIST
+	}
+	b.entries = append(b.entries, e)
+	b.mu.Unlock()
+	return nil
+}
+
+// release drops the references held by e.
+func (e *BinfmtMiscEntry) release() {
+	if e.interp != nil {
+		e.interp.DecRef()
+	}
+}
+
+// Names returns the names of all registered entries in sorted order.
+func (b *BinfmtMisc) Names() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	names := make([]string, 0, len(b.entries))
+	for _, e := range b.entries {
+		names = append(names, e.name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// findLocked returns the index of the entry with the given name, or -1 if
+// there is none.
+//
+// Preconditions: b.mu must be locked.
+func (b *BinfmtMisc) findLocked(name string) int {
+	for i, e := range b.entries {
+		if e.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Status returns the contents of the binfmt_misc file for the named entry,
+// in the format of Linux's fs/binfmt_misc.c:entry_status.
+func (b *BinfmtMisc) Status(name string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i := b.findLocked(name)
+	if i < 0 {
+		return "", syserror.ENOENT
+	}
+	e := b.entries[i]
+
+	var buf bytes.Buffer
+	if e.enabled {
+		buf.WriteString("enabled\n")
+	} else {
+		buf.WriteString("disabled\n")
+	}
+	fmt.Fprintf(&buf, "interpreter %s\nflags: ", e.interpreter)
+	if e.preserveArgv0 {
+		buf.WriteByte('P')
+	}
+	if e.credentials {
+		buf.WriteByte('C')
+	}
+	if e.openBinary {
+		buf.WriteByte('O')
+	}
+	if e.fixBinary {
+		buf.WriteByte('F')
+	}
+	buf.WriteByte('\n')
+	if e.extension {
+		fmt.Fprintf(&buf, "extension .%s\n", e.magic)
+	} else {
+		fmt.Fprintf(&buf, "offset %d\nmagic %s\n", e.offset, hex.EncodeToString(e.magic))
+		if e.mask != nil {
+			fmt.Fprintf(&buf, "mask %s\n", hex.EncodeToString(e.mask))
+		}
+	}
+	return buf.String(), nil
+}
+
+// SetEntryEnabled enables or disables the named entry.
+func (b *BinfmtMisc) SetEntryEnabled(name string, enabled bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i := b.findLocked(name)
+	if i < 0 {
+		return syserror.ENOENT
+	}
+	b.entries[i].enabled = enabled
+	return nil
+}
+
+// Unregister removes the named entry.
+func (b *BinfmtMisc) Unregister(name string) error {
+	b.mu.Lock()
+	i := b.findLocked(name)
+	if i < 0 {
+		b.mu.Unlock()
+		return syserror.ENOENT
+	}
+	e := b.entries[i]
+	b.entries = append(b.entries[:i], b.entries[i+1:]...)
+	b.mu.Unlock()
+
+	e.release()
+	return nil
+}
+
+// UnregisterAll removes all entries.
+func (b *BinfmtMisc) UnregisterAll() {
+	b.mu.Lock()
+	entries := b.entries
+	b.entries = nil
+	b.mu.Unlock()
+
+	for _, e := range entries {
+		e.release()
+	}
+}
+
+// Enabled returns true if entries may be used.
+func (b *BinfmtMisc) Enabled() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.disabled
+}
+
+// SetEnabled enables or disables the use of all entries.
+func (b *BinfmtMisc) SetEnabled(enabled bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.disabled = !enabled
+}
+
+// matches returns true if e matches the binary at filename, the first bytes
+// of which are in buf.
+func (e *BinfmtMiscEntry) matches(filename string, buf []byte) bool {
+	if e.extension {
+		i := strings.LastIndexByte(filename, '.')
+		return i >= 0 && filename[i+1:] == string(e.magic)
+	}
+	for i, m := range e.magic {
+		diff := buf[e.offset+i] ^ m
+		if e.mask != nil {
+			diff &= e.mask[i]
+		}
+		if diff != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// match returns the enabled entry that matches the binary f at filename, or
+// nil if there is none. If match returns an entry with an interp, it holds a
+// reference on interp that the caller must drop.
+func (b *BinfmtMisc) match(ctx context.Context, filename string, f *fs.File) (*BinfmtMiscEntry, error) {
+	if b == nil {
+		return nil, nil
+	}
+
+	// As in Linux, bytes past the end of the file match zero.
+	buf := make([]byte, binprmBufSize)
+	if _, err := readFull(ctx, f, usermem.BytesIOSequence(buf), 0); err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.disabled {
+		return nil, nil
+	}
+	for i := len(b.entries) - 1; i >= 0; i-- {
+		e := b.entries[i]
+		if e.enabled && e.matches(filename, buf) {
+			if e.interp != nil {
+				e.interp.IncRef()
+			}
+			return e, nil
+		}
+	}
+	return nil, nil
+}
+
+// argv returns the argv with which the interpreter of e executes the binary
+// at filename that was invoked with argv.
+func (e *BinfmtMiscEntry) argv(filename string, argv []string) []string {
+	newargv := []string{e.interpreter, filename}
+	if len(argv) > 0 {
+		if e.preserveArgv0 {
+			newargv = append(newargv, argv...)
+		} else {
+			newargv = append(newargv, argv[1:]...)
+		}
+	}
+	return newargv
+}
@@ -35,6 +35,57 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
 )
 
+// LoadArgs holds specifications for an executable file to be loaded.
+type LoadArgs struct {
+	// MemoryManager is the memory manager to load the executable into.
+	MemoryManager *mm.MemoryManager
+
+	// Mounts is the mount namespace in which to look up Filename.
+	Mounts *fs.MountNamespace
+
+	// Root is the root directory under which to look up Filename.
+	Root *fs.Dirent
+
+	// WorkingDirectory is the working directory under which to look up
+	// Filename.
+	WorkingDirectory *fs.Dirent
+
+	// RemainingTraversals is the maximum number of symlinks to follow to
+	// resolve Filename. This counter is passed by reference to keep it
+	// updated throughout the call stack.
+	RemainingTraversals *uint
+
+	// ResolveFinal indicates whether the final component of Filename
+	// should be resolved if it is a symlink. If it is not, loading a
+	// symlink fails with ELOOP.
+	ResolveFinal bool
+
+	// Filename is the path of the executable.
+	Filename string
+
+	// File, if not nil, is an open file for the executable, which is
+	// loaded instead of looking up Filename. Filename is then only used as
+	// the name of the executable.
+	File *fs.File
+
+	// CloseOnExec indicates that the executable was specified by a file
+	// descriptor with the close-on-exec flag set, and will be inaccessible
+	// by name after exec. As in Linux, executables that must be reopened
+	// by an interpreter, i.e. interpreter scripts and binfmt_misc
+	// binaries, then fail to load with ENOENT.
+	CloseOnExec bool
+
+	// Argv is the vector of arguments to pass to the executable.
+	Argv []string
+
+	// Envv is the vector of environment variables to pass to the
+	// executable.
+	Envv []string
+
+	// Features specifies the CPU feature set for the executable.
+	Features *cpuid.FeatureSet
+}
+
 // readFull behaves like io.ReadFull for an *fs.File.
 func readFull(ctx context.Context, f *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
 	var total int64
@@ -56,19 +107,43 @@ func readFull(ctx context.Context, f *fs.File, dst usermem.IOSequence, offset in
 // openPath returns the fs.Dirent and an *fs.File for name, which is not
 // installed in the Task FDMap. The caller takes ownership of both.
 //
-// name must be a readable, executable, regular file.
-func openPath(ctx context.Context, mm *fs.MountNamespace, root, wd *fs.Dirent, maxTraversals *uint, name string) (*fs.Dirent, *fs.File, error) {
+// name must be a readable, executable, regular file. If resolveFinal is false
+// and the final component of name is a symlink, openPath fails with ELOOP.
+func openPath(ctx context.Context, mm *fs.MountNamespace, root, wd *fs.Dirent, maxTraversals *uint, name string, resolveFinal bool) (*fs.Dirent, *fs.File, error) {
 	if name == "" {
 		ctx.Infof("cannot open empty name")
 		return nil, nil, syserror.ENOENT
 	}
 
-	d, err := mm.FindInode(ctx, root, wd, name, maxTraversals)
+	var (
+		d   *fs.Dirent
+		err error
+	)
+	if resolveFinal {
+		d, err = mm.FindInode(ctx, root, wd, name, maxTraversals)
+	} else {
+		d, err = mm.FindLink(ctx, root, wd, name, maxTraversals)
+	}
 	if err != nil {
 		return nil, nil, err
 	}
 	defer d.DecRef()
 
+	if fs.IsSymlink(d.Inode.StableAttr) {
+		return nil, nil, syserror.ELOOP
+	}
+
+	return openDirent(ctx, d, name)
+}
+
+// openDirent opens d, which was found at name, for loading.
+//
+// openDirent returns d and an *fs.File for d, which is not installed in the
+// Task FDMap. The caller takes ownership of both, and retains its own
+// reference on d.
+//
+// d must be a readable, executable, regular file.
+func openDirent(ctx context.Context, d *fs.Dirent, name string) (*fs.Dirent, *fs.File, error) {
 	perms := fs.PermMask{
 		// TODO: Linux requires only execute permission,
 		// not read. However, our backing filesystems may prevent us
@@ -131,20 +206,30 @@ const (
 	maxLoaderAttempts = 6
 )
 
-// loadPath resolves filename to a binary and loads it.
+// loadBinary resolves the executable described by args to a binary and loads
+// it.
 //
 // It returns:
 //  * loadedELF, description of the loaded binary
 //  * arch.Context matching the binary arch
 //  * fs.Dirent of the binary file
 //  * Possibly updated argv
-func loadPath(ctx context.Context, m *mm.MemoryManager, mounts *fs.MountNamespace, root, wd *fs.Dirent, remainingTraversals *uint, fs *cpuid.FeatureSet, filename string, argv []string) (loadedELF, arch.Context, *fs.Dirent, []string, error) {
+func loadBinary(ctx context.Context, args LoadArgs, misc *BinfmtMisc) (loadedELF, arch.Context, *fs.Dirent, []string, error) {
+	filename := args.Filename
+	argv := args.Argv
+	// e, if not nil, is the binfmt_misc entry whose interpreter is at
+	// filename.
+	var e *BinfmtMiscEntry
 	for i := 0; i < maxLoaderAttempts; i++ {
-		d, f, err := openPath(ctx, mounts, root, wd, remainingTraversals, filename)
+		d, f, err := openBinary(ctx, args, e, filename)
+		e = nil
 		if err != nil {
 			ctx.Infof("Error opening %s: %v", filename, err)
 			return loadedELF{}, nil, nil, nil, err
 		}
+		// Interpreters are always looked up by name, following symlinks.
+		args.File = nil
+		args.ResolveFinal = true
 		defer f.DecRef()
 		// We will return d in the successful case, but defer a DecRef
 		// for intermediate loops and failure cases.
@@ -164,8 +249,8 @@ func loadPath(ctx context.Context, m *mm.MemoryManager, mounts *fs.MountNamespac
 		}
 
 		switch {
-		case bytes.Equal(hdr[:], []byte(elfMagic)):
-			loaded, ac, err := loadELF(ctx, m, mounts, root, wd, remainingTraversals, fs, f)
+		case bytes.Equal(hdr[:], []byte(elfMagic)) && !foreignELF(ctx, misc, filename, f):
+			loaded, ac, err := loadELF(ctx, args.MemoryManager, args.Mounts, args.Root, args.WorkingDirectory, args.RemainingTraversals, args.Features, f)
 			if err != nil {
 				ctx.Infof("Error loading ELF: %v", err)
 				return loadedELF{}, nil, nil, nil, err
@@ -174,6 +259,9 @@ func loadPath(ctx context.Context, m *mm.MemoryManager, mounts *fs.MountNamespac
 			d.IncRef()
 			return loaded, ac, d, argv, err
 		case bytes.Equal(hdr[:2], []byte(interpreterScriptMagic)):
+			if args.CloseOnExec {
+				return loadedELF{}, nil, nil, nil, syserror.ENOENT
+			}
 			newpath, newargv, err := parseInterpreterScript(ctx, filename, f, argv)
 			if err != nil {
 				ctx.Infof("Error loading interpreter script: %v", err)
@@ -182,25 +270,83 @@ func loadPath(ctx context.Context, m *mm.MemoryManager, mounts *fs.MountNamespac
 			filename = newpath
 			argv = newargv
 		default:
-			ctx.Infof("Unknown magic: %v", hdr)
-			return loadedELF{}, nil, nil, nil, syserror.ENOEXEC
+			e, err = misc.match(ctx, filename, f)
+			if err != nil {
+				return loadedELF{}, nil, nil, nil, err
+			}
+			if e == nil {
+				ctx.Infof("Unknown magic: %v", hdr)
+				return loadedELF{}, nil, nil, nil, syserror.ENOEXEC
+			}
+			if args.CloseOnExec {
+				if e.interp != nil {
+					e.interp.DecRef()
+				}
+				return loadedELF{}, nil, nil, nil, syserror.ENOENT
+			}
+			argv = e.argv(filename, argv)
+			filename = e.interpreter
 		}
 	}
 
+	if e != nil && e.interp != nil {
+		e.interp.DecRef()
+	}
 	return loadedELF{}, nil, nil, nil, syserror.ELOOP
 }
 
-// Load loads filename into a MemoryManager.
+// openBinary opens the binary at filename for loading, as with openPath. If
+// args.File is not nil, its Dirent is opened instead. If e is not nil and its
+// interpreter, at filename, was opened when it was registered, that file is
+// opened instead, and the reference on it returned by BinfmtMisc.match is
+// dropped.
+func openBinary(ctx context.Context, args LoadArgs, e *BinfmtMiscEntry, filename string) (*fs.Dirent, *fs.File, error) {
+	switch {
+	case e != nil && e.interp != nil:
+		defer e.interp.DecRef()
+		return openDirent(ctx, e.interp, filename)
+	case args.File != nil:
+		return openDirent(ctx, args.File.Dirent, filename)
+	default:
+		return openPath(ctx, args.Mounts, args.Root, args.WorkingDirectory, args.RemainingTraversals, filename, args.ResolveFinal)
+	}
+}
+
+// foreignELF returns true if f is an ELF binary that cannot be loaded
+// natively, e.g. because it is for another architecture, and misc has an entry
+// to execute it.
+func foreignELF(ctx context.Context, misc *BinfmtMisc, filename string, f *fs.File) bool {
+	if _, err := parseHeader(ctx, f); err != syserror.ENOEXEC {
+		return false
+	}
+	e, err := misc.match(ctx, filename, f)
+	if err != nil || e == nil {
+		return false
+	}
+	if e.interp != nil {
+		e.interp.DecRef()
+	}
+	return true
+}
+
+// Load loads args.Filename into args.MemoryManager.
 //
 // If Load returns ErrSwitchFile it should be called again with the returned
 // path and argv.
 //
+// Binaries that are not ELF binaries or interpreter scripts, or that are ELF
+// binaries that cannot be loaded natively, are executed by the interpreter of
+// the matching binfmt_misc entry in misc, which may be nil.
+//
 // Preconditions:
 //  * The Task MemoryManager is empty.
 //  * Load is called on the Task goroutine.
-func Load(ctx context.Context, m *mm.MemoryManager, mounts *fs.MountNamespace, root, wd *fs.Dirent, maxTraversals *uint, fs *cpuid.FeatureSet, filename string, argv, envv []string, extraAuxv []arch.AuxEntry, vdso *VDSO) (abi.OS, arch.Context, string, *syserr.Error) {
+func Load(ctx context.Context, args LoadArgs, extraAuxv []arch.AuxEntry, vdso *VDSO, misc *BinfmtMisc) (abi.OS, arch.Context, string, *syserr.Error) {
+	m := args.MemoryManager
+	filename := args.Filename
+
 	// Load the binary itself.
-	loaded, ac, d, argv, err := loadPath(ctx, m, mounts, root, wd, maxTraversals, fs, filename, argv)
+	loaded, ac, d, argv, err := loadBinary(ctx, args, misc)
 	if err != nil {
 		return 0, nil, "", syserr.NewDynamic(fmt.Sprintf("Failed to load %s: %v", filename, err), syserr.FromError(err).ToLinux())
 	}
@@ -259,7 +405,7 @@ func Load(ctx context.Context, m *mm.MemoryManager, mounts *fs.MountNamespace, r
 	}...)
 	auxv = append(auxv, extraAuxv...)
 
-	sl, err := stack.Load(argv, envv, auxv)
+	sl, err := stack.Load(argv, args.Envv, auxv)
 	if err != nil {
 		return 0, nil, "", syserr.NewDynamic(fmt.Sprintf("Failed to load stack: %v", err), syserr.FromError(err).ToLinux())
 	}
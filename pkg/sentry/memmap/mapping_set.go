@@ -43,8 +43,44 @@ type MappingOfRange struct {
 	Writable     bool
 }
 
-func (r MappingOfRange) invalidate(opts InvalidateOpts) {
-	r.MappingSpace.Invalidate(r.AddrRange, opts)
+// invalidationBatch collects the AddrRanges to be invalidated in each
+// MappingSpace, so that each MappingSpace is invalidated only once.
+type invalidationBatch struct {
+	// spaces contains each MappingSpace in ranges, in the order in which they
+	// were first added.
+	spaces []MappingSpace
+
+	// ranges maps each MappingSpace to the AddrRanges to invalidate in it.
+	ranges map[MappingSpace][]usermem.AddrRange
+}
+
+// add adds the invalidation of r to b, merging it with the previous
+// invalidation of r.MappingSpace if they are contiguous.
+func (b *invalidationBatch) add(r MappingOfRange) {
+	if b.ranges == nil {
+		b.ranges = make(map[MappingSpace][]usermem.AddrRange)
+	}
+	ars, ok := b.ranges[r.MappingSpace]
+	if !ok {
+		b.spaces = append(b.spaces, r.MappingSpace)
+	}
+	if n := len(ars); n != 0 && ars[n-1].End == r.AddrRange.Start {
+		ars[n-1].End = r.AddrRange.End
+	} else {
+		ars = append(ars, r.AddrRange)
+	}
+	b.ranges[r.MappingSpace] = ars
+}
+
+// invalidate invalidates all ranges in b.
+func (b *invalidationBatch) invalidate(opts InvalidateOpts) {
+	for _, ms := range b.spaces {
+		if ars := b.ranges[ms]; len(ars) == 1 {
+			ms.Invalidate(ars[0], opts)
+		} else {
+			ms.InvalidateRanges(ars, opts)
+		}
+	}
 }
 
 // String implements fmt.Stringer.String.
@@ -232,22 +268,27 @@ func (s *MappingSet) RemoveMapping(ms MappingSpace, ar usermem.AddrRange, offset
 	return unmapped
 }
 
-// Invalidate calls MappingSpace.Invalidate for all mappings of offsets in mr.
+// Invalidate invalidates all mappings of offsets in mr. Each MappingSpace is
+// invalidated once, by MappingSpace.Invalidate if only one range of it maps
+// offsets in mr and by MappingSpace.InvalidateRanges otherwise.
 func (s *MappingSet) Invalidate(mr MappableRange, opts InvalidateOpts) {
+	var b invalidationBatch
 	for seg := s.LowerBoundSegment(mr.Start); seg.Ok() && seg.Start() < mr.End; seg = seg.NextSegment() {
 		segMR := seg.Range()
 		for m := range seg.Value() {
-			region := subsetMapping(segMR, segMR.Intersect(mr), m.MappingSpace, m.AddrRange.Start, m.Writable)
-			region.invalidate(opts)
+			b.add(subsetMapping(segMR, segMR.Intersect(mr), m.MappingSpace, m.AddrRange.Start, m.Writable))
 		}
 	}
+	b.invalidate(opts)
 }
 
-// InvalidateAll calls MappingSpace.Invalidate for all mappings of s.
+// InvalidateAll invalidates all mappings of s, as for Invalidate.
 func (s *MappingSet) InvalidateAll(opts InvalidateOpts) {
+	var b invalidationBatch
 	for seg := s.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
 		for m := range seg.Value() {
-			m.invalidate(opts)
+			b.add(m)
 		}
 	}
+	b.invalidate(opts)
 }
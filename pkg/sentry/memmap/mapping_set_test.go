@@ -36,6 +36,10 @@ func (n *testMappingSpace) Invalidate(ar usermem.AddrRange, opts InvalidateOpts)
 	n.inv = append(n.inv, ar)
 }
 
+func (n *testMappingSpace) InvalidateRanges(ars []usermem.AddrRange, opts InvalidateOpts) {
+	n.inv = append(n.inv, ars...)
+}
+
 func TestAddRemoveMapping(t *testing.T) {
 	set := MappingSet{}
 	ms := &testMappingSpace{}
@@ -185,6 +189,28 @@ func TestInvalidateOverlappingMappings(t *testing.T) {
 	}
 }
 
+func TestInvalidateMergesSplitMapping(t *testing.T) {
+	set := MappingSet{}
+	ms1 := &testMappingSpace{}
+	ms2 := &testMappingSpace{}
+
+	set.AddMapping(ms1, usermem.AddrRange{0x10000, 0x13000}, 0, true)
+	set.AddMapping(ms2, usermem.AddrRange{0x20000, 0x21000}, 0x1000, true)
+	// Mappings:
+	// ms1:[0x10000, 0x13000) => [0, 0x3000)
+	// ms2:[0x20000, 0x21000) => [0x1000, 0x2000)
+	t.Log(&set)
+	set.Invalidate(MappableRange{0, 0x3000}, InvalidateOpts{})
+	// ms1's mapping spans three segments of set, but is invalidated as one
+	// range.
+	if got, want := ms1.inv, []usermem.AddrRange{{0x10000, 0x13000}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Invalidate: ms1: got %+v, wanted %+v", got, want)
+	}
+	if got, want := ms2.inv, []usermem.AddrRange{{0x20000, 0x21000}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Invalidate: ms2: got %+v, wanted %+v", got, want)
+	}
+}
+
 func TestMixedWritableMappings(t *testing.T) {
 	set := MappingSet{}
 	ms := &testMappingSpace{}
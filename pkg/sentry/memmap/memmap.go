@@ -95,6 +95,21 @@ type Mappable interface {
 	InvalidateUnsavable(ctx context.Context) error
 }
 
+// ResidencyMappable is an optional interface that may be implemented by
+// Mappables that can report which of their pages are resident in memory, as
+// for mincore(2). Pages of Mappables that do not implement ResidencyMappable
+// are assumed to always be resident.
+type ResidencyMappable interface {
+	// Residency sets dst[i] to 1 if the page at offset mr.Start +
+	// i*usermem.PageSize is resident in memory, and 0 otherwise.
+	//
+	// Preconditions: mr must be page-aligned and non-empty. len(dst) must be
+	// at least mr.Length() / usermem.PageSize. The caller must have
+	// established a mapping for all of the queried offsets via a previous
+	// call to AddMapping.
+	Residency(ctx context.Context, mr MappableRange, dst []byte) error
+}
+
 // Translations are returned by Mappable.Translate.
 type Translation struct {
 	// Source is the translated range in the Mappable.
@@ -217,6 +232,17 @@ type MappingSpace interface {
 	//
 	// Preconditions: ar.Length() != 0. ar must be page-aligned.
 	Invalidate(ar usermem.AddrRange, opts InvalidateOpts)
+
+	// InvalidateRanges is equivalent to calling Invalidate for each range in
+	// ars, but allows the MappingSpace to amortize the cost of invalidation
+	// across all ranges, e.g. by coalescing host unmappings.
+	//
+	// InvalidateRanges must not take any locks preceding
+	// mm.MemoryManager.activeMu in the lock order.
+	//
+	// Preconditions: len(ars) != 0. For all ar in ars, ar.Length() != 0 and
+	// ar must be page-aligned.
+	InvalidateRanges(ars []usermem.AddrRange, opts InvalidateOpts)
 }
 
 // InvalidateOpts holds options to MappingSpace.Invalidate.
@@ -318,7 +344,9 @@ type MMapOpts struct {
 	Fixed bool
 
 	// Unmap specifies whether existing mappings in the range being mapped may
-	// be replaced. If Unmap is true, Fixed must be true.
+	// be replaced. If Unmap is true, Fixed must be true. If Fixed is true and
+	// Unmap is false, mapping fails with EEXIST if existing mappings overlap
+	// the range, as for Linux's MAP_FIXED_NOREPLACE.
 	Unmap bool
 
 	// If Map32Bit is true, all addresses in the created mapping must fit in a
@@ -346,10 +374,21 @@ type MMapOpts struct {
 	// downward on guard page faults.
 	GrowsDown bool
 
+	// WipeOnFork is true if the mapping's contents should not be copied to
+	// the child of a fork; instead, the child's mapping is zero-filled. If
+	// WipeOnFork is true, Mappable must be nil and Private must be true.
+	WipeOnFork bool
+
 	// Precommit is true if the platform should eagerly commit resources to the
 	// mapping (see platform.AddressSpace.MapFile).
 	Precommit bool
 
+	// Hugetlb is true if the mapping should be backed by huge pages, as for
+	// Linux's MAP_HUGETLB. The mapping's address, length, and offset must be
+	// aligned to usermem.HugePageSize, and the mapping can't be split at
+	// unaligned addresses.
+	Hugetlb bool
+
 	// MLockMode specifies the memory locking behavior of the mapping.
 	MLockMode MLockMode
 
@@ -98,6 +98,14 @@ func (mm *MemoryManager) Activate() error {
 			continue
 		}
 
+		// Platforms don't retain LDT entries across AddressSpaces, so install
+		// them now.
+		if err := mm.installLDTLocked(as); err != nil {
+			as.Release()
+			mm.activeMu.Unlock()
+			return err
+		}
+
 		// Okay, we could restore all mappings at this point.
 		// But forget that. Let's just let them fault in.
 		mm.as = as
@@ -45,7 +45,7 @@ func NewMemoryManager(p platform.Platform, mfp pgalloc.MemoryFileProvider) *Memo
 //
 // Preconditions: mm contains no mappings and is not used concurrently.
 func (mm *MemoryManager) SetMmapLayout(ac arch.Context, r *limits.LimitSet) (arch.MmapLayout, error) {
-	layout, err := ac.NewMmapLayout(mm.p.MinUserAddress(), mm.p.MaxUserAddress(), r)
+	layout, err := ac.NewMmapLayout(mm.p.MinUserAddress(), mm.p.MaxUserAddress(), r, mm.layoutOpts)
 	if err != nil {
 		return arch.MmapLayout{}, err
 	}
@@ -53,6 +53,42 @@ func (mm *MemoryManager) SetMmapLayout(ac arch.Context, r *limits.LimitSet) (arc
 	return layout, nil
 }
 
+// DisableVsyscall prevents calls to the legacy vsyscall page from being
+// emulated for mm and all MemoryManagers forked from it, as for Linux's
+// vsyscall=none.
+//
+// Preconditions: mm is not used concurrently.
+func (mm *MemoryManager) DisableVsyscall() {
+	mm.vsyscallDisabled = true
+}
+
+// VsyscallEnabled returns true if calls to the legacy vsyscall page should be
+// emulated for mm.
+func (mm *MemoryManager) VsyscallEnabled() bool {
+	return !mm.vsyscallDisabled
+}
+
+// SetMmapLayoutOptions sets the options used by SetMmapLayout.
+//
+// Preconditions: mm contains no mappings and is not used concurrently.
+func (mm *MemoryManager) SetMmapLayoutOptions(opts arch.MmapLayoutOptions) {
+	mm.layoutOpts = opts
+}
+
+// MmapLayoutOptions returns the options used to construct mm's layout.
+func (mm *MemoryManager) MmapLayoutOptions() arch.MmapLayoutOptions {
+	return mm.layoutOpts
+}
+
+// EnableHostMLock causes memory locked by mlock(2), mlockall(2), or
+// MAP_LOCKED to also be locked into host memory, so that it is not swapped
+// out by the host.
+//
+// Preconditions: mm is not used concurrently.
+func (mm *MemoryManager) EnableHostMLock() {
+	mm.hostMLock = true
+}
+
 // Fork creates a copy of mm with 1 user, as for Linux syscalls fork() or
 // clone() (without CLONE_VM).
 func (mm *MemoryManager) Fork(ctx context.Context) (*MemoryManager, error) {
@@ -78,15 +114,22 @@ func (mm *MemoryManager) Fork(ctx context.Context) (*MemoryManager, error) {
 		envv:                 mm.envv,
 		auxv:                 append(arch.Auxv(nil), mm.auxv...),
 		// IncRef'd below, once we know that there isn't an error.
-		executable: mm.executable,
-		aioManager: aioManager{contexts: make(map[uint64]*AIOContext)},
+		executable:       mm.executable,
+		aioManager:       aioManager{contexts: make(map[uint64]*AIOContext)},
+		vsyscallDisabled: mm.vsyscallDisabled,
+		layoutOpts:       mm.layoutOpts,
+		hostMLock:        mm.hostMLock,
 	}
 
 	// Copy vmas.
+	var wipeARs []usermem.AddrRange
 	dstvgap := mm2.vmas.FirstGap()
 	for srcvseg := mm.vmas.FirstSegment(); srcvseg.Ok(); srcvseg = srcvseg.NextSegment() {
 		vma := srcvseg.Value() // makes a copy of the vma
 		vmaAR := srcvseg.Range()
+		if vma.wipeOnFork {
+			wipeARs = append(wipeARs, vmaAR)
+		}
 		// Inform the Mappable, if any, of the new mapping.
 		if vma.mappable != nil {
 			if err := vma.mappable.AddMapping(ctx, mm2, vmaAR, vma.off, vma.canWriteMappableLocked()); err != nil {
@@ -115,6 +158,16 @@ func (mm *MemoryManager) Fork(ctx context.Context) (*MemoryManager, error) {
 	defer mm2.activeMu.Unlock()
 	mm.activeMu.Lock()
 	defer mm.activeMu.Unlock()
+	// The child inherits the parent's LDT, as in Linux's
+	// arch/x86/kernel/ldt.c:ldt_dup_context().
+	mm2.ldt = mm.ldt.Fork()
+	// pmas in wipe-on-fork vmas are not copied, leaving the child to fault
+	// in zero-filled memory. Split pmas at the boundaries of such vmas so
+	// that each pma is either entirely wiped or entirely copied.
+	for _, ar := range wipeARs {
+		mm.pmas.SplitAt(ar.Start)
+		mm.pmas.SplitAt(ar.End)
+	}
 	dstpgap := mm2.pmas.FirstGap()
 	var unmapAR usermem.AddrRange
 	for srcpseg := mm.pmas.FirstSegment(); srcpseg.Ok(); srcpseg = srcpseg.NextSegment() {
@@ -122,6 +175,12 @@ func (mm *MemoryManager) Fork(ctx context.Context) (*MemoryManager, error) {
 		if !pma.private {
 			continue
 		}
+		if len(wipeARs) != 0 && mm.vmas.FindSegment(srcpseg.Start()).ValuePtr().wipeOnFork {
+			continue
+		}
+		// Memory shared with mm2 can't be discarded without mm2 observing
+		// it, so cancel MADV_FREE.
+		pma.lazyFree = false
 		if !pma.needCOW {
 			pma.needCOW = true
 			if pma.effectivePerms.Write {
@@ -148,7 +207,10 @@ func (mm *MemoryManager) Fork(ctx context.Context) (*MemoryManager, error) {
 		srcpseg.ValuePtr().file.IncRef(fr)
 		addrRange := srcpseg.Range()
 		mm2.addRSSLocked(addrRange)
-		dstpgap = mm2.pmas.Insert(dstpgap, addrRange, *pma).NextGap()
+		// mm2's vmas are not locked, so its pmas aren't either.
+		pma2 := *pma
+		pma2.hostLocked = false
+		dstpgap = mm2.pmas.Insert(dstpgap, addrRange, pma2).NextGap()
 	}
 	if unmapAR.Length() != 0 {
 		mm.unmapASLocked(unmapAR)
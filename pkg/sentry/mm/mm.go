@@ -175,6 +175,12 @@ type MemoryManager struct {
 	// invalidations should be propagated immediately.
 	unmapAllOnActivate bool `state:"nosave"`
 
+	// ldt is the local descriptor table installed by modify_ldt(2). ldt is
+	// installed in as whenever as is non-nil.
+	//
+	// ldt is protected by activeMu.
+	ldt arch.LDT
+
 	// If captureInvalidations is true, calls to MM.Invalidate() are recorded
 	// in capturedInvalidations rather than being applied immediately to pmas.
 	// This is to avoid a race condition in MM.Fork(); see that function for
@@ -216,6 +222,20 @@ type MemoryManager struct {
 	// aioManager keeps track of AIOContexts used for async IOs. AIOManager
 	// must be cloned when CLONE_VM is used.
 	aioManager aioManager
+
+	// If vsyscallDisabled is true, calls to the legacy vsyscall page are not
+	// emulated, and the page is not advertised in /proc/[pid]/maps.
+	// vsyscallDisabled is immutable after the MemoryManager is first used.
+	vsyscallDisabled bool
+
+	// layoutOpts controls the construction of layout and the placement of
+	// mm's executable. layoutOpts is immutable after the MemoryManager is
+	// first used.
+	layoutOpts arch.MmapLayoutOptions
+
+	// If hostMLock is true, memory in locked vmas is also locked into host
+	// memory. hostMLock is immutable after the MemoryManager is first used.
+	hostMLock bool
 }
 
 // vma represents a virtual memory area.
@@ -262,8 +282,23 @@ type vma struct {
 	// metag, none of which we currently support.
 	growsDown bool `state:"manual"`
 
+	// wipeOnFork is true if the mapping is zero-filled, rather than copied,
+	// in the child of a fork. If wipeOnFork is true, mappable must be nil.
+	wipeOnFork bool
+
+	// hugetlb is true if the mapping is backed by huge pages. If hugetlb is
+	// true, the vma's bounds are aligned to usermem.HugePageSize.
+	hugetlb bool
+
 	mlockMode memmap.MLockMode
 
+	// numaPolicy is the NUMA policy for this vma set by mbind(2), with the
+	// MPOL_MODE_FLAGS, and numaNodemask is its node mask. Since the
+	// sandbox has a single NUMA node, the policy has no effect on memory
+	// allocation; it is only tracked so that get_mempolicy(2) can report it.
+	numaPolicy   int32
+	numaNodemask uint32
+
 	// If id is not nil, it controls the lifecycle of mappable and provides vma
 	// metadata shown in /proc/[pid]/maps, and the vma holds a reference.
 	id memmap.MappingIdentity
@@ -407,6 +442,19 @@ type pma struct {
 	// corresponding vma's memmap.Mappable.Translate.
 	private bool
 
+	// lazyFree is true if this pma has been freed by madvise(MADV_FREE) and
+	// not written since, such that its contents may be discarded by
+	// MemoryManager.ReclaimLazyFree. lazyFree may only be true if private is
+	// true and needCOW is false. If lazyFree is true, effectivePerms.Write and
+	// maxPerms.Write are false, so that writes to the pma cause it to be
+	// returned to use by MemoryManager.getPMAsLocked.
+	lazyFree bool
+
+	// hostLocked is true if the memory mapped by this pma has been locked
+	// into host memory by MemoryFile.HostMLock. hostLocked may only be true
+	// if file is MemoryManager.mfp.MemoryFile().
+	hostLocked bool `state:"nosave"`
+
 	// If internalMappings is not empty, it is the cached return value of
 	// file.MapInternal for the platform.FileRange mapped by this pma.
 	internalMappings safemem.BlockSeq `state:"nosave"`
@@ -15,8 +15,12 @@
 package mm
 
 import (
+	"bytes"
+	"sync"
+	"sync/atomic"
 	"testing"
 
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context/contexttest"
@@ -174,3 +178,429 @@ func TestIOAfterMProtect(t *testing.T) {
 		t.Errorf("CopyOut got %d want 1", n)
 	}
 }
+
+// TestNumaPolicy tests that NUMA policies apply to the requested range only.
+func TestNumaPolicy(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	addr, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   3 * usermem.PageSize,
+		Private:  true,
+		Perms:    usermem.ReadWrite,
+		MaxPerms: usermem.AnyAccess,
+	})
+	if err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+
+	if err := mm.SetNumaPolicy(addr+usermem.PageSize, usermem.PageSize, linux.MPOL_BIND, 1); err != nil {
+		t.Fatalf("SetNumaPolicy got err %v want nil", err)
+	}
+	for i, want := range []int32{linux.MPOL_DEFAULT, linux.MPOL_BIND, linux.MPOL_DEFAULT} {
+		policy, _, err := mm.NumaPolicy(addr + usermem.Addr(i)*usermem.PageSize)
+		if err != nil {
+			t.Fatalf("NumaPolicy(page %d) got err %v want nil", i, err)
+		}
+		if policy != want {
+			t.Errorf("NumaPolicy(page %d) got policy %d want %d", i, policy, want)
+		}
+	}
+
+	// Resetting the policy merges the vmas again.
+	if err := mm.SetNumaPolicy(addr+usermem.PageSize, usermem.PageSize, linux.MPOL_DEFAULT, 0); err != nil {
+		t.Fatalf("SetNumaPolicy got err %v want nil", err)
+	}
+	var n int
+	for vseg := mm.vmas.FirstSegment(); vseg.Ok(); vseg = vseg.NextSegment() {
+		n++
+	}
+	if n != 1 {
+		t.Errorf("got %d vmas want 1", n)
+	}
+
+	// Holes in the range fail without modifying any vma.
+	if err := mm.MUnmap(ctx, addr+usermem.PageSize, usermem.PageSize); err != nil {
+		t.Fatalf("MUnmap got err %v want nil", err)
+	}
+	if err := mm.SetNumaPolicy(addr, 3*usermem.PageSize, linux.MPOL_BIND, 1); err != syserror.EFAULT {
+		t.Errorf("SetNumaPolicy got err %v want EFAULT", err)
+	}
+	if policy, _, _ := mm.NumaPolicy(addr); policy != linux.MPOL_DEFAULT {
+		t.Errorf("NumaPolicy got policy %d want %d", policy, linux.MPOL_DEFAULT)
+	}
+	if _, _, err := mm.NumaPolicy(addr + usermem.PageSize); err != syserror.EFAULT {
+		t.Errorf("NumaPolicy(hole) got err %v want EFAULT", err)
+	}
+}
+
+// TestMMapFixedNoReplace tests that fixed mappings that may not replace
+// existing mappings fail with EEXIST.
+func TestMMapFixedNoReplace(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	addr, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   usermem.PageSize,
+		Private:  true,
+		Perms:    usermem.ReadWrite,
+		MaxPerms: usermem.AnyAccess,
+	})
+	if err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+
+	_, err = mm.MMap(ctx, memmap.MMapOpts{
+		Length:   usermem.PageSize,
+		Addr:     addr,
+		Fixed:    true,
+		Private:  true,
+		Perms:    usermem.ReadWrite,
+		MaxPerms: usermem.AnyAccess,
+	})
+	if err != syserror.EEXIST {
+		t.Errorf("MMap over existing mapping got err %v want EEXIST", err)
+	}
+}
+
+// TestMRemapDontUnmap tests that MRemap with DontUnmap moves pages to the new
+// mapping while leaving the old mapping in place.
+func TestMRemapDontUnmap(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	oldAddr, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   usermem.PageSize,
+		Private:  true,
+		Perms:    usermem.ReadWrite,
+		MaxPerms: usermem.AnyAccess,
+	})
+	if err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+	if _, err := mm.CopyOut(ctx, oldAddr, []byte{'a'}, usermem.IOOpts{}); err != nil {
+		t.Fatalf("CopyOut got err %v want nil", err)
+	}
+
+	newAddr, err := mm.MRemap(ctx, oldAddr, usermem.PageSize, usermem.PageSize, MRemapOpts{
+		Move:      MRemapMayMove,
+		DontUnmap: true,
+	})
+	if err != nil {
+		t.Fatalf("MRemap got err %v want nil", err)
+	}
+	if newAddr == oldAddr {
+		t.Fatalf("MRemap did not move mapping at %#x", oldAddr)
+	}
+	if realUsage := mm.realUsageAS(); mm.usageAS != realUsage || realUsage != 2*usermem.PageSize {
+		t.Errorf("usageAS believes %v bytes are mapped; %v bytes are actually mapped, want %v", mm.usageAS, realUsage, 2*usermem.PageSize)
+	}
+
+	for _, test := range []struct {
+		addr usermem.Addr
+		want byte
+	}{
+		{newAddr, 'a'},
+		{oldAddr, 0},
+	} {
+		b := make([]byte, 1)
+		if _, err := mm.CopyIn(ctx, test.addr, b, usermem.IOOpts{}); err != nil {
+			t.Errorf("CopyIn(%#x) got err %v want nil", test.addr, err)
+			continue
+		}
+		if b[0] != test.want {
+			t.Errorf("CopyIn(%#x) got %q want %q", test.addr, b[0], test.want)
+		}
+	}
+}
+
+func TestLazyFree(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	addr, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   2 * usermem.PageSize,
+		Private:  true,
+		Perms:    usermem.ReadWrite,
+		MaxPerms: usermem.AnyAccess,
+	})
+	if err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+	freedAddr := addr
+	writtenAddr := addr + usermem.PageSize
+	for _, a := range []usermem.Addr{freedAddr, writtenAddr} {
+		if _, err := mm.CopyOut(ctx, a, []byte{'a'}, usermem.IOOpts{}); err != nil {
+			t.Fatalf("CopyOut(%#x) got err %v want nil", a, err)
+		}
+	}
+
+	if err := mm.LazyFree(addr, 2*usermem.PageSize); err != nil {
+		t.Fatalf("LazyFree got err %v want nil", err)
+	}
+
+	// Until reclaimed, lazily-freed memory retains its contents.
+	b := make([]byte, 1)
+	if _, err := mm.CopyIn(ctx, freedAddr, b, usermem.IOOpts{}); err != nil {
+		t.Fatalf("CopyIn(%#x) got err %v want nil", freedAddr, err)
+	}
+	if b[0] != 'a' {
+		t.Errorf("CopyIn(%#x) before reclaim got %q want %q", freedAddr, b[0], 'a')
+	}
+
+	// Writing cancels the free.
+	if _, err := mm.CopyOut(ctx, writtenAddr, []byte{'b'}, usermem.IOOpts{}); err != nil {
+		t.Fatalf("CopyOut(%#x) got err %v want nil", writtenAddr, err)
+	}
+
+	if got, want := mm.ReclaimLazyFree(), uint64(usermem.PageSize); got != want {
+		t.Errorf("ReclaimLazyFree got %d want %d", got, want)
+	}
+
+	for _, test := range []struct {
+		addr usermem.Addr
+		want byte
+	}{
+		{freedAddr, 0},
+		{writtenAddr, 'b'},
+	} {
+		if _, err := mm.CopyIn(ctx, test.addr, b, usermem.IOOpts{}); err != nil {
+			t.Errorf("CopyIn(%#x) got err %v want nil", test.addr, err)
+			continue
+		}
+		if b[0] != test.want {
+			t.Errorf("CopyIn(%#x) got %q want %q", test.addr, b[0], test.want)
+		}
+	}
+}
+
+func TestMincore(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	addr, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   2 * usermem.PageSize,
+		Private:  true,
+		Perms:    usermem.ReadWrite,
+		MaxPerms: usermem.AnyAccess,
+	})
+	if err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+	ar := usermem.AddrRange{addr, addr + 2*usermem.PageSize}
+
+	// Untouched private anonymous memory is not resident.
+	vec, err := mm.Mincore(ctx, ar)
+	if err != nil {
+		t.Fatalf("Mincore got err %v want nil", err)
+	}
+	if want := []byte{0, 0}; !bytes.Equal(vec, want) {
+		t.Errorf("Mincore before write got %v want %v", vec, want)
+	}
+
+	// Writing to the first page makes only that page resident, even though
+	// memory for both pages may be allocated.
+	if _, err := mm.CopyOut(ctx, addr, []byte{'a'}, usermem.IOOpts{}); err != nil {
+		t.Fatalf("CopyOut got err %v want nil", err)
+	}
+	vec, err = mm.Mincore(ctx, ar)
+	if err != nil {
+		t.Fatalf("Mincore got err %v want nil", err)
+	}
+	if want := []byte{1, 0}; !bytes.Equal(vec, want) {
+		t.Errorf("Mincore after write got %v want %v", vec, want)
+	}
+
+	// Unmapped memory is an error.
+	if _, err := mm.Mincore(ctx, usermem.AddrRange{addr, addr + 3*usermem.PageSize}); err != syserror.ENOMEM {
+		t.Errorf("Mincore of unmapped range got err %v want %v", err, syserror.ENOMEM)
+	}
+}
+
+// testAddressSpace is a platform.AddressSpace that only counts the pages
+// mapped into it.
+type testAddressSpace struct {
+	// AddressSpaceIO is nil; MemoryManagers using testAddressSpace must not
+	// use AddressSpace I/O.
+	platform.AddressSpace
+
+	// mapped is the number of pages mapped by MapFile, and is accessed
+	// using atomic memory operations.
+	mapped int64
+}
+
+// MapFile implements platform.AddressSpace.MapFile.
+func (as *testAddressSpace) MapFile(addr usermem.Addr, f platform.File, fr platform.FileRange, at usermem.AccessType, precommit bool) error {
+	atomic.AddInt64(&as.mapped, int64(fr.Length()/usermem.PageSize))
+	return nil
+}
+
+// Unmap implements platform.AddressSpace.Unmap.
+func (*testAddressSpace) Unmap(addr usermem.Addr, length uint64) {}
+
+// Release implements platform.AddressSpace.Release.
+func (*testAddressSpace) Release() {}
+
+// faultPages calls mm.HandleUserFault on each page of the given ranges, with
+// one goroutine per range.
+func faultPages(ctx context.Context, mm *MemoryManager, ars []usermem.AddrRange) error {
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+	)
+	for _, ar := range ars {
+		wg.Add(1)
+		go func(ar usermem.AddrRange) {
+			defer wg.Done()
+			for addr := ar.Start; addr < ar.End; addr += usermem.PageSize {
+				if err := mm.HandleUserFault(ctx, addr, usermem.Write, 0); err != nil {
+					errMu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errMu.Unlock()
+					return
+				}
+			}
+		}(ar)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+func TestConcurrentFaults(t *testing.T) {
+	const (
+		ranges        = 8
+		pagesPerRange = 64
+	)
+	ctx := contexttest.Context(t)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+	as := &testAddressSpace{}
+	mm.as = as
+
+	length := uint64(ranges * pagesPerRange * usermem.PageSize)
+	addr, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   length,
+		Private:  true,
+		Perms:    usermem.ReadWrite,
+		MaxPerms: usermem.AnyAccess,
+	})
+	if err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+	var ars []usermem.AddrRange
+	for i := 0; i < ranges; i++ {
+		start := addr + usermem.Addr(i*pagesPerRange*usermem.PageSize)
+		ars = append(ars, usermem.AddrRange{start, start + pagesPerRange*usermem.PageSize})
+	}
+
+	// Faults on disjoint ranges create pmas for all pages.
+	if err := faultPages(ctx, mm, ars); err != nil {
+		t.Fatalf("HandleUserFault got err %v want nil", err)
+	}
+	if got, want := atomic.LoadInt64(&as.mapped), int64(ranges*pagesPerRange); got != want {
+		t.Errorf("got %d pages mapped, want %d", got, want)
+	}
+	mm.activeMu.RLock()
+	pseg := mm.existingPMAsLocked(usermem.AddrRange{addr, addr + usermem.Addr(length)}, usermem.Write, false /* ignorePermissions */, false /* needInternalMappings */)
+	mm.activeMu.RUnlock()
+	if !pseg.Ok() {
+		t.Errorf("no pmas for the faulted range")
+	}
+
+	// Faults on pages whose pmas exist only map them again.
+	if err := faultPages(ctx, mm, ars); err != nil {
+		t.Fatalf("HandleUserFault on existing pmas got err %v want nil", err)
+	}
+	if got, want := atomic.LoadInt64(&as.mapped), int64(2*ranges*pagesPerRange); got != want {
+		t.Errorf("got %d pages mapped, want %d", got, want)
+	}
+
+	// The ranges are backed by distinct pages.
+	for i, ar := range ars {
+		if _, err := mm.CopyOut(ctx, ar.Start, []byte{byte(i)}, usermem.IOOpts{}); err != nil {
+			t.Fatalf("CopyOut(%#x) got err %v want nil", ar.Start, err)
+		}
+	}
+	for i, ar := range ars {
+		b := make([]byte, 1)
+		if _, err := mm.CopyIn(ctx, ar.Start, b, usermem.IOOpts{}); err != nil {
+			t.Fatalf("CopyIn(%#x) got err %v want nil", ar.Start, err)
+		}
+		if b[0] != byte(i) {
+			t.Errorf("CopyIn(%#x) got %d want %d", ar.Start, b[0], i)
+		}
+	}
+}
+
+// BenchmarkConcurrentFaults measures page faults from parallel goroutines on
+// disjoint ranges of a private anonymous mapping. "existing" faults pages
+// whose pmas exist, which only read-locks activeMu; "new" faults pages
+// without pmas, which are created with activeMu write-locked.
+func BenchmarkConcurrentFaults(b *testing.B) {
+	const pagesPerRange = 256
+	for _, bm := range []struct {
+		name     string
+		existing bool
+	}{
+		{"existing", true},
+		{"new", false},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			ctx := contexttest.Context(b)
+			mm := testMemoryManager(ctx)
+			defer mm.DecUsers(ctx)
+			mm.as = &testAddressSpace{}
+
+			b.RunParallel(func(pb *testing.PB) {
+				var ar usermem.AddrRange
+				mmap := func() bool {
+					addr, err := mm.MMap(ctx, memmap.MMapOpts{
+						Length:   pagesPerRange * usermem.PageSize,
+						Private:  true,
+						Perms:    usermem.ReadWrite,
+						MaxPerms: usermem.AnyAccess,
+					})
+					if err != nil {
+						b.Errorf("MMap got err %v want nil", err)
+						return false
+					}
+					ar = usermem.AddrRange{addr, addr + pagesPerRange*usermem.PageSize}
+					return true
+				}
+				if !mmap() {
+					return
+				}
+				addr := ar.Start
+				for pb.Next() {
+					if err := mm.HandleUserFault(ctx, addr, usermem.Write, 0); err != nil {
+						b.Errorf("HandleUserFault(%#x) got err %v want nil", addr, err)
+						return
+					}
+					addr += usermem.PageSize
+					if addr < ar.End {
+						continue
+					}
+					if !bm.existing {
+						// Start over with pages without pmas.
+						if err := mm.MUnmap(ctx, ar.Start, uint64(ar.Length())); err != nil {
+							b.Errorf("MUnmap got err %v want nil", err)
+							return
+						}
+						if !mmap() {
+							return
+						}
+					}
+					addr = ar.Start
+				}
+			})
+		})
+	}
+}
@@ -16,7 +16,9 @@ package mm
 
 import (
 	"fmt"
+	"sort"
 
+	"gvisor.googlesource.com/gvisor/pkg/log"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/memmap"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
@@ -233,10 +235,15 @@ func (mm *MemoryManager) getPMAsInternalLocked(ctx context.Context, vseg vmaIter
 							panic(fmt.Sprintf("Allocate(%v) returned invalid FileRange %v", allocAR.Length(), fr))
 						}
 					}
+					if vma.hugetlb && fr.Start%usermem.HugePageSize == 0 && fr.End%usermem.HugePageSize == 0 {
+						// This is best-effort; huge pages may be unavailable
+						// on the host.
+						mf.AdviseHugePages(fr)
+					}
 					mm.addRSSLocked(allocAR)
 					mm.incPrivateRef(fr)
 					mf.IncRef(fr)
-					pseg, pgap = mm.pmas.Insert(pgap, allocAR, pma{
+					pseg = mm.pmas.Insert(pgap, allocAR, pma{
 						file:           mf,
 						off:            fr.Start,
 						translatePerms: usermem.AnyAccess,
@@ -246,7 +253,9 @@ func (mm *MemoryManager) getPMAsInternalLocked(ctx context.Context, vseg vmaIter
 						// only reference, the new pma does not need
 						// copy-on-write.
 						private: true,
-					}).NextNonEmpty()
+					})
+					mm.hostMLockPMALocked(vma, pseg)
+					pseg, pgap = pseg.NextNonEmpty()
 					pstart = pmaIterator{} // iterators invalidated
 				} else {
 					// Other mappings get pmas by translating.
@@ -296,6 +305,7 @@ func (mm *MemoryManager) getPMAsInternalLocked(ctx context.Context, vseg vmaIter
 						// required to return Translations in increasing
 						// Translation.Source order.
 						pseg = mm.pmas.Insert(pgap, newpmaAR, newpma)
+						mm.hostMLockPMALocked(vma, pseg)
 						pgap = pseg.NextGap()
 					}
 					// The error returned by Translate is only significant if
@@ -311,6 +321,20 @@ func (mm *MemoryManager) getPMAsInternalLocked(ctx context.Context, vseg vmaIter
 
 			case pseg.Ok() && pseg.Start() < vsegAR.End:
 				oldpma := pseg.ValuePtr()
+				if at.Write && oldpma.lazyFree {
+					// Writing to memory freed by MADV_FREE cancels the
+					// free, as in Linux. Restrict this to ar and vma, so
+					// that the remainder of the pma may still be reclaimed.
+					if !vsegAR.IsSupersetOf(pseg.Range()) {
+						pseg = mm.pmas.Isolate(pseg, vsegAR)
+						pstart = pmaIterator{} // iterators invalidated
+						oldpma = pseg.ValuePtr()
+					}
+					oldpma.lazyFree = false
+					oldpma.effectivePerms = vma.effectivePerms
+					oldpma.maxPerms = vma.maxPerms
+					mm.hostMLockPMALocked(vma, pseg)
+				}
 				if at.Write && mm.isPMACopyOnWriteLocked(vseg, pseg) {
 					// Break copy-on-write by copying.
 					if checkInvariants {
@@ -365,6 +389,7 @@ func (mm *MemoryManager) getPMAsInternalLocked(ctx context.Context, vseg vmaIter
 						pseg = mm.pmas.Isolate(pseg, copyAR)
 						pstart = pmaIterator{} // iterators invalidated
 					}
+					mm.hostMUnlockPMALocked(pseg)
 					oldpma = pseg.ValuePtr()
 					if oldpma.private {
 						mm.decPrivateRef(pseg.fileRange())
@@ -380,6 +405,7 @@ func (mm *MemoryManager) getPMAsInternalLocked(ctx context.Context, vseg vmaIter
 					oldpma.needCOW = false
 					oldpma.private = true
 					oldpma.internalMappings = safemem.BlockSeq{}
+					mm.hostMLockPMALocked(vma, pseg)
 					// Try to merge the pma with its neighbors.
 					if prev := pseg.PrevSegment(); prev.Ok() {
 						if merged := mm.pmas.Merge(prev, pseg); merged.Ok() {
@@ -434,6 +460,7 @@ func (mm *MemoryManager) getPMAsInternalLocked(ctx context.Context, vseg vmaIter
 					transMR := memmap.MappableRange{ts[0].Source.Start, ts[len(ts)-1].Source.End}
 					transAR := vseg.addrRangeOf(transMR)
 					pseg = mm.pmas.Isolate(pseg, transAR)
+					mm.hostMUnlockPMALocked(pseg)
 					pseg.ValuePtr().file.DecRef(pseg.fileRange())
 					pgap = mm.pmas.Remove(pseg)
 					pstart = pmaIterator{} // iterators invalidated
@@ -453,6 +480,7 @@ func (mm *MemoryManager) getPMAsInternalLocked(ctx context.Context, vseg vmaIter
 						}
 						t.File.IncRef(t.FileRange())
 						pseg = mm.pmas.Insert(pgap, newpmaAR, newpma)
+						mm.hostMLockPMALocked(vma, pseg)
 						pgap = pseg.NextGap()
 					}
 					// The error returned by Translate is only significant if
@@ -566,12 +594,71 @@ func (mm *MemoryManager) Invalidate(ar usermem.AddrRange, opts memmap.Invalidate
 	mm.invalidateLocked(ar, opts.InvalidatePrivate, true)
 }
 
+// InvalidateRanges implements memmap.MappingSpace.InvalidateRanges.
+func (mm *MemoryManager) InvalidateRanges(ars []usermem.AddrRange, opts memmap.InvalidateOpts) {
+	if checkInvariants {
+		for _, ar := range ars {
+			if !ar.WellFormed() || ar.Length() <= 0 || !ar.IsPageAligned() {
+				panic(fmt.Sprintf("invalid ar: %v", ar))
+			}
+		}
+	}
+
+	mm.activeMu.Lock()
+	defer mm.activeMu.Unlock()
+	if mm.captureInvalidations {
+		for _, ar := range ars {
+			mm.capturedInvalidations = append(mm.capturedInvalidations, invalidateArgs{ar, opts})
+		}
+		return
+	}
+	var b pmaInvalidationBatch
+	for _, ar := range ars {
+		mm.invalidateBatchedLocked(&b, ar, opts.InvalidatePrivate, true)
+	}
+	mm.flushInvalidationsLocked(&b)
+}
+
 // invalidateLocked removes pmas and AddressSpace mappings of those pmas for
 // addresses in ar.
 //
 // Preconditions: mm.activeMu must be locked for writing. ar.Length() != 0. ar
 // must be page-aligned.
 func (mm *MemoryManager) invalidateLocked(ar usermem.AddrRange, invalidatePrivate, invalidateShared bool) {
+	var b pmaInvalidationBatch
+	mm.invalidateBatchedLocked(&b, ar, invalidatePrivate, invalidateShared)
+	mm.flushInvalidationsLocked(&b)
+}
+
+// pmaInvalidationBatch holds the work deferred by invalidateBatchedLocked.
+// Since AddressSpace mappings must be removed before the memory they map is
+// released, releasing memory is deferred along with AddressSpace unmapping,
+// allowing the unmapping of many ranges to be coalesced into fewer host
+// syscalls.
+type pmaInvalidationBatch struct {
+	// unmaps contains the ranges that must be unmapped from mm.as.
+	unmaps []usermem.AddrRange
+
+	// releases contains the memory that must be released after unmaps have
+	// been unmapped.
+	releases []pmaRelease
+}
+
+// pmaRelease is memory formerly mapped by a removed pma.
+type pmaRelease struct {
+	file    platform.File
+	fr      platform.FileRange
+	private bool
+}
+
+// invalidateBatchedLocked removes pmas for addresses in ar, deferring the
+// removal of their AddressSpace mappings and the release of their memory to
+// b.
+//
+// Preconditions: mm.activeMu must be locked for writing. ar.Length() != 0. ar
+// must be page-aligned. mm.flushInvalidationsLocked(b) must be called before
+// mm.activeMu is unlocked.
+func (mm *MemoryManager) invalidateBatchedLocked(b *pmaInvalidationBatch, ar usermem.AddrRange, invalidatePrivate, invalidateShared bool) {
 	if checkInvariants {
 		if !ar.WellFormed() || ar.Length() <= 0 || !ar.IsPageAligned() {
 			panic(fmt.Sprintf("invalid ar: %v", ar))
@@ -587,16 +674,17 @@ func (mm *MemoryManager) invalidateLocked(ar usermem.AddrRange, invalidatePrivat
 			pma = pseg.ValuePtr()
 			if !didUnmapAS {
 				// Unmap all of ar, not just pseg.Range(), to minimize host
-				// syscalls. AddressSpace mappings must be removed before
-				// mm.decPrivateRef().
-				mm.unmapASLocked(ar)
+				// syscalls.
+				b.unmaps = append(b.unmaps, ar)
 				didUnmapAS = true
 			}
-			if pma.private {
-				mm.decPrivateRef(pseg.fileRange())
-			}
+			mm.hostMUnlockPMALocked(pseg)
 			mm.removeRSSLocked(pseg.Range())
-			pma.file.DecRef(pseg.fileRange())
+			b.releases = append(b.releases, pmaRelease{
+				file:    pma.file,
+				fr:      pseg.fileRange(),
+				private: pma.private,
+			})
 			pseg = mm.pmas.Remove(pseg).NextSegment()
 		} else {
 			pseg = pseg.NextSegment()
@@ -604,6 +692,36 @@ func (mm *MemoryManager) invalidateLocked(ar usermem.AddrRange, invalidatePrivat
 	}
 }
 
+// flushInvalidationsLocked performs the work deferred to b, unmapping each
+// maximal contiguous range in b.unmaps with a single call to
+// mm.unmapASLocked.
+//
+// Preconditions: mm.activeMu must be locked for writing.
+func (mm *MemoryManager) flushInvalidationsLocked(b *pmaInvalidationBatch) {
+	if len(b.unmaps) > 1 {
+		sort.Slice(b.unmaps, func(i, j int) bool {
+			return b.unmaps[i].Start < b.unmaps[j].Start
+		})
+	}
+	for i := 0; i < len(b.unmaps); {
+		ar := b.unmaps[i]
+		for i++; i < len(b.unmaps) && b.unmaps[i].Start <= ar.End; i++ {
+			if b.unmaps[i].End > ar.End {
+				ar.End = b.unmaps[i].End
+			}
+		}
+		mm.unmapASLocked(ar)
+	}
+	// AddressSpace mappings must be removed before mm.decPrivateRef().
+	for _, r := range b.releases {
+		if r.private {
+			mm.decPrivateRef(r.fr)
+		}
+		r.file.DecRef(r.fr)
+	}
+	*b = pmaInvalidationBatch{}
+}
+
 // Pin returns the platform.File ranges currently mapped by addresses in ar in
 // mm, acquiring a reference on the returned ranges which the caller must
 // release by calling Unpin. If not all addresses are mapped, Pin returns a
@@ -903,6 +1021,95 @@ func (mm *MemoryManager) decPrivateRef(fr platform.FileRange) {
 	}
 }
 
+// hostMLockPMALocked locks the memory mapped by pseg into host memory, if host
+// memory locking is enabled and vma is locked. It returns a non-nil error if
+// the memory could not be locked.
+//
+// Preconditions: mm.activeMu must be locked for writing. vma must overlap
+// pseg.
+func (mm *MemoryManager) hostMLockPMALocked(vma *vma, pseg pmaIterator) error {
+	pma := pseg.ValuePtr()
+	if !mm.hostMLock || vma.mlockMode == memmap.MLockNone || pma.hostLocked {
+		return nil
+	}
+	// Only memory owned by the sentry can be locked; memory mapped from host
+	// files is subject to the host's treatment of those files.
+	mf := mm.mfp.MemoryFile()
+	if pma.file != mf {
+		return nil
+	}
+	if err := mf.HostMLock(pseg.fileRange()); err != nil {
+		log.Warningf("Failed to lock %v into host memory: %v", pseg.Range(), err)
+		return err
+	}
+	pma.hostLocked = true
+	return nil
+}
+
+// hostMUnlockPMALocked undoes hostMLockPMALocked for pseg. It must be called
+// before the reference held by pseg on its file is dropped.
+//
+// Preconditions: mm.activeMu must be locked for writing.
+func (mm *MemoryManager) hostMUnlockPMALocked(pseg pmaIterator) {
+	pma := pseg.ValuePtr()
+	if !pma.hostLocked {
+		return
+	}
+	mm.mfp.MemoryFile().HostMUnlock(pseg.fileRange())
+	pma.hostLocked = false
+}
+
+// mlockPMAsLocked applies the mlock mode of vmas to existing pmas in ar: memory
+// freed by madvise(MADV_FREE) is no longer reclaimable, and memory is locked
+// into host memory if host memory locking is enabled. It returns a non-nil
+// error if any memory could not be locked into host memory.
+//
+// Preconditions: mm.mappingMu must be locked. mm.activeMu must be locked for
+// writing. ar.Length() != 0. ar must be fully covered by vmas.
+func (mm *MemoryManager) mlockPMAsLocked(ar usermem.AddrRange) error {
+	var retErr error
+	vseg := mm.vmas.FindSegment(ar.Start)
+	pseg := mm.pmas.LowerBoundSegment(ar.Start)
+	for pseg.Ok() && pseg.Start() < ar.End {
+		for vseg.End() <= pseg.Start() {
+			vseg = vseg.NextSegment()
+		}
+		vma := vseg.ValuePtr()
+		if vma.mlockMode == memmap.MLockNone {
+			pseg = pseg.NextSegment()
+			continue
+		}
+		pseg = mm.pmas.Isolate(pseg, vseg.Range().Intersect(ar))
+		if pma := pseg.ValuePtr(); pma.lazyFree {
+			pma.lazyFree = false
+			pma.effectivePerms = vma.effectivePerms
+			pma.maxPerms = vma.maxPerms
+		}
+		if err := mm.hostMLockPMALocked(vma, pseg); err != nil && retErr == nil {
+			retErr = err
+		}
+		pseg = pseg.NextSegment()
+	}
+	mm.pmas.MergeRange(ar)
+	mm.pmas.MergeAdjacent(ar)
+	return retErr
+}
+
+// munlockPMAsLocked unlocks all pmas in ar from host memory.
+//
+// Preconditions: mm.activeMu must be locked for writing. ar.Length() != 0.
+func (mm *MemoryManager) munlockPMAsLocked(ar usermem.AddrRange) {
+	for pseg := mm.pmas.LowerBoundSegment(ar.Start); pseg.Ok() && pseg.Start() < ar.End; pseg = pseg.NextSegment() {
+		if !pseg.ValuePtr().hostLocked {
+			continue
+		}
+		pseg = mm.pmas.Isolate(pseg, ar)
+		mm.hostMUnlockPMALocked(pseg)
+	}
+	mm.pmas.MergeRange(ar)
+	mm.pmas.MergeAdjacent(ar)
+}
+
 // addRSSLocked updates the current and maximum resident set size of a
 // MemoryManager to reflect the insertion of a pma at ar.
 //
@@ -945,7 +1152,9 @@ func (pmaSetFunctions) Merge(ar1 usermem.AddrRange, pma1 pma, ar2 usermem.AddrRa
 		pma1.effectivePerms != pma2.effectivePerms ||
 		pma1.maxPerms != pma2.maxPerms ||
 		pma1.needCOW != pma2.needCOW ||
-		pma1.private != pma2.private {
+		pma1.private != pma2.private ||
+		pma1.lazyFree != pma2.lazyFree ||
+		pma1.hostLocked != pma2.hostLocked {
 		return pma{}, false
 	}
 
@@ -78,16 +78,16 @@ func (mm *MemoryManager) ReadMapsSeqFileData(ctx context.Context, handle seqfile
 		})
 	}
 
-	// We always emulate vsyscall, so advertise it here. Everything about a
-	// vsyscall region is static, so just hard code the maps entry since we
-	// don't have a real vma backing it. The vsyscall region is at the end of
-	// the virtual address space so nothing should be mapped after it (if
-	// something is really mapped in the tiny ~10 MiB segment afterwards, we'll
-	// get the sorting on the maps file wrong at worst; but that's not possible
-	// on any current platform).
+	// If we emulate vsyscall, advertise it here. Everything about a vsyscall
+	// region is static, so just hard code the maps entry since we don't have
+	// a real vma backing it. The vsyscall region is at the end of the virtual
+	// address space so nothing should be mapped after it (if something is
+	// really mapped in the tiny ~10 MiB segment afterwards, we'll get the
+	// sorting on the maps file wrong at worst; but that's not possible on any
+	// current platform).
 	//
 	// Artifically adjust the seqfile handle so we only output vsyscall entry once.
-	if start != vsyscallEnd {
+	if start != vsyscallEnd && !mm.vsyscallDisabled {
 		// FIXME: Can't get a pointer to constant vsyscallEnd.
 		vmaAddr := vsyscallEnd
 		data = append(data, seqfile.SeqData{
@@ -171,9 +171,9 @@ func (mm *MemoryManager) ReadSmapsSeqFileData(ctx context.Context, handle seqfil
 		})
 	}
 
-	// We always emulate vsyscall, so advertise it here. See
-	// ReadMapsSeqFileData for additional commentary.
-	if start != vsyscallEnd {
+	// If we emulate vsyscall, advertise it here. See ReadMapsSeqFileData for
+	// additional commentary.
+	if start != vsyscallEnd && !mm.vsyscallDisabled {
 		// FIXME: Can't get a pointer to constant vsyscallEnd.
 		vmaAddr := vsyscallEnd
 		data = append(data, seqfile.SeqData{
@@ -211,6 +211,20 @@ func (mm *MemoryManager) vmaSmapsEntryLocked(ctx context.Context, vseg vmaIterat
 	}
 	mm.activeMu.RUnlock()
 
+	// As in Linux, huge pages in hugetlb mappings are accounted separately
+	// from other resident memory.
+	var sharedHugetlb, privateHugetlb uint64
+	pageSize := uint64(usermem.PageSize)
+	if vma.hugetlb {
+		if vma.private {
+			privateHugetlb = rss
+		} else {
+			sharedHugetlb = rss
+		}
+		rss, anon = 0, 0
+		pageSize = usermem.HugePageSize
+	}
+
 	fmt.Fprintf(&b, "Size:           %8d kB\n", vseg.Range().Length()/1024)
 	fmt.Fprintf(&b, "Rss:            %8d kB\n", rss/1024)
 	// Currently we report PSS = RSS, i.e. we pretend each page mapped by a pma
@@ -231,15 +245,15 @@ func (mm *MemoryManager) vmaSmapsEntryLocked(ctx context.Context, vseg vmaIterat
 	// Pretend that all pages are "referenced" (recently touched).
 	fmt.Fprintf(&b, "Referenced:     %8d kB\n", rss/1024)
 	fmt.Fprintf(&b, "Anonymous:      %8d kB\n", anon/1024)
-	// Hugepages (hugetlb and THP) are not implemented.
+	// Transparent huge pages are not tracked.
 	fmt.Fprintf(&b, "AnonHugePages:  %8d kB\n", 0)
-	fmt.Fprintf(&b, "Shared_Hugetlb: %8d kB\n", 0)
-	fmt.Fprintf(&b, "Private_Hugetlb: %7d kB\n", 0)
+	fmt.Fprintf(&b, "Shared_Hugetlb: %8d kB\n", sharedHugetlb/1024)
+	fmt.Fprintf(&b, "Private_Hugetlb: %7d kB\n", privateHugetlb/1024)
 	// Swap is not implemented.
 	fmt.Fprintf(&b, "Swap:           %8d kB\n", 0)
 	fmt.Fprintf(&b, "SwapPss:        %8d kB\n", 0)
-	fmt.Fprintf(&b, "KernelPageSize: %8d kB\n", usermem.PageSize/1024)
-	fmt.Fprintf(&b, "MMUPageSize:    %8d kB\n", usermem.PageSize/1024)
+	fmt.Fprintf(&b, "KernelPageSize: %8d kB\n", pageSize/1024)
+	fmt.Fprintf(&b, "MMUPageSize:    %8d kB\n", pageSize/1024)
 	locked := rss
 	if vma.mlockMode == memmap.MLockNone {
 		locked = 0
@@ -283,6 +297,9 @@ func (mm *MemoryManager) vmaSmapsEntryLocked(ctx context.Context, vseg vmaIterat
 	if vma.private && vma.effectivePerms.Write { // VM_ACCOUNT
 		b.WriteString("ac ")
 	}
+	if vma.hugetlb { // VM_HUGETLB
+		b.WriteString("ht ")
+	}
 	b.WriteString("\n")
 
 	return b.Bytes()
@@ -15,6 +15,7 @@
 package mm
 
 import (
+	"gvisor.googlesource.com/gvisor/pkg/log"
 	"gvisor.googlesource.com/gvisor/pkg/refs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/memmap"
@@ -153,3 +154,21 @@ func NewSharedAnonMappable(length uint64, mfp pgalloc.MemoryFileProvider) (*Spec
 	}
 	return NewSpecialMappable("/dev/zero (deleted)", mfp, fr), nil
 }
+
+// NewSharedAnonHugetlbMappable returns a SpecialMappable that implements the
+// semantics of mmap(MAP_SHARED|MAP_ANONYMOUS|MAP_HUGETLB). length must be
+// aligned to usermem.HugePageSize.
+func NewSharedAnonHugetlbMappable(length uint64, mfp pgalloc.MemoryFileProvider) (*SpecialMappable, error) {
+	if length == 0 || usermem.Addr(length).HugeRoundDown() != usermem.Addr(length) {
+		return nil, syserror.EINVAL
+	}
+	mf := mfp.MemoryFile()
+	fr, err := mf.Allocate(length, usage.Anonymous)
+	if err != nil {
+		return nil, err
+	}
+	if err := mf.AdviseHugePages(fr); err != nil {
+		log.Debugf("Huge pages unavailable for %v: %v", fr, err)
+	}
+	return NewSpecialMappable("/anon_hugepage (deleted)", mfp, fr), nil
+}
@@ -25,6 +25,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/limits"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/memmap"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/pgalloc"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
 )
@@ -39,9 +40,6 @@ func (mm *MemoryManager) HandleUserFault(ctx context.Context, addr usermem.Addr,
 		return syserror.EFAULT
 	}
 
-	// Don't bother trying existingPMAsLocked; in most cases, if we did have
-	// existing pmas, we wouldn't have faulted.
-
 	// Ensure that we have a usable vma. Here and below, since we are only
 	// asking for a single page, there is no possibility of partial success,
 	// and any error is immediately fatal.
@@ -52,6 +50,37 @@ func (mm *MemoryManager) HandleUserFault(ctx context.Context, addr usermem.Addr,
 		return err
 	}
 
+	// Try to handle the fault while holding activeMu only for reading, so
+	// that it can proceed concurrently with other such faults. This succeeds
+	// if another thread raced with us to fault in the same page, or if the
+	// page's pma survived the loss of its AddressSpace mapping (e.g. after
+	// mm.Deactivate). Faults that need new pmas are still serialized by
+	// activeMu below, whatever their address; there is no range locking.
+	mm.activeMu.RLock()
+	if pseg := mm.existingPMAsLocked(ar, at, false /* ignorePermissions */, false /* needInternalMappings */); pseg.Ok() {
+		mm.mappingMu.RUnlock()
+		err := mm.mapASLocked(pseg, ar, false)
+		mm.activeMu.RUnlock()
+		return err
+	}
+	mm.activeMu.RUnlock()
+
+	// Translating a page of a file-backed vma may block (e.g. on I/O to a
+	// remote filesystem). Do so before locking activeMu for writing, so that
+	// other faults don't wait for the I/O; mm.getPMAsLocked will then
+	// usually find the page cached by the Mappable. Private mappings are
+	// translated for reading only, since copy-on-write is handled by
+	// getPMAsLocked.
+	if vma := vseg.ValuePtr(); vma.mappable != nil {
+		tat := at
+		if vma.private {
+			tat = usermem.Read
+		}
+		mr := vseg.mappableRangeOf(ar)
+		// Errors will be returned by getPMAsLocked below.
+		vma.mappable.Translate(ctx, mr, mr, tat)
+	}
+
 	// Ensure that we have a usable pma.
 	mm.activeMu.Lock()
 	pseg, _, err := mm.getPMAsLocked(ctx, vseg, ar, at)
@@ -82,6 +111,28 @@ func (mm *MemoryManager) MMap(ctx context.Context, opts memmap.MMapOpts) (userme
 	}
 	opts.Length = uint64(length)
 
+	if opts.Hugetlb {
+		// Callers are responsible for rounding the length up, since only
+		// they know if the mapping is required to be hugetlb.
+		if usermem.Addr(opts.Length).HugeRoundDown() != usermem.Addr(opts.Length) {
+			return 0, syserror.EINVAL
+		}
+		if opts.Mappable != nil && usermem.Addr(opts.Offset).HugeRoundDown() != usermem.Addr(opts.Offset) {
+			return 0, syserror.EINVAL
+		}
+		if opts.Addr.HugeRoundDown() != opts.Addr {
+			if opts.Fixed {
+				return 0, syserror.EINVAL
+			}
+			// Compare Linux's fs/hugetlbfs/inode.c:hugetlb_get_unmapped_area().
+			addr, ok := opts.Addr.HugeRoundUp()
+			if !ok {
+				addr = 0
+			}
+			opts.Addr = addr
+		}
+	}
+
 	if opts.Mappable != nil {
 		// Offset must be aligned.
 		if usermem.Addr(opts.Offset).RoundDown() != usermem.Addr(opts.Offset) {
@@ -97,7 +148,13 @@ func (mm *MemoryManager) MMap(ctx context.Context, opts memmap.MMapOpts) (userme
 			if opts.MappingIdentity != nil {
 				return 0, syserror.EINVAL
 			}
-			m, err := NewSharedAnonMappable(opts.Length, pgalloc.MemoryFileProviderFromContext(ctx))
+			var m *SpecialMappable
+			var err error
+			if opts.Hugetlb {
+				m, err = NewSharedAnonHugetlbMappable(opts.Length, pgalloc.MemoryFileProviderFromContext(ctx))
+			} else {
+				m, err = NewSharedAnonMappable(opts.Length, pgalloc.MemoryFileProviderFromContext(ctx))
+			}
 			if err != nil {
 				return 0, err
 			}
@@ -125,6 +182,9 @@ func (mm *MemoryManager) MMap(ctx context.Context, opts memmap.MMapOpts) (userme
 	if opts.GrowsDown && opts.Mappable != nil {
 		return 0, syserror.EINVAL
 	}
+	if opts.WipeOnFork && (opts.Mappable != nil || !opts.Private) {
+		return 0, syserror.EINVAL
+	}
 
 	// Get the new vma.
 	mm.mappingMu.Lock()
@@ -265,9 +325,11 @@ func (mm *MemoryManager) MapStack(ctx context.Context) (usermem.AddrRange, error
 	szaddr := usermem.Addr(sz)
 	ctx.Debugf("Allocating stack with size of %v bytes", sz)
 
-	// Determine the stack's desired location. Unlike Linux, address
-	// randomization can't be disabled.
-	stackEnd := mm.layout.MaxAddr - usermem.Addr(mrand.Int63n(int64(mm.layout.MaxStackRand))).RoundDown()
+	// Determine the stack's desired location.
+	stackEnd := mm.layout.MaxAddr
+	if mm.layout.MaxStackRand != 0 {
+		stackEnd -= usermem.Addr(mrand.Int63n(int64(mm.layout.MaxStackRand))).RoundDown()
+	}
 	if stackEnd < szaddr {
 		return usermem.AddrRange{}, syserror.ENOMEM
 	}
@@ -306,6 +368,9 @@ func (mm *MemoryManager) MUnmap(ctx context.Context, addr usermem.Addr, length u
 
 	mm.mappingMu.Lock()
 	defer mm.mappingMu.Unlock()
+	if err := mm.checkHugetlbSplitLocked(ar); err != nil {
+		return err
+	}
 	mm.unmapLocked(ctx, ar)
 	return nil
 }
@@ -318,6 +383,12 @@ type MRemapOpts struct {
 	// NewAddr is the new address for the remapping. NewAddr is ignored unless
 	// Move is MMRemapMustMove.
 	NewAddr usermem.Addr
+
+	// If DontUnmap is true, the remapped mapping is always moved, but the old
+	// mapping remains in place without its pages, as for Linux's
+	// MREMAP_DONTUNMAP. If DontUnmap is true, Move must not be MRemapNoMove,
+	// and oldSize must equal newSize.
+	DontUnmap bool
 }
 
 // MRemapMoveMode controls MRemap's moving behavior.
@@ -366,6 +437,11 @@ func (mm *MemoryManager) MRemap(ctx context.Context, oldAddr usermem.Addr, oldSi
 	if !vseg.Ok() {
 		return 0, syserror.EFAULT
 	}
+	// Hugetlb mappings can't be resized or moved; compare Linux's
+	// mm/mremap.c:vma_to_resize().
+	if vseg.ValuePtr().hugetlb {
+		return 0, syserror.EINVAL
+	}
 
 	// Behavior matrix:
 	//
@@ -393,7 +469,7 @@ func (mm *MemoryManager) MRemap(ctx context.Context, oldAddr usermem.Addr, oldSi
 		}
 	}
 
-	if opts.Move != MRemapMustMove {
+	if opts.Move != MRemapMustMove && !opts.DontUnmap {
 		// Handle no-ops and in-place shrinking. These cases don't care if
 		// [oldAddr, oldEnd) maps to a single vma, or is even mapped at all
 		// (aside from oldAddr).
@@ -442,6 +518,11 @@ func (mm *MemoryManager) MRemap(ctx context.Context, oldAddr usermem.Addr, oldSi
 		// In-place growth failed. In the MRemapMayMove case, fall through to
 		// copying/moving below.
 		if opts.Move == MRemapNoMove {
+			if err == syserror.EEXIST {
+				// Compare Linux's mm/mremap.c:mremap() =>
+				// vma_expandable().
+				err = syserror.ENOMEM
+			}
 			return 0, err
 		}
 	}
@@ -495,7 +576,10 @@ func (mm *MemoryManager) MRemap(ctx context.Context, oldAddr usermem.Addr, oldSi
 	}
 
 	// Check against RLIMIT_AS.
-	newUsageAS := mm.usageAS - uint64(oldAR.Length()) + uint64(newAR.Length())
+	newUsageAS := mm.usageAS + uint64(newAR.Length())
+	if !opts.DontUnmap {
+		newUsageAS -= uint64(oldAR.Length())
+	}
 	if limitAS := limits.FromContext(ctx).Get(limits.AS).Cur; newUsageAS > limitAS {
 		return 0, syserror.ENOMEM
 	}
@@ -553,9 +637,20 @@ func (mm *MemoryManager) MRemap(ctx context.Context, oldAddr usermem.Addr, oldSi
 	// vma.
 	vseg = mm.vmas.Isolate(vseg, oldAR)
 	vma := vseg.Value()
-	mm.vmas.Remove(vseg)
+	if opts.DontUnmap {
+		// Leave the old vma in place, sharing its MappingIdentity with the
+		// new one. The old vma is no longer locked, since its pages are
+		// moving; compare Linux's mm/mremap.c:move_vma().
+		if vma.id != nil {
+			vma.id.IncRef()
+		}
+		vseg.ValuePtr().mlockMode = memmap.MLockNone
+		mm.usageAS += uint64(newAR.Length())
+	} else {
+		mm.vmas.Remove(vseg)
+		mm.usageAS = mm.usageAS - uint64(oldAR.Length()) + uint64(newAR.Length())
+	}
 	vseg = mm.vmas.Insert(mm.vmas.FindGap(newAR.Start), newAR, vma)
-	mm.usageAS = mm.usageAS - uint64(oldAR.Length()) + uint64(newAR.Length())
 	if vma.mlockMode != memmap.MLockNone {
 		mm.lockedAS = mm.lockedAS - uint64(oldAR.Length()) + uint64(newAR.Length())
 	}
@@ -569,7 +664,7 @@ func (mm *MemoryManager) MRemap(ctx context.Context, oldAddr usermem.Addr, oldSi
 
 	// Now that pmas have been moved to newAR, we can notify vma.mappable that
 	// oldAR is no longer mapped.
-	if vma.mappable != nil {
+	if vma.mappable != nil && !opts.DontUnmap {
 		vma.mappable.RemoveMapping(ctx, mm, oldAR, vma.off, vma.canWriteMappableLocked())
 	}
 
@@ -600,6 +695,9 @@ func (mm *MemoryManager) MProtect(addr usermem.Addr, length uint64, realPerms us
 
 	mm.mappingMu.Lock()
 	defer mm.mappingMu.Unlock()
+	if err := mm.checkHugetlbSplitLocked(ar); err != nil {
+		return err
+	}
 	// Non-growsDown mprotect requires that all of ar is mapped, and stops at
 	// the first non-empty gap. growsDown mprotect requires that the first vma
 	// be growsDown, but does not require it to extend all the way to ar.Start;
@@ -658,7 +756,7 @@ func (mm *MemoryManager) MProtect(addr usermem.Addr, length uint64, realPerms us
 					didUnmapAS = true
 				}
 				pma.effectivePerms = effectivePerms.Intersect(pma.translatePerms)
-				if pma.needCOW {
+				if pma.needCOW || pma.lazyFree {
 					pma.effectivePerms.Write = false
 				}
 			}
@@ -817,6 +915,25 @@ func (mm *MemoryManager) MLock(ctx context.Context, addr usermem.Addr, length ui
 		return syserror.ENOMEM
 	}
 
+	if mode == memmap.MLockNone {
+		mm.activeMu.Lock()
+		mm.munlockPMAsLocked(ar)
+		mm.activeMu.Unlock()
+	}
+
+	if mode == memmap.MLockLazy {
+		// Existing pmas are locked now; pmas created later are locked when
+		// they are faulted in.
+		mm.activeMu.Lock()
+		err := mm.mlockPMAsLocked(ar)
+		mm.activeMu.Unlock()
+		mm.mappingMu.Unlock()
+		if err != nil {
+			return syserror.EAGAIN
+		}
+		return nil
+	}
+
 	if mode == memmap.MLockEager {
 		// Ensure that we have usable pmas. Since we didn't return ENOMEM
 		// above, ar must be fully covered by vmas, so we can just use
@@ -845,6 +962,12 @@ func (mm *MemoryManager) MLock(ctx context.Context, addr usermem.Addr, length ui
 				return err
 			}
 		}
+		if err := mm.mlockPMAsLocked(ar); err != nil {
+			mm.activeMu.Unlock()
+			mm.mappingMu.RUnlock()
+			// Linux: mm/mlock.c:__mlock_posix_error_return()
+			return syserror.EAGAIN
+		}
 
 		// Map pmas into the active AddressSpace, if we have one.
 		mm.mappingMu.RUnlock()
@@ -910,6 +1033,17 @@ func (mm *MemoryManager) MLockAll(ctx context.Context, opts MLockAllOpts) error
 				mm.lockedAS -= uint64(vseg.Range().Length())
 			}
 		}
+		// As for Linux's mlockall(), errors from locking existing pmas
+		// below are ignored.
+		mm.activeMu.Lock()
+		for vseg := mm.vmas.FirstSegment(); vseg.Ok(); vseg = vseg.NextSegment() {
+			if opts.Mode == memmap.MLockNone {
+				mm.munlockPMAsLocked(vseg.Range())
+			} else {
+				mm.mlockPMAsLocked(vseg.Range())
+			}
+		}
+		mm.activeMu.Unlock()
 	}
 
 	if opts.Future {
@@ -1023,6 +1157,148 @@ func (mm *MemoryManager) Decommit(addr usermem.Addr, length uint64) error {
 	return nil
 }
 
+// LazyFree implements the semantics of Linux's madvise(MADV_FREE).
+//
+// Memory in private anonymous vmas that is not shared copy-on-write is marked
+// as lazily freed: its contents are retained until they are either discarded
+// by ReclaimLazyFree, after which the memory reads as zero, or written, which
+// cancels the free.
+func (mm *MemoryManager) LazyFree(addr usermem.Addr, length uint64) error {
+	ar, ok := addr.ToRange(length)
+	if !ok {
+		return syserror.EINVAL
+	}
+
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	mm.activeMu.Lock()
+	defer mm.activeMu.Unlock()
+
+	// Linux's mm/madvise.c:madvise_free_single_vma() rejects vmas that are
+	// not anonymous, and madvise_behavior_valid() => can_madv_lru_vma()
+	// rejects locked vmas. Check all vmas before changing any pmas.
+	for vseg := mm.vmas.LowerBoundSegment(ar.Start); vseg.Ok() && vseg.Start() < ar.End; vseg = vseg.NextSegment() {
+		vma := vseg.ValuePtr()
+		if vma.mappable != nil || vma.mlockMode != memmap.MLockNone {
+			return syserror.EINVAL
+		}
+	}
+
+	var didUnmapAS bool
+	pseg := mm.pmas.LowerBoundSegment(ar.Start)
+	for vseg := mm.vmas.LowerBoundSegment(ar.Start); vseg.Ok() && vseg.Start() < ar.End; vseg = vseg.NextSegment() {
+		vsegAR := vseg.Range().Intersect(ar)
+		for pseg.Ok() && pseg.Start() < vsegAR.End {
+			pma := pseg.ValuePtr()
+			// Pages that are shared copy-on-write can't be discarded without
+			// the other sharers observing it. Linux similarly skips pages
+			// with a mapcount greater than 1.
+			if !pma.private || pma.lazyFree || mm.isPMACopyOnWriteLocked(vseg, pseg) {
+				pseg = pseg.NextSegment()
+				continue
+			}
+			pseg = mm.pmas.Isolate(pseg, vsegAR)
+			pma = pseg.ValuePtr()
+			if pma.effectivePerms.Write && !didUnmapAS {
+				// Unmap all of ar, not just pseg.Range(), to minimize host
+				// syscalls. Subsequent accesses will remap the pma without
+				// write permission.
+				mm.unmapASLocked(ar)
+				didUnmapAS = true
+			}
+			pma.lazyFree = true
+			pma.effectivePerms.Write = false
+			pma.maxPerms.Write = false
+			pseg = pseg.NextSegment()
+		}
+	}
+
+	if mm.vmas.SpanRange(ar) != ar.Length() {
+		return syserror.ENOMEM
+	}
+	return nil
+}
+
+// ReclaimLazyFree discards all memory in mm that has been freed by
+// madvise(MADV_FREE) and not written since. It returns the number of bytes
+// reclaimed.
+func (mm *MemoryManager) ReclaimLazyFree() uint64 {
+	mm.activeMu.Lock()
+	defer mm.activeMu.Unlock()
+
+	var reclaimed uint64
+	for pseg := mm.pmas.FirstSegment(); pseg.Ok(); {
+		pma := pseg.ValuePtr()
+		if !pma.lazyFree {
+			pseg = pseg.NextSegment()
+			continue
+		}
+		// AddressSpace mappings must be removed before mm.decPrivateRef().
+		ar := pseg.Range()
+		mm.unmapASLocked(ar)
+		mm.decPrivateRef(pseg.fileRange())
+		pma.file.DecRef(pseg.fileRange())
+		mm.removeRSSLocked(ar)
+		reclaimed += uint64(ar.Length())
+		pseg = mm.pmas.Remove(pseg).NextSegment()
+	}
+	return reclaimed
+}
+
+// Mincore implements the semantics of Linux's mincore(2). It returns a slice
+// containing one byte per page in ar, which is 1 if the page is resident in
+// memory and 0 otherwise.
+//
+// Preconditions: ar must be page-aligned.
+func (mm *MemoryManager) Mincore(ctx context.Context, ar usermem.AddrRange) ([]byte, error) {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+
+	// "ENOMEM: addr to addr + length contained unmapped memory." - mincore(2)
+	if mm.vmas.SpanRange(ar) != ar.Length() {
+		return nil, syserror.ENOMEM
+	}
+
+	// Linux's mm/mincore.c:mincore_page() reports pages in file-backed vmas as
+	// resident if they are present in the page cache. Ask each vma's Mappable
+	// for the equivalent. Pages of private anonymous vmas are only resident
+	// if they are backed by private memory, which is handled below.
+	vec := make([]byte, ar.Length()/usermem.PageSize)
+	for vseg := mm.vmas.LowerBoundSegment(ar.Start); vseg.Ok() && vseg.Start() < ar.End; vseg = vseg.NextSegment() {
+		vma := vseg.ValuePtr()
+		if vma.mappable == nil {
+			continue
+		}
+		vsegAR := vseg.Range().Intersect(ar)
+		dst := vec[(vsegAR.Start-ar.Start)/usermem.PageSize:][:vsegAR.Length()/usermem.PageSize]
+		if rm, ok := vma.mappable.(memmap.ResidencyMappable); ok {
+			if err := rm.Residency(ctx, vseg.mappableRangeOf(vsegAR), dst); err != nil {
+				return nil, err
+			}
+		} else {
+			for i := range dst {
+				dst[i] = 1
+			}
+		}
+	}
+
+	// Private memory, including copy-on-write copies of file-backed pages,
+	// is resident if it is committed in the MemoryFile.
+	mm.activeMu.RLock()
+	defer mm.activeMu.RUnlock()
+	mf := mm.mfp.MemoryFile()
+	for pseg := mm.pmas.LowerBoundSegment(ar.Start); pseg.Ok() && pseg.Start() < ar.End; pseg = pseg.NextSegment() {
+		if !pseg.ValuePtr().private {
+			continue
+		}
+		psegAR := pseg.Range().Intersect(ar)
+		if err := mf.Residency(pseg.fileRangeOf(psegAR), vec[(psegAR.Start-ar.Start)/usermem.PageSize:]); err != nil {
+			return nil, err
+		}
+	}
+	return vec, nil
+}
+
 // MSyncOpts holds options to MSync.
 type MSyncOpts struct {
 	// Sync has the semantics of MS_SYNC.
@@ -1069,6 +1345,9 @@ func (mm *MemoryManager) MSync(ctx context.Context, addr usermem.Addr, length ui
 		}
 		lastEnd = vseg.End()
 		vma := vseg.ValuePtr()
+		// As in Linux, MS_INVALIDATE otherwise has no effect: all mappings
+		// of a given Mappable observe the same memory, so there are no stale
+		// copies to invalidate.
 		if opts.Invalidate && vma.mlockMode != memmap.MLockNone {
 			mm.mappingMu.RUnlock()
 			return syserror.EBUSY
@@ -1141,6 +1420,104 @@ func (mm *MemoryManager) GetSharedFutexKey(ctx context.Context, addr usermem.Add
 	}, nil
 }
 
+// NumaPolicy implements the semantics of Linux's get_mempolicy(MPOL_F_ADDR).
+func (mm *MemoryManager) NumaPolicy(addr usermem.Addr) (policy int32, nodemask uint32, err error) {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	vseg := mm.vmas.FindSegment(addr)
+	if !vseg.Ok() {
+		return 0, 0, syserror.EFAULT
+	}
+	vma := vseg.ValuePtr()
+	return vma.numaPolicy, vma.numaNodemask, nil
+}
+
+// SetNumaPolicy implements the semantics of Linux's mbind().
+func (mm *MemoryManager) SetNumaPolicy(addr usermem.Addr, length uint64, policy int32, nodemask uint32) error {
+	if !addr.IsPageAligned() {
+		return syserror.EINVAL
+	}
+	// Linux allows this to overflow.
+	la, _ := usermem.Addr(length).RoundUp()
+	ar, ok := addr.ToRange(uint64(la))
+	if !ok {
+		return syserror.EINVAL
+	}
+	if ar.Length() == 0 {
+		return nil
+	}
+
+	mm.mappingMu.Lock()
+	defer mm.mappingMu.Unlock()
+	if mm.vmas.SpanRange(ar) != ar.Length() {
+		// "EFAULT: ... there was an unmapped hole in the specified memory
+		// range specified [sic] by addr and len." - mbind(2)
+		return syserror.EFAULT
+	}
+	for vseg := mm.vmas.LowerBoundSegment(ar.Start); vseg.Ok() && vseg.Start() < ar.End; vseg = vseg.NextSegment() {
+		vseg = mm.vmas.Isolate(vseg, ar)
+		vma := vseg.ValuePtr()
+		vma.numaPolicy = policy
+		vma.numaNodemask = nodemask
+	}
+	mm.vmas.MergeRange(ar)
+	mm.vmas.MergeAdjacent(ar)
+	return nil
+}
+
+// ReadLDT implements the semantics of Linux's modify_ldt(2) function 0,
+// returning the bytes to copy out to a buffer of the given size.
+func (mm *MemoryManager) ReadLDT(size uint64) []byte {
+	mm.activeMu.RLock()
+	defer mm.activeMu.RUnlock()
+	return mm.ldt.Read(size)
+}
+
+// WriteLDT implements the semantics of Linux's modify_ldt(2) functions 1
+// (oldMode) and 0x11 (!oldMode).
+//
+// Preconditions: mm must be active.
+func (mm *MemoryManager) WriteLDT(info *linux.UserDesc, oldMode bool) error {
+	mm.activeMu.Lock()
+	defer mm.activeMu.Unlock()
+	las, ok := mm.as.(platform.LDTAddressSpace)
+	if !ok {
+		// The platform can't install descriptors, so behave as Linux built
+		// without CONFIG_MODIFY_LDT_SYSCALL.
+		return syserror.ENOSYS
+	}
+	// Update a copy so that mm.ldt is unchanged on failure.
+	ldt := mm.ldt.Fork()
+	desc, err := ldt.Write(info, oldMode)
+	if err != nil {
+		return err
+	}
+	if err := las.SetLDTEntry(&desc); err != nil {
+		return err
+	}
+	mm.ldt = ldt
+	return nil
+}
+
+// installLDTLocked installs all entries in mm.ldt in as.
+//
+// Preconditions: mm.activeMu must be locked for writing.
+func (mm *MemoryManager) installLDTLocked(as platform.AddressSpace) error {
+	if mm.ldt.Len() == 0 {
+		return nil
+	}
+	las, ok := as.(platform.LDTAddressSpace)
+	if !ok {
+		return syserror.ENOSYS
+	}
+	for _, desc := range mm.ldt.Entries() {
+		if err := las.SetLDTEntry(&desc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // VirtualMemorySize returns the combined length in bytes of all mappings in
 // mm.
 func (mm *MemoryManager) VirtualMemorySize() uint64 {
@@ -1157,6 +1534,14 @@ func (mm *MemoryManager) VirtualMemorySizeRange(ar usermem.AddrRange) uint64 {
 	return uint64(mm.vmas.SpanRange(ar))
 }
 
+// LockedMemorySize returns the combined length in bytes of all locked
+// mappings in mm.
+func (mm *MemoryManager) LockedMemorySize() uint64 {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	return mm.lockedAS
+}
+
 // ResidentSetSize returns the value advertised as mm's RSS in bytes.
 func (mm *MemoryManager) ResidentSetSize() uint64 {
 	mm.activeMu.RLock()
@@ -106,6 +106,8 @@ func (mm *MemoryManager) createVMALocked(ctx context.Context, opts memmap.MMapOp
 		maxPerms:       opts.MaxPerms,
 		private:        opts.Private,
 		growsDown:      opts.GrowsDown,
+		wipeOnFork:     opts.WipeOnFork,
+		hugetlb:        opts.Hugetlb,
 		mlockMode:      opts.MLockMode,
 		id:             opts.MappingIdentity,
 		hint:           opts.Hint,
@@ -160,6 +162,11 @@ func (mm *MemoryManager) findAvailableLocked(length uint64, opts findAvailableOp
 			if vgap := mm.vmas.FindGap(ar.Start); vgap.Ok() && vgap.availableRange().IsSupersetOf(ar) {
 				return ar.Start, nil
 			}
+			// Fixed mappings that may not replace existing ones fail
+			// distinctly; compare Linux's mm/mmap.c:do_mmap().
+			if opts.Fixed {
+				return 0, syserror.EEXIST
+			}
 		}
 	}
 
@@ -183,6 +190,23 @@ func (mm *MemoryManager) findAvailableLocked(length uint64, opts findAvailableOp
 	return mm.findHighestAvailableLocked(length, alignment, usermem.AddrRange{mm.layout.MinAddr, mm.layout.TopDownBase})
 }
 
+// checkHugetlbSplitLocked returns EINVAL if changing the mappings in ar
+// would split a hugetlb vma at an address that isn't aligned to
+// usermem.HugePageSize, as for Linux's mm/hugetlb.c:hugetlb_vm_op_split().
+//
+// Preconditions: mm.mappingMu must be locked.
+func (mm *MemoryManager) checkHugetlbSplitLocked(ar usermem.AddrRange) error {
+	for _, addr := range []usermem.Addr{ar.Start, ar.End} {
+		if addr.HugeRoundDown() == addr {
+			continue
+		}
+		if vseg := mm.vmas.FindSegment(addr); vseg.Ok() && vseg.ValuePtr().hugetlb && vseg.Start() != addr {
+			return syserror.EINVAL
+		}
+	}
+	return nil
+}
+
 func (mm *MemoryManager) applicationAddrRange() usermem.AddrRange {
 	return usermem.AddrRange{mm.layout.MinAddr, mm.layout.MaxAddr}
 }
@@ -420,7 +444,11 @@ func (vmaSetFunctions) Merge(ar1 usermem.AddrRange, vma1 vma, ar2 usermem.AddrRa
 		vma1.maxPerms != vma2.maxPerms ||
 		vma1.private != vma2.private ||
 		vma1.growsDown != vma2.growsDown ||
+		vma1.wipeOnFork != vma2.wipeOnFork ||
+		vma1.hugetlb != vma2.hugetlb ||
 		vma1.mlockMode != vma2.mlockMode ||
+		vma1.numaPolicy != vma2.numaPolicy ||
+		vma1.numaNodemask != vma2.numaNodemask ||
 		vma1.id != vma2.id ||
 		vma1.hint != vma2.hint {
 		return vma{}, false
@@ -164,6 +164,11 @@ type usageInfo struct {
 	knownCommitted bool
 
 	refs uint64
+
+	// hostLocks is the number of outstanding calls to HostMLock for the
+	// tracked region. Host memory locks are not preserved across
+	// save/restore.
+	hostLocks uint64 `state:"nosave"`
 }
 
 const (
@@ -600,6 +605,83 @@ func (f *MemoryFile) DecRef(fr platform.FileRange) {
 	}
 }
 
+// HostMLock locks the pages in fr into host memory, as for mlock(2). Host
+// memory locks are reference-counted: pages remain locked until HostMUnlock
+// has been called on them as many times as HostMLock.
+//
+// Preconditions: fr must be page-aligned and non-empty. All pages in fr must
+// be allocated.
+func (f *MemoryFile) HostMLock(fr platform.FileRange) error {
+	if !fr.WellFormed() || fr.Length() == 0 || fr.Start%usermem.PageSize != 0 || fr.End%usermem.PageSize != 0 {
+		panic(fmt.Sprintf("invalid range: %v", fr))
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Locking already-locked pages is harmless, so lock all of fr at once.
+	var err error
+	if ferr := f.forEachMappingSlice(fr, func(bs []byte) {
+		if err == nil {
+			err = syscall.Mlock(bs)
+		}
+	}); ferr != nil {
+		err = ferr
+	}
+	if err != nil {
+		// Unlock pages that weren't previously locked.
+		for seg := f.usage.FindSegment(fr.Start); seg.Ok() && seg.Start() < fr.End; seg = seg.NextSegment() {
+			if seg.ValuePtr().hostLocks == 0 {
+				f.hostMUnlockLocked(seg.Range().Intersect(fr))
+			}
+		}
+		return err
+	}
+
+	gap := f.usage.ApplyContiguous(fr, func(seg usageIterator) {
+		seg.ValuePtr().hostLocks++
+	})
+	if gap.Ok() {
+		panic(fmt.Sprintf("HostMLock(%v): attempted to lock unallocated pages %v:\n%v", fr, gap.Range(), &f.usage))
+	}
+	f.usage.MergeAdjacent(fr)
+	return nil
+}
+
+// HostMUnlock undoes a previous call to HostMLock(fr).
+func (f *MemoryFile) HostMUnlock(fr platform.FileRange) {
+	if !fr.WellFormed() || fr.Length() == 0 || fr.Start%usermem.PageSize != 0 || fr.End%usermem.PageSize != 0 {
+		panic(fmt.Sprintf("invalid range: %v", fr))
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for seg := f.usage.FindSegment(fr.Start); seg.Ok() && seg.Start() < fr.End; seg = seg.NextSegment() {
+		seg = f.usage.Isolate(seg, fr)
+		val := seg.ValuePtr()
+		if val.hostLocks == 0 {
+			panic(fmt.Sprintf("HostMUnlock(%v): no existing host locks on %v:\n%v", fr, seg.Range(), &f.usage))
+		}
+		val.hostLocks--
+		if val.hostLocks == 0 {
+			f.hostMUnlockLocked(seg.Range())
+		}
+	}
+	f.usage.MergeAdjacent(fr)
+}
+
+// Preconditions: f.mu must be locked.
+func (f *MemoryFile) hostMUnlockLocked(fr platform.FileRange) {
+	if err := f.forEachMappingSlice(fr, func(bs []byte) {
+		if err := syscall.Munlock(bs); err != nil {
+			log.Warningf("Failed to unlock host memory for %v: %v", fr, err)
+		}
+	}); err != nil {
+		log.Warningf("Failed to map %v for host unlock: %v", fr, err)
+	}
+}
+
 // MapInternal implements platform.File.MapInternal.
 func (f *MemoryFile) MapInternal(fr platform.FileRange, at usermem.AccessType) (safemem.BlockSeq, error) {
 	if !fr.WellFormed() || fr.Length() == 0 {
@@ -652,6 +734,54 @@ func (f *MemoryFile) forEachMappingSlice(fr platform.FileRange, fn func([]byte))
 	return nil
 }
 
+// Residency sets dst[i] to 1 if the page at offset fr.Start +
+// i*usermem.PageSize is committed, and 0 otherwise, as for mincore(2).
+//
+// Preconditions: fr must be page-aligned and non-empty. len(dst) must be at
+// least fr.Length() / usermem.PageSize.
+func (f *MemoryFile) Residency(fr platform.FileRange, dst []byte) error {
+	dst = dst[:fr.Length()/usermem.PageSize]
+	var err error
+	rest := dst
+	if ferr := f.forEachMappingSlice(fr, func(bs []byte) {
+		n := len(bs) / usermem.PageSize
+		if err == nil {
+			err = mincore(bs, rest[:n])
+		}
+		rest = rest[n:]
+	}); ferr != nil {
+		return ferr
+	}
+	if err != nil {
+		return err
+	}
+	// Bits other than the least significant are reserved by mincore(2).
+	for i := range dst {
+		dst[i] &= 1
+	}
+	return nil
+}
+
+// AdviseHugePages asks the host to back fr with huge pages when pages in fr
+// are next committed. Whether it does so depends on the host's transparent
+// huge page configuration for shared memory.
+//
+// Preconditions: fr must be aligned to usermem.HugePageSize and non-empty.
+func (f *MemoryFile) AdviseHugePages(fr platform.FileRange) error {
+	if !fr.WellFormed() || fr.Length() == 0 || fr.Start%usermem.HugePageSize != 0 || fr.End%usermem.HugePageSize != 0 {
+		panic(fmt.Sprintf("invalid range: %v", fr))
+	}
+	var err error
+	if ferr := f.forEachMappingSlice(fr, func(bs []byte) {
+		if err == nil {
+			err = syscall.Madvise(bs, syscall.MADV_HUGEPAGE)
+		}
+	}); ferr != nil {
+		return ferr
+	}
+	return err
+}
+
 func (f *MemoryFile) getChunkMapping(chunk int) ([]uintptr, uintptr, error) {
 	f.mappingsMu.Lock()
 	defer f.mappingsMu.Unlock()
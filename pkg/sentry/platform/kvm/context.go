@@ -15,6 +15,8 @@
 package kvm
 
 import (
+	"sync"
+
 	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/platform/interrupt"
@@ -34,6 +36,22 @@ type context struct {
 
 	// interrupt is the interrupt context.
 	interrupt interrupt.Forwarder
+
+	// hostCPUMu protects hostCPUMask.
+	hostCPUMu sync.Mutex
+
+	// hostCPUMask is the set of host CPUs on which this context executes,
+	// in the format used by sched_setaffinity(2). If hostCPUMask is nil,
+	// the context executes on all host CPUs available to the sandbox.
+	hostCPUMask []byte
+}
+
+// SetCPUMask implements platform.HostCPUPinningContext.SetCPUMask.
+func (c *context) SetCPUMask(mask []byte) {
+	hostMask := c.machine.hostCPUMask(mask)
+	c.hostCPUMu.Lock()
+	c.hostCPUMask = hostMask
+	c.hostCPUMu.Unlock()
 }
 
 // Switch runs the provided context in the given address space.
@@ -49,6 +67,15 @@ func (c *context) Switch(as platform.AddressSpace, ac arch.Context, _ int32) (*a
 		return nil, usermem.NoAccess, platform.ErrContextInterrupt
 	}
 
+	// Restrict the host thread, which is locked by Get, to the requested
+	// host CPUs.
+	if c.machine.hostCPUs != nil {
+		c.hostCPUMu.Lock()
+		hostMask := c.hostCPUMask
+		c.hostCPUMu.Unlock()
+		cpu.setHostCPUMask(hostMask)
+	}
+
 	// Set the active address space.
 	//
 	// This must be done prior to the call to Touch below. If the address
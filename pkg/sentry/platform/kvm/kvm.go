@@ -84,6 +84,26 @@ func New(deviceFile *os.File) (*KVM, error) {
 	}, nil
 }
 
+// EnableHostCPUPinning causes the host threads executing application code to
+// be restricted to the host CPUs corresponding to each task's CPU affinity
+// mask. Application CPU i corresponds to the i-th host CPU available to the
+// sandbox.
+//
+// This must be called before any contexts are created.
+func (k *KVM) EnableHostCPUPinning() error {
+	mask, err := getHostCPUAffinity()
+	if err != nil {
+		return fmt.Errorf("getting host CPU affinity: %v", err)
+	}
+	k.machine.hostCPUs = mask
+	return nil
+}
+
+// HostCPUPinning returns true if EnableHostCPUPinning has been called.
+func (k *KVM) HostCPUPinning() bool {
+	return k.machine.hostCPUs != nil
+}
+
 // SupportsAddressSpaceIO implements platform.Platform.SupportsAddressSpaceIO.
 func (*KVM) SupportsAddressSpaceIO() bool {
 	return false
@@ -15,6 +15,7 @@
 package kvm
 
 import (
+	"bytes"
 	"fmt"
 	"runtime"
 	"sync"
@@ -62,6 +63,13 @@ type machine struct {
 
 	// maxVCPUs is the maximum number of vCPUs supported by the machine.
 	maxVCPUs int
+
+	// hostCPUs is the set of host CPUs available to the sandbox, in the
+	// format used by sched_setaffinity(2). If hostCPUs is nil, host CPU
+	// pinning is disabled.
+	//
+	// hostCPUs is immutable after KVM.EnableHostCPUPinning.
+	hostCPUs []byte
 }
 
 const (
@@ -122,6 +130,12 @@ type vCPU struct {
 	vCPUArchState
 
 	dieState dieState
+
+	// hostCPUMask is the CPU affinity mask last set on the host thread
+	// hostCPUTID by setHostCPUMask. hostCPUMask and hostCPUTID are only
+	// accessed by the host thread that holds the vCPU.
+	hostCPUMask []byte
+	hostCPUTID  uint64
 }
 
 type dieState struct {
@@ -384,6 +398,65 @@ func (m *machine) Get() *vCPU {
 	}
 }
 
+// hostCPUMask returns the mask of host CPUs corresponding to the given mask of
+// application CPUs, or nil if host CPU pinning is disabled or the mask does
+// not restrict execution to fewer host CPUs.
+func (m *machine) hostCPUMask(mask []byte) []byte {
+	if m.hostCPUs == nil {
+		return nil
+	}
+	var (
+		hostMask = make([]byte, len(m.hostCPUs))
+		restrict = false
+		empty    = true
+		appCPU   = 0
+	)
+	for hostCPU := 0; hostCPU < 8*len(m.hostCPUs); hostCPU++ {
+		if m.hostCPUs[hostCPU/8]&(1<<uint(hostCPU%8)) == 0 {
+			continue
+		}
+		if appCPU/8 < len(mask) && mask[appCPU/8]&(1<<uint(appCPU%8)) != 0 {
+			hostMask[hostCPU/8] |= 1 << uint(hostCPU%8)
+			empty = false
+		} else {
+			restrict = true
+		}
+		appCPU++
+	}
+	if empty || !restrict {
+		return nil
+	}
+	return hostMask
+}
+
+// setHostCPUMask restricts the host thread holding c to the host CPUs in mask,
+// or to all host CPUs available to the sandbox if mask is nil.
+//
+// The affinity of the host thread is left as is when c is released, so that
+// it is only changed when the mask of the context running on c changes or c
+// moves to another host thread, rather than on every switch. Other goroutines
+// running on the host thread in the meantime share its affinity.
+//
+// Preconditions: Host CPU pinning must be enabled. c must be held by the
+// current host thread (see machine.Get).
+func (c *vCPU) setHostCPUMask(mask []byte) {
+	if mask == nil {
+		mask = c.machine.hostCPUs
+	}
+	tid := atomic.LoadUint64(&c.tid)
+	if c.hostCPUTID == tid && bytes.Equal(c.hostCPUMask, mask) {
+		return
+	}
+	if err := setHostCPUAffinity(mask); err != nil {
+		log.Warningf("Failed to set host CPU affinity of vCPU thread: %v", err)
+		// The affinity of the thread is unknown.
+		c.hostCPUTID = 0
+		return
+	}
+	c.hostCPUMask = mask
+	c.hostCPUTID = tid
+}
+
 // Put puts the current vCPU.
 func (m *machine) Put(c *vCPU) {
 	c.unlock()
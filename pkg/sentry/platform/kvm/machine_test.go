@@ -0,0 +1,91 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvm
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHostCPUMask(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		hostCPUs []byte
+		mask     []byte
+		want     []byte
+	}{
+		{
+			name:     "pinning disabled",
+			hostCPUs: nil,
+			mask:     []byte{0x01},
+			want:     nil,
+		},
+		{
+			name:     "all CPUs",
+			hostCPUs: []byte{0x0f},
+			mask:     []byte{0x0f},
+			want:     nil,
+		},
+		{
+			name:     "more CPUs than the host",
+			hostCPUs: []byte{0x0f},
+			mask:     []byte{0xff, 0xff},
+			want:     nil,
+		},
+		{
+			name:     "subset",
+			hostCPUs: []byte{0x0f},
+			mask:     []byte{0x05},
+			want:     []byte{0x05},
+		},
+		{
+			name:     "sparse host CPUs",
+			hostCPUs: []byte{0xaa},
+			mask:     []byte{0x03},
+			want:     []byte{0x0a},
+		},
+		{
+			name:     "second byte",
+			hostCPUs: []byte{0xff, 0x01},
+			mask:     []byte{0x00, 0x01},
+			want:     []byte{0x00, 0x01},
+		},
+		{
+			name:     "short mask",
+			hostCPUs: []byte{0xff, 0xff},
+			mask:     []byte{0xff},
+			want:     []byte{0xff, 0x00},
+		},
+		{
+			name:     "only CPUs beyond the host",
+			hostCPUs: []byte{0x03},
+			mask:     []byte{0x04},
+			want:     nil,
+		},
+		{
+			name:     "empty mask",
+			hostCPUs: []byte{0x03},
+			mask:     nil,
+			want:     nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &machine{hostCPUs: tc.hostCPUs}
+			if got := m.hostCPUMask(tc.mask); !bytes.Equal(got, tc.want) || (got == nil) != (tc.want == nil) {
+				t.Errorf("hostCPUMask(%#v) with hostCPUs %#v: got %#v, want %#v", tc.mask, tc.hostCPUs, got, tc.want)
+			}
+		})
+	}
+}
@@ -153,3 +153,37 @@ func (c *vCPU) waitUntilNot(state uint32) {
 		panic("futex wait error")
 	}
 }
+
+// getHostCPUAffinity returns the CPU affinity mask of the current host
+// thread.
+func getHostCPUAffinity() ([]byte, error) {
+	// The kernel's cpumask may be larger than the buffer; grow it until
+	// sched_getaffinity accepts it.
+	for size := 128; ; size *= 2 {
+		mask := make([]byte, size)
+		n, _, errno := syscall.RawSyscall(
+			syscall.SYS_SCHED_GETAFFINITY,
+			0,
+			uintptr(len(mask)),
+			uintptr(unsafe.Pointer(&mask[0])))
+		if errno == syscall.EINVAL && size < 1<<16 {
+			continue
+		}
+		if errno != 0 {
+			return nil, errno
+		}
+		return mask[:n], nil
+	}
+}
+
+// setHostCPUAffinity sets the CPU affinity mask of the current host thread.
+func setHostCPUAffinity(mask []byte) error {
+	if _, _, errno := syscall.RawSyscall(
+		syscall.SYS_SCHED_SETAFFINITY,
+		0,
+		uintptr(len(mask)),
+		uintptr(unsafe.Pointer(&mask[0]))); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -145,6 +145,19 @@ type Context interface {
 	Interrupt()
 }
 
+// HostCPUPinningContext is an optional interface that may be implemented by a
+// Context whose execution can be restricted to a subset of host CPUs.
+type HostCPUPinningContext interface {
+	// SetCPUMask informs the Context of the set of application CPUs on
+	// which the thread is allowed to run, in the format used by
+	// sched_setaffinity(2). Subsequent calls to Switch may restrict the
+	// host thread executing the Context to the corresponding host CPUs.
+	//
+	// SetCPUMask may be called concurrently with Switch. The Context does
+	// not retain mask.
+	SetCPUMask(mask []byte)
+}
+
 var (
 	// ErrContextSignal is returned by Context.Switch() to indicate that the
 	// Context was interrupted by a signal.
@@ -216,6 +229,18 @@ type AddressSpace interface {
 	AddressSpaceIO
 }
 
+// LDTAddressSpace is an optional interface that may be implemented by an
+// AddressSpace that supports x86 local descriptor table entries, as installed
+// by modify_ldt(2).
+type LDTAddressSpace interface {
+	// SetLDTEntry installs desc in the address space's local descriptor
+	// table, replacing any existing entry with the same entry number.
+	//
+	// Preconditions: desc has been validated and normalized by
+	// arch.LDT.Write.
+	SetLDTEntry(desc *linux.UserDesc) error
+}
+
 // AddressSpaceIO supports IO through the memory mappings installed in an
 // AddressSpace.
 //
@@ -65,6 +65,11 @@ var (
 	// stubStart this is valid only after a call to stubInit.
 	stubEnd uintptr
 
+	// stubLDTScratch is the address of a buffer following the stub, used to
+	// pass struct user_desc to modify_ldt(2) in subprocesses. As with
+	// stubStart this is valid only after a call to stubInit.
+	stubLDTScratch uintptr
+
 	// stubInitialized controls one-time stub initialization.
 	stubInitialized sync.Once
 )
@@ -19,6 +19,7 @@ import (
 	"syscall"
 	"unsafe"
 
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/platform/safecopy"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
 )
@@ -44,7 +45,10 @@ func stubInit() {
 	stubBegin := reflect.ValueOf(stub).Pointer()
 	stubLen := int(safecopy.FindEndAddress(stubBegin) - stubBegin)
 	stubSlice := unsafeSlice(stubBegin, stubLen)
-	mapLen := uintptr(stubLen)
+	// Reserve room after the stub for a struct user_desc, aligned for
+	// PTRACE_POKEDATA.
+	ldtScratchOffset := (uintptr(stubLen) + 7) &^ 7
+	mapLen := ldtScratchOffset + linux.SizeOfUserDesc
 	if offset := mapLen % usermem.PageSize; offset != 0 {
 		mapLen += usermem.PageSize - offset
 	}
@@ -89,6 +93,7 @@ func stubInit() {
 
 		// Set the end.
 		stubEnd = stubStart + mapLen
+		stubLDTScratch = stubStart + ldtScratchOffset
 		return
 	}
 
@@ -120,6 +120,13 @@ type subprocess struct {
 	// contexts is the set of contexts for which it's possible that
 	// context.lastFaultSP == this subprocess.
 	contexts map[*context]struct{}
+
+	// ldtMu serializes use of stubLDTScratch, and protects ldtEntries.
+	ldtMu sync.Mutex
+
+	// ldtEntries is the set of non-empty LDT entry numbers installed in the
+	// subprocess.
+	ldtEntries map[uint32]struct{}
 }
 
 // newSubprocess returns a useable subprocess.
@@ -201,7 +208,8 @@ func newSubprocess(create func() (*thread, error)) (*subprocess, error) {
 		syscallThreads: threadPool{
 			threads: make(map[int32]*thread),
 		},
-		contexts: make(map[*context]struct{}),
+		contexts:   make(map[*context]struct{}),
+		ldtEntries: make(map[uint32]struct{}),
 	}
 
 	sp.unmap()
@@ -230,6 +238,7 @@ func (s *subprocess) unmap() {
 func (s *subprocess) Release() {
 	go func() { // S/R-SAFE: Platform.
 		s.unmap()
+		s.clearLDT()
 		globalPool.mu.Lock()
 		globalPool.available = append(globalPool.available, s)
 		globalPool.mu.Unlock()
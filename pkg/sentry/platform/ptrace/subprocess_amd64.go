@@ -17,9 +17,13 @@
 package ptrace
 
 import (
+	"fmt"
+	"runtime"
 	"syscall"
 
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/platform/procid"
 )
 
 const (
@@ -46,12 +50,30 @@ const (
 func (t *thread) resetSysemuRegs(regs *syscall.PtraceRegs) {
 	regs.Cs = t.initRegs.Cs
 	regs.Ss = t.initRegs.Ss
-	regs.Ds = t.initRegs.Ds
-	regs.Es = t.initRegs.Es
-	regs.Fs = t.initRegs.Fs
-	regs.Gs = t.initRegs.Gs
+	// Data segment selectors referring to the LDT were loaded by the
+	// application from entries installed by modify_ldt(2), so preserve them.
+	if !isLDTSelector(regs.Ds) {
+		regs.Ds = t.initRegs.Ds
+	}
+	if !isLDTSelector(regs.Es) {
+		regs.Es = t.initRegs.Es
+	}
+	if !isLDTSelector(regs.Fs) {
+		regs.Fs = t.initRegs.Fs
+	}
+	if !isLDTSelector(regs.Gs) {
+		regs.Gs = t.initRegs.Gs
+	}
+}
+
+// isLDTSelector returns true if the segment selector sel refers to the LDT.
+func isLDTSelector(sel uint64) bool {
+	return sel&selectorTI != 0
 }
 
+// selectorTI is the table indicator bit of a segment selector.
+const selectorTI = 1 << 2
+
 // createSyscallRegs sets up syscall registers.
 //
 // This should be called to generate registers for a system call.
@@ -102,3 +124,71 @@ func syscallReturnValue(regs *syscall.PtraceRegs) (uintptr, error) {
 	}
 	return uintptr(rval), nil
 }
+
+// SetLDTEntry implements platform.LDTAddressSpace.SetLDTEntry.
+func (s *subprocess) SetLDTEntry(desc *linux.UserDesc) error {
+	s.ldtMu.Lock()
+	defer s.ldtMu.Unlock()
+	if err := s.setLDTEntryLocked(desc); err != nil {
+		return err
+	}
+	if desc.Empty() {
+		delete(s.ldtEntries, desc.EntryNumber)
+	} else {
+		s.ldtEntries[desc.EntryNumber] = struct{}{}
+	}
+	return nil
+}
+
+// clearLDT empties all LDT entries installed in the subprocess, so that it
+// may be reused by another address space.
+func (s *subprocess) clearLDT() {
+	s.ldtMu.Lock()
+	defer s.ldtMu.Unlock()
+	for entry := range s.ldtEntries {
+		desc := linux.UserDesc{EntryNumber: entry}
+		desc.SetFlags(false, 0, true, false, true, false)
+		if err := s.setLDTEntryLocked(&desc); err != nil {
+			// We never expect this to happen.
+			panic(fmt.Sprintf("failed to clear LDT entry %d: %v", entry, err))
+		}
+		delete(s.ldtEntries, entry)
+	}
+}
+
+// setLDTEntryLocked installs desc in the subprocess' LDT by executing
+// modify_ldt(2) in the stub, with desc passed through stubLDTScratch.
+//
+// Preconditions: s.ldtMu must be locked.
+func (s *subprocess) setLDTEntryLocked(desc *linux.UserDesc) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	currentTID := int32(procid.Current())
+	t := s.syscallThreads.lookupOrCreate(currentTID, s.newThread)
+
+	words := [linux.SizeOfUserDesc / 8]uint64{
+		uint64(desc.EntryNumber) | uint64(desc.BaseAddr)<<32,
+		uint64(desc.Limit) | uint64(desc.Flags)<<32,
+	}
+	for i, word := range words {
+		if _, _, errno := syscall.RawSyscall6(syscall.SYS_PTRACE, syscall.PTRACE_POKEDATA, uintptr(t.tid), stubLDTScratch+uintptr(i*8), uintptr(word), 0, 0); errno != 0 {
+			return errno
+		}
+	}
+
+	rval, err := t.syscallIgnoreInterrupt(
+		&t.initRegs,
+		syscall.SYS_MODIFY_LDT,
+		arch.SyscallArgument{Value: linux.MODIFY_LDT_WRITE},
+		arch.SyscallArgument{Value: stubLDTScratch},
+		arch.SyscallArgument{Value: linux.SizeOfUserDesc})
+	if err != nil {
+		return err
+	}
+	// modify_ldt(2) returns an int-sized value, so errors are not
+	// sign-extended.
+	if ret := int32(rval); ret < 0 {
+		return syscall.Errno(-ret)
+	}
+	return nil
+}
@@ -190,6 +190,9 @@ func attachedThread(flags uintptr, defaultAction linux.BPFAction) (*thread, erro
 				// Injected to support the address space operations.
 				syscall.SYS_MMAP:   {},
 				syscall.SYS_MUNMAP: {},
+				syscall.SYS_MODIFY_LDT: []seccomp.Rule{
+					{seccomp.AllowValue(linux.MODIFY_LDT_WRITE), seccomp.AllowAny{}, seccomp.AllowValue(linux.SizeOfUserDesc)},
+				},
 			},
 			Action: linux.SECCOMP_RET_ALLOW,
 		})
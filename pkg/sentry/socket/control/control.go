@@ -26,7 +26,10 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/kdefs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/unix/transport"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserr"
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
 )
 
 const maxInt = int(^uint(0) >> 1)
@@ -164,6 +167,89 @@ func (c *scmCredentials) Equals(oc transport.CredentialsControlMessage) bool {
 	return false
 }
 
+// NewHostSCMCredentials creates a new SCM_CREDENTIALS socket control message
+// representation for credentials received over a host socket. The sender is
+// outside of the sandbox, so its PID is reported as 0 and its host user and
+// group IDs are used as KUID and KGID.
+func NewHostSCMCredentials(cred linux.ControlMessageCredentials) SCMCredentials {
+	return &scmCredentials{kuid: auth.KUID(cred.UID), kgid: auth.KGID(cred.GID)}
+}
+
+// peerCredentials implements transport.PeerCredentials.
+//
+// +stateify savable
+type peerCredentials struct {
+	// tg is the thread group of the process, or nil if it is outside of the
+	// sandbox.
+	tg *kernel.ThreadGroup
+
+	kuid   auth.KUID
+	kgid   auth.KGID
+	groups []auth.KGID
+}
+
+// NewPeerCredentials returns the credentials of t, to be reported to the peer
+// of a socket.
+func NewPeerCredentials(t *kernel.Task) transport.PeerCredentials {
+	tcred := t.Credentials()
+	return &peerCredentials{
+		tg:     t.ThreadGroup(),
+		kuid:   tcred.EffectiveKUID,
+		kgid:   tcred.EffectiveKGID,
+		groups: tcred.ExtraKGIDs,
+	}
+}
+
+// NewHostPeerCredentials returns the credentials of the peer of a host socket,
+// as reported by the host. As for NewHostSCMCredentials, the PID is reported
+// as 0 and the host user and group IDs are used as KUID and KGID.
+func NewHostPeerCredentials(cred linux.ControlMessageCredentials, groups []uint32) transport.PeerCredentials {
+	pc := &peerCredentials{
+		kuid: auth.KUID(cred.UID),
+		kgid: auth.KGID(cred.GID),
+	}
+	for _, g := range groups {
+		pc.groups = append(pc.groups, auth.KGID(g))
+	}
+	return pc
+}
+
+// PeerCredentials returns the credentials reported by SO_PEERCRED, as seen by
+// t. Like Linux, sockets without peer credentials report a PID of 0 and the
+// overflow user and group IDs.
+func PeerCredentials(t *kernel.Task, creds transport.PeerCredentials) linux.ControlMessageCredentials {
+	pc, ok := creds.(*peerCredentials)
+	if !ok {
+		return linux.ControlMessageCredentials{
+			UID: uint32(auth.OverflowUID),
+			GID: uint32(auth.OverflowGID),
+		}
+	}
+	var pid kernel.ThreadID
+	if pc.tg != nil {
+		pid = t.PIDNamespace().IDOfThreadGroup(pc.tg)
+	}
+	return linux.ControlMessageCredentials{
+		PID: int32(pid),
+		UID: uint32(pc.kuid.In(t.UserNamespace()).OrOverflow()),
+		GID: uint32(pc.kgid.In(t.UserNamespace()).OrOverflow()),
+	}
+}
+
+// PeerGroups returns the supplementary groups reported by SO_PEERGROUPS, as
+// seen by t. ok is false if the socket has no peer credentials.
+func PeerGroups(t *kernel.Task, creds transport.PeerCredentials) (groups []uint32, ok bool) {
+	pc, ok := creds.(*peerCredentials)
+	if !ok {
+		return nil, false
+	}
+	groups = make([]uint32, 0, len(pc.groups))
+	for _, kgid := range pc.groups {
+		groups = append(groups, uint32(kgid.In(t.UserNamespace()).OrOverflow()))
+	}
+	return groups, true
+}
+
 func putUint64(buf []byte, n uint64) []byte {
 	usermem.ByteOrder.PutUint64(buf[len(buf):len(buf)+8], n)
 	return buf[:len(buf)+8]
@@ -212,14 +298,14 @@ func putCmsg(buf []byte, msgType uint32, align uint, data []int32) []byte {
 	return alignSlice(buf, align)
 }
 
-func putCmsgStruct(buf []byte, msgType uint32, align uint, data interface{}) []byte {
+func putCmsgStruct(buf []byte, level, msgType uint32, align uint, data interface{}) []byte {
 	if cap(buf)-len(buf) < linux.SizeOfControlMessageHeader {
 		return buf
 	}
 	ob := buf
 
 	buf = putUint64(buf, uint64(linux.SizeOfControlMessageHeader))
-	buf = putUint32(buf, linux.SOL_SOCKET)
+	buf = putUint32(buf, level)
 	buf = putUint32(buf, msgType)
 
 	hdrBuf := buf
@@ -244,7 +330,13 @@ func (c *scmCredentials) Credentials(t *kernel.Task) (kernel.ThreadID, auth.UID,
 	// of SCM_CREDENTIALS in unix(7)), they are translated into the
 	// corresponding values as per the receiving process's user and group ID
 	// mappings." - user_namespaces(7)
-	pid := t.PIDNamespace().IDOfTask(c.t)
+	//
+	// Like Linux, report the thread group of the sender. c.t is nil for
+	// credentials received over a host socket, for which pid is 0.
+	var pid kernel.ThreadID
+	if c.t != nil {
+		pid = t.PIDNamespace().IDOfThreadGroup(c.t.ThreadGroup())
+	}
 	uid := c.kuid.In(t.UserNamespace()).OrOverflow()
 	gid := c.kgid.In(t.UserNamespace()).OrOverflow()
 
@@ -294,12 +386,38 @@ func alignSlice(buf []byte, align uint) []byte {
 func PackTimestamp(t *kernel.Task, timestamp int64, buf []byte) []byte {
 	return putCmsgStruct(
 		buf,
+		linux.SOL_SOCKET,
 		linux.SO_TIMESTAMP,
 		t.Arch().Width(),
 		linux.NsecToTimeval(timestamp),
 	)
 }
 
+// PackSockErr packs an IP_RECVERR or IPV6_RECVERR socket control message,
+// depending on the network protocol of the endpoint that reported serr.
+//
+// The address of the node that reported the error isn't known, so it's
+// reported as AF_UNSPEC.
+func PackSockErr(t *kernel.Task, serr *tcpip.SockError, buf []byte) []byte {
+	ee := linux.SockExtendedErr{
+		Errno:  uint32(syserr.TranslateNetstackError(serr.Err).ToLinux().Number()),
+		Origin: uint8(serr.Origin),
+		Type:   serr.Type,
+		Code:   serr.Code,
+		Info:   serr.Info,
+	}
+	if serr.NetProto == header.IPv6ProtocolNumber {
+		return putCmsgStruct(buf, linux.SOL_IPV6, linux.IPV6_RECVERR, t.Arch().Width(), struct {
+			linux.SockExtendedErr
+			Offender linux.SockAddrInet6
+		}{SockExtendedErr: ee})
+	}
+	return putCmsgStruct(buf, linux.SOL_IP, linux.IP_RECVERR, t.Arch().Width(), struct {
+		linux.SockExtendedErr
+		Offender linux.SockAddrInet
+	}{SockExtendedErr: ee})
+}
+
 // Parse parses a raw socket control message into portable objects.
 func Parse(t *kernel.Task, socketOrEndpoint interface{}, buf []byte) (transport.ControlMessages, error) {
 	var (
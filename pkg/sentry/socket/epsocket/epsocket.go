@@ -33,6 +33,7 @@ import (
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/binary"
+	"gvisor.googlesource.com/gvisor/pkg/bpf"
 	"gvisor.googlesource.com/gvisor/pkg/metric"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
@@ -51,6 +52,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
 	"gvisor.googlesource.com/gvisor/pkg/waiter"
 )
@@ -101,37 +103,67 @@ var Metrics = tcpip.Stats{
 		},
 		V6PacketsSent: tcpip.ICMPv6SentPacketStats{
 			ICMPv6PacketStats: tcpip.ICMPv6PacketStats{
-				EchoRequest:     mustCreateMetric("/netstack/icmp/v6/packets_sent/echo_request", "Total number of ICMPv6 echo request packets sent by netstack."),
-				EchoReply:       mustCreateMetric("/netstack/icmp/v6/packets_sent/echo_reply", "Total number of ICMPv6 echo reply packets sent by netstack."),
-				DstUnreachable:  mustCreateMetric("/netstack/icmp/v6/packets_sent/dst_unreachable", "Total number of ICMPv6 destination unreachable packets sent by netstack."),
-				PacketTooBig:    mustCreateMetric("/netstack/icmp/v6/packets_sent/packet_too_big", "Total number of ICMPv6 packet too big packets sent by netstack."),
-				TimeExceeded:    mustCreateMetric("/netstack/icmp/v6/packets_sent/time_exceeded", "Total number of ICMPv6 time exceeded packets sent by netstack."),
-				ParamProblem:    mustCreateMetric("/netstack/icmp/v6/packets_sent/param_problem", "Total number of ICMPv6 parameter problem packets sent by netstack."),
-				RouterSolicit:   mustCreateMetric("/netstack/icmp/v6/packets_sent/router_solicit", "Total number of ICMPv6 router solicit packets sent by netstack."),
-				RouterAdvert:    mustCreateMetric("/netstack/icmp/v6/packets_sent/router_advert", "Total number of ICMPv6 router advert packets sent by netstack."),
-				NeighborSolicit: mustCreateMetric("/netstack/icmp/v6/packets_sent/neighbor_solicit", "Total number of ICMPv6 neighbor solicit packets sent by netstack."),
-				NeighborAdvert:  mustCreateMetric("/netstack/icmp/v6/packets_sent/neighbor_advert", "Total number of ICMPv6 neighbor advert packets sent by netstack."),
-				RedirectMsg:     mustCreateMetric("/netstack/icmp/v6/packets_sent/redirect_msg", "Total number of ICMPv6 redirect message packets sent by netstack."),
+				EchoRequest:               mustCreateMetric("/netstack/icmp/v6/packets_sent/echo_request", "Total number of ICMPv6 echo request packets sent by netstack."),
+				EchoReply:                 mustCreateMetric("/netstack/icmp/v6/packets_sent/echo_reply", "Total number of ICMPv6 echo reply packets sent by netstack."),
+				DstUnreachable:            mustCreateMetric("/netstack/icmp/v6/packets_sent/dst_unreachable", "Total number of ICMPv6 destination unreachable packets sent by netstack."),
+				PacketTooBig:              mustCreateMetric("/netstack/icmp/v6/packets_sent/packet_too_big", "Total number of ICMPv6 packet too big packets sent by netstack."),
+				TimeExceeded:              mustCreateMetric("/netstack/icmp/v6/packets_sent/time_exceeded", "Total number of ICMPv6 time exceeded packets sent by netstack."),
+				ParamProblem:              mustCreateMetric("/netstack/icmp/v6/packets_sent/param_problem", "Total number of ICMPv6 parameter problem packets sent by netstack."),
+				RouterSolicit:             mustCreateMetric("/netstack/icmp/v6/packets_sent/router_solicit", "Total number of ICMPv6 router solicit packets sent by netstack."),
+				RouterAdvert:              mustCreateMetric("/netstack/icmp/v6/packets_sent/router_advert", "Total number of ICMPv6 router advert packets sent by netstack."),
+				NeighborSolicit:           mustCreateMetric("/netstack/icmp/v6/packets_sent/neighbor_solicit", "Total number of ICMPv6 neighbor solicit packets sent by netstack."),
+				NeighborAdvert:            mustCreateMetric("/netstack/icmp/v6/packets_sent/neighbor_advert", "Total number of ICMPv6 neighbor advert packets sent by netstack."),
+				RedirectMsg:               mustCreateMetric("/netstack/icmp/v6/packets_sent/redirect_msg", "Total number of ICMPv6 redirect message packets sent by netstack."),
+				MulticastListenerQuery:    mustCreateMetric("/netstack/icmp/v6/packets_sent/multicast_listener_query", "Total number of MLD multicast listener query packets sent by netstack."),
+				MulticastListenerReport:   mustCreateMetric("/netstack/icmp/v6/packets_sent/multicast_listener_report", "Total number of MLDv1 multicast listener report packets sent by netstack."),
+				MulticastListenerDone:     mustCreateMetric("/netstack/icmp/v6/packets_sent/multicast_listener_done", "Total number of MLDv1 multicast listener done packets sent by netstack."),
+				MulticastListenerV2Report: mustCreateMetric("/netstack/icmp/v6/packets_sent/multicast_listener_v2_report", "Total number of MLDv2 multicast listener report packets sent by netstack."),
 			},
 			Dropped: mustCreateMetric("/netstack/icmp/v6/packets_sent/dropped", "Total number of ICMPv6 packets dropped by netstack due to link layer errors."),
 		},
 		V6PacketsReceived: tcpip.ICMPv6ReceivedPacketStats{
 			ICMPv6PacketStats: tcpip.ICMPv6PacketStats{
-				EchoRequest:     mustCreateMetric("/netstack/icmp/v6/packets_received/echo_request", "Total number of ICMPv6 echo request packets received by netstack."),
-				EchoReply:       mustCreateMetric("/netstack/icmp/v6/packets_received/echo_reply", "Total number of ICMPv6 echo reply packets received by netstack."),
-				DstUnreachable:  mustCreateMetric("/netstack/icmp/v6/packets_received/dst_unreachable", "Total number of ICMPv6 destination unreachable packets received by netstack."),
-				PacketTooBig:    mustCreateMetric("/netstack/icmp/v6/packets_received/packet_too_big", "Total number of ICMPv6 packet too big packets received by netstack."),
-				TimeExceeded:    mustCreateMetric("/netstack/icmp/v6/packets_received/time_exceeded", "Total number of ICMPv6 time exceeded packets received by netstack."),
-				ParamProblem:    mustCreateMetric("/netstack/icmp/v6/packets_received/param_problem", "Total number of ICMPv6 parameter problem packets received by netstack."),
-				RouterSolicit:   mustCreateMetric("/netstack/icmp/v6/packets_received/router_solicit", "Total number of ICMPv6 router solicit packets received by netstack."),
-				RouterAdvert:    mustCreateMetric("/netstack/icmp/v6/packets_received/router_advert", "Total number of ICMPv6 router advert packets received by netstack."),
-				NeighborSolicit: mustCreateMetric("/netstack/icmp/v6/packets_received/neighbor_solicit", "Total number of ICMPv6 neighbor solicit packets received by netstack."),
-				NeighborAdvert:  mustCreateMetric("/netstack/icmp/v6/packets_received/neighbor_advert", "Total number of ICMPv6 neighbor advert packets received by netstack."),
-				RedirectMsg:     mustCreateMetric("/netstack/icmp/v6/packets_received/redirect_msg", "Total number of ICMPv6 redirect message packets received by netstack."),
+				EchoRequest:               mustCreateMetric("/netstack/icmp/v6/packets_received/echo_request", "Total number of ICMPv6 echo request packets received by netstack."),
+				EchoReply:                 mustCreateMetric("/netstack/icmp/v6/packets_received/echo_reply", "Total number of ICMPv6 echo reply packets received by netstack."),
+				DstUnreachable:            mustCreateMetric("/netstack/icmp/v6/packets_received/dst_unreachable", "Total number of ICMPv6 destination unreachable packets received by netstack."),
+				PacketTooBig:              mustCreateMetric("/netstack/icmp/v6/packets_received/packet_too_big", "Total number of ICMPv6 packet too big packets received by netstack."),
+				TimeExceeded:              mustCreateMetric("/netstack/icmp/v6/packets_received/time_exceeded", "Total number of ICMPv6 time exceeded packets received by netstack."),
+				ParamProblem:              mustCreateMetric("/netstack/icmp/v6/packets_received/param_problem", "Total number of ICMPv6 parameter problem packets received by netstack."),
+				RouterSolicit:             mustCreateMetric("/netstack/icmp/v6/packets_received/router_solicit", "Total number of ICMPv6 router solicit packets received by netstack."),
+				RouterAdvert:              mustCreateMetric("/netstack/icmp/v6/packets_received/router_advert", "Total number of ICMPv6 router advert packets received by netstack."),
+				NeighborSolicit:           mustCreateMetric("/netstack/icmp/v6/packets_received/neighbor_solicit", "Total number of ICMPv6 neighbor solicit packets received by netstack."),
+				NeighborAdvert:            mustCreateMetric("/netstack/icmp/v6/packets_received/neighbor_advert", "Total number of ICMPv6 neighbor advert packets received by netstack."),
+				RedirectMsg:               mustCreateMetric("/netstack/icmp/v6/packets_received/redirect_msg", "Total number of ICMPv6 redirect message packets received by netstack."),
+				MulticastListenerQuery:    mustCreateMetric("/netstack/icmp/v6/packets_received/multicast_listener_query", "Total number of MLD multicast listener query packets received by netstack."),
+				MulticastListenerReport:   mustCreateMetric("/netstack/icmp/v6/packets_received/multicast_listener_report", "Total number of MLDv1 multicast listener report packets received by netstack."),
+				MulticastListenerDone:     mustCreateMetric("/netstack/icmp/v6/packets_received/multicast_listener_done", "Total number of MLDv1 multicast listener done packets received by netstack."),
+				MulticastListenerV2Report: mustCreateMetric("/netstack/icmp/v6/packets_received/multicast_listener_v2_report", "Total number of MLDv2 multicast listener report packets received by netstack."),
 			},
 			Invalid: mustCreateMetric("/netstack/icmp/v6/packets_received/invalid", "Total number of ICMPv6 packets received that the transport layer could not parse."),
 		},
 	},
+	IGMP: tcpip.IGMPStats{
+		PacketsSent: tcpip.IGMPSentPacketStats{
+			IGMPPacketStats: tcpip.IGMPPacketStats{
+				MembershipQuery:    mustCreateMetric("/netstack/igmp/packets_sent/membership_query", "Total number of IGMP membership query packets sent by netstack."),
+				V1MembershipReport: mustCreateMetric("/netstack/igmp/packets_sent/v1_membership_report", "Total number of IGMPv1 membership report packets sent by netstack."),
+				V2MembershipReport: mustCreateMetric("/netstack/igmp/packets_sent/v2_membership_report", "Total number of IGMPv2 membership report packets sent by netstack."),
+				LeaveGroup:         mustCreateMetric("/netstack/igmp/packets_sent/leave_group", "Total number of IGMPv2 leave group packets sent by netstack."),
+				V3MembershipReport: mustCreateMetric("/netstack/igmp/packets_sent/v3_membership_report", "Total number of IGMPv3 membership report packets sent by netstack."),
+			},
+			Dropped: mustCreateMetric("/netstack/igmp/packets_sent/dropped", "Total number of IGMP packets dropped by netstack due to link layer errors."),
+		},
+		PacketsReceived: tcpip.IGMPReceivedPacketStats{
+			IGMPPacketStats: tcpip.IGMPPacketStats{
+				MembershipQuery:    mustCreateMetric("/netstack/igmp/packets_received/membership_query", "Total number of IGMP membership query packets received by netstack."),
+				V1MembershipReport: mustCreateMetric("/netstack/igmp/packets_received/v1_membership_report", "Total number of IGMPv1 membership report packets received by netstack."),
+				V2MembershipReport: mustCreateMetric("/netstack/igmp/packets_received/v2_membership_report", "Total number of IGMPv2 membership report packets received by netstack."),
+				LeaveGroup:         mustCreateMetric("/netstack/igmp/packets_received/leave_group", "Total number of IGMPv2 leave group packets received by netstack."),
+				V3MembershipReport: mustCreateMetric("/netstack/igmp/packets_received/v3_membership_report", "Total number of IGMPv3 membership report packets received by netstack."),
+			},
+			Invalid: mustCreateMetric("/netstack/igmp/packets_received/invalid", "Total number of IGMP packets received that netstack could not parse."),
+		},
+	},
 	IP: tcpip.IPStats{
 		PacketsReceived:          mustCreateMetric("/netstack/ip/packets_received", "Total number of IP packets received from the link layer in nic.DeliverNetworkPacket."),
 		InvalidAddressesReceived: mustCreateMetric("/netstack/ip/invalid_addresses_received", "Total number of IP packets received with an unknown or invalid destination address."),
@@ -154,6 +186,9 @@ var Metrics = tcpip.Stats{
 		SlowStartRetransmits:      mustCreateMetric("/netstack/tcp/slow_start_retransmits", "Number of segments retransmitted in slow start mode."),
 		FastRetransmit:            mustCreateMetric("/netstack/tcp/fast_retransmit", "Number of TCP segments which were fast retransmitted."),
 		Timeouts:                  mustCreateMetric("/netstack/tcp/timeouts", "Number of times RTO expired."),
+		MTUProbes:                 mustCreateMetric("/netstack/tcp/mtu_probes", "Number of path MTU probes sent."),
+		TailLossProbes:            mustCreateMetric("/netstack/tcp/tail_loss_probes", "Number of tail loss probes sent."),
+		MD5Failures:               mustCreateMetric("/netstack/tcp/md5_failures", "Number of segments dropped because of a missing, unexpected or wrong MD5 signature."),
 	},
 	UDP: tcpip.UDPStats{
 		PacketsReceived:          mustCreateMetric("/netstack/udp/packets_received", "Number of UDP datagrams received via HandlePacket."),
@@ -162,6 +197,20 @@ var Metrics = tcpip.Stats{
 		MalformedPacketsReceived: mustCreateMetric("/netstack/udp/malformed_packets_received", "Number of incoming UDP datagrams dropped due to the UDP header being in a malformed state."),
 		PacketsSent:              mustCreateMetric("/netstack/udp/packets_sent", "Number of UDP datagrams sent via sendUDP."),
 	},
+	SCTP: tcpip.SCTPStats{
+		ActiveEstablishments:      mustCreateMetric("/netstack/sctp/active_establishments", "Number of SCTP associations established after sending an INIT."),
+		PassiveEstablishments:     mustCreateMetric("/netstack/sctp/passive_establishments", "Number of SCTP associations established after receiving an INIT."),
+		FailedAssociationAttempts: mustCreateMetric("/netstack/sctp/failed_association_attempts", "Number of SCTP associations that failed before being established."),
+		Aborts:                    mustCreateMetric("/netstack/sctp/aborts", "Number of established SCTP associations that were aborted."),
+		Shutdowns:                 mustCreateMetric("/netstack/sctp/shutdowns", "Number of SCTP associations that were shut down gracefully."),
+		PacketsReceived:           mustCreateMetric("/netstack/sctp/packets_received", "Number of SCTP packets received."),
+		PacketsSent:               mustCreateMetric("/netstack/sctp/packets_sent", "Number of SCTP packets sent."),
+		ChecksumErrors:            mustCreateMetric("/netstack/sctp/checksum_errors", "Number of SCTP packets dropped because of an invalid checksum."),
+		MalformedPacketsReceived:  mustCreateMetric("/netstack/sctp/malformed_packets_received", "Number of SCTP packets dropped because their chunks are malformed."),
+		OutOfTheBluePackets:       mustCreateMetric("/netstack/sctp/out_of_the_blue_packets", "Number of SCTP packets received that don't belong to any association."),
+		Retransmits:               mustCreateMetric("/netstack/sctp/retransmits", "Number of SCTP DATA chunks retransmitted."),
+		AbandonedMessages:         mustCreateMetric("/netstack/sctp/abandoned_messages", "Number of SCTP messages abandoned by partial reliability."),
+	},
 }
 
 const sizeOfInt32 int = 4
@@ -220,6 +269,7 @@ type SocketOperations struct {
 	family   int
 	Endpoint tcpip.Endpoint
 	skType   transport.SockType
+	protocol tcpip.TransportProtocolNumber
 
 	// readMu protects access to the below fields.
 	readMu sync.Mutex `state:"nosave"`
@@ -244,7 +294,7 @@ type SocketOperations struct {
 }
 
 // New creates a new endpoint socket.
-func New(t *kernel.Task, family int, skType transport.SockType, queue *waiter.Queue, endpoint tcpip.Endpoint) (*fs.File, *syserr.Error) {
+func New(t *kernel.Task, family int, skType transport.SockType, protocol tcpip.TransportProtocolNumber, queue *waiter.Queue, endpoint tcpip.Endpoint) (*fs.File, *syserr.Error) {
 	if skType == transport.SockStream {
 		if err := endpoint.SetSockOpt(tcpip.DelayOption(1)); err != nil {
 			return nil, syserr.TranslateNetstackError(err)
@@ -258,9 +308,15 @@ func New(t *kernel.Task, family int, skType transport.SockType, queue *waiter.Qu
 		family:   family,
 		Endpoint: endpoint,
 		skType:   skType,
+		protocol: protocol,
 	}), nil
 }
 
+// Type returns the family, type and transport protocol of the socket.
+func (s *SocketOperations) Type() (family int, skType transport.SockType, protocol tcpip.TransportProtocolNumber) {
+	return s.family, s.skType, s.protocol
+}
+
 var sockAddrInetSize = int(binary.Size(linux.SockAddrInet{}))
 var sockAddrInet6Size = int(binary.Size(linux.SockAddrInet6{}))
 
@@ -542,7 +598,7 @@ func (s *SocketOperations) Accept(t *kernel.Task, peerRequested bool, flags int,
 		}
 	}
 
-	ns, err := New(t, s.family, s.skType, wq, ep)
+	ns, err := New(t, s.family, s.skType, s.protocol, wq, ep)
 	if err != nil {
 		return 0, nil, 0, err
 	}
@@ -637,6 +693,12 @@ func GetSockOpt(t *kernel.Task, s socket.Socket, ep commonEndpoint, family int,
 	case linux.SOL_TCP:
 		return getSockOptTCP(t, ep, name, outLen)
 
+	case linux.SOL_SCTP:
+		return getSockOptSCTP(t, ep, name, outLen)
+
+	case linux.SOL_MPTCP:
+		return getSockOptMPTCP(t, ep, name, outLen)
+
 	case linux.SOL_IPV6:
 		return getSockOptIPv6(t, ep, name, outLen)
 
@@ -677,16 +739,9 @@ func getSockOptSocket(t *kernel.Task, s socket.Socket, ep commonEndpoint, family
 		return int32(syserr.TranslateNetstackError(err).ToLinux().Number()), nil
 
 	case linux.SO_PEERCRED:
-		if family != linux.AF_UNIX || outLen < syscall.SizeofUcred {
-			return nil, syserr.ErrInvalidArgument
-		}
-
-		tcred := t.Credentials()
-		return syscall.Ucred{
-			Pid: int32(t.ThreadGroup().ID()),
-			Uid: uint32(tcred.EffectiveKUID.In(tcred.UserNamespace).OrOverflow()),
-			Gid: uint32(tcred.EffectiveKGID.In(tcred.UserNamespace).OrOverflow()),
-		}, nil
+		// Unix sockets report the credentials of their peer themselves;
+		// see unix.SocketOperations.GetSockOpt.
+		return nil, syserr.ErrInvalidArgument
 
 	case linux.SO_PASSCRED:
 		if outLen < sizeOfInt32 {
@@ -732,6 +787,22 @@ func getSockOptSocket(t *kernel.Task, s socket.Socket, ep commonEndpoint, family
 
 		return int32(size), nil
 
+	case linux.SO_MEMINFO:
+		var v tcpip.MemInfoOption
+		if err := ep.GetSockOpt(&v); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+
+		mem := MemInfo(&v)
+
+		// Linux truncates the output binary to outLen.
+		ib := binary.Marshal(nil, usermem.ByteOrder, &mem)
+		if len(ib) > outLen {
+			ib = ib[:outLen]
+		}
+
+		return ib, nil
+
 	case linux.SO_REUSEADDR:
 		if outLen < sizeOfInt32 {
 			return nil, syserr.ErrInvalidArgument
@@ -768,6 +839,35 @@ func getSockOptSocket(t *kernel.Task, s socket.Socket, ep commonEndpoint, family
 
 		return int32(v), nil
 
+	case linux.SO_BINDTODEVICE:
+		if outLen < linux.IFNAMSIZ {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		var v tcpip.BindToDeviceOption
+		if err := ep.GetSockOpt(&v); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+
+		// Like Linux, the name is returned with its NUL terminator, and
+		// nothing is returned if the socket isn't bound to a device.
+		if v == "" {
+			return []byte{}, nil
+		}
+		return append([]byte(v), 0), nil
+
+	case linux.SO_LOCK_FILTER:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		var v tcpip.LockFilterOption
+		if err := ep.GetSockOpt(&v); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+
+		return int32(v), nil
+
 	case linux.SO_KEEPALIVE:
 		if outLen < sizeOfInt32 {
 			return nil, syserr.ErrInvalidArgument
@@ -892,9 +992,7 @@ func getSockOptTCP(t *kernel.Task, ep commonEndpoint, name, outLen int) (interfa
 			return nil, syserr.TranslateNetstackError(err)
 		}
 
-		// TODO: Translate fields once they are added to
-		// tcpip.TCPInfoOption.
-		info := linux.TCPInfo{}
+		info := TCPInfo(&v, time.Now())
 
 		// Linux truncates the output binary to outLen.
 		ib := binary.Marshal(nil, usermem.ByteOrder, &info)
@@ -904,8 +1002,17 @@ func getSockOptTCP(t *kernel.Task, ep commonEndpoint, name, outLen int) (interfa
 
 		return ib, nil
 
-	case linux.TCP_CC_INFO,
-		linux.TCP_NOTSENT_LOWAT,
+	case linux.TCP_CC_INFO:
+		var v tcpip.TCPInfoOption
+		if err := ep.GetSockOpt(&v); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+
+		// Neither reno nor cubic export information, so Linux returns
+		// no data for them.
+		return []byte{}, nil
+
+	case linux.TCP_NOTSENT_LOWAT,
 		linux.TCP_ZEROCOPY_RECEIVE:
 
 		t.Kernel().EmitUnimplementedEvent(t)
@@ -916,6 +1023,244 @@ func getSockOptTCP(t *kernel.Task, ep commonEndpoint, name, outLen int) (interfa
 	return nil, syserr.ErrProtocolNotAvailable
 }
 
+// MemInfo converts v to the values returned by SO_MEMINFO.
+func MemInfo(v *tcpip.MemInfoOption) [linux.SK_MEMINFO_VARS]uint32 {
+	clamp := func(n int) uint32 {
+		if n > math.MaxInt32 {
+			return math.MaxInt32
+		}
+		return uint32(n)
+	}
+
+	var mem [linux.SK_MEMINFO_VARS]uint32
+	mem[linux.SK_MEMINFO_RMEM_ALLOC] = clamp(v.RcvQueued)
+	mem[linux.SK_MEMINFO_RCVBUF] = clamp(v.RcvBufSize)
+	mem[linux.SK_MEMINFO_WMEM_ALLOC] = clamp(v.SndAlloc)
+	mem[linux.SK_MEMINFO_SNDBUF] = clamp(v.SndBufSize)
+	mem[linux.SK_MEMINFO_WMEM_QUEUED] = clamp(v.SndQueued)
+	return mem
+}
+
+// TCPInfo translates the TCP statistics of v to a Linux struct tcp_info at
+// time now.
+func TCPInfo(v *tcpip.TCPInfoOption, now time.Time) linux.TCPInfo {
+	toUsec := func(d time.Duration) uint32 {
+		return uint32(d / time.Microsecond)
+	}
+	msecSince := func(t time.Time) uint32 {
+		if t.IsZero() {
+			return 0
+		}
+		return uint32(now.Sub(t) / time.Millisecond)
+	}
+	clamp := func(n int) uint32 {
+		if n > math.MaxInt32 {
+			return math.MaxInt32
+		}
+		return uint32(n)
+	}
+
+	info := linux.TCPInfo{
+		State:         uint8(v.State),
+		CaState:       uint8(v.CAState),
+		Retransmits:   uint8(v.Timeouts),
+		Backoff:       uint8(v.Timeouts),
+		RTO:           toUsec(v.RTO),
+		SndMss:        uint32(v.SndMSS),
+		RcvMss:        uint32(v.RcvMSS),
+		Unacked:       uint32(v.Unacked),
+		Sacked:        uint32(v.Sacked),
+		LastDataSent:  msecSince(v.LastDataSent),
+		LastDataRecv:  msecSince(v.LastDataRecv),
+		LastAckRecv:   msecSince(v.LastAckRecv),
+		PMTU:          uint32(v.PMTU),
+		RcvSsthresh:   clamp(v.RcvSpace),
+		RTT:           toUsec(v.RTT),
+		RTTVar:        toUsec(v.RTTVar),
+		SndSsthresh:   clamp(v.SndSsthresh),
+		SndCwnd:       uint32(v.SndCwnd),
+		Advmss:        uint32(v.AdvMSS),
+		Reordering:    uint32(v.Reordering),
+		RcvSpace:      clamp(v.RcvSpace),
+		TotalRetrans:  v.TotalRetrans,
+		MaxPacingRate: math.MaxUint64,
+		BytesAcked:    v.BytesAcked,
+		BytesReceived: v.BytesReceived,
+		SegsOut:       uint32(v.SegsOut),
+		SegsIn:        uint32(v.SegsIn),
+		NotSentBytes:  uint32(v.NotSentBytes),
+		DataSegsIn:    uint32(v.DataSegsIn),
+		DataSegsOut:   uint32(v.DataSegsOut),
+		DeliveryRate:  v.DeliveryRate,
+		BusyTime:      uint64(v.BusyTime / time.Microsecond),
+	}
+
+	if v.TimestampsEnabled {
+		info.Options |= linux.TCPI_OPT_TIMESTAMPS
+	}
+	if v.SACKPermitted {
+		info.Options |= linux.TCPI_OPT_SACK
+	}
+	if v.WindowScaleEnabled {
+		info.Options |= linux.TCPI_OPT_WSCALE
+		info.WindowScale = v.SndWndScale&0xf | v.RcvWndScale<<4
+	}
+	if v.DeliveryRateAppLimited {
+		info.DeliveryRateAppLimited = 1
+	}
+
+	// Linux reports an unknown minimum RTT as ~0.
+	info.MinRTT = math.MaxUint32
+	if v.MinRTT != 0 {
+		info.MinRTT = toUsec(v.MinRTT)
+	}
+
+	// The pacing rate is derived from the delivery rate as Linux does: it's
+	// doubled in slow start, and increased by a fifth in congestion
+	// avoidance.
+	if v.SndCwnd < v.SndSsthresh/2 {
+		info.PacingRate = 2 * v.DeliveryRate
+	} else {
+		info.PacingRate = v.DeliveryRate * 6 / 5
+	}
+
+	return info
+}
+
+// getSockOptMPTCP implements GetSockOpt when level is SOL_MPTCP.
+func getSockOptMPTCP(t *kernel.Task, ep commonEndpoint, name, outLen int) (interface{}, *syserr.Error) {
+	switch name {
+	case linux.MPTCP_INFO:
+		var v tcpip.MPTCPInfoOption
+		if err := ep.GetSockOpt(&v); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+
+		info := linux.MPTCPInfo{
+			Subflows:           v.Subflows,
+			AddAddrSignal:      v.AddAddrSignal,
+			AddAddrAccepted:    v.AddAddrAccepted,
+			SubflowsMax:        v.SubflowsMax,
+			AddAddrSignalMax:   v.AddAddrSignalMax,
+			AddAddrAcceptedMax: v.AddAddrAcceptedMax,
+			Token:              v.Token,
+			WriteSeq:           v.WriteSeq,
+			SndUna:             v.SndUna,
+			RcvNxt:             v.RcvNxt,
+			LocalAddrUsed:      v.LocalAddrUsed,
+			LocalAddrMax:       v.LocalAddrMax,
+		}
+		if v.Flags&tcpip.MPTCPInfoFallback != 0 {
+			info.Flags |= linux.MPTCP_INFO_FLAG_FALLBACK
+		}
+		if v.Flags&tcpip.MPTCPInfoRemoteKeyReceived != 0 {
+			info.Flags |= linux.MPTCP_INFO_FLAG_REMOTE_KEY_RECEIVED
+		}
+
+		// Linux truncates the output binary to outLen.
+		ib := binary.Marshal(nil, usermem.ByteOrder, &info)
+		if len(ib) > outLen {
+			ib = ib[:outLen]
+		}
+
+		return ib, nil
+
+	default:
+		t.Kernel().EmitUnimplementedEvent(t)
+	}
+	return nil, syserr.ErrProtocolNotAvailable
+}
+
+// getSockOptSCTP implements GetSockOpt when level is SOL_SCTP.
+func getSockOptSCTP(t *kernel.Task, ep commonEndpoint, name, outLen int) (interface{}, *syserr.Error) {
+	switch name {
+	case linux.SCTP_NODELAY:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		var v tcpip.DelayOption
+		if err := ep.GetSockOpt(&v); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+
+		if v == 0 {
+			return int32(1), nil
+		}
+		return int32(0), nil
+
+	case linux.SCTP_RTOINFO:
+		if outLen < int(binary.Size(linux.SCTPRTOInfo{})) {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		var v tcpip.SCTPRTOInfoOption
+		if err := ep.GetSockOpt(&v); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+
+		return linux.SCTPRTOInfo{
+			Initial: uint32(v.Initial / time.Millisecond),
+			Max:     uint32(v.Max / time.Millisecond),
+			Min:     uint32(v.Min / time.Millisecond),
+		}, nil
+
+	case linux.SCTP_INITMSG:
+		if outLen < int(binary.Size(linux.SCTPInitMsg{})) {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		var v tcpip.SCTPInitMsgOption
+		if err := ep.GetSockOpt(&v); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+
+		return linux.SCTPInitMsg{
+			NumOstreams:    v.NumOutboundStreams,
+			MaxInstreams:   v.MaxInboundStreams,
+			MaxAttempts:    v.MaxAttempts,
+			MaxInitTimeout: uint16(v.MaxInitTimeout / time.Millisecond),
+		}, nil
+
+	case linux.SCTP_PR_SUPPORTED:
+		if outLen < int(binary.Size(linux.SCTPAssocValue{})) {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		var v tcpip.SCTPPartialReliabilityOption
+		if err := ep.GetSockOpt(&v); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+
+		return linux.SCTPAssocValue{Value: uint32(v)}, nil
+
+	case linux.SCTP_DEFAULT_PRINFO:
+		if outLen < int(binary.Size(linux.SCTPDefaultPRInfo{})) {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		var v tcpip.SCTPDefaultPRInfoOption
+		if err := ep.GetSockOpt(&v); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+
+		info := linux.SCTPDefaultPRInfo{Value: v.Value}
+		switch v.Policy {
+		case tcpip.SCTPPRPolicyTTL:
+			info.Policy = linux.SCTP_PR_SCTP_TTL
+		case tcpip.SCTPPRPolicyRTX:
+			info.Policy = linux.SCTP_PR_SCTP_RTX
+		default:
+			info.Policy = linux.SCTP_PR_SCTP_NONE
+		}
+		return info, nil
+
+	default:
+		t.Kernel().EmitUnimplementedEvent(t)
+	}
+	return nil, syserr.ErrProtocolNotAvailable
+}
+
 // getSockOptIPv6 implements GetSockOpt when level is SOL_IPV6.
 func getSockOptIPv6(t *kernel.Task, ep commonEndpoint, name, outLen int) (interface{}, *syserr.Error) {
 	switch name {
@@ -931,6 +1276,18 @@ func getSockOptIPv6(t *kernel.Task, ep commonEndpoint, name, outLen int) (interf
 
 		return int32(v), nil
 
+	case linux.IPV6_RECVERR:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		var v tcpip.RecvErrOption
+		if err := ep.GetSockOpt(&v); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+
+		return int32(v), nil
+
 	case linux.IPV6_PATHMTU:
 		t.Kernel().EmitUnimplementedEvent(t)
 
@@ -984,6 +1341,18 @@ func getSockOptIP(t *kernel.Task, ep commonEndpoint, name, outLen int) (interfac
 		}
 		return int32(0), nil
 
+	case linux.IP_RECVERR:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		var v tcpip.RecvErrOption
+		if err := ep.GetSockOpt(&v); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+
+		return int32(v), nil
+
 	default:
 		emitUnimplementedEventIP(t, name)
 	}
@@ -1021,6 +1390,9 @@ func SetSockOpt(t *kernel.Task, s socket.Socket, ep commonEndpoint, level int, n
 	case linux.SOL_TCP:
 		return setSockOptTCP(t, ep, name, optVal)
 
+	case linux.SOL_SCTP:
+		return setSockOptSCTP(t, ep, name, optVal)
+
 	case linux.SOL_IPV6:
 		return setSockOptIPv6(t, ep, name, optVal)
 
@@ -1082,6 +1454,69 @@ func setSockOptSocket(t *kernel.Task, s socket.Socket, ep commonEndpoint, name i
 		v := usermem.ByteOrder.Uint32(optVal)
 		return syserr.TranslateNetstackError(ep.SetSockOpt(tcpip.BroadcastOption(v)))
 
+	case linux.SO_BINDTODEVICE:
+		// Binding to a device requires CAP_NET_RAW, as in Linux.
+		if !t.HasCapability(linux.CAP_NET_RAW) {
+			return syserr.ErrNotPermitted
+		}
+
+		// The name is truncated to IFNAMSIZ-1 bytes and ends at the
+		// first NUL, if any.
+		if len(optVal) > linux.IFNAMSIZ-1 {
+			optVal = optVal[:linux.IFNAMSIZ-1]
+		}
+		if n := bytes.IndexByte(optVal, 0); n >= 0 {
+			optVal = optVal[:n]
+		}
+		return syserr.TranslateNetstackError(ep.SetSockOpt(tcpip.BindToDeviceOption(optVal)))
+
+	case linux.SO_ATTACH_FILTER:
+		if len(optVal) < linux.SizeOfSockFprog {
+			return syserr.ErrInvalidArgument
+		}
+
+		var fprog linux.SockFprog
+		binary.Unmarshal(optVal[:linux.SizeOfSockFprog], usermem.ByteOrder, &fprog)
+		if fprog.Len == 0 || int(fprog.Len) > bpf.MaxInstructions {
+			return syserr.ErrInvalidArgument
+		}
+		insns := make([]linux.BPFInstruction, int(fprog.Len))
+		if _, err := t.CopyIn(usermem.Addr(fprog.Filter), &insns); err != nil {
+			return syserr.FromError(err)
+		}
+		f, err := newSocketFilter(insns)
+		if err != nil {
+			t.Debugf("Invalid socket filter: %v", err)
+			return syserr.ErrInvalidArgument
+		}
+		return syserr.TranslateNetstackError(ep.SetSockOpt(tcpip.AttachFilterOption{Filter: f}))
+
+	case linux.SO_ATTACH_BPF:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		// eBPF programs can't be loaded, so the file descriptor can't
+		// refer to one.
+		fd := kdefs.FD(usermem.ByteOrder.Uint32(optVal))
+		file := t.FDMap().GetFile(fd)
+		if file == nil {
+			return syserr.ErrBadFD
+		}
+		file.DecRef()
+		return syserr.ErrInvalidArgument
+
+	case linux.SO_DETACH_FILTER:
+		return syserr.TranslateNetstackError(ep.SetSockOpt(tcpip.DetachFilterOption{}))
+
+	case linux.SO_LOCK_FILTER:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		v := usermem.ByteOrder.Uint32(optVal)
+		return syserr.TranslateNetstackError(ep.SetSockOpt(tcpip.LockFilterOption(v)))
+
 	case linux.SO_PASSCRED:
 		if len(optVal) < sizeOfInt32 {
 			return syserr.ErrInvalidArgument
@@ -1185,6 +1620,13 @@ func setSockOptTCP(t *kernel.Task, ep commonEndpoint, name int, optVal []byte) *
 		}
 		return syserr.TranslateNetstackError(ep.SetSockOpt(tcpip.KeepaliveIntervalOption(time.Second * time.Duration(v))))
 
+	case linux.TCP_MD5SIG, linux.TCP_MD5SIG_EXT:
+		o, err := copyInTCPMD5Sig(optVal, name == linux.TCP_MD5SIG_EXT)
+		if err != nil {
+			return err
+		}
+		return syserr.TranslateNetstackError(ep.SetSockOpt(o))
+
 	case linux.TCP_REPAIR_OPTIONS:
 		t.Kernel().EmitUnimplementedEvent(t)
 
@@ -1196,6 +1638,141 @@ func setSockOptTCP(t *kernel.Task, ep commonEndpoint, name int, optVal []byte) *
 	return syserr.TranslateNetstackError(ep.SetSockOpt(struct{}{}))
 }
 
+var tcpMD5SigSize = int(binary.Size(linux.TCPMD5Sig{}))
+
+// copyInTCPMD5Sig converts a struct tcp_md5sig to a TCPMD5SigOption. Its
+// prefix length is only honored by TCP_MD5SIG_EXT, otherwise the key applies
+// to a single address. Like Linux, IPv4-mapped IPv6 addresses are treated as
+// IPv4 addresses.
+func copyInTCPMD5Sig(optVal []byte, ext bool) (tcpip.TCPMD5SigOption, *syserr.Error) {
+	if len(optVal) < tcpMD5SigSize {
+		return tcpip.TCPMD5SigOption{}, syserr.ErrInvalidArgument
+	}
+
+	var sig linux.TCPMD5Sig
+	binary.Unmarshal(optVal[:tcpMD5SigSize], usermem.ByteOrder, &sig)
+	if sig.Keylen > linux.TCPMD5SigMaxKeyLen {
+		return tcpip.TCPMD5SigOption{}, syserr.ErrInvalidArgument
+	}
+
+	var addr tcpip.Address
+	switch usermem.ByteOrder.Uint16(sig.Addr[:]) {
+	case linux.AF_INET:
+		var a linux.SockAddrInet
+		binary.Unmarshal(sig.Addr[:sockAddrInetSize], usermem.ByteOrder, &a)
+		addr = tcpip.Address(a.Addr[:])
+	case linux.AF_INET6:
+		var a linux.SockAddrInet6
+		binary.Unmarshal(sig.Addr[:sockAddrInet6Size], usermem.ByteOrder, &a)
+		addr = tcpip.Address(a.Addr[:])
+		if header.IsV4MappedAddress(addr) {
+			addr = addr[header.IPv6AddressSize-header.IPv4AddressSize:]
+		}
+	default:
+		return tcpip.TCPMD5SigOption{}, syserr.ErrInvalidArgument
+	}
+
+	o := tcpip.TCPMD5SigOption{
+		Addr:      addr,
+		PrefixLen: len(addr) * 8,
+		Key:       sig.Key[:sig.Keylen],
+	}
+	if ext {
+		if sig.Flags&linux.TCP_MD5SIG_FLAG_IFINDEX != 0 && sig.Ifindex != 0 {
+			// Keys scoped to an interface aren't supported.
+			return tcpip.TCPMD5SigOption{}, syserr.ErrInvalidArgument
+		}
+		if sig.Flags&linux.TCP_MD5SIG_FLAG_PREFIX != 0 {
+			if int(sig.Prefixlen) > len(addr)*8 {
+				return tcpip.TCPMD5SigOption{}, syserr.ErrInvalidArgument
+			}
+			o.PrefixLen = int(sig.Prefixlen)
+		}
+	}
+	return o, nil
+}
+
+// setSockOptSCTP implements SetSockOpt when level is SOL_SCTP.
+func setSockOptSCTP(t *kernel.Task, ep commonEndpoint, name int, optVal []byte) *syserr.Error {
+	switch name {
+	case linux.SCTP_NODELAY:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		v := usermem.ByteOrder.Uint32(optVal)
+		var o tcpip.DelayOption
+		if v == 0 {
+			o = 1
+		}
+		return syserr.TranslateNetstackError(ep.SetSockOpt(o))
+
+	case linux.SCTP_RTOINFO:
+		var v linux.SCTPRTOInfo
+		if len(optVal) < int(binary.Size(v)) {
+			return syserr.ErrInvalidArgument
+		}
+
+		binary.Unmarshal(optVal[:binary.Size(v)], usermem.ByteOrder, &v)
+		return syserr.TranslateNetstackError(ep.SetSockOpt(tcpip.SCTPRTOInfoOption{
+			Initial: time.Duration(v.Initial) * time.Millisecond,
+			Min:     time.Duration(v.Min) * time.Millisecond,
+			Max:     time.Duration(v.Max) * time.Millisecond,
+		}))
+
+	case linux.SCTP_INITMSG:
+		var v linux.SCTPInitMsg
+		if len(optVal) < int(binary.Size(v)) {
+			return syserr.ErrInvalidArgument
+		}
+
+		binary.Unmarshal(optVal[:binary.Size(v)], usermem.ByteOrder, &v)
+		return syserr.TranslateNetstackError(ep.SetSockOpt(tcpip.SCTPInitMsgOption{
+			NumOutboundStreams: v.NumOstreams,
+			MaxInboundStreams:  v.MaxInstreams,
+			MaxAttempts:        v.MaxAttempts,
+			MaxInitTimeout:     time.Duration(v.MaxInitTimeout) * time.Millisecond,
+		}))
+
+	case linux.SCTP_PR_SUPPORTED:
+		var v linux.SCTPAssocValue
+		if len(optVal) < int(binary.Size(v)) {
+			return syserr.ErrInvalidArgument
+		}
+
+		binary.Unmarshal(optVal[:binary.Size(v)], usermem.ByteOrder, &v)
+		var o tcpip.SCTPPartialReliabilityOption
+		if v.Value != 0 {
+			o = 1
+		}
+		return syserr.TranslateNetstackError(ep.SetSockOpt(o))
+
+	case linux.SCTP_DEFAULT_PRINFO:
+		var v linux.SCTPDefaultPRInfo
+		if len(optVal) < int(binary.Size(v)) {
+			return syserr.ErrInvalidArgument
+		}
+
+		binary.Unmarshal(optVal[:binary.Size(v)], usermem.ByteOrder, &v)
+		o := tcpip.SCTPDefaultPRInfoOption{Value: v.Value}
+		switch v.Policy {
+		case linux.SCTP_PR_SCTP_NONE:
+			o.Policy = tcpip.SCTPPRPolicyNone
+		case linux.SCTP_PR_SCTP_TTL:
+			o.Policy = tcpip.SCTPPRPolicyTTL
+		case linux.SCTP_PR_SCTP_RTX:
+			o.Policy = tcpip.SCTPPRPolicyRTX
+		default:
+			return syserr.ErrInvalidArgument
+		}
+		return syserr.TranslateNetstackError(ep.SetSockOpt(o))
+
+	default:
+		t.Kernel().EmitUnimplementedEvent(t)
+	}
+	return syserr.ErrProtocolNotAvailable
+}
+
 // setSockOptIPv6 implements SetSockOpt when level is SOL_IPV6.
 func setSockOptIPv6(t *kernel.Task, ep commonEndpoint, name int, optVal []byte) *syserr.Error {
 	switch name {
@@ -1207,6 +1784,14 @@ func setSockOptIPv6(t *kernel.Task, ep commonEndpoint, name int, optVal []byte)
 		v := usermem.ByteOrder.Uint32(optVal)
 		return syserr.TranslateNetstackError(ep.SetSockOpt(tcpip.V6OnlyOption(v)))
 
+	case linux.IPV6_RECVERR:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		v := usermem.ByteOrder.Uint32(optVal)
+		return syserr.TranslateNetstackError(ep.SetSockOpt(tcpip.RecvErrOption(v)))
+
 	case linux.IPV6_ADD_MEMBERSHIP,
 		linux.IPV6_DROP_MEMBERSHIP,
 		linux.IPV6_IPSEC_POLICY,
@@ -1350,6 +1935,16 @@ func setSockOptIP(t *kernel.Task, ep commonEndpoint, name int, optVal []byte) *s
 			tcpip.MulticastLoopOption(v != 0),
 		))
 
+	case linux.IP_RECVERR:
+		v, err := parseIntOrChar(optVal)
+		if err != nil {
+			return err
+		}
+
+		return syserr.TranslateNetstackError(ep.SetSockOpt(
+			tcpip.RecvErrOption(v),
+		))
+
 	case linux.MCAST_JOIN_GROUP:
 		// FIXME: Implement MCAST_JOIN_GROUP.
 		t.Kernel().EmitUnimplementedEvent(t)
@@ -1371,7 +1966,6 @@ func setSockOptIP(t *kernel.Task, ep commonEndpoint, name int, optVal []byte) *s
 		linux.IP_OPTIONS,
 		linux.IP_PASSSEC,
 		linux.IP_PKTINFO,
-		linux.IP_RECVERR,
 		linux.IP_RECVFRAGSIZE,
 		linux.IP_RECVOPTS,
 		linux.IP_RECVORIGDSTADDR,
@@ -1463,7 +2057,6 @@ func emitUnimplementedEventIPv6(t *kernel.Task, name int) {
 		linux.IPV6_MULTICAST_IF,
 		linux.IPV6_MULTICAST_LOOP,
 		linux.IPV6_RECVDSTOPTS,
-		linux.IPV6_RECVERR,
 		linux.IPV6_RECVFRAGSIZE,
 		linux.IPV6_RECVHOPLIMIT,
 		linux.IPV6_RECVHOPOPTS,
@@ -1500,7 +2093,6 @@ func emitUnimplementedEventIP(t *kernel.Task, name int) {
 		linux.IP_PKTINFO,
 		linux.IP_PKTOPTIONS,
 		linux.IP_MTU_DISCOVER,
-		linux.IP_RECVERR,
 		linux.IP_RECVTTL,
 		linux.IP_RECVTOS,
 		linux.IP_MTU,
@@ -1813,7 +2405,7 @@ func (s *SocketOperations) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags
 	// We'll have to block. Register for notifications and keep trying to
 	// send all the data.
 	e, ch := waiter.NewChannelEntry(nil)
-	s.EventRegister(&e, waiter.EventIn)
+	s.EventRegister(&e, waiter.EventIn|waiter.EventErr)
 	defer s.EventUnregister(&e)
 
 	for {
@@ -1925,6 +2517,155 @@ func (s *SocketOperations) SendMsg(t *kernel.Task, src usermem.IOSequence, to []
 	}
 }
 
+// RecvErrQueue implements socket.ErrQueueSocket.RecvErrQueue.
+func (s *SocketOperations) RecvErrQueue(t *kernel.Task, dst usermem.IOSequence, senderRequested bool) (int, interface{}, uint32, socket.ControlMessages, *syserr.Error) {
+	qe, ok := s.Endpoint.(tcpip.ErrQueueEndpoint)
+	if !ok {
+		// The error queue of other endpoints is always empty.
+		return 0, nil, 0, socket.ControlMessages{}, syserr.ErrTryAgain
+	}
+
+	serr, err := qe.ReadErrQueue()
+	if err != nil {
+		return 0, nil, 0, socket.ControlMessages{}, syserr.TranslateNetstackError(err)
+	}
+
+	// Like Linux, return the payload of the packet that caused the error,
+	// and its destination as the sender.
+	n, e := dst.CopyOut(t, serr.Payload)
+	if e != nil {
+		return 0, nil, 0, socket.ControlMessages{}, syserr.FromError(e)
+	}
+	var addr interface{}
+	var addrLen uint32
+	if senderRequested {
+		addr, addrLen = ConvertAddress(s.family, serr.Dst)
+	}
+	return n, addr, addrLen, socket.ControlMessages{IP: tcpip.ControlMessages{SockErr: &serr}}, nil
+}
+
+// RecvMMsg implements socket.BatchSocket.RecvMMsg.
+func (s *SocketOperations) RecvMMsg(t *kernel.Task, msgs []socket.MMsg, flags int, haveDeadline bool, deadline ktime.Time) (int, *syserr.Error) {
+	// The first message is received as by recvmsg(2), blocking if needed.
+	m := &msgs[0]
+	var err *syserr.Error
+	m.N, m.SenderAddr, m.SenderAddrLen, m.ControlMessages, err = s.RecvMsg(t, m.Data, flags, haveDeadline, deadline, m.SenderRequested, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	be, ok := s.Endpoint.(tcpip.BatchEndpoint)
+	if !ok || !s.isPacketBased() || flags&linux.MSG_PEEK != 0 || len(msgs) == 1 {
+		return 1, nil
+	}
+	return 1 + s.recvBatch(t, be, msgs[1:], flags&linux.MSG_TRUNC != 0), nil
+}
+
+// recvBatch receives the datagrams pending on be into msgs, reading them from
+// the endpoint at once, and returns how many were received.
+func (s *SocketOperations) recvBatch(t *kernel.Task, be tcpip.BatchEndpoint, msgs []socket.MMsg, trunc bool) int {
+	s.readMu.Lock()
+	defer s.readMu.Unlock()
+
+	// A datagram fetched by a concurrent peek must be received first.
+	if len(s.readView) > 0 {
+		return 0
+	}
+
+	views := make([]buffer.View, len(msgs))
+	addrs := make([]tcpip.FullAddress, len(msgs))
+	cms := make([]tcpip.ControlMessages, len(msgs))
+	n, err := be.ReadBatch(views, addrs, cms)
+	if err != nil {
+		return 0
+	}
+
+	for i := 0; i < n; i++ {
+		m := &msgs[i]
+		c, err := m.Data.CopyOut(t, views[i])
+		if err != nil {
+			// Like Linux, drop the datagram that can't be copied
+			// out. The ones after it, which were already read from
+			// the endpoint, are dropped as well.
+			return i
+		}
+		s.readCM = cms[i]
+		s.updateTimestamp()
+
+		m.N = c
+		if trunc {
+			m.N = len(views[i])
+		}
+		if m.SenderRequested {
+			m.SenderAddr, m.SenderAddrLen = ConvertAddress(s.family, addrs[i])
+		}
+		m.ControlMessages = s.controlMessages()
+	}
+	return n
+}
+
+// SendMMsg implements socket.BatchSocket.SendMMsg.
+func (s *SocketOperations) SendMMsg(t *kernel.Task, msgs []socket.MMsg, flags int, haveDeadline bool, deadline ktime.Time) (int, *syserr.Error) {
+	be, ok := s.Endpoint.(tcpip.BatchEndpoint)
+	if !ok || !s.isPacketBased() {
+		m := &msgs[0]
+		var err *syserr.Error
+		m.N, err = s.SendMsg(t, m.Data, m.To, flags, haveDeadline, deadline, socket.ControlMessages{})
+		if m.N == 0 && err != nil {
+			return 0, err
+		}
+		return 1, nil
+	}
+
+	var addr *tcpip.FullAddress
+	if len(msgs[0].To) > 0 {
+		addrBuf, err := GetAddress(s.family, msgs[0].To)
+		if err != nil {
+			return 0, err
+		}
+		addr = &addrBuf
+	}
+
+	// Datagrams to the same destination are written at once, so that the
+	// endpoint looks up their route once.
+	ps := make([]tcpip.Payload, 0, len(msgs))
+	for i := range msgs {
+		m := &msgs[i]
+		if i > 0 && !bytes.Equal(m.To, msgs[0].To) {
+			break
+		}
+		v := buffer.NewView(int(m.Data.NumBytes()))
+		if _, err := m.Data.CopyIn(t, v); err != nil {
+			if i == 0 {
+				return 0, syserr.FromError(err)
+			}
+			break
+		}
+		ps = append(ps, tcpip.SlicePayload(v))
+	}
+
+	opts := tcpip.WriteOptions{
+		To:          addr,
+		More:        flags&linux.MSG_MORE != 0,
+		EndOfRecord: flags&linux.MSG_EOR != 0,
+	}
+
+	n, resCh, err := be.WriteBatch(ps, opts)
+	if resCh != nil {
+		if err := t.Block(resCh); err != nil {
+			return 0, syserr.FromError(err)
+		}
+		n, _, err = be.WriteBatch(ps, opts)
+	}
+	if n == 0 {
+		return 0, syserr.TranslateNetstackError(err)
+	}
+	for i := 0; i < n; i++ {
+		msgs[i].N = ps[i].Size()
+	}
+	return n, nil
+}
+
 // Ioctl implements fs.FileOperations.Ioctl.
 func (s *SocketOperations) Ioctl(ctx context.Context, io usermem.IO, args arch.SyscallArguments) (uintptr, error) {
 	// SIOCGSTAMP is implemented by epsocket rather than all commonEndpoint
@@ -1997,7 +2738,7 @@ func Ioctl(ctx context.Context, ep commonEndpoint, io usermem.IO, args arch.Sysc
 
 		return 0, err
 
-	case linux.TIOCINQ:
+	case linux.SIOCINQ:
 		var v tcpip.ReceiveQueueSizeOption
 		if err := ep.GetSockOpt(&v); err != nil {
 			return 0, syserr.TranslateNetstackError(err).ToError()
@@ -2012,7 +2753,7 @@ func Ioctl(ctx context.Context, ep commonEndpoint, io usermem.IO, args arch.Sysc
 		})
 		return 0, err
 
-	case linux.TIOCOUTQ:
+	case linux.SIOCOUTQ:
 		var v tcpip.SendQueueSizeOption
 		if err := ep.GetSockOpt(&v); err != nil {
 			return 0, syserr.TranslateNetstackError(err).ToError()
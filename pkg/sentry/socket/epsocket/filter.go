@@ -0,0 +1,68 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package epsocket
+
+import (
+	"fmt"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/binary"
+	"gvisor.googlesource.com/gvisor/pkg/bpf"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+)
+
+// socketFilter is a classic BPF program attached to a socket with
+// SO_ATTACH_FILTER. It implements tcpip.SocketFilter.
+//
+// +stateify savable
+type socketFilter struct {
+	// insns are the instructions of the program, which is compiled again
+	// on restore.
+	insns []linux.BPFInstruction
+
+	prog bpf.Program `state:"nosave"`
+}
+
+// newSocketFilter compiles the classic BPF program insns into a socket filter.
+func newSocketFilter(insns []linux.BPFInstruction) (*socketFilter, error) {
+	prog, err := bpf.Compile(insns)
+	if err != nil {
+		return nil, err
+	}
+	return &socketFilter{insns: insns, prog: prog}, nil
+}
+
+// afterLoad is invoked by stateify.
+func (f *socketFilter) afterLoad() {
+	prog, err := bpf.Compile(f.insns)
+	if err != nil {
+		panic(fmt.Sprintf("failed to compile saved socket filter: %v", err))
+	}
+	f.prog = prog
+}
+
+// Filter implements tcpip.SocketFilter.Filter. Packets are accessed in network
+// byte order, and are dropped if the program makes an invalid load, as in
+// Linux.
+func (f *socketFilter) Filter(pkt buffer.VectorisedView) int {
+	ret, err := bpf.Exec(f.prog, bpf.InputBytes{Data: pkt.ToView(), Order: binary.BigEndian})
+	if err != nil {
+		return 0
+	}
+	if uint64(ret) > uint64(pkt.Size()) {
+		return pkt.Size()
+	}
+	return int(ret)
+}
@@ -29,6 +29,8 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv4"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/mptcp"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/sctp"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/tcp"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/udp"
 	"gvisor.googlesource.com/gvisor/pkg/waiter"
@@ -41,14 +43,25 @@ type provider struct {
 }
 
 // getTransportProtocol figures out transport protocol. Currently only TCP,
-// UDP, and ICMP are supported.
+// MPTCP, UDP, SCTP and ICMP are supported.
 func getTransportProtocol(ctx context.Context, stype transport.SockType, protocol int) (tcpip.TransportProtocolNumber, *syserr.Error) {
 	switch stype {
 	case linux.SOCK_STREAM:
-		if protocol != 0 && protocol != syscall.IPPROTO_TCP {
+		switch protocol {
+		case 0, syscall.IPPROTO_TCP:
+			return tcp.ProtocolNumber, nil
+		case syscall.IPPROTO_SCTP:
+			return sctp.ProtocolNumber, nil
+		case linux.IPPROTO_MPTCP:
+			return mptcp.ProtocolNumber, nil
+		}
+		return 0, syserr.ErrInvalidArgument
+
+	case linux.SOCK_SEQPACKET:
+		if protocol != 0 && protocol != syscall.IPPROTO_SCTP {
 			return 0, syserr.ErrInvalidArgument
 		}
-		return tcp.ProtocolNumber, nil
+		return sctp.ProtocolNumber, nil
 
 	case linux.SOCK_DGRAM:
 		switch protocol {
@@ -108,7 +121,16 @@ func (p *provider) Socket(t *kernel.Task, stype transport.SockType, protocol int
 		return nil, syserr.TranslateNetstackError(e)
 	}
 
-	return New(t, p.family, stype, wq, ep)
+	// SOCK_SEQPACKET SCTP sockets are one-to-many style sockets (RFC 6458
+	// section 3).
+	if stype == linux.SOCK_SEQPACKET {
+		if e := ep.SetSockOpt(tcpip.SCTPOneToManyOption(1)); e != nil {
+			ep.Close()
+			return nil, syserr.TranslateNetstackError(e)
+		}
+	}
+
+	return New(t, p.family, stype, transProto, wq, ep)
 }
 
 // Pair just returns nil sockets (not supported).
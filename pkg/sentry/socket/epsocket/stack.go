@@ -15,10 +15,19 @@
 package epsocket
 
 import (
+	"io"
+	"sync"
+
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/log"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/inet"
 	"gvisor.googlesource.com/gvisor/pkg/syserr"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/qdisc"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/tunnel"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/wireguard"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/arp"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv4"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv6"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
@@ -30,6 +39,15 @@ import (
 // +stateify savable
 type Stack struct {
 	Stack *stack.Stack `state:"manual"`
+
+	// mu protects wireguard and tunnels.
+	mu sync.Mutex `state:"nosave"`
+
+	// wireguard maps the IDs of the WireGuard NICs to their devices.
+	wireguard map[tcpip.NICID]*wireguard.Device `state:"nosave"`
+
+	// tunnels maps the IDs of the tunnel NICs to their settings.
+	tunnels map[tcpip.NICID]inet.Tunnel `state:"nosave"`
 }
 
 // SupportsIPv6 implements Stack.SupportsIPv6.
@@ -39,11 +57,18 @@ func (s *Stack) SupportsIPv6() bool {
 
 // Interfaces implements inet.Stack.Interfaces.
 func (s *Stack) Interfaces() map[int32]inet.Interface {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	is := make(map[int32]inet.Interface)
 	for id, ni := range s.Stack.NICInfo() {
 		var devType uint16
 		if ni.Flags.Loopback {
 			devType = linux.ARPHRD_LOOPBACK
+		} else if _, ok := s.wireguard[id]; ok {
+			devType = linux.ARPHRD_NONE
+		} else if t, ok := s.tunnels[id]; ok {
+			devType = tunnelDeviceType(&t)
 		}
 		is[int32(id)] = inet.Interface{
 			Name:       ni.Name,
@@ -85,6 +110,24 @@ func (s *Stack) InterfaceAddrs() map[int32][]inet.InterfaceAddr {
 	return nicAddrs
 }
 
+// InterfaceStatistics implements inet.Stack.InterfaceStatistics.
+func (s *Stack) InterfaceStatistics() map[int32]inet.InterfaceStatistics {
+	stats := make(map[int32]inet.InterfaceStatistics)
+	for id, ni := range s.Stack.NICInfo() {
+		is := inet.InterfaceStatistics{
+			RxPackets: ni.Stats.Rx.Packets.Value(),
+			RxBytes:   ni.Stats.Rx.Bytes.Value(),
+			TxPackets: ni.Stats.Tx.Packets.Value(),
+			TxBytes:   ni.Stats.Tx.Bytes.Value(),
+		}
+		if q, err := s.Stack.QueueingDiscipline(id); err == nil && q != nil {
+			is.TxDropped = q.Stats().Drops
+		}
+		stats[int32(id)] = is
+	}
+	return stats
+}
+
 // TCPReceiveBufferSize implements inet.Stack.TCPReceiveBufferSize.
 func (s *Stack) TCPReceiveBufferSize() (inet.TCPBufferSize, error) {
 	var rs tcp.ReceiveBufferSizeOption
@@ -138,3 +181,386 @@ func (s *Stack) TCPSACKEnabled() (bool, error) {
 func (s *Stack) SetTCPSACKEnabled(enabled bool) error {
 	return syserr.TranslateNetstackError(s.Stack.SetTransportProtocolOption(tcp.ProtocolNumber, tcp.SACKEnabled(enabled))).ToError()
 }
+
+// QueueingDisciplines implements inet.Stack.QueueingDisciplines.
+func (s *Stack) QueueingDisciplines() map[int32]inet.QueueingDiscipline {
+	qs := make(map[int32]inet.QueueingDiscipline)
+	for id := range s.Stack.NICInfo() {
+		q, err := s.Stack.QueueingDiscipline(id)
+		if err != nil || q == nil {
+			continue
+		}
+
+		var iq inet.QueueingDiscipline
+		switch q := q.(type) {
+		case *qdisc.FQ:
+			opts := q.Options()
+			iq = inet.QueueingDiscipline{
+				Kind:           inet.QueueingDisciplineFQ,
+				Limit:          opts.Limit,
+				FlowLimit:      opts.FlowLimit,
+				Quantum:        opts.Quantum,
+				InitialQuantum: opts.InitialQuantum,
+				MaxRate:        opts.MaxRate,
+			}
+		case *qdisc.TBF:
+			opts := q.Options()
+			iq = inet.QueueingDiscipline{
+				Kind:  inet.QueueingDisciplineTBF,
+				Limit: opts.Limit,
+				Rate:  opts.Rate,
+				Burst: opts.Burst,
+			}
+		case *qdisc.Netem:
+			opts := q.Options()
+			iq = inet.QueueingDiscipline{
+				Kind:    inet.QueueingDisciplineNetem,
+				Limit:   opts.Limit,
+				Latency: opts.Latency,
+				Jitter:  opts.Jitter,
+				Loss:    opts.Loss,
+			}
+		default:
+			log.Warningf("Unknown queueing discipline %T on NIC %d", q, id)
+			continue
+		}
+		stats := q.Stats()
+		iq.Stats = inet.QueueingDisciplineStats{
+			Packets:    stats.Packets,
+			Bytes:      stats.Bytes,
+			Drops:      stats.Drops,
+			Overlimits: stats.Overlimits,
+			QueueLen:   stats.QueueLen,
+			Backlog:    stats.Backlog,
+		}
+		qs[int32(id)] = iq
+	}
+	return qs
+}
+
+// SetQueueingDiscipline implements inet.Stack.SetQueueingDiscipline.
+func (s *Stack) SetQueueingDiscipline(idx int32, q inet.QueueingDiscipline) error {
+	var sq stack.QueueingDiscipline
+	switch q.Kind {
+	case inet.QueueingDisciplineFQ:
+		sq = qdisc.NewFQ(qdisc.FQOptions{
+			Limit:          q.Limit,
+			FlowLimit:      q.FlowLimit,
+			Quantum:        q.Quantum,
+			InitialQuantum: q.InitialQuantum,
+			MaxRate:        q.MaxRate,
+		})
+	case inet.QueueingDisciplineTBF:
+		if q.Rate == 0 || q.Burst == 0 {
+			return syserror.EINVAL
+		}
+		sq = qdisc.NewTBF(qdisc.TBFOptions{
+			Rate:  q.Rate,
+			Burst: q.Burst,
+			Limit: q.Limit,
+		})
+	case inet.QueueingDisciplineNetem:
+		if q.Latency < 0 || q.Jitter < 0 {
+			return syserror.EINVAL
+		}
+		sq = qdisc.NewNetem(qdisc.NetemOptions{
+			Latency: q.Latency,
+			Jitter:  q.Jitter,
+			Loss:    q.Loss,
+			Limit:   q.Limit,
+		})
+	default:
+		return syserror.ENOENT
+	}
+	if err := s.Stack.SetQueueingDiscipline(tcpip.NICID(idx), sq); err != nil {
+		sq.Close()
+		return syserr.TranslateNetstackError(err).ToError()
+	}
+	return nil
+}
+
+// RemoveQueueingDiscipline implements inet.Stack.RemoveQueueingDiscipline.
+func (s *Stack) RemoveQueueingDiscipline(idx int32) error {
+	q, err := s.Stack.QueueingDiscipline(tcpip.NICID(idx))
+	if err != nil {
+		return syserr.TranslateNetstackError(err).ToError()
+	}
+	if q == nil {
+		return syserror.ENOENT
+	}
+	return syserr.TranslateNetstackError(s.Stack.SetQueueingDiscipline(tcpip.NICID(idx), nil)).ToError()
+}
+
+// AddInterfaceAddr implements inet.Stack.AddInterfaceAddr.
+func (s *Stack) AddInterfaceAddr(idx int32, addr inet.InterfaceAddr) error {
+	proto, ok := familyToNetProto(addr.Family)
+	if !ok || !s.Stack.CheckNetworkProtocol(proto) {
+		return syserr.ErrAddressFamilyNotSupported.ToError()
+	}
+	address := tcpip.Address(addr.Addr)
+	subnet, err := wireguard.NewSubnet(address, int(addr.PrefixLen))
+	if err != nil {
+		return syserror.EINVAL
+	}
+	nicID := tcpip.NICID(idx)
+	if err := s.Stack.AddAddress(nicID, proto, address); err != nil {
+		return syserr.TranslateNetstackError(err).ToError()
+	}
+
+	// Netstack has no connected routes: route the subnet of the address
+	// through the NIC, ahead of the routes through gateways.
+	if addr.PrefixLen == 0 || int(addr.PrefixLen) == len(address)*8 {
+		return nil
+	}
+	routes := []tcpip.Route{{
+		Destination: subnet.ID(),
+		Mask:        subnet.Mask(),
+		NIC:         nicID,
+	}}
+	s.Stack.SetRouteTable(append(routes, s.Stack.GetRouteTable()...))
+	return nil
+}
+
+// NewWireGuardInterface implements inet.Stack.NewWireGuardInterface.
+func (s *Stack) NewWireGuardInterface(name string) (int32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, err := s.newNICID(name)
+	if err != nil {
+		return 0, err
+	}
+	d, err := wireguard.New(wireguard.NewStackBind(s.Stack), wireguard.DefaultMTU)
+	if err != nil {
+		log.Warningf("Failed to create WireGuard device %q: %v", name, err)
+		return 0, syserr.ErrAddressInUse.ToError()
+	}
+	if err := s.Stack.CreateNamedNIC(id, name, stack.RegisterLinkEndpoint(d)); err != nil {
+		d.Close()
+		return 0, syserr.TranslateNetstackError(err).ToError()
+	}
+	if s.wireguard == nil {
+		s.wireguard = make(map[tcpip.NICID]*wireguard.Device)
+	}
+	s.wireguard[id] = d
+	return int32(id), nil
+}
+
+// WireGuardInterfaces implements inet.Stack.WireGuardInterfaces.
+func (s *Stack) WireGuardInterfaces() map[int32]inet.WireGuardDevice {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ds := make(map[int32]inet.WireGuardDevice)
+	for id, d := range s.wireguard {
+		ds[int32(id)] = wireGuardDevice{d}
+	}
+	return ds
+}
+
+// newNICID returns the ID of a new NIC named name, after the existing ones.
+//
+// Preconditions: s.mu must be locked.
+func (s *Stack) newNICID(name string) (tcpip.NICID, error) {
+	id := tcpip.NICID(1)
+	for nicID, ni := range s.Stack.NICInfo() {
+		if ni.Name == name {
+			return 0, syserror.EEXIST
+		}
+		if nicID >= id {
+			id = nicID + 1
+		}
+	}
+	return id, nil
+}
+
+// NewTunnelInterface implements inet.Stack.NewTunnelInterface.
+func (s *Stack) NewTunnelInterface(name string, t inet.Tunnel) (int32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, err := s.newNICID(name)
+	if err != nil {
+		return 0, err
+	}
+
+	var linkEP stack.LinkEndpoint
+	var closeEP func()
+	switch t.Kind {
+	case inet.TunnelKindGRE:
+		g, err := tunnel.NewGRE(s.Stack, tunnel.GREOptions{
+			NICID:        id,
+			Local:        tcpip.Address(t.Local),
+			Remote:       tcpip.Address(t.Remote),
+			InputKey:     t.InputKey,
+			HasInputKey:  t.HasInputKey,
+			OutputKey:    t.OutputKey,
+			HasOutputKey: t.HasOutputKey,
+			TTL:          t.TTL,
+		})
+		if err != nil {
+			return 0, syserr.TranslateNetstackError(err).ToError()
+		}
+		linkEP, closeEP = g, g.Close
+	case inet.TunnelKindVXLAN:
+		v, err := tunnel.NewVXLAN(s.Stack, tunnel.VXLANOptions{
+			NICID:    id,
+			VNI:      t.VNI,
+			Local:    tcpip.Address(t.Local),
+			Remote:   tcpip.Address(t.Remote),
+			Port:     t.Port,
+			TTL:      t.TTL,
+			Learning: t.Learning,
+		})
+		if err != nil {
+			return 0, syserr.TranslateNetstackError(err).ToError()
+		}
+		t.Port = v.Options().Port
+		linkEP, closeEP = v, v.Close
+	default:
+		return 0, syserror.EOPNOTSUPP
+	}
+
+	if err := s.Stack.CreateNamedNIC(id, name, stack.RegisterLinkEndpoint(linkEP)); err != nil {
+		closeEP()
+		return 0, syserr.TranslateNetstackError(err).ToError()
+	}
+	if linkEP.Capabilities()&stack.CapabilityResolutionRequired != 0 && s.Stack.CheckNetworkProtocol(arp.ProtocolNumber) {
+		if err := s.Stack.AddAddress(id, arp.ProtocolNumber, arp.ProtocolAddress); err != nil {
+			return 0, syserr.TranslateNetstackError(err).ToError()
+		}
+	}
+	if s.tunnels == nil {
+		s.tunnels = make(map[tcpip.NICID]inet.Tunnel)
+	}
+	s.tunnels[id] = t
+	return int32(id), nil
+}
+
+// Tunnels implements inet.Stack.Tunnels.
+func (s *Stack) Tunnels() map[int32]inet.Tunnel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ts := make(map[int32]inet.Tunnel)
+	for id, t := range s.tunnels {
+		ts[int32(id)] = t
+	}
+	return ts
+}
+
+// tunnelDeviceType returns the device type of the tunnel t, a Linux ARPHRD_*
+// constant.
+func tunnelDeviceType(t *inet.Tunnel) uint16 {
+	switch {
+	case t.Kind == inet.TunnelKindVXLAN:
+		return linux.ARPHRD_ETHER
+	case len(t.Remote) == 16:
+		return linux.ARPHRD_IP6GRE
+	default:
+		return linux.ARPHRD_IPGRE
+	}
+}
+
+// SupportsConnTrack implements inet.Stack.SupportsConnTrack.
+func (s *Stack) SupportsConnTrack() bool {
+	return s.Stack.ConnTrackEnabled()
+}
+
+// ConnTrack implements inet.Stack.ConnTrack.
+func (s *Stack) ConnTrack() []inet.ConnTrackEntry {
+	entries := s.Stack.ConnTrackEntries()
+	es := make([]inet.ConnTrackEntry, 0, len(entries))
+	for _, e := range entries {
+		es = append(es, inet.ConnTrackEntry{
+			ID:        e.ID,
+			Original:  connTrackTupleToInet(&e.Original),
+			Reply:     connTrackTupleToInet(&e.Reply),
+			TCPState:  uint8(e.State),
+			SeenReply: e.SeenReply,
+			Assured:   e.Assured,
+			Timeout:   e.Timeout,
+		})
+	}
+	return es
+}
+
+// DeleteConnTrack implements inet.Stack.DeleteConnTrack.
+func (s *Stack) DeleteConnTrack(t inet.ConnTrackTuple) error {
+	netProto, ok := familyToNetProto(t.Family)
+	if !ok {
+		return syserr.ErrAddressFamilyNotSupported.ToError()
+	}
+	if !s.Stack.RemoveConnTrackEntry(stack.ConnTrackTuple{
+		NetProto:   netProto,
+		TransProto: tcpip.TransportProtocolNumber(t.Protocol),
+		SrcAddr:    tcpip.Address(t.Src),
+		DstAddr:    tcpip.Address(t.Dst),
+		SrcPort:    t.SrcPort,
+		DstPort:    t.DstPort,
+	}) {
+		return syserror.ENOENT
+	}
+	return nil
+}
+
+// FlushConnTrack implements inet.Stack.FlushConnTrack.
+func (s *Stack) FlushConnTrack(family uint8) error {
+	var netProto tcpip.NetworkProtocolNumber
+	if family != linux.AF_UNSPEC {
+		var ok bool
+		if netProto, ok = familyToNetProto(family); !ok {
+			return syserr.ErrAddressFamilyNotSupported.ToError()
+		}
+	}
+	s.Stack.FlushConnTrack(netProto)
+	return nil
+}
+
+// familyToNetProto returns the network protocol of the address family family,
+// a Linux AF_* constant.
+func familyToNetProto(family uint8) (tcpip.NetworkProtocolNumber, bool) {
+	switch family {
+	case linux.AF_INET:
+		return ipv4.ProtocolNumber, true
+	case linux.AF_INET6:
+		return ipv6.ProtocolNumber, true
+	default:
+		return 0, false
+	}
+}
+
+// connTrackTupleToInet converts the netstack tuple t to its inet counterpart.
+func connTrackTupleToInet(t *stack.ConnTrackTuple) inet.ConnTrackTuple {
+	family := uint8(linux.AF_INET)
+	if t.NetProto == ipv6.ProtocolNumber {
+		family = linux.AF_INET6
+	}
+	return inet.ConnTrackTuple{
+		Family:   family,
+		Protocol: uint8(t.TransProto),
+		Src:      []byte(t.SrcAddr),
+		Dst:      []byte(t.DstAddr),
+		SrcPort:  t.SrcPort,
+		DstPort:  t.DstPort,
+	}
+}
+
+// wireGuardDevice implements inet.WireGuardDevice for wireguard.Device.
+type wireGuardDevice struct {
+	d *wireguard.Device
+}
+
+// IpcGet implements inet.WireGuardDevice.IpcGet.
+func (w wireGuardDevice) IpcGet(wr io.Writer) error {
+	return w.d.IpcGet(wr)
+}
+
+// IpcSet implements inet.WireGuardDevice.IpcSet.
+func (w wireGuardDevice) IpcSet(r io.Reader) error {
+	if err := w.d.IpcSet(r); err != nil {
+		log.Debugf("Invalid WireGuard configuration: %v", err)
+		return syserror.EINVAL
+	}
+	return nil
+}
@@ -14,7 +14,68 @@
 
 package hostinet
 
+import (
+	"fmt"
+	"syscall"
+
+	"gvisor.googlesource.com/gvisor/pkg/fdnotifier"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+)
+
 // beforeSave is invoked by stateify.
-func (*socketOperations) beforeSave() {
-	panic("host.socketOperations is not savable")
+func (s *socketOperations) beforeSave() {
+	// The connection of a stream socket can't be moved to the socket
+	// created at restore.
+	if s.stype == syscall.SOCK_STREAM && !s.listening {
+		if _, _, err := s.GetPeerName(nil); err == nil {
+			panic(fs.ErrSaveRejection{fmt.Errorf("connected host TCP socket can't be saved")})
+		}
+	}
+
+	s.savedAddr = nil
+	if addr, _, err := s.GetSockName(nil); err == nil && bound(addr.([]byte)) {
+		s.savedAddr = addr.([]byte)
+	}
+	s.savedPeer = nil
+	if s.stype == syscall.SOCK_DGRAM {
+		if addr, _, err := s.GetPeerName(nil); err == nil {
+			s.savedPeer = addr.([]byte)
+		}
+	}
+}
+
+// afterLoad is invoked by stateify.
+func (s *socketOperations) afterLoad() {
+	fd, err := syscall.Socket(s.family, s.stype|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		panic(fmt.Sprintf("failed to create host socket: %v", err))
+	}
+	s.fd = fd
+	if err := fdnotifier.AddFD(int32(fd), &s.queue); err != nil {
+		panic(fmt.Sprintf("failed to add host socket FD %d to notifier: %v", fd, err))
+	}
+
+	if s.savedAddr != nil {
+		if err := s.Bind(nil, s.savedAddr); err != nil {
+			panic(fmt.Sprintf("failed to bind host socket to %v: %v", s.savedAddr, err))
+		}
+	}
+	if s.savedPeer != nil {
+		if err := s.Connect(nil, s.savedPeer, false /* blocking */); err != nil {
+			panic(fmt.Sprintf("failed to connect host socket to %v: %v", s.savedPeer, err))
+		}
+	}
+	if s.listening {
+		if err := syscall.Listen(fd, s.backlog); err != nil {
+			panic(fmt.Sprintf("failed to listen on host socket: %v", err))
+		}
+	}
+	s.savedAddr = nil
+	s.savedPeer = nil
+}
+
+// bound returns true if addr, a sockaddr_in or sockaddr_in6, has a port.
+func bound(addr []byte) bool {
+	// The port follows the family in both.
+	return len(addr) >= 4 && (addr[2] != 0 || addr[3] != 0)
 }
@@ -19,6 +19,7 @@ import (
 	"syscall"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/binary"
 	"gvisor.googlesource.com/gvisor/pkg/fdnotifier"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
@@ -45,6 +46,12 @@ const (
 
 // socketOperations implements fs.FileOperations and socket.Socket for a socket
 // implemented using a host socket.
+//
+// The host socket itself can't be saved. At restore, a new host socket is
+// bound, connected or listening as the saved one was, but other state, such as
+// socket options and queued data, is lost.
+//
+// +stateify savable
 type socketOperations struct {
 	fsutil.FilePipeSeek      `state:"nosave"`
 	fsutil.FileNotDirReaddir `state:"nosave"`
@@ -53,15 +60,25 @@ type socketOperations struct {
 	fsutil.FileNoMMap        `state:"nosave"`
 	socket.SendReceiveTimeout
 
-	family int // Read-only.
-	fd     int // must be O_NONBLOCK
-	queue  waiter.Queue
+	family int          // Read-only.
+	stype  int          // Read-only.
+	fd     int          `state:"nosave"` // must be O_NONBLOCK
+	queue  waiter.Queue `state:"zerovalue"`
+
+	// listening is true if Listen succeeded, with the backlog.
+	listening bool
+	backlog   int
+
+	// savedAddr and savedPeer are the local and, for datagram sockets,
+	// remote addresses of the host socket at save, if any.
+	savedAddr []byte
+	savedPeer []byte
 }
 
 var _ = socket.Socket(&socketOperations{})
 
-func newSocketFile(ctx context.Context, family int, fd int, nonblock bool) (*fs.File, *syserr.Error) {
-	s := &socketOperations{family: family, fd: fd}
+func newSocketFile(ctx context.Context, family int, stype int, fd int, nonblock bool) (*fs.File, *syserr.Error) {
+	s := &socketOperations{family: family, stype: stype, fd: fd}
 	if err := fdnotifier.AddFD(int32(fd), &s.queue); err != nil {
 		return nil, syserr.FromError(err)
 	}
@@ -219,7 +236,7 @@ func (s *socketOperations) Accept(t *kernel.Task, peerRequested bool, flags int,
 		return 0, peerAddr, peerAddrlen, syserr.FromError(syscallErr)
 	}
 
-	f, err := newSocketFile(t, s.family, fd, flags&syscall.SOCK_NONBLOCK != 0)
+	f, err := newSocketFile(t, s.family, s.stype, fd, flags&syscall.SOCK_NONBLOCK != 0)
 	if err != nil {
 		syscall.Close(fd)
 		return 0, nil, 0, err
@@ -249,7 +266,12 @@ func (s *socketOperations) Bind(t *kernel.Task, sockaddr []byte) *syserr.Error {
 
 // Listen implements socket.Socket.Listen.
 func (s *socketOperations) Listen(t *kernel.Task, backlog int) *syserr.Error {
-	return syserr.FromError(syscall.Listen(s.fd, backlog))
+	if err := syscall.Listen(s.fd, backlog); err != nil {
+		return syserr.FromError(err)
+	}
+	s.listening = true
+	s.backlog = backlog
+	return nil
 }
 
 // Shutdown implements socket.Socket.Shutdown.
@@ -269,32 +291,16 @@ func (s *socketOperations) GetSockOpt(t *kernel.Task, level int, name int, outLe
 	}
 
 	// Whitelist options and constrain option length.
-	var optlen int
-	switch level {
-	case syscall.SOL_IPV6:
-		switch name {
-		case syscall.IPV6_V6ONLY:
-			optlen = sizeofInt32
-		}
-	case syscall.SOL_SOCKET:
-		switch name {
-		case syscall.SO_ERROR, syscall.SO_KEEPALIVE, syscall.SO_SNDBUF, syscall.SO_RCVBUF, syscall.SO_REUSEADDR, syscall.SO_TYPE:
-			optlen = sizeofInt32
-		case syscall.SO_LINGER:
-			optlen = syscall.SizeofLinger
-		}
-	case syscall.SOL_TCP:
-		switch name {
-		case syscall.TCP_NODELAY:
-			optlen = sizeofInt32
-		case syscall.TCP_INFO:
-			optlen = int(linux.SizeOfTCPInfo)
-		}
-	}
-	if optlen == 0 {
+	o, ok := findSockOpt(level, name)
+	if !ok || !o.AllowGet {
 		return nil, syserr.ErrProtocolNotAvailable // ENOPROTOOPT
 	}
-	if outLen < optlen {
+	optlen := o.Size
+	if o.Variable {
+		if outLen < optlen {
+			optlen = outLen
+		}
+	} else if outLen < optlen {
 		return nil, syserr.ErrInvalidArgument
 	}
 
@@ -308,33 +314,17 @@ func (s *socketOperations) GetSockOpt(t *kernel.Task, level int, name int, outLe
 // SetSockOpt implements socket.Socket.SetSockOpt.
 func (s *socketOperations) SetSockOpt(t *kernel.Task, level int, name int, opt []byte) *syserr.Error {
 	// Whitelist options and constrain option length.
-	var optlen int
-	switch level {
-	case syscall.SOL_IPV6:
-		switch name {
-		case syscall.IPV6_V6ONLY:
-			optlen = sizeofInt32
-		}
-	case syscall.SOL_SOCKET:
-		switch name {
-		case syscall.SO_SNDBUF, syscall.SO_RCVBUF, syscall.SO_REUSEADDR:
-			optlen = sizeofInt32
-		}
-	case syscall.SOL_TCP:
-		switch name {
-		case syscall.TCP_NODELAY:
-			optlen = sizeofInt32
-		}
-	}
-	if optlen == 0 {
+	o, ok := findSockOpt(level, name)
+	if !ok || !o.AllowSet {
 		// Pretend to accept socket options we don't understand. This seems
 		// dangerous, but it's what netstack does...
 		return nil
 	}
-	if len(opt) < optlen {
+	if len(opt) > o.Size {
+		opt = opt[:o.Size]
+	} else if len(opt) < o.Size && !o.Variable {
 		return syserr.ErrInvalidArgument
 	}
-	opt = opt[:optlen]
 
 	_, _, errno := syscall.Syscall6(syscall.SYS_SETSOCKOPT, uintptr(s.fd), uintptr(level), uintptr(name), uintptr(firstBytePtr(opt)), uintptr(len(opt)), 0)
 	if errno != 0 {
@@ -359,6 +349,13 @@ func (s *socketOperations) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags
 		senderAddr = make([]byte, sizeofSockaddr)
 	}
 
+	// The only control message which may be returned is SO_TIMESTAMP, since
+	// no other option enabling control messages is passed through.
+	var controlBuf []byte
+	if controlDataLen > 0 {
+		controlBuf = make([]byte, syscall.CmsgSpace(linux.SizeOfTimeval))
+	}
+
 	recvmsgToBlocks := safemem.ReaderFunc(func(dsts safemem.BlockSeq) (uint64, error) {
 		// Refuse to do anything if any part of dst.Addrs was unusable.
 		if uint64(dst.NumBytes()) != dsts.NumBytes() {
@@ -371,7 +368,7 @@ func (s *socketOperations) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags
 		// We always do a non-blocking recv*().
 		sysflags := flags | syscall.MSG_DONTWAIT
 
-		if dsts.NumBlocks() == 1 {
+		if dsts.NumBlocks() == 1 && len(controlBuf) == 0 {
 			// Skip allocating []syscall.Iovec.
 			return recvfrom(s.fd, dsts.Head().ToSlice(), sysflags, &senderAddr)
 		}
@@ -385,11 +382,16 @@ func (s *socketOperations) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags
 			msg.Name = &senderAddr[0]
 			msg.Namelen = uint32(len(senderAddr))
 		}
+		if len(controlBuf) != 0 {
+			msg.Control = &controlBuf[0]
+			msg.Controllen = uint64(len(controlBuf))
+		}
 		n, err := recvmsg(s.fd, &msg, sysflags)
 		if err != nil {
 			return 0, err
 		}
 		senderAddr = senderAddr[:msg.Namelen]
+		controlBuf = controlBuf[:msg.Controllen]
 		return n, nil
 	})
 
@@ -416,7 +418,29 @@ func (s *socketOperations) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags
 		}
 	}
 
-	return int(n), senderAddr, uint32(len(senderAddr)), socket.ControlMessages{}, syserr.FromError(err)
+	return int(n), senderAddr, uint32(len(senderAddr)), parseControlMessages(controlBuf), syserr.FromError(err)
+}
+
+// parseControlMessages parses the control messages returned by the host.
+func parseControlMessages(buf []byte) socket.ControlMessages {
+	var cms socket.ControlMessages
+	if len(buf) == 0 {
+		return cms
+	}
+	msgs, err := syscall.ParseSocketControlMessage(buf)
+	if err != nil {
+		return cms
+	}
+	for _, m := range msgs {
+		if m.Header.Level != linux.SOL_SOCKET || m.Header.Type != linux.SO_TIMESTAMP || len(m.Data) < linux.SizeOfTimeval {
+			continue
+		}
+		var tv linux.Timeval
+		binary.Unmarshal(m.Data[:linux.SizeOfTimeval], usermem.ByteOrder, &tv)
+		cms.IP.HasTimestamp = true
+		cms.IP.Timestamp = tv.ToNsecCapped()
+	}
+	return cms
 }
 
 // SendMsg implements socket.Socket.SendMsg.
@@ -554,7 +578,7 @@ func (p *socketProvider) Socket(t *kernel.Task, stypeflags transport.SockType, p
 	if err != nil {
 		return nil, syserr.FromError(err)
 	}
-	return newSocketFile(t, p.family, fd, stypeflags&syscall.SOCK_NONBLOCK != 0)
+	return newSocketFile(t, p.family, stype, fd, stypeflags&syscall.SOCK_NONBLOCK != 0)
 }
 
 // Pair implements socket.Provider.Pair.
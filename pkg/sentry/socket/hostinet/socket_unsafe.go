@@ -15,9 +15,11 @@
 package hostinet
 
 import (
+	"runtime"
 	"syscall"
 	"unsafe"
 
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
@@ -26,6 +28,10 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
 )
 
+// maxIFConfLen is the maximum size of the buffer passed to the host for
+// SIOCGIFCONF, which is enough for a thousand interface addresses.
+const maxIFConfLen = 1000 * 40 // sizeof(struct ifreq)
+
 func firstBytePtr(bs []byte) unsafe.Pointer {
 	if bs == nil {
 		return nil
@@ -66,6 +72,95 @@ func (s *socketOperations) Ioctl(ctx context.Context, io usermem.IO, args arch.S
 		})
 		return 0, err
 
+	case syscall.SIOCATMARK:
+		var val int32
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(s.fd), cmd, uintptr(unsafe.Pointer(&val))); errno != 0 {
+			return 0, translateIOSyscallError(errno)
+		}
+		_, err := usermem.CopyObjectOut(ctx, io, args[2].Pointer(), val, usermem.IOOpts{
+			AddressSpaceActive: true,
+		})
+		return 0, err
+
+	case syscall.SIOCGSTAMP:
+		var tv linux.Timeval
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(s.fd), cmd, uintptr(unsafe.Pointer(&tv))); errno != 0 {
+			return 0, translateIOSyscallError(errno)
+		}
+		_, err := usermem.CopyObjectOut(ctx, io, args[2].Pointer(), &tv, usermem.IOOpts{
+			AddressSpaceActive: true,
+		})
+		return 0, err
+
+	case syscall.SIOCGIFFLAGS,
+		syscall.SIOCGIFADDR,
+		syscall.SIOCGIFBRDADDR,
+		syscall.SIOCGIFDSTADDR,
+		syscall.SIOCGIFHWADDR,
+		syscall.SIOCGIFINDEX,
+		syscall.SIOCGIFMAP,
+		syscall.SIOCGIFMETRIC,
+		syscall.SIOCGIFMTU,
+		syscall.SIOCGIFNAME,
+		syscall.SIOCGIFNETMASK,
+		syscall.SIOCGIFTXQLEN:
+
+		var ifr linux.IFReq
+		if _, err := usermem.CopyObjectIn(ctx, io, args[2].Pointer(), &ifr, usermem.IOOpts{
+			AddressSpaceActive: true,
+		}); err != nil {
+			return 0, err
+		}
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(s.fd), cmd, uintptr(unsafe.Pointer(&ifr))); errno != 0 {
+			return 0, translateIOSyscallError(errno)
+		}
+		_, err := usermem.CopyObjectOut(ctx, io, args[2].Pointer(), &ifr, usermem.IOOpts{
+			AddressSpaceActive: true,
+		})
+		return 0, err
+
+	case syscall.SIOCGIFCONF:
+		var ifc linux.IFConf
+		if _, err := usermem.CopyObjectIn(ctx, io, args[2].Pointer(), &ifc, usermem.IOOpts{
+			AddressSpaceActive: true,
+		}); err != nil {
+			return 0, err
+		}
+		if ifc.Len < 0 {
+			return 0, syserror.EINVAL
+		}
+
+		// The host fills a buffer of the sentry, which is then copied to the
+		// buffer of the application. If the application passes no buffer, the
+		// host returns the size it needs.
+		hostIFC := linux.IFConf{Len: ifc.Len}
+		var buf []byte
+		if ifc.Ptr != 0 && ifc.Len > 0 {
+			if ifc.Len > maxIFConfLen {
+				hostIFC.Len = maxIFConfLen
+			}
+			buf = make([]byte, hostIFC.Len)
+			hostIFC.Ptr = uint64(uintptr(unsafe.Pointer(&buf[0])))
+		}
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(s.fd), cmd, uintptr(unsafe.Pointer(&hostIFC)))
+		// Keep buf alive until the host has written to it.
+		runtime.KeepAlive(buf)
+		if errno != 0 {
+			return 0, translateIOSyscallError(errno)
+		}
+		if buf != nil {
+			if _, err := io.CopyOut(ctx, usermem.Addr(ifc.Ptr), buf[:hostIFC.Len], usermem.IOOpts{
+				AddressSpaceActive: true,
+			}); err != nil {
+				return 0, err
+			}
+		}
+		ifc.Len = hostIFC.Len
+		_, err := usermem.CopyObjectOut(ctx, io, args[2].Pointer(), &ifc, usermem.IOOpts{
+			AddressSpaceActive: true,
+		})
+		return 0, err
+
 	default:
 		return 0, syserror.ENOTTY
 	}
@@ -0,0 +1,124 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hostinet
+
+import (
+	"syscall"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+)
+
+const (
+	sizeofIPMreqn   = 12 // sizeof(struct ip_mreqn)
+	sizeofIPv6Mreq  = 20 // sizeof(struct ipv6_mreq)
+	sizeofTCPCAName = 16 // TCP_CA_NAME_MAX
+)
+
+// SockOpt is a socket option which is passed through to host sockets.
+type SockOpt struct {
+	// Level is the level of the option.
+	Level int
+
+	// Name is the name of the option.
+	Name int
+
+	// Size is the size of the option value. If Variable is true, it is the
+	// maximum size, and smaller values are passed through as is.
+	Size     int
+	Variable bool
+
+	// AllowGet and AllowSet indicate whether getsockopt(2) and setsockopt(2)
+	// are allowed for the option.
+	AllowGet bool
+	AllowSet bool
+}
+
+// SockOpts are the socket options supported by host sockets. The seccomp
+// filters of the sandbox are built from them.
+var SockOpts = []SockOpt{
+	{Level: linux.SOL_SOCKET, Name: linux.SO_ACCEPTCONN, Size: sizeofInt32, AllowGet: true},
+	{Level: linux.SOL_SOCKET, Name: linux.SO_BROADCAST, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_SOCKET, Name: linux.SO_DOMAIN, Size: sizeofInt32, AllowGet: true},
+	{Level: linux.SOL_SOCKET, Name: linux.SO_ERROR, Size: sizeofInt32, AllowGet: true},
+	{Level: linux.SOL_SOCKET, Name: linux.SO_KEEPALIVE, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_SOCKET, Name: linux.SO_LINGER, Size: syscall.SizeofLinger, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_SOCKET, Name: linux.SO_OOBINLINE, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_SOCKET, Name: linux.SO_PRIORITY, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_SOCKET, Name: linux.SO_PROTOCOL, Size: sizeofInt32, AllowGet: true},
+	{Level: linux.SOL_SOCKET, Name: linux.SO_RCVBUF, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_SOCKET, Name: linux.SO_RCVLOWAT, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_SOCKET, Name: linux.SO_REUSEADDR, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_SOCKET, Name: linux.SO_REUSEPORT, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_SOCKET, Name: linux.SO_SNDBUF, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_SOCKET, Name: linux.SO_TIMESTAMP, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_SOCKET, Name: linux.SO_TYPE, Size: sizeofInt32, AllowGet: true},
+
+	{Level: linux.SOL_IP, Name: linux.IP_ADD_MEMBERSHIP, Size: sizeofIPMreqn, Variable: true, AllowSet: true},
+	{Level: linux.SOL_IP, Name: linux.IP_DROP_MEMBERSHIP, Size: sizeofIPMreqn, Variable: true, AllowSet: true},
+	{Level: linux.SOL_IP, Name: linux.IP_MTU, Size: sizeofInt32, AllowGet: true},
+	{Level: linux.SOL_IP, Name: linux.IP_MTU_DISCOVER, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_IP, Name: linux.IP_MULTICAST_IF, Size: sizeofIPMreqn, Variable: true, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_IP, Name: linux.IP_MULTICAST_LOOP, Size: sizeofInt32, Variable: true, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_IP, Name: linux.IP_MULTICAST_TTL, Size: sizeofInt32, Variable: true, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_IP, Name: linux.IP_TOS, Size: sizeofInt32, Variable: true, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_IP, Name: linux.IP_TTL, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+
+	{Level: linux.SOL_IPV6, Name: linux.IPV6_ADD_MEMBERSHIP, Size: sizeofIPv6Mreq, AllowSet: true},
+	{Level: linux.SOL_IPV6, Name: linux.IPV6_DROP_MEMBERSHIP, Size: sizeofIPv6Mreq, AllowSet: true},
+	{Level: linux.SOL_IPV6, Name: linux.IPV6_MTU, Size: sizeofInt32, AllowGet: true},
+	{Level: linux.SOL_IPV6, Name: linux.IPV6_MTU_DISCOVER, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_IPV6, Name: linux.IPV6_MULTICAST_HOPS, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_IPV6, Name: linux.IPV6_MULTICAST_IF, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_IPV6, Name: linux.IPV6_MULTICAST_LOOP, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_IPV6, Name: linux.IPV6_TCLASS, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_IPV6, Name: linux.IPV6_UNICAST_HOPS, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_IPV6, Name: linux.IPV6_V6ONLY, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+
+	{Level: linux.SOL_TCP, Name: linux.TCP_CONGESTION, Size: sizeofTCPCAName, Variable: true, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_TCP, Name: linux.TCP_CORK, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_TCP, Name: linux.TCP_DEFER_ACCEPT, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_TCP, Name: linux.TCP_INFO, Size: int(linux.SizeOfTCPInfo), Variable: true, AllowGet: true},
+	{Level: linux.SOL_TCP, Name: linux.TCP_KEEPCNT, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_TCP, Name: linux.TCP_KEEPIDLE, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_TCP, Name: linux.TCP_KEEPINTVL, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_TCP, Name: linux.TCP_LINGER2, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_TCP, Name: linux.TCP_MAXSEG, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_TCP, Name: linux.TCP_NODELAY, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_TCP, Name: linux.TCP_NOTSENT_LOWAT, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_TCP, Name: linux.TCP_QUICKACK, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_TCP, Name: linux.TCP_SYNCNT, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_TCP, Name: linux.TCP_USER_TIMEOUT, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+	{Level: linux.SOL_TCP, Name: linux.TCP_WINDOW_CLAMP, Size: sizeofInt32, AllowGet: true, AllowSet: true},
+}
+
+type sockOptKey struct {
+	level int
+	name  int
+}
+
+// sockOpts indexes SockOpts by level and name.
+var sockOpts = func() map[sockOptKey]SockOpt {
+	m := make(map[sockOptKey]SockOpt, len(SockOpts))
+	for _, opt := range SockOpts {
+		m[sockOptKey{opt.Level, opt.Name}] = opt
+	}
+	return m
+}()
+
+// findSockOpt returns the SockOpt of level and name, if it is supported.
+func findSockOpt(level, name int) (SockOpt, bool) {
+	opt, ok := sockOpts[sockOptKey{level, name}]
+	return opt, ok
+}
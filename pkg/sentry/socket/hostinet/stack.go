@@ -210,6 +210,11 @@ func (s *Stack) InterfaceAddrs() map[int32][]inet.InterfaceAddr {
 	return s.interfaceAddrs
 }
 
+// InterfaceStatistics implements inet.Stack.InterfaceStatistics.
+func (s *Stack) InterfaceStatistics() map[int32]inet.InterfaceStatistics {
+	return nil
+}
+
 // SupportsIPv6 implements inet.Stack.SupportsIPv6.
 func (s *Stack) SupportsIPv6() bool {
 	return s.supportsIPv6
@@ -244,3 +249,63 @@ func (s *Stack) TCPSACKEnabled() (bool, error) {
 func (s *Stack) SetTCPSACKEnabled(enabled bool) error {
 	return syserror.EACCES
 }
+
+// QueueingDisciplines implements inet.Stack.QueueingDisciplines.
+func (s *Stack) QueueingDisciplines() map[int32]inet.QueueingDiscipline {
+	return nil
+}
+
+// SetQueueingDiscipline implements inet.Stack.SetQueueingDiscipline.
+func (s *Stack) SetQueueingDiscipline(idx int32, q inet.QueueingDiscipline) error {
+	return syserror.EACCES
+}
+
+// RemoveQueueingDiscipline implements inet.Stack.RemoveQueueingDiscipline.
+func (s *Stack) RemoveQueueingDiscipline(idx int32) error {
+	return syserror.EACCES
+}
+
+// AddInterfaceAddr implements inet.Stack.AddInterfaceAddr.
+func (s *Stack) AddInterfaceAddr(idx int32, addr inet.InterfaceAddr) error {
+	return syserror.EACCES
+}
+
+// NewWireGuardInterface implements inet.Stack.NewWireGuardInterface.
+func (s *Stack) NewWireGuardInterface(name string) (int32, error) {
+	return 0, syserror.EACCES
+}
+
+// WireGuardInterfaces implements inet.Stack.WireGuardInterfaces.
+func (s *Stack) WireGuardInterfaces() map[int32]inet.WireGuardDevice {
+	return nil
+}
+
+// NewTunnelInterface implements inet.Stack.NewTunnelInterface.
+func (s *Stack) NewTunnelInterface(name string, t inet.Tunnel) (int32, error) {
+	return 0, syserror.EACCES
+}
+
+// Tunnels implements inet.Stack.Tunnels.
+func (s *Stack) Tunnels() map[int32]inet.Tunnel {
+	return nil
+}
+
+// SupportsConnTrack implements inet.Stack.SupportsConnTrack.
+func (s *Stack) SupportsConnTrack() bool {
+	return false
+}
+
+// ConnTrack implements inet.Stack.ConnTrack.
+func (s *Stack) ConnTrack() []inet.ConnTrackEntry {
+	return nil
+}
+
+// DeleteConnTrack implements inet.Stack.DeleteConnTrack.
+func (s *Stack) DeleteConnTrack(t inet.ConnTrackTuple) error {
+	return syserror.EACCES
+}
+
+// FlushConnTrack implements inet.Stack.FlushConnTrack.
+func (s *Stack) FlushConnTrack(family uint8) error {
+	return syserror.EACCES
+}
@@ -0,0 +1,182 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package genetlink provides a NETLINK_GENERIC socket protocol.
+//
+// The generic netlink controller and the WireGuard family are supported.
+package genetlink
+
+import (
+	"bytes"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/binary"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserr"
+)
+
+const (
+	// ctrlVersion is the version of the generic netlink controller.
+	ctrlVersion = 2
+
+	// wireGuardFamilyID is the ID of the WireGuard family. Linux allocates
+	// family IDs dynamically from the one after the controller's.
+	wireGuardFamilyID = linux.GENL_ID_CTRL + 1
+)
+
+// familyOp describes a command of a family.
+type familyOp struct {
+	id    uint32
+	flags uint32
+}
+
+// family describes a generic netlink family, as reported by the controller.
+type family struct {
+	id      uint16
+	name    string
+	version uint32
+	maxAttr uint32
+	ops     []familyOp
+}
+
+// families are the supported generic netlink families.
+var families = []family{
+	{
+		id:      linux.GENL_ID_CTRL,
+		name:    "nlctrl",
+		version: ctrlVersion,
+		maxAttr: linux.CTRL_ATTR_MCAST_GROUPS,
+		ops: []familyOp{
+			{linux.CTRL_CMD_GETFAMILY, linux.GENL_CMD_CAP_DO | linux.GENL_CMD_CAP_DUMP},
+		},
+	},
+	{
+		id:      wireGuardFamilyID,
+		name:    linux.WG_GENL_NAME,
+		version: linux.WG_GENL_VERSION,
+		maxAttr: linux.WGDEVICE_A_PEERS,
+		ops: []familyOp{
+			{linux.WG_CMD_GET_DEVICE, linux.GENL_ADMIN_PERM | linux.GENL_CMD_CAP_DUMP},
+			{linux.WG_CMD_SET_DEVICE, linux.GENL_ADMIN_PERM | linux.GENL_CMD_CAP_DO},
+		},
+	},
+}
+
+// Protocol implements netlink.Protocol.
+//
+// +stateify savable
+type Protocol struct{}
+
+var _ netlink.Protocol = (*Protocol)(nil)
+
+// NewProtocol creates a NETLINK_GENERIC netlink.Protocol.
+func NewProtocol(t *kernel.Task) (netlink.Protocol, *syserr.Error) {
+	return &Protocol{}, nil
+}
+
+// Protocol implements netlink.Protocol.Protocol.
+func (p *Protocol) Protocol() int {
+	return linux.NETLINK_GENERIC
+}
+
+// ProcessMessage implements netlink.Protocol.ProcessMessage.
+func (p *Protocol) ProcessMessage(ctx context.Context, hdr linux.NetlinkMessageHeader, data []byte, ms *netlink.MessageSet) *syserr.Error {
+	// All messages start with a genlmsghdr.
+	if len(data) < linux.GenericNetlinkMessageSize {
+		return syserr.ErrInvalidArgument
+	}
+	var msg linux.GenericNetlinkMessage
+	binary.Unmarshal(data[:linux.GenericNetlinkMessageSize], usermem.ByteOrder, &msg)
+	attrs := netlink.AttrsView(data[linux.GenericNetlinkMessageSize:])
+
+	switch hdr.Type {
+	case linux.GENL_ID_CTRL:
+		return p.processControl(ctx, hdr, msg, attrs, ms)
+	case wireGuardFamilyID:
+		return p.processWireGuard(ctx, hdr, msg, attrs, ms)
+	default:
+		return syserr.ErrNoFileOrDir
+	}
+}
+
+// processControl handles the messages of the generic netlink controller.
+func (p *Protocol) processControl(ctx context.Context, hdr linux.NetlinkMessageHeader, msg linux.GenericNetlinkMessage, attrs netlink.AttrsView, ms *netlink.MessageSet) *syserr.Error {
+	if msg.Command != linux.CTRL_CMD_GETFAMILY {
+		return syserr.ErrNotSupported
+	}
+
+	if hdr.Flags&linux.NLM_F_DUMP == linux.NLM_F_DUMP {
+		// We always send back an NLMSG_DONE.
+		ms.Multi = true
+		for i := range families {
+			putFamily(ms, &families[i])
+		}
+		return nil
+	}
+
+	as, ok := attrs.Parse()
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	for i := range families {
+		f := &families[i]
+		if v, ok := as[linux.CTRL_ATTR_FAMILY_ID]; ok {
+			if len(v) < 2 || usermem.ByteOrder.Uint16(v) != f.id {
+				continue
+			}
+		} else if v, ok := as[linux.CTRL_ATTR_FAMILY_NAME]; ok {
+			if name := bytes.TrimRight(v, "\x00"); string(name) != f.name {
+				continue
+			}
+		} else {
+			return syserr.ErrInvalidArgument
+		}
+		putFamily(ms, f)
+		return nil
+	}
+	return syserr.ErrNoFileOrDir
+}
+
+// putFamily adds a CTRL_CMD_NEWFAMILY message describing f to ms.
+func putFamily(ms *netlink.MessageSet, f *family) {
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: linux.GENL_ID_CTRL,
+	})
+	m.Put(linux.GenericNetlinkMessage{
+		Command: linux.CTRL_CMD_NEWFAMILY,
+		Version: ctrlVersion,
+	})
+	m.PutAttrString(linux.CTRL_ATTR_FAMILY_NAME, f.name)
+	m.PutAttr(linux.CTRL_ATTR_FAMILY_ID, f.id)
+	m.PutAttr(linux.CTRL_ATTR_VERSION, f.version)
+	m.PutAttr(linux.CTRL_ATTR_HDRSIZE, uint32(0))
+	m.PutAttr(linux.CTRL_ATTR_MAXATTR, f.maxAttr)
+
+	var ops netlink.Attrs
+	for i, op := range f.ops {
+		var a netlink.Attrs
+		a.Put(linux.CTRL_ATTR_OP_ID, op.id)
+		a.Put(linux.CTRL_ATTR_OP_FLAGS, op.flags)
+		ops.Put(uint16(i+1)|linux.NLA_F_NESTED, a.Bytes())
+	}
+	m.PutAttr(linux.CTRL_ATTR_OPS|linux.NLA_F_NESTED, ops.Bytes())
+}
+
+// init registers the NETLINK_GENERIC provider.
+func init() {
+	netlink.RegisterProvider(linux.NETLINK_GENERIC, NewProtocol)
+}
@@ -0,0 +1,494 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package genetlink
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/binary"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/inet"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserr"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/wireguard"
+)
+
+// The WireGuard family translates its messages to and from the
+// cross-platform userspace API of wg(8), which devices implement.
+
+// maxPeersSize is the maximum size of the peers of a WG_CMD_GET_DEVICE
+// message, the maximum size of the value of an attribute. Larger sets of
+// peers are split across messages, as Linux does.
+const maxPeersSize = math.MaxUint16 - linux.NetlinkAttrHeaderSize
+
+// processWireGuard handles the messages of the WireGuard family.
+func (p *Protocol) processWireGuard(ctx context.Context, hdr linux.NetlinkMessageHeader, msg linux.GenericNetlinkMessage, attrs netlink.AttrsView, ms *netlink.MessageSet) *syserr.Error {
+	// All commands require CAP_NET_ADMIN.
+	creds := auth.CredentialsFromContext(ctx)
+	if !creds.HasCapability(linux.CAP_NET_ADMIN) {
+		return syserr.ErrNotPermitted
+	}
+
+	as, ok := attrs.Parse()
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	stack := inet.StackFromContext(ctx)
+	if stack == nil {
+		return syserr.ErrNoDevice
+	}
+	idx, name, dev, err := lookupWireGuardDevice(stack, as)
+	if err != nil {
+		return err
+	}
+
+	switch msg.Command {
+	case linux.WG_CMD_GET_DEVICE:
+		// Devices can only be dumped.
+		if hdr.Flags&linux.NLM_F_DUMP != linux.NLM_F_DUMP {
+			return syserr.ErrNotSupported
+		}
+		return getWireGuardDevice(idx, name, dev, ms)
+	case linux.WG_CMD_SET_DEVICE:
+		return setWireGuardDevice(dev, as)
+	default:
+		return syserr.ErrNotSupported
+	}
+}
+
+// lookupWireGuardDevice returns the WireGuard interface designated by
+// WGDEVICE_A_IFINDEX or WGDEVICE_A_IFNAME in attrs.
+func lookupWireGuardDevice(stack inet.Stack, attrs map[uint16][]byte) (int32, string, inet.WireGuardDevice, *syserr.Error) {
+	var idx int32
+	var name string
+	ifaces := stack.Interfaces()
+	if v, ok := attrs[linux.WGDEVICE_A_IFINDEX]; ok {
+		if len(v) < 4 {
+			return 0, "", nil, syserr.ErrInvalidArgument
+		}
+		idx = int32(usermem.ByteOrder.Uint32(v))
+		iface, ok := ifaces[idx]
+		if !ok {
+			return 0, "", nil, syserr.ErrNoDevice
+		}
+		name = iface.Name
+	} else if v, ok := attrs[linux.WGDEVICE_A_IFNAME]; ok {
+		name = string(bytes.TrimRight(v, "\x00"))
+		for i, iface := range ifaces {
+			if iface.Name == name {
+				idx = i
+				break
+			}
+		}
+		if idx == 0 {
+			return 0, "", nil, syserr.ErrNoDevice
+		}
+	} else {
+		return 0, "", nil, syserr.ErrInvalidArgument
+	}
+
+	dev, ok := stack.WireGuardInterfaces()[idx]
+	if !ok {
+		return 0, "", nil, syserr.ErrNotSupported
+	}
+	return idx, name, dev, nil
+}
+
+// wireGuardPeer contains the attributes of a peer in a WG_CMD_GET_DEVICE
+// response.
+type wireGuardPeer struct {
+	publicKey []byte
+
+	// attrs are the attributes of the peer but its allowed IPs.
+	attrs netlink.Attrs
+
+	// allowedIPs are the serialized attributes of each allowed IP.
+	allowedIPs [][]byte
+}
+
+// getWireGuardDevice handles WG_CMD_GET_DEVICE requests for dev, the device
+// of interface idx named name.
+func getWireGuardDevice(idx int32, name string, dev inet.WireGuardDevice, ms *netlink.MessageSet) *syserr.Error {
+	var b bytes.Buffer
+	if err := dev.IpcGet(&b); err != nil {
+		return syserr.ErrIO
+	}
+
+	var device netlink.Attrs
+	var peers []*wireGuardPeer
+	var peer *wireGuardPeer
+	var lastHandshake linux.Timespec
+	scanner := bufio.NewScanner(&b)
+	for scanner.Scan() {
+		line := scanner.Text()
+		i := strings.IndexByte(line, '=')
+		if i < 0 {
+			continue
+		}
+		key, value := line[:i], line[i+1:]
+		var err error
+		switch key {
+		case "private_key":
+			var k wireguard.Key
+			if k, err = wireguard.ParseHexKey(value); err == nil {
+				pub := k.PublicKey()
+				device.Put(linux.WGDEVICE_A_PRIVATE_KEY, k[:])
+				device.Put(linux.WGDEVICE_A_PUBLIC_KEY, pub[:])
+			}
+		case "listen_port":
+			var port uint64
+			if port, err = strconv.ParseUint(value, 10, 16); err == nil {
+				device.Put(linux.WGDEVICE_A_LISTEN_PORT, uint16(port))
+			}
+		case "public_key":
+			var k wireguard.Key
+			if k, err = wireguard.ParseHexKey(value); err == nil {
+				peer = &wireGuardPeer{publicKey: k[:]}
+				peer.attrs.Put(linux.WGPEER_A_PUBLIC_KEY, peer.publicKey)
+				peers = append(peers, peer)
+			}
+		default:
+			if peer == nil {
+				continue
+			}
+			err = parseWireGuardPeerKey(peer, &lastHandshake, key, value)
+		}
+		if err != nil {
+			return syserr.ErrIO
+		}
+	}
+	device.Put(linux.WGDEVICE_A_FWMARK, uint32(0))
+
+	// We always send back an NLMSG_DONE.
+	ms.Multi = true
+
+	newMessage := func() *netlink.Message {
+		m := ms.AddMessage(linux.NetlinkMessageHeader{
+			Type: wireGuardFamilyID,
+		})
+		m.Put(linux.GenericNetlinkMessage{
+			Command: linux.WG_CMD_GET_DEVICE,
+			Version: linux.WG_GENL_VERSION,
+		})
+		m.PutAttr(linux.WGDEVICE_A_IFINDEX, uint32(idx))
+		m.PutAttrString(linux.WGDEVICE_A_IFNAME, name)
+		return m
+	}
+	m := newMessage()
+	m.Put(device.Bytes())
+
+	// Peers whose allowed IPs don't fit in a message are continued in the
+	// next ones, with only their public key.
+	var nested netlink.Attrs
+	for _, peer := range peers {
+		first := true
+		ips := peer.allowedIPs
+		for first || len(ips) > 0 {
+			var attrs netlink.Attrs
+			if first {
+				attrs = peer.attrs
+			} else {
+				attrs.Put(linux.WGPEER_A_PUBLIC_KEY, peer.publicKey)
+			}
+			first = false
+
+			// Leave room for the headers of the peer and its allowed
+			// IPs.
+			size := len(attrs.Bytes()) + 2*linux.NetlinkAttrHeaderSize
+			var allowed netlink.Attrs
+			for len(ips) > 0 && size+len(allowed.Bytes())+linux.NetlinkAttrHeaderSize+len(ips[0]) <= maxPeersSize {
+				allowed.Put(linux.NLA_F_NESTED, ips[0])
+				ips = ips[1:]
+			}
+			if len(allowed.Bytes()) > 0 {
+				attrs.Put(linux.WGPEER_A_ALLOWEDIPS|linux.NLA_F_NESTED, allowed.Bytes())
+			}
+
+			if len(nested.Bytes())+linux.NetlinkAttrHeaderSize+len(attrs.Bytes()) > maxPeersSize {
+				m.PutAttr(linux.WGDEVICE_A_PEERS|linux.NLA_F_NESTED, nested.Bytes())
+				m = newMessage()
+				nested = netlink.Attrs{}
+			}
+			nested.Put(linux.NLA_F_NESTED, attrs.Bytes())
+		}
+	}
+	if len(nested.Bytes()) > 0 {
+		m.PutAttr(linux.WGDEVICE_A_PEERS|linux.NLA_F_NESTED, nested.Bytes())
+	}
+	return nil
+}
+
+// parseWireGuardPeerKey adds the attribute of the peer key and value of the
+// userspace API to peer. lastHandshake holds the last handshake time of the
+// peer until it is complete.
+func parseWireGuardPeerKey(peer *wireGuardPeer, lastHandshake *linux.Timespec, key, value string) error {
+	switch key {
+	case "preshared_key":
+		k, err := wireguard.ParseHexKey(value)
+		if err != nil {
+			return err
+		}
+		peer.attrs.Put(linux.WGPEER_A_PRESHARED_KEY, k[:])
+	case "protocol_version":
+		v, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return err
+		}
+		peer.attrs.Put(linux.WGPEER_A_PROTOCOL_VERSION, uint32(v))
+	case "endpoint":
+		addr, err := wireguard.ParseEndpoint(value)
+		if err != nil {
+			return err
+		}
+		peer.attrs.Put(linux.WGPEER_A_ENDPOINT, marshalSockAddr(addr))
+	case "last_handshake_time_sec":
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		lastHandshake.Sec = v
+	case "last_handshake_time_nsec":
+		// The nanoseconds follow the seconds.
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		lastHandshake.Nsec = v
+		peer.attrs.Put(linux.WGPEER_A_LAST_HANDSHAKE_TIME, *lastHandshake)
+		*lastHandshake = linux.Timespec{}
+	case "rx_bytes", "tx_bytes":
+		v, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		typ := uint16(linux.WGPEER_A_RX_BYTES)
+		if key == "tx_bytes" {
+			typ = linux.WGPEER_A_TX_BYTES
+		}
+		peer.attrs.Put(typ, v)
+	case "persistent_keepalive_interval":
+		v, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return err
+		}
+		peer.attrs.Put(linux.WGPEER_A_PERSISTENT_KEEPALIVE_INTERVAL, uint16(v))
+	case "allowed_ip":
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return err
+		}
+		family := uint16(linux.AF_INET6)
+		ip := ipNet.IP
+		if ip4 := ip.To4(); ip4 != nil {
+			family, ip = linux.AF_INET, ip4
+		}
+		ones, _ := ipNet.Mask.Size()
+		var a netlink.Attrs
+		a.Put(linux.WGALLOWEDIP_A_FAMILY, family)
+		a.Put(linux.WGALLOWEDIP_A_IPADDR, []byte(ip))
+		a.Put(linux.WGALLOWEDIP_A_CIDR_MASK, uint8(ones))
+		peer.allowedIPs = append(peer.allowedIPs, a.Bytes())
+	}
+	return nil
+}
+
+// setWireGuardDevice handles WG_CMD_SET_DEVICE requests for dev, with the
+// attributes attrs.
+func setWireGuardDevice(dev inet.WireGuardDevice, attrs map[uint16][]byte) *syserr.Error {
+	var b bytes.Buffer
+	if v, ok := attrs[linux.WGDEVICE_A_FLAGS]; ok {
+		if len(v) < 4 {
+			return syserr.ErrInvalidArgument
+		}
+		flags := usermem.ByteOrder.Uint32(v)
+		if flags&^linux.WGDEVICE_F_REPLACE_PEERS != 0 {
+			return syserr.ErrNotSupported
+		}
+		if flags&linux.WGDEVICE_F_REPLACE_PEERS != 0 {
+			b.WriteString("replace_peers=true\n")
+		}
+	}
+	if v, ok := attrs[linux.WGDEVICE_A_PRIVATE_KEY]; ok {
+		if len(v) != linux.WG_KEY_LEN {
+			return syserr.ErrInvalidArgument
+		}
+		fmt.Fprintf(&b, "private_key=%s\n", hex.EncodeToString(v))
+	}
+	if v, ok := attrs[linux.WGDEVICE_A_LISTEN_PORT]; ok {
+		if len(v) < 2 {
+			return syserr.ErrInvalidArgument
+		}
+		fmt.Fprintf(&b, "listen_port=%d\n", usermem.ByteOrder.Uint16(v))
+	}
+	if v, ok := attrs[linux.WGDEVICE_A_FWMARK]; ok {
+		if len(v) < 4 {
+			return syserr.ErrInvalidArgument
+		}
+		fmt.Fprintf(&b, "fwmark=%d\n", usermem.ByteOrder.Uint32(v))
+	}
+
+	for peers := netlink.AttrsView(attrs[linux.WGDEVICE_A_PEERS]); !peers.Empty(); {
+		_, v, rest, ok := peers.ParseFirst()
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		peers = rest
+		if err := writeWireGuardPeer(&b, v); err != nil {
+			return err
+		}
+	}
+
+	return syserr.FromError(dev.IpcSet(&b))
+}
+
+// writeWireGuardPeer writes the configuration of the peer with the attributes
+// in v to b, in the format of the userspace API.
+func writeWireGuardPeer(b *bytes.Buffer, v []byte) *syserr.Error {
+	attrs, ok := netlink.AttrsView(v).Parse()
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	pub, ok := attrs[linux.WGPEER_A_PUBLIC_KEY]
+	if !ok || len(pub) != linux.WG_KEY_LEN {
+		return syserr.ErrInvalidArgument
+	}
+	fmt.Fprintf(b, "public_key=%s\n", hex.EncodeToString(pub))
+
+	if v, ok := attrs[linux.WGPEER_A_FLAGS]; ok {
+		if len(v) < 4 {
+			return syserr.ErrInvalidArgument
+		}
+		flags := usermem.ByteOrder.Uint32(v)
+		if flags&^(linux.WGPEER_F_REMOVE_ME|linux.WGPEER_F_REPLACE_ALLOWEDIPS|linux.WGPEER_F_UPDATE_ONLY) != 0 {
+			return syserr.ErrNotSupported
+		}
+		if flags&linux.WGPEER_F_REMOVE_ME != 0 {
+			b.WriteString("remove=true\n")
+		}
+		if flags&linux.WGPEER_F_UPDATE_ONLY != 0 {
+			b.WriteString("update_only=true\n")
+		}
+		if flags&linux.WGPEER_F_REPLACE_ALLOWEDIPS != 0 {
+			b.WriteString("replace_allowed_ips=true\n")
+		}
+	}
+	if v, ok := attrs[linux.WGPEER_A_PRESHARED_KEY]; ok {
+		if len(v) != linux.WG_KEY_LEN {
+			return syserr.ErrInvalidArgument
+		}
+		fmt.Fprintf(b, "preshared_key=%s\n", hex.EncodeToString(v))
+	}
+	if v, ok := attrs[linux.WGPEER_A_ENDPOINT]; ok {
+		addr, ok := unmarshalSockAddr(v)
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		fmt.Fprintf(b, "endpoint=%s\n", wireguard.FormatEndpoint(addr))
+	}
+	if v, ok := attrs[linux.WGPEER_A_PERSISTENT_KEEPALIVE_INTERVAL]; ok {
+		if len(v) < 2 {
+			return syserr.ErrInvalidArgument
+		}
+		fmt.Fprintf(b, "persistent_keepalive_interval=%d\n", usermem.ByteOrder.Uint16(v))
+	}
+	if v, ok := attrs[linux.WGPEER_A_PROTOCOL_VERSION]; ok {
+		if len(v) < 4 {
+			return syserr.ErrInvalidArgument
+		}
+		fmt.Fprintf(b, "protocol_version=%d\n", usermem.ByteOrder.Uint32(v))
+	}
+
+	for ips := netlink.AttrsView(attrs[linux.WGPEER_A_ALLOWEDIPS]); !ips.Empty(); {
+		_, v, rest, ok := ips.ParseFirst()
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		ips = rest
+		ip, ok := netlink.AttrsView(v).Parse()
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		family, addr, mask := ip[linux.WGALLOWEDIP_A_FAMILY], ip[linux.WGALLOWEDIP_A_IPADDR], ip[linux.WGALLOWEDIP_A_CIDR_MASK]
+		if len(family) < 2 || len(mask) < 1 {
+			return syserr.ErrInvalidArgument
+		}
+		switch usermem.ByteOrder.Uint16(family) {
+		case linux.AF_INET:
+			if len(addr) != 4 {
+				return syserr.ErrInvalidArgument
+			}
+		case linux.AF_INET6:
+			if len(addr) != 16 {
+				return syserr.ErrInvalidArgument
+			}
+		default:
+			return syserr.ErrAddressFamilyNotSupported
+		}
+		fmt.Fprintf(b, "allowed_ip=%s/%d\n", net.IP(addr), mask[0])
+	}
+	return nil
+}
+
+// marshalSockAddr returns addr as a struct sockaddr_in or sockaddr_in6.
+func marshalSockAddr(addr tcpip.FullAddress) []byte {
+	var b []byte
+	if len(addr.Addr) == 4 {
+		sa := linux.SockAddrInet{Family: linux.AF_INET}
+		copy(sa.Addr[:], addr.Addr)
+		b = binary.Marshal(nil, usermem.ByteOrder, sa)
+	} else {
+		sa := linux.SockAddrInet6{Family: linux.AF_INET6}
+		copy(sa.Addr[:], addr.Addr)
+		b = binary.Marshal(nil, usermem.ByteOrder, sa)
+	}
+	// The port is in network byte order.
+	binary.BigEndian.PutUint16(b[2:], addr.Port)
+	return b
+}
+
+// unmarshalSockAddr parses the struct sockaddr_in or sockaddr_in6 in b. ok is
+// false if it is malformed.
+func unmarshalSockAddr(b []byte) (addr tcpip.FullAddress, ok bool) {
+	if len(b) < 4 {
+		return addr, false
+	}
+	addr.Port = binary.BigEndian.Uint16(b[2:])
+	switch usermem.ByteOrder.Uint16(b) {
+	case linux.AF_INET:
+		if len(b) < 8 {
+			return addr, false
+		}
+		addr.Addr = tcpip.Address(b[4:8])
+	case linux.AF_INET6:
+		if len(b) < 24 {
+			return addr, false
+		}
+		addr.Addr = tcpip.Address(b[8:24])
+	default:
+		return addr, false
+	}
+	return addr, true
+}
@@ -77,20 +77,7 @@ func (m *Message) Put(v interface{}) {
 // Preconditions: The serialized attribute (linux.NetlinkAttrHeaderSize +
 // binary.Size(v) fits in math.MaxUint16 bytes.
 func (m *Message) PutAttr(atype uint16, v interface{}) {
-	l := linux.NetlinkAttrHeaderSize + int(binary.Size(v))
-	if l > math.MaxUint16 {
-		panic(fmt.Sprintf("attribute too large: %d", l))
-	}
-
-	m.Put(linux.NetlinkAttrHeader{
-		Type:   atype,
-		Length: uint16(l),
-	})
-	m.Put(v)
-
-	// Align the attribute.
-	aligned := alignUp(l, linux.NLA_ALIGNTO)
-	m.putZeros(aligned - l)
+	m.buf = putAttr(m.buf, atype, v)
 }
 
 // PutAttrString adds s to the message as a netlink attribute.
@@ -110,6 +97,95 @@ func (m *Message) PutAttrString(atype uint16, s string) {
 	m.putZeros(aligned - l)
 }
 
+// putAttr appends v to buf as a netlink attribute, and returns the extended
+// buffer.
+func putAttr(buf []byte, atype uint16, v interface{}) []byte {
+	l := linux.NetlinkAttrHeaderSize + int(binary.Size(v))
+	if l > math.MaxUint16 {
+		panic(fmt.Sprintf("attribute too large: %d", l))
+	}
+
+	buf = binary.Marshal(buf, usermem.ByteOrder, linux.NetlinkAttrHeader{
+		Type:   atype,
+		Length: uint16(l),
+	})
+	buf = binary.Marshal(buf, usermem.ByteOrder, v)
+
+	// Align the attribute.
+	aligned := alignUp(l, linux.NLA_ALIGNTO)
+	for i := l; i < aligned; i++ {
+		buf = append(buf, 0)
+	}
+	return buf
+}
+
+// Attrs contains serialized netlink attributes, to be nested in another
+// attribute.
+type Attrs struct {
+	buf []byte
+}
+
+// Put adds v to the attributes.
+//
+// Preconditions: as Message.PutAttr.
+func (a *Attrs) Put(atype uint16, v interface{}) {
+	a.buf = putAttr(a.buf, atype, v)
+}
+
+// PutString adds s to the attributes as a NUL-terminated string.
+func (a *Attrs) PutString(atype uint16, s string) {
+	a.buf = putAttr(a.buf, atype, append([]byte(s), 0))
+}
+
+// Bytes returns the serialized attributes.
+func (a *Attrs) Bytes() []byte {
+	return a.buf
+}
+
+// AttrsView is a view into the netlink attributes of a message.
+type AttrsView []byte
+
+// Empty returns whether there is no attribute left in v.
+func (v AttrsView) Empty() bool {
+	return len(v) < linux.NetlinkAttrHeaderSize
+}
+
+// ParseFirst parses the first netlink attribute of v, and returns its header,
+// its value and the attributes following it. ok is false if the attribute is
+// malformed.
+func (v AttrsView) ParseFirst() (hdr linux.NetlinkAttrHeader, value []byte, rest AttrsView, ok bool) {
+	if len(v) < linux.NetlinkAttrHeaderSize {
+		return hdr, nil, nil, false
+	}
+	binary.Unmarshal(v[:linux.NetlinkAttrHeaderSize], usermem.ByteOrder, &hdr)
+	if hdr.Length < linux.NetlinkAttrHeaderSize || int(hdr.Length) > len(v) {
+		return hdr, nil, nil, false
+	}
+	value = v[linux.NetlinkAttrHeaderSize:hdr.Length]
+
+	next := alignUp(int(hdr.Length), linux.NLA_ALIGNTO)
+	if next > len(v) {
+		next = len(v)
+	}
+	return hdr, value, v[next:], true
+}
+
+// Parse parses all the netlink attributes of v into a mapping from attribute
+// types, without their flags, to values. ok is false if an attribute is
+// malformed.
+func (v AttrsView) Parse() (attrs map[uint16][]byte, ok bool) {
+	attrs = make(map[uint16][]byte)
+	for !v.Empty() {
+		hdr, value, rest, ok := v.ParseFirst()
+		if !ok {
+			return nil, false
+		}
+		attrs[hdr.Type&linux.NLA_TYPE_MASK] = value
+		v = rest
+	}
+	return attrs, true
+}
+
 // MessageSet contains a series of netlink messages.
 type MessageSet struct {
 	// Multi indicates that this a multi-part message, to be terminated by
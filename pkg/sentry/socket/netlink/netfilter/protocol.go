@@ -0,0 +1,326 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package netfilter provides a NETLINK_NETFILTER socket protocol.
+//
+// Only the dump, get and delete operations of the ctnetlink subsystem are
+// supported.
+package netfilter
+
+import (
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/binary"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/inet"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserr"
+)
+
+// Protocol implements netlink.Protocol.
+//
+// +stateify savable
+type Protocol struct{}
+
+var _ netlink.Protocol = (*Protocol)(nil)
+
+// NewProtocol creates a NETLINK_NETFILTER netlink.Protocol.
+func NewProtocol(t *kernel.Task) (netlink.Protocol, *syserr.Error) {
+	return &Protocol{}, nil
+}
+
+// Protocol implements netlink.Protocol.Protocol.
+func (p *Protocol) Protocol() int {
+	return linux.NETLINK_NETFILTER
+}
+
+// ProcessMessage implements netlink.Protocol.ProcessMessage.
+func (p *Protocol) ProcessMessage(ctx context.Context, hdr linux.NetlinkMessageHeader, data []byte, ms *netlink.MessageSet) *syserr.Error {
+	// All messages start with a nfgenmsg.
+	if len(data) < linux.NetFilterGenericMessageSize {
+		return syserr.ErrInvalidArgument
+	}
+	var msg linux.NetFilterGenericMessage
+	binary.Unmarshal(data[:linux.NetFilterGenericMessageSize], usermem.ByteOrder, &msg)
+	attrs := netlink.AttrsView(data[linux.NetFilterGenericMessageSize:])
+
+	// The subsystem is in the high byte of the message type.
+	if hdr.Type>>8 != linux.NFNL_SUBSYS_CTNETLINK {
+		return syserr.ErrNotSupported
+	}
+
+	// Like Linux, all ctnetlink operations require CAP_NET_ADMIN.
+	creds := auth.CredentialsFromContext(ctx)
+	if !creds.HasCapability(linux.CAP_NET_ADMIN) {
+		return syserr.ErrNotPermitted
+	}
+
+	stack := inet.StackFromContext(ctx)
+	if stack == nil || !stack.SupportsConnTrack() {
+		return syserr.ErrNotSupported
+	}
+
+	as, ok := attrs.Parse()
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+
+	switch hdr.Type & 0xff {
+	case linux.IPCTNL_MSG_CT_GET:
+		return getConnTrack(stack, hdr, msg, as, ms)
+	case linux.IPCTNL_MSG_CT_DELETE:
+		return deleteConnTrack(stack, msg, as)
+	default:
+		return syserr.ErrNotSupported
+	}
+}
+
+// getConnTrack handles IPCTNL_MSG_CT_GET messages. See Linux's
+// net/netfilter/nf_conntrack_netlink.c:ctnetlink_get_conntrack.
+func getConnTrack(stack inet.Stack, hdr linux.NetlinkMessageHeader, msg linux.NetFilterGenericMessage, attrs map[uint16][]byte, ms *netlink.MessageSet) *syserr.Error {
+	entries := stack.ConnTrack()
+
+	if hdr.Flags&linux.NLM_F_DUMP == linux.NLM_F_DUMP {
+		// We always send back an NLMSG_DONE.
+		ms.Multi = true
+		for i := range entries {
+			e := &entries[i]
+			if msg.Family != linux.AF_UNSPEC && e.Original.Family != msg.Family {
+				continue
+			}
+			putConnTrack(ms, e)
+		}
+		return nil
+	}
+
+	t, err := lookupTuple(msg.Family, attrs)
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		e := &entries[i]
+		if tupleEqual(&e.Original, &t) || tupleEqual(&e.Reply, &t) {
+			putConnTrack(ms, e)
+			return nil
+		}
+	}
+	return syserr.ErrNoFileOrDir
+}
+
+// deleteConnTrack handles IPCTNL_MSG_CT_DELETE messages. Without a tuple, all
+// the connections of the family are deleted. See Linux's
+// net/netfilter/nf_conntrack_netlink.c:ctnetlink_del_conntrack.
+func deleteConnTrack(stack inet.Stack, msg linux.NetFilterGenericMessage, attrs map[uint16][]byte) *syserr.Error {
+	_, orig := attrs[linux.CTA_TUPLE_ORIG]
+	_, reply := attrs[linux.CTA_TUPLE_REPLY]
+	if !orig && !reply {
+		if err := stack.FlushConnTrack(msg.Family); err != nil {
+			return syserr.FromError(err)
+		}
+		return nil
+	}
+
+	t, err := lookupTuple(msg.Family, attrs)
+	if err != nil {
+		return err
+	}
+	if err := stack.DeleteConnTrack(t); err != nil {
+		return syserr.FromError(err)
+	}
+	return nil
+}
+
+// lookupTuple parses the CTA_TUPLE_ORIG or CTA_TUPLE_REPLY attribute of a
+// request.
+func lookupTuple(family uint8, attrs map[uint16][]byte) (inet.ConnTrackTuple, *syserr.Error) {
+	v, ok := attrs[linux.CTA_TUPLE_ORIG]
+	if !ok {
+		if v, ok = attrs[linux.CTA_TUPLE_REPLY]; !ok {
+			return inet.ConnTrackTuple{}, syserr.ErrInvalidArgument
+		}
+	}
+	return parseTuple(family, v)
+}
+
+// parseTuple parses the nested attributes of a CTA_TUPLE_* attribute. See
+// Linux's net/netfilter/nf_conntrack_netlink.c:ctnetlink_parse_tuple.
+func parseTuple(family uint8, b []byte) (inet.ConnTrackTuple, *syserr.Error) {
+	t := inet.ConnTrackTuple{Family: family}
+
+	attrs, ok := netlink.AttrsView(b).Parse()
+	if !ok {
+		return t, syserr.ErrInvalidArgument
+	}
+	ipAttrs, ok := netlink.AttrsView(attrs[linux.CTA_TUPLE_IP]).Parse()
+	if !ok {
+		return t, syserr.ErrInvalidArgument
+	}
+	protoAttrs, ok := netlink.AttrsView(attrs[linux.CTA_TUPLE_PROTO]).Parse()
+	if !ok {
+		return t, syserr.ErrInvalidArgument
+	}
+
+	var srcType, dstType uint16
+	var addrLen int
+	switch family {
+	case linux.AF_INET:
+		srcType, dstType, addrLen = linux.CTA_IP_V4_SRC, linux.CTA_IP_V4_DST, 4
+	case linux.AF_INET6:
+		srcType, dstType, addrLen = linux.CTA_IP_V6_SRC, linux.CTA_IP_V6_DST, 16
+	default:
+		return t, syserr.ErrNotSupported
+	}
+	if len(ipAttrs[srcType]) != addrLen || len(ipAttrs[dstType]) != addrLen {
+		return t, syserr.ErrInvalidArgument
+	}
+	t.Src, t.Dst = ipAttrs[srcType], ipAttrs[dstType]
+
+	if len(protoAttrs[linux.CTA_PROTO_NUM]) != 1 {
+		return t, syserr.ErrInvalidArgument
+	}
+	t.Protocol = protoAttrs[linux.CTA_PROTO_NUM][0]
+	switch t.Protocol {
+	case linux.IPPROTO_TCP, linux.IPPROTO_UDP:
+		src, dst := protoAttrs[linux.CTA_PROTO_SRC_PORT], protoAttrs[linux.CTA_PROTO_DST_PORT]
+		if len(src) != 2 || len(dst) != 2 {
+			return t, syserr.ErrInvalidArgument
+		}
+		t.SrcPort, t.DstPort = binary.BigEndian.Uint16(src), binary.BigEndian.Uint16(dst)
+	case linux.IPPROTO_ICMP, linux.IPPROTO_ICMPV6:
+		idType := uint16(linux.CTA_PROTO_ICMP_ID)
+		if t.Protocol == linux.IPPROTO_ICMPV6 {
+			idType = linux.CTA_PROTO_ICMPV6_ID
+		}
+		id := protoAttrs[idType]
+		if len(id) != 2 {
+			return t, syserr.ErrInvalidArgument
+		}
+		// Echo ids are tracked in both ports.
+		t.SrcPort = binary.BigEndian.Uint16(id)
+		t.DstPort = t.SrcPort
+	default:
+		return t, syserr.ErrNotSupported
+	}
+	return t, nil
+}
+
+// tupleEqual returns true if a and b identify the same direction of a
+// connection.
+func tupleEqual(a, b *inet.ConnTrackTuple) bool {
+	return a.Family == b.Family && a.Protocol == b.Protocol &&
+		string(a.Src) == string(b.Src) && string(a.Dst) == string(b.Dst) &&
+		a.SrcPort == b.SrcPort && a.DstPort == b.DstPort
+}
+
+// putConnTrack adds a IPCTNL_MSG_CT_NEW message describing e to ms. See
+// Linux's net/netfilter/nf_conntrack_netlink.c:ctnetlink_fill_info.
+func putConnTrack(ms *netlink.MessageSet, e *inet.ConnTrackEntry) {
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: linux.NFNL_SUBSYS_CTNETLINK<<8 | linux.IPCTNL_MSG_CT_NEW,
+	})
+	m.Put(linux.NetFilterGenericMessage{
+		Family:  e.Original.Family,
+		Version: linux.NFNETLINK_V0,
+	})
+
+	m.PutAttr(linux.CTA_TUPLE_ORIG|linux.NLA_F_NESTED, tupleAttrs(&e.Original, false /* reply */))
+	m.PutAttr(linux.CTA_TUPLE_REPLY|linux.NLA_F_NESTED, tupleAttrs(&e.Reply, true /* reply */))
+
+	status := uint32(linux.IPS_CONFIRMED)
+	if e.SeenReply {
+		status |= linux.IPS_SEEN_REPLY
+	}
+	if e.Assured {
+		status |= linux.IPS_ASSURED
+	}
+	m.PutAttr(linux.CTA_STATUS, bigEndianUint32(status))
+	m.PutAttr(linux.CTA_TIMEOUT, bigEndianUint32(uint32(e.Timeout/time.Second)))
+
+	if e.Original.Protocol == linux.IPPROTO_TCP {
+		var tcp netlink.Attrs
+		tcp.Put(linux.CTA_PROTOINFO_TCP_STATE, e.TCPState)
+		var info netlink.Attrs
+		info.Put(linux.CTA_PROTOINFO_TCP|linux.NLA_F_NESTED, tcp.Bytes())
+		m.PutAttr(linux.CTA_PROTOINFO|linux.NLA_F_NESTED, info.Bytes())
+	}
+
+	m.PutAttr(linux.CTA_USE, bigEndianUint32(1))
+	m.PutAttr(linux.CTA_ID, bigEndianUint32(e.ID))
+}
+
+// tupleAttrs returns the nested attributes of a CTA_TUPLE_* attribute
+// describing t. reply is whether t is the tuple of the reply direction.
+func tupleAttrs(t *inet.ConnTrackTuple, reply bool) []byte {
+	var ip netlink.Attrs
+	if t.Family == linux.AF_INET6 {
+		ip.Put(linux.CTA_IP_V6_SRC, t.Src)
+		ip.Put(linux.CTA_IP_V6_DST, t.Dst)
+	} else {
+		ip.Put(linux.CTA_IP_V4_SRC, t.Src)
+		ip.Put(linux.CTA_IP_V4_DST, t.Dst)
+	}
+
+	var proto netlink.Attrs
+	proto.Put(linux.CTA_PROTO_NUM, t.Protocol)
+	switch t.Protocol {
+	case linux.IPPROTO_TCP, linux.IPPROTO_UDP:
+		proto.Put(linux.CTA_PROTO_SRC_PORT, bigEndianUint16(t.SrcPort))
+		proto.Put(linux.CTA_PROTO_DST_PORT, bigEndianUint16(t.DstPort))
+	case linux.IPPROTO_ICMP:
+		// Only echo requests and their replies are tracked.
+		typ := uint8(8) // ICMP_ECHO
+		if reply {
+			typ = 0 // ICMP_ECHOREPLY
+		}
+		proto.Put(linux.CTA_PROTO_ICMP_ID, bigEndianUint16(t.SrcPort))
+		proto.Put(linux.CTA_PROTO_ICMP_TYPE, typ)
+		proto.Put(linux.CTA_PROTO_ICMP_CODE, uint8(0))
+	case linux.IPPROTO_ICMPV6:
+		typ := uint8(128) // ICMPV6_ECHO_REQUEST
+		if reply {
+			typ = 129 // ICMPV6_ECHO_REPLY
+		}
+		proto.Put(linux.CTA_PROTO_ICMPV6_ID, bigEndianUint16(t.SrcPort))
+		proto.Put(linux.CTA_PROTO_ICMPV6_TYPE, typ)
+		proto.Put(linux.CTA_PROTO_ICMPV6_CODE, uint8(0))
+	}
+
+	var attrs netlink.Attrs
+	attrs.Put(linux.CTA_TUPLE_IP|linux.NLA_F_NESTED, ip.Bytes())
+	attrs.Put(linux.CTA_TUPLE_PROTO|linux.NLA_F_NESTED, proto.Bytes())
+	return attrs.Bytes()
+}
+
+// bigEndianUint16 returns the __be16 attribute value v.
+func bigEndianUint16(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+// bigEndianUint32 returns the __be32 attribute value v.
+func bigEndianUint32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+// init registers the NETLINK_NETFILTER provider.
+func init() {
+	netlink.RegisterProvider(linux.NETLINK_NETFILTER, NewProtocol)
+}
@@ -39,6 +39,18 @@ type Protocol interface {
 	ProcessMessage(ctx context.Context, hdr linux.NetlinkMessageHeader, data []byte, ms *MessageSet) *syserr.Error
 }
 
+// Multicaster is implemented by protocols whose sockets may join multicast
+// groups to receive messages sent by the kernel.
+type Multicaster interface {
+	// Groups returns the mask of the multicast groups that sockets of the
+	// protocol may join.
+	Groups() uint32
+
+	// JoinGroups is called when a socket joins the multicast groups in
+	// groups. It returns the datagrams to deliver to the socket.
+	JoinGroups(ctx context.Context, groups uint32) [][]byte
+}
+
 // Provider is a function that creates a new Protocol for a specific netlink
 // protocol.
 //
@@ -0,0 +1,162 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route
+
+import (
+	"bytes"
+	"strings"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/binary"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/inet"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserr"
+)
+
+// linkKindWireGuard is the kind of WireGuard links, as named by ip-link(8).
+const linkKindWireGuard = "wireguard"
+
+// newLink handles RTM_NEWLINK requests.
+//
+// Only WireGuard, GRE and VXLAN links can be created. Existing links can only be set up, as
+// they always are.
+func (p *Protocol) newLink(ctx context.Context, hdr linux.NetlinkMessageHeader, data []byte, ms *netlink.MessageSet) *syserr.Error {
+	if len(data) < linux.InterfaceInfoMessageSize {
+		return syserr.ErrInvalidArgument
+	}
+	var msg linux.InterfaceInfoMessage
+	binary.Unmarshal(data[:linux.InterfaceInfoMessageSize], usermem.ByteOrder, &msg)
+	attrs, ok := netlink.AttrsView(data[linux.InterfaceInfoMessageSize:]).Parse()
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+
+	stack := inet.StackFromContext(ctx)
+	if stack == nil {
+		return syserr.ErrNotSupported
+	}
+	name := attrString(attrs[linux.IFLA_IFNAME])
+	var iface inet.Interface
+	exists := false
+	for id, i := range stack.Interfaces() {
+		if (msg.Index != 0 && id == msg.Index) || (msg.Index == 0 && name != "" && i.Name == name) {
+			iface, exists = i, true
+			break
+		}
+	}
+
+	if exists {
+		if hdr.Flags&linux.NLM_F_EXCL != 0 {
+			return syserr.ErrExists
+		}
+		if msg.Change&^linux.IFF_UP != 0 || (msg.Change&linux.IFF_UP != 0 && msg.Flags&linux.IFF_UP == 0) {
+			return syserr.ErrNotSupported
+		}
+		if v, ok := attrs[linux.IFLA_MTU]; ok {
+			if mtu, ok := attrUint32(v); !ok || mtu != iface.MTU {
+				return syserr.ErrNotSupported
+			}
+		}
+		return nil
+	}
+	if msg.Index != 0 {
+		return syserr.ErrNoDevice
+	}
+	if hdr.Flags&linux.NLM_F_CREATE == 0 {
+		return syserr.ErrNoDevice
+	}
+
+	info, ok := netlink.AttrsView(attrs[linux.IFLA_LINKINFO]).Parse()
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	kind := attrString(info[linux.IFLA_INFO_KIND])
+	var tunnel inet.Tunnel
+	switch kind {
+	case linkKindWireGuard:
+	case linkKindGRE, linkKindIP6GRE, linkKindVXLAN:
+		var err *syserr.Error
+		if tunnel, err = parseTunnel(kind, info[linux.IFLA_INFO_DATA]); err != nil {
+			return err
+		}
+	default:
+		return syserr.ErrNotSupported
+	}
+	if name == "" || len(name) >= linux.IFNAMSIZ || strings.ContainsAny(name, "/: ") {
+		return syserr.ErrInvalidArgument
+	}
+	if kind == linkKindWireGuard {
+		_, err := stack.NewWireGuardInterface(name)
+		return syserr.FromError(err)
+	}
+	_, err := stack.NewTunnelInterface(name, tunnel)
+	return syserr.FromError(err)
+}
+
+// newAddr handles RTM_NEWADDR requests.
+func (p *Protocol) newAddr(ctx context.Context, hdr linux.NetlinkMessageHeader, data []byte, ms *netlink.MessageSet) *syserr.Error {
+	if len(data) < linux.InterfaceAddrMessageSize {
+		return syserr.ErrInvalidArgument
+	}
+	var msg linux.InterfaceAddrMessage
+	binary.Unmarshal(data[:linux.InterfaceAddrMessageSize], usermem.ByteOrder, &msg)
+	attrs, ok := netlink.AttrsView(data[linux.InterfaceAddrMessageSize:]).Parse()
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+
+	// IFA_LOCAL is the address of the interface, and IFA_ADDRESS the one
+	// of its peer on point-to-point links. They are the same otherwise.
+	addr, ok := attrs[linux.IFA_LOCAL]
+	if !ok {
+		if addr, ok = attrs[linux.IFA_ADDRESS]; !ok {
+			return syserr.ErrInvalidArgument
+		}
+	}
+	switch {
+	case msg.Family == linux.AF_INET && len(addr) == 4:
+	case msg.Family == linux.AF_INET6 && len(addr) == 16:
+	default:
+		return syserr.ErrInvalidArgument
+	}
+	if int(msg.PrefixLen) > len(addr)*8 {
+		return syserr.ErrInvalidArgument
+	}
+
+	stack := inet.StackFromContext(ctx)
+	if stack == nil {
+		return syserr.ErrNoDevice
+	}
+	idx := int32(msg.Index)
+	if _, ok := stack.Interfaces()[idx]; !ok {
+		return syserr.ErrNoDevice
+	}
+	for _, a := range stack.InterfaceAddrs()[idx] {
+		if bytes.Equal(a.Addr, addr) {
+			if hdr.Flags&linux.NLM_F_EXCL != 0 {
+				return syserr.ErrExists
+			}
+			return nil
+		}
+	}
+
+	return syserr.FromError(stack.AddInterfaceAddr(idx, inet.InterfaceAddr{
+		Family:    msg.Family,
+		PrefixLen: msg.PrefixLen,
+		Addr:      append([]byte(nil), addr...),
+	}))
+}
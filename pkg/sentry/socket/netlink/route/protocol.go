@@ -86,6 +86,8 @@ func (p *Protocol) dumpLinks(ctx context.Context, hdr linux.NetlinkMessageHeader
 		return nil
 	}
 
+	wgs := stack.WireGuardInterfaces()
+	tunnels := stack.Tunnels()
 	for id, i := range stack.Interfaces() {
 		m := ms.AddMessage(linux.NetlinkMessageHeader{
 			Type: linux.RTM_NEWLINK,
@@ -110,6 +112,16 @@ func (p *Protocol) dumpLinks(ctx context.Context, hdr linux.NetlinkMessageHeader
 		m.PutAttr(linux.IFLA_ADDRESS, mac)
 		m.PutAttr(linux.IFLA_BROADCAST, brd)
 
+		if _, ok := wgs[id]; ok {
+			var info netlink.Attrs
+			info.PutString(linux.IFLA_INFO_KIND, linkKindWireGuard)
+			m.PutAttr(linux.IFLA_LINKINFO, info.Bytes())
+		} else if t, ok := tunnels[id]; ok {
+			var info netlink.Attrs
+			putTunnelInfo(&info, &t)
+			m.PutAttr(linux.IFLA_LINKINFO, info.Bytes())
+		}
+
 		// TODO: There are many more attributes.
 	}
 
@@ -175,6 +187,17 @@ func (p *Protocol) ProcessMessage(ctx context.Context, hdr linux.NetlinkMessageH
 		}
 	}
 
+	switch hdr.Type {
+	case linux.RTM_NEWLINK:
+		return p.newLink(ctx, hdr, data, ms)
+	case linux.RTM_NEWADDR:
+		return p.newAddr(ctx, hdr, data, ms)
+	case linux.RTM_NEWQDISC:
+		return p.newQdisc(ctx, hdr, data, ms)
+	case linux.RTM_DELQDISC:
+		return p.delQdisc(ctx, hdr, data, ms)
+	}
+
 	// TODO: Only the dump variant of the types below are
 	// supported.
 	if hdr.Flags&linux.NLM_F_DUMP != linux.NLM_F_DUMP {
@@ -186,6 +209,8 @@ func (p *Protocol) ProcessMessage(ctx context.Context, hdr linux.NetlinkMessageH
 		return p.dumpLinks(ctx, hdr, data, ms)
 	case linux.RTM_GETADDR:
 		return p.dumpAddrs(ctx, hdr, data, ms)
+	case linux.RTM_GETQDISC:
+		return p.dumpQdiscs(ctx, hdr, data, ms)
 	default:
 		return syserr.ErrNotSupported
 	}
@@ -0,0 +1,392 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route
+
+import (
+	"bytes"
+	"math"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/binary"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/inet"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserr"
+)
+
+const (
+	// qdiscHandle is the handle of the queueing disciplines attached to
+	// interfaces, 8001:, the first one Linux allocates.
+	qdiscHandle = 0x80010000
+
+	// qdiscNoQueue is the kind of the queueing discipline reported for
+	// interfaces without one.
+	qdiscNoQueue = "noqueue"
+)
+
+// parseTrafficControlMessage parses the tcmsg at the start of data, and
+// returns it with the attributes following it.
+func parseTrafficControlMessage(data []byte) (linux.TrafficControlMessage, map[uint16][]byte, *syserr.Error) {
+	var msg linux.TrafficControlMessage
+	if len(data) < linux.TrafficControlMessageSize {
+		return msg, nil, syserr.ErrInvalidArgument
+	}
+	binary.Unmarshal(data[:linux.TrafficControlMessageSize], usermem.ByteOrder, &msg)
+	attrs, ok := netlink.AttrsView(data[linux.TrafficControlMessageSize:]).Parse()
+	if !ok {
+		return msg, nil, syserr.ErrInvalidArgument
+	}
+	return msg, attrs, nil
+}
+
+// attrString returns the value of a string attribute, without its NUL
+// terminator.
+func attrString(v []byte) string {
+	if i := bytes.IndexByte(v, 0); i >= 0 {
+		v = v[:i]
+	}
+	return string(v)
+}
+
+// attrUint32 returns the value of a u32 attribute. ok is false if it is
+// malformed.
+func attrUint32(v []byte) (val uint32, ok bool) {
+	if len(v) < 4 {
+		return 0, false
+	}
+	return usermem.ByteOrder.Uint32(v), true
+}
+
+// attrUint64 returns the value of a u64 attribute. ok is false if it is
+// malformed.
+func attrUint64(v []byte) (val uint64, ok bool) {
+	if len(v) < 8 {
+		return 0, false
+	}
+	return usermem.ByteOrder.Uint64(v), true
+}
+
+// newQdisc handles RTM_NEWQDISC requests.
+func (p *Protocol) newQdisc(ctx context.Context, hdr linux.NetlinkMessageHeader, data []byte, ms *netlink.MessageSet) *syserr.Error {
+	msg, attrs, err := parseTrafficControlMessage(data)
+	if err != nil {
+		return err
+	}
+
+	stack := inet.StackFromContext(ctx)
+	if stack == nil {
+		return syserr.ErrNoDevice
+	}
+	if _, ok := stack.Interfaces()[msg.Index]; !ok {
+		return syserr.ErrNoDevice
+	}
+	// Only root queueing disciplines are supported.
+	if msg.Parent != linux.TC_H_ROOT {
+		return syserr.ErrNotSupported
+	}
+
+	_, exists := stack.QueueingDisciplines()[msg.Index]
+	if exists && hdr.Flags&linux.NLM_F_EXCL != 0 {
+		return syserr.ErrExists
+	}
+	if !exists && hdr.Flags&linux.NLM_F_CREATE == 0 {
+		return syserr.ErrNoFileOrDir
+	}
+
+	kind, ok := attrs[linux.TCA_KIND]
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	q := inet.QueueingDiscipline{Kind: attrString(kind)}
+	opts := attrs[linux.TCA_OPTIONS]
+	switch q.Kind {
+	case inet.QueueingDisciplineFQ:
+		err = parseFQOptions(&q, opts)
+	case inet.QueueingDisciplineTBF:
+		err = parseTBFOptions(&q, opts)
+	case inet.QueueingDisciplineNetem:
+		err = parseNetemOptions(&q, opts)
+	default:
+		return syserr.ErrNoFileOrDir
+	}
+	if err != nil {
+		return err
+	}
+
+	return syserr.FromError(stack.SetQueueingDiscipline(msg.Index, q))
+}
+
+// parseFQOptions parses the TCA_OPTIONS of an fq queueing discipline into q.
+func parseFQOptions(q *inet.QueueingDiscipline, opts []byte) *syserr.Error {
+	attrs, ok := netlink.AttrsView(opts).Parse()
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	for _, a := range []struct {
+		typ uint16
+		val *uint32
+	}{
+		{linux.TCA_FQ_PLIMIT, &q.Limit},
+		{linux.TCA_FQ_FLOW_PLIMIT, &q.FlowLimit},
+		{linux.TCA_FQ_QUANTUM, &q.Quantum},
+		{linux.TCA_FQ_INITIAL_QUANTUM, &q.InitialQuantum},
+	} {
+		if v, ok := attrs[a.typ]; ok {
+			if *a.val, ok = attrUint32(v); !ok {
+				return syserr.ErrInvalidArgument
+			}
+		}
+	}
+	if v, ok := attrs[linux.TCA_FQ_FLOW_MAX_RATE]; ok {
+		rate, ok := attrUint32(v)
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		// ~0U stands for unlimited.
+		if rate != math.MaxUint32 {
+			q.MaxRate = uint64(rate)
+		}
+	}
+	return nil
+}
+
+// parseTBFOptions parses the TCA_OPTIONS of a tbf queueing discipline into q.
+func parseTBFOptions(q *inet.QueueingDiscipline, opts []byte) *syserr.Error {
+	attrs, ok := netlink.AttrsView(opts).Parse()
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	parms, ok := attrs[linux.TCA_TBF_PARMS]
+	if !ok || len(parms) < linux.TCTBFQoptSize {
+		return syserr.ErrInvalidArgument
+	}
+	var qopt linux.TCTBFQopt
+	binary.Unmarshal(parms[:linux.TCTBFQoptSize], usermem.ByteOrder, &qopt)
+	if qopt.PeakRate.Rate != 0 || attrs[linux.TCA_TBF_PRATE64] != nil {
+		// Peak rates aren't supported.
+		return syserr.ErrNotSupported
+	}
+
+	q.Rate = uint64(qopt.Rate.Rate)
+	if v, ok := attrs[linux.TCA_TBF_RATE64]; ok {
+		if q.Rate, ok = attrUint64(v); !ok {
+			return syserr.ErrInvalidArgument
+		}
+	}
+	if q.Rate == 0 {
+		return syserr.ErrInvalidArgument
+	}
+	if v, ok := attrs[linux.TCA_TBF_BURST]; ok {
+		if q.Burst, ok = attrUint32(v); !ok {
+			return syserr.ErrInvalidArgument
+		}
+	} else {
+		// The buffer is the time needed to send the burst at the rate.
+		buffer := uint64(qopt.Buffer) << linux.PSCHED_SHIFT
+		q.Burst = uint32(buffer * q.Rate / uint64(time.Second))
+	}
+	if q.Burst == 0 {
+		return syserr.ErrInvalidArgument
+	}
+	q.Limit = qopt.Limit
+	return nil
+}
+
+// parseNetemOptions parses the TCA_OPTIONS of a netem queueing discipline
+// into q. They are a tc_netem_qopt followed by attributes.
+func parseNetemOptions(q *inet.QueueingDiscipline, opts []byte) *syserr.Error {
+	if len(opts) < linux.TCNetemQoptSize {
+		return syserr.ErrInvalidArgument
+	}
+	var qopt linux.TCNetemQopt
+	binary.Unmarshal(opts[:linux.TCNetemQoptSize], usermem.ByteOrder, &qopt)
+	attrs, ok := netlink.AttrsView(opts[linux.TCNetemQoptSize:]).Parse()
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	if qopt.Gap != 0 || qopt.Duplicate != 0 {
+		// Reordering and duplication aren't supported.
+		return syserr.ErrNotSupported
+	}
+	for typ, v := range attrs {
+		switch typ {
+		case linux.TCA_NETEM_LATENCY64, linux.TCA_NETEM_JITTER64, linux.TCA_NETEM_PAD:
+		case linux.TCA_NETEM_CORR:
+			// Correlations are sent even when they are zero, and only
+			// then supported.
+			for _, b := range v {
+				if b != 0 {
+					return syserr.ErrNotSupported
+				}
+			}
+		default:
+			return syserr.ErrNotSupported
+		}
+	}
+
+	q.Limit = qopt.Limit
+	q.Loss = qopt.Loss
+	q.Latency = time.Duration(uint64(qopt.Latency) << linux.PSCHED_SHIFT)
+	q.Jitter = time.Duration(uint64(qopt.Jitter) << linux.PSCHED_SHIFT)
+	if v, ok := attrs[linux.TCA_NETEM_LATENCY64]; ok {
+		latency, ok := attrUint64(v)
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		q.Latency = time.Duration(latency)
+	}
+	if v, ok := attrs[linux.TCA_NETEM_JITTER64]; ok {
+		jitter, ok := attrUint64(v)
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		q.Jitter = time.Duration(jitter)
+	}
+	return nil
+}
+
+// delQdisc handles RTM_DELQDISC requests.
+func (p *Protocol) delQdisc(ctx context.Context, hdr linux.NetlinkMessageHeader, data []byte, ms *netlink.MessageSet) *syserr.Error {
+	msg, _, err := parseTrafficControlMessage(data)
+	if err != nil {
+		return err
+	}
+
+	stack := inet.StackFromContext(ctx)
+	if stack == nil {
+		return syserr.ErrNoDevice
+	}
+	if _, ok := stack.Interfaces()[msg.Index]; !ok {
+		return syserr.ErrNoDevice
+	}
+	if msg.Parent != linux.TC_H_ROOT {
+		return syserr.ErrNotSupported
+	}
+	return syserr.FromError(stack.RemoveQueueingDiscipline(msg.Index))
+}
+
+// dumpQdiscs handles RTM_GETQDISC + NLM_F_DUMP requests.
+func (p *Protocol) dumpQdiscs(ctx context.Context, hdr linux.NetlinkMessageHeader, data []byte, ms *netlink.MessageSet) *syserr.Error {
+	// The RTM_GETQDISC dump response is a set of RTM_NEWQDISC messages
+	// each containing a TrafficControlMessage followed by a set of netlink
+	// attributes.
+
+	// We always send back an NLMSG_DONE.
+	ms.Multi = true
+
+	stack := inet.StackFromContext(ctx)
+	if stack == nil {
+		// No network devices.
+		return nil
+	}
+
+	qs := stack.QueueingDisciplines()
+	for id := range stack.Interfaces() {
+		m := ms.AddMessage(linux.NetlinkMessageHeader{
+			Type: linux.RTM_NEWQDISC,
+		})
+
+		q, ok := qs[id]
+		if !ok {
+			// Interfaces without a queueing discipline send packets
+			// directly.
+			m.Put(linux.TrafficControlMessage{
+				Family: linux.AF_UNSPEC,
+				Index:  id,
+				Parent: linux.TC_H_ROOT,
+				Info:   1,
+			})
+			m.PutAttrString(linux.TCA_KIND, qdiscNoQueue)
+			m.PutAttr(linux.TCA_STATS, linux.TCStats{})
+			continue
+		}
+
+		m.Put(linux.TrafficControlMessage{
+			Family: linux.AF_UNSPEC,
+			Index:  id,
+			Handle: qdiscHandle,
+			Parent: linux.TC_H_ROOT,
+			Info:   1,
+		})
+		m.PutAttrString(linux.TCA_KIND, q.Kind)
+		if opts := qdiscOptions(q); opts != nil {
+			m.PutAttr(linux.TCA_OPTIONS, opts)
+		}
+		m.PutAttr(linux.TCA_STATS, linux.TCStats{
+			Bytes:      q.Stats.Bytes,
+			Packets:    uint32(q.Stats.Packets),
+			Drops:      uint32(q.Stats.Drops),
+			Overlimits: uint32(q.Stats.Overlimits),
+			QLen:       q.Stats.QueueLen,
+			Backlog:    q.Stats.Backlog,
+		})
+	}
+
+	return nil
+}
+
+// qdiscOptions returns the TCA_OPTIONS attribute of q.
+func qdiscOptions(q inet.QueueingDiscipline) []byte {
+	var attrs netlink.Attrs
+	switch q.Kind {
+	case inet.QueueingDisciplineFQ:
+		attrs.Put(linux.TCA_FQ_PLIMIT, q.Limit)
+		attrs.Put(linux.TCA_FQ_FLOW_PLIMIT, q.FlowLimit)
+		attrs.Put(linux.TCA_FQ_QUANTUM, q.Quantum)
+		attrs.Put(linux.TCA_FQ_INITIAL_QUANTUM, q.InitialQuantum)
+		maxRate := uint32(math.MaxUint32)
+		if q.MaxRate != 0 && q.MaxRate < math.MaxUint32 {
+			maxRate = uint32(q.MaxRate)
+		}
+		attrs.Put(linux.TCA_FQ_FLOW_MAX_RATE, maxRate)
+		return attrs.Bytes()
+
+	case inet.QueueingDisciplineTBF:
+		rate := uint32(math.MaxUint32)
+		if q.Rate < math.MaxUint32 {
+			rate = uint32(q.Rate)
+		}
+		var buffer uint32
+		if q.Rate != 0 {
+			buffer = uint32((uint64(q.Burst) * uint64(time.Second) / q.Rate) >> linux.PSCHED_SHIFT)
+		}
+		attrs.Put(linux.TCA_TBF_PARMS, linux.TCTBFQopt{
+			Rate:   linux.TCRateSpec{Rate: rate},
+			Limit:  q.Limit,
+			Buffer: buffer,
+		})
+		attrs.Put(linux.TCA_TBF_BURST, q.Burst)
+		if q.Rate >= math.MaxUint32 {
+			attrs.Put(linux.TCA_TBF_RATE64, q.Rate)
+		}
+		return attrs.Bytes()
+
+	case inet.QueueingDisciplineNetem:
+		opts := binary.Marshal(nil, usermem.ByteOrder, linux.TCNetemQopt{
+			Latency: uint32(uint64(q.Latency) >> linux.PSCHED_SHIFT),
+			Limit:   q.Limit,
+			Loss:    q.Loss,
+			Jitter:  uint32(uint64(q.Jitter) >> linux.PSCHED_SHIFT),
+		})
+		attrs.Put(linux.TCA_NETEM_LATENCY64, uint64(q.Latency))
+		attrs.Put(linux.TCA_NETEM_JITTER64, uint64(q.Jitter))
+		return append(opts, attrs.Bytes()...)
+
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route
+
+import (
+	"encoding/binary"
+	"net"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/inet"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.googlesource.com/gvisor/pkg/syserr"
+)
+
+// Kinds of tunnel links, as named by ip-link(8).
+const (
+	linkKindGRE    = "gre"
+	linkKindIP6GRE = "ip6gre"
+	linkKindVXLAN  = "vxlan"
+)
+
+// parseTunnel parses the IFLA_INFO_DATA attributes data of a tunnel link of
+// kind kind.
+func parseTunnel(kind string, data []byte) (inet.Tunnel, *syserr.Error) {
+	attrs, ok := netlink.AttrsView(data).Parse()
+	if !ok {
+		return inet.Tunnel{}, syserr.ErrInvalidArgument
+	}
+	switch kind {
+	case linkKindGRE:
+		return parseGRE(attrs, 4)
+	case linkKindIP6GRE:
+		return parseGRE(attrs, 16)
+	case linkKindVXLAN:
+		return parseVXLAN(attrs)
+	default:
+		return inet.Tunnel{}, syserr.ErrNotSupported
+	}
+}
+
+// parseGRE parses the attributes of a GRE link, whose addresses are addrLen
+// bytes long.
+func parseGRE(attrs map[uint16][]byte, addrLen int) (inet.Tunnel, *syserr.Error) {
+	t := inet.Tunnel{Kind: inet.TunnelKindGRE}
+	remote, ok := attrs[linux.IFLA_GRE_REMOTE]
+	if !ok || len(remote) != addrLen || net.IP(remote).IsUnspecified() {
+		// Point-to-multipoint tunnels are not supported.
+		return inet.Tunnel{}, syserr.ErrInvalidArgument
+	}
+	t.Remote = append([]byte(nil), remote...)
+	if local, ok := attrs[linux.IFLA_GRE_LOCAL]; ok && !net.IP(local).IsUnspecified() {
+		if len(local) != addrLen {
+			return inet.Tunnel{}, syserr.ErrInvalidArgument
+		}
+		t.Local = append([]byte(nil), local...)
+	}
+	if v, ok := attrs[linux.IFLA_GRE_TTL]; ok {
+		if len(v) < 1 {
+			return inet.Tunnel{}, syserr.ErrInvalidArgument
+		}
+		t.TTL = v[0]
+	}
+
+	// Checksums and sequence numbers are not supported.
+	iflags, err := attrBigEndianUint16(attrs, linux.IFLA_GRE_IFLAGS)
+	if err != nil {
+		return inet.Tunnel{}, err
+	}
+	oflags, err := attrBigEndianUint16(attrs, linux.IFLA_GRE_OFLAGS)
+	if err != nil {
+		return inet.Tunnel{}, err
+	}
+	if iflags&^linux.GRE_KEY != 0 || oflags&^linux.GRE_KEY != 0 {
+		return inet.Tunnel{}, syserr.ErrNotSupported
+	}
+	if t.HasInputKey = iflags&linux.GRE_KEY != 0; t.HasInputKey {
+		if t.InputKey, err = attrBigEndianUint32(attrs, linux.IFLA_GRE_IKEY); err != nil {
+			return inet.Tunnel{}, err
+		}
+	}
+	if t.HasOutputKey = oflags&linux.GRE_KEY != 0; t.HasOutputKey {
+		if t.OutputKey, err = attrBigEndianUint32(attrs, linux.IFLA_GRE_OKEY); err != nil {
+			return inet.Tunnel{}, err
+		}
+	}
+	return t, nil
+}
+
+// parseVXLAN parses the attributes of a VXLAN link.
+func parseVXLAN(attrs map[uint16][]byte) (inet.Tunnel, *syserr.Error) {
+	// Addresses are learned by default, as on Linux.
+	t := inet.Tunnel{Kind: inet.TunnelKindVXLAN, Learning: true}
+	vni, ok := attrUint32(attrs[linux.IFLA_VXLAN_ID])
+	if !ok || vni > 1<<24-1 {
+		return inet.Tunnel{}, syserr.ErrInvalidArgument
+	}
+	t.VNI = vni
+
+	remote, ok := attrs[linux.IFLA_VXLAN_GROUP]
+	if !ok {
+		remote, ok = attrs[linux.IFLA_VXLAN_GROUP6]
+	}
+	if ok {
+		ip := net.IP(remote)
+		if (len(ip) != 4 && len(ip) != 16) || ip.IsUnspecified() {
+			return inet.Tunnel{}, syserr.ErrInvalidArgument
+		}
+		if ip.IsMulticast() {
+			// Multicast groups are not supported, only unicast
+			// remote ends.
+			return inet.Tunnel{}, syserr.ErrNotSupported
+		}
+		t.Remote = append([]byte(nil), ip...)
+	}
+	local, ok := attrs[linux.IFLA_VXLAN_LOCAL]
+	if !ok {
+		local, ok = attrs[linux.IFLA_VXLAN_LOCAL6]
+	}
+	if ok && !net.IP(local).IsUnspecified() {
+		if (len(local) != 4 && len(local) != 16) || (t.Remote != nil && len(local) != len(t.Remote)) {
+			return inet.Tunnel{}, syserr.ErrInvalidArgument
+		}
+		t.Local = append([]byte(nil), local...)
+	}
+	if v, ok := attrs[linux.IFLA_VXLAN_TTL]; ok {
+		if len(v) < 1 {
+			return inet.Tunnel{}, syserr.ErrInvalidArgument
+		}
+		t.TTL = v[0]
+	}
+	if v, ok := attrs[linux.IFLA_VXLAN_LEARNING]; ok {
+		if len(v) < 1 {
+			return inet.Tunnel{}, syserr.ErrInvalidArgument
+		}
+		t.Learning = v[0] != 0
+	}
+	port, err := attrBigEndianUint16(attrs, linux.IFLA_VXLAN_PORT)
+	if err != nil {
+		return inet.Tunnel{}, err
+	}
+	t.Port = port
+	return t, nil
+}
+
+// attrBigEndianUint16 returns the value of the __be16 attribute atype of
+// attrs, or zero if it is absent.
+func attrBigEndianUint16(attrs map[uint16][]byte, atype uint16) (uint16, *syserr.Error) {
+	v, ok := attrs[atype]
+	if !ok {
+		return 0, nil
+	}
+	if len(v) < 2 {
+		return 0, syserr.ErrInvalidArgument
+	}
+	return binary.BigEndian.Uint16(v), nil
+}
+
+// attrBigEndianUint32 returns the value of the __be32 attribute atype of
+// attrs, or zero if it is absent.
+func attrBigEndianUint32(attrs map[uint16][]byte, atype uint16) (uint32, *syserr.Error) {
+	v, ok := attrs[atype]
+	if !ok {
+		return 0, nil
+	}
+	if len(v) < 4 {
+		return 0, syserr.ErrInvalidArgument
+	}
+	return binary.BigEndian.Uint32(v), nil
+}
+
+// putTunnelInfo adds the IFLA_INFO_KIND and IFLA_INFO_DATA attributes
+// describing the tunnel t to info.
+func putTunnelInfo(info *netlink.Attrs, t *inet.Tunnel) {
+	var data netlink.Attrs
+	switch t.Kind {
+	case inet.TunnelKindGRE:
+		kind := linkKindGRE
+		if len(t.Remote) == 16 {
+			kind = linkKindIP6GRE
+		}
+		info.PutString(linux.IFLA_INFO_KIND, kind)
+		var iflags, oflags uint16
+		if t.HasInputKey {
+			iflags |= linux.GRE_KEY
+		}
+		if t.HasOutputKey {
+			oflags |= linux.GRE_KEY
+		}
+		data.Put(linux.IFLA_GRE_LINK, uint32(0))
+		data.Put(linux.IFLA_GRE_IFLAGS, bigEndianUint16(iflags))
+		data.Put(linux.IFLA_GRE_OFLAGS, bigEndianUint16(oflags))
+		data.Put(linux.IFLA_GRE_IKEY, bigEndianUint32(t.InputKey))
+		data.Put(linux.IFLA_GRE_OKEY, bigEndianUint32(t.OutputKey))
+		local := t.Local
+		if local == nil {
+			local = make([]byte, len(t.Remote))
+		}
+		data.Put(linux.IFLA_GRE_LOCAL, local)
+		data.Put(linux.IFLA_GRE_REMOTE, t.Remote)
+		data.Put(linux.IFLA_GRE_TTL, t.TTL)
+		data.Put(linux.IFLA_GRE_TOS, uint8(0))
+		data.Put(linux.IFLA_GRE_PMTUDISC, uint8(1))
+	case inet.TunnelKindVXLAN:
+		info.PutString(linux.IFLA_INFO_KIND, linkKindVXLAN)
+		data.Put(linux.IFLA_VXLAN_ID, t.VNI)
+		if len(t.Remote) == 16 {
+			data.Put(linux.IFLA_VXLAN_GROUP6, t.Remote)
+		} else if t.Remote != nil {
+			data.Put(linux.IFLA_VXLAN_GROUP, t.Remote)
+		}
+		if len(t.Local) == 16 {
+			data.Put(linux.IFLA_VXLAN_LOCAL6, t.Local)
+		} else if t.Local != nil {
+			data.Put(linux.IFLA_VXLAN_LOCAL, t.Local)
+		}
+		data.Put(linux.IFLA_VXLAN_TTL, t.TTL)
+		var learning uint8
+		if t.Learning {
+			learning = 1
+		}
+		data.Put(linux.IFLA_VXLAN_LEARNING, learning)
+		data.Put(linux.IFLA_VXLAN_PORT, bigEndianUint16(t.Port))
+	default:
+		return
+	}
+	info.Put(linux.IFLA_INFO_DATA, data.Bytes())
+}
+
+// bigEndianUint16 returns the __be16 attribute value v.
+func bigEndianUint16(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+// bigEndianUint32 returns the __be32 attribute value v.
+func bigEndianUint32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
@@ -0,0 +1,154 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sockdiag
+
+import (
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/binary"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/epsocket"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/unix/transport"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserr"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+)
+
+// inetDiagID returns the inet_diag_sockid of a socket of family with the
+// given addresses. IPv4 addresses of IPv6 sockets are v4-mapped.
+func inetDiagID(family int, local, remote tcpip.FullAddress, sfile *fs.File) linux.InetDiagSockID {
+	var id linux.InetDiagSockID
+	id.SrcPort = [2]byte{byte(local.Port >> 8), byte(local.Port)}
+	id.DstPort = [2]byte{byte(remote.Port >> 8), byte(remote.Port)}
+	inetDiagAddr(family, id.Src[:], local.Addr)
+	inetDiagAddr(family, id.Dst[:], remote.Addr)
+	id.Interface = uint32(local.NIC)
+	id.Cookie = sockCookie(sfile)
+	return id
+}
+
+// inetDiagAddr copies addr to dst as in an inet_diag_sockid of a socket of
+// family. Unspecified addresses are left zero.
+func inetDiagAddr(family int, dst []byte, addr tcpip.Address) {
+	a := []byte(addr)
+	if family == linux.AF_INET6 && len(a) == header.IPv4AddressSize {
+		a = append([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff}, a...)
+	}
+	copy(dst, a)
+}
+
+// inetDiagMatches returns true if the socket with the given ID is the one
+// identified by a non-dump request.
+func inetDiagMatches(req, id *linux.InetDiagSockID, sfile *fs.File) bool {
+	if req.SrcPort != id.SrcPort || req.DstPort != id.DstPort || req.Src != id.Src || req.Dst != id.Dst {
+		return false
+	}
+	if req.Interface != 0 && req.Interface != id.Interface {
+		return false
+	}
+	return cookieMatches(req.Cookie, sfile)
+}
+
+// inetDiag handles SOCK_DIAG_BY_FAMILY requests for AF_INET and AF_INET6. See
+// Linux's net/ipv4/inet_diag.c.
+func inetDiag(ctx context.Context, k *kernel.Kernel, data []byte, dump bool, ms *netlink.MessageSet) *syserr.Error {
+	if len(data) < linux.InetDiagRequestV2Size {
+		return syserr.ErrInvalidArgument
+	}
+	var req linux.InetDiagRequestV2
+	binary.Unmarshal(data[:linux.InetDiagRequestV2Size], usermem.ByteOrder, &req)
+
+	var skType transport.SockType
+	var protocol tcpip.TransportProtocolNumber
+	switch req.Protocol {
+	case linux.IPPROTO_TCP:
+		skType, protocol = linux.SOCK_STREAM, header.TCPProtocolNumber
+	case linux.IPPROTO_UDP:
+		skType, protocol = linux.SOCK_DGRAM, header.UDPProtocolNumber
+	default:
+		return syserr.ErrNoFileOrDir
+	}
+
+	found := false
+	now := time.Now()
+	forEachSocket(k, int(req.Family), func(sfile *fs.File) bool {
+		sops, ok := sfile.FileOperations.(*epsocket.SocketOperations)
+		if !ok {
+			// Sockets of other stacks aren't reported.
+			return true
+		}
+		if _, t, p := sops.Type(); t != skType || p != protocol {
+			return true
+		}
+		ep := sops.Endpoint
+
+		var info tcpip.TCPInfoOption
+		state := tcpip.TCPStateClose
+		remote, err := ep.GetRemoteAddress()
+		if protocol == header.TCPProtocolNumber {
+			if err := ep.GetSockOpt(&info); err != nil {
+				return true
+			}
+			state = info.State
+		} else if err == nil {
+			state = tcpip.TCPStateEstablished
+		}
+		if req.States&(1<<uint(state)) == 0 {
+			return true
+		}
+
+		local, _ := ep.GetLocalAddress()
+		id := inetDiagID(int(req.Family), local, remote, sfile)
+		if !dump && !inetDiagMatches(&req.ID, &id, sfile) {
+			return true
+		}
+		found = true
+
+		var mi tcpip.MemInfoOption
+		ep.GetSockOpt(&mi)
+
+		m := ms.AddMessage(linux.NetlinkMessageHeader{
+			Type: linux.SOCK_DIAG_BY_FAMILY,
+		})
+		m.Put(linux.InetDiagMessage{
+			Family: req.Family,
+			State:  uint8(state),
+			ID:     id,
+			RQueue: uint32(mi.RcvQueued),
+			WQueue: uint32(mi.SndQueued),
+			UID:    sockUID(ctx, sfile),
+			Inode:  uint32(sfile.InodeID()),
+		})
+		if protocol == header.TCPProtocolNumber && req.Ext&(1<<(linux.INET_DIAG_INFO-1)) != 0 {
+			m.PutAttr(linux.INET_DIAG_INFO, epsocket.TCPInfo(&info, now))
+		}
+		if req.Ext&(1<<(linux.INET_DIAG_SKMEMINFO-1)) != 0 {
+			m.PutAttr(linux.INET_DIAG_SKMEMINFO, epsocket.MemInfo(&mi))
+		}
+		return dump
+	})
+
+	if dump {
+		ms.Multi = true
+	} else if !found {
+		return syserr.ErrNoFileOrDir
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sockdiag provides a NETLINK_SOCK_DIAG socket protocol.
+//
+// SOCK_DIAG_BY_FAMILY requests are supported for TCP and UDP sockets of
+// netstack, and for Unix domain sockets. Bytecode filters attached to
+// inet_diag requests are ignored; ss(8) applies its filters to the sockets
+// returned again anyway.
+package sockdiag
+
+import (
+	"sort"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/binary"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserr"
+)
+
+// Protocol implements netlink.Protocol.
+//
+// +stateify savable
+type Protocol struct{}
+
+var _ netlink.Protocol = (*Protocol)(nil)
+
+// NewProtocol creates a NETLINK_SOCK_DIAG netlink.Protocol.
+func NewProtocol(t *kernel.Task) (netlink.Protocol, *syserr.Error) {
+	return &Protocol{}, nil
+}
+
+// Protocol implements netlink.Protocol.Protocol.
+func (p *Protocol) Protocol() int {
+	return linux.NETLINK_SOCK_DIAG
+}
+
+// ProcessMessage implements netlink.Protocol.ProcessMessage.
+func (p *Protocol) ProcessMessage(ctx context.Context, hdr linux.NetlinkMessageHeader, data []byte, ms *netlink.MessageSet) *syserr.Error {
+	if hdr.Type != linux.SOCK_DIAG_BY_FAMILY {
+		// Sockets can't be destroyed with SOCK_DESTROY.
+		return syserr.ErrNotSupported
+	}
+
+	// All requests start with a sock_diag_req.
+	if len(data) < linux.SockDiagRequestSize {
+		return syserr.ErrInvalidArgument
+	}
+	var req linux.SockDiagRequest
+	binary.Unmarshal(data[:linux.SockDiagRequestSize], usermem.ByteOrder, &req)
+
+	k := kernel.KernelFromContext(ctx)
+	dump := hdr.Flags&linux.NLM_F_DUMP == linux.NLM_F_DUMP
+	switch req.Family {
+	case linux.AF_INET, linux.AF_INET6:
+		return inetDiag(ctx, k, data, dump, ms)
+	case linux.AF_UNIX:
+		return unixDiag(ctx, k, data, dump, ms)
+	default:
+		// As in Linux, when no handler is registered for the family.
+		return syserr.ErrNoFileOrDir
+	}
+}
+
+// forEachSocket calls fn for each socket of family, in order of inode number,
+// until fn returns false.
+func forEachSocket(k *kernel.Kernel, family int, fn func(sfile *fs.File) bool) {
+	var files []*fs.File
+	for _, sref := range k.ListSockets(family) {
+		s := sref.Get()
+		if s == nil {
+			log.Debugf("Couldn't resolve weakref %v in socket table, racing with destruction?", sref)
+			continue
+		}
+		files = append(files, s.(*fs.File))
+	}
+	defer func() {
+		for _, sfile := range files {
+			sfile.DecRef()
+		}
+	}()
+
+	sort.Slice(files, func(i, j int) bool { return files[i].InodeID() < files[j].InodeID() })
+	for _, sfile := range files {
+		if !fn(sfile) {
+			return
+		}
+	}
+}
+
+// sockCookie returns the cookie identifying the socket file, which is its inode
+// number.
+func sockCookie(sfile *fs.File) [2]uint32 {
+	ino := sfile.InodeID()
+	return [2]uint32{uint32(ino), uint32(ino >> 32)}
+}
+
+// cookieMatches returns true if a request with the given cookie matches the
+// socket file.
+func cookieMatches(cookie [2]uint32, sfile *fs.File) bool {
+	if cookie[0] == linux.INET_DIAG_NOCOOKIE && cookie[1] == linux.INET_DIAG_NOCOOKIE {
+		return true
+	}
+	return cookie == sockCookie(sfile)
+}
+
+// sockUID returns the owner of the socket file, in the user namespace of ctx.
+func sockUID(ctx context.Context, sfile *fs.File) uint32 {
+	uattr, err := sfile.Dirent.Inode.UnstableAttr(ctx)
+	if err != nil {
+		return uint32(auth.OverflowUID)
+	}
+	return uint32(uattr.Owner.UID.In(auth.CredentialsFromContext(ctx).UserNamespace).OrOverflow())
+}
+
+// init registers the NETLINK_SOCK_DIAG provider.
+func init() {
+	netlink.RegisterProvider(linux.NETLINK_SOCK_DIAG, NewProtocol)
+}
@@ -0,0 +1,135 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sockdiag
+
+import (
+	"fmt"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/binary"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/unix"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/unix/transport"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserr"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+)
+
+// unixState returns the state of a Unix domain socket, as the TCP states used
+// by Linux for them.
+func unixState(ep transport.Endpoint) uint8 {
+	switch ep.Type() {
+	case linux.SOCK_DGRAM:
+		if _, err := ep.GetRemoteAddress(); err == nil {
+			return linux.TCP_ESTABLISHED
+		}
+	case linux.SOCK_SEQPACKET, linux.SOCK_STREAM:
+		ce := ep.(transport.ConnectingEndpoint)
+		if ce.Listening() {
+			return linux.TCP_LISTEN
+		}
+		if ce.Connected() {
+			return linux.TCP_ESTABLISHED
+		}
+	}
+	return linux.TCP_CLOSE
+}
+
+// unixDiag handles SOCK_DIAG_BY_FAMILY requests for AF_UNIX. See Linux's
+// net/unix/diag.c.
+func unixDiag(ctx context.Context, k *kernel.Kernel, data []byte, dump bool, ms *netlink.MessageSet) *syserr.Error {
+	if len(data) < linux.UnixDiagRequestSize {
+		return syserr.ErrInvalidArgument
+	}
+	var req linux.UnixDiagRequest
+	binary.Unmarshal(data[:linux.UnixDiagRequestSize], usermem.ByteOrder, &req)
+
+	// Peers are reported by inode number, so map endpoints to the inodes of
+	// their sockets.
+	var inodes map[transport.Endpoint]uint32
+	if req.Show&linux.UDIAG_SHOW_PEER != 0 {
+		inodes = make(map[transport.Endpoint]uint32)
+		forEachSocket(k, linux.AF_UNIX, func(sfile *fs.File) bool {
+			inodes[sfile.FileOperations.(*unix.SocketOperations).Endpoint()] = uint32(sfile.InodeID())
+			return true
+		})
+	}
+
+	found := false
+	forEachSocket(k, linux.AF_UNIX, func(sfile *fs.File) bool {
+		sops, ok := sfile.FileOperations.(*unix.SocketOperations)
+		if !ok {
+			panic(fmt.Sprintf("Found non-unix socket file in unix socket table: %+v", sfile))
+		}
+		ep := sops.Endpoint()
+
+		if !dump && (req.Inode != uint32(sfile.InodeID()) || !cookieMatches(req.Cookie, sfile)) {
+			return true
+		}
+		state := unixState(ep)
+		if req.States&(1<<state) == 0 {
+			return true
+		}
+		found = true
+
+		m := ms.AddMessage(linux.NetlinkMessageHeader{
+			Type: linux.SOCK_DIAG_BY_FAMILY,
+		})
+		m.Put(linux.UnixDiagMessage{
+			Family: linux.AF_UNIX,
+			Type:   uint8(ep.Type()),
+			State:  state,
+			Inode:  uint32(sfile.InodeID()),
+			Cookie: sockCookie(sfile),
+		})
+		if req.Show&linux.UDIAG_SHOW_NAME != 0 {
+			if addr, err := ep.GetLocalAddress(); err == nil && addr.Addr != "" {
+				m.PutAttr(linux.UNIX_DIAG_NAME, []byte(addr.Addr))
+			}
+		}
+		if req.Show&linux.UDIAG_SHOW_PEER != 0 {
+			if peer := ep.Peer(); peer != nil {
+				if ino, ok := inodes[peer]; ok {
+					m.PutAttr(linux.UNIX_DIAG_PEER, ino)
+				}
+			}
+		}
+		if req.Show&linux.UDIAG_SHOW_RQLEN != 0 {
+			// Listening sockets report no queue sizes.
+			var rxQueue tcpip.ReceiveQueueSizeOption
+			var txQueue tcpip.SendQueueSizeOption
+			ep.GetSockOpt(&rxQueue)
+			ep.GetSockOpt(&txQueue)
+			m.PutAttr(linux.UNIX_DIAG_RQLEN, linux.UnixDiagRQLen{
+				RQueue: uint32(rxQueue),
+				WQueue: uint32(txQueue),
+			})
+		}
+		if req.Show&linux.UDIAG_SHOW_UID != 0 {
+			m.PutAttr(linux.UNIX_DIAG_UID, sockUID(ctx, sfile))
+		}
+		return dump
+	})
+
+	if dump {
+		ms.Multi = true
+	} else if !found {
+		return syserr.ErrNoFileOrDir
+	}
+	return nil
+}
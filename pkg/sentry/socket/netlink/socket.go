@@ -30,6 +30,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/kdefs"
 	ktime "gvisor.googlesource.com/gvisor/pkg/sentry/kernel/time"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/socket"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/control"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink/port"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/unix"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/unix/transport"
@@ -59,7 +60,8 @@ var netlinkSocketDevice = device.NewAnonDevice()
 // Socket is the base socket type for netlink sockets.
 //
 // This implementation only supports userspace sending and receiving messages
-// to/from the kernel.
+// to/from the kernel, and receiving messages sent by the kernel to multicast
+// groups of protocols implementing Multicaster.
 //
 // Socket implements socket.Socket.
 //
@@ -95,12 +97,19 @@ type Socket struct {
 	// portID is the port ID allocated for this socket.
 	portID int32
 
+	// groups is the mask of multicast groups the socket is a member of.
+	groups uint32
+
+	// passcred indicates that the SO_PASSCRED socket option is enabled.
+	passcred bool
+
 	// sendBufferSize is the send buffer "size". We don't actually have a
 	// fixed buffer but only consume this many bytes.
 	sendBufferSize uint32
 }
 
 var _ socket.Socket = (*Socket)(nil)
+var _ transport.Credentialer = (*Socket)(nil)
 
 // NewSocket creates a new Socket.
 func NewSocket(t *kernel.Task, protocol Protocol) (*Socket, *syserr.Error) {
@@ -222,15 +231,37 @@ func (s *Socket) Bind(t *kernel.Task, sockaddr []byte) *syserr.Error {
 		return err
 	}
 
-	// No support for multicast groups yet.
-	if a.Groups != 0 {
+	// Only protocols implementing Multicaster have multicast groups.
+	if _, ok := s.protocol.(Multicaster); !ok && a.Groups != 0 {
 		return syserr.ErrPermissionDenied
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	return s.bindPort(t, int32(a.PortID))
+	if err := s.bindPort(t, int32(a.PortID)); err != nil {
+		return err
+	}
+	return s.setGroups(t, a.Groups)
+}
+
+// setGroups makes the socket a member of the multicast groups in groups, and
+// of no other groups. Groups the protocol doesn't have are ignored, as in
+// Linux.
+//
+// Preconditions: mu is held.
+func (s *Socket) setGroups(ctx context.Context, groups uint32) *syserr.Error {
+	m, ok := s.protocol.(Multicaster)
+	if !ok {
+		return nil
+	}
+	groups &= m.Groups()
+	joined := groups &^ s.groups
+	s.groups = groups
+	if joined == 0 {
+		return nil
+	}
+	return s.deliver(m.JoinGroups(ctx, joined))
 }
 
 // Connect implements socket.Socket.Connect.
@@ -240,7 +271,7 @@ func (s *Socket) Connect(t *kernel.Task, sockaddr []byte, blocking bool) *syserr
 		return err
 	}
 
-	// No support for multicast groups yet.
+	// No support for sending to multicast groups yet.
 	if a.Groups != 0 {
 		return syserr.ErrPermissionDenied
 	}
@@ -302,6 +333,16 @@ func (s *Socket) GetSockOpt(t *kernel.Task, level int, name int, outLen int) (in
 			// We don't have limit on receiving size.
 			return int32(math.MaxInt32), nil
 
+		case linux.SO_PASSCRED:
+			if outLen < sizeOfInt32 {
+				return nil, syserr.ErrInvalidArgument
+			}
+			var passcred int32
+			if s.Passcred() {
+				passcred = 1
+			}
+			return passcred, nil
+
 		default:
 			socket.GetSockOptEmitUnimplementedEvent(t, name)
 		}
@@ -348,6 +389,15 @@ func (s *Socket) SetSockOpt(t *kernel.Task, level int, name int, opt []byte) *sy
 			// We don't have limit on receiving size. So just accept anything as
 			// valid for compatibility.
 			return nil
+		case linux.SO_PASSCRED:
+			if len(opt) < sizeOfInt32 {
+				return syserr.ErrInvalidArgument
+			}
+			passcred := usermem.ByteOrder.Uint32(opt)
+			s.mu.Lock()
+			s.passcred = passcred != 0
+			s.mu.Unlock()
+			return nil
 		default:
 			socket.SetSockOptEmitUnimplementedEvent(t, name)
 		}
@@ -355,9 +405,32 @@ func (s *Socket) SetSockOpt(t *kernel.Task, level int, name int, opt []byte) *sy
 	case linux.SOL_NETLINK:
 		switch name {
 		case linux.NETLINK_ADD_MEMBERSHIP,
-			linux.NETLINK_BROADCAST_ERROR,
+			linux.NETLINK_DROP_MEMBERSHIP:
+
+			m, ok := s.protocol.(Multicaster)
+			if !ok {
+				t.Kernel().EmitUnimplementedEvent(t)
+				break
+			}
+			if len(opt) < sizeOfInt32 {
+				return syserr.ErrInvalidArgument
+			}
+			group := usermem.ByteOrder.Uint32(opt)
+			if group == 0 || group > 32 || m.Groups()&(1<<(group-1)) == 0 {
+				return syserr.ErrInvalidArgument
+			}
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			groups := s.groups
+			if name == linux.NETLINK_ADD_MEMBERSHIP {
+				groups |= 1 << (group - 1)
+			} else {
+				groups &^= 1 << (group - 1)
+			}
+			return s.setGroups(t, groups)
+
+		case linux.NETLINK_BROADCAST_ERROR,
 			linux.NETLINK_CAP_ACK,
-			linux.NETLINK_DROP_MEMBERSHIP,
 			linux.NETLINK_DUMP_STRICT_CHK,
 			linux.NETLINK_EXT_ACK,
 			linux.NETLINK_LISTEN_ALL_NSID,
@@ -380,6 +453,7 @@ func (s *Socket) GetSockName(t *kernel.Task) (interface{}, uint32, *syserr.Error
 	sa := linux.SockAddrNetlink{
 		Family: linux.AF_NETLINK,
 		PortID: uint32(s.portID),
+		Groups: s.groups,
 	}
 	return sa, uint32(binary.Size(sa)), nil
 }
@@ -403,6 +477,12 @@ func (s *Socket) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, have
 	}
 	fromLen := uint32(binary.Size(from))
 
+	// All messages are sent by the kernel.
+	var cms socket.ControlMessages
+	if s.Passcred() {
+		cms.Unix.Credentials = control.NewHostSCMCredentials(linux.ControlMessageCredentials{})
+	}
+
 	trunc := flags&linux.MSG_TRUNC != 0
 
 	r := unix.EndpointReader{
@@ -414,7 +494,7 @@ func (s *Socket) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, have
 		if trunc {
 			n = int64(r.MsgSize)
 		}
-		return int(n), from, fromLen, socket.ControlMessages{}, syserr.FromError(err)
+		return int(n), from, fromLen, cms, syserr.FromError(err)
 	}
 
 	// We'll have to block. Register for notification and keep trying to
@@ -428,7 +508,7 @@ func (s *Socket) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, have
 			if trunc {
 				n = int64(r.MsgSize)
 			}
-			return int(n), from, fromLen, socket.ControlMessages{}, syserr.FromError(err)
+			return int(n), from, fromLen, cms, syserr.FromError(err)
 		}
 
 		if err := t.BlockWithDeadline(ch, haveDeadline, deadline); err != nil {
@@ -440,6 +520,19 @@ func (s *Socket) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, have
 	}
 }
 
+// Passcred implements transport.Credentialer.Passcred.
+func (s *Socket) Passcred() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.passcred
+}
+
+// ConnectedPasscred implements transport.Credentialer.ConnectedPasscred.
+func (s *Socket) ConnectedPasscred() bool {
+	// The kernel doesn't receive credentials.
+	return false
+}
+
 // Read implements fs.FileOperations.Read.
 func (s *Socket) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, _ int64) (int64, error) {
 	if dst.NumBytes() == 0 {
@@ -497,6 +590,41 @@ func (s *Socket) sendResponse(ctx context.Context, ms *MessageSet) *syserr.Error
 	return nil
 }
 
+// deliver sends each of dgrams to userspace as a datagram.
+func (s *Socket) deliver(dgrams [][]byte) *syserr.Error {
+	for _, d := range dgrams {
+		_, notify, err := s.connection.Send([][]byte{d}, transport.ControlMessages{}, tcpip.FullAddress{})
+		// If the buffer is full, we simply drop messages, just like
+		// Linux.
+		if err != nil && err != syserr.ErrWouldBlock {
+			return err
+		}
+		if notify {
+			s.connection.SendNotify()
+		}
+	}
+	return nil
+}
+
+// sendAck sends an NLMSG_ERROR message acknowledging the message with header
+// hdr, with the error err, or nil on success.
+func (s *Socket) sendAck(ctx context.Context, hdr linux.NetlinkMessageHeader, err *syserr.Error) *syserr.Error {
+	var errno int32
+	if err != nil {
+		errno = -int32(err.ToLinux().Number())
+	}
+
+	ms := NewMessageSet(s.portID, hdr.Seq)
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: linux.NLMSG_ERROR,
+	})
+	m.Put(linux.NetlinkErrorMessage{
+		Error:  errno,
+		Header: hdr,
+	})
+	return s.sendResponse(ctx, ms)
+}
+
 // processMessages handles each message in buf, passing it to the protocol
 // handler for final handling.
 func (s *Socket) processMessages(ctx context.Context, buf []byte) *syserr.Error {
@@ -531,18 +659,25 @@ func (s *Socket) processMessages(ctx context.Context, buf []byte) *syserr.Error
 			continue
 		}
 
-		// TODO: ACKs not supported yet.
-		if hdr.Flags&linux.NLM_F_ACK == linux.NLM_F_ACK {
-			return syserr.ErrNotSupported
+		ms := NewMessageSet(s.portID, hdr.Seq)
+		perr := s.protocol.ProcessMessage(ctx, hdr, data, ms)
+		ack := hdr.Flags&linux.NLM_F_ACK == linux.NLM_F_ACK
+		if perr != nil && !ack {
+			return perr
 		}
 
-		ms := NewMessageSet(s.portID, hdr.Seq)
-		if err := s.protocol.ProcessMessage(ctx, hdr, data, ms); err != nil {
-			return err
+		if perr == nil {
+			if err := s.sendResponse(ctx, ms); err != nil {
+				return err
+			}
 		}
 
-		if err := s.sendResponse(ctx, ms); err != nil {
-			return err
+		// Errors of messages to acknowledge are reported in the
+		// acknowledgement, as Linux does.
+		if ack {
+			if err := s.sendAck(ctx, hdr, perr); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -559,7 +694,7 @@ func (s *Socket) sendMsg(ctx context.Context, src usermem.IOSequence, to []byte,
 			return 0, err
 		}
 
-		// No support for multicast groups yet.
+		// No support for sending to multicast groups yet.
 		if a.Groups != 0 {
 			return 0, syserr.ErrPermissionDenied
 		}
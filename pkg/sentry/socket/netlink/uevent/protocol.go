@@ -0,0 +1,107 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package uevent provides a NETLINK_KOBJECT_UEVENT socket protocol.
+//
+// The devices of the sentry never come or go, so the kernel never sends
+// uevents of its own accord. Instead, a socket joining the kernel's multicast
+// group receives an "add" event for each device in sysfs, as udev would
+// otherwise trigger by writing to the uevent files of the devices at
+// coldplug.
+package uevent
+
+import (
+	"bytes"
+	"fmt"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/sys"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.googlesource.com/gvisor/pkg/syserr"
+)
+
+// kernelGroup is the multicast group of events sent by the kernel. Group 2 is
+// used by udev to forward events to its clients.
+const kernelGroup = 1
+
+// Protocol implements netlink.Protocol and netlink.Multicaster.
+//
+// +stateify savable
+type Protocol struct {
+	// seqnum is the SEQNUM of the last event sent to the socket.
+	seqnum uint64
+}
+
+var _ netlink.Protocol = (*Protocol)(nil)
+var _ netlink.Multicaster = (*Protocol)(nil)
+
+// NewProtocol creates a NETLINK_KOBJECT_UEVENT netlink.Protocol.
+func NewProtocol(t *kernel.Task) (netlink.Protocol, *syserr.Error) {
+	return &Protocol{}, nil
+}
+
+// Protocol implements netlink.Protocol.Protocol.
+func (p *Protocol) Protocol() int {
+	return linux.NETLINK_KOBJECT_UEVENT
+}
+
+// ProcessMessage implements netlink.Protocol.ProcessMessage.
+func (p *Protocol) ProcessMessage(ctx context.Context, hdr linux.NetlinkMessageHeader, data []byte, ms *netlink.MessageSet) *syserr.Error {
+	// Events can't be injected from userspace.
+	return syserr.ErrNotSupported
+}
+
+// Groups implements netlink.Multicaster.Groups.
+func (p *Protocol) Groups() uint32 {
+	// Like Linux, allow all 32 groups, though only the kernel's group
+	// receives messages.
+	return ^uint32(0)
+}
+
+// JoinGroups implements netlink.Multicaster.JoinGroups.
+func (p *Protocol) JoinGroups(ctx context.Context, groups uint32) [][]byte {
+	if groups&(1<<(kernelGroup-1)) == 0 {
+		return nil
+	}
+	var dgrams [][]byte
+	for _, d := range sys.Devices(ctx) {
+		dgrams = append(dgrams, p.event("add", d))
+	}
+	return dgrams
+}
+
+// event returns the datagram of the uevent for action on the device d. See
+// Linux's lib/kobject_uevent.c:kobject_uevent_env.
+func (p *Protocol) event(action string, d sys.Device) []byte {
+	p.seqnum++
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s@%s\x00", action, d.Path)
+	fmt.Fprintf(&buf, "ACTION=%s\x00", action)
+	fmt.Fprintf(&buf, "DEVPATH=%s\x00", d.Path)
+	fmt.Fprintf(&buf, "SUBSYSTEM=%s\x00", d.Subsystem)
+	for _, env := range d.Env {
+		buf.WriteString(env)
+		buf.WriteByte(0)
+	}
+	fmt.Fprintf(&buf, "SEQNUM=%d\x00", p.seqnum)
+	return buf.Bytes()
+}
+
+// init registers the NETLINK_KOBJECT_UEVENT provider.
+func init() {
+	netlink.RegisterProvider(linux.NETLINK_KOBJECT_UEVENT, NewProtocol)
+}
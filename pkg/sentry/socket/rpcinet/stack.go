@@ -23,6 +23,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/rpcinet/conn"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/rpcinet/notifier"
 	"gvisor.googlesource.com/gvisor/pkg/syserr"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
 	"gvisor.googlesource.com/gvisor/pkg/unet"
 )
 
@@ -97,6 +98,11 @@ func (s *Stack) InterfaceAddrs() map[int32][]inet.InterfaceAddr {
 	return s.interfaceAddrs
 }
 
+// InterfaceStatistics implements inet.Stack.InterfaceStatistics.
+func (s *Stack) InterfaceStatistics() map[int32]inet.InterfaceStatistics {
+	return nil
+}
+
 // SupportsIPv6 implements inet.Stack.SupportsIPv6.
 func (s *Stack) SupportsIPv6() bool {
 	panic("rpcinet handles procfs directly this method should not be called")
@@ -133,3 +139,63 @@ func (s *Stack) TCPSACKEnabled() (bool, error) {
 func (s *Stack) SetTCPSACKEnabled(enabled bool) error {
 	panic("rpcinet handles procfs directly this method should not be called")
 }
+
+// QueueingDisciplines implements inet.Stack.QueueingDisciplines.
+func (s *Stack) QueueingDisciplines() map[int32]inet.QueueingDiscipline {
+	return nil
+}
+
+// SetQueueingDiscipline implements inet.Stack.SetQueueingDiscipline.
+func (s *Stack) SetQueueingDiscipline(idx int32, q inet.QueueingDiscipline) error {
+	return syserror.EOPNOTSUPP
+}
+
+// RemoveQueueingDiscipline implements inet.Stack.RemoveQueueingDiscipline.
+func (s *Stack) RemoveQueueingDiscipline(idx int32) error {
+	return syserror.EOPNOTSUPP
+}
+
+// AddInterfaceAddr implements inet.Stack.AddInterfaceAddr.
+func (s *Stack) AddInterfaceAddr(idx int32, addr inet.InterfaceAddr) error {
+	return syserror.EOPNOTSUPP
+}
+
+// NewWireGuardInterface implements inet.Stack.NewWireGuardInterface.
+func (s *Stack) NewWireGuardInterface(name string) (int32, error) {
+	return 0, syserror.EOPNOTSUPP
+}
+
+// WireGuardInterfaces implements inet.Stack.WireGuardInterfaces.
+func (s *Stack) WireGuardInterfaces() map[int32]inet.WireGuardDevice {
+	return nil
+}
+
+// NewTunnelInterface implements inet.Stack.NewTunnelInterface.
+func (s *Stack) NewTunnelInterface(name string, t inet.Tunnel) (int32, error) {
+	return 0, syserror.EOPNOTSUPP
+}
+
+// Tunnels implements inet.Stack.Tunnels.
+func (s *Stack) Tunnels() map[int32]inet.Tunnel {
+	return nil
+}
+
+// SupportsConnTrack implements inet.Stack.SupportsConnTrack.
+func (s *Stack) SupportsConnTrack() bool {
+	return false
+}
+
+// ConnTrack implements inet.Stack.ConnTrack.
+func (s *Stack) ConnTrack() []inet.ConnTrackEntry {
+	return nil
+}
+
+// DeleteConnTrack implements inet.Stack.DeleteConnTrack.
+func (s *Stack) DeleteConnTrack(t inet.ConnTrackTuple) error {
+	return syserror.EOPNOTSUPP
+}
+
+// FlushConnTrack implements inet.Stack.FlushConnTrack.
+func (s *Stack) FlushConnTrack(family uint8) error {
+	return syserror.EOPNOTSUPP
+}
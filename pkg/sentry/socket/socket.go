@@ -65,6 +65,9 @@ type Socket interface {
 	Shutdown(t *kernel.Task, how int) *syserr.Error
 
 	// GetSockOpt implements the getsockopt(2) linux syscall.
+	//
+	// If the value doesn't fit in outLen, GetSockOpt may return it along
+	// with syserr.ErrRange so that its length is reported.
 	GetSockOpt(t *kernel.Task, level int, name int, outLen int) (interface{}, *syserr.Error)
 
 	// SetSockOpt implements the setsockopt(2) linux syscall.
@@ -113,6 +116,65 @@ type Socket interface {
 	SendTimeout() int64
 }
 
+// MMsg is a message received or sent by BatchSocket.RecvMMsg or
+// BatchSocket.SendMMsg.
+type MMsg struct {
+	// Data is the buffer the message is received into, or the data to send.
+	Data usermem.IOSequence
+
+	// To is the destination address of a message to send. If empty, the
+	// message is sent to the connected peer.
+	To []byte
+
+	// SenderRequested is true if the sender address of a message to receive
+	// is requested.
+	SenderRequested bool
+
+	// N is the length of the message received or sent. As for RecvMsg, it
+	// is the full length of a truncated message if MSG_TRUNC is set.
+	N int
+
+	// SenderAddr and SenderAddrLen are the sender address of the message
+	// received, as returned by RecvMsg.
+	SenderAddr    interface{}
+	SenderAddrLen uint32
+
+	// ControlMessages are the control messages of the message received.
+	ControlMessages ControlMessages
+}
+
+// BatchSocket is implemented by sockets that can receive and send several
+// messages at once, amortizing the per-message cost of recvmmsg(2) and
+// sendmmsg(2).
+type BatchSocket interface {
+	Socket
+
+	// RecvMMsg receives up to len(msgs) messages, and returns how many were
+	// received. As RecvMsg, it blocks until a message can be received unless
+	// MSG_DONTWAIT is set, but the messages after it are only received if
+	// they are already available. err is only set if no message was
+	// received.
+	RecvMMsg(t *kernel.Task, msgs []MMsg, flags int, haveDeadline bool, deadline ktime.Time) (n int, err *syserr.Error)
+
+	// SendMMsg sends up to len(msgs) messages, and returns how many were
+	// sent. As SendMsg, it blocks until a message can be sent unless
+	// MSG_DONTWAIT is set, but the messages after it are only sent if that
+	// doesn't require blocking. err is only set if no message was sent.
+	SendMMsg(t *kernel.Task, msgs []MMsg, flags int, haveDeadline bool, deadline ktime.Time) (n int, err *syserr.Error)
+}
+
+// ErrQueueSocket is implemented by sockets with an error queue, which
+// recvmsg(2) reads with MSG_ERRQUEUE.
+type ErrQueueSocket interface {
+	Socket
+
+	// RecvErrQueue dequeues the oldest error on the socket's error queue.
+	// The error is returned as a control message, along with the data and
+	// destination of the packet that caused it. RecvErrQueue doesn't
+	// block, and returns ErrTryAgain if the queue is empty.
+	RecvErrQueue(t *kernel.Task, dst usermem.IOSequence, senderRequested bool) (n int, senderAddr interface{}, senderAddrLen uint32, controlMessages ControlMessages, err *syserr.Error)
+}
+
 // Provider is the interface implemented by providers of sockets for specific
 // address families (e.g., AF_INET).
 type Provider interface {
@@ -251,8 +313,6 @@ func GetSockOptEmitUnimplementedEvent(t *kernel.Task, name int) {
 		linux.SO_GET_FILTER,
 		linux.SO_INCOMING_NAPI_ID,
 		linux.SO_MEMINFO,
-		linux.SO_PEERCRED,
-		linux.SO_PEERGROUPS,
 		linux.SO_PEERNAME,
 		linux.SO_PEERSEC,
 		linux.SO_PROTOCOL,
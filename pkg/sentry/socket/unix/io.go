@@ -36,6 +36,9 @@ type EndpointWriter struct {
 
 // WriteFromBlocks implements safemem.Writer.WriteFromBlocks.
 func (w *EndpointWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64, error) {
+	if n, ok, err := w.Endpoint.SendMsgBlocks(srcs, w.Control, w.To); ok {
+		return n, err
+	}
 	return safemem.FromVecWriterFunc{func(bufs [][]byte) (int64, error) {
 		n, err := w.Endpoint.SendMsg(bufs, w.Control, w.To)
 		if err != nil {
@@ -76,6 +79,11 @@ type EndpointReader struct {
 
 // ReadToBlocks implements safemem.Reader.ReadToBlocks.
 func (r *EndpointReader) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error) {
+	if n, ms, c, ok, err := r.Endpoint.RecvMsgBlocks(dsts, r.Creds, r.NumRights, r.Peek, r.From); ok {
+		r.Control = c
+		r.MsgSize = ms
+		return n, err
+	}
 	return safemem.FromVecReaderFunc{func(bufs [][]byte) (int64, error) {
 		n, ms, c, err := r.Endpoint.RecvMsg(bufs, r.Creds, r.NumRights, r.Peek, r.From)
 		r.Control = c
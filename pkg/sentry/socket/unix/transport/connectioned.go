@@ -108,6 +108,12 @@ type connectionedEndpoint struct {
 	//
 	// If nil, then no listen call has been made.
 	acceptedChan chan *connectionedEndpoint `state:".([]*connectionedEndpoint)"`
+
+	// peerCreds are the credentials of the peer, which are captured when
+	// the endpoint is created by socketpair(2), connected or accepted. The
+	// peer of a listening endpoint is itself. peerCreds is protected by
+	// baseEndpoint.Mutex.
+	peerCreds PeerCredentials
 }
 
 // NewConnectioned creates a new unbound connectionedEndpoint.
@@ -121,18 +127,22 @@ func NewConnectioned(stype SockType, uid UniqueIDProvider) Endpoint {
 }
 
 // NewPair allocates a new pair of connected unix-domain connectionedEndpoints.
-func NewPair(stype SockType, uid UniqueIDProvider) (Endpoint, Endpoint) {
+// creds are the credentials of the creating process, which both endpoints
+// report as their peer's.
+func NewPair(stype SockType, uid UniqueIDProvider, creds PeerCredentials) (Endpoint, Endpoint) {
 	a := &connectionedEndpoint{
 		baseEndpoint: baseEndpoint{Queue: &waiter.Queue{}},
 		id:           uid.UniqueID(),
 		idGenerator:  uid,
 		stype:        stype,
+		peerCreds:    creds,
 	}
 	b := &connectionedEndpoint{
 		baseEndpoint: baseEndpoint{Queue: &waiter.Queue{}},
 		id:           uid.UniqueID(),
 		idGenerator:  uid,
 		stype:        stype,
+		peerCreds:    creds,
 	}
 
 	q1 := &queue{ReaderQueue: a.Queue, WriterQueue: b.Queue, limit: initialLimit}
@@ -161,13 +171,14 @@ func NewPair(stype SockType, uid UniqueIDProvider) (Endpoint, Endpoint) {
 }
 
 // NewExternal creates a new externally backed Endpoint. It behaves like a
-// socketpair.
-func NewExternal(stype SockType, uid UniqueIDProvider, queue *waiter.Queue, receiver Receiver, connected ConnectedEndpoint) Endpoint {
+// socketpair. peerCreds are the credentials of the external peer, if known.
+func NewExternal(stype SockType, uid UniqueIDProvider, queue *waiter.Queue, receiver Receiver, connected ConnectedEndpoint, peerCreds PeerCredentials) Endpoint {
 	return &connectionedEndpoint{
 		baseEndpoint: baseEndpoint{Queue: queue, receiver: receiver, connected: connected},
 		id:           uid.UniqueID(),
 		idGenerator:  uid,
 		stype:        stype,
+		peerCreds:    peerCreds,
 	}
 }
 
@@ -237,7 +248,7 @@ func (e *connectionedEndpoint) Close() {
 }
 
 // BidirectionalConnect implements BoundEndpoint.BidirectionalConnect.
-func (e *connectionedEndpoint) BidirectionalConnect(ce ConnectingEndpoint, returnConnect func(Receiver, ConnectedEndpoint)) *syserr.Error {
+func (e *connectionedEndpoint) BidirectionalConnect(ce ConnectingEndpoint, creds PeerCredentials, returnConnect func(Receiver, ConnectedEndpoint, PeerCredentials)) *syserr.Error {
 	if ce.Type() != e.stype {
 		return syserr.ErrConnectionRefused
 	}
@@ -284,6 +295,7 @@ func (e *connectionedEndpoint) BidirectionalConnect(ce ConnectingEndpoint, retur
 		id:          e.idGenerator.UniqueID(),
 		idGenerator: e.idGenerator,
 		stype:       e.stype,
+		peerCreds:   creds,
 	}
 
 	readQueue := &queue{ReaderQueue: ce.WaiterQueue(), WriterQueue: ne.Queue, limit: initialLimit}
@@ -309,9 +321,9 @@ func (e *connectionedEndpoint) BidirectionalConnect(ce ConnectingEndpoint, retur
 		}
 		readQueue.IncRef()
 		if e.stype == SockStream {
-			returnConnect(&streamQueueReceiver{queueReceiver: queueReceiver{readQueue: readQueue}}, connected)
+			returnConnect(&streamQueueReceiver{queueReceiver: queueReceiver{readQueue: readQueue}}, connected, e.peerCreds)
 		} else {
-			returnConnect(&queueReceiver{readQueue: readQueue}, connected)
+			returnConnect(&queueReceiver{readQueue: readQueue}, connected, e.peerCreds)
 		}
 
 		// Notify can deadlock if we are holding these locks.
@@ -339,17 +351,18 @@ func (e *connectionedEndpoint) UnidirectionalConnect() (ConnectedEndpoint, *syse
 
 // Connect attempts to directly connect to another Endpoint.
 // Implements Endpoint.Connect.
-func (e *connectionedEndpoint) Connect(server BoundEndpoint) *syserr.Error {
-	returnConnect := func(r Receiver, ce ConnectedEndpoint) {
+func (e *connectionedEndpoint) Connect(server BoundEndpoint, creds PeerCredentials) *syserr.Error {
+	returnConnect := func(r Receiver, ce ConnectedEndpoint, peerCreds PeerCredentials) {
 		e.receiver = r
 		e.connected = ce
+		e.peerCreds = peerCreds
 	}
 
-	return server.BidirectionalConnect(e, returnConnect)
+	return server.BidirectionalConnect(e, creds, returnConnect)
 }
 
 // Listen starts listening on the connection.
-func (e *connectionedEndpoint) Listen(backlog int) *syserr.Error {
+func (e *connectionedEndpoint) Listen(backlog int, creds PeerCredentials) *syserr.Error {
 	e.Lock()
 	defer e.Unlock()
 	if e.Listening() {
@@ -364,6 +377,7 @@ func (e *connectionedEndpoint) Listen(backlog int) *syserr.Error {
 		for ep := range origChan {
 			e.acceptedChan <- ep
 		}
+		e.peerCreds = creds
 		return nil
 	}
 	if !e.isBound() {
@@ -372,9 +386,17 @@ func (e *connectionedEndpoint) Listen(backlog int) *syserr.Error {
 
 	// Normal case.
 	e.acceptedChan = make(chan *connectionedEndpoint, backlog)
+	e.peerCreds = creds
 	return nil
 }
 
+// PeerCredentials implements Endpoint.PeerCredentials.
+func (e *connectionedEndpoint) PeerCredentials() PeerCredentials {
+	e.Lock()
+	defer e.Unlock()
+	return e.peerCreds
+}
+
 // Accept accepts a new connection.
 func (e *connectionedEndpoint) Accept() (Endpoint, *syserr.Error) {
 	e.Lock()
@@ -458,3 +480,17 @@ func (e *connectionedEndpoint) Readiness(mask waiter.EventMask) waiter.EventMask
 
 	return ready
 }
+
+// GetSockOpt implements tcpip.Endpoint.GetSockOpt.
+func (e *connectionedEndpoint) GetSockOpt(opt interface{}) *tcpip.Error {
+	if _, ok := opt.(*tcpip.ReceiveQueueSizeOption); ok {
+		// Like Linux, listening sockets have no receive queue.
+		e.Lock()
+		listening := e.Listening()
+		e.Unlock()
+		if listening {
+			return tcpip.ErrInvalidEndpointState
+		}
+	}
+	return e.baseEndpoint.GetSockOpt(opt)
+}
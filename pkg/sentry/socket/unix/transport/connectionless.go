@@ -71,7 +71,7 @@ func (e *connectionlessEndpoint) Close() {
 }
 
 // BidirectionalConnect implements BoundEndpoint.BidirectionalConnect.
-func (e *connectionlessEndpoint) BidirectionalConnect(ce ConnectingEndpoint, returnConnect func(Receiver, ConnectedEndpoint)) *syserr.Error {
+func (e *connectionlessEndpoint) BidirectionalConnect(ce ConnectingEndpoint, creds PeerCredentials, returnConnect func(Receiver, ConnectedEndpoint, PeerCredentials)) *syserr.Error {
 	return syserr.ErrConnectionRefused
 }
 
@@ -123,7 +123,9 @@ func (e *connectionlessEndpoint) Type() SockType {
 }
 
 // Connect attempts to connect directly to server.
-func (e *connectionlessEndpoint) Connect(server BoundEndpoint) *syserr.Error {
+//
+// As in Linux, connecting datagram sockets doesn't exchange credentials.
+func (e *connectionlessEndpoint) Connect(server BoundEndpoint, _ PeerCredentials) *syserr.Error {
 	connected, err := server.UnidirectionalConnect()
 	if err != nil {
 		return err
@@ -137,10 +139,15 @@ func (e *connectionlessEndpoint) Connect(server BoundEndpoint) *syserr.Error {
 }
 
 // Listen starts listening on the connection.
-func (e *connectionlessEndpoint) Listen(int) *syserr.Error {
+func (e *connectionlessEndpoint) Listen(int, PeerCredentials) *syserr.Error {
 	return syserr.ErrNotSupported
 }
 
+// PeerCredentials implements Endpoint.PeerCredentials.
+func (e *connectionlessEndpoint) PeerCredentials() PeerCredentials {
+	return nil
+}
+
 // Accept accepts a new connection.
 func (e *connectionlessEndpoint) Accept() (Endpoint, *syserr.Error) {
 	return nil, syserr.ErrNotSupported
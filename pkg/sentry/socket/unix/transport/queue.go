@@ -18,10 +18,20 @@ import (
 	"sync"
 
 	"gvisor.googlesource.com/gvisor/pkg/refs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/safemem"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
 	"gvisor.googlesource.com/gvisor/pkg/syserr"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
 	"gvisor.googlesource.com/gvisor/pkg/waiter"
 )
 
+// chunkSize is the maximum size of the buffers that EnqueueBlocks copies data
+// into. Receivers consume these buffers by reference, so they are
+// page-sized, like the page fragments of a Linux sk_buff; this bounds both
+// the size of each allocation and the memory wasted by partial reads.
+const chunkSize = usermem.PageSize
+
 // queue is a buffer queue.
 //
 // +stateify savable
@@ -150,6 +160,64 @@ func (q *queue) Enqueue(e *message, truncate bool) (l int64, notify bool, err *s
 	return l, notify, err
 }
 
+// EnqueueBlocks copies as much of srcs as fits into a new message, which is
+// added to the data queue. This is equivalent to Enqueue with truncate set,
+// except that data is copied directly from srcs into page-sized buffers rather
+// than into an intermediate buffer, and err may be an error returned by
+// copying from srcs.
+//
+// If notify is true, ReaderQueue.Notify must be called:
+// q.ReaderQueue.Notify(waiter.EventIn)
+func (q *queue) EnqueueBlocks(srcs safemem.BlockSeq, control ControlMessages, from tcpip.FullAddress) (l uint64, notify bool, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return 0, false, syserr.ErrClosedForSend.ToError()
+	}
+
+	free := uint64(q.limit - q.used)
+	if free == 0 {
+		// Message can't fit right now.
+		return 0, false, syserr.ErrWouldBlock.ToError()
+	}
+
+	// Copy while holding q.mu, so that the queue can't be filled
+	// concurrently.
+	var views []buffer.View
+	for !srcs.IsEmpty() && l < free {
+		size := srcs.NumBytes()
+		if size > free-l {
+			size = free - l
+		}
+		if size > chunkSize {
+			size = chunkSize
+		}
+		v := buffer.NewView(int(size))
+		n, cerr := safemem.CopySeq(safemem.BlockSeqOf(safemem.BlockFromSafeSlice(v)), srcs)
+		if n != 0 {
+			views = append(views, v[:n])
+			l += n
+			srcs = srcs.DropFirst64(n)
+		}
+		if cerr != nil {
+			err = cerr
+			break
+		}
+	}
+	if l == 0 {
+		return 0, false, err
+	}
+	if err == nil && !srcs.IsEmpty() {
+		err = syserr.ErrWouldBlock.ToError()
+	}
+
+	notify = q.dataList.Front() == nil
+	q.used += int64(l)
+	q.dataList.PushBack(&message{Data: buffer.NewVectorisedView(int(l), views), Control: control, Address: from})
+	return l, notify, err
+}
+
 // Dequeue removes the first entry in the data queue, if one exists.
 //
 // If notify is true, WriterQueue.Notify must be called:
@@ -19,6 +19,7 @@ import (
 	"sync"
 	"sync/atomic"
 
+	"gvisor.googlesource.com/gvisor/pkg/sentry/safemem"
 	"gvisor.googlesource.com/gvisor/pkg/syserr"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
@@ -58,6 +59,13 @@ type CredentialsControlMessage interface {
 	Equals(CredentialsControlMessage) bool
 }
 
+// PeerCredentials are the credentials of the process that created, connected
+// or listened on an endpoint, which are reported to the endpoint's peer by the
+// SO_PEERCRED and SO_PEERGROUPS socket options. Like
+// CredentialsControlMessage, they are opaque to transport; see
+// control.NewPeerCredentials.
+type PeerCredentials interface{}
+
 // A ControlMessages represents a collection of socket control messages.
 //
 // +stateify savable
@@ -138,13 +146,29 @@ type Endpoint interface {
 	// SendMsg does not take ownership of any of its arguments on error.
 	SendMsg([][]byte, ControlMessages, BoundEndpoint) (uintptr, *syserr.Error)
 
+	// RecvMsgBlocks is equivalent to RecvMsg, except that data is copied
+	// directly to dsts, and err may be an error returned by copying to
+	// dsts. If the endpoint can't receive data this way, ok is false and
+	// nothing is received, in which case RecvMsg must be used instead.
+	RecvMsgBlocks(dsts safemem.BlockSeq, creds bool, numRights uintptr, peek bool, addr *tcpip.FullAddress) (recvLen uint64, msgLen uintptr, cm ControlMessages, ok bool, err error)
+
+	// SendMsgBlocks is equivalent to SendMsg, except that data is copied
+	// directly from srcs into buffers that are passed to the receiving
+	// endpoint by reference, and err may be an error returned by copying
+	// from srcs. If the endpoint can't send data this way, ok is false and
+	// nothing is sent, in which case SendMsg must be used instead.
+	SendMsgBlocks(srcs safemem.BlockSeq, c ControlMessages, to BoundEndpoint) (n uint64, ok bool, err error)
+
 	// Connect connects this endpoint directly to another.
 	//
 	// This should be called on the client endpoint, and the (bound)
 	// endpoint passed in as a parameter.
 	//
+	// creds are the credentials of the connecting process, which become the
+	// peer credentials of the server's end of the connection.
+	//
 	// The error codes are the same as Connect.
-	Connect(server BoundEndpoint) *syserr.Error
+	Connect(server BoundEndpoint, creds PeerCredentials) *syserr.Error
 
 	// Shutdown closes the read and/or write end of the endpoint connection
 	// to its peer.
@@ -152,7 +176,10 @@ type Endpoint interface {
 
 	// Listen puts the endpoint in "listen" mode, which allows it to accept
 	// new connections.
-	Listen(backlog int) *syserr.Error
+	//
+	// creds are the credentials of the listening process, which become the
+	// peer credentials of the endpoints that connect to it.
+	Listen(backlog int, creds PeerCredentials) *syserr.Error
 
 	// Accept returns a new endpoint if a peer has established a connection
 	// to an endpoint previously set to listen mode. This method does not
@@ -180,6 +207,10 @@ type Endpoint interface {
 	// connected.
 	GetRemoteAddress() (tcpip.FullAddress, *tcpip.Error)
 
+	// Peer returns the endpoint to which the endpoint is connected, or nil
+	// if it isn't connected.
+	Peer() Endpoint
+
 	// SetSockOpt sets a socket option. opt should be one of the tcpip.*Option
 	// types.
 	SetSockOpt(opt interface{}) *tcpip.Error
@@ -187,6 +218,10 @@ type Endpoint interface {
 	// GetSockOpt gets a socket option. opt should be a pointer to one of the
 	// tcpip.*Option types.
 	GetSockOpt(opt interface{}) *tcpip.Error
+
+	// PeerCredentials returns the credentials of the endpoint's peer, or nil
+	// if it has none.
+	PeerCredentials() PeerCredentials
 }
 
 // A Credentialer is a socket or endpoint that supports the SO_PASSCRED socket
@@ -210,10 +245,10 @@ type BoundEndpoint interface {
 	// In order for an endpoint to establish such a bidirectional connection
 	// with a BoundEndpoint, the endpoint calls the BidirectionalConnect method
 	// on the BoundEndpoint and sends a representation of itself (the
-	// ConnectingEndpoint) and a callback (returnConnect) to receive the
-	// connection information (Receiver and ConnectedEndpoint) upon a
-	// successful connect. The callback should only be called on a successful
-	// connect.
+	// ConnectingEndpoint) along with its credentials, and a callback
+	// (returnConnect) to receive the connection information (Receiver,
+	// ConnectedEndpoint and the credentials of the peer) upon a successful
+	// connect. The callback should only be called on a successful connect.
 	//
 	// For a connection attempt to be successful, the ConnectingEndpoint must
 	// be unconnected and not listening and the BoundEndpoint whose
@@ -221,7 +256,7 @@ type BoundEndpoint interface {
 	//
 	// This method will return syserr.ErrConnectionRefused on endpoints with a
 	// type that isn't SockStream or SockSeqpacket.
-	BidirectionalConnect(ep ConnectingEndpoint, returnConnect func(Receiver, ConnectedEndpoint)) *syserr.Error
+	BidirectionalConnect(ep ConnectingEndpoint, creds PeerCredentials, returnConnect func(Receiver, ConnectedEndpoint, PeerCredentials)) *syserr.Error
 
 	// UnidirectionalConnect establishes a write-only connection to a unix
 	// endpoint.
@@ -246,7 +281,7 @@ type message struct {
 	messageEntry
 
 	// Data is the Message payload.
-	Data buffer.View
+	Data buffer.VectorisedView
 
 	// Control is auxiliary control message data that goes along with the
 	// data.
@@ -261,7 +296,7 @@ type message struct {
 
 // Length returns number of bytes stored in the message.
 func (m *message) Length() int64 {
-	return int64(len(m.Data))
+	return int64(m.Data.Size())
 }
 
 // Release releases any resources held by the message.
@@ -271,7 +306,7 @@ func (m *message) Release() {
 
 // Peek returns a copy of the message.
 func (m *message) Peek() *message {
-	return &message{Data: m.Data, Control: m.Control.Clone(), Address: m.Address}
+	return &message{Data: m.Data.Clone(nil), Control: m.Control.Clone(), Address: m.Address}
 }
 
 // Truncate reduces the length of the message payload to n bytes.
@@ -340,14 +375,86 @@ func (q *queueReceiver) Recv(data [][]byte, creds bool, numRights uintptr, peek
 	if err != nil {
 		return 0, 0, ControlMessages{}, tcpip.FullAddress{}, false, err
 	}
-	src := []byte(m.Data)
+	copied := (&sliceDst{data: data}).copyFrom(m.Data)
+	return copied, uintptr(m.Data.Size()), m.Control, m.Address, notify, nil
+}
+
+// recvDst is a destination for data received by a Receiver.
+type recvDst interface {
+	// copyFrom copies as much of vv as possible to the destination,
+	// advances the destination past the copied data, and returns the number
+	// of bytes copied.
+	copyFrom(vv buffer.VectorisedView) uintptr
+
+	// full returns true if no more data can be copied to the destination.
+	full() bool
+}
+
+// sliceDst is a recvDst that copies to a [][]byte.
+type sliceDst struct {
+	data [][]byte
+
+	// off is the offset into data[0] at which the next copy starts. The
+	// slices in data are not modified, since callers may reuse them.
+	off int
+}
+
+// copyFrom implements recvDst.copyFrom.
+func (d *sliceDst) copyFrom(vv buffer.VectorisedView) uintptr {
 	var copied uintptr
-	for i := 0; i < len(data) && len(src) > 0; i++ {
-		n := copy(data[i], src)
-		copied += uintptr(n)
-		src = src[n:]
+	for _, v := range vv.Views() {
+		for len(v) > 0 && len(d.data) > 0 {
+			n := copy(d.data[0][d.off:], v)
+			copied += uintptr(n)
+			v = v[n:]
+			d.off += n
+			if d.off == len(d.data[0]) {
+				d.data = d.data[1:]
+				d.off = 0
+			}
+		}
 	}
-	return copied, uintptr(len(m.Data)), m.Control, m.Address, notify, nil
+	return copied
+}
+
+// full implements recvDst.full.
+func (d *sliceDst) full() bool {
+	return len(d.data) == 0
+}
+
+// blockDst is a recvDst that copies to a safemem.BlockSeq.
+type blockDst struct {
+	dsts safemem.BlockSeq
+
+	// err is the error returned by the copy that failed, if any. Once a
+	// copy fails, the destination is full.
+	err error
+}
+
+// copyFrom implements recvDst.copyFrom.
+func (d *blockDst) copyFrom(vv buffer.VectorisedView) uintptr {
+	var copied uint64
+	for _, v := range vv.Views() {
+		if d.dsts.IsEmpty() {
+			break
+		}
+		if len(v) == 0 {
+			continue
+		}
+		n, err := safemem.CopySeq(d.dsts, safemem.BlockSeqOf(safemem.BlockFromSafeSlice(v)))
+		copied += n
+		d.dsts = d.dsts.DropFirst64(n)
+		if err != nil {
+			d.err = err
+			d.dsts = safemem.BlockSeq{}
+		}
+	}
+	return uintptr(copied)
+}
+
+// full implements recvDst.full.
+func (d *blockDst) full() bool {
+	return d.dsts.IsEmpty()
 }
 
 // RecvNotify implements Receiver.RecvNotify.
@@ -392,30 +499,19 @@ func (q *queueReceiver) Release() {
 type streamQueueReceiver struct {
 	queueReceiver
 
-	mu      sync.Mutex `state:"nosave"`
-	buffer  []byte
+	mu sync.Mutex `state:"nosave"`
+
+	// buffer is the unread remainder of the last dequeued message. It
+	// refers to the message's data rather than a copy of it.
+	buffer  buffer.VectorisedView
 	control ControlMessages
 	addr    tcpip.FullAddress
 }
 
-func vecCopy(data [][]byte, buf []byte) (uintptr, [][]byte, []byte) {
-	var copied uintptr
-	for len(data) > 0 && len(buf) > 0 {
-		n := copy(data[0], buf)
-		copied += uintptr(n)
-		buf = buf[n:]
-		data[0] = data[0][n:]
-		if len(data[0]) == 0 {
-			data = data[1:]
-		}
-	}
-	return copied, data, buf
-}
-
 // Readable implements Receiver.Readable.
 func (q *streamQueueReceiver) Readable() bool {
 	q.mu.Lock()
-	bl := len(q.buffer)
+	bl := q.buffer.Size()
 	r := q.readQueue.IsReadable()
 	q.mu.Unlock()
 	// We're readable if we have data in our buffer or if the queue receiver is
@@ -426,7 +522,7 @@ func (q *streamQueueReceiver) Readable() bool {
 // RecvQueuedSize implements Receiver.RecvQueuedSize.
 func (q *streamQueueReceiver) RecvQueuedSize() int64 {
 	q.mu.Lock()
-	bl := len(q.buffer)
+	bl := q.buffer.Size()
 	qs := q.readQueue.QueuedSize()
 	q.mu.Unlock()
 	return int64(bl) + qs
@@ -441,13 +537,18 @@ func (q *streamQueueReceiver) RecvMaxQueueSize() int64 {
 
 // Recv implements Receiver.Recv.
 func (q *streamQueueReceiver) Recv(data [][]byte, wantCreds bool, numRights uintptr, peek bool) (uintptr, uintptr, ControlMessages, tcpip.FullAddress, bool, *syserr.Error) {
+	return q.recv(&sliceDst{data: data}, wantCreds, numRights, peek)
+}
+
+// recv implements Recv, copying received data to dst.
+func (q *streamQueueReceiver) recv(dst recvDst, wantCreds bool, numRights uintptr, peek bool) (uintptr, uintptr, ControlMessages, tcpip.FullAddress, bool, *syserr.Error) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
 	var notify bool
 
 	// If we have no data in the endpoint, we need to get some.
-	if len(q.buffer) == 0 {
+	if q.buffer.Size() == 0 {
 		// Load the next message into a buffer, even if we are peeking. Peeking
 		// won't consume the message, so it will be still available to be read
 		// the next time Recv() is called.
@@ -456,24 +557,24 @@ func (q *streamQueueReceiver) Recv(data [][]byte, wantCreds bool, numRights uint
 			return 0, 0, ControlMessages{}, tcpip.FullAddress{}, false, err
 		}
 		notify = n
-		q.buffer = []byte(m.Data)
+		q.buffer = m.Data
 		q.control = m.Control
 		q.addr = m.Address
 	}
 
-	var copied uintptr
 	if peek {
 		// Don't consume control message if we are peeking.
 		c := q.control.Clone()
 
 		// Don't consume data since we are peeking.
-		copied, data, _ = vecCopy(data, q.buffer)
+		copied := dst.copyFrom(q.buffer)
 
 		return copied, copied, c, q.addr, notify, nil
 	}
 
 	// Consume data and control message since we are not peeking.
-	copied, data, q.buffer = vecCopy(data, q.buffer)
+	copied := dst.copyFrom(q.buffer)
+	q.buffer.TrimFront(int(copied))
 
 	// Save the original state of q.control.
 	c := q.control
@@ -495,7 +596,7 @@ func (q *streamQueueReceiver) Recv(data [][]byte, wantCreds bool, numRights uint
 	// rights.
 	//
 	// Linux never coalesces rights control messages.
-	for !haveRights && len(data) > 0 {
+	for !haveRights && !dst.full() {
 		// Get a message from the readQueue.
 		m, n, err := q.readQueue.Dequeue()
 		if err != nil {
@@ -505,7 +606,7 @@ func (q *streamQueueReceiver) Recv(data [][]byte, wantCreds bool, numRights uint
 			break
 		}
 		notify = notify || n
-		q.buffer = []byte(m.Data)
+		q.buffer = m.Data
 		q.control = m.Control
 		q.addr = m.Address
 
@@ -526,8 +627,8 @@ func (q *streamQueueReceiver) Recv(data [][]byte, wantCreds bool, numRights uint
 			break
 		}
 
-		var cpd uintptr
-		cpd, data, q.buffer = vecCopy(data, q.buffer)
+		cpd := dst.copyFrom(q.buffer)
+		q.buffer.TrimFront(int(cpd))
 		copied += cpd
 
 		if cpd == 0 {
@@ -658,10 +759,24 @@ func (e *connectedEndpoint) Send(data [][]byte, controlMessages ControlMessages,
 		v = append(v, d...)
 	}
 
-	l, notify, err := e.writeQueue.Enqueue(&message{Data: buffer.View(v), Control: controlMessages, Address: from}, truncate)
+	m := &message{Data: buffer.NewVectorisedView(len(v), []buffer.View{v}), Control: controlMessages, Address: from}
+	l, notify, err := e.writeQueue.Enqueue(m, truncate)
 	return uintptr(l), notify, err
 }
 
+// sendBlocks is equivalent to Send, except that data is copied directly from
+// srcs, and err may be an error returned by copying from srcs.
+//
+// Preconditions: e.endpoint.Type() == SockStream.
+func (e *connectedEndpoint) sendBlocks(srcs safemem.BlockSeq, controlMessages ControlMessages, from tcpip.FullAddress) (uint64, bool, error) {
+	// Discard empty stream packets, as in Send.
+	if srcs.NumBytes() == 0 {
+		controlMessages.Release()
+		return 0, false, nil
+	}
+	return e.writeQueue.EnqueueBlocks(srcs, controlMessages, from)
+}
+
 // SendNotify implements ConnectedEndpoint.SendNotify.
 func (e *connectedEndpoint) SendNotify() {
 	e.writeQueue.ReaderQueue.Notify(waiter.EventIn)
@@ -822,6 +937,55 @@ func (e *baseEndpoint) SendMsg(data [][]byte, c ControlMessages, to BoundEndpoin
 	return n, err
 }
 
+// RecvMsgBlocks implements Endpoint.RecvMsgBlocks. Only stream endpoints
+// connected to another endpoint in the sentry support it, since their data is
+// held in page-sized buffers that are handed over by the sender.
+func (e *baseEndpoint) RecvMsgBlocks(dsts safemem.BlockSeq, creds bool, numRights uintptr, peek bool, addr *tcpip.FullAddress) (uint64, uintptr, ControlMessages, bool, error) {
+	e.Lock()
+	r, ok := e.receiver.(*streamQueueReceiver)
+	if !ok {
+		e.Unlock()
+		return 0, 0, ControlMessages{}, false, nil
+	}
+
+	d := blockDst{dsts: dsts}
+	recvLen, msgLen, cms, a, notify, err := r.recv(&d, creds, numRights, peek)
+	e.Unlock()
+	if err != nil {
+		return 0, 0, ControlMessages{}, true, err.ToError()
+	}
+
+	if notify {
+		r.RecvNotify()
+	}
+
+	if addr != nil {
+		*addr = a
+	}
+	return uint64(recvLen), msgLen, cms, true, d.err
+}
+
+// SendMsgBlocks implements Endpoint.SendMsgBlocks. Only stream endpoints
+// connected to another endpoint in the sentry support it.
+func (e *baseEndpoint) SendMsgBlocks(srcs safemem.BlockSeq, c ControlMessages, to BoundEndpoint) (uint64, bool, error) {
+	e.Lock()
+	ce, ok := e.connected.(*connectedEndpoint)
+	if !ok || to != nil || !e.Connected() || ce.endpoint.Type() != SockStream {
+		// SendMsg handles all errors for these cases.
+		e.Unlock()
+		return 0, false, nil
+	}
+
+	n, notify, err := ce.sendBlocks(srcs, c, tcpip.FullAddress{Addr: tcpip.Address(e.path)})
+	e.Unlock()
+
+	if notify {
+		ce.SendNotify()
+	}
+
+	return n, true, err
+}
+
 // SetSockOpt sets a socket option. Currently not supported.
 func (e *baseEndpoint) SetSockOpt(opt interface{}) *tcpip.Error {
 	switch v := opt.(type) {
@@ -841,8 +1005,11 @@ func (e *baseEndpoint) GetSockOpt(opt interface{}) *tcpip.Error {
 	case *tcpip.SendQueueSizeOption:
 		e.Lock()
 		if !e.Connected() {
+			// Like Linux, nothing is queued for sending by an
+			// unconnected socket.
 			e.Unlock()
-			return tcpip.ErrNotConnected
+			*o = 0
+			return nil
 		}
 		qs := tcpip.SendQueueSizeOption(e.connected.SendQueuedSize())
 		e.Unlock()
@@ -854,9 +1021,12 @@ func (e *baseEndpoint) GetSockOpt(opt interface{}) *tcpip.Error {
 
 	case *tcpip.ReceiveQueueSizeOption:
 		e.Lock()
-		if !e.Connected() {
+		if e.receiver == nil {
+			// Nothing can be received before the socket is bound
+			// or connected.
 			e.Unlock()
-			return tcpip.ErrNotConnected
+			*o = 0
+			return nil
 		}
 		qs := tcpip.ReceiveQueueSizeOption(e.receiver.RecvQueuedSize())
 		e.Unlock()
@@ -902,6 +1072,29 @@ func (e *baseEndpoint) GetSockOpt(opt interface{}) *tcpip.Error {
 		*o = qs
 		return nil
 
+	case *tcpip.MemInfoOption:
+		*o = tcpip.MemInfoOption{}
+		e.Lock()
+		if e.receiver != nil {
+			o.RcvQueued = int(e.receiver.RecvQueuedSize())
+			o.RcvBufSize = int(e.receiver.RecvMaxQueueSize())
+		}
+		if e.Connected() {
+			// Data written by a unix socket is held by the peer's
+			// receive queue until read.
+			o.SndAlloc = int(e.connected.SendQueuedSize())
+			o.SndBufSize = int(e.connected.SendMaxQueueSize())
+		}
+		e.Unlock()
+
+		// Sizes are negative if the queue doesn't support them.
+		for _, v := range []*int{&o.RcvQueued, &o.RcvBufSize, &o.SndAlloc, &o.SndBufSize} {
+			if *v < 0 {
+				*v = 0
+			}
+		}
+		return nil
+
 	case *tcpip.KeepaliveEnabledOption:
 		*o = 0
 		return nil
@@ -960,6 +1153,21 @@ func (e *baseEndpoint) GetRemoteAddress() (tcpip.FullAddress, *tcpip.Error) {
 	return tcpip.FullAddress{}, tcpip.ErrNotConnected
 }
 
+// Peer implements Endpoint.Peer.
+func (e *baseEndpoint) Peer() Endpoint {
+	e.Lock()
+	defer e.Unlock()
+	if !e.Connected() {
+		return nil
+	}
+	ce, ok := e.connected.(*connectedEndpoint)
+	if !ok {
+		return nil
+	}
+	peer, _ := ce.endpoint.(Endpoint)
+	return peer
+}
+
 // Release implements BoundEndpoint.Release.
 func (*baseEndpoint) Release() {
 	// Binding a baseEndpoint doesn't take a reference.
@@ -144,13 +144,34 @@ func (s *SocketOperations) Ioctl(ctx context.Context, io usermem.IO, args arch.S
 // GetSockOpt implements the linux syscall getsockopt(2) for sockets backed by
 // a transport.Endpoint.
 func (s *SocketOperations) GetSockOpt(t *kernel.Task, level, name, outLen int) (interface{}, *syserr.Error) {
+	if level == linux.SOL_SOCKET {
+		switch name {
+		case linux.SO_PEERCRED:
+			if outLen < linux.SizeOfControlMessageCredentials {
+				return nil, syserr.ErrInvalidArgument
+			}
+			return control.PeerCredentials(t, s.ep.PeerCredentials()), nil
+
+		case linux.SO_PEERGROUPS:
+			groups, ok := control.PeerGroups(t, s.ep.PeerCredentials())
+			if !ok {
+				return nil, syserr.ErrNoDataAvailable
+			}
+			// Like Linux, report the required length along with ERANGE
+			// if the groups don't fit.
+			if outLen < 4*len(groups) {
+				return groups, syserr.ErrRange
+			}
+			return groups, nil
+		}
+	}
 	return epsocket.GetSockOpt(t, s, s.ep, linux.AF_UNIX, s.ep.Type(), level, name, outLen)
 }
 
 // Listen implements the linux syscall listen(2) for sockets backed by
 // a transport.Endpoint.
 func (s *SocketOperations) Listen(t *kernel.Task, backlog int) *syserr.Error {
-	return s.ep.Listen(backlog)
+	return s.ep.Listen(backlog, control.NewPeerCredentials(t))
 }
 
 // blockingAccept implements a blocking version of accept(2), that is, if no
@@ -348,7 +369,7 @@ func (s *SocketOperations) Connect(t *kernel.Task, sockaddr []byte, blocking boo
 	defer ep.Release()
 
 	// Connect the server endpoint.
-	return s.ep.Connect(ep)
+	return s.ep.Connect(ep, control.NewPeerCredentials(t))
 }
 
 // Writev implements fs.FileOperations.Write.
@@ -612,7 +633,7 @@ func (*provider) Pair(t *kernel.Task, stype transport.SockType, protocol int) (*
 	}
 
 	// Create the endpoints and sockets.
-	ep1, ep2 := transport.NewPair(stype, t.Kernel())
+	ep1, ep2 := transport.NewPair(stype, t.Kernel(), control.NewPeerCredentials(t))
 	s1 := New(t, ep1, isPacket)
 	s2 := New(t, ep2, isPacket)
 
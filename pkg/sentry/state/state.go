@@ -51,6 +51,10 @@ type SaveOpts struct {
 	// Metadata is save metadata.
 	Metadata map[string]string
 
+	// Compression is the compression algorithm of the state file. If
+	// empty, the statefile default is used.
+	Compression statefile.Compression
+
 	// Callback is called prior to unpause, with any save error.
 	Callback func(err error)
 }
@@ -72,7 +76,7 @@ func (opts SaveOpts) Save(k *kernel.Kernel, w *watchdog.Watchdog) error {
 	addSaveMetadata(opts.Metadata)
 
 	// Open the statefile.
-	wc, err := statefile.NewWriter(opts.Destination, opts.Key, opts.Metadata)
+	wc, err := statefile.NewWriterCompression(opts.Destination, opts.Key, opts.Metadata, opts.Compression)
 	if err != nil {
 		err = ErrStateFile{err}
 	} else {
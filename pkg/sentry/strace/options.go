@@ -0,0 +1,209 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package strace
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+)
+
+// Format is the format of straces sent to the log sink.
+type Format int
+
+const (
+	// FormatText logs each syscall entry and exit as a line of text.
+	FormatText Format = iota
+
+	// FormatJSON emits each syscall entry and exit as a JSON object on a
+	// single line. See jsonRecord for the schema.
+	FormatJSON
+)
+
+// Options configure which tasks are traced and how straces are logged.
+type Options struct {
+	// Format is the format of the log sink.
+	Format Format
+
+	// PIDs restricts tracing to the given thread groups, identified by
+	// their ID in the root PID namespace. If empty, all tasks are traced.
+	PIDs []kernel.ThreadID
+
+	// Output, if not nil, receives JSON lines instead of the log. It is
+	// only used with FormatJSON, and is closed when the options are
+	// replaced.
+	Output io.WriteCloser
+}
+
+// options is the current configuration.
+type options struct {
+	format Format
+
+	// pids is the set of traced thread groups, or nil if all are traced.
+	pids map[kernel.ThreadID]struct{}
+
+	// output is the destination of JSON lines. If nil, they are logged.
+	output io.WriteCloser
+
+	// outputMu serializes writes to output.
+	outputMu sync.Mutex
+}
+
+var (
+	// currentOptions holds the current *options.
+	currentOptions atomic.Value
+
+	// setOptionsMu serializes calls to SetOptions.
+	setOptionsMu sync.Mutex
+)
+
+func init() {
+	currentOptions.Store(&options{})
+}
+
+// SetOptions replaces the current options. Syscalls in progress may be traced
+// with either the old or new options.
+func SetOptions(opts Options) {
+	o := &options{
+		format: opts.Format,
+	}
+	if opts.Format == FormatJSON {
+		o.output = opts.Output
+	} else if opts.Output != nil {
+		opts.Output.Close()
+	}
+	if len(opts.PIDs) > 0 {
+		o.pids = make(map[kernel.ThreadID]struct{}, len(opts.PIDs))
+		for _, pid := range opts.PIDs {
+			o.pids[pid] = struct{}{}
+		}
+	}
+
+	setOptionsMu.Lock()
+	defer setOptionsMu.Unlock()
+	old := currentOptions.Load().(*options)
+	currentOptions.Store(o)
+	if old.output != nil {
+		old.outputMu.Lock()
+		old.output.Close()
+		old.output = nil
+		old.outputMu.Unlock()
+	}
+}
+
+func loadOptions() *options {
+	return currentOptions.Load().(*options)
+}
+
+// traced returns true if syscalls made by t should be traced.
+func (o *options) traced(t *kernel.Task) bool {
+	if o.pids == nil {
+		return true
+	}
+	_, ok := o.pids[t.Kernel().TaskSet().Root.IDOfThreadGroup(t.ThreadGroup())]
+	return ok
+}
+
+// jsonRecord is the JSON representation of a syscall entry or exit.
+type jsonRecord struct {
+	// Time is the time of the event.
+	Time time.Time `json:"time"`
+
+	// PID and TID are the thread group and thread IDs of the task in the
+	// root PID namespace.
+	PID kernel.ThreadID `json:"pid"`
+	TID kernel.ThreadID `json:"tid"`
+
+	// Process is the name of the task.
+	Process string `json:"process"`
+
+	// Event is "enter" or "exit".
+	Event string `json:"event"`
+
+	// Syscall is the name of the syscall.
+	Syscall string `json:"syscall"`
+
+	// Args are the decoded syscall arguments.
+	Args []string `json:"args"`
+
+	// The fields below are only set on exit.
+
+	// Return is the return value.
+	Return string `json:"return,omitempty"`
+
+	// Errno and Error describe the error returned by the syscall, if any.
+	Errno int    `json:"errno,omitempty"`
+	Error string `json:"error,omitempty"`
+
+	// DurationNs is the time spent in the syscall, in nanoseconds.
+	DurationNs int64 `json:"duration_ns,omitempty"`
+}
+
+// emit writes r as a JSON line.
+func (o *options) emit(t *kernel.Task, r *jsonRecord) {
+	ns := t.Kernel().TaskSet().Root
+	r.PID = ns.IDOfThreadGroup(t.ThreadGroup())
+	r.TID = ns.IDOfTask(t)
+	r.Process = t.Name()
+	b, err := json.Marshal(r)
+	if err != nil {
+		log.Warningf("Failed to marshal strace record %+v: %v", r, err)
+		return
+	}
+
+	o.outputMu.Lock()
+	defer o.outputMu.Unlock()
+	if o.output == nil {
+		log.Infof("%s", b)
+		return
+	}
+	if _, err := o.output.Write(append(b, '\n')); err != nil {
+		log.Warningf("Failed to write strace record, logging it instead: %v", err)
+		log.Infof("%s", b)
+	}
+}
+
+// jsonEnter emits the given system call entry as JSON.
+func (i *SyscallInfo) jsonEnter(t *kernel.Task, o *options, output []string) {
+	o.emit(t, &jsonRecord{
+		Time:    time.Now(),
+		Event:   "enter",
+		Syscall: i.name,
+		Args:    output,
+	})
+}
+
+// jsonExit emits the given system call exit as JSON.
+func (i *SyscallInfo) jsonExit(t *kernel.Task, o *options, elapsed time.Duration, output []string, retval uintptr, err error, errno int) {
+	r := &jsonRecord{
+		Time:       time.Now(),
+		Event:      "exit",
+		Syscall:    i.name,
+		Args:       output,
+		Return:     fmt.Sprintf("%#x", retval),
+		DurationNs: elapsed.Nanoseconds(),
+	}
+	if err != nil {
+		r.Errno = errno
+		r.Error = err.Error()
+	}
+	o.emit(t, r)
+}
@@ -124,6 +124,7 @@ var ipProtocol = abi.ValueSet{
 	linux.IPPROTO_UDPLITE: "IPPROTO_UDPLITE",
 	linux.IPPROTO_MPLS:    "IPPROTO_MPLS",
 	linux.IPPROTO_RAW:     "IPPROTO_RAW",
+	linux.IPPROTO_MPTCP:   "IPPROTO_MPTCP",
 }
 
 // SocketProtocol are the possible socket(2) protocols for each protocol family.
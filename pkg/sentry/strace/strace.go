@@ -592,6 +592,7 @@ type syscallContext struct {
 	logOutput   []string
 	eventOutput []string
 	flags       uint32
+	options     *options
 }
 
 // SyscallEnter implements kernel.Stracer.SyscallEnter. It logs the syscall
@@ -605,9 +606,20 @@ func (s SyscallMap) SyscallEnter(t *kernel.Task, sysno uintptr, args arch.Syscal
 		}
 	}
 
+	o := loadOptions()
+	if !o.traced(t) {
+		// Nothing to do on exit either.
+		return &syscallContext{}
+	}
+
 	var output, eventOutput []string
 	if bits.IsOn32(flags, kernel.StraceEnableLog) {
-		output = info.printEnter(t, args)
+		if o.format == FormatJSON {
+			output = info.pre(t, args, LogMaximumSize)
+			info.jsonEnter(t, o, output)
+		} else {
+			output = info.printEnter(t, args)
+		}
 	}
 	if bits.IsOn32(flags, kernel.StraceEnableEvent) {
 		eventOutput = info.sendEnter(t, args)
@@ -620,18 +632,30 @@ func (s SyscallMap) SyscallEnter(t *kernel.Task, sysno uintptr, args arch.Syscal
 		logOutput:   output,
 		eventOutput: eventOutput,
 		flags:       flags,
+		options:     o,
 	}
 }
 
 // SyscallExit implements kernel.Stracer.SyscallExit. It logs the syscall
 // exit trace.
 func (s SyscallMap) SyscallExit(context interface{}, t *kernel.Task, sysno, rval uintptr, err error) {
-	errno := t.ExtractErrno(err, int(sysno))
 	c := context.(*syscallContext)
+	if c.flags == 0 {
+		return
+	}
+	errno := t.ExtractErrno(err, int(sysno))
 
 	elapsed := time.Since(c.start)
 	if bits.IsOn32(c.flags, kernel.StraceEnableLog) {
-		c.info.printExit(t, elapsed, c.logOutput, c.args, rval, err, errno)
+		if c.options.format == FormatJSON {
+			if err == nil {
+				// Fill in the output after successful execution.
+				c.info.post(t, c.args, rval, c.logOutput, LogMaximumSize)
+			}
+			c.info.jsonExit(t, c.options, elapsed, c.logOutput, rval, err, errno)
+		} else {
+			c.info.printExit(t, elapsed, c.logOutput, c.args, rval, err, errno)
+		}
 	}
 	if bits.IsOn32(c.flags, kernel.StraceEnableEvent) {
 		c.info.sendExit(t, elapsed, c.eventOutput, c.args, rval, err, errno)
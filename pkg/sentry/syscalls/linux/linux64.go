@@ -211,8 +211,7 @@ var AMD64 = &kernel.SyscallTable{
 		133: Mknod,
 		// @Syscall(Uselib, note:Obsolete)
 		134: syscalls.Error(syscall.ENOSYS),
-		// @Syscall(SetPersonality, returns:EINVAL, note:Unable to change personality)
-		135: syscalls.ErrorWithEvent(syscall.EINVAL),
+		135: Personality,
 		// @Syscall(Ustat, note:Needs filesystem support)
 		136: syscalls.ErrorWithEvent(syscall.ENOSYS),
 		137: Statfs,
@@ -235,8 +234,7 @@ var AMD64 = &kernel.SyscallTable{
 		152: Munlockall,
 		// @Syscall(Vhangup, returns:EPERM)
 		153: syscalls.CapError(linux.CAP_SYS_TTY_CONFIG),
-		// @Syscall(ModifyLdt, returns:EPERM)
-		154: syscalls.Error(syscall.EPERM),
+		154: ModifyLDT,
 		// @Syscall(PivotRoot, returns:EPERM)
 		155: syscalls.Error(syscall.EPERM),
 		// @Syscall(Sysctl, returns:EPERM)
@@ -248,8 +246,7 @@ var AMD64 = &kernel.SyscallTable{
 		160: Setrlimit,
 		161: Chroot,
 		162: Sync,
-		// @Syscall(Acct, returns:EPERM or ENOSYS, note:Returns EPERM if the process does not have cap_sys_pacct; ENOSYS otherwise)
-		163: syscalls.CapError(linux.CAP_SYS_PACCT), // requires cap_sys_pacct
+		163: Acct,
 		// @Syscall(Settimeofday, returns:EPERM or ENOSYS, note:Returns EPERM if the process does not have cap_sys_time; ENOSYS otherwise)
 		164: syscalls.CapError(linux.CAP_SYS_TIME), // requires cap_sys_time
 		165: Mount,
@@ -342,7 +339,7 @@ var AMD64 = &kernel.SyscallTable{
 		217: Getdents64,
 		218: SetTidAddress,
 		219: RestartSyscall,
-		//     220: @Syscall(Semtimedop), TODO
+		220: Semtimedop,
 		221: Fadvise64,
 		222: TimerCreate,
 		223: TimerSettime,
@@ -360,8 +357,7 @@ var AMD64 = &kernel.SyscallTable{
 		235: Utimes,
 		// @Syscall(Vserver, note:Not implemented by Linux)
 		236: syscalls.Error(syscall.ENOSYS), // Vserver, not implemented by Linux
-		// @Syscall(Mbind, returns:EPERM or ENOSYS, note:Returns EPERM if the process does not have cap_sys_nice; ENOSYS otherwise), TODO
-		237: syscalls.CapError(linux.CAP_SYS_NICE), // may require cap_sys_nice
+		237: Mbind,
 		238: SetMempolicy,
 		239: GetMempolicy,
 		//     240: @Syscall(MqOpen), TODO
@@ -378,10 +374,10 @@ var AMD64 = &kernel.SyscallTable{
 		249: syscalls.Error(syscall.EACCES),
 		// @Syscall(Keyctl, returns:EACCES, note:Not available to user)
 		250: syscalls.Error(syscall.EACCES),
-		// @Syscall(IoprioSet, returns:EPERM or ENOSYS, note:Returns EPERM if the process does not have cap_sys_admin; ENOSYS otherwise)
-		251: syscalls.CapError(linux.CAP_SYS_ADMIN), // requires cap_sys_nice or cap_sys_admin (depending)
-		// @Syscall(IoprioGet, returns:EPERM or ENOSYS, note:Returns EPERM if the process does not have cap_sys_admin; ENOSYS otherwise)
-		252: syscalls.CapError(linux.CAP_SYS_ADMIN), // requires cap_sys_nice or cap_sys_admin (depending)
+		// @Syscall(IoprioSet, note:I/O priorities are recorded but not enforced)
+		251: IoprioSet,
+		// @Syscall(IoprioGet)
+		252: IoprioGet,
 		253: InotifyInit,
 		254: InotifyAddWatch,
 		255: InotifyRmWatch,
@@ -439,10 +435,8 @@ var AMD64 = &kernel.SyscallTable{
 		// @Syscall(FanotifyMark, note:Needs CONFIG_FANOTIFY)
 		301: syscalls.ErrorWithEvent(syscall.ENOSYS),
 		302: Prlimit64,
-		// @Syscall(NameToHandleAt, returns:EOPNOTSUPP, note:Needs filesystem support)
-		303: syscalls.ErrorWithEvent(syscall.EOPNOTSUPP),
-		// @Syscall(OpenByHandleAt, returns:EOPNOTSUPP, note:Needs filesystem support)
-		304: syscalls.ErrorWithEvent(syscall.EOPNOTSUPP),
+		303: NameToHandleAt,
+		304: OpenByHandleAt,
 		// @Syscall(ClockAdjtime, returns:EPERM or ENOSYS, note:Returns EPERM if the process does not have cap_sys_module; ENOSYS otherwise)
 		305: syscalls.CapError(linux.CAP_SYS_TIME), // requires cap_sys_time
 		306: Syncfs,
@@ -451,8 +445,7 @@ var AMD64 = &kernel.SyscallTable{
 		309: Getcpu,
 		//     310: @Syscall(ProcessVmReadv), TODO may require cap_sys_ptrace
 		//     311: @Syscall(ProcessVmWritev), TODO may require cap_sys_ptrace
-		// @Syscall(Kcmp, returns:EPERM or ENOSYS, note:Requires cap_sys_ptrace)
-		312: syscalls.CapError(linux.CAP_SYS_PTRACE),
+		312: Kcmp,
 		// @Syscall(FinitModule, returns:EPERM or ENOSYS, note:Returns EPERM if the process does not have cap_sys_module; ENOSYS otherwise)
 		313: syscalls.CapError(linux.CAP_SYS_MODULE),
 		//     314: @Syscall(SchedSetattr), TODO, we have no scheduler
@@ -465,7 +458,7 @@ var AMD64 = &kernel.SyscallTable{
 		320: syscalls.CapError(linux.CAP_SYS_BOOT),
 		// @Syscall(Bpf, returns:EPERM or ENOSYS, note:Returns EPERM if the process does not have cap_sys_boot; ENOSYS otherwise)
 		321: syscalls.CapError(linux.CAP_SYS_ADMIN), // requires cap_sys_admin for all commands
-		//     322: @Syscall(Execveat), TODO
+		322: Execveat,
 		//     323: @Syscall(Userfaultfd), TODO
 		//     324: @Syscall(Membarrier), TODO
 		325: Mlock2,
@@ -473,6 +466,8 @@ var AMD64 = &kernel.SyscallTable{
 		//	326: @Syscall(CopyFileRange),
 		327: Preadv2,
 		328: Pwritev2,
+		436: CloseRange,
+		437: Openat2,
 	},
 
 	Emulate: map[usermem.Addr]uintptr{
@@ -16,14 +16,18 @@ package linux
 
 import (
 	"encoding/binary"
+	"math"
 
 	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/host"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/eventfd"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/kdefs"
 	ktime "gvisor.googlesource.com/gvisor/pkg/sentry/kernel/time"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/limits"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/mm"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/safemem"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
 )
@@ -44,6 +48,10 @@ const (
 	_IOCB_FLAG_RESFD = 1
 )
 
+// maxHostAIOBlocks is the maximum number of memory blocks in a request
+// submitted to host AIO, equivalent to Linux's UIO_MAXIOV.
+const maxHostAIOBlocks = 1024
+
 // ioCallback describes an I/O request.
 //
 // The priority field is currently ignored in the implementation below. Also
@@ -270,6 +278,12 @@ func performCallback(t *kernel.Task, file *fs.File, cbAddr usermem.Addr, cb *ioC
 		err = file.Fsync(c, 0, fs.FileMaxOffset, fs.SyncData)
 	}
 
+	finishCallback(t, file, ev, err, ctx, eventFile)
+}
+
+// finishCallback completes a request for which ev and err describe the
+// result, releasing the references on file and eventFile held by the request.
+func finishCallback(t *kernel.Task, file *fs.File, ev *ioEvent, err error, ctx *mm.AIOContext, eventFile *fs.File) {
 	// Update the result.
 	if err != nil {
 		err = handleIOError(t, ev.Result != 0 /* partial */, err, nil /* never interrupted */, "aio", file)
@@ -290,6 +304,115 @@ func performCallback(t *kernel.Task, file *fs.File, cbAddr usermem.Addr, cb *ioC
 	}
 }
 
+// hostAIOResult is the result of a request submitted to host AIO.
+type hostAIOResult struct {
+	n   int64
+	err error
+}
+
+// submitHostAIO attempts to perform the read or write described by cb using
+// host AIO on hostFD, the host FD backing file, so that the request is queued
+// to the host device rather than occupying a goroutine. If submitHostAIO
+// returns false, the request was not submitted and must be performed by
+// performCallback instead.
+func submitHostAIO(t *kernel.Task, file *fs.File, hostFD int, cbAddr usermem.Addr, cb *ioCallback, ioseq usermem.IOSequence, ctx *mm.AIOContext, eventFile *fs.File) bool {
+	var write bool
+	switch cb.OpCode {
+	case _IOCB_CMD_PREAD, _IOCB_CMD_PREADV:
+		if !file.Flags().Read {
+			return false
+		}
+	case _IOCB_CMD_PWRITE, _IOCB_CMD_PWRITEV:
+		// Appending writes and writes that may exceed the file size limit
+		// require the checks performed by fs.File.Pwritev.
+		if !file.Flags().Write || file.Flags().Append {
+			return false
+		}
+		if limit := limits.FromContext(t).Get(limits.FileSize).Cur; limit <= math.MaxInt64 && uint64(cb.Offset)+uint64(ioseq.NumBytes()) > limit {
+			return false
+		}
+		write = true
+	default:
+		return false
+	}
+
+	// Pin the memory to be read into or written from for the duration of the
+	// I/O, as Linux does for O_DIRECT I/O using get_user_pages(). Only memory
+	// in the MemoryFile has internal mappings that remain valid while pinned.
+	at := usermem.Write
+	if write {
+		at = usermem.Read
+	}
+	mf := t.Kernel().MemoryFile()
+	var prs []mm.PinnedRange
+	var blocks []safemem.Block
+	for ars := ioseq.Addrs; !ars.IsEmpty(); ars = ars.Tail() {
+		ar := ars.Head()
+		if ar.Length() == 0 {
+			continue
+		}
+		end, ok := ar.End.RoundUp()
+		if !ok {
+			mm.Unpin(prs)
+			return false
+		}
+		pinned, err := t.MemoryManager().Pin(t, usermem.AddrRange{ar.Start.RoundDown(), end}, at, false /* ignorePermissions */)
+		prs = append(prs, pinned...)
+		if err != nil {
+			mm.Unpin(prs)
+			return false
+		}
+		for _, pr := range pinned {
+			if pr.File != mf {
+				mm.Unpin(prs)
+				return false
+			}
+			ims, err := pr.File.MapInternal(pr.FileRange(), at)
+			if err != nil {
+				mm.Unpin(prs)
+				return false
+			}
+			sub := pr.Source.Intersect(ar)
+			ims = ims.DropFirst64(uint64(sub.Start - pr.Source.Start)).TakeFirst64(uint64(sub.Length()))
+			for ; !ims.IsEmpty(); ims = ims.Tail() {
+				blocks = append(blocks, ims.Head())
+			}
+		}
+	}
+	if len(blocks) > maxHostAIOBlocks {
+		mm.Unpin(prs)
+		return false
+	}
+
+	res := make(chan hostAIOResult, 1)
+	if err := host.SubmitAIO(&host.AIORequest{
+		FD:     hostFD,
+		Write:  write,
+		Offset: cb.Offset,
+		Blocks: safemem.BlockSeqFromSlice(blocks),
+		Done: func(n int64, err error) {
+			res <- hostAIOResult{n, err}
+		},
+	}); err != nil {
+		mm.Unpin(prs)
+		return false
+	}
+
+	// Wait for completion in a goroutine started by fs.Async, so that
+	// save/restore waits for the request to complete.
+	fs.Async(func() {
+		r := <-res
+		mm.Unpin(prs)
+		ev := &ioEvent{
+			Data:   cb.Data,
+			Obj:    uint64(cbAddr),
+			Result: r.n,
+		}
+		finishCallback(t, file, ev, r.err, ctx, eventFile)
+	})
+	return true
+}
+
 // submitCallback processes a single callback.
 func submitCallback(t *kernel.Task, id uint64, cb *ioCallback, cbAddr usermem.Addr) error {
 	file := t.FDMap().GetFile(kdefs.FD(cb.FD))
@@ -349,6 +472,9 @@ func submitCallback(t *kernel.Task, id uint64, cb *ioCallback, cbAddr usermem.Ad
 
 	// Perform the request asynchronously.
 	file.IncRef()
+	if hostFD := host.AIOFD(file); hostFD >= 0 && submitHostAIO(t, file, hostFD, cbAddr, cb, ioseq, ctx, eventFile) {
+		return nil
+	}
 	fs.Async(func() { performCallback(t, file, cbAddr, cb, ioseq, ctx, eventFile) })
 
 	// All set.
@@ -16,6 +16,7 @@ package linux
 
 import (
 	"io"
+	"math"
 	"syscall"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
@@ -36,9 +37,18 @@ import (
 
 // fileOpAt performs an operation on the second last component in the path.
 func fileOpAt(t *kernel.Task, dirFD kdefs.FD, path string, fn func(root *fs.Dirent, d *fs.Dirent, name string) error) error {
+	return fileOpAtFlags(t, dirFD, path, fs.ResolveFlags{}, fn)
+}
+
+// fileOpAtFlags is identical to fileOpAt, except that path resolution is
+// restricted by flags.
+func fileOpAtFlags(t *kernel.Task, dirFD kdefs.FD, path string, flags fs.ResolveFlags, fn func(root *fs.Dirent, d *fs.Dirent, name string) error) error {
 	// Extract the last component.
 	dir, name := fs.SplitLast(path)
-	if dir == "/" {
+	if flags != (fs.ResolveFlags{}) {
+		// Restricted lookups must always be checked; skip the common
+		// cases below.
+	} else if dir == "/" {
 		// Common case: we are accessing a file in the root.
 		root := t.FSContext().RootDirectory()
 		err := fn(root, root, name)
@@ -55,13 +65,19 @@ func fileOpAt(t *kernel.Task, dirFD kdefs.FD, path string, fn func(root *fs.Dire
 		return err
 	}
 
-	return fileOpOn(t, dirFD, dir, true /* resolve */, func(root *fs.Dirent, d *fs.Dirent) error {
+	return fileOpOnFlags(t, dirFD, dir, true /* resolve */, flags, func(root *fs.Dirent, d *fs.Dirent) error {
 		return fn(root, d, name)
 	})
 }
 
 // fileOpOn performs an operation on the last entry of the path.
 func fileOpOn(t *kernel.Task, dirFD kdefs.FD, path string, resolve bool, fn func(root *fs.Dirent, d *fs.Dirent) error) error {
+	return fileOpOnFlags(t, dirFD, path, resolve, fs.ResolveFlags{}, fn)
+}
+
+// fileOpOnFlags is identical to fileOpOn, except that path resolution is
+// restricted by flags.
+func fileOpOnFlags(t *kernel.Task, dirFD kdefs.FD, path string, resolve bool, flags fs.ResolveFlags, fn func(root *fs.Dirent, d *fs.Dirent) error) error {
 	var (
 		d   *fs.Dirent // The file.
 		wd  *fs.Dirent // The working directory (if required.)
@@ -70,8 +86,12 @@ func fileOpOn(t *kernel.Task, dirFD kdefs.FD, path string, resolve bool, fn func
 		err error
 	)
 
+	// Scoped lookups are confined to the starting directory, so it is
+	// required even for absolute paths.
+	scoped := flags.Beneath || flags.InRoot
+
 	// Extract the working directory (maybe).
-	if len(path) > 0 && path[0] == '/' {
+	if len(path) > 0 && path[0] == '/' && !scoped {
 		// Absolute path; rel can be nil.
 	} else if dirFD == linux.AT_FDCWD {
 		// Need to reference the working directory.
@@ -85,19 +105,26 @@ func fileOpOn(t *kernel.Task, dirFD kdefs.FD, path string, resolve bool, fn func
 		}
 		rel = f.Dirent
 		if !fs.IsDir(rel.Inode.StableAttr) {
+			f.DecRef()
 			return syserror.ENOTDIR
 		}
 	}
 
 	// Grab the root (always required.)
-	root := t.FSContext().RootDirectory()
+	var root *fs.Dirent
+	if scoped {
+		root = rel
+		root.IncRef()
+	} else {
+		root = t.FSContext().RootDirectory()
+	}
 
 	// Lookup the node.
 	remainingTraversals := uint(linux.MaxSymlinkTraversals)
 	if resolve {
-		d, err = t.MountNamespace().FindInode(t, root, rel, path, &remainingTraversals)
+		d, err = t.MountNamespace().FindInodeWithFlags(t, root, rel, path, &remainingTraversals, flags)
 	} else {
-		d, err = t.MountNamespace().FindLink(t, root, rel, path, &remainingTraversals)
+		d, err = t.MountNamespace().FindLinkWithFlags(t, root, rel, path, &remainingTraversals, flags)
 	}
 	root.DecRef()
 	if wd != nil {
@@ -132,74 +159,121 @@ func copyInPath(t *kernel.Task, addr usermem.Addr, allowEmpty bool) (path string
 	return path, dirPath, nil
 }
 
-func openAt(t *kernel.Task, dirFD kdefs.FD, addr usermem.Addr, flags uint) (fd uintptr, err error) {
+func openAt(t *kernel.Task, dirFD kdefs.FD, addr usermem.Addr, flags uint, resolveFlags fs.ResolveFlags) (fd uintptr, err error) {
 	path, dirPath, err := copyInPath(t, addr, false /* allowEmpty */)
 	if err != nil {
 		return 0, err
 	}
 
+	if flags&linux.O_PATH != 0 {
+		return openPathAt(t, dirFD, path, dirPath, flags, resolveFlags)
+	}
+
 	resolve := flags&linux.O_NOFOLLOW == 0
-	err = fileOpOn(t, dirFD, path, resolve, func(root *fs.Dirent, d *fs.Dirent) error {
-		// First check a few things about the filesystem before trying to get the file
-		// reference.
-		//
-		// It's required that Check does not try to open files not that aren't backed by
-		// this dirent (e.g. pipes and sockets) because this would result in opening these
-		// files an extra time just to check permissions.
-		if err := d.Inode.CheckPermission(t, flagsToPermissions(flags)); err != nil {
-			return err
-		}
+	err = fileOpOnFlags(t, dirFD, path, resolve, resolveFlags, func(root *fs.Dirent, d *fs.Dirent) error {
+		fd, err = openDirent(t, d, flags, resolve, dirPath)
+		return err
+	})
+	return fd, err // Use result in frame.
+}
 
-		if fs.IsSymlink(d.Inode.StableAttr) && !resolve {
-			return syserror.ELOOP
-		}
+// openDirent opens d with the given open(2) flags and installs the resulting
+// file in t's FD table.
+//
+// If resolve is false, the final path component leading to d was not followed
+// (as with O_NOFOLLOW), and opening a symlink fails with ELOOP.
+func openDirent(t *kernel.Task, d *fs.Dirent, flags uint, resolve, dirPath bool) (uintptr, error) {
+	// First check a few things about the filesystem before trying to get the file
+	// reference.
+	//
+	// It's required that Check does not try to open files not that aren't backed by
+	// this dirent (e.g. pipes and sockets) because this would result in opening these
+	// files an extra time just to check permissions.
+	if err := d.Inode.CheckPermission(t, flagsToPermissions(flags)); err != nil {
+		return 0, err
+	}
 
-		fileFlags := linuxToFlags(flags)
-		// Linux always adds the O_LARGEFILE flag when running in 64-bit mode.
-		fileFlags.LargeFile = true
-		if fs.IsDir(d.Inode.StableAttr) {
-			// Don't allow directories to be opened writable.
-			if fileFlags.Write {
-				return syserror.EISDIR
-			}
-		} else {
-			// If O_DIRECTORY is set, but the file is not a directory, then fail.
-			if fileFlags.Directory {
-				return syserror.ENOTDIR
-			}
-			// If it's a directory, then make sure.
-			if dirPath {
-				return syserror.ENOTDIR
-			}
-			if flags&linux.O_TRUNC != 0 {
-				if err := d.Inode.Truncate(t, d, 0); err != nil {
-					return err
-				}
+	if fs.IsSymlink(d.Inode.StableAttr) && !resolve {
+		return 0, syserror.ELOOP
+	}
+
+	fileFlags := linuxToFlags(flags)
+	// Linux always adds the O_LARGEFILE flag when running in 64-bit mode.
+	fileFlags.LargeFile = true
+	if fs.IsDir(d.Inode.StableAttr) {
+		// Don't allow directories to be opened writable.
+		if fileFlags.Write {
+			return 0, syserror.EISDIR
+		}
+	} else {
+		// If O_DIRECTORY is set, but the file is not a directory, then fail.
+		if fileFlags.Directory {
+			return 0, syserror.ENOTDIR
+		}
+		// If it's a directory, then make sure.
+		if dirPath {
+			return 0, syserror.ENOTDIR
+		}
+		if flags&linux.O_TRUNC != 0 {
+			if err := d.Inode.Truncate(t, d, 0); err != nil {
+				return 0, err
 			}
 		}
+	}
 
-		file, err := d.Inode.GetFile(t, d, fileFlags)
-		if err != nil {
-			return syserror.ConvertIntr(err, kernel.ERESTARTSYS)
-		}
-		defer file.DecRef()
+	file, err := d.Inode.GetFile(t, d, fileFlags)
+	if err != nil {
+		return 0, syserror.ConvertIntr(err, kernel.ERESTARTSYS)
+	}
+	defer file.DecRef()
 
-		// Success.
-		fdFlags := kernel.FDFlags{CloseOnExec: flags&linux.O_CLOEXEC != 0}
-		newFD, err := t.FDMap().NewFDFrom(0, file, fdFlags, t.ThreadGroup().Limits())
-		if err != nil {
-			return err
-		}
+	// Success.
+	fdFlags := kernel.FDFlags{CloseOnExec: flags&linux.O_CLOEXEC != 0}
+	newFD, err := t.FDMap().NewFDFrom(0, file, fdFlags, t.ThreadGroup().Limits())
+	if err != nil {
+		return 0, err
+	}
 
-		// Set return result in frame.
-		fd = uintptr(newFD)
+	// Generate notification for opened file.
+	d.InotifyEvent(linux.IN_OPEN, 0)
 
-		// Generate notification for opened file.
-		d.InotifyEvent(linux.IN_OPEN, 0)
+	return uintptr(newFD), nil
+}
 
-		return nil
+// openPathAt opens an O_PATH file descriptor, which refers to a location in
+// the filesystem without opening the file itself.
+//
+// As in Linux, all flags other than O_DIRECTORY, O_NOFOLLOW and O_CLOEXEC are
+// ignored, and no permissions are required on the file itself.
+func openPathAt(t *kernel.Task, dirFD kdefs.FD, path string, dirPath bool, flags uint, resolveFlags fs.ResolveFlags) (fd uintptr, err error) {
+	resolve := flags&linux.O_NOFOLLOW == 0
+	err = fileOpOnFlags(t, dirFD, path, resolve, resolveFlags, func(root *fs.Dirent, d *fs.Dirent) error {
+		fd, err = openPathDirent(t, d, flags, dirPath)
+		return err
 	})
-	return fd, err // Use result in frame.
+	return fd, err
+}
+
+// openPathDirent creates an O_PATH file for d and installs it in t's FD table.
+func openPathDirent(t *kernel.Task, d *fs.Dirent, flags uint, dirPath bool) (uintptr, error) {
+	if !fs.IsDir(d.Inode.StableAttr) && (flags&linux.O_DIRECTORY != 0 || dirPath) {
+		return 0, syserror.ENOTDIR
+	}
+
+	file := fs.NewPathFile(t, d, fs.FileFlags{
+		Directory: flags&linux.O_DIRECTORY != 0,
+		// Linux always adds the O_LARGEFILE flag when running in 64-bit
+		// mode.
+		LargeFile: true,
+	})
+	defer file.DecRef()
+
+	fdFlags := kernel.FDFlags{CloseOnExec: flags&linux.O_CLOEXEC != 0}
+	newFD, err := t.FDMap().NewFDFrom(0, file, fdFlags, t.ThreadGroup().Limits())
+	if err != nil {
+		return 0, err
+	}
+	return uintptr(newFD), nil
 }
 
 func mknodAt(t *kernel.Task, dirFD kdefs.FD, addr usermem.Addr, mode linux.FileMode) error {
@@ -295,7 +369,7 @@ func Mknodat(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysca
 	return 0, nil, mknodAt(t, dirFD, path, mode)
 }
 
-func createAt(t *kernel.Task, dirFD kdefs.FD, addr usermem.Addr, flags uint, mode linux.FileMode) (fd uintptr, err error) {
+func createAt(t *kernel.Task, dirFD kdefs.FD, addr usermem.Addr, flags uint, mode linux.FileMode, resolveFlags fs.ResolveFlags) (fd uintptr, err error) {
 	path, dirPath, err := copyInPath(t, addr, false /* allowEmpty */)
 	if err != nil {
 		return 0, err
@@ -304,7 +378,7 @@ func createAt(t *kernel.Task, dirFD kdefs.FD, addr usermem.Addr, flags uint, mod
 		return 0, syserror.ENOENT
 	}
 
-	err = fileOpAt(t, dirFD, path, func(root *fs.Dirent, d *fs.Dirent, name string) error {
+	err = fileOpAtFlags(t, dirFD, path, resolveFlags, func(root *fs.Dirent, d *fs.Dirent, name string) error {
 		if !fs.IsDir(d.Inode.StableAttr) {
 			return syserror.ENOTDIR
 		}
@@ -315,7 +389,7 @@ func createAt(t *kernel.Task, dirFD kdefs.FD, addr usermem.Addr, flags uint, mod
 
 		// Does this file exist already?
 		remainingTraversals := uint(linux.MaxSymlinkTraversals)
-		targetDirent, err := t.MountNamespace().FindInode(t, root, d, name, &remainingTraversals)
+		targetDirent, err := t.MountNamespace().FindInodeWithFlags(t, root, d, name, &remainingTraversals, resolveFlags)
 		var newFile *fs.File
 		switch err {
 		case nil:
@@ -392,12 +466,13 @@ func createAt(t *kernel.Task, dirFD kdefs.FD, addr usermem.Addr, flags uint, mod
 func Open(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	addr := args[0].Pointer()
 	flags := uint(args[1].Uint())
-	if flags&linux.O_CREAT != 0 {
+	// O_CREAT is ignored for O_PATH opens.
+	if flags&linux.O_CREAT != 0 && flags&linux.O_PATH == 0 {
 		mode := linux.FileMode(args[2].ModeT())
-		n, err := createAt(t, linux.AT_FDCWD, addr, flags, mode)
+		n, err := createAt(t, linux.AT_FDCWD, addr, flags, mode, fs.ResolveFlags{})
 		return n, nil, err
 	}
-	n, err := openAt(t, linux.AT_FDCWD, addr, flags)
+	n, err := openAt(t, linux.AT_FDCWD, addr, flags, fs.ResolveFlags{})
 	return n, nil, err
 }
 
@@ -406,20 +481,238 @@ func Openat(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 	dirFD := kdefs.FD(args[0].Int())
 	addr := args[1].Pointer()
 	flags := uint(args[2].Uint())
-	if flags&linux.O_CREAT != 0 {
+	// O_CREAT is ignored for O_PATH opens.
+	if flags&linux.O_CREAT != 0 && flags&linux.O_PATH == 0 {
 		mode := linux.FileMode(args[3].ModeT())
-		n, err := createAt(t, dirFD, addr, flags, mode)
+		n, err := createAt(t, dirFD, addr, flags, mode, fs.ResolveFlags{})
 		return n, nil, err
 	}
-	n, err := openAt(t, dirFD, addr, flags)
+	n, err := openAt(t, dirFD, addr, flags, fs.ResolveFlags{})
 	return n, nil, err
 }
 
+// Openat2 implements linux syscall openat2(2).
+func Openat2(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	dirFD := kdefs.FD(args[0].Int())
+	addr := args[1].Pointer()
+	howAddr := args[2].Pointer()
+	size := args[3].SizeT()
+
+	// struct open_how is extensible; see linux/uaccess.h:copy_struct_from_user.
+	if size < linux.SizeOfOpenHow {
+		return 0, nil, syserror.EINVAL
+	}
+	if size > usermem.PageSize {
+		return 0, nil, syserror.E2BIG
+	}
+	var how linux.OpenHow
+	if _, err := t.CopyIn(howAddr, &how); err != nil {
+		return 0, nil, err
+	}
+	if size > linux.SizeOfOpenHow {
+		// Fields we don't know about must be zero.
+		rest := make([]byte, size-linux.SizeOfOpenHow)
+		if _, err := t.CopyInBytes(howAddr+linux.SizeOfOpenHow, rest); err != nil {
+			return 0, nil, err
+		}
+		for _, b := range rest {
+			if b != 0 {
+				return 0, nil, syserror.E2BIG
+			}
+		}
+	}
+
+	// Unlike open(2), unknown flags are rejected. See
+	// fs/open.c:build_open_flags.
+	if how.Flags&^openat2ValidFlags != 0 || how.Resolve&^openat2ValidResolveFlags != 0 {
+		return 0, nil, syserror.EINVAL
+	}
+	flags := uint(how.Flags)
+	if flags&(linux.O_CREAT|linux.O_TMPFILE) != 0 {
+		if how.Mode&^07777 != 0 {
+			return 0, nil, syserror.EINVAL
+		}
+	} else if how.Mode != 0 {
+		return 0, nil, syserror.EINVAL
+	}
+	if how.Resolve&linux.RESOLVE_BENEATH != 0 && how.Resolve&linux.RESOLVE_IN_ROOT != 0 {
+		return 0, nil, syserror.EINVAL
+	}
+	if how.Resolve&linux.RESOLVE_CACHED != 0 {
+		// There is no lookup cache that could satisfy the open without
+		// blocking, so callers must always retry without RESOLVE_CACHED.
+		return 0, nil, syserror.EAGAIN
+	}
+
+	resolveFlags := fs.ResolveFlags{
+		NoXDev:       how.Resolve&linux.RESOLVE_NO_XDEV != 0,
+		NoMagicLinks: how.Resolve&linux.RESOLVE_NO_MAGICLINKS != 0,
+		NoSymlinks:   how.Resolve&linux.RESOLVE_NO_SYMLINKS != 0,
+		Beneath:      how.Resolve&linux.RESOLVE_BENEATH != 0,
+		InRoot:       how.Resolve&linux.RESOLVE_IN_ROOT != 0,
+	}
+	if flags&linux.O_CREAT != 0 && flags&linux.O_PATH == 0 {
+		n, err := createAt(t, dirFD, addr, flags, linux.FileMode(how.Mode), resolveFlags)
+		return n, nil, err
+	}
+	n, err := openAt(t, dirFD, addr, flags, resolveFlags)
+	return n, nil, err
+}
+
+const (
+	// openat2ValidFlags are the flags accepted by openat2(2), VALID_OPEN_FLAGS
+	// in Linux.
+	openat2ValidFlags = linux.O_ACCMODE | linux.O_CREAT | linux.O_EXCL | linux.O_NOCTTY | linux.O_TRUNC | linux.O_APPEND | linux.O_NONBLOCK | linux.O_SYNC | linux.O_ASYNC | linux.O_DIRECT | linux.O_LARGEFILE | linux.O_DIRECTORY | linux.O_NOFOLLOW | linux.O_NOATIME | linux.O_CLOEXEC | linux.O_PATH | linux.O_TMPFILE
+
+	// openat2ValidResolveFlags are the resolve flags accepted by openat2(2).
+	openat2ValidResolveFlags = linux.RESOLVE_NO_XDEV | linux.RESOLVE_NO_MAGICLINKS | linux.RESOLVE_NO_SYMLINKS | linux.RESOLVE_BENEATH | linux.RESOLVE_IN_ROOT | linux.RESOLVE_CACHED
+)
+
+// fileHandleSize is the size of the data of file handles returned by
+// name_to_handle_at(2), which contain an fs.FileHandle.
+const fileHandleSize = 12
+
+// NameToHandleAt implements linux syscall name_to_handle_at(2).
+func NameToHandleAt(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	dirFD := kdefs.FD(args[0].Int())
+	addr := args[1].Pointer()
+	handleAddr := args[2].Pointer()
+	mountIDAddr := args[3].Pointer()
+	flags := args[4].Int()
+
+	if flags&^(linux.AT_SYMLINK_FOLLOW|linux.AT_EMPTY_PATH) != 0 {
+		return 0, nil, syserror.EINVAL
+	}
+	path, _, err := copyInPath(t, addr, flags&linux.AT_EMPTY_PATH != 0)
+	if err != nil {
+		return 0, nil, err
+	}
+	var hdr linux.FileHandle
+	if _, err := t.CopyIn(handleAddr, &hdr); err != nil {
+		return 0, nil, err
+	}
+	if hdr.HandleBytes > linux.MAX_HANDLE_SZ {
+		return 0, nil, syserror.EINVAL
+	}
+
+	encode := func(d *fs.Dirent) error {
+		fh, err := d.EncodeFileHandle()
+		if err != nil {
+			return err
+		}
+		mountID := int32(d.Inode.MountSource.ID())
+		if _, err := t.CopyOut(mountIDAddr, mountID); err != nil {
+			return err
+		}
+		if hdr.HandleBytes < fileHandleSize {
+			// Tell the caller how large the handle needs to be.
+			hdr.HandleBytes = fileHandleSize
+			if _, err := t.CopyOut(handleAddr, &hdr); err != nil {
+				return err
+			}
+			return syserror.EOVERFLOW
+		}
+
+		hdr = linux.FileHandle{
+			HandleBytes: fileHandleSize,
+			HandleType:  linux.FILEID_INO64_GEN,
+		}
+		if _, err := t.CopyOut(handleAddr, &hdr); err != nil {
+			return err
+		}
+		buf := make([]byte, fileHandleSize)
+		usermem.ByteOrder.PutUint64(buf[0:], fh.InodeID)
+		usermem.ByteOrder.PutUint32(buf[8:], fh.Generation)
+		_, err = t.CopyOutBytes(handleAddr+linux.SizeOfFileHandle, buf)
+		return err
+	}
+
+	if path == "" {
+		if dirFD == linux.AT_FDCWD {
+			wd := t.FSContext().WorkingDirectory()
+			defer wd.DecRef()
+			return 0, nil, encode(wd)
+		}
+
+		file := t.FDMap().GetFile(dirFD)
+		if file == nil {
+			return 0, nil, syserror.EBADF
+		}
+		defer file.DecRef()
+		return 0, nil, encode(file.Dirent)
+	}
+
+	return 0, nil, fileOpOn(t, dirFD, path, flags&linux.AT_SYMLINK_FOLLOW != 0, func(root *fs.Dirent, d *fs.Dirent) error {
+		return encode(d)
+	})
+}
+
+// OpenByHandleAt implements linux syscall open_by_handle_at(2).
+func OpenByHandleAt(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	mountFD := kdefs.FD(args[0].Int())
+	handleAddr := args[1].Pointer()
+	flags := uint(args[2].Uint())
+
+	// The handle is decoded on the filesystem of mountFD.
+	var msrc *fs.MountSource
+	if mountFD == linux.AT_FDCWD {
+		wd := t.FSContext().WorkingDirectory()
+		defer wd.DecRef()
+		msrc = wd.Inode.MountSource
+	} else {
+		file := t.FDMap().GetFile(mountFD)
+		if file == nil {
+			return 0, nil, syserror.EBADF
+		}
+		defer file.DecRef()
+		msrc = file.Dirent.Inode.MountSource
+	}
+
+	// Opening files by handle bypasses permission checks on the path to
+	// the file. See fs/fhandle.c:may_decode_fh.
+	if !t.HasCapability(linux.CAP_DAC_READ_SEARCH) {
+		return 0, nil, syserror.EPERM
+	}
+
+	var hdr linux.FileHandle
+	if _, err := t.CopyIn(handleAddr, &hdr); err != nil {
+		return 0, nil, err
+	}
+	if hdr.HandleBytes == 0 || hdr.HandleBytes > linux.MAX_HANDLE_SZ {
+		return 0, nil, syserror.EINVAL
+	}
+	if hdr.HandleType != linux.FILEID_INO64_GEN || hdr.HandleBytes != fileHandleSize {
+		return 0, nil, syserror.ESTALE
+	}
+	buf := make([]byte, fileHandleSize)
+	if _, err := t.CopyInBytes(handleAddr+linux.SizeOfFileHandle, buf); err != nil {
+		return 0, nil, err
+	}
+
+	d, err := msrc.DecodeFileHandle(fs.FileHandle{
+		InodeID:    usermem.ByteOrder.Uint64(buf[0:]),
+		Generation: usermem.ByteOrder.Uint32(buf[8:]),
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	defer d.DecRef()
+
+	// Handles of symlinks can only be opened with O_PATH.
+	var fd uintptr
+	if flags&linux.O_PATH != 0 {
+		fd, err = openPathDirent(t, d, flags, false /* dirPath */)
+	} else {
+		fd, err = openDirent(t, d, flags, false /* resolve */, false /* dirPath */)
+	}
+	return fd, nil, err
+}
+
 // Creat implements linux syscall creat(2).
 func Creat(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	addr := args[0].Pointer()
 	mode := linux.FileMode(args[1].ModeT())
-	n, err := createAt(t, linux.AT_FDCWD, addr, linux.O_WRONLY|linux.O_TRUNC, mode)
+	n, err := createAt(t, linux.AT_FDCWD, addr, linux.O_WRONLY|linux.O_TRUNC, mode, fs.ResolveFlags{})
 	return n, nil, err
 }
 
@@ -516,6 +809,11 @@ func Ioctl(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 	}
 	defer file.DecRef()
 
+	// O_PATH files can't be used for I/O.
+	if file.Flags().Path {
+		return 0, nil, syserror.EBADF
+	}
+
 	// Shared flags between file and socket.
 	switch request {
 	case linux.FIONCLEX:
@@ -704,6 +1002,44 @@ func Close(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 	return 0, nil, handleIOError(t, false /* partial */, err, syscall.EINTR, "close", file)
 }
 
+// CloseRange implements linux syscall close_range(2).
+func CloseRange(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	first := args[0].Uint()
+	last := args[1].Uint()
+	flags := args[2].Uint()
+
+	if flags&^(linux.CLOSE_RANGE_UNSHARE|linux.CLOSE_RANGE_CLOEXEC) != 0 || first > last {
+		return 0, nil, syserror.EINVAL
+	}
+	if first > math.MaxInt32 {
+		// No valid FDs are in the range.
+		return 0, nil, nil
+	}
+	if last > math.MaxInt32 {
+		last = math.MaxInt32
+	}
+
+	// Operate on a private copy of the FD table, so that other tasks
+	// sharing it are unaffected.
+	if flags&linux.CLOSE_RANGE_UNSHARE != 0 {
+		if err := t.Unshare(&kernel.SharingOptions{NewFiles: true}); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if flags&linux.CLOSE_RANGE_CLOEXEC != 0 {
+		t.FDMap().SetFlagsRange(kdefs.FD(first), kdefs.FD(last), kernel.FDFlags{CloseOnExec: true})
+		return 0, nil, nil
+	}
+
+	// As in Linux, errors from closing individual files are ignored.
+	for _, file := range t.FDMap().RemoveRange(kdefs.FD(first), kdefs.FD(last)) {
+		file.Flush(t)
+		file.DecRef()
+	}
+	return 0, nil, nil
+}
+
 // Dup implements linux syscall dup(2).
 func Dup(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	fd := kdefs.FD(args[0].Int())
@@ -811,6 +1147,16 @@ func Fcntl(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 	}
 	defer file.DecRef()
 
+	// Only a few commands are allowed on O_PATH files, see
+	// fs/fcntl.c:check_fcntl_cmd.
+	if file.Flags().Path {
+		switch cmd {
+		case linux.F_DUPFD, linux.F_DUPFD_CLOEXEC, linux.F_GETFD, linux.F_SETFD, linux.F_GETFL:
+		default:
+			return 0, nil, syserror.EBADF
+		}
+	}
+
 	switch cmd {
 	case linux.F_DUPFD, linux.F_DUPFD_CLOEXEC:
 		from := kdefs.FD(args[2].Int())
@@ -977,6 +1323,11 @@ func Fadvise64(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sys
 	}
 	defer file.DecRef()
 
+	// O_PATH files can't be used for I/O.
+	if file.Flags().Path {
+		return 0, nil, syserror.EBADF
+	}
+
 	// If the FD refers to a pipe or FIFO, return error.
 	if fs.IsPipe(file.Dirent.Inode.StableAttr) {
 		return 0, nil, syserror.ESPIPE
@@ -1278,7 +1629,7 @@ func Linkat(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 }
 
 func readlinkAt(t *kernel.Task, dirFD kdefs.FD, addr usermem.Addr, bufAddr usermem.Addr, size uint) (copied uintptr, err error) {
-	path, dirPath, err := copyInPath(t, addr, false /* allowEmpty */)
+	path, dirPath, err := copyInPath(t, addr, true /* allowEmpty */)
 	if err != nil {
 		return 0, err
 	}
@@ -1286,35 +1637,56 @@ func readlinkAt(t *kernel.Task, dirFD kdefs.FD, addr usermem.Addr, bufAddr userm
 		return 0, syserror.ENOENT
 	}
 
-	err = fileOpOn(t, dirFD, path, false /* resolve */, func(root *fs.Dirent, d *fs.Dirent) error {
-		// Check for Read permission.
-		if err := d.Inode.CheckPermission(t, fs.PermMask{Read: true}); err != nil {
-			return err
-		}
-
-		s, err := d.Inode.Readlink(t)
-		if err == syserror.ENOLINK {
-			return syserror.EINVAL
+	if path == "" {
+		// An empty path refers to dirFD itself, which must be a symlink,
+		// i.e. opened with O_PATH|O_NOFOLLOW. The working directory
+		// never is.
+		if dirFD == linux.AT_FDCWD {
+			return 0, syserror.ENOENT
 		}
-		if err != nil {
-			return err
+		file := t.FDMap().GetFile(dirFD)
+		if file == nil {
+			return 0, syserror.EBADF
 		}
+		defer file.DecRef()
 
-		buffer := []byte(s)
-		if uint(len(buffer)) > size {
-			buffer = buffer[:size]
+		if !fs.IsSymlink(file.Dirent.Inode.StableAttr) {
+			return 0, syserror.ENOENT
 		}
+		return readlink(t, file.Dirent, bufAddr, size)
+	}
 
-		n, err := t.CopyOutBytes(bufAddr, buffer)
-
-		// Update frame return value.
-		copied = uintptr(n)
-
+	err = fileOpOn(t, dirFD, path, false /* resolve */, func(root *fs.Dirent, d *fs.Dirent) error {
+		copied, err = readlink(t, d, bufAddr, size)
 		return err
 	})
 	return copied, err // Return frame value.
 }
 
+// readlink copies the target of the symlink d out to bufAddr.
+func readlink(t *kernel.Task, d *fs.Dirent, bufAddr usermem.Addr, size uint) (uintptr, error) {
+	// Check for Read permission.
+	if err := d.Inode.CheckPermission(t, fs.PermMask{Read: true}); err != nil {
+		return 0, err
+	}
+
+	s, err := d.Inode.Readlink(t)
+	if err == syserror.ENOLINK {
+		return 0, syserror.EINVAL
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	buffer := []byte(s)
+	if uint(len(buffer)) > size {
+		buffer = buffer[:size]
+	}
+
+	n, err := t.CopyOutBytes(bufAddr, buffer)
+	return uintptr(n), err
+}
+
 // Readlink implements linux syscall readlink(2).
 func Readlink(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	addr := args[0].Pointer()
@@ -1436,6 +1808,11 @@ func Ftruncate(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sys
 	}
 	defer file.DecRef()
 
+	// O_PATH files can't be truncated.
+	if file.Flags().Path {
+		return 0, nil, syserror.EBADF
+	}
+
 	// Reject truncation if the file flags do not permit this operation.
 	// This is different from truncate(2) above.
 	if !file.Flags().Write {
@@ -1597,6 +1974,11 @@ func Fchown(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 	}
 	defer file.DecRef()
 
+	// O_PATH files can't be used to change ownership.
+	if file.Flags().Path {
+		return 0, nil, syserror.EBADF
+	}
+
 	return 0, nil, chown(t, file.Dirent, uid, gid)
 }
 
@@ -1662,6 +2044,11 @@ func Fchmod(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 	}
 	defer file.DecRef()
 
+	// O_PATH files can't be used to change permissions.
+	if file.Flags().Path {
+		return 0, nil, syserror.EBADF
+	}
+
 	return 0, nil, chmod(t, file.Dirent, mode)
 }
 
@@ -1930,6 +2317,11 @@ func Flock(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 	}
 	defer file.DecRef()
 
+	// O_PATH files can't be locked.
+	if file.Flags().Path {
+		return 0, nil, syserror.EBADF
+	}
+
 	nonblocking := operation&linux.LOCK_NB != 0
 	operation &^= linux.LOCK_NB
 
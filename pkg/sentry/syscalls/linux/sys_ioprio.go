@@ -0,0 +1,167 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+import (
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+// ioprioTargets returns the tasks that ioprio_get(2) and ioprio_set(2) apply
+// to for which and who.
+func ioprioTargets(t *kernel.Task, which, who int32) ([]*kernel.Task, error) {
+	pidns := t.PIDNamespace()
+	switch which {
+	case linux.IOPRIO_WHO_PROCESS:
+		target := t
+		if who != 0 {
+			target = pidns.TaskWithID(kernel.ThreadID(who))
+		}
+		if target == nil {
+			return nil, syserror.ESRCH
+		}
+		return []*kernel.Task{target}, nil
+
+	case linux.IOPRIO_WHO_PGRP:
+		pg := t.ThreadGroup().ProcessGroup()
+		if who != 0 {
+			pg = pidns.ProcessGroupWithID(kernel.ProcessGroupID(who))
+		}
+		if pg == nil {
+			return nil, syserror.ESRCH
+		}
+		var tasks []*kernel.Task
+		for _, task := range pidns.Tasks() {
+			if task.ThreadGroup().ProcessGroup() == pg {
+				tasks = append(tasks, task)
+			}
+		}
+		return tasks, nil
+
+	case linux.IOPRIO_WHO_USER:
+		creds := t.Credentials()
+		kuid := creds.RealKUID
+		if who != 0 {
+			kuid = creds.UserNamespace.MapToKUID(auth.UID(who))
+			if !kuid.Ok() {
+				return nil, syserror.ESRCH
+			}
+		}
+		var tasks []*kernel.Task
+		for _, task := range pidns.Tasks() {
+			if task.Credentials().RealKUID == kuid {
+				tasks = append(tasks, task)
+			}
+		}
+		return tasks, nil
+
+	default:
+		return nil, syserror.EINVAL
+	}
+}
+
+// ioprioBest returns the higher of two I/O priorities. Priorities without a
+// class are treated as the default best-effort level. See
+// block/ioprio.c:ioprio_best.
+func ioprioBest(a, b int32) int32 {
+	if a>>linux.IOPRIO_CLASS_SHIFT == linux.IOPRIO_CLASS_NONE {
+		a = linux.IOPRIO_CLASS_BE<<linux.IOPRIO_CLASS_SHIFT | linux.IOPRIO_NORM
+	}
+	if b>>linux.IOPRIO_CLASS_SHIFT == linux.IOPRIO_CLASS_NONE {
+		b = linux.IOPRIO_CLASS_BE<<linux.IOPRIO_CLASS_SHIFT | linux.IOPRIO_NORM
+	}
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// IoprioSet implements linux syscall ioprio_set(2).
+//
+// I/O priorities are recorded for ioprio_get(2), but do not affect how I/O is
+// scheduled.
+func IoprioSet(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	which := args[0].Int()
+	who := args[1].Int()
+	ioprio := args[2].Int()
+
+	class := ioprio >> linux.IOPRIO_CLASS_SHIFT
+	data := ioprio & linux.IOPRIO_PRIO_MASK
+	switch class {
+	case linux.IOPRIO_CLASS_RT:
+		if !t.HasCapability(linux.CAP_SYS_ADMIN) {
+			return 0, nil, syserror.EPERM
+		}
+		fallthrough
+	case linux.IOPRIO_CLASS_BE:
+		if data >= linux.IOPRIO_BE_NR {
+			return 0, nil, syserror.EINVAL
+		}
+	case linux.IOPRIO_CLASS_IDLE:
+	case linux.IOPRIO_CLASS_NONE:
+		if data != 0 {
+			return 0, nil, syserror.EINVAL
+		}
+	default:
+		return 0, nil, syserror.EINVAL
+	}
+
+	tasks, err := ioprioTargets(t, which, who)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(tasks) == 0 {
+		return 0, nil, syserror.ESRCH
+	}
+
+	// From block/ioprio.c:set_task_ioprio: the caller's real or effective
+	// UID must match the target's real UID, unless the caller has
+	// CAP_SYS_NICE.
+	creds := t.Credentials()
+	for _, task := range tasks {
+		tcreds := task.Credentials()
+		if tcreds.RealKUID != creds.EffectiveKUID && tcreds.RealKUID != creds.RealKUID && !t.HasCapability(linux.CAP_SYS_NICE) {
+			return 0, nil, syserror.EPERM
+		}
+		task.SetIOPriority(ioprio)
+	}
+	return 0, nil, nil
+}
+
+// IoprioGet implements linux syscall ioprio_get(2).
+func IoprioGet(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	which := args[0].Int()
+	who := args[1].Int()
+
+	tasks, err := ioprioTargets(t, which, who)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(tasks) == 0 {
+		return 0, nil, syserror.ESRCH
+	}
+
+	if which == linux.IOPRIO_WHO_PROCESS {
+		return uintptr(tasks[0].IOPriority()), nil, nil
+	}
+	ioprio := tasks[0].IOPriority()
+	for _, task := range tasks[1:] {
+		ioprio = ioprioBest(ioprio, task.IOPriority())
+	}
+	return uintptr(ioprio), nil, nil
+}
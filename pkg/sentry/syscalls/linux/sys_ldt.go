@@ -0,0 +1,77 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build amd64
+
+package linux
+
+import (
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+// readDefaultLDTSize is the number of bytes copied out by modify_ldt(2)
+// function 2, as in Linux's arch/x86/kernel/ldt.c:read_default_ldt().
+const readDefaultLDTSize = 128
+
+// ModifyLDT implements linux syscall modify_ldt(2).
+//
+// Note that Linux returns an int from modify_ldt, so errors are not
+// sign-extended to 64 bits for callers that inspect the raw return value.
+// We return errors normally, which is indistinguishable to libc wrappers.
+func ModifyLDT(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	fn := args[0].Int()
+	addr := args[1].Pointer()
+	bytecount := args[2].Uint64()
+
+	switch fn {
+	case linux.MODIFY_LDT_READ:
+		buf := t.MemoryManager().ReadLDT(bytecount)
+		if len(buf) == 0 {
+			return 0, nil, nil
+		}
+		if _, err := t.CopyOutBytes(addr, buf); err != nil {
+			return 0, nil, syserror.EFAULT
+		}
+		return uintptr(len(buf)), nil, nil
+
+	case linux.MODIFY_LDT_READ_DEFAULT:
+		size := bytecount
+		if size > readDefaultLDTSize {
+			size = readDefaultLDTSize
+		}
+		if _, err := t.CopyOutBytes(addr, make([]byte, size)); err != nil {
+			return 0, nil, syserror.EFAULT
+		}
+		return uintptr(size), nil, nil
+
+	case linux.MODIFY_LDT_WRITE_OLD, linux.MODIFY_LDT_WRITE:
+		if bytecount != linux.SizeOfUserDesc {
+			return 0, nil, syserror.EINVAL
+		}
+		var info linux.UserDesc
+		if _, err := t.CopyIn(addr, &info); err != nil {
+			return 0, nil, syserror.EFAULT
+		}
+		if err := t.MemoryManager().WriteLDT(&info, fn == linux.MODIFY_LDT_WRITE_OLD); err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, nil
+
+	default:
+		return 0, nil, syserror.ENOSYS
+	}
+}
@@ -15,8 +15,6 @@
 package linux
 
 import (
-	"bytes"
-
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
@@ -42,13 +40,24 @@ func Mmap(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallC
 	flags := args[3].Int()
 	fd := kdefs.FD(args[4].Int())
 	fixed := flags&linux.MAP_FIXED != 0
+	noReplace := flags&linux.MAP_FIXED_NOREPLACE != 0
 	private := flags&linux.MAP_PRIVATE != 0
 	shared := flags&linux.MAP_SHARED != 0
 	anon := flags&linux.MAP_ANONYMOUS != 0
 	map32bit := flags&linux.MAP_32BIT != 0
-
-	// Require exactly one of MAP_PRIVATE and MAP_SHARED.
-	if private == shared {
+	droppable := flags&linux.MAP_TYPE == linux.MAP_DROPPABLE
+	hugetlb := flags&linux.MAP_HUGETLB != 0
+
+	// MAP_DROPPABLE mappings are private anonymous mappings that are wiped,
+	// rather than copied, on fork. The sentry never drops their pages
+	// under memory pressure, which applications must tolerate anyway.
+	if droppable {
+		if !anon {
+			return 0, nil, syserror.EINVAL
+		}
+		private = true
+	} else if private == shared {
+		// Require exactly one of MAP_PRIVATE and MAP_SHARED.
 		return 0, nil, syserror.EINVAL
 	}
 
@@ -56,8 +65,8 @@ func Mmap(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallC
 		Length:   args[1].Uint64(),
 		Offset:   args[5].Uint64(),
 		Addr:     args[0].Pointer(),
-		Fixed:    fixed,
-		Unmap:    fixed,
+		Fixed:    fixed || noReplace,
+		Unmap:    fixed && !noReplace,
 		Map32Bit: map32bit,
 		Private:  private,
 		Perms: usermem.AccessType{
@@ -65,13 +74,26 @@ func Mmap(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallC
 			Write:   linux.PROT_WRITE&prot != 0,
 			Execute: linux.PROT_EXEC&prot != 0,
 		},
-		MaxPerms:  usermem.AnyAccess,
-		GrowsDown: linux.MAP_GROWSDOWN&flags != 0,
-		Precommit: linux.MAP_POPULATE&flags != 0,
+		MaxPerms:   usermem.AnyAccess,
+		GrowsDown:  linux.MAP_GROWSDOWN&flags != 0,
+		Precommit:  linux.MAP_POPULATE&flags != 0,
+		WipeOnFork: droppable,
 	}
 	if linux.MAP_LOCKED&flags != 0 {
 		opts.MLockMode = memmap.MLockEager
 	}
+	if hugetlb && anon {
+		// Only the default huge page size is supported.
+		if shift := (flags >> linux.MAP_HUGE_SHIFT) & linux.MAP_HUGE_MASK; shift != 0 && shift != usermem.HugePageShift {
+			return 0, nil, syserror.EINVAL
+		}
+		length, ok := usermem.Addr(opts.Length).HugeRoundUp()
+		if !ok {
+			return 0, nil, syserror.ENOMEM
+		}
+		opts.Length = uint64(length)
+		opts.Hugetlb = true
+	}
 	defer func() {
 		if opts.MappingIdentity != nil {
 			opts.MappingIdentity.DecRef()
@@ -87,6 +109,10 @@ func Mmap(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallC
 		defer file.DecRef()
 
 		flags := file.Flags()
+		// O_PATH files can't be mapped.
+		if flags.Path {
+			return 0, nil, syserror.EBADF
+		}
 		// mmap unconditionally requires that the FD is readable.
 		if !flags.Read {
 			return 0, nil, syserror.EACCES
@@ -99,6 +125,11 @@ func Mmap(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallC
 		if err := file.ConfigureMMap(t, &opts); err != nil {
 			return 0, nil, err
 		}
+		// Files on hugetlbfs are always mapped with huge pages; other files
+		// can't be.
+		if hugetlb && !opts.Hugetlb {
+			return 0, nil, syserror.EINVAL
+		}
 	}
 
 	rv, err := t.MemoryManager().MMap(t, opts)
@@ -118,11 +149,17 @@ func Mremap(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 	flags := args[3].Uint64()
 	newAddr := args[4].Pointer()
 
-	if flags&^(linux.MREMAP_MAYMOVE|linux.MREMAP_FIXED) != 0 {
+	if flags&^(linux.MREMAP_MAYMOVE|linux.MREMAP_FIXED|linux.MREMAP_DONTUNMAP) != 0 {
 		return 0, nil, syserror.EINVAL
 	}
 	mayMove := flags&linux.MREMAP_MAYMOVE != 0
 	fixed := flags&linux.MREMAP_FIXED != 0
+	dontUnmap := flags&linux.MREMAP_DONTUNMAP != 0
+	// MREMAP_DONTUNMAP requires MREMAP_MAYMOVE, and does not allow resizing.
+	// Like Linux, compare sizes before rounding.
+	if dontUnmap && (!mayMove || oldSize != newSize) {
+		return 0, nil, syserror.EINVAL
+	}
 	var moveMode mm.MRemapMoveMode
 	switch {
 	case !mayMove && !fixed:
@@ -138,8 +175,9 @@ func Mremap(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 	}
 
 	rv, err := t.MemoryManager().MRemap(t, oldAddr, oldSize, newSize, mm.MRemapOpts{
-		Move:    moveMode,
-		NewAddr: newAddr,
+		Move:      moveMode,
+		NewAddr:   newAddr,
+		DontUnmap: dontUnmap,
 	})
 	return uintptr(rv), nil, err
 }
@@ -180,6 +218,8 @@ func Madvise(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysca
 	switch adv {
 	case linux.MADV_DONTNEED:
 		return 0, nil, t.MemoryManager().Decommit(addr, length)
+	case linux.MADV_FREE:
+		return 0, nil, t.MemoryManager().LazyFree(addr, length)
 	case linux.MADV_HUGEPAGE, linux.MADV_NOHUGEPAGE:
 		fallthrough
 	case linux.MADV_MERGEABLE, linux.MADV_UNMERGEABLE:
@@ -223,8 +263,7 @@ func GetMempolicy(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.
 	nodeFlag := flags&linux.MPOL_F_NODE != 0
 	addrFlag := flags&linux.MPOL_F_ADDR != 0
 
-	// TODO: Once sysfs is implemented, report a single numa node in
-	// /sys/devices/system/node.
+	// We report a single numa node, consistent with /sys/devices/system/node.
 	if nodemask != 0 && maxnode < 1 {
 		return 0, nil, syserror.EINVAL
 	}
@@ -277,9 +316,15 @@ func GetMempolicy(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.
 				return 0, nil, syserror.EFAULT
 			}
 		} else {
-			storedPolicy, _ := t.NumaPolicy()
 			// Return the policy governing the memory referenced by 'addr'.
-			if _, err := copyOutIfNotNull(t, mode, int32(storedPolicy)); err != nil {
+			storedPolicy, storedNodemask, err := t.MemoryManager().NumaPolicy(addr)
+			if err != nil {
+				return 0, nil, err
+			}
+			if _, err := copyOutIfNotNull(t, mode, storedPolicy); err != nil {
+				return 0, nil, syserror.EFAULT
+			}
+			if _, err := copyOutIfNotNull(t, nodemask, storedNodemask); err != nil {
 				return 0, nil, syserror.EFAULT
 			}
 		}
@@ -305,43 +350,54 @@ func allowedNodesMask() uint32 {
 	return ^uint32((1 << maxNodes) - 1)
 }
 
-// SetMempolicy implements the syscall set_mempolicy(2).
-func SetMempolicy(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
-	modeWithFlags := args[0].Int()
-	nodemask := args[1].Pointer()
-	maxnode := args[2].Uint()
-
+// copyInMempolicyNodemask validates the policy modeWithFlags and copies in the
+// node mask, for set_mempolicy(2) and mbind(2).
+func copyInMempolicyNodemask(t *kernel.Task, modeWithFlags int32, nodemask usermem.Addr, maxnode uint32) (uint32, error) {
 	if nodemask != 0 && maxnode < 1 {
-		return 0, nil, syserror.EINVAL
+		return 0, syserror.EINVAL
 	}
 
 	if modeWithFlags&linux.MPOL_MODE_FLAGS == linux.MPOL_MODE_FLAGS {
 		// Can't specify multiple modes simultaneously.
-		return 0, nil, syserror.EINVAL
+		return 0, syserror.EINVAL
 	}
 
 	mode := modeWithFlags &^ linux.MPOL_MODE_FLAGS
 	if mode < 0 || mode >= linux.MPOL_MAX {
 		// Must specify a valid mode.
-		return 0, nil, syserror.EINVAL
+		return 0, syserror.EINVAL
 	}
 
 	var nodemaskVal uint32
 	// Nodemask may be empty for some policy modes.
 	if nodemask != 0 && maxnode > 0 {
 		if _, err := t.CopyIn(nodemask, &nodemaskVal); err != nil {
-			return 0, nil, syserror.EFAULT
+			return 0, syserror.EFAULT
 		}
 	}
 
 	if (mode == linux.MPOL_INTERLEAVE || mode == linux.MPOL_BIND) && nodemaskVal == 0 {
 		// Mode requires a non-empty nodemask, but got an empty nodemask.
-		return 0, nil, syserror.EINVAL
+		return 0, syserror.EINVAL
 	}
 
 	if nodemaskVal&allowedNodesMask() != 0 {
 		// Invalid node specified.
-		return 0, nil, syserror.EINVAL
+		return 0, syserror.EINVAL
+	}
+
+	return nodemaskVal, nil
+}
+
+// SetMempolicy implements the syscall set_mempolicy(2).
+func SetMempolicy(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	modeWithFlags := args[0].Int()
+	nodemask := args[1].Pointer()
+	maxnode := args[2].Uint()
+
+	nodemaskVal, err := copyInMempolicyNodemask(t, modeWithFlags, nodemask, maxnode)
+	if err != nil {
+		return 0, nil, err
 	}
 
 	t.SetNumaPolicy(int32(modeWithFlags), nodemaskVal)
@@ -349,6 +405,37 @@ func SetMempolicy(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.
 	return 0, nil, nil
 }
 
+// Mbind implements the syscall mbind(2).
+func Mbind(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	addr := args[0].Pointer()
+	length := args[1].Uint64()
+	modeWithFlags := args[2].Int()
+	nodemask := args[3].Pointer()
+	maxnode := args[4].Uint()
+	flags := args[5].Uint()
+
+	if flags&^linux.MPOL_MF_VALID != 0 {
+		return 0, nil, syserror.EINVAL
+	}
+	// "If MPOL_MF_MOVE_ALL is passed in flags, then the kernel will attempt
+	// to move all existing pages in the memory range regardless of whether
+	// other processes use the pages. The calling thread must be privileged
+	// (CAP_SYS_NICE) to use this flag." - mbind(2)
+	if flags&linux.MPOL_MF_MOVE_ALL != 0 && !t.HasCapability(linux.CAP_SYS_NICE) {
+		return 0, nil, syserror.EPERM
+	}
+
+	nodemaskVal, err := copyInMempolicyNodemask(t, modeWithFlags, nodemask, maxnode)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Since we only have a single node, all pages are already on an allowed
+	// node, so MPOL_MF_STRICT and MPOL_MF_MOVE* never fail and never move
+	// anything.
+	return 0, nil, t.MemoryManager().SetNumaPolicy(addr, length, modeWithFlags, nodemaskVal)
+}
+
 // Mincore implements the syscall mincore(2).
 func Mincore(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	addr := args[0].Pointer()
@@ -370,14 +457,11 @@ func Mincore(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysca
 		return 0, nil, syserror.ENOMEM
 	}
 
-	// Pretend that all mapped pages are "resident in core".
-	mapped := t.MemoryManager().VirtualMemorySizeRange(ar)
-	// "ENOMEM: addr to addr + length contained unmapped memory."
-	if mapped != uint64(la) {
-		return 0, nil, syserror.ENOMEM
+	resident, err := t.MemoryManager().Mincore(t, ar)
+	if err != nil {
+		return 0, nil, err
 	}
-	resident := bytes.Repeat([]byte{1}, int(mapped/usermem.PageSize))
-	_, err := t.CopyOut(vec, resident)
+	_, err = t.CopyOut(vec, resident)
 	return 0, nil, err
 }
 
@@ -69,7 +69,7 @@ func Mount(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 		return 0, nil, syserror.EPERM
 	}
 
-	const unsupportedOps = linux.MS_REMOUNT | linux.MS_BIND |
+	const unsupportedOps = linux.MS_BIND |
 		linux.MS_SHARED | linux.MS_PRIVATE | linux.MS_SLAVE |
 		linux.MS_UNBINDABLE | linux.MS_MOVE
 
@@ -85,6 +85,10 @@ func Mount(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 		return 0, nil, syserror.EINVAL
 	}
 
+	if flags&linux.MS_REMOUNT != 0 {
+		return 0, nil, remount(t, targetPath, flags, data)
+	}
+
 	rsys, ok := fs.FindFilesystem(fsType)
 	if !ok {
 		return 0, nil, syserror.ENODEV
@@ -93,6 +97,19 @@ func Mount(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 		return 0, nil, syserror.EPERM
 	}
 
+	rootInode, err := rsys.Mount(t, sourcePath, mountSourceFlags(flags), data, nil)
+	if err != nil {
+		return 0, nil, syserror.EINVAL
+	}
+
+	return 0, nil, fileOpOn(t, linux.AT_FDCWD, targetPath, true /* resolve */, func(root *fs.Dirent, d *fs.Dirent) error {
+		return t.MountNamespace().Mount(t, d, rootInode)
+	})
+}
+
+// mountSourceFlags returns the MountSourceFlags corresponding to mount(2)
+// flags.
+func mountSourceFlags(flags uint64) fs.MountSourceFlags {
 	var superFlags fs.MountSourceFlags
 	if flags&linux.MS_NOATIME == linux.MS_NOATIME {
 		superFlags.NoAtime = true
@@ -103,14 +120,35 @@ func Mount(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 	if flags&linux.MS_NOEXEC == linux.MS_NOEXEC {
 		superFlags.NoExec = true
 	}
+	return superFlags
+}
 
-	rootInode, err := rsys.Mount(t, sourcePath, superFlags, data, nil)
-	if err != nil {
-		return 0, nil, syserror.EINVAL
-	}
+// remount implements mount(2) with MS_REMOUNT, which reconfigures the
+// existing mount at targetPath using data.
+func remount(t *kernel.Task, targetPath string, flags uint64, data string) error {
+	return fileOpOn(t, linux.AT_FDCWD, targetPath, true /* resolve */, func(root *fs.Dirent, d *fs.Dirent) error {
+		msrc := d.Inode.MountSource
+		mountRoot := msrc.Root()
+		defer mountRoot.DecRef()
+		if mountRoot != d {
+			// Only the root of a mount can be remounted.
+			return syserror.EINVAL
+		}
 
-	return 0, nil, fileOpOn(t, linux.AT_FDCWD, targetPath, true /* resolve */, func(root *fs.Dirent, d *fs.Dirent) error {
-		return t.MountNamespace().Mount(t, d, rootInode)
+		// Changing the flags of an existing mount is not supported.
+		superFlags := mountSourceFlags(flags)
+		if superFlags.ReadOnly != msrc.Flags.ReadOnly || superFlags.NoAtime != msrc.Flags.NoAtime || superFlags.NoExec != msrc.Flags.NoExec {
+			return syserror.EINVAL
+		}
+
+		r, ok := msrc.Filesystem.(fs.Remounter)
+		if !ok {
+			return syserror.EINVAL
+		}
+		if err := r.Remount(t, d.Inode, data); err != nil {
+			return syserror.EINVAL
+		}
+		return nil
 	})
 }
 
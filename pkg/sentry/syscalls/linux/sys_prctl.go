@@ -44,6 +44,18 @@ func Prctl(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 		_, err := t.CopyOut(args[1].Pointer(), int32(t.ParentDeathSignal()))
 		return 0, nil, err
 
+	case linux.PR_SET_CHILD_SUBREAPER:
+		t.ThreadGroup().SetChildSubreaper(args[1].Uint64() != 0)
+		return 0, nil, nil
+
+	case linux.PR_GET_CHILD_SUBREAPER:
+		var isSubreaper int32
+		if t.ThreadGroup().IsChildSubreaper() {
+			isSubreaper = 1
+		}
+		_, err := t.CopyOut(args[1].Pointer(), isSubreaper)
+		return 0, nil, err
+
 	case linux.PR_GET_KEEPCAPS:
 		if t.Credentials().KeepCaps {
 			return 1, nil, nil
@@ -184,8 +196,6 @@ func Prctl(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 		linux.PR_MCE_KILL,
 		linux.PR_MCE_KILL_GET,
 		linux.PR_GET_TID_ADDRESS,
-		linux.PR_SET_CHILD_SUBREAPER,
-		linux.PR_GET_CHILD_SUBREAPER,
 		linux.PR_GET_THP_DISABLE,
 		linux.PR_SET_THP_DISABLE,
 		linux.PR_MPX_ENABLE_MANAGEMENT,
@@ -25,21 +25,27 @@ import (
 
 func getrusage(t *kernel.Task, which int32) linux.Rusage {
 	var cs usage.CPUStats
+	var io usage.IO
 
 	switch which {
 	case linux.RUSAGE_SELF:
 		cs = t.ThreadGroup().CPUStats()
+		io.Accumulate(t.ThreadGroup().IOUsage())
 
 	case linux.RUSAGE_CHILDREN:
 		cs = t.ThreadGroup().JoinedChildCPUStats()
+		io.Accumulate(t.ThreadGroup().JoinedChildIOUsage())
 
 	case linux.RUSAGE_THREAD:
 		cs = t.CPUStats()
+		io.Accumulate(t.IOUsage())
 
 	case linux.RUSAGE_BOTH:
 		tg := t.ThreadGroup()
 		cs = tg.CPUStats()
 		cs.Accumulate(tg.JoinedChildCPUStats())
+		io.Accumulate(tg.IOUsage())
+		io.Accumulate(tg.JoinedChildIOUsage())
 	}
 
 	return linux.Rusage{
@@ -47,6 +53,12 @@ func getrusage(t *kernel.Task, which int32) linux.Rusage {
 		STime:  linux.NsecToTimeval(cs.SysTime.Nanoseconds()),
 		NVCSw:  int64(cs.VoluntarySwitches),
 		MaxRSS: int64(t.MaxRSS(which) / 1024),
+		MinFlt: int64(cs.MinorFaults),
+		MajFlt: int64(cs.MajorFaults),
+		// Block operations are counted in 512-byte units, as in Linux's
+		// include/linux/task_io_accounting_ops.h.
+		InBlock: int64(io.BytesRead / 512),
+		OuBlock: int64(io.BytesWritten / 512),
 	}
 }
 
@@ -61,11 +73,11 @@ func getrusage(t *kernel.Task, which int32) linux.Rusage {
 //	*    long   ru_ixrss;         /* integral shared memory size */
 //	*    long   ru_idrss;         /* integral unshared data size */
 //	*    long   ru_isrss;         /* integral unshared stack size */
-//	p    long   ru_minflt;        /* page reclaims (soft page faults) */
-//	p    long   ru_majflt;        /* page faults (hard page faults) */
+//	y    long   ru_minflt;        /* page reclaims (soft page faults) */
+//	y    long   ru_majflt;        /* page faults (hard page faults) */
 //	*    long   ru_nswap;         /* swaps */
-//	p    long   ru_inblock;       /* block input operations */
-//	p    long   ru_oublock;       /* block output operations */
+//	y    long   ru_inblock;       /* block input operations */
+//	y    long   ru_oublock;       /* block output operations */
 //	*    long   ru_msgsnd;        /* IPC messages sent */
 //	*    long   ru_msgrcv;        /* IPC messages received */
 //	*    long   ru_nsignals;      /* signals received */
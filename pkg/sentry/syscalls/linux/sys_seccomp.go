@@ -24,20 +24,6 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
 )
 
-// userSockFprog is equivalent to Linux's struct sock_fprog on amd64.
-type userSockFprog struct {
-	// Len is the length of the filter in BPF instructions.
-	Len uint16
-
-	_ [6]byte // padding for alignment
-
-	// Filter is a user pointer to the struct sock_filter array that makes up
-	// the filter program. Filter is a uint64 rather than a usermem.Addr
-	// because usermem.Addr is actually uintptr, which is not a fixed-size
-	// type, and encoding/binary.Read objects to this.
-	Filter uint64
-}
-
 // seccomp applies a seccomp policy to the current task.
 func seccomp(t *kernel.Task, mode, flags uint64, addr usermem.Addr) error {
 	// We only support SECCOMP_SET_MODE_FILTER at the moment.
@@ -54,7 +40,7 @@ func seccomp(t *kernel.Task, mode, flags uint64, addr usermem.Addr) error {
 		return syscall.EINVAL
 	}
 
-	var fprog userSockFprog
+	var fprog linux.SockFprog
 	if _, err := t.CopyIn(addr, &fprog); err != nil {
 		return err
 	}
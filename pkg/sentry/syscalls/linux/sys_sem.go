@@ -16,6 +16,7 @@ package linux
 
 import (
 	"math"
+	"time"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
@@ -26,8 +27,6 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
 )
 
-const opsMax = 500 // SEMOPM
-
 // Semget handles: semget(key_t key, int nsems, int semflg)
 func Semget(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	key := args[0].Int()
@@ -53,34 +52,63 @@ func Semop(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 	sembufAddr := args[1].Pointer()
 	nsops := args[2].SizeT()
 
+	return 0, nil, semTimedOp(t, id, sembufAddr, nsops, false, 0)
+}
+
+// Semtimedop handles: semtimedop(int semid, struct sembuf *sops, size_t nsops,
+// const struct timespec *timeout)
+func Semtimedop(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	id := args[0].Int()
+	sembufAddr := args[1].Pointer()
+	nsops := args[2].SizeT()
+	timespecAddr := args[3].Pointer()
+
+	timeout, err := copyTimespecInToDuration(t, timespecAddr)
+	if err != nil {
+		return 0, nil, err
+	}
+	return 0, nil, semTimedOp(t, id, sembufAddr, nsops, timeout >= 0, timeout)
+}
+
+// semTimedOp implements semop(2) and semtimedop(2). If haveTimeout is true,
+// the operations fail with EAGAIN if they can't be performed before timeout
+// elapses.
+func semTimedOp(t *kernel.Task, id int32, sembufAddr usermem.Addr, nsops uint, haveTimeout bool, timeout time.Duration) error {
 	r := t.IPCNamespace().SemaphoreRegistry()
-	set := r.FindByID(id)
-	if set == nil {
-		return 0, nil, syserror.EINVAL
+	if nsops == 0 {
+		return syserror.EINVAL
 	}
-	if nsops <= 0 {
-		return 0, nil, syserror.EINVAL
+	if nsops > uint(r.Limits().OpsMax) {
+		return syserror.E2BIG
 	}
-	if nsops > opsMax {
-		return 0, nil, syserror.E2BIG
+	set := r.FindByID(id)
+	if set == nil {
+		return syserror.EINVAL
 	}
 
 	ops := make([]linux.Sembuf, nsops)
 	if _, err := t.CopyIn(sembufAddr, ops); err != nil {
-		return 0, nil, err
+		return err
 	}
 
 	creds := auth.CredentialsFromContext(t)
 	pid := t.Kernel().GlobalInit().PIDNamespace().IDOfThreadGroup(t.ThreadGroup())
+	undo := t.ThreadGroup().SemUndoList()
 	for {
-		ch, num, err := set.ExecuteOps(t, ops, creds, int32(pid))
+		ch, num, err := set.ExecuteOps(t, ops, creds, int32(pid), undo)
 		if ch == nil || err != nil {
 			// We're done (either on success or a failure).
-			return 0, nil, err
+			return err
 		}
-		if err = t.Block(ch); err != nil {
+		if timeout, err = t.BlockWithTimeout(ch, haveTimeout, timeout); err != nil {
 			set.AbortWait(num, ch)
-			return 0, nil, err
+			if err == syserror.ETIMEDOUT {
+				// "The time limit specified in the timeout argument to
+				// semtimedop() expired before the requested operation could
+				// be performed." - man semop(2)
+				return syserror.EAGAIN
+			}
+			return err
 		}
 	}
 }
@@ -128,16 +156,50 @@ func Semctl(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 		v, err := getPID(t, id, num)
 		return uintptr(v), nil, err
 
-	case linux.IPC_INFO,
-		linux.SEM_INFO,
-		linux.IPC_STAT,
-		linux.SEM_STAT,
-		linux.SEM_STAT_ANY,
-		linux.GETNCNT,
-		linux.GETZCNT:
+	case linux.GETNCNT:
+		v, err := getNCnt(t, id, num)
+		return uintptr(v), nil, err
 
-		t.Kernel().EmitUnimplementedEvent(t)
-		fallthrough
+	case linux.GETZCNT:
+		v, err := getZCnt(t, id, num)
+		return uintptr(v), nil, err
+
+	case linux.IPC_STAT, linux.SEM_STAT, linux.SEM_STAT_ANY:
+		// As for shmctl(SHM_STAT), set IDs double as indices for SEM_STAT and
+		// SEM_STAT_ANY.
+		arg := args[3].Pointer()
+		r := t.IPCNamespace().SemaphoreRegistry()
+		set := r.FindByID(id)
+		if set == nil {
+			return 0, nil, syserror.EINVAL
+		}
+		creds := auth.CredentialsFromContext(t)
+		var ds *linux.SemidDS
+		if cmd == linux.SEM_STAT_ANY {
+			ds = set.Stat(creds)
+		} else {
+			var err error
+			if ds, err = set.GetStat(creds); err != nil {
+				return 0, nil, err
+			}
+		}
+		if _, err := t.CopyOut(arg, ds); err != nil {
+			return 0, nil, err
+		}
+		if cmd == linux.IPC_STAT {
+			return 0, nil, nil
+		}
+		// SEM_STAT and SEM_STAT_ANY return the semid of the set.
+		return uintptr(set.ID), nil, nil
+
+	case linux.IPC_INFO, linux.SEM_INFO:
+		arg := args[3].Pointer()
+		r := t.IPCNamespace().SemaphoreRegistry()
+		info := r.IPCInfo(cmd == linux.SEM_INFO)
+		if _, err := t.CopyOut(arg, info); err != nil {
+			return 0, nil, err
+		}
+		return uintptr(r.HighestID()), nil, nil
 
 	default:
 		return 0, nil, syserror.EINVAL
@@ -221,6 +283,26 @@ func getValAll(t *kernel.Task, id int32, array usermem.Addr) error {
 	return err
 }
 
+func getNCnt(t *kernel.Task, id int32, num int32) (int32, error) {
+	r := t.IPCNamespace().SemaphoreRegistry()
+	set := r.FindByID(id)
+	if set == nil {
+		return 0, syserror.EINVAL
+	}
+	creds := auth.CredentialsFromContext(t)
+	return set.GetNCnt(num, creds)
+}
+
+func getZCnt(t *kernel.Task, id int32, num int32) (int32, error) {
+	r := t.IPCNamespace().SemaphoreRegistry()
+	set := r.FindByID(id)
+	if set == nil {
+		return 0, syserror.EINVAL
+	}
+	creds := auth.CredentialsFromContext(t)
+	return set.GetZCnt(num, creds)
+}
+
 func getPID(t *kernel.Task, id int32, num int32) (int32, error) {
 	r := t.IPCNamespace().SemaphoreRegistry()
 	set := r.FindByID(id)
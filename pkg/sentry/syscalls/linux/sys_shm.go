@@ -93,34 +93,46 @@ func Shmctl(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 	r := t.IPCNamespace().ShmRegistry()
 
 	switch cmd {
-	case linux.SHM_STAT:
-		// Technically, we should be treating id as "an index into the kernel's
-		// internal array that maintains information about all shared memory
-		// segments on the system". Since we don't track segments in an array,
-		// we'll just pretend the shmid is the index and do the same thing as
-		// IPC_STAT. Linux also uses the index as the shmid.
-		fallthrough
-	case linux.IPC_STAT:
+	case linux.IPC_STAT, linux.SHM_STAT, linux.SHM_STAT_ANY:
+		// Technically, for SHM_STAT and SHM_STAT_ANY we should be treating id
+		// as "an index into the kernel's internal array that maintains
+		// information about all shared memory segments on the system". Since
+		// we don't track segments in an array, we'll just pretend the shmid is
+		// the index, as the highest index reported by SHM_INFO is the highest
+		// shmid. Linux also uses the index as the shmid.
 		segment, err := findSegment(t, id)
 		if err != nil {
 			return 0, nil, syserror.EINVAL
 		}
 
-		stat, err := segment.IPCStat(t)
-		if err == nil {
-			_, err = t.CopyOut(buf, stat)
+		var stat *linux.ShmidDS
+		if cmd == linux.SHM_STAT_ANY {
+			stat = segment.IPCStatAny(t)
+		} else if stat, err = segment.IPCStat(t); err != nil {
+			return 0, nil, err
 		}
-		return 0, nil, err
+		if _, err := t.CopyOut(buf, stat); err != nil {
+			return 0, nil, err
+		}
+		if cmd == linux.IPC_STAT {
+			return 0, nil, nil
+		}
+		// SHM_STAT and SHM_STAT_ANY return the shmid of the segment.
+		return uintptr(segment.ID), nil, nil
 
 	case linux.IPC_INFO:
 		params := r.IPCInfo()
-		_, err := t.CopyOut(buf, params)
-		return 0, nil, err
+		if _, err := t.CopyOut(buf, params); err != nil {
+			return 0, nil, err
+		}
+		return uintptr(r.HighestID()), nil, nil
 
 	case linux.SHM_INFO:
 		info := r.ShmInfo()
-		_, err := t.CopyOut(buf, info)
-		return 0, nil, err
+		if _, err := t.CopyOut(buf, info); err != nil {
+			return 0, nil, err
+		}
+		return uintptr(r.HighestID()), nil, nil
 	}
 
 	// Remaining commands refer to a specific segment.
@@ -143,12 +155,11 @@ func Shmctl(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 		segment.MarkDestroyed()
 		return 0, nil, nil
 
-	case linux.SHM_LOCK, linux.SHM_UNLOCK:
-		// We currently do not support memory locking anywhere.
-		// mlock(2)/munlock(2) are currently stubbed out as no-ops so do the
-		// same here.
-		t.Kernel().EmitUnimplementedEvent(t)
-		return 0, nil, nil
+	case linux.SHM_LOCK:
+		return 0, nil, segment.SetLocked(t, true)
+
+	case linux.SHM_UNLOCK:
+		return 0, nil, segment.SetLocked(t, false)
 
 	default:
 		return 0, nil, syserror.EINVAL
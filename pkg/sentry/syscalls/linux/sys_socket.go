@@ -29,6 +29,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/control"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/unix/transport"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserr"
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
 )
 
@@ -467,6 +468,12 @@ func GetSockOpt(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sy
 
 	// Call syscall implementation then copy both value and value len out.
 	v, e := s.GetSockOpt(t, int(level), int(name), int(optLen))
+	if e == syserr.ErrRange && v != nil && optLenAddr != 0 {
+		// The value doesn't fit; report the length it needs.
+		if _, err := t.CopyOut(optLenAddr, int32(binary.Size(v))); err != nil {
+			return 0, nil, err
+		}
+	}
 	if e != nil {
 		return 0, nil, e.ToError()
 	}
@@ -689,6 +696,11 @@ func RecvMMsg(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysc
 		}
 	}
 
+	if bs, ok := s.(socket.BatchSocket); ok && flags&linux.MSG_ERRQUEUE == 0 {
+		n, err := recvMMsgBatch(t, bs, msgPtr, vlen, flags, haveDeadline, deadline)
+		return n, nil, err
+	}
+
 	var count uint32
 	var err error
 	for i := uint64(0); i < uint64(vlen); i++ {
@@ -718,6 +730,108 @@ func RecvMMsg(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysc
 	return uintptr(count), nil, nil
 }
 
+// captureMMsgHeaders copies in up to vlen message headers of a recvmmsg or
+// sendmmsg call at msgPtr. As headers are otherwise accessed one message at a
+// time, a failure only matters for the first one: the messages before the
+// failing one are returned.
+func captureMMsgHeaders(t *kernel.Task, msgPtr usermem.Addr, vlen uint32) ([]MessageHeader64, error) {
+	if vlen > linux.UIO_MAXIOV {
+		vlen = linux.UIO_MAXIOV
+	}
+	hdrs := make([]MessageHeader64, 0, vlen)
+	for i := uint64(0); i < uint64(vlen); i++ {
+		mp, ok := msgPtr.AddLength(i * multipleMessageHeader64Len)
+		if !ok {
+			if i == 0 {
+				return nil, syscall.EFAULT
+			}
+			break
+		}
+		var msg MessageHeader64
+		if err := CopyInMessageHeader64(t, mp, &msg); err != nil {
+			if i == 0 {
+				return nil, err
+			}
+			break
+		}
+		hdrs = append(hdrs, msg)
+	}
+	return hdrs, nil
+}
+
+// recvMMsgBatch implements recvmmsg(2) for sockets that can receive several
+// messages at once.
+func recvMMsgBatch(t *kernel.Task, s socket.BatchSocket, msgPtr usermem.Addr, vlen uint32, flags int32, haveDeadline bool, deadline ktime.Time) (uintptr, error) {
+	hdrs, err := captureMMsgHeaders(t, msgPtr, vlen)
+	if err != nil {
+		return 0, err
+	}
+	msgs := make([]socket.MMsg, 0, len(hdrs))
+	for i := range hdrs {
+		dst, err := recvMMsgIOSequence(t, &hdrs[i])
+		if err != nil {
+			if i == 0 {
+				return 0, err
+			}
+			// The messages before the invalid one can still be
+			// received.
+			break
+		}
+		msgs = append(msgs, socket.MMsg{
+			Data:            dst,
+			SenderRequested: hdrs[i].NameLen != 0,
+		})
+	}
+
+	count := 0
+	for count < len(msgs) {
+		n, e := s.RecvMMsg(t, msgs[count:], int(flags), haveDeadline, deadline)
+		if e != nil {
+			err = syserror.ConvertIntr(e.ToError(), kernel.ERESTARTSYS)
+			break
+		}
+
+		received := msgs[count : count+n]
+		for i := range received {
+			m := &received[i]
+			if err == nil {
+				mp := msgPtr + usermem.Addr(uint64(count)*multipleMessageHeader64Len)
+				err = copyOutRecvMsg(t, s, mp, &hdrs[count], flags, m.SenderAddr, m.SenderAddrLen, m.ControlMessages)
+				if err == nil {
+					// Copy the received length to the caller.
+					_, err = t.CopyOut(mp+usermem.Addr(messageHeader64Len), uint32(m.N))
+				}
+				if err == nil {
+					count++
+				}
+			}
+			m.ControlMessages.Unix.Release()
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if count == 0 {
+		return 0, err
+	}
+	return uintptr(count), nil
+}
+
+// recvMMsgIOSequence validates the header of a message to receive with
+// recvmmsg, and returns the IOSequence to receive its data into.
+func recvMMsgIOSequence(t *kernel.Task, msg *MessageHeader64) (usermem.IOSequence, error) {
+	if msg.IovLen > linux.UIO_MAXIOV {
+		return usermem.IOSequence{}, syscall.EMSGSIZE
+	}
+	if msg.ControlLen > maxControlLen {
+		return usermem.IOSequence{}, syscall.ENOBUFS
+	}
+	return t.IovecsIOSequence(usermem.Addr(msg.Iov), int(msg.IovLen), usermem.IOOpts{
+		AddressSpaceActive: true,
+	})
+}
+
 func recvSingleMsg(t *kernel.Task, s socket.Socket, msgPtr usermem.Addr, flags int32, haveDeadline bool, deadline ktime.Time) (uintptr, error) {
 	// Capture the message header and io vectors.
 	var msg MessageHeader64
@@ -735,39 +849,57 @@ func recvSingleMsg(t *kernel.Task, s socket.Socket, msgPtr usermem.Addr, flags i
 		return 0, err
 	}
 
-	// FIXME: Pretend we have an empty error queue.
+	if msg.ControlLen > maxControlLen {
+		return 0, syscall.ENOBUFS
+	}
+
+	var (
+		n         int
+		sender    interface{}
+		senderLen uint32
+		cms       socket.ControlMessages
+		e         *syserr.Error
+	)
 	if flags&linux.MSG_ERRQUEUE != 0 {
-		return 0, syscall.EAGAIN
+		es, ok := s.(socket.ErrQueueSocket)
+		if !ok {
+			// Pretend other sockets have an empty error queue.
+			return 0, syscall.EAGAIN
+		}
+		n, sender, senderLen, cms, e = es.RecvErrQueue(t, dst, msg.NameLen != 0)
+	} else {
+		n, sender, senderLen, cms, e = s.RecvMsg(t, dst, int(flags), haveDeadline, deadline, msg.NameLen != 0, msg.ControlLen)
+	}
+	if e != nil {
+		return 0, syserror.ConvertIntr(e.ToError(), kernel.ERESTARTSYS)
+	}
+	defer cms.Unix.Release()
+
+	if err := copyOutRecvMsg(t, s, msgPtr, &msg, flags, sender, senderLen, cms); err != nil {
+		return 0, err
+	}
+	return uintptr(n), nil
+}
+
+// copyOutRecvMsg copies the sender address, control messages and flags of a
+// received message to its header at msgPtr.
+func copyOutRecvMsg(t *kernel.Task, s socket.Socket, msgPtr usermem.Addr, msg *MessageHeader64, flags int32, sender interface{}, senderLen uint32, cms socket.ControlMessages) error {
+	// TODO: Plumb through actual flags.
+	var msgFlags int32
+	if cms.IP.SockErr != nil {
+		msgFlags = linux.MSG_ERRQUEUE
 	}
 
 	// Fast path when no control message nor name buffers are provided.
 	if msg.ControlLen == 0 && msg.NameLen == 0 {
-		n, _, _, cms, err := s.RecvMsg(t, dst, int(flags), haveDeadline, deadline, false, 0)
-		if err != nil {
-			return 0, syserror.ConvertIntr(err.ToError(), kernel.ERESTARTSYS)
-		}
-		cms.Unix.Release()
-
-		if msg.Flags != 0 {
+		if msg.Flags != msgFlags {
 			// Copy out the flags to the caller.
-			//
-			// TODO: Plumb through actual flags.
-			if _, err := t.CopyOut(msgPtr+flagsOffset, int32(0)); err != nil {
-				return 0, err
+			if _, err := t.CopyOut(msgPtr+flagsOffset, msgFlags); err != nil {
+				return err
 			}
 		}
-
-		return uintptr(n), nil
-	}
-
-	if msg.ControlLen > maxControlLen {
-		return 0, syscall.ENOBUFS
-	}
-	n, sender, senderLen, cms, e := s.RecvMsg(t, dst, int(flags), haveDeadline, deadline, msg.NameLen != 0, msg.ControlLen)
-	if e != nil {
-		return 0, syserror.ConvertIntr(e.ToError(), kernel.ERESTARTSYS)
+		return nil
 	}
-	defer cms.Unix.Release()
 
 	controlData := make([]byte, 0, msg.ControlLen)
 
@@ -780,6 +912,10 @@ func recvSingleMsg(t *kernel.Task, s socket.Socket, msgPtr usermem.Addr, flags i
 		controlData = control.PackTimestamp(t, cms.IP.Timestamp, controlData)
 	}
 
+	if cms.IP.SockErr != nil {
+		controlData = control.PackSockErr(t, cms.IP.SockErr, controlData)
+	}
+
 	if cms.Unix.Rights != nil {
 		controlData = control.PackRights(t, cms.Unix.Rights.(control.SCMRights), flags&linux.MSG_CMSG_CLOEXEC != 0, controlData)
 	}
@@ -787,28 +923,26 @@ func recvSingleMsg(t *kernel.Task, s socket.Socket, msgPtr usermem.Addr, flags i
 	// Copy the address to the caller.
 	if msg.NameLen != 0 {
 		if err := writeAddress(t, sender, senderLen, usermem.Addr(msg.Name), usermem.Addr(msgPtr+nameLenOffset)); err != nil {
-			return 0, err
+			return err
 		}
 	}
 
 	// Copy the control data to the caller.
 	if _, err := t.CopyOut(msgPtr+controlLenOffset, uint64(len(controlData))); err != nil {
-		return 0, err
+		return err
 	}
 	if len(controlData) > 0 {
 		if _, err := t.CopyOut(usermem.Addr(msg.Control), controlData); err != nil {
-			return 0, err
+			return err
 		}
 	}
 
 	// Copy out the flags to the caller.
-	//
-	// TODO: Plumb through actual flags.
-	if _, err := t.CopyOut(msgPtr+flagsOffset, int32(0)); err != nil {
-		return 0, err
+	if _, err := t.CopyOut(msgPtr+flagsOffset, msgFlags); err != nil {
+		return err
 	}
 
-	return uintptr(n), nil
+	return nil
 }
 
 // recvFrom is the implementation of the recvfrom syscall. It is called by
@@ -956,6 +1090,11 @@ func SendMMsg(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysc
 		flags |= linux.MSG_DONTWAIT
 	}
 
+	if bs, ok := s.(socket.BatchSocket); ok {
+		n, err := sendMMsgBatch(t, bs, file, msgPtr, vlen, flags)
+		return n, nil, err
+	}
+
 	var count uint32
 	var err error
 	for i := uint64(0); i < uint64(vlen); i++ {
@@ -985,6 +1124,103 @@ func SendMMsg(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysc
 	return uintptr(count), nil, nil
 }
 
+// sendMMsgBatch implements sendmmsg(2) for sockets that can send several
+// messages at once. Messages carrying control data are sent one at a time.
+func sendMMsgBatch(t *kernel.Task, s socket.BatchSocket, file *fs.File, msgPtr usermem.Addr, vlen uint32, flags int32) (uintptr, error) {
+	hdrs, err := captureMMsgHeaders(t, msgPtr, vlen)
+	if err != nil {
+		return 0, err
+	}
+
+	var haveDeadline bool
+	var deadline ktime.Time
+	if dl := s.SendTimeout(); dl > 0 {
+		deadline = t.Kernel().MonotonicClock().Now().Add(time.Duration(dl) * time.Nanosecond)
+		haveDeadline = true
+	} else if dl < 0 {
+		flags |= linux.MSG_DONTWAIT
+	}
+
+	count := 0
+	for count < len(hdrs) && err == nil {
+		mp := msgPtr + usermem.Addr(uint64(count)*multipleMessageHeader64Len)
+		if hdrs[count].ControlLen > 0 {
+			var n uintptr
+			if n, err = sendSingleMsg(t, s, file, mp, flags); err != nil {
+				break
+			}
+			// Copy the sent length to the caller.
+			if _, err = t.CopyOut(mp+usermem.Addr(messageHeader64Len), uint32(n)); err == nil {
+				count++
+			}
+			continue
+		}
+
+		// Send the messages up to the next one with control data together.
+		var msgs []socket.MMsg
+		for i := count; i < len(hdrs) && hdrs[i].ControlLen == 0; i++ {
+			m, e := sendMMsgMessage(t, &hdrs[i])
+			if e != nil {
+				if len(msgs) == 0 {
+					err = e
+				}
+				break
+			}
+			msgs = append(msgs, m)
+		}
+		if len(msgs) == 0 {
+			break
+		}
+		n, e := s.SendMMsg(t, msgs, int(flags), haveDeadline, deadline)
+		if e != nil {
+			err = handleIOError(t, false, e.ToError(), kernel.ERESTARTSYS, "sendmmsg", file)
+			break
+		}
+		for _, m := range msgs[:n] {
+			// Copy the sent length to the caller.
+			mp := msgPtr + usermem.Addr(uint64(count)*multipleMessageHeader64Len)
+			if _, err = t.CopyOut(mp+usermem.Addr(messageHeader64Len), uint32(m.N)); err != nil {
+				break
+			}
+			count++
+		}
+		if n < len(msgs) {
+			// The socket could not send the whole batch without
+			// blocking; report what was sent.
+			break
+		}
+	}
+
+	if count == 0 {
+		return 0, err
+	}
+	return uintptr(count), nil
+}
+
+// sendMMsgMessage validates the header of a message without control data to
+// send with sendmmsg, and captures its destination address and data.
+func sendMMsgMessage(t *kernel.Task, msg *MessageHeader64) (socket.MMsg, error) {
+	var m socket.MMsg
+	if msg.NameLen != 0 {
+		to, err := CaptureAddress(t, usermem.Addr(msg.Name), msg.NameLen)
+		if err != nil {
+			return m, err
+		}
+		m.To = to
+	}
+	if msg.IovLen > linux.UIO_MAXIOV {
+		return m, syscall.EMSGSIZE
+	}
+	src, err := t.IovecsIOSequence(usermem.Addr(msg.Iov), int(msg.IovLen), usermem.IOOpts{
+		AddressSpaceActive: true,
+	})
+	if err != nil {
+		return m, err
+	}
+	m.Data = src
+	return m, nil
+}
+
 func sendSingleMsg(t *kernel.Task, s socket.Socket, file *fs.File, msgPtr usermem.Addr, flags int32) (uintptr, error) {
 	// Capture the message header.
 	var msg MessageHeader64
@@ -53,6 +53,12 @@ func Fstatat(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysca
 	}
 
 	if path == "" {
+		if fd == linux.AT_FDCWD {
+			wd := t.FSContext().WorkingDirectory()
+			defer wd.DecRef()
+			return 0, nil, stat(t, wd, false, statAddr)
+		}
+
 		// Annoying. What's wrong with fstat?
 		file := t.FDMap().GetFile(fd)
 		if file == nil {
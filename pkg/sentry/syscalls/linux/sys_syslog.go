@@ -15,30 +15,80 @@
 package linux
 
 import (
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
 )
 
 const (
-	_SYSLOG_ACTION_READ_ALL    = 3
-	_SYSLOG_ACTION_SIZE_BUFFER = 10
+	_SYSLOG_ACTION_CLOSE         = 0
+	_SYSLOG_ACTION_OPEN          = 1
+	_SYSLOG_ACTION_READ          = 2
+	_SYSLOG_ACTION_READ_ALL      = 3
+	_SYSLOG_ACTION_READ_CLEAR    = 4
+	_SYSLOG_ACTION_CLEAR         = 5
+	_SYSLOG_ACTION_CONSOLE_OFF   = 6
+	_SYSLOG_ACTION_CONSOLE_ON    = 7
+	_SYSLOG_ACTION_CONSOLE_LEVEL = 8
+	_SYSLOG_ACTION_SIZE_UNREAD   = 9
+	_SYSLOG_ACTION_SIZE_BUFFER   = 10
 )
 
 // logBufLen is the default syslog buffer size on Linux.
-const logBufLen = 1 << 17
+const logBufLen = kernel.SyslogBufferSize
 
-// Syslog implements part of Linux syscall syslog.
+// Syslog implements Linux syscall syslog.
 //
-// Only the unpriviledged commands are implemented, allowing applications to
-// read a fun dmesg.
+// As with the default kernel.dmesg_restrict=0, reading the entire log and
+// querying its size are unprivileged; all other commands require
+// CAP_SYSLOG. The console commands are accepted but have no effect.
 func Syslog(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	command := args[0].Int()
 	buf := args[1].Pointer()
 	size := int(args[2].Int())
 
 	switch command {
-	case _SYSLOG_ACTION_READ_ALL:
+	case _SYSLOG_ACTION_READ_ALL, _SYSLOG_ACTION_SIZE_BUFFER:
+	default:
+		if !t.HasCapability(linux.CAP_SYSLOG) && !t.HasCapability(linux.CAP_SYS_ADMIN) {
+			return 0, nil, syserror.EPERM
+		}
+	}
+
+	syslog := t.Kernel().Syslog()
+	switch command {
+	case _SYSLOG_ACTION_CLOSE, _SYSLOG_ACTION_OPEN:
+		return 0, nil, nil
+	case _SYSLOG_ACTION_READ:
+		if size < 0 {
+			return 0, nil, syserror.EINVAL
+		}
+		if size == 0 {
+			return 0, nil, nil
+		}
+		log, err := syslog.ReadUnread(size)
+		if err == syserror.ErrWouldBlock {
+			w, ch := waiter.NewChannelEntry(nil)
+			syslog.EventRegister(&w, waiter.EventIn)
+			for {
+				log, err = syslog.ReadUnread(size)
+				if err != syserror.ErrWouldBlock {
+					break
+				}
+				if err = t.Block(ch); err != nil {
+					break
+				}
+			}
+			syslog.EventUnregister(&w)
+		}
+		if err != nil {
+			return 0, nil, syserror.ConvertIntr(err, kernel.ERESTARTSYS)
+		}
+		n, err := t.CopyOutBytes(buf, log)
+		return uintptr(n), nil, err
+	case _SYSLOG_ACTION_READ_ALL, _SYSLOG_ACTION_READ_CLEAR:
 		if size < 0 {
 			return 0, nil, syserror.EINVAL
 		}
@@ -46,16 +96,32 @@ func Syslog(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 			size = logBufLen
 		}
 
-		log := t.Kernel().Syslog().Log()
+		log := syslog.Log()
 		if len(log) > size {
-			log = log[:size]
+			// Like Linux, return the most recent messages.
+			log = log[len(log)-size:]
 		}
 
 		n, err := t.CopyOutBytes(buf, log)
+		if err == nil && command == _SYSLOG_ACTION_READ_CLEAR {
+			syslog.Clear()
+		}
 		return uintptr(n), nil, err
+	case _SYSLOG_ACTION_CLEAR:
+		syslog.Clear()
+		return 0, nil, nil
+	case _SYSLOG_ACTION_CONSOLE_OFF, _SYSLOG_ACTION_CONSOLE_ON:
+		return 0, nil, nil
+	case _SYSLOG_ACTION_CONSOLE_LEVEL:
+		if size < 1 || size > 8 {
+			return 0, nil, syserror.EINVAL
+		}
+		return 0, nil, nil
+	case _SYSLOG_ACTION_SIZE_UNREAD:
+		return uintptr(syslog.Unread()), nil, nil
 	case _SYSLOG_ACTION_SIZE_BUFFER:
 		return logBufLen, nil, nil
 	default:
-		return 0, nil, syserror.ENOSYS
+		return 0, nil, syserror.EINVAL
 	}
 }
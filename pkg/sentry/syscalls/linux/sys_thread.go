@@ -15,12 +15,17 @@
 package linux
 
 import (
+	"fmt"
+	"path"
 	"syscall"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/kdefs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/sched"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/loader"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
 )
@@ -74,12 +79,34 @@ func Execve(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 	filenameAddr := args[0].Pointer()
 	argvAddr := args[1].Pointer()
 	envvAddr := args[2].Pointer()
+	return execveat(t, linux.AT_FDCWD, filenameAddr, argvAddr, envvAddr, 0)
+}
+
+// Execveat implements linux syscall execveat(2).
+func Execveat(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	dirFD := kdefs.FD(args[0].Int())
+	pathnameAddr := args[1].Pointer()
+	argvAddr := args[2].Pointer()
+	envvAddr := args[3].Pointer()
+	flags := args[4].Int()
+	return execveat(t, dirFD, pathnameAddr, argvAddr, envvAddr, flags)
+}
+
+func execveat(t *kernel.Task, dirFD kdefs.FD, pathnameAddr, argvAddr, envvAddr usermem.Addr, flags int32) (uintptr, *kernel.SyscallControl, error) {
+	if flags&^(linux.AT_EMPTY_PATH|linux.AT_SYMLINK_NOFOLLOW) != 0 {
+		return 0, nil, syserror.EINVAL
+	}
+	atEmptyPath := flags&linux.AT_EMPTY_PATH != 0
+	resolveFinal := flags&linux.AT_SYMLINK_NOFOLLOW == 0
 
 	// Extract our arguments.
-	filename, err := t.CopyInString(filenameAddr, linux.PATH_MAX)
+	pathname, err := t.CopyInString(pathnameAddr, linux.PATH_MAX)
 	if err != nil {
 		return 0, nil, err
 	}
+	if pathname == "" && !atEmptyPath {
+		return 0, nil, syserror.ENOENT
+	}
 
 	var argv, envv []string
 	if argvAddr != 0 {
@@ -99,12 +126,56 @@ func Execve(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 
 	root := t.FSContext().RootDirectory()
 	defer root.DecRef()
-	wd := t.FSContext().WorkingDirectory()
+
+	// Resolve the working directory and/or executable.
+	var (
+		wd          *fs.Dirent
+		executable  *fs.File
+		closeOnExec bool
+	)
+	if dirFD == linux.AT_FDCWD || path.IsAbs(pathname) {
+		wd = t.FSContext().WorkingDirectory()
+	} else {
+		f, fdFlags := t.FDMap().GetDescriptor(dirFD)
+		if f == nil {
+			return 0, nil, syserror.EBADF
+		}
+		defer f.DecRef()
+		closeOnExec = fdFlags.CloseOnExec
+
+		if atEmptyPath && pathname == "" {
+			// Execute the file itself. As in Linux, it is named by its
+			// file descriptor. Interpreters of scripts are still looked
+			// up relative to the working directory.
+			executable = f
+			pathname = fmt.Sprintf("/dev/fd/%d", dirFD)
+			wd = t.FSContext().WorkingDirectory()
+		} else {
+			if !fs.IsDir(f.Dirent.Inode.StableAttr) {
+				return 0, nil, syserror.ENOTDIR
+			}
+			wd = f.Dirent
+			wd.IncRef()
+		}
+	}
 	defer wd.DecRef()
 
 	// Load the new TaskContext.
-	maxTraversals := uint(linux.MaxSymlinkTraversals)
-	tc, se := t.Kernel().LoadTaskImage(t, t.MountNamespace(), root, wd, &maxTraversals, filename, argv, envv, t.Arch().FeatureSet())
+	remainingTraversals := uint(linux.MaxSymlinkTraversals)
+	loadArgs := loader.LoadArgs{
+		Mounts:              t.MountNamespace(),
+		Root:                root,
+		WorkingDirectory:    wd,
+		RemainingTraversals: &remainingTraversals,
+		ResolveFinal:        resolveFinal,
+		Filename:            pathname,
+		File:                executable,
+		CloseOnExec:         closeOnExec,
+		Argv:                argv,
+		Envv:                envv,
+		Features:            t.Arch().FeatureSet(),
+	}
+	tc, se := t.Kernel().LoadTaskImage(t, loadArgs, t.Personality())
 	if se != nil {
 		return 0, nil, se.ToError()
 	}
@@ -121,9 +121,18 @@ func getClock(t *kernel.Task, clockID int32) (ktime.Clock, error) {
 	switch clockID {
 	case linux.CLOCK_REALTIME, linux.CLOCK_REALTIME_COARSE:
 		return t.Kernel().RealtimeClock(), nil
+	case linux.CLOCK_TAI:
+		// The offset of CLOCK_TAI from CLOCK_REALTIME is set by adjtimex(2),
+		// which is unsupported, so it remains 0 as in Linux.
+		return t.Kernel().RealtimeClock(), nil
 	case linux.CLOCK_MONOTONIC, linux.CLOCK_MONOTONIC_COARSE, linux.CLOCK_MONOTONIC_RAW:
 		// CLOCK_MONOTONIC approximates CLOCK_MONOTONIC_RAW.
 		return t.Kernel().MonotonicClock(), nil
+	case linux.CLOCK_BOOTTIME:
+		// The sandbox is never suspended, so CLOCK_BOOTTIME is identical to
+		// CLOCK_MONOTONIC. Note that after restore, CLOCK_MONOTONIC also
+		// advances by the time elapsed since save.
+		return t.Kernel().MonotonicClock(), nil
 	case linux.CLOCK_PROCESS_CPUTIME_ID:
 		return t.ThreadGroup().CPUClock(), nil
 	case linux.CLOCK_THREAD_CPUTIME_ID:
@@ -298,6 +307,8 @@ func ClockNanosleep(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kerne
 	if clockID > 0 {
 		if clockID != linux.CLOCK_REALTIME &&
 			clockID != linux.CLOCK_MONOTONIC &&
+			clockID != linux.CLOCK_BOOTTIME &&
+			clockID != linux.CLOCK_TAI &&
 			clockID != linux.CLOCK_PROCESS_CPUTIME_ID {
 			return 0, nil, syserror.EINVAL
 		}
@@ -38,12 +38,13 @@ func TimerfdCreate(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel
 	switch clockID {
 	case linux.CLOCK_REALTIME:
 		c = t.Kernel().RealtimeClock()
-	case linux.CLOCK_MONOTONIC:
+	case linux.CLOCK_MONOTONIC, linux.CLOCK_BOOTTIME:
+		// See getClock for CLOCK_BOOTTIME.
 		c = t.Kernel().MonotonicClock()
 	default:
 		return 0, nil, syserror.EINVAL
 	}
-	f := timerfd.NewFile(t, c)
+	f := timerfd.NewFile(t, clockID, c)
 	defer f.DecRef()
 	f.SetFlags(fs.SettableFileFlags{
 		NonBlocking: flags&linux.TFD_NONBLOCK != 0,
@@ -66,7 +67,7 @@ func TimerfdSettime(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kerne
 	newValAddr := args[2].Pointer()
 	oldValAddr := args[3].Pointer()
 
-	if flags&^(linux.TFD_TIMER_ABSTIME) != 0 {
+	if flags&^(linux.TFD_TIMER_ABSTIME|linux.TFD_TIMER_CANCEL_ON_SET) != 0 {
 		return 0, nil, syserror.EINVAL
 	}
 
@@ -89,7 +90,7 @@ func TimerfdSettime(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kerne
 	if err != nil {
 		return 0, nil, err
 	}
-	tm, oldS := tf.SetTime(newS)
+	tm, oldS := tf.SetTime(newS, flags)
 	if oldValAddr != 0 {
 		oldVal := ktime.ItimerspecFromSetting(tm, oldS)
 		if _, err := t.CopyOut(oldValAddr, &oldVal); err != nil {
@@ -19,7 +19,7 @@ import (
 )
 
 // CPUStats contains the subset of struct rusage fields that relate to CPU
-// scheduling.
+// scheduling and page faults.
 //
 // +stateify savable
 type CPUStats struct {
@@ -36,6 +36,14 @@ type CPUStats struct {
 	// InvoluntarySwitches (struct rusage::ru_nivcsw) is unsupported, since
 	// "preemptive" scheduling is managed by the Go runtime, which doesn't
 	// provide this information.
+
+	// MinorFaults is the number of page faults that were handled without
+	// reading from a file.
+	MinorFaults uint64
+
+	// MajorFaults is the number of page faults that required reading from a
+	// file.
+	MajorFaults uint64
 }
 
 // Accumulate adds s2 to s.
@@ -43,4 +51,6 @@ func (s *CPUStats) Accumulate(s2 CPUStats) {
 	s.UserTime += s2.UserTime
 	s.SysTime += s2.SysTime
 	s.VoluntarySwitches += s2.VoluntarySwitches
+	s.MinorFaults += s2.MinorFaults
+	s.MajorFaults += s2.MajorFaults
 }
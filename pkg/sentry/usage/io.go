@@ -78,6 +78,14 @@ func (i *IO) AccountWriteIO(bytes int64) {
 	}
 }
 
+// AccountCancelledWriteIO does the accounting for dirty data that was
+// discarded without being written to the file system.
+func (i *IO) AccountCancelledWriteIO(bytes int64) {
+	if bytes > 0 {
+		atomic.AddUint64(&i.BytesWriteCancelled, uint64(bytes))
+	}
+}
+
 // Accumulate adds up io usages.
 func (i *IO) Accumulate(io *IO) {
 	atomic.AddUint64(&i.CharsRead, atomic.LoadUint64(&io.CharsRead))
@@ -26,13 +26,19 @@
 //			 If a tasks continues to be stuck, the message will repeat every minute, unless
 //			 a new stuck task is detected
 //		2. Panic: same as above, followed by panic()
+//		3. Dump: same as LogWarning, and also writes the stack dump and a heap
+//			 profile to files in a directory, to be attached to bug reports
 //
 package watchdog
 
 import (
 	"bytes"
 	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
 	"sync"
+	"syscall"
 	"time"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
@@ -63,6 +69,9 @@ const (
 	LogWarning Action = iota
 	// Panic will do the same logging as LogWarning and panic().
 	Panic
+	// Dump will do the same logging as LogWarning, and write the stack
+	// dump and a heap profile to Opts.DumpDirFD.
+	Dump
 )
 
 // String returns Action's string representation.
@@ -72,11 +81,32 @@ func (a Action) String() string {
 		return "LogWarning"
 	case Panic:
 		return "Panic"
+	case Dump:
+		return "Dump"
 	default:
 		panic(fmt.Sprintf("Invalid action: %d", a))
 	}
 }
 
+// DumpFileFlags are the flags used to create dump files in Opts.DumpDirFD.
+const DumpFileFlags = syscall.O_WRONLY | syscall.O_CREAT | syscall.O_EXCL | syscall.O_CLOEXEC
+
+// Opts configures the watchdog.
+type Opts struct {
+	// TaskTimeout is the amount of time to allow a task to execute the
+	// same syscall without blocking before it's declared stuck. If zero,
+	// the watchdog is disabled.
+	TaskTimeout time.Duration
+
+	// TaskTimeoutAction indicates what action to take when a stuck task is
+	// detected.
+	TaskTimeoutAction Action
+
+	// DumpDirFD is an FD to the directory where the Dump action writes
+	// files, or 0 if unset. It is required if TaskTimeoutAction is Dump.
+	DumpDirFD int
+}
+
 // Watchdog is the main watchdog class. It controls a goroutine that periodically
 // analyses all tasks and reports if any of them appear to be stuck.
 type Watchdog struct {
@@ -91,6 +121,9 @@ type Watchdog struct {
 	// timeoutAction indicates what action to take when a stuck tasks is detected.
 	timeoutAction Action
 
+	// dumpDirFD is the directory where the Dump action writes files.
+	dumpDirFD int
+
 	// k is where the tasks come from.
 	k *kernel.Kernel
 
@@ -122,20 +155,30 @@ type offender struct {
 }
 
 // New creates a new watchdog.
-func New(k *kernel.Kernel, taskTimeout time.Duration, a Action) *Watchdog {
+func New(k *kernel.Kernel, opts Opts) *Watchdog {
 	// 4 is arbitrary, just don't want to prolong 'taskTimeout' too much.
-	period := taskTimeout / 4
+	period := opts.TaskTimeout / 4
 	return &Watchdog{
 		k:             k,
 		period:        period,
-		taskTimeout:   taskTimeout,
-		timeoutAction: a,
+		taskTimeout:   opts.TaskTimeout,
+		timeoutAction: opts.TaskTimeoutAction,
+		dumpDirFD:     opts.DumpDirFD,
 		offenders:     make(map[*kernel.Task]*offender),
 		stop:          make(chan struct{}),
 		done:          make(chan struct{}),
 	}
 }
 
+// Opts returns the options the watchdog was created with.
+func (w *Watchdog) Opts() Opts {
+	return Opts{
+		TaskTimeout:       w.taskTimeout,
+		TaskTimeoutAction: w.timeoutAction,
+		DumpDirFD:         w.dumpDirFD,
+	}
+}
+
 // Start starts the watchdog.
 func (w *Watchdog) Start() {
 	if w.taskTimeout == 0 {
@@ -273,7 +316,7 @@ func (w *Watchdog) reportStuckWatchdog() {
 
 func (w *Watchdog) onStuckTask(newTaskFound bool, buf *bytes.Buffer) {
 	switch w.timeoutAction {
-	case LogWarning:
+	case LogWarning, Dump:
 		// Dump stack only if a new task is detected or if it sometime has passed since
 		// the last time a stack dump was generated.
 		if !newTaskFound && time.Since(w.lastStackDump) < stackDumpSameTaskPeriod {
@@ -281,6 +324,9 @@ func (w *Watchdog) onStuckTask(newTaskFound bool, buf *bytes.Buffer) {
 			log.Warningf(buf.String())
 		} else {
 			log.TracebackAll(buf.String())
+			if w.timeoutAction == Dump {
+				w.dump(buf.String())
+			}
 			w.lastStackDump = time.Now()
 		}
 
@@ -303,3 +349,42 @@ func (w *Watchdog) onStuckTask(newTaskFound bool, buf *bytes.Buffer) {
 		panic("Sentry detected stuck task(s). See stack trace and message above for more details")
 	}
 }
+
+// dump writes msg followed by the stacks of all goroutines, and a heap
+// profile, to new files in the dump directory. Errors are logged, since there
+// is nothing else to do about them.
+func (w *Watchdog) dump(msg string) {
+	prefix := fmt.Sprintf("watchdog-%d", time.Now().UnixNano())
+
+	stacks, err := w.createDumpFile(prefix + "-stacks.txt")
+	if err != nil {
+		log.Warningf("Failed to create watchdog stack dump: %v", err)
+	} else {
+		fmt.Fprintf(stacks, "%s\n\n%s", msg, log.Stacks(true))
+		stacks.Close()
+	}
+
+	heap, err := w.createDumpFile(prefix + "-heap.pprof")
+	if err != nil {
+		log.Warningf("Failed to create watchdog heap profile: %v", err)
+		return
+	}
+	defer heap.Close()
+	// Get up-to-date statistics.
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(heap); err != nil {
+		log.Warningf("Failed to write watchdog heap profile: %v", err)
+	}
+	log.Warningf("Watchdog diagnostics written to %s-*", prefix)
+}
+
+func (w *Watchdog) createDumpFile(name string) (*os.File, error) {
+	if w.dumpDirFD <= 0 {
+		return nil, fmt.Errorf("no dump directory")
+	}
+	fd, err := syscall.Openat(w.dumpDirFD, name, DumpFileFlags, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("creating %q: %v", name, err)
+	}
+	return os.NewFile(uintptr(fd), name), nil
+}
@@ -0,0 +1,720 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package shim implements the containerd task API (runtime v2 shim) for runsc.
+//
+// A shim is started by containerd for each container, and forwards task
+// service requests to runsc's runc-compatible command line interface. The
+// shim is the parent of the sandbox and of each "runsc exec" process, so it
+// reaps them and reports their exit status to containerd.
+package shim
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/containerd/cgroups"
+	eventstypes "github.com/containerd/containerd/api/events"
+	"github.com/containerd/containerd/api/types/task"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/log"
+	"github.com/containerd/containerd/mount"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/pkg/process"
+	"github.com/containerd/containerd/pkg/stdio"
+	"github.com/containerd/containerd/runtime/v2/runc"
+	"github.com/containerd/containerd/runtime/v2/runc/options"
+	"github.com/containerd/containerd/runtime/v2/shim"
+	taskAPI "github.com/containerd/containerd/runtime/v2/task"
+	"github.com/containerd/containerd/sys/reaper"
+	runcC "github.com/containerd/go-runc"
+	"github.com/containerd/typeurl"
+	"github.com/gogo/protobuf/proto"
+	ptypes "github.com/gogo/protobuf/types"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// RuntimeName is the name under which the shim is registered with
+	// containerd. containerd derives the binary name
+	// containerd-shim-runsc-v1 from it.
+	RuntimeName = "io.containerd.runsc.v1"
+
+	// defaultBinary is the runsc binary used if the runtime options do not
+	// specify one.
+	defaultBinary = "runsc"
+
+	// defaultRoot is the runsc root directory used if the runtime options
+	// do not specify one. Containers are namespaced below it.
+	defaultRoot = "/run/containerd/runsc"
+)
+
+var (
+	_     = (taskAPI.TaskService)(&service{})
+	empty = &ptypes.Empty{}
+)
+
+// service is the shim implementation of the containerd task service.
+type service struct {
+	mu sync.Mutex
+
+	// eventSendMu ensures that start events are sent before exit events.
+	eventSendMu sync.Mutex
+
+	context  context.Context
+	events   chan interface{}
+	platform stdio.Platform
+	ec       chan runcC.Exit
+
+	// id is the ID of the container served by this shim.
+	id string
+
+	// container is the container, once it has been created. It is
+	// protected by mu.
+	container *runc.Container
+
+	// cancel shuts down the shim.
+	cancel func()
+}
+
+// New returns a new shim service. It implements shim.Init.
+func New(ctx context.Context, id string, publisher shim.Publisher, shutdown func()) (shim.Shim, error) {
+	s := &service{
+		id:      id,
+		context: ctx,
+		events:  make(chan interface{}, 128),
+		ec:      reaper.Default.Subscribe(),
+		cancel:  shutdown,
+	}
+	go s.processExits()
+	runcC.Monitor = reaper.Default
+	platform, err := runc.NewPlatform()
+	if err != nil {
+		shutdown()
+		return nil, fmt.Errorf("initializing platform: %v", err)
+	}
+	s.platform = platform
+	go s.forward(ctx, publisher)
+	return s, nil
+}
+
+// newCommand returns the command used by StartShim to start the shim daemon.
+func newCommand(ctx context.Context, id, containerdAddress string) (*exec.Cmd, error) {
+	ns, err := namespaces.NamespaceRequired(ctx)
+	if err != nil {
+		return nil, err
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(self, "-namespace", ns, "-id", id, "-address", containerdAddress)
+	cmd.Dir = cwd
+	cmd.Env = append(os.Environ(), "GOMAXPROCS=2")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid: true,
+	}
+	return cmd, nil
+}
+
+// StartShim implements shim.Shim.StartShim. It starts the shim daemon, which
+// serves the task API on a socket, and returns the socket's address.
+func (s *service) StartShim(ctx context.Context, id, containerdBinary, containerdAddress, containerdTTRPCAddress string) (_ string, retErr error) {
+	cmd, err := newCommand(ctx, id, containerdAddress)
+	if err != nil {
+		return "", err
+	}
+	address, err := shim.SocketAddress(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	socket, err := shim.NewSocket(address)
+	if err != nil {
+		return "", err
+	}
+	defer socket.Close()
+	f, err := socket.File()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	defer func() {
+		if retErr != nil {
+			cmd.Process.Kill()
+		}
+	}()
+	// Make sure to wait after start.
+	go cmd.Wait()
+	if err := shim.WritePidFile("shim.pid", cmd.Process.Pid); err != nil {
+		return "", err
+	}
+	if err := shim.WriteAddress("address", address); err != nil {
+		return "", err
+	}
+
+	// containerd passes the runtime options on stdin. The only one that
+	// applies to the shim itself is its cgroup.
+	if data, err := ioutil.ReadAll(os.Stdin); err == nil && len(data) > 0 {
+		var any ptypes.Any
+		if err := proto.Unmarshal(data, &any); err != nil {
+			return "", err
+		}
+		v, err := typeurl.UnmarshalAny(&any)
+		if err != nil {
+			return "", err
+		}
+		if opts, ok := v.(*options.Options); ok && opts.ShimCgroup != "" {
+			cg, err := cgroups.Load(cgroups.V1, cgroups.StaticPath(opts.ShimCgroup))
+			if err != nil {
+				return "", fmt.Errorf("loading cgroup %q: %v", opts.ShimCgroup, err)
+			}
+			if err := cg.Add(cgroups.Process{Pid: cmd.Process.Pid}); err != nil {
+				return "", fmt.Errorf("joining cgroup %q: %v", opts.ShimCgroup, err)
+			}
+		}
+	}
+	if err := shim.AdjustOOMScore(cmd.Process.Pid); err != nil {
+		return "", fmt.Errorf("adjusting OOM score for shim: %v", err)
+	}
+	return address, nil
+}
+
+// Cleanup implements shim.Shim.Cleanup. It is called by containerd when the
+// shim has died, to forcibly remove the container.
+func (s *service) Cleanup(ctx context.Context) (*taskAPI.DeleteResponse, error) {
+	path, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	ns, err := namespaces.NamespaceRequired(ctx)
+	if err != nil {
+		return nil, err
+	}
+	binary, err := runc.ReadRuntime(path)
+	if err != nil {
+		return nil, err
+	}
+	r := process.NewRunc(defaultRoot, path, ns, binary, "", false)
+	if err := r.Delete(ctx, s.id, &runcC.DeleteOpts{
+		Force: true,
+	}); err != nil {
+		log.G(ctx).WithError(err).Warn("failed to remove runsc container")
+	}
+	if err := mount.UnmountAll(filepath.Join(path, "rootfs"), 0); err != nil {
+		log.G(ctx).WithError(err).Warn("failed to cleanup rootfs mount")
+	}
+	return &taskAPI.DeleteResponse{
+		ExitedAt:   time.Now(),
+		ExitStatus: 128 + uint32(unix.SIGKILL),
+	}, nil
+}
+
+// Create implements taskAPI.TaskService.Create. It creates the container and
+// its initial process with "runsc create", or "runsc restore" if a checkpoint
+// is given.
+func (s *service) Create(ctx context.Context, r *taskAPI.CreateTaskRequest) (*taskAPI.CreateTaskResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	opts, err := withDefaults(r.Options)
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	r.Options = opts
+
+	container, err := runc.NewContainer(ctx, s.platform, r)
+	if err != nil {
+		return nil, err
+	}
+	s.container = container
+
+	s.send(&eventstypes.TaskCreate{
+		ContainerID: r.ID,
+		Bundle:      r.Bundle,
+		Rootfs:      r.Rootfs,
+		IO: &eventstypes.TaskIO{
+			Stdin:    r.Stdin,
+			Stdout:   r.Stdout,
+			Stderr:   r.Stderr,
+			Terminal: r.Terminal,
+		},
+		Checkpoint: r.Checkpoint,
+		Pid:        uint32(container.Pid()),
+	})
+	return &taskAPI.CreateTaskResponse{
+		Pid: uint32(container.Pid()),
+	}, nil
+}
+
+// withDefaults returns the runtime options opts, with runsc's binary name and
+// root directory filled in if they were not specified. Options that go-runc
+// would turn into flags runsc doesn't have are dropped if they don't apply to
+// runsc, or rejected.
+func withDefaults(opts *ptypes.Any) (*ptypes.Any, error) {
+	o := &options.Options{}
+	if opts != nil {
+		v, err := typeurl.UnmarshalAny(opts)
+		if err != nil {
+			return nil, err
+		}
+		ro, ok := v.(*options.Options)
+		if !ok {
+			return nil, fmt.Errorf("unsupported runtime options type %T", v)
+		}
+		o = ro
+	}
+	if o.BinaryName == "" {
+		o.BinaryName = defaultBinary
+	}
+	if o.Root == "" {
+		o.Root = defaultRoot
+	}
+	if o.CriuPath != "" {
+		return nil, fmt.Errorf("criu path %q is not supported, runsc checkpoints without criu", o.CriuPath)
+	}
+	// runsc does not support the --systemd-cgroup flag.
+	o.SystemdCgroup = false
+	// The sandbox neither pivots root nor has session keyrings, so the
+	// options disabling them don't apply.
+	o.NoPivotRoot = false
+	o.NoNewKeyring = false
+	return typeurl.MarshalAny(o)
+}
+
+// Start implements taskAPI.TaskService.Start.
+func (s *service) Start(ctx context.Context, r *taskAPI.StartRequest) (*taskAPI.StartResponse, error) {
+	container, err := s.getContainer()
+	if err != nil {
+		return nil, err
+	}
+
+	// Hold the send lock so that the start events are sent before any
+	// exit events in the error case.
+	s.eventSendMu.Lock()
+	defer s.eventSendMu.Unlock()
+	p, err := container.Start(ctx, r)
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	if r.ExecID == "" {
+		s.send(&eventstypes.TaskStart{
+			ContainerID: container.ID,
+			Pid:         uint32(p.Pid()),
+		})
+	} else {
+		s.send(&eventstypes.TaskExecStarted{
+			ContainerID: container.ID,
+			ExecID:      r.ExecID,
+			Pid:         uint32(p.Pid()),
+		})
+	}
+	return &taskAPI.StartResponse{
+		Pid: uint32(p.Pid()),
+	}, nil
+}
+
+// Delete implements taskAPI.TaskService.Delete. It deletes an exec'd process,
+// or the container itself if no exec ID is given.
+func (s *service) Delete(ctx context.Context, r *taskAPI.DeleteRequest) (*taskAPI.DeleteResponse, error) {
+	container, err := s.getContainer()
+	if err != nil {
+		return nil, err
+	}
+	p, err := container.Delete(ctx, r)
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	if r.ExecID == "" {
+		s.platform.Close()
+		s.send(&eventstypes.TaskDelete{
+			ContainerID: container.ID,
+			Pid:         uint32(p.Pid()),
+			ExitStatus:  uint32(p.ExitStatus()),
+			ExitedAt:    p.ExitedAt(),
+		})
+	}
+	return &taskAPI.DeleteResponse{
+		ExitStatus: uint32(p.ExitStatus()),
+		ExitedAt:   p.ExitedAt(),
+		Pid:        uint32(p.Pid()),
+	}, nil
+}
+
+// Exec implements taskAPI.TaskService.Exec. The process is started by a later
+// call to Start with the same exec ID.
+func (s *service) Exec(ctx context.Context, r *taskAPI.ExecProcessRequest) (*ptypes.Empty, error) {
+	container, err := s.getContainer()
+	if err != nil {
+		return nil, err
+	}
+	ok, cancel := container.ReserveProcess(r.ExecID)
+	if !ok {
+		return nil, errdefs.ToGRPCf(errdefs.ErrAlreadyExists, "id %s", r.ExecID)
+	}
+	p, err := container.Exec(ctx, r)
+	if err != nil {
+		cancel()
+		return nil, errdefs.ToGRPC(err)
+	}
+	s.send(&eventstypes.TaskExecAdded{
+		ContainerID: container.ID,
+		ExecID:      p.ID(),
+	})
+	return empty, nil
+}
+
+// ResizePty implements taskAPI.TaskService.ResizePty.
+func (s *service) ResizePty(ctx context.Context, r *taskAPI.ResizePtyRequest) (*ptypes.Empty, error) {
+	container, err := s.getContainer()
+	if err != nil {
+		return nil, err
+	}
+	if err := container.ResizePty(ctx, r); err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	return empty, nil
+}
+
+// State implements taskAPI.TaskService.State.
+func (s *service) State(ctx context.Context, r *taskAPI.StateRequest) (*taskAPI.StateResponse, error) {
+	container, err := s.getContainer()
+	if err != nil {
+		return nil, err
+	}
+	p, err := container.Process(r.ExecID)
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	st, err := p.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status := task.StatusUnknown
+	switch st {
+	case "created":
+		status = task.StatusCreated
+	case "running":
+		status = task.StatusRunning
+	case "stopped":
+		status = task.StatusStopped
+	case "paused":
+		status = task.StatusPaused
+	case "pausing":
+		status = task.StatusPausing
+	}
+	sio := p.Stdio()
+	return &taskAPI.StateResponse{
+		ID:         p.ID(),
+		Bundle:     container.Bundle,
+		Pid:        uint32(p.Pid()),
+		Status:     status,
+		Stdin:      sio.Stdin,
+		Stdout:     sio.Stdout,
+		Stderr:     sio.Stderr,
+		Terminal:   sio.Terminal,
+		ExitStatus: uint32(p.ExitStatus()),
+		ExitedAt:   p.ExitedAt(),
+	}, nil
+}
+
+// Pause implements taskAPI.TaskService.Pause.
+func (s *service) Pause(ctx context.Context, r *taskAPI.PauseRequest) (*ptypes.Empty, error) {
+	container, err := s.getContainer()
+	if err != nil {
+		return nil, err
+	}
+	if err := container.Pause(ctx); err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	s.send(&eventstypes.TaskPaused{
+		ContainerID: container.ID,
+	})
+	return empty, nil
+}
+
+// Resume implements taskAPI.TaskService.Resume.
+func (s *service) Resume(ctx context.Context, r *taskAPI.ResumeRequest) (*ptypes.Empty, error) {
+	container, err := s.getContainer()
+	if err != nil {
+		return nil, err
+	}
+	if err := container.Resume(ctx); err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	s.send(&eventstypes.TaskResumed{
+		ContainerID: container.ID,
+	})
+	return empty, nil
+}
+
+// Kill implements taskAPI.TaskService.Kill.
+func (s *service) Kill(ctx context.Context, r *taskAPI.KillRequest) (*ptypes.Empty, error) {
+	container, err := s.getContainer()
+	if err != nil {
+		return nil, err
+	}
+	if err := container.Kill(ctx, r); err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	return empty, nil
+}
+
+// Pids implements taskAPI.TaskService.Pids. The returned pids are those of the
+// container's processes in the sandbox's PID namespace, as reported by
+// "runsc ps".
+func (s *service) Pids(ctx context.Context, r *taskAPI.PidsRequest) (*taskAPI.PidsResponse, error) {
+	container, err := s.getContainer()
+	if err != nil {
+		return nil, err
+	}
+	p, err := container.Process("")
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	pids, err := p.(*process.Init).Runtime().Ps(ctx, r.ID)
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	var processes []*task.ProcessInfo
+	for _, pid := range pids {
+		processes = append(processes, &task.ProcessInfo{
+			Pid: uint32(pid),
+		})
+	}
+	return &taskAPI.PidsResponse{
+		Processes: processes,
+	}, nil
+}
+
+// CloseIO implements taskAPI.TaskService.CloseIO.
+func (s *service) CloseIO(ctx context.Context, r *taskAPI.CloseIORequest) (*ptypes.Empty, error) {
+	container, err := s.getContainer()
+	if err != nil {
+		return nil, err
+	}
+	if err := container.CloseIO(ctx, r); err != nil {
+		return nil, err
+	}
+	return empty, nil
+}
+
+// Checkpoint implements taskAPI.TaskService.Checkpoint with "runsc
+// checkpoint". The checkpoint image is written to r.Path, and may be restored
+// by passing it as the checkpoint of a new task.
+func (s *service) Checkpoint(ctx context.Context, r *taskAPI.CheckpointTaskRequest) (*ptypes.Empty, error) {
+	container, err := s.getContainer()
+	if err != nil {
+		return nil, err
+	}
+	opts, err := checkpointOptions(r.Options)
+	if err != nil {
+		return nil, errdefs.ToGRPCf(errdefs.ErrInvalidArgument, "%v", err)
+	}
+	r.Options = opts
+	if err := container.Checkpoint(ctx, r); err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	return empty, nil
+}
+
+// checkpointOptions returns the checkpoint options opts without those that
+// don't apply to runsc, or an error if opts has criu options runsc doesn't
+// support.
+func checkpointOptions(opts *ptypes.Any) (*ptypes.Any, error) {
+	if opts == nil {
+		return nil, nil
+	}
+	v, err := typeurl.UnmarshalAny(opts)
+	if err != nil {
+		return nil, err
+	}
+	o, ok := v.(*options.CheckpointOptions)
+	if !ok {
+		return nil, fmt.Errorf("unsupported checkpoint options type %T", v)
+	}
+	switch {
+	case o.ExternalUnixSockets:
+		return nil, fmt.Errorf("checkpointing external unix sockets is not supported by runsc")
+	case o.Terminal:
+		return nil, fmt.Errorf("checkpointing terminals is not supported by runsc")
+	case o.FileLocks:
+		return nil, fmt.Errorf("checkpointing file locks is not supported by runsc")
+	case len(o.EmptyNamespaces) > 0:
+		return nil, fmt.Errorf("empty namespaces are not supported by runsc")
+	case o.CgroupsMode != "":
+		return nil, fmt.Errorf("cgroups mode %q is not supported by runsc", o.CgroupsMode)
+	}
+	// Whether TCP connections are checkpointed is decided by the
+	// --net-restore flag of the sandbox.
+	o.OpenTcp = false
+	return typeurl.MarshalAny(o)
+}
+
+// Update implements taskAPI.TaskService.Update. runsc does not support
+// updating the resources of a running container.
+func (s *service) Update(ctx context.Context, r *taskAPI.UpdateTaskRequest) (*ptypes.Empty, error) {
+	return nil, errdefs.ToGRPCf(errdefs.ErrNotImplemented, "container update is not supported by runsc")
+}
+
+// Wait implements taskAPI.TaskService.Wait.
+func (s *service) Wait(ctx context.Context, r *taskAPI.WaitRequest) (*taskAPI.WaitResponse, error) {
+	container, err := s.getContainer()
+	if err != nil {
+		return nil, err
+	}
+	p, err := container.Process(r.ExecID)
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	p.Wait()
+	return &taskAPI.WaitResponse{
+		ExitStatus: uint32(p.ExitStatus()),
+		ExitedAt:   p.ExitedAt(),
+	}, nil
+}
+
+// Connect implements taskAPI.TaskService.Connect.
+func (s *service) Connect(ctx context.Context, r *taskAPI.ConnectRequest) (*taskAPI.ConnectResponse, error) {
+	var pid int
+	if container, err := s.getContainer(); err == nil {
+		pid = container.Pid()
+	}
+	return &taskAPI.ConnectResponse{
+		ShimPid: uint32(os.Getpid()),
+		TaskPid: uint32(pid),
+	}, nil
+}
+
+// Shutdown implements taskAPI.TaskService.Shutdown.
+func (s *service) Shutdown(ctx context.Context, r *taskAPI.ShutdownRequest) (*ptypes.Empty, error) {
+	s.cancel()
+	close(s.events)
+	return empty, nil
+}
+
+// Stats implements taskAPI.TaskService.Stats. The statistics are those of the
+// cgroup containing the sandbox, which accounts for all of the container's
+// processes as well as the sentry itself.
+func (s *service) Stats(ctx context.Context, r *taskAPI.StatsRequest) (*taskAPI.StatsResponse, error) {
+	container, err := s.getContainer()
+	if err != nil {
+		return nil, err
+	}
+	cg := container.Cgroup()
+	if cg == nil {
+		return nil, errdefs.ToGRPCf(errdefs.ErrNotFound, "cgroup does not exist")
+	}
+	stats, err := cg.Stat(cgroups.IgnoreNotExist)
+	if err != nil {
+		return nil, err
+	}
+	data, err := typeurl.MarshalAny(stats)
+	if err != nil {
+		return nil, err
+	}
+	return &taskAPI.StatsResponse{
+		Stats: data,
+	}, nil
+}
+
+// processExits reports the exits of reaped children.
+func (s *service) processExits() {
+	for e := range s.ec {
+		s.checkProcesses(e)
+	}
+}
+
+// checkProcesses marks the process with the exited pid, which is either the
+// sandbox or a "runsc exec" process, as exited, and sends an exit event.
+func (s *service) checkProcesses(e runcC.Exit) {
+	container, err := s.getContainer()
+	if err != nil {
+		return
+	}
+	for _, p := range container.All() {
+		if p.Pid() != e.Pid {
+			continue
+		}
+		if ip, ok := p.(*process.Init); ok {
+			// The sandbox is gone, so make sure that exec'd
+			// processes are also reported as exited.
+			if err := ip.KillAll(s.context); err != nil {
+				log.G(s.context).WithError(err).WithField("id", ip.ID()).Debug("failed to kill init's children")
+			}
+		}
+		p.SetExited(e.Status)
+		s.sendL(&eventstypes.TaskExit{
+			ContainerID: container.ID,
+			ID:          p.ID(),
+			Pid:         uint32(e.Pid),
+			ExitStatus:  uint32(e.Status),
+			ExitedAt:    p.ExitedAt(),
+		})
+		return
+	}
+}
+
+// send queues an event to be published.
+func (s *service) send(evt interface{}) {
+	s.events <- evt
+}
+
+// sendL is equivalent to send, but takes eventSendMu.
+func (s *service) sendL(evt interface{}) {
+	s.eventSendMu.Lock()
+	s.events <- evt
+	s.eventSendMu.Unlock()
+}
+
+// forward publishes queued events to containerd until the shim is shut down.
+func (s *service) forward(ctx context.Context, publisher shim.Publisher) {
+	ns, _ := namespaces.Namespace(ctx)
+	ctx = namespaces.WithNamespace(context.Background(), ns)
+	for e := range s.events {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err := publisher.Publish(ctx, runc.GetTopic(e), e)
+		cancel()
+		if err != nil {
+			log.G(ctx).WithError(err).Error("post event")
+		}
+	}
+	publisher.Close()
+}
+
+// getContainer returns the container, or an error if it has not been created.
+func (s *service) getContainer() (*runc.Container, error) {
+	s.mu.Lock()
+	container := s.container
+	s.mu.Unlock()
+	if container == nil {
+		return nil, errdefs.ToGRPCf(errdefs.ErrNotFound, "container not created")
+	}
+	return container, nil
+}
@@ -0,0 +1,362 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shim
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	eventstypes "github.com/containerd/containerd/api/events"
+	"github.com/containerd/containerd/api/types"
+	"github.com/containerd/containerd/api/types/task"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/runtime/v2/runc"
+	"github.com/containerd/containerd/runtime/v2/runc/options"
+	taskAPI "github.com/containerd/containerd/runtime/v2/task"
+	runcC "github.com/containerd/go-runc"
+	"github.com/containerd/typeurl"
+	"github.com/gogo/protobuf/proto"
+	ptypes "github.com/gogo/protobuf/types"
+)
+
+// fakePid is the pid of the sandbox reported by fakeRunsc. Pids are below
+// the kernel's maximum of 1<<22, so it isn't the pid of any process.
+const fakePid = 1 << 22
+
+// fakeRunsc is a shell script standing in for runsc. It appends its
+// subcommand to the file given as first format argument, and writes the
+// second format argument, the sandbox pid, to the pid file of "create".
+const fakeRunsc = `#!/bin/sh
+while [ $# -gt 0 ]; do
+	case "$1" in
+	--root|--log|--log-format) shift 2 ;;
+	-*) shift ;;
+	*) break ;;
+	esac
+done
+echo "$1" >> %q
+if [ "$1" = create ]; then
+	while [ $# -gt 0 ]; do
+		if [ "$1" = --pid-file ]; then
+			echo %d > "$2"
+		fi
+		shift
+	done
+fi
+`
+
+// nextEvent returns the next event sent by s.
+func nextEvent(t *testing.T, s *service) interface{} {
+	select {
+	case e := <-s.events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatalf("No event sent")
+		return nil
+	}
+}
+
+// checkStatus checks that the status of the container of s is want.
+func checkStatus(ctx context.Context, t *testing.T, s *service, want task.Status) {
+	r, err := s.State(ctx, &taskAPI.StateRequest{ID: s.id})
+	if err != nil {
+		t.Fatalf("State() failed: %v", err)
+	}
+	if r.Status != want {
+		t.Errorf("State(): got status %v, want %v", r.Status, want)
+	}
+}
+
+// TestLifecycle runs a container through the shim, from creation to deletion,
+// with runsc replaced by fakeRunsc.
+func TestLifecycle(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skipf("Lifecycle test requires CAP_SYS_ADMIN to mount the container's rootfs, running as %d", os.Getuid())
+	}
+	dir, err := ioutil.TempDir("", "shim_test")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "runsc.log")
+	binary := filepath.Join(dir, "runsc")
+	if err := ioutil.WriteFile(binary, []byte(fmt.Sprintf(fakeRunsc, logPath, fakePid)), 0755); err != nil {
+		t.Fatalf("ioutil.WriteFile(%q) failed: %v", binary, err)
+	}
+	bundle := filepath.Join(dir, "bundle")
+	rootfs := filepath.Join(dir, "rootfs")
+	for _, d := range []string{bundle, rootfs} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatalf("os.Mkdir(%q) failed: %v", d, err)
+		}
+	}
+	// In case the container isn't deleted, which unmounts the rootfs.
+	defer syscall.Unmount(filepath.Join(bundle, "rootfs"), syscall.MNT_DETACH)
+
+	opts, err := typeurl.MarshalAny(&options.Options{
+		BinaryName: binary,
+		Root:       filepath.Join(dir, "root"),
+	})
+	if err != nil {
+		t.Fatalf("typeurl.MarshalAny() failed: %v", err)
+	}
+	platform, err := runc.NewPlatform()
+	if err != nil {
+		t.Fatalf("runc.NewPlatform() failed: %v", err)
+	}
+	ctx := namespaces.WithNamespace(context.Background(), "test")
+	s := &service{
+		context:  ctx,
+		events:   make(chan interface{}, 128),
+		platform: platform,
+		id:       "test",
+		cancel:   func() {},
+	}
+
+	if _, err := s.Start(ctx, &taskAPI.StartRequest{ID: s.id}); !errdefs.IsNotFound(errdefs.FromGRPC(err)) {
+		t.Errorf("Start() before Create(): got error %v, want not found", err)
+	}
+
+	cr, err := s.Create(ctx, &taskAPI.CreateTaskRequest{
+		ID:     s.id,
+		Bundle: bundle,
+		Rootfs: []*types.Mount{{
+			Type:    "bind",
+			Source:  rootfs,
+			Options: []string{"rbind"},
+		}},
+		Options: opts,
+	})
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	if cr.Pid != fakePid {
+		t.Errorf("Create(): got pid %d, want %d", cr.Pid, fakePid)
+	}
+	if e, ok := nextEvent(t, s).(*eventstypes.TaskCreate); !ok || e.Pid != fakePid {
+		t.Errorf("Create(): got event %+v, want TaskCreate with pid %d", e, fakePid)
+	}
+	checkStatus(ctx, t, s, task.StatusCreated)
+
+	if _, err := s.Start(ctx, &taskAPI.StartRequest{ID: s.id}); err != nil {
+		t.Fatalf("Start() failed: %v", err)
+	}
+	if e, ok := nextEvent(t, s).(*eventstypes.TaskStart); !ok || e.Pid != fakePid {
+		t.Errorf("Start(): got event %+v, want TaskStart with pid %d", e, fakePid)
+	}
+	checkStatus(ctx, t, s, task.StatusRunning)
+
+	if _, err := s.Delete(ctx, &taskAPI.DeleteRequest{ID: s.id}); err == nil {
+		t.Errorf("Delete() of running container: got no error, want one")
+	}
+
+	if _, err := s.Kill(ctx, &taskAPI.KillRequest{ID: s.id, Signal: uint32(syscall.SIGTERM)}); err != nil {
+		t.Fatalf("Kill() failed: %v", err)
+	}
+
+	waitc := make(chan *taskAPI.WaitResponse, 1)
+	go func() {
+		r, err := s.Wait(ctx, &taskAPI.WaitRequest{ID: s.id})
+		if err != nil {
+			t.Errorf("Wait() failed: %v", err)
+		}
+		waitc <- r
+	}()
+
+	// The sandbox exits on the signal, and is reaped by the shim.
+	const wantStatus = 128 + uint32(syscall.SIGTERM)
+	s.checkProcesses(runcC.Exit{Pid: fakePid, Status: int(wantStatus)})
+	if e, ok := nextEvent(t, s).(*eventstypes.TaskExit); !ok || e.ExitStatus != wantStatus {
+		t.Errorf("Exit: got event %+v, want TaskExit with status %d", e, wantStatus)
+	}
+	select {
+	case r := <-waitc:
+		if r != nil && r.ExitStatus != wantStatus {
+			t.Errorf("Wait(): got status %d, want %d", r.ExitStatus, wantStatus)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Wait() didn't return after the sandbox exited")
+	}
+	checkStatus(ctx, t, s, task.StatusStopped)
+
+	dr, err := s.Delete(ctx, &taskAPI.DeleteRequest{ID: s.id})
+	if err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	if dr.ExitStatus != wantStatus {
+		t.Errorf("Delete(): got status %d, want %d", dr.ExitStatus, wantStatus)
+	}
+	if e, ok := nextEvent(t, s).(*eventstypes.TaskDelete); !ok || e.ExitStatus != wantStatus {
+		t.Errorf("Delete(): got event %+v, want TaskDelete with status %d", e, wantStatus)
+	}
+
+	// Kill is called by Kill, then by the shim to kill exec'd processes
+	// once the sandbox exited.
+	b, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile(%q) failed: %v", logPath, err)
+	}
+	got := strings.Fields(string(b))
+	want := []string{"create", "start", "kill", "kill", "delete"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("runsc commands: got %v, want %v", got, want)
+	}
+}
+
+// mustMarshalAny returns v marshaled as an Any.
+func mustMarshalAny(t *testing.T, v interface{}) *ptypes.Any {
+	a, err := typeurl.MarshalAny(v)
+	if err != nil {
+		t.Fatalf("typeurl.MarshalAny(%+v) failed: %v", v, err)
+	}
+	return a
+}
+
+func TestWithDefaults(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		opts    *options.Options
+		want    *options.Options
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			want: &options.Options{BinaryName: defaultBinary, Root: defaultRoot},
+		},
+		{
+			name: "unsupported flags dropped",
+			opts: &options.Options{
+				BinaryName:    "/usr/bin/runsc",
+				Root:          "/runsc",
+				SystemdCgroup: true,
+				NoPivotRoot:   true,
+				NoNewKeyring:  true,
+			},
+			want: &options.Options{BinaryName: "/usr/bin/runsc", Root: "/runsc"},
+		},
+		{
+			name:    "criu",
+			opts:    &options.Options{CriuPath: "/usr/sbin/criu"},
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var opts *ptypes.Any
+			if tc.opts != nil {
+				opts = mustMarshalAny(t, tc.opts)
+			}
+			got, err := withDefaults(opts)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("withDefaults(%+v): got no error, want one", tc.opts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("withDefaults(%+v) failed: %v", tc.opts, err)
+			}
+			v, err := typeurl.UnmarshalAny(got)
+			if err != nil {
+				t.Fatalf("typeurl.UnmarshalAny() failed: %v", err)
+			}
+			if o, ok := v.(*options.Options); !ok || !proto.Equal(o, tc.want) {
+				t.Errorf("withDefaults(%+v): got %+v, want %+v", tc.opts, v, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckpointOptions(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		opts    *options.CheckpointOptions
+		want    *options.CheckpointOptions
+		wantErr bool
+	}{
+		{
+			name: "none",
+		},
+		{
+			name: "open tcp dropped",
+			opts: &options.CheckpointOptions{Exit: true, OpenTcp: true},
+			want: &options.CheckpointOptions{Exit: true},
+		},
+		{
+			name:    "external unix sockets",
+			opts:    &options.CheckpointOptions{ExternalUnixSockets: true},
+			wantErr: true,
+		},
+		{
+			name:    "terminal",
+			opts:    &options.CheckpointOptions{Terminal: true},
+			wantErr: true,
+		},
+		{
+			name:    "file locks",
+			opts:    &options.CheckpointOptions{FileLocks: true},
+			wantErr: true,
+		},
+		{
+			name:    "empty namespaces",
+			opts:    &options.CheckpointOptions{EmptyNamespaces: []string{"network"}},
+			wantErr: true,
+		},
+		{
+			name:    "cgroups mode",
+			opts:    &options.CheckpointOptions{CgroupsMode: "soft"},
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var opts *ptypes.Any
+			if tc.opts != nil {
+				opts = mustMarshalAny(t, tc.opts)
+			}
+			got, err := checkpointOptions(opts)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("checkpointOptions(%+v): got no error, want one", tc.opts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("checkpointOptions(%+v) failed: %v", tc.opts, err)
+			}
+			if tc.want == nil {
+				if got != nil {
+					t.Errorf("checkpointOptions(%+v): got %+v, want nil", tc.opts, got)
+				}
+				return
+			}
+			v, err := typeurl.UnmarshalAny(got)
+			if err != nil {
+				t.Fatalf("typeurl.UnmarshalAny() failed: %v", err)
+			}
+			if o, ok := v.(*options.CheckpointOptions); !ok || !proto.Equal(o, tc.want) {
+				t.Errorf("checkpointOptions(%+v): got %+v, want %+v", tc.opts, v, tc.want)
+			}
+		})
+	}
+}
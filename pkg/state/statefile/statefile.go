@@ -37,8 +37,10 @@
 //
 // This map includes only strings for keys and strings for values. Keys in the
 // map that begin with "_" are for internal use only. They may be read, but may
-// not be provided by the user. In the future, this metadata may contain some
-// information relating to the state encoding itself.
+// not be provided by the user. The "_compression" key names the compression
+// algorithm of the state data, and is absent for the default "flate". In the
+// future, this metadata may contain some information relating to the state
+// encoding itself.
 //
 // After the map, the remainder of the file is the state data.
 package statefile
@@ -55,6 +57,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/klauspost/compress/zstd"
 	"gvisor.googlesource.com/gvisor/pkg/binary"
 	"gvisor.googlesource.com/gvisor/pkg/compressio"
 )
@@ -83,10 +86,52 @@ var ErrInvalidMetadataLength = fmt.Errorf("metadata length invalid, maximum size
 // ErrMetadataInvalid is returned if passed metadata is invalid.
 var ErrMetadataInvalid = fmt.Errorf("metadata invalid, can't start with _")
 
-// NewWriter returns a state data writer for a statefile.
+// compressionKey is the metadata key recording the compression algorithm.
+const compressionKey = "_compression"
+
+// Compression is the compression algorithm of the state data.
+type Compression string
+
+const (
+	// CompressionFlate compresses with DEFLATE. It is the default.
+	CompressionFlate Compression = "flate"
+
+	// CompressionZstd compresses with Zstandard.
+	CompressionZstd Compression = "zstd"
+)
+
+// algorithm returns the compressio algorithm for c.
+func (c Compression) algorithm() (compressio.Algorithm, int, error) {
+	switch c {
+	case "", CompressionFlate:
+		// We always use "best speed" mode here. When using "best
+		// compression" mode, there is usually only a little gain in file
+		// size reduction, which translate to even smaller gain in restore
+		// latency reduction, while inccuring much more CPU usage at save
+		// time.
+		return compressio.Flate, flate.BestSpeed, nil
+	case CompressionZstd:
+		return compressio.Zstd, int(zstd.SpeedDefault), nil
+	default:
+		return 0, 0, fmt.Errorf("unknown compression %q", c)
+	}
+}
+
+// NewWriter returns a state data writer for a statefile, compressed with
+// CompressionFlate.
 //
 // Note that the returned WriteCloser must be closed.
 func NewWriter(w io.Writer, key []byte, metadata map[string]string) (io.WriteCloser, error) {
+	return NewWriterCompression(w, key, metadata, CompressionFlate)
+}
+
+// NewWriterCompression is like NewWriter, but compresses the state data with
+// the given algorithm.
+func NewWriterCompression(w io.Writer, key []byte, metadata map[string]string, compression Compression) (io.WriteCloser, error) {
+	algorithm, level, err := compression.algorithm()
+	if err != nil {
+		return nil, err
+	}
 	if metadata == nil {
 		metadata = make(map[string]string)
 	}
@@ -108,6 +153,12 @@ func NewWriter(w io.Writer, key []byte, metadata map[string]string) (io.WriteClo
 	// Generate a timestamp, for convenience only.
 	metadata["_timestamp"] = time.Now().UTC().String()
 	defer delete(metadata, "_timestamp")
+	if compression != "" && compression != CompressionFlate {
+		// Omitted for the default, so that older versions can read
+		// such files.
+		metadata[compressionKey] = string(compression)
+		defer delete(metadata, compressionKey)
+	}
 
 	// Write the metadata.
 	b, err := json.Marshal(metadata)
@@ -138,11 +189,8 @@ func NewWriter(w io.Writer, key []byte, metadata map[string]string) (io.WriteClo
 		}
 	}
 
-	// Wrap in compression. We always use "best speed" mode here. When using
-	// "best compression" mode, there is usually only a little gain in file
-	// size reduction, which translate to even smaller gain in restore
-	// latency reduction, while inccuring much more CPU usage at save time.
-	return compressio.NewWriter(w, key, compressionChunkSize, flate.BestSpeed)
+	// Wrap in compression.
+	return compressio.NewWriterAlgorithm(w, key, compressionChunkSize, algorithm, level)
 }
 
 // MetadataUnsafe reads out the metadata from a state file without verifying any
@@ -224,7 +272,11 @@ func NewReader(r io.Reader, key []byte) (io.Reader, map[string]string, error) {
 	}
 
 	// Wrap in compression.
-	rc, err := compressio.NewReader(r, key)
+	algorithm, _, err := Compression(metadata[compressionKey]).algorithm()
+	if err != nil {
+		return nil, nil, err
+	}
+	rc, err := compressio.NewReaderAlgorithm(r, key, algorithm)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -163,6 +163,61 @@ func TestStatefile(t *testing.T) {
 	}
 }
 
+func TestStatefileCompression(t *testing.T) {
+	key, err := randomKey()
+	if err != nil {
+		t.Fatalf("can't generate key: got %v, excepted nil", err)
+	}
+	data := make([]byte, 3*compressionChunkSize)
+	for i := range data {
+		data[i] = byte(i % 7)
+	}
+
+	for _, c := range []Compression{CompressionFlate, CompressionZstd} {
+		t.Run(string(c), func(t *testing.T) {
+			var bufEncoded, bufDecoded bytes.Buffer
+			w, err := NewWriterCompression(&bufEncoded, key, nil, c)
+			if err != nil {
+				t.Fatalf("error creating writer: got %v, expected nil", err)
+			}
+			if _, err := w.Write(data); err != nil {
+				t.Fatalf("error during write: got %v, expected nil", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("error during close: got %v, expected nil", err)
+			}
+
+			// The algorithm is recorded, except for the default.
+			metadata, err := MetadataUnsafe(bytes.NewReader(bufEncoded.Bytes()))
+			if err != nil {
+				t.Fatalf("error reading metadata: got %v, expected nil", err)
+			}
+			want := string(c)
+			if c == CompressionFlate {
+				want = ""
+			}
+			if got := metadata[compressionKey]; got != want {
+				t.Errorf("got compression metadata %q, expected %q", got, want)
+			}
+
+			r, _, err := NewReader(bytes.NewReader(bufEncoded.Bytes()), key)
+			if err != nil {
+				t.Fatalf("error creating reader: got %v, expected nil", err)
+			}
+			if _, err := io.Copy(&bufDecoded, r); err != nil {
+				t.Fatalf("error during read: got %v, expected nil", err)
+			}
+			if !bytes.Equal(data, bufDecoded.Bytes()) {
+				t.Fatalf("data didn't match (%d vs %d bytes)", len(bufDecoded.Bytes()), len(data))
+			}
+		})
+	}
+
+	if _, err := NewWriterCompression(&bytes.Buffer{}, key, nil, "lzma"); err == nil {
+		t.Errorf("got no error: expected error for unknown compression")
+	}
+}
+
 const benchmarkDataSize = 100 * 1024 * 1024
 
 func benchmark(b *testing.B, size int, write bool, compressible bool) {
@@ -30,6 +30,7 @@ var (
 	EAGAIN       = error(syscall.EAGAIN)
 	EBADF        = error(syscall.EBADF)
 	EBUSY        = error(syscall.EBUSY)
+	ECANCELED    = error(syscall.ECANCELED)
 	ECHILD       = error(syscall.ECHILD)
 	ECONNREFUSED = error(syscall.ECONNREFUSED)
 	ECONNRESET   = error(syscall.ECONNRESET)
@@ -70,6 +71,7 @@ var (
 	EROFS        = error(syscall.EROFS)
 	ESPIPE       = error(syscall.ESPIPE)
 	ESRCH        = error(syscall.ESRCH)
+	ESTALE       = error(syscall.ESTALE)
 	ETIMEDOUT    = error(syscall.ETIMEDOUT)
 	EUSERS       = error(syscall.EUSERS)
 	EWOULDBLOCK  = error(syscall.EWOULDBLOCK)
@@ -0,0 +1,164 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import (
+	"encoding/binary"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+)
+
+const (
+	greFlagsVersion = 0
+	greProtocolType = 2
+)
+
+// Flags of the GRE header, as described in RFC 2784 and RFC 2890.
+const (
+	GREFlagChecksum = 1 << 15
+	GREFlagKey      = 1 << 13
+	GREFlagSequence = 1 << 12
+
+	// greVersionMask masks the version in the first 16 bits of the
+	// header.
+	greVersionMask = 0x7
+)
+
+// GREFields contains the fields of a GRE header. It is used to describe the
+// fields of a packet that needs to be encoded.
+type GREFields struct {
+	// Protocol is the "protocol type" field of the GRE header, the
+	// EtherType of the encapsulated packet.
+	Protocol tcpip.NetworkProtocolNumber
+
+	// Checksum is whether the checksum of the header and the payload is
+	// present.
+	Checksum bool
+
+	// Key is the "key" field of the GRE header, if HasKey is set.
+	Key    uint32
+	HasKey bool
+
+	// Sequence is the "sequence number" field of the GRE header, if
+	// HasSequence is set.
+	Sequence    uint32
+	HasSequence bool
+}
+
+// GRE represents a Generic Routing Encapsulation header stored in a byte
+// array, as described in RFC 2784 and RFC 2890.
+type GRE []byte
+
+const (
+	// GREMinimumSize is the minimum size of a valid GRE header.
+	GREMinimumSize = 4
+
+	// GREProtocolNumber is GRE's transport protocol number.
+	GREProtocolNumber tcpip.TransportProtocolNumber = 47
+)
+
+// GRESize returns the size of the GRE header with the fields f.
+func GRESize(f *GREFields) int {
+	size := GREMinimumSize
+	if f.Checksum {
+		size += 4
+	}
+	if f.HasKey {
+		size += 4
+	}
+	if f.HasSequence {
+		size += 4
+	}
+	return size
+}
+
+// Flags returns the flags of the GRE header.
+func (b GRE) Flags() uint16 {
+	return binary.BigEndian.Uint16(b[greFlagsVersion:]) &^ greVersionMask
+}
+
+// Version returns the version of the GRE header.
+func (b GRE) Version() uint8 {
+	return uint8(binary.BigEndian.Uint16(b[greFlagsVersion:]) & greVersionMask)
+}
+
+// Protocol returns the "protocol type" field of the GRE header.
+func (b GRE) Protocol() tcpip.NetworkProtocolNumber {
+	return tcpip.NetworkProtocolNumber(binary.BigEndian.Uint16(b[greProtocolType:]))
+}
+
+// HeaderLength returns the length of the GRE header, as given by its flags.
+func (b GRE) HeaderLength() int {
+	f := b.Flags()
+	return GRESize(&GREFields{
+		Checksum:    f&GREFlagChecksum != 0,
+		HasKey:      f&GREFlagKey != 0,
+		HasSequence: f&GREFlagSequence != 0,
+	})
+}
+
+// IsValid returns whether b holds a complete GRE header of version 0, the
+// only one used for encapsulation.
+func (b GRE) IsValid() bool {
+	return len(b) >= GREMinimumSize && b.Version() == 0 && len(b) >= b.HeaderLength()
+}
+
+// Key returns the "key" field of the GRE header, and whether it is present.
+func (b GRE) Key() (uint32, bool) {
+	f := b.Flags()
+	if f&GREFlagKey == 0 {
+		return 0, false
+	}
+	off := GREMinimumSize
+	if f&GREFlagChecksum != 0 {
+		off += 4
+	}
+	return binary.BigEndian.Uint32(b[off:]), true
+}
+
+// Payload returns the packet encapsulated after the GRE header.
+func (b GRE) Payload() []byte {
+	return b[b.HeaderLength():]
+}
+
+// Encode encodes all the fields of the GRE header but the checksum, which
+// must be set with SetChecksum once the payload follows it.
+func (b GRE) Encode(f *GREFields) {
+	var flags uint16
+	off := GREMinimumSize
+	if f.Checksum {
+		flags |= GREFlagChecksum
+		binary.BigEndian.PutUint32(b[off:], 0)
+		off += 4
+	}
+	if f.HasKey {
+		flags |= GREFlagKey
+		binary.BigEndian.PutUint32(b[off:], f.Key)
+		off += 4
+	}
+	if f.HasSequence {
+		flags |= GREFlagSequence
+		binary.BigEndian.PutUint32(b[off:], f.Sequence)
+	}
+	binary.BigEndian.PutUint16(b[greFlagsVersion:], flags)
+	binary.BigEndian.PutUint16(b[greProtocolType:], uint16(f.Protocol))
+}
+
+// SetChecksum sets the checksum of the GRE header, whose checksum flag must be
+// set. partial is the checksum of the payload following the header.
+func (b GRE) SetChecksum(partial uint16) {
+	binary.BigEndian.PutUint16(b[GREMinimumSize:], 0)
+	binary.BigEndian.PutUint16(b[GREMinimumSize:], ^Checksum(b[:b.HeaderLength()], partial))
+}
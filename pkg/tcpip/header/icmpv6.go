@@ -18,6 +18,7 @@ import (
 	"encoding/binary"
 
 	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
 )
 
 // ICMPv6 represents an ICMPv6 header stored in a byte array.
@@ -61,6 +62,14 @@ const (
 	ICMPv6EchoRequest    ICMPv6Type = 128
 	ICMPv6EchoReply      ICMPv6Type = 129
 
+	// Multicast Listener Discovery (MLD) messages, see RFC 2710 and RFC
+	// 3810.
+
+	ICMPv6MulticastListenerQuery    ICMPv6Type = 130
+	ICMPv6MulticastListenerReport   ICMPv6Type = 131
+	ICMPv6MulticastListenerDone     ICMPv6Type = 132
+	ICMPv6MulticastListenerV2Report ICMPv6Type = 143
+
 	// Neighbor Discovery Protocol (NDP) messages, see RFC 4861.
 
 	ICMPv6RouterSolicit   ICMPv6Type = 133
@@ -72,7 +81,9 @@ const (
 
 // Values for ICMP code as defined in RFC 4443.
 const (
-	ICMPv6PortUnreachable = 4
+	ICMPv6NetworkUnreachable = 0
+	ICMPv6AddressUnreachable = 3
+	ICMPv6PortUnreachable    = 4
 )
 
 // Type is the ICMP type field.
@@ -119,3 +130,26 @@ func (ICMPv6) SetDestinationPort(uint16) {
 func (b ICMPv6) Payload() []byte {
 	return b[ICMPv6MinimumSize:]
 }
+
+// ICMPv6Checksum calculates the ICMP checksum over the provided ICMP header,
+// IPv6 src/dst addresses and the payload.
+func ICMPv6Checksum(h ICMPv6, src, dst tcpip.Address, vv buffer.VectorisedView) uint16 {
+	// Calculate the IPv6 pseudo-header upper-layer checksum.
+	xsum := Checksum([]byte(src), 0)
+	xsum = Checksum([]byte(dst), xsum)
+	var upperLayerLength [4]byte
+	binary.BigEndian.PutUint32(upperLayerLength[:], uint32(len(h)+vv.Size()))
+	xsum = Checksum(upperLayerLength[:], xsum)
+	xsum = Checksum([]byte{0, 0, 0, uint8(ICMPv6ProtocolNumber)}, xsum)
+	for _, v := range vv.Views() {
+		xsum = Checksum(v, xsum)
+	}
+
+	// h[2:4] is the checksum itself, set it aside to avoid checksumming the checksum.
+	h2, h3 := h[2], h[3]
+	h[2], h[3] = 0, 0
+	xsum = ^Checksum(h, xsum)
+	h[2], h[3] = h2, h3
+
+	return xsum
+}
@@ -0,0 +1,223 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import (
+	"encoding/binary"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+)
+
+// IGMP represents an IGMP message stored in a byte array. It holds the fields
+// common to IGMPv1 and IGMPv2 messages, and to IGMPv3 queries, as defined in
+// RFC 2236 section 2 and RFC 3376 section 4.1.
+type IGMP []byte
+
+// IGMPType is the IGMP type field.
+type IGMPType uint8
+
+// Values for the IGMP Type field.
+const (
+	IGMPMembershipQuery    IGMPType = 0x11
+	IGMPv1MembershipReport IGMPType = 0x12
+	IGMPv2MembershipReport IGMPType = 0x16
+	IGMPLeaveGroup         IGMPType = 0x17
+	IGMPv3MembershipReport IGMPType = 0x22
+)
+
+const (
+	// IGMPMinimumSize is the minimum size of a valid IGMP message, and the
+	// size of IGMPv1 and IGMPv2 messages.
+	IGMPMinimumSize = 8
+
+	// IGMPv3QueryMinimumSize is the minimum size of a valid IGMPv3 query.
+	// Shorter queries come from IGMPv1 or IGMPv2 queriers.
+	IGMPv3QueryMinimumSize = 12
+
+	// IGMPv3ReportMinimumSize is the size of the header of IGMPv3
+	// Membership Reports, without group records.
+	IGMPv3ReportMinimumSize = 8
+
+	// IGMPv3GroupRecordMinimumSize is the size of a group record of an
+	// IGMPv3 Membership Report, without sources.
+	IGMPv3GroupRecordMinimumSize = 8
+
+	// IGMPProtocolNumber is IGMP's transport protocol number.
+	IGMPProtocolNumber tcpip.TransportProtocolNumber = 2
+
+	// IGMPTTL is the TTL of all IGMP messages, which never leave the local
+	// network.
+	IGMPTTL = 1
+
+	// IGMPv3RoutersMulticastAddress is the multicast group that all
+	// IGMPv3-capable routers join, 224.0.0.22, described in RFC 3376
+	// section 4.2.14.
+	IGMPv3RoutersMulticastAddress tcpip.Address = "\xe0\x00\x00\x16"
+
+	igmpTypeOffset               = 0
+	igmpMaxRespCodeOffset        = 1
+	igmpChecksumOffset           = 2
+	igmpGroupAddressOffset       = 4
+	igmpv3QRVOffset              = 8
+	igmpv3NumSourcesOffset       = 10
+	igmpv3NumRecordsOffset       = 6
+	igmpv3RecordTypeOffset       = 0
+	igmpv3RecordAddrOffset       = 4
+	igmpv3RecordNumSourcesOffset = 2
+	igmpMaxRespTimeUnit          = time.Second / 10
+)
+
+// GroupRecordType is the type of a group record of an IGMPv3 or MLDv2 report,
+// as defined in RFC 3376 section 4.2.12 and RFC 3810 section 5.2.12.
+type GroupRecordType uint8
+
+// Values for the record type of IGMPv3 and MLDv2 group records.
+const (
+	GroupRecordModeIsInclude       GroupRecordType = 1
+	GroupRecordModeIsExclude       GroupRecordType = 2
+	GroupRecordChangeToIncludeMode GroupRecordType = 3
+	GroupRecordChangeToExcludeMode GroupRecordType = 4
+	GroupRecordAllowNewSources     GroupRecordType = 5
+	GroupRecordBlockOldSources     GroupRecordType = 6
+)
+
+// Type is the IGMP type field.
+func (b IGMP) Type() IGMPType { return IGMPType(b[igmpTypeOffset]) }
+
+// SetType sets the IGMP type field.
+func (b IGMP) SetType(t IGMPType) { b[igmpTypeOffset] = byte(t) }
+
+// MaxRespCode is the IGMP max response code field. It is called max response
+// time in IGMPv2, and is unused in IGMPv1.
+func (b IGMP) MaxRespCode() uint8 { return b[igmpMaxRespCodeOffset] }
+
+// SetMaxRespCode sets the IGMP max response code field.
+func (b IGMP) SetMaxRespCode(c uint8) { b[igmpMaxRespCodeOffset] = c }
+
+// MaxRespTime returns the max response time of an IGMPv2 query, which is
+// expressed in units of 1/10 second.
+func (b IGMP) MaxRespTime() time.Duration {
+	return time.Duration(b.MaxRespCode()) * igmpMaxRespTimeUnit
+}
+
+// Checksum is the IGMP checksum field.
+func (b IGMP) Checksum() uint16 {
+	return binary.BigEndian.Uint16(b[igmpChecksumOffset:])
+}
+
+// SetChecksum sets the IGMP checksum field.
+func (b IGMP) SetChecksum(checksum uint16) {
+	binary.BigEndian.PutUint16(b[igmpChecksumOffset:], checksum)
+}
+
+// GroupAddress is the IGMP group address field. It is the unspecified address
+// in general queries.
+func (b IGMP) GroupAddress() tcpip.Address {
+	return tcpip.Address(b[igmpGroupAddressOffset : igmpGroupAddressOffset+IPv4AddressSize])
+}
+
+// SetGroupAddress sets the IGMP group address field.
+func (b IGMP) SetGroupAddress(addr tcpip.Address) {
+	copy(b[igmpGroupAddressOffset:], addr)
+}
+
+// IGMPv3Query is an IGMPv3 Membership Query, as defined in RFC 3376 section
+// 4.1.
+type IGMPv3Query IGMP
+
+// MaxRespTime returns the max response time of the query, decoded from its
+// max response code as described in RFC 3376 section 4.1.1.
+func (b IGMPv3Query) MaxRespTime() time.Duration {
+	return time.Duration(decodeMaxRespCode(uint16(IGMP(b).MaxRespCode()), 8)) * igmpMaxRespTimeUnit
+}
+
+// GroupAddress is the group address field of the query.
+func (b IGMPv3Query) GroupAddress() tcpip.Address {
+	return IGMP(b).GroupAddress()
+}
+
+// QuerierRobustnessVariable is the querier's robustness variable field, or 0
+// if it is greater than 7.
+func (b IGMPv3Query) QuerierRobustnessVariable() uint8 {
+	return b[igmpv3QRVOffset] & 0x7
+}
+
+// NumberOfSources is the number of sources field of the query.
+func (b IGMPv3Query) NumberOfSources() uint16 {
+	return binary.BigEndian.Uint16(b[igmpv3NumSourcesOffset:])
+}
+
+// IGMPv3Report is an IGMPv3 Membership Report, as defined in RFC 3376 section
+// 4.2.
+type IGMPv3Report []byte
+
+// NumberOfGroupRecords is the number of group records field of the report.
+func (b IGMPv3Report) NumberOfGroupRecords() uint16 {
+	return binary.BigEndian.Uint16(b[igmpv3NumRecordsOffset:])
+}
+
+// SetNumberOfGroupRecords sets the number of group records field of the
+// report.
+func (b IGMPv3Report) SetNumberOfGroupRecords(n uint16) {
+	binary.BigEndian.PutUint16(b[igmpv3NumRecordsOffset:], n)
+}
+
+// GroupRecords returns the group records of the report.
+func (b IGMPv3Report) GroupRecords() []byte {
+	return b[IGMPv3ReportMinimumSize:]
+}
+
+// IGMPv3GroupRecord is a group record of an IGMPv3 Membership Report.
+type IGMPv3GroupRecord []byte
+
+// RecordType is the record type field.
+func (b IGMPv3GroupRecord) RecordType() GroupRecordType {
+	return GroupRecordType(b[igmpv3RecordTypeOffset])
+}
+
+// SetRecordType sets the record type field.
+func (b IGMPv3GroupRecord) SetRecordType(t GroupRecordType) {
+	b[igmpv3RecordTypeOffset] = byte(t)
+}
+
+// NumberOfSources is the number of sources field of the record.
+func (b IGMPv3GroupRecord) NumberOfSources() uint16 {
+	return binary.BigEndian.Uint16(b[igmpv3RecordNumSourcesOffset:])
+}
+
+// MulticastAddress is the multicast address field of the record.
+func (b IGMPv3GroupRecord) MulticastAddress() tcpip.Address {
+	return tcpip.Address(b[igmpv3RecordAddrOffset : igmpv3RecordAddrOffset+IPv4AddressSize])
+}
+
+// SetMulticastAddress sets the multicast address field of the record.
+func (b IGMPv3GroupRecord) SetMulticastAddress(addr tcpip.Address) {
+	copy(b[igmpv3RecordAddrOffset:], addr)
+}
+
+// decodeMaxRespCode decodes the max response code of IGMPv3 and MLDv2
+// queries, which are codeBits bits long. Codes with the most significant bit
+// set hold a floating point value, with a 3-bit exponent followed by the
+// mantissa (RFC 3376 section 4.1.1 and RFC 3810 section 5.1.3).
+func decodeMaxRespCode(code uint16, codeBits uint) uint32 {
+	if code < 1<<(codeBits-1) {
+		return uint32(code)
+	}
+	mantBits := codeBits - 4
+	mant := uint32(code) & (1<<mantBits - 1)
+	exp := (uint32(code) >> mantBits) & 0x7
+	return (mant | 1<<mantBits) << (exp + 3)
+}
@@ -99,6 +99,22 @@ const (
 
 	// IPv4Any is the non-routable IPv4 "any" meta address.
 	IPv4Any tcpip.Address = "\x00\x00\x00\x00"
+
+	// IPv4AllSystemsMulticastAddress is the multicast group that all IPv4
+	// hosts join, 224.0.0.1, described in RFC 1112 section 4.
+	IPv4AllSystemsMulticastAddress tcpip.Address = "\xe0\x00\x00\x01"
+
+	// IPv4AllRoutersMulticastAddress is the multicast group that all IPv4
+	// routers join, 224.0.0.2, described in RFC 2236 section 3.
+	IPv4AllRoutersMulticastAddress tcpip.Address = "\xe0\x00\x00\x02"
+
+	// IPv4RouterAlertOption is the type of the IPv4 Router Alert option,
+	// RFC 2113.
+	IPv4RouterAlertOption = 148
+
+	// IPv4RouterAlertOptionSize is the size of the IPv4 Router Alert
+	// option.
+	IPv4RouterAlertOptionSize = 4
 )
 
 // Flags that may be set in an IPv4 packet.
@@ -280,3 +296,24 @@ func IsV4MulticastAddress(addr tcpip.Address) bool {
 	}
 	return (addr[0] & 0xf0) == 0xe0
 }
+
+// EthernetAddressFromMulticastIPv4Address computes the ethernet multicast
+// address an IPv4 multicast address maps to.
+func EthernetAddressFromMulticastIPv4Address(addr tcpip.Address) tcpip.LinkAddress {
+	// RFC 1112 Host Extensions for IP Multicasting
+	//
+	// 6.4. Extensions to an Ethernet Local Network Module:
+	//
+	// An IP host group address is mapped to an Ethernet multicast
+	// address by placing the low-order 23-bits of the IP address
+	// into the low-order 23 bits of the Ethernet multicast address
+	// 01-00-5E-00-00-00 (hex).
+	return tcpip.LinkAddress([]byte{
+		0x01,
+		0x00,
+		0x5e,
+		addr[IPv4AddressSize-3] & 0x7f,
+		addr[IPv4AddressSize-2],
+		addr[IPv4AddressSize-1],
+	})
+}
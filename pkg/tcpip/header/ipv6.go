@@ -80,6 +80,31 @@ const (
 
 	// IPv6Any is the non-routable IPv6 "any" meta address.
 	IPv6Any tcpip.Address = "\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"
+
+	// IPv6AllNodesMulticastAddress is the link-local multicast group that
+	// all IPv6 nodes join, ff02::1, described in RFC 4291 section 2.7.1.
+	IPv6AllNodesMulticastAddress tcpip.Address = "\xff\x02\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01"
+
+	// IPv6AllRoutersMulticastAddress is the link-local multicast group that
+	// all IPv6 routers join, ff02::2, described in RFC 4291 section 2.7.1.
+	IPv6AllRoutersMulticastAddress tcpip.Address = "\xff\x02\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02"
+
+	// IPv6HopByHopOptionsHeader is the number used to specify that the
+	// next header is a Hop-by-Hop Options header, per RFC 8200 section
+	// 4.3.
+	IPv6HopByHopOptionsHeader = 0
+
+	// IPv6Pad1Option is the type of the Pad1 option of Hop-by-Hop Options
+	// headers. It is a single byte, without length and data.
+	IPv6Pad1Option = 0
+
+	// IPv6PadNOption is the type of the PadN option of Hop-by-Hop Options
+	// headers.
+	IPv6PadNOption = 1
+
+	// IPv6RouterAlertOption is the type of the IPv6 Router Alert option,
+	// RFC 2711.
+	IPv6RouterAlertOption = 5
 )
 
 // PayloadLength returns the value of the "payload length" field of the ipv6
@@ -217,25 +242,51 @@ func SolicitedNodeAddr(addr tcpip.Address) tcpip.Address {
 // LinkLocalAddr computes the default IPv6 link-local address from a link-layer
 // (MAC) address.
 func LinkLocalAddr(linkAddr tcpip.LinkAddress) tcpip.Address {
-	// Convert a 48-bit MAC to an EUI-64 and then prepend the link-local
-	// header, FE80::.
+	return SLAACAddr("\xfe\x80\x00\x00\x00\x00\x00\x00", linkAddr)
+}
+
+// SLAACAddr computes the address formed by the first 8 bytes of prefix and the
+// modified EUI-64 interface identifier of a link-layer (MAC) address, as
+// described by RFC 4862 section 5.5.3 and RFC 4291 appendix A.
+func SLAACAddr(prefix tcpip.Address, linkAddr tcpip.LinkAddress) tcpip.Address {
+	// Convert a 48-bit MAC to an EUI-64 and then prepend the prefix.
 	//
 	// The conversion is very nearly:
 	//	aa:bb:cc:dd:ee:ff => FE80::Aabb:ccFF:FEdd:eeff
 	// Note the capital A. The conversion aa->Aa involves a bit flip.
-	lladdrb := [16]byte{
-		0:  0xFE,
-		1:  0x80,
-		8:  linkAddr[0] ^ 2,
-		9:  linkAddr[1],
-		10: linkAddr[2],
-		11: 0xFF,
-		12: 0xFE,
-		13: linkAddr[3],
-		14: linkAddr[4],
-		15: linkAddr[5],
-	}
-	return tcpip.Address(lladdrb[:])
+	var addr [IPv6AddressSize]byte
+	copy(addr[:8], prefix)
+	addr[8] = linkAddr[0] ^ 2
+	addr[9] = linkAddr[1]
+	addr[10] = linkAddr[2]
+	addr[11] = 0xFF
+	addr[12] = 0xFE
+	addr[13] = linkAddr[3]
+	addr[14] = linkAddr[4]
+	addr[15] = linkAddr[5]
+	return tcpip.Address(addr[:])
+}
+
+// EthernetAddressFromMulticastIPv6Address computes the ethernet multicast
+// address an IPv6 multicast address maps to.
+func EthernetAddressFromMulticastIPv6Address(addr tcpip.Address) tcpip.LinkAddress {
+	// RFC 2464 Transmission of IPv6 Packets over Ethernet Networks
+	//
+	// 7. Address Mapping -- Multicast
+	//
+	// An IPv6 packet with a multicast destination address DST,
+	// consisting of the sixteen octets DST[1] through DST[16], is
+	// transmitted to the Ethernet multicast address whose first
+	// two octets are the value 3333 hexadecimal and whose last
+	// four octets are the last four octets of DST.
+	return tcpip.LinkAddress([]byte{
+		0x33,
+		0x33,
+		addr[IPv6AddressSize-4],
+		addr[IPv6AddressSize-3],
+		addr[IPv6AddressSize-2],
+		addr[IPv6AddressSize-1],
+	})
 }
 
 // IsV6LinkLocalAddress determines if the provided address is an IPv6
@@ -0,0 +1,166 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import (
+	"encoding/binary"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+)
+
+// MLD is a Multicast Listener Discovery message, as defined in RFC 2710
+// section 3. It holds the message body, i.e. the bytes that follow the ICMPv6
+// type, code and checksum, of MLDv1 messages and MLDv2 queries.
+type MLD []byte
+
+const (
+	// MLDMinimumSize is the minimum size of a valid MLD message body, and
+	// the size of MLDv1 message bodies.
+	MLDMinimumSize = 20
+
+	// MLDv2QueryMinimumSize is the minimum size of a valid MLDv2 query
+	// body. Shorter queries come from MLDv1 queriers.
+	MLDv2QueryMinimumSize = 24
+
+	// MLDv2ReportMinimumSize is the size of the body of MLDv2 reports,
+	// without multicast address records.
+	MLDv2ReportMinimumSize = 4
+
+	// MLDv2AddressRecordMinimumSize is the size of a multicast address
+	// record of an MLDv2 report, without sources.
+	MLDv2AddressRecordMinimumSize = 20
+
+	// MLDHopLimit is the hop limit of all MLD messages, which never leave
+	// the local link (RFC 2710 section 3).
+	MLDHopLimit = 1
+
+	// IPv6AllMLDv2RoutersMulticastAddress is the link-local multicast
+	// group that all MLDv2-capable routers join, ff02::16, described in RFC
+	// 3810 section 5.2.14.
+	IPv6AllMLDv2RoutersMulticastAddress tcpip.Address = "\xff\x02\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x16"
+
+	mldMaxRespDelayOffset       = 0
+	mldMulticastAddressOffset   = 4
+	mldv2QRVOffset              = 20
+	mldv2NumSourcesOffset       = 22
+	mldv2NumRecordsOffset       = 2
+	mldv2RecordTypeOffset       = 0
+	mldv2RecordNumSourcesOffset = 2
+	mldv2RecordAddressOffset    = 4
+	mldMaxRespDelayUnit         = time.Millisecond
+)
+
+// MaxRespDelay returns the maximum response delay of an MLDv1 query.
+func (b MLD) MaxRespDelay() time.Duration {
+	return time.Duration(b.MaxRespCode()) * mldMaxRespDelayUnit
+}
+
+// MaxRespCode is the maximum response code field. It is called maximum
+// response delay in MLDv1.
+func (b MLD) MaxRespCode() uint16 {
+	return binary.BigEndian.Uint16(b[mldMaxRespDelayOffset:])
+}
+
+// SetMaxRespCode sets the maximum response code field.
+func (b MLD) SetMaxRespCode(c uint16) {
+	binary.BigEndian.PutUint16(b[mldMaxRespDelayOffset:], c)
+}
+
+// MulticastAddress is the multicast address field. It is the unspecified
+// address in general queries.
+func (b MLD) MulticastAddress() tcpip.Address {
+	return tcpip.Address(b[mldMulticastAddressOffset : mldMulticastAddressOffset+IPv6AddressSize])
+}
+
+// SetMulticastAddress sets the multicast address field.
+func (b MLD) SetMulticastAddress(addr tcpip.Address) {
+	copy(b[mldMulticastAddressOffset:], addr)
+}
+
+// MLDv2Query is the body of an MLDv2 query, as defined in RFC 3810 section
+// 5.1.
+type MLDv2Query MLD
+
+// MaxRespDelay returns the maximum response delay of the query, decoded from
+// its maximum response code as described in RFC 3810 section 5.1.3.
+func (b MLDv2Query) MaxRespDelay() time.Duration {
+	return time.Duration(decodeMaxRespCode(MLD(b).MaxRespCode(), 16)) * mldMaxRespDelayUnit
+}
+
+// MulticastAddress is the multicast address field of the query.
+func (b MLDv2Query) MulticastAddress() tcpip.Address {
+	return MLD(b).MulticastAddress()
+}
+
+// QuerierRobustnessVariable is the querier's robustness variable field, or 0
+// if it is greater than 7.
+func (b MLDv2Query) QuerierRobustnessVariable() uint8 {
+	return b[mldv2QRVOffset] & 0x7
+}
+
+// NumberOfSources is the number of sources field of the query.
+func (b MLDv2Query) NumberOfSources() uint16 {
+	return binary.BigEndian.Uint16(b[mldv2NumSourcesOffset:])
+}
+
+// MLDv2Report is the body of an MLDv2 report, as defined in RFC 3810 section
+// 5.2.
+type MLDv2Report []byte
+
+// NumberOfAddressRecords is the number of multicast address records field of
+// the report.
+func (b MLDv2Report) NumberOfAddressRecords() uint16 {
+	return binary.BigEndian.Uint16(b[mldv2NumRecordsOffset:])
+}
+
+// SetNumberOfAddressRecords sets the number of multicast address records field
+// of the report.
+func (b MLDv2Report) SetNumberOfAddressRecords(n uint16) {
+	binary.BigEndian.PutUint16(b[mldv2NumRecordsOffset:], n)
+}
+
+// AddressRecords returns the multicast address records of the report.
+func (b MLDv2Report) AddressRecords() []byte {
+	return b[MLDv2ReportMinimumSize:]
+}
+
+// MLDv2AddressRecord is a multicast address record of an MLDv2 report.
+type MLDv2AddressRecord []byte
+
+// RecordType is the record type field.
+func (b MLDv2AddressRecord) RecordType() GroupRecordType {
+	return GroupRecordType(b[mldv2RecordTypeOffset])
+}
+
+// SetRecordType sets the record type field.
+func (b MLDv2AddressRecord) SetRecordType(t GroupRecordType) {
+	b[mldv2RecordTypeOffset] = byte(t)
+}
+
+// NumberOfSources is the number of sources field of the record.
+func (b MLDv2AddressRecord) NumberOfSources() uint16 {
+	return binary.BigEndian.Uint16(b[mldv2RecordNumSourcesOffset:])
+}
+
+// MulticastAddress is the multicast address field of the record.
+func (b MLDv2AddressRecord) MulticastAddress() tcpip.Address {
+	return tcpip.Address(b[mldv2RecordAddressOffset : mldv2RecordAddressOffset+IPv6AddressSize])
+}
+
+// SetMulticastAddress sets the multicast address field of the record.
+func (b MLDv2AddressRecord) SetMulticastAddress(addr tcpip.Address) {
+	copy(b[mldv2RecordAddressOffset:], addr)
+}
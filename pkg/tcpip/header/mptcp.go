@@ -0,0 +1,666 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+)
+
+// MPTCPSubtype is the subtype of a multipath TCP option, as defined in RFC
+// 8684 section 3.
+type MPTCPSubtype uint8
+
+// MPTCP option subtypes.
+const (
+	MPTCPSubtypeCapable    MPTCPSubtype = 0
+	MPTCPSubtypeJoin       MPTCPSubtype = 1
+	MPTCPSubtypeDSS        MPTCPSubtype = 2
+	MPTCPSubtypeAddAddr    MPTCPSubtype = 3
+	MPTCPSubtypeRemoveAddr MPTCPSubtype = 4
+	MPTCPSubtypePrio       MPTCPSubtype = 5
+	MPTCPSubtypeFail       MPTCPSubtype = 6
+	MPTCPSubtypeFastclose  MPTCPSubtype = 7
+)
+
+const (
+	// MPTCPVersion is the version of the MPTCP protocol implemented here.
+	MPTCPVersion = 1
+
+	// MPTCPCapableFlagChecksum is the "A" flag of MP_CAPABLE, set when
+	// the sender requires DSS checksums.
+	MPTCPCapableFlagChecksum = 0x80
+
+	// MPTCPCapableFlagNoJoinToSource is the "C" flag of MP_CAPABLE, set
+	// when the sender will not accept subflows to its source address.
+	MPTCPCapableFlagNoJoinToSource = 0x20
+
+	// MPTCPCapableFlagHMACSHA256 is the "H" flag of MP_CAPABLE, selecting
+	// HMAC-SHA256 as the crypto algorithm.
+	MPTCPCapableFlagHMACSHA256 = 0x01
+)
+
+// Lengths of the fixed-size MPTCP options.
+const (
+	MPTCPCapableSynLength     = 4
+	MPTCPCapableSynAckLength  = 12
+	MPTCPCapableAckLength     = 20
+	MPTCPCapableDataLength    = 22
+	MPTCPJoinSynLength        = 12
+	MPTCPJoinSynAckLength     = 16
+	MPTCPJoinAckLength        = 24
+	MPTCPJoinTruncatedHMACLen = 8
+	MPTCPJoinHMACLen          = 20
+	MPTCPPrioLength           = 3
+	MPTCPFastcloseLength      = 12
+
+	// MPTCPDSSMaximumLength is the length of a DSS option carrying an
+	// 8-byte Data ACK and a mapping with an 8-byte DSN and no checksum,
+	// which is what this implementation sends.
+	MPTCPDSSMaximumLength = 26
+)
+
+const (
+	mptcpDSSFlagDataFin = 0x10
+	mptcpDSSFlagDSN64   = 0x08
+	mptcpDSSFlagMapping = 0x04
+	mptcpDSSFlagAck64   = 0x02
+	mptcpDSSFlagAck     = 0x01
+
+	mptcpJoinFlagBackup   = 0x01
+	mptcpAddAddrFlagEcho  = 0x01
+	mptcpPrioFlagBackup   = 0x01
+	mptcpAddAddrHMACLen   = 8
+	mptcpAddAddrBaseLen   = 4
+	mptcpRemoveAddrMinLen = 4
+)
+
+// MPTCPCapable is the MP_CAPABLE option used to negotiate MPTCP on the
+// initial subflow, see RFC 8684 section 3.1.
+type MPTCPCapable struct {
+	// Version is the MPTCP version requested by the sender.
+	Version uint8
+
+	// Flags holds the MPTCPCapableFlag* bits.
+	Flags uint8
+
+	// NumKeys is the number of keys carried. The SYN carries none, the
+	// SYN-ACK carries SenderKey and the third ACK carries both.
+	NumKeys int
+
+	// SenderKey is the key of the sender of the option.
+	SenderKey uint64
+
+	// ReceiverKey is the key of the receiver of the option.
+	ReceiverKey uint64
+
+	// HasDataLen is set when the option also maps the data it is sent
+	// with, in which case DataLen is the data-level length of the
+	// mapping. The mapping implicitly starts at relative subflow sequence
+	// number 1 and at the first data sequence number of the sender.
+	HasDataLen bool
+	DataLen    uint16
+}
+
+// MPTCPJoin is the MP_JOIN option used to associate a new subflow with an
+// existing MPTCP connection, see RFC 8684 section 3.2.
+type MPTCPJoin struct {
+	// Backup is set when the sender wishes the subflow to be used only
+	// as a backup.
+	Backup bool
+
+	// AddressID identifies the source address of the sender.
+	AddressID uint8
+
+	// Token identifies the connection being joined. It is only carried by
+	// the SYN.
+	Token uint32
+
+	// Nonce is the random number of the sender. It is carried by the SYN
+	// and the SYN-ACK.
+	Nonce uint32
+
+	// HMAC authenticates the sender. It is truncated to
+	// MPTCPJoinTruncatedHMACLen bytes in the SYN-ACK, is MPTCPJoinHMACLen
+	// bytes long in the third ACK and empty in the SYN.
+	HMAC []byte
+}
+
+// MPTCPDSS is the Data Sequence Signal option, see RFC 8684 section 3.3.
+type MPTCPDSS struct {
+	// DataFin is set when the mapping includes the DATA_FIN.
+	DataFin bool
+
+	// HasAck is set when DataAck is present, and Ack64 when it was
+	// encoded in 8 bytes. A 4-byte DataAck only holds the low 32 bits.
+	HasAck  bool
+	Ack64   bool
+	DataAck uint64
+
+	// HasMapping is set when the following fields are present. DSN64 is
+	// set when DSN was encoded in 8 bytes; otherwise it only holds the low
+	// 32 bits of the data sequence number.
+	HasMapping bool
+	DSN64      bool
+	DSN        uint64
+
+	// SSN is the relative subflow sequence number of the first byte of the
+	// mapping.
+	SSN uint32
+
+	// DataLen is the data-level length of the mapping.
+	DataLen uint16
+
+	// HasChecksum is set when the mapping carries a checksum.
+	HasChecksum bool
+	Checksum    uint16
+}
+
+// MPTCPAddAddr is the ADD_ADDR option used to announce additional addresses,
+// see RFC 8684 section 3.4.1.
+type MPTCPAddAddr struct {
+	// Echo is set when the option echoes a received announcement.
+	Echo bool
+
+	// AddressID identifies the announced address.
+	AddressID uint8
+
+	// Address is the announced address.
+	Address tcpip.Address
+
+	// Port is the announced port, or zero if the option has none.
+	Port uint16
+
+	// HMAC is the truncated HMAC authenticating the announcement. It is
+	// only present when Echo is not set.
+	HMAC uint64
+}
+
+// MPTCPOptions holds the MPTCP options of a segment. Fields of options that
+// are not present in the segment are nil or empty.
+type MPTCPOptions struct {
+	Capable    *MPTCPCapable
+	Join       *MPTCPJoin
+	DSS        *MPTCPDSS
+	AddAddr    []MPTCPAddAddr
+	RemoveAddr []uint8
+
+	// Prio is set when an MP_PRIO option is present; its value is the
+	// requested backup state.
+	Prio *bool
+
+	// Fastclose is set when an MP_FASTCLOSE option is present; its value
+	// is the receiver's key.
+	Fastclose *uint64
+}
+
+// ParseMPTCPOptions extracts the MPTCP options from the provided TCP option
+// bytes. isSyn must indicate whether the segment has the SYN flag set and isAck
+// whether it has the ACK flag set, as these determine the format of the
+// MP_JOIN option. Malformed MPTCP options are ignored.
+func ParseMPTCPOptions(b []byte, isSyn, isAck bool) MPTCPOptions {
+	var opts MPTCPOptions
+	limit := len(b)
+	for i := 0; i < limit; {
+		switch b[i] {
+		case TCPOptionEOL:
+			return opts
+		case TCPOptionNOP:
+			i++
+			continue
+		}
+
+		if i+2 > limit {
+			return opts
+		}
+		l := int(b[i+1])
+		if l < 2 || i+l > limit {
+			return opts
+		}
+		if b[i] == TCPOptionMPTCP && l >= 3 {
+			parseMPTCPOption(&opts, b[i:i+l], isSyn, isAck)
+		}
+		i += l
+	}
+	return opts
+}
+
+// parseMPTCPOption parses a single MPTCP option, whose length has already been
+// validated against the options limit.
+func parseMPTCPOption(opts *MPTCPOptions, b []byte, isSyn, isAck bool) {
+	l := len(b)
+	switch MPTCPSubtype(b[2] >> 4) {
+	case MPTCPSubtypeCapable:
+		if l < MPTCPCapableSynLength {
+			return
+		}
+		c := &MPTCPCapable{
+			Version: b[2] & 0xf,
+			Flags:   b[3],
+		}
+		switch l {
+		case MPTCPCapableSynLength:
+		case MPTCPCapableSynAckLength:
+			c.NumKeys = 1
+			c.SenderKey = binary.BigEndian.Uint64(b[4:])
+		case MPTCPCapableAckLength, MPTCPCapableDataLength, MPTCPCapableDataLength + 2:
+			c.NumKeys = 2
+			c.SenderKey = binary.BigEndian.Uint64(b[4:])
+			c.ReceiverKey = binary.BigEndian.Uint64(b[12:])
+			if l >= MPTCPCapableDataLength {
+				c.HasDataLen = true
+				c.DataLen = binary.BigEndian.Uint16(b[20:])
+			}
+		default:
+			return
+		}
+		opts.Capable = c
+
+	case MPTCPSubtypeJoin:
+		j := &MPTCPJoin{
+			Backup:    b[2]&mptcpJoinFlagBackup != 0,
+			AddressID: b[3],
+		}
+		switch {
+		case isSyn && !isAck && l == MPTCPJoinSynLength:
+			j.Token = binary.BigEndian.Uint32(b[4:])
+			j.Nonce = binary.BigEndian.Uint32(b[8:])
+		case isSyn && isAck && l == MPTCPJoinSynAckLength:
+			j.HMAC = append([]byte(nil), b[4:4+MPTCPJoinTruncatedHMACLen]...)
+			j.Nonce = binary.BigEndian.Uint32(b[12:])
+		case !isSyn && l == MPTCPJoinAckLength:
+			// The third ACK has no address ID or flags.
+			j.Backup = false
+			j.AddressID = 0
+			j.HMAC = append([]byte(nil), b[4:4+MPTCPJoinHMACLen]...)
+		default:
+			return
+		}
+		opts.Join = j
+
+	case MPTCPSubtypeDSS:
+		if l < 4 {
+			return
+		}
+		flags := b[3]
+		d := &MPTCPDSS{
+			DataFin:    flags&mptcpDSSFlagDataFin != 0,
+			HasAck:     flags&mptcpDSSFlagAck != 0,
+			Ack64:      flags&mptcpDSSFlagAck64 != 0,
+			HasMapping: flags&mptcpDSSFlagMapping != 0,
+			DSN64:      flags&mptcpDSSFlagDSN64 != 0,
+		}
+		off := 4
+		if d.HasAck {
+			if d.Ack64 {
+				if off+8 > l {
+					return
+				}
+				d.DataAck = binary.BigEndian.Uint64(b[off:])
+				off += 8
+			} else {
+				if off+4 > l {
+					return
+				}
+				d.DataAck = uint64(binary.BigEndian.Uint32(b[off:]))
+				off += 4
+			}
+		}
+		if d.HasMapping {
+			if d.DSN64 {
+				if off+8 > l {
+					return
+				}
+				d.DSN = binary.BigEndian.Uint64(b[off:])
+				off += 8
+			} else {
+				if off+4 > l {
+					return
+				}
+				d.DSN = uint64(binary.BigEndian.Uint32(b[off:]))
+				off += 4
+			}
+			if off+6 > l {
+				return
+			}
+			d.SSN = binary.BigEndian.Uint32(b[off:])
+			d.DataLen = binary.BigEndian.Uint16(b[off+4:])
+			off += 6
+			if off+2 <= l {
+				d.HasChecksum = true
+				d.Checksum = binary.BigEndian.Uint16(b[off:])
+			}
+		}
+		opts.DSS = d
+
+	case MPTCPSubtypeAddAddr:
+		a := MPTCPAddAddr{
+			Echo:      b[2]&mptcpAddAddrFlagEcho != 0,
+			AddressID: b[3],
+		}
+		n := l - mptcpAddAddrBaseLen
+		if !a.Echo {
+			n -= mptcpAddAddrHMACLen
+		}
+		var addrLen int
+		switch n {
+		case IPv4AddressSize, IPv4AddressSize + 2:
+			addrLen = IPv4AddressSize
+		case IPv6AddressSize, IPv6AddressSize + 2:
+			addrLen = IPv6AddressSize
+		default:
+			return
+		}
+		off := mptcpAddAddrBaseLen
+		a.Address = tcpip.Address(b[off : off+addrLen])
+		off += addrLen
+		if n > addrLen {
+			a.Port = binary.BigEndian.Uint16(b[off:])
+			off += 2
+		}
+		if !a.Echo {
+			a.HMAC = binary.BigEndian.Uint64(b[off:])
+		}
+		opts.AddAddr = append(opts.AddAddr, a)
+
+	case MPTCPSubtypeRemoveAddr:
+		if l < mptcpRemoveAddrMinLen {
+			return
+		}
+		opts.RemoveAddr = append(opts.RemoveAddr, b[3:]...)
+
+	case MPTCPSubtypePrio:
+		backup := b[2]&mptcpPrioFlagBackup != 0
+		opts.Prio = &backup
+
+	case MPTCPSubtypeFastclose:
+		if l != MPTCPFastcloseLength {
+			return
+		}
+		key := binary.BigEndian.Uint64(b[4:])
+		opts.Fastclose = &key
+	}
+}
+
+// EncodeMPTCPCapable encodes the provided MP_CAPABLE option into the provided
+// buffer. The format is selected by c.NumKeys and c.HasDataLen. If the buffer
+// is smaller than required it just returns without encoding anything. It
+// returns the number of bytes written to the provided buffer.
+func EncodeMPTCPCapable(c *MPTCPCapable, b []byte) int {
+	l := MPTCPCapableSynLength
+	switch {
+	case c.NumKeys == 1:
+		l = MPTCPCapableSynAckLength
+	case c.NumKeys == 2 && c.HasDataLen:
+		l = MPTCPCapableDataLength
+	case c.NumKeys == 2:
+		l = MPTCPCapableAckLength
+	}
+	if len(b) < l {
+		return 0
+	}
+
+	b[0], b[1] = TCPOptionMPTCP, byte(l)
+	b[2] = byte(MPTCPSubtypeCapable)<<4 | c.Version&0xf
+	b[3] = c.Flags
+	if c.NumKeys >= 1 {
+		binary.BigEndian.PutUint64(b[4:], c.SenderKey)
+	}
+	if c.NumKeys == 2 {
+		binary.BigEndian.PutUint64(b[12:], c.ReceiverKey)
+	}
+	if c.NumKeys == 2 && c.HasDataLen {
+		binary.BigEndian.PutUint16(b[20:], c.DataLen)
+	}
+	return l
+}
+
+// EncodeMPTCPJoin encodes the provided MP_JOIN option into the provided
+// buffer. The format is selected by the length of j.HMAC: the SYN carries no
+// HMAC, the SYN-ACK a truncated one and the third ACK a full one. If the buffer
+// is smaller than required it just returns without encoding anything. It
+// returns the number of bytes written to the provided buffer.
+func EncodeMPTCPJoin(j *MPTCPJoin, b []byte) int {
+	var l int
+	switch len(j.HMAC) {
+	case 0:
+		l = MPTCPJoinSynLength
+	case MPTCPJoinTruncatedHMACLen:
+		l = MPTCPJoinSynAckLength
+	case MPTCPJoinHMACLen:
+		l = MPTCPJoinAckLength
+	default:
+		return 0
+	}
+	if len(b) < l {
+		return 0
+	}
+
+	b[0], b[1] = TCPOptionMPTCP, byte(l)
+	b[2] = byte(MPTCPSubtypeJoin) << 4
+	b[3] = 0
+	if l == MPTCPJoinAckLength {
+		copy(b[4:], j.HMAC)
+		return l
+	}
+	if j.Backup {
+		b[2] |= mptcpJoinFlagBackup
+	}
+	b[3] = j.AddressID
+	if l == MPTCPJoinSynLength {
+		binary.BigEndian.PutUint32(b[4:], j.Token)
+		binary.BigEndian.PutUint32(b[8:], j.Nonce)
+	} else {
+		copy(b[4:], j.HMAC)
+		binary.BigEndian.PutUint32(b[12:], j.Nonce)
+	}
+	return l
+}
+
+// EncodeMPTCPDSS encodes the provided DSS option into the provided buffer. The
+// Data ACK and the DSN are encoded in 8 bytes when d.Ack64 and d.DSN64 are set
+// respectively. If the buffer is smaller than required it just returns without
+// encoding anything. It returns the number of bytes written to the provided
+// buffer.
+func EncodeMPTCPDSS(d *MPTCPDSS, b []byte) int {
+	l := 4
+	var flags byte
+	if d.HasAck {
+		flags |= mptcpDSSFlagAck
+		l += 4
+		if d.Ack64 {
+			flags |= mptcpDSSFlagAck64
+			l += 4
+		}
+	}
+	if d.HasMapping {
+		flags |= mptcpDSSFlagMapping
+		l += 4 + 6
+		if d.DSN64 {
+			flags |= mptcpDSSFlagDSN64
+			l += 4
+		}
+		if d.HasChecksum {
+			l += 2
+		}
+		if d.DataFin {
+			flags |= mptcpDSSFlagDataFin
+		}
+	}
+	if len(b) < l {
+		return 0
+	}
+
+	b[0], b[1] = TCPOptionMPTCP, byte(l)
+	b[2] = byte(MPTCPSubtypeDSS) << 4
+	b[3] = flags
+	off := 4
+	if d.HasAck {
+		if d.Ack64 {
+			binary.BigEndian.PutUint64(b[off:], d.DataAck)
+			off += 8
+		} else {
+			binary.BigEndian.PutUint32(b[off:], uint32(d.DataAck))
+			off += 4
+		}
+	}
+	if d.HasMapping {
+		if d.DSN64 {
+			binary.BigEndian.PutUint64(b[off:], d.DSN)
+			off += 8
+		} else {
+			binary.BigEndian.PutUint32(b[off:], uint32(d.DSN))
+			off += 4
+		}
+		binary.BigEndian.PutUint32(b[off:], d.SSN)
+		binary.BigEndian.PutUint16(b[off+4:], d.DataLen)
+		off += 6
+		if d.HasChecksum {
+			binary.BigEndian.PutUint16(b[off:], d.Checksum)
+		}
+	}
+	return l
+}
+
+// EncodeMPTCPAddAddr encodes the provided ADD_ADDR option into the provided
+// buffer. The port is only encoded if it is not zero, and the HMAC only if the
+// option is not an echo. If the buffer is smaller than required it just
+// returns without encoding anything. It returns the number of bytes written to
+// the provided buffer.
+func EncodeMPTCPAddAddr(a *MPTCPAddAddr, b []byte) int {
+	l := mptcpAddAddrBaseLen + len(a.Address)
+	if a.Port != 0 {
+		l += 2
+	}
+	if !a.Echo {
+		l += mptcpAddAddrHMACLen
+	}
+	if len(b) < l {
+		return 0
+	}
+
+	b[0], b[1] = TCPOptionMPTCP, byte(l)
+	b[2] = byte(MPTCPSubtypeAddAddr) << 4
+	if a.Echo {
+		b[2] |= mptcpAddAddrFlagEcho
+	}
+	b[3] = a.AddressID
+	off := mptcpAddAddrBaseLen + copy(b[mptcpAddAddrBaseLen:], a.Address)
+	if a.Port != 0 {
+		binary.BigEndian.PutUint16(b[off:], a.Port)
+		off += 2
+	}
+	if !a.Echo {
+		binary.BigEndian.PutUint64(b[off:], a.HMAC)
+	}
+	return l
+}
+
+// EncodeMPTCPRemoveAddr encodes a REMOVE_ADDR option for the provided address
+// IDs into the provided buffer. If the buffer is smaller than required it just
+// returns without encoding anything. It returns the number of bytes written to
+// the provided buffer.
+func EncodeMPTCPRemoveAddr(ids []uint8, b []byte) int {
+	l := 3 + len(ids)
+	if len(ids) == 0 || len(b) < l {
+		return 0
+	}
+
+	b[0], b[1] = TCPOptionMPTCP, byte(l)
+	b[2] = byte(MPTCPSubtypeRemoveAddr) << 4
+	copy(b[3:], ids)
+	return l
+}
+
+// EncodeMPTCPPrio encodes an MP_PRIO option requesting the provided backup
+// state into the provided buffer. If the buffer is smaller than required it
+// just returns without encoding anything. It returns the number of bytes
+// written to the provided buffer.
+func EncodeMPTCPPrio(backup bool, b []byte) int {
+	if len(b) < MPTCPPrioLength {
+		return 0
+	}
+
+	b[0], b[1] = TCPOptionMPTCP, MPTCPPrioLength
+	b[2] = byte(MPTCPSubtypePrio) << 4
+	if backup {
+		b[2] |= mptcpPrioFlagBackup
+	}
+	return MPTCPPrioLength
+}
+
+// EncodeMPTCPFastclose encodes an MP_FASTCLOSE option carrying the receiver's
+// key into the provided buffer. If the buffer is smaller than required it just
+// returns without encoding anything. It returns the number of bytes written to
+// the provided buffer.
+func EncodeMPTCPFastclose(key uint64, b []byte) int {
+	if len(b) < MPTCPFastcloseLength {
+		return 0
+	}
+
+	b[0], b[1] = TCPOptionMPTCP, MPTCPFastcloseLength
+	b[2] = byte(MPTCPSubtypeFastclose) << 4
+	b[3] = 0
+	binary.BigEndian.PutUint64(b[4:], key)
+	return MPTCPFastcloseLength
+}
+
+// MPTCPTokenAndIDSN returns the token and the initial data sequence number
+// derived from the provided key, which are respectively the most significant 32
+// bits and the least significant 64 bits of the SHA-256 hash of the key.
+func MPTCPTokenAndIDSN(key uint64) (uint32, uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], key)
+	sum := sha256.Sum256(b[:])
+	return binary.BigEndian.Uint32(sum[:]), binary.BigEndian.Uint64(sum[sha256.Size-8:])
+}
+
+// mptcpHMAC computes the HMAC-SHA256 of msg keyed by keyA followed by keyB.
+func mptcpHMAC(keyA, keyB uint64, msg []byte) []byte {
+	var key [16]byte
+	binary.BigEndian.PutUint64(key[:], keyA)
+	binary.BigEndian.PutUint64(key[8:], keyB)
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write(msg)
+	return mac.Sum(nil)
+}
+
+// MPTCPJoinHMAC computes the HMAC used to authenticate an MP_JOIN handshake
+// (RFC 8684 section 3.2). keyA and nonceA are those of the host sending the
+// HMAC, keyB and nonceB those of its peer. The SYN-ACK carries the leftmost
+// MPTCPJoinTruncatedHMACLen bytes and the third ACK the leftmost
+// MPTCPJoinHMACLen bytes of the result.
+func MPTCPJoinHMAC(keyA, keyB uint64, nonceA, nonceB uint32) []byte {
+	var msg [8]byte
+	binary.BigEndian.PutUint32(msg[:], nonceA)
+	binary.BigEndian.PutUint32(msg[4:], nonceB)
+	return mptcpHMAC(keyA, keyB, msg[:])
+}
+
+// MPTCPAddAddrHMAC computes the truncated HMAC authenticating an ADD_ADDR
+// option (RFC 8684 section 3.4.1), which is the rightmost 64 bits of the HMAC
+// of the address ID, address and port keyed by the key of the sender of the
+// announcement (keyA) followed by the key of its peer (keyB).
+func MPTCPAddAddrHMAC(keyA, keyB uint64, id uint8, addr tcpip.Address, port uint16) uint64 {
+	msg := make([]byte, 0, 1+len(addr)+2)
+	msg = append(msg, id)
+	msg = append(msg, addr...)
+	msg = append(msg, byte(port>>8), byte(port))
+	sum := mptcpHMAC(keyA, keyB, msg)
+	return binary.BigEndian.Uint64(sum[len(sum)-8:])
+}
@@ -0,0 +1,233 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+)
+
+// NDPRouterAdvert is an NDP Router Advertisement message, as defined in RFC
+// 4861 section 4.2. It holds the message body, i.e. the bytes that follow the
+// ICMPv6 type, code and checksum.
+type NDPRouterAdvert []byte
+
+const (
+	// NDPRAMinimumSize is the minimum size of a valid NDP Router
+	// Advertisement message body.
+	NDPRAMinimumSize = 12
+
+	// NDPRSMinimumSize is the minimum size of a valid NDP Router
+	// Solicitation message body. It only contains reserved bytes.
+	NDPRSMinimumSize = 4
+
+	// NDPHopLimit is the hop limit of all NDP messages. Receivers discard
+	// NDP messages with a different hop limit, as they can't come from the
+	// local link (RFC 4861 section 6.1).
+	NDPHopLimit = 255
+
+	// NDPInfiniteLifetime is used for lifetimes that never expire. On the
+	// wire, it is represented by all ones.
+	NDPInfiniteLifetime = time.Duration(math.MaxInt64)
+
+	ndpRACurrHopLimitOffset    = 0
+	ndpRAFlagsOffset           = 1
+	ndpRARouterLifetimeOffset  = 2
+	ndpRAReachableTimeOffset   = 4
+	ndpRARetransTimerOffset    = 8
+	ndpRAManagedAddrConfFlag   = 1 << 7
+	ndpRAOtherConfFlag         = 1 << 6
+	ndpInfiniteLifetimeEncoded = math.MaxUint32
+)
+
+// CurrHopLimit returns the default hop limit advertised by the router, or 0
+// if it is unspecified.
+func (b NDPRouterAdvert) CurrHopLimit() uint8 {
+	return b[ndpRACurrHopLimitOffset]
+}
+
+// ManagedAddrConfFlag returns whether addresses are available through
+// DHCPv6.
+func (b NDPRouterAdvert) ManagedAddrConfFlag() bool {
+	return b[ndpRAFlagsOffset]&ndpRAManagedAddrConfFlag != 0
+}
+
+// OtherConfFlag returns whether other configuration, such as DNS servers, is
+// available through DHCPv6.
+func (b NDPRouterAdvert) OtherConfFlag() bool {
+	return b[ndpRAFlagsOffset]&ndpRAOtherConfFlag != 0
+}
+
+// RouterLifetime returns how long the router may be used as a default router.
+// A lifetime of 0 means that the router is not a default router.
+func (b NDPRouterAdvert) RouterLifetime() time.Duration {
+	return time.Duration(binary.BigEndian.Uint16(b[ndpRARouterLifetimeOffset:])) * time.Second
+}
+
+// ReachableTime returns how long a neighbor is considered reachable after a
+// reachability confirmation, or 0 if it is unspecified.
+func (b NDPRouterAdvert) ReachableTime() time.Duration {
+	return time.Duration(binary.BigEndian.Uint32(b[ndpRAReachableTimeOffset:])) * time.Millisecond
+}
+
+// RetransTimer returns the time between retransmitted Neighbor Solicitation
+// messages, or 0 if it is unspecified.
+func (b NDPRouterAdvert) RetransTimer() time.Duration {
+	return time.Duration(binary.BigEndian.Uint32(b[ndpRARetransTimerOffset:])) * time.Millisecond
+}
+
+// Options returns the options of the message.
+func (b NDPRouterAdvert) Options() NDPOptions {
+	return NDPOptions(b[NDPRAMinimumSize:])
+}
+
+// NDPOptionType is the type of an NDP option, as defined in RFC 4861 section
+// 4.6.
+type NDPOptionType uint8
+
+// NDP option types.
+const (
+	NDPSourceLinkLayerAddressOption NDPOptionType = 1
+	NDPTargetLinkLayerAddressOption NDPOptionType = 2
+	NDPPrefixInformationOption      NDPOptionType = 3
+)
+
+// ndpOptionLengthUnit is the unit of the length field of NDP options.
+const ndpOptionLengthUnit = 8
+
+// ErrNDPOptionMalformed is returned when NDP options can't be parsed.
+var ErrNDPOptionMalformed = errors.New("malformed NDP option")
+
+// NDPOption is a single NDP option.
+type NDPOption struct {
+	// Type is the option type.
+	Type NDPOptionType
+
+	// Body is the option data following the type and length fields.
+	Body []byte
+}
+
+// NDPOptions is a buffer of NDP options, as found at the end of NDP messages.
+type NDPOptions []byte
+
+// Parse returns the options in b. Options of unknown types are returned as is,
+// to be ignored by the caller as required by RFC 4861 section 4.6.
+func (b NDPOptions) Parse() ([]NDPOption, error) {
+	var opts []NDPOption
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return nil, ErrNDPOptionMalformed
+		}
+		// All options must have a non-zero length (RFC 4861 section
+		// 4.6).
+		l := int(b[1]) * ndpOptionLengthUnit
+		if l == 0 || l > len(b) {
+			return nil, ErrNDPOptionMalformed
+		}
+		opts = append(opts, NDPOption{
+			Type: NDPOptionType(b[0]),
+			Body: b[2:l],
+		})
+		b = b[l:]
+	}
+	return opts, nil
+}
+
+// NDPPrefixInformation is the body of an NDP Prefix Information option, as
+// defined in RFC 4861 section 4.6.2.
+type NDPPrefixInformation []byte
+
+const (
+	// NDPPrefixInformationSize is the size of the body of a Prefix
+	// Information option.
+	NDPPrefixInformationSize = 30
+
+	ndpPrefixInformationPrefixLengthOffset      = 0
+	ndpPrefixInformationFlagsOffset             = 1
+	ndpPrefixInformationValidLifetimeOffset     = 2
+	ndpPrefixInformationPreferredLifetimeOffset = 6
+	ndpPrefixInformationPrefixOffset            = 14
+	ndpPrefixInformationOnLinkFlag              = 1 << 7
+	ndpPrefixInformationAutonomousFlag          = 1 << 6
+)
+
+// PrefixLength returns the number of leading bits of Prefix that are valid.
+func (b NDPPrefixInformation) PrefixLength() uint8 {
+	return b[ndpPrefixInformationPrefixLengthOffset]
+}
+
+// OnLinkFlag returns whether the prefix can be used for on-link
+// determination.
+func (b NDPPrefixInformation) OnLinkFlag() bool {
+	return b[ndpPrefixInformationFlagsOffset]&ndpPrefixInformationOnLinkFlag != 0
+}
+
+// AutonomousAddressConfigurationFlag returns whether the prefix can be used
+// for stateless address autoconfiguration.
+func (b NDPPrefixInformation) AutonomousAddressConfigurationFlag() bool {
+	return b[ndpPrefixInformationFlagsOffset]&ndpPrefixInformationAutonomousFlag != 0
+}
+
+// ValidLifetime returns how long the prefix is valid for on-link
+// determination and for addresses generated from it.
+func (b NDPPrefixInformation) ValidLifetime() time.Duration {
+	return ndpLifetime(binary.BigEndian.Uint32(b[ndpPrefixInformationValidLifetimeOffset:]))
+}
+
+// PreferredLifetime returns how long addresses generated from the prefix
+// remain preferred.
+func (b NDPPrefixInformation) PreferredLifetime() time.Duration {
+	return ndpLifetime(binary.BigEndian.Uint32(b[ndpPrefixInformationPreferredLifetimeOffset:]))
+}
+
+// Prefix returns the prefix, with the bits after PrefixLength cleared.
+func (b NDPPrefixInformation) Prefix() tcpip.Address {
+	sn := b.Subnet()
+	return sn.ID()
+}
+
+// Subnet returns the prefix as a subnet. The prefix length is capped at 128
+// bits.
+func (b NDPPrefixInformation) Subnet() tcpip.Subnet {
+	l := int(b.PrefixLength())
+	if l > IPv6AddressSize*8 {
+		l = IPv6AddressSize * 8
+	}
+	var mask [IPv6AddressSize]byte
+	for i := 0; i < l; i++ {
+		mask[i/8] |= 0x80 >> uint(i%8)
+	}
+	var prefix [IPv6AddressSize]byte
+	for i := range prefix {
+		prefix[i] = b[ndpPrefixInformationPrefixOffset+i] & mask[i]
+	}
+	sn, err := tcpip.NewSubnet(tcpip.Address(prefix[:]), tcpip.AddressMask(mask[:]))
+	if err != nil {
+		// The prefix is masked, so this can't happen.
+		panic(err)
+	}
+	return sn
+}
+
+func ndpLifetime(v uint32) time.Duration {
+	if v == ndpInfiniteLifetimeEncoded {
+		return NDPInfiniteLifetime
+	}
+	return time.Duration(v) * time.Second
+}
@@ -0,0 +1,171 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header_test
+
+import (
+	"testing"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+)
+
+func TestNDPRouterAdvert(t *testing.T) {
+	b := []byte{
+		64, 0xc0, 0x07, 0x08,
+		0, 0, 0x03, 0xe8,
+		0, 0, 0x01, 0xf4,
+	}
+	ra := header.NDPRouterAdvert(b)
+
+	if got, want := ra.CurrHopLimit(), uint8(64); got != want {
+		t.Errorf("got CurrHopLimit() = %d, want = %d", got, want)
+	}
+	if !ra.ManagedAddrConfFlag() {
+		t.Errorf("got ManagedAddrConfFlag() = false, want = true")
+	}
+	if !ra.OtherConfFlag() {
+		t.Errorf("got OtherConfFlag() = false, want = true")
+	}
+	if got, want := ra.RouterLifetime(), 0x0708*time.Second; got != want {
+		t.Errorf("got RouterLifetime() = %s, want = %s", got, want)
+	}
+	if got, want := ra.ReachableTime(), time.Second; got != want {
+		t.Errorf("got ReachableTime() = %s, want = %s", got, want)
+	}
+	if got, want := ra.RetransTimer(), 500*time.Millisecond; got != want {
+		t.Errorf("got RetransTimer() = %s, want = %s", got, want)
+	}
+	if got := len(ra.Options()); got != 0 {
+		t.Errorf("got len(Options()) = %d, want = 0", got)
+	}
+}
+
+func TestNDPOptionsParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		b       []byte
+		want    []header.NDPOption
+		wantErr bool
+	}{
+		{
+			name: "Empty",
+		},
+		{
+			name: "Unknown option",
+			b:    []byte{255, 1, 1, 2, 3, 4, 5, 6},
+			want: []header.NDPOption{{Type: 255, Body: []byte{1, 2, 3, 4, 5, 6}}},
+		},
+		{
+			name: "Two options",
+			b: []byte{
+				1, 1, 1, 2, 3, 4, 5, 6,
+				2, 1, 6, 5, 4, 3, 2, 1,
+			},
+			want: []header.NDPOption{
+				{Type: header.NDPSourceLinkLayerAddressOption, Body: []byte{1, 2, 3, 4, 5, 6}},
+				{Type: header.NDPTargetLinkLayerAddressOption, Body: []byte{6, 5, 4, 3, 2, 1}},
+			},
+		},
+		{
+			name:    "Zero length",
+			b:       []byte{1, 0, 1, 2, 3, 4, 5, 6},
+			wantErr: true,
+		},
+		{
+			name:    "Truncated",
+			b:       []byte{1, 2, 1, 2, 3, 4, 5, 6},
+			wantErr: true,
+		},
+		{
+			name:    "Missing length",
+			b:       []byte{1},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts, err := header.NDPOptions(test.b).Parse()
+			if test.wantErr {
+				if err != header.ErrNDPOptionMalformed {
+					t.Fatalf("got Parse() = _, %v, want = _, %v", err, header.ErrNDPOptionMalformed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			if len(opts) != len(test.want) {
+				t.Fatalf("got Parse() = %v, want = %v", opts, test.want)
+			}
+			for i := range opts {
+				if opts[i].Type != test.want[i].Type || string(opts[i].Body) != string(test.want[i].Body) {
+					t.Errorf("got option %d = %v, want = %v", i, opts[i], test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNDPPrefixInformation(t *testing.T) {
+	b := []byte{
+		60, 0xc0,
+		0, 0, 0x0e, 0x10,
+		0xff, 0xff, 0xff, 0xff,
+		0, 0, 0, 0,
+		0x20, 0x01, 0x0d, 0xb8, 0x12, 0x34, 0x56, 0x7f,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	}
+	pi := header.NDPPrefixInformation(b)
+
+	if got, want := pi.PrefixLength(), uint8(60); got != want {
+		t.Errorf("got PrefixLength() = %d, want = %d", got, want)
+	}
+	if !pi.OnLinkFlag() {
+		t.Errorf("got OnLinkFlag() = false, want = true")
+	}
+	if !pi.AutonomousAddressConfigurationFlag() {
+		t.Errorf("got AutonomousAddressConfigurationFlag() = false, want = true")
+	}
+	if got, want := pi.ValidLifetime(), time.Hour; got != want {
+		t.Errorf("got ValidLifetime() = %s, want = %s", got, want)
+	}
+	if got, want := pi.PreferredLifetime(), header.NDPInfiniteLifetime; got != want {
+		t.Errorf("got PreferredLifetime() = %s, want = %s", got, want)
+	}
+
+	// The bits after the prefix length are cleared.
+	want := tcpip.Address("\x20\x01\x0d\xb8\x12\x34\x56\x70\x00\x00\x00\x00\x00\x00\x00\x00")
+	if got := pi.Prefix(); got != want {
+		t.Errorf("got Prefix() = %s, want = %s", got, want)
+	}
+	sn := pi.Subnet()
+	if got := sn.Prefix(); got != 60 {
+		t.Errorf("got Subnet().Prefix() = %d, want = 60", got)
+	}
+	if !sn.Contains("\x20\x01\x0d\xb8\x12\x34\x56\x7f\x00\x00\x00\x00\x00\x00\x00\x01") {
+		t.Errorf("Subnet() = %v doesn't contain an address of the prefix", sn)
+	}
+}
+
+func TestSLAACAddr(t *testing.T) {
+	prefix := tcpip.Address("\x20\x01\x0d\xb8\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00")
+	linkAddr := tcpip.LinkAddress("\x02\x03\x04\x05\x06\x07")
+	want := tcpip.Address("\x20\x01\x0d\xb8\x00\x00\x00\x01\x00\x03\x04\xff\xfe\x05\x06\x07")
+	if got := header.SLAACAddr(prefix, linkAddr); got != want {
+		t.Errorf("got SLAACAddr(%s, %s) = %s, want = %s", prefix, linkAddr, got, want)
+	}
+}
@@ -0,0 +1,500 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+)
+
+const (
+	sctpSrcPort  = 0
+	sctpDstPort  = 2
+	sctpVerifTag = 4
+	sctpChecksum = 8
+)
+
+// SCTP represents an SCTP packet stored in a byte array. It starts with the
+// common header described in RFC 4960 section 3.1, followed by chunks.
+type SCTP []byte
+
+const (
+	// SCTPMinimumSize is the size of the SCTP common header.
+	SCTPMinimumSize = 12
+
+	// SCTPProtocolNumber is SCTP's transport protocol number.
+	SCTPProtocolNumber tcpip.TransportProtocolNumber = 132
+
+	// SCTPChunkHeaderSize is the size of the type, flags and length
+	// fields that start every chunk.
+	SCTPChunkHeaderSize = 4
+
+	// SCTPParameterHeaderSize is the size of the type and length fields
+	// that start every parameter and error cause.
+	SCTPParameterHeaderSize = 4
+
+	// SCTPInitSize is the size of the fixed fields of the value of INIT
+	// and INIT ACK chunks.
+	SCTPInitSize = 16
+
+	// SCTPDataSize is the size of the fixed fields of the value of DATA
+	// chunks.
+	SCTPDataSize = 12
+
+	// SCTPSackSize is the size of the fixed fields of the value of SACK
+	// chunks.
+	SCTPSackSize = 12
+
+	// SCTPForwardTSNSize is the size of the fixed fields of the value of
+	// FORWARD TSN chunks.
+	SCTPForwardTSNSize = 4
+)
+
+// SCTPChunkType is the type of an SCTP chunk.
+type SCTPChunkType uint8
+
+// Values for SCTPChunkType, from RFC 4960 section 3.2 and RFC 3758 section
+// 3.2.
+const (
+	SCTPChunkData             SCTPChunkType = 0
+	SCTPChunkInit             SCTPChunkType = 1
+	SCTPChunkInitAck          SCTPChunkType = 2
+	SCTPChunkSack             SCTPChunkType = 3
+	SCTPChunkHeartbeat        SCTPChunkType = 4
+	SCTPChunkHeartbeatAck     SCTPChunkType = 5
+	SCTPChunkAbort            SCTPChunkType = 6
+	SCTPChunkShutdown         SCTPChunkType = 7
+	SCTPChunkShutdownAck      SCTPChunkType = 8
+	SCTPChunkError            SCTPChunkType = 9
+	SCTPChunkCookieEcho       SCTPChunkType = 10
+	SCTPChunkCookieAck        SCTPChunkType = 11
+	SCTPChunkShutdownComplete SCTPChunkType = 14
+	SCTPChunkForwardTSN       SCTPChunkType = 192
+)
+
+// Flags of SCTP chunks.
+const (
+	// SCTPFlagEnd, SCTPFlagBeginning and SCTPFlagUnordered are the E, B
+	// and U flags of DATA chunks.
+	SCTPFlagEnd       = 1 << 0
+	SCTPFlagBeginning = 1 << 1
+	SCTPFlagUnordered = 1 << 2
+
+	// SCTPFlagNoTCB is the T flag of ABORT and SHUTDOWN COMPLETE chunks,
+	// set when the sender has no association, and the packet carries the
+	// verification tag of the receiver.
+	SCTPFlagNoTCB = 1 << 0
+)
+
+// SCTPParameterType is the type of a parameter of INIT and INIT ACK chunks,
+// or of the value of HEARTBEAT chunks.
+type SCTPParameterType uint16
+
+// Values for SCTPParameterType, from RFC 4960 section 3.3.2 and RFC 3758
+// section 3.1.
+const (
+	SCTPParamHeartbeatInfo         SCTPParameterType = 1
+	SCTPParamIPv4Address           SCTPParameterType = 5
+	SCTPParamIPv6Address           SCTPParameterType = 6
+	SCTPParamStateCookie           SCTPParameterType = 7
+	SCTPParamSupportedAddressTypes SCTPParameterType = 12
+	SCTPParamForwardTSNSupported   SCTPParameterType = 0xc000
+)
+
+// SCTPErrorCause is the code of an error cause of ERROR and ABORT chunks.
+type SCTPErrorCause uint16
+
+// Values for SCTPErrorCause, from RFC 4960 section 3.3.10.
+const (
+	SCTPCauseInvalidStreamIdentifier SCTPErrorCause = 1
+	SCTPCauseStaleCookie             SCTPErrorCause = 3
+	SCTPCauseUnrecognizedChunkType   SCTPErrorCause = 6
+	SCTPCauseNoUserData              SCTPErrorCause = 9
+	SCTPCauseUserInitiatedAbort      SCTPErrorCause = 12
+	SCTPCauseProtocolViolation       SCTPErrorCause = 13
+)
+
+var sctpCRC32CTable = crc32.MakeTable(crc32.Castagnoli)
+
+// SourcePort returns the "source port" field of the SCTP header.
+func (b SCTP) SourcePort() uint16 {
+	return binary.BigEndian.Uint16(b[sctpSrcPort:])
+}
+
+// DestinationPort returns the "destination port" field of the SCTP header.
+func (b SCTP) DestinationPort() uint16 {
+	return binary.BigEndian.Uint16(b[sctpDstPort:])
+}
+
+// VerificationTag returns the "verification tag" field of the SCTP header.
+func (b SCTP) VerificationTag() uint32 {
+	return binary.BigEndian.Uint32(b[sctpVerifTag:])
+}
+
+// Checksum returns the "checksum" field of the SCTP header.
+func (b SCTP) Checksum() uint32 {
+	// The CRC32c is stored least significant byte first (RFC 4960
+	// appendix B).
+	return binary.LittleEndian.Uint32(b[sctpChecksum:])
+}
+
+// SetSourcePort sets the "source port" field of the SCTP header.
+func (b SCTP) SetSourcePort(port uint16) {
+	binary.BigEndian.PutUint16(b[sctpSrcPort:], port)
+}
+
+// SetDestinationPort sets the "destination port" field of the SCTP header.
+func (b SCTP) SetDestinationPort(port uint16) {
+	binary.BigEndian.PutUint16(b[sctpDstPort:], port)
+}
+
+// SetVerificationTag sets the "verification tag" field of the SCTP header.
+func (b SCTP) SetVerificationTag(tag uint32) {
+	binary.BigEndian.PutUint32(b[sctpVerifTag:], tag)
+}
+
+// SetChecksum sets the "checksum" field of the SCTP header.
+func (b SCTP) SetChecksum(checksum uint32) {
+	binary.LittleEndian.PutUint32(b[sctpChecksum:], checksum)
+}
+
+// CalculateChecksum calculates the CRC32c checksum of the whole packet, which
+// must be stored contiguously in b, as if its checksum field was zero.
+func (b SCTP) CalculateChecksum() uint32 {
+	xsum := crc32.Update(0, sctpCRC32CTable, b[:sctpChecksum])
+	xsum = crc32.Update(xsum, sctpCRC32CTable, []byte{0, 0, 0, 0})
+	return crc32.Update(xsum, sctpCRC32CTable, b[SCTPMinimumSize:])
+}
+
+// IsChecksumValid returns true if the checksum of the packet is valid.
+func (b SCTP) IsChecksumValid() bool {
+	return b.CalculateChecksum() == b.Checksum()
+}
+
+// Chunks returns the chunks of the packet. It returns false if the packet is
+// malformed.
+func (b SCTP) Chunks() ([]SCTPChunk, bool) {
+	var chunks []SCTPChunk
+	for rest := []byte(b[SCTPMinimumSize:]); len(rest) > 0; {
+		if len(rest) < SCTPChunkHeaderSize {
+			return nil, false
+		}
+		c := SCTPChunk(rest)
+		l := int(c.Length())
+		if l < SCTPChunkHeaderSize || l > len(rest) {
+			return nil, false
+		}
+		chunks = append(chunks, c[:l])
+
+		// The padding of the last chunk may be missing.
+		l = sctpPadded(l)
+		if l > len(rest) {
+			l = len(rest)
+		}
+		rest = rest[l:]
+	}
+	return chunks, len(chunks) > 0
+}
+
+// sctpPadded returns n rounded up to a multiple of 4, the alignment of chunks
+// and parameters.
+func sctpPadded(n int) int {
+	return (n + 3) &^ 3
+}
+
+// SCTPChunk is a chunk of an SCTP packet, without its padding.
+type SCTPChunk []byte
+
+// Type returns the type of the chunk.
+func (c SCTPChunk) Type() SCTPChunkType {
+	return SCTPChunkType(c[0])
+}
+
+// Flags returns the flags of the chunk.
+func (c SCTPChunk) Flags() uint8 {
+	return c[1]
+}
+
+// Length returns the length of the chunk, including its header but not its
+// padding.
+func (c SCTPChunk) Length() uint16 {
+	return binary.BigEndian.Uint16(c[2:])
+}
+
+// Value returns the value of the chunk.
+func (c SCTPChunk) Value() []byte {
+	return c[SCTPChunkHeaderSize:]
+}
+
+// SCTPAppendChunk appends a chunk with the given type, flags and value, along
+// with its padding, to b.
+func SCTPAppendChunk(b []byte, typ SCTPChunkType, flags uint8, value []byte) []byte {
+	var h [SCTPChunkHeaderSize]byte
+	h[0] = byte(typ)
+	h[1] = flags
+	binary.BigEndian.PutUint16(h[2:], uint16(SCTPChunkHeaderSize+len(value)))
+	b = append(b, h[:]...)
+	b = append(b, value...)
+	return sctpAppendPadding(b, len(value))
+}
+
+func sctpAppendPadding(b []byte, n int) []byte {
+	for i := n; i < sctpPadded(n); i++ {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// SCTPParameter is a parameter of INIT and INIT ACK chunks, or the value of
+// HEARTBEAT chunks, without its padding. Error causes have the same format.
+type SCTPParameter []byte
+
+// Type returns the type of the parameter.
+func (p SCTPParameter) Type() SCTPParameterType {
+	return SCTPParameterType(binary.BigEndian.Uint16(p))
+}
+
+// Length returns the length of the parameter, including its header but not
+// its padding.
+func (p SCTPParameter) Length() uint16 {
+	return binary.BigEndian.Uint16(p[2:])
+}
+
+// Value returns the value of the parameter.
+func (p SCTPParameter) Value() []byte {
+	return p[SCTPParameterHeaderSize:]
+}
+
+// SCTPParameters returns the parameters stored in b. It returns false if b is
+// malformed.
+func SCTPParameters(b []byte) ([]SCTPParameter, bool) {
+	var params []SCTPParameter
+	for len(b) > 0 {
+		if len(b) < SCTPParameterHeaderSize {
+			return nil, false
+		}
+		p := SCTPParameter(b)
+		l := int(p.Length())
+		if l < SCTPParameterHeaderSize || l > len(b) {
+			return nil, false
+		}
+		params = append(params, p[:l])
+		l = sctpPadded(l)
+		if l > len(b) {
+			l = len(b)
+		}
+		b = b[l:]
+	}
+	return params, true
+}
+
+// SCTPAppendParameter appends a parameter with the given type and value, along
+// with its padding, to b.
+func SCTPAppendParameter(b []byte, typ SCTPParameterType, value []byte) []byte {
+	var h [SCTPParameterHeaderSize]byte
+	binary.BigEndian.PutUint16(h[:], uint16(typ))
+	binary.BigEndian.PutUint16(h[2:], uint16(SCTPParameterHeaderSize+len(value)))
+	b = append(b, h[:]...)
+	b = append(b, value...)
+	return sctpAppendPadding(b, len(value))
+}
+
+// SCTPInit is the value of an INIT or INIT ACK chunk (RFC 4960 sections 3.3.2
+// and 3.3.3).
+type SCTPInit []byte
+
+// SCTPInitFields contains the fixed fields of INIT and INIT ACK chunks.
+type SCTPInitFields struct {
+	// InitiateTag is the verification tag the receiver must use.
+	InitiateTag uint32
+
+	// AdvertisedReceiverWindow is the receive window of the sender, in
+	// bytes.
+	AdvertisedReceiverWindow uint32
+
+	// OutboundStreams is the number of streams the sender wants to send
+	// on.
+	OutboundStreams uint16
+
+	// InboundStreams is the maximum number of streams the sender accepts.
+	InboundStreams uint16
+
+	// InitialTSN is the TSN of the first DATA chunk of the sender.
+	InitialTSN uint32
+}
+
+// Encode encodes the fixed fields of the chunk.
+func (b SCTPInit) Encode(f *SCTPInitFields) {
+	binary.BigEndian.PutUint32(b[0:], f.InitiateTag)
+	binary.BigEndian.PutUint32(b[4:], f.AdvertisedReceiverWindow)
+	binary.BigEndian.PutUint16(b[8:], f.OutboundStreams)
+	binary.BigEndian.PutUint16(b[10:], f.InboundStreams)
+	binary.BigEndian.PutUint32(b[12:], f.InitialTSN)
+}
+
+// Fields returns the fixed fields of the chunk.
+func (b SCTPInit) Fields() SCTPInitFields {
+	return SCTPInitFields{
+		InitiateTag:              binary.BigEndian.Uint32(b[0:]),
+		AdvertisedReceiverWindow: binary.BigEndian.Uint32(b[4:]),
+		OutboundStreams:          binary.BigEndian.Uint16(b[8:]),
+		InboundStreams:           binary.BigEndian.Uint16(b[10:]),
+		InitialTSN:               binary.BigEndian.Uint32(b[12:]),
+	}
+}
+
+// Parameters returns the variable-length parameters of the chunk.
+func (b SCTPInit) Parameters() []byte {
+	return b[SCTPInitSize:]
+}
+
+// SCTPData is the value of a DATA chunk (RFC 4960 section 3.3.1).
+type SCTPData []byte
+
+// SCTPDataFields contains the fixed fields of DATA chunks.
+type SCTPDataFields struct {
+	// TSN is the transmission sequence number of the chunk.
+	TSN uint32
+
+	// StreamIdentifier is the stream the chunk belongs to.
+	StreamIdentifier uint16
+
+	// StreamSequenceNumber is the sequence number of the message of the
+	// chunk in its stream.
+	StreamSequenceNumber uint16
+
+	// PayloadProtocolIdentifier is the application-specified protocol of
+	// the message.
+	PayloadProtocolIdentifier uint32
+}
+
+// Encode encodes the fixed fields of the chunk.
+func (b SCTPData) Encode(f *SCTPDataFields) {
+	binary.BigEndian.PutUint32(b[0:], f.TSN)
+	binary.BigEndian.PutUint16(b[4:], f.StreamIdentifier)
+	binary.BigEndian.PutUint16(b[6:], f.StreamSequenceNumber)
+	binary.BigEndian.PutUint32(b[8:], f.PayloadProtocolIdentifier)
+}
+
+// Fields returns the fixed fields of the chunk.
+func (b SCTPData) Fields() SCTPDataFields {
+	return SCTPDataFields{
+		TSN:                       binary.BigEndian.Uint32(b[0:]),
+		StreamIdentifier:          binary.BigEndian.Uint16(b[4:]),
+		StreamSequenceNumber:      binary.BigEndian.Uint16(b[6:]),
+		PayloadProtocolIdentifier: binary.BigEndian.Uint32(b[8:]),
+	}
+}
+
+// UserData returns the user data carried by the chunk.
+func (b SCTPData) UserData() []byte {
+	return b[SCTPDataSize:]
+}
+
+// SCTPGapAckBlock is a gap ack block of a SACK chunk. Start and End are
+// offsets from the cumulative TSN ack of the chunk.
+type SCTPGapAckBlock struct {
+	Start uint16
+	End   uint16
+}
+
+// SCTPSack is the value of a SACK chunk (RFC 4960 section 3.3.4).
+type SCTPSack []byte
+
+// CumulativeTSNAck returns the "cumulative TSN ack" field of the chunk.
+func (b SCTPSack) CumulativeTSNAck() uint32 {
+	return binary.BigEndian.Uint32(b[0:])
+}
+
+// AdvertisedReceiverWindow returns the "advertised receiver window credit"
+// field of the chunk.
+func (b SCTPSack) AdvertisedReceiverWindow() uint32 {
+	return binary.BigEndian.Uint32(b[4:])
+}
+
+// GapAckBlocks returns the gap ack blocks of the chunk. It returns false if
+// the chunk is too short to hold them.
+func (b SCTPSack) GapAckBlocks() ([]SCTPGapAckBlock, bool) {
+	n := int(binary.BigEndian.Uint16(b[8:]))
+	if len(b) < SCTPSackSize+4*n {
+		return nil, false
+	}
+	blocks := make([]SCTPGapAckBlock, n)
+	for i := range blocks {
+		blocks[i].Start = binary.BigEndian.Uint16(b[SCTPSackSize+4*i:])
+		blocks[i].End = binary.BigEndian.Uint16(b[SCTPSackSize+4*i+2:])
+	}
+	return blocks, true
+}
+
+// EncodeSCTPSack returns the value of a SACK chunk with the given fields and
+// duplicate TSNs.
+func EncodeSCTPSack(cumTSN, rwnd uint32, blocks []SCTPGapAckBlock, dups []uint32) []byte {
+	b := make([]byte, SCTPSackSize+4*len(blocks)+4*len(dups))
+	binary.BigEndian.PutUint32(b[0:], cumTSN)
+	binary.BigEndian.PutUint32(b[4:], rwnd)
+	binary.BigEndian.PutUint16(b[8:], uint16(len(blocks)))
+	binary.BigEndian.PutUint16(b[10:], uint16(len(dups)))
+	off := SCTPSackSize
+	for _, blk := range blocks {
+		binary.BigEndian.PutUint16(b[off:], blk.Start)
+		binary.BigEndian.PutUint16(b[off+2:], blk.End)
+		off += 4
+	}
+	for _, d := range dups {
+		binary.BigEndian.PutUint32(b[off:], d)
+		off += 4
+	}
+	return b
+}
+
+// SCTPForwardTSNStream is a stream entry of a FORWARD TSN chunk, holding the
+// largest stream sequence number skipped in the stream.
+type SCTPForwardTSNStream struct {
+	StreamIdentifier     uint16
+	StreamSequenceNumber uint16
+}
+
+// SCTPForwardTSN is the value of a FORWARD TSN chunk (RFC 3758 section 3.2).
+type SCTPForwardTSN []byte
+
+// NewCumulativeTSN returns the "new cumulative TSN" field of the chunk.
+func (b SCTPForwardTSN) NewCumulativeTSN() uint32 {
+	return binary.BigEndian.Uint32(b)
+}
+
+// Streams returns the stream entries of the chunk.
+func (b SCTPForwardTSN) Streams() []SCTPForwardTSNStream {
+	streams := make([]SCTPForwardTSNStream, (len(b)-SCTPForwardTSNSize)/4)
+	for i := range streams {
+		streams[i].StreamIdentifier = binary.BigEndian.Uint16(b[SCTPForwardTSNSize+4*i:])
+		streams[i].StreamSequenceNumber = binary.BigEndian.Uint16(b[SCTPForwardTSNSize+4*i+2:])
+	}
+	return streams
+}
+
+// EncodeSCTPForwardTSN returns the value of a FORWARD TSN chunk with the given
+// fields.
+func EncodeSCTPForwardTSN(newCumTSN uint32, streams []SCTPForwardTSNStream) []byte {
+	b := make([]byte, SCTPForwardTSNSize+4*len(streams))
+	binary.BigEndian.PutUint32(b, newCumTSN)
+	for i, s := range streams {
+		binary.BigEndian.PutUint16(b[SCTPForwardTSNSize+4*i:], s.StreamIdentifier)
+		binary.BigEndian.PutUint16(b[SCTPForwardTSNSize+4*i+2:], s.StreamSequenceNumber)
+	}
+	return b
+}
@@ -15,10 +15,12 @@
 package header
 
 import (
+	"crypto/md5"
 	"encoding/binary"
 
 	"github.com/google/btree"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/seqnum"
 )
 
@@ -63,6 +65,13 @@ const (
 	TCPOptionTS            = 8
 	TCPOptionSACKPermitted = 4
 	TCPOptionSACK          = 5
+	TCPOptionMD5           = 19
+	TCPOptionMPTCP         = 30
+)
+
+const (
+	// TCPMD5OptionSize is the size of the TCP MD5 signature option.
+	TCPMD5OptionSize = 2 + md5.Size
 )
 
 // TCPFields contains the fields of a TCP packet. It is used to describe the
@@ -523,6 +532,91 @@ func EncodeSACKBlocks(sackBlocks []SACKBlock, b []byte) int {
 	return int(b[1])
 }
 
+// EncodeMD5Option encodes the TCP MD5 signature option, described in RFC 2385,
+// with a zero signature in the provided buffer. The signature is filled in
+// once the segment is complete. If the provided buffer is not large enough
+// then it just returns without encoding anything. It returns the number of
+// bytes written to the provided buffer.
+func EncodeMD5Option(b []byte) int {
+	if len(b) < TCPMD5OptionSize {
+		return 0
+	}
+	b[0], b[1] = TCPOptionMD5, TCPMD5OptionSize
+	for i := range b[2:TCPMD5OptionSize] {
+		b[2+i] = 0
+	}
+	return TCPMD5OptionSize
+}
+
+// TCPMD5Option returns the signature of the TCP MD5 signature option in the
+// provided options, or nil if there's no such option.
+func TCPMD5Option(opts []byte) []byte {
+	limit := len(opts)
+	for i := 0; i < limit; {
+		switch opts[i] {
+		case TCPOptionEOL:
+			return nil
+		case TCPOptionNOP:
+			i++
+		default:
+			if i+2 > limit {
+				return nil
+			}
+			l := int(opts[i+1])
+			if l < 2 || i+l > limit {
+				return nil
+			}
+			if opts[i] == TCPOptionMD5 {
+				if l != TCPMD5OptionSize {
+					return nil
+				}
+				return opts[i+2 : i+l]
+			}
+			i += l
+		}
+	}
+	return nil
+}
+
+// TCPMD5Signature computes the MD5 signature of a TCP segment with the given
+// key, as described in RFC 2385 section 2.0. The segment is sent from src to
+// dst, h is its header including options and payload its data. The signature
+// covers the pseudo-header, the header without options assuming a zero
+// checksum, the data and the key. IPv6 segments use the IPv6 pseudo-header,
+// like Linux.
+func TCPMD5Signature(src, dst tcpip.Address, h TCP, payload buffer.VectorisedView, key []byte) [md5.Size]byte {
+	d := md5.New()
+	length := len(h) + payload.Size()
+
+	var pseudo [40]byte
+	n := copy(pseudo[:], src)
+	n += copy(pseudo[n:], dst)
+	if len(src) == IPv4AddressSize {
+		pseudo[n+1] = uint8(TCPProtocolNumber)
+		binary.BigEndian.PutUint16(pseudo[n+2:], uint16(length))
+		n += 4
+	} else {
+		binary.BigEndian.PutUint32(pseudo[n:], uint32(length))
+		pseudo[n+7] = uint8(TCPProtocolNumber)
+		n += 8
+	}
+	d.Write(pseudo[:n])
+
+	var fixed [TCPMinimumSize]byte
+	copy(fixed[:], h[:TCPMinimumSize])
+	fixed[tcpChecksum], fixed[tcpChecksum+1] = 0, 0
+	d.Write(fixed[:])
+
+	for _, v := range payload.Views() {
+		d.Write(v)
+	}
+	d.Write(key)
+
+	var sig [md5.Size]byte
+	copy(sig[:], d.Sum(nil))
+	return sig
+}
+
 // EncodeNOP adds an explicit NOP to the option list.
 func EncodeNOP(b []byte) int {
 	if len(b) == 0 {
@@ -0,0 +1,64 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import (
+	"encoding/binary"
+)
+
+const (
+	vxlanFlags = 0
+	vxlanVNI   = 4
+)
+
+// VXLAN represents a Virtual eXtensible Local Area Network header stored in a
+// byte array, as described in RFC 7348.
+type VXLAN []byte
+
+const (
+	// VXLANSize is the size of a VXLAN header.
+	VXLANSize = 8
+
+	// VXLANDefaultPort is the UDP port assigned to VXLAN by IANA.
+	VXLANDefaultPort = 4789
+
+	// VXLANFlagVNI is the flag of the VXLAN header indicating that the VNI
+	// is valid, which must be set.
+	VXLANFlagVNI = 0x08
+
+	// VXLANMaxVNI is the largest VXLAN network identifier.
+	VXLANMaxVNI = 1<<24 - 1
+)
+
+// Flags returns the flags of the VXLAN header.
+func (b VXLAN) Flags() uint8 {
+	return b[vxlanFlags]
+}
+
+// VNI returns the VXLAN network identifier of the VXLAN header.
+func (b VXLAN) VNI() uint32 {
+	return binary.BigEndian.Uint32(b[vxlanVNI:]) >> 8
+}
+
+// Payload returns the Ethernet frame encapsulated after the VXLAN header.
+func (b VXLAN) Payload() []byte {
+	return b[VXLANSize:]
+}
+
+// Encode encodes the VXLAN header with the network identifier vni.
+func (b VXLAN) Encode(vni uint32) {
+	binary.BigEndian.PutUint32(b[vxlanFlags:], VXLANFlagVNI<<24)
+	binary.BigEndian.PutUint32(b[vxlanVNI:], vni<<8)
+}
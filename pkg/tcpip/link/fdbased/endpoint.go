@@ -21,12 +21,22 @@
 // FD based endpoints can be used in the networking stack by calling New() to
 // create a new endpoint, and then passing it as an argument to
 // Stack.CreateNIC().
+//
+// An endpoint may be backed by several file descriptors, each read by its own
+// goroutine, for the packets it receives to be processed on several CPUs. The
+// packets of a flow must then always be received on the same file descriptor
+// (e.g. with PACKET_FANOUT_HASH) to avoid reordering them.
 package fdbased
 
 import (
 	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
+	"golang.org/x/sys/unix"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
@@ -43,7 +53,7 @@ const (
 // BufConfig defines the shape of the vectorised view used to read packets from the NIC.
 var BufConfig = []int{128, 256, 256, 512, 1024, 2048, 4096, 8192, 16384, 32768}
 
-// linkDispatcher reads packets from the link FD and dispatches them to the
+// linkDispatcher reads packets from a link FD and dispatches them to the
 // NetworkDispatcher.
 type linkDispatcher func() (bool, *tcpip.Error)
 
@@ -72,7 +82,8 @@ const (
 )
 
 type endpoint struct {
-	// fd is the file descriptor used to send and receive packets.
+	// fd is the file descriptor used to send packets. It is the first of
+	// the file descriptors used to receive them.
 	fd int
 
 	// mtu (maximum transmission unit) is the maximum size of a packet.
@@ -92,18 +103,62 @@ type endpoint struct {
 	// its end of the communication pipe.
 	closed func(*tcpip.Error)
 
-	views  [][]buffer.View
-	iovecs [][]syscall.Iovec
-	// msgHdrs is only used by the RecvMMsg dispatcher.
-	msgHdrs []rawfile.MMsgHdr
+	// closedOnce ensures that closed is called only once, by the first
+	// inbound dispatcher which stops.
+	closedOnce sync.Once
+
+	// inbound holds one inbound dispatcher per file descriptor.
+	inbound []*inboundDispatcher
 
-	inboundDispatcher linkDispatcher
-	dispatcher        stack.NetworkDispatcher
+	// stopFD is an eventfd, polled by the inbound dispatchers along with
+	// their file descriptor, which is signaled to stop them when the
+	// endpoint is closed. It is -1 if the endpoint has no inbound
+	// dispatchers.
+	stopFD int
+
+	// stopping is set to 1 when the endpoint is closed. It is accessed
+	// using atomic memory operations, and only set with writeMu locked.
+	stopping int32
+
+	// writeMu is held for reading while packets are written to fd, so that
+	// Close can wait for writes in progress before fd is closed by its
+	// owner.
+	writeMu sync.RWMutex
+
+	// closeOnce ensures that the endpoint is closed only once.
+	closeOnce sync.Once
+
+	// running tracks the goroutines of the inbound dispatchers.
+	running sync.WaitGroup
+
+	dispatcher stack.NetworkDispatcher
 
 	// packetDispatchMode controls the packet dispatcher used by this
 	// endpoint.
 	packetDispatchMode PacketDispatchMode
 
+	// gsoMaxSize is the maximum GSO packet size. It is zero if GSO is
+	// disabled.
+	gsoMaxSize uint32
+
+	// busyPoll is the time for which the FDs are busy-polled after a packet
+	// is received. It is zero if busy-polling is disabled.
+	busyPoll time.Duration
+}
+
+// inboundDispatcher reads packets from one of the file descriptors of an
+// endpoint, from its own goroutine, and dispatches them.
+type inboundDispatcher struct {
+	e  *endpoint
+	fd int
+
+	views  [][]buffer.View
+	iovecs [][]syscall.Iovec
+	// msgHdrs is only used by the RecvMMsg dispatcher.
+	msgHdrs []rawfile.MMsgHdr
+
+	dispatch linkDispatcher
+
 	// ringBuffer is only used when PacketMMap dispatcher is used and points
 	// to the start of the mmapped PACKET_RX_RING buffer.
 	ringBuffer []byte
@@ -112,14 +167,20 @@ type endpoint struct {
 	// inbound packet will be placed by the kernel.
 	ringOffset int
 
-	// gsoMaxSize is the maximum GSO packet size. It is zero if GSO is
-	// disabled.
-	gsoMaxSize uint32
+	// lastRecv is the time at which the last packet was received. It is
+	// only used when busy-polling is enabled.
+	lastRecv time.Time
 }
 
 // Options specify the details about the fd-based endpoint to be created.
 type Options struct {
-	FD                 int
+	FD int
+
+	// FDs are the file descriptors of an endpoint with several queues. If
+	// not empty, FD is ignored, and packets are received from all of them
+	// and sent through the first one.
+	FDs []int
+
 	MTU                uint32
 	EthernetHeader     bool
 	ChecksumOffload    bool
@@ -129,6 +190,12 @@ type Options struct {
 	DisconnectOk       bool
 	GSOMaxSize         uint32
 	PacketDispatchMode PacketDispatchMode
+
+	// BusyPoll is the time for which the FD is busy-polled after a packet
+	// is received, instead of blocking in poll(2) until the next one. This
+	// trades CPU for a lower latency when packets arrive back to back,
+	// while an idle endpoint still blocks. Zero disables busy-polling.
+	BusyPoll time.Duration
 }
 
 // New creates a new fd-based endpoint.
@@ -136,9 +203,15 @@ type Options struct {
 // Makes fd non-blocking, but does not take ownership of fd, which must remain
 // open for the lifetime of the returned endpoint.
 func New(opts *Options) tcpip.LinkEndpointID {
-	if err := syscall.SetNonblock(opts.FD, true); err != nil {
-		// TODO : replace panic with an error return.
-		panic(fmt.Sprintf("syscall.SetNonblock(%v) failed: %v", opts.FD, err))
+	fds := opts.FDs
+	if len(fds) == 0 {
+		fds = []int{opts.FD}
+	}
+	for _, fd := range fds {
+		if err := syscall.SetNonblock(fd, true); err != nil {
+			// TODO : replace panic with an error return.
+			panic(fmt.Sprintf("syscall.SetNonblock(%v) failed: %v", fd, err))
+		}
 	}
 
 	caps := stack.LinkEndpointCapabilities(0)
@@ -161,58 +234,81 @@ func New(opts *Options) tcpip.LinkEndpointID {
 	}
 
 	e := &endpoint{
-		fd:                 opts.FD,
+		fd:                 fds[0],
 		mtu:                opts.MTU,
 		caps:               caps,
 		closed:             opts.ClosedFunc,
 		addr:               opts.Address,
 		hdrSize:            hdrSize,
 		packetDispatchMode: opts.PacketDispatchMode,
+		busyPoll:           opts.BusyPoll,
+	}
+
+	stopFD, err := newEventFD()
+	if err != nil {
+		// TODO: replace panic with an error return.
+		panic(fmt.Sprintf("newEventFD() failed: %v", err))
 	}
+	e.stopFD = stopFD
 
-	if opts.GSOMaxSize != 0 && isSocketFD(opts.FD) {
+	if opts.GSOMaxSize != 0 && isSocketFD(e.fd) {
 		e.caps |= stack.CapabilityGSO
 		e.gsoMaxSize = opts.GSOMaxSize
 	}
-	if isSocketFD(opts.FD) && e.packetDispatchMode == PacketMMap {
-		if err := e.setupPacketRXRing(); err != nil {
+
+	for _, fd := range fds {
+		d, err := newInboundDispatcher(e, fd)
+		if err != nil {
 			// TODO: replace panic with an error return.
-			panic(fmt.Sprintf("e.setupPacketRXRing failed: %v", err))
+			panic(fmt.Sprintf("newInboundDispatcher(%v) failed: %v", fd, err))
+		}
+		e.inbound = append(e.inbound, d)
+	}
+
+	return stack.RegisterLinkEndpoint(e)
+}
+
+// newInboundDispatcher returns a dispatcher of the packets received on fd by
+// e.
+func newInboundDispatcher(e *endpoint, fd int) (*inboundDispatcher, error) {
+	d := &inboundDispatcher{e: e, fd: fd}
+	if isSocketFD(fd) && e.packetDispatchMode == PacketMMap {
+		if err := d.setupPacketRXRing(); err != nil {
+			return nil, err
 		}
-		e.inboundDispatcher = e.packetMMapDispatch
-		return stack.RegisterLinkEndpoint(e)
+		d.dispatch = d.packetMMapDispatch
+		return d, nil
 	}
 
 	// For non-socket FDs we read one packet a time (e.g. TAP devices)
 	msgsPerRecv := 1
-	e.inboundDispatcher = e.dispatch
+	d.dispatch = d.readvDispatch
 	// If the provided FD is a socket then we optimize packet reads by
 	// using recvmmsg() instead of read() to read packets in a batch.
-	if isSocketFD(opts.FD) && e.packetDispatchMode == RecvMMsg {
-		e.inboundDispatcher = e.recvMMsgDispatch
+	if isSocketFD(fd) && e.packetDispatchMode == RecvMMsg {
+		d.dispatch = d.recvMMsgDispatch
 		msgsPerRecv = MaxMsgsPerRecv
 	}
 
-	e.views = make([][]buffer.View, msgsPerRecv)
-	for i := range e.views {
-		e.views[i] = make([]buffer.View, len(BufConfig))
+	d.views = make([][]buffer.View, msgsPerRecv)
+	for i := range d.views {
+		d.views[i] = make([]buffer.View, len(BufConfig))
 	}
-	e.iovecs = make([][]syscall.Iovec, msgsPerRecv)
+	d.iovecs = make([][]syscall.Iovec, msgsPerRecv)
 	iovLen := len(BufConfig)
 	if e.Capabilities()&stack.CapabilityGSO != 0 {
 		// virtioNetHdr is prepended before each packet.
 		iovLen++
 	}
-	for i := range e.iovecs {
-		e.iovecs[i] = make([]syscall.Iovec, iovLen)
+	for i := range d.iovecs {
+		d.iovecs[i] = make([]syscall.Iovec, iovLen)
 	}
-	e.msgHdrs = make([]rawfile.MMsgHdr, msgsPerRecv)
-	for i := range e.msgHdrs {
-		e.msgHdrs[i].Msg.Iov = &e.iovecs[i][0]
-		e.msgHdrs[i].Msg.Iovlen = uint64(iovLen)
+	d.msgHdrs = make([]rawfile.MMsgHdr, msgsPerRecv)
+	for i := range d.msgHdrs {
+		d.msgHdrs[i].Msg.Iov = &d.iovecs[i][0]
+		d.msgHdrs[i].Msg.Iovlen = uint64(iovLen)
 	}
-
-	return stack.RegisterLinkEndpoint(e)
+	return d, nil
 }
 
 func isSocketFD(fd int) bool {
@@ -224,14 +320,53 @@ func isSocketFD(fd int) bool {
 	return (stat.Mode & syscall.S_IFSOCK) == syscall.S_IFSOCK
 }
 
-// Attach launches the goroutine that reads packets from the file descriptor and
-// dispatches them via the provided dispatcher.
+// Attach launches the goroutines that read packets from the file descriptors
+// and dispatch them via the provided dispatcher.
 func (e *endpoint) Attach(dispatcher stack.NetworkDispatcher) {
 	e.dispatcher = dispatcher
 	// Link endpoints are not savable. When transportation endpoints are
 	// saved, they stop sending outgoing packets and all incoming packets
 	// are rejected.
-	go e.dispatchLoop() // S/R-SAFE: See above.
+	for _, d := range e.inbound {
+		e.running.Add(1)
+		go func(d *inboundDispatcher) { // S/R-SAFE: See above.
+			defer e.running.Done()
+			d.dispatchLoop()
+		}(d)
+	}
+}
+
+// Close implements stack.ClosableEndpoint.Close. It stops the goroutines
+// reading packets from the file descriptors, and unmaps their PACKET_RX_RING
+// buffers. The file descriptors themselves are left open, as they are owned
+// by the caller of New.
+func (e *endpoint) Close() {
+	e.closeOnce.Do(func() {
+		if e.stopFD < 0 {
+			return
+		}
+		e.writeMu.Lock()
+		atomic.StoreInt32(&e.stopping, 1)
+		e.writeMu.Unlock()
+		if err := signalEventFD(e.stopFD); err != nil {
+			panic(fmt.Sprintf("signalEventFD(%v) failed: %v", e.stopFD, err))
+		}
+		e.running.Wait()
+
+		for _, d := range e.inbound {
+			if d.ringBuffer != nil {
+				syscall.Munmap(d.ringBuffer)
+				d.ringBuffer = nil
+			}
+		}
+		syscall.Close(e.stopFD)
+		e.stopFD = -1
+	})
+}
+
+// stopped returns true if the endpoint was closed.
+func (e *endpoint) stopped() bool {
+	return atomic.LoadInt32(&e.stopping) != 0
 }
 
 // IsAttached implements stack.LinkEndpoint.IsAttached.
@@ -281,6 +416,18 @@ const (
 // WritePacket writes outbound packets to the file descriptor. If it is not
 // currently writable, the packet is dropped.
 func (e *endpoint) WritePacket(r *stack.Route, gso *stack.GSO, hdr buffer.Prependable, payload buffer.VectorisedView, protocol tcpip.NetworkProtocolNumber) *tcpip.Error {
+	// Hot path. Avoid defers.
+	e.writeMu.RLock()
+	err := e.writePacketLocked(r, gso, hdr, payload, protocol)
+	e.writeMu.RUnlock()
+	return err
+}
+
+// writePacketLocked is WritePacket with e.writeMu held for reading.
+func (e *endpoint) writePacketLocked(r *stack.Route, gso *stack.GSO, hdr buffer.Prependable, payload buffer.VectorisedView, protocol tcpip.NetworkProtocolNumber) *tcpip.Error {
+	if e.stopped() {
+		return tcpip.ErrClosedForSend
+	}
 	if e.hdrSize > 0 {
 		// Add ethernet header if needed.
 		eth := header.Ethernet(hdr.Prepend(header.EthernetMinimumSize))
@@ -333,42 +480,47 @@ func (e *endpoint) WritePacket(r *stack.Route, gso *stack.GSO, hdr buffer.Prepen
 
 // WriteRawPacket writes a raw packet directly to the file descriptor.
 func (e *endpoint) WriteRawPacket(dest tcpip.Address, packet []byte) *tcpip.Error {
+	e.writeMu.RLock()
+	defer e.writeMu.RUnlock()
+	if e.stopped() {
+		return tcpip.ErrClosedForSend
+	}
 	return rawfile.NonBlockingWrite(e.fd, packet)
 }
 
-func (e *endpoint) capViews(k, n int, buffers []int) int {
+func (d *inboundDispatcher) capViews(k, n int, buffers []int) int {
 	c := 0
 	for i, s := range buffers {
 		c += s
 		if c >= n {
-			e.views[k][i].CapLength(s - (c - n))
+			d.views[k][i].CapLength(s - (c - n))
 			return i + 1
 		}
 	}
 	return len(buffers)
 }
 
-func (e *endpoint) allocateViews(bufConfig []int) {
-	for k := 0; k < len(e.views); k++ {
+func (d *inboundDispatcher) allocateViews(bufConfig []int) {
+	for k := 0; k < len(d.views); k++ {
 		var vnetHdr [virtioNetHdrSize]byte
 		vnetHdrOff := 0
-		if e.Capabilities()&stack.CapabilityGSO != 0 {
+		if d.e.Capabilities()&stack.CapabilityGSO != 0 {
 			// The kernel adds virtioNetHdr before each packet, but
 			// we don't use it, so so we allocate a buffer for it,
 			// add it in iovecs but don't add it in a view.
-			e.iovecs[k][0] = syscall.Iovec{
+			d.iovecs[k][0] = syscall.Iovec{
 				Base: &vnetHdr[0],
 				Len:  uint64(virtioNetHdrSize),
 			}
 			vnetHdrOff++
 		}
 		for i := 0; i < len(bufConfig); i++ {
-			if e.views[k][i] != nil {
+			if d.views[k][i] != nil {
 				break
 			}
 			b := buffer.NewView(bufConfig[i])
-			e.views[k][i] = b
-			e.iovecs[k][i+vnetHdrOff] = syscall.Iovec{
+			d.views[k][i] = b
+			d.iovecs[k][i+vnetHdrOff] = syscall.Iovec{
 				Base: &b[0],
 				Len:  uint64(len(b)),
 			}
@@ -376,20 +528,97 @@ func (e *endpoint) allocateViews(bufConfig []int) {
 	}
 }
 
-// dispatch reads one packet from the file descriptor and dispatches it.
-func (e *endpoint) dispatch() (bool, *tcpip.Error) {
-	e.allocateViews(BufConfig)
+// busyPolling returns true if the FD is to be busy-polled, i.e. if a packet
+// was received less than busyPoll ago.
+func (d *inboundDispatcher) busyPolling() bool {
+	return d.e.busyPoll != 0 && time.Since(d.lastRecv) < d.e.busyPoll
+}
+
+// received records that packets were received, which extends busy-polling.
+func (d *inboundDispatcher) received() {
+	if d.e.busyPoll != 0 {
+		d.lastRecv = time.Now()
+	}
+}
+
+// wait blocks until the file descriptor is readable. It returns
+// tcpip.ErrClosedForReceive if the endpoint is closed in the meantime.
+func (d *inboundDispatcher) wait() *tcpip.Error {
+	events := [2]rawfile.PollEvent{
+		{FD: int32(d.fd), Events: unix.POLLIN | unix.POLLERR},
+		{FD: int32(d.e.stopFD), Events: unix.POLLIN},
+	}
+	for {
+		_, errno := rawfile.BlockingPoll(&events[0], len(events), -1)
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return rawfile.TranslateErrno(errno)
+		}
+		if events[1].Revents != 0 {
+			return tcpip.ErrClosedForReceive
+		}
+		return nil
+	}
+}
+
+// readv reads one packet from the file descriptor, busy-polling it while
+// packets were received recently enough.
+func (d *inboundDispatcher) readv(iovecs []syscall.Iovec) (int, *tcpip.Error) {
+	for {
+		n, err := rawfile.NonBlockingReadv(d.fd, iovecs)
+		if err != tcpip.ErrWouldBlock {
+			if err == nil {
+				d.received()
+			}
+			return n, err
+		}
+		if d.busyPolling() {
+			runtime.Gosched()
+			continue
+		}
+		if err := d.wait(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// recvMMsg reads packets from the file descriptor, busy-polling it while
+// packets were received recently enough.
+func (d *inboundDispatcher) recvMMsg(msgHdrs []rawfile.MMsgHdr) (int, *tcpip.Error) {
+	for {
+		n, err := rawfile.NonBlockingRecvMMsg(d.fd, msgHdrs)
+		if err != tcpip.ErrWouldBlock {
+			if err == nil {
+				d.received()
+			}
+			return n, err
+		}
+		if d.busyPolling() {
+			runtime.Gosched()
+			continue
+		}
+		if err := d.wait(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// readvDispatch reads one packet from the file descriptor and dispatches it.
+func (d *inboundDispatcher) readvDispatch() (bool, *tcpip.Error) {
+	d.allocateViews(BufConfig)
 
-	n, err := rawfile.BlockingReadv(e.fd, e.iovecs[0])
+	n, err := d.readv(d.iovecs[0])
 	if err != nil {
 		return false, err
 	}
-	if e.Capabilities()&stack.CapabilityGSO != 0 {
+	if d.e.Capabilities()&stack.CapabilityGSO != 0 {
 		// Skip virtioNetHdr which is added before each packet, it
 		// isn't used and it isn't in a view.
 		n -= virtioNetHdrSize
 	}
-	if n <= e.hdrSize {
+	if n <= d.e.hdrSize {
 		return false, nil
 	}
 
@@ -397,15 +626,15 @@ func (e *endpoint) dispatch() (bool, *tcpip.Error) {
 		p             tcpip.NetworkProtocolNumber
 		remote, local tcpip.LinkAddress
 	)
-	if e.hdrSize > 0 {
-		eth := header.Ethernet(e.views[0][0])
+	if d.e.hdrSize > 0 {
+		eth := header.Ethernet(d.views[0][0])
 		p = eth.Type()
 		remote = eth.SourceAddress()
 		local = eth.DestinationAddress()
 	} else {
 		// We don't get any indication of what the packet is, so try to guess
 		// if it's an IPv4 or IPv6 packet.
-		switch header.IPVersion(e.views[0][0]) {
+		switch header.IPVersion(d.views[0][0]) {
 		case header.IPv4Version:
 			p = header.IPv4ProtocolNumber
 		case header.IPv6Version:
@@ -415,15 +644,15 @@ func (e *endpoint) dispatch() (bool, *tcpip.Error) {
 		}
 	}
 
-	used := e.capViews(0, n, BufConfig)
-	vv := buffer.NewVectorisedView(n, e.views[0][:used])
-	vv.TrimFront(e.hdrSize)
+	used := d.capViews(0, n, BufConfig)
+	vv := buffer.NewVectorisedView(n, d.views[0][:used])
+	vv.TrimFront(d.e.hdrSize)
 
-	e.dispatcher.DeliverNetworkPacket(e, remote, local, p, vv)
+	d.e.dispatcher.DeliverNetworkPacket(d.e, remote, local, p, vv)
 
-	// Prepare e.views for another packet: release used views.
+	// Prepare d.views for another packet: release used views.
 	for i := 0; i < used; i++ {
-		e.views[0][i] = nil
+		d.views[0][i] = nil
 	}
 
 	return true, nil
@@ -431,20 +660,20 @@ func (e *endpoint) dispatch() (bool, *tcpip.Error) {
 
 // recvMMsgDispatch reads more than one packet at a time from the file
 // descriptor and dispatches it.
-func (e *endpoint) recvMMsgDispatch() (bool, *tcpip.Error) {
-	e.allocateViews(BufConfig)
+func (d *inboundDispatcher) recvMMsgDispatch() (bool, *tcpip.Error) {
+	d.allocateViews(BufConfig)
 
-	nMsgs, err := rawfile.BlockingRecvMMsg(e.fd, e.msgHdrs)
+	nMsgs, err := d.recvMMsg(d.msgHdrs)
 	if err != nil {
 		return false, err
 	}
 	// Process each of received packets.
 	for k := 0; k < nMsgs; k++ {
-		n := int(e.msgHdrs[k].Len)
-		if e.Capabilities()&stack.CapabilityGSO != 0 {
+		n := int(d.msgHdrs[k].Len)
+		if d.e.Capabilities()&stack.CapabilityGSO != 0 {
 			n -= virtioNetHdrSize
 		}
-		if n <= e.hdrSize {
+		if n <= d.e.hdrSize {
 			return false, nil
 		}
 
@@ -452,15 +681,15 @@ func (e *endpoint) recvMMsgDispatch() (bool, *tcpip.Error) {
 			p             tcpip.NetworkProtocolNumber
 			remote, local tcpip.LinkAddress
 		)
-		if e.hdrSize > 0 {
-			eth := header.Ethernet(e.views[k][0])
+		if d.e.hdrSize > 0 {
+			eth := header.Ethernet(d.views[k][0])
 			p = eth.Type()
 			remote = eth.SourceAddress()
 			local = eth.DestinationAddress()
 		} else {
 			// We don't get any indication of what the packet is, so try to guess
 			// if it's an IPv4 or IPv6 packet.
-			switch header.IPVersion(e.views[k][0]) {
+			switch header.IPVersion(d.views[k][0]) {
 			case header.IPv4Version:
 				p = header.IPv4ProtocolNumber
 			case header.IPv6Version:
@@ -470,19 +699,19 @@ func (e *endpoint) recvMMsgDispatch() (bool, *tcpip.Error) {
 			}
 		}
 
-		used := e.capViews(k, int(n), BufConfig)
-		vv := buffer.NewVectorisedView(int(n), e.views[k][:used])
-		vv.TrimFront(e.hdrSize)
-		e.dispatcher.DeliverNetworkPacket(e, remote, local, p, vv)
+		used := d.capViews(k, int(n), BufConfig)
+		vv := buffer.NewVectorisedView(int(n), d.views[k][:used])
+		vv.TrimFront(d.e.hdrSize)
+		d.e.dispatcher.DeliverNetworkPacket(d.e, remote, local, p, vv)
 
-		// Prepare e.views for another packet: release used views.
+		// Prepare d.views for another packet: release used views.
 		for i := 0; i < used; i++ {
-			e.views[k][i] = nil
+			d.views[k][i] = nil
 		}
 	}
 
 	for k := 0; k < nMsgs; k++ {
-		e.msgHdrs[k].Len = 0
+		d.msgHdrs[k].Len = 0
 	}
 
 	return true, nil
@@ -490,13 +719,22 @@ func (e *endpoint) recvMMsgDispatch() (bool, *tcpip.Error) {
 
 // dispatchLoop reads packets from the file descriptor in a loop and dispatches
 // them to the network stack.
-func (e *endpoint) dispatchLoop() *tcpip.Error {
+func (d *inboundDispatcher) dispatchLoop() *tcpip.Error {
 	for {
-		cont, err := e.inboundDispatcher()
+		if d.e.stopped() {
+			return nil
+		}
+		cont, err := d.dispatch()
+		if d.e.stopped() {
+			// The endpoint was closed on purpose, not by the peer.
+			return nil
+		}
 		if err != nil || !cont {
-			if e.closed != nil {
-				e.closed(err)
-			}
+			d.e.closedOnce.Do(func() {
+				if d.e.closed != nil {
+					d.e.closed(err)
+				}
+			})
 			return err
 		}
 	}
@@ -531,8 +769,9 @@ func NewInjectable(fd int, mtu uint32) (tcpip.LinkEndpointID, *InjectableEndpoin
 	syscall.SetNonblock(fd, true)
 
 	e := &InjectableEndpoint{endpoint: endpoint{
-		fd:  fd,
-		mtu: mtu,
+		fd:     fd,
+		mtu:    mtu,
+		stopFD: -1,
 	}}
 
 	return stack.RegisterLinkEndpoint(e), e
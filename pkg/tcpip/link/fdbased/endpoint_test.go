@@ -330,6 +330,165 @@ func TestDeliverPacket(t *testing.T) {
 	}
 }
 
+func TestBusyPoll(t *testing.T) {
+	const busyPoll = 50 * time.Millisecond
+	for _, mode := range []PacketDispatchMode{Readv, RecvMMsg} {
+		t.Run(fmt.Sprintf("Mode=%v", mode), func(t *testing.T) {
+			c := newContext(t, &Options{Address: laddr, MTU: mtu, PacketDispatchMode: mode, BusyPoll: busyPoll})
+			defer c.cleanup()
+
+			// The first packets are received while busy-polling, the last
+			// one after it stopped for lack of packets.
+			for i, delay := range []time.Duration{0, 0, busyPoll / 10, 2 * busyPoll} {
+				time.Sleep(delay)
+
+				b := make([]byte, 100)
+				// So that it looks like an IPv4 packet.
+				b[0] = 0x40
+				b[1] = uint8(i)
+				if _, err := syscall.Write(c.fds[0], b); err != nil {
+					t.Fatalf("Write failed: %v", err)
+				}
+
+				select {
+				case pi := <-c.ch:
+					if !bytes.Equal(pi.contents, b) {
+						t.Fatalf("Unexpected received packet %d: %x, want %x", i, pi.contents, b)
+					}
+				case <-time.After(10 * time.Second):
+					t.Fatalf("Timed out waiting for packet %d", i)
+				}
+			}
+		})
+	}
+}
+
+func TestMultipleFDs(t *testing.T) {
+	const queues = 4
+	var peers, fds []int
+	for i := 0; i < queues; i++ {
+		pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET, 0)
+		if err != nil {
+			t.Fatalf("Socketpair failed: %v", err)
+		}
+		defer syscall.Close(pair[1])
+		peers = append(peers, pair[0])
+		fds = append(fds, pair[1])
+	}
+
+	done := make(chan struct{}, queues)
+	ep := stack.FindLinkEndpoint(New(&Options{
+		FDs:                fds,
+		MTU:                mtu,
+		PacketDispatchMode: RecvMMsg,
+		ClosedFunc: func(*tcpip.Error) {
+			done <- struct{}{}
+		},
+	})).(*endpoint)
+	c := &context{t: t, ep: ep, ch: make(chan packetInfo, 100)}
+	ep.Attach(c)
+
+	// Packets are received on all queues.
+	want := make(map[uint8]bool)
+	for i, peer := range peers {
+		b := make([]byte, 100)
+		// So that it looks like an IPv4 packet.
+		b[0] = 0x40
+		b[1] = uint8(i)
+		if _, err := syscall.Write(peer, b); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		want[uint8(i)] = true
+	}
+	for range peers {
+		select {
+		case pi := <-c.ch:
+			if !want[pi.contents[1]] {
+				t.Fatalf("Unexpected received packet: %x", pi.contents)
+			}
+			delete(want, pi.contents[1])
+		case <-time.After(10 * time.Second):
+			t.Fatalf("Timed out waiting for packets from queues %v", want)
+		}
+	}
+
+	// Packets are sent through the first queue.
+	r := &stack.Route{RemoteLinkAddress: raddr}
+	hdr := buffer.NewPrependable(int(ep.MaxHeaderLength()) + 1)
+	hdr.Prepend(1)[0] = 0x40
+	if err := ep.WritePacket(r, nil /* gso */, hdr, buffer.VectorisedView{}, proto); err != nil {
+		t.Fatalf("WritePacket failed: %v", err)
+	}
+	b := make([]byte, mtu)
+	if n, err := syscall.Read(peers[0], b); err != nil || n != 1 {
+		t.Fatalf("Read from first queue = (%d, %v), want (1, nil)", n, err)
+	}
+
+	// The closed function is called once, when the first queue is closed.
+	syscall.Close(peers[0])
+	<-done
+	for _, peer := range peers[1:] {
+		syscall.Close(peer)
+	}
+	select {
+	case <-done:
+		t.Fatalf("Closed function called more than once")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestClose(t *testing.T) {
+	for _, mode := range []PacketDispatchMode{Readv, RecvMMsg} {
+		t.Run(fmt.Sprintf("mode=%v", mode), func(t *testing.T) {
+			fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET, 0)
+			if err != nil {
+				t.Fatalf("Socketpair failed: %v", err)
+			}
+			defer syscall.Close(fds[0])
+			defer syscall.Close(fds[1])
+
+			done := make(chan struct{}, 1)
+			ep := stack.FindLinkEndpoint(New(&Options{
+				FD:                 fds[1],
+				MTU:                mtu,
+				PacketDispatchMode: mode,
+				ClosedFunc: func(*tcpip.Error) {
+					done <- struct{}{}
+				},
+			})).(*endpoint)
+			c := &context{t: t, ep: ep, ch: make(chan packetInfo, 100)}
+			ep.Attach(c)
+
+			// Close returns once the dispatcher, blocked waiting for a
+			// packet, has stopped.
+			ep.Close()
+
+			// Packets are neither received nor sent anymore.
+			b := make([]byte, 100)
+			b[0] = 0x40
+			if _, err := syscall.Write(fds[0], b); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+			r := &stack.Route{RemoteLinkAddress: raddr}
+			hdr := buffer.NewPrependable(int(ep.MaxHeaderLength()) + 1)
+			hdr.Prepend(1)[0] = 0x40
+			if err := ep.WritePacket(r, nil /* gso */, hdr, buffer.VectorisedView{}, proto); err != tcpip.ErrClosedForSend {
+				t.Errorf("WritePacket after Close: got %v, want %v", err, tcpip.ErrClosedForSend)
+			}
+			select {
+			case pi := <-c.ch:
+				t.Errorf("Unexpected received packet: %x", pi.contents)
+			case <-done:
+				t.Errorf("Closed function called by Close")
+			case <-time.After(100 * time.Millisecond):
+			}
+
+			// Closing again is a no-op.
+			ep.Close()
+		})
+	}
+}
+
 func TestBufConfigMaxLength(t *testing.T) {
 	got := 0
 	for _, i := range BufConfig {
@@ -352,8 +511,9 @@ func TestBufConfigFirst(t *testing.T) {
 	}
 }
 
-func build(bufConfig []int) *endpoint {
-	e := &endpoint{
+func build(bufConfig []int) *inboundDispatcher {
+	e := &inboundDispatcher{
+		e:       &endpoint{},
 		views:   make([][]buffer.View, MaxMsgsPerRecv),
 		iovecs:  make([][]syscall.Iovec, MaxMsgsPerRecv),
 		msgHdrs: make([]rawfile.MMsgHdr, MaxMsgsPerRecv),
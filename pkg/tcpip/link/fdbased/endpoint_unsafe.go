@@ -18,6 +18,7 @@ package fdbased
 
 import (
 	"reflect"
+	"syscall"
 	"unsafe"
 )
 
@@ -30,3 +31,22 @@ func vnetHdrToByteSlice(hdr *virtioNetHdr) (slice []byte) {
 	sh.Cap = virtioNetHdrSize
 	return
 }
+
+// newEventFD returns a new non-blocking eventfd.
+func newEventFD() (int, error) {
+	// EFD_NONBLOCK and EFD_CLOEXEC are O_NONBLOCK and O_CLOEXEC.
+	fd, _, e := syscall.RawSyscall(syscall.SYS_EVENTFD2, 0, syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if e != 0 {
+		return -1, e
+	}
+	return int(fd), nil
+}
+
+// signalEventFD adds 1 to the counter of the eventfd fd.
+func signalEventFD(fd int) error {
+	v := uint64(1)
+	if _, _, e := syscall.RawSyscall(syscall.SYS_WRITE, uintptr(fd), uintptr(unsafe.Pointer(&v)), unsafe.Sizeof(v)); e != 0 {
+		return e
+	}
+	return nil
+}
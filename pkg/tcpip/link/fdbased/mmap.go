@@ -20,14 +20,14 @@ import "gvisor.googlesource.com/gvisor/pkg/tcpip"
 
 // Stubbed out versions for non-linux/non-amd64 platforms.
 
-func (e *endpoint) setupPacketRXRing() error {
+func (d *inboundDispatcher) setupPacketRXRing() error {
 	return nil
 }
 
-func (e *endpoint) readMMappedPacket() ([]byte, *tcpip.Error) {
+func (d *inboundDispatcher) readMMappedPacket() ([]byte, *tcpip.Error) {
 	return nil, nil
 }
 
-func (e *endpoint) packetMMapDispatch() (bool, *tcpip.Error) {
+func (d *inboundDispatcher) packetMMapDispatch() (bool, *tcpip.Error) {
 	return false, nil
 }
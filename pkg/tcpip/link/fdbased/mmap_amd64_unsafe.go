@@ -19,14 +19,13 @@ package fdbased
 import (
 	"encoding/binary"
 	"fmt"
+	"runtime"
 	"syscall"
 	"unsafe"
 
-	"golang.org/x/sys/unix"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
-	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/rawfile"
 )
 
 const (
@@ -117,7 +116,7 @@ func (t tPacketHdr) Payload() []byte {
 	return t[uint32(t.tpMac()) : uint32(t.tpMac())+t.tpSnapLen()]
 }
 
-func (e *endpoint) setupPacketRXRing() error {
+func (d *inboundDispatcher) setupPacketRXRing() error {
 	tReq := tPacketReq{
 		tpBlockSize: uint32(tpBlockSize),
 		tpBlockNR:   uint32(tpBlockNR),
@@ -125,32 +124,29 @@ func (e *endpoint) setupPacketRXRing() error {
 		tpFrameNR:   uint32(tpFrameNR),
 	}
 	// Setup PACKET_RX_RING.
-	if err := setsockopt(e.fd, syscall.SOL_PACKET, syscall.PACKET_RX_RING, unsafe.Pointer(&tReq), unsafe.Sizeof(tReq)); err != nil {
+	if err := setsockopt(d.fd, syscall.SOL_PACKET, syscall.PACKET_RX_RING, unsafe.Pointer(&tReq), unsafe.Sizeof(tReq)); err != nil {
 		return fmt.Errorf("failed to enable PACKET_RX_RING: %v", err)
 	}
 	// Let's mmap the blocks.
 	sz := tpBlockSize * tpBlockNR
-	buf, err := syscall.Mmap(e.fd, 0, sz, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	buf, err := syscall.Mmap(d.fd, 0, sz, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
 	if err != nil {
 		return fmt.Errorf("syscall.Mmap(...,0, %v, ...) failed = %v", sz, err)
 	}
-	e.ringBuffer = buf
+	d.ringBuffer = buf
 	return nil
 }
 
-func (e *endpoint) readMMappedPacket() ([]byte, *tcpip.Error) {
-	hdr := (tPacketHdr)(e.ringBuffer[0+e.ringOffset*tpFrameSize:])
+func (d *inboundDispatcher) readMMappedPacket() ([]byte, *tcpip.Error) {
+	hdr := (tPacketHdr)(d.ringBuffer[0+d.ringOffset*tpFrameSize:])
 	for (hdr.tpStatus() & tpStatusUser) == 0 {
-		event := rawfile.PollEvent{
-			FD:     int32(e.fd),
-			Events: unix.POLLIN | unix.POLLERR,
+		if d.busyPolling() {
+			// The frame is checked again without polling the FD.
+			runtime.Gosched()
+			continue
 		}
-		_, errno := rawfile.BlockingPoll(&event, 1, -1)
-		if errno != 0 {
-			if errno == syscall.EINTR {
-				continue
-			}
-			return nil, rawfile.TranslateErrno(errno)
+		if err := d.wait(); err != nil {
+			return nil, err
 		}
 		if hdr.tpStatus()&tpStatusCopy != 0 {
 			continue
@@ -160,19 +156,21 @@ func (e *endpoint) readMMappedPacket() ([]byte, *tcpip.Error) {
 		}
 	}
 
+	d.received()
+
 	// Copy out the packet from the mmapped frame to a locally owned buffer.
 	pkt := make([]byte, hdr.tpSnapLen())
 	copy(pkt, hdr.Payload())
 	// Release packet to kernel.
 	hdr.setTPStatus(tpStatusKernel)
-	e.ringOffset = (e.ringOffset + 1) % tpFrameNR
+	d.ringOffset = (d.ringOffset + 1) % tpFrameNR
 	return pkt, nil
 }
 
 // packetMMapDispatch reads packets from an mmaped ring buffer and dispatches
 // them to the network stack.
-func (e *endpoint) packetMMapDispatch() (bool, *tcpip.Error) {
-	pkt, err := e.readMMappedPacket()
+func (d *inboundDispatcher) packetMMapDispatch() (bool, *tcpip.Error) {
+	pkt, err := d.readMMappedPacket()
 	if err != nil {
 		return false, err
 	}
@@ -180,7 +178,7 @@ func (e *endpoint) packetMMapDispatch() (bool, *tcpip.Error) {
 		p             tcpip.NetworkProtocolNumber
 		remote, local tcpip.LinkAddress
 	)
-	if e.hdrSize > 0 {
+	if d.e.hdrSize > 0 {
 		eth := header.Ethernet(pkt)
 		p = eth.Type()
 		remote = eth.SourceAddress()
@@ -198,8 +196,8 @@ func (e *endpoint) packetMMapDispatch() (bool, *tcpip.Error) {
 		}
 	}
 
-	pkt = pkt[e.hdrSize:]
-	e.dispatcher.DeliverNetworkPacket(e, remote, local, p, buffer.NewVectorisedView(len(pkt), []buffer.View{buffer.View(pkt)}))
+	pkt = pkt[d.e.hdrSize:]
+	d.e.dispatcher.DeliverNetworkPacket(d.e, remote, local, p, buffer.NewVectorisedView(len(pkt), []buffer.View{buffer.View(pkt)}))
 	return true, nil
 }
 
@@ -0,0 +1,227 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qdisc
+
+import (
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+)
+
+// Default settings of FQ, from net/sched/sch_fq.c, for an Ethernet MTU.
+const (
+	DefaultFQLimit          = 10000
+	DefaultFQFlowLimit      = 100
+	DefaultFQQuantum        = 2 * 1514
+	DefaultFQInitialQuantum = 10 * 1514
+)
+
+// FQOptions are the settings of an FQ queueing discipline. Zero values stand
+// for the defaults.
+type FQOptions struct {
+	// Limit is the maximum number of packets queued.
+	Limit uint32
+
+	// FlowLimit is the maximum number of packets queued per flow.
+	FlowLimit uint32
+
+	// Quantum is the number of bytes a flow may send per round.
+	Quantum uint32
+
+	// InitialQuantum is the number of bytes a new flow may send in its first
+	// round.
+	InitialQuantum uint32
+
+	// MaxRate is the maximum rate of a flow, in bytes per second. If zero,
+	// flows aren't paced.
+	MaxRate uint64
+}
+
+// fqFlow is a flow scheduled by FQ.
+type fqFlow struct {
+	hash    uint32
+	packets []*stack.QueuedPacket
+
+	// credit is the number of bytes the flow may send in this round.
+	credit int
+
+	// next is the time the flow may send its next packet at, when it is
+	// paced.
+	next time.Time
+
+	// active is whether the flow is in the new or old flows of FQ.
+	active bool
+}
+
+// FQ is a fair queue: it schedules flows with deficit round robin, giving a
+// fair share of the link to each, and paces them.
+type FQ struct {
+	scheduler
+
+	opts  FQOptions
+	flows map[uint32]*fqFlow
+
+	// newFlows are the flows which became active in this round, served
+	// before oldFlows.
+	newFlows []*fqFlow
+	oldFlows []*fqFlow
+
+	// gcThreshold is the number of flows above which idle flows are
+	// garbage collected.
+	gcThreshold int
+}
+
+// fqMinGCThreshold is the minimum number of flows FQ garbage collects idle
+// flows above.
+const fqMinGCThreshold = 1024
+
+// NewFQ returns an FQ queueing discipline with settings opts.
+func NewFQ(opts FQOptions) *FQ {
+	if opts.Limit == 0 {
+		opts.Limit = DefaultFQLimit
+	}
+	if opts.FlowLimit == 0 {
+		opts.FlowLimit = DefaultFQFlowLimit
+	}
+	if opts.Quantum == 0 {
+		opts.Quantum = DefaultFQQuantum
+	}
+	if opts.InitialQuantum == 0 {
+		opts.InitialQuantum = DefaultFQInitialQuantum
+	}
+	q := &FQ{
+		opts:        opts,
+		flows:       make(map[uint32]*fqFlow),
+		gcThreshold: fqMinGCThreshold,
+	}
+	q.init(q)
+	return q
+}
+
+// Options returns the settings of the discipline.
+func (q *FQ) Options() FQOptions {
+	return q.opts
+}
+
+// enqueueLocked implements discipline.enqueueLocked.
+func (q *FQ) enqueueLocked(p *stack.QueuedPacket, now time.Time) bool {
+	if q.stats.QueueLen >= q.opts.Limit {
+		return false
+	}
+	f := q.flows[p.FlowHash()]
+	if f == nil {
+		if len(q.flows) >= q.gcThreshold {
+			q.gcLocked(now)
+		}
+		f = &fqFlow{hash: p.FlowHash(), credit: int(q.opts.InitialQuantum)}
+		q.flows[f.hash] = f
+	}
+	if uint32(len(f.packets)) >= q.opts.FlowLimit {
+		return false
+	}
+	f.packets = append(f.packets, p)
+	if !f.active {
+		f.active = true
+		if f.credit < int(q.opts.Quantum) {
+			f.credit = int(q.opts.Quantum)
+		}
+		q.newFlows = append(q.newFlows, f)
+	}
+	return true
+}
+
+// gcLocked forgets the idle flows which are no longer paced.
+func (q *FQ) gcLocked(now time.Time) {
+	for hash, f := range q.flows {
+		if !f.active && !f.next.After(now) {
+			delete(q.flows, hash)
+		}
+	}
+	q.gcThreshold = 2 * len(q.flows)
+	if q.gcThreshold < fqMinGCThreshold {
+		q.gcThreshold = fqMinGCThreshold
+	}
+}
+
+// dequeueLocked implements discipline.dequeueLocked.
+func (q *FQ) dequeueLocked(now time.Time) (*stack.QueuedPacket, time.Time) {
+	var next time.Time
+	// Each flow may be looked at twice: once to refill its credit, and once
+	// to send.
+	for n := 2*(len(q.newFlows)+len(q.oldFlows)) + 1; n > 0; n-- {
+		list := &q.newFlows
+		if len(*list) == 0 {
+			list = &q.oldFlows
+			if len(*list) == 0 {
+				break
+			}
+		}
+		f := (*list)[0]
+		if len(f.packets) > 0 && f.credit > 0 && !f.next.After(now) {
+			// The flow keeps its place until its credit is spent.
+			p := f.packets[0]
+			f.packets[0] = nil
+			f.packets = f.packets[1:]
+			f.credit -= p.Size()
+			if q.opts.MaxRate != 0 {
+				f.next = now.Add(time.Duration(uint64(p.Size()) * uint64(time.Second) / q.opts.MaxRate))
+			}
+			return p, time.Time{}
+		}
+		(*list)[0] = nil
+		*list = (*list)[1:]
+
+		switch {
+		case len(f.packets) == 0:
+			// Empty new flows go through the old flows before being
+			// detached, so flows can't get ahead by going idle.
+			if list == &q.newFlows && len(q.oldFlows) > 0 {
+				q.oldFlows = append(q.oldFlows, f)
+				continue
+			}
+			f.active = false
+			if !f.next.After(now) {
+				delete(q.flows, f.hash)
+			}
+		case f.credit <= 0:
+			f.credit += int(q.opts.Quantum)
+			q.oldFlows = append(q.oldFlows, f)
+		default:
+			// The flow is paced.
+			q.stats.Overlimits++
+			if next.IsZero() || f.next.Before(next) {
+				next = f.next
+			}
+			q.oldFlows = append(q.oldFlows, f)
+		}
+	}
+	if next.IsZero() && q.stats.QueueLen > 0 {
+		// Flows are still refilling their credit.
+		next = now
+	}
+	return nil, next
+}
+
+// resetLocked implements discipline.resetLocked.
+func (q *FQ) resetLocked() []*stack.QueuedPacket {
+	var ps []*stack.QueuedPacket
+	for _, f := range q.flows {
+		ps = append(ps, f.packets...)
+	}
+	q.flows = make(map[uint32]*fqFlow)
+	q.newFlows = nil
+	q.oldFlows = nil
+	return ps
+}
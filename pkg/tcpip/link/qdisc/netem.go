@@ -0,0 +1,164 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qdisc
+
+import (
+	"container/heap"
+	"math/rand"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+)
+
+// DefaultNetemLimit is the default maximum number of packets queued by a
+// Netem queueing discipline.
+const DefaultNetemLimit = 1000
+
+// NetemOptions are the settings of a Netem queueing discipline.
+type NetemOptions struct {
+	// Latency is the delay added to the packets.
+	Latency time.Duration
+
+	// Jitter is the maximum variation of the delay, which is uniformly
+	// distributed in [Latency-Jitter, Latency+Jitter]. Packets may be
+	// reordered by it.
+	Jitter time.Duration
+
+	// Loss is the probability of dropping a packet, scaled to
+	// math.MaxUint32.
+	Loss uint32
+
+	// Limit is the maximum number of packets queued. If zero, it is
+	// DefaultNetemLimit.
+	Limit uint32
+}
+
+// netemPacket is a packet queued by Netem with the time it is to be sent.
+type netemPacket struct {
+	p    *stack.QueuedPacket
+	time time.Time
+	seq  uint64
+}
+
+// netemQueue is a heap of packets, ordered by the time they are to be sent,
+// and then by the order they were queued.
+type netemQueue []netemPacket
+
+// Len implements heap.Interface.Len.
+func (h netemQueue) Len() int {
+	return len(h)
+}
+
+// Less implements heap.Interface.Less.
+func (h netemQueue) Less(i, j int) bool {
+	if !h[i].time.Equal(h[j].time) {
+		return h[i].time.Before(h[j].time)
+	}
+	return h[i].seq < h[j].seq
+}
+
+// Swap implements heap.Interface.Swap.
+func (h netemQueue) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+// Push implements heap.Interface.Push.
+func (h *netemQueue) Push(x interface{}) {
+	*h = append(*h, x.(netemPacket))
+}
+
+// Pop implements heap.Interface.Pop.
+func (h *netemQueue) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = netemPacket{}
+	*h = old[:n-1]
+	return x
+}
+
+// Netem is a network emulator: it delays packets, and drops some of them.
+type Netem struct {
+	scheduler
+
+	opts  NetemOptions
+	rand  *rand.Rand
+	queue netemQueue
+	seq   uint64
+}
+
+// NewNetem returns a Netem queueing discipline with settings opts.
+func NewNetem(opts NetemOptions) *Netem {
+	if opts.Limit == 0 {
+		opts.Limit = DefaultNetemLimit
+	}
+	q := &Netem{
+		opts: opts,
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	q.init(q)
+	return q
+}
+
+// Options returns the settings of the discipline.
+func (q *Netem) Options() NetemOptions {
+	return q.opts
+}
+
+// delayLocked returns the delay of a packet.
+func (q *Netem) delayLocked() time.Duration {
+	d := q.opts.Latency
+	if q.opts.Jitter > 0 {
+		d += time.Duration(q.rand.Int63n(2*int64(q.opts.Jitter)+1)) - q.opts.Jitter
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+// enqueueLocked implements discipline.enqueueLocked.
+func (q *Netem) enqueueLocked(p *stack.QueuedPacket, now time.Time) bool {
+	if q.opts.Loss != 0 && q.rand.Uint32() < q.opts.Loss {
+		return false
+	}
+	if uint32(len(q.queue)) >= q.opts.Limit {
+		return false
+	}
+	heap.Push(&q.queue, netemPacket{p: p, time: now.Add(q.delayLocked()), seq: q.seq})
+	q.seq++
+	return true
+}
+
+// dequeueLocked implements discipline.dequeueLocked.
+func (q *Netem) dequeueLocked(now time.Time) (*stack.QueuedPacket, time.Time) {
+	if len(q.queue) == 0 {
+		return nil, time.Time{}
+	}
+	if t := q.queue[0].time; t.After(now) {
+		return nil, t
+	}
+	return heap.Pop(&q.queue).(netemPacket).p, time.Time{}
+}
+
+// resetLocked implements discipline.resetLocked.
+func (q *Netem) resetLocked() []*stack.QueuedPacket {
+	var ps []*stack.QueuedPacket
+	for _, np := range q.queue {
+		ps = append(ps, np.p)
+	}
+	q.queue = nil
+	return ps
+}
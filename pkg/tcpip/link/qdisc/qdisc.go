@@ -0,0 +1,152 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package qdisc provides queueing disciplines which can be attached to the
+// NICs of a stack to schedule the packets they send, mirroring the Linux
+// qdiscs of the same names:
+//
+//   - FQ paces flows and schedules them fairly.
+//   - TBF shapes the traffic with a token bucket.
+//   - Netem emulates the latency, jitter and loss of a network.
+package qdisc
+
+import (
+	"sync"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+)
+
+// discipline is the scheduling policy of a queueing discipline. Its methods
+// are called with the lock of the scheduler held.
+type discipline interface {
+	// enqueueLocked queues p, and returns false if p must be dropped
+	// instead.
+	enqueueLocked(p *stack.QueuedPacket, now time.Time) bool
+
+	// dequeueLocked returns the next packet to send at now. If there is
+	// none, it returns the time at which to try again, or the zero time if
+	// nothing is queued.
+	dequeueLocked(now time.Time) (*stack.QueuedPacket, time.Time)
+
+	// resetLocked empties the queue, and returns the packets it held.
+	resetLocked() []*stack.QueuedPacket
+}
+
+// scheduler implements stack.QueueingDiscipline on top of a discipline: it
+// keeps the statistics, and writes the packets dequeued from a goroutine.
+type scheduler struct {
+	d    discipline
+	wake chan struct{}
+
+	mu     sync.Mutex
+	stats  stack.QueueingDisciplineStats
+	closed bool
+}
+
+// init initializes the scheduler of d, and starts its goroutine.
+func (s *scheduler) init(d discipline) {
+	s.d = d
+	s.wake = make(chan struct{}, 1)
+	go s.run() // S/R-SAFE: netstack is not saved.
+}
+
+// Enqueue implements stack.QueueingDiscipline.Enqueue.
+func (s *scheduler) Enqueue(p *stack.QueuedPacket) *tcpip.Error {
+	s.mu.Lock()
+	if s.closed || !s.d.enqueueLocked(p, time.Now()) {
+		s.stats.Drops++
+		s.mu.Unlock()
+		p.Drop()
+		return nil
+	}
+	s.stats.QueueLen++
+	s.stats.Backlog += uint32(p.Size())
+	s.mu.Unlock()
+
+	s.notify()
+	return nil
+}
+
+// Stats implements stack.QueueingDiscipline.Stats.
+func (s *scheduler) Stats() stack.QueueingDisciplineStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// Close implements stack.QueueingDiscipline.Close.
+func (s *scheduler) Close() {
+	s.mu.Lock()
+	s.closed = true
+	dropped := s.d.resetLocked()
+	s.stats.Drops += uint64(len(dropped))
+	s.stats.QueueLen = 0
+	s.stats.Backlog = 0
+	s.mu.Unlock()
+
+	s.notify()
+	for _, p := range dropped {
+		p.Drop()
+	}
+}
+
+// notify wakes the goroutine of the scheduler up.
+func (s *scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run writes the packets dequeued until the scheduler is closed, sleeping
+// while none is due.
+func (s *scheduler) run() {
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+		now := time.Now()
+		p, next := s.d.dequeueLocked(now)
+		if p != nil {
+			size := p.Size()
+			s.stats.Packets++
+			s.stats.Bytes += uint64(size)
+			s.stats.QueueLen--
+			s.stats.Backlog -= uint32(size)
+		}
+		s.mu.Unlock()
+
+		switch {
+		case p != nil:
+			p.Write()
+		case next.IsZero():
+			<-s.wake
+		default:
+			timer.Reset(next.Sub(now))
+			select {
+			case <-s.wake:
+				if !timer.Stop() {
+					<-timer.C
+				}
+			case <-timer.C:
+			}
+		}
+	}
+}
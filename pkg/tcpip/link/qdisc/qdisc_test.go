@@ -0,0 +1,209 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qdisc
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/channel"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+const (
+	nicID      = 1
+	stackAddr  = "\x0a\x00\x00\x01"
+	remoteAddr = "\x0a\x00\x00\x02"
+)
+
+type testContext struct {
+	t    *testing.T
+	s    *stack.Stack
+	link *channel.Endpoint
+	ep   tcpip.Endpoint
+}
+
+func newTestContext(t *testing.T, q stack.QueueingDiscipline) *testContext {
+	s := stack.New([]string{ipv4.ProtocolName}, []string{udp.ProtocolName}, stack.Options{})
+	id, link := channel.New(256, 1500, "")
+	if err := s.CreateNIC(nicID, id); err != nil {
+		t.Fatalf("CreateNIC failed: %v", err)
+	}
+	if err := s.AddAddress(nicID, ipv4.ProtocolNumber, stackAddr); err != nil {
+		t.Fatalf("AddAddress failed: %v", err)
+	}
+	s.SetRouteTable([]tcpip.Route{{
+		Destination: "\x00\x00\x00\x00",
+		Mask:        "\x00\x00\x00\x00",
+		NIC:         nicID,
+	}})
+	if err := s.SetQueueingDiscipline(nicID, q); err != nil {
+		t.Fatalf("SetQueueingDiscipline failed: %v", err)
+	}
+
+	var wq waiter.Queue
+	ep, err := s.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+	if err != nil {
+		t.Fatalf("NewEndpoint failed: %v", err)
+	}
+	return &testContext{t: t, s: s, link: link, ep: ep}
+}
+
+func (c *testContext) cleanup() {
+	c.ep.Close()
+	c.s.SetQueueingDiscipline(nicID, nil)
+}
+
+// send sends a datagram of size bytes to the remote address.
+func (c *testContext) send(size int) {
+	to := tcpip.FullAddress{Addr: remoteAddr, Port: 80}
+	if _, _, err := c.ep.Write(tcpip.SlicePayload(make([]byte, size)), tcpip.WriteOptions{To: &to}); err != nil {
+		c.t.Fatalf("Write failed: %v", err)
+	}
+}
+
+// expectPackets waits for n packets to be sent on the link.
+func (c *testContext) expectPackets(n int, timeout time.Duration) {
+	deadline := time.After(timeout)
+	for i := 0; i < n; i++ {
+		select {
+		case <-c.link.C:
+		case <-deadline:
+			c.t.Fatalf("got %d packets, want %d", i, n)
+		}
+	}
+}
+
+// expectNoPacket checks no packet is sent on the link for d.
+func (c *testContext) expectNoPacket(d time.Duration) {
+	select {
+	case <-c.link.C:
+		c.t.Fatalf("got unexpected packet")
+	case <-time.After(d):
+	}
+}
+
+func TestNetemLatency(t *testing.T) {
+	q := NewNetem(NetemOptions{Latency: 200 * time.Millisecond})
+	c := newTestContext(t, q)
+	defer c.cleanup()
+
+	c.send(100)
+	c.expectNoPacket(50 * time.Millisecond)
+	c.expectPackets(1, 5*time.Second)
+
+	if got := q.Stats().Packets; got != 1 {
+		t.Errorf("got Stats().Packets = %d, want = 1", got)
+	}
+}
+
+func TestNetemLoss(t *testing.T) {
+	q := NewNetem(NetemOptions{Loss: math.MaxUint32})
+	c := newTestContext(t, q)
+	defer c.cleanup()
+
+	for i := 0; i < 10; i++ {
+		c.send(100)
+	}
+	c.expectNoPacket(50 * time.Millisecond)
+
+	if got := q.Stats().Drops; got < 9 {
+		t.Errorf("got Stats().Drops = %d, want >= 9", got)
+	}
+}
+
+func TestTBFRate(t *testing.T) {
+	q := NewTBF(TBFOptions{Rate: 10000, Burst: 1500, Limit: 10000})
+	c := newTestContext(t, q)
+	defer c.cleanup()
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		c.send(1000)
+	}
+	// The first packet fits in the bucket, the others are sent at the rate.
+	c.expectPackets(1, time.Second)
+	c.expectPackets(3, 5*time.Second)
+	if d := time.Since(start); d < 250*time.Millisecond {
+		t.Errorf("packets sent in %s, want >= 250ms", d)
+	}
+	if got := q.Stats().Overlimits; got == 0 {
+		t.Errorf("got Stats().Overlimits = 0, want > 0")
+	}
+}
+
+func TestTBFLimit(t *testing.T) {
+	q := NewTBF(TBFOptions{Rate: 1000, Burst: 1500, Limit: 2000})
+	c := newTestContext(t, q)
+	defer c.cleanup()
+
+	for i := 0; i < 4; i++ {
+		c.send(1000)
+	}
+	if got := q.Stats().Drops; got == 0 {
+		t.Errorf("got Stats().Drops = 0, want > 0")
+	}
+}
+
+func TestFQMaxRate(t *testing.T) {
+	q := NewFQ(FQOptions{MaxRate: 10000})
+	c := newTestContext(t, q)
+	defer c.cleanup()
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		c.send(1000)
+	}
+	c.expectPackets(4, 5*time.Second)
+	if d := time.Since(start); d < 250*time.Millisecond {
+		t.Errorf("packets sent in %s, want >= 250ms", d)
+	}
+}
+
+func TestFQFlowLimit(t *testing.T) {
+	q := NewFQ(FQOptions{FlowLimit: 2, MaxRate: 100})
+	c := newTestContext(t, q)
+	defer c.cleanup()
+
+	for i := 0; i < 5; i++ {
+		c.send(100)
+	}
+	if got := q.Stats().Drops; got < 2 {
+		t.Errorf("got Stats().Drops = %d, want >= 2", got)
+	}
+}
+
+func TestDetachDropsQueued(t *testing.T) {
+	q := NewNetem(NetemOptions{Latency: time.Hour})
+	c := newTestContext(t, q)
+	defer c.cleanup()
+
+	c.send(100)
+	if err := c.s.SetQueueingDiscipline(nicID, nil); err != nil {
+		t.Fatalf("SetQueueingDiscipline failed: %v", err)
+	}
+	if got := q.Stats().Drops; got != 1 {
+		t.Errorf("got Stats().Drops = %d, want = 1", got)
+	}
+
+	// Packets are sent directly once the discipline is detached.
+	c.send(100)
+	c.expectPackets(1, time.Second)
+}
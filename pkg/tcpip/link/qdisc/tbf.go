@@ -0,0 +1,123 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qdisc
+
+import (
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+)
+
+// TBFOptions are the settings of a TBF queueing discipline.
+type TBFOptions struct {
+	// Rate is the rate of the traffic, in bytes per second.
+	Rate uint64
+
+	// Burst is the size of the bucket, in bytes: the number of bytes which
+	// may be sent at once after an idle period.
+	Burst uint32
+
+	// Limit is the maximum number of bytes queued. If zero, it is Burst.
+	Limit uint32
+}
+
+// TBF is a token bucket filter: it limits the traffic sent to a rate, while
+// allowing bursts.
+type TBF struct {
+	scheduler
+
+	opts TBFOptions
+
+	// buffer is the time needed to fill the bucket at the rate, and tokens
+	// the time accumulated in the bucket at last.
+	buffer time.Duration
+	tokens time.Duration
+	last   time.Time
+
+	queue []*stack.QueuedPacket
+}
+
+// NewTBF returns a TBF queueing discipline with settings opts.
+//
+// Preconditions: opts.Rate and opts.Burst are not zero.
+func NewTBF(opts TBFOptions) *TBF {
+	if opts.Limit == 0 {
+		opts.Limit = opts.Burst
+	}
+	q := &TBF{opts: opts}
+	q.buffer = q.cost(int(opts.Burst))
+	q.tokens = q.buffer
+	q.last = time.Now()
+	q.init(q)
+	return q
+}
+
+// Options returns the settings of the discipline.
+func (q *TBF) Options() TBFOptions {
+	return q.opts
+}
+
+// cost returns the time needed to send size bytes at the rate.
+func (q *TBF) cost(size int) time.Duration {
+	return time.Duration(uint64(size) * uint64(time.Second) / q.opts.Rate)
+}
+
+// enqueueLocked implements discipline.enqueueLocked.
+func (q *TBF) enqueueLocked(p *stack.QueuedPacket, now time.Time) bool {
+	if uint64(q.stats.Backlog)+uint64(p.Size()) > uint64(q.opts.Limit) {
+		return false
+	}
+	q.queue = append(q.queue, p)
+	return true
+}
+
+// dequeueLocked implements discipline.dequeueLocked.
+func (q *TBF) dequeueLocked(now time.Time) (*stack.QueuedPacket, time.Time) {
+	if len(q.queue) == 0 {
+		return nil, time.Time{}
+	}
+
+	p := q.queue[0]
+	tokens := q.tokens + now.Sub(q.last)
+	if tokens > q.buffer {
+		tokens = q.buffer
+	}
+	// Packets larger than the bucket are sent once it is full.
+	cost := q.cost(p.Size())
+	if need := minDuration(cost, q.buffer); tokens < need {
+		q.stats.Overlimits++
+		return nil, now.Add(need - tokens)
+	}
+
+	q.tokens = tokens - cost
+	q.last = now
+	q.queue[0] = nil
+	q.queue = q.queue[1:]
+	return p, time.Time{}
+}
+
+// resetLocked implements discipline.resetLocked.
+func (q *TBF) resetLocked() []*stack.QueuedPacket {
+	queue := q.queue
+	q.queue = nil
+	return queue
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
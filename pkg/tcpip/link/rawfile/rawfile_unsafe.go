@@ -152,6 +152,17 @@ func BlockingReadv(fd int, iovecs []syscall.Iovec) (int, *tcpip.Error) {
 	}
 }
 
+// NonBlockingReadv reads from a file descriptor that is set up as
+// non-blocking and stores the data in a list of iovecs buffers. If no data is
+// available, it returns tcpip.ErrWouldBlock.
+func NonBlockingReadv(fd int, iovecs []syscall.Iovec) (int, *tcpip.Error) {
+	n, _, e := syscall.RawSyscall(syscall.SYS_READV, uintptr(fd), uintptr(unsafe.Pointer(&iovecs[0])), uintptr(len(iovecs)))
+	if e != 0 {
+		return 0, TranslateErrno(e)
+	}
+	return int(n), nil
+}
+
 // MMsgHdr represents the mmsg_hdr structure required by recvmmsg() on linux.
 type MMsgHdr struct {
 	Msg syscall.Msghdr
@@ -159,6 +170,17 @@ type MMsgHdr struct {
 	_   [4]byte
 }
 
+// NonBlockingRecvMMsg reads from a file descriptor that is set up as
+// non-blocking and stores the received messages in a slice of MMsgHdr
+// structures. If no data is available, it returns tcpip.ErrWouldBlock.
+func NonBlockingRecvMMsg(fd int, msgHdrs []MMsgHdr) (int, *tcpip.Error) {
+	n, _, e := syscall.RawSyscall6(syscall.SYS_RECVMMSG, uintptr(fd), uintptr(unsafe.Pointer(&msgHdrs[0])), uintptr(len(msgHdrs)), syscall.MSG_DONTWAIT, 0, 0)
+	if e != 0 {
+		return 0, TranslateErrno(e)
+	}
+	return int(n), nil
+}
+
 // BlockingRecvMMsg reads from a file descriptor that is set up as non-blocking
 // and stores the received messages in a slice of MMsgHdr structures. If no data
 // is available, it will block in a poll() syscall until the file descriptor
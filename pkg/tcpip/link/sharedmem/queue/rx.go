@@ -93,6 +93,13 @@ func (r *Rx) DisableNotification() {
 	atomic.StoreUint32(r.sharedEventFDState, eventFDDisabled)
 }
 
+// NotificationRequested returns whether the consumer of a queue, whose shared
+// state is sharedEventFDState, has enabled eventfd notifications. The producer
+// must then notify the eventfd after it makes new data available.
+func NotificationRequested(sharedEventFDState *uint32) bool {
+	return atomic.LoadUint32(sharedEventFDState) == eventFDEnabled
+}
+
 // PostedBuffersLimit returns the maximum number of buffers that can be posted
 // before the tx queue fills up.
 func (r *Rx) PostedBuffersLimit() uint64 {
@@ -0,0 +1,105 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build linux
+
+package sharedmem
+
+import (
+	"syscall"
+)
+
+// sharedDataSize is the size of the file holding the state shared by the two
+// ends of a queue.
+const sharedDataSize = 4096
+
+// QueueOptions are the sizes of the shared memory regions of a queue.
+type QueueOptions struct {
+	// DataSize is the size of the data region, in bytes.
+	DataSize int64
+
+	// PipeSize is the size of each of the tx and rx pipes, in bytes. Both
+	// pipes are descriptor rings: the tx pipe carries descriptors from the
+	// producer to the consumer, and the rx pipe completions back.
+	PipeSize int64
+}
+
+// NewQueueConfig creates the memory files and the eventfd of a queue with
+// sizes opts, and returns their file descriptors. The pipes are initialized
+// such that the endpoint and its peer can map them right away.
+//
+// The caller owns the returned file descriptors, which are typically passed
+// to New() and to the peer, and then closed with Close().
+func NewQueueConfig(name string, opts QueueOptions) (QueueConfig, error) {
+	c := QueueConfig{
+		DataFD:       -1,
+		EventFD:      -1,
+		TxPipeFD:     -1,
+		RxPipeFD:     -1,
+		SharedDataFD: -1,
+	}
+
+	var err error
+	if c.DataFD, err = createMemFD(name+"-data", opts.DataSize); err != nil {
+		c.Close()
+		return QueueConfig{}, err
+	}
+	if c.TxPipeFD, err = createPipeFD(name+"-tx", opts.PipeSize); err != nil {
+		c.Close()
+		return QueueConfig{}, err
+	}
+	if c.RxPipeFD, err = createPipeFD(name+"-rx", opts.PipeSize); err != nil {
+		c.Close()
+		return QueueConfig{}, err
+	}
+	if c.SharedDataFD, err = createMemFD(name+"-shared", sharedDataSize); err != nil {
+		c.Close()
+		return QueueConfig{}, err
+	}
+
+	efd, _, e := syscall.RawSyscall(syscall.SYS_EVENTFD2, 0, syscall.O_CLOEXEC, 0)
+	if e != 0 {
+		c.Close()
+		return QueueConfig{}, e
+	}
+	c.EventFD = int(efd)
+
+	return c, nil
+}
+
+// Close closes all the file descriptors of the queue. The endpoint and the
+// peer keep their own references to the memory and the eventfd.
+func (c *QueueConfig) Close() {
+	for _, fd := range []*int{&c.DataFD, &c.EventFD, &c.TxPipeFD, &c.RxPipeFD, &c.SharedDataFD} {
+		if *fd >= 0 {
+			syscall.Close(*fd)
+			*fd = -1
+		}
+	}
+}
+
+// createPipeFD creates a memory file of the given size holding an empty pipe.
+func createPipeFD(name string, size int64) (int, error) {
+	fd, err := createMemFD(name, size)
+	if err != nil {
+		return -1, err
+	}
+
+	// Write the "slot-free" flag in the first slot of the pipe.
+	if _, err := syscall.Pwrite(fd, []byte{0, 0, 0, 0, 0, 0, 0, 0x80}, 0); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
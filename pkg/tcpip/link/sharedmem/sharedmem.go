@@ -20,6 +20,12 @@
 // Shared memory endpoints can be used in the networking stack by calling New()
 // to create a new endpoint, and then passing it as an argument to
 // Stack.CreateNIC().
+//
+// Each endpoint has a tx and an rx queue, whose descriptor rings, data and
+// eventfd doorbells are shared with a peer, such as a dataplane running on the
+// host, so that packets are exchanged without a system call per packet. The
+// peer consumes the tx queue and produces the rx queue; NewQueueConfig()
+// creates the memory and eventfds of a queue.
 package sharedmem
 
 import (
@@ -45,7 +51,8 @@ type QueueConfig struct {
 	DataFD int
 
 	// EventFD is a file descriptor for the event that is signaled when
-	// data is becomes available in this queue.
+	// data is becomes available in this queue, if the consumer of the queue
+	// has enabled notifications in the shared data.
 	EventFD int
 
 	// TxPipeFD is a file descriptor for the tx pipe associated with the
@@ -23,6 +23,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
@@ -377,6 +378,68 @@ func TestPreserveSrcAddressInSend(t *testing.T) {
 	}
 }
 
+// TestTxNotification checks that the endpoint signals the eventfd of the tx
+// queue when it sends a packet, only if the peer enabled notifications.
+func TestTxNotification(t *testing.T) {
+	opts := QueueOptions{DataSize: queueDataSize, PipeSize: queuePipeSize}
+	txCfg, err := NewQueueConfig("tx", opts)
+	if err != nil {
+		t.Fatalf("NewQueueConfig failed: %v", err)
+	}
+	defer txCfg.Close()
+	rxCfg, err := NewQueueConfig("rx", opts)
+	if err != nil {
+		t.Fatalf("NewQueueConfig failed: %v", err)
+	}
+	defer rxCfg.Close()
+
+	var txq queueBuffers
+	initQueue(t, &txq, &txCfg)
+	defer txq.cleanup()
+	sharedData, err := getBuffer(txCfg.SharedDataFD)
+	if err != nil {
+		t.Fatalf("getBuffer failed: %v", err)
+	}
+	defer syscall.Munmap(sharedData)
+	if err := syscall.SetNonblock(txCfg.EventFD, true); err != nil {
+		t.Fatalf("SetNonblock failed: %v", err)
+	}
+
+	id, err := New(20000, 1500, localLinkAddr, txCfg, rxCfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	ep := stack.FindLinkEndpoint(id).(*endpoint)
+	defer ep.Close()
+
+	r := stack.Route{
+		RemoteLinkAddress: remoteLinkAddr,
+	}
+	buf := buffer.NewView(100)
+	var tmp [8]byte
+	for _, enabled := range []bool{false, true} {
+		state := uint32(1) // Disabled.
+		if enabled {
+			state = 2 // Enabled.
+		}
+		atomic.StoreUint32(sharedDataPointer(sharedData), state)
+
+		hdr := buffer.NewPrependable(int(ep.MaxHeaderLength()))
+		if err := ep.WritePacket(&r, nil /* gso */, hdr, buf.ToVectorisedView(), header.IPv4ProtocolNumber); err != nil {
+			t.Fatalf("WritePacket failed: %v", err)
+		}
+		if txq.tx.Pull() == nil {
+			t.Fatalf("Packet not found in the tx queue")
+		}
+		txq.tx.Flush()
+
+		_, err := syscall.Read(txCfg.EventFD, tmp[:])
+		if got := err == nil; got != enabled {
+			t.Fatalf("Got eventfd notification = %t (err = %v), want = %t", got, err, enabled)
+		}
+	}
+}
+
 // TestFillTxQueue sends packets until the queue is full.
 func TestFillTxQueue(t *testing.T) {
 	c := newTestContext(t, 20000, 1500, localLinkAddr)
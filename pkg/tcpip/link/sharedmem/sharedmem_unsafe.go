@@ -15,7 +15,10 @@
 package sharedmem
 
 import (
+	"syscall"
 	"unsafe"
+
+	"golang.org/x/sys/unix"
 )
 
 // sharedDataPointer converts the shared data slice into a pointer so that it
@@ -23,3 +26,20 @@ import (
 func sharedDataPointer(sharedData []byte) *uint32 {
 	return (*uint32)(unsafe.Pointer(&sharedData[0:4][0]))
 }
+
+// createMemFD creates a memory file of the given size.
+func createMemFD(name string, size int64) (int, error) {
+	p, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return -1, err
+	}
+	fd, _, e := syscall.Syscall(unix.SYS_MEMFD_CREATE, uintptr(unsafe.Pointer(p)), unix.MFD_CLOEXEC, 0)
+	if e != 0 {
+		return -1, e
+	}
+	if err := syscall.Ftruncate(int(fd), size); err != nil {
+		syscall.Close(int(fd))
+		return -1, err
+	}
+	return int(fd), nil
+}
@@ -27,10 +27,12 @@ const (
 
 // tx holds all state associated with a tx queue.
 type tx struct {
-	data []byte
-	q    queue.Tx
-	ids  idManager
-	bufs bufferManager
+	data       []byte
+	sharedData []byte
+	q          queue.Tx
+	ids        idManager
+	bufs       bufferManager
+	eventFD    int
 }
 
 // init initializes all state needed by the tx queue based on the information
@@ -58,11 +60,42 @@ func (t *tx) init(mtu uint32, c *QueueConfig) error {
 		return err
 	}
 
+	sharedData, err := getBuffer(c.SharedDataFD)
+	if err != nil {
+		syscall.Munmap(txPipe)
+		syscall.Munmap(rxPipe)
+		syscall.Munmap(data)
+		return err
+	}
+
+	// Duplicate the eventFD so that caller can close it but we can still
+	// use it to notify the peer.
+	efd, err := syscall.Dup(c.EventFD)
+	if err != nil {
+		syscall.Munmap(txPipe)
+		syscall.Munmap(rxPipe)
+		syscall.Munmap(data)
+		syscall.Munmap(sharedData)
+		return err
+	}
+
+	// Set the eventfd as non-blocking.
+	if err := syscall.SetNonblock(efd, true); err != nil {
+		syscall.Munmap(txPipe)
+		syscall.Munmap(rxPipe)
+		syscall.Munmap(data)
+		syscall.Munmap(sharedData)
+		syscall.Close(efd)
+		return err
+	}
+
 	// Initialize state based on buffers.
 	t.q.Init(txPipe, rxPipe)
 	t.ids.init()
 	t.bufs.init(0, len(data), int(mtu))
 	t.data = data
+	t.sharedData = sharedData
+	t.eventFD = efd
 
 	return nil
 }
@@ -74,6 +107,8 @@ func (t *tx) cleanup() {
 	syscall.Munmap(a)
 	syscall.Munmap(b)
 	syscall.Munmap(t.data)
+	syscall.Munmap(t.sharedData)
+	syscall.Close(t.eventFD)
 }
 
 // transmit sends a packet made up of up to two buffers. Returns a boolean that
@@ -135,9 +170,21 @@ func (t *tx) transmit(a, b []byte) bool {
 		return false
 	}
 
+	// Ring the doorbell if the peer is waiting for packets.
+	if queue.NotificationRequested(sharedDataPointer(t.sharedData)) {
+		t.notify()
+	}
+
 	return true
 }
 
+// notify signals the eventfd of the queue to wake the peer up. Errors are
+// ignored: the eventfd is non-blocking, and fails to be written only if the
+// peer has plenty of pending notifications already.
+func (t *tx) notify() {
+	syscall.Write(t.eventFD, []byte{1, 0, 0, 0, 0, 0, 0, 0})
+}
+
 // getBuffer returns a memory region mapped to the full contents of the given
 // file descriptor.
 func getBuffer(fd int) ([]byte, error) {
@@ -193,6 +193,14 @@ func (e *endpoint) GSOMaxSize() uint32 {
 	return 0
 }
 
+// Close implements stack.ClosableEndpoint.Close. It closes the lower endpoint
+// if it is closable.
+func (e *endpoint) Close() {
+	if c, ok := e.lower.(stack.ClosableEndpoint); ok {
+		c.Close()
+	}
+}
+
 // WritePacket implements the stack.LinkEndpoint interface. It is called by
 // higher-level protocols to write packets; it just logs the packet and forwards
 // the request to the lower endpoint.
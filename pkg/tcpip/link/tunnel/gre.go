@@ -0,0 +1,179 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import (
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+)
+
+// GREOptions specify the configuration of a GRE tunnel.
+type GREOptions struct {
+	// NICID is the ID of the NIC the tunnel is attached to. Packets routed
+	// back over it once encapsulated are dropped.
+	NICID tcpip.NICID
+
+	// Local is the source address of the encapsulating packets, or empty
+	// to pick it from the route to Remote. Only packets sent to it are
+	// received when it is set.
+	Local tcpip.Address
+
+	// Remote is the address of the other end of the tunnel. Only packets
+	// sent from it are received.
+	Remote tcpip.Address
+
+	// InputKey is the key packets received must carry, if HasInputKey is
+	// set. Packets carrying a key are dropped otherwise.
+	InputKey    uint32
+	HasInputKey bool
+
+	// OutputKey is the key set on the packets sent, if HasOutputKey is
+	// set.
+	OutputKey    uint32
+	HasOutputKey bool
+
+	// TTL is the TTL of the encapsulating packets, or zero to use the
+	// default one of the route.
+	TTL uint8
+
+	// MTU is the MTU of the tunnel, or zero to derive it from the size of
+	// the encapsulation headers.
+	MTU uint32
+}
+
+// GRE is a GRE tunnel, carrying IPv4 and IPv6 packets to a single remote end
+// over IPv4 or IPv6, as described in RFC 2784 and RFC 2890.
+type GRE struct {
+	stack      *stack.Stack
+	opts       GREOptions
+	mtu        uint32
+	netProto   tcpip.NetworkProtocolNumber
+	dispatcher stack.NetworkDispatcher
+}
+
+// NewGRE creates a GRE tunnel in the stack s, and starts receiving the packets
+// sent to it. It must be closed with Close once it is no longer used.
+func NewGRE(s *stack.Stack, opts GREOptions) (*GRE, *tcpip.Error) {
+	netProto := netProtoOf(opts.Remote)
+	if opts.Local != "" && netProtoOf(opts.Local) != netProto {
+		return nil, tcpip.ErrInvalidEndpointState
+	}
+	mtu := opts.MTU
+	if mtu == 0 {
+		size := header.GRESize(&header.GREFields{HasKey: opts.HasOutputKey})
+		if netProto == header.IPv6ProtocolNumber {
+			mtu = underlayMTU - header.IPv6MinimumSize - uint32(size)
+		} else {
+			mtu = underlayMTU - header.IPv4MinimumSize - uint32(size)
+		}
+	}
+	g := &GRE{
+		stack:    s,
+		opts:     opts,
+		mtu:      mtu,
+		netProto: netProto,
+	}
+	if err := s.RegisterRawTransportEndpoint(0, netProto, header.GREProtocolNumber, g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Options returns the options the tunnel was created with.
+func (g *GRE) Options() GREOptions {
+	return g.opts
+}
+
+// Close stops receiving the packets sent to the tunnel.
+func (g *GRE) Close() {
+	g.stack.UnregisterRawTransportEndpoint(0, g.netProto, header.GREProtocolNumber, g)
+}
+
+// MTU implements stack.LinkEndpoint.MTU.
+func (g *GRE) MTU() uint32 {
+	return g.mtu
+}
+
+// Capabilities implements stack.LinkEndpoint.Capabilities.
+func (*GRE) Capabilities() stack.LinkEndpointCapabilities {
+	return 0
+}
+
+// MaxHeaderLength implements stack.LinkEndpoint.MaxHeaderLength. The
+// encapsulation headers are prepended to a copy of the packet, so no room is
+// reserved for them.
+func (*GRE) MaxHeaderLength() uint16 {
+	return 0
+}
+
+// LinkAddress implements stack.LinkEndpoint.LinkAddress. GRE tunnels carry
+// network packets, so they have no link address.
+func (*GRE) LinkAddress() tcpip.LinkAddress {
+	return ""
+}
+
+// Attach implements stack.LinkEndpoint.Attach.
+func (g *GRE) Attach(dispatcher stack.NetworkDispatcher) {
+	g.dispatcher = dispatcher
+}
+
+// IsAttached implements stack.LinkEndpoint.IsAttached.
+func (g *GRE) IsAttached() bool {
+	return g.dispatcher != nil
+}
+
+// WritePacket implements stack.LinkEndpoint.WritePacket.
+func (g *GRE) WritePacket(r *stack.Route, gso *stack.GSO, hdr buffer.Prependable, payload buffer.VectorisedView, protocol tcpip.NetworkProtocolNumber) *tcpip.Error {
+	f := header.GREFields{
+		Protocol: protocol,
+		Key:      g.opts.OutputKey,
+		HasKey:   g.opts.HasOutputKey,
+	}
+	size := header.GRESize(&f)
+	v := packetView(size, hdr, payload)
+	header.GRE(v).Encode(&f)
+	return writeIP(g.stack, g.opts.NICID, g.opts.Local, g.opts.Remote, g.opts.TTL, header.GREProtocolNumber, v, false /* retry */)
+}
+
+// HandlePacket implements stack.RawTransportEndpoint.HandlePacket. It delivers
+// the packet encapsulated in the GRE packets received from the remote end.
+func (g *GRE) HandlePacket(r *stack.Route, netHeader buffer.View, vv buffer.VectorisedView) {
+	if g.dispatcher == nil {
+		return
+	}
+	if r.RemoteAddress != g.opts.Remote || (g.opts.Local != "" && r.LocalAddress != g.opts.Local) {
+		return
+	}
+
+	v := vv.ToView()
+	gre := header.GRE(v)
+	if !gre.IsValid() {
+		return
+	}
+	if gre.Flags()&header.GREFlagChecksum != 0 && header.Checksum(v, 0) != 0xffff {
+		return
+	}
+	if key, ok := gre.Key(); ok != g.opts.HasInputKey || (ok && key != g.opts.InputKey) {
+		return
+	}
+
+	proto := gre.Protocol()
+	if proto != header.IPv4ProtocolNumber && proto != header.IPv6ProtocolNumber {
+		return
+	}
+	g.dispatcher.DeliverNetworkPacket(g, "" /* remote */, "" /* local */, proto, buffer.View(gre.Payload()).ToVectorisedView())
+}
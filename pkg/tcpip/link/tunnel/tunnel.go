@@ -0,0 +1,95 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tunnel provides the implementation of GRE and VXLAN tunnels, link
+// endpoints which encapsulate the packets sent over them and send them to the
+// remote end of the tunnel through the networking stack they belong to.
+//
+// Tunnels can be used in the networking stack by calling NewGRE() or
+// NewVXLAN() to create a new tunnel, registering it with
+// stack.RegisterLinkEndpoint(), and then passing it as an argument to
+// Stack.CreateNIC(). GRE tunnels require the gre transport protocol to be
+// enabled on the stack, and VXLAN tunnels the udp one.
+package tunnel
+
+import (
+	"gvisor.googlesource.com/gvisor/pkg/sleep"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+)
+
+// underlayMTU is the MTU assumed for the links the tunneled packets are sent
+// over, to derive the default MTU of tunnels.
+const underlayMTU = 1500
+
+// netProtoOf returns the network protocol of addr.
+func netProtoOf(addr tcpip.Address) tcpip.NetworkProtocolNumber {
+	if len(addr) == header.IPv6AddressSize {
+		return header.IPv6ProtocolNumber
+	}
+	return header.IPv4ProtocolNumber
+}
+
+// writeIP sends data as the payload of a packet of transport protocol proto,
+// from local to remote. The packet is dropped if it would be sent over the NIC
+// nicID, the one of the tunnel, to not loop.
+//
+// If the link address of the next hop must be resolved, the packet is sent
+// once it is, without blocking.
+func writeIP(s *stack.Stack, nicID tcpip.NICID, local, remote tcpip.Address, ttl uint8, proto tcpip.TransportProtocolNumber, data buffer.View, retry bool) *tcpip.Error {
+	r, err := s.FindRoute(0, local, remote, netProtoOf(remote), false /* multicastLoop */)
+	if err != nil {
+		return err
+	}
+	defer r.Release()
+	if r.NICID() == nicID {
+		return tcpip.ErrNoRoute
+	}
+
+	if r.IsResolutionRequired() {
+		waker := &sleep.Waker{}
+		ch, err := r.Resolve(waker)
+		if err == tcpip.ErrWouldBlock && !retry {
+			r.RemoveWaker(waker)
+			go func() { // S/R-SAFE: netstack is not saved.
+				<-ch
+				writeIP(s, nicID, local, remote, ttl, proto, data, true)
+			}()
+			return nil
+		}
+		if err != nil {
+			r.RemoveWaker(waker)
+			return err
+		}
+	}
+
+	if ttl == 0 {
+		ttl = r.DefaultTTL()
+	}
+	hdr := buffer.NewPrependable(int(r.MaxHeaderLength()))
+	return r.WritePacket(nil /* gso */, hdr, data.ToVectorisedView(), proto, ttl)
+}
+
+// packetView returns the packet made of hdr and payload as a single view,
+// after size bytes left for the encapsulation headers.
+func packetView(size int, hdr buffer.Prependable, payload buffer.VectorisedView) buffer.View {
+	v := buffer.NewView(size + hdr.UsedLength() + payload.Size())
+	n := size + copy(v[size:], hdr.View())
+	for _, pv := range payload.Views() {
+		n += copy(v[n:], pv)
+	}
+	return v
+}
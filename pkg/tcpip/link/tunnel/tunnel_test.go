@@ -0,0 +1,298 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/channel"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/arp"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/gre"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+const (
+	underlayNIC = 1
+	tunnelNIC   = 2
+	testPort    = 1234
+)
+
+var (
+	underlayAddrs = []tcpip.Address{"\x0a\x00\x00\x01", "\x0a\x00\x00\x02"}
+	tunnelAddrs   = []tcpip.Address{"\xc0\xa8\x00\x01", "\xc0\xa8\x00\x02"}
+)
+
+// newStacks creates two stacks connected by their underlay NICs, whose packets
+// are forwarded from one to the other until done is closed.
+func newStacks(t *testing.T, done chan struct{}) [2]*stack.Stack {
+	t.Helper()
+	var stacks [2]*stack.Stack
+	var eps [2]*channel.Endpoint
+	for i := range stacks {
+		s := stack.New([]string{ipv4.ProtocolName, arp.ProtocolName}, []string{udp.ProtocolName, gre.ProtocolName}, stack.Options{})
+		id, ep := channel.New(256, underlayMTU, "")
+		if err := s.CreateNIC(underlayNIC, id); err != nil {
+			t.Fatalf("CreateNIC failed: %v", err)
+		}
+		if err := s.AddAddress(underlayNIC, ipv4.ProtocolNumber, underlayAddrs[i]); err != nil {
+			t.Fatalf("AddAddress failed: %v", err)
+		}
+		stacks[i], eps[i] = s, ep
+	}
+
+	for i := range eps {
+		go func(from, to *channel.Endpoint) {
+			for {
+				select {
+				case p := <-from.C:
+					v := append(append(buffer.View(nil), p.Header...), p.Payload...)
+					to.Inject(p.Proto, v.ToVectorisedView())
+				case <-done:
+					return
+				}
+			}
+		}(eps[i], eps[1-i])
+	}
+	return stacks
+}
+
+// addTunnel adds the tunnel ep to s, with the tunnel address of index i.
+func addTunnel(t *testing.T, s *stack.Stack, ep stack.LinkEndpoint, i int) {
+	t.Helper()
+	if err := s.CreateNIC(tunnelNIC, stack.RegisterLinkEndpoint(ep)); err != nil {
+		t.Fatalf("CreateNIC failed: %v", err)
+	}
+	if err := s.AddAddress(tunnelNIC, ipv4.ProtocolNumber, tunnelAddrs[i]); err != nil {
+		t.Fatalf("AddAddress failed: %v", err)
+	}
+	if err := s.AddAddress(tunnelNIC, arp.ProtocolNumber, arp.ProtocolAddress); err != nil {
+		t.Fatalf("AddAddress failed: %v", err)
+	}
+	s.SetRouteTable([]tcpip.Route{
+		{
+			Destination: "\xc0\xa8\x00\x00",
+			Mask:        "\xff\xff\xff\x00",
+			NIC:         tunnelNIC,
+		},
+		{
+			Destination: "\x0a\x00\x00\x00",
+			Mask:        "\xff\xff\xff\x00",
+			NIC:         underlayNIC,
+		},
+	})
+}
+
+// checkTunnel sends a datagram from the tunnel address of stacks[0] to the one
+// of stacks[1], and checks whether it is received.
+func checkTunnel(t *testing.T, stacks [2]*stack.Stack, wantReceived bool) {
+	t.Helper()
+	var wq waiter.Queue
+	rep, err := stacks[1].NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+	if err != nil {
+		t.Fatalf("NewEndpoint failed: %v", err)
+	}
+	defer rep.Close()
+	if err := rep.Bind(tcpip.FullAddress{Addr: tunnelAddrs[1], Port: testPort}); err != nil {
+		t.Fatalf("Bind failed: %v", err)
+	}
+	waitEntry, notifyCh := waiter.NewChannelEntry(nil)
+	wq.EventRegister(&waitEntry, waiter.EventIn)
+	defer wq.EventUnregister(&waitEntry)
+
+	sep, err := stacks[0].NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &waiter.Queue{})
+	if err != nil {
+		t.Fatalf("NewEndpoint failed: %v", err)
+	}
+	defer sep.Close()
+	payload := []byte("through the tunnel")
+	to := tcpip.FullAddress{Addr: tunnelAddrs[1], Port: testPort}
+	_, resCh, err := sep.Write(tcpip.SlicePayload(payload), tcpip.WriteOptions{To: &to})
+	if err == tcpip.ErrNoLinkAddress {
+		<-resCh
+		_, _, err = sep.Write(tcpip.SlicePayload(payload), tcpip.WriteOptions{To: &to})
+		if err == tcpip.ErrNoLinkAddress && !wantReceived {
+			// Nothing answered over the tunnel.
+			return
+		}
+	}
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	timeout := 5 * time.Second
+	if !wantReceived {
+		timeout = 100 * time.Millisecond
+	}
+	select {
+	case <-notifyCh:
+	case <-time.After(timeout):
+		if wantReceived {
+			t.Fatalf("Timed out waiting for the datagram")
+		}
+		return
+	}
+	var from tcpip.FullAddress
+	v, _, err := rep.Read(&from)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if !wantReceived {
+		t.Fatalf("Got datagram %q, want none", v)
+	}
+	if !bytes.Equal(v, payload) || from.Addr != tunnelAddrs[0] {
+		t.Fatalf("Got datagram %q from %v, want %q from %v", v, from.Addr, payload, tunnelAddrs[0])
+	}
+}
+
+func TestGRE(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		outputKey    uint32
+		hasOutputKey bool
+		inputKey     uint32
+		hasInputKey  bool
+		wantReceived bool
+	}{
+		{name: "no key", wantReceived: true},
+		{name: "key", outputKey: 42, hasOutputKey: true, inputKey: 42, hasInputKey: true, wantReceived: true},
+		{name: "wrong key", outputKey: 42, hasOutputKey: true, inputKey: 43, hasInputKey: true},
+		{name: "missing key", inputKey: 42, hasInputKey: true},
+		{name: "unexpected key", outputKey: 42, hasOutputKey: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			done := make(chan struct{})
+			defer close(done)
+			stacks := newStacks(t, done)
+			for i, s := range stacks {
+				opts := GREOptions{
+					NICID:  tunnelNIC,
+					Local:  underlayAddrs[i],
+					Remote: underlayAddrs[1-i],
+				}
+				if i == 0 {
+					opts.OutputKey, opts.HasOutputKey = test.outputKey, test.hasOutputKey
+				} else {
+					opts.InputKey, opts.HasInputKey = test.inputKey, test.hasInputKey
+				}
+				g, err := NewGRE(s, opts)
+				if err != nil {
+					t.Fatalf("NewGRE failed: %v", err)
+				}
+				defer g.Close()
+				addTunnel(t, s, g, i)
+			}
+			checkTunnel(t, stacks, test.wantReceived)
+		})
+	}
+}
+
+func TestGREMTU(t *testing.T) {
+	s := stack.New([]string{ipv4.ProtocolName}, []string{gre.ProtocolName}, stack.Options{})
+	for _, test := range []struct {
+		opts GREOptions
+		want uint32
+	}{
+		{GREOptions{Remote: underlayAddrs[1]}, 1476},
+		{GREOptions{Remote: underlayAddrs[1], HasOutputKey: true}, 1472},
+		{GREOptions{Remote: underlayAddrs[1], MTU: 1400}, 1400},
+	} {
+		g, err := NewGRE(s, test.opts)
+		if err != nil {
+			t.Fatalf("NewGRE failed: %v", err)
+		}
+		if got := g.MTU(); got != test.want {
+			t.Errorf("Got MTU %d with options %+v, want %d", got, test.opts, test.want)
+		}
+		g.Close()
+	}
+}
+
+func TestVXLAN(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		vnis         [2]uint32
+		learning     bool
+		wantReceived bool
+	}{
+		{name: "same VNI", vnis: [2]uint32{42, 42}, wantReceived: true},
+		{name: "same VNI learning", vnis: [2]uint32{42, 42}, learning: true, wantReceived: true},
+		{name: "different VNI", vnis: [2]uint32{42, 43}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			done := make(chan struct{})
+			defer close(done)
+			stacks := newStacks(t, done)
+			var tunnels [2]*VXLAN
+			for i, s := range stacks {
+				v, err := NewVXLAN(s, VXLANOptions{
+					NICID:    tunnelNIC,
+					VNI:      test.vnis[i],
+					Local:    underlayAddrs[i],
+					Remote:   underlayAddrs[1-i],
+					Learning: test.learning,
+				})
+				if err != nil {
+					t.Fatalf("NewVXLAN failed: %v", err)
+				}
+				defer v.Close()
+				addTunnel(t, s, v, i)
+				tunnels[i] = v
+			}
+			checkTunnel(t, stacks, test.wantReceived)
+
+			if test.learning {
+				src := tunnels[0].LinkAddress()
+				if got := tunnels[1].remoteOf(src); got != underlayAddrs[0] {
+					t.Errorf("Got remote %v for %v, want %v", got, src, underlayAddrs[0])
+				}
+			}
+		})
+	}
+}
+
+func TestVXLANOptions(t *testing.T) {
+	s := stack.New([]string{ipv4.ProtocolName}, []string{udp.ProtocolName}, stack.Options{})
+	v, err := NewVXLAN(s, VXLANOptions{VNI: 1})
+	if err != nil {
+		t.Fatalf("NewVXLAN failed: %v", err)
+	}
+	defer v.Close()
+	opts := v.Options()
+	if opts.Port != header.VXLANDefaultPort {
+		t.Errorf("Got port %d, want %d", opts.Port, header.VXLANDefaultPort)
+	}
+	if addr := opts.LinkAddress; len(addr) != header.EthernetAddressSize || addr[0]&0x03 != 0x02 {
+		t.Errorf("Got link address %v, want a unicast locally administered one", addr)
+	}
+	if got, want := v.MTU(), uint32(1450); got != want {
+		t.Errorf("Got MTU %d, want %d", got, want)
+	}
+
+	// The port is taken.
+	if _, err := NewVXLAN(s, VXLANOptions{VNI: 2}); err != tcpip.ErrPortInUse {
+		t.Errorf("Got NewVXLAN error %v, want %v", err, tcpip.ErrPortInUse)
+	}
+	if _, err := NewVXLAN(s, VXLANOptions{VNI: header.VXLANMaxVNI + 1, Port: 1}); err != tcpip.ErrInvalidOptionValue {
+		t.Errorf("Got NewVXLAN error %v, want %v", err, tcpip.ErrInvalidOptionValue)
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import (
+	"crypto/rand"
+	"sync"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+// VXLANOptions specify the configuration of a VXLAN tunnel.
+type VXLANOptions struct {
+	// NICID is the ID of the NIC the tunnel is attached to. Packets routed
+	// back over it once encapsulated are dropped.
+	NICID tcpip.NICID
+
+	// VNI is the VXLAN network identifier of the tunnel.
+	VNI uint32
+
+	// Local is the address the tunnel receives from and sends from, or
+	// empty to receive on all addresses and pick the source address from
+	// the route to the remote end.
+	Local tcpip.Address
+
+	// Remote is the address frames are sent to when their destination is
+	// not learned yet, or is a broadcast or multicast address. If empty,
+	// such frames are dropped.
+	Remote tcpip.Address
+
+	// Port is the UDP port the tunnel receives on and sends to, or zero
+	// to use the one assigned by IANA.
+	Port uint16
+
+	// TTL is the TTL of the encapsulating packets, or zero to use the
+	// default one of the route.
+	TTL uint8
+
+	// Learning is whether the address of the remote end of the frames
+	// received is learned from their source link address.
+	Learning bool
+
+	// MTU is the MTU of the tunnel, or zero to derive it from the size of
+	// the encapsulation headers.
+	MTU uint32
+
+	// LinkAddress is the link address of the tunnel, or empty to pick a
+	// random one.
+	LinkAddress tcpip.LinkAddress
+}
+
+// VXLAN is a VXLAN tunnel, carrying Ethernet frames over UDP as described in
+// RFC 7348.
+type VXLAN struct {
+	stack      *stack.Stack
+	opts       VXLANOptions
+	mtu        uint32
+	netProto   tcpip.NetworkProtocolNumber
+	ep         tcpip.Endpoint
+	wq         waiter.Queue
+	dispatcher stack.NetworkDispatcher
+
+	// mu protects fdb.
+	mu sync.Mutex
+
+	// fdb maps the link addresses learned to the address of the remote
+	// end they're behind.
+	fdb map[tcpip.LinkAddress]tcpip.Address
+}
+
+// NewVXLAN creates a VXLAN tunnel in the stack s, and starts receiving the
+// packets sent to it. It must be closed with Close once it is no longer used.
+func NewVXLAN(s *stack.Stack, opts VXLANOptions) (*VXLAN, *tcpip.Error) {
+	if opts.VNI > header.VXLANMaxVNI {
+		return nil, tcpip.ErrInvalidOptionValue
+	}
+	if opts.Port == 0 {
+		opts.Port = header.VXLANDefaultPort
+	}
+	netProto := header.IPv4ProtocolNumber
+	switch {
+	case opts.Remote != "":
+		netProto = netProtoOf(opts.Remote)
+		if opts.Local != "" && netProtoOf(opts.Local) != netProto {
+			return nil, tcpip.ErrInvalidEndpointState
+		}
+	case opts.Local != "":
+		netProto = netProtoOf(opts.Local)
+	}
+	if opts.LinkAddress == "" {
+		opts.LinkAddress = randomLinkAddress()
+	}
+	mtu := opts.MTU
+	if mtu == 0 {
+		mtu = underlayMTU - header.UDPMinimumSize - header.VXLANSize - header.EthernetMinimumSize
+		if netProto == header.IPv6ProtocolNumber {
+			mtu -= header.IPv6MinimumSize
+		} else {
+			mtu -= header.IPv4MinimumSize
+		}
+	}
+
+	v := &VXLAN{
+		stack:    s,
+		opts:     opts,
+		mtu:      mtu,
+		netProto: netProto,
+		fdb:      make(map[tcpip.LinkAddress]tcpip.Address),
+	}
+	ep, err := s.NewEndpoint(udp.ProtocolNumber, netProto, &v.wq)
+	if err != nil {
+		return nil, err
+	}
+	if err := ep.Bind(tcpip.FullAddress{Addr: opts.Local, Port: opts.Port}); err != nil {
+		ep.Close()
+		return nil, err
+	}
+	v.ep = ep
+	go v.receive() // S/R-SAFE: netstack is not saved.
+	return v, nil
+}
+
+// randomLinkAddress returns a random unicast, locally administered, MAC
+// address.
+func randomLinkAddress() tcpip.LinkAddress {
+	b := make([]byte, header.EthernetAddressSize)
+	rand.Read(b)
+	b[0] = b[0]&^0x01 | 0x02
+	return tcpip.LinkAddress(b)
+}
+
+// Options returns the options the tunnel was created with, with their default
+// values filled in.
+func (v *VXLAN) Options() VXLANOptions {
+	return v.opts
+}
+
+// Close stops receiving the packets sent to the tunnel, and releases its port.
+func (v *VXLAN) Close() {
+	v.ep.Close()
+}
+
+// MTU implements stack.LinkEndpoint.MTU.
+func (v *VXLAN) MTU() uint32 {
+	return v.mtu
+}
+
+// Capabilities implements stack.LinkEndpoint.Capabilities.
+func (*VXLAN) Capabilities() stack.LinkEndpointCapabilities {
+	return stack.CapabilityResolutionRequired
+}
+
+// MaxHeaderLength implements stack.LinkEndpoint.MaxHeaderLength. Only the
+// Ethernet header is reserved room for, the encapsulation headers are
+// prepended to a copy of the frame.
+func (*VXLAN) MaxHeaderLength() uint16 {
+	return header.EthernetMinimumSize
+}
+
+// LinkAddress implements stack.LinkEndpoint.LinkAddress.
+func (v *VXLAN) LinkAddress() tcpip.LinkAddress {
+	return v.opts.LinkAddress
+}
+
+// Attach implements stack.LinkEndpoint.Attach.
+func (v *VXLAN) Attach(dispatcher stack.NetworkDispatcher) {
+	v.dispatcher = dispatcher
+}
+
+// IsAttached implements stack.LinkEndpoint.IsAttached.
+func (v *VXLAN) IsAttached() bool {
+	return v.dispatcher != nil
+}
+
+// WritePacket implements stack.LinkEndpoint.WritePacket.
+func (v *VXLAN) WritePacket(r *stack.Route, gso *stack.GSO, hdr buffer.Prependable, payload buffer.VectorisedView, protocol tcpip.NetworkProtocolNumber) *tcpip.Error {
+	eth := header.Ethernet(hdr.Prepend(header.EthernetMinimumSize))
+	ethHdr := &header.EthernetFields{
+		DstAddr: r.RemoteLinkAddress,
+		Type:    protocol,
+	}
+
+	// Preserve the src address if it's set in the route.
+	if r.LocalLinkAddress != "" {
+		ethHdr.SrcAddr = r.LocalLinkAddress
+	} else {
+		ethHdr.SrcAddr = v.opts.LinkAddress
+	}
+	eth.Encode(ethHdr)
+
+	dst := v.remoteOf(r.RemoteLinkAddress)
+	if dst == "" {
+		// Nowhere to send the frame to.
+		return nil
+	}
+
+	b := packetView(header.VXLANSize, hdr, payload)
+	header.VXLAN(b).Encode(v.opts.VNI)
+	return v.send(b, dst, false /* retry */)
+}
+
+// remoteOf returns the address of the remote end the frames to linkAddr must
+// be sent to.
+func (v *VXLAN) remoteOf(linkAddr tcpip.LinkAddress) tcpip.Address {
+	if len(linkAddr) == header.EthernetAddressSize && linkAddr[0]&0x01 == 0 {
+		v.mu.Lock()
+		dst, ok := v.fdb[linkAddr]
+		v.mu.Unlock()
+		if ok {
+			return dst
+		}
+	}
+	return v.opts.Remote
+}
+
+// send sends the encapsulated frame b to the remote end dst. The frame is
+// dropped if it would be sent over the NIC of the tunnel, to not loop.
+func (v *VXLAN) send(b buffer.View, dst tcpip.Address, retry bool) *tcpip.Error {
+	r, err := v.stack.FindRoute(0, v.opts.Local, dst, v.netProto, false /* multicastLoop */)
+	if err != nil {
+		return err
+	}
+	nicID := r.NICID()
+	r.Release()
+	if nicID == v.opts.NICID {
+		return tcpip.ErrNoRoute
+	}
+
+	to := tcpip.FullAddress{Addr: dst, Port: v.opts.Port}
+	_, resCh, err := v.ep.Write(tcpip.SlicePayload(b), tcpip.WriteOptions{To: &to})
+	if err == tcpip.ErrNoLinkAddress && !retry {
+		// Send once the link address is resolved, without blocking.
+		go func() { // S/R-SAFE: netstack is not saved.
+			<-resCh
+			v.send(b, dst, true /* retry */)
+		}()
+		return nil
+	}
+	return err
+}
+
+// receive delivers the frames encapsulated in the packets received, until the
+// tunnel is closed.
+func (v *VXLAN) receive() {
+	waitEntry, notifyCh := waiter.NewChannelEntry(nil)
+	v.wq.EventRegister(&waitEntry, waiter.EventIn)
+	defer v.wq.EventUnregister(&waitEntry)
+
+	for {
+		var from tcpip.FullAddress
+		b, _, err := v.ep.Read(&from)
+		switch err {
+		case nil:
+			v.handlePacket(b, from.Addr)
+		case tcpip.ErrWouldBlock:
+			<-notifyCh
+		default:
+			return
+		}
+	}
+}
+
+// handlePacket delivers the frame encapsulated in the packet b received from
+// the remote end from.
+func (v *VXLAN) handlePacket(b buffer.View, from tcpip.Address) {
+	if v.dispatcher == nil || len(b) < header.VXLANSize+header.EthernetMinimumSize {
+		return
+	}
+	h := header.VXLAN(b)
+	if h.Flags()&header.VXLANFlagVNI == 0 || h.VNI() != v.opts.VNI {
+		return
+	}
+
+	eth := header.Ethernet(h.Payload())
+	src := eth.SourceAddress()
+	if src == v.opts.LinkAddress {
+		// Our own frame, looped back by a remote end.
+		return
+	}
+	if v.opts.Learning && src[0]&0x01 == 0 {
+		v.mu.Lock()
+		v.fdb[src] = from
+		v.mu.Unlock()
+	}
+	v.dispatcher.DeliverNetworkPacket(v, src, eth.DestinationAddress(), eth.Type(), buffer.View(eth[header.EthernetMinimumSize:]).ToVectorisedView())
+}
@@ -0,0 +1,109 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireguard
+
+import (
+	"fmt"
+	"sort"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+)
+
+// NewSubnet returns the subnet of addr with a prefix of prefixLen bits. The
+// host bits of addr are cleared, as wg(8) does for allowed IPs.
+func NewSubnet(addr tcpip.Address, prefixLen int) (tcpip.Subnet, error) {
+	if prefixLen < 0 || prefixLen > len(addr)*8 {
+		return tcpip.Subnet{}, fmt.Errorf("invalid prefix length %d for %v", prefixLen, addr)
+	}
+	mask := make([]byte, len(addr))
+	for i := range mask {
+		switch n := prefixLen - i*8; {
+		case n >= 8:
+			mask[i] = 0xff
+		case n > 0:
+			mask[i] = ^byte(0xff >> uint(n))
+		}
+	}
+	masked := make([]byte, len(addr))
+	for i := range masked {
+		masked[i] = addr[i] & mask[i]
+	}
+	return tcpip.NewSubnet(tcpip.Address(masked), tcpip.AddressMask(mask))
+}
+
+// allowedIP maps a subnet to the peer packets from and to it belong to.
+type allowedIP struct {
+	subnet tcpip.Subnet
+	peer   *peer
+}
+
+// allowedIPs is the cryptokey routing table of a device: it maps the
+// addresses of the packets sent to the peer they are sent to, and those of
+// the packets received to the peer they must come from.
+//
+// Entries are sorted by decreasing prefix length, so that the first match of
+// an address is its longest prefix match.
+type allowedIPs struct {
+	entries []allowedIP
+}
+
+// insert maps subnet to p, replacing the peer it was mapped to.
+func (a *allowedIPs) insert(subnet tcpip.Subnet, p *peer) {
+	for i := range a.entries {
+		if e := &a.entries[i]; e.subnet == subnet {
+			e.peer = p
+			return
+		}
+	}
+	a.entries = append(a.entries, allowedIP{subnet: subnet, peer: p})
+	sort.SliceStable(a.entries, func(i, j int) bool {
+		return a.entries[i].subnet.Prefix() > a.entries[j].subnet.Prefix()
+	})
+}
+
+// removePeer removes all subnets mapped to p.
+func (a *allowedIPs) removePeer(p *peer) {
+	entries := a.entries[:0]
+	for _, e := range a.entries {
+		if e.peer != p {
+			entries = append(entries, e)
+		}
+	}
+	for i := len(entries); i < len(a.entries); i++ {
+		a.entries[i] = allowedIP{}
+	}
+	a.entries = entries
+}
+
+// lookup returns the peer addr is mapped to, or nil.
+func (a *allowedIPs) lookup(addr tcpip.Address) *peer {
+	for i := range a.entries {
+		if e := &a.entries[i]; e.subnet.Contains(addr) {
+			return e.peer
+		}
+	}
+	return nil
+}
+
+// subnets returns the subnets mapped to p.
+func (a *allowedIPs) subnets(p *peer) []tcpip.Subnet {
+	var subnets []tcpip.Subnet
+	for _, e := range a.entries {
+		if e.peer == p {
+			subnets = append(subnets, e.subnet)
+		}
+	}
+	return subnets
+}
@@ -0,0 +1,183 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireguard
+
+import (
+	"errors"
+	"sync"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+// Bind is the UDP transport over which a device exchanges its messages with
+// its peers.
+type Bind interface {
+	// Open binds to port, or to a random port if it is zero, and returns
+	// the port bound. Datagrams received are passed to recv, until the
+	// Bind is closed.
+	Open(port uint16, recv func(b []byte, from tcpip.FullAddress)) (uint16, error)
+
+	// Close stops receiving datagrams, and releases the port.
+	Close()
+
+	// Send sends the datagram b to to. It must not block.
+	Send(b []byte, to tcpip.FullAddress) error
+}
+
+// StackBind is a Bind over the UDP endpoints of a stack, for devices which
+// tunnel over the stack they are attached to.
+type StackBind struct {
+	stack *stack.Stack
+
+	mu  sync.Mutex
+	eps map[tcpip.NetworkProtocolNumber]*stackBindEndpoint
+}
+
+// stackBindEndpoint is a UDP endpoint of a StackBind.
+type stackBindEndpoint struct {
+	ep tcpip.Endpoint
+	wq waiter.Queue
+}
+
+// NewStackBind returns a Bind over the UDP endpoints of s.
+func NewStackBind(s *stack.Stack) *StackBind {
+	return &StackBind{stack: s}
+}
+
+// Open implements Bind.Open. It binds to port over IPv4, and over IPv6 if s
+// supports it.
+func (b *StackBind) Open(port uint16, recv func(b []byte, from tcpip.FullAddress)) (uint16, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.eps != nil {
+		return 0, errors.New("bind already open")
+	}
+	eps := make(map[tcpip.NetworkProtocolNumber]*stackBindEndpoint)
+	for _, proto := range []tcpip.NetworkProtocolNumber{ipv4.ProtocolNumber, ipv6.ProtocolNumber} {
+		if !b.stack.CheckNetworkProtocol(proto) {
+			continue
+		}
+		e := &stackBindEndpoint{}
+		ep, err := b.stack.NewEndpoint(udp.ProtocolNumber, proto, &e.wq)
+		if err != nil {
+			closeStackBindEndpoints(eps)
+			return 0, errors.New(err.String())
+		}
+		if proto == ipv6.ProtocolNumber {
+			// IPv4 is served by its own endpoint.
+			if err := ep.SetSockOpt(tcpip.V6OnlyOption(1)); err != nil {
+				ep.Close()
+				closeStackBindEndpoints(eps)
+				return 0, errors.New(err.String())
+			}
+		}
+		if err := ep.Bind(tcpip.FullAddress{Port: port}); err != nil {
+			ep.Close()
+			closeStackBindEndpoints(eps)
+			return 0, errors.New(err.String())
+		}
+		if port == 0 {
+			// Bind the other endpoints to the port picked for the
+			// first one.
+			addr, err := ep.GetLocalAddress()
+			if err != nil {
+				ep.Close()
+				closeStackBindEndpoints(eps)
+				return 0, errors.New(err.String())
+			}
+			port = addr.Port
+		}
+		e.ep = ep
+		eps[proto] = e
+	}
+	if len(eps) == 0 {
+		return 0, errors.New("no IP protocol")
+	}
+
+	for _, e := range eps {
+		go e.receive(recv) // S/R-SAFE: netstack is not saved.
+	}
+	b.eps = eps
+	return port, nil
+}
+
+// Close implements Bind.Close.
+func (b *StackBind) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	closeStackBindEndpoints(b.eps)
+	b.eps = nil
+}
+
+func closeStackBindEndpoints(eps map[tcpip.NetworkProtocolNumber]*stackBindEndpoint) {
+	for _, e := range eps {
+		e.ep.Close()
+	}
+}
+
+// Send implements Bind.Send.
+func (b *StackBind) Send(buf []byte, to tcpip.FullAddress) error {
+	proto := ipv4.ProtocolNumber
+	if len(to.Addr) == 16 {
+		proto = ipv6.ProtocolNumber
+	}
+	b.mu.Lock()
+	e := b.eps[proto]
+	b.mu.Unlock()
+	if e == nil {
+		return errors.New("bind not open")
+	}
+
+	_, resCh, err := e.ep.Write(tcpip.SlicePayload(buf), tcpip.WriteOptions{To: &to})
+	if err == tcpip.ErrNoLinkAddress {
+		// Send once the link address is resolved, without blocking.
+		buf = append([]byte(nil), buf...)
+		go func() { // S/R-SAFE: netstack is not saved.
+			<-resCh
+			e.ep.Write(tcpip.SlicePayload(buf), tcpip.WriteOptions{To: &to})
+		}()
+		return nil
+	}
+	if err != nil {
+		return errors.New(err.String())
+	}
+	return nil
+}
+
+// receive passes the datagrams received by e to recv, until e is closed.
+func (e *stackBindEndpoint) receive(recv func(b []byte, from tcpip.FullAddress)) {
+	waitEntry, notifyCh := waiter.NewChannelEntry(nil)
+	e.wq.EventRegister(&waitEntry, waiter.EventIn)
+	defer e.wq.EventUnregister(&waitEntry)
+
+	for {
+		var from tcpip.FullAddress
+		v, _, err := e.ep.Read(&from)
+		switch err {
+		case nil:
+			recv(v, from)
+		case tcpip.ErrWouldBlock:
+			<-notifyCh
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireguard
+
+import (
+	"crypto/cipher"
+	"time"
+)
+
+const (
+	replayBlockBits  = 64
+	replayRingBlocks = 32
+
+	// replayWindowSize is the number of counters below the greatest one
+	// received which are still accepted, if not received already.
+	replayWindowSize = (replayRingBlocks - 1) * replayBlockBits
+)
+
+// replayFilter rejects the counters of transport messages which were received
+// already or which are too old, as described in RFC 6479.
+type replayFilter struct {
+	last uint64
+	ring [replayRingBlocks]uint64
+}
+
+// validate returns whether counter was not received yet and is in the window,
+// and then marks it received. Counters not below limit are rejected.
+func (f *replayFilter) validate(counter, limit uint64) bool {
+	if counter >= limit {
+		return false
+	}
+	block := counter / replayBlockBits
+	if counter > f.last {
+		// Move the window forward, clearing the blocks it enters.
+		current := f.last / replayBlockBits
+		diff := block - current
+		if diff > replayRingBlocks {
+			diff = replayRingBlocks
+		}
+		for i := current + 1; i <= current+diff; i++ {
+			f.ring[i%replayRingBlocks] = 0
+		}
+		f.last = counter
+	} else if f.last-counter > replayWindowSize {
+		return false
+	}
+
+	bit := uint64(1) << (counter % replayBlockBits)
+	b := &f.ring[block%replayRingBlocks]
+	if *b&bit != 0 {
+		return false
+	}
+	*b |= bit
+	return true
+}
+
+// keypair holds the transport keys derived from a handshake. It is protected
+// by the mutex of its peer.
+type keypair struct {
+	send cipher.AEAD
+	recv cipher.AEAD
+
+	// sendCounter is the counter of the next message sent.
+	sendCounter uint64
+	replay      replayFilter
+
+	created   time.Time
+	initiator bool
+
+	localIndex  uint32
+	remoteIndex uint32
+}
+
+// canSend returns whether kp may still be used to send at now.
+func (kp *keypair) canSend(now time.Time) bool {
+	return kp != nil && now.Sub(kp.created) < rejectAfterTime && kp.sendCounter < rejectAfterMessages
+}
+
+// canReceive returns whether kp may still be used to receive at now.
+func (kp *keypair) canReceive(now time.Time) bool {
+	return kp != nil && now.Sub(kp.created) < rejectAfterTime
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireguard
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// KeySize is the size of the keys of WireGuard, in bytes.
+const KeySize = 32
+
+// Key is a Curve25519 private or public key, or a symmetric preshared key.
+type Key [KeySize]byte
+
+// GeneratePrivateKey returns a new random private key.
+func GeneratePrivateKey() (Key, error) {
+	var k Key
+	if _, err := rand.Read(k[:]); err != nil {
+		return Key{}, err
+	}
+	k.clamp()
+	return k, nil
+}
+
+// clamp clamps the private key k as Curve25519 requires.
+func (k *Key) clamp() {
+	k[0] &= 248
+	k[31] = (k[31] & 127) | 64
+}
+
+// PublicKey returns the public key of the private key k.
+func (k Key) PublicKey() Key {
+	var pub Key
+	priv := [KeySize]byte(k)
+	curve25519.ScalarBaseMult((*[KeySize]byte)(&pub), &priv)
+	return pub
+}
+
+// IsZero returns whether k is all zeroes, which stands for no key.
+func (k Key) IsZero() bool {
+	var zero Key
+	return k.Equal(zero)
+}
+
+// Equal returns whether k and o are equal, in constant time.
+func (k Key) Equal(o Key) bool {
+	return subtle.ConstantTimeCompare(k[:], o[:]) == 1
+}
+
+// String returns k in base64, as wg(8) prints keys.
+func (k Key) String() string {
+	return base64.StdEncoding.EncodeToString(k[:])
+}
+
+// Hex returns k in hexadecimal, as the UAPI encodes keys.
+func (k Key) Hex() string {
+	return hex.EncodeToString(k[:])
+}
+
+// ParseKey parses a key in base64.
+func ParseKey(s string) (Key, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return Key{}, fmt.Errorf("invalid key %q: %v", s, err)
+	}
+	return keyFromBytes(b)
+}
+
+// ParseHexKey parses a key in hexadecimal.
+func ParseHexKey(s string) (Key, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return Key{}, fmt.Errorf("invalid key %q: %v", s, err)
+	}
+	return keyFromBytes(b)
+}
+
+func keyFromBytes(b []byte) (Key, error) {
+	var k Key
+	if len(b) != KeySize {
+		return Key{}, fmt.Errorf("invalid key size %d, want %d", len(b), KeySize)
+	}
+	copy(k[:], b)
+	return k, nil
+}
+
+// sharedSecret returns the Diffie-Hellman shared secret of the private key
+// priv and the public key pub. It returns false if the result is all
+// zeroes, i.e., pub is a low order point.
+func sharedSecret(priv, pub Key) (Key, bool) {
+	var ss Key
+	p, q := [KeySize]byte(priv), [KeySize]byte(pub)
+	curve25519.ScalarMult((*[KeySize]byte)(&ss), &p, &q)
+	return ss, !ss.IsZero()
+}
@@ -0,0 +1,464 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireguard
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"time"
+
+	"golang.org/x/crypto/blake2s"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Message types.
+const (
+	messageInitiationType  = 1
+	messageResponseType    = 2
+	messageCookieReplyType = 3
+	messageTransportType   = 4
+)
+
+// Message sizes and offsets.
+const (
+	messageInitiationSize      = 148
+	messageResponseSize        = 92
+	messageCookieReplySize     = 64
+	messageTransportHeaderSize = 16
+	messageKeepaliveSize       = messageTransportHeaderSize + chacha20poly1305.Overhead
+
+	macSize       = 16
+	timestampSize = 12
+	cookieSize    = 16
+	nonceSize     = 24
+
+	// Offsets within a handshake initiation message.
+	initiationSender    = 4
+	initiationEphemeral = 8
+	initiationStatic    = 40
+	initiationTimestamp = 88
+	initiationMAC1      = 116
+	initiationMAC2      = 132
+
+	// Offsets within a handshake response message.
+	responseSender    = 4
+	responseReceiver  = 8
+	responseEphemeral = 12
+	responseEmpty     = 44
+	responseMAC1      = 60
+	responseMAC2      = 76
+
+	// Offsets within a cookie reply message.
+	cookieReceiver  = 4
+	cookieNonce     = 8
+	cookieEncrypted = 32
+
+	// Offsets within a transport message.
+	transportReceiver = 4
+	transportCounter  = 8
+	transportContent  = 16
+)
+
+var (
+	construction = []byte("Noise_IKpsk2_25519_ChaChaPoly_BLAKE2s")
+	identifier   = []byte("WireGuard v1 zx2c4 Jason@zx2c4.com")
+	labelMAC1    = []byte("mac1----")
+	labelCookie  = []byte("cookie--")
+
+	// initialChainKey and initialHash are the chaining key and the hash
+	// every handshake starts from.
+	initialChainKey = blake2s.Sum256(construction)
+	initialHash     = mixHash(initialChainKey, identifier)
+)
+
+var (
+	errInvalidMessage = errors.New("invalid handshake message")
+	errInvalidMAC     = errors.New("invalid handshake MAC")
+	errUnknownPeer    = errors.New("handshake from unknown peer")
+	errReplay         = errors.New("replayed handshake initiation")
+	errFlood          = errors.New("handshake initiations too frequent")
+)
+
+// handshakeState is the state of the handshake with a peer.
+type handshakeState int
+
+const (
+	handshakeZeroed handshakeState = iota
+	handshakeInitiationCreated
+	handshakeInitiationConsumed
+	handshakeResponseCreated
+	handshakeResponseConsumed
+)
+
+// handshake holds the state of the handshake with a peer. It is protected by
+// the mutex of the peer.
+type handshake struct {
+	state     handshakeState
+	hash      [blake2s.Size]byte
+	chainKey  [blake2s.Size]byte
+	ephemeral Key // Private.
+
+	remoteEphemeral Key
+	localIndex      uint32
+	remoteIndex     uint32
+
+	// precomputedStaticStatic is the shared secret of the static keys of
+	// the device and the peer.
+	precomputedStaticStatic Key
+
+	// lastTimestamp is the greatest timestamp of the initiations received,
+	// and lastInitiationConsumption the time the last one was received.
+	lastTimestamp             [timestampSize]byte
+	lastInitiationConsumption time.Time
+}
+
+// clear wipes the keys of the handshake, but keeps the replay protection.
+func (h *handshake) clear() {
+	h.state = handshakeZeroed
+	h.hash = [blake2s.Size]byte{}
+	h.chainKey = [blake2s.Size]byte{}
+	h.ephemeral = Key{}
+	h.remoteEphemeral = Key{}
+	h.localIndex = 0
+	h.remoteIndex = 0
+}
+
+func newBlake2s() hash.Hash {
+	h, _ := blake2s.New256(nil)
+	return h
+}
+
+// mixHash returns HASH(h || data).
+func mixHash(h [blake2s.Size]byte, data []byte) [blake2s.Size]byte {
+	d := newBlake2s()
+	d.Write(h[:])
+	d.Write(data)
+	var out [blake2s.Size]byte
+	d.Sum(out[:0])
+	return out
+}
+
+// hmacBlake2s returns HMAC-BLAKE2s(key, data...).
+func hmacBlake2s(key []byte, data ...[]byte) [blake2s.Size]byte {
+	m := hmac.New(newBlake2s, key)
+	for _, d := range data {
+		m.Write(d)
+	}
+	var out [blake2s.Size]byte
+	m.Sum(out[:0])
+	return out
+}
+
+// kdf derives len(outs) keys from the chaining key and the input, as the
+// HKDF of the Noise protocol.
+func kdf(chainKey [blake2s.Size]byte, input []byte, outs ...*[blake2s.Size]byte) {
+	prk := hmacBlake2s(chainKey[:], input)
+	var prev []byte
+	for i, out := range outs {
+		*out = hmacBlake2s(prk[:], prev, []byte{byte(i + 1)})
+		prev = out[:]
+	}
+}
+
+// mac returns the keyed BLAKE2s-128 of data with key.
+func mac(key []byte, data []byte) [macSize]byte {
+	h, _ := blake2s.New128(key)
+	h.Write(data)
+	var out [macSize]byte
+	h.Sum(out[:0])
+	return out
+}
+
+// newAEAD returns the ChaCha20-Poly1305 AEAD of key.
+func newAEAD(key [blake2s.Size]byte) cipher.AEAD {
+	a, err := chacha20poly1305.New(key[:])
+	if err != nil {
+		// Only possible with a key of the wrong size.
+		panic(err)
+	}
+	return a
+}
+
+// counterNonce returns the nonce of the AEAD with counter.
+func counterNonce(counter uint64) []byte {
+	var nonce [chacha20poly1305.NonceSize]byte
+	binary.LittleEndian.PutUint64(nonce[4:], counter)
+	return nonce[:]
+}
+
+// timestamp returns the TAI64N timestamp of t.
+func timestamp(t time.Time) [timestampSize]byte {
+	var ts [timestampSize]byte
+	const base = uint64(0x400000000000000a)
+	binary.BigEndian.PutUint64(ts[0:], base+uint64(t.Unix()))
+	binary.BigEndian.PutUint32(ts[8:], uint32(t.Nanosecond()))
+	return ts
+}
+
+// createInitiation fills msg, of size messageInitiationSize, with a new
+// handshake initiation to peer p, from the device whose static public key is
+// pub. The sender index is hs.localIndex, and the MACs are left to the
+// caller.
+//
+// Preconditions: p.mu must be locked.
+func (p *peer) createInitiation(pub Key, msg []byte) error {
+	hs := &p.handshake
+	if hs.precomputedStaticStatic.IsZero() {
+		return errInvalidMessage
+	}
+	eph, err := GeneratePrivateKey()
+	if err != nil {
+		return err
+	}
+
+	hs.chainKey = initialChainKey
+	hs.hash = mixHash(initialHash, p.publicKey[:])
+	hs.ephemeral = eph
+
+	msg[0] = messageInitiationType
+	binary.LittleEndian.PutUint32(msg[initiationSender:], hs.localIndex)
+	ephPub := eph.PublicKey()
+	copy(msg[initiationEphemeral:], ephPub[:])
+	kdf(hs.chainKey, ephPub[:], &hs.chainKey)
+	hs.hash = mixHash(hs.hash, ephPub[:])
+
+	// Encrypt the static key of the device.
+	var key [blake2s.Size]byte
+	ss, ok := sharedSecret(eph, p.publicKey)
+	if !ok {
+		return errInvalidMessage
+	}
+	kdf(hs.chainKey, ss[:], &hs.chainKey, &key)
+	static := newAEAD(key).Seal(msg[initiationStatic:initiationStatic], counterNonce(0), pub[:], hs.hash[:])
+	hs.hash = mixHash(hs.hash, static)
+
+	// Encrypt the timestamp.
+	kdf(hs.chainKey, hs.precomputedStaticStatic[:], &hs.chainKey, &key)
+	ts := timestamp(time.Now())
+	encTS := newAEAD(key).Seal(msg[initiationTimestamp:initiationTimestamp], counterNonce(0), ts[:], hs.hash[:])
+	hs.hash = mixHash(hs.hash, encTS)
+
+	hs.state = handshakeInitiationCreated
+	return nil
+}
+
+// consumeInitiation processes the handshake initiation msg received by the
+// device whose static keys are priv and pub. It returns the static key of the
+// initiator, its timestamp, and the state of the handshake to be installed in
+// its peer with installInitiation.
+func consumeInitiation(priv, pub Key, msg []byte) (Key, [timestampSize]byte, handshake, error) {
+	var (
+		hs     handshake
+		ts     [timestampSize]byte
+		static Key
+		key    [blake2s.Size]byte
+	)
+
+	hs.chainKey = initialChainKey
+	hs.hash = mixHash(initialHash, pub[:])
+
+	copy(hs.remoteEphemeral[:], msg[initiationEphemeral:])
+	kdf(hs.chainKey, hs.remoteEphemeral[:], &hs.chainKey)
+	hs.hash = mixHash(hs.hash, hs.remoteEphemeral[:])
+
+	// Decrypt the static key of the initiator.
+	ss, ok := sharedSecret(priv, hs.remoteEphemeral)
+	if !ok {
+		return Key{}, ts, hs, errInvalidMessage
+	}
+	kdf(hs.chainKey, ss[:], &hs.chainKey, &key)
+	encStatic := msg[initiationStatic:initiationTimestamp]
+	if _, err := newAEAD(key).Open(static[:0], counterNonce(0), encStatic, hs.hash[:]); err != nil {
+		return Key{}, ts, hs, errInvalidMessage
+	}
+	hs.hash = mixHash(hs.hash, encStatic)
+
+	// Decrypt the timestamp.
+	ss, ok = sharedSecret(priv, static)
+	if !ok {
+		return Key{}, ts, hs, errInvalidMessage
+	}
+	kdf(hs.chainKey, ss[:], &hs.chainKey, &key)
+	encTS := msg[initiationTimestamp:initiationMAC1]
+	if _, err := newAEAD(key).Open(ts[:0], counterNonce(0), encTS, hs.hash[:]); err != nil {
+		return Key{}, ts, hs, errInvalidMessage
+	}
+	hs.hash = mixHash(hs.hash, encTS)
+
+	hs.remoteIndex = binary.LittleEndian.Uint32(msg[initiationSender:])
+	hs.state = handshakeInitiationConsumed
+	return static, ts, hs, nil
+}
+
+// installInitiation installs in peer p the state hs of the handshake consumed
+// from an initiation with timestamp ts. The local index of the handshake is
+// left to the caller.
+//
+// Preconditions: p.mu must be locked.
+func (p *peer) installInitiation(hs handshake, ts [timestampSize]byte, now time.Time) error {
+	old := &p.handshake
+	if bytes.Compare(ts[:], old.lastTimestamp[:]) <= 0 {
+		return errReplay
+	}
+	if now.Sub(old.lastInitiationConsumption) < handshakeInitiationRate {
+		return errFlood
+	}
+
+	hs.precomputedStaticStatic = old.precomputedStaticStatic
+	hs.lastTimestamp = ts
+	hs.lastInitiationConsumption = now
+	*old = hs
+	return nil
+}
+
+// createResponse fills msg, of size messageResponseSize, with the handshake
+// response to the initiation consumed from peer p. The MACs are left to the
+// caller.
+//
+// Preconditions: p.mu must be locked, and the handshake must be in state
+// handshakeInitiationConsumed.
+func (p *peer) createResponse(msg []byte) error {
+	hs := &p.handshake
+	eph, err := GeneratePrivateKey()
+	if err != nil {
+		return err
+	}
+	hs.ephemeral = eph
+
+	msg[0] = messageResponseType
+	binary.LittleEndian.PutUint32(msg[responseSender:], hs.localIndex)
+	binary.LittleEndian.PutUint32(msg[responseReceiver:], hs.remoteIndex)
+	ephPub := eph.PublicKey()
+	copy(msg[responseEphemeral:], ephPub[:])
+	kdf(hs.chainKey, ephPub[:], &hs.chainKey)
+	hs.hash = mixHash(hs.hash, ephPub[:])
+
+	ss, ok := sharedSecret(eph, hs.remoteEphemeral)
+	if !ok {
+		return errInvalidMessage
+	}
+	kdf(hs.chainKey, ss[:], &hs.chainKey)
+	ss, ok = sharedSecret(eph, p.publicKey)
+	if !ok {
+		return errInvalidMessage
+	}
+	kdf(hs.chainKey, ss[:], &hs.chainKey)
+
+	// Mix the preshared key in, and encrypt nothing.
+	var tau, key [blake2s.Size]byte
+	kdf(hs.chainKey, p.presharedKey[:], &hs.chainKey, &tau, &key)
+	hs.hash = mixHash(hs.hash, tau[:])
+	empty := newAEAD(key).Seal(msg[responseEmpty:responseEmpty], counterNonce(0), nil, hs.hash[:])
+	hs.hash = mixHash(hs.hash, empty)
+
+	hs.state = handshakeResponseCreated
+	return nil
+}
+
+// consumeResponse processes the handshake response msg received from peer p
+// by the device whose static private key is priv.
+//
+// Preconditions: p.mu must be locked.
+func (p *peer) consumeResponse(priv Key, msg []byte) error {
+	hs := &p.handshake
+	if hs.state != handshakeInitiationCreated || binary.LittleEndian.Uint32(msg[responseReceiver:]) != hs.localIndex {
+		return errInvalidMessage
+	}
+
+	// Work on copies, so that an invalid response doesn't clobber the
+	// handshake.
+	hash, chainKey := hs.hash, hs.chainKey
+	var remoteEphemeral Key
+	copy(remoteEphemeral[:], msg[responseEphemeral:])
+	kdf(chainKey, remoteEphemeral[:], &chainKey)
+	hash = mixHash(hash, remoteEphemeral[:])
+
+	ss, ok := sharedSecret(hs.ephemeral, remoteEphemeral)
+	if !ok {
+		return errInvalidMessage
+	}
+	kdf(chainKey, ss[:], &chainKey)
+	ss, ok = sharedSecret(priv, remoteEphemeral)
+	if !ok {
+		return errInvalidMessage
+	}
+	kdf(chainKey, ss[:], &chainKey)
+
+	var tau, key [blake2s.Size]byte
+	kdf(chainKey, p.presharedKey[:], &chainKey, &tau, &key)
+	hash = mixHash(hash, tau[:])
+	empty := msg[responseEmpty:responseMAC1]
+	if _, err := newAEAD(key).Open(nil, counterNonce(0), empty, hash[:]); err != nil {
+		return errInvalidMessage
+	}
+	hash = mixHash(hash, empty)
+
+	hs.hash, hs.chainKey = hash, chainKey
+	hs.remoteEphemeral = remoteEphemeral
+	hs.remoteIndex = binary.LittleEndian.Uint32(msg[responseSender:])
+	hs.state = handshakeResponseConsumed
+	return nil
+}
+
+// deriveKeypair derives the transport keys from the completed handshake, and
+// clears it.
+//
+// Preconditions: p.mu must be locked, and the handshake must be in state
+// handshakeResponseCreated or handshakeResponseConsumed.
+func (p *peer) deriveKeypair(now time.Time) *keypair {
+	hs := &p.handshake
+	initiator := hs.state == handshakeResponseConsumed
+
+	var send, recv [blake2s.Size]byte
+	if initiator {
+		kdf(hs.chainKey, nil, &send, &recv)
+	} else {
+		kdf(hs.chainKey, nil, &recv, &send)
+	}
+	kp := &keypair{
+		send:        newAEAD(send),
+		recv:        newAEAD(recv),
+		created:     now,
+		initiator:   initiator,
+		localIndex:  hs.localIndex,
+		remoteIndex: hs.remoteIndex,
+	}
+	hs.clear()
+	return kp
+}
+
+// labelHash returns HASH(label || pub): the key of the first MAC of the
+// handshake messages sent to the holder of the static public key pub with
+// labelMAC1, and the key of the cookies it sends with labelCookie.
+func labelHash(label []byte, pub Key) [blake2s.Size]byte {
+	d := newBlake2s()
+	d.Write(label)
+	d.Write(pub[:])
+	var out [blake2s.Size]byte
+	d.Sum(out[:0])
+	return out
+}
+
+// checkMAC1 returns whether the first MAC of a handshake message msg, received
+// by the holder of the static public key pub, is valid.
+func checkMAC1(pub Key, msg, mac1 []byte) bool {
+	key := labelHash(labelMAC1, pub)
+	want := mac(key[:], msg)
+	return hmac.Equal(want[:], mac1)
+}
@@ -0,0 +1,475 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireguard
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+)
+
+// peerTimer is a timer of a peer. Its function is called with the locks of
+// the device and the peer held, unless the timer was stopped in the meantime.
+type peerTimer struct {
+	t       *time.Timer
+	pending bool
+}
+
+// peer is a peer of a device.
+type peer struct {
+	device    *Device
+	publicKey Key
+
+	// mu protects the following fields.
+	mu                  sync.Mutex
+	removed             bool
+	presharedKey        Key
+	endpoint            tcpip.FullAddress
+	hasEndpoint         bool
+	persistentKeepalive time.Duration
+
+	handshake handshake
+
+	// lastHandshakeSent is the time the last initiation was sent, and
+	// handshakeAttempts the number of initiations sent since the handshake
+	// was started.
+	lastHandshakeSent time.Time
+	handshakeAttempts int
+
+	// lastHandshake is the time the last handshake was completed.
+	lastHandshake time.Time
+
+	// current is the keypair the packets are sent with. previous is the
+	// keypair it replaced, and next the keypair derived by a handshake the
+	// peer initiated, until the peer sends with it.
+	previous *keypair
+	current  *keypair
+	next     *keypair
+
+	// staged holds the packets waiting for a handshake to complete.
+	staged [][]byte
+
+	// cookie is the cookie received from the peer under load, and
+	// lastMAC1 the first MAC of the last handshake message sent to it.
+	cookie     [cookieSize]byte
+	cookieTime time.Time
+	lastMAC1   [macSize]byte
+
+	rxBytes uint64
+	txBytes uint64
+
+	retransmitHandshake peerTimer
+	sendKeepalive       peerTimer
+	newHandshake        peerTimer
+	persistentTimer     peerTimer
+}
+
+// newPeer returns a new peer of d with the static public key pub.
+//
+// Preconditions: d.mu must be locked for writing.
+func newPeer(d *Device, pub Key) *peer {
+	p := &peer{
+		device:    d,
+		publicKey: pub,
+	}
+	p.handshake.precomputedStaticStatic, _ = sharedSecret(d.privateKey, pub)
+	p.initTimer(&p.retransmitHandshake, (*peer).retransmitHandshakeLocked)
+	p.initTimer(&p.sendKeepalive, (*peer).keepaliveLocked)
+	p.initTimer(&p.newHandshake, func(p *peer, now time.Time) []outgoing {
+		return p.initiateHandshakeLocked(now, false)
+	})
+	p.initTimer(&p.persistentTimer, (*peer).keepaliveLocked)
+	return p
+}
+
+// initTimer initializes the timer t of p, which calls f.
+func (p *peer) initTimer(t *peerTimer, f func(p *peer, now time.Time) []outgoing) {
+	t.t = time.AfterFunc(time.Hour, func() {
+		d := p.device
+		d.mu.RLock()
+		p.mu.Lock()
+		var out []outgoing
+		if t.pending && !p.removed {
+			t.pending = false
+			out = f(p, time.Now())
+		}
+		p.mu.Unlock()
+		d.mu.RUnlock()
+
+		d.transmit(out)
+	})
+	t.t.Stop()
+}
+
+// reset arms the timer t to fire after d.
+func (t *peerTimer) reset(d time.Duration) {
+	t.pending = true
+	t.t.Reset(d)
+}
+
+// stop disarms the timer t.
+func (t *peerTimer) stop() {
+	t.pending = false
+	t.t.Stop()
+}
+
+// stopTimersLocked disarms all timers of p.
+//
+// Preconditions: p.mu must be locked.
+func (p *peer) stopTimersLocked() {
+	for _, t := range []*peerTimer{&p.retransmitHandshake, &p.sendKeepalive, &p.newHandshake, &p.persistentTimer} {
+		t.stop()
+	}
+}
+
+// sentLocked updates the timers of p after an authenticated message was sent,
+// carrying data if data is true.
+//
+// Preconditions: p.mu must be locked.
+func (p *peer) sentLocked(data bool) {
+	p.sendKeepalive.stop()
+	if data && !p.newHandshake.pending {
+		// Expect a reply, or start over.
+		p.newHandshake.reset(keepaliveTimeout + rekeyTimeout)
+	}
+	if p.persistentKeepalive != 0 {
+		p.persistentTimer.reset(p.persistentKeepalive)
+	}
+}
+
+// receivedLocked updates the timers of p after an authenticated message was
+// received, carrying data if data is true.
+//
+// Preconditions: p.mu must be locked.
+func (p *peer) receivedLocked(data bool) {
+	p.newHandshake.stop()
+	if data && !p.sendKeepalive.pending {
+		// Acknowledge the data, unless it is replied to in the meantime.
+		p.sendKeepalive.reset(keepaliveTimeout)
+	}
+	if p.persistentKeepalive != 0 {
+		p.persistentTimer.reset(p.persistentKeepalive)
+	}
+}
+
+// sendLocked sends packet to p, or stages it until a handshake completes.
+//
+// Preconditions: d.mu and p.mu must be locked.
+func (p *peer) sendLocked(packet []byte, now time.Time) ([]outgoing, *tcpip.Error) {
+	if !p.hasEndpoint {
+		return nil, tcpip.ErrNoRoute
+	}
+
+	kp := p.current
+	if !kp.canSend(now) {
+		if len(p.staged) == maxStagedPackets {
+			p.staged[0] = nil
+			p.staged = p.staged[1:]
+		}
+		p.staged = append(p.staged, packet)
+		return p.initiateHandshakeLocked(now, false), nil
+	}
+
+	out := []outgoing{p.sealLocked(kp, packet)}
+	p.sentLocked(true)
+	if kp.initiator && (now.Sub(kp.created) >= rekeyAfterTime || kp.sendCounter >= rekeyAfterMessages) {
+		out = append(out, p.initiateHandshakeLocked(now, false)...)
+	}
+	return out, nil
+}
+
+// keepaliveLocked sends a keepalive to p, or initiates a handshake if there
+// is no session with it.
+//
+// Preconditions: d.mu and p.mu must be locked.
+func (p *peer) keepaliveLocked(now time.Time) []outgoing {
+	if !p.hasEndpoint {
+		return nil
+	}
+	kp := p.current
+	if !kp.canSend(now) {
+		return p.initiateHandshakeLocked(now, false)
+	}
+	out := []outgoing{p.sealLocked(kp, nil)}
+	p.sentLocked(false)
+	return out
+}
+
+// flushStagedLocked sends the packets staged for p with the current keypair.
+// If none are, it sends a keepalive to confirm the session.
+//
+// Preconditions: d.mu and p.mu must be locked, and p.current must be valid.
+func (p *peer) flushStagedLocked() []outgoing {
+	if len(p.staged) == 0 {
+		out := []outgoing{p.sealLocked(p.current, nil)}
+		p.sentLocked(false)
+		return out
+	}
+	out := make([]outgoing, 0, len(p.staged))
+	for _, packet := range p.staged {
+		out = append(out, p.sealLocked(p.current, packet))
+	}
+	p.staged = nil
+	p.sentLocked(true)
+	return out
+}
+
+// sealLocked returns the transport message carrying packet encrypted with kp,
+// padded to a multiple of 16 bytes without exceeding the MTU.
+//
+// Preconditions: p.mu must be locked.
+func (p *peer) sealLocked(kp *keypair, packet []byte) outgoing {
+	padded := (len(packet) + 15) &^ 15
+	if mtu := int(p.device.mtu); padded > mtu {
+		padded = mtu
+		if padded < len(packet) {
+			padded = len(packet)
+		}
+	}
+	plain := make([]byte, padded)
+	copy(plain, packet)
+
+	msg := make([]byte, transportContent, transportContent+padded+chacha20poly1305.Overhead)
+	msg[0] = messageTransportType
+	binary.LittleEndian.PutUint32(msg[transportReceiver:], kp.remoteIndex)
+	binary.LittleEndian.PutUint64(msg[transportCounter:], kp.sendCounter)
+	msg = kp.send.Seal(msg, counterNonce(kp.sendCounter), plain, nil)
+	kp.sendCounter++
+
+	p.txBytes += uint64(len(msg))
+	return outgoing{b: msg, to: p.endpoint}
+}
+
+// openLocked decrypts the transport message b received with kp from the UDP
+// address from. It returns the padded packet it carries, empty for
+// keepalives, and the messages to send in response.
+//
+// Preconditions: d.mu and p.mu must be locked.
+func (p *peer) openLocked(kp *keypair, b []byte, from tcpip.FullAddress, now time.Time) ([]byte, []outgoing, bool) {
+	if p.removed || (kp != p.current && kp != p.previous && kp != p.next) || !kp.canReceive(now) {
+		return nil, nil, false
+	}
+	counter := binary.LittleEndian.Uint64(b[transportCounter:])
+	packet, err := kp.recv.Open(b[transportContent:transportContent], counterNonce(counter), b[transportContent:], nil)
+	if err != nil || !kp.replay.validate(counter, rejectAfterMessages) {
+		return nil, nil, false
+	}
+
+	if kp == p.next {
+		// The peer confirmed the keypair derived from its handshake.
+		p.retireLocked(p.previous)
+		p.previous = p.current
+		p.current = kp
+		p.next = nil
+	}
+	p.endpoint = from
+	p.hasEndpoint = true
+	p.rxBytes += uint64(len(b))
+	p.receivedLocked(len(packet) > 0)
+
+	var out []outgoing
+	if kp == p.current && kp.initiator && now.Sub(kp.created) >= rejectAfterTime-keepaliveTimeout-rekeyTimeout {
+		// Renew the session before it expires.
+		out = p.initiateHandshakeLocked(now, false)
+	}
+	return packet, out, true
+}
+
+// initiateHandshakeLocked sends a handshake initiation to p, unless one was
+// sent recently and retry is false.
+//
+// Preconditions: d.mu and p.mu must be locked.
+func (p *peer) initiateHandshakeLocked(now time.Time, retry bool) []outgoing {
+	d := p.device
+	if p.removed || !p.hasEndpoint || d.privateKey.IsZero() {
+		return nil
+	}
+	if !retry {
+		if now.Sub(p.lastHandshakeSent) < rekeyTimeout {
+			return nil
+		}
+		p.handshakeAttempts = 0
+	}
+
+	if idx := p.handshake.localIndex; idx != 0 {
+		d.removeIndex(idx)
+	}
+	p.handshake.localIndex = d.newIndex(p)
+	msg := make([]byte, messageInitiationSize)
+	if err := p.createInitiation(d.publicKey, msg); err != nil {
+		p.clearHandshakeLocked()
+		return nil
+	}
+	p.addMACsLocked(msg, initiationMAC1, now)
+
+	p.lastHandshakeSent = now
+	p.handshakeAttempts++
+	jitter := time.Duration(rand.Int63n(int64(time.Second / 3)))
+	p.retransmitHandshake.reset(rekeyTimeout + jitter)
+	p.txBytes += uint64(len(msg))
+	return []outgoing{{b: msg, to: p.endpoint}}
+}
+
+// retransmitHandshakeLocked sends the handshake initiation to p again, until
+// there were too many attempts.
+//
+// Preconditions: d.mu and p.mu must be locked.
+func (p *peer) retransmitHandshakeLocked(now time.Time) []outgoing {
+	if p.handshakeAttempts >= maxHandshakeAttempts {
+		// Give up, and drop the packets waiting for the handshake.
+		p.staged = nil
+		p.clearHandshakeLocked()
+		return nil
+	}
+	return p.initiateHandshakeLocked(now, true)
+}
+
+// respondLocked installs the handshake consumed from the initiation b, sent
+// by p from the UDP address from, and returns the response.
+//
+// Preconditions: d.mu and p.mu must be locked.
+func (p *peer) respondLocked(hs handshake, ts [timestampSize]byte, b []byte, from tcpip.FullAddress, now time.Time) []outgoing {
+	d := p.device
+	if p.removed {
+		return nil
+	}
+	old := p.handshake.localIndex
+	if err := p.installInitiation(hs, ts, now); err != nil {
+		return nil
+	}
+	if old != 0 {
+		d.removeIndex(old)
+	}
+	p.handshake.localIndex = d.newIndex(p)
+	p.endpoint = from
+	p.hasEndpoint = true
+	p.rxBytes += uint64(len(b))
+
+	msg := make([]byte, messageResponseSize)
+	if err := p.createResponse(msg); err != nil {
+		p.clearHandshakeLocked()
+		return nil
+	}
+	p.addMACsLocked(msg, responseMAC1, now)
+
+	// The keypair is used once the initiator sends with it.
+	kp := p.deriveKeypair(now)
+	d.setIndexKeypair(kp.localIndex, kp)
+	p.retireLocked(p.next)
+	p.next = kp
+	p.lastHandshake = now
+	p.receivedLocked(false)
+	p.sentLocked(false)
+
+	p.txBytes += uint64(len(msg))
+	return []outgoing{{b: msg, to: p.endpoint}}
+}
+
+// completeHandshakeLocked consumes the response b, sent by p from the UDP
+// address from, and sends the packets staged with the new keypair.
+//
+// Preconditions: d.mu and p.mu must be locked.
+func (p *peer) completeHandshakeLocked(priv Key, b []byte, from tcpip.FullAddress, now time.Time) []outgoing {
+	if p.removed || p.consumeResponse(priv, b) != nil {
+		return nil
+	}
+	kp := p.deriveKeypair(now)
+	p.device.setIndexKeypair(kp.localIndex, kp)
+	if p.next != nil {
+		p.retireLocked(p.previous)
+		p.previous = p.next
+		p.next = nil
+	} else {
+		p.retireLocked(p.previous)
+		p.previous = p.current
+	}
+	p.current = kp
+
+	p.endpoint = from
+	p.hasEndpoint = true
+	p.rxBytes += uint64(len(b))
+	p.lastHandshake = now
+	p.handshakeAttempts = 0
+	p.retransmitHandshake.stop()
+	p.receivedLocked(false)
+	return p.flushStagedLocked()
+}
+
+// consumeCookieReplyLocked stores the cookie of the cookie reply b, to be
+// used in the next handshake messages sent to p.
+//
+// Preconditions: p.mu must be locked.
+func (p *peer) consumeCookieReplyLocked(b []byte, now time.Time) {
+	var zero [macSize]byte
+	if p.removed || p.lastMAC1 == zero {
+		return
+	}
+	key := labelHash(labelCookie, p.publicKey)
+	aead, err := chacha20poly1305.NewX(key[:])
+	if err != nil {
+		return
+	}
+	var cookie [cookieSize]byte
+	if _, err := aead.Open(cookie[:0], b[cookieNonce:cookieEncrypted], b[cookieEncrypted:], p.lastMAC1[:]); err != nil {
+		return
+	}
+	p.cookie = cookie
+	p.cookieTime = now
+}
+
+// addMACsLocked fills the MACs of the handshake message msg, whose first MAC
+// is at offset mac1.
+//
+// Preconditions: p.mu must be locked.
+func (p *peer) addMACsLocked(msg []byte, mac1 int, now time.Time) {
+	key := labelHash(labelMAC1, p.publicKey)
+	m := mac(key[:], msg[:mac1])
+	copy(msg[mac1:], m[:])
+	p.lastMAC1 = m
+
+	mac2 := msg[mac1+macSize : mac1+2*macSize]
+	if !p.cookieTime.IsZero() && now.Sub(p.cookieTime) < cookieRefreshTime {
+		m := mac(p.cookie[:], msg[:mac1+macSize])
+		copy(mac2, m[:])
+	} else {
+		for i := range mac2 {
+			mac2[i] = 0
+		}
+	}
+}
+
+// clearHandshakeLocked abandons the handshake in progress with p.
+//
+// Preconditions: p.mu must be locked.
+func (p *peer) clearHandshakeLocked() {
+	if idx := p.handshake.localIndex; idx != 0 {
+		p.device.removeIndex(idx)
+	}
+	p.handshake.clear()
+	p.retransmitHandshake.stop()
+}
+
+// retireLocked unregisters the local index of kp, if any.
+//
+// Preconditions: p.mu must be locked.
+func (p *peer) retireLocked(kp *keypair) {
+	if kp != nil {
+		p.device.removeIndex(kp.localIndex)
+	}
+}
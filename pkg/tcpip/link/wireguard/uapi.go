@@ -0,0 +1,223 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireguard
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+)
+
+// IpcGet writes the configuration and the state of the device to w, in the
+// format of the "get=1" operation of the cross-platform userspace API of
+// wg(8). The empty line ending the response is left to the caller.
+func (d *Device) IpcGet(w io.Writer) error {
+	s := d.Status()
+	bw := bufio.NewWriter(w)
+	if !s.PrivateKey.IsZero() {
+		fmt.Fprintf(bw, "private_key=%s\n", s.PrivateKey.Hex())
+	}
+	fmt.Fprintf(bw, "listen_port=%d\n", s.ListenPort)
+	for _, p := range s.Peers {
+		fmt.Fprintf(bw, "public_key=%s\n", p.PublicKey.Hex())
+		fmt.Fprintf(bw, "preshared_key=%s\n", p.PresharedKey.Hex())
+		fmt.Fprintf(bw, "protocol_version=1\n")
+		if p.HasEndpoint {
+			fmt.Fprintf(bw, "endpoint=%s\n", FormatEndpoint(p.Endpoint))
+		}
+		var sec, nsec int64
+		if !p.LastHandshake.IsZero() {
+			sec, nsec = p.LastHandshake.Unix(), int64(p.LastHandshake.Nanosecond())
+		}
+		fmt.Fprintf(bw, "last_handshake_time_sec=%d\n", sec)
+		fmt.Fprintf(bw, "last_handshake_time_nsec=%d\n", nsec)
+		fmt.Fprintf(bw, "tx_bytes=%d\n", p.TxBytes)
+		fmt.Fprintf(bw, "rx_bytes=%d\n", p.RxBytes)
+		fmt.Fprintf(bw, "persistent_keepalive_interval=%d\n", p.PersistentKeepalive/time.Second)
+		for _, subnet := range p.AllowedIPs {
+			fmt.Fprintf(bw, "allowed_ip=%s/%d\n", net.IP(subnet.ID()), subnet.Prefix())
+		}
+	}
+	return bw.Flush()
+}
+
+// IpcSet reads a configuration change from r, in the format of the "set=1"
+// operation of the cross-platform userspace API of wg(8), until an empty line
+// or the end of r, and applies it to the device.
+func (d *Device) IpcSet(r io.Reader) error {
+	var c Config
+	var p *PeerConfig
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		i := strings.IndexByte(line, '=')
+		if i < 0 {
+			return fmt.Errorf("invalid line %q", line)
+		}
+		key, value := line[:i], line[i+1:]
+
+		if key == "public_key" {
+			pub, err := ParseHexKey(value)
+			if err != nil {
+				return err
+			}
+			c.Peers = append(c.Peers, PeerConfig{PublicKey: pub})
+			p = &c.Peers[len(c.Peers)-1]
+			continue
+		}
+		if p == nil {
+			if err := parseDeviceKey(&c, key, value); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := parsePeerKey(p, key, value); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return d.Configure(c)
+}
+
+// parseDeviceKey applies the device key and value to c.
+func parseDeviceKey(c *Config, key, value string) error {
+	switch key {
+	case "private_key":
+		k, err := ParseHexKey(value)
+		if err != nil {
+			return err
+		}
+		c.PrivateKey = &k
+	case "listen_port":
+		port, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid listen_port %q", value)
+		}
+		p := uint16(port)
+		c.ListenPort = &p
+	case "fwmark":
+		// Packets aren't marked in netstack; only accept clearing it.
+		if value != "" && value != "0" {
+			return fmt.Errorf("fwmark not supported")
+		}
+	case "replace_peers":
+		if value != "true" {
+			return fmt.Errorf("invalid replace_peers %q", value)
+		}
+		c.ReplacePeers = true
+	default:
+		return fmt.Errorf("invalid device key %q", key)
+	}
+	return nil
+}
+
+// parsePeerKey applies the peer key and value to p.
+func parsePeerKey(p *PeerConfig, key, value string) error {
+	switch key {
+	case "remove":
+		if value != "true" {
+			return fmt.Errorf("invalid remove %q", value)
+		}
+		p.Remove = true
+	case "update_only":
+		if value != "true" {
+			return fmt.Errorf("invalid update_only %q", value)
+		}
+		p.UpdateOnly = true
+	case "preshared_key":
+		k, err := ParseHexKey(value)
+		if err != nil {
+			return err
+		}
+		p.PresharedKey = &k
+	case "endpoint":
+		addr, err := ParseEndpoint(value)
+		if err != nil {
+			return err
+		}
+		p.Endpoint = &addr
+	case "persistent_keepalive_interval":
+		secs, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid persistent_keepalive_interval %q", value)
+		}
+		interval := time.Duration(secs) * time.Second
+		p.PersistentKeepalive = &interval
+	case "replace_allowed_ips":
+		if value != "true" {
+			return fmt.Errorf("invalid replace_allowed_ips %q", value)
+		}
+		p.ReplaceAllowedIPs = true
+	case "allowed_ip":
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return fmt.Errorf("invalid allowed_ip %q", value)
+		}
+		ones, _ := ipNet.Mask.Size()
+		addr := ipNet.IP
+		if ip4 := addr.To4(); ip4 != nil {
+			addr = ip4
+		}
+		subnet, err := NewSubnet(tcpip.Address(addr), ones)
+		if err != nil {
+			return err
+		}
+		p.AllowedIPs = append(p.AllowedIPs, subnet)
+	case "protocol_version":
+		if value != "1" {
+			return fmt.Errorf("unsupported protocol_version %q", value)
+		}
+	default:
+		return fmt.Errorf("invalid peer key %q", key)
+	}
+	return nil
+}
+
+// ParseEndpoint parses a UDP address of the form "host:port", where IPv6
+// hosts are in brackets.
+func ParseEndpoint(s string) (tcpip.FullAddress, error) {
+	host, portStr, err := net.SplitHostPort(s)
+	if err != nil {
+		return tcpip.FullAddress{}, fmt.Errorf("invalid endpoint %q: %v", s, err)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return tcpip.FullAddress{}, fmt.Errorf("invalid endpoint address %q", host)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return tcpip.FullAddress{}, fmt.Errorf("invalid endpoint port %q", portStr)
+	}
+	return tcpip.FullAddress{Addr: tcpip.Address(ip), Port: uint16(port)}, nil
+}
+
+// FormatEndpoint formats the UDP address addr as ParseEndpoint parses it.
+func FormatEndpoint(addr tcpip.FullAddress) string {
+	return net.JoinHostPort(net.IP(addr.Addr).String(), strconv.Itoa(int(addr.Port)))
+}
@@ -0,0 +1,624 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wireguard provides the implementation of WireGuard tunnel devices,
+// link endpoints which encrypt the packets sent over them and tunnel them to
+// their peers over UDP, as described in "WireGuard: Next Generation Kernel
+// Network Tunnel".
+//
+// Devices can be used in the networking stack by calling New() to create a
+// new device, registering it with stack.RegisterLinkEndpoint(), and then
+// passing it as an argument to Stack.CreateNIC(). They are configured with
+// Configure(), or with the cross-platform userspace API of wg(8) with IpcSet()
+// and IpcGet().
+package wireguard
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+)
+
+// DefaultMTU is the default MTU of devices, which leaves room for the
+// encapsulation over IPv6 on links with an MTU of 1500.
+const DefaultMTU = 1420
+
+// Protocol constants, from the WireGuard paper.
+const (
+	rekeyAfterMessages  = 1 << 60
+	rejectAfterMessages = math.MaxUint64 - 1<<13
+	rekeyAfterTime      = 120 * time.Second
+	rejectAfterTime     = 180 * time.Second
+	rekeyAttemptTime    = 90 * time.Second
+	rekeyTimeout        = 5 * time.Second
+	keepaliveTimeout    = 10 * time.Second
+	cookieRefreshTime   = 120 * time.Second
+
+	// maxHandshakeAttempts is the number of handshake initiations sent
+	// before giving up.
+	maxHandshakeAttempts = int(rekeyAttemptTime / rekeyTimeout)
+
+	// handshakeInitiationRate is the minimum interval between the
+	// initiations accepted from a peer.
+	handshakeInitiationRate = time.Second / 50
+
+	// maxStagedPackets is the number of packets queued per peer while a
+	// handshake is in progress.
+	maxStagedPackets = 128
+)
+
+// Config is a change of the configuration of a device. Nil fields are left
+// unchanged.
+type Config struct {
+	// PrivateKey is the static private key of the device. The zero key
+	// removes it.
+	PrivateKey *Key
+
+	// ListenPort is the UDP port of the device. Zero picks a random port.
+	ListenPort *uint16
+
+	// ReplacePeers removes all peers before Peers are applied.
+	ReplacePeers bool
+
+	// Peers are the changes of the peers.
+	Peers []PeerConfig
+}
+
+// PeerConfig is a change of the configuration of a peer, or the addition of a
+// peer if there is none with PublicKey.
+type PeerConfig struct {
+	// PublicKey is the static public key of the peer.
+	PublicKey Key
+
+	// Remove removes the peer.
+	Remove bool
+
+	// UpdateOnly ignores the change if there is no such peer.
+	UpdateOnly bool
+
+	// PresharedKey is the symmetric key mixed in the handshakes. The zero
+	// key removes it.
+	PresharedKey *Key
+
+	// Endpoint is the UDP address of the peer.
+	Endpoint *tcpip.FullAddress
+
+	// PersistentKeepalive is the interval of the keepalives sent to the
+	// peer. Zero disables them.
+	PersistentKeepalive *time.Duration
+
+	// ReplaceAllowedIPs removes the allowed IPs of the peer before
+	// AllowedIPs are added.
+	ReplaceAllowedIPs bool
+
+	// AllowedIPs are the subnets routed to the peer, and from which it may
+	// send packets.
+	AllowedIPs []tcpip.Subnet
+}
+
+// Status is the configuration and the state of a device.
+type Status struct {
+	PrivateKey Key
+	PublicKey  Key
+	ListenPort uint16
+	Peers      []PeerStatus
+}
+
+// PeerStatus is the configuration and the state of a peer.
+type PeerStatus struct {
+	PublicKey           Key
+	PresharedKey        Key
+	Endpoint            tcpip.FullAddress
+	HasEndpoint         bool
+	PersistentKeepalive time.Duration
+	AllowedIPs          []tcpip.Subnet
+
+	// LastHandshake is the time of the last completed handshake, zero if
+	// there is none.
+	LastHandshake time.Time
+
+	// RxBytes and TxBytes are the number of bytes received from and sent
+	// to the peer, including the overhead of WireGuard.
+	RxBytes uint64
+	TxBytes uint64
+}
+
+// outgoing is a message to send to a peer.
+type outgoing struct {
+	b  []byte
+	to tcpip.FullAddress
+}
+
+// indexEntry is what a local index refers to: the handshake of a peer, or a
+// keypair.
+type indexEntry struct {
+	peer    *peer
+	keypair *keypair
+}
+
+// Device is a WireGuard tunnel device. It implements stack.LinkEndpoint.
+type Device struct {
+	bind Bind
+	mtu  uint32
+
+	// dispatcher is set once by Attach.
+	dispatcher stack.NetworkDispatcher
+
+	// mu protects the following fields. It is locked before the mutexes
+	// of the peers.
+	mu         sync.RWMutex
+	privateKey Key
+	publicKey  Key
+	listenPort uint16
+	peers      map[Key]*peer
+	allowedIPs allowedIPs
+	closed     bool
+
+	// indexMu protects indices. It is locked after the mutexes of the
+	// peers.
+	indexMu sync.Mutex
+	indices map[uint32]indexEntry
+}
+
+// New creates a new device with the given MTU, which exchanges its messages
+// over bind. The bind is opened on a random port until one is configured.
+func New(bind Bind, mtu uint32) (*Device, error) {
+	d := &Device{
+		bind:    bind,
+		mtu:     mtu,
+		peers:   make(map[Key]*peer),
+		indices: make(map[uint32]indexEntry),
+	}
+	port, err := bind.Open(0, d.receive)
+	if err != nil {
+		return nil, err
+	}
+	d.listenPort = port
+	return d, nil
+}
+
+// Close removes all peers, and closes the bind of the device.
+func (d *Device) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+	d.closed = true
+	for _, p := range d.peers {
+		d.removePeerLocked(p)
+	}
+	d.bind.Close()
+}
+
+// MTU implements stack.LinkEndpoint.MTU.
+func (d *Device) MTU() uint32 {
+	return d.mtu
+}
+
+// Capabilities implements stack.LinkEndpoint.Capabilities.
+func (*Device) Capabilities() stack.LinkEndpointCapabilities {
+	return 0
+}
+
+// MaxHeaderLength implements stack.LinkEndpoint.MaxHeaderLength. Devices are
+// layer 3 devices, and have no link header.
+func (*Device) MaxHeaderLength() uint16 {
+	return 0
+}
+
+// LinkAddress implements stack.LinkEndpoint.LinkAddress.
+func (*Device) LinkAddress() tcpip.LinkAddress {
+	return ""
+}
+
+// Attach implements stack.LinkEndpoint.Attach.
+func (d *Device) Attach(dispatcher stack.NetworkDispatcher) {
+	d.dispatcher = dispatcher
+}
+
+// IsAttached implements stack.LinkEndpoint.IsAttached.
+func (d *Device) IsAttached() bool {
+	return d.dispatcher != nil
+}
+
+// WritePacket implements stack.LinkEndpoint.WritePacket. It sends the packet
+// to the peer its destination is routed to, once there is a session with it.
+func (d *Device) WritePacket(r *stack.Route, _ *stack.GSO, hdr buffer.Prependable, payload buffer.VectorisedView, protocol tcpip.NetworkProtocolNumber) *tcpip.Error {
+	packet := make([]byte, 0, hdr.UsedLength()+payload.Size())
+	packet = append(packet, hdr.View()...)
+	for _, v := range payload.Views() {
+		packet = append(packet, v...)
+	}
+
+	d.mu.RLock()
+	p := d.allowedIPs.lookup(r.RemoteAddress)
+	if p == nil {
+		d.mu.RUnlock()
+		return tcpip.ErrNoRoute
+	}
+	p.mu.Lock()
+	out, err := p.sendLocked(packet, time.Now())
+	p.mu.Unlock()
+	d.mu.RUnlock()
+
+	d.transmit(out)
+	return err
+}
+
+// Configure applies the configuration change c to the device.
+func (d *Device) Configure(c Config) error {
+	d.mu.Lock()
+	out, err := d.configureLocked(c)
+	d.mu.Unlock()
+
+	d.transmit(out)
+	return err
+}
+
+// configureLocked applies the configuration change c to the device, and
+// returns the messages to send to the peers.
+//
+// Preconditions: d.mu must be locked for writing.
+func (d *Device) configureLocked(c Config) ([]outgoing, error) {
+	if d.closed {
+		return nil, errors.New("device closed")
+	}
+
+	if c.PrivateKey != nil {
+		d.setPrivateKeyLocked(*c.PrivateKey)
+	}
+	if c.ListenPort != nil && *c.ListenPort != d.listenPort {
+		d.bind.Close()
+		port, err := d.bind.Open(*c.ListenPort, d.receive)
+		if err != nil {
+			// Stay reachable on the previous port.
+			if port, err := d.bind.Open(d.listenPort, d.receive); err == nil {
+				d.listenPort = port
+			}
+			return nil, err
+		}
+		d.listenPort = port
+	}
+	if c.ReplacePeers {
+		for _, p := range d.peers {
+			d.removePeerLocked(p)
+		}
+	}
+
+	now := time.Now()
+	var out []outgoing
+	for _, pc := range c.Peers {
+		p := d.peers[pc.PublicKey]
+		if pc.Remove {
+			if p != nil {
+				d.removePeerLocked(p)
+			}
+			continue
+		}
+		if p == nil {
+			if pc.UpdateOnly {
+				continue
+			}
+			if pc.PublicKey.Equal(d.publicKey) {
+				// A device can't be its own peer.
+				continue
+			}
+			p = newPeer(d, pc.PublicKey)
+			d.peers[pc.PublicKey] = p
+		}
+
+		p.mu.Lock()
+		if pc.PresharedKey != nil {
+			p.presharedKey = *pc.PresharedKey
+		}
+		if pc.Endpoint != nil {
+			p.endpoint = *pc.Endpoint
+			p.hasEndpoint = true
+		}
+		if pc.PersistentKeepalive != nil {
+			p.persistentKeepalive = *pc.PersistentKeepalive
+			if p.persistentKeepalive != 0 {
+				// Open the session right away, as Linux does.
+				out = append(out, p.keepaliveLocked(now)...)
+			}
+		}
+		p.mu.Unlock()
+
+		if pc.ReplaceAllowedIPs {
+			d.allowedIPs.removePeer(p)
+		}
+		for _, subnet := range pc.AllowedIPs {
+			d.allowedIPs.insert(subnet, p)
+		}
+	}
+	return out, nil
+}
+
+// setPrivateKeyLocked sets the static private key of the device.
+//
+// Preconditions: d.mu must be locked for writing.
+func (d *Device) setPrivateKeyLocked(priv Key) {
+	if !priv.IsZero() {
+		priv.clamp()
+	}
+	d.privateKey = priv
+	d.publicKey = Key{}
+	if !priv.IsZero() {
+		d.publicKey = priv.PublicKey()
+	}
+
+	for _, p := range d.peers {
+		if !d.publicKey.IsZero() && p.publicKey.Equal(d.publicKey) {
+			d.removePeerLocked(p)
+			continue
+		}
+		p.mu.Lock()
+		p.handshake.precomputedStaticStatic, _ = sharedSecret(priv, p.publicKey)
+		p.clearHandshakeLocked()
+		p.mu.Unlock()
+	}
+}
+
+// removePeerLocked removes peer p.
+//
+// Preconditions: d.mu must be locked for writing.
+func (d *Device) removePeerLocked(p *peer) {
+	d.allowedIPs.removePeer(p)
+	delete(d.peers, p.publicKey)
+
+	p.mu.Lock()
+	p.removed = true
+	p.stopTimersLocked()
+	p.clearHandshakeLocked()
+	for _, kp := range []*keypair{p.previous, p.current, p.next} {
+		p.retireLocked(kp)
+	}
+	p.previous, p.current, p.next = nil, nil, nil
+	p.staged = nil
+	p.mu.Unlock()
+}
+
+// Status returns the configuration and the state of the device, with its
+// peers sorted by public key.
+func (d *Device) Status() Status {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	s := Status{
+		PrivateKey: d.privateKey,
+		PublicKey:  d.publicKey,
+		ListenPort: d.listenPort,
+	}
+	for _, p := range d.peers {
+		p.mu.Lock()
+		s.Peers = append(s.Peers, PeerStatus{
+			PublicKey:           p.publicKey,
+			PresharedKey:        p.presharedKey,
+			Endpoint:            p.endpoint,
+			HasEndpoint:         p.hasEndpoint,
+			PersistentKeepalive: p.persistentKeepalive,
+			AllowedIPs:          d.allowedIPs.subnets(p),
+			LastHandshake:       p.lastHandshake,
+			RxBytes:             p.rxBytes,
+			TxBytes:             p.txBytes,
+		})
+		p.mu.Unlock()
+	}
+	sort.Slice(s.Peers, func(i, j int) bool {
+		a, b := s.Peers[i].PublicKey, s.Peers[j].PublicKey
+		return string(a[:]) < string(b[:])
+	})
+	return s
+}
+
+// transmit sends the messages out. It must be called without locks held, as
+// the messages may be routed over the device itself.
+func (d *Device) transmit(out []outgoing) {
+	for _, o := range out {
+		d.bind.Send(o.b, o.to)
+	}
+}
+
+// newIndex registers a new random local index referring to the handshake of
+// p.
+func (d *Device) newIndex(p *peer) uint32 {
+	d.indexMu.Lock()
+	defer d.indexMu.Unlock()
+	var b [4]byte
+	for {
+		rand.Read(b[:])
+		idx := binary.LittleEndian.Uint32(b[:])
+		if _, ok := d.indices[idx]; idx != 0 && !ok {
+			d.indices[idx] = indexEntry{peer: p}
+			return idx
+		}
+	}
+}
+
+// setIndexKeypair makes the local index idx refer to kp.
+func (d *Device) setIndexKeypair(idx uint32, kp *keypair) {
+	d.indexMu.Lock()
+	defer d.indexMu.Unlock()
+	if e, ok := d.indices[idx]; ok {
+		e.keypair = kp
+		d.indices[idx] = e
+	}
+}
+
+// removeIndex unregisters the local index idx.
+func (d *Device) removeIndex(idx uint32) {
+	d.indexMu.Lock()
+	defer d.indexMu.Unlock()
+	delete(d.indices, idx)
+}
+
+// lookupIndex returns what the local index idx refers to.
+func (d *Device) lookupIndex(idx uint32) (indexEntry, bool) {
+	d.indexMu.Lock()
+	defer d.indexMu.Unlock()
+	e, ok := d.indices[idx]
+	return e, ok
+}
+
+// receive processes the message b received from the UDP address from.
+func (d *Device) receive(b []byte, from tcpip.FullAddress) {
+	if len(b) < 4 || b[1] != 0 || b[2] != 0 || b[3] != 0 {
+		return
+	}
+	now := time.Now()
+	switch {
+	case b[0] == messageInitiationType && len(b) == messageInitiationSize:
+		d.receiveInitiation(b, from, now)
+	case b[0] == messageResponseType && len(b) == messageResponseSize:
+		d.receiveResponse(b, from, now)
+	case b[0] == messageCookieReplyType && len(b) == messageCookieReplySize:
+		d.receiveCookieReply(b)
+	case b[0] == messageTransportType && len(b) >= messageKeepaliveSize:
+		d.receiveTransport(b, from, now)
+	}
+}
+
+// receiveInitiation processes a handshake initiation, and responds to it.
+func (d *Device) receiveInitiation(b []byte, from tcpip.FullAddress, now time.Time) {
+	d.mu.RLock()
+	if d.privateKey.IsZero() || !checkMAC1(d.publicKey, b[:initiationMAC1], b[initiationMAC1:initiationMAC2]) {
+		d.mu.RUnlock()
+		return
+	}
+	static, ts, hs, err := consumeInitiation(d.privateKey, d.publicKey, b)
+	if err != nil {
+		d.mu.RUnlock()
+		return
+	}
+	p := d.peers[static]
+	if p == nil {
+		d.mu.RUnlock()
+		return
+	}
+
+	p.mu.Lock()
+	out := p.respondLocked(hs, ts, b, from, now)
+	p.mu.Unlock()
+	d.mu.RUnlock()
+
+	d.transmit(out)
+}
+
+// receiveResponse processes a handshake response, which completes the
+// handshake initiated.
+func (d *Device) receiveResponse(b []byte, from tcpip.FullAddress, now time.Time) {
+	e, ok := d.lookupIndex(binary.LittleEndian.Uint32(b[responseReceiver:]))
+	if !ok || e.keypair != nil {
+		return
+	}
+
+	d.mu.RLock()
+	if d.privateKey.IsZero() || !checkMAC1(d.publicKey, b[:responseMAC1], b[responseMAC1:responseMAC2]) {
+		d.mu.RUnlock()
+		return
+	}
+	p := e.peer
+	p.mu.Lock()
+	out := p.completeHandshakeLocked(d.privateKey, b, from, now)
+	p.mu.Unlock()
+	d.mu.RUnlock()
+
+	d.transmit(out)
+}
+
+// receiveCookieReply processes a cookie reply, sent by peers under load in
+// response to handshake messages.
+func (d *Device) receiveCookieReply(b []byte) {
+	e, ok := d.lookupIndex(binary.LittleEndian.Uint32(b[cookieReceiver:]))
+	if !ok {
+		return
+	}
+	p := e.peer
+	p.mu.Lock()
+	p.consumeCookieReplyLocked(b, time.Now())
+	p.mu.Unlock()
+}
+
+// receiveTransport processes a transport message, and delivers the packet it
+// carries.
+func (d *Device) receiveTransport(b []byte, from tcpip.FullAddress, now time.Time) {
+	e, ok := d.lookupIndex(binary.LittleEndian.Uint32(b[transportReceiver:]))
+	if !ok || e.keypair == nil {
+		return
+	}
+
+	d.mu.RLock()
+	p := e.peer
+	p.mu.Lock()
+	packet, out, ok := p.openLocked(e.keypair, b, from, now)
+	p.mu.Unlock()
+	if ok && len(packet) > 0 {
+		packet, ok = d.checkPacketLocked(p, packet)
+	}
+	d.mu.RUnlock()
+
+	d.transmit(out)
+	if !ok || len(packet) == 0 || d.dispatcher == nil {
+		// Keepalives carry no packet.
+		return
+	}
+	var protocol tcpip.NetworkProtocolNumber
+	switch header.IPVersion(packet) {
+	case header.IPv4Version:
+		protocol = header.IPv4ProtocolNumber
+	case header.IPv6Version:
+		protocol = header.IPv6ProtocolNumber
+	}
+	d.dispatcher.DeliverNetworkPacket(d, "" /* remote */, "" /* local */, protocol, buffer.View(packet).ToVectorisedView())
+}
+
+// checkPacketLocked checks that the packet received from p is an IP packet
+// from one of its allowed IPs, and returns it without its padding.
+//
+// Preconditions: d.mu must be locked.
+func (d *Device) checkPacketLocked(p *peer, packet []byte) ([]byte, bool) {
+	var src tcpip.Address
+	switch header.IPVersion(packet) {
+	case header.IPv4Version:
+		h := header.IPv4(packet)
+		if len(packet) < header.IPv4MinimumSize || int(h.TotalLength()) > len(packet) || int(h.TotalLength()) < int(h.HeaderLength()) {
+			return nil, false
+		}
+		packet = packet[:h.TotalLength()]
+		src = h.SourceAddress()
+	case header.IPv6Version:
+		h := header.IPv6(packet)
+		if len(packet) < header.IPv6MinimumSize || header.IPv6MinimumSize+int(h.PayloadLength()) > len(packet) {
+			return nil, false
+		}
+		packet = packet[:header.IPv6MinimumSize+int(h.PayloadLength())]
+		src = h.SourceAddress()
+	default:
+		return nil, false
+	}
+	if d.allowedIPs.lookup(src) != p {
+		return nil, false
+	}
+	return packet, true
+}
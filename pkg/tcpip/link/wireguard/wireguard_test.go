@@ -0,0 +1,388 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireguard
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+)
+
+// pipeBind is a Bind which delivers the messages sent to the pipeBind whose
+// address they are sent to.
+type pipeBind struct {
+	addr  tcpip.FullAddress
+	binds map[tcpip.Address]*pipeBind
+
+	mu   sync.Mutex
+	recv func(b []byte, from tcpip.FullAddress)
+	drop bool
+}
+
+func newPipeBinds(addrs ...tcpip.Address) []*pipeBind {
+	binds := make(map[tcpip.Address]*pipeBind)
+	var bs []*pipeBind
+	for _, a := range addrs {
+		b := &pipeBind{addr: tcpip.FullAddress{Addr: a, Port: 51820}, binds: binds}
+		binds[a] = b
+		bs = append(bs, b)
+	}
+	return bs
+}
+
+func (b *pipeBind) Open(port uint16, recv func(b []byte, from tcpip.FullAddress)) (uint16, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.recv = recv
+	if port != 0 {
+		b.addr.Port = port
+	}
+	return b.addr.Port, nil
+}
+
+func (b *pipeBind) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.recv = nil
+}
+
+func (b *pipeBind) Send(buf []byte, to tcpip.FullAddress) error {
+	b.mu.Lock()
+	drop := b.drop
+	b.mu.Unlock()
+	dst := b.binds[to.Addr]
+	if drop || dst == nil {
+		return nil
+	}
+	dst.mu.Lock()
+	recv := dst.recv
+	dst.mu.Unlock()
+	if recv != nil {
+		recv(append([]byte(nil), buf...), b.addr)
+	}
+	return nil
+}
+
+// packetCollector is a stack.NetworkDispatcher which collects the packets
+// delivered.
+type packetCollector struct {
+	ch chan []byte
+}
+
+func (c *packetCollector) DeliverNetworkPacket(_ stack.LinkEndpoint, _, _ tcpip.LinkAddress, _ tcpip.NetworkProtocolNumber, vv buffer.VectorisedView) {
+	c.ch <- vv.ToView()
+}
+
+func (c *packetCollector) wait(t *testing.T) []byte {
+	t.Helper()
+	select {
+	case p := <-c.ch:
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for a packet")
+		return nil
+	}
+}
+
+type testDevice struct {
+	*Device
+	priv      Key
+	bind      *pipeBind
+	addr      tcpip.Address
+	collector *packetCollector
+}
+
+func newTestDevice(t *testing.T, bind *pipeBind, addr tcpip.Address) *testDevice {
+	t.Helper()
+	d, err := New(bind, DefaultMTU)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	priv, err := GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("GeneratePrivateKey failed: %v", err)
+	}
+	if err := d.Configure(Config{PrivateKey: &priv}); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	c := &packetCollector{ch: make(chan []byte, 100)}
+	d.Attach(c)
+	return &testDevice{Device: d, priv: priv, bind: bind, addr: addr, collector: c}
+}
+
+// addPeer adds o as a peer of d, routing the /32 of its address to it.
+func (d *testDevice) addPeer(t *testing.T, o *testDevice, psk *Key) {
+	t.Helper()
+	subnet, err := NewSubnet(o.addr, 32)
+	if err != nil {
+		t.Fatalf("NewSubnet failed: %v", err)
+	}
+	ep := o.bind.addr
+	if err := d.Configure(Config{Peers: []PeerConfig{{
+		PublicKey:    o.priv.PublicKey(),
+		PresharedKey: psk,
+		Endpoint:     &ep,
+		AllowedIPs:   []tcpip.Subnet{subnet},
+	}}}); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+}
+
+// send sends an IPv4 packet with payload from d to dst.
+func (d *testDevice) send(t *testing.T, dst tcpip.Address, payload []byte) []byte {
+	t.Helper()
+	hdr := buffer.NewPrependable(header.IPv4MinimumSize)
+	ip := header.IPv4(hdr.Prepend(header.IPv4MinimumSize))
+	ip.Encode(&header.IPv4Fields{
+		IHL:         header.IPv4MinimumSize,
+		TotalLength: uint16(header.IPv4MinimumSize + len(payload)),
+		TTL:         64,
+		Protocol:    17,
+		SrcAddr:     d.addr,
+		DstAddr:     dst,
+	})
+	ip.SetChecksum(^ip.CalculateChecksum())
+	want := append(append([]byte(nil), hdr.View()...), payload...)
+
+	r := stack.Route{RemoteAddress: dst}
+	if err := d.WritePacket(&r, nil /* gso */, hdr, buffer.View(payload).ToVectorisedView(), header.IPv4ProtocolNumber); err != nil {
+		t.Fatalf("WritePacket failed: %v", err)
+	}
+	return want
+}
+
+const (
+	addrA = tcpip.Address("\x0a\x00\x00\x01")
+	addrB = tcpip.Address("\x0a\x00\x00\x02")
+)
+
+func newTestPair(t *testing.T, psk *Key) (*testDevice, *testDevice) {
+	binds := newPipeBinds("\xc0\xa8\x00\x01", "\xc0\xa8\x00\x02")
+	a := newTestDevice(t, binds[0], addrA)
+	b := newTestDevice(t, binds[1], addrB)
+	a.addPeer(t, b, psk)
+	b.addPeer(t, a, psk)
+	return a, b
+}
+
+func TestHandshakeAndTransport(t *testing.T) {
+	psk, err := GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("GeneratePrivateKey failed: %v", err)
+	}
+	for _, test := range []struct {
+		name string
+		psk  *Key
+	}{
+		{"NoPresharedKey", nil},
+		{"PresharedKey", &psk},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			a, b := newTestPair(t, test.psk)
+			defer a.Close()
+			defer b.Close()
+
+			// The packet is staged until the handshake completes.
+			want := a.send(t, addrB, []byte("hello"))
+			if got := b.collector.wait(t); !bytes.Equal(got, want) {
+				t.Fatalf("Got packet %x, want %x", got, want)
+			}
+
+			// The responder may send once the initiator sent data.
+			want = b.send(t, addrA, []byte("world"))
+			if got := a.collector.wait(t); !bytes.Equal(got, want) {
+				t.Fatalf("Got packet %x, want %x", got, want)
+			}
+
+			for _, d := range []*testDevice{a, b} {
+				s := d.Status()
+				if len(s.Peers) != 1 {
+					t.Fatalf("Got %d peers, want 1", len(s.Peers))
+				}
+				if p := s.Peers[0]; p.LastHandshake.IsZero() || p.RxBytes == 0 || p.TxBytes == 0 {
+					t.Errorf("Got peer status %+v, want a handshake and traffic", p)
+				}
+			}
+		})
+	}
+}
+
+func TestWrongKey(t *testing.T) {
+	a, b := newTestPair(t, nil)
+	defer a.Close()
+	defer b.Close()
+
+	// Make b expect another key from a.
+	other, err := GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("GeneratePrivateKey failed: %v", err)
+	}
+	ep := a.bind.addr
+	subnet, _ := NewSubnet(addrA, 32)
+	if err := b.Configure(Config{ReplacePeers: true, Peers: []PeerConfig{{
+		PublicKey:  other.PublicKey(),
+		Endpoint:   &ep,
+		AllowedIPs: []tcpip.Subnet{subnet},
+	}}}); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+
+	a.send(t, addrB, []byte("hello"))
+	select {
+	case p := <-b.collector.ch:
+		t.Fatalf("Got packet %x from unknown peer", p)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSourceNotAllowed(t *testing.T) {
+	a, b := newTestPair(t, nil)
+	defer a.Close()
+	defer b.Close()
+
+	// Packets from addresses not allowed for a are dropped by b.
+	a.addr = "\x0a\x00\x00\x03"
+	a.send(t, addrB, []byte("hello"))
+	select {
+	case p := <-b.collector.ch:
+		t.Fatalf("Got packet %x from a source not allowed", p)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNoRoute(t *testing.T) {
+	a, b := newTestPair(t, nil)
+	defer a.Close()
+	defer b.Close()
+
+	hdr := buffer.NewPrependable(header.IPv4MinimumSize)
+	hdr.Prepend(header.IPv4MinimumSize)
+	r := stack.Route{RemoteAddress: "\x0a\x00\x00\x09"}
+	if err := a.WritePacket(&r, nil /* gso */, hdr, buffer.VectorisedView{}, header.IPv4ProtocolNumber); err != tcpip.ErrNoRoute {
+		t.Fatalf("Got WritePacket = %v, want %v", err, tcpip.ErrNoRoute)
+	}
+}
+
+func TestReplayFilter(t *testing.T) {
+	var f replayFilter
+	for _, test := range []struct {
+		counter uint64
+		want    bool
+	}{
+		{0, true},
+		{0, false},
+		{1, true},
+		{5, true},
+		{3, true},
+		{3, false},
+		{5, false},
+		{replayWindowSize + 5, true},
+		{6, true},
+		{6, false},
+		{2, false}, // Out of the window.
+		{replayWindowSize * 10, true},
+		{replayWindowSize * 8, false}, // Out of the window.
+		{rejectAfterMessages, false},
+	} {
+		if got := f.validate(test.counter, rejectAfterMessages); got != test.want {
+			t.Errorf("validate(%d) = %t, want %t", test.counter, got, test.want)
+		}
+	}
+}
+
+func TestIpcSetGet(t *testing.T) {
+	binds := newPipeBinds("\xc0\xa8\x00\x01")
+	d, err := New(binds[0], DefaultMTU)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer d.Close()
+
+	priv, _ := GeneratePrivateKey()
+	pub := priv.PublicKey()
+	peerPriv, _ := GeneratePrivateKey()
+	peerPub := peerPriv.PublicKey()
+	set := strings.Join([]string{
+		"private_key=" + priv.Hex(),
+		"listen_port=12345",
+		"replace_peers=true",
+		"public_key=" + peerPub.Hex(),
+		"endpoint=[2001:db8::1]:51820",
+		"persistent_keepalive_interval=0",
+		"replace_allowed_ips=true",
+		"allowed_ip=10.0.0.7/24",
+		"allowed_ip=fd00::/64",
+		"",
+	}, "\n")
+	if err := d.IpcSet(strings.NewReader(set)); err != nil {
+		t.Fatalf("IpcSet failed: %v", err)
+	}
+	if got := d.Status().PublicKey; got != pub {
+		t.Errorf("Got public key %v, want %v", got, pub)
+	}
+
+	var b bytes.Buffer
+	if err := d.IpcGet(&b); err != nil {
+		t.Fatalf("IpcGet failed: %v", err)
+	}
+	for _, want := range []string{
+		"private_key=" + priv.Hex(),
+		"listen_port=12345",
+		"public_key=" + peerPub.Hex(),
+		"endpoint=[2001:db8::1]:51820",
+		"allowed_ip=10.0.0.0/24",
+		"allowed_ip=fd00::/64",
+		"last_handshake_time_sec=0",
+	} {
+		if !strings.Contains(b.String(), want+"\n") {
+			t.Errorf("IpcGet output %q doesn't contain %q", b.String(), want)
+		}
+	}
+
+	for _, bad := range []string{
+		"private_key=00",
+		"listen_port=70000",
+		"public_key=" + peerPub.Hex() + "\nallowed_ip=10.0.0.0/33",
+		"public_key=" + peerPub.Hex() + "\nendpoint=10.0.0.1",
+		"unknown=1",
+	} {
+		if err := d.IpcSet(strings.NewReader(bad)); err == nil {
+			t.Errorf("IpcSet(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestKeyParsing(t *testing.T) {
+	k, err := GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("GeneratePrivateKey failed: %v", err)
+	}
+	if got, err := ParseKey(k.String()); err != nil || got != k {
+		t.Errorf("ParseKey(%q) = %v, %v, want %v", k.String(), got, err, k)
+	}
+	if got, err := ParseHexKey(k.Hex()); err != nil || got != k {
+		t.Errorf("ParseHexKey(%q) = %v, %v, want %v", k.Hex(), got, err, k)
+	}
+	if _, err := ParseKey("AAAA"); err == nil {
+		t.Errorf("ParseKey succeeded with a short key")
+	}
+}
@@ -105,6 +105,12 @@ func (e *endpoint) handleICMP(r *stack.Route, netHeader buffer.View, vv buffer.V
 		}
 		vv.TrimFront(header.ICMPv4DstUnreachableMinimumSize)
 		switch h.Code() {
+		case header.ICMPv4NetUnreachable:
+			e.handleControl(stack.ControlNetworkUnreachable, 0, vv)
+
+		case header.ICMPv4HostUnreachable:
+			e.handleControl(stack.ControlHostUnreachable, 0, vv)
+
 		case header.ICMPv4PortUnreachable:
 			e.handleControl(stack.ControlPortUnreachable, 0, vv)
 
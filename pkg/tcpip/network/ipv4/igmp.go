@@ -0,0 +1,83 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipv4
+
+import (
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+)
+
+// igmpv1MaxRespTime is the max response time of IGMPv1 queries, which don't
+// have the field (RFC 2236 section 4).
+const igmpv1MaxRespTime = 10 * time.Second
+
+// handleIGMP handles an IGMP message. Hosts only care about queries, and
+// about the reports of other hosts, which may suppress their own. The
+// membership reports of the stack itself are sent by the NIC.
+func (e *endpoint) handleIGMP(r *stack.Route, vv buffer.VectorisedView) {
+	received := r.Stats().IGMP.PacketsReceived
+	v := vv.ToView()
+	if len(v) < header.IGMPMinimumSize || header.Checksum(v, 0) != 0xffff {
+		received.Invalid.Increment()
+		return
+	}
+	h := header.IGMP(v)
+
+	handler, ok := e.linkAddrCache.(stack.MulticastGroupHandler)
+	switch h.Type() {
+	case header.IGMPMembershipQuery:
+		received.MembershipQuery.Increment()
+		if !ok {
+			return
+		}
+
+		// The version of a query is determined by its length and max
+		// response time (RFC 3376 section 7.1). Queries of other
+		// lengths are ignored.
+		switch {
+		case len(v) >= header.IGMPv3QueryMinimumSize:
+			q := header.IGMPv3Query(v)
+			handler.HandleMulticastGroupQuery(e.nicid, ProtocolNumber, q.GroupAddress(), q.MaxRespTime(), 3)
+		case len(v) != header.IGMPMinimumSize:
+			received.Invalid.Increment()
+		case h.MaxRespCode() == 0:
+			handler.HandleMulticastGroupQuery(e.nicid, ProtocolNumber, h.GroupAddress(), igmpv1MaxRespTime, 1)
+		default:
+			handler.HandleMulticastGroupQuery(e.nicid, ProtocolNumber, h.GroupAddress(), h.MaxRespTime(), 2)
+		}
+
+	case header.IGMPv1MembershipReport, header.IGMPv2MembershipReport:
+		if h.Type() == header.IGMPv1MembershipReport {
+			received.V1MembershipReport.Increment()
+		} else {
+			received.V2MembershipReport.Increment()
+		}
+		if ok {
+			handler.HandleMulticastGroupReport(e.nicid, ProtocolNumber, h.GroupAddress())
+		}
+
+	case header.IGMPLeaveGroup:
+		received.LeaveGroup.Increment()
+
+	case header.IGMPv3MembershipReport:
+		received.V3MembershipReport.Increment()
+
+	default:
+		received.Invalid.Increment()
+	}
+}
@@ -50,6 +50,7 @@ type endpoint struct {
 	nicid         tcpip.NICID
 	id            stack.NetworkEndpointID
 	linkEP        stack.LinkEndpoint
+	linkAddrCache stack.LinkAddressCache
 	dispatcher    stack.TransportDispatcher
 	fragmentation *fragmentation.Fragmentation
 }
@@ -60,6 +61,7 @@ func (p *protocol) NewEndpoint(nicid tcpip.NICID, addr tcpip.Address, linkAddrCa
 		nicid:         nicid,
 		id:            stack.NetworkEndpointID{LocalAddress: addr},
 		linkEP:        linkEP,
+		linkAddrCache: linkAddrCache,
 		dispatcher:    dispatcher,
 		fragmentation: fragmentation.NewFragmentation(fragmentation.HighFragThreshold, fragmentation.LowFragThreshold, fragmentation.DefaultReassembleTimeout),
 	}
@@ -173,6 +175,10 @@ func (e *endpoint) HandlePacket(r *stack.Route, vv buffer.VectorisedView) {
 		e.handleICMP(r, headerView, vv)
 		return
 	}
+	if p == header.IGMPProtocolNumber {
+		e.handleIGMP(r, vv)
+		return
+	}
 	r.Stats().IP.PacketsDelivered.Increment()
 	e.dispatcher.DeliverTransportPacket(r, p, headerView, vv)
 }
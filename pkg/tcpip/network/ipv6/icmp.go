@@ -93,6 +93,12 @@ func (e *endpoint) handleICMP(r *stack.Route, netHeader buffer.View, vv buffer.V
 		}
 		vv.TrimFront(header.ICMPv6DstUnreachableMinimumSize)
 		switch h.Code() {
+		case header.ICMPv6NetworkUnreachable:
+			e.handleControl(stack.ControlNetworkUnreachable, 0, vv)
+
+		case header.ICMPv6AddressUnreachable:
+			e.handleControl(stack.ControlHostUnreachable, 0, vv)
+
 		case header.ICMPv6PortUnreachable:
 			e.handleControl(stack.ControlPortUnreachable, 0, vv)
 		}
@@ -100,7 +106,12 @@ func (e *endpoint) handleICMP(r *stack.Route, netHeader buffer.View, vv buffer.V
 	case header.ICMPv6NeighborSolicit:
 		received.NeighborSolicit.Increment()
 
-		e.linkAddrCache.AddLinkAddress(e.nicid, r.RemoteAddress, r.RemoteLinkAddress)
+		// Solicitations sent for Duplicate Address Detection come from
+		// the unspecified address, which has no link address.
+		isDAD := r.RemoteAddress == header.IPv6Any
+		if !isDAD {
+			e.linkAddrCache.AddLinkAddress(e.nicid, r.RemoteAddress, r.RemoteLinkAddress)
+		}
 
 		if len(v) < header.ICMPv6NeighborSolicitMinimumSize {
 			received.Invalid.Increment()
@@ -108,6 +119,13 @@ func (e *endpoint) handleICMP(r *stack.Route, netHeader buffer.View, vv buffer.V
 		}
 		targetAddr := tcpip.Address(v[8:][:16])
 		if e.linkAddrCache.CheckLocalAddress(e.nicid, ProtocolNumber, targetAddr) == 0 {
+			// If another node is doing DAD for one of our tentative
+			// addresses, the address is a duplicate (RFC 4862
+			// section 5.4.3).
+			if ndp, ok := e.linkAddrCache.(stack.NDPHandler); ok && isDAD {
+				ndp.DupTentativeAddrDetected(e.nicid, targetAddr)
+			}
+
 			// We don't have a useful answer; the best we can do is ignore the request.
 			return
 		}
@@ -116,6 +134,12 @@ func (e *endpoint) handleICMP(r *stack.Route, netHeader buffer.View, vv buffer.V
 		pkt := header.ICMPv6(hdr.Prepend(header.ICMPv6NeighborAdvertSize))
 		pkt.SetType(header.ICMPv6NeighborAdvert)
 		pkt[icmpV6FlagOffset] = ndpSolicitedFlag | ndpOverrideFlag
+		if isDAD {
+			// The node doing DAD can't receive unicast packets yet,
+			// so the advertisement is sent to all nodes and isn't
+			// flagged as solicited (RFC 4861 section 7.2.4).
+			pkt[icmpV6FlagOffset] = ndpOverrideFlag
+		}
 		copy(pkt[icmpV6OptOffset-len(targetAddr):], targetAddr)
 		pkt[icmpV6OptOffset] = ndpOptDstLinkAddr
 		pkt[icmpV6LengthOffset] = 1
@@ -132,7 +156,11 @@ func (e *endpoint) handleICMP(r *stack.Route, netHeader buffer.View, vv buffer.V
 		r := r.Clone()
 		defer r.Release()
 		r.LocalAddress = targetAddr
-		pkt.SetChecksum(icmpChecksum(pkt, r.LocalAddress, r.RemoteAddress, buffer.VectorisedView{}))
+		if isDAD {
+			r.RemoteAddress = header.IPv6AllNodesMulticastAddress
+			r.RemoteLinkAddress = header.EthernetAddressFromMulticastIPv6Address(r.RemoteAddress)
+		}
+		pkt.SetChecksum(header.ICMPv6Checksum(pkt, r.LocalAddress, r.RemoteAddress, buffer.VectorisedView{}))
 
 		if err := r.WritePacket(nil /* gso */, hdr, buffer.VectorisedView{}, header.ICMPv6ProtocolNumber, r.DefaultTTL()); err != nil {
 			sent.Dropped.Increment()
@@ -147,6 +175,13 @@ func (e *endpoint) handleICMP(r *stack.Route, netHeader buffer.View, vv buffer.V
 			return
 		}
 		targetAddr := tcpip.Address(v[8:][:16])
+
+		// An advertisement for one of our tentative addresses means
+		// that it is a duplicate (RFC 4862 section 5.4.4).
+		if ndp, ok := e.linkAddrCache.(stack.NDPHandler); ok && ndp.DupTentativeAddrDetected(e.nicid, targetAddr) == nil {
+			return
+		}
+
 		e.linkAddrCache.AddLinkAddress(e.nicid, targetAddr, r.RemoteLinkAddress)
 		if targetAddr != r.RemoteAddress {
 			e.linkAddrCache.AddLinkAddress(e.nicid, r.RemoteAddress, r.RemoteLinkAddress)
@@ -164,7 +199,7 @@ func (e *endpoint) handleICMP(r *stack.Route, netHeader buffer.View, vv buffer.V
 		pkt := header.ICMPv6(hdr.Prepend(header.ICMPv6EchoMinimumSize))
 		copy(pkt, h)
 		pkt.SetType(header.ICMPv6EchoReply)
-		pkt.SetChecksum(icmpChecksum(pkt, r.LocalAddress, r.RemoteAddress, vv))
+		pkt.SetChecksum(header.ICMPv6Checksum(pkt, r.LocalAddress, r.RemoteAddress, vv))
 		if err := r.WritePacket(nil /* gso */, hdr, vv, header.ICMPv6ProtocolNumber, r.DefaultTTL()); err != nil {
 			sent.Dropped.Increment()
 			return
@@ -191,9 +226,65 @@ func (e *endpoint) handleICMP(r *stack.Route, netHeader buffer.View, vv buffer.V
 	case header.ICMPv6RouterAdvert:
 		received.RouterAdvert.Increment()
 
+		// Router Advertisements that don't come from a router on the
+		// link are silently discarded (RFC 4861 section 6.1.2).
+		pkt := vv.ToView()
+		if header.IPv6(netHeader).HopLimit() != header.NDPHopLimit || h.Code() != 0 || !header.IsV6LinkLocalAddress(r.RemoteAddress) || len(pkt) < header.ICMPv6MinimumSize+header.NDPRAMinimumSize {
+			return
+		}
+
+		e.linkAddrCache.AddLinkAddress(e.nicid, r.RemoteAddress, r.RemoteLinkAddress)
+		if ndp, ok := e.linkAddrCache.(stack.NDPHandler); ok {
+			ndp.HandleNDPRouterAdvert(e.nicid, r.RemoteAddress, header.NDPRouterAdvert(pkt[header.ICMPv6MinimumSize:]))
+		}
+
 	case header.ICMPv6RedirectMsg:
 		received.RedirectMsg.Increment()
 
+	case header.ICMPv6MulticastListenerQuery:
+		received.MulticastListenerQuery.Increment()
+
+		// MLD messages that don't come from a link-local address are
+		// silently discarded (RFC 3810 section 5.1.14).
+		handler, ok := e.linkAddrCache.(stack.MulticastGroupHandler)
+		if !ok || !header.IsV6LinkLocalAddress(r.RemoteAddress) {
+			return
+		}
+
+		// The version of a query is determined by its length (RFC 3810
+		// section 8.1). Queries of other lengths are ignored.
+		body := vv.ToView()[header.ICMPv6MinimumSize:]
+		switch {
+		case len(body) >= header.MLDv2QueryMinimumSize:
+			q := header.MLDv2Query(body)
+			handler.HandleMulticastGroupQuery(e.nicid, ProtocolNumber, q.MulticastAddress(), q.MaxRespDelay(), 2)
+		case len(body) == header.MLDMinimumSize:
+			q := header.MLD(body)
+			handler.HandleMulticastGroupQuery(e.nicid, ProtocolNumber, q.MulticastAddress(), q.MaxRespDelay(), 1)
+		default:
+			received.Invalid.Increment()
+		}
+
+	case header.ICMPv6MulticastListenerReport:
+		received.MulticastListenerReport.Increment()
+
+		handler, ok := e.linkAddrCache.(stack.MulticastGroupHandler)
+		if !ok || !header.IsV6LinkLocalAddress(r.RemoteAddress) {
+			return
+		}
+		body := vv.ToView()[header.ICMPv6MinimumSize:]
+		if len(body) < header.MLDMinimumSize {
+			received.Invalid.Increment()
+			return
+		}
+		handler.HandleMulticastGroupReport(e.nicid, ProtocolNumber, header.MLD(body).MulticastAddress())
+
+	case header.ICMPv6MulticastListenerDone:
+		received.MulticastListenerDone.Increment()
+
+	case header.ICMPv6MulticastListenerV2Report:
+		received.MulticastListenerV2Report.Increment()
+
 	default:
 		received.Invalid.Increment()
 	}
@@ -235,7 +326,7 @@ func (*protocol) LinkAddressRequest(addr, localAddr tcpip.Address, linkEP stack.
 	pkt[icmpV6OptOffset] = ndpOptSrcLinkAddr
 	pkt[icmpV6LengthOffset] = 1
 	copy(pkt[icmpV6LengthOffset+1:], linkEP.LinkAddress())
-	pkt.SetChecksum(icmpChecksum(pkt, r.LocalAddress, r.RemoteAddress, buffer.VectorisedView{}))
+	pkt.SetChecksum(header.ICMPv6Checksum(pkt, r.LocalAddress, r.RemoteAddress, buffer.VectorisedView{}))
 
 	length := uint16(hdr.UsedLength())
 	ip := header.IPv6(hdr.Prepend(header.IPv6MinimumSize))
@@ -254,44 +345,7 @@ func (*protocol) LinkAddressRequest(addr, localAddr tcpip.Address, linkEP stack.
 // ResolveStaticAddress implements stack.LinkAddressResolver.
 func (*protocol) ResolveStaticAddress(addr tcpip.Address) (tcpip.LinkAddress, bool) {
 	if header.IsV6MulticastAddress(addr) {
-		// RFC 2464 Transmission of IPv6 Packets over Ethernet Networks
-		//
-		// 7. Address Mapping -- Multicast
-		//
-		// An IPv6 packet with a multicast destination address DST,
-		// consisting of the sixteen octets DST[1] through DST[16], is
-		// transmitted to the Ethernet multicast address whose first
-		// two octets are the value 3333 hexadecimal and whose last
-		// four octets are the last four octets of DST.
-		return tcpip.LinkAddress([]byte{
-			0x33,
-			0x33,
-			addr[header.IPv6AddressSize-4],
-			addr[header.IPv6AddressSize-3],
-			addr[header.IPv6AddressSize-2],
-			addr[header.IPv6AddressSize-1],
-		}), true
+		return header.EthernetAddressFromMulticastIPv6Address(addr), true
 	}
 	return "", false
 }
-
-func icmpChecksum(h header.ICMPv6, src, dst tcpip.Address, vv buffer.VectorisedView) uint16 {
-	// Calculate the IPv6 pseudo-header upper-layer checksum.
-	xsum := header.Checksum([]byte(src), 0)
-	xsum = header.Checksum([]byte(dst), xsum)
-	var upperLayerLength [4]byte
-	binary.BigEndian.PutUint32(upperLayerLength[:], uint32(len(h)+vv.Size()))
-	xsum = header.Checksum(upperLayerLength[:], xsum)
-	xsum = header.Checksum([]byte{0, 0, 0, uint8(header.ICMPv6ProtocolNumber)}, xsum)
-	for _, v := range vv.Views() {
-		xsum = header.Checksum(v, xsum)
-	}
-
-	// h[2:4] is the checksum itself, set it aside to avoid checksumming the checksum.
-	h2, h3 := h[2], h[3]
-	h[2], h[3] = 0, 0
-	xsum = ^header.Checksum(h, xsum)
-	h[2], h[3] = h2, h3
-
-	return xsum
-}
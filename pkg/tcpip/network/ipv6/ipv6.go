@@ -131,6 +131,12 @@ func (e *endpoint) HandlePacket(r *stack.Route, vv buffer.VectorisedView) {
 	vv.CapLength(int(h.PayloadLength()))
 
 	p := h.TransportProtocol()
+	if p == header.IPv6HopByHopOptionsHeader {
+		var ok bool
+		if p, ok = skipHopByHopOptions(&vv); !ok {
+			return
+		}
+	}
 	if p == header.ICMPv6ProtocolNumber {
 		e.handleICMP(r, headerView, vv)
 		return
@@ -140,6 +146,48 @@ func (e *endpoint) HandlePacket(r *stack.Route, vv buffer.VectorisedView) {
 	e.dispatcher.DeliverTransportPacket(r, p, headerView, vv)
 }
 
+// skipHopByHopOptions removes the Hop-by-Hop Options header at the front of
+// vv, and returns the number of the header that follows it. None of the
+// options, such as the Router Alert option of MLD messages, need processing.
+// It returns false if the packet must be discarded, because the header is
+// malformed or holds an unrecognized option whose type says so (RFC 8200
+// section 4.2).
+func skipHopByHopOptions(vv *buffer.VectorisedView) (tcpip.TransportProtocolNumber, bool) {
+	v := vv.ToView()
+	if len(v) < 2 {
+		return 0, false
+	}
+	l := (int(v[1]) + 1) * 8
+	if len(v) < l {
+		return 0, false
+	}
+
+	for opts := v[2:l]; len(opts) > 0; {
+		typ := opts[0]
+		if typ == header.IPv6Pad1Option {
+			opts = opts[1:]
+			continue
+		}
+		if len(opts) < 2 || len(opts) < 2+int(opts[1]) {
+			return 0, false
+		}
+		switch typ {
+		case header.IPv6PadNOption, header.IPv6RouterAlertOption:
+		default:
+			// Unrecognized options can only be skipped if the
+			// two high-order bits of their type are zero.
+			if typ>>6 != 0 {
+				return 0, false
+			}
+		}
+		opts = opts[2+int(opts[1]):]
+	}
+
+	p := tcpip.TransportProtocolNumber(v[0])
+	vv.TrimFront(l)
+	return p, true
+}
+
 // Close cleans up resources associated with the endpoint.
 func (*endpoint) Close() {}
 
@@ -0,0 +1,420 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+)
+
+// ConnTrackMax is the maximum number of connections tracked. New connections
+// are not tracked once it is reached, until tracked ones expire.
+const ConnTrackMax = 65536
+
+// ConnTrackState is the state of a tracked TCP connection. The values are the
+// ones of Linux's TCP_CONNTRACK_* constants.
+type ConnTrackState uint8
+
+// States of tracked TCP connections.
+const (
+	ConnTrackNone ConnTrackState = iota
+	ConnTrackSynSent
+	ConnTrackSynRecv
+	ConnTrackEstablished
+	ConnTrackFinWait
+	ConnTrackCloseWait
+	ConnTrackLastAck
+	ConnTrackTimeWait
+	ConnTrackClose
+)
+
+// String returns the name of the state, as shown by Linux.
+func (s ConnTrackState) String() string {
+	switch s {
+	case ConnTrackSynSent:
+		return "SYN_SENT"
+	case ConnTrackSynRecv:
+		return "SYN_RECV"
+	case ConnTrackEstablished:
+		return "ESTABLISHED"
+	case ConnTrackFinWait:
+		return "FIN_WAIT"
+	case ConnTrackCloseWait:
+		return "CLOSE_WAIT"
+	case ConnTrackLastAck:
+		return "LAST_ACK"
+	case ConnTrackTimeWait:
+		return "TIME_WAIT"
+	case ConnTrackClose:
+		return "CLOSE"
+	default:
+		return "NONE"
+	}
+}
+
+// Timeouts of tracked connections, the defaults of Linux.
+var (
+	connTrackTCPTimeouts = [...]time.Duration{
+		ConnTrackNone:        10 * time.Second,
+		ConnTrackSynSent:     2 * time.Minute,
+		ConnTrackSynRecv:     time.Minute,
+		ConnTrackEstablished: 5 * 24 * time.Hour,
+		ConnTrackFinWait:     2 * time.Minute,
+		ConnTrackCloseWait:   time.Minute,
+		ConnTrackLastAck:     30 * time.Second,
+		ConnTrackTimeWait:    2 * time.Minute,
+		ConnTrackClose:       10 * time.Second,
+	}
+	connTrackUDPTimeout       = 30 * time.Second
+	connTrackUDPStreamTimeout = 2 * time.Minute
+	connTrackICMPTimeout      = 30 * time.Second
+)
+
+// ConnTrackTuple identifies one direction of a tracked connection.
+type ConnTrackTuple struct {
+	NetProto   tcpip.NetworkProtocolNumber
+	TransProto tcpip.TransportProtocolNumber
+	SrcAddr    tcpip.Address
+	DstAddr    tcpip.Address
+
+	// SrcPort and DstPort are the ports of TCP and UDP, and both the
+	// identifier of ICMP echo requests.
+	SrcPort uint16
+	DstPort uint16
+}
+
+// reverse returns the tuple of the other direction of the connection.
+func (t ConnTrackTuple) reverse() ConnTrackTuple {
+	t.SrcAddr, t.DstAddr = t.DstAddr, t.SrcAddr
+	t.SrcPort, t.DstPort = t.DstPort, t.SrcPort
+	return t
+}
+
+// ConnTrackEntry describes a tracked connection.
+type ConnTrackEntry struct {
+	// ID identifies the connection for as long as it is tracked.
+	ID uint32
+
+	// Original is the tuple of the direction the connection was initiated
+	// in, and Reply the one of the other direction.
+	Original ConnTrackTuple
+	Reply    ConnTrackTuple
+
+	// State is the state of TCP connections.
+	State ConnTrackState
+
+	// SeenReply is whether packets were seen in the reply direction.
+	SeenReply bool
+
+	// Assured is whether the connection is established enough to not be
+	// evicted early.
+	Assured bool
+
+	// Timeout is the time left before the connection expires, unless more
+	// packets are seen.
+	Timeout time.Duration
+}
+
+// Directions of the packets of a tracked connection.
+const (
+	connTrackOriginal = 0
+	connTrackReply    = 1
+)
+
+// connTrackConn is a tracked connection.
+type connTrackConn struct {
+	ConnTrackEntry
+
+	// finSeen is whether a FIN was seen in each direction.
+	finSeen [2]bool
+
+	// expires is when the connection expires, in monotonic nanoseconds.
+	expires int64
+}
+
+// connTrack is the table of the connections tracked by a stack.
+type connTrack struct {
+	clock tcpip.Clock
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// conns maps the tuples of both directions of the connections to them.
+	conns map[ConnTrackTuple]*connTrackConn
+
+	// count is the number of connections, half the size of conns.
+	count int
+
+	// nextID is the ID of the next connection.
+	nextID uint32
+}
+
+func newConnTrack(clock tcpip.Clock) *connTrack {
+	return &connTrack{
+		clock: clock,
+		conns: make(map[ConnTrackTuple]*connTrackConn),
+	}
+}
+
+// handlePacket tracks a packet of transport protocol transProto, sent from src
+// to dst, whose transport header starts at the beginning of b.
+func (ct *connTrack) handlePacket(netProto tcpip.NetworkProtocolNumber, transProto tcpip.TransportProtocolNumber, src, dst tcpip.Address, b []byte) {
+	t := ConnTrackTuple{
+		NetProto:   netProto,
+		TransProto: transProto,
+		SrcAddr:    src,
+		DstAddr:    dst,
+	}
+	// create is whether the packet may start a connection.
+	create := true
+	var tcpFlags uint8
+	switch transProto {
+	case header.TCPProtocolNumber:
+		if len(b) < header.TCPMinimumSize {
+			return
+		}
+		tcp := header.TCP(b)
+		t.SrcPort, t.DstPort = tcp.SourcePort(), tcp.DestinationPort()
+		tcpFlags = tcp.Flags()
+		// A reset doesn't start anything.
+		create = tcpFlags&header.TCPFlagRst == 0
+	case header.UDPProtocolNumber:
+		if len(b) < header.UDPMinimumSize {
+			return
+		}
+		udp := header.UDP(b)
+		t.SrcPort, t.DstPort = udp.SourcePort(), udp.DestinationPort()
+	case header.ICMPv4ProtocolNumber, header.ICMPv6ProtocolNumber:
+		// Only echo requests and replies are tracked, with requests
+		// starting connections.
+		if len(b) < header.ICMPv4EchoMinimumSize {
+			return
+		}
+		switch typ := b[0]; {
+		case transProto == header.ICMPv4ProtocolNumber && typ == uint8(header.ICMPv4Echo),
+			transProto == header.ICMPv6ProtocolNumber && typ == uint8(header.ICMPv6EchoRequest):
+		case transProto == header.ICMPv4ProtocolNumber && typ == uint8(header.ICMPv4EchoReply),
+			transProto == header.ICMPv6ProtocolNumber && typ == uint8(header.ICMPv6EchoReply):
+			create = false
+		default:
+			return
+		}
+		id := binary.BigEndian.Uint16(b[4:])
+		t.SrcPort, t.DstPort = id, id
+	default:
+		return
+	}
+
+	now := ct.clock.NowMonotonic()
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	c, ok := ct.conns[t]
+	if ok && c.expires <= now {
+		ct.removeLocked(c)
+		ok = false
+	}
+	if !ok {
+		if !create || !ct.reserveLocked(now) {
+			return
+		}
+		ct.nextID++
+		c = &connTrackConn{ConnTrackEntry: ConnTrackEntry{
+			ID:       ct.nextID,
+			Original: t,
+			Reply:    t.reverse(),
+		}}
+		if transProto == header.TCPProtocolNumber && tcpFlags&(header.TCPFlagSyn|header.TCPFlagAck) != header.TCPFlagSyn {
+			// Pick up connections established before being
+			// tracked, as Linux does.
+			c.State = ConnTrackEstablished
+		}
+		ct.conns[c.Original] = c
+		ct.conns[c.Reply] = c
+		ct.count++
+	}
+
+	dir := connTrackOriginal
+	if t == c.Reply {
+		dir = connTrackReply
+		c.SeenReply = true
+	}
+	var timeout time.Duration
+	switch transProto {
+	case header.TCPProtocolNumber:
+		c.updateTCP(dir, tcpFlags)
+		timeout = connTrackTCPTimeouts[c.State]
+	case header.UDPProtocolNumber:
+		timeout = connTrackUDPTimeout
+		if c.SeenReply {
+			c.Assured = true
+			timeout = connTrackUDPStreamTimeout
+		}
+	default:
+		timeout = connTrackICMPTimeout
+	}
+	c.expires = now + timeout.Nanoseconds()
+}
+
+// updateTCP updates the state of a TCP connection with a segment with the
+// flags flags sent in the direction dir.
+func (c *connTrackConn) updateTCP(dir int, flags uint8) {
+	switch {
+	case flags&header.TCPFlagRst != 0:
+		c.State = ConnTrackClose
+	case flags&header.TCPFlagSyn != 0 && flags&header.TCPFlagAck == 0:
+		if dir == connTrackOriginal && (c.State == ConnTrackNone || c.State >= ConnTrackTimeWait) {
+			// A new connection, possibly reusing the tuple.
+			c.State = ConnTrackSynSent
+			c.finSeen = [2]bool{}
+			c.Assured = false
+		}
+	case flags&header.TCPFlagSyn != 0:
+		if dir == connTrackReply && c.State == ConnTrackSynSent {
+			c.State = ConnTrackSynRecv
+		}
+	case flags&header.TCPFlagFin != 0:
+		c.finSeen[dir] = true
+		switch {
+		case c.finSeen[1-dir]:
+			c.State = ConnTrackLastAck
+		case dir == connTrackOriginal:
+			c.State = ConnTrackFinWait
+		default:
+			c.State = ConnTrackCloseWait
+		}
+	case flags&header.TCPFlagAck != 0:
+		switch {
+		case c.State == ConnTrackSynRecv && dir == connTrackOriginal:
+			c.State = ConnTrackEstablished
+			c.Assured = true
+		case c.State == ConnTrackLastAck && c.finSeen[0] && c.finSeen[1]:
+			c.State = ConnTrackTimeWait
+		}
+	}
+}
+
+// reserveLocked returns whether a new connection can be tracked, evicting
+// expired connections if the table is full.
+//
+// Preconditions: ct.mu must be locked.
+func (ct *connTrack) reserveLocked(now int64) bool {
+	if ct.count < ConnTrackMax {
+		return true
+	}
+	ct.expireLocked(now)
+	return ct.count < ConnTrackMax
+}
+
+// expireLocked removes the expired connections.
+//
+// Preconditions: ct.mu must be locked.
+func (ct *connTrack) expireLocked(now int64) {
+	for t, c := range ct.conns {
+		if t == c.Original && c.expires <= now {
+			ct.removeLocked(c)
+		}
+	}
+}
+
+// removeLocked stops tracking c.
+//
+// Preconditions: ct.mu must be locked.
+func (ct *connTrack) removeLocked(c *connTrackConn) {
+	delete(ct.conns, c.Original)
+	delete(ct.conns, c.Reply)
+	ct.count--
+}
+
+// entries returns the tracked connections.
+func (ct *connTrack) entries() []ConnTrackEntry {
+	now := ct.clock.NowMonotonic()
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	ct.expireLocked(now)
+	es := make([]ConnTrackEntry, 0, ct.count)
+	for t, c := range ct.conns {
+		if t != c.Original {
+			continue
+		}
+		e := c.ConnTrackEntry
+		e.Timeout = time.Duration(c.expires - now)
+		es = append(es, e)
+	}
+	return es
+}
+
+// remove stops tracking the connection with the tuple t in either direction,
+// and returns whether it was tracked.
+func (ct *connTrack) remove(t ConnTrackTuple) bool {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	c, ok := ct.conns[t]
+	if ok {
+		ct.removeLocked(c)
+	}
+	return ok
+}
+
+// flush stops tracking the connections of the network protocol netProto, or
+// of all network protocols if it is zero.
+func (ct *connTrack) flush(netProto tcpip.NetworkProtocolNumber) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	for t, c := range ct.conns {
+		if t == c.Original && (netProto == 0 || t.NetProto == netProto) {
+			ct.removeLocked(c)
+		}
+	}
+}
+
+// ConnTrackEnabled returns whether the stack tracks connections.
+func (s *Stack) ConnTrackEnabled() bool {
+	return s.connTrack != nil
+}
+
+// ConnTrackEntries returns the connections tracked by the stack, in no
+// particular order.
+func (s *Stack) ConnTrackEntries() []ConnTrackEntry {
+	if s.connTrack == nil {
+		return nil
+	}
+	return s.connTrack.entries()
+}
+
+// RemoveConnTrackEntry stops tracking the connection with the tuple t in either
+// direction, and returns whether it was tracked. The connection itself is not
+// affected, and is tracked again from its next packet.
+func (s *Stack) RemoveConnTrackEntry(t ConnTrackTuple) bool {
+	if s.connTrack == nil {
+		return false
+	}
+	return s.connTrack.remove(t)
+}
+
+// FlushConnTrack stops tracking the connections of the network protocol
+// netProto, or of all network protocols if it is zero.
+func (s *Stack) FlushConnTrack(netProto tcpip.NetworkProtocolNumber) {
+	if s.connTrack != nil {
+		s.connTrack.flush(netProto)
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+)
+
+const (
+	ctClientAddr = tcpip.Address("\x0a\x00\x00\x01")
+	ctServerAddr = tcpip.Address("\x0a\x00\x00\x02")
+	ctClientPort = 40000
+	ctServerPort = 80
+)
+
+type fakeClock struct {
+	now int64
+}
+
+func (c *fakeClock) NowNanoseconds() int64 {
+	return c.now
+}
+
+func (c *fakeClock) NowMonotonic() int64 {
+	return c.now
+}
+
+func tcpSegment(srcPort, dstPort uint16, flags uint8) []byte {
+	b := make([]byte, header.TCPMinimumSize)
+	header.TCP(b).Encode(&header.TCPFields{
+		SrcPort:    srcPort,
+		DstPort:    dstPort,
+		DataOffset: header.TCPMinimumSize,
+		Flags:      flags,
+	})
+	return b
+}
+
+// sendTCP tracks a segment with flags from the client if fromClient is set, or
+// from the server.
+func sendTCP(ct *connTrack, fromClient bool, flags uint8) {
+	if fromClient {
+		ct.handlePacket(header.IPv4ProtocolNumber, header.TCPProtocolNumber, ctClientAddr, ctServerAddr, tcpSegment(ctClientPort, ctServerPort, flags))
+	} else {
+		ct.handlePacket(header.IPv4ProtocolNumber, header.TCPProtocolNumber, ctServerAddr, ctClientAddr, tcpSegment(ctServerPort, ctClientPort, flags))
+	}
+}
+
+func singleEntry(t *testing.T, ct *connTrack) ConnTrackEntry {
+	t.Helper()
+	es := ct.entries()
+	if len(es) != 1 {
+		t.Fatalf("Got %d entries, want 1: %+v", len(es), es)
+	}
+	return es[0]
+}
+
+func TestConnTrackTCP(t *testing.T) {
+	ct := newConnTrack(&fakeClock{})
+	steps := []struct {
+		fromClient  bool
+		flags       uint8
+		wantState   ConnTrackState
+		wantAssured bool
+	}{
+		{true, header.TCPFlagSyn, ConnTrackSynSent, false},
+		{false, header.TCPFlagSyn | header.TCPFlagAck, ConnTrackSynRecv, false},
+		{true, header.TCPFlagAck, ConnTrackEstablished, true},
+		{false, header.TCPFlagAck | header.TCPFlagPsh, ConnTrackEstablished, true},
+		{true, header.TCPFlagFin | header.TCPFlagAck, ConnTrackFinWait, true},
+		{false, header.TCPFlagFin | header.TCPFlagAck, ConnTrackLastAck, true},
+		{true, header.TCPFlagAck, ConnTrackTimeWait, true},
+	}
+	for i, s := range steps {
+		sendTCP(ct, s.fromClient, s.flags)
+		e := singleEntry(t, ct)
+		if e.State != s.wantState || e.Assured != s.wantAssured {
+			t.Fatalf("After step %d, got state %v assured %t, want %v assured %t", i, e.State, e.Assured, s.wantState, s.wantAssured)
+		}
+		if want := connTrackTCPTimeouts[s.wantState]; e.Timeout != want {
+			t.Errorf("After step %d, got timeout %v, want %v", i, e.Timeout, want)
+		}
+	}
+
+	e := singleEntry(t, ct)
+	want := ConnTrackTuple{
+		NetProto:   header.IPv4ProtocolNumber,
+		TransProto: header.TCPProtocolNumber,
+		SrcAddr:    ctClientAddr,
+		DstAddr:    ctServerAddr,
+		SrcPort:    ctClientPort,
+		DstPort:    ctServerPort,
+	}
+	if e.Original != want || e.Reply != want.reverse() || !e.SeenReply {
+		t.Errorf("Got entry %+v, want original tuple %+v and a reply seen", e, want)
+	}
+
+	// The tuple is reused by a new connection.
+	sendTCP(ct, true, header.TCPFlagSyn)
+	if e := singleEntry(t, ct); e.State != ConnTrackSynSent || e.Assured {
+		t.Errorf("Got state %v assured %t, want %v not assured", e.State, e.Assured, ConnTrackSynSent)
+	}
+	sendTCP(ct, false, header.TCPFlagRst|header.TCPFlagAck)
+	if e := singleEntry(t, ct); e.State != ConnTrackClose {
+		t.Errorf("Got state %v, want %v", e.State, ConnTrackClose)
+	}
+}
+
+func TestConnTrackTCPPickup(t *testing.T) {
+	ct := newConnTrack(&fakeClock{})
+
+	// A reset doesn't create an entry.
+	sendTCP(ct, true, header.TCPFlagRst)
+	if es := ct.entries(); len(es) != 0 {
+		t.Fatalf("Got entries %+v, want none", es)
+	}
+
+	sendTCP(ct, false, header.TCPFlagAck)
+	e := singleEntry(t, ct)
+	if e.State != ConnTrackEstablished || e.SeenReply {
+		t.Errorf("Got entry %+v, want an established connection without reply", e)
+	}
+	if e.Original.SrcAddr != ctServerAddr {
+		t.Errorf("Got original source %v, want %v", e.Original.SrcAddr, ctServerAddr)
+	}
+}
+
+func TestConnTrackUDPExpiry(t *testing.T) {
+	clock := &fakeClock{}
+	ct := newConnTrack(clock)
+	udp := func(src, dst tcpip.Address, srcPort, dstPort uint16) {
+		b := make([]byte, header.UDPMinimumSize)
+		header.UDP(b).Encode(&header.UDPFields{SrcPort: srcPort, DstPort: dstPort, Length: header.UDPMinimumSize})
+		ct.handlePacket(header.IPv4ProtocolNumber, header.UDPProtocolNumber, src, dst, b)
+	}
+
+	udp(ctClientAddr, ctServerAddr, ctClientPort, 53)
+	if e := singleEntry(t, ct); e.SeenReply || e.Timeout != connTrackUDPTimeout {
+		t.Errorf("Got entry %+v, want an unreplied one expiring in %v", e, connTrackUDPTimeout)
+	}
+	udp(ctServerAddr, ctClientAddr, 53, ctClientPort)
+	if e := singleEntry(t, ct); !e.SeenReply || !e.Assured || e.Timeout != connTrackUDPStreamTimeout {
+		t.Errorf("Got entry %+v, want an assured one expiring in %v", e, connTrackUDPStreamTimeout)
+	}
+
+	clock.now += connTrackUDPStreamTimeout.Nanoseconds()
+	if es := ct.entries(); len(es) != 0 {
+		t.Errorf("Got entries %+v after expiry, want none", es)
+	}
+	if ct.count != 0 || len(ct.conns) != 0 {
+		t.Errorf("Got count %d and %d tuples after expiry, want none", ct.count, len(ct.conns))
+	}
+}
+
+func TestConnTrackICMPEcho(t *testing.T) {
+	ct := newConnTrack(&fakeClock{})
+	icmp := func(src, dst tcpip.Address, typ header.ICMPv4Type, id uint16) {
+		b := make([]byte, header.ICMPv4EchoMinimumSize)
+		b[0] = byte(typ)
+		binary.BigEndian.PutUint16(b[4:], id)
+		ct.handlePacket(header.IPv4ProtocolNumber, header.ICMPv4ProtocolNumber, src, dst, b)
+	}
+
+	// Replies and other messages don't create entries.
+	icmp(ctServerAddr, ctClientAddr, header.ICMPv4EchoReply, 7)
+	icmp(ctServerAddr, ctClientAddr, header.ICMPv4DstUnreachable, 7)
+	if es := ct.entries(); len(es) != 0 {
+		t.Fatalf("Got entries %+v, want none", es)
+	}
+
+	icmp(ctClientAddr, ctServerAddr, header.ICMPv4Echo, 7)
+	icmp(ctServerAddr, ctClientAddr, header.ICMPv4EchoReply, 7)
+	e := singleEntry(t, ct)
+	if e.Original.SrcPort != 7 || e.Original.DstPort != 7 || !e.SeenReply || e.Timeout != connTrackICMPTimeout {
+		t.Errorf("Got entry %+v, want a replied echo with identifier 7", e)
+	}
+}
+
+func TestConnTrackRemoveAndFlush(t *testing.T) {
+	ct := newConnTrack(&fakeClock{})
+	sendTCP(ct, true, header.TCPFlagSyn)
+	e := singleEntry(t, ct)
+	ct.handlePacket(header.IPv6ProtocolNumber, header.TCPProtocolNumber, "\xfe\x80\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01", "\xfe\x80\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02", tcpSegment(1, 2, header.TCPFlagSyn))
+	if es := ct.entries(); len(es) != 2 {
+		t.Fatalf("Got %d entries, want 2", len(es))
+	}
+
+	ct.flush(header.IPv6ProtocolNumber)
+	if got := singleEntry(t, ct); got.ID != e.ID {
+		t.Errorf("Got entry %+v after flushing IPv6, want %+v", got, e)
+	}
+	if !ct.remove(e.Reply) {
+		t.Errorf("remove(%+v) = false, want true", e.Reply)
+	}
+	if ct.remove(e.Original) {
+		t.Errorf("remove(%+v) = true after removal, want false", e.Original)
+	}
+
+	sendTCP(ct, true, header.TCPFlagSyn)
+	ct.flush(0)
+	if es := ct.entries(); len(es) != 0 {
+		t.Errorf("Got entries %+v after flush, want none", es)
+	}
+}
+
+func TestConnTrackMax(t *testing.T) {
+	clock := &fakeClock{}
+	ct := newConnTrack(clock)
+	for i := 0; i < ConnTrackMax+1; i++ {
+		ct.handlePacket(header.IPv4ProtocolNumber, header.TCPProtocolNumber, ctClientAddr, ctServerAddr, tcpSegment(uint16(i), ctServerPort, header.TCPFlagSyn))
+	}
+	if ct.count != ConnTrackMax {
+		t.Errorf("Got %d connections, want %d", ct.count, ConnTrackMax)
+	}
+
+	// Expired connections make room for new ones.
+	clock.now += connTrackTCPTimeouts[ConnTrackSynSent].Nanoseconds()
+	ct.handlePacket(header.IPv4ProtocolNumber, header.TCPProtocolNumber, ctClientAddr, ctServerAddr, tcpSegment(ctClientPort, ctServerPort+1, header.TCPFlagSyn))
+	if ct.count != 1 {
+		t.Errorf("Got %d connections, want 1", ct.count)
+	}
+}
+
+func TestConnTrackFollowsStackClock(t *testing.T) {
+	s := New(nil, nil, Options{Clock: &fakeClock{now: 1}, ConnTrack: true})
+	if got := s.connTrack.clock.NowMonotonic(); got != 1 {
+		t.Errorf("Got time %d, want 1", got)
+	}
+	s.SetClock(&fakeClock{now: 2})
+	if got := s.connTrack.clock.NowMonotonic(); got != 2 {
+		t.Errorf("Got time %d after SetClock, want 2", got)
+	}
+}
@@ -0,0 +1,673 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"math/rand"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+)
+
+const (
+	// defaultRobustnessVariable is the default number of times
+	// unsolicited reports are sent.
+	//
+	// Default = 2 (from RFC 3376 section 8.1 and RFC 3810 section 9.1).
+	defaultRobustnessVariable = 2
+
+	// defaultUnsolicitedReportInterval is the default maximum amount of
+	// time between unsolicited reports.
+	//
+	// Default = 1s (from RFC 3376 section 8.11 and RFC 3810 section 9.11).
+	defaultUnsolicitedReportInterval = time.Second
+
+	// defaultQueryInterval is the default interval between general queries
+	// sent by queriers.
+	//
+	// Default = 125s (from RFC 3376 section 8.2 and RFC 3810 section 9.2).
+	defaultQueryInterval = 125 * time.Second
+
+	// defaultQueryResponseInterval is the default max response time of
+	// general queries.
+	//
+	// Default = 10s (from RFC 3376 section 8.3 and RFC 3810 section 9.3).
+	defaultQueryResponseInterval = 10 * time.Second
+
+	// newestIGMPVersion and newestMLDVersion are the versions of IGMP and
+	// MLD used when no querier of an older version is present.
+	newestIGMPVersion = 3
+	newestMLDVersion  = 2
+)
+
+// MulticastGroupConfigurations is the configuration of the multicast group
+// management protocols, IGMP and MLD, of the netstack. The zero value disables
+// them, so multicast groups are joined without telling routers.
+type MulticastGroupConfigurations struct {
+	// EnableIGMP determines whether the membership of IPv4 multicast
+	// groups is reported with IGMP. IGMPv3 is used, unless an IGMPv1 or
+	// IGMPv2 querier is present on the link.
+	EnableIGMP bool
+
+	// EnableMLD determines whether the membership of IPv6 multicast
+	// groups is reported with MLD. MLDv2 is used, unless an MLDv1 querier
+	// is present on the link.
+	EnableMLD bool
+
+	// RobustnessVariable is the number of times unsolicited reports are
+	// sent, to make up for packet loss. A value of 0 is replaced by the
+	// default, 2.
+	RobustnessVariable uint8
+
+	// UnsolicitedReportInterval is the maximum amount of time between
+	// unsolicited reports. Values lower than 1ms are replaced by the
+	// default, 1s.
+	UnsolicitedReportInterval time.Duration
+}
+
+// DefaultMulticastGroupConfigurations returns a MulticastGroupConfigurations
+// enabling IGMP and MLD with the default values from RFC 3376 and RFC 3810.
+func DefaultMulticastGroupConfigurations() MulticastGroupConfigurations {
+	return MulticastGroupConfigurations{
+		EnableIGMP:                true,
+		EnableMLD:                 true,
+		RobustnessVariable:        defaultRobustnessVariable,
+		UnsolicitedReportInterval: defaultUnsolicitedReportInterval,
+	}
+}
+
+// validate replaces invalid values of c with their defaults.
+func (c *MulticastGroupConfigurations) validate() {
+	if c.RobustnessVariable == 0 {
+		c.RobustnessVariable = defaultRobustnessVariable
+	}
+	if c.UnsolicitedReportInterval < time.Millisecond {
+		c.UnsolicitedReportInterval = defaultUnsolicitedReportInterval
+	}
+}
+
+// mcastState is the per-NIC state of the host side of IGMP (RFC 1112, RFC 2236
+// and RFC 3376) and MLD (RFC 2710 and RFC 3810).
+//
+// Source filtering isn't supported, so all groups are reported in EXCLUDE
+// mode with no sources, which IGMPv1, IGMPv2 and MLDv1 routers understand as a
+// plain membership.
+//
+// mcastState is protected by the mu of the NIC it belongs to. Timer callbacks
+// acquire it and check that the state they were created for is still current,
+// since a timer may fire after it has been stopped.
+type mcastState struct {
+	nic     *NIC
+	configs MulticastGroupConfigurations
+
+	igmp mcastProtocolState
+	mld  mcastProtocolState
+}
+
+// mcastProtocolState is the state of IGMP or MLD on a NIC.
+type mcastProtocolState struct {
+	// enabled is whether the protocol is enabled.
+	enabled bool
+
+	// allHostsJoined is whether the protocol holds a join of the group
+	// that general queries are sent to.
+	allHostsJoined bool
+
+	// olderQuerierUntil holds, for each protocol version older than the
+	// newest one, when the last query received with that version stops
+	// being considered (RFC 3376 section 7.2.1 and RFC 3810 section 8.2.1).
+	// The version used is the oldest one with a querier present.
+	olderQuerierUntil [newestIGMPVersion - 1]time.Time
+
+	// groups holds the reported multicast groups.
+	groups map[tcpip.Address]*mcastGroupState
+}
+
+// mcastGroupState is the state of a reported multicast group.
+type mcastGroupState struct {
+	// timer is the timer of the next report, or nil if none is pending.
+	timer *time.Timer
+
+	// deadline is when timer fires.
+	deadline time.Time
+
+	// unsolicited is the number of unsolicited reports left to send.
+	unsolicited uint8
+
+	// lastReporter is whether the NIC sent the last IGMPv1, IGMPv2 or MLDv1
+	// report for the group, in which case it tells routers when it leaves
+	// the group.
+	lastReporter bool
+}
+
+func newMcastState(nic *NIC) mcastState {
+	return mcastState{
+		nic:  nic,
+		igmp: mcastProtocolState{groups: make(map[tcpip.Address]*mcastGroupState)},
+		mld:  mcastProtocolState{groups: make(map[tcpip.Address]*mcastGroupState)},
+	}
+}
+
+// protocolState returns the state of the multicast group management protocol
+// of protocol, along with its newest version and the group that its general
+// queries are sent to. It returns nil if protocol isn't IPv4 or IPv6.
+func (m *mcastState) protocolState(protocol tcpip.NetworkProtocolNumber) (p *mcastProtocolState, newest uint8, allHosts tcpip.Address) {
+	switch protocol {
+	case header.IPv4ProtocolNumber:
+		return &m.igmp, newestIGMPVersion, header.IPv4AllSystemsMulticastAddress
+	case header.IPv6ProtocolNumber:
+		return &m.mld, newestMLDVersion, header.IPv6AllNodesMulticastAddress
+	default:
+		return nil, 0, ""
+	}
+}
+
+// version returns the version of the multicast group management protocol of
+// protocol currently used.
+func (m *mcastState) version(protocol tcpip.NetworkProtocolNumber) uint8 {
+	p, newest, _ := m.protocolState(protocol)
+	now := time.Now()
+	for v := uint8(1); v < newest; v++ {
+		if now.Before(p.olderQuerierUntil[v-1]) {
+			return v
+		}
+	}
+	return newest
+}
+
+// isAllHostsGroup returns whether addr is the group that general queries of
+// the multicast group management protocol of protocol are sent to, and was
+// joined for that protocol.
+func (m *mcastState) isAllHostsGroup(protocol tcpip.NetworkProtocolNumber, addr tcpip.Address) bool {
+	p, _, allHosts := m.protocolState(protocol)
+	return p != nil && p.allHostsJoined && addr == allHosts
+}
+
+// isReportedGroup returns whether the membership of addr is reported. The
+// all-systems and all-nodes groups, which every host joins, are never
+// reported, and neither are IPv6 groups that are narrower than the link (RFC
+// 3376 section 5 and RFC 3810 section 6).
+func isReportedGroup(protocol tcpip.NetworkProtocolNumber, addr tcpip.Address) bool {
+	switch protocol {
+	case header.IPv4ProtocolNumber:
+		return header.IsV4MulticastAddress(addr) && addr != header.IPv4AllSystemsMulticastAddress
+	case header.IPv6ProtocolNumber:
+		if !header.IsV6MulticastAddress(addr) || addr == header.IPv6AllNodesMulticastAddress {
+			return false
+		}
+		// Scopes 0 (reserved) and 1 (interface-local) don't reach the
+		// link (RFC 4291 section 2.7).
+		return addr[1]&0xf > 1
+	default:
+		return false
+	}
+}
+
+// setConfigs applies new IGMP and MLD configurations to the NIC. The groups
+// joined so far are reported by the protocols being enabled.
+//
+// The NIC's mu must be locked.
+func (m *mcastState) setConfigs(c MulticastGroupConfigurations) {
+	if c != (MulticastGroupConfigurations{}) {
+		c.validate()
+	}
+
+	m.cleanup()
+	m.configs = c
+	m.igmp.enabled = c.EnableIGMP
+	m.mld.enabled = c.EnableMLD
+
+	for _, protocol := range []tcpip.NetworkProtocolNumber{header.IPv4ProtocolNumber, header.IPv6ProtocolNumber} {
+		p, _, allHosts := m.protocolState(protocol)
+		if !p.enabled {
+			continue
+		}
+
+		// General queries are sent to the all-systems or all-nodes
+		// group.
+		p.allHostsJoined = m.nic.joinGroupLocked(protocol, allHosts) == nil
+		for id := range m.nic.mcastJoins {
+			if ref := m.nic.endpoints[id]; ref != nil && ref.protocol == protocol {
+				m.groupJoined(protocol, id.LocalAddress)
+			}
+		}
+	}
+}
+
+// cleanup stops all IGMP and MLD activity on the NIC, without telling routers
+// about it.
+//
+// The NIC's mu must be locked.
+func (m *mcastState) cleanup() {
+	for _, protocol := range []tcpip.NetworkProtocolNumber{header.IPv4ProtocolNumber, header.IPv6ProtocolNumber} {
+		p, _, allHosts := m.protocolState(protocol)
+		for addr, g := range p.groups {
+			if g.timer != nil {
+				g.timer.Stop()
+			}
+			delete(p.groups, addr)
+		}
+		p.olderQuerierUntil = [newestIGMPVersion - 1]time.Time{}
+		p.enabled = false
+		if p.allHostsJoined {
+			p.allHostsJoined = false
+			m.nic.leaveGroupLocked(allHosts)
+		}
+	}
+}
+
+// groupJoined is called when the NIC joins the multicast group addr. It sends
+// the unsolicited reports of the group (RFC 3376 section 5.1 and RFC 3810
+// section 6.1).
+//
+// The NIC's mu must be locked.
+func (m *mcastState) groupJoined(protocol tcpip.NetworkProtocolNumber, addr tcpip.Address) {
+	p, _, _ := m.protocolState(protocol)
+	if p == nil || !p.enabled || !isReportedGroup(protocol, addr) {
+		return
+	}
+
+	g := &mcastGroupState{
+		unsolicited: m.configs.RobustnessVariable,
+	}
+	p.groups[addr] = g
+	m.sendGroupReport(protocol, addr, g)
+}
+
+// groupLeft is called when the NIC leaves the multicast group addr. It tells
+// routers that the NIC is no longer a member of the group.
+//
+// The NIC's mu must be locked.
+func (m *mcastState) groupLeft(protocol tcpip.NetworkProtocolNumber, addr tcpip.Address) {
+	p, _, _ := m.protocolState(protocol)
+	if p == nil {
+		return
+	}
+	g, ok := p.groups[addr]
+	if !ok {
+		return
+	}
+	if g.timer != nil {
+		g.timer.Stop()
+	}
+	delete(p.groups, addr)
+
+	switch protocol {
+	case header.IPv4ProtocolNumber:
+		switch m.version(protocol) {
+		case 1:
+			// IGMPv1 has no leave message.
+		case 2:
+			if g.lastReporter {
+				m.nic.sendIGMPLeave(addr)
+			}
+		default:
+			m.nic.sendIGMPv3Report(addr, header.GroupRecordChangeToIncludeMode)
+		}
+	case header.IPv6ProtocolNumber:
+		switch m.version(protocol) {
+		case 1:
+			if g.lastReporter {
+				m.nic.sendMLDv1Message(header.ICMPv6MulticastListenerDone, header.IPv6AllRoutersMulticastAddress, addr)
+			}
+		default:
+			m.nic.sendMLDv2Report(addr, header.GroupRecordChangeToIncludeMode)
+		}
+	}
+}
+
+// sendGroupReport sends a report for the group addr, and schedules the next
+// unsolicited one if any is left. Unsolicited reports are state-change reports
+// in IGMPv3 and MLDv2, other reports describe the current state.
+//
+// The NIC's mu must be locked.
+func (m *mcastState) sendGroupReport(protocol tcpip.NetworkProtocolNumber, addr tcpip.Address, g *mcastGroupState) {
+	g.timer = nil
+	recordType := header.GroupRecordModeIsExclude
+	if g.unsolicited > 0 {
+		recordType = header.GroupRecordChangeToExcludeMode
+		g.unsolicited--
+	}
+
+	switch protocol {
+	case header.IPv4ProtocolNumber:
+		switch m.version(protocol) {
+		case 1:
+			m.nic.sendIGMPv1v2Report(header.IGMPv1MembershipReport, addr)
+		case 2:
+			m.nic.sendIGMPv1v2Report(header.IGMPv2MembershipReport, addr)
+		default:
+			m.nic.sendIGMPv3Report(addr, recordType)
+		}
+	case header.IPv6ProtocolNumber:
+		switch m.version(protocol) {
+		case 1:
+			m.nic.sendMLDv1Message(header.ICMPv6MulticastListenerReport, addr, addr)
+		default:
+			m.nic.sendMLDv2Report(addr, recordType)
+		}
+	}
+	g.lastReporter = true
+
+	if g.unsolicited > 0 {
+		m.scheduleGroupReport(protocol, addr, g, m.configs.UnsolicitedReportInterval)
+	}
+}
+
+// scheduleGroupReport schedules a report for the group addr after a random
+// delay lower than maxDelay, unless one is already pending that would be sent
+// sooner.
+//
+// The NIC's mu must be locked.
+func (m *mcastState) scheduleGroupReport(protocol tcpip.NetworkProtocolNumber, addr tcpip.Address, g *mcastGroupState, maxDelay time.Duration) {
+	var delay time.Duration
+	if maxDelay > 0 {
+		delay = time.Duration(rand.Int63n(int64(maxDelay)))
+	}
+	deadline := time.Now().Add(delay)
+	if g.timer != nil {
+		if !g.deadline.After(deadline) {
+			return
+		}
+		g.timer.Stop()
+	}
+
+	p, _, _ := m.protocolState(protocol)
+	var t *time.Timer
+	t = time.AfterFunc(delay, func() {
+		m.nic.mu.Lock()
+		defer m.nic.mu.Unlock()
+		if p.groups[addr] != g || g.timer != t {
+			return
+		}
+		m.sendGroupReport(protocol, addr, g)
+	})
+	g.timer = t
+	g.deadline = deadline
+}
+
+// handleQuery processes a query of the given version of the multicast group
+// management protocol of protocol. group is the queried group, or the
+// unspecified address for general queries, and reports must be sent within
+// maxRespTime.
+//
+// The NIC's mu must be locked.
+func (m *mcastState) handleQuery(protocol tcpip.NetworkProtocolNumber, group tcpip.Address, maxRespTime time.Duration, version uint8) {
+	p, newest, _ := m.protocolState(protocol)
+	if p == nil || !p.enabled || version == 0 || version > newest {
+		return
+	}
+
+	if version < newest {
+		prev := m.version(protocol)
+		p.olderQuerierUntil[version-1] = time.Now().Add(time.Duration(m.configs.RobustnessVariable)*defaultQueryInterval + defaultQueryResponseInterval)
+
+		// Pending reports are canceled when the version used
+		// changes (RFC 3376 section 7.2.1 and RFC 3810 section
+		// 8.2.1).
+		if m.version(protocol) != prev {
+			for _, g := range p.groups {
+				if g.timer != nil {
+					g.timer.Stop()
+					g.timer = nil
+				}
+				g.unsolicited = 0
+			}
+		}
+	}
+
+	if len(group) == 0 || group == header.IPv4Any || group == header.IPv6Any {
+		for addr, g := range p.groups {
+			m.scheduleGroupReport(protocol, addr, g, maxRespTime)
+		}
+		return
+	}
+	if g, ok := p.groups[group]; ok {
+		m.scheduleGroupReport(protocol, group, g, maxRespTime)
+	}
+}
+
+// handleReport processes a report for group sent by another host. In IGMPv1,
+// IGMPv2 and MLDv1, it suppresses the pending report of the NIC, as routers
+// only need to learn about one member of each group (RFC 2236 section 3 and
+// RFC 2710 section 4).
+//
+// The NIC's mu must be locked.
+func (m *mcastState) handleReport(protocol tcpip.NetworkProtocolNumber, group tcpip.Address) {
+	p, newest, _ := m.protocolState(protocol)
+	if p == nil || !p.enabled || m.version(protocol) == newest {
+		return
+	}
+	g, ok := p.groups[group]
+	if !ok {
+		return
+	}
+	if g.timer != nil {
+		g.timer.Stop()
+		g.timer = nil
+	}
+	g.unsolicited = 0
+	g.lastReporter = false
+}
+
+// mcastSourceAddress returns the source address of the IGMP or MLD messages
+// sent by n. IGMP messages are sent from a primary IPv4 address of the NIC,
+// and MLD messages from a link-local address. The unspecified address is used
+// if there is none (RFC 3376 section 4.2.13 and RFC 3590 section 4).
+//
+// n.mu must be locked.
+func (n *NIC) mcastSourceAddress(protocol tcpip.NetworkProtocolNumber) tcpip.Address {
+	if protocol == header.IPv4ProtocolNumber {
+		if list := n.primary[protocol]; list != nil {
+			for e := list.Front(); e != nil; e = e.Next() {
+				r := e.(*referencedNetworkEndpoint)
+				switch r.ep.ID().LocalAddress {
+				case header.IPv4Broadcast, header.IPv4Any:
+					continue
+				}
+				if r.holdsInsertRef && !r.tentative {
+					return r.ep.ID().LocalAddress
+				}
+			}
+		}
+		return header.IPv4Any
+	}
+
+	for id, ref := range n.endpoints {
+		if ref.protocol == header.IPv6ProtocolNumber && ref.holdsInsertRef && !ref.tentative && header.IsV6LinkLocalAddress(id.LocalAddress) {
+			return id.LocalAddress
+		}
+	}
+	return header.IPv6Any
+}
+
+// sendIGMPv1v2Report sends an IGMPv1 or IGMPv2 Membership Report for group,
+// which is sent to the group itself.
+//
+// n.mu must be locked.
+func (n *NIC) sendIGMPv1v2Report(typ header.IGMPType, group tcpip.Address) {
+	msg := header.IGMP(make([]byte, header.IGMPMinimumSize))
+	msg.SetType(typ)
+	msg.SetGroupAddress(group)
+	if n.sendIGMPPacket(group, msg) != nil {
+		return
+	}
+	if typ == header.IGMPv1MembershipReport {
+		n.stack.stats.IGMP.PacketsSent.V1MembershipReport.Increment()
+	} else {
+		n.stack.stats.IGMP.PacketsSent.V2MembershipReport.Increment()
+	}
+}
+
+// sendIGMPLeave sends an IGMPv2 Leave Group message for group to the
+// all-routers multicast group.
+//
+// n.mu must be locked.
+func (n *NIC) sendIGMPLeave(group tcpip.Address) {
+	msg := header.IGMP(make([]byte, header.IGMPMinimumSize))
+	msg.SetType(header.IGMPLeaveGroup)
+	msg.SetGroupAddress(group)
+	if n.sendIGMPPacket(header.IPv4AllRoutersMulticastAddress, msg) == nil {
+		n.stack.stats.IGMP.PacketsSent.LeaveGroup.Increment()
+	}
+}
+
+// sendIGMPv3Report sends an IGMPv3 Membership Report with a single group
+// record for group, with no sources, to the IGMPv3 routers multicast group.
+//
+// n.mu must be locked.
+func (n *NIC) sendIGMPv3Report(group tcpip.Address, recordType header.GroupRecordType) {
+	msg := make([]byte, header.IGMPv3ReportMinimumSize+header.IGMPv3GroupRecordMinimumSize)
+	header.IGMP(msg).SetType(header.IGMPv3MembershipReport)
+	report := header.IGMPv3Report(msg)
+	report.SetNumberOfGroupRecords(1)
+	record := header.IGMPv3GroupRecord(report.GroupRecords())
+	record.SetRecordType(recordType)
+	record.SetMulticastAddress(group)
+	if n.sendIGMPPacket(header.IGMPv3RoutersMulticastAddress, msg) == nil {
+		n.stack.stats.IGMP.PacketsSent.V3MembershipReport.Increment()
+	}
+}
+
+// sendMLDv1Message sends an MLDv1 message of type typ for group to dst.
+//
+// n.mu must be locked.
+func (n *NIC) sendMLDv1Message(typ header.ICMPv6Type, dst, group tcpip.Address) {
+	body := header.MLD(make([]byte, header.MLDMinimumSize))
+	body.SetMulticastAddress(group)
+	if n.sendMLDPacket(dst, typ, body) != nil {
+		return
+	}
+	if typ == header.ICMPv6MulticastListenerReport {
+		n.stack.stats.ICMP.V6PacketsSent.MulticastListenerReport.Increment()
+	} else {
+		n.stack.stats.ICMP.V6PacketsSent.MulticastListenerDone.Increment()
+	}
+}
+
+// sendMLDv2Report sends an MLDv2 report with a single multicast address record
+// for group, with no sources, to the MLDv2 routers multicast group.
+//
+// n.mu must be locked.
+func (n *NIC) sendMLDv2Report(group tcpip.Address, recordType header.GroupRecordType) {
+	body := header.MLDv2Report(make([]byte, header.MLDv2ReportMinimumSize+header.MLDv2AddressRecordMinimumSize))
+	body.SetNumberOfAddressRecords(1)
+	record := header.MLDv2AddressRecord(body.AddressRecords())
+	record.SetRecordType(recordType)
+	record.SetMulticastAddress(group)
+	if n.sendMLDPacket(header.IPv6AllMLDv2RoutersMulticastAddress, header.ICMPv6MulticastListenerV2Report, body) == nil {
+		n.stack.stats.ICMP.V6PacketsSent.MulticastListenerV2Report.Increment()
+	}
+}
+
+// sendIGMPPacket sends the IGMP message msg, whose checksum is computed, to
+// the multicast group dst. IGMP messages are sent with a TTL of 1 and with the
+// Router Alert option (RFC 2236 section 2 and RFC 3376 section 4).
+//
+// Like NDP messages, IGMP messages are written to the link endpoint directly,
+// so they can be sent while the NIC's mu is locked.
+func (n *NIC) sendIGMPPacket(dst tcpip.Address, msg []byte) *tcpip.Error {
+	src := n.mcastSourceAddress(header.IPv4ProtocolNumber)
+	r := &Route{
+		NetProto:          header.IPv4ProtocolNumber,
+		LocalAddress:      src,
+		LocalLinkAddress:  n.linkEP.LinkAddress(),
+		RemoteAddress:     dst,
+		RemoteLinkAddress: header.EthernetAddressFromMulticastIPv4Address(dst),
+	}
+
+	hlen := header.IPv4MinimumSize + header.IPv4RouterAlertOptionSize
+	hdr := buffer.NewPrependable(int(n.linkEP.MaxHeaderLength()) + hlen + len(msg))
+	pkt := header.IGMP(hdr.Prepend(len(msg)))
+	copy(pkt, msg)
+	pkt.SetChecksum(^header.Checksum(pkt, 0))
+
+	ip := header.IPv4(hdr.Prepend(hlen))
+	ip.Encode(&header.IPv4Fields{
+		IHL:         uint8(hlen),
+		TotalLength: uint16(hdr.UsedLength()),
+		TTL:         header.IGMPTTL,
+		Protocol:    uint8(header.IGMPProtocolNumber),
+		SrcAddr:     src,
+		DstAddr:     dst,
+	})
+	copy(ip[header.IPv4MinimumSize:], []byte{header.IPv4RouterAlertOption, header.IPv4RouterAlertOptionSize, 0, 0})
+	ip.SetChecksum(^ip.CalculateChecksum())
+
+	if err := n.linkEP.WritePacket(r, nil /* gso */, hdr, buffer.VectorisedView{}, header.IPv4ProtocolNumber); err != nil {
+		n.stack.stats.IP.OutgoingPacketErrors.Increment()
+		n.stack.stats.IGMP.PacketsSent.Dropped.Increment()
+		return err
+	}
+	n.stack.stats.IP.PacketsSent.Increment()
+	n.stats.Tx.Packets.Increment()
+	n.stats.Tx.Bytes.IncrementBy(uint64(hdr.UsedLength()))
+	return nil
+}
+
+// sendMLDPacket sends an MLD message of type typ to the multicast address
+// dst. body holds the message after the ICMPv6 header. MLD messages are sent
+// with a hop limit of 1 and with the Router Alert option in a Hop-by-Hop
+// Options header (RFC 2710 section 3 and RFC 3810 section 5).
+//
+// Like NDP messages, MLD messages are written to the link endpoint directly,
+// so they can be sent while the NIC's mu is locked.
+func (n *NIC) sendMLDPacket(dst tcpip.Address, typ header.ICMPv6Type, body []byte) *tcpip.Error {
+	src := n.mcastSourceAddress(header.IPv6ProtocolNumber)
+	r := &Route{
+		NetProto:          header.IPv6ProtocolNumber,
+		LocalAddress:      src,
+		LocalLinkAddress:  n.linkEP.LinkAddress(),
+		RemoteAddress:     dst,
+		RemoteLinkAddress: header.EthernetAddressFromMulticastIPv6Address(dst),
+	}
+
+	// The Hop-by-Hop Options header holds the Router Alert option, with
+	// the value for MLD messages, padded to 8 bytes with a PadN option.
+	hopByHop := []byte{
+		uint8(header.ICMPv6ProtocolNumber), 0,
+		header.IPv6RouterAlertOption, 2, 0, 0,
+		header.IPv6PadNOption, 0,
+	}
+
+	hdr := buffer.NewPrependable(int(n.linkEP.MaxHeaderLength()) + header.IPv6MinimumSize + len(hopByHop) + header.ICMPv6MinimumSize + len(body))
+	pkt := header.ICMPv6(hdr.Prepend(header.ICMPv6MinimumSize + len(body)))
+	pkt.SetType(typ)
+	copy(pkt[header.ICMPv6MinimumSize:], body)
+	pkt.SetChecksum(header.ICMPv6Checksum(pkt, src, dst, buffer.VectorisedView{}))
+	copy(hdr.Prepend(len(hopByHop)), hopByHop)
+
+	length := uint16(hdr.UsedLength())
+	ip := header.IPv6(hdr.Prepend(header.IPv6MinimumSize))
+	ip.Encode(&header.IPv6Fields{
+		PayloadLength: length,
+		NextHeader:    header.IPv6HopByHopOptionsHeader,
+		HopLimit:      header.MLDHopLimit,
+		SrcAddr:       src,
+		DstAddr:       dst,
+	})
+
+	if err := n.linkEP.WritePacket(r, nil /* gso */, hdr, buffer.VectorisedView{}, header.IPv6ProtocolNumber); err != nil {
+		n.stack.stats.IP.OutgoingPacketErrors.Increment()
+		n.stack.stats.ICMP.V6PacketsSent.Dropped.Increment()
+		return err
+	}
+	n.stack.stats.IP.PacketsSent.Increment()
+	n.stats.Tx.Packets.Increment()
+	n.stats.Tx.Bytes.IncrementBy(uint64(hdr.UsedLength()))
+	return nil
+}
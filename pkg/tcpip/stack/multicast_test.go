@@ -0,0 +1,413 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack_test
+
+import (
+	"testing"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/channel"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	// mcastLocalV4Addr is 10.0.0.2, the address of the tested NIC.
+	mcastLocalV4Addr = tcpip.Address("\x0a\x00\x00\x02")
+
+	// mcastRouterV4Addr and mcastOtherV4Addr are 10.0.0.1 and 10.0.0.3,
+	// the addresses of a router and of another host on the link.
+	mcastRouterV4Addr = tcpip.Address("\x0a\x00\x00\x01")
+	mcastOtherV4Addr  = tcpip.Address("\x0a\x00\x00\x03")
+
+	// mcastV4Group is 239.1.2.3.
+	mcastV4Group = tcpip.Address("\xef\x01\x02\x03")
+
+	// mcastV6Group is ff0e::101, a global scope group.
+	mcastV6Group = tcpip.Address("\xff\x0e\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\x01")
+)
+
+func newMcastTestStack(t *testing.T, c stack.MulticastGroupConfigurations) (*stack.Stack, *channel.Endpoint) {
+	t.Helper()
+
+	s := stack.New([]string{ipv4.ProtocolName, ipv6.ProtocolName}, nil, stack.Options{MulticastGroupConfigs: c})
+	id, e := channel.New(10, 1280, ndpLinkAddr1)
+	if err := s.CreateNIC(1, id); err != nil {
+		t.Fatalf("CreateNIC(_) = %s", err)
+	}
+	if err := s.AddAddress(1, header.IPv4ProtocolNumber, mcastLocalV4Addr); err != nil {
+		t.Fatalf("AddAddress(_) = %s", err)
+	}
+	if err := s.AddAddress(1, header.IPv6ProtocolNumber, ndpLLAddr1); err != nil {
+		t.Fatalf("AddAddress(_) = %s", err)
+	}
+	return s, e
+}
+
+func readMcastPacket(t *testing.T, e *channel.Endpoint, proto tcpip.NetworkProtocolNumber) []byte {
+	t.Helper()
+
+	var p channel.PacketInfo
+	select {
+	case p = <-e.C:
+	case <-time.After(ndpTestTimeout):
+		t.Fatalf("timed out waiting for a packet of protocol %d", proto)
+	}
+	if p.Proto != proto {
+		t.Fatalf("got protocol = %d, want = %d", p.Proto, proto)
+	}
+	return append(p.Header, p.Payload...)
+}
+
+// readIGMPPacket reads an IGMP message written by the stack and checks its
+// IPv4 header.
+func readIGMPPacket(t *testing.T, e *channel.Endpoint, dst tcpip.Address, typ header.IGMPType) header.IGMP {
+	t.Helper()
+
+	ip := header.IPv4(readMcastPacket(t, e, header.IPv4ProtocolNumber))
+	if !ip.IsValid(len(ip)) {
+		t.Fatalf("got invalid IPv4 header")
+	}
+	if got := ip.SourceAddress(); got != mcastLocalV4Addr {
+		t.Errorf("got source = %s, want = %s", got, mcastLocalV4Addr)
+	}
+	if got := ip.DestinationAddress(); got != dst {
+		t.Errorf("got destination = %s, want = %s", got, dst)
+	}
+	if got := ip.TTL(); got != header.IGMPTTL {
+		t.Errorf("got TTL = %d, want = %d", got, header.IGMPTTL)
+	}
+	if got := tcpip.TransportProtocolNumber(ip.Protocol()); got != header.IGMPProtocolNumber {
+		t.Fatalf("got protocol = %d, want = %d", got, header.IGMPProtocolNumber)
+	}
+	if got := int(ip.HeaderLength()); got != header.IPv4MinimumSize+header.IPv4RouterAlertOptionSize {
+		t.Fatalf("got header length = %d, want = %d", got, header.IPv4MinimumSize+header.IPv4RouterAlertOptionSize)
+	}
+	if got := ip[header.IPv4MinimumSize]; got != header.IPv4RouterAlertOption {
+		t.Errorf("got IPv4 option = %d, want = %d", got, header.IPv4RouterAlertOption)
+	}
+	if got := ip.CalculateChecksum(); got != 0xffff {
+		t.Errorf("got IPv4 checksum = %#x, want = 0xffff", got)
+	}
+
+	pkt := header.IGMP(ip.Payload())
+	if got := header.Checksum(pkt, 0); got != 0xffff {
+		t.Errorf("got IGMP checksum = %#x, want = 0xffff", got)
+	}
+	if got := pkt.Type(); got != typ {
+		t.Fatalf("got IGMP type = %#x, want = %#x", got, typ)
+	}
+	return pkt
+}
+
+// checkIGMPv3Report checks that the IGMPv3 report r has a single group record
+// of the given type for group.
+func checkIGMPv3Report(t *testing.T, r header.IGMPv3Report, recordType header.GroupRecordType, group tcpip.Address) {
+	t.Helper()
+
+	if got := r.NumberOfGroupRecords(); got != 1 {
+		t.Fatalf("got %d group records, want = 1", got)
+	}
+	record := header.IGMPv3GroupRecord(r.GroupRecords())
+	if got := record.RecordType(); got != recordType {
+		t.Errorf("got record type = %d, want = %d", got, recordType)
+	}
+	if got := record.MulticastAddress(); got != group {
+		t.Errorf("got record address = %s, want = %s", got, group)
+	}
+}
+
+// igmpPacket returns an IPv4 packet carrying an IGMP message.
+func igmpPacket(src, dst tcpip.Address, msg []byte) buffer.VectorisedView {
+	hdr := buffer.NewPrependable(header.IPv4MinimumSize + len(msg))
+	pkt := header.IGMP(hdr.Prepend(len(msg)))
+	copy(pkt, msg)
+	pkt.SetChecksum(^header.Checksum(pkt, 0))
+	ip := header.IPv4(hdr.Prepend(header.IPv4MinimumSize))
+	ip.Encode(&header.IPv4Fields{
+		IHL:         header.IPv4MinimumSize,
+		TotalLength: uint16(hdr.UsedLength()),
+		TTL:         header.IGMPTTL,
+		Protocol:    uint8(header.IGMPProtocolNumber),
+		SrcAddr:     src,
+		DstAddr:     dst,
+	})
+	ip.SetChecksum(^ip.CalculateChecksum())
+	return hdr.View().ToVectorisedView()
+}
+
+// igmpv1v2Message returns an IGMPv1 or IGMPv2 message.
+func igmpv1v2Message(typ header.IGMPType, maxRespCode uint8, group tcpip.Address) []byte {
+	msg := header.IGMP(make([]byte, header.IGMPMinimumSize))
+	msg.SetType(typ)
+	msg.SetMaxRespCode(maxRespCode)
+	msg.SetGroupAddress(group)
+	return msg
+}
+
+// readMLDPacket reads an MLD message written by the stack and checks its IPv6
+// and Hop-by-Hop Options headers.
+func readMLDPacket(t *testing.T, e *channel.Endpoint, dst tcpip.Address, typ header.ICMPv6Type) []byte {
+	t.Helper()
+
+	ip := header.IPv6(readMcastPacket(t, e, header.IPv6ProtocolNumber))
+	if got := ip.SourceAddress(); got != ndpLLAddr1 {
+		t.Errorf("got source = %s, want = %s", got, ndpLLAddr1)
+	}
+	if got := ip.DestinationAddress(); got != dst {
+		t.Errorf("got destination = %s, want = %s", got, dst)
+	}
+	if got := ip.HopLimit(); got != header.MLDHopLimit {
+		t.Errorf("got hop limit = %d, want = %d", got, header.MLDHopLimit)
+	}
+	if got := ip.NextHeader(); got != header.IPv6HopByHopOptionsHeader {
+		t.Fatalf("got next header = %d, want = %d", got, header.IPv6HopByHopOptionsHeader)
+	}
+	opts := ip.Payload()
+	if got := tcpip.TransportProtocolNumber(opts[0]); got != header.ICMPv6ProtocolNumber {
+		t.Fatalf("got Hop-by-Hop next header = %d, want = %d", got, header.ICMPv6ProtocolNumber)
+	}
+	if got := opts[2]; got != header.IPv6RouterAlertOption {
+		t.Errorf("got Hop-by-Hop option = %d, want = %d", got, header.IPv6RouterAlertOption)
+	}
+	hlen := 8 * (int(opts[1]) + 1)
+
+	pkt := header.ICMPv6(opts[hlen:])
+	if got, want := pkt.Checksum(), header.ICMPv6Checksum(pkt, ndpLLAddr1, dst, buffer.VectorisedView{}); got != want {
+		t.Errorf("got ICMPv6 checksum = %#x, want = %#x", got, want)
+	}
+	if got := pkt.Type(); got != typ {
+		t.Fatalf("got ICMPv6 type = %d, want = %d", got, typ)
+	}
+	return pkt[header.ICMPv6MinimumSize:]
+}
+
+// checkMLDv2Report checks that the MLDv2 report body r has a single multicast
+// address record of the given type for group.
+func checkMLDv2Report(t *testing.T, r header.MLDv2Report, recordType header.GroupRecordType, group tcpip.Address) {
+	t.Helper()
+
+	if got := r.NumberOfAddressRecords(); got != 1 {
+		t.Fatalf("got %d address records, want = 1", got)
+	}
+	record := header.MLDv2AddressRecord(r.AddressRecords())
+	if got := record.RecordType(); got != recordType {
+		t.Errorf("got record type = %d, want = %d", got, recordType)
+	}
+	if got := record.MulticastAddress(); got != group {
+		t.Errorf("got record address = %s, want = %s", got, group)
+	}
+}
+
+// mldPacket returns an IPv6 packet carrying an MLD message, with a Router
+// Alert option in a Hop-by-Hop Options header.
+func mldPacket(src, dst tcpip.Address, typ header.ICMPv6Type, body []byte) buffer.VectorisedView {
+	hopByHop := []byte{uint8(header.ICMPv6ProtocolNumber), 0, header.IPv6RouterAlertOption, 2, 0, 0, header.IPv6PadNOption, 0}
+	hdr := buffer.NewPrependable(header.IPv6MinimumSize + len(hopByHop) + header.ICMPv6MinimumSize + len(body))
+	pkt := header.ICMPv6(hdr.Prepend(header.ICMPv6MinimumSize + len(body)))
+	pkt.SetType(typ)
+	copy(pkt[header.ICMPv6MinimumSize:], body)
+	pkt.SetChecksum(header.ICMPv6Checksum(pkt, src, dst, buffer.VectorisedView{}))
+	copy(hdr.Prepend(len(hopByHop)), hopByHop)
+	payloadLength := hdr.UsedLength()
+	ip := header.IPv6(hdr.Prepend(header.IPv6MinimumSize))
+	ip.Encode(&header.IPv6Fields{
+		PayloadLength: uint16(payloadLength),
+		NextHeader:    header.IPv6HopByHopOptionsHeader,
+		HopLimit:      header.MLDHopLimit,
+		SrcAddr:       src,
+		DstAddr:       dst,
+	})
+	return hdr.View().ToVectorisedView()
+}
+
+func TestIGMPv3JoinLeave(t *testing.T) {
+	s, e := newMcastTestStack(t, stack.MulticastGroupConfigurations{
+		EnableIGMP:                true,
+		RobustnessVariable:        2,
+		UnsolicitedReportInterval: 10 * time.Millisecond,
+	})
+
+	if err := s.JoinGroup(header.IPv4ProtocolNumber, 1, mcastV4Group); err != nil {
+		t.Fatalf("JoinGroup(_) = %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		pkt := readIGMPPacket(t, e, header.IGMPv3RoutersMulticastAddress, header.IGMPv3MembershipReport)
+		checkIGMPv3Report(t, header.IGMPv3Report(pkt), header.GroupRecordChangeToExcludeMode, mcastV4Group)
+	}
+
+	// Joining the group again only takes a reference.
+	if err := s.JoinGroup(header.IPv4ProtocolNumber, 1, mcastV4Group); err != nil {
+		t.Fatalf("JoinGroup(_) = %s", err)
+	}
+	if err := s.LeaveGroup(header.IPv4ProtocolNumber, 1, mcastV4Group); err != nil {
+		t.Fatalf("LeaveGroup(_) = %s", err)
+	}
+	if got := e.Drain(); got != 0 {
+		t.Errorf("got %d packets sent while still a member, want = 0", got)
+	}
+
+	if err := s.LeaveGroup(header.IPv4ProtocolNumber, 1, mcastV4Group); err != nil {
+		t.Fatalf("LeaveGroup(_) = %s", err)
+	}
+	pkt := readIGMPPacket(t, e, header.IGMPv3RoutersMulticastAddress, header.IGMPv3MembershipReport)
+	checkIGMPv3Report(t, header.IGMPv3Report(pkt), header.GroupRecordChangeToIncludeMode, mcastV4Group)
+
+	if err := s.LeaveGroup(header.IPv4ProtocolNumber, 1, mcastV4Group); err != tcpip.ErrBadLocalAddress {
+		t.Errorf("got LeaveGroup(_) = %v, want = %s", err, tcpip.ErrBadLocalAddress)
+	}
+	if got := s.Stats().IGMP.PacketsSent.V3MembershipReport.Value(); got != 3 {
+		t.Errorf("got V3MembershipReport sent = %d, want = 3", got)
+	}
+}
+
+func TestIGMPv2Querier(t *testing.T) {
+	s, e := newMcastTestStack(t, stack.MulticastGroupConfigurations{
+		EnableIGMP:         true,
+		RobustnessVariable: 1,
+	})
+
+	if err := s.JoinGroup(header.IPv4ProtocolNumber, 1, mcastV4Group); err != nil {
+		t.Fatalf("JoinGroup(_) = %s", err)
+	}
+	readIGMPPacket(t, e, header.IGMPv3RoutersMulticastAddress, header.IGMPv3MembershipReport)
+
+	// An IGMPv2 general query, with a max response time of 100ms, makes
+	// the stack switch to IGMPv2.
+	e.Inject(header.IPv4ProtocolNumber, igmpPacket(mcastRouterV4Addr, header.IPv4AllSystemsMulticastAddress, igmpv1v2Message(header.IGMPMembershipQuery, 1, header.IPv4Any)))
+	pkt := readIGMPPacket(t, e, mcastV4Group, header.IGMPv2MembershipReport)
+	if got := pkt.GroupAddress(); got != mcastV4Group {
+		t.Errorf("got group = %s, want = %s", got, mcastV4Group)
+	}
+
+	if err := s.LeaveGroup(header.IPv4ProtocolNumber, 1, mcastV4Group); err != nil {
+		t.Fatalf("LeaveGroup(_) = %s", err)
+	}
+	pkt = readIGMPPacket(t, e, header.IPv4AllRoutersMulticastAddress, header.IGMPLeaveGroup)
+	if got := pkt.GroupAddress(); got != mcastV4Group {
+		t.Errorf("got group = %s, want = %s", got, mcastV4Group)
+	}
+
+	if got := s.Stats().IGMP.PacketsReceived.MembershipQuery.Value(); got != 1 {
+		t.Errorf("got MembershipQuery received = %d, want = 1", got)
+	}
+}
+
+func TestIGMPv2ReportSuppression(t *testing.T) {
+	s, e := newMcastTestStack(t, stack.MulticastGroupConfigurations{
+		EnableIGMP:         true,
+		RobustnessVariable: 1,
+	})
+
+	if err := s.JoinGroup(header.IPv4ProtocolNumber, 1, mcastV4Group); err != nil {
+		t.Fatalf("JoinGroup(_) = %s", err)
+	}
+	readIGMPPacket(t, e, header.IGMPv3RoutersMulticastAddress, header.IGMPv3MembershipReport)
+
+	// The report of another member cancels the pending report, and the
+	// stack no longer needs to tell the router when it leaves.
+	e.Inject(header.IPv4ProtocolNumber, igmpPacket(mcastRouterV4Addr, header.IPv4AllSystemsMulticastAddress, igmpv1v2Message(header.IGMPMembershipQuery, 255, header.IPv4Any)))
+	e.Inject(header.IPv4ProtocolNumber, igmpPacket(mcastOtherV4Addr, mcastV4Group, igmpv1v2Message(header.IGMPv2MembershipReport, 0, mcastV4Group)))
+	if err := s.LeaveGroup(header.IPv4ProtocolNumber, 1, mcastV4Group); err != nil {
+		t.Fatalf("LeaveGroup(_) = %s", err)
+	}
+	if got := e.Drain(); got != 0 {
+		t.Errorf("got %d packets sent after another member reported, want = 0", got)
+	}
+	if got := s.Stats().IGMP.PacketsReceived.V2MembershipReport.Value(); got != 1 {
+		t.Errorf("got V2MembershipReport received = %d, want = 1", got)
+	}
+}
+
+func TestMLDv2JoinLeave(t *testing.T) {
+	s, e := newMcastTestStack(t, stack.MulticastGroupConfigurations{
+		EnableMLD:          true,
+		RobustnessVariable: 1,
+	})
+
+	if err := s.JoinGroup(header.IPv6ProtocolNumber, 1, mcastV6Group); err != nil {
+		t.Fatalf("JoinGroup(_) = %s", err)
+	}
+	body := readMLDPacket(t, e, header.IPv6AllMLDv2RoutersMulticastAddress, header.ICMPv6MulticastListenerV2Report)
+	checkMLDv2Report(t, header.MLDv2Report(body), header.GroupRecordChangeToExcludeMode, mcastV6Group)
+
+	if err := s.LeaveGroup(header.IPv6ProtocolNumber, 1, mcastV6Group); err != nil {
+		t.Fatalf("LeaveGroup(_) = %s", err)
+	}
+	body = readMLDPacket(t, e, header.IPv6AllMLDv2RoutersMulticastAddress, header.ICMPv6MulticastListenerV2Report)
+	checkMLDv2Report(t, header.MLDv2Report(body), header.GroupRecordChangeToIncludeMode, mcastV6Group)
+
+	if got := s.Stats().ICMP.V6PacketsSent.MulticastListenerV2Report.Value(); got != 2 {
+		t.Errorf("got MulticastListenerV2Report sent = %d, want = 2", got)
+	}
+}
+
+func TestMLDv1Querier(t *testing.T) {
+	s, e := newMcastTestStack(t, stack.MulticastGroupConfigurations{
+		EnableMLD:          true,
+		RobustnessVariable: 1,
+	})
+
+	if err := s.JoinGroup(header.IPv6ProtocolNumber, 1, mcastV6Group); err != nil {
+		t.Fatalf("JoinGroup(_) = %s", err)
+	}
+	readMLDPacket(t, e, header.IPv6AllMLDv2RoutersMulticastAddress, header.ICMPv6MulticastListenerV2Report)
+
+	// An MLDv1 general query, with a max response delay of 10ms, makes
+	// the stack switch to MLDv1.
+	query := header.MLD(make([]byte, header.MLDMinimumSize))
+	query.SetMaxRespCode(10)
+	e.Inject(header.IPv6ProtocolNumber, mldPacket(ndpLLAddr2, header.IPv6AllNodesMulticastAddress, header.ICMPv6MulticastListenerQuery, query))
+	body := readMLDPacket(t, e, mcastV6Group, header.ICMPv6MulticastListenerReport)
+	if got := header.MLD(body).MulticastAddress(); got != mcastV6Group {
+		t.Errorf("got multicast address = %s, want = %s", got, mcastV6Group)
+	}
+
+	if err := s.LeaveGroup(header.IPv6ProtocolNumber, 1, mcastV6Group); err != nil {
+		t.Fatalf("LeaveGroup(_) = %s", err)
+	}
+	body = readMLDPacket(t, e, header.IPv6AllRoutersMulticastAddress, header.ICMPv6MulticastListenerDone)
+	if got := header.MLD(body).MulticastAddress(); got != mcastV6Group {
+		t.Errorf("got multicast address = %s, want = %s", got, mcastV6Group)
+	}
+
+	if got := s.Stats().ICMP.V6PacketsReceived.MulticastListenerQuery.Value(); got != 1 {
+		t.Errorf("got MulticastListenerQuery received = %d, want = 1", got)
+	}
+}
+
+func TestMulticastGroupReportsDisabled(t *testing.T) {
+	s, e := newMcastTestStack(t, stack.MulticastGroupConfigurations{})
+
+	if err := s.JoinGroup(header.IPv4ProtocolNumber, 1, mcastV4Group); err != nil {
+		t.Fatalf("JoinGroup(_) = %s", err)
+	}
+	if err := s.JoinGroup(header.IPv6ProtocolNumber, 1, mcastV6Group); err != nil {
+		t.Fatalf("JoinGroup(_) = %s", err)
+	}
+	if err := s.LeaveGroup(header.IPv4ProtocolNumber, 1, mcastV4Group); err != nil {
+		t.Fatalf("LeaveGroup(_) = %s", err)
+	}
+	if err := s.LeaveGroup(header.IPv6ProtocolNumber, 1, mcastV6Group); err != nil {
+		t.Fatalf("LeaveGroup(_) = %s", err)
+	}
+	if got := e.Drain(); got != 0 {
+		t.Errorf("got %d packets sent with IGMP and MLD disabled, want = 0", got)
+	}
+}
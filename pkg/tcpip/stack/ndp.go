@@ -0,0 +1,787 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"math/rand"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+)
+
+const (
+	// defaultDupAddrDetectTransmits is the default number of NDP Neighbor
+	// Solicitation messages to send when doing Duplicate Address Detection
+	// for a tentative address.
+	//
+	// Default = 1 (from RFC 4862 section 5.1)
+	defaultDupAddrDetectTransmits = 1
+
+	// defaultRetransmitTimer is the default amount of time to wait between
+	// sending NDP Neighbor Solicitation messages.
+	//
+	// Default = 1s (from RFC 4861 section 10).
+	defaultRetransmitTimer = time.Second
+
+	// defaultMaxRtrSolicitations is the default number of Router
+	// Solicitation messages to send when a NIC becomes enabled.
+	//
+	// Default = 3 (from RFC 4861 section 10).
+	defaultMaxRtrSolicitations = 3
+
+	// defaultRtrSolicitationInterval is the default amount of time between
+	// sending Router Solicitation messages.
+	//
+	// Default = 4s (from 4861 section 10).
+	defaultRtrSolicitationInterval = 4 * time.Second
+
+	// defaultMaxRtrSolicitationDelay is the default maximum amount of time
+	// to wait before sending the first Router Solicitation message.
+	//
+	// Default = 1s (from 4861 section 10).
+	defaultMaxRtrSolicitationDelay = time.Second
+
+	// minimumRetransmitTimer is the minimum amount of time to wait between
+	// sending NDP Neighbor Solicitation messages. Note, RFC 4861 does not
+	// impose a minimum, but this keeps a misconfiguration from flooding
+	// the link.
+	minimumRetransmitTimer = time.Millisecond
+
+	// minPrefixValidLifetimeUpdate is the lifetime below which the valid
+	// lifetime of an autoconfigured address is never lowered by a Router
+	// Advertisement, as per RFC 4862 section 5.5.3.e.
+	minPrefixValidLifetimeUpdate = 2 * time.Hour
+
+	// slaacPrefixLength is the only prefix length usable for stateless
+	// address autoconfiguration, as interface identifiers derived from
+	// link-layer addresses are 64 bits long (RFC 4291 section 2.5.1).
+	slaacPrefixLength = 64
+)
+
+// NDPConfigurations is the NDP configurations for the netstack. The zero
+// value disables NDP.
+type NDPConfigurations struct {
+	// DupAddrDetectTransmits is the number of Neighbor Solicitation
+	// messages to send when doing Duplicate Address Detection for a
+	// tentative address. A value of 0 disables DAD, so addresses are
+	// assigned immediately.
+	DupAddrDetectTransmits uint8
+
+	// RetransmitTimer is the amount of time to wait between sending
+	// Neighbor Solicitation messages. Values lower than 1ms are replaced
+	// by the default, 1s.
+	RetransmitTimer time.Duration
+
+	// HandleRAs determines whether Router Advertisements are processed.
+	HandleRAs bool
+
+	// DiscoverDefaultRouters determines whether default routers are
+	// discovered from Router Advertisements. It only takes effect if
+	// HandleRAs is set.
+	DiscoverDefaultRouters bool
+
+	// DiscoverOnLinkPrefixes determines whether on-link prefixes are
+	// discovered from the Prefix Information options of Router
+	// Advertisements. It only takes effect if HandleRAs is set.
+	DiscoverOnLinkPrefixes bool
+
+	// AutoGenGlobalAddresses determines whether global addresses are
+	// generated from the Prefix Information options of Router
+	// Advertisements, as described in RFC 4862. It only takes effect if
+	// HandleRAs is set.
+	AutoGenGlobalAddresses bool
+
+	// MaxRtrSolicitations is the number of Router Solicitation messages to
+	// send when NDP is enabled on a NIC. A value of 0 disables router
+	// solicitation.
+	MaxRtrSolicitations uint8
+
+	// RtrSolicitationInterval is the amount of time to wait between
+	// sending Router Solicitation messages. Values lower than 1ms are
+	// replaced by the default, 4s.
+	RtrSolicitationInterval time.Duration
+
+	// MaxRtrSolicitationDelay is the maximum amount of time to wait before
+	// sending the first Router Solicitation message. Negative values are
+	// replaced by the default, 1s.
+	MaxRtrSolicitationDelay time.Duration
+}
+
+// DefaultNDPConfigurations returns an NDPConfigurations populated with the
+// default values from RFC 4861 and RFC 4862.
+func DefaultNDPConfigurations() NDPConfigurations {
+	return NDPConfigurations{
+		DupAddrDetectTransmits:  defaultDupAddrDetectTransmits,
+		RetransmitTimer:         defaultRetransmitTimer,
+		HandleRAs:               true,
+		DiscoverDefaultRouters:  true,
+		DiscoverOnLinkPrefixes:  true,
+		AutoGenGlobalAddresses:  true,
+		MaxRtrSolicitations:     defaultMaxRtrSolicitations,
+		RtrSolicitationInterval: defaultRtrSolicitationInterval,
+		MaxRtrSolicitationDelay: defaultMaxRtrSolicitationDelay,
+	}
+}
+
+// validate replaces invalid values of c with their defaults.
+func (c *NDPConfigurations) validate() {
+	if c.RetransmitTimer < minimumRetransmitTimer {
+		c.RetransmitTimer = defaultRetransmitTimer
+	}
+	if c.RtrSolicitationInterval < minimumRetransmitTimer {
+		c.RtrSolicitationInterval = defaultRtrSolicitationInterval
+	}
+	if c.MaxRtrSolicitationDelay < 0 {
+		c.MaxRtrSolicitationDelay = defaultMaxRtrSolicitationDelay
+	}
+}
+
+// ndpState is the per-NIC state of the Neighbor Discovery Protocol, RFC 4861,
+// and of IPv6 Stateless Address Autoconfiguration, RFC 4862.
+//
+// ndpState is protected by the mu of the NIC it belongs to. Timer callbacks
+// acquire it and check that the state they were created for is still current,
+// since a timer may fire after it has been stopped.
+type ndpState struct {
+	nic     *NIC
+	configs NDPConfigurations
+
+	// dad holds the tentative addresses undergoing Duplicate Address
+	// Detection.
+	dad map[tcpip.Address]*dadState
+
+	// defaultRouters holds the discovered default routers, in the order
+	// they were discovered.
+	defaultRouters []*defaultRouterState
+
+	// onLinkPrefixes holds the discovered on-link prefixes.
+	onLinkPrefixes map[tcpip.Subnet]*onLinkPrefixState
+
+	// autoGenAddrs holds the addresses generated by SLAAC, keyed by the
+	// prefix they were generated from.
+	autoGenAddrs map[tcpip.Subnet]*autoGenAddrState
+
+	// groups holds the multicast groups joined for NDP.
+	groups map[tcpip.Address]*ndpGroup
+
+	// rtrSolicit is the timer of the next Router Solicitation message, or
+	// nil if none is pending.
+	rtrSolicit *time.Timer
+}
+
+// dadState is the state of Duplicate Address Detection for a tentative
+// address.
+type dadState struct {
+	ref *referencedNetworkEndpoint
+
+	// remaining is the number of Neighbor Solicitation messages left to
+	// send.
+	remaining uint8
+
+	timer *time.Timer
+}
+
+// defaultRouterState is the state of a discovered default router.
+type defaultRouterState struct {
+	addr tcpip.Address
+
+	// timer invalidates the router when its lifetime expires.
+	timer *time.Timer
+}
+
+// onLinkPrefixState is the state of a discovered on-link prefix.
+type onLinkPrefixState struct {
+	// timer invalidates the prefix when its valid lifetime expires. It is
+	// nil if the lifetime is infinite.
+	timer *time.Timer
+}
+
+// autoGenAddrState is the state of an address generated by SLAAC.
+type autoGenAddrState struct {
+	ref *referencedNetworkEndpoint
+
+	// validUntil is when the address becomes invalid. It is the zero value
+	// if the valid lifetime is infinite.
+	validUntil time.Time
+
+	// timer invalidates the address when its valid lifetime expires. It is
+	// nil if the lifetime is infinite.
+	timer *time.Timer
+}
+
+// ndpGroup is a multicast group joined for NDP.
+type ndpGroup struct {
+	// refs is the number of addresses that need the group.
+	refs int
+
+	// joined is whether NDP holds a join of the group on the NIC.
+	joined bool
+}
+
+func newNDPState(nic *NIC) ndpState {
+	return ndpState{
+		nic:            nic,
+		dad:            make(map[tcpip.Address]*dadState),
+		onLinkPrefixes: make(map[tcpip.Subnet]*onLinkPrefixState),
+		autoGenAddrs:   make(map[tcpip.Subnet]*autoGenAddrState),
+		groups:         make(map[tcpip.Address]*ndpGroup),
+	}
+}
+
+// enabled returns whether NDP is enabled on the NIC.
+func (ndp *ndpState) enabled() bool {
+	return ndp.configs != NDPConfigurations{}
+}
+
+// isNDPAddress returns whether NDP manages addr: DAD is done for it and its
+// solicited-node multicast group is joined.
+func isNDPAddress(protocol tcpip.NetworkProtocolNumber, addr tcpip.Address) bool {
+	return protocol == header.IPv6ProtocolNumber && len(addr) == header.IPv6AddressSize && addr != header.IPv6Any && !header.IsV6MulticastAddress(addr)
+}
+
+// setConfigs applies new NDP configurations to the NIC.
+//
+// The NIC's mu must be locked.
+func (ndp *ndpState) setConfigs(c NDPConfigurations) {
+	if c != (NDPConfigurations{}) {
+		c.validate()
+	}
+
+	wasEnabled := ndp.enabled()
+	if wasEnabled {
+		ndp.cleanup()
+	}
+	ndp.configs = c
+	if !ndp.enabled() {
+		return
+	}
+
+	// All nodes must join the all-nodes multicast group (RFC 4861
+	// section 7.2.1), and the solicited-node multicast groups of their
+	// addresses, so that their neighbors can resolve them.
+	ndp.joinGroup(header.IPv6AllNodesMulticastAddress)
+	for id, ref := range ndp.nic.endpoints {
+		if ref.holdsInsertRef && isNDPAddress(ref.protocol, id.LocalAddress) {
+			ndp.joinGroup(header.SolicitedNodeAddr(id.LocalAddress))
+		}
+	}
+
+	if c.HandleRAs && c.MaxRtrSolicitations > 0 {
+		ndp.startSolicitingRouters()
+	}
+}
+
+// cleanup stops all NDP activity on the NIC and forgets everything NDP has
+// learned, including the addresses generated by SLAAC.
+//
+// The NIC's mu must be locked.
+func (ndp *ndpState) cleanup() {
+	if ndp.rtrSolicit != nil {
+		ndp.rtrSolicit.Stop()
+		ndp.rtrSolicit = nil
+	}
+
+	// Addresses that were still being checked are assumed to be unique.
+	for addr, s := range ndp.dad {
+		s.timer.Stop()
+		s.ref.tentative = false
+		delete(ndp.dad, addr)
+	}
+
+	for _, r := range ndp.defaultRouters {
+		r.timer.Stop()
+	}
+	ndp.defaultRouters = nil
+
+	for sn, p := range ndp.onLinkPrefixes {
+		if p.timer != nil {
+			p.timer.Stop()
+		}
+		delete(ndp.onLinkPrefixes, sn)
+	}
+
+	for sn := range ndp.autoGenAddrs {
+		ndp.invalidateAutoGenAddr(sn)
+	}
+
+	for addr, g := range ndp.groups {
+		ndp.removeGroup(addr, g)
+	}
+}
+
+// addressAdded is called when addr is assigned to the NIC. If DAD is
+// enabled, the address is marked tentative until DAD completes.
+//
+// The NIC's mu must be locked.
+func (ndp *ndpState) addressAdded(addr tcpip.Address, ref *referencedNetworkEndpoint) {
+	if !ndp.enabled() {
+		return
+	}
+
+	ndp.joinGroup(header.SolicitedNodeAddr(addr))
+
+	if ndp.configs.DupAddrDetectTransmits == 0 {
+		return
+	}
+
+	ref.tentative = true
+	s := &dadState{
+		ref:       ref,
+		remaining: ndp.configs.DupAddrDetectTransmits,
+	}
+	ndp.dad[addr] = s
+	ndp.doDAD(addr, s)
+}
+
+// doDAD sends the next Neighbor Solicitation message of s, or assigns the
+// address if all of them were sent without a duplicate being detected.
+//
+// The NIC's mu must be locked.
+func (ndp *ndpState) doDAD(addr tcpip.Address, s *dadState) {
+	if s.remaining == 0 {
+		// DAD succeeded, the address is unique (RFC 4862 section 5.4.5).
+		s.ref.tentative = false
+		delete(ndp.dad, addr)
+		return
+	}
+	s.remaining--
+
+	// DAD Neighbor Solicitations are sent from the unspecified address
+	// to the target's solicited-node multicast address, and must not
+	// include a source link-layer address option (RFC 4862 section
+	// 5.4.2).
+	body := make([]byte, header.ICMPv6NeighborSolicitMinimumSize-header.ICMPv6MinimumSize)
+	copy(body[4:], addr)
+	if err := ndp.nic.sendNDPPacket(header.IPv6Any, header.SolicitedNodeAddr(addr), header.ICMPv6NeighborSolicit, body); err == nil {
+		ndp.nic.stack.stats.ICMP.V6PacketsSent.NeighborSolicit.Increment()
+	}
+
+	s.timer = time.AfterFunc(ndp.configs.RetransmitTimer, func() {
+		ndp.nic.mu.Lock()
+		defer ndp.nic.mu.Unlock()
+		if ndp.dad[addr] != s {
+			return
+		}
+		ndp.doDAD(addr, s)
+	})
+}
+
+// dupTentativeAddrDetected removes addr from the NIC after DAD detected that
+// another node is using it.
+//
+// The NIC's mu must be locked.
+func (ndp *ndpState) dupTentativeAddrDetected(addr tcpip.Address) *tcpip.Error {
+	s, ok := ndp.dad[addr]
+	if !ok {
+		return tcpip.ErrBadAddress
+	}
+
+	// The address is not reconfigured: manual intervention is required,
+	// as per RFC 4862 section 5.4.5.
+	for sn, a := range ndp.autoGenAddrs {
+		if a.ref == s.ref {
+			ndp.invalidateAutoGenAddr(sn)
+			return nil
+		}
+	}
+	ndp.nic.removeAddressLocked(s.ref)
+	return nil
+}
+
+// addressRemoved is called when addr is removed from the NIC.
+//
+// The NIC's mu must be locked.
+func (ndp *ndpState) addressRemoved(addr tcpip.Address) {
+	if s, ok := ndp.dad[addr]; ok {
+		s.timer.Stop()
+		delete(ndp.dad, addr)
+	}
+	if ndp.enabled() {
+		ndp.leaveGroup(header.SolicitedNodeAddr(addr))
+	}
+}
+
+// joinGroup joins the multicast group addr on the NIC, unless it was already
+// joined for NDP.
+//
+// The NIC's mu must be locked.
+func (ndp *ndpState) joinGroup(addr tcpip.Address) {
+	if g, ok := ndp.groups[addr]; ok {
+		g.refs++
+		return
+	}
+
+	ndp.groups[addr] = &ndpGroup{
+		refs:   1,
+		joined: ndp.nic.joinGroupLocked(header.IPv6ProtocolNumber, addr) == nil,
+	}
+}
+
+// leaveGroup undoes one call to joinGroup.
+//
+// The NIC's mu must be locked.
+func (ndp *ndpState) leaveGroup(addr tcpip.Address) {
+	g, ok := ndp.groups[addr]
+	if !ok {
+		return
+	}
+	g.refs--
+	if g.refs == 0 {
+		ndp.removeGroup(addr, g)
+	}
+}
+
+// removeGroup leaves the multicast group addr, if it was joined for NDP.
+//
+// The NIC's mu must be locked.
+func (ndp *ndpState) removeGroup(addr tcpip.Address, g *ndpGroup) {
+	delete(ndp.groups, addr)
+	if g.joined {
+		ndp.nic.leaveGroupLocked(addr)
+	}
+}
+
+// startSolicitingRouters schedules the Router Solicitation messages sent when
+// NDP is enabled, after a random delay as per RFC 4861 section 6.3.7.
+//
+// The NIC's mu must be locked.
+func (ndp *ndpState) startSolicitingRouters() {
+	remaining := ndp.configs.MaxRtrSolicitations
+	var delay time.Duration
+	if ndp.configs.MaxRtrSolicitationDelay > 0 {
+		delay = time.Duration(rand.Int63n(int64(ndp.configs.MaxRtrSolicitationDelay)))
+	}
+
+	var t *time.Timer
+	var solicit func()
+	solicit = func() {
+		ndp.nic.mu.Lock()
+		defer ndp.nic.mu.Unlock()
+		if ndp.rtrSolicit != t {
+			return
+		}
+		ndp.sendRouterSolicit()
+		remaining--
+		if remaining == 0 {
+			ndp.rtrSolicit = nil
+			return
+		}
+		t = time.AfterFunc(ndp.configs.RtrSolicitationInterval, solicit)
+		ndp.rtrSolicit = t
+	}
+	t = time.AfterFunc(delay, solicit)
+	ndp.rtrSolicit = t
+}
+
+// sendRouterSolicit sends a Router Solicitation message to the all-routers
+// multicast group.
+//
+// The NIC's mu must be locked.
+func (ndp *ndpState) sendRouterSolicit() {
+	// The source is a link-local address if one is assigned, or the
+	// unspecified address, in which case the source link-layer address
+	// option must not be included (RFC 4861 section 4.1).
+	src := header.IPv6Any
+	for id, ref := range ndp.nic.endpoints {
+		if ref.protocol == header.IPv6ProtocolNumber && !ref.tentative && header.IsV6LinkLocalAddress(id.LocalAddress) {
+			src = id.LocalAddress
+			break
+		}
+	}
+
+	body := make([]byte, header.NDPRSMinimumSize)
+	if linkAddr := ndp.nic.linkEP.LinkAddress(); src != header.IPv6Any && len(linkAddr) != 0 {
+		body = append(body, ndpLinkLayerAddressOption(header.NDPSourceLinkLayerAddressOption, linkAddr)...)
+	}
+	if err := ndp.nic.sendNDPPacket(src, header.IPv6AllRoutersMulticastAddress, header.ICMPv6RouterSolicit, body); err == nil {
+		ndp.nic.stack.stats.ICMP.V6PacketsSent.RouterSolicit.Increment()
+	}
+}
+
+// ndpLinkLayerAddressOption returns a source or target link-layer address
+// option, padded to a multiple of 8 bytes.
+func ndpLinkLayerAddressOption(typ header.NDPOptionType, linkAddr tcpip.LinkAddress) []byte {
+	l := (2 + len(linkAddr) + 7) / 8
+	opt := make([]byte, l*8)
+	opt[0] = byte(typ)
+	opt[1] = byte(l)
+	copy(opt[2:], linkAddr)
+	return opt
+}
+
+// handleRA processes a Router Advertisement sent by routerAddr, as described
+// in RFC 4861 section 6.3.4 and RFC 4862 section 5.5.3. The caller must have
+// validated the message as per RFC 4861 section 6.1.2.
+//
+// The NIC's mu must be locked.
+func (ndp *ndpState) handleRA(routerAddr tcpip.Address, ra header.NDPRouterAdvert) {
+	if !ndp.configs.HandleRAs {
+		return
+	}
+
+	// A host stops soliciting routers once it receives a valid Router
+	// Advertisement (RFC 4861 section 6.3.7).
+	if ndp.rtrSolicit != nil {
+		ndp.rtrSolicit.Stop()
+		ndp.rtrSolicit = nil
+	}
+
+	if ndp.configs.DiscoverDefaultRouters {
+		ndp.updateDefaultRouter(routerAddr, ra.RouterLifetime())
+	}
+
+	opts, err := ra.Options().Parse()
+	if err != nil {
+		return
+	}
+	for _, opt := range opts {
+		if opt.Type != header.NDPPrefixInformationOption || len(opt.Body) < header.NDPPrefixInformationSize {
+			continue
+		}
+		pi := header.NDPPrefixInformation(opt.Body)
+		sn := pi.Subnet()
+		prefix := sn.ID()
+		if header.IsV6LinkLocalAddress(prefix) {
+			continue
+		}
+		if pi.OnLinkFlag() && ndp.configs.DiscoverOnLinkPrefixes {
+			ndp.updateOnLinkPrefix(sn, pi.ValidLifetime())
+		}
+		if pi.AutonomousAddressConfigurationFlag() && ndp.configs.AutoGenGlobalAddresses {
+			ndp.handleAutonomousPrefix(pi)
+		}
+	}
+}
+
+// updateDefaultRouter adds, refreshes or removes the default router addr
+// according to its advertised lifetime.
+//
+// The NIC's mu must be locked.
+func (ndp *ndpState) updateDefaultRouter(addr tcpip.Address, lifetime time.Duration) {
+	for i, r := range ndp.defaultRouters {
+		if r.addr != addr {
+			continue
+		}
+		r.timer.Stop()
+		if lifetime == 0 {
+			ndp.defaultRouters = append(ndp.defaultRouters[:i], ndp.defaultRouters[i+1:]...)
+			return
+		}
+		r.timer = ndp.invalidateDefaultRouterAfter(r, lifetime)
+		return
+	}
+
+	if lifetime == 0 {
+		return
+	}
+	r := &defaultRouterState{addr: addr}
+	r.timer = ndp.invalidateDefaultRouterAfter(r, lifetime)
+	ndp.defaultRouters = append(ndp.defaultRouters, r)
+}
+
+func (ndp *ndpState) invalidateDefaultRouterAfter(r *defaultRouterState, lifetime time.Duration) *time.Timer {
+	return time.AfterFunc(lifetime, func() {
+		ndp.nic.mu.Lock()
+		defer ndp.nic.mu.Unlock()
+		for i, cur := range ndp.defaultRouters {
+			if cur == r {
+				ndp.defaultRouters = append(ndp.defaultRouters[:i], ndp.defaultRouters[i+1:]...)
+				return
+			}
+		}
+	})
+}
+
+// updateOnLinkPrefix adds, refreshes or removes the on-link prefix sn
+// according to its advertised valid lifetime.
+//
+// The NIC's mu must be locked.
+func (ndp *ndpState) updateOnLinkPrefix(sn tcpip.Subnet, lifetime time.Duration) {
+	p, ok := ndp.onLinkPrefixes[sn]
+	if ok && p.timer != nil {
+		p.timer.Stop()
+	}
+	if lifetime == 0 {
+		delete(ndp.onLinkPrefixes, sn)
+		return
+	}
+	if !ok {
+		p = &onLinkPrefixState{}
+		ndp.onLinkPrefixes[sn] = p
+	}
+	p.timer = nil
+	if lifetime != header.NDPInfiniteLifetime {
+		p.timer = time.AfterFunc(lifetime, func() {
+			ndp.nic.mu.Lock()
+			defer ndp.nic.mu.Unlock()
+			if ndp.onLinkPrefixes[sn] == p {
+				delete(ndp.onLinkPrefixes, sn)
+			}
+		})
+	}
+}
+
+// handleAutonomousPrefix generates an address from the prefix of pi, or
+// updates the lifetime of the address previously generated from it.
+//
+// The NIC's mu must be locked.
+func (ndp *ndpState) handleAutonomousPrefix(pi header.NDPPrefixInformation) {
+	validLifetime := pi.ValidLifetime()
+	if pi.PreferredLifetime() > validLifetime {
+		return
+	}
+
+	sn := pi.Subnet()
+	if a, ok := ndp.autoGenAddrs[sn]; ok {
+		ndp.updateAutoGenAddrLifetime(sn, a, validLifetime)
+		return
+	}
+
+	// Interface identifiers are only generated from 48-bit MAC addresses.
+	linkAddr := ndp.nic.linkEP.LinkAddress()
+	if validLifetime == 0 || pi.PrefixLength() != slaacPrefixLength || len(linkAddr) != 6 {
+		return
+	}
+	addr := header.SLAACAddr(sn.ID(), linkAddr)
+	if _, ok := ndp.nic.endpoints[NetworkEndpointID{addr}]; ok {
+		return
+	}
+	ref, err := ndp.nic.addAddressLocked(header.IPv6ProtocolNumber, addr, CanBePrimaryEndpoint, false)
+	if err != nil {
+		return
+	}
+	a := &autoGenAddrState{ref: ref}
+	ndp.autoGenAddrs[sn] = a
+	ndp.setAutoGenAddrLifetime(sn, a, validLifetime)
+	ndp.addressAdded(addr, ref)
+}
+
+// updateAutoGenAddrLifetime updates the valid lifetime of an address generated
+// by SLAAC, as described in RFC 4862 section 5.5.3.e: unauthenticated Router
+// Advertisements may extend the lifetime, but not lower it below two hours.
+//
+// The NIC's mu must be locked.
+func (ndp *ndpState) updateAutoGenAddrLifetime(sn tcpip.Subnet, a *autoGenAddrState, validLifetime time.Duration) {
+	if validLifetime != header.NDPInfiniteLifetime && validLifetime <= minPrefixValidLifetimeUpdate {
+		if a.validUntil.IsZero() {
+			validLifetime = minPrefixValidLifetimeUpdate
+		} else if remaining := time.Until(a.validUntil); validLifetime <= remaining {
+			if remaining <= minPrefixValidLifetimeUpdate {
+				return
+			}
+			validLifetime = minPrefixValidLifetimeUpdate
+		}
+	}
+
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+	ndp.setAutoGenAddrLifetime(sn, a, validLifetime)
+}
+
+// setAutoGenAddrLifetime sets the valid lifetime of a.
+//
+// The NIC's mu must be locked.
+func (ndp *ndpState) setAutoGenAddrLifetime(sn tcpip.Subnet, a *autoGenAddrState, validLifetime time.Duration) {
+	a.validUntil = time.Time{}
+	a.timer = nil
+	if validLifetime == header.NDPInfiniteLifetime {
+		return
+	}
+	a.validUntil = time.Now().Add(validLifetime)
+	a.timer = time.AfterFunc(validLifetime, func() {
+		ndp.nic.mu.Lock()
+		defer ndp.nic.mu.Unlock()
+		if ndp.autoGenAddrs[sn] == a {
+			ndp.invalidateAutoGenAddr(sn)
+		}
+	})
+}
+
+// invalidateAutoGenAddr removes the address generated from sn.
+//
+// The NIC's mu must be locked.
+func (ndp *ndpState) invalidateAutoGenAddr(sn tcpip.Subnet) {
+	a := ndp.autoGenAddrs[sn]
+	delete(ndp.autoGenAddrs, sn)
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+	if a.ref.holdsInsertRef {
+		ndp.nic.removeAddressLocked(a.ref)
+	}
+}
+
+// nextHop returns the next hop towards the off-link or on-link remoteAddr, as
+// determined from Router Advertisements (RFC 4861 section 5.2). On-link
+// destinations are their own next hop, which is returned as the empty
+// address.
+//
+// The NIC's mu must be locked for reading.
+func (ndp *ndpState) nextHop(remoteAddr tcpip.Address) (tcpip.Address, bool) {
+	for sn := range ndp.onLinkPrefixes {
+		if sn.Contains(remoteAddr) {
+			return "", true
+		}
+	}
+	// TODO: prefer routers that are known to be reachable, as
+	// described in RFC 4861 section 6.3.6.
+	if len(ndp.defaultRouters) > 0 {
+		return ndp.defaultRouters[0].addr, true
+	}
+	return "", false
+}
+
+// sendNDPPacket sends an NDP message of type typ from src to the multicast
+// address dst. body holds the message after the ICMPv6 header.
+//
+// The packet is written to the link endpoint directly, without a Route, so it
+// can be sent from the unspecified address and while the NIC's mu is locked.
+func (n *NIC) sendNDPPacket(src, dst tcpip.Address, typ header.ICMPv6Type, body []byte) *tcpip.Error {
+	r := &Route{
+		NetProto:          header.IPv6ProtocolNumber,
+		LocalAddress:      src,
+		LocalLinkAddress:  n.linkEP.LinkAddress(),
+		RemoteAddress:     dst,
+		RemoteLinkAddress: header.EthernetAddressFromMulticastIPv6Address(dst),
+	}
+	hdr := buffer.NewPrependable(int(n.linkEP.MaxHeaderLength()) + header.IPv6MinimumSize + header.ICMPv6MinimumSize + len(body))
+	pkt := header.ICMPv6(hdr.Prepend(header.ICMPv6MinimumSize + len(body)))
+	pkt.SetType(typ)
+	copy(pkt[header.ICMPv6MinimumSize:], body)
+	pkt.SetChecksum(header.ICMPv6Checksum(pkt, src, dst, buffer.VectorisedView{}))
+
+	length := uint16(hdr.UsedLength())
+	ip := header.IPv6(hdr.Prepend(header.IPv6MinimumSize))
+	ip.Encode(&header.IPv6Fields{
+		PayloadLength: length,
+		NextHeader:    uint8(header.ICMPv6ProtocolNumber),
+		HopLimit:      header.NDPHopLimit,
+		SrcAddr:       src,
+		DstAddr:       dst,
+	})
+
+	if err := n.linkEP.WritePacket(r, nil /* gso */, hdr, buffer.VectorisedView{}, header.IPv6ProtocolNumber); err != nil {
+		n.stack.stats.IP.OutgoingPacketErrors.Increment()
+		n.stack.stats.ICMP.V6PacketsSent.Dropped.Increment()
+		return err
+	}
+	n.stack.stats.IP.PacketsSent.Increment()
+	n.stats.Tx.Packets.Increment()
+	n.stats.Tx.Bytes.IncrementBy(uint64(hdr.UsedLength()))
+	return nil
+}
@@ -0,0 +1,527 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack_test
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/channel"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	ndpLinkAddr1 = tcpip.LinkAddress("\x02\x02\x03\x04\x05\x06")
+	ndpLinkAddr2 = tcpip.LinkAddress("\x02\x02\x03\x04\x05\x07")
+
+	// ndpPrefix is 2001:db8:1::/64.
+	ndpPrefix = tcpip.Address("\x20\x01\x0d\xb8\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+
+	// ndpOnLinkAddr is 2001:db8:1::5, an address in ndpPrefix.
+	ndpOnLinkAddr = tcpip.Address("\x20\x01\x0d\xb8\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x05")
+
+	// ndpOffLinkAddr is 2001:db8:2::1.
+	ndpOffLinkAddr = tcpip.Address("\x20\x01\x0d\xb8\x00\x02\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01")
+
+	// ndpLoopbackAddr is ::1.
+	ndpLoopbackAddr = tcpip.Address("\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01")
+
+	// ndpTestTimeout bounds how long the tests wait for NDP timers.
+	ndpTestTimeout = 5 * time.Second
+)
+
+var (
+	ndpLLAddr1 = header.LinkLocalAddr(ndpLinkAddr1)
+	ndpLLAddr2 = header.LinkLocalAddr(ndpLinkAddr2)
+)
+
+func newNDPTestStack(t *testing.T, c stack.NDPConfigurations) (*stack.Stack, *channel.Endpoint) {
+	t.Helper()
+
+	s := stack.New([]string{ipv6.ProtocolName}, nil, stack.Options{NDPConfigs: c})
+	id, e := channel.New(10, 1280, ndpLinkAddr1)
+	if err := s.CreateNIC(1, id); err != nil {
+		t.Fatalf("CreateNIC(_) = %s", err)
+	}
+	return s, e
+}
+
+// ndpPacket returns an IPv6 packet carrying an NDP message.
+func ndpPacket(src, dst tcpip.Address, typ header.ICMPv6Type, body []byte) buffer.VectorisedView {
+	hdr := buffer.NewPrependable(header.IPv6MinimumSize + header.ICMPv6MinimumSize + len(body))
+	pkt := header.ICMPv6(hdr.Prepend(header.ICMPv6MinimumSize + len(body)))
+	pkt.SetType(typ)
+	copy(pkt[header.ICMPv6MinimumSize:], body)
+	pkt.SetChecksum(header.ICMPv6Checksum(pkt, src, dst, buffer.VectorisedView{}))
+	payloadLength := hdr.UsedLength()
+	ip := header.IPv6(hdr.Prepend(header.IPv6MinimumSize))
+	ip.Encode(&header.IPv6Fields{
+		PayloadLength: uint16(payloadLength),
+		NextHeader:    uint8(header.ICMPv6ProtocolNumber),
+		HopLimit:      header.NDPHopLimit,
+		SrcAddr:       src,
+		DstAddr:       dst,
+	})
+	return hdr.View().ToVectorisedView()
+}
+
+// raBody returns the body of a Router Advertisement with the given router
+// lifetime and options.
+func raBody(routerLifetime uint16, opts ...[]byte) []byte {
+	b := make([]byte, header.NDPRAMinimumSize)
+	binary.BigEndian.PutUint16(b[2:], routerLifetime)
+	for _, opt := range opts {
+		b = append(b, opt...)
+	}
+	return b
+}
+
+// prefixInfoOpt returns a Prefix Information option.
+func prefixInfoOpt(prefix tcpip.Address, length uint8, onLink, autonomous bool, validLifetime, preferredLifetime uint32) []byte {
+	opt := make([]byte, 2+header.NDPPrefixInformationSize)
+	opt[0] = byte(header.NDPPrefixInformationOption)
+	opt[1] = byte(len(opt) / 8)
+	opt[2] = length
+	if onLink {
+		opt[3] |= 1 << 7
+	}
+	if autonomous {
+		opt[3] |= 1 << 6
+	}
+	binary.BigEndian.PutUint32(opt[4:], validLifetime)
+	binary.BigEndian.PutUint32(opt[8:], preferredLifetime)
+	copy(opt[16:], prefix)
+	return opt
+}
+
+// readNDPPacket reads an NDP message written by the stack and checks its
+// addresses and type.
+func readNDPPacket(t *testing.T, e *channel.Endpoint, src, dst tcpip.Address, typ header.ICMPv6Type) header.ICMPv6 {
+	t.Helper()
+
+	var p channel.PacketInfo
+	select {
+	case p = <-e.C:
+	case <-time.After(ndpTestTimeout):
+		t.Fatalf("timed out waiting for ICMPv6 type %d", typ)
+	}
+	if p.Proto != header.IPv6ProtocolNumber {
+		t.Fatalf("got protocol = %d, want = %d", p.Proto, header.IPv6ProtocolNumber)
+	}
+	ip := header.IPv6(append(p.Header, p.Payload...))
+	if got := ip.SourceAddress(); got != src {
+		t.Errorf("got source = %s, want = %s", got, src)
+	}
+	if got := ip.DestinationAddress(); got != dst {
+		t.Errorf("got destination = %s, want = %s", got, dst)
+	}
+	if got := ip.HopLimit(); got != header.NDPHopLimit {
+		t.Errorf("got hop limit = %d, want = %d", got, header.NDPHopLimit)
+	}
+	if got := tcpip.TransportProtocolNumber(ip.NextHeader()); got != header.ICMPv6ProtocolNumber {
+		t.Fatalf("got next header = %d, want = %d", got, header.ICMPv6ProtocolNumber)
+	}
+	pkt := header.ICMPv6(ip.Payload())
+	if got := pkt.Type(); got != typ {
+		t.Fatalf("got ICMPv6 type = %d, want = %d", got, typ)
+	}
+	return pkt
+}
+
+func hasAddress(s *stack.Stack, nicid tcpip.NICID, addr tcpip.Address) bool {
+	for _, a := range s.NICInfo()[nicid].ProtocolAddresses {
+		if a.Address == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDADResolve(t *testing.T) {
+	s, e := newNDPTestStack(t, stack.NDPConfigurations{
+		DupAddrDetectTransmits: 2,
+		RetransmitTimer:        10 * time.Millisecond,
+	})
+
+	if err := s.AddAddress(1, header.IPv6ProtocolNumber, ndpLLAddr1); err != nil {
+		t.Fatalf("AddAddress(_) = %s", err)
+	}
+
+	// The address can't be used while it is tentative.
+	if got := s.CheckLocalAddress(1, header.IPv6ProtocolNumber, ndpLLAddr1); got != 0 {
+		t.Errorf("got CheckLocalAddress(_) = %d for a tentative address, want = 0", got)
+	}
+	if _, err := s.FindRoute(1, ndpLLAddr1, ndpLLAddr2, header.IPv6ProtocolNumber, false /* multicastLoop */); err == nil {
+		t.Errorf("FindRoute(_) succeeded with a tentative local address")
+	}
+
+	for i := 0; i < 2; i++ {
+		pkt := readNDPPacket(t, e, header.IPv6Any, header.SolicitedNodeAddr(ndpLLAddr1), header.ICMPv6NeighborSolicit)
+		if got := len(pkt); got != header.ICMPv6NeighborSolicitMinimumSize {
+			t.Errorf("got NS size = %d, want = %d", got, header.ICMPv6NeighborSolicitMinimumSize)
+		}
+		if got := tcpip.Address(pkt[8:][:16]); got != ndpLLAddr1 {
+			t.Errorf("got NS target = %s, want = %s", got, ndpLLAddr1)
+		}
+	}
+
+	deadline := time.Now().Add(ndpTestTimeout)
+	for s.CheckLocalAddress(1, header.IPv6ProtocolNumber, ndpLLAddr1) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("address is still tentative after %s", ndpTestTimeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := s.Stats().ICMP.V6PacketsSent.NeighborSolicit.Value(); got != 2 {
+		t.Errorf("got NeighborSolicit sent = %d, want = 2", got)
+	}
+}
+
+func TestDADDisabled(t *testing.T) {
+	s, e := newNDPTestStack(t, stack.NDPConfigurations{})
+
+	if err := s.AddAddress(1, header.IPv6ProtocolNumber, ndpLLAddr1); err != nil {
+		t.Fatalf("AddAddress(_) = %s", err)
+	}
+	if got := s.CheckLocalAddress(1, header.IPv6ProtocolNumber, ndpLLAddr1); got != 1 {
+		t.Errorf("got CheckLocalAddress(_) = %d, want = 1", got)
+	}
+	if got := e.Drain(); got != 0 {
+		t.Errorf("got %d packets sent with NDP disabled, want = 0", got)
+	}
+}
+
+func TestDADDuplicateDetected(t *testing.T) {
+	tests := []struct {
+		name string
+		pkt  buffer.VectorisedView
+	}{
+		{
+			name: "Neighbor Advertisement",
+			pkt: func() buffer.VectorisedView {
+				body := make([]byte, header.ICMPv6NeighborAdvertSize-header.ICMPv6MinimumSize)
+				body[0] = 1 << 5 // Override.
+				copy(body[4:], ndpLLAddr1)
+				body[20] = byte(header.NDPTargetLinkLayerAddressOption)
+				body[21] = 1
+				copy(body[22:], ndpLinkAddr2)
+				return ndpPacket(ndpLLAddr1, header.IPv6AllNodesMulticastAddress, header.ICMPv6NeighborAdvert, body)
+			}(),
+		},
+		{
+			name: "Neighbor Solicitation from another node doing DAD",
+			pkt: func() buffer.VectorisedView {
+				body := make([]byte, header.ICMPv6NeighborSolicitMinimumSize-header.ICMPv6MinimumSize)
+				copy(body[4:], ndpLLAddr1)
+				return ndpPacket(header.IPv6Any, header.SolicitedNodeAddr(ndpLLAddr1), header.ICMPv6NeighborSolicit, body)
+			}(),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, e := newNDPTestStack(t, stack.NDPConfigurations{
+				DupAddrDetectTransmits: 1,
+				RetransmitTimer:        time.Hour,
+			})
+
+			if err := s.AddAddress(1, header.IPv6ProtocolNumber, ndpLLAddr1); err != nil {
+				t.Fatalf("AddAddress(_) = %s", err)
+			}
+			readNDPPacket(t, e, header.IPv6Any, header.SolicitedNodeAddr(ndpLLAddr1), header.ICMPv6NeighborSolicit)
+			if !hasAddress(s, 1, ndpLLAddr1) {
+				t.Fatalf("tentative address %s is missing", ndpLLAddr1)
+			}
+
+			e.InjectLinkAddr(header.IPv6ProtocolNumber, ndpLinkAddr2, test.pkt)
+
+			if hasAddress(s, 1, ndpLLAddr1) {
+				t.Errorf("duplicate address %s wasn't removed", ndpLLAddr1)
+			}
+
+			// The address can be added again.
+			if err := s.AddAddress(1, header.IPv6ProtocolNumber, ndpLLAddr1); err != nil {
+				t.Errorf("AddAddress(_) after DAD failure = %s", err)
+			}
+		})
+	}
+}
+
+func TestDADReplyToOtherNode(t *testing.T) {
+	s, e := newNDPTestStack(t, stack.NDPConfigurations{
+		HandleRAs: true,
+	})
+
+	if err := s.AddAddress(1, header.IPv6ProtocolNumber, ndpLLAddr1); err != nil {
+		t.Fatalf("AddAddress(_) = %s", err)
+	}
+
+	// Another node doing DAD for our address must be told that it is
+	// taken, through the all-nodes multicast group.
+	body := make([]byte, header.ICMPv6NeighborSolicitMinimumSize-header.ICMPv6MinimumSize)
+	copy(body[4:], ndpLLAddr1)
+	e.InjectLinkAddr(header.IPv6ProtocolNumber, ndpLinkAddr2, ndpPacket(header.IPv6Any, header.SolicitedNodeAddr(ndpLLAddr1), header.ICMPv6NeighborSolicit, body))
+
+	pkt := readNDPPacket(t, e, ndpLLAddr1, header.IPv6AllNodesMulticastAddress, header.ICMPv6NeighborAdvert)
+	if got, want := pkt[4], byte(1<<5); got != want {
+		t.Errorf("got NA flags = %#x, want = %#x", got, want)
+	}
+	if !hasAddress(s, 1, ndpLLAddr1) {
+		t.Errorf("address %s was removed", ndpLLAddr1)
+	}
+}
+
+func TestRouterSolicitation(t *testing.T) {
+	_, e := newNDPTestStack(t, stack.NDPConfigurations{
+		HandleRAs:               true,
+		MaxRtrSolicitations:     2,
+		RtrSolicitationInterval: 10 * time.Millisecond,
+	})
+
+	for i := 0; i < 2; i++ {
+		pkt := readNDPPacket(t, e, header.IPv6Any, header.IPv6AllRoutersMulticastAddress, header.ICMPv6RouterSolicit)
+		// Solicitations from the unspecified address have no
+		// source link-layer address option.
+		if got, want := len(pkt), header.ICMPv6MinimumSize+header.NDPRSMinimumSize; got != want {
+			t.Errorf("got RS size = %d, want = %d", got, want)
+		}
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if got := e.Drain(); got != 0 {
+		t.Errorf("got %d extra packets, want = 0", got)
+	}
+}
+
+func TestRouterSolicitationStopsOnRA(t *testing.T) {
+	s, e := newNDPTestStack(t, stack.NDPConfigurations{})
+	if err := s.AddAddress(1, header.IPv6ProtocolNumber, ndpLLAddr1); err != nil {
+		t.Fatalf("AddAddress(_) = %s", err)
+	}
+
+	// Enable NDP once the link-local address is assigned, so that it is
+	// the source of the solicitations.
+	if err := s.SetNDPConfigurations(1, stack.NDPConfigurations{
+		HandleRAs:               true,
+		MaxRtrSolicitations:     2,
+		RtrSolicitationInterval: 100 * time.Millisecond,
+	}); err != nil {
+		t.Fatalf("SetNDPConfigurations(_) = %s", err)
+	}
+
+	pkt := readNDPPacket(t, e, ndpLLAddr1, header.IPv6AllRoutersMulticastAddress, header.ICMPv6RouterSolicit)
+	opts, err := header.NDPOptions(pkt[header.ICMPv6MinimumSize+header.NDPRSMinimumSize:]).Parse()
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	if len(opts) != 1 || opts[0].Type != header.NDPSourceLinkLayerAddressOption || tcpip.LinkAddress(opts[0].Body) != ndpLinkAddr1 {
+		t.Errorf("got RS options = %v, want a source link-layer address option for %s", opts, ndpLinkAddr1)
+	}
+
+	e.InjectLinkAddr(header.IPv6ProtocolNumber, ndpLinkAddr2, ndpPacket(ndpLLAddr2, header.IPv6AllNodesMulticastAddress, header.ICMPv6RouterAdvert, raBody(0)))
+
+	time.Sleep(200 * time.Millisecond)
+	if got := e.Drain(); got != 0 {
+		t.Errorf("got %d packets after receiving an RA, want = 0", got)
+	}
+}
+
+func TestRAHandling(t *testing.T) {
+	s, e := newNDPTestStack(t, stack.NDPConfigurations{
+		HandleRAs:              true,
+		DiscoverDefaultRouters: true,
+		DiscoverOnLinkPrefixes: true,
+		AutoGenGlobalAddresses: true,
+	})
+	if err := s.AddAddress(1, header.IPv6ProtocolNumber, ndpLLAddr1); err != nil {
+		t.Fatalf("AddAddress(_) = %s", err)
+	}
+
+	if _, err := s.FindRoute(0, "", ndpOffLinkAddr, header.IPv6ProtocolNumber, false /* multicastLoop */); err != tcpip.ErrNoRoute {
+		t.Fatalf("got FindRoute(_) before RA = _, %v, want = _, %s", err, tcpip.ErrNoRoute)
+	}
+
+	ra := raBody(1000, prefixInfoOpt(ndpPrefix, 64, true, true, 0xffffffff, 0xffffffff))
+	e.InjectLinkAddr(header.IPv6ProtocolNumber, ndpLinkAddr2, ndpPacket(ndpLLAddr2, header.IPv6AllNodesMulticastAddress, header.ICMPv6RouterAdvert, ra))
+
+	slaacAddr := header.SLAACAddr(ndpPrefix, ndpLinkAddr1)
+	if !hasAddress(s, 1, slaacAddr) {
+		t.Fatalf("SLAAC address %s wasn't generated, addresses = %v", slaacAddr, s.NICInfo()[1].ProtocolAddresses)
+	}
+
+	// Off-link destinations are reached through the default router, and
+	// on-link destinations directly. Both use the global source.
+	for _, test := range []struct {
+		remoteAddr tcpip.Address
+		nextHop    tcpip.Address
+	}{
+		{ndpOffLinkAddr, ndpLLAddr2},
+		{ndpOnLinkAddr, ""},
+	} {
+		r, err := s.FindRoute(0, "", test.remoteAddr, header.IPv6ProtocolNumber, false /* multicastLoop */)
+		if err != nil {
+			t.Fatalf("FindRoute(_, _, %s, _) = _, %s", test.remoteAddr, err)
+		}
+		if r.NextHop != test.nextHop {
+			t.Errorf("got NextHop to %s = %s, want = %s", test.remoteAddr, r.NextHop, test.nextHop)
+		}
+		if r.LocalAddress != slaacAddr {
+			t.Errorf("got LocalAddress to %s = %s, want = %s", test.remoteAddr, r.LocalAddress, slaacAddr)
+		}
+		r.Release()
+	}
+
+	// Link-local destinations still use the link-local source.
+	r, err := s.FindRoute(1, "", ndpLLAddr2, header.IPv6ProtocolNumber, false /* multicastLoop */)
+	if err != nil {
+		t.Fatalf("FindRoute(_, _, %s, _) = _, %s", ndpLLAddr2, err)
+	}
+	if r.LocalAddress != ndpLLAddr1 {
+		t.Errorf("got LocalAddress to %s = %s, want = %s", ndpLLAddr2, r.LocalAddress, ndpLLAddr1)
+	}
+	r.Release()
+
+	// The router stops being a default router and the prefix stops being
+	// on-link. The address is kept for two more hours, as per RFC 4862
+	// section 5.5.3.e.
+	ra = raBody(0, prefixInfoOpt(ndpPrefix, 64, true, true, 0, 0))
+	e.InjectLinkAddr(header.IPv6ProtocolNumber, ndpLinkAddr2, ndpPacket(ndpLLAddr2, header.IPv6AllNodesMulticastAddress, header.ICMPv6RouterAdvert, ra))
+
+	for _, addr := range []tcpip.Address{ndpOffLinkAddr, ndpOnLinkAddr} {
+		if _, err := s.FindRoute(0, "", addr, header.IPv6ProtocolNumber, false /* multicastLoop */); err != tcpip.ErrNoRoute {
+			t.Errorf("got FindRoute(_, _, %s, _) = _, %v, want = _, %s", addr, err, tcpip.ErrNoRoute)
+		}
+	}
+	if !hasAddress(s, 1, slaacAddr) {
+		t.Errorf("SLAAC address %s was removed", slaacAddr)
+	}
+}
+
+func TestRAIgnored(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs stack.NDPConfigurations
+		src     tcpip.Address
+		prefix  []byte
+	}{
+		{
+			name:    "RAs not handled",
+			configs: stack.NDPConfigurations{DiscoverDefaultRouters: true, AutoGenGlobalAddresses: true},
+			src:     ndpLLAddr2,
+			prefix:  prefixInfoOpt(ndpPrefix, 64, true, true, 0xffffffff, 0xffffffff),
+		},
+		{
+			name:    "Non link-local source",
+			configs: stack.NDPConfigurations{HandleRAs: true, DiscoverDefaultRouters: true, AutoGenGlobalAddresses: true},
+			src:     ndpOnLinkAddr,
+			prefix:  prefixInfoOpt(ndpPrefix, 64, true, true, 0xffffffff, 0xffffffff),
+		},
+		{
+			name:    "Prefix length not 64",
+			configs: stack.NDPConfigurations{HandleRAs: true, AutoGenGlobalAddresses: true},
+			src:     ndpLLAddr2,
+			prefix:  prefixInfoOpt(ndpPrefix, 48, true, true, 0xffffffff, 0xffffffff),
+		},
+		{
+			name:    "Preferred lifetime greater than valid lifetime",
+			configs: stack.NDPConfigurations{HandleRAs: true, AutoGenGlobalAddresses: true},
+			src:     ndpLLAddr2,
+			prefix:  prefixInfoOpt(ndpPrefix, 64, true, true, 100, 200),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, e := newNDPTestStack(t, test.configs)
+			if err := s.AddAddress(1, header.IPv6ProtocolNumber, ndpLLAddr1); err != nil {
+				t.Fatalf("AddAddress(_) = %s", err)
+			}
+
+			e.InjectLinkAddr(header.IPv6ProtocolNumber, ndpLinkAddr2, ndpPacket(test.src, header.IPv6AllNodesMulticastAddress, header.ICMPv6RouterAdvert, raBody(1000, test.prefix)))
+
+			if slaacAddr := header.SLAACAddr(ndpPrefix, ndpLinkAddr1); hasAddress(s, 1, slaacAddr) {
+				t.Errorf("SLAAC address %s was generated", slaacAddr)
+			}
+			if _, err := s.FindRoute(0, "", ndpOffLinkAddr, header.IPv6ProtocolNumber, false /* multicastLoop */); err != tcpip.ErrNoRoute {
+				t.Errorf("got FindRoute(_) = _, %v, want = _, %s", err, tcpip.ErrNoRoute)
+			}
+		})
+	}
+}
+
+func TestOnLinkPrefixExpiry(t *testing.T) {
+	s, e := newNDPTestStack(t, stack.NDPConfigurations{
+		HandleRAs:              true,
+		DiscoverOnLinkPrefixes: true,
+	})
+	if err := s.AddAddress(1, header.IPv6ProtocolNumber, ndpLLAddr1); err != nil {
+		t.Fatalf("AddAddress(_) = %s", err)
+	}
+
+	ra := raBody(0, prefixInfoOpt(ndpPrefix, 64, true, false, 1, 1))
+	e.InjectLinkAddr(header.IPv6ProtocolNumber, ndpLinkAddr2, ndpPacket(ndpLLAddr2, header.IPv6AllNodesMulticastAddress, header.ICMPv6RouterAdvert, ra))
+
+	r, err := s.FindRoute(0, "", ndpOnLinkAddr, header.IPv6ProtocolNumber, false /* multicastLoop */)
+	if err != nil {
+		t.Fatalf("FindRoute(_) = _, %s", err)
+	}
+	r.Release()
+
+	deadline := time.Now().Add(ndpTestTimeout)
+	for {
+		r, err := s.FindRoute(0, "", ndpOnLinkAddr, header.IPv6ProtocolNumber, false /* multicastLoop */)
+		if err == tcpip.ErrNoRoute {
+			break
+		}
+		if err == nil {
+			r.Release()
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("on-link prefix still valid after %s", ndpTestTimeout)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestSetNDPConfigurationsLoopback(t *testing.T) {
+	s := stack.New([]string{ipv6.ProtocolName}, nil, stack.Options{})
+	id, e := channel.New(10, 1280, "")
+	if err := s.CreateNamedLoopbackNIC(1, "lo", id); err != nil {
+		t.Fatalf("CreateNamedLoopbackNIC(_) = %s", err)
+	}
+	if err := s.SetNDPConfigurations(1, stack.DefaultNDPConfigurations()); err != nil {
+		t.Fatalf("SetNDPConfigurations(_) = %s", err)
+	}
+	if err := s.AddAddress(1, header.IPv6ProtocolNumber, ndpLoopbackAddr); err != nil {
+		t.Fatalf("AddAddress(_) = %s", err)
+	}
+
+	// Loopback addresses are never tentative.
+	if got := s.CheckLocalAddress(1, header.IPv6ProtocolNumber, ndpLoopbackAddr); got != 1 {
+		t.Errorf("got CheckLocalAddress(_) = %d, want = 1", got)
+	}
+	if got := e.Drain(); got != 0 {
+		t.Errorf("got %d packets sent on a loopback NIC, want = 0", got)
+	}
+
+	if err := s.SetNDPConfigurations(2, stack.DefaultNDPConfigurations()); err != tcpip.ErrUnknownNICID {
+		t.Errorf("got SetNDPConfigurations(2, _) = %v, want = %s", err, tcpip.ErrUnknownNICID)
+	}
+}
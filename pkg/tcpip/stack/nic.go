@@ -15,9 +15,11 @@
 package stack
 
 import (
+	"math/rand"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"gvisor.googlesource.com/gvisor/pkg/ilist"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip"
@@ -43,6 +45,24 @@ type NIC struct {
 	endpoints   map[NetworkEndpointID]*referencedNetworkEndpoint
 	subnets     []tcpip.Subnet
 
+	// mcastJoins counts the joins of each multicast group joined by the
+	// NIC, protected by mu.
+	mcastJoins map[NetworkEndpointID]int32
+
+	// ndp is the NDP state of the NIC, protected by mu.
+	ndp ndpState
+
+	// mcast is the IGMP and MLD state of the NIC, protected by mu.
+	mcast mcastState
+
+	// egressEP is the link endpoint the network endpoints of the NIC write
+	// to, through the queueing discipline qdisc, protected by qmu. qseed is
+	// the secret of the flow hashes of the packets queued.
+	egressEP egressEndpoint
+	qmu      sync.RWMutex
+	qdisc    QueueingDiscipline
+	qseed    uint32
+
 	stats NICStats
 }
 
@@ -78,15 +98,17 @@ const (
 )
 
 func newNIC(stack *Stack, id tcpip.NICID, name string, ep LinkEndpoint, loopback bool) *NIC {
-	return &NIC{
-		stack:     stack,
-		id:        id,
-		name:      name,
-		linkEP:    ep,
-		loopback:  loopback,
-		demux:     newTransportDemuxer(stack),
-		primary:   make(map[tcpip.NetworkProtocolNumber]*ilist.List),
-		endpoints: make(map[NetworkEndpointID]*referencedNetworkEndpoint),
+	n := &NIC{
+		stack:      stack,
+		id:         id,
+		name:       name,
+		linkEP:     ep,
+		loopback:   loopback,
+		demux:      newTransportDemuxer(stack),
+		primary:    make(map[tcpip.NetworkProtocolNumber]*ilist.List),
+		endpoints:  make(map[NetworkEndpointID]*referencedNetworkEndpoint),
+		mcastJoins: make(map[NetworkEndpointID]int32),
+		qseed:      rand.Uint32(),
 		stats: NICStats{
 			Tx: DirectionStats{
 				Packets: &tcpip.StatCounter{},
@@ -98,6 +120,10 @@ func newNIC(stack *Stack, id tcpip.NICID, name string, ep LinkEndpoint, loopback
 			},
 		},
 	}
+	n.ndp = newNDPState(n)
+	n.mcast = newMcastState(n)
+	n.egressEP = egressEndpoint{LinkEndpoint: ep, nic: n}
+	return n
 }
 
 // attachLinkEndpoint attaches the NIC to the endpoint, which will enable it
@@ -137,7 +163,7 @@ func (n *NIC) getMainNICAddress(protocol tcpip.NetworkProtocolNumber) (tcpip.Add
 	if list, ok := n.primary[protocol]; ok {
 		for e := list.Front(); e != nil; e = e.Next() {
 			ref := e.(*referencedNetworkEndpoint)
-			if ref.holdsInsertRef && ref.tryIncRef() {
+			if ref.holdsInsertRef && !ref.tentative && ref.tryIncRef() {
 				r = ref
 				break
 			}
@@ -164,8 +190,11 @@ func (n *NIC) getMainNICAddress(protocol tcpip.NetworkProtocolNumber) (tcpip.Add
 }
 
 // primaryEndpoint returns the primary endpoint of n for the given network
-// protocol.
-func (n *NIC) primaryEndpoint(protocol tcpip.NetworkProtocolNumber) *referencedNetworkEndpoint {
+// protocol, to be used as the source of packets sent to remoteAddr. IPv6
+// link-local endpoints are only used for other destinations if no other
+// primary endpoint exists, as they have a smaller scope (RFC 6724 section 5,
+// rule 2).
+func (n *NIC) primaryEndpoint(protocol tcpip.NetworkProtocolNumber, remoteAddr tcpip.Address) *referencedNetworkEndpoint {
 	n.mu.RLock()
 	defer n.mu.RUnlock()
 
@@ -174,6 +203,7 @@ func (n *NIC) primaryEndpoint(protocol tcpip.NetworkProtocolNumber) *referencedN
 		return nil
 	}
 
+	var fallback *referencedNetworkEndpoint
 	for e := list.Front(); e != nil; e = e.Next() {
 		r := e.(*referencedNetworkEndpoint)
 		// TODO: allow broadcast address when SO_BROADCAST is set.
@@ -181,11 +211,23 @@ func (n *NIC) primaryEndpoint(protocol tcpip.NetworkProtocolNumber) *referencedN
 		case header.IPv4Broadcast, header.IPv4Any:
 			continue
 		}
+		if r.tentative {
+			continue
+		}
+		if len(remoteAddr) != 0 && header.IsV6LinkLocalAddress(r.ep.ID().LocalAddress) && !header.IsV6LinkLocalAddress(remoteAddr) {
+			if fallback == nil {
+				fallback = r
+			}
+			continue
+		}
 		if r.tryIncRef() {
 			return r
 		}
 	}
 
+	if fallback != nil && fallback.tryIncRef() {
+		return fallback
+	}
 	return nil
 }
 
@@ -195,6 +237,11 @@ func (n *NIC) findEndpoint(protocol tcpip.NetworkProtocolNumber, address tcpip.A
 
 	n.mu.RLock()
 	ref := n.endpoints[id]
+	if ref != nil && ref.tentative {
+		// Tentative addresses can't be used until DAD completes.
+		n.mu.RUnlock()
+		return nil
+	}
 	if ref != nil && !ref.tryIncRef() {
 		ref = nil
 	}
@@ -210,6 +257,10 @@ func (n *NIC) findEndpoint(protocol tcpip.NetworkProtocolNumber, address tcpip.A
 	// there's a route through it.
 	n.mu.Lock()
 	ref = n.endpoints[id]
+	if ref != nil && ref.tentative {
+		n.mu.Unlock()
+		return nil
+	}
 	if ref == nil || !ref.tryIncRef() {
 		ref, _ = n.addAddressLocked(protocol, address, peb, true)
 		if ref != nil {
@@ -227,7 +278,7 @@ func (n *NIC) addAddressLocked(protocol tcpip.NetworkProtocolNumber, addr tcpip.
 	}
 
 	// Create the new network endpoint.
-	ep, err := netProto.NewEndpoint(n.id, addr, n.stack, n, n.linkEP)
+	ep, err := netProto.NewEndpoint(n.id, addr, n.stack, n, &n.egressEP)
 	if err != nil {
 		return nil, err
 	}
@@ -285,7 +336,10 @@ func (n *NIC) AddAddress(protocol tcpip.NetworkProtocolNumber, addr tcpip.Addres
 func (n *NIC) AddAddressWithOptions(protocol tcpip.NetworkProtocolNumber, addr tcpip.Address, peb PrimaryEndpointBehavior) *tcpip.Error {
 	// Add the endpoint.
 	n.mu.Lock()
-	_, err := n.addAddressLocked(protocol, addr, peb, false)
+	ref, err := n.addAddressLocked(protocol, addr, peb, false)
+	if err == nil && isNDPAddress(protocol, addr) {
+		n.ndp.addressAdded(addr, ref)
+	}
 	n.mu.Unlock()
 
 	return err
@@ -297,6 +351,14 @@ func (n *NIC) Addresses() []tcpip.ProtocolAddress {
 	defer n.mu.RUnlock()
 	addrs := make([]tcpip.ProtocolAddress, 0, len(n.endpoints))
 	for nid, ep := range n.endpoints {
+		// Multicast groups joined for NDP, IGMP and MLD aren't addresses
+		// of the NIC.
+		if g, ok := n.ndp.groups[nid.LocalAddress]; ok && g.joined {
+			continue
+		}
+		if n.mcast.isAllHostsGroup(ep.protocol, nid.LocalAddress) {
+			continue
+		}
 		addrs = append(addrs, tcpip.ProtocolAddress{
 			Protocol: ep.protocol,
 			Address:  nid.LocalAddress,
@@ -394,6 +456,15 @@ func (n *NIC) RemoveAddress(addr tcpip.Address) *tcpip.Error {
 	}
 
 	r.holdsInsertRef = false
+	if isNDPAddress(r.protocol, addr) {
+		n.ndp.addressRemoved(addr)
+	}
+	if _, ok := n.mcastJoins[NetworkEndpointID{addr}]; ok {
+		// Removing the address of a multicast group leaves it, no
+		// matter how many times it was joined.
+		delete(n.mcastJoins, NetworkEndpointID{addr})
+		n.mcast.groupLeft(r.protocol, addr)
+	}
 	n.mu.Unlock()
 
 	r.decRef()
@@ -401,6 +472,150 @@ func (n *NIC) RemoveAddress(addr tcpip.Address) *tcpip.Error {
 	return nil
 }
 
+// removeAddresses removes all addresses of n, leaving the multicast groups it
+// joined, and its subnets.
+func (n *NIC) removeAddresses() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for id, r := range n.endpoints {
+		if !r.holdsInsertRef {
+			continue
+		}
+		if _, ok := n.mcastJoins[id]; ok {
+			delete(n.mcastJoins, id)
+			n.mcast.groupLeft(r.protocol, id.LocalAddress)
+		}
+		n.removeAddressLocked(r)
+	}
+	n.subnets = nil
+}
+
+// removeAddressLocked is like RemoveAddress, but for an endpoint known to hold
+// its insert reference.
+//
+// n.mu must be locked.
+func (n *NIC) removeAddressLocked(r *referencedNetworkEndpoint) {
+	r.holdsInsertRef = false
+	if addr := r.ep.ID().LocalAddress; isNDPAddress(r.protocol, addr) {
+		n.ndp.addressRemoved(addr)
+	}
+	r.decRefLocked()
+}
+
+// joinGroup joins the multicast group addr. It is reference counted, so the
+// group is only left once leaveGroup is called as many times as joinGroup.
+func (n *NIC) joinGroup(protocol tcpip.NetworkProtocolNumber, addr tcpip.Address) *tcpip.Error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.joinGroupLocked(protocol, addr)
+}
+
+// joinGroupLocked is like joinGroup, but with n.mu locked.
+func (n *NIC) joinGroupLocked(protocol tcpip.NetworkProtocolNumber, addr tcpip.Address) *tcpip.Error {
+	id := NetworkEndpointID{addr}
+	joins := n.mcastJoins[id]
+	if joins == 0 {
+		if _, err := n.addAddressLocked(protocol, addr, NeverPrimaryEndpoint, false); err != nil {
+			return err
+		}
+		n.mcast.groupJoined(protocol, addr)
+	}
+	n.mcastJoins[id] = joins + 1
+	return nil
+}
+
+// leaveGroup undoes one call to joinGroup for the multicast group addr.
+func (n *NIC) leaveGroup(addr tcpip.Address) *tcpip.Error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.leaveGroupLocked(addr)
+}
+
+// leaveGroupLocked is like leaveGroup, but with n.mu locked.
+func (n *NIC) leaveGroupLocked(addr tcpip.Address) *tcpip.Error {
+	id := NetworkEndpointID{addr}
+	joins := n.mcastJoins[id]
+	switch joins {
+	case 0:
+		// There are no joins with this address on this NIC.
+		return tcpip.ErrBadLocalAddress
+	case 1:
+		// This is the last one, leave the group.
+		delete(n.mcastJoins, id)
+		if r := n.endpoints[id]; r != nil && r.holdsInsertRef {
+			n.mcast.groupLeft(r.protocol, addr)
+			n.removeAddressLocked(r)
+		}
+	default:
+		n.mcastJoins[id] = joins - 1
+	}
+	return nil
+}
+
+// setMulticastGroupConfigurations sets the IGMP and MLD configurations of n.
+// Group membership is never reported on loopback NICs.
+func (n *NIC) setMulticastGroupConfigurations(c MulticastGroupConfigurations) {
+	if n.loopback {
+		return
+	}
+
+	n.mu.Lock()
+	n.mcast.setConfigs(c)
+	n.mu.Unlock()
+}
+
+// handleMulticastGroupQuery processes an IGMP or MLD query. See
+// mcastState.handleQuery.
+func (n *NIC) handleMulticastGroupQuery(protocol tcpip.NetworkProtocolNumber, group tcpip.Address, maxRespTime time.Duration, version uint8) {
+	n.mu.Lock()
+	n.mcast.handleQuery(protocol, group, maxRespTime, version)
+	n.mu.Unlock()
+}
+
+// handleMulticastGroupReport processes an IGMP or MLD report sent by another
+// host. See mcastState.handleReport.
+func (n *NIC) handleMulticastGroupReport(protocol tcpip.NetworkProtocolNumber, group tcpip.Address) {
+	n.mu.Lock()
+	n.mcast.handleReport(protocol, group)
+	n.mu.Unlock()
+}
+
+// setNDPConfigurations sets the NDP configurations of n. NDP is never done on
+// loopback NICs.
+func (n *NIC) setNDPConfigurations(c NDPConfigurations) {
+	if n.loopback {
+		return
+	}
+
+	n.mu.Lock()
+	n.ndp.setConfigs(c)
+	n.mu.Unlock()
+}
+
+// handleNDPRA processes an NDP Router Advertisement sent by routerAddr.
+func (n *NIC) handleNDPRA(routerAddr tcpip.Address, ra header.NDPRouterAdvert) {
+	n.mu.Lock()
+	n.ndp.handleRA(routerAddr, ra)
+	n.mu.Unlock()
+}
+
+// dupTentativeAddrDetected removes the tentative address addr, which another
+// node is already using.
+func (n *NIC) dupTentativeAddrDetected(addr tcpip.Address) *tcpip.Error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.ndp.dupTentativeAddrDetected(addr)
+}
+
+// ndpNextHop returns the next hop towards remoteAddr learned by NDP, if any.
+// See ndpState.nextHop.
+func (n *NIC) ndpNextHop(remoteAddr tcpip.Address) (tcpip.Address, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.ndp.nextHop(remoteAddr)
+}
+
 // DeliverNetworkPacket finds the appropriate network protocol endpoint and
 // hands the packet over for further processing. This function is called when
 // the NIC receives a packet from the physical interface.
@@ -486,7 +701,7 @@ func (n *NIC) DeliverNetworkPacket(linkEP LinkEndpoint, remote, _ tcpip.LinkAddr
 			vv.RemoveFirst()
 
 			// TODO: use route.WritePacket.
-			if err := n.linkEP.WritePacket(&r, nil /* gso */, hdr, vv, protocol); err != nil {
+			if err := n.egressEP.WritePacket(&r, nil /* gso */, hdr, vv, protocol); err != nil {
 				r.Stats().IP.OutgoingPacketErrors.Increment()
 			} else {
 				n.stats.Tx.Packets.Increment()
@@ -503,9 +718,17 @@ func (n *NIC) getRef(protocol tcpip.NetworkProtocolNumber, dst tcpip.Address) *r
 	id := NetworkEndpointID{dst}
 
 	n.mu.RLock()
-	if ref, ok := n.endpoints[id]; ok && ref.tryIncRef() {
-		n.mu.RUnlock()
-		return ref
+	if ref, ok := n.endpoints[id]; ok {
+		// Packets addressed to tentative addresses are silently
+		// discarded (RFC 4862 section 5.4).
+		if ref.tentative {
+			n.mu.RUnlock()
+			return nil
+		}
+		if ref.tryIncRef() {
+			n.mu.RUnlock()
+			return ref
+		}
 	}
 
 	promiscuous := n.promiscuous
@@ -524,9 +747,15 @@ func (n *NIC) getRef(protocol tcpip.NetworkProtocolNumber, dst tcpip.Address) *r
 		// get the endpoint, create a new "temporary" one. It will only
 		// exist while there's a route through it.
 		n.mu.Lock()
-		if ref, ok := n.endpoints[id]; ok && ref.tryIncRef() {
-			n.mu.Unlock()
-			return ref
+		if ref, ok := n.endpoints[id]; ok {
+			if ref.tentative {
+				n.mu.Unlock()
+				return nil
+			}
+			if ref.tryIncRef() {
+				n.mu.Unlock()
+				return ref
+			}
 		}
 		ref, err := n.addAddressLocked(protocol, dst, CanBePrimaryEndpoint, true)
 		n.mu.Unlock()
@@ -542,6 +771,11 @@ func (n *NIC) getRef(protocol tcpip.NetworkProtocolNumber, dst tcpip.Address) *r
 // DeliverTransportPacket delivers the packets to the appropriate transport
 // protocol endpoint.
 func (n *NIC) DeliverTransportPacket(r *Route, protocol tcpip.TransportProtocolNumber, netHeader buffer.View, vv buffer.VectorisedView) {
+	// Looped back packets were tracked when sent.
+	if ct := n.stack.connTrack; ct != nil && n.linkEP.Capabilities()&CapabilityLoopback == 0 {
+		ct.handlePacket(r.NetProto, protocol, r.RemoteAddress, r.LocalAddress, vv.First())
+	}
+
 	state, ok := n.stack.transportProtocols[protocol]
 	if !ok {
 		n.stack.stats.UnknownProtocolRcvdPackets.Increment()
@@ -634,6 +868,11 @@ type referencedNetworkEndpoint struct {
 	// endpoint. It is reset to false when RemoveAddress is called on the
 	// NIC.
 	holdsInsertRef bool
+
+	// tentative is protected by the NIC's mutex. It indicates whether the
+	// address is undergoing Duplicate Address Detection, in which case it
+	// must not be used.
+	tentative bool
 }
 
 // decRef decrements the ref count and cleans up the endpoint once it reaches
@@ -644,6 +883,14 @@ func (r *referencedNetworkEndpoint) decRef() {
 	}
 }
 
+// decRefLocked is the same as decRef, but for callers that hold the NIC's
+// mutex.
+func (r *referencedNetworkEndpoint) decRefLocked() {
+	if atomic.AddInt32(&r.refs, -1) == 0 {
+		r.nic.removeEndpointLocked(r)
+	}
+}
+
 // incRef increments the ref count. It must only be called when the caller is
 // known to be holding a reference to the endpoint, otherwise tryIncRef should
 // be used.
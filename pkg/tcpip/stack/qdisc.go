@@ -0,0 +1,202 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/hash/jenkins"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+)
+
+// QueueingDiscipline is the interface implemented by the queueing disciplines
+// (qdiscs) which can be attached to a NIC to schedule the packets it sends,
+// e.g. to shape or delay them.
+type QueueingDiscipline interface {
+	// Enqueue queues p to be sent. The discipline takes ownership of p, and
+	// must eventually either write it with p.Write or drop it with p.Drop,
+	// including when the packet is rejected with an error.
+	Enqueue(p *QueuedPacket) *tcpip.Error
+
+	// Stats returns the statistics of the discipline.
+	Stats() QueueingDisciplineStats
+
+	// Close drops the packets queued and releases the resources of the
+	// discipline. It is called when the discipline is detached from its
+	// NIC.
+	Close()
+}
+
+// QueueingDisciplineStats contains the statistics of a queueing discipline.
+type QueueingDisciplineStats struct {
+	// Packets and Bytes count the packets sent.
+	Packets uint64
+	Bytes   uint64
+
+	// Drops counts the packets dropped.
+	Drops uint64
+
+	// Overlimits counts the times a packet was held back because it
+	// exceeded the rate of the discipline.
+	Overlimits uint64
+
+	// QueueLen and Backlog are the number of packets and bytes queued.
+	QueueLen uint32
+	Backlog  uint32
+}
+
+// QueuedPacket is a packet sent by a NIC held by its queueing discipline.
+type QueuedPacket struct {
+	linkEP   LinkEndpoint
+	route    Route
+	gso      *GSO
+	hdr      buffer.Prependable
+	payload  buffer.VectorisedView
+	protocol tcpip.NetworkProtocolNumber
+	hash     uint32
+}
+
+// newQueuedPacket returns a packet holding copies of the route and headers
+// passed to the WritePacket method of linkEP, which may be reused by the
+// caller once it returns.
+func newQueuedPacket(linkEP LinkEndpoint, r *Route, gso *GSO, hdr buffer.Prependable, payload buffer.VectorisedView, protocol tcpip.NetworkProtocolNumber, seed uint32) *QueuedPacket {
+	p := &QueuedPacket{
+		linkEP:   linkEP,
+		route:    *r,
+		payload:  payload.Clone(nil),
+		protocol: protocol,
+	}
+	if r.ref != nil {
+		p.route = r.Clone()
+	}
+	if gso != nil {
+		g := *gso
+		p.gso = &g
+	}
+	v := hdr.View()
+	p.hdr = buffer.NewPrependable(int(linkEP.MaxHeaderLength()) + len(v))
+	copy(p.hdr.Prepend(len(v)), v)
+	p.hash = flowHash(protocol, v, seed)
+	return p
+}
+
+// Size returns the size of the packet, without its link header.
+func (p *QueuedPacket) Size() int {
+	return p.hdr.UsedLength() + p.payload.Size()
+}
+
+// FlowHash returns a hash of the flow of the packet: its addresses, transport
+// protocol and ports.
+func (p *QueuedPacket) FlowHash() uint32 {
+	return p.hash
+}
+
+// Write writes the packet to the link endpoint of its NIC, and releases it.
+func (p *QueuedPacket) Write() *tcpip.Error {
+	err := p.linkEP.WritePacket(&p.route, p.gso, p.hdr, p.payload, p.protocol)
+	if err != nil {
+		p.route.Stats().IP.OutgoingPacketErrors.Increment()
+	}
+	p.route.Release()
+	return err
+}
+
+// Drop releases the packet without sending it.
+func (p *QueuedPacket) Drop() {
+	p.route.Release()
+}
+
+// flowHash hashes the addresses and transport protocol of the network header
+// at the start of h, followed by the first 4 bytes of the transport header,
+// the ports of TCP and UDP.
+func flowHash(protocol tcpip.NetworkProtocolNumber, h buffer.View, seed uint32) uint32 {
+	var src, dst, transport []byte
+	var proto uint8
+	switch protocol {
+	case header.IPv4ProtocolNumber:
+		if len(h) < header.IPv4MinimumSize {
+			return 0
+		}
+		ip := header.IPv4(h)
+		src, dst, proto = []byte(ip.SourceAddress()), []byte(ip.DestinationAddress()), ip.Protocol()
+		if ip.FragmentOffset() == 0 {
+			transport = h[ip.HeaderLength():]
+		}
+	case header.IPv6ProtocolNumber:
+		if len(h) < header.IPv6MinimumSize {
+			return 0
+		}
+		ip := header.IPv6(h)
+		src, dst, proto = []byte(ip.SourceAddress()), []byte(ip.DestinationAddress()), ip.NextHeader()
+		transport = h[header.IPv6MinimumSize:]
+	default:
+		return 0
+	}
+	if len(transport) > 4 {
+		transport = transport[:4]
+	}
+
+	hash := jenkins.Sum32(seed)
+	hash.Write(src)
+	hash.Write(dst)
+	hash.Write([]byte{proto})
+	hash.Write(transport)
+	return hash.Sum32()
+}
+
+// egressEndpoint is the link endpoint the network endpoints of a NIC write
+// to. It passes the packets through the queueing discipline of the NIC, if
+// any.
+type egressEndpoint struct {
+	LinkEndpoint
+	nic *NIC
+}
+
+// WritePacket implements LinkEndpoint.WritePacket.
+func (e *egressEndpoint) WritePacket(r *Route, gso *GSO, hdr buffer.Prependable, payload buffer.VectorisedView, protocol tcpip.NetworkProtocolNumber) *tcpip.Error {
+	q := e.nic.queueingDiscipline()
+	if q == nil {
+		return e.LinkEndpoint.WritePacket(r, gso, hdr, payload, protocol)
+	}
+	return q.Enqueue(newQueuedPacket(e.LinkEndpoint, r, gso, hdr, payload, protocol, e.nic.qseed))
+}
+
+// GSOMaxSize implements GSOEndpoint.GSOMaxSize.
+func (e *egressEndpoint) GSOMaxSize() uint32 {
+	if gso, ok := e.LinkEndpoint.(GSOEndpoint); ok {
+		return gso.GSOMaxSize()
+	}
+	return 0
+}
+
+// setQueueingDiscipline attaches q to the NIC, closing the discipline it
+// replaces.
+func (n *NIC) setQueueingDiscipline(q QueueingDiscipline) {
+	n.qmu.Lock()
+	old := n.qdisc
+	n.qdisc = q
+	n.qmu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+}
+
+// queueingDiscipline returns the queueing discipline attached to the NIC, or
+// nil.
+func (n *NIC) queueingDiscipline() QueueingDiscipline {
+	n.qmu.RLock()
+	defer n.qmu.RUnlock()
+	return n.qdisc
+}
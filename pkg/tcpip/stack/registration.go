@@ -16,10 +16,12 @@ package stack
 
 import (
 	"sync"
+	"time"
 
 	"gvisor.googlesource.com/gvisor/pkg/sleep"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
 	"gvisor.googlesource.com/gvisor/pkg/waiter"
 )
 
@@ -56,6 +58,8 @@ type ControlType int
 const (
 	ControlPacketTooBig ControlType = iota
 	ControlPortUnreachable
+	ControlNetworkUnreachable
+	ControlHostUnreachable
 	ControlUnknown
 )
 
@@ -341,6 +345,35 @@ type LinkAddressCache interface {
 	RemoveWaker(nicid tcpip.NICID, addr tcpip.Address, waker *sleep.Waker)
 }
 
+// NDPHandler handles the NDP messages that change the configuration of a NIC.
+// It is implemented by the Stack, and network protocols that implement NDP
+// find it by type asserting their LinkAddressCache.
+type NDPHandler interface {
+	// HandleNDPRouterAdvert processes a valid Router Advertisement sent by
+	// routerAddr and received on the given NIC.
+	HandleNDPRouterAdvert(nicid tcpip.NICID, routerAddr tcpip.Address, ra header.NDPRouterAdvert)
+
+	// DupTentativeAddrDetected is called when another node is found to
+	// use the tentative address addr of the given NIC, which is then
+	// removed. It returns ErrBadAddress if addr is not tentative.
+	DupTentativeAddrDetected(nicid tcpip.NICID, addr tcpip.Address) *tcpip.Error
+}
+
+// MulticastGroupHandler handles the IGMP and MLD messages sent by routers and
+// other hosts. It is implemented by the Stack, and network protocols find it
+// by type asserting their LinkAddressCache.
+type MulticastGroupHandler interface {
+	// HandleMulticastGroupQuery processes a query received on the given
+	// NIC, of the given version of IGMP (1 to 3) or MLD (1 or 2). group is
+	// the queried group, or the unspecified address for general queries,
+	// and reports must be sent within maxRespTime.
+	HandleMulticastGroupQuery(nicid tcpip.NICID, protocol tcpip.NetworkProtocolNumber, group tcpip.Address, maxRespTime time.Duration, version uint8)
+
+	// HandleMulticastGroupReport processes a report for group sent by
+	// another host and received on the given NIC.
+	HandleMulticastGroupReport(nicid tcpip.NICID, protocol tcpip.NetworkProtocolNumber, group tcpip.Address)
+}
+
 // TransportProtocolFactory functions are used by the stack to instantiate
 // transport protocols.
 type TransportProtocolFactory func() TransportProtocol
@@ -426,6 +459,16 @@ type GSO struct {
 	MaxSize uint32
 }
 
+// ClosableEndpoint is a LinkEndpoint which holds resources, such as the
+// goroutines delivering its inbound packets, that are released by Close when
+// its NIC is removed.
+type ClosableEndpoint interface {
+	// Close stops the endpoint from delivering and sending packets, and
+	// releases its resources. It doesn't return until packets being
+	// delivered were handled.
+	Close()
+}
+
 // GSOEndpoint provides access to GSO properties.
 type GSOEndpoint interface {
 	// GSOMaxSize returns the maximum GSO packet size.
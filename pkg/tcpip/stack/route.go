@@ -153,6 +153,13 @@ func (r *Route) IsResolutionRequired() bool {
 
 // WritePacket writes the packet through the given route.
 func (r *Route) WritePacket(gso *GSO, hdr buffer.Prependable, payload buffer.VectorisedView, protocol tcpip.TransportProtocolNumber, ttl uint8) *tcpip.Error {
+	if ct := r.ref.nic.stack.connTrack; ct != nil {
+		b := hdr.View()
+		if len(b) == 0 {
+			b = payload.First()
+		}
+		ct.handlePacket(r.NetProto, protocol, r.LocalAddress, r.RemoteAddress, b)
+	}
 	err := r.ref.ep.WritePacket(r, gso, hdr, payload, protocol, ttl, r.loop)
 	if err != nil {
 		r.Stats().IP.OutgoingPacketErrors.Increment()
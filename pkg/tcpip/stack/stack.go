@@ -306,11 +306,25 @@ type Stack struct {
 	// invoked everytime they receive a TCP segment.
 	tcpProbeFunc TCPProbeFunc
 
+	// clockMu protects clock, which may be replaced by SetClock while
+	// packets are being processed.
+	clockMu sync.RWMutex
+
 	// clock is used to generate user-visible times.
 	clock tcpip.Clock
 
 	// handleLocal allows non-loopback interfaces to loop packets.
 	handleLocal bool
+
+	// ndpConfigs is the default NDP configurations of new NICs.
+	ndpConfigs NDPConfigurations
+
+	// mcastConfigs is the default IGMP and MLD configurations of new NICs.
+	mcastConfigs MulticastGroupConfigurations
+
+	// connTrack is the table of tracked connections, or nil if they are not
+	// tracked.
+	connTrack *connTrack
 }
 
 // Options contains optional Stack configuration.
@@ -327,6 +341,23 @@ type Options struct {
 	// should be handled by the stack internally (true) or outside the
 	// stack (false).
 	HandleLocal bool
+
+	// NDPConfigs is the default NDP configurations used by non-loopback
+	// NICs. It can be changed per NIC with SetNDPConfigurations.
+	//
+	// The zero value disables NDP.
+	NDPConfigs NDPConfigurations
+
+	// MulticastGroupConfigs is the default IGMP and MLD configurations
+	// used by non-loopback NICs. It can be changed per NIC with
+	// SetMulticastGroupConfigurations.
+	//
+	// The zero value disables IGMP and MLD.
+	MulticastGroupConfigs MulticastGroupConfigurations
+
+	// ConnTrack enables the tracking of the TCP, UDP and ICMP echo
+	// connections the stack sends and receives packets of.
+	ConnTrack bool
 }
 
 // New allocates a new networking stack with only the requested networking and
@@ -352,6 +383,13 @@ func New(network []string, transport []string, opts Options) *Stack {
 		clock:              clock,
 		stats:              opts.Stats.FillIn(),
 		handleLocal:        opts.HandleLocal,
+		ndpConfigs:         opts.NDPConfigs,
+		mcastConfigs:       opts.MulticastGroupConfigs,
+	}
+	if opts.ConnTrack {
+		// Connection tracking follows the clock of the stack, even once
+		// replaced by SetClock.
+		s.connTrack = newConnTrack(s)
 	}
 
 	// Add specified network protocols.
@@ -453,9 +491,28 @@ func (s *Stack) SetTransportProtocolHandler(p tcpip.TransportProtocolNumber, h f
 	}
 }
 
+// SetClock replaces the clock of the stack, e.g. by the clock of the kernel
+// the stack is restored into. It may be called while the stack is in use.
+func (s *Stack) SetClock(clock tcpip.Clock) {
+	s.clockMu.Lock()
+	s.clock = clock
+	s.clockMu.Unlock()
+}
+
 // NowNanoseconds implements tcpip.Clock.NowNanoseconds.
 func (s *Stack) NowNanoseconds() int64 {
-	return s.clock.NowNanoseconds()
+	s.clockMu.RLock()
+	c := s.clock
+	s.clockMu.RUnlock()
+	return c.NowNanoseconds()
+}
+
+// NowMonotonic implements tcpip.Clock.NowMonotonic.
+func (s *Stack) NowMonotonic() int64 {
+	s.clockMu.RLock()
+	c := s.clock
+	s.clockMu.RUnlock()
+	return c.NowMonotonic()
 }
 
 // Stats returns a mutable copy of the current stats.
@@ -537,6 +594,8 @@ func (s *Stack) createNIC(id tcpip.NICID, name string, linkEP tcpip.LinkEndpoint
 	}
 
 	n := newNIC(s, id, name, ep, loopback)
+	n.setNDPConfigurations(s.ndpConfigs)
+	n.setMulticastGroupConfigurations(s.mcastConfigs)
 
 	s.nics[id] = n
 	if enabled {
@@ -592,6 +651,43 @@ func (s *Stack) EnableNIC(id tcpip.NICID) *tcpip.Error {
 	return nil
 }
 
+// RemoveNIC removes the NIC with the given id, along with its addresses and the
+// routes through it, and closes its link-layer endpoint if it is a
+// ClosableEndpoint.
+//
+// Otherwise, the link-layer endpoint of the NIC stays attached, but the packets
+// it delivers are dropped, as the NIC has no address left.
+func (s *Stack) RemoveNIC(id tcpip.NICID) *tcpip.Error {
+	s.mu.Lock()
+	nic, ok := s.nics[id]
+	if !ok {
+		s.mu.Unlock()
+		return tcpip.ErrUnknownNICID
+	}
+	delete(s.nics, id)
+
+	// Don't filter the route table in place, as it may be shared with the
+	// caller of SetRouteTable.
+	var routes []tcpip.Route
+	for _, r := range s.routeTable {
+		if r.NIC != id {
+			routes = append(routes, r)
+		}
+	}
+	s.routeTable = routes
+	s.mu.Unlock()
+
+	nic.removeAddresses()
+	nic.setQueueingDiscipline(nil)
+
+	// Close the endpoint without s.mu held, as the packets it is delivering
+	// may need it.
+	if ep, ok := nic.linkEP.(ClosableEndpoint); ok {
+		ep.Close()
+	}
+	return nil
+}
+
 // CheckNIC checks if a NIC is usable.
 func (s *Stack) CheckNIC(id tcpip.NICID) bool {
 	s.mu.RLock()
@@ -603,6 +699,32 @@ func (s *Stack) CheckNIC(id tcpip.NICID) bool {
 	return false
 }
 
+// FindNICByName returns the ID of the NIC with the given name, or 0 if there is
+// no such NIC.
+func (s *Stack) FindNICByName(name string) tcpip.NICID {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for id, nic := range s.nics {
+		if nic.name == name {
+			return id
+		}
+	}
+	return 0
+}
+
+// NICName returns the name of the NIC with the given ID, or an empty string if
+// there is no such NIC.
+func (s *Stack) NICName(id tcpip.NICID) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if nic, ok := s.nics[id]; ok {
+		return nic.name
+	}
+	return ""
+}
+
 // NICSubnets returns a map of NICIDs to their associated subnets.
 func (s *Stack) NICSubnets() map[tcpip.NICID][]tcpip.Subnet {
 	s.mu.RLock()
@@ -757,9 +879,9 @@ func (s *Stack) GetMainNICAddress(id tcpip.NICID, protocol tcpip.NetworkProtocol
 	return "", tcpip.Subnet{}, tcpip.ErrUnknownNICID
 }
 
-func (s *Stack) getRefEP(nic *NIC, localAddr tcpip.Address, netProto tcpip.NetworkProtocolNumber) (ref *referencedNetworkEndpoint) {
+func (s *Stack) getRefEP(nic *NIC, localAddr, remoteAddr tcpip.Address, netProto tcpip.NetworkProtocolNumber) (ref *referencedNetworkEndpoint) {
 	if len(localAddr) == 0 {
-		return nic.primaryEndpoint(netProto)
+		return nic.primaryEndpoint(netProto, remoteAddr)
 	}
 	return nic.findEndpoint(netProto, localAddr, CanBePrimaryEndpoint)
 }
@@ -775,7 +897,7 @@ func (s *Stack) FindRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, n
 	needRoute := !(isBroadcast || isMulticast || header.IsV6LinkLocalAddress(remoteAddr))
 	if id != 0 && !needRoute {
 		if nic, ok := s.nics[id]; ok {
-			if ref := s.getRefEP(nic, localAddr, netProto); ref != nil {
+			if ref := s.getRefEP(nic, localAddr, remoteAddr, netProto); ref != nil {
 				return makeRoute(netProto, ref.ep.ID().LocalAddress, remoteAddr, nic.linkEP.LinkAddress(), ref, s.handleLocal && !nic.loopback, multicastLoop && !nic.loopback), nil
 			}
 		}
@@ -785,7 +907,7 @@ func (s *Stack) FindRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, n
 				continue
 			}
 			if nic, ok := s.nics[route.NIC]; ok {
-				if ref := s.getRefEP(nic, localAddr, netProto); ref != nil {
+				if ref := s.getRefEP(nic, localAddr, remoteAddr, netProto); ref != nil {
 					if len(remoteAddr) == 0 {
 						// If no remote address was provided, then the route
 						// provided will refer to the link local address.
@@ -800,6 +922,24 @@ func (s *Stack) FindRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, n
 				}
 			}
 		}
+
+		// Fall back to the routes learned by NDP.
+		if needRoute && netProto == header.IPv6ProtocolNumber && len(remoteAddr) != 0 {
+			for nicID, nic := range s.nics {
+				if id != 0 && id != nicID {
+					continue
+				}
+				nextHop, ok := nic.ndpNextHop(remoteAddr)
+				if !ok {
+					continue
+				}
+				if ref := s.getRefEP(nic, localAddr, remoteAddr, netProto); ref != nil {
+					r := makeRoute(netProto, ref.ep.ID().LocalAddress, remoteAddr, nic.linkEP.LinkAddress(), ref, s.handleLocal && !nic.loopback, multicastLoop && !nic.loopback)
+					r.NextHop = nextHop
+					return r, nil
+				}
+			}
+		}
 	}
 
 	if !needRoute {
@@ -809,6 +949,87 @@ func (s *Stack) FindRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, n
 	return Route{}, tcpip.ErrNoRoute
 }
 
+// SetNDPConfigurations sets the NDP configurations of the specified NIC,
+// restarting NDP on it. Everything previously learned by NDP on the NIC,
+// including the addresses generated by SLAAC, is forgotten.
+//
+// NDP is never done on loopback NICs.
+func (s *Stack) SetNDPConfigurations(id tcpip.NICID, c NDPConfigurations) *tcpip.Error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nic, ok := s.nics[id]
+	if !ok {
+		return tcpip.ErrUnknownNICID
+	}
+
+	nic.setNDPConfigurations(c)
+	return nil
+}
+
+// HandleNDPRouterAdvert implements NDPHandler.HandleNDPRouterAdvert.
+func (s *Stack) HandleNDPRouterAdvert(nicid tcpip.NICID, routerAddr tcpip.Address, ra header.NDPRouterAdvert) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if nic, ok := s.nics[nicid]; ok {
+		nic.handleNDPRA(routerAddr, ra)
+	}
+}
+
+// DupTentativeAddrDetected implements NDPHandler.DupTentativeAddrDetected.
+func (s *Stack) DupTentativeAddrDetected(nicid tcpip.NICID, addr tcpip.Address) *tcpip.Error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nic, ok := s.nics[nicid]
+	if !ok {
+		return tcpip.ErrUnknownNICID
+	}
+
+	return nic.dupTentativeAddrDetected(addr)
+}
+
+// SetMulticastGroupConfigurations sets the IGMP and MLD configurations of the
+// specified NIC. The multicast groups already joined on the NIC are reported
+// by the protocols being enabled.
+//
+// Group membership is never reported on loopback NICs.
+func (s *Stack) SetMulticastGroupConfigurations(id tcpip.NICID, c MulticastGroupConfigurations) *tcpip.Error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nic, ok := s.nics[id]
+	if !ok {
+		return tcpip.ErrUnknownNICID
+	}
+
+	nic.setMulticastGroupConfigurations(c)
+	return nil
+}
+
+// HandleMulticastGroupQuery implements
+// MulticastGroupHandler.HandleMulticastGroupQuery.
+func (s *Stack) HandleMulticastGroupQuery(nicid tcpip.NICID, protocol tcpip.NetworkProtocolNumber, group tcpip.Address, maxRespTime time.Duration, version uint8) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if nic, ok := s.nics[nicid]; ok {
+		nic.handleMulticastGroupQuery(protocol, group, maxRespTime, version)
+	}
+}
+
+// HandleMulticastGroupReport implements
+// MulticastGroupHandler.HandleMulticastGroupReport.
+func (s *Stack) HandleMulticastGroupReport(nicid tcpip.NICID, protocol tcpip.NetworkProtocolNumber, group tcpip.Address) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if nic, ok := s.nics[nicid]; ok {
+		nic.handleMulticastGroupReport(protocol, group)
+	}
+}
+
 // CheckNetworkProtocol checks if a given network protocol is enabled in the
 // stack.
 func (s *Stack) CheckNetworkProtocol(protocol tcpip.NetworkProtocolNumber) bool {
@@ -867,6 +1088,38 @@ func (s *Stack) SetPromiscuousMode(nicID tcpip.NICID, enable bool) *tcpip.Error
 	return nil
 }
 
+// SetQueueingDiscipline attaches the queueing discipline q to the given NIC,
+// replacing and closing the one attached to it, if any. The packets the NIC
+// sends then go through q. A nil q detaches the queueing discipline of the
+// NIC.
+func (s *Stack) SetQueueingDiscipline(nicID tcpip.NICID, q QueueingDiscipline) *tcpip.Error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nic := s.nics[nicID]
+	if nic == nil {
+		return tcpip.ErrUnknownNICID
+	}
+
+	nic.setQueueingDiscipline(q)
+
+	return nil
+}
+
+// QueueingDiscipline returns the queueing discipline attached to the given
+// NIC, or nil if none is.
+func (s *Stack) QueueingDiscipline(nicID tcpip.NICID) (QueueingDiscipline, *tcpip.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nic := s.nics[nicID]
+	if nic == nil {
+		return nil, tcpip.ErrUnknownNICID
+	}
+
+	return nic.queueingDiscipline(), nil
+}
+
 // SetSpoofing enables or disables address spoofing in the given NIC, allowing
 // endpoints to bind to any address in the NIC.
 func (s *Stack) SetSpoofing(nicID tcpip.NICID, enable bool) *tcpip.Error {
@@ -1047,13 +1300,27 @@ func (s *Stack) RemoveTCPProbe() {
 	s.mu.Unlock()
 }
 
-// JoinGroup joins the given multicast group on the given NIC.
+// JoinGroup joins the given multicast group on the given NIC. Joins are
+// reference counted, and if IGMP or MLD is enabled on the NIC, the membership
+// is reported to routers when the group is first joined.
 func (s *Stack) JoinGroup(protocol tcpip.NetworkProtocolNumber, nicID tcpip.NICID, multicastAddr tcpip.Address) *tcpip.Error {
-	// TODO: notify network of subscription via igmp protocol.
-	return s.AddAddressWithOptions(nicID, protocol, multicastAddr, NeverPrimaryEndpoint)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if nic, ok := s.nics[nicID]; ok {
+		return nic.joinGroup(protocol, multicastAddr)
+	}
+	return tcpip.ErrUnknownNICID
 }
 
-// LeaveGroup leaves the given multicast group on the given NIC.
+// LeaveGroup leaves the given multicast group on the given NIC. The group is
+// only left once LeaveGroup is called as many times as JoinGroup.
 func (s *Stack) LeaveGroup(protocol tcpip.NetworkProtocolNumber, nicID tcpip.NICID, multicastAddr tcpip.Address) *tcpip.Error {
-	return s.RemoveAddress(nicID, multicastAddr)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if nic, ok := s.nics[nicID]; ok {
+		return nic.leaveGroup(multicastAddr)
+	}
+	return tcpip.ErrUnknownNICID
 }
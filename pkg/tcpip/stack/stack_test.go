@@ -496,6 +496,59 @@ func TestAddressRemoval(t *testing.T) {
 	}
 }
 
+func TestNICRemoval(t *testing.T) {
+	s := stack.New([]string{"fakeNet"}, nil, stack.Options{})
+
+	id1, linkEP := channel.New(10, defaultMTU, "")
+	if err := s.CreateNIC(1, id1); err != nil {
+		t.Fatalf("CreateNIC failed: %v", err)
+	}
+	if err := s.AddAddress(1, fakeNetNumber, "\x01"); err != nil {
+		t.Fatalf("AddAddress failed: %v", err)
+	}
+
+	id2, _ := channel.New(10, defaultMTU, "")
+	if err := s.CreateNIC(2, id2); err != nil {
+		t.Fatalf("CreateNIC failed: %v", err)
+	}
+	if err := s.AddAddress(2, fakeNetNumber, "\x02"); err != nil {
+		t.Fatalf("AddAddress failed: %v", err)
+	}
+
+	s.SetRouteTable([]tcpip.Route{
+		{"\x01", "\x01", "\x00", 1},
+		{"\x00", "\x01", "\x00", 2},
+	})
+
+	if err := s.RemoveNIC(1); err != nil {
+		t.Fatalf("RemoveNIC failed: %v", err)
+	}
+	if err := s.RemoveNIC(1); err != tcpip.ErrUnknownNICID {
+		t.Fatalf("RemoveNIC got %v, want %v", err, tcpip.ErrUnknownNICID)
+	}
+	if s.CheckNIC(1) {
+		t.Errorf("CheckNIC(1) = true, want false")
+	}
+
+	// Only the route through the second NIC is left.
+	want := tcpip.Route{"\x00", "\x01", "\x00", 2}
+	if got := s.GetRouteTable(); len(got) != 1 || got[0] != want {
+		t.Errorf("GetRouteTable() = %v, want [%v]", got, want)
+	}
+	testNoRoute(t, s, 0, "", "\x05")
+	testRoute(t, s, 0, "", "\x06", "\x02")
+
+	// Packets the link endpoint of the removed NIC delivers are dropped.
+	fakeNet := s.NetworkProtocolInstance(fakeNetNumber).(*fakeNetworkProtocol)
+	fakeNet.packetCount[1] = 0
+	buf := buffer.NewView(30)
+	buf[0] = 1
+	linkEP.Inject(fakeNetNumber, buf.ToVectorisedView())
+	if fakeNet.packetCount[1] != 0 {
+		t.Errorf("packetCount[1] = %d, want %d", fakeNet.packetCount[1], 0)
+	}
+}
+
 func TestDelayedRemovalDueToRoute(t *testing.T) {
 	s := stack.New([]string{"fakeNet"}, nil, stack.Options{})
 
@@ -102,6 +102,7 @@ var (
 	ErrMessageTooLong        = &Error{msg: "message too long"}
 	ErrNoBufferSpace         = &Error{msg: "no buffer space available"}
 	ErrBroadcastDisabled     = &Error{msg: "broadcast socket option disabled"}
+	ErrNotPermitted          = &Error{msg: "operation not permitted"}
 )
 
 // Errors related to Subnet
@@ -286,6 +287,9 @@ type ControlMessages struct {
 	// Timestamp is the time (in ns) that the last packed used to create
 	// the read data was received.
 	Timestamp int64
+
+	// SockErr is the error read from the endpoint's error queue, if any.
+	SockErr *SockError `state:"nosave"`
 }
 
 // Endpoint is the interface implemented by transport protocols (e.g., tcp, udp)
@@ -378,6 +382,76 @@ type Endpoint interface {
 	GetSockOpt(opt interface{}) *Error
 }
 
+// BatchEndpoint is implemented by datagram endpoints that can read and write
+// several datagrams at a time, taking their locks and looking up their route
+// once per batch rather than once per datagram.
+type BatchEndpoint interface {
+	Endpoint
+
+	// ReadBatch reads up to len(views) datagrams into views, and their
+	// senders and control messages into addrs and cms, which must be as
+	// long as views. It returns the number of datagrams read.
+	//
+	// Like Read, ReadBatch does not block, and returns an error only if
+	// there is no datagram pending.
+	ReadBatch(views []buffer.View, addrs []FullAddress, cms []ControlMessages) (int, *Error)
+
+	// WriteBatch writes the datagrams in ps to the same destination, as
+	// Write does for a single one. It returns the number of datagrams
+	// written and, if not all of them were, the error that prevented
+	// writing the next one.
+	WriteBatch(ps []Payload, opts WriteOptions) (int, <-chan struct{}, *Error)
+}
+
+// ErrQueueEndpoint is implemented by endpoints that keep the errors reported to
+// them on an error queue when RecvErrOption is set.
+type ErrQueueEndpoint interface {
+	Endpoint
+
+	// ReadErrQueue dequeues the oldest error on the endpoint's error
+	// queue. It returns ErrWouldBlock if the queue is empty.
+	ReadErrQueue() (SockError, *Error)
+}
+
+// SockErrOrigin is the origin of a SockError. Origins are numbered as
+// Linux's SO_EE_ORIGIN values.
+type SockErrOrigin uint8
+
+// Origins of socket errors.
+const (
+	SockErrOriginNone SockErrOrigin = iota
+	SockErrOriginLocal
+	SockErrOriginICMP
+	SockErrOriginICMP6
+)
+
+// SockError is an error on an endpoint's error queue, reported by an ICMP
+// message received for a packet the endpoint sent.
+type SockError struct {
+	// Err is the error reported to the endpoint.
+	Err *Error
+
+	// Origin, Type and Code are the origin of the error and, for ICMP
+	// errors, the type and code of the ICMP message.
+	Origin SockErrOrigin
+	Type   uint8
+	Code   uint8
+
+	// Info is the path MTU reported by "packet too big" errors.
+	Info uint32
+
+	// NetProto is the network protocol of the endpoint that queued the
+	// error.
+	NetProto NetworkProtocolNumber
+
+	// Dst is the destination of the packet that caused the error.
+	Dst FullAddress
+
+	// Payload is the part of the packet's payload that was returned with
+	// the ICMP message.
+	Payload buffer.View
+}
+
 // WriteOptions contains options for Endpoint.Write.
 type WriteOptions struct {
 	// If To is not nil, write to the given address instead of the endpoint's
@@ -411,6 +485,28 @@ type SendQueueSizeOption int
 // unread bytes in the input buffer should be returned.
 type ReceiveQueueSizeOption int
 
+// MemInfoOption is used by GetSockOpt to retrieve the memory used by the
+// buffers of an endpoint, as SO_MEMINFO does in Linux. Sizes are in bytes.
+type MemInfoOption struct {
+	// RcvQueued is the size of the data held in the receive buffer.
+	RcvQueued int
+
+	// RcvBufSize is the size of the receive buffer.
+	RcvBufSize int
+
+	// SndAlloc is the size of the data that was sent but is still held by
+	// the receiving side, like the data unread by the peer of a unix
+	// socket.
+	SndAlloc int
+
+	// SndBufSize is the size of the send buffer.
+	SndBufSize int
+
+	// SndQueued is the size of the data held in the send buffer, like the
+	// data not yet acknowledged by the peer of a TCP endpoint.
+	SndQueued int
+}
+
 // V6OnlyOption is used by SetSockOpt/GetSockOpt to specify whether an IPv6
 // socket is to be restricted to sending and receiving IPv6 packets only.
 type V6OnlyOption int
@@ -441,12 +537,122 @@ type QuickAckOption int
 // Only supported on Unix sockets.
 type PasscredOption int
 
-// TCPInfoOption is used by GetSockOpt to expose TCP statistics.
-//
-// TODO: Add and populate stat fields.
+// RecvErrOption is used by SetSockOpt/GetSockOpt to specify whether the errors
+// reported by ICMP are queued on the endpoint's error queue, and reported
+// immediately rather than only to connected endpoints.
+type RecvErrOption int
+
+// TCPState is the state of a TCP connection, as reported by TCPInfoOption.
+// States are numbered as in Linux.
+type TCPState uint8
+
+// TCP connection states.
+const (
+	TCPStateEstablished TCPState = iota + 1
+	TCPStateSynSent
+	TCPStateSynRecv
+	TCPStateFinWait1
+	TCPStateFinWait2
+	TCPStateTimeWait
+	TCPStateClose
+	TCPStateCloseWait
+	TCPStateLastAck
+	TCPStateListen
+	TCPStateClosing
+)
+
+// TCPCAState is the congestion avoidance state of a TCP sender, as reported by
+// TCPInfoOption.
+type TCPCAState uint8
+
+// TCP congestion avoidance states.
+const (
+	// TCPCAStateOpen is the normal state: no loss is suspected.
+	TCPCAStateOpen TCPCAState = iota
+
+	// TCPCAStateDisorder is entered when duplicate ACKs or SACKs are
+	// received.
+	TCPCAStateDisorder
+
+	// TCPCAStateCWR is entered when the congestion window is reduced
+	// because of a congestion notification.
+	TCPCAStateCWR
+
+	// TCPCAStateRecovery is the fast recovery state.
+	TCPCAStateRecovery
+
+	// TCPCAStateLoss is entered when the retransmission timer expires.
+	TCPCAStateLoss
+)
+
+// TCPInfoOption is used by GetSockOpt to expose TCP statistics, as TCP_INFO
+// does in Linux. Sizes are in bytes, and congestion windows and counts of
+// outstanding data in segments. The times of the last events are zero if they
+// didn't happen yet.
 type TCPInfoOption struct {
+	State   TCPState
+	CAState TCPCAState
+
+	// Timeouts is the number of consecutive retransmission timeouts.
+	Timeouts int
+
+	// TimestampsEnabled, SACKPermitted and WindowScaleEnabled are set when
+	// the respective options were negotiated with the peer. SndWndScale and
+	// RcvWndScale are then the window scales in use.
+	TimestampsEnabled  bool
+	SACKPermitted      bool
+	WindowScaleEnabled bool
+	SndWndScale        uint8
+	RcvWndScale        uint8
+
+	RTO    time.Duration
 	RTT    time.Duration
 	RTTVar time.Duration
+	MinRTT time.Duration
+
+	// SndMSS is the maximum payload of the segments sent, and RcvMSS the
+	// largest payload received. AdvMSS is the MSS advertised to the peer,
+	// and PMTU the path MTU.
+	SndMSS int
+	RcvMSS int
+	AdvMSS int
+	PMTU   int
+
+	// Unacked is the number of segments sent and not acknowledged yet, of
+	// which Sacked were selectively acknowledged.
+	Unacked int
+	Sacked  int
+
+	LastDataSent time.Time
+	LastDataRecv time.Time
+	LastAckRecv  time.Time
+
+	SndSsthresh int
+	SndCwnd     int
+	RcvSpace    int
+	Reordering  int
+
+	// TotalRetrans is the number of segments retransmitted.
+	TotalRetrans uint32
+
+	BytesAcked    uint64
+	BytesReceived uint64
+	SegsOut       uint64
+	SegsIn        uint64
+	DataSegsOut   uint64
+	DataSegsIn    uint64
+
+	// NotSentBytes is the amount of data queued and not sent yet.
+	NotSentBytes int
+
+	// DeliveryRate is the estimated rate at which data is delivered to the
+	// peer, in bytes per second. DeliveryRateAppLimited is set if the
+	// sender was limited by the application rather than the network.
+	DeliveryRate           uint64
+	DeliveryRateAppLimited bool
+
+	// BusyTime is the time spent with data outstanding.
+	BusyTime time.Duration
 }
 
 // KeepaliveEnabledOption is used by SetSockOpt/GetSockOpt to specify whether
@@ -467,6 +673,16 @@ type KeepaliveIntervalOption time.Duration
 // closed.
 type KeepaliveCountOption int
 
+// TCPMD5SigOption is used by SetSockOpt to set the key used to sign and verify
+// TCP segments exchanged with a peer, as described in RFC 2385. The key
+// applies to peers whose address matches the first PrefixLen bits of Addr. An
+// empty key removes the key previously set for the same address and prefix.
+type TCPMD5SigOption struct {
+	Addr      Address
+	PrefixLen int
+	Key       []byte
+}
+
 // MulticastTTLOption is used by SetSockOpt/GetSockOpt to control the default
 // TTL value for multicast messages. The default is 1.
 type MulticastTTLOption uint8
@@ -508,6 +724,130 @@ type OutOfBandInlineOption int
 // datagram sockets are allowed to send packets to a broadcast address.
 type BroadcastOption int
 
+// BindToDeviceOption is used by SetSockOpt/GetSockOpt to restrict an endpoint
+// to the NIC with the given name. Both the packets it receives and the routes
+// it uses to send are limited to that NIC. An empty name removes the
+// restriction.
+type BindToDeviceOption string
+
+// SocketFilter is a filter of the packets received by an endpoint, as the
+// socket filters of Linux.
+type SocketFilter interface {
+	// Filter returns the number of bytes of pkt to deliver, 0 if the packet
+	// must be dropped. pkt starts with the UDP header for UDP endpoints,
+	// and with the network header for raw endpoints.
+	Filter(pkt buffer.VectorisedView) int
+}
+
+// AttachFilterOption is used by SetSockOpt to attach a socket filter to an
+// endpoint, replacing the one attached, if any.
+type AttachFilterOption struct {
+	Filter SocketFilter
+}
+
+// DetachFilterOption is used by SetSockOpt to detach the socket filter of an
+// endpoint.
+type DetachFilterOption struct{}
+
+// LockFilterOption is used by SetSockOpt/GetSockOpt to specify whether the
+// socket filter of an endpoint is locked. The filter of a locked endpoint
+// can't be attached or detached, and it can't be unlocked.
+type LockFilterOption int
+
+// SCTPOneToManyOption is used by SetSockOpt/GetSockOpt to specify whether an
+// SCTP endpoint is a one-to-many style socket, which holds any number of
+// associations, as opposed to a one-to-one style socket with a single
+// association (RFC 6458 section 3). It can only be set on new endpoints.
+type SCTPOneToManyOption int
+
+// SCTPInitMsgOption is used by SetSockOpt/GetSockOpt to specify the
+// parameters of the associations started by an SCTP endpoint. Zero fields
+// are left unchanged by SetSockOpt.
+type SCTPInitMsgOption struct {
+	// NumOutboundStreams is the number of streams requested to send on.
+	NumOutboundStreams uint16
+
+	// MaxInboundStreams is the maximum number of streams accepted from
+	// peers.
+	MaxInboundStreams uint16
+
+	// MaxAttempts is the maximum number of INIT retransmissions.
+	MaxAttempts uint16
+
+	// MaxInitTimeout is the maximum retransmission timeout of INIT chunks.
+	MaxInitTimeout time.Duration
+}
+
+// SCTPRTOInfoOption is used by SetSockOpt/GetSockOpt to specify the
+// retransmission timeouts of the associations of an SCTP endpoint. Zero fields
+// are left unchanged by SetSockOpt.
+type SCTPRTOInfoOption struct {
+	Initial time.Duration
+	Min     time.Duration
+	Max     time.Duration
+}
+
+// SCTPPartialReliabilityOption is used by SetSockOpt/GetSockOpt to specify
+// whether an SCTP endpoint supports the partial reliability extension
+// (PR-SCTP, RFC 3758) in the associations it starts.
+type SCTPPartialReliabilityOption int
+
+// SCTPPRPolicy is the policy deciding when PR-SCTP gives up transmitting a
+// message.
+type SCTPPRPolicy int
+
+const (
+	// SCTPPRPolicyNone never abandons messages.
+	SCTPPRPolicyNone SCTPPRPolicy = iota
+
+	// SCTPPRPolicyTTL abandons messages that haven't been acknowledged
+	// within a lifetime.
+	SCTPPRPolicyTTL
+
+	// SCTPPRPolicyRTX abandons messages that were retransmitted a given
+	// number of times.
+	SCTPPRPolicyRTX
+)
+
+// SCTPDefaultPRInfoOption is used by SetSockOpt/GetSockOpt to specify the
+// PR-SCTP policy of the messages sent by an SCTP endpoint. Value is the
+// lifetime in milliseconds of SCTPPRPolicyTTL, or the maximum number of
+// retransmissions of SCTPPRPolicyRTX.
+type SCTPDefaultPRInfoOption struct {
+	Policy SCTPPRPolicy
+	Value  uint32
+}
+
+// MPTCPInfoOption is used by GetSockOpt to expose the state of a multipath TCP
+// connection, as MPTCP_INFO does in Linux. The data sequence numbers are
+// those of the connection, WriteSeq being the one of the next byte queued for
+// sending.
+type MPTCPInfoOption struct {
+	Subflows           uint8
+	AddAddrSignal      uint8
+	AddAddrAccepted    uint8
+	SubflowsMax        uint8
+	AddAddrSignalMax   uint8
+	AddAddrAcceptedMax uint8
+	Flags              uint32
+	Token              uint32
+	WriteSeq           uint64
+	SndUna             uint64
+	RcvNxt             uint64
+	LocalAddrUsed      uint8
+	LocalAddrMax       uint8
+}
+
+// Flags of MPTCPInfoOption.
+const (
+	// MPTCPInfoFallback is set when the connection fell back to TCP.
+	MPTCPInfoFallback = 1 << 0
+
+	// MPTCPInfoRemoteKeyReceived is set once the key of the peer is
+	// known.
+	MPTCPInfoRemoteKeyReceived = 1 << 1
+)
+
 // Route is a row in the routing table. It specifies through which NIC (and
 // gateway) sets of packets should be routed. A row is considered viable if the
 // masked target address matches the destination adddress in the row.
@@ -668,6 +1008,22 @@ type ICMPv6PacketStats struct {
 	// RedirectMsg is the total number of ICMPv6 redirect message packets
 	// counted.
 	RedirectMsg *StatCounter
+
+	// MulticastListenerQuery is the total number of MLD multicast listener
+	// query packets counted.
+	MulticastListenerQuery *StatCounter
+
+	// MulticastListenerReport is the total number of MLDv1 multicast
+	// listener report packets counted.
+	MulticastListenerReport *StatCounter
+
+	// MulticastListenerDone is the total number of MLDv1 multicast
+	// listener done packets counted.
+	MulticastListenerDone *StatCounter
+
+	// MulticastListenerV2Report is the total number of MLDv2 multicast
+	// listener report packets counted.
+	MulticastListenerV2Report *StatCounter
 }
 
 // ICMPv4SentPacketStats collects outbound ICMPv4-specific stats.
@@ -727,6 +1083,58 @@ type ICMPStats struct {
 	V6PacketsReceived ICMPv6ReceivedPacketStats
 }
 
+// IGMPPacketStats enumerates counts for all IGMP packet types.
+type IGMPPacketStats struct {
+	// MembershipQuery is the total number of IGMP membership query packets
+	// counted.
+	MembershipQuery *StatCounter
+
+	// V1MembershipReport is the total number of IGMPv1 membership report
+	// packets counted.
+	V1MembershipReport *StatCounter
+
+	// V2MembershipReport is the total number of IGMPv2 membership report
+	// packets counted.
+	V2MembershipReport *StatCounter
+
+	// LeaveGroup is the total number of IGMPv2 leave group packets
+	// counted.
+	LeaveGroup *StatCounter
+
+	// V3MembershipReport is the total number of IGMPv3 membership report
+	// packets counted.
+	V3MembershipReport *StatCounter
+}
+
+// IGMPSentPacketStats collects outbound IGMP-specific stats.
+type IGMPSentPacketStats struct {
+	IGMPPacketStats
+
+	// Dropped is the total number of IGMP packets dropped due to link
+	// layer errors.
+	Dropped *StatCounter
+}
+
+// IGMPReceivedPacketStats collects inbound IGMP-specific stats.
+type IGMPReceivedPacketStats struct {
+	IGMPPacketStats
+
+	// Invalid is the total number of IGMP packets received that IGMP could
+	// not parse.
+	Invalid *StatCounter
+}
+
+// IGMPStats collects IGMP-specific stats.
+type IGMPStats struct {
+	// PacketsSent contains counts of sent packets by IGMP packet type and
+	// a single count of packets which failed to write to the link layer.
+	PacketsSent IGMPSentPacketStats
+
+	// PacketsReceived contains counts of received packets by IGMP packet
+	// type and a single count of invalid packets received.
+	PacketsReceived IGMPReceivedPacketStats
+}
+
 // IPStats collects IP-specific stats (both v4 and v6).
 type IPStats struct {
 	// PacketsReceived is the total number of IP packets received from the
@@ -801,6 +1209,63 @@ type TCPStats struct {
 
 	// Timeouts is the number of times the RTO expired.
 	Timeouts *StatCounter
+
+	// MTUProbes is the number of path MTU probes sent.
+	MTUProbes *StatCounter
+
+	// TailLossProbes is the number of tail loss probes sent.
+	TailLossProbes *StatCounter
+
+	// MD5Failures is the number of segments dropped because their MD5
+	// signature was missing, unexpected or wrong.
+	MD5Failures *StatCounter
+}
+
+// SCTPStats collects SCTP-specific stats.
+type SCTPStats struct {
+	// ActiveEstablishments is the number of associations established
+	// after sending an INIT.
+	ActiveEstablishments *StatCounter
+
+	// PassiveEstablishments is the number of associations established
+	// after receiving an INIT.
+	PassiveEstablishments *StatCounter
+
+	// FailedAssociationAttempts is the number of associations that failed
+	// before being established.
+	FailedAssociationAttempts *StatCounter
+
+	// Aborts is the number of established associations that ended with
+	// an ABORT, sent or received, or because the peer became unreachable.
+	Aborts *StatCounter
+
+	// Shutdowns is the number of associations that were shut down
+	// gracefully.
+	Shutdowns *StatCounter
+
+	// PacketsReceived is the number of SCTP packets received.
+	PacketsReceived *StatCounter
+
+	// PacketsSent is the number of SCTP packets sent.
+	PacketsSent *StatCounter
+
+	// ChecksumErrors is the number of SCTP packets dropped because of an
+	// invalid checksum.
+	ChecksumErrors *StatCounter
+
+	// MalformedPacketsReceived is the number of SCTP packets dropped
+	// because their chunks are malformed.
+	MalformedPacketsReceived *StatCounter
+
+	// OutOfTheBluePackets is the number of SCTP packets received that
+	// don't belong to any association.
+	OutOfTheBluePackets *StatCounter
+
+	// Retransmits is the number of DATA chunks retransmitted.
+	Retransmits *StatCounter
+
+	// AbandonedMessages is the number of messages abandoned by PR-SCTP.
+	AbandonedMessages *StatCounter
 }
 
 // UDPStats collects UDP-specific stats.
@@ -843,6 +1308,9 @@ type Stats struct {
 	// ICMP breaks out ICMP-specific stats (both v4 and v6).
 	ICMP ICMPStats
 
+	// IGMP breaks out IGMP-specific stats.
+	IGMP IGMPStats
+
 	// IP breaks out IP-specific stats (both v4 and v6).
 	IP IPStats
 
@@ -851,6 +1319,9 @@ type Stats struct {
 
 	// UDP breaks out UDP-specific stats.
 	UDP UDPStats
+
+	// SCTP breaks out SCTP-specific stats.
+	SCTP SCTPStats
 }
 
 func fillIn(v reflect.Value) {
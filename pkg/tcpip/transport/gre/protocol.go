@@ -0,0 +1,92 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gre contains the registration of the GRE transport protocol, so
+// that the networking stack delivers GRE packets to the GRE tunnels of
+// package tunnel. To use it in the networking stack, this package must be
+// added to the project, and activated on the stack by passing
+// gre.ProtocolName (or "gre") as one of the transport protocols when calling
+// stack.New().
+//
+// GRE endpoints can't be created: GRE packets are only handled by tunnels,
+// which register as raw endpoints of the protocol.
+package gre
+
+import (
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+const (
+	// ProtocolName is the string representation of the gre protocol name.
+	ProtocolName = "gre"
+
+	// ProtocolNumber is the gre protocol number.
+	ProtocolNumber = header.GREProtocolNumber
+)
+
+// protocol implements stack.TransportProtocol.
+type protocol struct{}
+
+// Number returns the gre protocol number.
+func (*protocol) Number() tcpip.TransportProtocolNumber {
+	return ProtocolNumber
+}
+
+// NewEndpoint implements stack.TransportProtocol.NewEndpoint. GRE endpoints
+// aren't supported.
+func (*protocol) NewEndpoint(*stack.Stack, tcpip.NetworkProtocolNumber, *waiter.Queue) (tcpip.Endpoint, *tcpip.Error) {
+	return nil, tcpip.ErrUnknownProtocol
+}
+
+// NewRawEndpoint implements stack.TransportProtocol.NewRawEndpoint. Raw GRE
+// endpoints aren't supported.
+func (*protocol) NewRawEndpoint(*stack.Stack, tcpip.NetworkProtocolNumber, *waiter.Queue) (tcpip.Endpoint, *tcpip.Error) {
+	return nil, tcpip.ErrUnknownProtocol
+}
+
+// MinimumPacketSize returns the minimum valid gre packet size.
+func (*protocol) MinimumPacketSize() int {
+	return header.GREMinimumSize
+}
+
+// ParsePorts implements stack.TransportProtocol.ParsePorts. GRE has no ports.
+func (*protocol) ParsePorts(buffer.View) (src, dst uint16, err *tcpip.Error) {
+	return 0, 0, nil
+}
+
+// HandleUnknownDestinationPacket handles gre packets that no tunnel accepts,
+// by dropping them.
+func (*protocol) HandleUnknownDestinationPacket(*stack.Route, stack.TransportEndpointID, buffer.VectorisedView) bool {
+	return true
+}
+
+// SetOption implements TransportProtocol.SetOption.
+func (*protocol) SetOption(option interface{}) *tcpip.Error {
+	return tcpip.ErrUnknownProtocolOption
+}
+
+// Option implements TransportProtocol.Option.
+func (*protocol) Option(option interface{}) *tcpip.Error {
+	return tcpip.ErrUnknownProtocolOption
+}
+
+func init() {
+	stack.RegisterTransportProtocolFactory(ProtocolName, func() stack.TransportProtocol {
+		return &protocol{}
+	})
+}
@@ -0,0 +1,801 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mptcp
+
+import (
+	"sync"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/sleep"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+type endpointState int
+
+const (
+	stateInitial endpointState = iota
+	stateBound
+	stateListen
+	stateConnecting
+	stateConnected
+	stateClosed
+	stateError
+)
+
+// endpoint represents an MPTCP endpoint. This struct serves as the interface
+// between users of the endpoint and the protocol implementation; it is legal
+// to have concurrent goroutines make calls into the endpoint, they are
+// properly synchronized.
+//
+// The endpoint binds, listens and connects through its primary endpoint, a
+// TCP endpoint whose subflow is the initial subflow of the connection it
+// establishes. The connection is run by a worker goroutine, which is the only
+// one calling into the TCP endpoints of its subflows once they're started.
+//
+// +stateify savable
+type endpoint struct {
+	// The following fields are initialized at creation time and do not
+	// change throughout the lifetime of the endpoint.
+	stack       *stack.Stack `state:"manual"`
+	netProto    tcpip.NetworkProtocolNumber
+	waiterQueue *waiter.Queue
+
+	// mu protects all the fields below, as well as the subflows of the
+	// endpoint.
+	mu sync.Mutex `state:"nosave"`
+
+	// events are the events to notify waiters of once mu is unlocked.
+	events waiter.EventMask `state:"nosave"`
+
+	state endpointState
+
+	// hardError is the error the connection failed with, and lastError
+	// the error reported by ErrorOption.
+	hardError *tcpip.Error `state:"nosave"`
+	lastError *tcpip.Error `state:"nosave"`
+
+	// isConnectNotified is whether Connect reported the establishment of
+	// the connection.
+	isConnectNotified bool
+
+	// closed is whether Close was called, and closedAt when.
+	closed   bool
+	closedAt time.Time `state:"nosave"`
+
+	// bindAddr is the address the endpoint is bound to, and backlog the
+	// backlog of a listening endpoint. They are used to restore the
+	// primary endpoint.
+	bindAddr tcpip.FullAddress
+	backlog  int
+
+	// primary is the TCP endpoint through which the endpoint binds,
+	// listens and establishes its connection, and primaryQueue its waiter
+	// queue. primaryEntry is registered with primaryQueue by listening
+	// endpoints.
+	primary      tcpip.Endpoint `state:"nosave"`
+	primaryQueue *waiter.Queue  `state:"nosave"`
+	primaryEntry waiter.Entry   `state:"nosave"`
+
+	// pending holds the connections established by the primary endpoint
+	// of a listening endpoint and not accepted yet, by their initial
+	// subflow. listener is the listening endpoint of an accepted
+	// connection.
+	pending  map[tcpip.Endpoint]*endpoint `state:"nosave"`
+	listener *endpoint                    `state:"nosave"`
+
+	// sockOpts are the options set on the endpoint that are also set on
+	// the subflows it opens.
+	sockOpts []interface{} `state:"nosave"`
+
+	// The following fields hold the state of the connection. They aren't
+	// saved: connections are aborted on restore.
+
+	// fallback is set when the connection fell back to TCP, in which case
+	// data sequence numbers are offsets in the byte stream of its only
+	// subflow.
+	fallback bool `state:"nosave"`
+
+	// localKey and remoteKey are the keys of both ends of the connection,
+	// from which their tokens and initial data sequence numbers derive.
+	// fullyEstablished is set once both ends know both keys.
+	localKey          uint64 `state:"nosave"`
+	localToken        uint32 `state:"nosave"`
+	tokenRegistered   bool   `state:"nosave"`
+	remoteKey         uint64 `state:"nosave"`
+	remoteToken       uint32 `state:"nosave"`
+	remoteIDSN        uint64 `state:"nosave"`
+	remoteKeyReceived bool   `state:"nosave"`
+	fullyEstablished  bool   `state:"nosave"`
+
+	// remoteAddr is the address of the peer of the initial subflow.
+	remoteAddr tcpip.FullAddress `state:"nosave"`
+
+	// initial is the initial subflow of the connection, and subflows all
+	// the subflows that weren't released yet.
+	initial  *subflow   `state:"nosave"`
+	subflows []*subflow `state:"nosave"`
+
+	// workerRunning is set while the worker goroutine of the connection
+	// runs. It is woken up through workWaker, and periodically through
+	// tickWaker.
+	workerRunning bool        `state:"nosave"`
+	workWaker     sleep.Waker `state:"nosave"`
+	tickWaker     sleep.Waker `state:"nosave"`
+
+	// The send queue holds the data from sndUna, the first data sequence
+	// number not acknowledged by the peer, to the end of the queue. sndNxt
+	// is the first data sequence number not sent yet. reinject holds the
+	// data sent on failed or stalled subflows, which is sent again on the
+	// other subflows.
+	sndBuf     buffer.VectorisedView `state:"nosave"`
+	sndBufSize int
+	sndUna     uint64      `state:"nosave"`
+	sndNxt     uint64      `state:"nosave"`
+	reinject   []dataRange `state:"nosave"`
+
+	// sndClosed is set once the endpoint was shut down for writing. The
+	// DATA_FIN then follows the data of the send queue, and dataFinAcked
+	// is set once the peer acknowledged it. dataFinSent is when it was
+	// last signaled.
+	sndClosed    bool
+	dataFinAcked bool      `state:"nosave"`
+	dataFinSent  time.Time `state:"nosave"`
+
+	// rcvList holds the data received in sequence and not read yet, and
+	// rcvOOO the data received out of sequence, sorted by data sequence
+	// number. rcvNxt is the next data sequence number expected.
+	rcvList       []buffer.View `state:"nosave"`
+	rcvOOO        []rcvChunk    `state:"nosave"`
+	rcvBufSizeMax int
+	rcvBufUsed    int    `state:"nosave"`
+	rcvNxt        uint64 `state:"nosave"`
+
+	// rcvFin is set once the peer sent its DATA_FIN, whose data sequence
+	// number is rcvFinDSN, and rcvClosed once all the data preceding it
+	// was received. rcvShutdown is set once the endpoint was shut down for
+	// reading.
+	rcvFin      bool   `state:"nosave"`
+	rcvFinDSN   uint64 `state:"nosave"`
+	rcvClosed   bool   `state:"nosave"`
+	rcvShutdown bool
+
+	// The following fields are used by the path manager. localAddrIDs
+	// holds the identifiers of the local addresses of the connection;
+	// the address of the initial subflow is 0. remoteAddrs are the
+	// addresses announced by the peer, and announced the addresses
+	// announced to the peer. removed holds the identifiers of the local
+	// addresses withdrawn and not signaled to the peer yet, and echoes
+	// the announcements of the peer not echoed yet. paths holds when
+	// subflows were last opened, by path.
+	localAddrIDs map[tcpip.Address]uint8 `state:"nosave"`
+	nextAddrID   uint8                   `state:"nosave"`
+	remoteAddrs  []remoteAddr            `state:"nosave"`
+	announced    []*announcement         `state:"nosave"`
+	removed      []uint8                 `state:"nosave"`
+	echoes       []header.MPTCPAddAddr   `state:"nosave"`
+	paths        map[pathKey]time.Time   `state:"nosave"`
+}
+
+// rcvChunk is data received out of sequence.
+type rcvChunk struct {
+	dsn uint64
+	v   buffer.View
+}
+
+// dataRange is a range of data to send again.
+type dataRange struct {
+	dsn  uint64
+	size uint64
+
+	// from is the subflow the data was sent on.
+	from *subflow
+}
+
+func newEndpoint(s *stack.Stack, netProto tcpip.NetworkProtocolNumber, waiterQueue *waiter.Queue) *endpoint {
+	e := &endpoint{
+		stack:         s,
+		netProto:      netProto,
+		waiterQueue:   waiterQueue,
+		rcvBufSizeMax: DefaultBufferSize,
+		sndBufSize:    DefaultBufferSize,
+	}
+	e.initPrimary()
+	return e
+}
+
+// initPrimary creates the primary endpoint of e, with the initial subflow of
+// the connection it may establish.
+func (e *endpoint) initPrimary() {
+	e.primaryQueue = &waiter.Queue{}
+	e.initial = newSubflow(e, subflowCapable, true)
+	e.primary = tcp.NewSubflowEndpoint(e.stack, e.netProto, e.primaryQueue, e.initial, e)
+	e.initial.tcpEP = e.primary
+	e.initial.wq = e.primaryQueue
+}
+
+// newAcceptedEndpoint returns a new endpoint for a connection accepted by the
+// listening endpoint e, with the options of e.
+func (e *endpoint) newAcceptedEndpoint() *endpoint {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return &endpoint{
+		stack:         e.stack,
+		netProto:      e.netProto,
+		waiterQueue:   &waiter.Queue{},
+		listener:      e,
+		sockOpts:      append([]interface{}(nil), e.sockOpts...),
+		rcvBufSizeMax: e.rcvBufSizeMax,
+		sndBufSize:    e.sndBufSize,
+	}
+}
+
+// protocol returns the protocol instance of the stack of e.
+func (e *endpoint) protocol() *protocol {
+	return e.stack.TransportProtocolInstance(ProtocolNumber).(*protocol)
+}
+
+// unlockAndNotify unlocks e.mu, and notifies the waiters of the events raised
+// while it was locked.
+func (e *endpoint) unlockAndNotify() {
+	events := e.events
+	e.events = 0
+	e.mu.Unlock()
+	if events != 0 {
+		e.waiterQueue.Notify(events)
+	}
+}
+
+// Callback implements waiter.EntryCallback. It is invoked by the primary
+// endpoint of a listening endpoint when connections are ready to be accepted.
+func (e *endpoint) Callback(*waiter.Entry) {
+	e.waiterQueue.Notify(waiter.EventIn)
+}
+
+// Close puts the endpoint in a closed state and frees all resources associated
+// with it. Established connections are shut down in the background.
+func (e *endpoint) Close() {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return
+	}
+	e.closed = true
+	e.closedAt = time.Now()
+	e.sndClosed = true
+	e.rcvShutdown = true
+
+	if e.workerRunning {
+		// The worker closes the subflows of the connection.
+		e.wakeWorkerLocked()
+		e.unlockAndNotify()
+		return
+	}
+
+	// The primary endpoint of connections that ran is closed by their
+	// worker. Connections established by the primary endpoint of a
+	// listening endpoint are closed along with it.
+	primary := e.primary
+	prevState := e.state
+	e.state = stateClosed
+	e.releasePendingLocked()
+	e.events |= waiter.EventHUp | waiter.EventIn | waiter.EventOut
+	e.unlockAndNotify()
+
+	switch prevState {
+	case stateListen:
+		e.primaryQueue.EventUnregister(&e.primaryEntry)
+		primary.Close()
+	case stateInitial, stateBound:
+		primary.Close()
+	}
+}
+
+// releasePendingLocked releases the connections established by the primary
+// endpoint of the listening endpoint e and not accepted yet, whose initial
+// subflows are closed by the primary endpoint.
+func (e *endpoint) releasePendingLocked() {
+	for _, n := range e.pending {
+		n.mu.Lock()
+		n.initial.closed = true
+		n.state = stateClosed
+		if n.tokenRegistered {
+			n.protocol().unregisterToken(n.localToken)
+			n.tokenRegistered = false
+		}
+		n.mu.Unlock()
+	}
+	e.pending = nil
+}
+
+// Read reads data from the endpoint.
+func (e *endpoint) Read(*tcpip.FullAddress) (buffer.View, tcpip.ControlMessages, *tcpip.Error) {
+	e.mu.Lock()
+	if len(e.rcvList) == 0 {
+		err := e.rcvErrorLocked()
+		e.mu.Unlock()
+		return buffer.View{}, tcpip.ControlMessages{}, err
+	}
+
+	v := e.rcvList[0]
+	e.rcvList[0] = nil
+	e.rcvList = e.rcvList[1:]
+	e.consumeLocked(len(v))
+	e.mu.Unlock()
+	return v, tcpip.ControlMessages{}, nil
+}
+
+// rcvErrorLocked returns the error of reads from the endpoint when no data is
+// available.
+func (e *endpoint) rcvErrorLocked() *tcpip.Error {
+	switch {
+	case e.rcvClosed || e.rcvShutdown:
+		return tcpip.ErrClosedForReceive
+	case e.state == stateConnected:
+		return tcpip.ErrWouldBlock
+	case e.state == stateError:
+		return e.hardError
+	case e.state == stateClosed:
+		return tcpip.ErrClosedForReceive
+	default:
+		return tcpip.ErrInvalidEndpointState
+	}
+}
+
+// Write writes data to the endpoint's peer.
+func (e *endpoint) Write(p tcpip.Payload, opts tcpip.WriteOptions) (uintptr, <-chan struct{}, *tcpip.Error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch {
+	case e.state == stateError:
+		return 0, nil, e.hardError
+	case e.state != stateConnected || e.sndClosed:
+		return 0, nil, tcpip.ErrClosedForSend
+	}
+
+	// Nothing to do if the buffer is empty.
+	if p.Size() == 0 {
+		return 0, nil, nil
+	}
+
+	avail := e.sndBufSize - e.sndBuf.Size()
+	if avail <= 0 {
+		return 0, nil, tcpip.ErrWouldBlock
+	}
+	v, err := p.Get(avail)
+	if err != nil {
+		return 0, nil, err
+	}
+	e.sndBuf.Append(buffer.View(v).ToVectorisedView())
+	e.wakeWorkerLocked()
+	return uintptr(len(v)), nil, nil
+}
+
+// Peek reads data without consuming it from the endpoint.
+func (e *endpoint) Peek(vec [][]byte) (uintptr, tcpip.ControlMessages, *tcpip.Error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.rcvList) == 0 {
+		return 0, tcpip.ControlMessages{}, e.rcvErrorLocked()
+	}
+
+	// Make a copy of vec so that we don't modify the slice of the caller.
+	vec = append([][]byte(nil), vec...)
+
+	var num uintptr
+	for _, v := range e.rcvList {
+		for len(v) > 0 {
+			if len(vec) == 0 {
+				return num, tcpip.ControlMessages{}, nil
+			}
+			if len(vec[0]) == 0 {
+				vec = vec[1:]
+				continue
+			}
+			n := copy(vec[0], v)
+			v = v[n:]
+			vec[0] = vec[0][n:]
+			num += uintptr(n)
+		}
+	}
+	return num, tcpip.ControlMessages{}, nil
+}
+
+// Connect connects the endpoint to its peer.
+func (e *endpoint) Connect(addr tcpip.FullAddress) *tcpip.Error {
+	e.mu.Lock()
+	switch e.state {
+	case stateInitial, stateBound:
+	case stateConnecting:
+		e.mu.Unlock()
+		return tcpip.ErrAlreadyConnecting
+	case stateConnected:
+		// The endpoint is already connected. If the caller hasn't been
+		// notified yet, return success.
+		notified := e.isConnectNotified
+		e.isConnectNotified = true
+		e.mu.Unlock()
+		if !notified {
+			return nil
+		}
+		return tcpip.ErrAlreadyConnected
+	case stateError:
+		err := e.hardError
+		e.mu.Unlock()
+		return err
+	default:
+		e.mu.Unlock()
+		return tcpip.ErrInvalidEndpointState
+	}
+
+	// The key of the connection is chosen now, so that its token can be
+	// registered before any subflow joins.
+	p := e.protocol()
+	for {
+		e.localKey = p.newKey()
+		e.localToken, e.sndUna = header.MPTCPTokenAndIDSN(e.localKey)
+		if p.registerToken(e.localToken, e) {
+			break
+		}
+	}
+	e.tokenRegistered = true
+	e.sndUna++
+	e.sndNxt = e.sndUna
+	prevState := e.state
+	e.state = stateConnecting
+	e.addSubflowLocked(e.initial)
+	e.mu.Unlock()
+
+	err := e.primary.Connect(addr)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil && err != tcpip.ErrConnectStarted {
+		e.removeSubflowLocked(e.initial)
+		e.initial.wq.EventUnregister(&e.initial.entry)
+		p.unregisterToken(e.localToken)
+		e.tokenRegistered = false
+		e.state = prevState
+		return err
+	}
+	e.startWorkerLocked()
+	return err
+}
+
+// Shutdown closes the read and/or write end of the endpoint connection to its
+// peer.
+func (e *endpoint) Shutdown(flags tcpip.ShutdownFlags) *tcpip.Error {
+	e.mu.Lock()
+	switch e.state {
+	case stateConnected:
+		if flags&tcpip.ShutdownWrite != 0 && !e.sndClosed {
+			e.sndClosed = true
+			e.wakeWorkerLocked()
+		}
+		if flags&tcpip.ShutdownRead != 0 {
+			e.rcvShutdown = true
+			e.events |= waiter.EventIn
+		}
+		e.unlockAndNotify()
+		return nil
+
+	case stateListen:
+		if flags&tcpip.ShutdownRead != 0 {
+			// The primary endpoint stops listening.
+			e.releasePendingLocked()
+		}
+		e.mu.Unlock()
+		return e.primary.Shutdown(flags)
+
+	default:
+		e.mu.Unlock()
+		return tcpip.ErrNotConnected
+	}
+}
+
+// Listen puts the endpoint in "listen" mode, which allows it to accept new
+// connections.
+func (e *endpoint) Listen(backlog int) *tcpip.Error {
+	e.mu.Lock()
+	switch e.state {
+	case stateInitial, stateBound, stateListen:
+	default:
+		e.mu.Unlock()
+		return tcpip.ErrInvalidEndpointState
+	}
+	if e.pending == nil {
+		e.pending = make(map[tcpip.Endpoint]*endpoint)
+	}
+	e.mu.Unlock()
+
+	if err := e.primary.Listen(backlog); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.state != stateListen {
+		e.state = stateListen
+		e.bindAddr, _ = e.primary.GetLocalAddress()
+		e.primaryEntry.Callback = e
+		e.primaryQueue.EventRegister(&e.primaryEntry, waiter.EventIn)
+	}
+	e.backlog = backlog
+	return nil
+}
+
+// Accept returns a new endpoint if a peer has established a connection to an
+// endpoint previously set to listen mode.
+func (e *endpoint) Accept() (tcpip.Endpoint, *waiter.Queue, *tcpip.Error) {
+	e.mu.Lock()
+	if e.state != stateListen {
+		e.mu.Unlock()
+		return nil, nil, tcpip.ErrInvalidEndpointState
+	}
+	e.mu.Unlock()
+
+	ep, wq, err := e.primary.Accept()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The connection of the subflow was added to pending when its
+	// handshake completed, before the subflow was queued. Its worker
+	// starts along with the protocol goroutine of the subflow.
+	e.mu.Lock()
+	n := e.pending[ep]
+	delete(e.pending, ep)
+	e.mu.Unlock()
+	if n == nil {
+		ep.Close()
+		return nil, nil, tcpip.ErrWouldBlock
+	}
+
+	n.mu.Lock()
+	n.primaryQueue = wq
+	n.initial.wq = wq
+	n.addSubflowLocked(n.initial)
+	n.startWorkerLocked()
+	n.mu.Unlock()
+	return n, n.waiterQueue, nil
+}
+
+// Bind binds the endpoint to a specific local address and port.
+func (e *endpoint) Bind(addr tcpip.FullAddress) *tcpip.Error {
+	e.mu.Lock()
+	if e.state != stateInitial {
+		e.mu.Unlock()
+		return tcpip.ErrAlreadyBound
+	}
+	e.mu.Unlock()
+
+	if err := e.primary.Bind(addr); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.state = stateBound
+	e.bindAddr, _ = e.primary.GetLocalAddress()
+	e.mu.Unlock()
+	return nil
+}
+
+// GetLocalAddress returns the address to which the endpoint is bound.
+func (e *endpoint) GetLocalAddress() (tcpip.FullAddress, *tcpip.Error) {
+	e.mu.Lock()
+	primary := e.primary
+	e.mu.Unlock()
+	return primary.GetLocalAddress()
+}
+
+// GetRemoteAddress returns the address to which the endpoint is connected.
+func (e *endpoint) GetRemoteAddress() (tcpip.FullAddress, *tcpip.Error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.state != stateConnected {
+		return tcpip.FullAddress{}, tcpip.ErrNotConnected
+	}
+	return e.remoteAddr, nil
+}
+
+// Readiness returns the current readiness of the endpoint. For example, if
+// waiter.EventIn is set, the endpoint is immediately readable.
+func (e *endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	result := waiter.EventMask(0)
+	switch e.state {
+	case stateInitial, stateBound, stateConnecting:
+		// Ready for nothing.
+
+	case stateClosed, stateError:
+		// Ready for anything.
+		result = mask
+
+	case stateListen:
+		if len(e.pending) > 0 {
+			result |= waiter.EventIn
+		}
+
+	case stateConnected:
+		if e.sndClosed || e.sndBuf.Size() < e.sndBufSize {
+			result |= waiter.EventOut
+		}
+		if len(e.rcvList) > 0 || e.rcvClosed || e.rcvShutdown {
+			result |= waiter.EventIn
+		}
+	}
+	return result & mask
+}
+
+// SetSockOpt sets a socket option. Options that aren't specific to MPTCP are
+// set on the primary endpoint, and on the subflows opened afterwards.
+func (e *endpoint) SetSockOpt(opt interface{}) *tcpip.Error {
+	switch v := opt.(type) {
+	case tcpip.SendBufferSizeOption:
+		// Make sure the send buffer size is within the min and max
+		// allowed.
+		var ss tcp.SendBufferSizeOption
+		if err := e.stack.TransportProtocolOption(tcp.ProtocolNumber, &ss); err == nil {
+			if int(v) < ss.Min {
+				v = tcpip.SendBufferSizeOption(ss.Min)
+			}
+			if int(v) > ss.Max {
+				v = tcpip.SendBufferSizeOption(ss.Max)
+			}
+		}
+		e.mu.Lock()
+		e.sndBufSize = int(v)
+		e.events |= waiter.EventOut
+		e.unlockAndNotify()
+		return nil
+
+	case tcpip.ReceiveBufferSizeOption:
+		var rs tcp.ReceiveBufferSizeOption
+		if err := e.stack.TransportProtocolOption(tcp.ProtocolNumber, &rs); err == nil {
+			if int(v) < rs.Min {
+				v = tcpip.ReceiveBufferSizeOption(rs.Min)
+			}
+			if int(v) > rs.Max {
+				v = tcpip.ReceiveBufferSizeOption(rs.Max)
+			}
+		}
+		e.mu.Lock()
+		e.rcvBufSizeMax = int(v)
+		e.signalSubflowsLocked()
+		e.mu.Unlock()
+		return nil
+	}
+
+	e.mu.Lock()
+	primary := e.primary
+	e.mu.Unlock()
+	if err := primary.SetSockOpt(opt); err != nil {
+		return err
+	}
+
+	switch opt.(type) {
+	case tcpip.BindToDeviceOption, tcpip.V6OnlyOption, tcpip.ReuseAddressOption, tcpip.ReusePortOption:
+		// These options only apply to the primary endpoint: the other
+		// subflows are bound to the addresses of their paths.
+	default:
+		e.mu.Lock()
+		e.sockOpts = append(e.sockOpts, opt)
+		e.mu.Unlock()
+	}
+	return nil
+}
+
+// GetSockOpt implements tcpip.Endpoint.GetSockOpt. Options that aren't
+// specific to MPTCP are those of the primary endpoint.
+func (e *endpoint) GetSockOpt(opt interface{}) *tcpip.Error {
+	switch o := opt.(type) {
+	case tcpip.ErrorOption:
+		e.mu.Lock()
+		err := e.lastError
+		e.lastError = nil
+		e.mu.Unlock()
+		return err
+
+	case *tcpip.SendBufferSizeOption:
+		e.mu.Lock()
+		*o = tcpip.SendBufferSizeOption(e.sndBufSize)
+		e.mu.Unlock()
+		return nil
+
+	case *tcpip.ReceiveBufferSizeOption:
+		e.mu.Lock()
+		*o = tcpip.ReceiveBufferSizeOption(e.rcvBufSizeMax)
+		e.mu.Unlock()
+		return nil
+
+	case *tcpip.ReceiveQueueSizeOption:
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if e.state != stateConnected && e.rcvBufUsed == 0 {
+			return tcpip.ErrInvalidEndpointState
+		}
+		*o = tcpip.ReceiveQueueSizeOption(e.rcvBufUsed)
+		return nil
+
+	case *tcpip.SendQueueSizeOption:
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if e.state == stateListen {
+			return tcpip.ErrInvalidEndpointState
+		}
+		*o = tcpip.SendQueueSizeOption(e.sndBuf.Size())
+		return nil
+
+	case *tcpip.MPTCPInfoOption:
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if e.state != stateConnected {
+			return tcpip.ErrNotConnected
+		}
+		e.infoLocked(o)
+		return nil
+	}
+
+	e.mu.Lock()
+	primary := e.primary
+	e.mu.Unlock()
+	return primary.GetSockOpt(opt)
+}
+
+// infoLocked fills the MPTCP_INFO of the connection of e.
+func (e *endpoint) infoLocked(o *tcpip.MPTCPInfoOption) {
+	maxSubflows, _ := e.protocol().limits(0)
+	*o = tcpip.MPTCPInfoOption{
+		SubflowsMax:        uint8(maxSubflows - 1),
+		AddAddrSignalMax:   maxAddresses,
+		AddAddrAcceptedMax: maxAddresses,
+		Token:              e.localToken,
+		WriteSeq:           e.sndEnd(),
+		SndUna:             e.sndUna,
+		RcvNxt:             e.rcvNxt,
+		LocalAddrMax:       maxAddresses,
+	}
+	for _, sf := range e.subflows {
+		if sf != e.initial && sf.established && !sf.done {
+			o.Subflows++
+		}
+	}
+	o.AddAddrSignal = uint8(len(e.announced))
+	o.AddAddrAccepted = uint8(len(e.remoteAddrs))
+	o.LocalAddrUsed = uint8(len(e.localAddrIDs))
+	if e.fallback {
+		o.Flags |= tcpip.MPTCPInfoFallback
+	}
+	if e.remoteKeyReceived {
+		o.Flags |= tcpip.MPTCPInfoRemoteKeyReceived
+	}
+}
+
+// setErrorLocked fails the connection of e with err.
+func (e *endpoint) setErrorLocked(err *tcpip.Error) {
+	e.state = stateError
+	e.hardError = err
+	e.lastError = err
+	e.events |= waiter.EventHUp | waiter.EventErr | waiter.EventIn | waiter.EventOut
+	e.wakeWorkerLocked()
+}
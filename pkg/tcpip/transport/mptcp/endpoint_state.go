@@ -0,0 +1,57 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mptcp
+
+import (
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+// afterLoad is invoked by stateify.
+func (e *endpoint) afterLoad() {
+	e.stack = stack.StackFromEnv
+	e.initPrimary()
+
+	// Connections aren't saved: their subflows are gone, so they are
+	// aborted.
+	switch {
+	case e.closed:
+		e.state = stateClosed
+		return
+	case e.state == stateConnecting || e.state == stateConnected:
+		e.state = stateError
+		e.hardError = tcpip.ErrConnectionAborted
+		e.lastError = tcpip.ErrConnectionAborted
+		return
+	}
+
+	// The primary endpoint of bound and listening endpoints is bound, and
+	// listening, again.
+	if e.state != stateBound && e.state != stateListen {
+		return
+	}
+	if err := e.primary.Bind(e.bindAddr); err != nil {
+		panic(*err)
+	}
+	if e.state == stateListen {
+		e.pending = make(map[tcpip.Endpoint]*endpoint)
+		if err := e.primary.Listen(e.backlog); err != nil {
+			panic(*err)
+		}
+		e.primaryEntry.Callback = e
+		e.primaryQueue.EventRegister(&e.primaryEntry, waiter.EventIn)
+	}
+}
@@ -0,0 +1,366 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mptcp_test
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/channel"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/mptcp"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+const (
+	// The client stack has the addresses 10.0.N.1, and the server stack
+	// the addresses 10.0.N.2, on their NIC N+1.
+	clientAddr = "\x0a\x00\x00\x01"
+	serverAddr = "\x0a\x00\x00\x02"
+	serverPort = 1234
+
+	defaultMTU = 1500
+	timeout    = 10 * time.Second
+)
+
+// link forwards the packets sent by an endpoint of a channel to the other
+// one, unless it is down.
+type link struct {
+	mu   sync.Mutex
+	down bool
+}
+
+func (l *link) setDown(down bool) {
+	l.mu.Lock()
+	l.down = down
+	l.mu.Unlock()
+}
+
+func (l *link) isDown() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.down
+}
+
+func (l *link) forward(from, to *channel.Endpoint, done <-chan struct{}) {
+	for {
+		select {
+		case p := <-from.C:
+			if l.isDown() {
+				continue
+			}
+			v := append(append(buffer.View(nil), p.Header...), p.Payload...)
+			to.Inject(p.Proto, v.ToVectorisedView())
+		case <-done:
+			return
+		}
+	}
+}
+
+type testContext struct {
+	t      *testing.T
+	client *stack.Stack
+	server *stack.Stack
+
+	// links are the links from clients to servers and from servers to
+	// clients of each pair of NICs.
+	links [][2]*link
+	done  chan struct{}
+}
+
+// newTestContext returns two stacks connected by the given number of links.
+func newTestContext(t *testing.T, nics int) *testContext {
+	protos := []string{tcp.ProtocolName, mptcp.ProtocolName}
+	c := &testContext{
+		t:      t,
+		client: stack.New([]string{ipv4.ProtocolName}, protos, stack.Options{}),
+		server: stack.New([]string{ipv4.ProtocolName}, protos, stack.Options{}),
+		done:   make(chan struct{}),
+	}
+	var clientRoutes, serverRoutes []tcpip.Route
+	for i := 0; i < nics; i++ {
+		nicid := tcpip.NICID(i + 1)
+		cid, cep := channel.New(256, defaultMTU, "")
+		sid, sep := channel.New(256, defaultMTU, "")
+		if err := c.client.CreateNIC(nicid, cid); err != nil {
+			t.Fatalf("CreateNIC failed: %v", err)
+		}
+		if err := c.server.CreateNIC(nicid, sid); err != nil {
+			t.Fatalf("CreateNIC failed: %v", err)
+		}
+		subnet := "\x0a\x00" + string(byte(i)) + "\x00"
+		if err := c.client.AddAddress(nicid, ipv4.ProtocolNumber, tcpip.Address(subnet[:3]+"\x01")); err != nil {
+			t.Fatalf("AddAddress failed: %v", err)
+		}
+		if err := c.server.AddAddress(nicid, ipv4.ProtocolNumber, tcpip.Address(subnet[:3]+"\x02")); err != nil {
+			t.Fatalf("AddAddress failed: %v", err)
+		}
+		route := tcpip.Route{
+			Destination: tcpip.Address(subnet),
+			Mask:        "\xff\xff\xff\x00",
+			NIC:         nicid,
+		}
+		clientRoutes = append(clientRoutes, route)
+		serverRoutes = append(serverRoutes, route)
+
+		l := [2]*link{{}, {}}
+		go l[0].forward(cep, sep, c.done)
+		go l[1].forward(sep, cep, c.done)
+		c.links = append(c.links, l)
+	}
+	c.client.SetRouteTable(clientRoutes)
+	c.server.SetRouteTable(serverRoutes)
+	return c
+}
+
+func (c *testContext) cleanup() {
+	close(c.done)
+}
+
+func (c *testContext) newEndpoint(s *stack.Stack, proto tcpip.TransportProtocolNumber) (tcpip.Endpoint, *waiter.Queue) {
+	var wq waiter.Queue
+	ep, err := s.NewEndpoint(proto, ipv4.ProtocolNumber, &wq)
+	if err != nil {
+		c.t.Fatalf("NewEndpoint failed: %v", err)
+	}
+	return ep, &wq
+}
+
+// listen creates a server endpoint of the given protocol listening on
+// serverPort.
+func (c *testContext) listen(proto tcpip.TransportProtocolNumber) (tcpip.Endpoint, *waiter.Queue) {
+	ep, wq := c.newEndpoint(c.server, proto)
+	if err := ep.Bind(tcpip.FullAddress{Port: serverPort}); err != nil {
+		c.t.Fatalf("Bind failed: %v", err)
+	}
+	if err := ep.Listen(10); err != nil {
+		c.t.Fatalf("Listen failed: %v", err)
+	}
+	return ep, wq
+}
+
+// wait waits for one of the given events of wq until ready returns true, and
+// fails the test if it doesn't happen in time.
+func (c *testContext) wait(wq *waiter.Queue, mask waiter.EventMask, ready func() bool) {
+	we, ch := waiter.NewChannelEntry(nil)
+	wq.EventRegister(&we, mask)
+	defer wq.EventUnregister(&we)
+
+	deadline := time.After(timeout)
+	for !ready() {
+		select {
+		case <-ch:
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			c.t.Fatalf("Timed out waiting for events %v", mask)
+		}
+	}
+}
+
+// dial returns an MPTCP client endpoint connected to a server endpoint of the
+// given protocol.
+func (c *testContext) dial(proto tcpip.TransportProtocolNumber) (client tcpip.Endpoint, clientWQ *waiter.Queue, server tcpip.Endpoint, serverWQ *waiter.Queue) {
+	l, lwq := c.listen(proto)
+	defer l.Close()
+
+	client, clientWQ = c.newEndpoint(c.client, mptcp.ProtocolNumber)
+	addr := tcpip.FullAddress{Addr: serverAddr, Port: serverPort}
+	if err := client.Connect(addr); err != tcpip.ErrConnectStarted {
+		c.t.Fatalf("Connect returned %v, want %v", err, tcpip.ErrConnectStarted)
+	}
+	c.wait(clientWQ, waiter.EventOut, func() bool {
+		return client.Readiness(waiter.EventOut) != 0
+	})
+	if err := client.Connect(addr); err != nil {
+		c.t.Fatalf("Connect failed: %v", err)
+	}
+
+	c.wait(lwq, waiter.EventIn, func() bool {
+		var err *tcpip.Error
+		server, serverWQ, err = l.Accept()
+		if err != nil && err != tcpip.ErrWouldBlock {
+			c.t.Fatalf("Accept failed: %v", err)
+		}
+		return err == nil
+	})
+	return client, clientWQ, server, serverWQ
+}
+
+// transfer writes v to from, and checks that it is read from to.
+func (c *testContext) transfer(from tcpip.Endpoint, fromWQ *waiter.Queue, to tcpip.Endpoint, toWQ *waiter.Queue, v []byte) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rest := v
+		for len(rest) > 0 {
+			n, _, err := from.Write(tcpip.SlicePayload(rest), tcpip.WriteOptions{})
+			switch err {
+			case nil:
+				rest = rest[n:]
+			case tcpip.ErrWouldBlock:
+				c.wait(fromWQ, waiter.EventOut, func() bool {
+					return from.Readiness(waiter.EventOut) != 0
+				})
+			default:
+				c.t.Errorf("Write failed: %v", err)
+				return
+			}
+		}
+	}()
+
+	var got []byte
+	c.wait(toWQ, waiter.EventIn, func() bool {
+		for {
+			b, _, err := to.Read(nil)
+			switch err {
+			case nil:
+				got = append(got, b...)
+			case tcpip.ErrWouldBlock:
+				return len(got) >= len(v)
+			default:
+				c.t.Fatalf("Read failed: %v", err)
+			}
+		}
+	})
+	<-done
+	if !bytes.Equal(got, v) {
+		c.t.Fatalf("Read %d bytes different from the %d bytes written", len(got), len(v))
+	}
+}
+
+// info returns the MPTCP_INFO of ep.
+func (c *testContext) info(ep tcpip.Endpoint) tcpip.MPTCPInfoOption {
+	var info tcpip.MPTCPInfoOption
+	if err := ep.GetSockOpt(&info); err != nil {
+		c.t.Fatalf("GetSockOpt(MPTCPInfoOption) failed: %v", err)
+	}
+	return info
+}
+
+func TestConnectAndTransfer(t *testing.T) {
+	c := newTestContext(t, 1)
+	defer c.cleanup()
+
+	client, clientWQ, server, serverWQ := c.dial(mptcp.ProtocolNumber)
+	defer server.Close()
+
+	data := bytes.Repeat([]byte("multipath"), 100000)
+	c.transfer(client, clientWQ, server, serverWQ, data)
+	c.transfer(server, serverWQ, client, clientWQ, []byte("reply"))
+
+	for _, ep := range []tcpip.Endpoint{client, server} {
+		info := c.info(ep)
+		if info.Flags&tcpip.MPTCPInfoFallback != 0 {
+			t.Fatalf("Connection fell back to TCP: %+v", info)
+		}
+		if info.Flags&tcpip.MPTCPInfoRemoteKeyReceived == 0 {
+			t.Fatalf("Remote key not received: %+v", info)
+		}
+	}
+
+	addr, err := server.GetRemoteAddress()
+	if err != nil {
+		t.Fatalf("GetRemoteAddress failed: %v", err)
+	}
+	if addr.Addr != clientAddr {
+		t.Fatalf("GetRemoteAddress returned %v, want %v", addr.Addr, clientAddr)
+	}
+
+	// Closing the client sends a DATA_FIN.
+	client.Close()
+	c.wait(serverWQ, waiter.EventIn, func() bool {
+		_, _, err := server.Read(nil)
+		return err == tcpip.ErrClosedForReceive
+	})
+}
+
+func TestFallback(t *testing.T) {
+	c := newTestContext(t, 1)
+	defer c.cleanup()
+
+	// TCP servers don't answer MP_CAPABLE.
+	client, clientWQ, server, serverWQ := c.dial(tcp.ProtocolNumber)
+	defer client.Close()
+	defer server.Close()
+
+	c.transfer(client, clientWQ, server, serverWQ, bytes.Repeat([]byte("tcp"), 10000))
+	c.transfer(server, serverWQ, client, clientWQ, []byte("reply"))
+
+	if info := c.info(client); info.Flags&tcpip.MPTCPInfoFallback == 0 {
+		t.Fatalf("Connection didn't fall back to TCP: %+v", info)
+	}
+
+	// Shutting the client down closes the TCP connection for the server.
+	if err := client.Shutdown(tcpip.ShutdownWrite); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	c.wait(serverWQ, waiter.EventIn, func() bool {
+		_, _, err := server.Read(nil)
+		return err == tcpip.ErrClosedForReceive
+	})
+}
+
+func TestJoinAndFailover(t *testing.T) {
+	c := newTestContext(t, 2)
+	defer c.cleanup()
+
+	client, clientWQ, server, serverWQ := c.dial(mptcp.ProtocolNumber)
+	defer client.Close()
+	defer server.Close()
+
+	// The client opens a subflow from the address of its other NIC.
+	c.wait(clientWQ, waiter.EventOut, func() bool {
+		return c.info(client).Subflows == 1 && c.info(server).Subflows == 1
+	})
+	c.transfer(client, clientWQ, server, serverWQ, []byte("both"))
+
+	// Data is sent on the remaining subflow when the link of the initial
+	// one goes down.
+	c.links[0][0].setDown(true)
+	c.links[0][1].setDown(true)
+	data := bytes.Repeat([]byte("failover"), 10000)
+	c.transfer(client, clientWQ, server, serverWQ, data)
+	c.transfer(server, serverWQ, client, clientWQ, data)
+}
+
+func TestProtocolOptions(t *testing.T) {
+	s := stack.New([]string{ipv4.ProtocolName}, []string{tcp.ProtocolName, mptcp.ProtocolName}, stack.Options{})
+	if err := s.SetTransportProtocolOption(mptcp.ProtocolNumber, mptcp.MaxSubflowsOption(0)); err != tcpip.ErrInvalidOptionValue {
+		t.Fatalf("SetTransportProtocolOption(MaxSubflowsOption(0)) returned %v, want %v", err, tcpip.ErrInvalidOptionValue)
+	}
+	if err := s.SetTransportProtocolOption(mptcp.ProtocolNumber, mptcp.MaxSubflowsOption(2)); err != nil {
+		t.Fatalf("SetTransportProtocolOption(MaxSubflowsOption(2)) failed: %v", err)
+	}
+	var v mptcp.MaxSubflowsOption
+	if err := s.TransportProtocolOption(mptcp.ProtocolNumber, &v); err != nil {
+		t.Fatalf("TransportProtocolOption(MaxSubflowsOption) failed: %v", err)
+	}
+	if v != 2 {
+		t.Fatalf("got MaxSubflowsOption = %d, want 2", v)
+	}
+
+	// MPTCP endpoints need TCP.
+	s = stack.New([]string{ipv4.ProtocolName}, []string{mptcp.ProtocolName}, stack.Options{})
+	var wq waiter.Queue
+	if _, err := s.NewEndpoint(mptcp.ProtocolNumber, ipv4.ProtocolNumber, &wq); err != tcpip.ErrUnknownProtocol {
+		t.Fatalf("NewEndpoint returned %v, want %v", err, tcpip.ErrUnknownProtocol)
+	}
+}
@@ -0,0 +1,359 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mptcp
+
+import (
+	"sort"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+)
+
+// remoteAddr is an address announced by the peer of a connection.
+type remoteAddr struct {
+	id   uint8
+	addr tcpip.Address
+	port uint16
+}
+
+// announcement is an address announced to the peer of a connection. sent is
+// when it was last sent, and echoed is set once the peer echoed it.
+type announcement struct {
+	id     uint8
+	addr   tcpip.Address
+	sent   time.Time
+	echoed bool
+}
+
+// pathKey identifies the path of a subflow.
+type pathKey struct {
+	local  tcpip.Address
+	remote tcpip.Address
+}
+
+// localAddr is a local address the connection may use.
+type localAddr struct {
+	nicID tcpip.NICID
+	addr  tcpip.Address
+}
+
+// localAddrIDLocked returns the identifier of the local address addr,
+// allocating one if needed.
+func (e *endpoint) localAddrIDLocked(addr tcpip.Address) uint8 {
+	if id, ok := e.localAddrIDs[addr]; ok {
+		return id
+	}
+	if e.localAddrIDs == nil {
+		e.localAddrIDs = make(map[tcpip.Address]uint8)
+	}
+	id := e.nextAddrID
+	e.nextAddrID++
+	e.localAddrIDs[addr] = id
+	return id
+}
+
+// managePathsLocked is the path manager of the connection, run periodically.
+// It withdraws the local addresses that vanished, and returns the subflows to
+// open for a connection established by the endpoint, or announces the local
+// addresses for a connection it accepted.
+func (e *endpoint) managePathsLocked(now time.Time) []*subflow {
+	if !e.joinableLocked() {
+		return nil
+	}
+
+	nics := e.stack.NICInfo()
+	e.withdrawLocked(nics)
+	addrs := e.localAddrsLocked(nics)
+	if e.initial.active {
+		return e.joinPathsLocked(addrs, now)
+	}
+	e.announceLocked(addrs, now)
+	return nil
+}
+
+// localAddrsLocked returns the addresses of the NICs of the stack the
+// connection may use, sorted by NIC. Loopback addresses are only used by
+// connections over the loopback NIC, and link-local addresses aren't used.
+func (e *endpoint) localAddrsLocked(nics map[tcpip.NICID]stack.NICInfo) []localAddr {
+	netProto := e.netProtoOf(e.remoteAddr.Addr)
+	loopback := nics[e.initial.nicID].Flags.Loopback
+
+	var addrs []localAddr
+	for id, info := range nics {
+		if info.Flags.Loopback != loopback {
+			continue
+		}
+		for _, pa := range info.ProtocolAddresses {
+			if pa.Protocol != netProto || header.IsV6LinkLocalAddress(pa.Address) {
+				continue
+			}
+			addrs = append(addrs, localAddr{nicID: id, addr: pa.Address})
+		}
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		if addrs[i].nicID != addrs[j].nicID {
+			return addrs[i].nicID < addrs[j].nicID
+		}
+		return addrs[i].addr < addrs[j].addr
+	})
+	return addrs
+}
+
+// joinPathsLocked returns the subflows to open between the local addresses
+// and the addresses of the peer, the one of the initial subflow and the ones
+// it announced, over the paths that have a route and no subflow yet.
+func (e *endpoint) joinPathsLocked(addrs []localAddr, now time.Time) []*subflow {
+	if e.paths == nil {
+		e.paths = make(map[pathKey]time.Time)
+	}
+	maxSubflows := e.maxSubflowsLocked()
+	var joins []*subflow
+	tryPath := func(nicID tcpip.NICID, local tcpip.Address, remote tcpip.FullAddress) {
+		if len(e.subflows)+len(joins) >= maxSubflows {
+			return
+		}
+		for _, sf := range e.subflows {
+			if sf.local == local && sf.remote.Addr == remote.Addr && !sf.closing {
+				return
+			}
+		}
+		key := pathKey{local: local, remote: remote.Addr}
+		if last, ok := e.paths[key]; ok && now.Sub(last) < joinRetryInterval {
+			return
+		}
+		e.paths[key] = now
+
+		r, err := e.stack.FindRoute(nicID, local, remote.Addr, e.netProtoOf(remote.Addr), false /* multicastLoop */)
+		if err != nil {
+			return
+		}
+		r.Release()
+
+		sf := newSubflow(e, subflowJoin, true)
+		sf.nicID = nicID
+		sf.local = local
+		sf.remote = remote
+		sf.remote.NIC = nicID
+		sf.localID = e.localAddrIDLocked(local)
+		sf.localNonce = newNonce()
+		_, sf.localBackup = e.protocol().limits(nicID)
+		joins = append(joins, sf)
+	}
+
+	remotes := []tcpip.FullAddress{e.remoteAddr}
+	for _, r := range e.remoteAddrs {
+		port := r.port
+		if port == 0 {
+			port = e.remoteAddr.Port
+		}
+		remotes = append(remotes, tcpip.FullAddress{Addr: r.addr, Port: port})
+	}
+	for _, a := range addrs {
+		for _, r := range remotes {
+			tryPath(a.nicID, a.addr, r)
+		}
+	}
+	return joins
+}
+
+// announceLocked announces the addresses of the other NICs to the peer, if the
+// listening endpoint of the connection is bound to the wildcard address.
+// Announcements not echoed by the peer are sent again.
+func (e *endpoint) announceLocked(addrs []localAddr, now time.Time) {
+	if e.listener == nil || e.listener.bindAddr.Addr != "" {
+		return
+	}
+
+	pending := false
+	for _, a := range addrs {
+		if len(e.announced) >= maxAddresses {
+			break
+		}
+		if a.addr == e.initial.local || e.announcedLocked(a.addr) {
+			continue
+		}
+		e.announced = append(e.announced, &announcement{
+			id:   e.localAddrIDLocked(a.addr),
+			addr: a.addr,
+		})
+		pending = true
+	}
+	for _, a := range e.announced {
+		if a.echoed {
+			continue
+		}
+		if !a.sent.IsZero() && now.Sub(a.sent) >= signalTimeout {
+			a.sent = time.Time{}
+		}
+		if a.sent.IsZero() {
+			pending = true
+		}
+	}
+	if pending {
+		e.signalSubflowsLocked()
+	}
+}
+
+// announcedLocked returns whether addr was announced to the peer.
+func (e *endpoint) announcedLocked(addr tcpip.Address) bool {
+	for _, a := range e.announced {
+		if a.addr == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// withdrawLocked closes the subflows whose local address vanished, and
+// withdraws it and the vanished addresses announced to the peer.
+func (e *endpoint) withdrawLocked(nics map[tcpip.NICID]stack.NICInfo) {
+	exists := func(nicID tcpip.NICID, addr tcpip.Address) bool {
+		for id, info := range nics {
+			if nicID != 0 && id != nicID {
+				continue
+			}
+			for _, pa := range info.ProtocolAddresses {
+				if pa.Address == addr {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	withdraw := func(id uint8) {
+		for _, r := range e.removed {
+			if r == id {
+				return
+			}
+		}
+		e.removed = append(e.removed, id)
+	}
+
+	for _, sf := range e.subflows {
+		if !sf.established || sf.closing || sf.done || exists(sf.nicID, sf.local) {
+			continue
+		}
+		sf.closing = true
+		e.reinjectLocked(sf)
+		withdraw(sf.localID)
+	}
+	kept := e.announced[:0]
+	for _, a := range e.announced {
+		if exists(0, a.addr) {
+			kept = append(kept, a)
+			continue
+		}
+		withdraw(a.id)
+	}
+	e.announced = kept
+	if len(e.removed) > 0 {
+		e.signalSubflowsLocked()
+	}
+}
+
+// signalOptionsLocked writes to b the address signaling option to send on sf,
+// if any: echoes of the announcements of the peer first, then withdrawals,
+// then announcements. It returns the length of the option. Options are only
+// sent one at a time, on pure ACKs.
+func (e *endpoint) signalOptionsLocked(sf *subflow, b []byte) int {
+	if sf.closing {
+		return 0
+	}
+	if len(e.echoes) > 0 {
+		a := e.echoes[0]
+		a.Echo = true
+		n := header.EncodeMPTCPAddAddr(&a, b)
+		if n > 0 {
+			e.echoes = e.echoes[1:]
+		}
+		return n
+	}
+	if len(e.removed) > 0 {
+		n := header.EncodeMPTCPRemoveAddr(e.removed, b)
+		if n > 0 {
+			e.removed = nil
+		}
+		return n
+	}
+	for _, a := range e.announced {
+		if a.echoed || !a.sent.IsZero() {
+			continue
+		}
+		opt := header.MPTCPAddAddr{
+			AddressID: a.id,
+			Address:   a.addr,
+			HMAC:      header.MPTCPAddAddrHMAC(e.localKey, e.remoteKey, a.id, a.addr, 0),
+		}
+		n := header.EncodeMPTCPAddAddr(&opt, b)
+		if n > 0 {
+			a.sent = time.Now()
+		}
+		return n
+	}
+	return 0
+}
+
+// handleAddAddrLocked handles an ADD_ADDR option received from the peer:
+// either an echo of an announcement, or an announcement which is echoed.
+func (e *endpoint) handleAddAddrLocked(a *header.MPTCPAddAddr) {
+	if a.Echo {
+		for _, an := range e.announced {
+			if an.id == a.AddressID && an.addr == a.Address {
+				an.echoed = true
+			}
+		}
+		return
+	}
+	if a.HMAC != header.MPTCPAddAddrHMAC(e.remoteKey, e.localKey, a.AddressID, a.Address, a.Port) {
+		return
+	}
+
+	echo := *a
+	echo.HMAC = 0
+	e.echoes = append(e.echoes, echo)
+	e.signalSubflowsLocked()
+
+	r := remoteAddr{id: a.AddressID, addr: a.Address, port: a.Port}
+	for i := range e.remoteAddrs {
+		if e.remoteAddrs[i].id == r.id {
+			e.remoteAddrs[i] = r
+			return
+		}
+	}
+	if len(e.remoteAddrs) < maxAddresses && len(r.addr) == len(e.remoteAddr.Addr) {
+		e.remoteAddrs = append(e.remoteAddrs, r)
+		e.wakeWorkerLocked()
+	}
+}
+
+// handleRemoveAddrLocked handles the withdrawal of the address id of the peer,
+// whose subflows are closed.
+func (e *endpoint) handleRemoveAddrLocked(id uint8) {
+	for i, r := range e.remoteAddrs {
+		if r.id == id {
+			e.remoteAddrs = append(e.remoteAddrs[:i], e.remoteAddrs[i+1:]...)
+			break
+		}
+	}
+	for _, sf := range e.subflows {
+		if sf.remoteID == id && !sf.closing {
+			sf.closing = true
+			e.reinjectLocked(sf)
+		}
+	}
+	e.wakeWorkerLocked()
+}
@@ -0,0 +1,281 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mptcp contains the implementation of multipath TCP (MPTCP v1, RFC
+// 8684). To use it in the networking stack, this package must be added to the
+// project, and activated on the stack by passing mptcp.ProtocolName (or
+// "mptcp") as one of the transport protocols when calling stack.New(), along
+// with tcp.ProtocolName. Then endpoints can be created by passing
+// mptcp.ProtocolNumber as the transport protocol number when calling
+// Stack.NewEndpoint().
+//
+// An MPTCP connection runs over TCP endpoints, its subflows, which are
+// extended through the hooks of the tcp package. Connections established by
+// endpoints open additional subflows from the addresses of the other NICs of
+// the stack, and to the addresses announced by their peers. Connections
+// accepted by endpoints bound to the wildcard address announce the addresses
+// of the other NICs of the stack. Data is scheduled on the subflow with the
+// lowest RTT, backup subflows being only used when no other subflow is
+// available, and data sent on a subflow that fails or stalls is sent again on
+// the remaining subflows.
+//
+// Connections with peers that don't support MPTCP, or that require data
+// sequence mapping checksums, fall back to TCP. Subflows can only join
+// connections while their listening endpoint exists, and connections aren't
+// saved: they are aborted on restore.
+package mptcp
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+const (
+	// ProtocolName is the string representation of the mptcp protocol
+	// name.
+	ProtocolName = "mptcp"
+
+	// ProtocolNumber is the mptcp protocol number. It is the number of
+	// IPPROTO_MPTCP sockets in Linux, which never appears on the wire:
+	// the packets of MPTCP connections are TCP packets.
+	ProtocolNumber tcpip.TransportProtocolNumber = 262
+
+	// DefaultBufferSize is the default size of the receive and send
+	// buffers of connections.
+	DefaultBufferSize = 1 << 20 // 1MB
+
+	// DefaultMaxSubflows is the default maximum number of subflows of a
+	// connection.
+	DefaultMaxSubflows = 8
+
+	// maxAddresses is the maximum number of addresses announced by or
+	// accepted from a peer, as in Linux.
+	maxAddresses = 8
+
+	// maxChunkSize is the maximum size of the data mapped at once on a
+	// subflow, and maxInFlight the maximum amount of data queued on a
+	// subflow and not acknowledged by its peer.
+	maxChunkSize = 64 << 10
+	maxInFlight  = 256 << 10
+
+	// tickInterval is the interval at which connections check the state
+	// of their subflows and paths.
+	tickInterval = 200 * time.Millisecond
+
+	// minStallTimeout is the minimum time after which data not
+	// acknowledged on a subflow is sent again on the other subflows.
+	minStallTimeout = time.Second
+
+	// signalTimeout is the time after which the DATA_FIN and the address
+	// announcements not acknowledged by the peer are sent again.
+	signalTimeout = time.Second
+
+	// joinRetryInterval is the minimum interval between attempts to open
+	// a subflow on the same path.
+	joinRetryInterval = 5 * time.Second
+
+	// closeTimeout is the time given to closed connections for their
+	// DATA_FIN to be acknowledged before their subflows are closed.
+	closeTimeout = 60 * time.Second
+)
+
+// MaxSubflowsOption is used by SetOption/Option to specify the maximum number
+// of subflows of each connection, including the initial subflow.
+type MaxSubflowsOption int
+
+// BackupNICsOption is used by SetOption/Option to specify the NICs whose
+// subflows are only used as backups, when no other subflow is available.
+type BackupNICsOption []tcpip.NICID
+
+type protocol struct {
+	mu          sync.Mutex
+	maxSubflows int
+	backupNICs  map[tcpip.NICID]bool
+
+	// tokens holds the connections that subflows may join, by token.
+	tokens map[uint32]*endpoint
+}
+
+// Number returns the mptcp protocol number.
+func (*protocol) Number() tcpip.TransportProtocolNumber {
+	return ProtocolNumber
+}
+
+// NewEndpoint creates a new mptcp endpoint.
+func (p *protocol) NewEndpoint(stack *stack.Stack, netProto tcpip.NetworkProtocolNumber, waiterQueue *waiter.Queue) (tcpip.Endpoint, *tcpip.Error) {
+	// Subflows are endpoints of the TCP protocol of the stack.
+	if stack.TransportProtocolInstance(tcp.ProtocolNumber) == nil {
+		return nil, tcpip.ErrUnknownProtocol
+	}
+	return newEndpoint(stack, netProto, waiterQueue), nil
+}
+
+// NewRawEndpoint creates a new raw MPTCP endpoint. Raw MPTCP sockets are
+// unsupported. It implements stack.TransportProtocol.NewRawEndpoint.
+func (p *protocol) NewRawEndpoint(stack *stack.Stack, netProto tcpip.NetworkProtocolNumber, waiterQueue *waiter.Queue) (tcpip.Endpoint, *tcpip.Error) {
+	return nil, tcpip.ErrUnknownProtocol
+}
+
+// MinimumPacketSize returns the minimum valid mptcp packet size, which is the
+// one of TCP.
+func (*protocol) MinimumPacketSize() int {
+	return header.TCPMinimumSize
+}
+
+// ParsePorts returns the source and destination ports stored in the given
+// packet, which is a TCP packet.
+func (*protocol) ParsePorts(v buffer.View) (src, dst uint16, err *tcpip.Error) {
+	h := header.TCP(v)
+	return h.SourcePort(), h.DestinationPort(), nil
+}
+
+// HandleUnknownDestinationPacket handles packets targeted at this protocol but
+// that don't match any existing endpoint. No packet is ever targeted at this
+// protocol, as subflows are TCP endpoints.
+func (*protocol) HandleUnknownDestinationPacket(*stack.Route, stack.TransportEndpointID, buffer.VectorisedView) bool {
+	return false
+}
+
+// SetOption implements TransportProtocol.SetOption.
+func (p *protocol) SetOption(option interface{}) *tcpip.Error {
+	switch v := option.(type) {
+	case MaxSubflowsOption:
+		if v < 1 || v > 255 {
+			return tcpip.ErrInvalidOptionValue
+		}
+		p.mu.Lock()
+		p.maxSubflows = int(v)
+		p.mu.Unlock()
+		return nil
+
+	case BackupNICsOption:
+		nics := make(map[tcpip.NICID]bool)
+		for _, nic := range v {
+			nics[nic] = true
+		}
+		p.mu.Lock()
+		p.backupNICs = nics
+		p.mu.Unlock()
+		return nil
+
+	default:
+		return tcpip.ErrUnknownProtocolOption
+	}
+}
+
+// Option implements TransportProtocol.Option.
+func (p *protocol) Option(option interface{}) *tcpip.Error {
+	switch v := option.(type) {
+	case *MaxSubflowsOption:
+		p.mu.Lock()
+		*v = MaxSubflowsOption(p.maxSubflows)
+		p.mu.Unlock()
+		return nil
+
+	case *BackupNICsOption:
+		p.mu.Lock()
+		nics := make(BackupNICsOption, 0, len(p.backupNICs))
+		for nic := range p.backupNICs {
+			nics = append(nics, nic)
+		}
+		p.mu.Unlock()
+		*v = nics
+		return nil
+
+	default:
+		return tcpip.ErrUnknownProtocolOption
+	}
+}
+
+// limits returns the maximum number of subflows of connections, and whether
+// the subflows of the provided NIC are backups.
+func (p *protocol) limits(nic tcpip.NICID) (maxSubflows int, backup bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.maxSubflows, p.backupNICs[nic]
+}
+
+// newKey returns a new random key whose token isn't used by any connection.
+func (p *protocol) newKey() uint64 {
+	var b [8]byte
+	for {
+		if _, err := rand.Read(b[:]); err != nil {
+			panic(err)
+		}
+		key := binary.BigEndian.Uint64(b[:])
+		token, _ := header.MPTCPTokenAndIDSN(key)
+		p.mu.Lock()
+		_, used := p.tokens[token]
+		p.mu.Unlock()
+		if !used {
+			return key
+		}
+	}
+}
+
+// registerToken makes the connection of e joinable with the provided token. It
+// fails if the token is already used.
+func (p *protocol) registerToken(token uint32, e *endpoint) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, used := p.tokens[token]; used {
+		return false
+	}
+	p.tokens[token] = e
+	return true
+}
+
+// unregisterToken removes a token registered with registerToken.
+func (p *protocol) unregisterToken(token uint32) {
+	p.mu.Lock()
+	delete(p.tokens, token)
+	p.mu.Unlock()
+}
+
+// lookupToken returns the connection with the provided token.
+func (p *protocol) lookupToken(token uint32) *endpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.tokens[token]
+}
+
+// newNonce returns a random nonce for MP_JOIN handshakes.
+func newNonce() uint32 {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return binary.BigEndian.Uint32(b[:])
+}
+
+// NewProtocol returns an MPTCP transport protocol.
+func NewProtocol() stack.TransportProtocol {
+	return &protocol{
+		maxSubflows: DefaultMaxSubflows,
+		tokens:      make(map[uint32]*endpoint),
+	}
+}
+
+func init() {
+	stack.RegisterTransportProtocolFactory(ProtocolName, NewProtocol)
+}
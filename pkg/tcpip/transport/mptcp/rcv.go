@@ -0,0 +1,125 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mptcp
+
+import (
+	"sort"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+// receiveLocked handles data received by a subflow, which starts at data
+// sequence number dsn. Data received on several subflows is reassembled here;
+// the parts already received, or that don't fit in the receive buffer, are
+// dropped.
+func (e *endpoint) receiveLocked(dsn uint64, v buffer.View) {
+	if e.rcvClosed || len(v) == 0 {
+		return
+	}
+	if dsn+uint64(len(v)) <= e.rcvNxt {
+		return
+	}
+	if dsn < e.rcvNxt {
+		v = v[e.rcvNxt-dsn:]
+		dsn = e.rcvNxt
+	}
+	if dsn-e.rcvNxt >= uint64(e.rcvBufSizeMax) {
+		return
+	}
+
+	if dsn != e.rcvNxt {
+		i := sort.Search(len(e.rcvOOO), func(i int) bool {
+			return e.rcvOOO[i].dsn > dsn
+		})
+		e.rcvOOO = append(e.rcvOOO, rcvChunk{})
+		copy(e.rcvOOO[i+1:], e.rcvOOO[i:])
+		e.rcvOOO[i] = rcvChunk{dsn: dsn, v: v}
+		return
+	}
+
+	e.appendLocked(v)
+
+	// Pull the data received out of sequence that is now in sequence.
+	for len(e.rcvOOO) > 0 && e.rcvOOO[0].dsn <= e.rcvNxt {
+		c := e.rcvOOO[0]
+		e.rcvOOO[0] = rcvChunk{}
+		e.rcvOOO = e.rcvOOO[1:]
+		if end := c.dsn + uint64(len(c.v)); end > e.rcvNxt {
+			e.appendLocked(c.v[e.rcvNxt-c.dsn:])
+		}
+	}
+
+	e.checkDataFinLocked()
+}
+
+// appendLocked appends data received in sequence to the receive list.
+func (e *endpoint) appendLocked(v buffer.View) {
+	e.rcvList = append(e.rcvList, v)
+	e.rcvBufUsed += len(v)
+	e.rcvNxt += uint64(len(v))
+	e.events |= waiter.EventIn
+}
+
+// peerFinLocked handles the DATA_FIN of the peer, at data sequence number dsn.
+func (e *endpoint) peerFinLocked(dsn uint64) {
+	if e.rcvFin {
+		return
+	}
+	e.rcvFin = true
+	e.rcvFinDSN = dsn
+	e.checkDataFinLocked()
+}
+
+// checkDataFinLocked closes the endpoint for receiving once all the data
+// preceding the DATA_FIN of the peer was received. The DATA_FIN is
+// acknowledged right away.
+func (e *endpoint) checkDataFinLocked() {
+	if !e.rcvFin || e.rcvClosed || e.rcvNxt != e.rcvFinDSN {
+		return
+	}
+	if !e.fallback {
+		// The DATA_FIN consumes a data sequence number.
+		e.rcvNxt++
+		e.signalSubflowsLocked()
+	}
+	e.rcvClosed = true
+	e.rcvOOO = nil
+	e.events |= waiter.EventIn
+	e.wakeWorkerLocked()
+}
+
+// consumeLocked releases the receive buffer space of n bytes read from the
+// endpoint. The subflows advertise the space once half of the buffer is free
+// again.
+func (e *endpoint) consumeLocked(n int) {
+	half := e.rcvBufSizeMax / 2
+	wasLow := e.rcvBufSizeMax-e.rcvBufUsed < half
+	e.rcvBufUsed -= n
+	if wasLow && e.rcvBufSizeMax-e.rcvBufUsed >= half {
+		e.signalSubflowsLocked()
+	}
+}
+
+// signalSubflowsLocked has the established subflows of the connection send an
+// ACK, with the current receive window and data acknowledgement.
+func (e *endpoint) signalSubflowsLocked() {
+	for _, sf := range e.subflows {
+		if sf.established && !sf.done {
+			tcp.SignalSubflow(sf.tcpEP)
+		}
+	}
+}
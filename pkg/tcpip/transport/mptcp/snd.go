@@ -0,0 +1,255 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mptcp
+
+import (
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/seqnum"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+// sndEnd returns the data sequence number following the data of the send
+// queue.
+func (e *endpoint) sndEnd() uint64 {
+	return e.sndUna + uint64(e.sndBuf.Size())
+}
+
+// dataFinPendingLocked returns whether the DATA_FIN must be sent: all the data
+// of the send queue was sent, and the peer didn't acknowledge it yet.
+func (e *endpoint) dataFinPendingLocked() bool {
+	return e.sndClosed && !e.dataFinAcked && e.sndNxt == e.sndEnd() && e.state == stateConnected
+}
+
+// dataAckLocked handles the acknowledgement of the data preceding data
+// sequence number ack, which releases it from the send queue.
+func (e *endpoint) dataAckLocked(ack uint64) {
+	if ack <= e.sndUna {
+		return
+	}
+	limit := e.sndNxt
+	if e.dataFinPendingLocked() {
+		limit++
+	}
+	if ack > limit {
+		return
+	}
+
+	end := e.sndEnd()
+	if ack > end {
+		e.dataFinAcked = true
+		ack = end
+	}
+	e.sndBuf.TrimFront(int(ack - e.sndUna))
+	e.sndUna = ack
+	e.events |= waiter.EventOut
+	e.wakeWorkerLocked()
+}
+
+// sendDataLocked sends the data of the send queue not sent yet, and the data
+// to send again, on the subflows that have room for it. e.mu is unlocked while
+// the data is written to the subflows.
+func (e *endpoint) sendDataLocked() {
+	for {
+		r, reinjected, sf := e.nextChunkLocked()
+		if sf == nil {
+			return
+		}
+
+		// The mapping of the data is registered first, as it may be
+		// sent, and acknowledged, before Write returns.
+		v := e.sndViewLocked(r.dsn, r.size)
+		if sf.sndUna == sf.sndNxt {
+			sf.lastProgress = time.Now()
+		}
+		ssn := sf.sndNxt
+		sf.sndMappings = append(sf.sndMappings, mapping{
+			ssn:  ssn,
+			dsn:  r.dsn,
+			size: seqnum.Size(len(v)),
+		})
+		sf.sndNxt = ssn.Add(seqnum.Size(len(v)))
+		ep := sf.tcpEP
+		e.mu.Unlock()
+
+		n, _, err := ep.Write(tcpip.SlicePayload(v), tcpip.WriteOptions{})
+
+		e.mu.Lock()
+		if err != nil {
+			n = 0
+		}
+		sf.sndNxt = ssn.Add(seqnum.Size(n))
+		// The mapping may have been acknowledged, and released, already.
+		if i := len(sf.sndMappings) - 1; i >= 0 && sf.sndMappings[i].ssn == ssn {
+			if n == 0 {
+				sf.sndMappings = sf.sndMappings[:i]
+			} else {
+				sf.sndMappings[i].size = seqnum.Size(n)
+			}
+		}
+		if n == 0 {
+			// Subflows that can't be written to are skipped until the
+			// worker is woken up again.
+			sf.full = true
+			continue
+		}
+
+		if reinjected {
+			// The range may have been acknowledged meanwhile.
+			if len(e.reinject) > 0 && e.reinject[0].dsn == r.dsn {
+				e.reinject[0].dsn += uint64(n)
+				e.reinject[0].size -= uint64(n)
+				if e.reinject[0].size == 0 {
+					e.reinject = e.reinject[1:]
+				}
+			}
+		} else if end := r.dsn + uint64(n); end > e.sndNxt {
+			e.sndNxt = end
+			if e.dataFinPendingLocked() {
+				e.signalDataFinLocked(time.Now())
+			}
+		}
+	}
+}
+
+// nextChunkLocked returns the next range of data to send and the subflow to
+// send it on, or a nil subflow if there is nothing that can be sent. The data
+// sent on failed or stalled subflows is sent first.
+func (e *endpoint) nextChunkLocked() (dataRange, bool, *subflow) {
+	for len(e.reinject) > 0 {
+		r := e.reinject[0]
+		if end := r.dsn + r.size; end <= e.sndUna {
+			e.reinject = e.reinject[1:]
+			continue
+		} else if r.dsn < e.sndUna {
+			r.size = end - e.sndUna
+			r.dsn = e.sndUna
+			e.reinject[0] = r
+		}
+
+		sf := e.pickSubflowLocked(r.from)
+		if sf == nil {
+			if e.pickSubflowLocked(nil) != nil {
+				// Only the subflow the data was sent on is
+				// left, which retransmits it itself.
+				e.reinject = e.reinject[1:]
+				continue
+			}
+			return dataRange{}, false, nil
+		}
+		return e.chunk(r.dsn, r.size, sf), true, sf
+	}
+
+	if e.sndNxt == e.sndEnd() {
+		return dataRange{}, false, nil
+	}
+	sf := e.pickSubflowLocked(nil)
+	if sf == nil {
+		return dataRange{}, false, nil
+	}
+	return e.chunk(e.sndNxt, e.sndEnd()-e.sndNxt, sf), false, sf
+}
+
+// chunk returns the range of data starting at dsn, of at most size bytes, that
+// fits on sf.
+func (e *endpoint) chunk(dsn, size uint64, sf *subflow) dataRange {
+	if size > maxChunkSize {
+		size = maxChunkSize
+	}
+	if room := uint64(maxInFlight - sf.sndUna.Size(sf.sndNxt)); size > room {
+		size = room
+	}
+	return dataRange{dsn: dsn, size: size}
+}
+
+// pickSubflowLocked returns the subflow data is sent on, other than exclude:
+// the usable subflow with the lowest RTT, backup subflows being only picked if
+// no other subflow is usable.
+func (e *endpoint) pickSubflowLocked(exclude *subflow) *subflow {
+	var best *subflow
+	for _, sf := range e.subflows {
+		if sf == exclude || !sf.usable() {
+			continue
+		}
+		switch {
+		case best == nil:
+			best = sf
+		case best.backup() != sf.backup():
+			if !sf.backup() {
+				best = sf
+			}
+		case sf.rtt < best.rtt:
+			best = sf
+		}
+	}
+	return best
+}
+
+// reinjectLocked queues the data sent on sf and not acknowledged by the peer
+// to be sent again on the other subflows.
+func (e *endpoint) reinjectLocked(sf *subflow) {
+	for _, m := range sf.sndMappings {
+		end := m.dsn + uint64(m.size)
+		if end <= e.sndUna {
+			continue
+		}
+		dsn := m.dsn
+		if dsn < e.sndUna {
+			dsn = e.sndUna
+		}
+		e.reinject = append(e.reinject, dataRange{dsn: dsn, size: end - dsn, from: sf})
+	}
+}
+
+// checkStallsLocked marks the subflows whose data wasn't acknowledged for too
+// long as stalled, and sends their data again on the other subflows. Stalled
+// subflows are used again once they make progress.
+func (e *endpoint) checkStallsLocked(now time.Time) {
+	for _, sf := range e.subflows {
+		if sf.stalled || !sf.established || sf.done || sf.sndUna == sf.sndNxt {
+			continue
+		}
+		timeout := 4 * sf.rtt
+		if timeout < minStallTimeout {
+			timeout = minStallTimeout
+		}
+		if now.Sub(sf.lastProgress) < timeout {
+			continue
+		}
+		sf.stalled = true
+		if e.pickSubflowLocked(sf) != nil {
+			e.reinjectLocked(sf)
+		}
+	}
+}
+
+// signalDataFinLocked sends the DATA_FIN on the established subflows.
+func (e *endpoint) signalDataFinLocked(now time.Time) {
+	e.dataFinSent = now
+	e.signalSubflowsLocked()
+}
+
+// sndViewLocked returns the data of the send queue from data sequence number
+// dsn, of at most size bytes.
+func (e *endpoint) sndViewLocked(dsn, size uint64) buffer.View {
+	vv := e.sndBuf.Clone(nil)
+	vv.TrimFront(int(dsn - e.sndUna))
+	if uint64(vv.Size()) > size {
+		vv.CapLength(int(size))
+	}
+	return vv.ToView()
+}
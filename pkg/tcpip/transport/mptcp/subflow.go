@@ -0,0 +1,667 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mptcp
+
+import (
+	"crypto/hmac"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/seqnum"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+type subflowKind int
+
+const (
+	// subflowCapable is the initial subflow of a connection, which
+	// negotiates MPTCP with MP_CAPABLE.
+	subflowCapable subflowKind = iota
+
+	// subflowJoin is an additional subflow, which joins the connection
+	// with MP_JOIN.
+	subflowJoin
+)
+
+// mapping maps size bytes of a subflow, starting at sequence number ssn, to
+// the data of the connection starting at data sequence number dsn.
+type mapping struct {
+	ssn  seqnum.Value
+	dsn  uint64
+	size seqnum.Size
+}
+
+// subflow is a TCP endpoint carrying data of a connection. It implements
+// tcp.SubflowHooks.
+//
+// All the fields of a subflow are protected by the mutex of its connection.
+type subflow struct {
+	ep     *endpoint
+	kind   subflowKind
+	active bool
+
+	tcpEP tcpip.Endpoint
+	wq    *waiter.Queue
+	entry waiter.Entry
+
+	// established is set once the handshake of the subflow completed,
+	// and done once its protocol goroutine exited, with the error it
+	// failed with if any. closing is set once the connection decided to
+	// close it, and closed once it did.
+	established bool
+	done        bool
+	err         *tcpip.Error
+	closing     bool
+	closed      bool
+
+	// iss and irs are the initial send and receive sequence numbers of
+	// the subflow.
+	iss seqnum.Value
+	irs seqnum.Value
+
+	// The addresses of the subflow, their identifiers, and the NIC it
+	// was opened on.
+	nicID    tcpip.NICID
+	local    tcpip.Address
+	remote   tcpip.FullAddress
+	localID  uint8
+	remoteID uint8
+
+	// localBackup and remoteBackup are set when either end asked for the
+	// subflow to be only used as a backup.
+	localBackup  bool
+	remoteBackup bool
+
+	// localNonce and remoteNonce are the nonces of the MP_JOIN handshake,
+	// and joinAcked is set once the peer acknowledged the third ACK of
+	// the handshake of an active join.
+	localNonce  uint32
+	remoteNonce uint32
+	joinAcked   bool
+
+	// rtt is the smoothed round-trip time of the subflow.
+	rtt time.Duration
+
+	// sndNxt is the sequence number of the next byte written to the
+	// subflow, and sndUna the first one not acknowledged by the peer.
+	// sndMappings maps the data written to the subflow and not
+	// acknowledged at both the subflow and the data levels, and
+	// rcvMappings the data not received yet.
+	sndNxt      seqnum.Value
+	sndUna      seqnum.Value
+	sndMappings []mapping
+	rcvMappings []mapping
+
+	// full is set when the send buffer of the subflow is full, and
+	// stalled when the data sent on the subflow wasn't acknowledged for
+	// too long; lastProgress is when it was last acknowledged.
+	full         bool
+	stalled      bool
+	lastProgress time.Time
+
+	// finReceived is set once the peer closed its side of the subflow.
+	finReceived bool
+}
+
+func newSubflow(e *endpoint, kind subflowKind, active bool) *subflow {
+	sf := &subflow{
+		ep:     e,
+		kind:   kind,
+		active: active,
+	}
+	sf.entry.Callback = sf
+	return sf
+}
+
+// Callback implements waiter.EntryCallback. The worker of the connection is
+// woken up by the events of its subflows.
+func (sf *subflow) Callback(*waiter.Entry) {
+	sf.ep.workWaker.Assert()
+}
+
+// backup returns whether the subflow is only used as a backup.
+func (sf *subflow) backup() bool {
+	return sf.localBackup || sf.remoteBackup
+}
+
+// usable returns whether data can be sent on the subflow.
+func (sf *subflow) usable() bool {
+	if !sf.established || sf.done || sf.closing || sf.full || sf.stalled {
+		return false
+	}
+	if sf.kind == subflowJoin && sf.active && !sf.joinAcked {
+		return false
+	}
+	return sf.sndUna.Size(sf.sndNxt) < maxInFlight
+}
+
+// SynOptions implements tcp.SubflowHooks.SynOptions.
+func (sf *subflow) SynOptions(b []byte, synAck bool) int {
+	e := sf.ep
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.fallback {
+		return 0
+	}
+	switch sf.kind {
+	case subflowCapable:
+		c := header.MPTCPCapable{
+			Version: header.MPTCPVersion,
+			Flags:   header.MPTCPCapableFlagHMACSHA256,
+		}
+		if synAck {
+			c.NumKeys = 1
+			c.SenderKey = e.localKey
+		}
+		return header.EncodeMPTCPCapable(&c, b)
+
+	default:
+		j := header.MPTCPJoin{
+			Backup:    sf.localBackup,
+			AddressID: sf.localID,
+			Nonce:     sf.localNonce,
+		}
+		if synAck {
+			j.HMAC = header.MPTCPJoinHMAC(e.localKey, e.remoteKey, sf.localNonce, sf.remoteNonce)[:header.MPTCPJoinTruncatedHMACLen]
+		} else {
+			j.Token = e.remoteToken
+		}
+		return header.EncodeMPTCPJoin(&j, b)
+	}
+}
+
+// HandleSynAck implements tcp.SubflowHooks.HandleSynAck.
+func (sf *subflow) HandleSynAck(iss, irs seqnum.Value, opts *header.MPTCPOptions) *tcpip.Error {
+	e := sf.ep
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sf.setSequenceNumbers(iss, irs)
+	switch sf.kind {
+	case subflowCapable:
+		// Peers that don't support MPTCP, or that require checksums,
+		// fall back to TCP.
+		c := opts.Capable
+		if c == nil || c.NumKeys != 1 || c.Version != header.MPTCPVersion || c.Flags&header.MPTCPCapableFlagChecksum != 0 || c.Flags&header.MPTCPCapableFlagHMACSHA256 == 0 {
+			e.fallBackLocked()
+			return nil
+		}
+		e.setRemoteKeyLocked(c.SenderKey)
+		return nil
+
+	default:
+		j := opts.Join
+		if j == nil || !hmac.Equal(j.HMAC, header.MPTCPJoinHMAC(e.remoteKey, e.localKey, j.Nonce, sf.localNonce)[:header.MPTCPJoinTruncatedHMACLen]) {
+			return tcpip.ErrConnectionAborted
+		}
+		sf.remoteNonce = j.Nonce
+		sf.remoteID = j.AddressID
+		sf.remoteBackup = j.Backup
+		return nil
+	}
+}
+
+// HandleAck implements tcp.SubflowHooks.HandleAck.
+func (sf *subflow) HandleAck(iss, irs seqnum.Value, opts *header.MPTCPOptions) *tcpip.Error {
+	e := sf.ep
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sf.setSequenceNumbers(iss, irs)
+	if e.fallback {
+		return nil
+	}
+	switch sf.kind {
+	case subflowCapable:
+		// The peer falls back to TCP if the third ACK lacks the keys.
+		c := opts.Capable
+		if c == nil {
+			e.fallBackLocked()
+			return nil
+		}
+		if c.NumKeys != 2 || c.ReceiverKey != e.localKey {
+			return tcpip.ErrConnectionAborted
+		}
+		if !e.protocol().registerToken(e.localToken, e) {
+			return tcpip.ErrConnectionAborted
+		}
+		e.tokenRegistered = true
+		e.setRemoteKeyLocked(c.SenderKey)
+		e.fullyEstablished = true
+		if c.HasDataLen {
+			sf.addRcvMapping(irs+1, e.rcvNxt, seqnum.Size(c.DataLen))
+		}
+		return nil
+
+	default:
+		j := opts.Join
+		if !e.joinableLocked() || j == nil || !hmac.Equal(j.HMAC, header.MPTCPJoinHMAC(e.remoteKey, e.localKey, sf.remoteNonce, sf.localNonce)[:header.MPTCPJoinHMACLen]) {
+			return tcpip.ErrConnectionAborted
+		}
+		return nil
+	}
+}
+
+// Attach implements tcp.SubflowHooks.Attach.
+func (sf *subflow) Attach(ep tcpip.Endpoint, wq *waiter.Queue) bool {
+	e := sf.ep
+	e.mu.Lock()
+	sf.tcpEP = ep
+	sf.wq = wq
+	sf.established = true
+
+	if sf.kind == subflowJoin {
+		if !e.joinableLocked() {
+			sf.closing = true
+		}
+		e.addSubflowLocked(sf)
+		e.startWorkerLocked()
+
+		// The third ACK of the handshake is acknowledged right away.
+		tcp.SignalSubflow(ep)
+		e.mu.Unlock()
+		return true
+	}
+
+	// The connection is queued for Accept by its listening endpoint,
+	// which starts it.
+	e.primary = ep
+	e.state = stateConnected
+	e.isConnectNotified = true
+	e.remoteAddr = sf.remote
+	l := e.listener
+	e.mu.Unlock()
+
+	l.mu.Lock()
+	if l.pending != nil {
+		l.pending[ep] = e
+		l.mu.Unlock()
+		return false
+	}
+	l.mu.Unlock()
+
+	// The listening endpoint is closed, and so is the subflow.
+	e.mu.Lock()
+	sf.closed = true
+	e.state = stateClosed
+	if e.tokenRegistered {
+		e.protocol().unregisterToken(e.localToken)
+		e.tokenRegistered = false
+	}
+	e.mu.Unlock()
+	return false
+}
+
+// Options implements tcp.SubflowHooks.Options.
+func (sf *subflow) Options(b []byte, seq seqnum.Value, size int, flags byte) int {
+	e := sf.ep
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.fallback || flags&header.TCPFlagSyn != 0 {
+		return 0
+	}
+
+	switch {
+	case sf.kind == subflowJoin && sf.active && !sf.joinAcked:
+		// The third ACK of the MP_JOIN handshake is repeated until the
+		// peer acknowledges it.
+		j := header.MPTCPJoin{
+			HMAC: header.MPTCPJoinHMAC(e.localKey, e.remoteKey, sf.localNonce, sf.remoteNonce)[:header.MPTCPJoinHMACLen],
+		}
+		return header.EncodeMPTCPJoin(&j, b)
+
+	case sf.kind == subflowCapable && sf.active && !e.fullyEstablished:
+		// The keys are repeated until the peer shows it received them.
+		// The first data also carries them, and implicitly maps to the
+		// first data sequence number.
+		c := header.MPTCPCapable{
+			Version:     header.MPTCPVersion,
+			Flags:       header.MPTCPCapableFlagHMACSHA256,
+			NumKeys:     2,
+			SenderKey:   e.localKey,
+			ReceiverKey: e.remoteKey,
+		}
+		if size > 0 && seq == sf.iss+1 {
+			c.HasDataLen = true
+			c.DataLen = uint16(size)
+		}
+		if size == 0 || c.HasDataLen {
+			return header.EncodeMPTCPCapable(&c, b)
+		}
+	}
+
+	off := 0
+	if size == 0 {
+		off += e.signalOptionsLocked(sf, b)
+	}
+	dss := header.MPTCPDSS{
+		HasAck:  true,
+		Ack64:   true,
+		DataAck: e.rcvNxt,
+	}
+	if size > 0 {
+		if m, ok := sf.sndMapping(seq); ok {
+			dss.HasMapping = true
+			dss.DSN64 = true
+			dss.DSN = m.dsn + uint64(m.ssn.Size(seq))
+			dss.SSN = uint32(sf.iss.Size(seq))
+			dss.DataLen = uint16(size)
+		}
+	} else if e.dataFinPendingLocked() {
+		// The DATA_FIN is sent alone, with a subflow sequence number
+		// of zero.
+		dss.HasMapping = true
+		dss.DSN64 = true
+		dss.DSN = e.sndNxt
+		dss.DataLen = 1
+		dss.DataFin = true
+	}
+	return off + header.EncodeMPTCPDSS(&dss, b[off:])
+}
+
+// MappingBoundary implements tcp.SubflowHooks.MappingBoundary.
+func (sf *subflow) MappingBoundary(seq seqnum.Value) bool {
+	e := sf.ep
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, m := range sf.sndMappings {
+		if m.ssn == seq {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleSegment implements tcp.SubflowHooks.HandleSegment.
+func (sf *subflow) HandleSegment(ack seqnum.Value, opts *header.MPTCPOptions) {
+	e := sf.ep
+	e.mu.Lock()
+	defer e.unlockAndNotify()
+
+	if e.fallback {
+		e.dataAckLocked(sf.dataSequenceNumber(ack))
+		sf.handleAck(ack)
+		return
+	}
+
+	if k := opts.Fastclose; k != nil && *k == e.localKey {
+		e.resetLocked(tcpip.ErrConnectionReset)
+		return
+	}
+
+	if sf.active && sf.kind == subflowJoin && !sf.joinAcked {
+		sf.joinAcked = true
+		e.wakeWorkerLocked()
+	}
+	if sf.active && sf.kind == subflowCapable && !e.fullyEstablished && opts.DSS != nil {
+		e.fullyEstablished = true
+		e.wakeWorkerLocked()
+	}
+
+	if c := opts.Capable; c != nil && c.HasDataLen && !sf.active && sf.kind == subflowCapable {
+		sf.addRcvMapping(sf.irs+1, e.remoteIDSN+1, seqnum.Size(c.DataLen))
+	}
+
+	if d := opts.DSS; d != nil {
+		if d.HasAck {
+			ack := d.DataAck
+			if !d.Ack64 {
+				ack = expandDSN(uint32(ack), e.sndUna)
+			}
+			e.dataAckLocked(ack)
+		}
+		if d.HasMapping {
+			dsn := d.DSN
+			if !d.DSN64 {
+				dsn = expandDSN(uint32(dsn), e.rcvNxt)
+			}
+			size := uint64(d.DataLen)
+			if d.DataFin && size > 0 {
+				size--
+				e.peerFinLocked(dsn + size)
+			}
+			if size > 0 && d.SSN != 0 {
+				sf.addRcvMapping(sf.irs+seqnum.Value(d.SSN), dsn, seqnum.Size(size))
+			}
+		}
+	}
+
+	// The acknowledgement is handled once the data acknowledgement is, so
+	// that mappings acknowledged at both levels are released.
+	sf.handleAck(ack)
+
+	for i := range opts.AddAddr {
+		e.handleAddAddrLocked(&opts.AddAddr[i])
+	}
+	for _, id := range opts.RemoveAddr {
+		e.handleRemoveAddrLocked(id)
+	}
+	if p := opts.Prio; p != nil && sf.remoteBackup != *p {
+		sf.remoteBackup = *p
+		e.wakeWorkerLocked()
+	}
+}
+
+// Deliver implements tcp.SubflowHooks.Deliver.
+func (sf *subflow) Deliver(seq seqnum.Value, vv buffer.VectorisedView, fin bool) {
+	e := sf.ep
+	e.mu.Lock()
+	defer e.unlockAndNotify()
+
+	if fin {
+		sf.finReceived = true
+		if e.fallback {
+			e.peerFinLocked(e.rcvNxt)
+		}
+		e.wakeWorkerLocked()
+		return
+	}
+
+	v := vv.ToView()
+	if e.fallback {
+		e.receiveLocked(e.rcvNxt, v)
+		return
+	}
+
+	// Data that isn't mapped is dropped.
+	for len(v) > 0 {
+		m, ok := sf.rcvMapping(seq)
+		if !ok {
+			break
+		}
+		n := int(seq.Size(m.ssn.Add(m.size)))
+		if n > len(v) {
+			n = len(v)
+		}
+		e.receiveLocked(m.dsn+uint64(m.ssn.Size(seq)), v[:n])
+		v = v[n:]
+		seq = seq.Add(seqnum.Size(n))
+	}
+
+	// Release the mappings of the data received.
+	kept := sf.rcvMappings[:0]
+	for _, m := range sf.rcvMappings {
+		if seq.LessThan(m.ssn.Add(m.size)) {
+			kept = append(kept, m)
+		}
+	}
+	sf.rcvMappings = kept
+}
+
+// ReceiveBufferAvailable implements tcp.SubflowHooks.ReceiveBufferAvailable.
+func (sf *subflow) ReceiveBufferAvailable() int {
+	e := sf.ep
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if avail := e.rcvBufSizeMax - e.rcvBufUsed; avail > 0 {
+		return avail
+	}
+	return 0
+}
+
+// Closed implements tcp.SubflowHooks.Closed.
+func (sf *subflow) Closed(err *tcpip.Error) {
+	e := sf.ep
+	e.mu.Lock()
+	sf.done = true
+	sf.err = err
+	e.wakeWorkerLocked()
+	e.mu.Unlock()
+}
+
+// setSequenceNumbers sets the initial sequence numbers of the subflow.
+func (sf *subflow) setSequenceNumbers(iss, irs seqnum.Value) {
+	sf.iss = iss
+	sf.irs = irs
+	sf.sndNxt = iss + 1
+	sf.sndUna = iss + 1
+}
+
+// sndMapping returns the mapping of the data sent at seq.
+func (sf *subflow) sndMapping(seq seqnum.Value) (mapping, bool) {
+	for _, m := range sf.sndMappings {
+		if seq.InWindow(m.ssn, m.size) {
+			return m, true
+		}
+	}
+	return mapping{}, false
+}
+
+// rcvMapping returns the mapping of the data received at seq.
+func (sf *subflow) rcvMapping(seq seqnum.Value) (mapping, bool) {
+	for _, m := range sf.rcvMappings {
+		if seq.InWindow(m.ssn, m.size) {
+			return m, true
+		}
+	}
+	return mapping{}, false
+}
+
+// addRcvMapping records the mapping of data the subflow receives. Mappings
+// are repeated in the retransmissions of their data, and may be announced
+// before the data they map.
+func (sf *subflow) addRcvMapping(ssn seqnum.Value, dsn uint64, size seqnum.Size) {
+	for i, m := range sf.rcvMappings {
+		if m.ssn == ssn {
+			sf.rcvMappings[i] = mapping{ssn, dsn, size}
+			return
+		}
+	}
+	sf.rcvMappings = append(sf.rcvMappings, mapping{ssn, dsn, size})
+}
+
+// handleAck handles the acknowledgement of the data sent on the subflow, and
+// releases the mappings of the data acknowledged at both levels.
+func (sf *subflow) handleAck(ack seqnum.Value) {
+	if sf.sndUna.LessThan(ack) && !sf.sndNxt.LessThan(ack) {
+		sf.sndUna = ack
+		sf.lastProgress = time.Now()
+		if sf.stalled {
+			sf.stalled = false
+			sf.ep.wakeWorkerLocked()
+		}
+	}
+
+	i := 0
+	for ; i < len(sf.sndMappings); i++ {
+		m := sf.sndMappings[i]
+		end := m.ssn.Add(m.size)
+		if sf.sndUna.LessThan(end) || sf.ep.sndUna < m.dsn+uint64(m.size) {
+			break
+		}
+	}
+	sf.sndMappings = sf.sndMappings[i:]
+}
+
+// dataSequenceNumber returns the data sequence number of the data sent at seq
+// by a subflow that fell back to TCP.
+func (sf *subflow) dataSequenceNumber(seq seqnum.Value) uint64 {
+	if m, ok := sf.sndMapping(seq); ok {
+		return m.dsn + uint64(m.ssn.Size(seq))
+	}
+	if n := len(sf.sndMappings); n > 0 {
+		if m := sf.sndMappings[n-1]; m.ssn.Add(m.size) == seq {
+			return m.dsn + uint64(m.size)
+		}
+	}
+	return sf.ep.sndUna
+}
+
+// NewSubflow implements tcp.ListenerHooks.NewSubflow. It is called by the
+// primary endpoint of a listening endpoint with the SYN of each subflow it
+// accepts.
+func (e *endpoint) NewSubflow(id stack.TransportEndpointID, nicID tcpip.NICID, opts *header.MPTCPOptions) (tcp.SubflowHooks, *tcpip.Error) {
+	remote := tcpip.FullAddress{NIC: nicID, Addr: id.RemoteAddress, Port: id.RemotePort}
+	if j := opts.Join; j != nil {
+		c := e.protocol().lookupToken(j.Token)
+		if c == nil {
+			return nil, tcpip.ErrConnectionRefused
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if !c.joinableLocked() || len(c.subflows) >= c.maxSubflowsLocked() {
+			return nil, tcpip.ErrConnectionRefused
+		}
+		sf := newSubflow(c, subflowJoin, false)
+		sf.nicID = nicID
+		sf.local = id.LocalAddress
+		sf.remote = remote
+		sf.localID = c.localAddrIDLocked(id.LocalAddress)
+		sf.remoteID = j.AddressID
+		sf.remoteBackup = j.Backup
+		_, sf.localBackup = c.protocol().limits(nicID)
+		sf.remoteNonce = j.Nonce
+		sf.localNonce = newNonce()
+		return sf, nil
+	}
+
+	n := e.newAcceptedEndpoint()
+	sf := newSubflow(n, subflowCapable, false)
+	sf.nicID = nicID
+	sf.local = id.LocalAddress
+	sf.remote = remote
+	n.initial = sf
+	n.localAddrIDs = map[tcpip.Address]uint8{id.LocalAddress: 0}
+	n.nextAddrID = 1
+
+	// Only MPTCP v1 without checksums is supported; other peers fall back
+	// to TCP.
+	c := opts.Capable
+	if c == nil || c.Version < header.MPTCPVersion || c.Flags&header.MPTCPCapableFlagChecksum != 0 || c.Flags&header.MPTCPCapableFlagHMACSHA256 == 0 {
+		n.fallback = true
+		return sf, nil
+	}
+
+	// The token is registered once the peer confirms the key.
+	n.localKey = e.protocol().newKey()
+	n.localToken, n.sndUna = header.MPTCPTokenAndIDSN(n.localKey)
+	n.sndUna++
+	n.sndNxt = n.sndUna
+	return sf, nil
+}
+
+// expandDSN returns the data sequence number whose least significant 32 bits
+// are v and that is the closest to ref.
+func expandDSN(v uint32, ref uint64) uint64 {
+	return ref + uint64(int64(int32(v-uint32(ref))))
+}
@@ -0,0 +1,355 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mptcp
+
+import (
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/sleep"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+const (
+	wakerForWork = iota
+	wakerForTick
+)
+
+// startWorkerLocked starts the worker goroutine of the connection of e, if it
+// isn't running already.
+func (e *endpoint) startWorkerLocked() {
+	if e.workerRunning {
+		return
+	}
+	e.workerRunning = true
+	go e.workerLoop() // S/R-SAFE: connections are aborted on restore.
+}
+
+// wakeWorkerLocked wakes the worker goroutine of the connection of e up.
+func (e *endpoint) wakeWorkerLocked() {
+	e.workWaker.Assert()
+}
+
+// workerLoop runs the connection of e: it sends the data of the send queue on
+// the subflows, manages the paths of the connection, and closes and releases
+// its subflows. It exits once all the subflows are released and the
+// connection is closed.
+func (e *endpoint) workerLoop() {
+	var s sleep.Sleeper
+	s.AddWaker(&e.workWaker, wakerForWork)
+	s.AddWaker(&e.tickWaker, wakerForTick)
+	defer s.Done()
+
+	ticker := time.AfterFunc(tickInterval, e.tickWaker.Assert)
+	defer ticker.Stop()
+
+	for {
+		tick := false
+		if w, _ := s.Fetch(true); w == wakerForTick {
+			tick = true
+			ticker.Reset(tickInterval)
+		}
+		if !e.work(tick) {
+			return
+		}
+	}
+}
+
+// work does the pending work of the connection, and the periodic work if tick
+// is set. It returns whether the worker must keep running.
+func (e *endpoint) work(tick bool) bool {
+	e.updateSubflows(tick)
+	now := time.Now()
+
+	e.mu.Lock()
+	toClose := e.reapSubflowsLocked()
+
+	if tick && e.state == stateConnected && !e.fallback {
+		e.checkStallsLocked(now)
+		if e.dataFinPendingLocked() && now.Sub(e.dataFinSent) >= signalTimeout {
+			e.signalDataFinLocked(now)
+		}
+	}
+
+	// Decide whether the connection is over.
+	closeAll := false
+	var shutdown tcpip.Endpoint
+	switch e.state {
+	case stateConnecting:
+		closeAll = e.closed
+	case stateConnected:
+		if e.fallback {
+			// The connection is shut down and closed through its
+			// only subflow once all the data was handed to it;
+			// dataFinAcked is then set once it was shut down.
+			if sf := e.initial; e.sndClosed && e.sndNxt == e.sndEnd() && sf.established && !sf.closing {
+				if e.closed {
+					sf.closing = true
+				} else if !e.dataFinAcked {
+					e.dataFinAcked = true
+					shutdown = sf.tcpEP
+				}
+			}
+		} else {
+			closeAll = e.dataFinAcked && (e.rcvClosed || e.closed) || e.closed && now.Sub(e.closedAt) >= closeTimeout
+		}
+	case stateClosed, stateError:
+		closeAll = true
+	}
+	for _, sf := range e.subflows {
+		if closeAll {
+			sf.closing = true
+		}
+		if sf.closing && !sf.closed {
+			sf.closed = true
+			toClose = append(toClose, sf)
+		}
+	}
+
+	var joins []*subflow
+	if tick {
+		joins = e.managePathsLocked(now)
+	}
+
+	if e.state == stateConnected {
+		e.sendDataLocked()
+	}
+
+	if len(e.subflows) == 0 && len(joins) == 0 && (e.state == stateClosed || e.state == stateError) {
+		if e.tokenRegistered {
+			e.protocol().unregisterToken(e.localToken)
+			e.tokenRegistered = false
+		}
+		e.workerRunning = false
+	}
+	running := e.workerRunning
+	sockOpts := e.sockOpts
+	e.unlockAndNotify()
+
+	for _, sf := range toClose {
+		sf.wq.EventUnregister(&sf.entry)
+		sf.tcpEP.Close()
+	}
+	if shutdown != nil {
+		shutdown.Shutdown(tcpip.ShutdownWrite)
+	}
+	for _, sf := range joins {
+		e.openSubflow(sf, sockOpts)
+	}
+	return running
+}
+
+// updateSubflows checks whether the subflows being established completed
+// their handshake, which establishes the connection for the initial subflow.
+// It also refreshes the RTT of the established subflows if tick is set. The
+// TCP endpoints of the subflows are queried without e.mu held, as they call
+// into the connection with their own locks held.
+func (e *endpoint) updateSubflows(tick bool) {
+	var connecting, established []*subflow
+	e.mu.Lock()
+	for _, sf := range e.subflows {
+		// Subflows are tried again once they're woken up.
+		sf.full = false
+		switch {
+		case sf.done || sf.closed:
+		case !sf.established:
+			connecting = append(connecting, sf)
+		case tick:
+			established = append(established, sf)
+		}
+	}
+	e.mu.Unlock()
+
+	for _, sf := range connecting {
+		remote, err := sf.tcpEP.GetRemoteAddress()
+		if err != nil {
+			continue
+		}
+		local, _ := sf.tcpEP.GetLocalAddress()
+		nicID := e.stack.CheckLocalAddress(local.NIC, e.netProtoOf(local.Addr), local.Addr)
+
+		e.mu.Lock()
+		sf.established = true
+		sf.lastProgress = time.Now()
+		if sf.local == "" {
+			sf.local = local.Addr
+			sf.nicID = nicID
+			sf.remote = remote
+		}
+		if sf == e.initial && e.state == stateConnecting {
+			e.state = stateConnected
+			e.remoteAddr = remote
+			e.localAddrIDs = map[tcpip.Address]uint8{local.Addr: 0}
+			e.nextAddrID = 1
+			e.events |= waiter.EventOut
+		}
+		e.unlockAndNotify()
+	}
+
+	for _, sf := range established {
+		var info tcpip.TCPInfoOption
+		if err := sf.tcpEP.GetSockOpt(&info); err != nil {
+			continue
+		}
+		e.mu.Lock()
+		sf.rtt = info.RTT
+		e.mu.Unlock()
+	}
+}
+
+// reapSubflowsLocked releases the subflows whose protocol goroutine exited,
+// and updates the state of the connection accordingly. It returns the
+// subflows that must still be closed.
+func (e *endpoint) reapSubflowsLocked() []*subflow {
+	var toClose []*subflow
+	var lastErr *tcpip.Error
+	released := false
+	for i := 0; i < len(e.subflows); {
+		sf := e.subflows[i]
+		if !sf.done {
+			i++
+			continue
+		}
+		e.reinjectLocked(sf)
+		e.removeSubflowLocked(sf)
+		if !sf.closed {
+			sf.closed = true
+			toClose = append(toClose, sf)
+		}
+		if sf == e.initial && e.state == stateConnecting {
+			err := sf.err
+			if err == nil {
+				err = tcpip.ErrConnectionAborted
+			}
+			e.setErrorLocked(err)
+		}
+		if sf.err != nil {
+			lastErr = sf.err
+		}
+		released = true
+	}
+
+	if !released || len(e.subflows) != 0 || e.state != stateConnected {
+		return toClose
+	}
+
+	// The last subflow of the connection is gone.
+	switch {
+	case e.rcvClosed && (e.dataFinAcked || e.fallback && lastErr == nil):
+		e.state = stateClosed
+		e.events |= waiter.EventHUp | waiter.EventIn | waiter.EventOut
+	case lastErr != nil:
+		e.setErrorLocked(lastErr)
+	default:
+		e.setErrorLocked(tcpip.ErrConnectionReset)
+	}
+	return toClose
+}
+
+// openSubflow opens the additional subflow sf, with the options of the
+// endpoint.
+func (e *endpoint) openSubflow(sf *subflow, sockOpts []interface{}) {
+	wq := &waiter.Queue{}
+	ep := tcp.NewSubflowEndpoint(e.stack, e.netProtoOf(sf.remote.Addr), wq, sf, nil)
+	for _, opt := range sockOpts {
+		ep.SetSockOpt(opt)
+	}
+
+	e.mu.Lock()
+	sf.tcpEP = ep
+	sf.wq = wq
+	e.addSubflowLocked(sf)
+	e.mu.Unlock()
+
+	err := ep.Bind(tcpip.FullAddress{NIC: sf.nicID, Addr: sf.local})
+	if err == nil {
+		err = ep.Connect(sf.remote)
+	}
+	if err != nil && err != tcpip.ErrConnectStarted {
+		e.mu.Lock()
+		e.removeSubflowLocked(sf)
+		sf.closed = true
+		e.mu.Unlock()
+		wq.EventUnregister(&sf.entry)
+		ep.Close()
+	}
+}
+
+// netProtoOf returns the network protocol of addr.
+func (e *endpoint) netProtoOf(addr tcpip.Address) tcpip.NetworkProtocolNumber {
+	if len(addr) == header.IPv4AddressSize {
+		return header.IPv4ProtocolNumber
+	}
+	return header.IPv6ProtocolNumber
+}
+
+// addSubflowLocked adds sf to the subflows of the connection. The worker is
+// woken up by its events.
+func (e *endpoint) addSubflowLocked(sf *subflow) {
+	e.subflows = append(e.subflows, sf)
+	sf.wq.EventRegister(&sf.entry, waiter.EventIn|waiter.EventOut|waiter.EventErr|waiter.EventHUp)
+}
+
+// removeSubflowLocked removes sf from the subflows of the connection.
+func (e *endpoint) removeSubflowLocked(sf *subflow) {
+	for i, s := range e.subflows {
+		if s == sf {
+			e.subflows = append(e.subflows[:i], e.subflows[i+1:]...)
+			return
+		}
+	}
+}
+
+// resetLocked aborts the connection with err, as asked by the peer. Its
+// subflows are closed by the worker.
+func (e *endpoint) resetLocked(err *tcpip.Error) {
+	e.setErrorLocked(err)
+	for _, sf := range e.subflows {
+		sf.closing = true
+	}
+}
+
+// fallBackLocked makes the connection fall back to TCP.
+func (e *endpoint) fallBackLocked() {
+	e.fallback = true
+	if e.tokenRegistered {
+		e.protocol().unregisterToken(e.localToken)
+		e.tokenRegistered = false
+	}
+	e.sndUna = 0
+	e.sndNxt = 0
+	e.rcvNxt = 0
+}
+
+// setRemoteKeyLocked records the key of the peer.
+func (e *endpoint) setRemoteKeyLocked(key uint64) {
+	e.remoteKey = key
+	e.remoteToken, e.remoteIDSN = header.MPTCPTokenAndIDSN(key)
+	e.rcvNxt = e.remoteIDSN + 1
+	e.remoteKeyReceived = true
+}
+
+// joinableLocked returns whether subflows may join the connection.
+func (e *endpoint) joinableLocked() bool {
+	return e.state == stateConnected && !e.closed && !e.fallback && e.fullyEstablished
+}
+
+// maxSubflowsLocked returns the maximum number of subflows of the connection.
+func (e *endpoint) maxSubflowsLocked() int {
+	maxSubflows, _ := e.protocol().limits(0)
+	return maxSubflows
+}
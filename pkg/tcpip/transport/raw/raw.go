@@ -77,6 +77,12 @@ type endpoint struct {
 	rcvBufSize    int
 	rcvClosed     bool
 
+	// filter is the socket filter attached by AttachFilterOption, and
+	// filterLocked is set once LockFilterOption locked it. They're
+	// protected by rcvMu.
+	filter       tcpip.SocketFilter
+	filterLocked bool
+
 	// The following fields are protected by mu.
 	mu         sync.RWMutex `state:"nosave"`
 	sndBufSize int
@@ -459,6 +465,37 @@ func (ep *endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
 
 // SetSockOpt implements tcpip.Endpoint.SetSockOpt.
 func (ep *endpoint) SetSockOpt(opt interface{}) *tcpip.Error {
+	switch v := opt.(type) {
+	case tcpip.AttachFilterOption:
+		ep.rcvMu.Lock()
+		defer ep.rcvMu.Unlock()
+
+		if ep.filterLocked {
+			return tcpip.ErrNotPermitted
+		}
+		ep.filter = v.Filter
+
+	case tcpip.DetachFilterOption:
+		ep.rcvMu.Lock()
+		defer ep.rcvMu.Unlock()
+
+		if ep.filterLocked {
+			return tcpip.ErrNotPermitted
+		}
+		if ep.filter == nil {
+			return tcpip.ErrNoSuchFile
+		}
+		ep.filter = nil
+
+	case tcpip.LockFilterOption:
+		ep.rcvMu.Lock()
+		defer ep.rcvMu.Unlock()
+
+		if ep.filterLocked && v == 0 {
+			return tcpip.ErrNotPermitted
+		}
+		ep.filterLocked = v != 0
+	}
 	return nil
 }
 
@@ -480,6 +517,17 @@ func (ep *endpoint) GetSockOpt(opt interface{}) *tcpip.Error {
 		ep.rcvMu.Unlock()
 		return nil
 
+	case *tcpip.LockFilterOption:
+		ep.rcvMu.Lock()
+		v := ep.filterLocked
+		ep.rcvMu.Unlock()
+
+		*o = 0
+		if v {
+			*o = 1
+		}
+		return nil
+
 	case *tcpip.ReceiveQueueSizeOption:
 		ep.rcvMu.Lock()
 		if ep.rcvList.Empty() {
@@ -531,6 +579,19 @@ func (ep *endpoint) HandlePacket(route *stack.Route, netHeader buffer.View, vv b
 		return
 	}
 
+	combinedVV := netHeader.ToVectorisedView()
+	combinedVV.Append(vv)
+
+	// The socket filter sees the network header.
+	if ep.filter != nil {
+		n := ep.filter.Filter(combinedVV)
+		if n == 0 {
+			ep.rcvMu.Unlock()
+			return
+		}
+		combinedVV.CapLength(n)
+	}
+
 	wasEmpty := ep.rcvBufSize == 0
 
 	// Push new packet into receive list and increment the buffer size.
@@ -541,8 +602,6 @@ func (ep *endpoint) HandlePacket(route *stack.Route, netHeader buffer.View, vv b
 		},
 	}
 
-	combinedVV := netHeader.ToVectorisedView()
-	combinedVV.Append(vv)
 	packet.data = combinedVV.Clone(packet.views[:])
 	packet.timestampNS = ep.stack.NowNanoseconds()
 
@@ -0,0 +1,690 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/seqnum"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+)
+
+// assocState is the state of an association (RFC 4960 section 4).
+type assocState int
+
+const (
+	assocClosed assocState = iota
+	assocCookieWait
+	assocCookieEchoed
+	assocEstablished
+	assocShutdownPending
+	assocShutdownSent
+	assocShutdownReceived
+	assocShutdownAckSent
+)
+
+// association is an SCTP association between an endpoint and one of its
+// peers. All its fields are protected by the mutex of the endpoint.
+type association struct {
+	ep       *endpoint
+	state    assocState
+	peerPort uint16
+	localTag uint32
+	peerTag  uint32
+
+	// paths are the addresses of the peer. primary is the one data is sent
+	// to while it is active.
+	paths   []*path
+	primary *path
+
+	outStreams uint16
+	inStreams  uint16
+
+	// peerPR is whether the peer supports PR-SCTP.
+	peerPR bool
+
+	// errors is the number of consecutive failures of the association
+	// (RFC 4960 section 8.1).
+	errors int
+
+	// initChunk is the INIT or COOKIE ECHO chunk retransmitted by initTimer
+	// while the association is being initiated, and initRetrans is the
+	// number of times it was retransmitted.
+	initChunk   []byte
+	initRetrans int
+	initTimer   assocTimer
+
+	// shutdownTimer retransmits SHUTDOWN and SHUTDOWN ACK chunks.
+	shutdownTimer assocTimer
+
+	// hbTimer sends heartbeats to the paths of the association.
+	hbTimer assocTimer
+
+	snd sender
+	rcv receiver
+}
+
+// assocTimer is a timer that runs its handler with the mutex of an endpoint
+// locked, unless it was stopped or reset in the meantime.
+type assocTimer struct {
+	t *time.Timer
+}
+
+// reset (re)starts the timer so that it runs f after d.
+//
+// Precondition: e.mu must be locked.
+func (t *assocTimer) reset(e *endpoint, d time.Duration, f func()) {
+	t.stop()
+	var tt *time.Timer
+	tt = time.AfterFunc(d, func() {
+		e.mu.Lock()
+		if t.t == tt {
+			t.t = nil
+			f()
+		}
+		e.unlockAndNotify()
+	})
+	t.t = tt
+}
+
+// stop stops the timer.
+func (t *assocTimer) stop() {
+	if t.t != nil {
+		t.t.Stop()
+		t.t = nil
+	}
+}
+
+// running returns true if the timer was started and hasn't run yet.
+func (t *assocTimer) running() bool {
+	return t.t != nil
+}
+
+// randUint32 returns a random non-zero number, as required for verification
+// tags.
+func randUint32() uint32 {
+	var b [4]byte
+	for {
+		if _, err := rand.Read(b[:]); err != nil {
+			panic(err)
+		}
+		if v := binary.BigEndian.Uint32(b[:]); v != 0 {
+			return v
+		}
+	}
+}
+
+func newAssociation(e *endpoint, peerPort uint16, localTag uint32, localTSN seqnum.Value) *association {
+	a := &association{
+		ep:         e,
+		peerPort:   peerPort,
+		localTag:   localTag,
+		outStreams: e.initMsg.NumOutboundStreams,
+		inStreams:  e.initMsg.MaxInboundStreams,
+	}
+	a.snd.init(a, localTSN)
+	a.rcv.init(a)
+	return a
+}
+
+// addPath adds addr to the paths of the association, unless it's already one
+// of them or there is no route to it. It returns the path of addr, or nil.
+func (a *association) addPath(nicid tcpip.NICID, addr tcpip.Address) *path {
+	if p := a.findPath(addr); p != nil {
+		return p
+	}
+	if nicid == 0 {
+		nicid = a.ep.bindNICID
+	}
+	r, err := a.ep.stack.FindRoute(nicid, a.ep.id.LocalAddress, addr, a.ep.netProto, false /* multicastLoop */)
+	if err != nil {
+		return nil
+	}
+	return a.addRoute(r)
+}
+
+// addRoute adds a path sending through r to the paths of the association,
+// which takes ownership of r.
+func (a *association) addRoute(r stack.Route) *path {
+	p := newPath(r, a.ep.rtoInfo.Initial)
+	a.paths = append(a.paths, p)
+	if a.primary == nil {
+		a.primary = p
+	}
+	a.ep.addPeerAddrLocked(a, r.RemoteAddress)
+	return p
+}
+
+// findPath returns the path of addr, or nil if addr isn't an address of the
+// peer.
+func (a *association) findPath(addr tcpip.Address) *path {
+	for _, p := range a.paths {
+		if p.route.RemoteAddress == addr {
+			return p
+		}
+	}
+	return nil
+}
+
+// currentPath returns the path new data is sent to: the primary path if it's
+// active, or another active path (RFC 4960 section 6.4).
+func (a *association) currentPath() *path {
+	if a.primary.active {
+		return a.primary
+	}
+	for _, p := range a.paths {
+		if p.active {
+			return p
+		}
+	}
+	return a.primary
+}
+
+// alternatePath returns an active path other than p if there is one, or p.
+func (a *association) alternatePath(p *path) *path {
+	for _, q := range a.paths {
+		if q != p && q.active {
+			return q
+		}
+	}
+	return p
+}
+
+// peerAddr returns the full address of the peer at the given path.
+func (a *association) peerAddr(p *path) tcpip.FullAddress {
+	return tcpip.FullAddress{
+		NIC:  p.route.NICID(),
+		Addr: p.route.RemoteAddress,
+		Port: a.peerPort,
+	}
+}
+
+// prEnabled returns true if both ends of the association support PR-SCTP.
+func (a *association) prEnabled() bool {
+	return a.peerPR && a.ep.prSupported
+}
+
+// sendChunks sends a packet holding the given encoded chunks to p.
+func (a *association) sendChunks(p *path, chunks []byte) {
+	p.lastSent = time.Now()
+	sendPacket(&p.route, a.ep.id.LocalPort, a.peerPort, a.peerTag, chunks)
+}
+
+// sendChunk sends a packet holding a single chunk to the current path.
+func (a *association) sendChunk(typ header.SCTPChunkType, flags uint8, value []byte) {
+	a.sendChunks(a.currentPath(), header.SCTPAppendChunk(nil, typ, flags, value))
+}
+
+// fail records a failure to reach p, and aborts the association if it failed
+// too many times in a row (RFC 4960 section 8.1). It returns true if the
+// association was aborted.
+func (a *association) fail(p *path) bool {
+	p.fail()
+	a.errors++
+	if a.errors > assocMaxRetrans {
+		a.abort(tcpip.ErrTimeout, nil)
+		return true
+	}
+	return false
+}
+
+// connect starts initiating the association by sending an INIT chunk (RFC
+// 4960 section 5.1).
+func (a *association) connect() {
+	a.state = assocCookieWait
+	value := encodeInit(&header.SCTPInitFields{
+		InitiateTag:              a.localTag,
+		AdvertisedReceiverWindow: uint32(a.rcv.window()),
+		OutboundStreams:          a.outStreams,
+		InboundStreams:           a.inStreams,
+		InitialTSN:               uint32(a.snd.nextTSN),
+	}, a.ep.localAddrsLocked(), a.ep.prSupported, nil)
+	a.initChunk = header.SCTPAppendChunk(nil, header.SCTPChunkInit, 0, value)
+	a.sendInitChunk()
+}
+
+// sendInitChunk sends the INIT or COOKIE ECHO chunk, and starts its
+// retransmission timer.
+func (a *association) sendInitChunk() {
+	tag := a.peerTag
+	if a.state == assocCookieWait {
+		tag = 0
+	}
+	p := a.primary
+	p.lastSent = time.Now()
+	sendPacket(&p.route, a.ep.id.LocalPort, a.peerPort, tag, a.initChunk)
+	a.initTimer.reset(a.ep, p.rto, a.handleInitTimeout)
+}
+
+// handleInitTimeout handles the expiration of the T1-init and T1-cookie
+// timers (RFC 4960 section 5.1.6).
+func (a *association) handleInitTimeout() {
+	a.initRetrans++
+	if a.initRetrans > int(a.ep.initMsg.MaxAttempts) {
+		a.close(tcpip.ErrTimeout)
+		return
+	}
+	a.primary.backoff(a.ep.rtoInfo.Min, a.ep.initMsg.MaxInitTimeout)
+	a.sendInitChunk()
+}
+
+// established moves the association to the established state once the
+// handshake completes.
+func (a *association) established() {
+	a.state = assocEstablished
+	a.initTimer.stop()
+	a.initChunk = nil
+	a.errors = 0
+	a.hbTimer.reset(a.ep, heartbeatInterval, a.handleHeartbeatTimeout)
+	a.ep.assocEstablishedLocked(a)
+}
+
+// handlePacket handles a packet received from the peer of the association.
+//
+// Precondition: a.ep.mu must be locked.
+func (a *association) handlePacket(r *stack.Route, pkt header.SCTP, chunks []header.SCTPChunk) {
+	// Check the verification tag (RFC 4960 section 8.5.1).
+	tag := pkt.VerificationTag()
+	switch c := chunks[0]; c.Type() {
+	case header.SCTPChunkInit:
+		// Initialization collisions and association restarts (RFC
+		// 4960 sections 5.2.1 to 5.2.4) aren't supported.
+		return
+	case header.SCTPChunkAbort, header.SCTPChunkShutdownComplete:
+		if tag != a.localTag && (c.Flags()&header.SCTPFlagNoTCB == 0 || tag != a.peerTag) {
+			return
+		}
+	case header.SCTPChunkCookieEcho:
+		// The tag is checked against the one in the cookie.
+	default:
+		if tag != a.localTag {
+			return
+		}
+	}
+	a.handleChunks(r, chunks)
+}
+
+// handleChunks handles the chunks of a packet received from the peer of the
+// association.
+//
+// Precondition: a.ep.mu must be locked.
+func (a *association) handleChunks(r *stack.Route, chunks []header.SCTPChunk) {
+	gotData := false
+	for _, c := range chunks {
+		switch c.Type() {
+		case header.SCTPChunkData:
+			if a.rcv.handleData(r, c) {
+				gotData = true
+			}
+		case header.SCTPChunkSack:
+			a.snd.handleSack(c)
+		case header.SCTPChunkForwardTSN:
+			if !a.ep.prSupported {
+				if !a.handleUnrecognizedChunk(c) {
+					return
+				}
+				continue
+			}
+			a.rcv.handleForwardTSN(c)
+		case header.SCTPChunkHeartbeat:
+			b := header.SCTPAppendChunk(nil, header.SCTPChunkHeartbeatAck, 0, c.Value())
+			sendPacket(r, a.ep.id.LocalPort, a.peerPort, a.peerTag, b)
+		case header.SCTPChunkHeartbeatAck:
+			a.handleHeartbeatAck(c)
+		case header.SCTPChunkInitAck:
+			a.handleInitAck(r, c)
+		case header.SCTPChunkCookieEcho:
+			a.handleCookieEcho(r, c)
+		case header.SCTPChunkCookieAck:
+			if a.state == assocCookieEchoed {
+				a.ep.stack.Stats().SCTP.ActiveEstablishments.Increment()
+				a.established()
+			}
+		case header.SCTPChunkShutdown:
+			a.handleShutdown(c)
+		case header.SCTPChunkShutdownAck:
+			a.handleShutdownAck()
+		case header.SCTPChunkShutdownComplete:
+			if a.state == assocShutdownAckSent {
+				a.ep.stack.Stats().SCTP.Shutdowns.Increment()
+				a.close(nil)
+			}
+		case header.SCTPChunkAbort:
+			if a.state == assocCookieWait {
+				a.close(tcpip.ErrConnectionRefused)
+			} else {
+				a.ep.stack.Stats().SCTP.Aborts.Increment()
+				a.close(tcpip.ErrConnectionReset)
+			}
+		case header.SCTPChunkError:
+			a.handleError(c)
+		default:
+			if !a.handleUnrecognizedChunk(c) {
+				return
+			}
+		}
+		if a.state == assocClosed {
+			return
+		}
+	}
+	if gotData {
+		a.rcv.dataReceived()
+	}
+	a.snd.flush()
+}
+
+// handleUnrecognizedChunk handles chunks of unknown types according to the
+// two highest bits of their types (RFC 4960 section 3.2). It returns false if
+// the rest of the packet must be discarded.
+func (a *association) handleUnrecognizedChunk(c header.SCTPChunk) bool {
+	t := c.Type()
+	if t&0x40 != 0 {
+		a.sendChunk(header.SCTPChunkError, 0, errorCause(header.SCTPCauseUnrecognizedChunkType, c))
+	}
+	return t&0x80 != 0
+}
+
+// handleError handles ERROR chunks. The only error acted upon is a Stale
+// Cookie error in answer to the COOKIE ECHO, in which case the association
+// is initiated again (RFC 4960 section 5.2.6).
+func (a *association) handleError(c header.SCTPChunk) {
+	if a.state != assocCookieEchoed {
+		return
+	}
+	causes, ok := header.SCTPParameters(c.Value())
+	if !ok {
+		return
+	}
+	for _, cause := range causes {
+		if header.SCTPErrorCause(cause.Type()) == header.SCTPCauseStaleCookie {
+			a.initRetrans++
+			if a.initRetrans > int(a.ep.initMsg.MaxAttempts) {
+				a.close(tcpip.ErrTimeout)
+				return
+			}
+			a.connect()
+			return
+		}
+	}
+}
+
+// handleInitAck handles an INIT ACK chunk answering the INIT of the
+// association (RFC 4960 section 5.1).
+func (a *association) handleInitAck(r *stack.Route, c header.SCTPChunk) {
+	if a.state != assocCookieWait {
+		return
+	}
+	f, addrs, pr, cookie, ok := parseInit(c.Value(), a.ep.addrLen())
+	if !ok || f.InitiateTag == 0 || cookie == nil {
+		return
+	}
+	if f.OutboundStreams == 0 || f.InboundStreams == 0 {
+		a.abort(tcpip.ErrConnectionRefused, errorCause(header.SCTPCauseProtocolViolation, nil))
+		return
+	}
+
+	a.peerTag = f.InitiateTag
+	a.peerPR = pr
+	if f.InboundStreams < a.outStreams {
+		a.outStreams = f.InboundStreams
+	}
+	if f.OutboundStreams < a.inStreams {
+		a.inStreams = f.OutboundStreams
+	}
+	a.snd.peerRwnd = int(f.AdvertisedReceiverWindow)
+	a.rcv.cumTSN = seqnum.Value(f.InitialTSN) - 1
+
+	a.addPath(r.NICID(), r.RemoteAddress)
+	for _, addr := range addrs {
+		a.addPath(0, addr)
+	}
+
+	a.state = assocCookieEchoed
+	a.initRetrans = 0
+	a.initChunk = header.SCTPAppendChunk(nil, header.SCTPChunkCookieEcho, 0, cookie)
+	a.sendInitChunk()
+}
+
+// handleCookieEcho handles a COOKIE ECHO chunk received by an existing
+// association. This happens when the COOKIE ACK answering it was lost: the
+// peer is then answered with another COOKIE ACK (RFC 4960 section 5.2.4
+// action D).
+func (a *association) handleCookieEcho(r *stack.Route, c header.SCTPChunk) {
+	cookie, ok := decodeCookie(c.Value(), a.ep.cookieKey())
+	if !ok || cookie.localTag != a.localTag || cookie.peerTag != a.peerTag {
+		return
+	}
+	switch a.state {
+	case assocCookieWait, assocCookieEchoed, assocClosed:
+		return
+	}
+	b := header.SCTPAppendChunk(nil, header.SCTPChunkCookieAck, 0, nil)
+	sendPacket(r, a.ep.id.LocalPort, a.peerPort, a.peerTag, b)
+}
+
+// shutdown starts the graceful shutdown of the association (RFC 4960 section
+// 9.2). The SHUTDOWN chunk is sent once all the queued data is acknowledged.
+func (a *association) shutdown() {
+	switch a.state {
+	case assocCookieWait:
+		a.close(tcpip.ErrConnectionAborted)
+	case assocCookieEchoed:
+		a.abort(tcpip.ErrConnectionAborted, nil)
+	case assocEstablished:
+		a.state = assocShutdownPending
+		a.snd.flush()
+	}
+}
+
+// sendShutdown sends the SHUTDOWN or the SHUTDOWN ACK chunk required by the
+// state of the association, and starts its retransmission timer.
+func (a *association) sendShutdown() {
+	p := a.currentPath()
+	switch a.state {
+	case assocShutdownSent:
+		var v [4]byte
+		binary.BigEndian.PutUint32(v[:], uint32(a.rcv.cumTSN))
+		a.sendChunks(p, header.SCTPAppendChunk(nil, header.SCTPChunkShutdown, 0, v[:]))
+	case assocShutdownAckSent:
+		a.sendChunks(p, header.SCTPAppendChunk(nil, header.SCTPChunkShutdownAck, 0, nil))
+	default:
+		return
+	}
+	a.shutdownTimer.reset(a.ep, p.rto, func() {
+		if a.fail(p) {
+			return
+		}
+		p.backoff(a.ep.rtoInfo.Min, a.ep.rtoInfo.Max)
+		a.sendShutdown()
+	})
+}
+
+// handleShutdown handles a SHUTDOWN chunk (RFC 4960 section 9.2).
+func (a *association) handleShutdown(c header.SCTPChunk) {
+	if len(c.Value()) < 4 {
+		return
+	}
+	switch a.state {
+	case assocEstablished, assocShutdownPending:
+		a.state = assocShutdownReceived
+		a.rcv.peerShutdown()
+	case assocShutdownSent:
+		a.state = assocShutdownAckSent
+		a.rcv.peerShutdown()
+		a.sendShutdown()
+	case assocShutdownReceived:
+	default:
+		return
+	}
+	a.snd.handleCumulativeAck(seqnum.Value(binary.BigEndian.Uint32(c.Value())))
+}
+
+// handleShutdownAck handles a SHUTDOWN ACK chunk, which completes the
+// shutdown of the association (RFC 4960 section 9.2).
+func (a *association) handleShutdownAck() {
+	switch a.state {
+	case assocShutdownSent, assocShutdownAckSent:
+		a.sendChunk(header.SCTPChunkShutdownComplete, 0, nil)
+		a.ep.stack.Stats().SCTP.Shutdowns.Increment()
+		a.close(nil)
+	}
+}
+
+// abort sends an ABORT chunk with the given error causes to the peer, and
+// closes the association with err.
+func (a *association) abort(err *tcpip.Error, causes []byte) {
+	switch a.state {
+	case assocClosed:
+		return
+	case assocCookieWait:
+		// The peer's tag isn't known yet, so no ABORT can be sent.
+	default:
+		a.sendChunk(header.SCTPChunkAbort, 0, causes)
+		if a.state != assocCookieEchoed {
+			a.ep.stack.Stats().SCTP.Aborts.Increment()
+		}
+	}
+	a.close(err)
+}
+
+// close releases the resources of the association and detaches it from its
+// endpoint. err is nil if the association was shut down gracefully.
+func (a *association) close(err *tcpip.Error) {
+	if a.state == assocClosed {
+		return
+	}
+	if a.state == assocCookieWait || a.state == assocCookieEchoed {
+		a.ep.stack.Stats().SCTP.FailedAssociationAttempts.Increment()
+	}
+	a.state = assocClosed
+	a.initTimer.stop()
+	a.shutdownTimer.stop()
+	a.hbTimer.stop()
+	a.rcv.sackTimer.stop()
+	a.snd.close()
+	a.ep.assocClosedLocked(a, err)
+	for _, p := range a.paths {
+		p.route.Release()
+	}
+}
+
+// handleHeartbeatTimeout sends heartbeats to the paths that are idle or
+// inactive, and records the failure of the ones that didn't answer the
+// previous heartbeat (RFC 4960 section 8.3).
+func (a *association) handleHeartbeatTimeout() {
+	now := time.Now()
+	for _, p := range a.paths {
+		if p.hbNonce != 0 {
+			p.hbNonce = 0
+			if a.fail(p) {
+				return
+			}
+		}
+		if p.active && now.Sub(p.lastSent) < heartbeatInterval {
+			continue
+		}
+		var b [8]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			panic(err)
+		}
+		p.hbNonce = binary.BigEndian.Uint64(b[:]) | 1
+		p.hbSent = now
+		info := append(b[:], p.route.RemoteAddress...)
+		binary.BigEndian.PutUint64(info, p.hbNonce)
+		a.sendChunks(p, header.SCTPAppendChunk(nil, header.SCTPChunkHeartbeat, 0, header.SCTPAppendParameter(nil, header.SCTPParamHeartbeatInfo, info)))
+	}
+	a.hbTimer.reset(a.ep, heartbeatInterval+a.primary.rto, a.handleHeartbeatTimeout)
+}
+
+// handleHeartbeatAck handles a HEARTBEAT ACK chunk, which confirms that its
+// path is reachable.
+func (a *association) handleHeartbeatAck(c header.SCTPChunk) {
+	params, ok := header.SCTPParameters(c.Value())
+	if !ok || len(params) != 1 || params[0].Type() != header.SCTPParamHeartbeatInfo {
+		return
+	}
+	info := params[0].Value()
+	if len(info) < 8 {
+		return
+	}
+	p := a.findPath(tcpip.Address(info[8:]))
+	if p == nil || p.hbNonce == 0 || p.hbNonce != binary.BigEndian.Uint64(info) {
+		return
+	}
+	p.hbNonce = 0
+	p.errors = 0
+	p.active = true
+	a.errors = 0
+	p.updateRTT(time.Since(p.hbSent), a.ep.rtoInfo.Min, a.ep.rtoInfo.Max)
+}
+
+// encodeInit returns the value of an INIT or INIT ACK chunk with the given
+// fields, addresses and state cookie.
+func encodeInit(f *header.SCTPInitFields, addrs []tcpip.Address, pr bool, cookie []byte) []byte {
+	b := make([]byte, header.SCTPInitSize)
+	header.SCTPInit(b).Encode(f)
+	for _, addr := range addrs {
+		typ := header.SCTPParamIPv4Address
+		if len(addr) == header.IPv6AddressSize {
+			typ = header.SCTPParamIPv6Address
+		}
+		b = header.SCTPAppendParameter(b, typ, []byte(addr))
+	}
+	if pr {
+		b = header.SCTPAppendParameter(b, header.SCTPParamForwardTSNSupported, nil)
+	}
+	if cookie != nil {
+		b = header.SCTPAppendParameter(b, header.SCTPParamStateCookie, cookie)
+	}
+	return b
+}
+
+// parseInit parses the value of an INIT or INIT ACK chunk. It returns the
+// fixed fields of the chunk, the addresses of length addrLen it lists,
+// whether it supports PR-SCTP and its state cookie. It returns false if the
+// chunk is malformed.
+func parseInit(v []byte, addrLen int) (header.SCTPInitFields, []tcpip.Address, bool, []byte, bool) {
+	if len(v) < header.SCTPInitSize {
+		return header.SCTPInitFields{}, nil, false, nil, false
+	}
+	init := header.SCTPInit(v)
+	params, ok := header.SCTPParameters(init.Parameters())
+	if !ok {
+		return header.SCTPInitFields{}, nil, false, nil, false
+	}
+	var (
+		addrs  []tcpip.Address
+		pr     bool
+		cookie []byte
+	)
+	for _, p := range params {
+		switch p.Type() {
+		case header.SCTPParamIPv4Address, header.SCTPParamIPv6Address:
+			if len(p.Value()) == addrLen {
+				addrs = append(addrs, tcpip.Address(p.Value()))
+			}
+		case header.SCTPParamForwardTSNSupported:
+			pr = true
+		case header.SCTPParamStateCookie:
+			cookie = buffer.NewViewFromBytes(p.Value())
+		}
+	}
+	return init.Fields(), addrs, pr, cookie, true
+}
@@ -0,0 +1,134 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/seqnum"
+)
+
+const (
+	// cookieKeySize is the size of the key signing state cookies.
+	cookieKeySize = 32
+
+	// cookieFixedSize is the size of the fixed fields of encoded state
+	// cookies.
+	cookieFixedSize = 36
+)
+
+// stateCookie holds the state of an association while it is being accepted.
+// It is sent to the peer in the INIT ACK chunk answering its INIT, and echoed
+// back in a COOKIE ECHO chunk, so that listening endpoints don't keep any
+// state before associations are established (RFC 4960 section 5.1.3).
+type stateCookie struct {
+	// created is the time the cookie was created, in nanoseconds since
+	// the epoch.
+	created int64
+
+	localPort  uint16
+	peerPort   uint16
+	localTag   uint32
+	peerTag    uint32
+	localTSN   seqnum.Value
+	peerTSN    seqnum.Value
+	peerRwnd   uint32
+	outStreams uint16
+	inStreams  uint16
+
+	// peerPR is whether the peer supports PR-SCTP.
+	peerPR bool
+
+	// peerAddrs are the addresses the peer listed in its INIT chunk.
+	peerAddrs []tcpip.Address
+}
+
+// encode encodes and signs the cookie.
+func (c *stateCookie) encode(key *[cookieKeySize]byte) []byte {
+	b := make([]byte, cookieFixedSize)
+	binary.BigEndian.PutUint64(b[0:], uint64(c.created))
+	binary.BigEndian.PutUint16(b[8:], c.localPort)
+	binary.BigEndian.PutUint16(b[10:], c.peerPort)
+	binary.BigEndian.PutUint32(b[12:], c.localTag)
+	binary.BigEndian.PutUint32(b[16:], c.peerTag)
+	binary.BigEndian.PutUint32(b[20:], uint32(c.localTSN))
+	binary.BigEndian.PutUint32(b[24:], uint32(c.peerTSN))
+	binary.BigEndian.PutUint32(b[28:], c.peerRwnd)
+	binary.BigEndian.PutUint16(b[32:], c.outStreams)
+	binary.BigEndian.PutUint16(b[34:], c.inStreams)
+	if c.peerPR {
+		b = append(b, 1)
+	} else {
+		b = append(b, 0)
+	}
+	for _, addr := range c.peerAddrs {
+		b = append(b, byte(len(addr)))
+		b = append(b, addr...)
+	}
+
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write(b)
+	return mac.Sum(b)
+}
+
+// decodeCookie verifies the signature of the encoded cookie b and decodes it.
+// It returns false if b wasn't created by encode with the same key.
+func decodeCookie(b []byte, key *[cookieKeySize]byte) (stateCookie, bool) {
+	if len(b) < cookieFixedSize+1+sha256.Size {
+		return stateCookie{}, false
+	}
+	data, sum := b[:len(b)-sha256.Size], b[len(b)-sha256.Size:]
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write(data)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return stateCookie{}, false
+	}
+
+	c := stateCookie{
+		created:    int64(binary.BigEndian.Uint64(data[0:])),
+		localPort:  binary.BigEndian.Uint16(data[8:]),
+		peerPort:   binary.BigEndian.Uint16(data[10:]),
+		localTag:   binary.BigEndian.Uint32(data[12:]),
+		peerTag:    binary.BigEndian.Uint32(data[16:]),
+		localTSN:   seqnum.Value(binary.BigEndian.Uint32(data[20:])),
+		peerTSN:    seqnum.Value(binary.BigEndian.Uint32(data[24:])),
+		peerRwnd:   binary.BigEndian.Uint32(data[28:]),
+		outStreams: binary.BigEndian.Uint16(data[32:]),
+		inStreams:  binary.BigEndian.Uint16(data[34:]),
+		peerPR:     data[cookieFixedSize] != 0,
+	}
+	for rest := data[cookieFixedSize+1:]; len(rest) > 0; {
+		l := int(rest[0])
+		if len(rest) < 1+l {
+			return stateCookie{}, false
+		}
+		c.peerAddrs = append(c.peerAddrs, tcpip.Address(rest[1:1+l]))
+		rest = rest[1+l:]
+	}
+	return c, true
+}
+
+// staleness returns for how long the cookie has been expired at time now, or
+// zero if it is still valid.
+func (c *stateCookie) staleness(now int64) time.Duration {
+	if d := time.Duration(now-c.created) - validCookieLife; d > 0 {
+		return d
+	}
+	return 0
+}
@@ -0,0 +1,1121 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp
+
+import (
+	"sync"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/seqnum"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+type endpointState int
+
+const (
+	stateInitial endpointState = iota
+	stateBound
+	stateListen
+	stateConnected
+	stateClosed
+)
+
+// peerKey identifies the association of a one-to-many endpoint with a peer by
+// one of the addresses of the peer.
+type peerKey struct {
+	addr tcpip.Address
+	port uint16
+}
+
+// rcvMessage is a message received by an endpoint and not read yet.
+//
+// +stateify savable
+type rcvMessage struct {
+	from tcpip.FullAddress
+	data buffer.View
+
+	// assoc is the association the message was received from.
+	assoc *association `state:"nosave"`
+}
+
+// endpoint represents an SCTP endpoint. This struct serves as the interface
+// between users of the endpoint and the protocol implementation; it is legal
+// to have concurrent goroutines make calls into the endpoint, they are
+// properly synchronized.
+//
+// A one-to-one endpoint holds at most one association, and a listening
+// one-to-one endpoint creates a new endpoint for each association it accepts.
+// A one-to-many endpoint holds all its associations.
+//
+// +stateify savable
+type endpoint struct {
+	// The following fields are initialized at creation time and do not
+	// change throughout the lifetime of the endpoint.
+	stack       *stack.Stack `state:"manual"`
+	netProto    tcpip.NetworkProtocolNumber
+	waiterQueue *waiter.Queue
+
+	// mu protects all the fields below, as well as the associations of
+	// the endpoint.
+	mu sync.Mutex `state:"nosave"`
+
+	// events are the events to notify waiters of once mu is unlocked.
+	events waiter.EventMask `state:"nosave"`
+
+	state     endpointState
+	oneToMany bool
+	id        stack.TransportEndpointID
+	bindNICID tcpip.NICID
+	reuseAddr bool
+
+	// isPortReserved is whether the local port is reserved by the endpoint,
+	// and isRegistered whether id is registered with the stack, which is
+	// only the case of bound one-to-many endpoints and of listening
+	// endpoints.
+	isPortReserved bool
+	isRegistered   bool
+
+	// backlog and acceptQueue hold the endpoints of the associations
+	// established by a listening one-to-one endpoint and not accepted yet.
+	backlog     int
+	acceptQueue []*endpoint `state:"nosave"`
+
+	// assoc is the association of a one-to-one endpoint, and assocs the
+	// associations of the endpoint by addresses of their peers.
+	assoc  *association             `state:"nosave"`
+	assocs map[peerKey]*association `state:"nosave"`
+
+	// hardError is the error the association of a one-to-one endpoint
+	// failed with, and lastError the last error of an association,
+	// reported by ErrorOption. They aren't saved: associations fail with
+	// ErrConnectionAborted on restore.
+	hardError *tcpip.Error `state:"nosave"`
+	lastError *tcpip.Error `state:"nosave"`
+
+	// isConnectNotified is whether Connect reported the establishment of
+	// the association of a one-to-one endpoint.
+	isConnectNotified bool
+
+	// peerClosed is whether the peer of a one-to-one endpoint shut down
+	// its association.
+	peerClosed bool
+
+	// closed is whether Close was called. The endpoint is released once
+	// its associations are closed.
+	closed bool
+
+	rcvList       []*rcvMessage
+	rcvBufSizeMax int
+	rcvBufUsed    int
+	rcvClosed     bool
+
+	sndBufSize int
+	sndBufUsed int
+	sndClosed  bool
+
+	// delay enables the Nagle algorithm.
+	delay bool
+
+	initMsg     tcpip.SCTPInitMsgOption
+	rtoInfo     tcpip.SCTPRTOInfoOption
+	prSupported bool
+	prInfo      tcpip.SCTPDefaultPRInfoOption
+}
+
+func newEndpoint(stack *stack.Stack, netProto tcpip.NetworkProtocolNumber, waiterQueue *waiter.Queue) *endpoint {
+	return &endpoint{
+		stack:         stack,
+		netProto:      netProto,
+		waiterQueue:   waiterQueue,
+		assocs:        make(map[peerKey]*association),
+		rcvBufSizeMax: DefaultBufferSize,
+		sndBufSize:    DefaultBufferSize,
+		initMsg: tcpip.SCTPInitMsgOption{
+			NumOutboundStreams: defaultOutboundStreams,
+			MaxInboundStreams:  defaultInboundStreams,
+			MaxAttempts:        defaultMaxInitRetransmit,
+			MaxInitTimeout:     defaultRTOMax,
+		},
+		rtoInfo: tcpip.SCTPRTOInfoOption{
+			Initial: defaultRTOInitial,
+			Min:     defaultRTOMin,
+			Max:     defaultRTOMax,
+		},
+		prSupported: true,
+	}
+}
+
+// newAcceptedEndpointLocked returns a new one-to-one endpoint for an
+// association accepted by e, with the options of e. The mutex of the new
+// endpoint is locked.
+func (e *endpoint) newAcceptedEndpointLocked() *endpoint {
+	n := newEndpoint(e.stack, e.netProto, &waiter.Queue{})
+	n.mu.Lock()
+	n.state = stateConnected
+	n.id = e.id
+	n.bindNICID = e.bindNICID
+	n.isConnectNotified = true
+	n.rcvBufSizeMax = e.rcvBufSizeMax
+	n.sndBufSize = e.sndBufSize
+	n.delay = e.delay
+	n.initMsg = e.initMsg
+	n.rtoInfo = e.rtoInfo
+	n.prSupported = e.prSupported
+	n.prInfo = e.prInfo
+	return n
+}
+
+// unlockAndNotify unlocks e.mu, and notifies the waiters of the events raised
+// while it was locked.
+func (e *endpoint) unlockAndNotify() {
+	events := e.events
+	e.events = 0
+	e.mu.Unlock()
+	if events != 0 {
+		e.waiterQueue.Notify(events)
+	}
+}
+
+// cookieKey returns the key signing the state cookies of the endpoint.
+func (e *endpoint) cookieKey() *[cookieKeySize]byte {
+	return &e.stack.TransportProtocolInstance(ProtocolNumber).(*protocol).cookieKey
+}
+
+func (e *endpoint) netProtos() []tcpip.NetworkProtocolNumber {
+	return []tcpip.NetworkProtocolNumber{e.netProto}
+}
+
+// addrLen returns the length of the addresses of the endpoint.
+func (e *endpoint) addrLen() int {
+	if e.netProto == header.IPv4ProtocolNumber {
+		return header.IPv4AddressSize
+	}
+	return header.IPv6AddressSize
+}
+
+// localAddrsLocked returns the addresses advertised to the peers of the
+// endpoint in INIT and INIT ACK chunks: all the addresses of the stack if the
+// endpoint is bound to the wildcard address, or none if there is only one, in
+// which case peers use the source address of packets.
+func (e *endpoint) localAddrsLocked() []tcpip.Address {
+	if e.id.LocalAddress != "" {
+		return nil
+	}
+	var addrs []tcpip.Address
+	for nicid, info := range e.stack.NICInfo() {
+		if info.Flags.Loopback || (e.bindNICID != 0 && nicid != e.bindNICID) {
+			continue
+		}
+		for _, pa := range info.ProtocolAddresses {
+			if pa.Protocol != e.netProto || header.IsV4MulticastAddress(pa.Address) || header.IsV6MulticastAddress(pa.Address) || header.IsV6LinkLocalAddress(pa.Address) {
+				continue
+			}
+			addrs = append(addrs, pa.Address)
+		}
+	}
+	if len(addrs) < 2 {
+		return nil
+	}
+	return addrs
+}
+
+// peerID returns the ID the packets of the peer at addr are received with by
+// a one-to-one endpoint.
+func (e *endpoint) peerID(a *association, addr tcpip.Address) stack.TransportEndpointID {
+	return stack.TransportEndpointID{
+		LocalAddress:  e.id.LocalAddress,
+		LocalPort:     e.id.LocalPort,
+		RemoteAddress: addr,
+		RemotePort:    a.peerPort,
+	}
+}
+
+// associationsLocked returns the associations of the endpoint.
+func (e *endpoint) associationsLocked() []*association {
+	var assocs []*association
+	seen := make(map[*association]bool)
+	for _, a := range e.assocs {
+		if !seen[a] {
+			seen[a] = true
+			assocs = append(assocs, a)
+		}
+	}
+	return assocs
+}
+
+// addPeerAddrLocked records that addr is an address of the peer of a, so
+// that the packets it sends are handled by a.
+func (e *endpoint) addPeerAddrLocked(a *association, addr tcpip.Address) {
+	e.assocs[peerKey{addr, a.peerPort}] = a
+	if !e.oneToMany {
+		// Errors are ignored: the packets of the peer are then handled
+		// by the endpoint listening on the port, if there is one.
+		e.stack.RegisterTransportEndpoint(e.bindNICID, e.netProtos(), ProtocolNumber, e.peerID(a, addr), e, false /* reusePort */)
+	}
+}
+
+// assocEstablishedLocked is called when a completes its handshake.
+func (e *endpoint) assocEstablishedLocked(a *association) {
+	e.events |= waiter.EventOut
+}
+
+// assocClosedLocked detaches the association a from the endpoint once it is
+// closed. err is nil if a was shut down gracefully.
+func (e *endpoint) assocClosedLocked(a *association, err *tcpip.Error) {
+	for _, p := range a.paths {
+		addr := p.route.RemoteAddress
+		delete(e.assocs, peerKey{addr, a.peerPort})
+		if !e.oneToMany {
+			e.stack.UnregisterTransportEndpoint(e.bindNICID, e.netProtos(), ProtocolNumber, e.peerID(a, addr), e)
+		}
+	}
+	for _, m := range e.rcvList {
+		if m.assoc == a {
+			m.assoc = nil
+		}
+	}
+	if err != nil {
+		e.lastError = err
+	}
+	if !e.oneToMany && e.assoc == a {
+		e.assoc = nil
+		e.state = stateClosed
+		if err != nil {
+			e.hardError = err
+		} else {
+			e.peerClosed = true
+		}
+	}
+	e.events |= waiter.EventIn | waiter.EventOut
+	if e.closed && len(e.assocs) == 0 {
+		e.cleanupLocked()
+	}
+}
+
+// releaseSndBufLocked releases n bytes of the send buffer once a message was
+// acknowledged or abandoned.
+func (e *endpoint) releaseSndBufLocked(n int) {
+	full := e.sndBufUsed >= e.sndBufSize
+	e.sndBufUsed -= n
+	if full && e.sndBufUsed < e.sndBufSize {
+		e.events |= waiter.EventOut
+	}
+}
+
+// deliverLocked queues a message received from an association.
+func (e *endpoint) deliverLocked(m *rcvMessage) {
+	if e.rcvClosed {
+		return
+	}
+	e.rcvList = append(e.rcvList, m)
+	e.rcvBufUsed += len(m.data)
+	e.events |= waiter.EventIn
+}
+
+// peerShutdownLocked is called when the peer of a shuts the association down.
+func (e *endpoint) peerShutdownLocked(a *association) {
+	if !e.oneToMany {
+		e.peerClosed = true
+	}
+	e.events |= waiter.EventIn
+}
+
+// cleanupLocked releases the resources of the endpoint once it is closed.
+func (e *endpoint) cleanupLocked() {
+	if e.isRegistered {
+		e.stack.UnregisterTransportEndpoint(e.bindNICID, e.netProtos(), ProtocolNumber, e.id, e)
+		e.isRegistered = false
+	}
+	if e.isPortReserved {
+		e.stack.ReleasePort(e.netProtos(), ProtocolNumber, e.id.LocalAddress, e.id.LocalPort)
+		e.isPortReserved = false
+	}
+	e.state = stateClosed
+}
+
+// Close puts the endpoint in a closed state and frees all resources
+// associated with it. Associations are shut down gracefully, unless data was
+// received and not read, in which case they are aborted (RFC 6458 section
+// 4.1.4).
+func (e *endpoint) Close() {
+	e.mu.Lock()
+	e.closed = true
+	e.rcvClosed = true
+	e.sndClosed = true
+	unread := len(e.rcvList) != 0
+	e.rcvList = nil
+	e.rcvBufUsed = 0
+	for _, a := range e.associationsLocked() {
+		if unread {
+			a.abort(tcpip.ErrConnectionAborted, errorCause(header.SCTPCauseUserInitiatedAbort, nil))
+		} else {
+			a.shutdown()
+		}
+	}
+	accepted := e.acceptQueue
+	e.acceptQueue = nil
+	if len(e.assocs) == 0 {
+		e.cleanupLocked()
+	}
+	e.events |= waiter.EventHUp | waiter.EventErr | waiter.EventIn | waiter.EventOut
+	e.unlockAndNotify()
+
+	// The associations established and not accepted yet are shut down.
+	for _, n := range accepted {
+		n.Close()
+	}
+}
+
+// Read reads a message from the endpoint. This method does not block if there
+// is no data pending.
+func (e *endpoint) Read(addr *tcpip.FullAddress) (buffer.View, tcpip.ControlMessages, *tcpip.Error) {
+	e.mu.Lock()
+	defer e.unlockAndNotify()
+
+	if len(e.rcvList) == 0 {
+		return buffer.View{}, tcpip.ControlMessages{}, e.readErrorLocked()
+	}
+
+	m := e.rcvList[0]
+	e.rcvList[0] = nil
+	e.rcvList = e.rcvList[1:]
+	e.rcvBufUsed -= len(m.data)
+	if addr != nil {
+		*addr = m.from
+	}
+	if m.assoc != nil {
+		m.assoc.rcv.readDone()
+	}
+	return m.data, tcpip.ControlMessages{}, nil
+}
+
+// readErrorLocked returns the error reads fail with when no data is pending.
+func (e *endpoint) readErrorLocked() *tcpip.Error {
+	if e.rcvClosed {
+		return tcpip.ErrClosedForReceive
+	}
+	if e.oneToMany {
+		return tcpip.ErrWouldBlock
+	}
+	switch e.state {
+	case stateConnected:
+		if e.peerClosed {
+			return tcpip.ErrClosedForReceive
+		}
+		return tcpip.ErrWouldBlock
+	case stateClosed:
+		if e.hardError != nil {
+			return e.hardError
+		}
+		return tcpip.ErrClosedForReceive
+	default:
+		return tcpip.ErrNotConnected
+	}
+}
+
+// Peek reads data without consuming it from the endpoint.
+//
+// This method does not block if there is no data pending.
+func (e *endpoint) Peek(vec [][]byte) (uintptr, tcpip.ControlMessages, *tcpip.Error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.rcvList) == 0 {
+		return 0, tcpip.ControlMessages{}, e.readErrorLocked()
+	}
+
+	// Make a copy of vec so we can modify the slice headers.
+	vec = append([][]byte(nil), vec...)
+
+	var num uintptr
+	for _, m := range e.rcvList {
+		v := m.data
+		for len(v) > 0 {
+			if len(vec) == 0 {
+				return num, tcpip.ControlMessages{}, nil
+			}
+			if len(vec[0]) == 0 {
+				vec = vec[1:]
+				continue
+			}
+
+			n := copy(vec[0], v)
+			v = v[n:]
+			vec[0] = vec[0][n:]
+			num += uintptr(n)
+		}
+	}
+	return num, tcpip.ControlMessages{}, nil
+}
+
+// Write writes a message to the endpoint. Messages are written whole, or not
+// at all.
+func (e *endpoint) Write(p tcpip.Payload, opts tcpip.WriteOptions) (uintptr, <-chan struct{}, *tcpip.Error) {
+	e.mu.Lock()
+	defer e.unlockAndNotify()
+
+	if e.sndClosed {
+		return 0, nil, tcpip.ErrClosedForSend
+	}
+	a, err := e.writeAssocLocked(opts.To)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	size := int(p.Size())
+	if size == 0 {
+		return 0, nil, nil
+	}
+	if size > e.sndBufSize {
+		return 0, nil, tcpip.ErrMessageTooLong
+	}
+	if e.sndBufUsed+size > e.sndBufSize {
+		return 0, nil, tcpip.ErrWouldBlock
+	}
+	v, err := p.Get(size)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	e.sndBufUsed += size
+	a.snd.queue(v, e.prInfo)
+	a.snd.flush()
+	return uintptr(size), nil, nil
+}
+
+// writeAssocLocked returns the association messages written to to are sent
+// on. One-to-many endpoints create it if there is none.
+func (e *endpoint) writeAssocLocked(to *tcpip.FullAddress) (*association, *tcpip.Error) {
+	if !e.oneToMany {
+		switch e.state {
+		case stateConnected:
+		case stateClosed:
+			if e.hardError != nil {
+				return nil, e.hardError
+			}
+			return nil, tcpip.ErrClosedForSend
+		default:
+			return nil, tcpip.ErrClosedForSend
+		}
+		switch e.assoc.state {
+		case assocCookieWait, assocCookieEchoed:
+			return nil, tcpip.ErrWouldBlock
+		case assocEstablished:
+			return e.assoc, nil
+		default:
+			return nil, tcpip.ErrClosedForSend
+		}
+	}
+
+	if to == nil {
+		return nil, tcpip.ErrDestinationRequired
+	}
+	a := e.assocs[peerKey{to.Addr, to.Port}]
+	if a == nil {
+		// Associations are set up implicitly, and messages are
+		// queued until they are established.
+		return e.connectLocked(*to)
+	}
+	switch a.state {
+	case assocCookieWait, assocCookieEchoed, assocEstablished:
+		return a, nil
+	default:
+		return nil, tcpip.ErrClosedForSend
+	}
+}
+
+// Connect starts an association with the peer at addr. One-to-one endpoints
+// return ErrConnectStarted, and report the result of the handshake on the
+// next call once they are notified of EventOut. One-to-many endpoints return
+// right away, and report failures with ErrorOption.
+func (e *endpoint) Connect(addr tcpip.FullAddress) *tcpip.Error {
+	e.mu.Lock()
+	defer e.unlockAndNotify()
+
+	if addr.Port == 0 || len(addr.Addr) != e.addrLen() {
+		return tcpip.ErrBadAddress
+	}
+
+	if e.oneToMany {
+		if a := e.assocs[peerKey{addr.Addr, addr.Port}]; a != nil {
+			return tcpip.ErrAlreadyConnected
+		}
+		_, err := e.connectLocked(addr)
+		return err
+	}
+
+	switch e.state {
+	case stateInitial, stateBound:
+	case stateConnected:
+		switch e.assoc.state {
+		case assocCookieWait, assocCookieEchoed:
+			return tcpip.ErrAlreadyConnecting
+		}
+		if !e.isConnectNotified {
+			e.isConnectNotified = true
+			return nil
+		}
+		return tcpip.ErrAlreadyConnected
+	case stateClosed:
+		if e.hardError != nil {
+			return e.hardError
+		}
+		return tcpip.ErrInvalidEndpointState
+	default:
+		return tcpip.ErrInvalidEndpointState
+	}
+
+	if _, err := e.connectLocked(addr); err != nil {
+		return err
+	}
+	return tcpip.ErrConnectStarted
+}
+
+// connectLocked creates an association with the peer at addr and starts its
+// handshake, binding the endpoint first if needed.
+func (e *endpoint) connectLocked(addr tcpip.FullAddress) (*association, *tcpip.Error) {
+	if addr.Port == 0 || len(addr.Addr) != e.addrLen() {
+		return nil, tcpip.ErrBadAddress
+	}
+	if e.state == stateInitial {
+		if err := e.bindLocked(tcpip.FullAddress{}); err != nil {
+			return nil, err
+		}
+	}
+
+	a := newAssociation(e, addr.Port, randUint32(), seqnum.Value(randUint32()))
+	if a.addPath(addr.NIC, addr.Addr) == nil {
+		return nil, tcpip.ErrNoRoute
+	}
+	if !e.oneToMany {
+		e.assoc = a
+		e.state = stateConnected
+	}
+	a.connect()
+	return a, nil
+}
+
+// ConnectEndpoint is not supported.
+func (*endpoint) ConnectEndpoint(tcpip.Endpoint) *tcpip.Error {
+	return tcpip.ErrInvalidEndpointState
+}
+
+// Shutdown closes the read and/or write end of the endpoint connection to its
+// peer. Closing the write end shuts the association down gracefully.
+func (e *endpoint) Shutdown(flags tcpip.ShutdownFlags) *tcpip.Error {
+	e.mu.Lock()
+	defer e.unlockAndNotify()
+
+	if e.oneToMany {
+		return tcpip.ErrNotSupported
+	}
+	if e.state != stateConnected {
+		return tcpip.ErrNotConnected
+	}
+
+	if flags&tcpip.ShutdownRead != 0 {
+		e.rcvClosed = true
+		e.events |= waiter.EventIn
+	}
+	if flags&tcpip.ShutdownWrite != 0 && !e.sndClosed {
+		e.sndClosed = true
+		e.events |= waiter.EventOut
+		e.assoc.shutdown()
+	}
+	return nil
+}
+
+// Listen puts the endpoint in "listen" mode, which allows it to accept new
+// associations.
+func (e *endpoint) Listen(backlog int) *tcpip.Error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch e.state {
+	case stateInitial:
+		if err := e.bindLocked(tcpip.FullAddress{}); err != nil {
+			return err
+		}
+	case stateBound, stateListen:
+	default:
+		return tcpip.ErrInvalidEndpointState
+	}
+	if err := e.registerLocked(); err != nil {
+		return err
+	}
+	e.backlog = backlog
+	e.state = stateListen
+	return nil
+}
+
+// Accept returns a new endpoint if a peer has established an association to
+// an endpoint previously set to listen mode.
+func (e *endpoint) Accept() (tcpip.Endpoint, *waiter.Queue, *tcpip.Error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.oneToMany {
+		return nil, nil, tcpip.ErrNotSupported
+	}
+	if e.state != stateListen {
+		return nil, nil, tcpip.ErrInvalidEndpointState
+	}
+	if len(e.acceptQueue) == 0 {
+		return nil, nil, tcpip.ErrWouldBlock
+	}
+	n := e.acceptQueue[0]
+	e.acceptQueue[0] = nil
+	e.acceptQueue = e.acceptQueue[1:]
+	return n, n.waiterQueue, nil
+}
+
+// registerLocked registers the endpoint with the stack, so that it receives
+// the packets of the peers it has no association with.
+func (e *endpoint) registerLocked() *tcpip.Error {
+	if e.isRegistered {
+		return nil
+	}
+	if err := e.stack.RegisterTransportEndpoint(e.bindNICID, e.netProtos(), ProtocolNumber, e.id, e, false /* reusePort */); err != nil {
+		return err
+	}
+	e.isRegistered = true
+	return nil
+}
+
+func (e *endpoint) bindLocked(addr tcpip.FullAddress) *tcpip.Error {
+	// Don't allow binding once endpoint is not in the initial state
+	// anymore.
+	if e.state != stateInitial {
+		return tcpip.ErrInvalidEndpointState
+	}
+
+	nicid := addr.NIC
+	if len(addr.Addr) != 0 {
+		// A local address was specified, verify that it's valid.
+		nicid = e.stack.CheckLocalAddress(nicid, e.netProto, addr.Addr)
+		if nicid == 0 {
+			return tcpip.ErrBadLocalAddress
+		}
+	}
+
+	port, err := e.stack.ReservePort(e.netProtos(), ProtocolNumber, addr.Addr, addr.Port, e.reuseAddr)
+	if err != nil {
+		return err
+	}
+	e.id = stack.TransportEndpointID{
+		LocalAddress: addr.Addr,
+		LocalPort:    port,
+	}
+	e.bindNICID = nicid
+	e.isPortReserved = true
+
+	// One-to-many endpoints receive packets once bound, as UDP endpoints
+	// do.
+	if e.oneToMany {
+		if err := e.registerLocked(); err != nil {
+			e.stack.ReleasePort(e.netProtos(), ProtocolNumber, addr.Addr, port)
+			e.isPortReserved = false
+			return err
+		}
+	}
+
+	// Mark endpoint as bound.
+	e.state = stateBound
+	return nil
+}
+
+// Bind binds the endpoint to a specific local address and port.
+// Specifying a NIC is optional.
+func (e *endpoint) Bind(addr tcpip.FullAddress) *tcpip.Error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.bindLocked(addr)
+}
+
+// GetLocalAddress returns the address to which the endpoint is bound. For
+// one-to-one endpoints bound to the wildcard address, it is the source
+// address of the primary path of their association.
+func (e *endpoint) GetLocalAddress() (tcpip.FullAddress, *tcpip.Error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	addr := tcpip.FullAddress{
+		NIC:  e.bindNICID,
+		Addr: e.id.LocalAddress,
+		Port: e.id.LocalPort,
+	}
+	if a := e.assoc; a != nil && addr.Addr == "" {
+		addr.NIC = a.primary.route.NICID()
+		addr.Addr = a.primary.route.LocalAddress
+	}
+	return addr, nil
+}
+
+// GetRemoteAddress returns the primary address of the peer of a one-to-one
+// endpoint.
+func (e *endpoint) GetRemoteAddress() (tcpip.FullAddress, *tcpip.Error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.assoc == nil {
+		return tcpip.FullAddress{}, tcpip.ErrNotConnected
+	}
+	return e.assoc.peerAddr(e.assoc.primary), nil
+}
+
+// Readiness returns the current readiness of the endpoint. For example, if
+// waiter.EventIn is set, the endpoint is immediately readable.
+func (e *endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var result waiter.EventMask
+	if e.state == stateListen && !e.oneToMany {
+		if len(e.acceptQueue) != 0 {
+			result |= waiter.EventIn
+		}
+		return result & mask
+	}
+
+	if len(e.rcvList) != 0 || e.rcvClosed {
+		result |= waiter.EventIn
+	}
+	writable := e.sndClosed || e.sndBufUsed < e.sndBufSize
+	if e.oneToMany {
+		if writable {
+			result |= waiter.EventOut
+		}
+		return result & mask
+	}
+
+	switch e.state {
+	case stateConnected:
+		if e.peerClosed {
+			result |= waiter.EventIn
+		}
+		switch e.assoc.state {
+		case assocCookieWait, assocCookieEchoed:
+		case assocEstablished:
+			if writable {
+				result |= waiter.EventOut
+			}
+		default:
+			// Writes fail once the association is shutting down.
+			result |= waiter.EventOut
+		}
+	case stateClosed:
+		result |= waiter.EventIn | waiter.EventOut
+		if e.hardError != nil {
+			result |= waiter.EventErr
+		}
+	}
+	return result & mask
+}
+
+// SetSockOpt sets a socket option.
+func (e *endpoint) SetSockOpt(opt interface{}) *tcpip.Error {
+	e.mu.Lock()
+	defer e.unlockAndNotify()
+
+	switch v := opt.(type) {
+	case tcpip.SCTPOneToManyOption:
+		if e.state != stateInitial {
+			return tcpip.ErrInvalidEndpointState
+		}
+		e.oneToMany = v != 0
+		return nil
+
+	case tcpip.SCTPInitMsgOption:
+		if v.NumOutboundStreams != 0 {
+			e.initMsg.NumOutboundStreams = v.NumOutboundStreams
+		}
+		if v.MaxInboundStreams != 0 {
+			e.initMsg.MaxInboundStreams = v.MaxInboundStreams
+		}
+		if v.MaxAttempts != 0 {
+			e.initMsg.MaxAttempts = v.MaxAttempts
+		}
+		if v.MaxInitTimeout != 0 {
+			e.initMsg.MaxInitTimeout = v.MaxInitTimeout
+		}
+		return nil
+
+	case tcpip.SCTPRTOInfoOption:
+		rto := e.rtoInfo
+		if v.Initial != 0 {
+			rto.Initial = v.Initial
+		}
+		if v.Min != 0 {
+			rto.Min = v.Min
+		}
+		if v.Max != 0 {
+			rto.Max = v.Max
+		}
+		if rto.Min < 0 || rto.Min > rto.Max || rto.Initial < rto.Min || rto.Initial > rto.Max {
+			return tcpip.ErrInvalidOptionValue
+		}
+		e.rtoInfo = rto
+		return nil
+
+	case tcpip.SCTPPartialReliabilityOption:
+		e.prSupported = v != 0
+		return nil
+
+	case tcpip.SCTPDefaultPRInfoOption:
+		switch v.Policy {
+		case tcpip.SCTPPRPolicyNone, tcpip.SCTPPRPolicyTTL, tcpip.SCTPPRPolicyRTX:
+		default:
+			return tcpip.ErrInvalidOptionValue
+		}
+		e.prInfo = v
+		return nil
+
+	case tcpip.DelayOption:
+		e.delay = v != 0
+		if !e.delay {
+			for _, a := range e.associationsLocked() {
+				a.snd.flush()
+			}
+		}
+		return nil
+
+	case tcpip.ReceiveBufferSizeOption:
+		if v <= 0 {
+			return tcpip.ErrInvalidOptionValue
+		}
+		e.rcvBufSizeMax = int(v)
+		return nil
+
+	case tcpip.SendBufferSizeOption:
+		if v <= 0 {
+			return tcpip.ErrInvalidOptionValue
+		}
+		full := e.sndBufUsed >= e.sndBufSize
+		e.sndBufSize = int(v)
+		if full && e.sndBufUsed < e.sndBufSize {
+			e.events |= waiter.EventOut
+		}
+		return nil
+
+	case tcpip.ReuseAddressOption:
+		e.reuseAddr = v != 0
+		return nil
+	}
+	return nil
+}
+
+// GetSockOpt implements tcpip.Endpoint.GetSockOpt.
+func (e *endpoint) GetSockOpt(opt interface{}) *tcpip.Error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch o := opt.(type) {
+	case tcpip.ErrorOption:
+		err := e.lastError
+		e.lastError = nil
+		return err
+
+	case *tcpip.SendBufferSizeOption:
+		*o = tcpip.SendBufferSizeOption(e.sndBufSize)
+		return nil
+
+	case *tcpip.ReceiveBufferSizeOption:
+		*o = tcpip.ReceiveBufferSizeOption(e.rcvBufSizeMax)
+		return nil
+
+	case *tcpip.ReceiveQueueSizeOption:
+		*o = tcpip.ReceiveQueueSizeOption(e.rcvBufUsed)
+		return nil
+
+	case *tcpip.SendQueueSizeOption:
+		*o = tcpip.SendQueueSizeOption(e.sndBufUsed)
+		return nil
+
+	case *tcpip.DelayOption:
+		*o = 0
+		if e.delay {
+			*o = 1
+		}
+		return nil
+
+	case *tcpip.ReuseAddressOption:
+		*o = 0
+		if e.reuseAddr {
+			*o = 1
+		}
+		return nil
+
+	case *tcpip.SCTPOneToManyOption:
+		*o = 0
+		if e.oneToMany {
+			*o = 1
+		}
+		return nil
+
+	case *tcpip.SCTPInitMsgOption:
+		*o = e.initMsg
+		return nil
+
+	case *tcpip.SCTPRTOInfoOption:
+		*o = e.rtoInfo
+		return nil
+
+	case *tcpip.SCTPPartialReliabilityOption:
+		*o = 0
+		if e.prSupported {
+			*o = 1
+		}
+		return nil
+
+	case *tcpip.SCTPDefaultPRInfoOption:
+		*o = e.prInfo
+		return nil
+	}
+	return tcpip.ErrUnknownProtocolOption
+}
+
+// HandlePacket is called by the stack when new packets arrive to this
+// transport endpoint.
+func (e *endpoint) HandlePacket(r *stack.Route, id stack.TransportEndpointID, vv buffer.VectorisedView) {
+	pkt, chunks, ok := parsePacket(r, vv)
+	if !ok {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.unlockAndNotify()
+
+	if a := e.assocs[peerKey{id.RemoteAddress, id.RemotePort}]; a != nil {
+		a.handlePacket(r, pkt, chunks)
+		return
+	}
+	if e.state == stateListen && !e.closed {
+		switch chunks[0].Type() {
+		case header.SCTPChunkInit:
+			e.handleInitLocked(r, pkt, chunks[0])
+			return
+		case header.SCTPChunkCookieEcho:
+			e.handleCookieEchoLocked(r, pkt, chunks)
+			return
+		}
+	}
+	replyOutOfTheBlue(r, pkt, chunks)
+}
+
+// handleInitLocked answers an INIT chunk received by a listening endpoint with
+// an INIT ACK chunk holding the state of the new association in a cookie
+// (RFC 4960 section 5.1).
+func (e *endpoint) handleInitLocked(r *stack.Route, pkt header.SCTP, c header.SCTPChunk) {
+	if pkt.VerificationTag() != 0 {
+		return
+	}
+	f, addrs, pr, _, ok := parseInit(c.Value(), e.addrLen())
+	if !ok || f.InitiateTag == 0 || f.OutboundStreams == 0 || f.InboundStreams == 0 {
+		return
+	}
+	if !e.oneToMany && len(e.acceptQueue) >= e.backlog {
+		return
+	}
+
+	cookie := stateCookie{
+		created:    e.stack.NowNanoseconds(),
+		localPort:  e.id.LocalPort,
+		peerPort:   pkt.SourcePort(),
+		localTag:   randUint32(),
+		peerTag:    f.InitiateTag,
+		localTSN:   seqnum.Value(randUint32()),
+		peerTSN:    seqnum.Value(f.InitialTSN),
+		peerRwnd:   f.AdvertisedReceiverWindow,
+		outStreams: e.initMsg.NumOutboundStreams,
+		inStreams:  e.initMsg.MaxInboundStreams,
+		peerPR:     pr,
+		peerAddrs:  addrs,
+	}
+	if f.InboundStreams < cookie.outStreams {
+		cookie.outStreams = f.InboundStreams
+	}
+	if f.OutboundStreams < cookie.inStreams {
+		cookie.inStreams = f.OutboundStreams
+	}
+
+	value := encodeInit(&header.SCTPInitFields{
+		InitiateTag:              cookie.localTag,
+		AdvertisedReceiverWindow: uint32(e.rcvBufSizeMax),
+		OutboundStreams:          cookie.outStreams,
+		InboundStreams:           cookie.inStreams,
+		InitialTSN:               uint32(cookie.localTSN),
+	}, e.localAddrsLocked(), e.prSupported, cookie.encode(e.cookieKey()))
+	sendPacket(r, e.id.LocalPort, cookie.peerPort, cookie.peerTag, header.SCTPAppendChunk(nil, header.SCTPChunkInitAck, 0, value))
+}
+
+// handleCookieEchoLocked establishes the association whose state is held in
+// the cookie of a COOKIE ECHO chunk received by a listening endpoint (RFC 4960
+// section 5.1). One-to-one endpoints queue a new endpoint for it to be
+// accepted.
+func (e *endpoint) handleCookieEchoLocked(r *stack.Route, pkt header.SCTP, chunks []header.SCTPChunk) {
+	cookie, ok := decodeCookie(chunks[0].Value(), e.cookieKey())
+	if !ok || pkt.VerificationTag() != cookie.localTag || cookie.localPort != e.id.LocalPort || cookie.peerPort != pkt.SourcePort() {
+		return
+	}
+	if s := cookie.staleness(e.stack.NowNanoseconds()); s > 0 {
+		b := header.SCTPAppendChunk(nil, header.SCTPChunkError, 0, staleCookieCause(uint32(s/time.Microsecond)))
+		sendPacket(r, e.id.LocalPort, cookie.peerPort, cookie.peerTag, b)
+		return
+	}
+
+	ep := e
+	if !e.oneToMany {
+		if len(e.acceptQueue) >= e.backlog {
+			return
+		}
+		ep = e.newAcceptedEndpointLocked()
+	}
+
+	a := newAssociation(ep, cookie.peerPort, cookie.localTag, cookie.localTSN)
+	a.peerTag = cookie.peerTag
+	a.peerPR = cookie.peerPR
+	a.outStreams = cookie.outStreams
+	a.inStreams = cookie.inStreams
+	a.snd.peerRwnd = int(cookie.peerRwnd)
+	a.rcv.cumTSN = cookie.peerTSN - 1
+	if ep != e {
+		ep.assoc = a
+	}
+	a.addRoute(r.Clone())
+	for _, addr := range cookie.peerAddrs {
+		a.addPath(0, addr)
+	}
+	a.established()
+	e.stack.Stats().SCTP.PassiveEstablishments.Increment()
+	sendPacket(r, e.id.LocalPort, a.peerPort, a.peerTag, header.SCTPAppendChunk(nil, header.SCTPChunkCookieAck, 0, nil))
+	a.handleChunks(r, chunks[1:])
+
+	if ep != e {
+		ep.unlockAndNotify()
+		e.acceptQueue = append(e.acceptQueue, ep)
+		e.events |= waiter.EventIn
+	}
+}
+
+// HandleControlPacket implements stack.TransportEndpoint.HandleControlPacket.
+// ICMP errors are ignored: unreachable paths are detected by the timers of
+// associations.
+func (e *endpoint) HandleControlPacket(id stack.TransportEndpointID, typ stack.ControlType, extra uint32, vv buffer.VectorisedView) {
+}
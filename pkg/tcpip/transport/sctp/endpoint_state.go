@@ -0,0 +1,53 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp
+
+import (
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+)
+
+// afterLoad is invoked by stateify.
+func (e *endpoint) afterLoad() {
+	e.stack = stack.StackFromEnv
+	e.assocs = make(map[peerKey]*association)
+
+	// Associations aren't saved: their peers give up on them while the
+	// endpoint is saved, so they are aborted.
+	e.sndBufUsed = 0
+	if e.state == stateConnected {
+		e.state = stateClosed
+		e.hardError = tcpip.ErrConnectionAborted
+		e.lastError = tcpip.ErrConnectionAborted
+	}
+	if e.closed {
+		e.isPortReserved = false
+		e.isRegistered = false
+		e.state = stateClosed
+		return
+	}
+
+	if e.isPortReserved {
+		if _, err := e.stack.ReservePort(e.netProtos(), ProtocolNumber, e.id.LocalAddress, e.id.LocalPort, e.reuseAddr); err != nil {
+			panic(*err)
+		}
+	}
+	if e.isRegistered {
+		e.isRegistered = false
+		if err := e.registerLocked(); err != nil {
+			panic(*err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp
+
+import (
+	"encoding/binary"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+)
+
+// parsePacket validates the sctp packet held by vv and splits it into chunks.
+// It returns false if the packet must be dropped.
+func parsePacket(r *stack.Route, vv buffer.VectorisedView) (header.SCTP, []header.SCTPChunk, bool) {
+	stats := r.Stats().SCTP
+	stats.PacketsReceived.Increment()
+
+	pkt := header.SCTP(vv.ToView())
+	if len(pkt) < header.SCTPMinimumSize {
+		stats.MalformedPacketsReceived.Increment()
+		return nil, nil, false
+	}
+	if r.Capabilities()&stack.CapabilityChecksumOffload == 0 && !pkt.IsChecksumValid() {
+		stats.ChecksumErrors.Increment()
+		return nil, nil, false
+	}
+	chunks, ok := pkt.Chunks()
+	if !ok {
+		stats.MalformedPacketsReceived.Increment()
+		return nil, nil, false
+	}
+
+	// INIT, INIT ACK and SHUTDOWN COMPLETE chunks must not be bundled
+	// with other chunks (RFC 4960 section 6.10).
+	if len(chunks) > 1 {
+		for _, c := range chunks {
+			switch c.Type() {
+			case header.SCTPChunkInit, header.SCTPChunkInitAck, header.SCTPChunkShutdownComplete:
+				stats.MalformedPacketsReceived.Increment()
+				return nil, nil, false
+			}
+		}
+	}
+	return pkt, chunks, true
+}
+
+// sendPacket sends a packet holding the given encoded chunks through r.
+func sendPacket(r *stack.Route, srcPort, dstPort uint16, tag uint32, chunks []byte) *tcpip.Error {
+	// Packets are dropped while the link address of the destination
+	// is resolved; they are retransmitted by the timers of the
+	// association.
+	if r.IsResolutionRequired() {
+		if _, err := r.Resolve(nil); err != nil {
+			return err
+		}
+	}
+
+	hdr := buffer.NewPrependable(header.SCTPMinimumSize + len(chunks) + int(r.MaxHeaderLength()))
+	copy(hdr.Prepend(len(chunks)), chunks)
+	h := header.SCTP(hdr.Prepend(header.SCTPMinimumSize))
+	h.SetSourcePort(srcPort)
+	h.SetDestinationPort(dstPort)
+	h.SetVerificationTag(tag)
+	h.SetChecksum(0)
+	if r.Capabilities()&stack.CapabilityChecksumOffload == 0 {
+		h.SetChecksum(header.SCTP(hdr.View()).CalculateChecksum())
+	}
+
+	r.Stats().SCTP.PacketsSent.Increment()
+	return r.WritePacket(nil /* gso */, hdr, buffer.VectorisedView{}, ProtocolNumber, r.DefaultTTL())
+}
+
+// errorCause returns an encoded error cause with the given code and
+// information.
+func errorCause(code header.SCTPErrorCause, info []byte) []byte {
+	return header.SCTPAppendParameter(nil, header.SCTPParameterType(code), info)
+}
+
+// staleCookieCause returns an encoded Stale Cookie error cause for a cookie
+// that expired for the given number of microseconds.
+func staleCookieCause(staleness uint32) []byte {
+	var info [4]byte
+	binary.BigEndian.PutUint32(info[:], staleness)
+	return errorCause(header.SCTPCauseStaleCookie, info[:])
+}
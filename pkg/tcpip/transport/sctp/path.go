@@ -0,0 +1,159 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp
+
+import (
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+)
+
+// path is one of the transport addresses of the peer of an association,
+// along with the state used to send to it: each path has its own
+// retransmission timeout (RFC 4960 section 6.3) and congestion window (RFC
+// 4960 section 7.2).
+type path struct {
+	route stack.Route
+
+	// active is false once the path failed pathMaxRetrans times in a row
+	// (RFC 4960 section 8.2). It becomes active again when a HEARTBEAT ACK
+	// is received from it.
+	active bool
+	errors int
+
+	srtt        time.Duration
+	rttvar      time.Duration
+	rto         time.Duration
+	rttMeasured bool
+
+	cwnd              int
+	ssthresh          int
+	partialBytesAcked int
+	flightSize        int
+
+	// hbNonce is the nonce of the outstanding HEARTBEAT sent to the path,
+	// or 0 if there is none. hbSent is the time it was sent.
+	hbNonce uint64
+	hbSent  time.Time
+
+	// lastSent is the last time a chunk was sent to the path.
+	lastSent time.Time
+}
+
+func newPath(r stack.Route, rtoInitial time.Duration) *path {
+	p := &path{
+		route:    r,
+		active:   true,
+		rto:      rtoInitial,
+		ssthresh: 1 << 30,
+	}
+	// RFC 4960 section 7.2.1: the initial cwnd is min(4*MTU, max(2*MTU,
+	// 4380 bytes)).
+	mtu := p.mtu()
+	p.cwnd = 4 * mtu
+	if max := 2 * mtu; max > 4380 {
+		if p.cwnd > max {
+			p.cwnd = max
+		}
+	} else if p.cwnd > 4380 {
+		p.cwnd = 4380
+	}
+	return p
+}
+
+// mtu returns the maximum size of the chunks of a packet sent to the path.
+func (p *path) mtu() int {
+	return int(p.route.MTU()) - header.SCTPMinimumSize
+}
+
+// updateRTT updates the retransmission timeout of the path with a new round
+// trip time measurement (RFC 4960 section 6.3.1).
+func (p *path) updateRTT(r, rtoMin, rtoMax time.Duration) {
+	if !p.rttMeasured {
+		p.srtt = r
+		p.rttvar = r / 2
+		p.rttMeasured = true
+	} else {
+		diff := p.srtt - r
+		if diff < 0 {
+			diff = -diff
+		}
+		p.rttvar = (3*p.rttvar + diff) / 4
+		p.srtt = (7*p.srtt + r) / 8
+	}
+	p.rto = p.srtt + 4*p.rttvar
+	p.clampRTO(rtoMin, rtoMax)
+}
+
+// backoff doubles the retransmission timeout of the path after a timeout
+// (RFC 4960 section 6.3.3).
+func (p *path) backoff(rtoMin, rtoMax time.Duration) {
+	p.rto *= 2
+	p.clampRTO(rtoMin, rtoMax)
+}
+
+func (p *path) clampRTO(rtoMin, rtoMax time.Duration) {
+	if p.rto < rtoMin {
+		p.rto = rtoMin
+	}
+	if p.rto > rtoMax {
+		p.rto = rtoMax
+	}
+}
+
+// onTimeout adjusts the congestion window of the path after a retransmission
+// timeout (RFC 4960 section 7.2.3).
+func (p *path) onTimeout() {
+	p.ssthresh = p.cwnd / 2
+	if min := 4 * p.mtu(); p.ssthresh < min {
+		p.ssthresh = min
+	}
+	p.cwnd = p.mtu()
+	p.partialBytesAcked = 0
+}
+
+// onAck grows the congestion window of the path after bytesAcked bytes sent
+// to it were newly acknowledged (RFC 4960 sections 7.2.1 and 7.2.2). full is
+// whether the congestion window was fully used.
+func (p *path) onAck(bytesAcked int, full, inFastRecovery bool) {
+	if !full || inFastRecovery {
+		return
+	}
+	mtu := p.mtu()
+	if p.cwnd <= p.ssthresh {
+		if bytesAcked > mtu {
+			bytesAcked = mtu
+		}
+		p.cwnd += bytesAcked
+		return
+	}
+	p.partialBytesAcked += bytesAcked
+	if p.partialBytesAcked >= p.cwnd {
+		p.partialBytesAcked -= p.cwnd
+		p.cwnd += mtu
+	}
+}
+
+// fail records a failure to reach the path, and returns true if it made the
+// path inactive.
+func (p *path) fail() bool {
+	p.errors++
+	if p.active && p.errors > pathMaxRetrans {
+		p.active = false
+		return true
+	}
+	return false
+}
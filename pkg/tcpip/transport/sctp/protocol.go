@@ -0,0 +1,173 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sctp contains the implementation of the SCTP transport protocol
+// (RFC 4960), along with its partial reliability extension (PR-SCTP, RFC
+// 3758). To use it in the networking stack, this package must be added to
+// the project, and activated on the stack by passing sctp.ProtocolName (or
+// "sctp") as one of the transport protocols when calling stack.New(). Then
+// endpoints can be created by passing sctp.ProtocolNumber as the transport
+// protocol number when calling Stack.NewEndpoint().
+//
+// Endpoints are one-to-one style sockets by default, and become one-to-many
+// style sockets with tcpip.SCTPOneToManyOption (RFC 6458 section 3). Both
+// preserve message boundaries. Associations are multi-homed: endpoints bound
+// to the wildcard address advertise all the addresses of the stack, and
+// traffic fails over to the alternate addresses of peers when their primary
+// address becomes unreachable.
+//
+// The following are not supported: initialization collisions and
+// association restarts (RFC 4960 sections 5.2.1 to 5.2.4), which are
+// discarded; multiple streams and payload protocol identifiers for outgoing
+// messages, which are all sent ordered on stream 0; and the notifications
+// and ancillary data of the sockets API.
+package sctp
+
+import (
+	"crypto/rand"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+const (
+	// ProtocolName is the string representation of the sctp protocol name.
+	ProtocolName = "sctp"
+
+	// ProtocolNumber is the sctp protocol number.
+	ProtocolNumber = header.SCTPProtocolNumber
+
+	// DefaultBufferSize is the default size of the receive and send
+	// buffers.
+	DefaultBufferSize = 1 << 20 // 1MB
+
+	// The following are the protocol parameters recommended by RFC 4960
+	// section 15.
+	defaultRTOInitial        = 3 * time.Second
+	defaultRTOMin            = time.Second
+	defaultRTOMax            = 60 * time.Second
+	defaultMaxInitRetransmit = 8
+	assocMaxRetrans          = 10
+	pathMaxRetrans           = 5
+	validCookieLife          = 60 * time.Second
+	heartbeatInterval        = 30 * time.Second
+
+	// sackDelay is the maximum delay of SACKs (RFC 4960 section 6.2).
+	sackDelay = 200 * time.Millisecond
+
+	// defaultOutboundStreams and defaultInboundStreams are the default
+	// numbers of streams requested by associations, as in Linux.
+	defaultOutboundStreams = 10
+	defaultInboundStreams  = 65535
+)
+
+type protocol struct {
+	// cookieKey signs the state cookies sent by the endpoints of the
+	// stack. It is immutable.
+	cookieKey [cookieKeySize]byte
+}
+
+// Number returns the sctp protocol number.
+func (*protocol) Number() tcpip.TransportProtocolNumber {
+	return ProtocolNumber
+}
+
+// NewEndpoint creates a new sctp endpoint.
+func (p *protocol) NewEndpoint(stack *stack.Stack, netProto tcpip.NetworkProtocolNumber, waiterQueue *waiter.Queue) (tcpip.Endpoint, *tcpip.Error) {
+	return newEndpoint(stack, netProto, waiterQueue), nil
+}
+
+// NewRawEndpoint creates a new raw SCTP endpoint. Raw SCTP sockets are
+// currently unsupported. It implements stack.TransportProtocol.NewRawEndpoint.
+func (p *protocol) NewRawEndpoint(stack *stack.Stack, netProto tcpip.NetworkProtocolNumber, waiterQueue *waiter.Queue) (tcpip.Endpoint, *tcpip.Error) {
+	return nil, tcpip.ErrUnknownProtocol
+}
+
+// MinimumPacketSize returns the minimum valid sctp packet size.
+func (*protocol) MinimumPacketSize() int {
+	return header.SCTPMinimumSize
+}
+
+// ParsePorts returns the source and destination ports stored in the given sctp
+// packet.
+func (*protocol) ParsePorts(v buffer.View) (src, dst uint16, err *tcpip.Error) {
+	h := header.SCTP(v)
+	return h.SourcePort(), h.DestinationPort(), nil
+}
+
+// HandleUnknownDestinationPacket handles packets targeted at this protocol but
+// that don't match any existing endpoint. They are answered as described in
+// RFC 4960 section 8.4.
+func (p *protocol) HandleUnknownDestinationPacket(r *stack.Route, id stack.TransportEndpointID, vv buffer.VectorisedView) bool {
+	pkt, chunks, ok := parsePacket(r, vv)
+	if !ok {
+		return true
+	}
+	replyOutOfTheBlue(r, pkt, chunks)
+	return true
+}
+
+// SetOption implements TransportProtocol.SetOption.
+func (p *protocol) SetOption(option interface{}) *tcpip.Error {
+	return tcpip.ErrUnknownProtocolOption
+}
+
+// Option implements TransportProtocol.Option.
+func (p *protocol) Option(option interface{}) *tcpip.Error {
+	return tcpip.ErrUnknownProtocolOption
+}
+
+// replyOutOfTheBlue answers a packet that doesn't belong to any association
+// (RFC 4960 section 8.4).
+func replyOutOfTheBlue(r *stack.Route, pkt header.SCTP, chunks []header.SCTPChunk) {
+	r.Stats().SCTP.OutOfTheBluePackets.Increment()
+	for _, c := range chunks {
+		switch c.Type() {
+		case header.SCTPChunkAbort, header.SCTPChunkShutdownComplete, header.SCTPChunkCookieAck, header.SCTPChunkError:
+			return
+		case header.SCTPChunkShutdownAck:
+			b := header.SCTPAppendChunk(nil, header.SCTPChunkShutdownComplete, header.SCTPFlagNoTCB, nil)
+			sendPacket(r, pkt.DestinationPort(), pkt.SourcePort(), pkt.VerificationTag(), b)
+			return
+		}
+	}
+
+	// The ABORT answering an INIT carries the tag the INIT asks for.
+	if c := chunks[0]; c.Type() == header.SCTPChunkInit {
+		if len(c.Value()) < header.SCTPInitSize {
+			return
+		}
+		tag := header.SCTPInit(c.Value()).Fields().InitiateTag
+		sendPacket(r, pkt.DestinationPort(), pkt.SourcePort(), tag, header.SCTPAppendChunk(nil, header.SCTPChunkAbort, 0, nil))
+		return
+	}
+	sendPacket(r, pkt.DestinationPort(), pkt.SourcePort(), pkt.VerificationTag(), header.SCTPAppendChunk(nil, header.SCTPChunkAbort, header.SCTPFlagNoTCB, nil))
+}
+
+// NewProtocol returns an SCTP transport protocol.
+func NewProtocol() stack.TransportProtocol {
+	p := &protocol{}
+	if _, err := rand.Read(p.cookieKey[:]); err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func init() {
+	stack.RegisterTransportProtocolFactory(ProtocolName, NewProtocol)
+}
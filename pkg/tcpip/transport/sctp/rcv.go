@@ -0,0 +1,393 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/seqnum"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+)
+
+// maxDuplicateTSNs is the maximum number of duplicate TSNs reported in a
+// SACK chunk.
+const maxDuplicateTSNs = 16
+
+// rcvChunk is a DATA chunk received out of order, or waiting for the other
+// fragments of its message.
+type rcvChunk struct {
+	tsn   seqnum.Value
+	flags uint8
+	sid   uint16
+	ssn   uint16
+	data  buffer.View
+}
+
+// pendingMessage is an ordered message waiting for the previous messages of
+// its stream.
+type pendingMessage struct {
+	sid  uint16
+	ssn  uint16
+	data buffer.View
+	from tcpip.FullAddress
+}
+
+// receiver holds the receiving side of an association (RFC 4960 section
+// 6.2).
+type receiver struct {
+	a *association
+
+	// cumTSN is the cumulative TSN received from the peer, outOfOrder the
+	// TSNs received above it, in order, and dups the duplicate TSNs
+	// received since the last SACK.
+	cumTSN     seqnum.Value
+	outOfOrder []seqnum.Value
+	dups       []uint32
+
+	// frags are the chunks waiting for the other fragments of their
+	// message, in TSN order.
+	frags []*rcvChunk
+
+	// pending are the ordered messages waiting for the previous messages
+	// of their stream, and streamSSN holds the next SSN expected on each
+	// stream.
+	pending   []*pendingMessage
+	streamSSN map[uint16]uint16
+
+	// held is the number of bytes held in frags and pending.
+	held int
+
+	// sackNeeded is whether a SACK must be sent now, and packets the
+	// number of packets with DATA chunks received since the last SACK.
+	sackNeeded bool
+	packets    int
+	sackTimer  assocTimer
+
+	// sackPath is the path the last DATA chunk was received from.
+	sackPath *path
+
+	// lastWindow is the receive window advertised in the last SACK.
+	lastWindow int
+}
+
+func (r *receiver) init(a *association) {
+	r.a = a
+	r.streamSSN = make(map[uint16]uint16)
+}
+
+// window returns the receive window of the association.
+func (r *receiver) window() int {
+	e := r.a.ep
+	w := e.rcvBufSizeMax - e.rcvBufUsed - r.held
+	if w < 0 {
+		return 0
+	}
+	return w
+}
+
+// handleData handles a DATA chunk. It returns true if the chunk must be
+// acknowledged.
+func (r *receiver) handleData(route *stack.Route, c header.SCTPChunk) bool {
+	a := r.a
+	switch a.state {
+	case assocEstablished, assocShutdownPending, assocShutdownSent:
+	default:
+		return false
+	}
+	v := c.Value()
+	if len(v) < header.SCTPDataSize {
+		return false
+	}
+	d := header.SCTPData(v)
+	f := d.Fields()
+	tsn := seqnum.Value(f.TSN)
+	if len(d.UserData()) == 0 {
+		var info [4]byte
+		binary.BigEndian.PutUint32(info[:], f.TSN)
+		a.abort(tcpip.ErrConnectionReset, errorCause(header.SCTPCauseNoUserData, info[:]))
+		return false
+	}
+	if p := a.findPath(route.RemoteAddress); p != nil {
+		r.sackPath = p
+	}
+
+	if tsn.LessThanEq(r.cumTSN) || r.isOutOfOrder(tsn) {
+		if len(r.dups) < maxDuplicateTSNs {
+			r.dups = append(r.dups, f.TSN)
+		}
+		r.sackNeeded = true
+		return true
+	}
+
+	// Chunks that don't fit in the receive window are dropped, unless
+	// they are the next ones in order (RFC 4960 section 6.2).
+	data := d.UserData()
+	if len(data) > r.window() && tsn != r.cumTSN+1 {
+		r.sackNeeded = true
+		return true
+	}
+
+	r.markReceived(tsn)
+	if f.StreamIdentifier >= a.inStreams {
+		var info [4]byte
+		binary.BigEndian.PutUint16(info[:], f.StreamIdentifier)
+		a.sendChunks(a.currentPath(), header.SCTPAppendChunk(nil, header.SCTPChunkError, 0, errorCause(header.SCTPCauseInvalidStreamIdentifier, info[:])))
+		return true
+	}
+
+	ch := &rcvChunk{
+		tsn:   tsn,
+		flags: c.Flags(),
+		sid:   f.StreamIdentifier,
+		ssn:   f.StreamSequenceNumber,
+		data:  buffer.NewViewFromBytes(data),
+	}
+	i := sort.Search(len(r.frags), func(i int) bool {
+		return tsn.LessThan(r.frags[i].tsn)
+	})
+	r.frags = append(r.frags, nil)
+	copy(r.frags[i+1:], r.frags[i:])
+	r.frags[i] = ch
+	r.held += len(ch.data)
+	r.reassemble(i, tcpip.FullAddress{
+		NIC:  route.NICID(),
+		Addr: route.RemoteAddress,
+		Port: a.peerPort,
+	})
+	return true
+}
+
+// isOutOfOrder returns true if tsn was received out of order.
+func (r *receiver) isOutOfOrder(tsn seqnum.Value) bool {
+	for _, t := range r.outOfOrder {
+		if t == tsn {
+			return true
+		}
+	}
+	return false
+}
+
+// markReceived records the reception of tsn.
+func (r *receiver) markReceived(tsn seqnum.Value) {
+	if tsn == r.cumTSN+1 {
+		r.cumTSN = tsn
+	} else {
+		i := sort.Search(len(r.outOfOrder), func(i int) bool {
+			return tsn.LessThan(r.outOfOrder[i])
+		})
+		r.outOfOrder = append(r.outOfOrder, 0)
+		copy(r.outOfOrder[i+1:], r.outOfOrder[i:])
+		r.outOfOrder[i] = tsn
+	}
+	r.advanceCumTSN()
+}
+
+// advanceCumTSN advances the cumulative TSN over the TSNs received out of
+// order that became consecutive.
+func (r *receiver) advanceCumTSN() {
+	n := 0
+	for n < len(r.outOfOrder) && r.outOfOrder[n].LessThanEq(r.cumTSN+1) {
+		if r.outOfOrder[n] == r.cumTSN+1 {
+			r.cumTSN++
+		}
+		n++
+	}
+	r.outOfOrder = r.outOfOrder[n:]
+	if len(r.outOfOrder) > 0 {
+		// Gaps are reported right away (RFC 4960 section 6.7).
+		r.sackNeeded = true
+	}
+}
+
+// reassemble delivers the message the fragment at frags[i] belongs to, if all
+// its fragments were received.
+func (r *receiver) reassemble(i int, from tcpip.FullAddress) {
+	b := i
+	for r.frags[b].flags&header.SCTPFlagBeginning == 0 {
+		if b == 0 || r.frags[b-1].tsn != r.frags[b].tsn-1 {
+			return
+		}
+		b--
+	}
+	e := i
+	for r.frags[e].flags&header.SCTPFlagEnd == 0 {
+		if e == len(r.frags)-1 || r.frags[e+1].tsn != r.frags[e].tsn+1 {
+			return
+		}
+		e++
+	}
+
+	size := 0
+	for _, f := range r.frags[b : e+1] {
+		size += len(f.data)
+	}
+	data := make(buffer.View, 0, size)
+	for _, f := range r.frags[b : e+1] {
+		data = append(data, f.data...)
+	}
+	first := r.frags[b]
+	r.frags = append(r.frags[:b], r.frags[e+1:]...)
+	r.held -= size
+
+	msg := &pendingMessage{sid: first.sid, ssn: first.ssn, data: data, from: from}
+	if first.flags&header.SCTPFlagUnordered != 0 {
+		r.deliver(msg)
+		return
+	}
+	r.pending = append(r.pending, msg)
+	r.held += size
+	r.deliverInOrder(msg.sid)
+}
+
+// deliverInOrder delivers the pending messages of stream sid that are next in
+// order.
+func (r *receiver) deliverInOrder(sid uint16) {
+	for {
+		next := r.streamSSN[sid]
+		if !r.deliverPending(sid, next) {
+			return
+		}
+		r.streamSSN[sid] = next + 1
+	}
+}
+
+// deliverPending delivers the pending message of stream sid with the given
+// SSN, and returns false if there is none.
+func (r *receiver) deliverPending(sid, ssn uint16) bool {
+	for i, m := range r.pending {
+		if m.sid == sid && m.ssn == ssn {
+			r.pending = append(r.pending[:i], r.pending[i+1:]...)
+			r.held -= len(m.data)
+			r.deliver(m)
+			return true
+		}
+	}
+	return false
+}
+
+func (r *receiver) deliver(m *pendingMessage) {
+	r.a.ep.deliverLocked(&rcvMessage{
+		from:  m.from,
+		data:  m.data,
+		assoc: r.a,
+	})
+}
+
+// dataReceived schedules the SACK acknowledging the DATA chunks of a packet:
+// SACKs are sent for every other packet, or after sackDelay (RFC 4960
+// section 6.2).
+func (r *receiver) dataReceived() {
+	r.packets++
+	if r.packets >= 2 || r.a.state == assocShutdownSent {
+		r.sackNeeded = true
+	}
+	if !r.sackNeeded && !r.sackTimer.running() {
+		r.sackTimer.reset(r.a.ep, sackDelay, func() {
+			r.sackNeeded = true
+			r.a.snd.flush()
+		})
+	}
+}
+
+// sackChunk returns an encoded SACK chunk acknowledging the chunks received
+// so far.
+func (r *receiver) sackChunk() []byte {
+	var blocks []header.SCTPGapAckBlock
+	for _, t := range r.outOfOrder {
+		off := uint16(t - r.cumTSN)
+		if n := len(blocks); n > 0 && blocks[n-1].End+1 == off {
+			blocks[n-1].End = off
+		} else {
+			blocks = append(blocks, header.SCTPGapAckBlock{Start: off, End: off})
+		}
+	}
+	w := r.window()
+	v := header.EncodeSCTPSack(uint32(r.cumTSN), uint32(w), blocks, r.dups)
+	r.dups = nil
+	r.sackNeeded = false
+	r.packets = 0
+	r.sackTimer.stop()
+	r.lastWindow = w
+	return header.SCTPAppendChunk(nil, header.SCTPChunkSack, 0, v)
+}
+
+// handleForwardTSN handles a FORWARD TSN chunk, which skips the chunks the
+// peer abandoned (RFC 3758 section 3.6).
+func (r *receiver) handleForwardTSN(c header.SCTPChunk) {
+	switch r.a.state {
+	case assocEstablished, assocShutdownPending, assocShutdownSent:
+	default:
+		return
+	}
+	v := c.Value()
+	if len(v) < header.SCTPForwardTSNSize {
+		return
+	}
+	f := header.SCTPForwardTSN(v)
+	r.sackNeeded = true
+	newCum := seqnum.Value(f.NewCumulativeTSN())
+	if !r.cumTSN.LessThan(newCum) {
+		return
+	}
+	r.cumTSN = newCum
+	r.advanceCumTSN()
+
+	// Drop the fragments of the abandoned messages.
+	frags := r.frags[:0]
+	for _, ch := range r.frags {
+		if ch.tsn.LessThanEq(r.cumTSN) {
+			r.held -= len(ch.data)
+			continue
+		}
+		frags = append(frags, ch)
+	}
+	for i := len(frags); i < len(r.frags); i++ {
+		r.frags[i] = nil
+	}
+	r.frags = frags
+
+	// Deliver the messages that were waiting for the skipped ones.
+	for _, s := range f.Streams() {
+		next := r.streamSSN[s.StreamIdentifier]
+		if int16(s.StreamSequenceNumber-next) < 0 {
+			continue
+		}
+		for ssn := next; ssn != s.StreamSequenceNumber+1; ssn++ {
+			r.deliverPending(s.StreamIdentifier, ssn)
+		}
+		r.streamSSN[s.StreamIdentifier] = s.StreamSequenceNumber + 1
+		r.deliverInOrder(s.StreamIdentifier)
+	}
+}
+
+// peerShutdown records that the peer won't send more data.
+func (r *receiver) peerShutdown() {
+	r.a.ep.peerShutdownLocked(r.a)
+}
+
+// readDone is called when messages of the association are read from the
+// endpoint, and sends a SACK if it opened the receive window significantly.
+func (r *receiver) readDone() {
+	w := r.window()
+	if w-r.lastWindow < r.a.currentPath().mtu() || r.lastWindow >= r.a.ep.rcvBufSizeMax/2 {
+		return
+	}
+	r.sackNeeded = true
+	r.a.snd.flush()
+}
@@ -0,0 +1,530 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp_test
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/channel"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/sctp"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+const (
+	// The client stack has the addresses 10.0.N.1, and the server stack
+	// the addresses 10.0.N.2, on their NIC N+1.
+	clientAddr  = "\x0a\x00\x00\x01"
+	clientAddr2 = "\x0a\x00\x01\x01"
+	serverAddr  = "\x0a\x00\x00\x02"
+	serverPort  = 1234
+
+	defaultMTU = 1500
+	timeout    = 5 * time.Second
+)
+
+// link forwards the packets sent by an endpoint of a channel to the other
+// one, unless drop returns true for them.
+type link struct {
+	mu   sync.Mutex
+	drop func(chunks []header.SCTPChunk) bool
+}
+
+func (l *link) setDrop(drop func(chunks []header.SCTPChunk) bool) {
+	l.mu.Lock()
+	l.drop = drop
+	l.mu.Unlock()
+}
+
+func (l *link) dropped(p channel.PacketInfo) bool {
+	l.mu.Lock()
+	drop := l.drop
+	l.mu.Unlock()
+	if drop == nil {
+		return false
+	}
+	b := append(append(buffer.View(nil), p.Header...), p.Payload...)
+	chunks, ok := header.SCTP(header.IPv4(b).Payload()).Chunks()
+	return ok && drop(chunks)
+}
+
+func (l *link) forward(from, to *channel.Endpoint, done <-chan struct{}) {
+	for {
+		select {
+		case p := <-from.C:
+			if l.dropped(p) {
+				continue
+			}
+			v := append(append(buffer.View(nil), p.Header...), p.Payload...)
+			to.Inject(p.Proto, v.ToVectorisedView())
+		case <-done:
+			return
+		}
+	}
+}
+
+// dropAll drops all packets.
+func dropAll([]header.SCTPChunk) bool {
+	return true
+}
+
+// dropData drops the packets holding DATA chunks.
+func dropData(chunks []header.SCTPChunk) bool {
+	for _, c := range chunks {
+		if c.Type() == header.SCTPChunkData {
+			return true
+		}
+	}
+	return false
+}
+
+type testContext struct {
+	t      *testing.T
+	client *stack.Stack
+	server *stack.Stack
+
+	// links are the links from clients to servers and from servers to
+	// clients of each pair of NICs.
+	links [][2]*link
+	done  chan struct{}
+}
+
+// newTestContext returns two stacks connected by the given number of links.
+func newTestContext(t *testing.T, nics int) *testContext {
+	c := &testContext{
+		t:      t,
+		client: stack.New([]string{ipv4.ProtocolName}, []string{sctp.ProtocolName}, stack.Options{}),
+		server: stack.New([]string{ipv4.ProtocolName}, []string{sctp.ProtocolName}, stack.Options{}),
+		done:   make(chan struct{}),
+	}
+	var clientRoutes, serverRoutes []tcpip.Route
+	for i := 0; i < nics; i++ {
+		nicid := tcpip.NICID(i + 1)
+		cid, cep := channel.New(256, defaultMTU, "")
+		sid, sep := channel.New(256, defaultMTU, "")
+		if err := c.client.CreateNIC(nicid, cid); err != nil {
+			t.Fatalf("CreateNIC failed: %v", err)
+		}
+		if err := c.server.CreateNIC(nicid, sid); err != nil {
+			t.Fatalf("CreateNIC failed: %v", err)
+		}
+		subnet := "\x0a\x00" + string(byte(i)) + "\x00"
+		if err := c.client.AddAddress(nicid, ipv4.ProtocolNumber, tcpip.Address(subnet[:3]+"\x01")); err != nil {
+			t.Fatalf("AddAddress failed: %v", err)
+		}
+		if err := c.server.AddAddress(nicid, ipv4.ProtocolNumber, tcpip.Address(subnet[:3]+"\x02")); err != nil {
+			t.Fatalf("AddAddress failed: %v", err)
+		}
+		route := tcpip.Route{
+			Destination: tcpip.Address(subnet),
+			Mask:        "\xff\xff\xff\x00",
+			NIC:         nicid,
+		}
+		clientRoutes = append(clientRoutes, route)
+		serverRoutes = append(serverRoutes, route)
+
+		l := [2]*link{{}, {}}
+		go l[0].forward(cep, sep, c.done)
+		go l[1].forward(sep, cep, c.done)
+		c.links = append(c.links, l)
+	}
+	c.client.SetRouteTable(clientRoutes)
+	c.server.SetRouteTable(serverRoutes)
+	return c
+}
+
+func (c *testContext) cleanup() {
+	close(c.done)
+}
+
+// newEndpoint creates an endpoint with short retransmission timeouts.
+func (c *testContext) newEndpoint(s *stack.Stack, oneToMany bool) (tcpip.Endpoint, *waiter.Queue) {
+	var wq waiter.Queue
+	ep, err := s.NewEndpoint(sctp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+	if err != nil {
+		c.t.Fatalf("NewEndpoint failed: %v", err)
+	}
+	if oneToMany {
+		if err := ep.SetSockOpt(tcpip.SCTPOneToManyOption(1)); err != nil {
+			c.t.Fatalf("SetSockOpt(SCTPOneToManyOption) failed: %v", err)
+		}
+	}
+	rto := tcpip.SCTPRTOInfoOption{
+		Initial: 100 * time.Millisecond,
+		Min:     50 * time.Millisecond,
+		Max:     time.Second,
+	}
+	if err := ep.SetSockOpt(rto); err != nil {
+		c.t.Fatalf("SetSockOpt(%+v) failed: %v", rto, err)
+	}
+	return ep, &wq
+}
+
+// listen creates a server endpoint listening on serverPort.
+func (c *testContext) listen(oneToMany bool) (tcpip.Endpoint, *waiter.Queue) {
+	ep, wq := c.newEndpoint(c.server, oneToMany)
+	if err := ep.Bind(tcpip.FullAddress{Port: serverPort}); err != nil {
+		c.t.Fatalf("Bind failed: %v", err)
+	}
+	if err := ep.Listen(10); err != nil {
+		c.t.Fatalf("Listen failed: %v", err)
+	}
+	return ep, wq
+}
+
+// wait waits for one of the given events of wq, and fails the test if it
+// doesn't happen in time.
+func (c *testContext) wait(ep tcpip.Endpoint, wq *waiter.Queue, mask waiter.EventMask, ready func() bool) {
+	we, ch := waiter.NewChannelEntry(nil)
+	wq.EventRegister(&we, mask)
+	defer wq.EventUnregister(&we)
+
+	deadline := time.After(timeout)
+	for !ready() {
+		select {
+		case <-ch:
+		case <-deadline:
+			c.t.Fatalf("Timed out waiting for events %v", mask)
+		}
+	}
+}
+
+// connect connects ep to the server, and returns the result of the
+// handshake.
+func (c *testContext) connect(ep tcpip.Endpoint, wq *waiter.Queue, addr tcpip.Address) *tcpip.Error {
+	we, ch := waiter.NewChannelEntry(nil)
+	wq.EventRegister(&we, waiter.EventOut)
+	defer wq.EventUnregister(&we)
+
+	if err := ep.Connect(tcpip.FullAddress{Addr: addr, Port: serverPort}); err != tcpip.ErrConnectStarted {
+		c.t.Fatalf("Connect returned %v, want %v", err, tcpip.ErrConnectStarted)
+	}
+	select {
+	case <-ch:
+	case <-time.After(timeout):
+		c.t.Fatalf("Timed out connecting")
+	}
+	return ep.Connect(tcpip.FullAddress{Addr: addr, Port: serverPort})
+}
+
+// accept accepts an association on the listening endpoint ep.
+func (c *testContext) accept(ep tcpip.Endpoint, wq *waiter.Queue) (tcpip.Endpoint, *waiter.Queue) {
+	var (
+		n   tcpip.Endpoint
+		nwq *waiter.Queue
+	)
+	c.wait(ep, wq, waiter.EventIn, func() bool {
+		var err *tcpip.Error
+		n, nwq, err = ep.Accept()
+		if err != nil && err != tcpip.ErrWouldBlock {
+			c.t.Fatalf("Accept failed: %v", err)
+		}
+		return err == nil
+	})
+	return n, nwq
+}
+
+// dial returns a client endpoint connected to a server endpoint.
+func (c *testContext) dial() (client tcpip.Endpoint, clientWQ *waiter.Queue, server tcpip.Endpoint, serverWQ *waiter.Queue) {
+	l, lwq := c.listen(false)
+	defer l.Close()
+
+	client, clientWQ = c.newEndpoint(c.client, false)
+	if err := c.connect(client, clientWQ, serverAddr); err != nil {
+		c.t.Fatalf("Connect failed: %v", err)
+	}
+	server, serverWQ = c.accept(l, lwq)
+	return client, clientWQ, server, serverWQ
+}
+
+func (c *testContext) write(ep tcpip.Endpoint, to *tcpip.FullAddress, v []byte) {
+	n, _, err := ep.Write(tcpip.SlicePayload(v), tcpip.WriteOptions{To: to})
+	if err != nil {
+		c.t.Fatalf("Write failed: %v", err)
+	}
+	if int(n) != len(v) {
+		c.t.Fatalf("Write wrote %d bytes, want %d", n, len(v))
+	}
+}
+
+// read reads a message from ep, waiting for it if needed.
+func (c *testContext) read(ep tcpip.Endpoint, wq *waiter.Queue) (buffer.View, tcpip.FullAddress) {
+	var (
+		v    buffer.View
+		from tcpip.FullAddress
+	)
+	c.wait(ep, wq, waiter.EventIn, func() bool {
+		var err *tcpip.Error
+		v, _, err = ep.Read(&from)
+		if err != nil && err != tcpip.ErrWouldBlock {
+			c.t.Fatalf("Read failed: %v", err)
+		}
+		return err == nil
+	})
+	return v, from
+}
+
+func TestConnectAndTransfer(t *testing.T) {
+	c := newTestContext(t, 1)
+	defer c.cleanup()
+
+	client, clientWQ, server, serverWQ := c.dial()
+	defer server.Close()
+
+	// Message boundaries are preserved.
+	msgs := [][]byte{[]byte("hello"), []byte("world"), bytes.Repeat([]byte{1}, 1000)}
+	for _, m := range msgs {
+		c.write(client, nil, m)
+	}
+	for _, m := range msgs {
+		if v, _ := c.read(server, serverWQ); !bytes.Equal(v, m) {
+			t.Fatalf("Read returned %q, want %q", v, m)
+		}
+	}
+
+	c.write(server, nil, []byte("reply"))
+	v, from := c.read(client, clientWQ)
+	if string(v) != "reply" {
+		t.Fatalf("Read returned %q, want %q", v, "reply")
+	}
+	if want := (tcpip.FullAddress{NIC: 1, Addr: serverAddr, Port: serverPort}); from != want {
+		t.Fatalf("Read returned sender %+v, want %+v", from, want)
+	}
+
+	addr, err := server.GetRemoteAddress()
+	if err != nil {
+		t.Fatalf("GetRemoteAddress failed: %v", err)
+	}
+	if addr.Addr != clientAddr {
+		t.Fatalf("GetRemoteAddress returned %v, want %v", addr.Addr, clientAddr)
+	}
+
+	// Closing the client shuts the association down gracefully.
+	client.Close()
+	c.wait(server, serverWQ, waiter.EventIn, func() bool {
+		_, _, err := server.Read(nil)
+		return err == tcpip.ErrClosedForReceive
+	})
+	for deadline := time.Now().Add(timeout); c.server.Stats().SCTP.Shutdowns.Value() != 1; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the shutdown to complete")
+		}
+	}
+	if _, _, err := server.Write(tcpip.SlicePayload("x"), tcpip.WriteOptions{}); err != tcpip.ErrClosedForSend {
+		t.Fatalf("Write returned %v, want %v", err, tcpip.ErrClosedForSend)
+	}
+}
+
+func TestConnectionRefused(t *testing.T) {
+	c := newTestContext(t, 1)
+	defer c.cleanup()
+
+	ep, wq := c.newEndpoint(c.client, false)
+	defer ep.Close()
+	if err := c.connect(ep, wq, serverAddr); err != tcpip.ErrConnectionRefused {
+		t.Fatalf("Connect returned %v, want %v", err, tcpip.ErrConnectionRefused)
+	}
+	if got := c.server.Stats().SCTP.OutOfTheBluePackets.Value(); got != 1 {
+		t.Fatalf("got OutOfTheBluePackets = %d, want 1", got)
+	}
+}
+
+func TestOneToMany(t *testing.T) {
+	c := newTestContext(t, 1)
+	defer c.cleanup()
+
+	server, serverWQ := c.listen(true)
+	defer server.Close()
+
+	// A one-to-many client sets associations up implicitly.
+	client1, client1WQ := c.newEndpoint(c.client, true)
+	defer client1.Close()
+	to := tcpip.FullAddress{Addr: serverAddr, Port: serverPort}
+	if _, _, err := client1.Write(tcpip.SlicePayload("x"), tcpip.WriteOptions{}); err != tcpip.ErrDestinationRequired {
+		t.Fatalf("Write returned %v, want %v", err, tcpip.ErrDestinationRequired)
+	}
+	c.write(client1, &to, []byte("client1"))
+
+	// One-to-one clients can connect to one-to-many servers.
+	client2, client2WQ := c.newEndpoint(c.client, false)
+	defer client2.Close()
+	if err := c.connect(client2, client2WQ, serverAddr); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	c.write(client2, nil, []byte("client2"))
+
+	peers := make(map[string]tcpip.FullAddress)
+	for i := 0; i < 2; i++ {
+		v, from := c.read(server, serverWQ)
+		peers[string(v)] = from
+	}
+	for _, name := range []string{"client1", "client2"} {
+		if _, ok := peers[name]; !ok {
+			t.Fatalf("Didn't receive the message of %s, got %v", name, peers)
+		}
+	}
+	if peers["client1"].Port == peers["client2"].Port {
+		t.Fatalf("Messages received from the same peer %+v", peers["client1"])
+	}
+
+	// The server answers each peer on its association.
+	from := peers["client1"]
+	c.write(server, &from, []byte("reply1"))
+	if v, got := c.read(client1, client1WQ); string(v) != "reply1" || got.Addr != to.Addr || got.Port != to.Port {
+		t.Fatalf("Read returned (%q, %+v), want (%q, %+v)", v, got, "reply1", to)
+	}
+
+	if _, _, err := server.Accept(); err != tcpip.ErrNotSupported {
+		t.Fatalf("Accept returned %v, want %v", err, tcpip.ErrNotSupported)
+	}
+}
+
+func TestFragmentation(t *testing.T) {
+	c := newTestContext(t, 1)
+	defer c.cleanup()
+
+	client, _, server, serverWQ := c.dial()
+	defer client.Close()
+	defer server.Close()
+
+	msg := make([]byte, 100000)
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+	c.write(client, nil, msg)
+	c.write(client, nil, []byte("next"))
+	if v, _ := c.read(server, serverWQ); !bytes.Equal(v, msg) {
+		t.Fatalf("Read returned %d bytes, want the %d bytes of the message", len(v), len(msg))
+	}
+	if v, _ := c.read(server, serverWQ); string(v) != "next" {
+		t.Fatalf("Read returned %q, want %q", v, "next")
+	}
+}
+
+func TestRetransmission(t *testing.T) {
+	c := newTestContext(t, 1)
+	defer c.cleanup()
+
+	client, _, server, serverWQ := c.dial()
+	defer client.Close()
+	defer server.Close()
+
+	// Drop the first two transmissions of the DATA chunk.
+	var mu sync.Mutex
+	drops := 2
+	c.links[0][0].setDrop(func(chunks []header.SCTPChunk) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if drops > 0 && dropData(chunks) {
+			drops--
+			return true
+		}
+		return false
+	})
+	c.write(client, nil, []byte("hello"))
+	if v, _ := c.read(server, serverWQ); string(v) != "hello" {
+		t.Fatalf("Read returned %q, want %q", v, "hello")
+	}
+	if got := c.client.Stats().SCTP.Retransmits.Value(); got < 2 {
+		t.Fatalf("got Retransmits = %d, want >= 2", got)
+	}
+}
+
+func TestMultihomingFailover(t *testing.T) {
+	c := newTestContext(t, 2)
+	defer c.cleanup()
+
+	client, _, server, serverWQ := c.dial()
+	defer client.Close()
+	defer server.Close()
+
+	// The primary path goes down: data is retransmitted to the alternate
+	// address of the server, and acknowledged from there.
+	c.links[0][0].setDrop(dropAll)
+	c.links[0][1].setDrop(dropAll)
+	c.write(client, nil, []byte("hello"))
+	v, from := c.read(server, serverWQ)
+	if string(v) != "hello" {
+		t.Fatalf("Read returned %q, want %q", v, "hello")
+	}
+	if from.Addr != clientAddr2 {
+		t.Fatalf("Read returned sender %v, want %v", from.Addr, clientAddr2)
+	}
+}
+
+func TestPartialReliabilityTTL(t *testing.T) {
+	c := newTestContext(t, 1)
+	defer c.cleanup()
+
+	client, _, server, serverWQ := c.dial()
+	defer client.Close()
+	defer server.Close()
+
+	pr := tcpip.SCTPDefaultPRInfoOption{Policy: tcpip.SCTPPRPolicyTTL, Value: 50}
+	if err := client.SetSockOpt(pr); err != nil {
+		t.Fatalf("SetSockOpt(%+v) failed: %v", pr, err)
+	}
+
+	// The first message can't be delivered before it expires: it is
+	// abandoned, and the server is told to skip it.
+	c.links[0][0].setDrop(dropData)
+	c.write(client, nil, []byte("lost"))
+	time.Sleep(200 * time.Millisecond)
+	c.links[0][0].setDrop(nil)
+	c.write(client, nil, []byte("next"))
+	if v, _ := c.read(server, serverWQ); string(v) != "next" {
+		t.Fatalf("Read returned %q, want %q", v, "next")
+	}
+	if got := c.client.Stats().SCTP.AbandonedMessages.Value(); got != 1 {
+		t.Fatalf("got AbandonedMessages = %d, want 1", got)
+	}
+}
+
+func TestSockOpts(t *testing.T) {
+	c := newTestContext(t, 1)
+	defer c.cleanup()
+
+	ep, _ := c.newEndpoint(c.client, false)
+	defer ep.Close()
+
+	if err := ep.SetSockOpt(tcpip.SCTPRTOInfoOption{Min: 2 * time.Second}); err != tcpip.ErrInvalidOptionValue {
+		t.Fatalf("SetSockOpt returned %v, want %v", err, tcpip.ErrInvalidOptionValue)
+	}
+	want := tcpip.SCTPInitMsgOption{NumOutboundStreams: 5, MaxInboundStreams: 6, MaxAttempts: 7, MaxInitTimeout: time.Second}
+	if err := ep.SetSockOpt(want); err != nil {
+		t.Fatalf("SetSockOpt(%+v) failed: %v", want, err)
+	}
+	var got tcpip.SCTPInitMsgOption
+	if err := ep.GetSockOpt(&got); err != nil {
+		t.Fatalf("GetSockOpt failed: %v", err)
+	}
+	if got != want {
+		t.Fatalf("got SCTPInitMsgOption = %+v, want %+v", got, want)
+	}
+
+	if err := ep.Bind(tcpip.FullAddress{}); err != nil {
+		t.Fatalf("Bind failed: %v", err)
+	}
+	if err := ep.SetSockOpt(tcpip.SCTPOneToManyOption(1)); err != tcpip.ErrInvalidEndpointState {
+		t.Fatalf("SetSockOpt(SCTPOneToManyOption) returned %v, want %v", err, tcpip.ErrInvalidEndpointState)
+	}
+}
@@ -0,0 +1,666 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp
+
+import (
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/seqnum"
+)
+
+// fastRetransmitThreshold is the number of miss indications after which a
+// DATA chunk is retransmitted without waiting for the T3-rtx timer (RFC 4960
+// section 7.2.4).
+const fastRetransmitThreshold = 3
+
+// sndMessage is a message queued for sending.
+type sndMessage struct {
+	size int
+
+	// expire is the time at which the message is abandoned by the TTL
+	// policy of PR-SCTP, or zero.
+	expire time.Time
+
+	// maxRtx is the number of retransmissions after which the message is
+	// abandoned by the RTX policy of PR-SCTP, or -1.
+	maxRtx int
+
+	// chunks is the number of chunks of the message that are neither
+	// acknowledged nor abandoned.
+	chunks int
+
+	abandoned bool
+}
+
+// dataChunk is a DATA chunk queued for sending. It is assigned its TSN when
+// queued.
+type dataChunk struct {
+	msg   *sndMessage
+	tsn   seqnum.Value
+	ssn   uint16
+	flags uint8
+	data  buffer.View
+
+	// path is the path the chunk was last sent to, sentAt the time it was
+	// sent at, and sendCount the number of times it was sent.
+	path      *path
+	sentAt    time.Time
+	sendCount int
+
+	// inFlight is whether the chunk is counted in the flight size of its
+	// path.
+	inFlight bool
+
+	// acked is whether the chunk is acknowledged by a gap ack block.
+	acked bool
+
+	// rtx is whether the chunk must be retransmitted.
+	rtx bool
+
+	missReports int
+	fastRtx     bool
+
+	// done is whether the chunk was cumulatively acknowledged or
+	// abandoned, in which case its message doesn't hold it anymore.
+	done      bool
+	abandoned bool
+}
+
+// sender holds the sending side of an association (RFC 4960 sections 6 and
+// 7).
+type sender struct {
+	a *association
+
+	nextTSN seqnum.Value
+	nextSSN uint16
+
+	// cumTSNAck is the cumulative TSN acknowledged by the peer, and
+	// advancedPeerAckPoint the TSN up to which chunks are acknowledged or
+	// abandoned (RFC 3758 section 3.5).
+	cumTSNAck            seqnum.Value
+	advancedPeerAckPoint seqnum.Value
+
+	// forwardTSN is whether a FORWARD TSN chunk must be sent.
+	forwardTSN bool
+
+	// chunks are the chunks whose TSN is above cumTSNAck, in order.
+	// chunks[nextSend:] were never sent.
+	chunks   []*dataChunk
+	nextSend int
+
+	peerRwnd int
+
+	// rtxPath is the path chunks are retransmitted to after a timeout, or
+	// nil to use the current path.
+	rtxPath *path
+
+	fastRecovery bool
+	recover      seqnum.Value
+
+	// rttChunk is the chunk used to measure the round trip time, or nil.
+	rttChunk *dataChunk
+
+	t3 assocTimer
+}
+
+func (s *sender) init(a *association, tsn seqnum.Value) {
+	s.a = a
+	s.nextTSN = tsn
+	s.cumTSNAck = tsn - 1
+	s.advancedPeerAckPoint = tsn - 1
+}
+
+// queue fragments the message v into DATA chunks and queues them for
+// sending, with the given PR-SCTP policy.
+func (s *sender) queue(v buffer.View, pr tcpip.SCTPDefaultPRInfoOption) {
+	msg := &sndMessage{size: len(v), maxRtx: -1}
+	switch pr.Policy {
+	case tcpip.SCTPPRPolicyTTL:
+		msg.expire = time.Now().Add(time.Duration(pr.Value) * time.Millisecond)
+	case tcpip.SCTPPRPolicyRTX:
+		msg.maxRtx = int(pr.Value)
+	}
+
+	max := s.a.currentPath().mtu() - header.SCTPChunkHeaderSize - header.SCTPDataSize
+	ssn := s.nextSSN
+	s.nextSSN++
+	for off := 0; off < len(v); {
+		n := len(v) - off
+		if n > max {
+			n = max
+		}
+		var flags uint8
+		if off == 0 {
+			flags |= header.SCTPFlagBeginning
+		}
+		if off+n == len(v) {
+			flags |= header.SCTPFlagEnd
+		}
+		s.chunks = append(s.chunks, &dataChunk{
+			msg:   msg,
+			tsn:   s.nextTSN,
+			ssn:   ssn,
+			flags: flags,
+			data:  v[off : off+n],
+		})
+		s.nextTSN++
+		msg.chunks++
+		off += n
+	}
+}
+
+// encodeDataChunk returns the encoded DATA chunk c.
+func encodeDataChunk(c *dataChunk) []byte {
+	v := make([]byte, header.SCTPDataSize+len(c.data))
+	header.SCTPData(v).Encode(&header.SCTPDataFields{
+		TSN:                  uint32(c.tsn),
+		StreamSequenceNumber: c.ssn,
+	})
+	copy(v[header.SCTPDataSize:], c.data)
+	return header.SCTPAppendChunk(nil, header.SCTPChunkData, c.flags, v)
+}
+
+// flightSize returns the number of bytes in flight on all the paths.
+func (s *sender) flightSize() int {
+	n := 0
+	for _, p := range s.a.paths {
+		n += p.flightSize
+	}
+	return n
+}
+
+// transmit records that c is sent to p.
+func (s *sender) transmit(c *dataChunk, p *path, now time.Time) {
+	c.sendCount++
+	c.rtx = false
+	c.inFlight = true
+	c.path = p
+	c.sentAt = now
+	p.flightSize += len(c.data)
+	s.peerRwnd -= len(c.data)
+	if s.peerRwnd < 0 {
+		s.peerRwnd = 0
+	}
+}
+
+// flush sends the pending control chunks, and as many DATA chunks as the
+// congestion and receive windows allow (RFC 4960 section 6.1).
+func (s *sender) flush() {
+	a := s.a
+	switch a.state {
+	case assocEstablished, assocShutdownPending, assocShutdownReceived, assocShutdownSent:
+	default:
+		return
+	}
+	now := time.Now()
+	s.abandonExpired(now)
+
+	var (
+		pkt     []byte
+		pktPath *path
+	)
+	send := func() {
+		if len(pkt) > 0 {
+			a.sendChunks(pktPath, pkt)
+			pkt = nil
+		}
+	}
+	add := func(p *path, chunk []byte) {
+		if p != pktPath || len(pkt)+len(chunk) > p.mtu() {
+			send()
+			pktPath = p
+		}
+		pkt = append(pkt, chunk...)
+	}
+
+	// Control chunks go to the path the peer last sent data from (RFC
+	// 4960 section 6.4).
+	var ctrl []byte
+	if a.rcv.sackNeeded {
+		ctrl = a.rcv.sackChunk()
+	}
+	if s.forwardTSN {
+		ctrl = append(ctrl, s.forwardTSNChunk()...)
+		s.forwardTSN = false
+	}
+	if ctrl != nil {
+		p := a.rcv.sackPath
+		if p == nil {
+			p = a.currentPath()
+		}
+		add(p, ctrl)
+	}
+
+	// Retransmissions go first.
+	rp := s.rtxPath
+	if rp == nil {
+		rp = a.currentPath()
+	}
+	pending := false
+	for _, c := range s.chunks {
+		if !c.rtx {
+			continue
+		}
+		if rp.flightSize >= rp.cwnd {
+			pending = true
+			break
+		}
+		s.transmit(c, rp, now)
+		add(rp, encodeDataChunk(c))
+		a.ep.stack.Stats().SCTP.Retransmits.Increment()
+	}
+	if !pending {
+		s.rtxPath = nil
+	}
+
+	// Then new data.
+	p := a.currentPath()
+	unsent := 0
+	for _, c := range s.chunks[s.nextSend:] {
+		if !c.done {
+			unsent += len(c.data)
+		}
+	}
+	for !pending && s.nextSend < len(s.chunks) {
+		c := s.chunks[s.nextSend]
+		if c.done {
+			s.nextSend++
+			continue
+		}
+		flight := s.flightSize()
+		if p.flightSize >= p.cwnd {
+			break
+		}
+		// A single chunk may be sent when the peer's window is closed
+		// and nothing is in flight (RFC 4960 section 6.1 rule A).
+		if len(c.data) > s.peerRwnd && flight > 0 {
+			break
+		}
+		// Small messages are delayed while data is in flight if the
+		// Nagle algorithm is enabled.
+		if a.ep.delay && flight > 0 && unsent < p.mtu()-header.SCTPChunkHeaderSize-header.SCTPDataSize {
+			break
+		}
+		s.transmit(c, p, now)
+		add(p, encodeDataChunk(c))
+		unsent -= len(c.data)
+		if s.rttChunk == nil {
+			s.rttChunk = c
+		}
+		s.nextSend++
+	}
+	send()
+
+	if s.hasInFlight() || s.cumTSNAck.LessThan(s.advancedPeerAckPoint) {
+		if !s.t3.running() {
+			s.startT3()
+		}
+	} else {
+		s.t3.stop()
+	}
+
+	// Shut down once all the data is acknowledged (RFC 4960 section 9.2).
+	if len(s.chunks) == 0 {
+		switch a.state {
+		case assocShutdownPending:
+			a.state = assocShutdownSent
+			a.sendShutdown()
+		case assocShutdownReceived:
+			a.state = assocShutdownAckSent
+			a.sendShutdown()
+		}
+	}
+}
+
+// hasInFlight returns true if chunks are in flight.
+func (s *sender) hasInFlight() bool {
+	for _, c := range s.chunks[:s.nextSend] {
+		if c.inFlight {
+			return true
+		}
+	}
+	return false
+}
+
+// startT3 starts the T3-rtx timer with the timeout of the path of the
+// earliest chunk in flight (RFC 4960 section 6.3.2).
+func (s *sender) startT3() {
+	p := s.a.currentPath()
+	for _, c := range s.chunks[:s.nextSend] {
+		if c.inFlight {
+			p = c.path
+			break
+		}
+	}
+	s.t3.reset(s.a.ep, p.rto, s.handleT3)
+}
+
+// handleT3 handles the expiration of the T3-rtx timer: the chunks in flight
+// to the path that timed out are retransmitted, to another path if possible
+// (RFC 4960 sections 6.3.3 and 6.4).
+func (s *sender) handleT3() {
+	a := s.a
+	var p *path
+	for _, c := range s.chunks[:s.nextSend] {
+		if c.inFlight {
+			p = c.path
+			break
+		}
+	}
+	if p == nil {
+		// Only a FORWARD TSN is outstanding.
+		s.forwardTSN = s.cumTSNAck.LessThan(s.advancedPeerAckPoint)
+		s.flush()
+		return
+	}
+
+	if a.fail(p) {
+		return
+	}
+	p.backoff(a.ep.rtoInfo.Min, a.ep.rtoInfo.Max)
+	p.onTimeout()
+	for _, c := range s.chunks[:s.nextSend] {
+		if c.inFlight && c.path == p {
+			s.markForRetransmit(c)
+		}
+	}
+	s.rtxPath = a.alternatePath(p)
+	if s.cumTSNAck.LessThan(s.advancedPeerAckPoint) {
+		s.forwardTSN = true
+	}
+	s.flush()
+}
+
+// markForRetransmit marks c to be retransmitted, or abandons its message if
+// it was retransmitted too many times.
+func (s *sender) markForRetransmit(c *dataChunk) {
+	if c.inFlight {
+		c.inFlight = false
+		c.path.flightSize -= len(c.data)
+	}
+	if c == s.rttChunk {
+		// Retransmitted chunks can't measure the round trip time
+		// (RFC 4960 section 6.3.1 rule C5).
+		s.rttChunk = nil
+	}
+	if s.a.prEnabled() && c.msg.maxRtx >= 0 && c.sendCount > c.msg.maxRtx {
+		s.abandon(c.msg)
+		return
+	}
+	c.rtx = true
+}
+
+// handleSack handles a SACK chunk (RFC 4960 section 6.2.1).
+func (s *sender) handleSack(ch header.SCTPChunk) {
+	a := s.a
+	switch a.state {
+	case assocEstablished, assocShutdownPending, assocShutdownReceived, assocShutdownSent:
+	default:
+		return
+	}
+	if len(ch.Value()) < header.SCTPSackSize {
+		return
+	}
+	sack := header.SCTPSack(ch.Value())
+	cum := seqnum.Value(sack.CumulativeTSNAck())
+	if cum.LessThan(s.cumTSNAck) || !cum.LessThan(s.nextTSN) {
+		// The SACK is older than a previous one, or acknowledges
+		// TSNs that weren't sent.
+		return
+	}
+	blocks, ok := sack.GapAckBlocks()
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	full := make(map[*path]bool)
+	for _, p := range a.paths {
+		full[p] = p.flightSize >= p.cwnd
+	}
+	acked := make(map[*path]int)
+	cumAdvanced := s.cumTSNAck.LessThan(cum)
+	s.ackCumulative(cum, acked, now)
+
+	// Handle the gap ack blocks.
+	var highest seqnum.Value
+	gapAcked := false
+	for _, c := range s.chunks[:s.nextSend] {
+		off := uint32(c.tsn - cum)
+		in := false
+		for _, b := range blocks {
+			if off >= uint32(b.Start) && off <= uint32(b.End) {
+				in = true
+				break
+			}
+		}
+		switch {
+		case in && !c.acked:
+			s.ackChunk(c, acked, now)
+			highest = c.tsn
+			gapAcked = true
+		case !in && c.acked && !c.done:
+			// The peer reneged on the chunk.
+			c.acked = false
+			c.rtx = true
+		}
+	}
+
+	// Chunks below the highest newly acknowledged one are missing (RFC
+	// 4960 section 7.2.4).
+	if gapAcked {
+		for _, c := range s.chunks[:s.nextSend] {
+			if !c.tsn.LessThan(highest) {
+				break
+			}
+			if !c.inFlight || c.acked || c.fastRtx {
+				continue
+			}
+			c.missReports++
+			if c.missReports < fastRetransmitThreshold {
+				continue
+			}
+			c.fastRtx = true
+			if !s.fastRecovery {
+				s.fastRecovery = true
+				s.recover = s.nextTSN - 1
+				p := c.path
+				p.ssthresh = p.cwnd / 2
+				if min := 4 * p.mtu(); p.ssthresh < min {
+					p.ssthresh = min
+				}
+				p.cwnd = p.ssthresh
+				p.partialBytesAcked = 0
+			}
+			s.markForRetransmit(c)
+		}
+	}
+	if s.fastRecovery && !cum.LessThan(s.recover) {
+		s.fastRecovery = false
+	}
+
+	if cumAdvanced {
+		for p, n := range acked {
+			p.onAck(n, full[p], s.fastRecovery)
+		}
+		a.errors = 0
+		s.t3.stop()
+	}
+	for p := range acked {
+		p.errors = 0
+		p.active = true
+	}
+
+	s.peerRwnd = int(sack.AdvertisedReceiverWindow()) - s.flightSize()
+	if s.peerRwnd < 0 {
+		s.peerRwnd = 0
+	}
+
+	// The FORWARD TSN is sent again if the peer didn't get it (RFC 3758
+	// section 3.5 rule C3).
+	if a.prEnabled() {
+		s.advancePeerAckPoint()
+		if s.cumTSNAck.LessThan(s.advancedPeerAckPoint) {
+			s.forwardTSN = true
+		}
+	}
+}
+
+// handleCumulativeAck handles the cumulative TSN ack of a SHUTDOWN chunk.
+func (s *sender) handleCumulativeAck(cum seqnum.Value) {
+	if !s.cumTSNAck.LessThan(cum) || !cum.LessThan(s.nextTSN) {
+		return
+	}
+	s.ackCumulative(cum, make(map[*path]int), time.Now())
+	s.t3.stop()
+}
+
+// ackCumulative removes the chunks up to cum from the queue.
+func (s *sender) ackCumulative(cum seqnum.Value, acked map[*path]int, now time.Time) {
+	n := 0
+	for n < len(s.chunks) && s.chunks[n].tsn.LessThanEq(cum) {
+		c := s.chunks[n]
+		if !c.acked {
+			s.ackChunk(c, acked, now)
+		}
+		s.chunkDone(c)
+		s.chunks[n] = nil
+		n++
+	}
+	s.chunks = s.chunks[n:]
+	s.nextSend -= n
+	if s.nextSend < 0 {
+		s.nextSend = 0
+	}
+	s.cumTSNAck = cum
+	if s.advancedPeerAckPoint.LessThan(cum) {
+		s.advancedPeerAckPoint = cum
+	}
+}
+
+// ackChunk records that c was newly acknowledged.
+func (s *sender) ackChunk(c *dataChunk, acked map[*path]int, now time.Time) {
+	c.acked = true
+	c.rtx = false
+	if c.inFlight {
+		c.inFlight = false
+		c.path.flightSize -= len(c.data)
+		acked[c.path] += len(c.data)
+	}
+	if c == s.rttChunk {
+		if c.sendCount == 1 {
+			c.path.updateRTT(now.Sub(c.sentAt), s.a.ep.rtoInfo.Min, s.a.ep.rtoInfo.Max)
+		}
+		s.rttChunk = nil
+	}
+}
+
+// chunkDone releases c from its message, and the message from the send
+// buffer once all its chunks are done.
+func (s *sender) chunkDone(c *dataChunk) {
+	if c.done {
+		return
+	}
+	c.done = true
+	c.msg.chunks--
+	if c.msg.chunks == 0 {
+		s.a.ep.releaseSndBufLocked(c.msg.size)
+	}
+}
+
+// abandon abandons the chunks of msg that weren't acknowledged yet (RFC 3758
+// section 3.5).
+func (s *sender) abandon(msg *sndMessage) {
+	if msg.abandoned {
+		return
+	}
+	msg.abandoned = true
+	s.a.ep.stack.Stats().SCTP.AbandonedMessages.Increment()
+	for _, c := range s.chunks {
+		if c.msg != msg || c.done {
+			continue
+		}
+		if c.inFlight {
+			c.inFlight = false
+			c.path.flightSize -= len(c.data)
+		}
+		c.rtx = false
+		c.abandoned = true
+		s.chunkDone(c)
+	}
+}
+
+// abandonExpired abandons the messages whose lifetime expired, and schedules
+// a FORWARD TSN if it lets the peer skip TSNs.
+func (s *sender) abandonExpired(now time.Time) {
+	if !s.a.prEnabled() {
+		return
+	}
+	for _, c := range s.chunks {
+		if !c.done && !c.msg.expire.IsZero() && now.After(c.msg.expire) {
+			s.abandon(c.msg)
+		}
+	}
+	if old := s.advancedPeerAckPoint; s.advancePeerAckPoint() != old {
+		s.forwardTSN = true
+	}
+}
+
+// advancePeerAckPoint advances the advanced peer ack point over abandoned
+// chunks (RFC 3758 section 3.5 rule C2), and returns it.
+func (s *sender) advancePeerAckPoint() seqnum.Value {
+	if s.advancedPeerAckPoint.LessThan(s.cumTSNAck) {
+		s.advancedPeerAckPoint = s.cumTSNAck
+	}
+	for _, c := range s.chunks {
+		if c.tsn.LessThanEq(s.advancedPeerAckPoint) {
+			continue
+		}
+		if c.tsn != s.advancedPeerAckPoint+1 || !c.abandoned {
+			break
+		}
+		s.advancedPeerAckPoint = c.tsn
+	}
+	return s.advancedPeerAckPoint
+}
+
+// forwardTSNChunk returns an encoded FORWARD TSN chunk that moves the
+// cumulative TSN of the peer to the advanced peer ack point.
+func (s *sender) forwardTSNChunk() []byte {
+	var streams []header.SCTPForwardTSNStream
+	for _, c := range s.chunks {
+		if s.advancedPeerAckPoint.LessThan(c.tsn) {
+			break
+		}
+		if c.flags&header.SCTPFlagUnordered == 0 {
+			streams = []header.SCTPForwardTSNStream{{StreamSequenceNumber: c.ssn}}
+		}
+	}
+	v := header.EncodeSCTPForwardTSN(uint32(s.advancedPeerAckPoint), streams)
+	return header.SCTPAppendChunk(nil, header.SCTPChunkForwardTSN, 0, v)
+}
+
+// close releases the chunks of the sender.
+func (s *sender) close() {
+	s.t3.stop()
+	for _, c := range s.chunks {
+		s.chunkDone(c)
+	}
+	s.chunks = nil
+	s.nextSend = 0
+}
@@ -95,6 +95,27 @@ type listenContext struct {
 	hasher   hash.Hash
 	v6only   bool
 	netProto tcpip.NetworkProtocolNumber
+
+	// bindToDevice is the listening endpoint's BindToDeviceOption NIC,
+	// inherited by the endpoints it creates.
+	bindToDevice tcpip.NICID
+
+	// listenerHooks are the hooks of a listening endpoint of multipath
+	// TCP, which create the hooks of the subflows it accepts.
+	listenerHooks ListenerHooks
+
+	// md5 holds the MD5 signature keys of a listening endpoint. The key
+	// for the peer, if any, is inherited by the endpoints it creates.
+	md5 *md5Keys
+}
+
+// md5Key returns the key of the listening endpoint for the peer at addr, or
+// nil if there's none.
+func (l *listenContext) md5Key(addr tcpip.Address) []byte {
+	if l.md5 == nil {
+		return nil
+	}
+	return l.md5.lookup(addr)
 }
 
 // timeStamp returns an 8-bit timestamp with a granularity of 64 seconds.
@@ -197,7 +218,7 @@ func (l *listenContext) isCookieValid(id stack.TransportEndpointID, cookie seqnu
 
 // createConnectedEndpoint creates a new connected endpoint, with the connection
 // parameters given by the arguments.
-func (l *listenContext) createConnectedEndpoint(s *segment, iss seqnum.Value, irs seqnum.Value, rcvdSynOpts *header.TCPSynOptions) (*endpoint, *tcpip.Error) {
+func (l *listenContext) createConnectedEndpoint(s *segment, iss seqnum.Value, irs seqnum.Value, rcvdSynOpts *header.TCPSynOptions, hooks SubflowHooks) (*endpoint, *tcpip.Error) {
 	// Create a new endpoint.
 	netProto := l.netProto
 	if netProto == 0 {
@@ -207,9 +228,14 @@ func (l *listenContext) createConnectedEndpoint(s *segment, iss seqnum.Value, ir
 	n.v6only = l.v6only
 	n.id = s.id
 	n.boundNICID = s.route.NICID()
+	n.bindToDevice = l.bindToDevice
 	n.route = s.route.Clone()
 	n.effectiveNetProtos = []tcpip.NetworkProtocolNumber{s.route.NetProto}
 	n.rcvBufSize = int(l.rcvWnd)
+	n.subflow = hooks
+	if key := l.md5Key(s.id.RemoteAddress); key != nil {
+		n.md5.set(s.id.RemoteAddress, len(s.id.RemoteAddress)*8, key)
+	}
 
 	n.maybeEnableTimestamp(rcvdSynOpts)
 	n.maybeEnableSACKPermitted(rcvdSynOpts)
@@ -241,7 +267,11 @@ func (l *listenContext) createEndpointAndPerformHandshake(s *segment, opts *head
 	// Create new endpoint.
 	irs := s.sequenceNumber
 	cookie := l.createCookie(s.id, irs, encodeMSS(opts.MSS))
-	ep, err := l.createConnectedEndpoint(s, cookie, irs, opts)
+	hooks, err := l.newSubflow(s, true)
+	if err != nil {
+		return nil, err
+	}
+	ep, err := l.createConnectedEndpoint(s, cookie, irs, opts, hooks)
 	if err != nil {
 		return nil, err
 	}
@@ -263,10 +293,40 @@ func (l *listenContext) createEndpointAndPerformHandshake(s *segment, opts *head
 	return ep, nil
 }
 
+// newSubflow returns the hooks of the multipath TCP subflow created for the
+// provided SYN segment, or for the ACK completing a SYN cookie handshake if
+// syn isn't set, or nil if the listener isn't one of multipath TCP. Subflows
+// established with SYN cookies fall back to TCP, as their SYN options are
+// lost. The segment is answered with a RST if the subflow is rejected.
+func (l *listenContext) newSubflow(s *segment, syn bool) (SubflowHooks, *tcpip.Error) {
+	if l.listenerHooks == nil {
+		return nil, nil
+	}
+	var opts header.MPTCPOptions
+	if syn {
+		opts = header.ParseMPTCPOptions(s.options, true, false)
+	}
+	hooks, err := l.listenerHooks.NewSubflow(s.id, s.route.NICID(), &opts)
+	if err != nil {
+		replyWithReset(s)
+		return nil, err
+	}
+	return hooks, nil
+}
+
 // deliverAccepted delivers the newly-accepted endpoint to the listener. If the
 // endpoint has transitioned out of the listen state, the new endpoint is closed
-// instead.
+// instead. Subflows joining an existing multipath TCP connection are started
+// rather than delivered.
 func (e *endpoint) deliverAccepted(n *endpoint) {
+	if n.subflow != nil {
+		wq := &waiter.Queue{}
+		if n.subflow.Attach(n, wq) {
+			n.startAcceptedLoop(wq)
+			return
+		}
+	}
+
 	e.mu.RLock()
 	if e.state == stateListen {
 		e.acceptedChan <- n
@@ -317,7 +377,7 @@ func (e *endpoint) handleListenSegment(ctx *listenContext, s *segment) {
 				TSVal: tcpTimeStamp(timeStampOffset()),
 				TSEcr: opts.TSVal,
 			}
-			sendSynTCP(&s.route, s.id, header.TCPFlagSyn|header.TCPFlagAck, cookie, s.sequenceNumber+1, ctx.rcvWnd, synOpts)
+			sendSynTCP(&s.route, s.id, header.TCPFlagSyn|header.TCPFlagAck, cookie, s.sequenceNumber+1, ctx.rcvWnd, synOpts, nil /* mptcp */, ctx.md5Key(s.id.RemoteAddress))
 		}
 
 	case header.TCPFlagAck:
@@ -338,7 +398,18 @@ func (e *endpoint) handleListenSegment(ctx *listenContext, s *segment) {
 				rcvdSynOptions.TSVal = s.parsedOptions.TSVal
 				rcvdSynOptions.TSEcr = s.parsedOptions.TSEcr
 			}
-			n, err := ctx.createConnectedEndpoint(s, s.ackNumber-1, s.sequenceNumber-1, rcvdSynOptions)
+			hooks, err := ctx.newSubflow(s, false)
+			if err != nil {
+				return
+			}
+			if hooks != nil {
+				var opts header.MPTCPOptions
+				if err := hooks.HandleAck(s.ackNumber-1, s.sequenceNumber-1, &opts); err != nil {
+					replyWithReset(s)
+					return
+				}
+			}
+			n, err := ctx.createConnectedEndpoint(s, s.ackNumber-1, s.sequenceNumber-1, rcvdSynOptions, hooks)
 			if err == nil {
 				// clear the tsOffset for the newly created
 				// endpoint as the Timestamp was already
@@ -375,9 +446,13 @@ func (e *endpoint) protocolListenLoop(rcvWnd seqnum.Size) *tcpip.Error {
 
 	e.mu.Lock()
 	v6only := e.v6only
+	bindToDevice := e.bindToDevice
 	e.mu.Unlock()
 
 	ctx := newListenContext(e.stack, rcvWnd, v6only, e.netProto)
+	ctx.bindToDevice = bindToDevice
+	ctx.listenerHooks = e.listenerHooks
+	ctx.md5 = &e.md5
 
 	s := sleep.Sleeper{}
 	s.AddWaker(&e.notificationWaker, wakerForNotification)
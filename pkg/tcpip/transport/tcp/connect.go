@@ -16,6 +16,7 @@ package tcp
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"gvisor.googlesource.com/gvisor/pkg/rand"
@@ -208,6 +209,13 @@ func (h *handshake) synSentState(s *segment) *tcpip.Error {
 	// If this is a SYN ACK response, we only need to acknowledge the SYN
 	// and the handshake is completed.
 	if s.flagIsSet(header.TCPFlagAck) {
+		if h.ep.subflow != nil {
+			opts := header.ParseMPTCPOptions(s.options, true, true)
+			if err := h.ep.subflow.HandleSynAck(h.iss, s.sequenceNumber, &opts); err != nil {
+				h.ep.sendRaw(buffer.VectorisedView{}, header.TCPFlagRst|header.TCPFlagAck, h.iss+1, h.ackNum, 0)
+				return err
+			}
+		}
 		h.state = handshakeCompleted
 		h.ep.sendRaw(buffer.VectorisedView{}, header.TCPFlagAck, h.iss+1, h.ackNum, h.rcvWnd>>h.effectiveRcvWndScale())
 		return nil
@@ -228,7 +236,7 @@ func (h *handshake) synSentState(s *segment) *tcpip.Error {
 		// this is the behaviour implemented by Linux.
 		SACKPermitted: rcvSynOpts.SACKPermitted,
 	}
-	sendSynTCP(&s.route, h.ep.id, h.flags, h.iss, h.ackNum, h.rcvWnd, synOpts)
+	h.sendSyn(&s.route, synOpts)
 
 	return nil
 }
@@ -272,7 +280,7 @@ func (h *handshake) synRcvdState(s *segment) *tcpip.Error {
 			TSEcr:         h.ep.recentTS,
 			SACKPermitted: h.ep.sackPermitted,
 		}
-		sendSynTCP(&s.route, h.ep.id, h.flags, h.iss, h.ackNum, h.rcvWnd, synOpts)
+		h.sendSyn(&s.route, synOpts)
 		return nil
 	}
 
@@ -292,6 +300,14 @@ func (h *handshake) synRcvdState(s *segment) *tcpip.Error {
 		if h.ep.sendTSOk && s.parsedOptions.TS {
 			h.ep.updateRecentTimestamp(s.parsedOptions.TSVal, h.ackNum, s.sequenceNumber)
 		}
+
+		if h.ep.subflow != nil {
+			opts := header.ParseMPTCPOptions(s.options, false, true)
+			if err := h.ep.subflow.HandleAck(h.iss, h.ackNum-1, &opts); err != nil {
+				h.ep.sendRaw(buffer.VectorisedView{}, header.TCPFlagRst|header.TCPFlagAck, s.ackNumber, h.ackNum, 0)
+				return err
+			}
+		}
 		h.state = handshakeCompleted
 		return nil
 	}
@@ -429,7 +445,7 @@ func (h *handshake) execute() *tcpip.Error {
 		synOpts.TS = h.ep.sendTSOk
 		synOpts.SACKPermitted = h.ep.sackPermitted && bool(sackEnabled)
 	}
-	sendSynTCP(&h.ep.route, h.ep.id, h.flags, h.iss, h.ackNum, h.rcvWnd, synOpts)
+	h.sendSyn(&h.ep.route, synOpts)
 	for h.state != handshakeCompleted {
 		switch index, _ := s.Fetch(true); index {
 		case wakerForResend:
@@ -438,13 +454,20 @@ func (h *handshake) execute() *tcpip.Error {
 				return tcpip.ErrTimeout
 			}
 			rt.Reset(timeOut)
-			sendSynTCP(&h.ep.route, h.ep.id, h.flags, h.iss, h.ackNum, h.rcvWnd, synOpts)
+			h.sendSyn(&h.ep.route, synOpts)
 
 		case wakerForNotification:
 			n := h.ep.fetchNotifications()
 			if n&notifyClose != 0 {
 				return tcpip.ErrAborted
 			}
+			if n&notifyICMPError != 0 {
+				// Like Linux, give up on the connection when
+				// its SYN is reported unreachable.
+				if err := h.ep.fetchICMPError(); err != nil {
+					return err
+				}
+			}
 			if n&notifyDrain != 0 {
 				for !h.ep.segmentQueue.empty() {
 					s := h.ep.segmentQueue.dequeue()
@@ -471,6 +494,18 @@ func (h *handshake) execute() *tcpip.Error {
 	return nil
 }
 
+// sendSyn sends the SYN or SYN-ACK segment of the handshake with the provided
+// options, along with the MPTCP options of subflows.
+func (h *handshake) sendSyn(r *stack.Route, synOpts header.TCPSynOptions) *tcpip.Error {
+	mptcp := h.ep.subflowSynOptions(h.flags&header.TCPFlagAck != 0)
+	err := sendSynTCP(r, h.ep.id, h.flags, h.iss, h.ackNum, h.rcvWnd, synOpts, mptcp, h.ep.md5Key())
+	atomic.AddUint64(&h.ep.segsOut, 1)
+	if mptcp != nil {
+		putOptions(mptcp)
+	}
+	return err
+}
+
 func parseSynSegmentOptions(s *segment) header.TCPSynOptions {
 	synOpts := header.ParseSynOptions(s.options, s.flagIsSet(header.TCPFlagAck))
 	if synOpts.TS {
@@ -495,7 +530,7 @@ func putOptions(options []byte) {
 	optionPool.Put(options[0:cap(options)])
 }
 
-func makeSynOptions(opts header.TCPSynOptions) []byte {
+func makeSynOptions(opts header.TCPSynOptions, md5 bool, mptcp []byte) []byte {
 	// Emulate linux option order. This is as follows:
 	//
 	// if md5: NOP NOP MD5SIG 18 md5sig(16)
@@ -513,9 +548,16 @@ func makeSynOptions(opts header.TCPSynOptions) []byte {
 	//	cookie(variable) [padding to four bytes]
 	//
 	options := getOptions()
+	offset := 0
+
+	if md5 {
+		offset += header.EncodeNOP(options[offset:])
+		offset += header.EncodeNOP(options[offset:])
+		offset += header.EncodeMD5Option(options[offset:])
+	}
 
 	// Always encode the mss.
-	offset := header.EncodeMSSOption(uint32(opts.MSS), options)
+	offset += header.EncodeMSSOption(uint32(opts.MSS), options[offset:])
 
 	// Special ordering is required here. If both TS and SACK are enabled,
 	// then the SACK option precedes TS, with no padding. If they are
@@ -539,6 +581,12 @@ func makeSynOptions(opts header.TCPSynOptions) []byte {
 		offset += header.EncodeWSOption(opts.WS, options[offset:])
 	}
 
+	// Linux places the MPTCP options last. They are all 4-byte aligned
+	// in SYN segments.
+	if offset+len(mptcp) <= len(options) {
+		offset += copy(options[offset:], mptcp)
+	}
+
 	// Padding to the end; note that this never apply unless we add a
 	// fastopen option, we always expect the offset to remain the same.
 	if delta := header.AddTCPOptionPadding(options, offset); delta != 0 {
@@ -548,7 +596,7 @@ func makeSynOptions(opts header.TCPSynOptions) []byte {
 	return options[:offset]
 }
 
-func sendSynTCP(r *stack.Route, id stack.TransportEndpointID, flags byte, seq, ack seqnum.Value, rcvWnd seqnum.Size, opts header.TCPSynOptions) *tcpip.Error {
+func sendSynTCP(r *stack.Route, id stack.TransportEndpointID, flags byte, seq, ack seqnum.Value, rcvWnd seqnum.Size, opts header.TCPSynOptions, mptcp, md5Key []byte) *tcpip.Error {
 	// The MSS in opts is automatically calculated as this function is
 	// called from many places and we don't want every call point being
 	// embedded with the MSS calculation.
@@ -556,15 +604,16 @@ func sendSynTCP(r *stack.Route, id stack.TransportEndpointID, flags byte, seq, a
 		opts.MSS = uint16(r.MTU() - header.TCPMinimumSize)
 	}
 
-	options := makeSynOptions(opts)
-	err := sendTCP(r, id, buffer.VectorisedView{}, r.DefaultTTL(), flags, seq, ack, rcvWnd, options, nil)
+	options := makeSynOptions(opts, md5Key != nil, mptcp)
+	err := sendTCP(r, id, buffer.VectorisedView{}, r.DefaultTTL(), flags, seq, ack, rcvWnd, options, nil, md5Key)
 	putOptions(options)
 	return err
 }
 
 // sendTCP sends a TCP segment with the provided options via the provided
-// network endpoint and under the provided identity.
-func sendTCP(r *stack.Route, id stack.TransportEndpointID, data buffer.VectorisedView, ttl uint8, flags byte, seq, ack seqnum.Value, rcvWnd seqnum.Size, opts []byte, gso *stack.GSO) *tcpip.Error {
+// network endpoint and under the provided identity. If md5Key isn't nil, the
+// MD5 signature option in opts is filled in with it.
+func sendTCP(r *stack.Route, id stack.TransportEndpointID, data buffer.VectorisedView, ttl uint8, flags byte, seq, ack seqnum.Value, rcvWnd seqnum.Size, opts []byte, gso *stack.GSO, md5Key []byte) *tcpip.Error {
 	optLen := len(opts)
 	// Allocate a buffer for the TCP header.
 	hdr := buffer.NewPrependable(header.TCPMinimumSize + int(r.MaxHeaderLength()) + optLen)
@@ -585,6 +634,9 @@ func sendTCP(r *stack.Route, id stack.TransportEndpointID, data buffer.Vectorise
 		WindowSize: uint16(rcvWnd),
 	})
 	copy(tcp[header.TCPMinimumSize:], opts)
+	if md5Key != nil {
+		signMD5(r.LocalAddress, r.RemoteAddress, tcp, data, md5Key)
+	}
 
 	length := uint16(hdr.UsedLength() + data.Size())
 	xsum := r.PseudoHeaderChecksum(ProtocolNumber, length)
@@ -608,14 +660,21 @@ func sendTCP(r *stack.Route, id stack.TransportEndpointID, data buffer.Vectorise
 	return r.WritePacket(gso, hdr, data, ProtocolNumber, ttl)
 }
 
-// makeOptions makes an options slice.
-func (e *endpoint) makeOptions(sackBlocks []header.SACKBlock) []byte {
+// makeOptions makes an options slice. md5 reserves room for the MD5 signature
+// option and mptcp holds the MPTCP options of subflows; SACK blocks are
+// dropped as needed to make room for them.
+func (e *endpoint) makeOptions(sackBlocks []header.SACKBlock, md5 bool, mptcp []byte) []byte {
 	options := getOptions()
 	offset := 0
 
 	// N.B. the ordering here matches the ordering used by Linux internally
 	// and described in the raw makeOptions function. We don't include
 	// unnecessary cases here (post connection.)
+	if md5 {
+		offset += header.EncodeNOP(options[offset:])
+		offset += header.EncodeNOP(options[offset:])
+		offset += header.EncodeMD5Option(options[offset:])
+	}
 	if e.sendTSOk {
 		// Embed the timestamp if timestamp has been enabled.
 		//
@@ -633,6 +692,18 @@ func (e *endpoint) makeOptions(sackBlocks []header.SACKBlock) []byte {
 		offset += header.EncodeNOP(options[offset:])
 		offset += header.EncodeTSOption(e.timestamp(), uint32(e.recentTS), options[offset:])
 	}
+	if len(mptcp) > 0 {
+		for i := -len(mptcp) & 3; i > 0; i-- {
+			offset += header.EncodeNOP(options[offset:])
+		}
+		offset += copy(options[offset:], mptcp)
+	}
+	if max := (len(options) - offset - 4) / 8; len(sackBlocks) > max {
+		if max < 0 {
+			max = 0
+		}
+		sackBlocks = sackBlocks[:max]
+	}
 	if e.sackPermitted && len(sackBlocks) > 0 {
 		offset += header.EncodeNOP(options[offset:])
 		offset += header.EncodeNOP(options[offset:])
@@ -653,8 +724,26 @@ func (e *endpoint) sendRaw(data buffer.VectorisedView, flags byte, seq, ack seqn
 	if e.state == stateConnected && e.rcv.pendingBufSize > 0 && (flags&header.TCPFlagAck != 0) {
 		sackBlocks = e.sack.Blocks[:e.sack.NumBlocks]
 	}
-	options := e.makeOptions(sackBlocks)
-	err := sendTCP(&e.route, e.id, data, e.route.DefaultTTL(), flags, seq, ack, rcvWnd, options, e.gso)
+	md5Key := e.md5Key()
+	var mptcp []byte
+	if e.subflow != nil && flags&header.TCPFlagRst == 0 {
+		// The MPTCP options share the option space with the
+		// timestamp option, which takes 12 bytes with its padding,
+		// and the MD5 signature option, which takes 20.
+		room := header.TCPOptionsMaximumSize
+		if e.sendTSOk {
+			room -= 12
+		}
+		if md5Key != nil {
+			room -= 2 + header.TCPMD5OptionSize
+		}
+		mptcp = getOptions()
+		mptcp = mptcp[:e.subflow.Options(mptcp[:room], seq, data.Size(), flags)]
+		defer putOptions(mptcp)
+	}
+	options := e.makeOptions(sackBlocks, md5Key != nil, mptcp)
+	err := sendTCP(&e.route, e.id, data, e.route.DefaultTTL(), flags, seq, ack, rcvWnd, options, e.gso, md5Key)
+	atomic.AddUint64(&e.segsOut, 1)
 	putOptions(options)
 	return err
 }
@@ -746,6 +835,13 @@ func (e *endpoint) handleSegments() *tcpip.Error {
 			// send window scale.
 			s.window <<= e.snd.sndWndScale
 
+			// The MPTCP options of subflows map the data of the
+			// segment, so they're handled first.
+			if e.subflow != nil {
+				opts := header.ParseMPTCPOptions(s.options, false, true)
+				e.subflow.HandleSegment(s.ackNumber, &opts)
+			}
+
 			// RFC 793, page 41 states that "once in the ESTABLISHED
 			// state all segments must carry current acknowledgment
 			// information."
@@ -847,8 +943,16 @@ func (e *endpoint) protocolMainLoop(handshake bool) *tcpip.Error {
 			close(e.drainDone)
 		}
 
+		hardError := e.hardError
+		if e.state != stateError {
+			hardError = nil
+		}
 		e.mu.Unlock()
 
+		if e.subflow != nil {
+			e.subflow.Closed(hardError)
+		}
+
 		// When the protocol loop exits we should wake up our waiters.
 		e.waiterQueue.Notify(waiter.EventHUp | waiter.EventErr | waiter.EventIn | waiter.EventOut)
 	}
@@ -961,6 +1065,22 @@ func (e *endpoint) protocolMainLoop(handshake bool) *tcpip.Error {
 					e.resetConnectionLocked(tcpip.ErrConnectionAborted)
 					e.mu.Unlock()
 				}
+
+				if n&notifyICMPError != 0 {
+					// Errors on an established connection are
+					// only reported when asked for; they're
+					// otherwise soft errors that Linux only
+					// reports on timeout.
+					e.mu.RLock()
+					recvErr := e.recvErr
+					e.mu.RUnlock()
+					if err := e.fetchICMPError(); err != nil && recvErr {
+						e.lastErrorMu.Lock()
+						e.lastError = err
+						e.lastErrorMu.Unlock()
+						e.waiterQueue.Notify(waiter.EventErr)
+					}
+				}
 				if n&notifyClose != 0 && closeTimer == nil {
 					// Reset the connection 3 seconds after
 					// the endpoint has been closed.
@@ -974,6 +1094,10 @@ func (e *endpoint) protocolMainLoop(handshake bool) *tcpip.Error {
 					})
 				}
 
+				if n&notifySubflowSignal != 0 {
+					e.snd.sendAck()
+				}
+
 				if n&notifyKeepaliveChanged != 0 {
 					// The timer could fire in background
 					// when the endpoint is drained. That's
@@ -1028,6 +1152,7 @@ func (e *endpoint) protocolMainLoop(handshake bool) *tcpip.Error {
 	// Main loop. Handle segments until both send and receive ends of the
 	// connection have completed.
 	for !e.rcv.closed || !e.snd.closed || e.snd.sndUna != e.snd.sndNxtList {
+		e.updateInfo()
 		e.workMu.Unlock()
 		v, _ := s.Fetch(true)
 		e.workMu.Lock()
@@ -1042,6 +1167,7 @@ func (e *endpoint) protocolMainLoop(handshake bool) *tcpip.Error {
 	}
 
 	// Mark endpoint as closed.
+	e.updateInfo()
 	e.mu.Lock()
 	if e.state != stateError {
 		e.state = stateClosed
@@ -53,6 +53,8 @@ const (
 	notifyDrain
 	notifyReset
 	notifyKeepaliveChanged
+	notifySubflowSignal
+	notifyICMPError
 )
 
 // SACKInfo holds TCP SACK related information for a given endpoint.
@@ -121,6 +123,15 @@ type endpoint struct {
 	// disabling SO_BROADCAST, albeit as a NOOP.
 	broadcast bool
 
+	// recvErr is set by RecvErrOption. When set, the errors reported by
+	// ICMP on an established connection are reported immediately, as
+	// Linux's IP_RECVERR does.
+	recvErr bool
+
+	// bindToDevice is the NIC set by BindToDeviceOption, or 0 if there is
+	// none.
+	bindToDevice tcpip.NICID
+
 	// effectiveNetProtos contains the network protocols actually in use. In
 	// most cases it will only contain "netProto", but in cases like IPv6
 	// endpoints with v6only set to false, this could include multiple
@@ -217,6 +228,16 @@ type endpoint struct {
 	// this endpoint.
 	cc CongestionControlOption
 
+	// mtuProbing is the path MTU probing mode of this endpoint.
+	mtuProbing MTUProbingOption
+
+	// recovery is the set of loss recovery mechanisms this endpoint uses.
+	recovery RecoveryOption
+
+	// md5 holds the keys used to sign and verify segments with the TCP MD5
+	// signature option.
+	md5 md5Keys
+
 	// The following are used when a "packet too big" control packet is
 	// received. They are protected by sndBufMu. They are used to
 	// communicate to the main protocol goroutine how many such control
@@ -225,6 +246,11 @@ type endpoint struct {
 	packetTooBigCount int
 	sndMTU            int
 
+	// icmpError is the last error reported by an ICMP unreachable message,
+	// which is passed to the main protocol goroutine. It's protected by
+	// sndBufMu.
+	icmpError *tcpip.Error `state:"nosave"`
+
 	// newSegmentWaker is used to indicate to the protocol goroutine that
 	// it needs to wake up and handle new segments queued to it.
 	newSegmentWaker sleep.Waker `state:"manual"`
@@ -253,6 +279,17 @@ type endpoint struct {
 	rcv *receiver `state:"wait"`
 	snd *sender   `state:"wait"`
 
+	// segsIn and segsOut are the number of segments received and sent by
+	// the endpoint. They must be accessed atomically.
+	segsIn  uint64
+	segsOut uint64
+
+	// info is the state of the connection reported by TCP_INFO, published
+	// by the goroutine doing the protocol work; access to it is protected
+	// by infoMu.
+	infoMu sync.Mutex          `state:"nosave"`
+	info   tcpip.TCPInfoOption `state:"nosave"`
+
 	// The goroutine drain completion notification channel.
 	drainDone chan struct{} `state:"nosave"`
 
@@ -268,6 +305,12 @@ type endpoint struct {
 	connectingAddress tcpip.Address
 
 	gso *stack.GSO
+
+	// subflow holds the hooks of multipath TCP if the endpoint is one of
+	// its subflows, and listenerHooks the hooks that create the subflows
+	// of a listening endpoint. Multipath TCP connections aren't saved.
+	subflow       SubflowHooks  `state:"nosave"`
+	listenerHooks ListenerHooks `state:"nosave"`
 }
 
 // StopWork halts packet processing. Only to be used in tests.
@@ -327,6 +370,16 @@ func newEndpoint(stack *stack.Stack, netProto tcpip.NetworkProtocolNumber, waite
 		e.cc = cs
 	}
 
+	var mp MTUProbingOption
+	if err := stack.TransportProtocolOption(ProtocolNumber, &mp); err == nil {
+		e.mtuProbing = mp
+	}
+
+	var ro RecoveryOption
+	if err := stack.TransportProtocolOption(ProtocolNumber, &ro); err == nil {
+		e.recovery = ro
+	}
+
 	if p := stack.GetTCPProbe(); p != nil {
 		e.probe = p
 	}
@@ -363,6 +416,15 @@ func (e *endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
 		}
 
 	case stateConnected:
+		// Determine if there's an error to report if requested.
+		if (mask & waiter.EventErr) != 0 {
+			e.lastErrorMu.Lock()
+			if e.lastError != nil {
+				result |= waiter.EventErr
+			}
+			e.lastErrorMu.Unlock()
+		}
+
 		// Determine if the endpoint is writable if requested.
 		if (mask & waiter.EventOut) != 0 {
 			e.sndBufMu.Lock()
@@ -591,6 +653,7 @@ func (e *endpoint) Write(p tcpip.Payload, opts tcpip.WriteOptions) (uintptr, <-c
 	if e.workMu.TryLock() {
 		// Do the work inline.
 		e.handleWrite()
+		e.updateInfo()
 		e.workMu.Unlock()
 	} else {
 		// Let the protocol goroutine do the work.
@@ -822,12 +885,40 @@ func (e *endpoint) SetSockOpt(opt interface{}) *tcpip.Error {
 		e.notifyProtocolGoroutine(notifyKeepaliveChanged)
 		return nil
 
+	case tcpip.TCPMD5SigOption:
+		if v.PrefixLen < 0 || v.PrefixLen > len(v.Addr)*8 {
+			return tcpip.ErrInvalidOptionValue
+		}
+		e.md5.set(v.Addr, v.PrefixLen, v.Key)
+		return nil
+
 	case tcpip.BroadcastOption:
 		e.mu.Lock()
 		e.broadcast = v != 0
 		e.mu.Unlock()
 		return nil
 
+	case tcpip.RecvErrOption:
+		e.mu.Lock()
+		e.recvErr = v != 0
+		e.mu.Unlock()
+		return nil
+
+	case tcpip.BindToDeviceOption:
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		if v == "" {
+			e.bindToDevice = 0
+			return nil
+		}
+		nic := e.stack.FindNICByName(string(v))
+		if nic == 0 {
+			return tcpip.ErrUnknownDevice
+		}
+		e.bindToDevice = nic
+		return nil
+
 	default:
 		return nil
 	}
@@ -849,6 +940,23 @@ func (e *endpoint) readyReceiveSize() (int, *tcpip.Error) {
 	return e.rcvBufUsed, nil
 }
 
+// queuedSendSize returns the number of bytes written to the endpoint that the
+// peer hasn't acknowledged yet, whether they have been sent or not.
+func (e *endpoint) queuedSendSize() (int, *tcpip.Error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	// The endpoint cannot be in listen state.
+	if e.state == stateListen {
+		return 0, tcpip.ErrInvalidEndpointState
+	}
+
+	e.sndBufMu.Lock()
+	defer e.sndBufMu.Unlock()
+
+	return e.sndBufUsed, nil
+}
+
 // GetSockOpt implements tcpip.Endpoint.GetSockOpt.
 func (e *endpoint) GetSockOpt(opt interface{}) *tcpip.Error {
 	switch o := opt.(type) {
@@ -880,6 +988,28 @@ func (e *endpoint) GetSockOpt(opt interface{}) *tcpip.Error {
 		*o = tcpip.ReceiveQueueSizeOption(v)
 		return nil
 
+	case *tcpip.SendQueueSizeOption:
+		v, err := e.queuedSendSize()
+		if err != nil {
+			return err
+		}
+
+		*o = tcpip.SendQueueSizeOption(v)
+		return nil
+
+	case *tcpip.MemInfoOption:
+		e.rcvListMu.Lock()
+		o.RcvQueued = e.rcvBufUsed
+		o.RcvBufSize = e.rcvBufSize
+		e.rcvListMu.Unlock()
+
+		e.sndBufMu.Lock()
+		o.SndAlloc = 0
+		o.SndQueued = e.sndBufUsed
+		o.SndBufSize = e.sndBufSize
+		e.sndBufMu.Unlock()
+		return nil
+
 	case *tcpip.DelayOption:
 		*o = 0
 		if v := atomic.LoadUint32(&e.delay); v != 0 {
@@ -940,16 +1070,46 @@ func (e *endpoint) GetSockOpt(opt interface{}) *tcpip.Error {
 		return nil
 
 	case *tcpip.TCPInfoOption:
-		*o = tcpip.TCPInfoOption{}
+		e.infoMu.Lock()
+		*o = e.info
+		e.infoMu.Unlock()
+
 		e.mu.RLock()
 		snd := e.snd
+		switch e.state {
+		case stateListen:
+			o.State = tcpip.TCPStateListen
+		case stateConnecting:
+			o.State = tcpip.TCPStateSynSent
+		case stateConnected:
+			// The state is published by the protocol goroutine,
+			// which may not have run yet.
+			if o.State == 0 {
+				o.State = tcpip.TCPStateEstablished
+			}
+		default:
+			o.State = tcpip.TCPStateClose
+		}
 		e.mu.RUnlock()
+
 		if snd != nil {
 			snd.rtt.Lock()
 			o.RTT = snd.rtt.srtt
 			o.RTTVar = snd.rtt.rttvar
+			o.MinRTT = snd.rtt.minRTT
 			snd.rtt.Unlock()
 		}
+
+		e.sndBufMu.Lock()
+		o.NotSentBytes += int(e.sndBufInQueue)
+		e.sndBufMu.Unlock()
+
+		e.rcvListMu.Lock()
+		o.RcvSpace = e.rcvBufSize
+		e.rcvListMu.Unlock()
+
+		o.SegsIn = atomic.LoadUint64(&e.segsIn)
+		o.SegsOut = atomic.LoadUint64(&e.segsOut)
 		return nil
 
 	case *tcpip.KeepaliveEnabledOption:
@@ -986,6 +1146,17 @@ func (e *endpoint) GetSockOpt(opt interface{}) *tcpip.Error {
 		*o = 1
 		return nil
 
+	case *tcpip.RecvErrOption:
+		e.mu.RLock()
+		v := e.recvErr
+		e.mu.RUnlock()
+
+		*o = 0
+		if v {
+			*o = 1
+		}
+		return nil
+
 	case *tcpip.BroadcastOption:
 		e.mu.Lock()
 		v := e.broadcast
@@ -997,6 +1168,17 @@ func (e *endpoint) GetSockOpt(opt interface{}) *tcpip.Error {
 		}
 		return nil
 
+	case *tcpip.BindToDeviceOption:
+		e.mu.RLock()
+		nic := e.bindToDevice
+		e.mu.RUnlock()
+
+		*o = ""
+		if nic != 0 {
+			*o = tcpip.BindToDeviceOption(e.stack.NICName(nic))
+		}
+		return nil
+
 	default:
 		return tcpip.ErrUnknownProtocolOption
 	}
@@ -1071,6 +1253,17 @@ func (e *endpoint) connect(addr tcpip.FullAddress, handshake bool, run bool) (er
 	case stateInitial:
 		// Nothing to do. We'll eventually fill-in the gaps in the ID
 		// (if any) when we find a route.
+		if e.bindToDevice == 0 {
+			break
+		}
+
+		// Routes are restricted to the NIC given by
+		// BindToDeviceOption.
+		if nicid != 0 && nicid != e.bindToDevice {
+			return tcpip.ErrNoRoute
+		}
+
+		nicid = e.bindToDevice
 
 	case stateConnecting:
 		// A connection request has already been issued but hasn't
@@ -1369,6 +1562,16 @@ func (e *endpoint) Bind(addr tcpip.FullAddress) (err *tcpip.Error) {
 		}
 	}
 
+	// An endpoint restricted to a NIC by BindToDeviceOption may only bind
+	// to addresses on that NIC.
+	nicid := addr.NIC
+	if e.bindToDevice != 0 {
+		if nicid != 0 && nicid != e.bindToDevice {
+			return tcpip.ErrBadLocalAddress
+		}
+		nicid = e.bindToDevice
+	}
+
 	port, err := e.stack.ReservePort(netProtos, ProtocolNumber, addr.Addr, addr.Port, e.reusePort)
 	if err != nil {
 		return err
@@ -1392,8 +1595,9 @@ func (e *endpoint) Bind(addr tcpip.FullAddress) (err *tcpip.Error) {
 
 	// If an address is specified, we must ensure that it's one of our
 	// local addresses.
+	e.boundNICID = e.bindToDevice
 	if len(addr.Addr) != 0 {
-		nic := e.stack.CheckLocalAddress(addr.NIC, netProto, addr.Addr)
+		nic := e.stack.CheckLocalAddress(nicid, netProto, addr.Addr)
 		if nic == 0 {
 			return tcpip.ErrBadLocalAddress
 		}
@@ -1447,7 +1651,14 @@ func (e *endpoint) HandlePacket(r *stack.Route, id stack.TransportEndpointID, vv
 		return
 	}
 
+	if !e.checkMD5(s, header.TCP(vv.First()[:header.TCPMinimumSize+len(s.options)])) {
+		e.stack.Stats().TCP.MD5Failures.Increment()
+		s.decRef()
+		return
+	}
+
 	e.stack.Stats().TCP.ValidSegmentsReceived.Increment()
+	atomic.AddUint64(&e.segsIn, 1)
 	if (s.flags & header.TCPFlagRst) != 0 {
 		e.stack.Stats().TCP.ResetsReceived.Increment()
 	}
@@ -1474,9 +1685,36 @@ func (e *endpoint) HandleControlPacket(id stack.TransportEndpointID, typ stack.C
 		e.sndBufMu.Unlock()
 
 		e.notifyProtocolGoroutine(notifyMTUChanged)
+
+	case stack.ControlPortUnreachable:
+		e.setICMPError(tcpip.ErrConnectionRefused)
+
+	case stack.ControlNetworkUnreachable:
+		e.setICMPError(tcpip.ErrNetworkUnreachable)
+
+	case stack.ControlHostUnreachable:
+		e.setICMPError(tcpip.ErrNoRoute)
 	}
 }
 
+// setICMPError passes an error reported by ICMP to the protocol goroutine.
+func (e *endpoint) setICMPError(err *tcpip.Error) {
+	e.sndBufMu.Lock()
+	e.icmpError = err
+	e.sndBufMu.Unlock()
+
+	e.notifyProtocolGoroutine(notifyICMPError)
+}
+
+// fetchICMPError returns and clears the last error reported by ICMP.
+func (e *endpoint) fetchICMPError() *tcpip.Error {
+	e.sndBufMu.Lock()
+	err := e.icmpError
+	e.icmpError = nil
+	e.sndBufMu.Unlock()
+	return err
+}
+
 // updateSndBufferUsage is called by the protocol goroutine when room opens up
 // in the send buffer. The number of newly available bytes is v.
 func (e *endpoint) updateSndBufferUsage(v int) {
@@ -1498,6 +1736,16 @@ func (e *endpoint) updateSndBufferUsage(v int) {
 // to be read, or when the connection is closed for receiving (in which case
 // s will be nil).
 func (e *endpoint) readyToRead(s *segment) {
+	if e.subflow != nil {
+		// The data of subflows is read from their connection.
+		if s != nil {
+			e.subflow.Deliver(s.sequenceNumber, s.data, false)
+		} else {
+			e.subflow.Deliver(e.rcv.rcvNxt, buffer.VectorisedView{}, true)
+		}
+		return
+	}
+
 	e.rcvListMu.Lock()
 	if s != nil {
 		s.incRef()
@@ -1514,6 +1762,10 @@ func (e *endpoint) readyToRead(s *segment) {
 // receiveBufferAvailable calculates how many bytes are still available in the
 // receive buffer.
 func (e *endpoint) receiveBufferAvailable() int {
+	if e.subflow != nil {
+		return e.subflow.ReceiveBufferAvailable()
+	}
+
 	e.rcvListMu.Lock()
 	size := e.rcvBufSize
 	used := e.rcvBufUsed
@@ -1604,13 +1856,106 @@ func (e *endpoint) maybeEnableSACKPermitted(synOpts *header.TCPSynOptions) {
 // maxOptionSize return the maximum size of TCP options.
 func (e *endpoint) maxOptionSize() (size int) {
 	var maxSackBlocks [header.TCPMaxSACKBlocks]header.SACKBlock
-	options := e.makeOptions(maxSackBlocks[:])
+	var mptcp []byte
+	if e.subflow != nil {
+		mptcp = make([]byte, header.MPTCPDSSMaximumLength)
+	}
+	options := e.makeOptions(maxSackBlocks[:], e.md5Key() != nil, mptcp)
 	size = len(options)
 	putOptions(options)
 
 	return size
 }
 
+// updateInfo publishes the state of the connection reported by TCP_INFO. It
+// must be called with workMu held once the connection is established.
+func (e *endpoint) updateInfo() {
+	s, r := e.snd, e.rcv
+	info := tcpip.TCPInfoOption{
+		State:              e.connectedState(),
+		CAState:            s.caState(),
+		Timeouts:           s.timeouts,
+		TimestampsEnabled:  e.sendTSOk,
+		SACKPermitted:      e.sackPermitted,
+		WindowScaleEnabled: s.wndScaleOK,
+		SndWndScale:        s.sndWndScale,
+		RcvWndScale:        r.rcvWndScale,
+		RTO:                s.rto,
+		SndMSS:             s.maxPayloadSize,
+		RcvMSS:             r.rcvMSS,
+		AdvMSS:             int(e.route.MTU()) - header.TCPMinimumSize,
+		Unacked:            s.outstanding,
+		LastDataSent:       s.lastDataSent,
+		LastDataRecv:       r.lastDataRcvd,
+		LastAckRecv:        s.lastAckRcvd,
+		SndSsthresh:        s.sndSsthresh,
+		SndCwnd:            s.sndCwnd,
+		Reordering:         nDupAckThreshold,
+		TotalRetrans:       s.totalRetrans,
+		BytesAcked:         s.bytesAcked,
+		BytesReceived:      r.bytesReceived,
+		DataSegsOut:        s.dataSegsOut,
+		DataSegsIn:         r.dataSegsIn,
+		BusyTime:           s.busyTime,
+	}
+
+	info.PMTU = int(e.route.MTU()) + header.IPv4MinimumSize
+	if e.route.NetProto == header.IPv6ProtocolNumber {
+		info.PMTU = int(e.route.MTU()) + header.IPv6MinimumSize
+	}
+
+	if sacked := int(e.scoreboard.Sacked()); sacked > 0 {
+		info.Sacked = (sacked + s.maxPayloadSize - 1) / s.maxPayloadSize
+	}
+
+	// The data of the write list that wasn't sent yet, excluding the FIN.
+	notSent := int(s.sndNxt.Size(s.sndNxtList))
+	if s.closed && notSent > 0 {
+		notSent--
+	}
+	info.NotSentBytes = notSent
+
+	if !s.busySince.IsZero() {
+		info.BusyTime += time.Now().Sub(s.busySince)
+	}
+
+	// Netstack doesn't sample the delivery rate, so it's estimated as a
+	// congestion window per round-trip time. The sender is limited by the
+	// application if it has nothing more to send.
+	s.rtt.Lock()
+	srtt := s.rtt.srtt
+	s.rtt.Unlock()
+	if srtt > 0 {
+		info.DeliveryRate = uint64(s.sndCwnd) * uint64(s.maxPayloadSize) * uint64(time.Second) / uint64(srtt)
+	}
+	info.DeliveryRateAppLimited = s.writeNext == nil && s.outstanding < s.sndCwnd
+
+	e.infoMu.Lock()
+	e.info = info
+	e.infoMu.Unlock()
+}
+
+// connectedState returns the state of the established connection reported by
+// TCP_INFO. It must be called with workMu held.
+func (e *endpoint) connectedState() tcpip.TCPState {
+	s, r := e.snd, e.rcv
+	finAcked := s.closed && s.sndUna == s.sndNxtList
+	switch {
+	case !s.closed && !r.closed:
+		return tcpip.TCPStateEstablished
+	case !s.closed:
+		return tcpip.TCPStateCloseWait
+	case !r.closed && finAcked:
+		return tcpip.TCPStateFinWait2
+	case !r.closed:
+		return tcpip.TCPStateFinWait1
+	case finAcked:
+		return tcpip.TCPStateTimeWait
+	default:
+		return tcpip.TCPStateLastAck
+	}
+}
+
 // completeState makes a full copy of the endpoint and returns it. This is used
 // before invoking the probe. The state returned may not be fully consistent if
 // there are intervening syscalls when the state is being copied.
@@ -1705,7 +2050,14 @@ func (e *endpoint) completeState() stack.TCPEndpointState {
 }
 
 func (e *endpoint) initGSO() {
-	if e.route.Capabilities()&stack.CapabilityGSO == 0 {
+	// The MPTCP options of subflows describe the data of each segment,
+	// so their segments can't be split.
+	if e.route.Capabilities()&stack.CapabilityGSO == 0 || e.subflow != nil {
+		return
+	}
+
+	// Segments signed with the MD5 signature option can't be split either.
+	if e.md5Key() != nil {
 		return
 	}
 
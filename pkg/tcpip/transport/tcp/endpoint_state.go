@@ -210,6 +210,8 @@ func (e *endpoint) afterLoad() {
 		if err := e.connect(tcpip.FullAddress{NIC: e.boundNICID, Addr: e.connectingAddress, Port: e.id.RemotePort}, false, e.workerRunning); err != tcpip.ErrConnectStarted {
 			panic("endpoint connecting failed: " + err.String())
 		}
+		// The keepalive timer isn't saved, so rearm it.
+		e.notifyProtocolGoroutine(notifyKeepaliveChanged)
 		connectedLoading.Done()
 	case stateListen:
 		tcpip.AsyncLoading.Add(1)
@@ -341,6 +343,7 @@ func loadError(s string) *tcpip.Error {
 			tcpip.ErrMessageTooLong,
 			tcpip.ErrNoBufferSpace,
 			tcpip.ErrBroadcastDisabled,
+			tcpip.ErrNotPermitted,
 		}
 
 		messageToError = make(map[string]*tcpip.Error)
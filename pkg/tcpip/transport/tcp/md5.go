@@ -0,0 +1,139 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"crypto/subtle"
+	"sync"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+)
+
+// md5Key is a key set with TCP_MD5SIG, which applies to the peers whose
+// address matches the first prefixLen bits of addr.
+//
+// +stateify savable
+type md5Key struct {
+	addr      tcpip.Address
+	prefixLen int
+	key       []byte
+}
+
+// matches returns true if the key applies to the peer at addr.
+func (k *md5Key) matches(addr tcpip.Address) bool {
+	if len(addr) != len(k.addr) {
+		return false
+	}
+	n := k.prefixLen / 8
+	if addr[:n] != k.addr[:n] {
+		return false
+	}
+	if bits := uint(k.prefixLen % 8); bits != 0 {
+		mask := byte(0xff << (8 - bits))
+		return addr[n]&mask == k.addr[n]&mask
+	}
+	return true
+}
+
+// md5Keys holds the TCP MD5 signature keys of an endpoint, as described in
+// RFC 2385. It's accessed both by the goroutines setting socket options and
+// by the protocol goroutine, so it's protected by its own mutex.
+//
+// +stateify savable
+type md5Keys struct {
+	sync.Mutex `state:"nosave"`
+	keys       []md5Key
+}
+
+// set sets the key for the peers matching addr and prefixLen, replacing the
+// existing one if any. An empty key removes it.
+func (m *md5Keys) set(addr tcpip.Address, prefixLen int, key []byte) {
+	m.Lock()
+	defer m.Unlock()
+
+	for i := range m.keys {
+		k := &m.keys[i]
+		if k.addr != addr || k.prefixLen != prefixLen {
+			continue
+		}
+		if len(key) == 0 {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+		} else {
+			k.key = append([]byte(nil), key...)
+		}
+		return
+	}
+
+	if len(key) != 0 {
+		m.keys = append(m.keys, md5Key{
+			addr:      addr,
+			prefixLen: prefixLen,
+			key:       append([]byte(nil), key...),
+		})
+	}
+}
+
+// lookup returns the key for the peer at addr, or nil if there's none. When
+// several keys apply, the one with the longest prefix is used.
+func (m *md5Keys) lookup(addr tcpip.Address) []byte {
+	m.Lock()
+	defer m.Unlock()
+
+	var best *md5Key
+	for i := range m.keys {
+		k := &m.keys[i]
+		if k.matches(addr) && (best == nil || k.prefixLen > best.prefixLen) {
+			best = k
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return best.key
+}
+
+// md5Key returns the key used to sign the segments exchanged with the peer of
+// a connected endpoint, or nil if they aren't signed.
+func (e *endpoint) md5Key() []byte {
+	return e.md5.lookup(e.id.RemoteAddress)
+}
+
+// checkMD5 returns true if the MD5 signature of s is acceptable. Like Linux,
+// a segment from a peer with a key must carry a valid signature, and one from
+// a peer without a key must not carry any. hdr is the header of s including
+// its options.
+func (e *endpoint) checkMD5(s *segment, hdr header.TCP) bool {
+	key := e.md5.lookup(s.id.RemoteAddress)
+	sig := header.TCPMD5Option(s.options)
+	if key == nil || sig == nil {
+		return key == nil && sig == nil
+	}
+
+	want := header.TCPMD5Signature(s.route.RemoteAddress, s.route.LocalAddress, hdr, s.data, key)
+	return subtle.ConstantTimeCompare(sig, want[:]) == 1
+}
+
+// signMD5 fills in the MD5 signature option of the segment from src to dst
+// with header tcp and payload data.
+func signMD5(src, dst tcpip.Address, tcp header.TCP, data buffer.VectorisedView, key []byte) {
+	sig := header.TCPMD5Option(tcp[header.TCPMinimumSize:])
+	if sig == nil {
+		return
+	}
+	want := header.TCPMD5Signature(src, dst, tcp, data, key)
+	copy(sig, want[:])
+}
@@ -0,0 +1,248 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/seqnum"
+)
+
+const (
+	// mtuProbeBaseMSS is the segment size used once probing is enabled,
+	// before any probe has succeeded. It matches Linux's tcp_base_mss.
+	mtuProbeBaseMSS = 1024
+
+	// mtuProbeFloor is the smallest segment size black hole detection may
+	// reduce the search range to. It matches Linux's tcp_mtu_probe_floor.
+	mtuProbeFloor = 48
+
+	// mtuProbeThreshold is the size of the search range, in bytes, below
+	// which the search is considered complete.
+	mtuProbeThreshold = 8
+
+	// mtuProbeInterval is how long after a search completes that the next
+	// one starts, to detect path MTU increases. See RFC 4821 section 7.7.
+	mtuProbeInterval = 10 * time.Minute
+
+	// mtuProbeBlackHoleTimeouts is the number of consecutive retransmit
+	// timeouts after which the path is assumed to contain an ICMP black
+	// hole. It matches Linux's tcp_retries1.
+	mtuProbeBlackHoleTimeouts = 3
+)
+
+// mtuProbe holds the state of packetization layer path MTU discovery, as
+// described in RFC 4821. Sizes are expressed as segment payload sizes, like
+// sender.maxPayloadSize.
+//
+// +stateify savable
+type mtuProbe struct {
+	// enabled is set when probing is in use. If false, the remaining fields
+	// are meaningless.
+	enabled bool
+
+	// searchLow is the largest size known to work, and searchHigh the
+	// largest size that may work.
+	searchLow  int
+	searchHigh int
+
+	// maxSize is the largest size permitted by the peer's MSS and the
+	// path MTU reported by ICMP; a new search starts from it.
+	maxSize int
+
+	// size is the size of the outstanding probe, or 0 if there is none.
+	// end is the sequence number following the probe.
+	size int
+	end  seqnum.Value
+
+	// lastSearch is when the current search started.
+	lastSearch time.Time `state:".(unixTime)"`
+}
+
+// initMTUProbe initializes path MTU probing according to the endpoint's
+// MTUProbingOption. It must be called once maxPayloadSize is known.
+func (s *sender) initMTUProbe() {
+	p := &s.mtuProbe
+	p.maxSize = s.maxPayloadSize
+	p.searchHigh = s.maxPayloadSize
+	p.searchLow = mtuProbeBaseMSS - s.ep.maxOptionSize()
+	if p.searchLow > s.maxPayloadSize {
+		p.searchLow = s.maxPayloadSize
+	}
+	if s.ep.mtuProbing == MTUProbingAlways {
+		s.enableMTUProbe()
+	}
+}
+
+// enableMTUProbe starts probing, and reduces the segment size to the lower
+// bound of the search range.
+func (s *sender) enableMTUProbe() {
+	p := &s.mtuProbe
+	p.enabled = true
+	p.lastSearch = time.Now()
+	if p.searchLow < s.maxPayloadSize {
+		s.setMaxPayloadSize(p.searchLow)
+	}
+}
+
+// mtuProbeBlackHole is called on repeated retransmit timeouts, which may be
+// caused by an ICMP black hole swallowing segments larger than the path MTU.
+// It enables probing, or if already enabled, halves the lower bound of the
+// search range. See RFC 4821 section 7.5.
+func (s *sender) mtuProbeBlackHole() {
+	if s.ep.mtuProbing == MTUProbingDisabled || s.gso {
+		return
+	}
+
+	p := &s.mtuProbe
+	if !p.enabled {
+		s.enableMTUProbe()
+		return
+	}
+
+	low := p.searchLow / 2
+	if base := mtuProbeBaseMSS - s.ep.maxOptionSize(); low > base {
+		low = base
+	}
+	if low < mtuProbeFloor {
+		low = mtuProbeFloor
+	}
+	p.searchLow = low
+	if p.searchHigh < low {
+		p.searchHigh = low
+	}
+	p.size = 0
+	if low < s.maxPayloadSize {
+		s.setMaxPayloadSize(low)
+	}
+}
+
+// mtuProbeTooBig is called when an ICMP "packet too big" message reduces the
+// path MTU so that at most m bytes of payload fit in a segment.
+func (s *sender) mtuProbeTooBig(m int) {
+	p := &s.mtuProbe
+	if m < p.maxSize {
+		p.maxSize = m
+	}
+	if m < p.searchHigh {
+		p.searchHigh = m
+	}
+	if m < p.searchLow {
+		p.searchLow = m
+	}
+	if p.size > m {
+		p.size = 0
+	}
+}
+
+// mtuProbeLost is called when a segment starting at seq is deemed lost. If it
+// is the outstanding probe, the probed size is too large for the path.
+func (s *sender) mtuProbeLost(seq seqnum.Value) {
+	p := &s.mtuProbe
+	if p.size == 0 || !seq.LessThan(p.end) {
+		return
+	}
+	p.searchHigh = p.size - 1
+	p.size = 0
+}
+
+// mtuProbeAcked is called once all data up to ack has been acknowledged. If
+// that covers the outstanding probe, the probed size becomes the new segment
+// size.
+func (s *sender) mtuProbeAcked(ack seqnum.Value) {
+	p := &s.mtuProbe
+	if p.size == 0 || ack.LessThan(p.end) {
+		return
+	}
+	p.searchLow = p.size
+	p.size = 0
+	if p.searchLow > s.maxPayloadSize {
+		s.setMaxPayloadSize(p.searchLow)
+	}
+}
+
+// sendMTUProbe sends a probe segment made of new data if one is due, as
+// described in RFC 4821 section 7.
+func (s *sender) sendMTUProbe() {
+	p := &s.mtuProbe
+	if !p.enabled || p.size != 0 || s.fr.active || s.timeouts > 0 {
+		return
+	}
+
+	if p.searchHigh-p.searchLow < mtuProbeThreshold {
+		// The search is complete. Start over once the interval
+		// elapses, in case the path MTU has increased.
+		if time.Now().Sub(p.lastSearch) < mtuProbeInterval {
+			return
+		}
+		p.searchHigh = p.maxSize
+		p.lastSearch = time.Now()
+		if p.searchHigh-p.searchLow < mtuProbeThreshold {
+			return
+		}
+	}
+
+	size := p.searchLow + (p.searchHigh-p.searchLow+1)/2
+
+	// Only probe with new data that fits the send and congestion windows.
+	seg := s.writeNext
+	if seg == nil || !seg.xmitTime.IsZero() || seg.data.Size() == 0 || s.outstanding >= s.sndCwnd {
+		return
+	}
+	if end := s.sndUna.Add(s.sndWnd); end.LessThan(s.sndNxt.Add(seqnum.Size(size))) {
+		return
+	}
+	if s.ep.subflow != nil {
+		// Merging data could cross MPTCP mapping boundaries.
+		return
+	}
+
+	queued := 0
+	for next := seg; next != nil && next.data.Size() != 0 && queued < size; next = next.Next() {
+		queued += next.data.Size()
+	}
+	if queued < size {
+		return
+	}
+
+	// Merge enough queued data to fill the probe.
+	for seg.data.Size() < size {
+		next := seg.Next()
+		seg.data.Append(next.data)
+		s.writeList.Remove(next)
+	}
+	seg.sequenceNumber = s.sndNxt
+	seg.flags = header.TCPFlagAck | header.TCPFlagPsh
+	if seg.data.Size() > size {
+		nSeg := seg.clone()
+		nSeg.data.TrimFront(size)
+		nSeg.sequenceNumber.UpdateForward(seqnum.Size(size))
+		s.writeList.InsertAfter(seg, nSeg)
+		seg.data.CapLength(size)
+	}
+
+	seg.xmitTime = time.Now()
+	seg.xmitCount++
+	s.ep.disableKeepaliveTimer()
+	s.sendSegment(seg.data, seg.flags, seg.sequenceNumber)
+	s.sndNxt = seg.sequenceNumber.Add(seqnum.Size(size))
+	s.outstanding += s.pCount(seg)
+	s.writeNext = seg.Next()
+
+	p.size = size
+	p.end = s.sndNxt
+	s.ep.stack.Stats().TCP.MTUProbes.Increment()
+}
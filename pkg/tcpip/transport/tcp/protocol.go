@@ -81,6 +81,34 @@ type CongestionControlOption string
 // algorithms.
 type AvailableCongestionControlOption string
 
+// MTUProbingOption configures packetization layer path MTU discovery, as
+// described in RFC 4821, for new connections. It mirrors Linux's
+// tcp_mtu_probing sysctl.
+type MTUProbingOption int
+
+const (
+	// MTUProbingDisabled disables path MTU probing.
+	MTUProbingDisabled MTUProbingOption = iota
+
+	// MTUProbingBlackHole enables path MTU probing once repeated
+	// retransmit timeouts suggest an ICMP black hole.
+	MTUProbingBlackHole
+
+	// MTUProbingAlways enables path MTU probing from the start of a
+	// connection.
+	MTUProbingAlways
+)
+
+// RecoveryOption configures loss recovery for new connections. It is a
+// bitmask that mirrors Linux's tcp_recovery sysctl.
+type RecoveryOption int
+
+const (
+	// RACKLossDetection enables RACK loss detection and tail loss probes,
+	// as described in RFC 8985, for connections that negotiated SACK.
+	RACKLossDetection RecoveryOption = 1 << iota
+)
+
 type protocol struct {
 	mu                         sync.Mutex
 	sackEnabled                bool
@@ -89,6 +117,8 @@ type protocol struct {
 	congestionControl          string
 	availableCongestionControl []string
 	allowedCongestionControl   []string
+	mtuProbing                 MTUProbingOption
+	recovery                   RecoveryOption
 }
 
 // Number returns the tcp protocol number.
@@ -153,7 +183,7 @@ func replyWithReset(s *segment) {
 
 	ack := s.sequenceNumber.Add(s.logicalLen())
 
-	sendTCP(&s.route, s.id, buffer.VectorisedView{}, s.route.DefaultTTL(), header.TCPFlagRst|header.TCPFlagAck, seq, ack, 0, nil /* options */, nil /* gso */)
+	sendTCP(&s.route, s.id, buffer.VectorisedView{}, s.route.DefaultTTL(), header.TCPFlagRst|header.TCPFlagAck, seq, ack, 0, nil /* options */, nil /* gso */, nil /* md5Key */)
 }
 
 // SetOption implements TransportProtocol.SetOption.
@@ -193,6 +223,25 @@ func (p *protocol) SetOption(option interface{}) *tcpip.Error {
 			}
 		}
 		return tcpip.ErrInvalidOptionValue
+
+	case MTUProbingOption:
+		if v < MTUProbingDisabled || v > MTUProbingAlways {
+			return tcpip.ErrInvalidOptionValue
+		}
+		p.mu.Lock()
+		p.mtuProbing = v
+		p.mu.Unlock()
+		return nil
+
+	case RecoveryOption:
+		if v&^RACKLossDetection != 0 {
+			return tcpip.ErrInvalidOptionValue
+		}
+		p.mu.Lock()
+		p.recovery = v
+		p.mu.Unlock()
+		return nil
+
 	default:
 		return tcpip.ErrUnknownProtocolOption
 	}
@@ -228,6 +277,16 @@ func (p *protocol) Option(option interface{}) *tcpip.Error {
 		*v = AvailableCongestionControlOption(strings.Join(p.availableCongestionControl, " "))
 		p.mu.Unlock()
 		return nil
+	case *MTUProbingOption:
+		p.mu.Lock()
+		*v = p.mtuProbing
+		p.mu.Unlock()
+		return nil
+	case *RecoveryOption:
+		p.mu.Lock()
+		*v = p.recovery
+		p.mu.Unlock()
+		return nil
 	default:
 		return tcpip.ErrUnknownProtocolOption
 	}
@@ -240,6 +299,8 @@ func init() {
 			recvBufferSize:             ReceiveBufferSizeOption{minBufferSize, DefaultBufferSize, maxBufferSize},
 			congestionControl:          ccReno,
 			availableCongestionControl: []string{ccReno, ccCubic},
+			mtuProbing:                 MTUProbingBlackHole,
+			recovery:                   RACKLossDetection,
 		}
 	})
 }
@@ -0,0 +1,275 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/seqnum"
+)
+
+const (
+	// tlpMinPTO is the lower bound of the probe timeout. See RFC 8985
+	// section 7.2.
+	tlpMinPTO = 10 * time.Millisecond
+
+	// tlpMaxAckDelay is the worst case delayed ACK timer the probe timeout
+	// accounts for when a single segment is in flight.
+	tlpMaxAckDelay = 200 * time.Millisecond
+)
+
+// resendTimerMode is what the sender's resend timer is armed for. RACK's
+// reordering timer and the tail loss probe timer share the retransmit timer,
+// as suggested by RFC 8985 section 8.
+type resendTimerMode int
+
+const (
+	// resendTimerRTO is the retransmission timeout.
+	resendTimerRTO resendTimerMode = iota
+
+	// resendTimerReorder is RACK's reordering window timeout.
+	resendTimerReorder
+
+	// resendTimerProbe is the tail loss probe timeout.
+	resendTimerProbe
+)
+
+// rackControl holds the state of RACK loss detection and tail loss probes, as
+// described in RFC 8985.
+//
+// +stateify savable
+type rackControl struct {
+	// xmitTime and endSequence are the latest transmit time and the end
+	// sequence number of the most recently transmitted segment that has
+	// been delivered, either cumulatively acknowledged or SACKed.
+	xmitTime    time.Time `state:".(unixTime)"`
+	endSequence seqnum.Value
+
+	// rtt is the round-trip time of the most recently delivered segment.
+	rtt time.Duration
+
+	// fack is the highest sequence number delivered, and reorderSeen is
+	// set once a segment below it is delivered.
+	fack        seqnum.Value
+	reorderSeen bool
+
+	// timerMode is what the resend timer is armed for.
+	timerMode resendTimerMode
+
+	// tlpRxtOut is set while a tail loss probe is outstanding, and
+	// tlpHighRxt is sndNxt when it was sent.
+	tlpRxtOut  bool
+	tlpHighRxt seqnum.Value
+}
+
+// rackEnabled returns true if RACK loss detection and tail loss probes are in
+// use. Both depend on SACK.
+func (s *sender) rackEnabled() bool {
+	return s.ep.sackPermitted && s.ep.recovery&RACKLossDetection != 0
+}
+
+// rackUpdate updates the RACK state when seg is delivered. See RFC 8985
+// section 6.2, steps 1 to 3.
+func (s *sender) rackUpdate(seg *segment) {
+	if seg.xmitTime.IsZero() {
+		return
+	}
+
+	rtt := time.Now().Sub(seg.xmitTime)
+	if seg.xmitCount > 1 {
+		// The delivery may be for an earlier transmission, in which
+		// case it doesn't say anything about the retransmission.
+		s.rtt.Lock()
+		minRTT := s.rtt.minRTT
+		s.rtt.Unlock()
+		if rtt < minRTT {
+			return
+		}
+	}
+
+	end := seg.sequenceNumber.Add(seqnum.Size(seg.logicalLen()))
+	s.rc.rtt = rtt
+	if s.rc.xmitTime.Before(seg.xmitTime) || (seg.xmitTime.Equal(s.rc.xmitTime) && s.rc.endSequence.LessThan(end)) {
+		s.rc.xmitTime = seg.xmitTime
+		s.rc.endSequence = end
+	}
+
+	if end.LessThan(s.rc.fack) {
+		s.rc.reorderSeen = true
+	} else {
+		s.rc.fack = end
+	}
+}
+
+// rackUpdateSACKed updates the RACK state for segments that were SACKed for
+// the first time.
+func (s *sender) rackUpdateSACKed() {
+	for seg := s.writeList.Front(); seg != nil && seg != s.writeNext; seg = seg.Next() {
+		if seg.sacked || seg.xmitTime.IsZero() {
+			continue
+		}
+		end := seg.sequenceNumber.Add(seqnum.Size(seg.logicalLen()))
+		if s.ep.scoreboard.IsSACKED(header.SACKBlock{seg.sequenceNumber, end}) {
+			seg.sacked = true
+			s.rackUpdate(seg)
+		}
+	}
+}
+
+// rackReoWnd returns the reordering window, the extra time a segment may take
+// to be delivered before it is deemed lost. See RFC 8985 section 6.2 step 4.
+func (s *sender) rackReoWnd() time.Duration {
+	if !s.rc.reorderSeen {
+		if s.fr.active || s.timeouts > 0 {
+			return 0
+		}
+		sacked := 0
+		for seg := s.writeList.Front(); seg != nil && seg != s.writeNext; seg = seg.Next() {
+			if seg.sacked {
+				sacked++
+			}
+		}
+		if sacked >= nDupAckThreshold {
+			return 0
+		}
+	}
+
+	s.rtt.Lock()
+	reoWnd, srtt := s.rtt.minRTT/4, s.rtt.srtt
+	s.rtt.Unlock()
+	if srtt < reoWnd {
+		reoWnd = srtt
+	}
+	return reoWnd
+}
+
+// rackDetectLoss retransmits the segments that were sent before the most
+// recently delivered one, and have not been delivered within the reordering
+// window since. If some segments may still be lost once the window elapses,
+// it arms the reordering timer. See RFC 8985 section 6.2 step 5.
+func (s *sender) rackDetectLoss() {
+	if s.rc.xmitTime.IsZero() {
+		return
+	}
+
+	reoWnd := s.rackReoWnd()
+	now := time.Now()
+	var timeout time.Duration
+	for seg := s.writeList.Front(); seg != nil && seg != s.writeNext; seg = seg.Next() {
+		if seg.sacked || seg.xmitTime.IsZero() {
+			continue
+		}
+
+		// Only segments sent before the most recently delivered one
+		// can be deemed lost.
+		end := seg.sequenceNumber.Add(seqnum.Size(seg.logicalLen()))
+		if !seg.xmitTime.Before(s.rc.xmitTime) && !(seg.xmitTime.Equal(s.rc.xmitTime) && end.LessThan(s.rc.endSequence)) {
+			continue
+		}
+
+		remaining := seg.xmitTime.Add(s.rc.rtt + reoWnd).Sub(now)
+		if remaining > 0 {
+			if remaining > timeout {
+				timeout = remaining
+			}
+			continue
+		}
+
+		if !s.fr.active {
+			s.cc.HandleNDupAcks()
+			s.enterFastRecovery()
+			s.dupAckCount = 0
+			s.ep.stack.Stats().TCP.SACKRecovery.Increment()
+		}
+		s.mtuProbeLost(seg.sequenceNumber)
+		s.retransmit(seg)
+		s.ep.stack.Stats().TCP.FastRetransmit.Increment()
+	}
+
+	if timeout > 0 {
+		s.rc.timerMode = resendTimerReorder
+		s.resendTimer.enable(timeout)
+	}
+}
+
+// rackReorderTimerExpired is called when the reordering window of a segment
+// elapses.
+func (s *sender) rackReorderTimerExpired() {
+	s.rackDetectLoss()
+	s.sendData()
+}
+
+// schedulePTO arms the tail loss probe timer instead of the retransmit timer
+// if a probe is allowed. It returns true if it did so. See RFC 8985 section
+// 7.2.
+func (s *sender) schedulePTO() bool {
+	if !s.rackEnabled() || s.rc.tlpRxtOut || s.fr.active || s.timeouts > 0 || !s.srttInited {
+		return false
+	}
+
+	s.rtt.Lock()
+	pto := 2 * s.rtt.srtt
+	s.rtt.Unlock()
+	if s.outstanding == 1 {
+		pto += tlpMaxAckDelay
+	}
+	if pto < tlpMinPTO {
+		pto = tlpMinPTO
+	}
+	if pto >= s.rto {
+		return false
+	}
+
+	s.rc.timerMode = resendTimerProbe
+	s.resendTimer.enable(pto)
+	return true
+}
+
+// probeTimerExpired sends a tail loss probe, which elicits an ACK to trigger
+// fast recovery when the last segments of a flight are lost. New data that
+// the windows allow would have been sent already, so the probe retransmits
+// the last segment sent. See RFC 8985 section 7.3.
+func (s *sender) probeTimerExpired() {
+	var last *segment
+	for seg := s.writeList.Front(); seg != nil && seg != s.writeNext; seg = seg.Next() {
+		last = seg
+	}
+
+	if last != nil && !last.sacked {
+		s.retransmit(last)
+		s.rc.tlpRxtOut = true
+		s.rc.tlpHighRxt = s.sndNxt
+		s.ep.stack.Stats().TCP.TailLossProbes.Increment()
+	}
+
+	s.rc.timerMode = resendTimerRTO
+	s.resendTimer.enable(s.rto)
+}
+
+// tlpProcessAck ends a tail loss probe episode once the probe is acknowledged.
+// Unless a DSACK reports the probe as a duplicate, it repaired a loss so the
+// congestion window is reduced. See RFC 8985 section 7.4.
+func (s *sender) tlpProcessAck(ack seqnum.Value, dsack bool) {
+	if !s.rc.tlpRxtOut || ack.LessThan(s.rc.tlpHighRxt) {
+		return
+	}
+
+	s.rc.tlpRxtOut = false
+	if !dsack && !s.fr.active {
+		s.cc.HandleNDupAcks()
+		s.sndCwnd = s.sndSsthresh
+	}
+}
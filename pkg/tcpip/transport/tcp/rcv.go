@@ -16,6 +16,7 @@ package tcp
 
 import (
 	"container/heap"
+	"time"
 
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/seqnum"
@@ -45,6 +46,16 @@ type receiver struct {
 	pendingRcvdSegments segmentHeap
 	pendingBufUsed      seqnum.Size
 	pendingBufSize      seqnum.Size
+
+	// The following fields are statistics reported by TCP_INFO.
+	//
+	// bytesReceived is the amount of in-sequence data received, dataSegsIn
+	// the number of segments received with data, rcvMSS the largest
+	// payload received and lastDataRcvd when data was last received.
+	bytesReceived uint64
+	dataSegsIn    uint64
+	rcvMSS        int
+	lastDataRcvd  time.Time `state:".(unixTime)"`
 }
 
 func newReceiver(ep *endpoint, irs seqnum.Value, rcvWnd seqnum.Size, rcvWndScale uint8) *receiver {
@@ -119,6 +130,7 @@ func (r *receiver) consumeSegment(s *segment, segSeq seqnum.Value, segLen seqnum
 			s.sequenceNumber.UpdateForward(diff)
 			s.data.TrimFront(int(diff))
 		}
+		r.bytesReceived += uint64(segLen)
 
 		// Move segment to ready-to-deliver list. Wakeup any waiters.
 		r.ep.readyToRead(s)
@@ -173,6 +185,14 @@ func (r *receiver) handleRcvdSegment(s *segment) {
 	segLen := seqnum.Size(s.data.Size())
 	segSeq := s.sequenceNumber
 
+	if segLen > 0 {
+		r.dataSegsIn++
+		r.lastDataRcvd = time.Now()
+		if int(segLen) > r.rcvMSS {
+			r.rcvMSS = int(segLen)
+		}
+	}
+
 	// If the sequence number range is outside the acceptable range, just
 	// send an ACK. This is according to RFC 793, page 37.
 	if !r.acceptable(segSeq, segLen) {
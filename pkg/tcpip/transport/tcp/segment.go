@@ -54,6 +54,10 @@ type segment struct {
 	// xmitTime is the last transmit time of this segment. A zero value
 	// indicates that the segment has yet to be transmitted.
 	xmitTime time.Time `state:".(unixTime)"`
+	// xmitCount is the number of times this segment has been transmitted.
+	xmitCount uint32
+	// sacked is set once the segment has been SACKed.
+	sacked bool
 }
 
 func newSegment(r *stack.Route, id stack.TransportEndpointID, vv buffer.VectorisedView) *segment {
@@ -129,6 +129,12 @@ type sender struct {
 	// It is initialized on demand.
 	maxPayloadSize int
 
+	// mtuProbe holds the state of packetization layer path MTU discovery.
+	mtuProbe mtuProbe
+
+	// rc holds the state of RACK loss detection and tail loss probes.
+	rc rackControl
+
 	// gso is set if generic segmentation offload is enabled.
 	gso bool
 
@@ -141,6 +147,30 @@ type sender struct {
 
 	// cc is the congestion control algorithm in use for this sender.
 	cc congestionControl
+
+	// wndScaleOK is set if window scaling was negotiated with the peer.
+	wndScaleOK bool
+
+	// The following fields are statistics reported by TCP_INFO.
+	//
+	// timeouts is the number of consecutive retransmission timeouts; it's
+	// reset once new data is acknowledged. totalRetrans is the number of
+	// segments retransmitted, bytesAcked the amount of data acknowledged
+	// and dataSegsOut the number of segments sent with data.
+	timeouts     int
+	totalRetrans uint32
+	bytesAcked   uint64
+	dataSegsOut  uint64
+
+	// lastDataSent is when data was last sent, and lastAckRcvd when an ACK
+	// was last received.
+	lastDataSent time.Time `state:".(unixTime)"`
+	lastAckRcvd  time.Time `state:".(unixTime)"`
+
+	// busySince is when data became outstanding, or the zero time if none
+	// is. busyTime is the time data was outstanding before.
+	busySince time.Time `state:".(unixTime)"`
+	busyTime  time.Duration
 }
 
 // rtt is a synchronization wrapper used to appease stateify. See the comment
@@ -152,6 +182,9 @@ type rtt struct {
 
 	srtt   time.Duration
 	rttvar time.Duration
+
+	// minRTT is the lowest round-trip time measured.
+	minRTT time.Duration
 }
 
 // fastRecovery holds information related to fast recovery from a packet loss.
@@ -211,12 +244,14 @@ func newSender(ep *endpoint, iss, irs seqnum.Value, sndWnd seqnum.Size, mss uint
 	if sndWndScale > 0 {
 		s.sndWndScale = uint8(sndWndScale)
 	}
+	s.wndScaleOK = sndWndScale >= 0
 
 	// Initialize SACK Scoreboard.
 	s.ep.scoreboard = NewSACKScoreboard(mss, iss)
 	s.resendTimer.init(&s.resendWaker)
 
 	s.updateMaxPayloadSize(int(ep.route.MTU()), 0)
+	s.initMTUProbe()
 
 	return s
 }
@@ -241,21 +276,20 @@ func (s *sender) updateMaxPayloadSize(mtu, count int) {
 
 	m -= s.ep.maxOptionSize()
 
-	// We don't adjust up for now.
-	if m >= s.maxPayloadSize {
-		return
-	}
-
 	// Make sure we can transmit at least one byte.
 	if m <= 0 {
 		m = 1
 	}
 
-	s.maxPayloadSize = m
-	if s.gso {
-		s.ep.gso.MSS = uint16(m)
+	s.mtuProbeTooBig(m)
+
+	// We don't adjust up for now.
+	if m >= s.maxPayloadSize {
+		return
 	}
 
+	s.setMaxPayloadSize(m)
+
 	s.outstanding -= count
 	if s.outstanding < 0 {
 		s.outstanding = 0
@@ -283,6 +317,14 @@ func (s *sender) updateMaxPayloadSize(mtu, count int) {
 	s.sendData()
 }
 
+// setMaxPayloadSize sets the maximum payload size of segments to m.
+func (s *sender) setMaxPayloadSize(m int) {
+	s.maxPayloadSize = m
+	if s.gso {
+		s.ep.gso.MSS = uint16(m)
+	}
+}
+
 // sendAck sends an ACK segment.
 func (s *sender) sendAck() {
 	s.sendSegment(buffer.VectorisedView{}, header.TCPFlagAck, s.sndNxt)
@@ -292,6 +334,9 @@ func (s *sender) sendAck() {
 // available. This is done in accordance with section 2 of RFC 6298.
 func (s *sender) updateRTO(rtt time.Duration) {
 	s.rtt.Lock()
+	if s.rtt.minRTT == 0 || rtt < s.rtt.minRTT {
+		s.rtt.minRTT = rtt
+	}
 	if !s.srttInited {
 		s.rtt.rttvar = rtt / 2
 		s.rtt.srtt = rtt
@@ -343,25 +388,36 @@ func (s *sender) updateRTO(rtt time.Duration) {
 
 // resendSegment resends the first unacknowledged segment.
 func (s *sender) resendSegment() {
+	// Resend the segment.
+	if seg := s.writeList.Front(); seg != nil {
+		s.retransmit(seg)
+		s.ep.stack.Stats().TCP.FastRetransmit.Increment()
+	}
+}
+
+// retransmit resends the given segment, splitting it first if it exceeds the
+// maximum payload size.
+func (s *sender) retransmit(seg *segment) {
 	// Don't use any segments we already sent to measure RTT as they may
 	// have been affected by packets being lost.
 	s.rttMeasureSeqNum = s.sndNxt
 
-	// Resend the segment.
-	if seg := s.writeList.Front(); seg != nil {
-		if seg.data.Size() > s.maxPayloadSize {
-			available := s.maxPayloadSize
-			// Split this segment up.
-			nSeg := seg.clone()
-			nSeg.data.TrimFront(available)
-			nSeg.sequenceNumber.UpdateForward(seqnum.Size(available))
-			s.writeList.InsertAfter(seg, nSeg)
-			seg.data.CapLength(available)
-		}
-		s.sendSegment(seg.data, seg.flags, seg.sequenceNumber)
-		s.ep.stack.Stats().TCP.FastRetransmit.Increment()
-		s.ep.stack.Stats().TCP.Retransmits.Increment()
+	if seg.data.Size() > s.maxPayloadSize {
+		available := s.maxPayloadSize
+		// Split this segment up.
+		nSeg := seg.clone()
+		nSeg.data.TrimFront(available)
+		nSeg.sequenceNumber.UpdateForward(seqnum.Size(available))
+		nSeg.xmitTime = seg.xmitTime
+		nSeg.xmitCount = seg.xmitCount
+		s.writeList.InsertAfter(seg, nSeg)
+		seg.data.CapLength(available)
 	}
+	seg.xmitTime = time.Now()
+	seg.xmitCount++
+	s.sendSegment(seg.data, seg.flags, seg.sequenceNumber)
+	s.ep.stack.Stats().TCP.Retransmits.Increment()
+	s.totalRetrans++
 }
 
 // retransmitTimerExpired is called when the retransmit timer expires, and
@@ -375,7 +431,29 @@ func (s *sender) retransmitTimerExpired() bool {
 		return true
 	}
 
+	// The timer may be armed for RACK's reordering window or a tail loss
+	// probe rather than the retransmission timeout.
+	switch s.rc.timerMode {
+	case resendTimerReorder:
+		s.rc.timerMode = resendTimerRTO
+		s.rackReorderTimerExpired()
+		return true
+	case resendTimerProbe:
+		s.rc.timerMode = resendTimerRTO
+		s.probeTimerExpired()
+		return true
+	}
+
 	s.ep.stack.Stats().TCP.Timeouts.Increment()
+	s.timeouts++
+
+	// The first unacknowledged segment is lost. If it was a path MTU
+	// probe, the probed size is too large, and repeated losses may mean
+	// that an ICMP black hole drops segments larger than the path MTU.
+	s.mtuProbeLost(s.sndUna)
+	if s.timeouts >= mtuProbeBlackHoleTimeouts {
+		s.mtuProbeBlackHole()
+	}
 
 	// Give up if we've waited more than a minute since the last resend.
 	if s.rto >= 60*time.Second {
@@ -422,6 +500,10 @@ func (s *sender) retransmitTimerExpired() bool {
 	// information as we lack more rigorous checks to validate if the SACK
 	// information is usable after an RTO.
 	s.ep.scoreboard.Reset()
+	for seg := s.writeList.Front(); seg != nil; seg = seg.Next() {
+		seg.sacked = false
+	}
+	s.rc.tlpRxtOut = false
 	s.writeNext = s.writeList.Front()
 	s.sendData()
 
@@ -456,6 +538,8 @@ func (s *sender) sendData() {
 		}
 	}
 
+	s.sendMTUProbe()
+
 	seg := s.writeNext
 	end := s.sndUna.Add(s.sndWnd)
 	var dataSent bool
@@ -491,6 +575,13 @@ func (s *sender) sendData() {
 						break
 					}
 
+					// The MPTCP options of a segment only
+					// map data of a single mapping.
+					if s.ep.subflow != nil && s.ep.subflow.MappingBoundary(s.sndNxt.Add(seqnum.Size(seg.data.Size()))) {
+						nextTooBig = true
+						break
+					}
+
 					seg.data.Append(seg.Next().data)
 
 					// Consume the segment that we just merged in.
@@ -568,12 +659,14 @@ func (s *sender) sendData() {
 
 		if !seg.xmitTime.IsZero() {
 			s.ep.stack.Stats().TCP.Retransmits.Increment()
+			s.totalRetrans++
 			if s.sndCwnd < s.sndSsthresh {
 				s.ep.stack.Stats().TCP.SlowStartRetransmits.Increment()
 			}
 		}
 
 		seg.xmitTime = time.Now()
+		seg.xmitCount++
 		s.sendSegment(seg.data, seg.flags, seg.sequenceNumber)
 
 		// Update sndNxt if we actually sent new data (as opposed to
@@ -587,13 +680,45 @@ func (s *sender) sendData() {
 	s.writeNext = seg
 
 	// Enable the timer if we have pending data and it's not enabled yet.
-	if !s.resendTimer.enabled() && s.sndUna != s.sndNxt {
+	// A tail loss probe is sent before the retransmission timeout if
+	// possible.
+	if !s.resendTimer.enabled() && s.sndUna != s.sndNxt && !s.schedulePTO() {
+		s.rc.timerMode = resendTimerRTO
 		s.resendTimer.enable(s.rto)
 	}
 	// If we have no more pending data, start the keepalive timer.
 	if s.sndUna == s.sndNxt {
 		s.ep.resetKeepaliveTimer(false)
 	}
+
+	s.updateBusyTime()
+}
+
+// caState returns the congestion avoidance state of the sender reported by
+// TCP_INFO.
+func (s *sender) caState() tcpip.TCPCAState {
+	switch {
+	case s.timeouts > 0:
+		return tcpip.TCPCAStateLoss
+	case s.fr.active:
+		return tcpip.TCPCAStateRecovery
+	case s.dupAckCount > 0 || !s.ep.scoreboard.Empty():
+		return tcpip.TCPCAStateDisorder
+	default:
+		return tcpip.TCPCAStateOpen
+	}
+}
+
+// updateBusyTime accounts for the time data is outstanding.
+func (s *sender) updateBusyTime() {
+	busy := s.sndUna != s.sndNxt
+	switch {
+	case busy && s.busySince.IsZero():
+		s.busySince = time.Now()
+	case !busy && !s.busySince.IsZero():
+		s.busyTime += time.Now().Sub(s.busySince)
+		s.busySince = time.Time{}
+	}
 }
 
 func (s *sender) enterFastRecovery() {
@@ -706,6 +831,8 @@ func (s *sender) checkDuplicateAck(seg *segment) (rtx bool) {
 // handleRcvdSegment is called when a segment is received; it is responsible for
 // updating the send-related state.
 func (s *sender) handleRcvdSegment(seg *segment) {
+	s.lastAckRcvd = time.Now()
+
 	// Check if we can extract an RTT measurement from this ack.
 	if !seg.parsedOptions.TS && s.rttMeasureSeqNum.LessThan(seg.ackNumber) {
 		s.updateRTO(time.Now().Sub(s.rttMeasureTime))
@@ -718,8 +845,15 @@ func (s *sender) handleRcvdSegment(seg *segment) {
 	}
 
 	// Insert SACKBlock information into our scoreboard.
+	var dsack bool
 	if s.ep.sackPermitted {
 		for _, sb := range seg.parsedOptions.SACKBlocks {
+			// A DSACK block reports data that was received more
+			// than once. See RFC 2883 section 4.
+			if sb.End.LessThanEq(seg.ackNumber) {
+				dsack = true
+			}
+
 			// Only insert the SACK block if the following holds
 			// true:
 			//  * SACK block acks data after the ack number in the
@@ -737,6 +871,9 @@ func (s *sender) handleRcvdSegment(seg *segment) {
 				seg.hasNewSACKInfo = true
 			}
 		}
+		if seg.hasNewSACKInfo && s.rackEnabled() {
+			s.rackUpdateSACKed()
+		}
 	}
 
 	// Count the duplicates and do the fast retransmit if needed.
@@ -770,6 +907,8 @@ func (s *sender) handleRcvdSegment(seg *segment) {
 		// Remove all acknowledged data from the write list.
 		acked := s.sndUna.Size(ack)
 		s.sndUna = ack
+		s.bytesAcked += uint64(acked)
+		s.timeouts = 0
 
 		ackLeft := acked
 		originalOutstanding := s.outstanding
@@ -791,6 +930,9 @@ func (s *sender) handleRcvdSegment(seg *segment) {
 			if s.writeNext == seg {
 				s.writeNext = seg.Next()
 			}
+			if !seg.sacked && s.rackEnabled() {
+				s.rackUpdate(seg)
+			}
 			s.writeList.Remove(seg)
 			s.outstanding -= s.pCount(seg)
 			seg.decRef()
@@ -803,6 +945,8 @@ func (s *sender) handleRcvdSegment(seg *segment) {
 		// Clear SACK information for all acked data.
 		s.ep.scoreboard.Delete(s.sndUna)
 
+		s.mtuProbeAcked(ack)
+
 		// If we are not in fast recovery then update the congestion
 		// window based on the number of acknowledged packets.
 		if !s.fr.active {
@@ -818,8 +962,14 @@ func (s *sender) handleRcvdSegment(seg *segment) {
 	}
 
 	// Now that we've popped all acknowledged data from the retransmit
-	// queue, retransmit if needed.
-	if rtx {
+	// queue, retransmit if needed. RACK may have retransmitted the first
+	// unacknowledged segment already.
+	if s.rackEnabled() {
+		s.tlpProcessAck(ack, dsack)
+		s.rackDetectLoss()
+	}
+	if front := s.writeList.Front(); rtx && (front == nil || front.xmitTime.Before(s.lastAckRcvd)) {
+		s.mtuProbeLost(s.sndUna)
 		s.resendSegment()
 	}
 
@@ -837,6 +987,10 @@ func (s *sender) sendSegment(data buffer.VectorisedView, flags byte, seq seqnum.
 	if seq == s.rttMeasureSeqNum {
 		s.rttMeasureTime = s.lastSendTime
 	}
+	if data.Size() > 0 {
+		s.dataSegsOut++
+		s.lastDataSent = s.lastSendTime
+	}
 
 	rcvNxt, rcvWnd := s.ep.rcv.getSendParams()
 
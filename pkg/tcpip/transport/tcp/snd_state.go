@@ -44,7 +44,80 @@ func (s *sender) loadRttMeasureTime(unix unixTime) {
 	s.rttMeasureTime = time.Unix(unix.second, unix.nano)
 }
 
+// saveLastDataSent is invoked by stateify.
+func (s *sender) saveLastDataSent() unixTime {
+	return timeToUnix(s.lastDataSent)
+}
+
+// loadLastDataSent is invoked by stateify.
+func (s *sender) loadLastDataSent(unix unixTime) {
+	s.lastDataSent = unixToTime(unix)
+}
+
+// saveLastAckRcvd is invoked by stateify.
+func (s *sender) saveLastAckRcvd() unixTime {
+	return timeToUnix(s.lastAckRcvd)
+}
+
+// loadLastAckRcvd is invoked by stateify.
+func (s *sender) loadLastAckRcvd(unix unixTime) {
+	s.lastAckRcvd = unixToTime(unix)
+}
+
+// saveBusySince is invoked by stateify.
+func (s *sender) saveBusySince() unixTime {
+	return timeToUnix(s.busySince)
+}
+
+// loadBusySince is invoked by stateify.
+func (s *sender) loadBusySince(unix unixTime) {
+	s.busySince = unixToTime(unix)
+}
+
+// timeToUnix converts t to a unixTime, the zero time to the zero unixTime.
+func timeToUnix(t time.Time) unixTime {
+	if t.IsZero() {
+		return unixTime{}
+	}
+	return unixTime{t.Unix(), int64(t.Nanosecond())}
+}
+
+// unixToTime converts a unixTime saved by timeToUnix back to a time.
+func unixToTime(unix unixTime) time.Time {
+	if unix == (unixTime{}) {
+		return time.Time{}
+	}
+	return time.Unix(unix.second, unix.nano)
+}
+
 // afterLoad is invoked by stateify.
 func (s *sender) afterLoad() {
 	s.resendTimer.init(&s.resendWaker)
+
+	// Segments in flight when the endpoint was saved may have been lost
+	// while it wasn't running, so retransmit them if they aren't
+	// acknowledged in time.
+	if s.sndUna != s.sndNxt {
+		s.resendTimer.enable(s.rto)
+	}
+}
+
+// saveLastSearch is invoked by stateify.
+func (p *mtuProbe) saveLastSearch() unixTime {
+	return timeToUnix(p.lastSearch)
+}
+
+// loadLastSearch is invoked by stateify.
+func (p *mtuProbe) loadLastSearch(unix unixTime) {
+	p.lastSearch = unixToTime(unix)
+}
+
+// saveXmitTime is invoked by stateify.
+func (rc *rackControl) saveXmitTime() unixTime {
+	return timeToUnix(rc.xmitTime)
+}
+
+// loadXmitTime is invoked by stateify.
+func (rc *rackControl) loadXmitTime(unix unixTime) {
+	rc.xmitTime = unixToTime(unix)
 }
@@ -0,0 +1,125 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/seqnum"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+// SubflowHooks is implemented by multipath TCP to run a connection over TCP
+// endpoints, which are then its subflows. The hooks extend the segments of a
+// subflow with MPTCP options, and take over the data it receives, which is
+// never queued for reading from the endpoint.
+//
+// The hooks are called by the protocol goroutine of the subflow, or by the
+// goroutine performing the handshake of passive opens. They must not call
+// into the endpoint, other than through SignalSubflow.
+type SubflowHooks interface {
+	// SynOptions encodes the MPTCP options of the SYN sent by an active
+	// opener, or of the SYN-ACK sent by a passive opener if synAck is set,
+	// into b. It returns the number of bytes written.
+	SynOptions(b []byte, synAck bool) int
+
+	// HandleSynAck is called by an active opener with the MPTCP options of
+	// the SYN-ACK of its peer. iss and irs are the initial send and receive
+	// sequence numbers of the subflow. The subflow is reset if it returns
+	// an error.
+	HandleSynAck(iss, irs seqnum.Value, opts *header.MPTCPOptions) *tcpip.Error
+
+	// HandleAck is called by a passive opener with the MPTCP options of
+	// the segment completing the handshake. iss and irs are the initial
+	// send and receive sequence numbers of the subflow. The subflow is
+	// reset if it returns an error.
+	HandleAck(iss, irs seqnum.Value, opts *header.MPTCPOptions) *tcpip.Error
+
+	// Attach is called once a passive opener completes its handshake. It
+	// returns true if the subflow joined an existing connection, in which
+	// case the subflow is started with wq as its waiter queue rather than
+	// queued for Accept.
+	Attach(ep tcpip.Endpoint, wq *waiter.Queue) bool
+
+	// Options encodes the MPTCP options of a segment with the provided
+	// flags, starting at sequence number seq and carrying size bytes of
+	// data, into b, which it must not overflow. It returns the number of
+	// bytes written.
+	Options(b []byte, seq seqnum.Value, size int, flags byte) int
+
+	// MappingBoundary returns whether the data starting at seq belongs to
+	// a different data sequence mapping than the data preceding it, in
+	// which case both must not be sent in the same segment.
+	MappingBoundary(seq seqnum.Value) bool
+
+	// HandleSegment is called with the acknowledgement number and the
+	// MPTCP options of each segment received once the subflow is
+	// established, before its data is delivered.
+	HandleSegment(ack seqnum.Value, opts *header.MPTCPOptions)
+
+	// Deliver is called with the data received in sequence, starting at
+	// sequence number seq. It is called with fin set and no data once the
+	// peer closed its side of the subflow.
+	Deliver(seq seqnum.Value, vv buffer.VectorisedView, fin bool)
+
+	// ReceiveBufferAvailable returns the receive window of the subflow,
+	// which is shared by all the subflows of the connection.
+	ReceiveBufferAvailable() int
+
+	// Closed is called once the protocol goroutine of the subflow exits,
+	// with the error the subflow failed with if any.
+	Closed(err *tcpip.Error)
+}
+
+// ListenerHooks is implemented by multipath TCP to accept subflows with a
+// listening TCP endpoint.
+type ListenerHooks interface {
+	// NewSubflow is called with the MPTCP options of each SYN received by
+	// the endpoint, and returns the hooks of the subflow it creates. The
+	// SYN is answered with a RST if it returns an error.
+	NewSubflow(id stack.TransportEndpointID, nicID tcpip.NICID, opts *header.MPTCPOptions) (SubflowHooks, *tcpip.Error)
+}
+
+// NewSubflowEndpoint creates a TCP endpoint extended by multipath TCP. hooks
+// are the hooks of the subflow it creates if it connects, and listenerHooks
+// create the hooks of the subflows it accepts if it listens.
+func NewSubflowEndpoint(s *stack.Stack, netProto tcpip.NetworkProtocolNumber, waiterQueue *waiter.Queue, hooks SubflowHooks, listenerHooks ListenerHooks) tcpip.Endpoint {
+	e := newEndpoint(s, netProto, waiterQueue)
+	e.subflow = hooks
+	e.listenerHooks = listenerHooks
+	return e
+}
+
+// SignalSubflow asks the protocol goroutine of the provided subflow to send an
+// ACK, which carries the current receive window and the MPTCP options its hooks
+// have pending.
+func SignalSubflow(ep tcpip.Endpoint) {
+	if e, ok := ep.(*endpoint); ok {
+		e.notifyProtocolGoroutine(notifySubflowSignal)
+	}
+}
+
+// subflowSynOptions returns the MPTCP options of a SYN or SYN-ACK sent by the
+// endpoint, or nil if it isn't a subflow. The returned slice must be released
+// with putOptions.
+func (e *endpoint) subflowSynOptions(synAck bool) []byte {
+	if e.subflow == nil {
+		return nil
+	}
+	options := getOptions()
+	return options[:e.subflow.SynOptions(options, synAck)]
+}
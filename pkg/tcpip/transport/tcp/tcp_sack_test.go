@@ -18,7 +18,11 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/checker"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/seqnum"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/tcp"
@@ -348,3 +352,118 @@ func TestTrimSackBlockList(t *testing.T) {
 		}
 	}
 }
+
+// sackedSegment is a data segment received from the endpoint under test.
+type sackedSegment struct {
+	start seqnum.Value
+	end   seqnum.Value
+}
+
+// writeAndReceiveSegments writes size bytes to c.EP and returns the segments
+// they are sent in.
+func writeAndReceiveSegments(t *testing.T, c *context.Context, size int) []sackedSegment {
+	t.Helper()
+	if _, _, err := c.EP.Write(tcpip.SlicePayload(buffer.NewView(size)), tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	var segs []sackedSegment
+	for received := 0; received < size; {
+		tcpHdr := header.TCP(header.IPv4(c.GetPacket()).Payload())
+		start := seqnum.Value(tcpHdr.SequenceNumber())
+		n := len(tcpHdr.Payload())
+		segs = append(segs, sackedSegment{start, start.Add(seqnum.Size(n))})
+		received += n
+	}
+	return segs
+}
+
+// sendSACK sends an ACK of all data before ack, with the given SACK blocks.
+func sendSACK(rep *context.RawEndpoint, ack seqnum.Value, sackBlocks []header.SACKBlock) {
+	rep.AckNum = ack
+	if len(sackBlocks) == 0 {
+		rep.SendPacket(nil, nil)
+		return
+	}
+	opts := make([]byte, header.TCPOptionsMaximumSize)
+	n := header.EncodeNOP(opts)
+	n += header.EncodeNOP(opts[n:])
+	n += header.EncodeSACKBlocks(sackBlocks, opts[n:])
+	rep.SendPacket(nil, opts[:n])
+}
+
+// checkRetransmit checks that the next packet sent retransmits seg.
+func checkRetransmit(t *testing.T, c *context.Context, seg sackedSegment) {
+	t.Helper()
+	checker.IPv4(t, c.GetPacket(),
+		checker.PayloadLen(int(seg.start.Size(seg.end))+header.TCPMinimumSize),
+		checker.TCP(
+			checker.DstPort(context.TestPort),
+			checker.SeqNum(uint32(seg.start)),
+		),
+	)
+}
+
+func TestRACKRetransmitsLostSegment(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	setStackSACKPermitted(t, c, true)
+	rep := c.CreateConnectedWithOptions(header.TCPSynOptions{SACKPermitted: true})
+
+	segs := writeAndReceiveSegments(t, c, 2000)
+	if len(segs) < 4 {
+		t.Fatalf("got %d segments, want at least 4", len(segs))
+	}
+
+	// SACK all segments but the first. The first segment was sent before
+	// them, so RACK deems it lost without waiting for more duplicate acks
+	// or the retransmission timeout.
+	sendSACK(rep, segs[0].start, []header.SACKBlock{{segs[1].start, segs[len(segs)-1].end}})
+	checkRetransmit(t, c, segs[0])
+
+	stats := c.Stack().Stats().TCP
+	if got, want := stats.SACKRecovery.Value(), uint64(1); got != want {
+		t.Errorf("got stats.TCP.SACKRecovery.Value = %v, want = %v", got, want)
+	}
+	if got, want := stats.Timeouts.Value(), uint64(0); got != want {
+		t.Errorf("got stats.TCP.Timeouts.Value = %v, want = %v", got, want)
+	}
+
+	// Acknowledge all the data and check nothing else is retransmitted.
+	sendSACK(rep, segs[len(segs)-1].end, nil)
+	c.CheckNoPacketTimeout("unexpected packet after all data was acknowledged", 100*time.Millisecond)
+}
+
+func TestTailLossProbe(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	setStackSACKPermitted(t, c, true)
+	rep := c.CreateConnectedWithOptions(header.TCPSynOptions{SACKPermitted: true})
+
+	// Send and acknowledge some data so that the RTT is known.
+	segs := writeAndReceiveSegments(t, c, 10)
+	sendSACK(rep, segs[0].end, nil)
+
+	// Lose the tail of the flight. A probe retransmitting the last segment
+	// is sent well before the retransmission timeout.
+	segs = writeAndReceiveSegments(t, c, 2000)
+	start := time.Now()
+	checkRetransmit(t, c, segs[len(segs)-1])
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("got tail loss probe after %v, want before the retransmission timeout", elapsed)
+	}
+
+	stats := c.Stack().Stats().TCP
+	if got, want := stats.TailLossProbes.Value(), uint64(1); got != want {
+		t.Errorf("got stats.TCP.TailLossProbes.Value = %v, want = %v", got, want)
+	}
+	if got, want := stats.Timeouts.Value(), uint64(0); got != want {
+		t.Errorf("got stats.TCP.Timeouts.Value = %v, want = %v", got, want)
+	}
+
+	// Acknowledge all the data and check nothing else is retransmitted.
+	sendSACK(rep, segs[len(segs)-1].end, nil)
+	c.CheckNoPacketTimeout("unexpected packet after all data was acknowledged", 100*time.Millisecond)
+}
@@ -900,6 +900,183 @@ func TestSimpleSend(t *testing.T) {
 	})
 }
 
+func TestQueueSizes(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	c.CreateConnected(789, 30000, nil)
+
+	data := []byte{1, 2, 3}
+	if _, _, err := c.EP.Write(tcpip.SlicePayload(data), tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	// The data is queued until it's acknowledged, even once sent.
+	c.GetPacket()
+	var sq tcpip.SendQueueSizeOption
+	if err := c.EP.GetSockOpt(&sq); err != nil {
+		t.Fatalf("GetSockOpt(&%T) failed: %v", sq, err)
+	}
+	if want := tcpip.SendQueueSizeOption(len(data)); sq != want {
+		t.Errorf("got SendQueueSizeOption = %d, want = %d", sq, want)
+	}
+
+	// Acknowledge the data along with some data of the peer.
+	c.SendPacket(data, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: c.Port,
+		Flags:   header.TCPFlagAck,
+		SeqNum:  790,
+		AckNum:  c.IRS.Add(1 + seqnum.Size(len(data))),
+		RcvWnd:  30000,
+	})
+	c.GetPacket()
+
+	if err := c.EP.GetSockOpt(&sq); err != nil {
+		t.Fatalf("GetSockOpt(&%T) failed: %v", sq, err)
+	}
+	if sq != 0 {
+		t.Errorf("got SendQueueSizeOption = %d, want = 0", sq)
+	}
+	var rq tcpip.ReceiveQueueSizeOption
+	if err := c.EP.GetSockOpt(&rq); err != nil {
+		t.Fatalf("GetSockOpt(&%T) failed: %v", rq, err)
+	}
+	if want := tcpip.ReceiveQueueSizeOption(len(data)); rq != want {
+		t.Errorf("got ReceiveQueueSizeOption = %d, want = %d", rq, want)
+	}
+}
+
+func TestQueueSizesListen(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	var err *tcpip.Error
+	c.EP, err = c.Stack().NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, &c.WQ)
+	if err != nil {
+		t.Fatalf("NewEndpoint failed: %v", err)
+	}
+	if err := c.EP.Bind(tcpip.FullAddress{Port: context.StackPort}); err != nil {
+		t.Fatalf("Bind failed: %v", err)
+	}
+	if err := c.EP.Listen(10); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+
+	var sq tcpip.SendQueueSizeOption
+	if err := c.EP.GetSockOpt(&sq); err != tcpip.ErrInvalidEndpointState {
+		t.Errorf("got GetSockOpt(&%T) = %v, want = %v", sq, err, tcpip.ErrInvalidEndpointState)
+	}
+	var rq tcpip.ReceiveQueueSizeOption
+	if err := c.EP.GetSockOpt(&rq); err != tcpip.ErrInvalidEndpointState {
+		t.Errorf("got GetSockOpt(&%T) = %v, want = %v", rq, err, tcpip.ErrInvalidEndpointState)
+	}
+}
+
+func TestMemInfo(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	c.CreateConnected(789, 30000, nil)
+
+	data := []byte{1, 2, 3}
+	if _, _, err := c.EP.Write(tcpip.SlicePayload(data), tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	c.GetPacket()
+
+	var mi tcpip.MemInfoOption
+	if err := c.EP.GetSockOpt(&mi); err != nil {
+		t.Fatalf("GetSockOpt(&%T) failed: %v", mi, err)
+	}
+	if want := (tcpip.MemInfoOption{RcvBufSize: tcp.DefaultBufferSize, SndBufSize: tcp.DefaultBufferSize, SndQueued: len(data)}); mi != want {
+		t.Errorf("got MemInfoOption = %+v, want = %+v", mi, want)
+	}
+
+	// Acknowledge the data along with some data of the peer.
+	c.SendPacket(data, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: c.Port,
+		Flags:   header.TCPFlagAck,
+		SeqNum:  790,
+		AckNum:  c.IRS.Add(1 + seqnum.Size(len(data))),
+		RcvWnd:  30000,
+	})
+	c.GetPacket()
+
+	if err := c.EP.GetSockOpt(&mi); err != nil {
+		t.Fatalf("GetSockOpt(&%T) failed: %v", mi, err)
+	}
+	if want := (tcpip.MemInfoOption{RcvQueued: len(data), RcvBufSize: tcp.DefaultBufferSize, SndBufSize: tcp.DefaultBufferSize}); mi != want {
+		t.Errorf("got MemInfoOption = %+v, want = %+v", mi, want)
+	}
+}
+
+func TestTCPInfo(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	c.CreateConnected(789, 30000, nil)
+
+	data := []byte{1, 2, 3}
+	view := buffer.NewView(len(data))
+	copy(view, data)
+
+	if _, _, err := c.EP.Write(tcpip.SlicePayload(view), tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	c.GetPacket()
+
+	// Acknowledge the data and send some.
+	c.SendPacket([]byte{4, 5}, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: c.Port,
+		Flags:   header.TCPFlagAck,
+		SeqNum:  790,
+		AckNum:  c.IRS.Add(1 + seqnum.Size(len(data))),
+		RcvWnd:  30000,
+	})
+	c.GetPacket()
+
+	var info tcpip.TCPInfoOption
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if err := c.EP.GetSockOpt(&info); err != nil {
+			t.Fatalf("GetSockOpt failed: %v", err)
+		}
+		if info.BytesReceived == 2 || time.Since(start) > 1*time.Second {
+			break
+		}
+	}
+
+	if info.State != tcpip.TCPStateEstablished {
+		t.Errorf("got State = %d, want = %d", info.State, tcpip.TCPStateEstablished)
+	}
+	if info.CAState != tcpip.TCPCAStateOpen {
+		t.Errorf("got CAState = %d, want = %d", info.CAState, tcpip.TCPCAStateOpen)
+	}
+	if info.BytesAcked != uint64(len(data)) {
+		t.Errorf("got BytesAcked = %d, want = %d", info.BytesAcked, len(data))
+	}
+	if info.BytesReceived != 2 {
+		t.Errorf("got BytesReceived = %d, want = 2", info.BytesReceived)
+	}
+	if info.DataSegsOut != 1 || info.DataSegsIn != 1 {
+		t.Errorf("got DataSegsOut = %d, DataSegsIn = %d, want = 1, 1", info.DataSegsOut, info.DataSegsIn)
+	}
+	if info.Unacked != 0 {
+		t.Errorf("got Unacked = %d, want = 0", info.Unacked)
+	}
+	if info.SndCwnd < tcp.InitialCwnd {
+		t.Errorf("got SndCwnd = %d, want >= %d", info.SndCwnd, tcp.InitialCwnd)
+	}
+	if info.LastDataSent.IsZero() || info.LastDataRecv.IsZero() || info.LastAckRecv.IsZero() {
+		t.Errorf("got LastDataSent = %v, LastDataRecv = %v, LastAckRecv = %v, want non-zero times", info.LastDataSent, info.LastDataRecv, info.LastAckRecv)
+	}
+	if info.SegsIn == 0 || info.SegsOut == 0 {
+		t.Errorf("got SegsIn = %d, SegsOut = %d, want non-zero counts", info.SegsIn, info.SegsOut)
+	}
+}
+
 func TestZeroWindowSend(t *testing.T) {
 	c := context.New(t, defaultMTU)
 	defer c.Cleanup()
@@ -3622,6 +3799,209 @@ func TestPathMTUDiscovery(t *testing.T) {
 	receivePackets(c, sizes, -1, uint32(c.IRS)+1)
 }
 
+// receiveSegments receives segments with the given payload sizes, starting at
+// sequence number seqNum, and returns the sequence number following them.
+func receiveSegments(t *testing.T, c *context.Context, sizes []int, seqNum uint32) uint32 {
+	t.Helper()
+	for _, size := range sizes {
+		checker.IPv4(t, c.GetPacket(),
+			checker.PayloadLen(size+header.TCPMinimumSize),
+			checker.TCP(
+				checker.DstPort(context.TestPort),
+				checker.SeqNum(seqNum),
+				checker.AckNum(790),
+				checker.TCPFlagsMatch(header.TCPFlagAck, ^uint8(header.TCPFlagPsh)),
+			),
+		)
+		seqNum += uint32(size)
+	}
+	return seqNum
+}
+
+func TestMTUProbingBlackHole(t *testing.T) {
+	// This test verifies that the stack reduces the segment size when
+	// full-sized segments are repeatedly lost without any ICMP packet
+	// indicating that the path MTU has been exceeded.
+	c := context.New(t, 1500)
+	defer c.Cleanup()
+
+	const maxPayload = 1500 - header.TCPMinimumSize - header.IPv4MinimumSize
+	c.CreateConnectedWithRawOptions(789, 30000, nil, []byte{
+		header.TCPOptionMSS, 4, byte(maxPayload / 256), byte(maxPayload % 256),
+	})
+
+	data := buffer.NewView(maxPayload)
+	if _, _, err := c.EP.Write(tcpip.SlicePayload(data), tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	// The segment and its first two retransmissions are lost. Sleep for
+	// most of each retransmit timeout, which doubles every time, so that
+	// GetPacket doesn't time out first.
+	seqNum := uint32(c.IRS) + 1
+	receiveSegments(t, c, []int{maxPayload}, seqNum)
+	rto := 1 * time.Second
+	for i := 0; i < 2; i++ {
+		time.Sleep(rto - 500*time.Millisecond)
+		receiveSegments(t, c, []int{maxPayload}, seqNum)
+		rto *= 2
+	}
+
+	// After the third timeout the segment is resent at the base MSS.
+	const baseMSS = 1024
+	time.Sleep(rto - 500*time.Millisecond)
+	next := receiveSegments(t, c, []int{baseMSS}, seqNum)
+	c.SendAck(790, baseMSS)
+	receiveSegments(t, c, []int{maxPayload - baseMSS}, next)
+}
+
+func TestMTUProbingAlways(t *testing.T) {
+	// This test verifies that the stack probes for larger segment sizes,
+	// and uses the probed size once a probe is acknowledged.
+	c := context.New(t, 1500)
+	defer c.Cleanup()
+
+	if err := c.Stack().SetTransportProtocolOption(tcp.ProtocolNumber, tcp.MTUProbingAlways); err != nil {
+		t.Fatalf("SetTransportProtocolOption(MTUProbingAlways) failed: %v", err)
+	}
+
+	const maxPayload = 1500 - header.TCPMinimumSize - header.IPv4MinimumSize
+	c.CreateConnectedWithRawOptions(789, 30000, nil, []byte{
+		header.TCPOptionMSS, 4, byte(maxPayload / 256), byte(maxPayload % 256),
+	})
+
+	data := buffer.NewView(20000)
+	if _, _, err := c.EP.Write(tcpip.SlicePayload(data), tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	// The first segment probes halfway between the base MSS and the MSS,
+	// followed by segments of the base MSS. The probe uses two packets of
+	// the congestion window.
+	const baseMSS = 1024
+	const probe = baseMSS + (maxPayload-baseMSS+1)/2
+	sizes := []int{probe}
+	for i := 0; i < tcp.InitialCwnd-2; i++ {
+		sizes = append(sizes, baseMSS)
+	}
+	next := receiveSegments(t, c, sizes, uint32(c.IRS)+1)
+	c.CheckNoPacketTimeout("More packets received than expected for this cwnd.", 50*time.Millisecond)
+
+	// Acknowledging the probe raises the segment size to the probed size,
+	// and the next probe searches the remaining range.
+	c.SendAck(790, int(next-uint32(c.IRS)-1))
+	const nextProbe = probe + (maxPayload-probe+1)/2
+	receiveSegments(t, c, []int{nextProbe, probe}, next)
+
+	if got, want := c.Stack().Stats().TCP.MTUProbes.Value(), uint64(2); got != want {
+		t.Errorf("got stats.TCP.MTUProbes.Value = %v, want = %v", got, want)
+	}
+}
+
+// checkMD5Signature checks that the TCP segment in the IPv4 packet b carries a
+// valid MD5 signature for key.
+func checkMD5Signature(t *testing.T, b []byte, key []byte) {
+	t.Helper()
+
+	h := header.TCP(header.IPv4(b).Payload())
+	sig := header.TCPMD5Option(h[header.TCPMinimumSize:h.DataOffset()])
+	if sig == nil {
+		t.Fatalf("segment has no MD5 signature option")
+	}
+	payload := buffer.NewViewFromBytes(h[h.DataOffset():]).ToVectorisedView()
+	if want := header.TCPMD5Signature(context.StackAddr, context.TestAddr, h[:h.DataOffset()], payload, key); !bytes.Equal(sig, want[:]) {
+		t.Fatalf("got MD5 signature %x, want %x", sig, want)
+	}
+}
+
+func TestMD5Signature(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	key := []byte("bgp-secret")
+	var err *tcpip.Error
+	c.EP, err = c.Stack().NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, &c.WQ)
+	if err != nil {
+		t.Fatalf("NewEndpoint failed: %v", err)
+	}
+	if err := c.EP.SetSockOpt(tcpip.TCPMD5SigOption{Addr: context.TestAddr, PrefixLen: 32, Key: key}); err != nil {
+		t.Fatalf("SetSockOpt(TCPMD5SigOption) failed: %v", err)
+	}
+
+	we, ch := waiter.NewChannelEntry(nil)
+	c.WQ.EventRegister(&we, waiter.EventOut)
+	defer c.WQ.EventUnregister(&we)
+
+	if err := c.EP.Connect(tcpip.FullAddress{Addr: context.TestAddr, Port: context.TestPort}); err != tcpip.ErrConnectStarted {
+		t.Fatalf("got c.EP.Connect(...) = %v, want = %v", err, tcpip.ErrConnectStarted)
+	}
+
+	// The SYN must be signed.
+	b := c.GetPacket()
+	checker.IPv4(t, b, checker.TCP(checker.TCPFlags(header.TCPFlagSyn)))
+	checkMD5Signature(t, b, key)
+	tcpHdr := header.TCP(header.IPv4(b).Payload())
+	c.IRS = seqnum.Value(tcpHdr.SequenceNumber())
+
+	md5Opts := func() []byte {
+		opts := make([]byte, 2+header.TCPMD5OptionSize)
+		opts[0], opts[1] = header.TCPOptionNOP, header.TCPOptionNOP
+		header.EncodeMD5Option(opts[2:])
+		return opts
+	}
+	iss := seqnum.Value(789)
+	synAck := func(opts, key []byte) {
+		c.SendPacket(nil, &context.Headers{
+			SrcPort: tcpHdr.DestinationPort(),
+			DstPort: tcpHdr.SourcePort(),
+			Flags:   header.TCPFlagSyn | header.TCPFlagAck,
+			SeqNum:  iss,
+			AckNum:  c.IRS.Add(1),
+			RcvWnd:  30000,
+			TCPOpts: opts,
+			MD5Key:  key,
+		})
+	}
+
+	// An unsigned SYN-ACK and one signed with the wrong key are dropped.
+	synAck(nil, nil)
+	synAck(md5Opts(), []byte("wrong-secret"))
+	c.CheckNoPacketTimeout("unexpected packet received in response to a SYN-ACK with a bad signature", 100*time.Millisecond)
+	if got, want := c.Stack().Stats().TCP.MD5Failures.Value(), uint64(2); got != want {
+		t.Errorf("got stats.TCP.MD5Failures.Value() = %d, want = %d", got, want)
+	}
+
+	// A correctly signed SYN-ACK completes the handshake.
+	synAck(md5Opts(), key)
+	b = c.GetPacket()
+	checker.IPv4(t, b,
+		checker.TCP(
+			checker.TCPFlags(header.TCPFlagAck),
+			checker.SeqNum(uint32(c.IRS)+1),
+			checker.AckNum(uint32(iss)+1),
+		),
+	)
+	checkMD5Signature(t, b, key)
+
+	select {
+	case <-ch:
+		if err := c.EP.GetSockOpt(tcpip.ErrorOption{}); err != nil {
+			t.Fatalf("GetSockOpt failed: %v", err)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatalf("Timed out waiting for connection")
+	}
+
+	// Data segments are signed too.
+	data := []byte{1, 2, 3}
+	if _, _, err := c.EP.Write(tcpip.SlicePayload(data), tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	b = c.GetPacket()
+	checker.IPv4(t, b, checker.PayloadLen(len(data)+header.TCPMinimumSize+2+header.TCPMD5OptionSize))
+	checkMD5Signature(t, b, key)
+}
+
 func TestTCPEndpointProbe(t *testing.T) {
 	c := context.New(t, 1500)
 	defer c.Cleanup()
@@ -3855,3 +4235,127 @@ func TestKeepalive(t *testing.T) {
 		t.Fatalf("got c.EP.Read(nil) = %v, want = %v", err, tcpip.ErrConnectionReset)
 	}
 }
+
+func TestBindToDevice(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	// Add a second NIC without any addresses or routes.
+	if err := c.Stack().CreateNamedNIC(2, "lo", loopback.New()); err != nil {
+		t.Fatalf("CreateNamedNIC failed: %v", err)
+	}
+
+	var wq waiter.Queue
+	ep, err := c.Stack().NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+	if err != nil {
+		t.Fatalf("NewEndpoint failed: %v", err)
+	}
+	defer ep.Close()
+
+	if err := ep.SetSockOpt(tcpip.BindToDeviceOption("lo")); err != nil {
+		t.Fatalf("SetSockOpt(BindToDeviceOption(lo)) failed: %v", err)
+	}
+	var v tcpip.BindToDeviceOption
+	if err := ep.GetSockOpt(&v); err != nil {
+		t.Fatalf("GetSockOpt failed: %v", err)
+	}
+	if v != "lo" {
+		t.Fatalf("got GetSockOpt(&BindToDeviceOption) = %q, want = %q", v, "lo")
+	}
+
+	// The address and routes of NIC 1 can't be used.
+	if err := ep.Bind(tcpip.FullAddress{Addr: context.StackAddr, Port: context.StackPort}); err != tcpip.ErrBadLocalAddress {
+		t.Fatalf("got ep.Bind(...) = %v, want = %v", err, tcpip.ErrBadLocalAddress)
+	}
+	if err := ep.Connect(tcpip.FullAddress{Addr: context.TestAddr, Port: context.TestPort}); err != tcpip.ErrNoRoute {
+		t.Fatalf("got ep.Connect(...) = %v, want = %v", err, tcpip.ErrNoRoute)
+	}
+
+	// Removing the restriction allows the connection.
+	if err := ep.SetSockOpt(tcpip.BindToDeviceOption("")); err != nil {
+		t.Fatalf("SetSockOpt(BindToDeviceOption()) failed: %v", err)
+	}
+	if err := ep.Connect(tcpip.FullAddress{Addr: context.TestAddr, Port: context.TestPort}); err != tcpip.ErrConnectStarted {
+		t.Fatalf("got ep.Connect(...) = %v, want = %v", err, tcpip.ErrConnectStarted)
+	}
+}
+
+func TestConnectICMPUnreachable(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	// Create TCP endpoint.
+	var err *tcpip.Error
+	c.EP, err = c.Stack().NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, &c.WQ)
+	if err != nil {
+		t.Fatalf("NewEndpoint failed: %v", err)
+	}
+
+	// Start connection attempt.
+	we, ch := waiter.NewChannelEntry(nil)
+	c.WQ.EventRegister(&we, waiter.EventOut)
+	defer c.WQ.EventUnregister(&we)
+
+	if err := c.EP.Connect(tcpip.FullAddress{Addr: context.TestAddr, Port: context.TestPort}); err != tcpip.ErrConnectStarted {
+		t.Fatalf("got c.EP.Connect(...) = %v, want = %v", err, tcpip.ErrConnectStarted)
+	}
+
+	// Receive SYN packet, and report it unreachable.
+	b := c.GetPacket()
+	checker.IPv4(t, b,
+		checker.TCP(
+			checker.DstPort(context.TestPort),
+			checker.TCPFlags(header.TCPFlagSyn),
+		),
+	)
+	c.SendICMPPacket(header.ICMPv4DstUnreachable, header.ICMPv4HostUnreachable, []byte{0, 0, 0, 0}, b, defaultMTU)
+
+	// The connection attempt fails without waiting for a retransmit.
+	select {
+	case <-ch:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatalf("Timed out waiting for the connection attempt to fail")
+	}
+	if err := c.EP.GetSockOpt(tcpip.ErrorOption{}); err != tcpip.ErrNoRoute {
+		t.Fatalf("GetSockOpt(ErrorOption) = %v, want %v", err, tcpip.ErrNoRoute)
+	}
+}
+
+func TestICMPUnreachableRecvErr(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	c.CreateConnected(789, 30000, nil)
+
+	// Unreachable errors aren't reported on an established connection
+	// unless asked for.
+	data := []byte{1, 2, 3}
+	view := buffer.NewView(len(data))
+	copy(view, data)
+	if _, _, err := c.EP.Write(tcpip.SlicePayload(view), tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	b := c.GetPacket()
+	c.SendICMPPacket(header.ICMPv4DstUnreachable, header.ICMPv4HostUnreachable, []byte{0, 0, 0, 0}, b, defaultMTU)
+	if err := c.EP.GetSockOpt(tcpip.ErrorOption{}); err != nil {
+		t.Fatalf("GetSockOpt(ErrorOption) = %v, want nil", err)
+	}
+
+	if err := c.EP.SetSockOpt(tcpip.RecvErrOption(1)); err != nil {
+		t.Fatalf("SetSockOpt failed: %v", err)
+	}
+
+	we, ch := waiter.NewChannelEntry(nil)
+	c.WQ.EventRegister(&we, waiter.EventErr)
+	defer c.WQ.EventUnregister(&we)
+
+	c.SendICMPPacket(header.ICMPv4DstUnreachable, header.ICMPv4HostUnreachable, []byte{0, 0, 0, 0}, b, defaultMTU)
+	select {
+	case <-ch:
+	case <-time.After(1 * time.Second):
+		t.Fatalf("Timed out waiting for the error")
+	}
+	if err := c.EP.GetSockOpt(tcpip.ErrorOption{}); err != tcpip.ErrNoRoute {
+		t.Fatalf("GetSockOpt(ErrorOption) = %v, want %v", err, tcpip.ErrNoRoute)
+	}
+}
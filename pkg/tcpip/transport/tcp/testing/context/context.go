@@ -103,6 +103,10 @@ type Headers struct {
 	// TCPOpts holds the options to be sent in the option field of the TCP
 	// header.
 	TCPOpts []byte
+
+	// MD5Key, if not nil, is the key used to fill in the MD5 signature
+	// option in TCPOpts.
+	MD5Key []byte
 }
 
 // Context provides an initialized Network stack and a link layer endpoint
@@ -326,6 +330,11 @@ func (c *Context) BuildSegment(payload []byte, h *Headers) buffer.VectorisedView
 		WindowSize: uint16(h.RcvWnd),
 	})
 
+	if h.MD5Key != nil {
+		sig := header.TCPMD5Signature(TestAddr, StackAddr, t[:t.DataOffset()], buffer.NewViewFromBytes(payload).ToVectorisedView(), h.MD5Key)
+		copy(header.TCPMD5Option(t[header.TCPMinimumSize:t.DataOffset()]), sig[:])
+	}
+
 	// Calculate the TCP pseudo-header checksum.
 	xsum := header.PseudoHeaderChecksum(tcp.ProtocolNumber, TestAddr, StackAddr, uint16(len(t)))
 
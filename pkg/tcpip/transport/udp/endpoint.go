@@ -68,6 +68,21 @@ type endpoint struct {
 	rcvBufSize    int
 	rcvClosed     bool
 
+	// filter is the socket filter attached by AttachFilterOption, and
+	// filterLocked is set once LockFilterOption locked it. They're
+	// protected by rcvMu.
+	filter       tcpip.SocketFilter
+	filterLocked bool
+
+	// lastError is the last error reported by ICMP, returned by the next
+	// read or write or by ErrorOption. errQueue holds the errors queued
+	// when recvErr is set, and errQueueSize the size of their payloads.
+	// They're protected by rcvMu, and are not saved as the errors they
+	// report are transient.
+	lastError    *tcpip.Error      `state:"nosave"`
+	errQueue     []tcpip.SockError `state:"nosave"`
+	errQueueSize int               `state:"nosave"`
+
 	// The following fields are protected by the mu mutex.
 	mu             sync.RWMutex `state:"nosave"`
 	sndBufSize     int
@@ -84,6 +99,11 @@ type endpoint struct {
 	multicastLoop  bool
 	reusePort      bool
 	broadcast      bool
+	recvErr        bool
+
+	// bindToDevice is the NIC set by BindToDeviceOption, or 0 if there is
+	// none.
+	bindToDevice tcpip.NICID
 
 	// shutdownFlags represent the current shutdown state of the endpoint.
 	shutdownFlags tcpip.ShutdownFlags
@@ -156,6 +176,8 @@ func (e *endpoint) Close() {
 		p := e.rcvList.Front()
 		e.rcvList.Remove(p)
 	}
+	e.errQueue = nil
+	e.errQueueSize = 0
 	e.rcvMu.Unlock()
 
 	e.route.Release()
@@ -173,6 +195,13 @@ func (e *endpoint) Close() {
 func (e *endpoint) Read(addr *tcpip.FullAddress) (buffer.View, tcpip.ControlMessages, *tcpip.Error) {
 	e.rcvMu.Lock()
 
+	// Like Linux, report a pending error before any pending data.
+	if err := e.lastError; err != nil {
+		e.lastError = nil
+		e.rcvMu.Unlock()
+		return buffer.View{}, tcpip.ControlMessages{}, err
+	}
+
 	if e.rcvList.Empty() {
 		err := tcpip.ErrWouldBlock
 		if e.rcvClosed {
@@ -195,6 +224,41 @@ func (e *endpoint) Read(addr *tcpip.FullAddress) (buffer.View, tcpip.ControlMess
 	return p.data.ToView(), tcpip.ControlMessages{HasTimestamp: true, Timestamp: p.timestamp}, nil
 }
 
+// ReadBatch implements tcpip.BatchEndpoint.ReadBatch.
+func (e *endpoint) ReadBatch(views []buffer.View, addrs []tcpip.FullAddress, cms []tcpip.ControlMessages) (int, *tcpip.Error) {
+	e.rcvMu.Lock()
+
+	if e.rcvList.Empty() {
+		err := tcpip.ErrWouldBlock
+		if e.rcvClosed {
+			err = tcpip.ErrClosedForReceive
+		}
+		e.rcvMu.Unlock()
+		return 0, err
+	}
+
+	// Dequeue the packets under the lock, but copy their data out of it.
+	var packets udpPacketList
+	n := 0
+	for ; n < len(views) && !e.rcvList.Empty(); n++ {
+		p := e.rcvList.Front()
+		e.rcvList.Remove(p)
+		e.rcvBufSize -= p.data.Size()
+		packets.PushBack(p)
+	}
+
+	e.rcvMu.Unlock()
+
+	i := 0
+	for p := packets.Front(); p != nil; p = p.Next() {
+		views[i] = p.data.ToView()
+		addrs[i] = p.senderAddress
+		cms[i] = tcpip.ControlMessages{HasTimestamp: true, Timestamp: p.timestamp}
+		i++
+	}
+	return n, nil
+}
+
 // prepareForWrite prepares the endpoint for sending data. In particular, it
 // binds it if it's still in the initial state. To do so, it must first
 // reacquire the mutex in exclusive mode.
@@ -265,18 +329,51 @@ func (e *endpoint) connectRoute(nicid tcpip.NICID, addr tcpip.FullAddress) (stac
 // Write writes data to the endpoint's peer. This method does not block
 // if the data cannot be written.
 func (e *endpoint) Write(p tcpip.Payload, opts tcpip.WriteOptions) (uintptr, <-chan struct{}, *tcpip.Error) {
+	if _, ch, err := e.write([]tcpip.Payload{p}, opts); err != nil {
+		return 0, ch, err
+	}
+	return uintptr(p.Size()), nil, nil
+}
+
+// WriteBatch implements tcpip.BatchEndpoint.WriteBatch.
+func (e *endpoint) WriteBatch(ps []tcpip.Payload, opts tcpip.WriteOptions) (int, <-chan struct{}, *tcpip.Error) {
+	return e.write(ps, opts)
+}
+
+// write writes the datagrams in ps to the same destination, preparing the
+// endpoint and looking up the route once for all of them. It returns the
+// number of datagrams written.
+func (e *endpoint) write(ps []tcpip.Payload, opts tcpip.WriteOptions) (int, <-chan struct{}, *tcpip.Error) {
 	// MSG_MORE is unimplemented. (This also means that MSG_EOR is a no-op.)
 	if opts.More {
 		return 0, nil, tcpip.ErrInvalidOptionValue
 	}
 
-	if p.Size() > math.MaxUint16 {
-		// Payload can't possibly fit in a packet.
-		return 0, nil, tcpip.ErrMessageTooLong
+	// Only write the datagrams before the first one that can't possibly
+	// fit in a packet.
+	var tooLong *tcpip.Error
+	for i, p := range ps {
+		if p.Size() > math.MaxUint16 {
+			if i == 0 {
+				return 0, nil, tcpip.ErrMessageTooLong
+			}
+			ps = ps[:i]
+			tooLong = tcpip.ErrMessageTooLong
+			break
+		}
 	}
 
 	to := opts.To
 
+	// Like Linux, fail the write with a pending error.
+	e.rcvMu.Lock()
+	err := e.lastError
+	e.lastError = nil
+	e.rcvMu.Unlock()
+	if err != nil {
+		return 0, nil, err
+	}
+
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
@@ -321,12 +418,12 @@ func (e *endpoint) Write(p tcpip.Payload, opts tcpip.WriteOptions) (uintptr, <-c
 		// Reject destination address if it goes through a different
 		// NIC than the endpoint was bound to.
 		nicid := to.NIC
-		if e.bindNICID != 0 {
-			if nicid != 0 && nicid != e.bindNICID {
+		if bound := e.boundNICLocked(); bound != 0 {
+			if nicid != 0 && nicid != bound {
 				return 0, nil, tcpip.ErrNoRoute
 			}
 
-			nicid = e.bindNICID
+			nicid = bound
 		}
 
 		if to.Addr == header.IPv4Broadcast && !e.broadcast {
@@ -356,20 +453,22 @@ func (e *endpoint) Write(p tcpip.Payload, opts tcpip.WriteOptions) (uintptr, <-c
 		}
 	}
 
-	v, err := p.Get(p.Size())
-	if err != nil {
-		return 0, nil, err
-	}
-
 	ttl := route.DefaultTTL()
 	if header.IsV4MulticastAddress(route.RemoteAddress) || header.IsV6MulticastAddress(route.RemoteAddress) {
 		ttl = e.multicastTTL
 	}
 
-	if err := sendUDP(route, buffer.View(v).ToVectorisedView(), e.id.LocalPort, dstPort, ttl); err != nil {
-		return 0, nil, err
+	for i, p := range ps {
+		v, err := p.Get(p.Size())
+		if err != nil {
+			return i, nil, err
+		}
+
+		if err := sendUDP(route, buffer.View(v).ToVectorisedView(), e.id.LocalPort, dstPort, ttl); err != nil {
+			return i, nil, err
+		}
 	}
-	return uintptr(len(v)), nil, nil
+	return len(ps), nil, tooLong
 }
 
 // Peek only returns data from a single datagram, so do nothing here.
@@ -380,6 +479,19 @@ func (e *endpoint) Peek([][]byte) (uintptr, tcpip.ControlMessages, *tcpip.Error)
 // SetSockOpt sets a socket option. Currently not supported.
 func (e *endpoint) SetSockOpt(opt interface{}) *tcpip.Error {
 	switch v := opt.(type) {
+	case tcpip.RecvErrOption:
+		e.mu.Lock()
+		e.recvErr = v != 0
+		e.mu.Unlock()
+
+		// Like Linux, drop the queued errors when the option is unset.
+		if v == 0 {
+			e.rcvMu.Lock()
+			e.errQueue = nil
+			e.errQueueSize = 0
+			e.rcvMu.Unlock()
+		}
+
 	case tcpip.V6OnlyOption:
 		// We only recognize this option on v6 endpoints.
 		if e.netProto != header.IPv6ProtocolNumber {
@@ -430,7 +542,7 @@ func (e *endpoint) SetSockOpt(opt interface{}) *tcpip.Error {
 			}
 		}
 
-		if e.bindNICID != 0 && e.bindNICID != nic {
+		if bound := e.boundNICLocked(); bound != 0 && bound != nic {
 			return tcpip.ErrInvalidEndpointState
 		}
 
@@ -458,14 +570,25 @@ func (e *endpoint) SetSockOpt(opt interface{}) *tcpip.Error {
 			return tcpip.ErrUnknownDevice
 		}
 
-		if err := e.stack.JoinGroup(e.netProto, nicID, v.MulticastAddr); err != nil {
-			return err
-		}
+		memToInsert := multicastMembership{nicID: nicID, multicastAddr: v.MulticastAddr}
 
 		e.mu.Lock()
 		defer e.mu.Unlock()
 
-		e.multicastMemberships = append(e.multicastMemberships, multicastMembership{nicID, v.MulticastAddr})
+		// Group joins are reference counted by the stack, so joining
+		// the same group twice on an endpoint must be rejected here,
+		// as Linux does.
+		for _, mem := range e.multicastMemberships {
+			if mem == memToInsert {
+				return tcpip.ErrPortInUse
+			}
+		}
+
+		if err := e.stack.JoinGroup(e.netProto, nicID, v.MulticastAddr); err != nil {
+			return err
+		}
+
+		e.multicastMemberships = append(e.multicastMemberships, memToInsert)
 
 	case tcpip.RemoveMembershipOption:
 		if !header.IsV4MulticastAddress(v.MulticastAddr) && !header.IsV6MulticastAddress(v.MulticastAddr) {
@@ -488,21 +611,30 @@ func (e *endpoint) SetSockOpt(opt interface{}) *tcpip.Error {
 			return tcpip.ErrUnknownDevice
 		}
 
-		if err := e.stack.LeaveGroup(e.netProto, nicID, v.MulticastAddr); err != nil {
-			return err
-		}
+		memToRemove := multicastMembership{nicID: nicID, multicastAddr: v.MulticastAddr}
+		memToRemoveIndex := -1
 
 		e.mu.Lock()
 		defer e.mu.Unlock()
+
+		// Only leave groups joined by this endpoint, so that the joins
+		// of other endpoints are left alone.
 		for i, mem := range e.multicastMemberships {
-			if mem.nicID == nicID && mem.multicastAddr == v.MulticastAddr {
-				// Only remove the first match, so that each added membership above is
-				// paired with exactly 1 removal.
-				e.multicastMemberships[i] = e.multicastMemberships[len(e.multicastMemberships)-1]
-				e.multicastMemberships = e.multicastMemberships[:len(e.multicastMemberships)-1]
+			if mem == memToRemove {
+				memToRemoveIndex = i
 				break
 			}
 		}
+		if memToRemoveIndex < 0 {
+			return tcpip.ErrBadLocalAddress
+		}
+
+		if err := e.stack.LeaveGroup(e.netProto, nicID, v.MulticastAddr); err != nil {
+			return err
+		}
+
+		e.multicastMemberships[memToRemoveIndex] = e.multicastMemberships[len(e.multicastMemberships)-1]
+		e.multicastMemberships = e.multicastMemberships[:len(e.multicastMemberships)-1]
 
 	case tcpip.MulticastLoopOption:
 		e.mu.Lock()
@@ -520,6 +652,50 @@ func (e *endpoint) SetSockOpt(opt interface{}) *tcpip.Error {
 		e.mu.Unlock()
 
 		return nil
+
+	case tcpip.BindToDeviceOption:
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		if v == "" {
+			e.bindToDevice = 0
+			return nil
+		}
+		nic := e.stack.FindNICByName(string(v))
+		if nic == 0 {
+			return tcpip.ErrUnknownDevice
+		}
+		e.bindToDevice = nic
+
+	case tcpip.AttachFilterOption:
+		e.rcvMu.Lock()
+		defer e.rcvMu.Unlock()
+
+		if e.filterLocked {
+			return tcpip.ErrNotPermitted
+		}
+		e.filter = v.Filter
+
+	case tcpip.DetachFilterOption:
+		e.rcvMu.Lock()
+		defer e.rcvMu.Unlock()
+
+		if e.filterLocked {
+			return tcpip.ErrNotPermitted
+		}
+		if e.filter == nil {
+			return tcpip.ErrNoSuchFile
+		}
+		e.filter = nil
+
+	case tcpip.LockFilterOption:
+		e.rcvMu.Lock()
+		defer e.rcvMu.Unlock()
+
+		if e.filterLocked && v == 0 {
+			return tcpip.ErrNotPermitted
+		}
+		e.filterLocked = v != 0
 	}
 	return nil
 }
@@ -528,6 +704,21 @@ func (e *endpoint) SetSockOpt(opt interface{}) *tcpip.Error {
 func (e *endpoint) GetSockOpt(opt interface{}) *tcpip.Error {
 	switch o := opt.(type) {
 	case tcpip.ErrorOption:
+		e.rcvMu.Lock()
+		err := e.lastError
+		e.lastError = nil
+		e.rcvMu.Unlock()
+		return err
+
+	case *tcpip.RecvErrOption:
+		e.mu.RLock()
+		v := e.recvErr
+		e.mu.RUnlock()
+
+		*o = 0
+		if v {
+			*o = 1
+		}
 		return nil
 
 	case *tcpip.SendBufferSizeOption:
@@ -542,6 +733,17 @@ func (e *endpoint) GetSockOpt(opt interface{}) *tcpip.Error {
 		e.rcvMu.Unlock()
 		return nil
 
+	case *tcpip.LockFilterOption:
+		e.rcvMu.Lock()
+		v := e.filterLocked
+		e.rcvMu.Unlock()
+
+		*o = 0
+		if v {
+			*o = 1
+		}
+		return nil
+
 	case *tcpip.V6OnlyOption:
 		// We only recognize this option on v6 endpoints.
 		if e.netProto != header.IPv6ProtocolNumber {
@@ -569,6 +771,25 @@ func (e *endpoint) GetSockOpt(opt interface{}) *tcpip.Error {
 		e.rcvMu.Unlock()
 		return nil
 
+	case *tcpip.SendQueueSizeOption:
+		// Datagrams are handed to the network layer as they are written,
+		// so none are ever queued.
+		*o = 0
+		return nil
+
+	case *tcpip.MemInfoOption:
+		e.rcvMu.Lock()
+		*o = tcpip.MemInfoOption{
+			RcvQueued:  e.rcvBufSize,
+			RcvBufSize: e.rcvBufSizeMax,
+		}
+		e.rcvMu.Unlock()
+
+		e.mu.RLock()
+		o.SndBufSize = e.sndBufSize
+		e.mu.RUnlock()
+		return nil
+
 	case *tcpip.MulticastTTLOption:
 		e.mu.Lock()
 		*o = tcpip.MulticastTTLOption(e.multicastTTL)
@@ -618,6 +839,17 @@ func (e *endpoint) GetSockOpt(opt interface{}) *tcpip.Error {
 		}
 		return nil
 
+	case *tcpip.BindToDeviceOption:
+		e.mu.RLock()
+		nic := e.bindToDevice
+		e.mu.RUnlock()
+
+		*o = ""
+		if nic != 0 {
+			*o = tcpip.BindToDeviceOption(e.stack.NICName(nic))
+		}
+		return nil
+
 	default:
 		return tcpip.ErrUnknownProtocolOption
 	}
@@ -693,23 +925,22 @@ func (e *endpoint) Connect(addr tcpip.FullAddress) *tcpip.Error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	nicid := addr.NIC
 	var localPort uint16
 	switch e.state {
 	case stateInitial:
 	case stateBound, stateConnected:
 		localPort = e.id.LocalPort
-		if e.bindNICID == 0 {
-			break
-		}
+	default:
+		return tcpip.ErrInvalidEndpointState
+	}
 
-		if nicid != 0 && nicid != e.bindNICID {
+	nicid := addr.NIC
+	if bound := e.boundNICLocked(); bound != 0 {
+		if nicid != 0 && nicid != bound {
 			return tcpip.ErrInvalidEndpointState
 		}
 
-		nicid = e.bindNICID
-	default:
-		return tcpip.ErrInvalidEndpointState
+		nicid = bound
 	}
 
 	r, nicid, netProto, err := e.connectRoute(nicid, addr)
@@ -804,6 +1035,16 @@ func (*endpoint) Accept() (tcpip.Endpoint, *waiter.Queue, *tcpip.Error) {
 	return nil, nil, tcpip.ErrNotSupported
 }
 
+// boundNICLocked returns the NIC the endpoint is restricted to, either because
+// it was bound to an address on that NIC or by BindToDeviceOption, or 0 if it
+// may use any NIC.
+func (e *endpoint) boundNICLocked() tcpip.NICID {
+	if e.bindNICID != 0 {
+		return e.bindNICID
+	}
+	return e.bindToDevice
+}
+
 func (e *endpoint) registerWithStack(nicid tcpip.NICID, netProtos []tcpip.NetworkProtocolNumber, id stack.TransportEndpointID) (stack.TransportEndpointID, *tcpip.Error) {
 	if e.id.LocalPort == 0 {
 		port, err := e.stack.ReservePort(netProtos, ProtocolNumber, id.LocalAddress, id.LocalPort, e.reusePort)
@@ -844,9 +1085,15 @@ func (e *endpoint) bindLocked(addr tcpip.FullAddress) *tcpip.Error {
 	}
 
 	nicid := addr.NIC
+	if e.bindToDevice != 0 {
+		if nicid != 0 && nicid != e.bindToDevice {
+			return tcpip.ErrBadLocalAddress
+		}
+		nicid = e.bindToDevice
+	}
 	if len(addr.Addr) != 0 {
 		// A local address was specified, verify that it's valid.
-		nicid = e.stack.CheckLocalAddress(addr.NIC, netProto, addr.Addr)
+		nicid = e.stack.CheckLocalAddress(nicid, netProto, addr.Addr)
 		if nicid == 0 {
 			return tcpip.ErrBadLocalAddress
 		}
@@ -926,15 +1173,22 @@ func (e *endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
 	// The endpoint is always writable.
 	result := waiter.EventOut & mask
 
+	e.rcvMu.Lock()
 	// Determine if the endpoint is readable if requested.
 	if (mask & waiter.EventIn) != 0 {
-		e.rcvMu.Lock()
 		if !e.rcvList.Empty() || e.rcvClosed {
 			result |= waiter.EventIn
 		}
-		e.rcvMu.Unlock()
 	}
 
+	// Determine if there's an error to report if requested.
+	if (mask & waiter.EventErr) != 0 {
+		if e.lastError != nil || len(e.errQueue) > 0 {
+			result |= waiter.EventErr
+		}
+	}
+	e.rcvMu.Unlock()
+
 	return result
 }
 
@@ -949,9 +1203,22 @@ func (e *endpoint) HandlePacket(r *stack.Route, id stack.TransportEndpointID, vv
 		return
 	}
 
+	e.rcvMu.Lock()
+
+	// The socket filter sees the UDP header, which isn't trimmed.
+	if e.filter != nil {
+		n := e.filter.Filter(vv)
+		if n == 0 {
+			e.rcvMu.Unlock()
+			return
+		}
+		if n < header.UDPMinimumSize {
+			n = header.UDPMinimumSize
+		}
+		vv.CapLength(n)
+	}
 	vv.TrimFront(header.UDPMinimumSize)
 
-	e.rcvMu.Lock()
 	e.stack.Stats().UDP.PacketsReceived.Increment()
 
 	// Drop the packet if our buffer is currently full.
@@ -987,4 +1254,109 @@ func (e *endpoint) HandlePacket(r *stack.Route, id stack.TransportEndpointID, vv
 
 // HandleControlPacket implements stack.TransportEndpoint.HandleControlPacket.
 func (e *endpoint) HandleControlPacket(id stack.TransportEndpointID, typ stack.ControlType, extra uint32, vv buffer.VectorisedView) {
+	serr, hard := controlError(id, typ, extra)
+	if serr.Err == nil {
+		return
+	}
+
+	e.mu.RLock()
+	recvErr := e.recvErr
+	connected := e.state == stateConnected
+	e.mu.RUnlock()
+
+	// Like Linux, only report hard errors to connected endpoints, unless
+	// they asked for all errors.
+	if !recvErr && (!hard || !connected) {
+		return
+	}
+
+	e.rcvMu.Lock()
+	if e.rcvClosed {
+		e.rcvMu.Unlock()
+		return
+	}
+	e.lastError = serr.Err
+	if recvErr {
+		// Skip the UDP header to return the datagram's payload.
+		if vv.Size() >= header.UDPMinimumSize {
+			vv.TrimFront(header.UDPMinimumSize)
+			serr.Payload = vv.ToView()
+		}
+		serr.NetProto = e.netProto
+		if e.errQueueSize+len(serr.Payload) <= e.rcvBufSizeMax {
+			e.errQueue = append(e.errQueue, serr)
+			e.errQueueSize += len(serr.Payload)
+		}
+	}
+	e.rcvMu.Unlock()
+
+	// Wake up blocked readers and writers, as Linux does.
+	e.waiterQueue.Notify(waiter.EventErr | waiter.EventIn | waiter.EventOut)
+}
+
+// controlError returns the error reported by a control packet for a datagram
+// sent to id's remote address, and whether it's a hard error that Linux
+// reports to connected endpoints even if they didn't set RecvErrOption.
+func controlError(id stack.TransportEndpointID, typ stack.ControlType, extra uint32) (tcpip.SockError, bool) {
+	serr := tcpip.SockError{
+		Origin: tcpip.SockErrOriginICMP,
+		Type:   uint8(header.ICMPv4DstUnreachable),
+		Dst:    tcpip.FullAddress{Addr: id.RemoteAddress, Port: id.RemotePort},
+	}
+	v6 := len(id.RemoteAddress) == header.IPv6AddressSize
+	if v6 {
+		serr.Origin = tcpip.SockErrOriginICMP6
+		serr.Type = uint8(header.ICMPv6DstUnreachable)
+	}
+
+	switch typ {
+	case stack.ControlPortUnreachable:
+		serr.Err = tcpip.ErrConnectionRefused
+		serr.Code = header.ICMPv4PortUnreachable
+		if v6 {
+			serr.Code = header.ICMPv6PortUnreachable
+		}
+		return serr, true
+
+	case stack.ControlNetworkUnreachable:
+		serr.Err = tcpip.ErrNetworkUnreachable
+		serr.Code = header.ICMPv4NetUnreachable
+		if v6 {
+			serr.Code = header.ICMPv6NetworkUnreachable
+		}
+
+	case stack.ControlHostUnreachable:
+		serr.Err = tcpip.ErrNoRoute
+		serr.Code = header.ICMPv4HostUnreachable
+		if v6 {
+			serr.Code = header.ICMPv6AddressUnreachable
+		}
+
+	case stack.ControlPacketTooBig:
+		// extra is the MTU available to the transport protocol; report
+		// the path MTU, as ICMP does.
+		serr.Err = tcpip.ErrMessageTooLong
+		serr.Code = header.ICMPv4FragmentationNeeded
+		serr.Info = extra + header.IPv4MinimumSize
+		if v6 {
+			serr.Type = uint8(header.ICMPv6PacketTooBig)
+			serr.Code = 0
+			serr.Info = extra + header.IPv6MinimumSize
+		}
+	}
+	return serr, false
+}
+
+// ReadErrQueue implements tcpip.ErrQueueEndpoint.ReadErrQueue.
+func (e *endpoint) ReadErrQueue() (tcpip.SockError, *tcpip.Error) {
+	e.rcvMu.Lock()
+	defer e.rcvMu.Unlock()
+
+	if len(e.errQueue) == 0 {
+		return tcpip.SockError{}, tcpip.ErrWouldBlock
+	}
+	serr := e.errQueue[0]
+	e.errQueue = e.errQueue[1:]
+	e.errQueueSize -= len(serr.Payload)
+	return serr, nil
 }
@@ -16,6 +16,7 @@ package udp_test
 
 import (
 	"bytes"
+	"encoding/binary"
 	"math"
 	"math/rand"
 	"testing"
@@ -1005,3 +1006,385 @@ func TestTTL(t *testing.T) {
 		})
 	}
 }
+
+func TestBindToDevice(t *testing.T) {
+	c := newDualTestContext(t, defaultMTU)
+	defer c.cleanup()
+
+	// Add a second NIC without any routes.
+	id, _ := channel.New(256, defaultMTU, "")
+	if err := c.s.CreateNamedNIC(2, "eth1", id); err != nil {
+		c.t.Fatalf("CreateNamedNIC failed: %v", err)
+	}
+
+	var err *tcpip.Error
+	c.ep, err = c.s.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &c.wq)
+	if err != nil {
+		c.t.Fatalf("NewEndpoint failed: %v", err)
+	}
+
+	if err := c.ep.SetSockOpt(tcpip.BindToDeviceOption("eth2")); err != tcpip.ErrUnknownDevice {
+		c.t.Fatalf("SetSockOpt(BindToDeviceOption(eth2)) = %v, want %v", err, tcpip.ErrUnknownDevice)
+	}
+	if err := c.ep.SetSockOpt(tcpip.BindToDeviceOption("eth1")); err != nil {
+		c.t.Fatalf("SetSockOpt(BindToDeviceOption(eth1)) failed: %v", err)
+	}
+	var v tcpip.BindToDeviceOption
+	if err := c.ep.GetSockOpt(&v); err != nil {
+		c.t.Fatalf("GetSockOpt failed: %v", err)
+	}
+	if v != "eth1" {
+		c.t.Fatalf("GetSockOpt(&BindToDeviceOption) = %q, want %q", v, "eth1")
+	}
+
+	// The address of NIC 1 can't be used.
+	if err := c.ep.Bind(tcpip.FullAddress{Addr: stackAddr, Port: stackPort}); err != tcpip.ErrBadLocalAddress {
+		c.t.Fatalf("Bind(%v) = %v, want %v", stackAddr, err, tcpip.ErrBadLocalAddress)
+	}
+	if err := c.ep.Bind(tcpip.FullAddress{Port: stackPort}); err != nil {
+		c.t.Fatalf("Bind failed: %v", err)
+	}
+
+	// Packets received on NIC 1 aren't delivered to the endpoint.
+	c.sendPacket(newPayload(), &headers{
+		srcPort: testPort,
+		dstPort: stackPort,
+	})
+	if _, _, err := c.ep.Read(nil); err != tcpip.ErrWouldBlock {
+		c.t.Fatalf("Read() = %v, want %v", err, tcpip.ErrWouldBlock)
+	}
+
+	// The routes through NIC 1 can't be used either.
+	payload := buffer.View(newPayload())
+	if _, _, err := c.ep.Write(tcpip.SlicePayload(payload), tcpip.WriteOptions{
+		To: &tcpip.FullAddress{Addr: testAddr, Port: testPort},
+	}); err != tcpip.ErrNoRoute {
+		c.t.Fatalf("Write() = %v, want %v", err, tcpip.ErrNoRoute)
+	}
+}
+
+// testFilter is a socket filter implemented by a function.
+type testFilter func(pkt buffer.VectorisedView) int
+
+// Filter implements tcpip.SocketFilter.Filter.
+func (f testFilter) Filter(pkt buffer.VectorisedView) int {
+	return f(pkt)
+}
+
+func TestSocketFilter(t *testing.T) {
+	c := newDualTestContext(t, defaultMTU)
+	defer c.cleanup()
+
+	var err *tcpip.Error
+	c.ep, err = c.s.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &c.wq)
+	if err != nil {
+		c.t.Fatalf("NewEndpoint failed: %v", err)
+	}
+	if err := c.ep.Bind(tcpip.FullAddress{Port: stackPort}); err != nil {
+		c.t.Fatalf("Bind failed: %v", err)
+	}
+
+	if err := c.ep.SetSockOpt(tcpip.DetachFilterOption{}); err != tcpip.ErrNoSuchFile {
+		c.t.Fatalf("SetSockOpt(DetachFilterOption{}) = %v, want %v", err, tcpip.ErrNoSuchFile)
+	}
+
+	// The filter drops packets whose payload starts with 0, and delivers
+	// the first 4 bytes of the payload of the others.
+	filter := testFilter(func(pkt buffer.VectorisedView) int {
+		if v := pkt.ToView(); v[header.UDPMinimumSize] == 0 {
+			return 0
+		}
+		return header.UDPMinimumSize + 4
+	})
+	if err := c.ep.SetSockOpt(tcpip.AttachFilterOption{Filter: filter}); err != nil {
+		c.t.Fatalf("SetSockOpt(AttachFilterOption) failed: %v", err)
+	}
+
+	h := &headers{
+		srcPort: testPort,
+		dstPort: stackPort,
+	}
+	c.sendPacket([]byte{0, 1, 2, 3, 4, 5}, h)
+	c.sendPacket([]byte{1, 2, 3, 4, 5, 6}, h)
+
+	v, _, err := c.ep.Read(nil)
+	if err != nil {
+		c.t.Fatalf("Read failed: %v", err)
+	}
+	if want := []byte{1, 2, 3, 4}; !bytes.Equal(v, want) {
+		c.t.Fatalf("got data = %v, want = %v", v, want)
+	}
+	if _, _, err := c.ep.Read(nil); err != tcpip.ErrWouldBlock {
+		c.t.Fatalf("Read() = %v, want %v", err, tcpip.ErrWouldBlock)
+	}
+
+	// Once locked, the filter can't be changed.
+	if err := c.ep.SetSockOpt(tcpip.LockFilterOption(1)); err != nil {
+		c.t.Fatalf("SetSockOpt(LockFilterOption(1)) failed: %v", err)
+	}
+	var locked tcpip.LockFilterOption
+	if err := c.ep.GetSockOpt(&locked); err != nil {
+		c.t.Fatalf("GetSockOpt failed: %v", err)
+	}
+	if locked != 1 {
+		c.t.Fatalf("GetSockOpt(&LockFilterOption) = %d, want 1", locked)
+	}
+	if err := c.ep.SetSockOpt(tcpip.DetachFilterOption{}); err != tcpip.ErrNotPermitted {
+		c.t.Fatalf("SetSockOpt(DetachFilterOption{}) = %v, want %v", err, tcpip.ErrNotPermitted)
+	}
+	if err := c.ep.SetSockOpt(tcpip.AttachFilterOption{Filter: filter}); err != tcpip.ErrNotPermitted {
+		c.t.Fatalf("SetSockOpt(AttachFilterOption) = %v, want %v", err, tcpip.ErrNotPermitted)
+	}
+	if err := c.ep.SetSockOpt(tcpip.LockFilterOption(0)); err != tcpip.ErrNotPermitted {
+		c.t.Fatalf("SetSockOpt(LockFilterOption(0)) = %v, want %v", err, tcpip.ErrNotPermitted)
+	}
+}
+
+func TestReadBatch(t *testing.T) {
+	c := newDualTestContext(t, defaultMTU)
+	defer c.cleanup()
+
+	var err *tcpip.Error
+	c.ep, err = c.s.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &c.wq)
+	if err != nil {
+		c.t.Fatalf("NewEndpoint failed: %v", err)
+	}
+	if err := c.ep.Bind(tcpip.FullAddress{Port: stackPort}); err != nil {
+		c.t.Fatalf("Bind failed: %v", err)
+	}
+	be := c.ep.(tcpip.BatchEndpoint)
+
+	views := make([]buffer.View, 2)
+	addrs := make([]tcpip.FullAddress, 2)
+	cms := make([]tcpip.ControlMessages, 2)
+	if _, err := be.ReadBatch(views, addrs, cms); err != tcpip.ErrWouldBlock {
+		c.t.Fatalf("ReadBatch() = %v, want %v", err, tcpip.ErrWouldBlock)
+	}
+
+	h := &headers{
+		srcPort: testPort,
+		dstPort: stackPort,
+	}
+	payloads := [][]byte{{1}, {2}, {3}}
+	for _, p := range payloads {
+		c.sendPacket(p, h)
+	}
+
+	// The first batch is limited by the length of views, the second by the
+	// number of pending datagrams.
+	for _, want := range [][][]byte{payloads[:2], payloads[2:]} {
+		n, err := be.ReadBatch(views, addrs, cms)
+		if err != nil {
+			c.t.Fatalf("ReadBatch failed: %v", err)
+		}
+		if n != len(want) {
+			c.t.Fatalf("ReadBatch() = %d, want %d", n, len(want))
+		}
+		for i := 0; i < n; i++ {
+			if !bytes.Equal(views[i], want[i]) {
+				c.t.Errorf("got datagram %d = %v, want = %v", i, views[i], want[i])
+			}
+			if addrs[i].Addr != testAddr || addrs[i].Port != testPort {
+				c.t.Errorf("got sender %d = %+v, want = %v:%d", i, addrs[i], testAddr, testPort)
+			}
+			if !cms[i].HasTimestamp {
+				c.t.Errorf("got datagram %d without timestamp", i)
+			}
+		}
+	}
+}
+
+func TestWriteBatch(t *testing.T) {
+	c := newDualTestContext(t, defaultMTU)
+	defer c.cleanup()
+
+	var err *tcpip.Error
+	c.ep, err = c.s.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &c.wq)
+	if err != nil {
+		c.t.Fatalf("NewEndpoint failed: %v", err)
+	}
+	be := c.ep.(tcpip.BatchEndpoint)
+
+	// The datagram that can't fit in a packet stops the batch.
+	ps := []tcpip.Payload{
+		tcpip.SlicePayload{1},
+		tcpip.SlicePayload{2},
+		tcpip.SlicePayload(make([]byte, math.MaxUint16+1)),
+		tcpip.SlicePayload{3},
+	}
+	n, _, err := be.WriteBatch(ps, tcpip.WriteOptions{
+		To: &tcpip.FullAddress{Addr: testAddr, Port: testPort},
+	})
+	if n != 2 || err != tcpip.ErrMessageTooLong {
+		c.t.Fatalf("WriteBatch() = %d, %v, want 2, %v", n, err, tcpip.ErrMessageTooLong)
+	}
+
+	for _, want := range ps[:2] {
+		b := c.getPacket(ipv4.ProtocolNumber, false)
+		checker.IPv4(c.t, b,
+			checker.UDP(
+				checker.DstPort(testPort),
+			),
+		)
+		udp := header.UDP(header.IPv4(b).Payload())
+		if got := udp.Payload(); !bytes.Equal(got, want.(tcpip.SlicePayload)) {
+			c.t.Errorf("Bad payload: got %x, want %x", got, want)
+		}
+	}
+}
+
+// sendICMPError injects an ICMP destination unreachable error for the IPv4
+// packet orig.
+func (c *testContext) sendICMPError(code byte, mtu uint16, orig []byte) {
+	buf := buffer.NewView(header.IPv4MinimumSize + header.ICMPv4DstUnreachableMinimumSize + len(orig))
+	copy(buf[header.IPv4MinimumSize+header.ICMPv4DstUnreachableMinimumSize:], orig)
+
+	// Initialize the IP header.
+	ip := header.IPv4(buf)
+	ip.Encode(&header.IPv4Fields{
+		IHL:         header.IPv4MinimumSize,
+		TotalLength: uint16(len(buf)),
+		TTL:         65,
+		Protocol:    uint8(header.ICMPv4ProtocolNumber),
+		SrcAddr:     testAddr,
+		DstAddr:     stackAddr,
+	})
+	ip.SetChecksum(^ip.CalculateChecksum())
+
+	// Initialize the ICMP header.
+	icmp := header.ICMPv4(buf[header.IPv4MinimumSize:])
+	icmp.SetType(header.ICMPv4DstUnreachable)
+	icmp.SetCode(code)
+	binary.BigEndian.PutUint16(icmp[header.ICMPv4DstUnreachableMinimumSize-2:], mtu)
+	icmp.SetChecksum(^header.Checksum(icmp, 0))
+
+	// Inject packet.
+	c.linkEP.Inject(ipv4.ProtocolNumber, buf.ToVectorisedView())
+}
+
+func TestICMPErrorConnected(t *testing.T) {
+	c := newDualTestContext(t, defaultMTU)
+	defer c.cleanup()
+
+	var err *tcpip.Error
+	c.ep, err = c.s.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &c.wq)
+	if err != nil {
+		c.t.Fatalf("NewEndpoint failed: %v", err)
+	}
+	if err := c.ep.Connect(tcpip.FullAddress{Addr: testAddr, Port: testPort}); err != nil {
+		c.t.Fatalf("Connect failed: %v", err)
+	}
+
+	// Soft errors aren't reported unless RecvErrOption is set.
+	if _, _, err := c.ep.Write(tcpip.SlicePayload(newPayload()), tcpip.WriteOptions{}); err != nil {
+		c.t.Fatalf("Write failed: %v", err)
+	}
+	c.sendICMPError(header.ICMPv4HostUnreachable, 0, c.getPacket(ipv4.ProtocolNumber, false))
+	if _, _, err := c.ep.Read(nil); err != tcpip.ErrWouldBlock {
+		c.t.Fatalf("Read() = %v, want %v", err, tcpip.ErrWouldBlock)
+	}
+
+	// Hard errors are reported to connected endpoints, once.
+	we, ch := waiter.NewChannelEntry(nil)
+	c.wq.EventRegister(&we, waiter.EventErr)
+	defer c.wq.EventUnregister(&we)
+
+	if _, _, err := c.ep.Write(tcpip.SlicePayload(newPayload()), tcpip.WriteOptions{}); err != nil {
+		c.t.Fatalf("Write failed: %v", err)
+	}
+	c.sendICMPError(header.ICMPv4PortUnreachable, 0, c.getPacket(ipv4.ProtocolNumber, false))
+	select {
+	case <-ch:
+	case <-time.After(2 * time.Second):
+		c.t.Fatalf("Timed out waiting for the error")
+	}
+	if _, _, err := c.ep.Read(nil); err != tcpip.ErrConnectionRefused {
+		c.t.Fatalf("Read() = %v, want %v", err, tcpip.ErrConnectionRefused)
+	}
+	if _, _, err := c.ep.Read(nil); err != tcpip.ErrWouldBlock {
+		c.t.Fatalf("Read() = %v, want %v", err, tcpip.ErrWouldBlock)
+	}
+
+	// Nothing is queued on the error queue.
+	if _, err := c.ep.(tcpip.ErrQueueEndpoint).ReadErrQueue(); err != tcpip.ErrWouldBlock {
+		c.t.Fatalf("ReadErrQueue() = %v, want %v", err, tcpip.ErrWouldBlock)
+	}
+}
+
+func TestICMPErrorQueue(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		code byte
+		mtu  uint16
+		want tcpip.SockError
+	}{
+		{
+			name: "port unreachable",
+			code: header.ICMPv4PortUnreachable,
+			want: tcpip.SockError{
+				Err:  tcpip.ErrConnectionRefused,
+				Code: header.ICMPv4PortUnreachable,
+			},
+		},
+		{
+			name: "fragmentation needed",
+			code: header.ICMPv4FragmentationNeeded,
+			mtu:  1280,
+			want: tcpip.SockError{
+				Err:  tcpip.ErrMessageTooLong,
+				Code: header.ICMPv4FragmentationNeeded,
+				Info: 1280,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newDualTestContext(t, defaultMTU)
+			defer c.cleanup()
+
+			var err *tcpip.Error
+			c.ep, err = c.s.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &c.wq)
+			if err != nil {
+				c.t.Fatalf("NewEndpoint failed: %v", err)
+			}
+			if err := c.ep.SetSockOpt(tcpip.RecvErrOption(1)); err != nil {
+				c.t.Fatalf("SetSockOpt failed: %v", err)
+			}
+
+			payload := newPayload()
+			if _, _, err := c.ep.Write(tcpip.SlicePayload(payload), tcpip.WriteOptions{
+				To: &tcpip.FullAddress{Addr: testAddr, Port: testPort},
+			}); err != nil {
+				c.t.Fatalf("Write failed: %v", err)
+			}
+			c.sendICMPError(tc.code, tc.mtu, c.getPacket(ipv4.ProtocolNumber, false))
+
+			// The error is reported once by ErrorOption, and
+			// queued on the error queue.
+			if err := c.ep.GetSockOpt(tcpip.ErrorOption{}); err != tc.want.Err {
+				c.t.Fatalf("GetSockOpt(ErrorOption) = %v, want %v", err, tc.want.Err)
+			}
+			if err := c.ep.GetSockOpt(tcpip.ErrorOption{}); err != nil {
+				c.t.Fatalf("GetSockOpt(ErrorOption) = %v, want nil", err)
+			}
+
+			qe := c.ep.(tcpip.ErrQueueEndpoint)
+			serr, err := qe.ReadErrQueue()
+			if err != nil {
+				c.t.Fatalf("ReadErrQueue failed: %v", err)
+			}
+			if serr.Err != tc.want.Err || serr.Origin != tcpip.SockErrOriginICMP || serr.Type != uint8(header.ICMPv4DstUnreachable) || serr.Code != tc.want.Code || serr.Info != tc.want.Info {
+				c.t.Errorf("ReadErrQueue() = %+v, want %+v", serr, tc.want)
+			}
+			if want := (tcpip.FullAddress{Addr: testAddr, Port: testPort}); serr.Dst != want {
+				c.t.Errorf("Bad destination: got %+v, want %+v", serr.Dst, want)
+			}
+			if !bytes.Equal(serr.Payload, payload) {
+				c.t.Errorf("Bad payload: got %x, want %x", serr.Payload, payload)
+			}
+
+			if _, err := qe.ReadErrQueue(); err != tcpip.ErrWouldBlock {
+				c.t.Fatalf("ReadErrQueue() = %v, want %v", err, tcpip.ErrWouldBlock)
+			}
+		})
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/log"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
 	rpb "gvisor.googlesource.com/gvisor/pkg/sentry/arch/registers_go_proto"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
 	ucspb "gvisor.googlesource.com/gvisor/pkg/sentry/kernel/uncaught_signal_go_proto"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/strace"
 	spb "gvisor.googlesource.com/gvisor/pkg/sentry/unimpl/unimplemented_syscall_go_proto"
@@ -94,24 +95,9 @@ func (c *compatEmitter) emitUnimplementedSyscall(us *spb.UnimplementedSyscall) {
 	sysnr := regs.OrigRax
 	tr := c.trackers[sysnr]
 	if tr == nil {
-		switch sysnr {
-		case syscall.SYS_PRCTL, syscall.SYS_ARCH_PRCTL:
-			// args: cmd, ...
-			tr = newArgsTracker(0)
-
-		case syscall.SYS_IOCTL, syscall.SYS_EPOLL_CTL, syscall.SYS_SHMCTL, syscall.SYS_FUTEX:
-			// args: fd/addr, cmd, ...
-			tr = newArgsTracker(1)
-
-		case syscall.SYS_GETSOCKOPT, syscall.SYS_SETSOCKOPT:
-			// args: fd, level, name, ...
-			tr = newArgsTracker(1, 2)
-
-		case syscall.SYS_SEMCTL:
-			// args: semid, semnum, cmd, ...
-			tr = newArgsTracker(2)
-
-		default:
+		if idx := kernel.UnimplementedSyscallArgs(uintptr(sysnr)); len(idx) > 0 {
+			tr = newArgsTracker(idx...)
+		} else {
 			tr = &onceTracker{}
 		}
 		c.trackers[sysnr] = tr
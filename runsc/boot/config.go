@@ -18,7 +18,10 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
+	"gvisor.googlesource.com/gvisor/pkg/cpuid"
+	"gvisor.googlesource.com/gvisor/pkg/log"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/watchdog"
 )
 
@@ -134,6 +137,96 @@ func (n NetworkType) String() string {
 	}
 }
 
+// VsyscallMode tells how calls to the legacy vsyscall page are handled.
+type VsyscallMode int
+
+const (
+	// VsyscallEmulate traps calls to the vsyscall page and services them as
+	// the corresponding system calls.
+	VsyscallEmulate VsyscallMode = iota
+
+	// VsyscallNone makes calls to the vsyscall page fault with SIGSEGV.
+	VsyscallNone
+)
+
+// MakeVsyscallMode converts mode from string.
+func MakeVsyscallMode(s string) (VsyscallMode, error) {
+	switch s {
+	case "emulate":
+		return VsyscallEmulate, nil
+	case "none":
+		return VsyscallNone, nil
+	default:
+		return 0, fmt.Errorf("invalid vsyscall mode %q", s)
+	}
+}
+
+func (v VsyscallMode) String() string {
+	switch v {
+	case VsyscallEmulate:
+		return "emulate"
+	case VsyscallNone:
+		return "none"
+	default:
+		return fmt.Sprintf("unknown(%d)", v)
+	}
+}
+
+// MmapLayoutMode selects the default layout of application address spaces.
+type MmapLayoutMode int
+
+const (
+	// MmapLayoutModern allocates mappings top-down from below the stack.
+	MmapLayoutModern MmapLayoutMode = iota
+
+	// MmapLayoutLegacy allocates mappings bottom-up from a third of the
+	// address space, as for Linux's vm.legacy_va_layout.
+	MmapLayoutLegacy
+)
+
+// MakeMmapLayoutMode converts mode from string.
+func MakeMmapLayoutMode(s string) (MmapLayoutMode, error) {
+	switch s {
+	case "modern":
+		return MmapLayoutModern, nil
+	case "legacy":
+		return MmapLayoutLegacy, nil
+	default:
+		return 0, fmt.Errorf("invalid mmap layout %q", s)
+	}
+}
+
+func (m MmapLayoutMode) String() string {
+	switch m {
+	case MmapLayoutModern:
+		return "modern"
+	case MmapLayoutLegacy:
+		return "legacy"
+	default:
+		return fmt.Sprintf("unknown(%d)", m)
+	}
+}
+
+// Bounds of Config.MmapRandBits, from CONFIG_ARCH_MMAP_RND_BITS_{MIN,MAX} for
+// x86_64 in Linux.
+const (
+	minMmapRandBits = 28
+	maxMmapRandBits = 32
+)
+
+// MakeMmapRandBits converts the number of bits of mmap randomization from
+// string.
+func MakeMmapRandBits(s string) (uint, error) {
+	n, err := strconv.ParseUint(s, 10, 0)
+	if err != nil {
+		return 0, err
+	}
+	if n < minMmapRandBits || n > maxMmapRandBits {
+		return 0, fmt.Errorf("mmap randomization bits %d outside of [%d, %d]", n, minMmapRandBits, maxMmapRandBits)
+	}
+	return uint(n), nil
+}
+
 // MakeWatchdogAction converts type from string.
 func MakeWatchdogAction(s string) (watchdog.Action, error) {
 	switch strings.ToLower(s) {
@@ -141,6 +234,8 @@ func MakeWatchdogAction(s string) (watchdog.Action, error) {
 		return watchdog.LogWarning, nil
 	case "panic":
 		return watchdog.Panic, nil
+	case "dump":
+		return watchdog.Dump, nil
 	default:
 		return 0, fmt.Errorf("invalid watchdog action %q", s)
 	}
@@ -172,18 +267,80 @@ type Config struct {
 	// Overlay is whether to wrap the root filesystem in an overlay.
 	Overlay bool
 
+	// FSGoferHostUDS allows applications to connect to host unix domain
+	// sockets, such as those bind mounted into the container, through the
+	// gofer.
+	FSGoferHostUDS bool
+
+	// FSGoferHostUDSFDs allows applications to receive file descriptors
+	// (SCM_RIGHTS) over host unix domain sockets connected through the
+	// gofer. Otherwise, they are closed upon receipt.
+	FSGoferHostUDSFDs bool
+
+	// FSGoferHostUDSSendFDs allows applications to send file descriptors
+	// (SCM_RIGHTS) over host unix domain sockets connected through the
+	// gofer. Only regular files backed by host file descriptors and sealed
+	// memfds can be sent.
+	FSGoferHostUDSSendFDs bool
+
+	// FSGoferCoalesceSync coalesces concurrent syncs of the same file
+	// through the gofer into a single sync of the host file.
+	FSGoferCoalesceSync bool
+
 	// Network indicates what type of network to use.
 	Network NetworkType
 
 	// GSO indicates that generic segmentation offload is enabled.
 	GSO bool
 
+	// NDP indicates that IPv6 neighbor discovery, i.e. router discovery,
+	// stateless address autoconfiguration and duplicate address
+	// detection, is enabled on sandbox interfaces.
+	NDP bool
+
+	// NetBusyPoll is the time for which sandbox interfaces busy-poll their
+	// host FD after receiving a packet. 0 disables busy-polling.
+	NetBusyPoll time.Duration
+
+	// NumNetworkChannels is the number of FDs, each read by its own
+	// goroutine, of each sandbox interface.
+	NumNetworkChannels int
+
+	// NetRestore indicates that the network environment of the sandbox,
+	// its interfaces, addresses and routes, is preserved across checkpoint
+	// and restore, so that TCP connections through sandbox interfaces are
+	// saved and restored rather than rejecting the checkpoint.
+	NetRestore bool
+
 	// LogPackets indicates that all network packets should be logged.
 	LogPackets bool
 
 	// Platform is the platform to run on.
 	Platform PlatformType
 
+	// KVMPinCPUs indicates that the KVM platform should restrict the host
+	// threads executing application code to the host CPUs corresponding to
+	// each task's CPU affinity.
+	KVMPinCPUs bool
+
+	// Vsyscall indicates how calls to the legacy vsyscall page are handled.
+	Vsyscall VsyscallMode
+
+	// MmapRandBits is the number of bits of page-granular randomization
+	// applied to the address space layout, as for Linux's vm.mmap_rnd_bits.
+	MmapRandBits uint
+
+	// MmapLayout selects the default address space layout.
+	MmapLayout MmapLayoutMode
+
+	// HostMLock indicates that application memory locked by mlock(2),
+	// mlockall(2), or MAP_LOCKED is also locked into host memory.
+	HostMLock bool
+
+	// CPUFeatures adds and removes CPU features exposed to the sandbox
+	// relative to the host. See cpuid.FeatureSet.ApplySpec for the format.
+	CPUFeatures string
+
 	// Strace indicates that strace should be enabled.
 	Strace bool
 
@@ -201,6 +358,15 @@ type Config struct {
 	// WatchdogAction sets what action the watchdog takes when triggered.
 	WatchdogAction watchdog.Action
 
+	// WatchdogTimeout is the time a task may run the same syscall without
+	// blocking before the watchdog considers it stuck. 0 disables the
+	// watchdog.
+	WatchdogTimeout time.Duration
+
+	// WatchdogDumpDir is the directory where the Dump watchdog action
+	// writes diagnostics.
+	WatchdogDumpDir string
+
 	// PanicSignal registers signal handling that panics. Usually set to
 	// SIGUSR2(12) to troubleshoot hangs. -1 disables it.
 	PanicSignal int
@@ -208,6 +374,20 @@ type Config struct {
 	// ProfileEnable is set to prepare the sandbox to be profiled.
 	ProfileEnable bool
 
+	// PauseStopsMonotonic indicates that CLOCK_MONOTONIC doesn't advance
+	// while the container is paused, as for Linux system suspend, so that
+	// timers based on it don't all expire at once on resume.
+	PauseStopsMonotonic bool
+
+	// SyscallMetrics enables recording of the count and latency of each
+	// syscall, reported in stats events.
+	SyscallMetrics bool
+
+	// AllowFlagOverride allows the flags above that support it to be
+	// overridden per sandbox with io.gvisor.* annotations in the OCI spec.
+	// See Config.Override.
+	AllowFlagOverride bool
+
 	// TestOnlyAllowRunAsCurrentUserWithoutChroot should only be used in
 	// tests. It allows runsc to start the sandbox process as the current
 	// user, and without chrooting the sandbox process. This can be
@@ -226,15 +406,29 @@ func (c *Config) ToFlags() []string {
 		"--debug-log-format=" + c.DebugLogFormat,
 		"--file-access=" + c.FileAccess.String(),
 		"--overlay=" + strconv.FormatBool(c.Overlay),
+		"--fsgofer-host-uds=" + strconv.FormatBool(c.FSGoferHostUDS),
+		"--fsgofer-host-uds-fds=" + strconv.FormatBool(c.FSGoferHostUDSFDs),
+		"--fsgofer-host-uds-send-fds=" + strconv.FormatBool(c.FSGoferHostUDSSendFDs),
+		"--fsgofer-coalesce-sync=" + strconv.FormatBool(c.FSGoferCoalesceSync),
 		"--network=" + c.Network.String(),
 		"--log-packets=" + strconv.FormatBool(c.LogPackets),
 		"--platform=" + c.Platform.String(),
+		"--kvm-pin-cpus=" + strconv.FormatBool(c.KVMPinCPUs),
+		"--cpu-features=" + c.CPUFeatures,
+		"--vsyscall=" + c.Vsyscall.String(),
+		"--mmap-rnd-bits=" + strconv.FormatUint(uint64(c.MmapRandBits), 10),
+		"--mmap-layout=" + c.MmapLayout.String(),
+		"--host-mlock=" + strconv.FormatBool(c.HostMLock),
 		"--strace=" + strconv.FormatBool(c.Strace),
 		"--strace-syscalls=" + strings.Join(c.StraceSyscalls, ","),
 		"--strace-log-size=" + strconv.Itoa(int(c.StraceLogSize)),
 		"--watchdog-action=" + c.WatchdogAction.String(),
+		"--watchdog-timeout=" + c.WatchdogTimeout.String(),
+		"--watchdog-dump-dir=" + c.WatchdogDumpDir,
 		"--panic-signal=" + strconv.Itoa(c.PanicSignal),
 		"--profile=" + strconv.FormatBool(c.ProfileEnable),
+		"--pause-stops-monotonic=" + strconv.FormatBool(c.PauseStopsMonotonic),
+		"--syscall-metrics=" + strconv.FormatBool(c.SyscallMetrics),
 	}
 	if c.TestOnlyAllowRunAsCurrentUserWithoutChroot {
 		// Only include if set since it is never to be used by users.
@@ -242,3 +436,97 @@ func (c *Config) ToFlags() []string {
 	}
 	return f
 }
+
+// AnnotationPrefix is the prefix of OCI annotations that override runsc flags
+// for a sandbox, e.g. "io.gvisor.platform" overrides --platform.
+const AnnotationPrefix = "io.gvisor."
+
+// overridableFlags maps the names of the flags that may be overridden by
+// annotations to functions setting the flag in a Config.
+var overridableFlags = map[string]func(c *Config, v string) error{
+	"cpu-features": func(c *Config, v string) error {
+		c.CPUFeatures = v
+		return cpuid.HostFeatureSet().ApplySpec(v, cpuid.HostFeatureSet())
+	},
+	"debug": func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		c.Debug = b
+		return err
+	},
+	"file-access": func(c *Config, v string) error {
+		fa, err := MakeFileAccessType(v)
+		c.FileAccess = fa
+		return err
+	},
+	"mmap-layout": func(c *Config, v string) error {
+		m, err := MakeMmapLayoutMode(v)
+		c.MmapLayout = m
+		return err
+	},
+	"mmap-rnd-bits": func(c *Config, v string) error {
+		n, err := MakeMmapRandBits(v)
+		c.MmapRandBits = n
+		return err
+	},
+	"network": func(c *Config, v string) error {
+		n, err := MakeNetworkType(v)
+		c.Network = n
+		return err
+	},
+	"overlay": func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		c.Overlay = b
+		return err
+	},
+	"platform": func(c *Config, v string) error {
+		p, err := MakePlatformType(v)
+		c.Platform = p
+		return err
+	},
+}
+
+// ConfigOverrides returns the annotations in the given set that override
+// runsc flags, or nil if there are none.
+func ConfigOverrides(annotations map[string]string) map[string]string {
+	var o map[string]string
+	for k, v := range annotations {
+		if strings.HasPrefix(k, AnnotationPrefix) {
+			if o == nil {
+				o = make(map[string]string)
+			}
+			o[k] = v
+		}
+	}
+	return o
+}
+
+// Override returns a copy of c with the flags set by io.gvisor.* annotations
+// overridden. Other annotations are ignored. If c.AllowFlagOverride is false,
+// overrides are ignored with a warning and c is returned unchanged.
+func (c *Config) Override(annotations map[string]string) (*Config, error) {
+	overrides := ConfigOverrides(annotations)
+	if len(overrides) == 0 {
+		return c, nil
+	}
+	if !c.AllowFlagOverride {
+		log.Warningf("Ignoring %s* annotations, flag overrides are disabled (see --allow-flag-override)", AnnotationPrefix)
+		return c, nil
+	}
+
+	o := *c
+	for k, v := range overrides {
+		name := strings.TrimPrefix(k, AnnotationPrefix)
+		set, ok := overridableFlags[name]
+		if !ok {
+			return nil, fmt.Errorf("annotation %q does not override a known flag", k)
+		}
+		if err := set(&o, v); err != nil {
+			return nil, fmt.Errorf("invalid value for annotation %q: %v", k, err)
+		}
+		log.Infof("Overriding flag --%s=%s from annotation", name, v)
+	}
+	if o.FileAccess == FileAccessShared && o.Overlay {
+		return nil, fmt.Errorf("overlay is incompatible with shared file access")
+	}
+	return &o, nil
+}
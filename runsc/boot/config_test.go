@@ -0,0 +1,79 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOverride(t *testing.T) {
+	base := Config{
+		AllowFlagOverride: true,
+		FileAccess:        FileAccessExclusive,
+		Network:           NetworkSandbox,
+		Platform:          PlatformPtrace,
+	}
+
+	got, err := base.Override(map[string]string{
+		"io.gvisor.debug":         "true",
+		"io.gvisor.mmap-layout":   "legacy",
+		"io.gvisor.mmap-rnd-bits": "32",
+		"io.gvisor.network":       "none",
+		"io.gvisor.overlay":       "true",
+		"io.gvisor.platform":      "kvm",
+		"unrelated":               "value",
+	})
+	if err != nil {
+		t.Fatalf("Override() failed: %v", err)
+	}
+	want := base
+	want.Debug = true
+	want.MmapLayout = MmapLayoutLegacy
+	want.MmapRandBits = 32
+	want.Network = NetworkNone
+	want.Overlay = true
+	want.Platform = PlatformKVM
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("Override() got %+v, want %+v", *got, want)
+	}
+	if base.Platform != PlatformPtrace {
+		t.Errorf("Override() modified the original config: %+v", base)
+	}
+
+	for _, annotations := range []map[string]string{
+		{"io.gvisor.unknown": "true"},
+		{"io.gvisor.platform": "xyz"},
+		{"io.gvisor.debug": "maybe"},
+		{"io.gvisor.mmap-layout": "sideways"},
+		{"io.gvisor.mmap-rnd-bits": "16"},
+		{"io.gvisor.file-access": "shared", "io.gvisor.overlay": "true"},
+	} {
+		if _, err := base.Override(annotations); err == nil {
+			t.Errorf("Override(%v) succeeded, want error", annotations)
+		}
+	}
+}
+
+func TestOverrideDisallowed(t *testing.T) {
+	base := &Config{Platform: PlatformPtrace}
+	got, err := base.Override(map[string]string{"io.gvisor.platform": "kvm"})
+	if err != nil {
+		t.Fatalf("Override() failed: %v", err)
+	}
+	if got.Platform != PlatformPtrace {
+		t.Errorf("Override() got platform %v with overrides disallowed, want %v", got.Platform, PlatformPtrace)
+	}
+}
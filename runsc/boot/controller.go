@@ -53,6 +53,14 @@ const (
 	// container..
 	ContainerExecuteAsync = "containerManager.ExecuteAsync"
 
+	// ContainerExportFilesystem writes a tar archive of the memory-backed
+	// filesystems of the sandbox.
+	ContainerExportFilesystem = "containerManager.ExportFilesystem"
+
+	// ContainerExportNetstack returns the state of the sandbox network
+	// stack.
+	ContainerExportNetstack = "containerManager.ExportNetstack"
+
 	// ContainerPause pauses the container.
 	ContainerPause = "containerManager.Pause"
 
@@ -77,6 +85,10 @@ const (
 	// within a sandbox.
 	ContainerStart = "containerManager.Start"
 
+	// ContainerUpdateResolver replaces /etc/hosts and /etc/resolv.conf of a
+	// container.
+	ContainerUpdateResolver = "containerManager.UpdateResolver"
+
 	// ContainerWait is used to wait on the init process of the container
 	// and return its ExitStatus.
 	ContainerWait = "containerManager.Wait"
@@ -89,6 +101,14 @@ const (
 	// and routes in a network stack.
 	NetworkCreateLinksAndRoutes = "Network.CreateLinksAndRoutes"
 
+	// NetworkAddLink is the URPC endpoint for adding a link, with its
+	// addresses and routes, to a network stack.
+	NetworkAddLink = "Network.AddLink"
+
+	// NetworkRemoveLink is the URPC endpoint for removing a link from a
+	// network stack.
+	NetworkRemoveLink = "Network.RemoveLink"
+
 	// RootContainerStart is the URPC endpoint for starting a new sandbox
 	// with root container.
 	RootContainerStart = "containerManager.StartRoot"
@@ -99,7 +119,14 @@ const (
 	// Profiling related commands (see pprof.go for more details).
 	StartCPUProfile = "Profile.StartCPUProfile"
 	StopCPUProfile  = "Profile.StopCPUProfile"
+	CPUProfile      = "Profile.CPUProfile"
 	HeapProfile     = "Profile.HeapProfile"
+	BlockProfile    = "Profile.BlockProfile"
+	MutexProfile    = "Profile.MutexProfile"
+	Goroutines      = "Profile.Goroutine"
+
+	// StraceConfigure enables, reconfigures or disables strace.
+	StraceConfigure = "Strace.Configure"
 )
 
 // ControlSocketAddr generates an abstract unix socket name for the given ID.
@@ -140,9 +167,8 @@ func newController(fd int, l *Loader) (*controller, error) {
 	}
 
 	srv.Register(&debug{})
-	if l.conf.ProfileEnable {
-		srv.Register(&control.Profile{})
-	}
+	srv.Register(&control.Profile{})
+	srv.Register(&control.Strace{})
 
 	return &controller{
 		srv:     srv,
@@ -182,6 +208,19 @@ func (cm *containerManager) Processes(cid *string, out *[]*control.Process) erro
 	return control.Processes(cm.l.k, *cid, out)
 }
 
+// ExportFilesystem writes a tar archive of the memory-backed filesystems of the
+// sandbox to the donated file.
+func (cm *containerManager) ExportFilesystem(o *control.ExportFilesystemOpts, _ *struct{}) error {
+	log.Debugf("containerManager.ExportFilesystem: %q", o.Path)
+	return control.ExportFilesystem(cm.l.k, o)
+}
+
+// ExportNetstack returns the state of the sandbox network stack.
+func (cm *containerManager) ExportNetstack(_ *struct{}, out *control.NetstackState) error {
+	log.Debugf("containerManager.ExportNetstack")
+	return control.ExportNetstack(cm.l.k, out)
+}
+
 // Create creates a container within a sandbox.
 func (cm *containerManager) Create(cid *string, _ *struct{}) error {
 	log.Debugf("containerManager.Create: %q", *cid)
@@ -284,6 +323,9 @@ func (cm *containerManager) Checkpoint(o *control.SaveOpts, _ *struct{}) error {
 func (cm *containerManager) Pause(_, _ *struct{}) error {
 	log.Debugf("containerManager.Pause")
 	cm.l.k.Pause()
+	if cm.l.conf.PauseStopsMonotonic {
+		cm.l.k.SuspendTime()
+	}
 	return nil
 }
 
@@ -320,6 +362,10 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 		return fmt.Errorf("at most two files may be passed to Restore")
 	}
 
+	// The network stack of the old kernel has been configured with the
+	// links and routes of the sandbox for the restore, so keep it.
+	oldStack := cm.l.k.NetworkStack()
+
 	// Destroy the old kernel and create a new kernel.
 	cm.l.k.Pause()
 	cm.l.k.Destroy()
@@ -344,12 +390,25 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 	if err != nil {
 		return fmt.Errorf("creating RestoreEnvironment: %v", err)
 	}
+	// The stdio FDs of the restoring sandbox replace those that the
+	// container was started with.
+	renv.DonatedFDs = make(map[string]int)
+	for appFD, hostFD := range cm.l.stdioFDs {
+		renv.DonatedFDs[stdioKey("" /* root container */, appFD)] = hostFD
+	}
 	fs.SetRestoreEnvironment(*renv)
 
-	// Prepare to load from the state file.
-	networkStack, err := newEmptyNetworkStack(cm.l.conf, k)
-	if err != nil {
-		return fmt.Errorf("creating network: %v", err)
+	// Prepare to load from the state file. Restored endpoints are
+	// reconnected through the links of the sandbox stack, so that
+	// connections survive if the network environment was preserved.
+	networkStack := oldStack
+	if eps, ok := networkStack.(*epsocket.Stack); ok {
+		eps.Stack.SetClock(k)
+	} else {
+		networkStack, err = newEmptyNetworkStack(cm.l.conf, k)
+		if err != nil {
+			return fmt.Errorf("creating network: %v", err)
+		}
 	}
 	if eps, ok := networkStack.(*epsocket.Stack); ok {
 		stack.StackFromEnv = eps.Stack // FIXME
@@ -374,7 +433,7 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 	k.Timekeeper().SetClocks(time.NewCalibratedClocks())
 
 	// Since we have a new kernel we also must make a new watchdog.
-	watchdog := watchdog.New(k, watchdog.DefaultTimeout, cm.l.conf.WatchdogAction)
+	watchdog := watchdog.New(k, cm.l.watchdog.Opts())
 
 	// Change the loader fields to reflect the changes made when restoring.
 	cm.l.k = k
@@ -406,10 +465,44 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 // Resume unpauses a container.
 func (cm *containerManager) Resume(_, _ *struct{}) error {
 	log.Debugf("containerManager.Resume")
+	if cm.l.conf.PauseStopsMonotonic {
+		cm.l.k.ResumeTime()
+	}
 	cm.l.k.Unpause()
 	return nil
 }
 
+// UpdateResolverArgs are arguments to the UpdateResolver method.
+type UpdateResolverArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// Hosts is the new content of the container's /etc/hosts. If nil, the
+	// file is left unchanged.
+	Hosts []byte
+
+	// ResolvConf is the new content of the container's /etc/resolv.conf.
+	// If nil, the file is left unchanged.
+	ResolvConf []byte
+}
+
+// UpdateResolver replaces /etc/hosts and /etc/resolv.conf in the root
+// filesystem of a container.
+func (cm *containerManager) UpdateResolver(args *UpdateResolverArgs, _ *struct{}) error {
+	log.Debugf("containerManager.UpdateResolver: %q", args.CID)
+	if path.Clean(args.CID) != args.CID {
+		return fmt.Errorf("container ID shouldn't contain directory traversals such as \"..\": %q", args.CID)
+	}
+	opts := control.UpdateResolverOpts{
+		Hosts:      args.Hosts,
+		ResolvConf: args.ResolvConf,
+	}
+	if args.CID != cm.l.sandboxID {
+		opts.Root = path.Join(ChildContainersDir, args.CID)
+	}
+	return control.UpdateResolver(cm.l.k, &opts)
+}
+
 // Wait waits for the init process in the given container.
 func (cm *containerManager) Wait(cid *string, waitStatus *uint32) error {
 	log.Debugf("containerManager.Wait")
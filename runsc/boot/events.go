@@ -15,7 +15,13 @@
 package boot
 
 import (
+	"fmt"
+	"sort"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/strace"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
 )
 
@@ -32,6 +38,44 @@ type Event struct {
 type Stats struct {
 	Memory Memory `json:"memory"`
 	Pids   Pids   `json:"pids"`
+
+	// Syscalls is a gVisor extension containing statistics on the syscalls
+	// invoked by the application, by syscall name. It is only populated with
+	// --syscall-metrics.
+	Syscalls map[string]Syscall `json:"syscalls,omitempty"`
+
+	// UnimplementedSyscalls is a gVisor extension counting the
+	// unimplemented syscalls, or unimplemented features of syscalls,
+	// invoked by the container, most frequent first.
+	UnimplementedSyscalls []UnimplementedSyscall `json:"unimplementedSyscalls,omitempty"`
+}
+
+// UnimplementedSyscall contains the number of invocations of an unimplemented
+// syscall.
+type UnimplementedSyscall struct {
+	// Name is the name of the syscall.
+	Name string `json:"name"`
+
+	// Args are the values of the arguments that select the unimplemented
+	// feature, e.g. the ioctl command. See
+	// kernel.UnimplementedSyscallArgs.
+	Args  string `json:"args,omitempty"`
+	Count uint64 `json:"count"`
+}
+
+// Syscall contains stats on a syscall.
+type Syscall struct {
+	Count   uint64          `json:"count"`
+	TotalNs int64           `json:"totalNs"`
+	Latency []LatencyBucket `json:"latency,omitempty"`
+}
+
+// LatencyBucket is the number of invocations of a syscall whose latency is
+// less than LessThanNs, and at least the bound of the previous bucket. The
+// last bucket has no upper bound and LessThanNs is omitted.
+type LatencyBucket struct {
+	LessThanNs int64  `json:"lessThanNs,omitempty"`
+	Count      uint64 `json:"count"`
 }
 
 // Pids contains stats on processes.
@@ -58,11 +102,20 @@ type Memory struct {
 	Raw       map[string]uint64 `json:"raw,omitempty"`
 }
 
-// Event gets the events from the container.
-func (cm *containerManager) Event(_ *struct{}, out *Event) error {
+// Event gets the events from the container. Except for unimplemented
+// syscalls, the stats cover the whole sandbox.
+func (cm *containerManager) Event(cid *string, out *Event) error {
 	stats := &Stats{}
 	stats.populateMemory(cm.l.k)
 	stats.populatePIDs(cm.l.k)
+	if err := stats.populateSyscalls(); err != nil {
+		return err
+	}
+	if cid != nil {
+		if err := stats.populateUnimplementedSyscalls(cm.l.k, *cid); err != nil {
+			return err
+		}
+	}
 	*out = Event{Type: "stats", Data: stats}
 	return nil
 }
@@ -79,3 +132,55 @@ func (s *Stats) populateMemory(k *kernel.Kernel) {
 func (s *Stats) populatePIDs(k *kernel.Kernel) {
 	s.Pids.Current = uint64(len(k.TaskSet().Root.ThreadGroups()))
 }
+
+func (s *Stats) populateSyscalls() error {
+	names, ok := strace.Lookup(abi.Linux, arch.AMD64)
+	if !ok {
+		return fmt.Errorf("amd64 Linux syscall table not found")
+	}
+	bounds := kernel.SyscallLatencyBounds()
+	s.Syscalls = make(map[string]Syscall)
+	for sysno, stat := range kernel.SyscallStats() {
+		sc := Syscall{
+			Count:   stat.Count,
+			TotalNs: stat.TotalLatency.Nanoseconds(),
+		}
+		for i, c := range stat.LatencyCounts {
+			if c == 0 {
+				continue
+			}
+			b := LatencyBucket{Count: c}
+			if i < len(bounds) {
+				b.LessThanNs = bounds[i].Nanoseconds()
+			}
+			sc.Latency = append(sc.Latency, b)
+		}
+		s.Syscalls[names.Name(sysno)] = sc
+	}
+	return nil
+}
+
+func (s *Stats) populateUnimplementedSyscalls(k *kernel.Kernel, cid string) error {
+	names, ok := strace.Lookup(abi.Linux, arch.AMD64)
+	if !ok {
+		return fmt.Errorf("amd64 Linux syscall table not found")
+	}
+	for us, count := range k.UnimplementedSyscalls(cid) {
+		s.UnimplementedSyscalls = append(s.UnimplementedSyscalls, UnimplementedSyscall{
+			Name:  names.Name(us.Sysno),
+			Args:  us.Args,
+			Count: count,
+		})
+	}
+	sort.Slice(s.UnimplementedSyscalls, func(i, j int) bool {
+		a, b := s.UnimplementedSyscalls[i], s.UnimplementedSyscalls[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Args < b.Args
+	})
+	return nil
+}
@@ -25,10 +25,17 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/limits"
 )
 
+// stdioKey returns the key under which the host FD of the stdio FD appFD of
+// container cid, empty for the root container, is imported and donated again
+// at restore.
+func stdioKey(cid string, appFD int) string {
+	return fmt.Sprintf("stdio:%s:%d", cid, appFD)
+}
+
 // createFDMap creates an FD map that contains stdin, stdout, and stderr. If
 // console is true, then ioctl calls will be passed through to the host FD.
 // Upon success, createFDMap dups then closes stdioFDs.
-func createFDMap(ctx context.Context, k *kernel.Kernel, l *limits.LimitSet, console bool, stdioFDs []int) (*kernel.FDMap, error) {
+func createFDMap(ctx context.Context, k *kernel.Kernel, l *limits.LimitSet, console bool, stdioFDs []int, cid string) (*kernel.FDMap, error) {
 	if len(stdioFDs) != 3 {
 		return nil, fmt.Errorf("stdioFDs should contain exactly 3 FDs (stdin, stdout, and stderr), but %d FDs received", len(stdioFDs))
 	}
@@ -52,7 +59,7 @@ func createFDMap(ctx context.Context, k *kernel.Kernel, l *limits.LimitSet, cons
 			// Import the file as a host TTY file.
 			if ttyFile == nil {
 				var err error
-				appFile, err = host.ImportFile(ctx, hostFD, mounter, true /* isTTY */)
+				appFile, err = host.ImportFile(ctx, stdioKey(cid, appFD), hostFD, mounter, true /* isTTY */)
 				if err != nil {
 					return nil, err
 				}
@@ -71,7 +78,7 @@ func createFDMap(ctx context.Context, k *kernel.Kernel, l *limits.LimitSet, cons
 		} else {
 			// Import the file as a regular host file.
 			var err error
-			appFile, err = host.ImportFile(ctx, hostFD, mounter, false /* isTTY */)
+			appFile, err = host.ImportFile(ctx, stdioKey(cid, appFD), hostFD, mounter, false /* isTTY */)
 			if err != nil {
 				return nil, err
 			}
@@ -21,6 +21,8 @@ import (
 	"golang.org/x/sys/unix"
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/seccomp"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/hostinet"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/watchdog"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/fdbased"
 )
 
@@ -60,6 +62,11 @@ var allowedSyscalls = seccomp.SyscallRules{
 			seccomp.AllowValue(0),
 			seccomp.AllowValue(0),
 		},
+		// Used by fdbased endpoints to stop their dispatchers.
+		{
+			seccomp.AllowValue(0),
+			seccomp.AllowValue(linux.EFD_NONBLOCK | linux.EFD_CLOEXEC),
+		},
 	},
 	syscall.SYS_EXIT:       {},
 	syscall.SYS_EXIT_GROUP: {},
@@ -79,6 +86,7 @@ var allowedSyscalls = seccomp.SyscallRules{
 			seccomp.AllowValue(syscall.F_GETFD),
 		},
 	},
+	syscall.SYS_FDATASYNC: {},
 	syscall.SYS_FSTAT:     {},
 	syscall.SYS_FSYNC:     {},
 	syscall.SYS_FTRUNCATE: {},
@@ -126,11 +134,23 @@ var allowedSyscalls = seccomp.SyscallRules{
 			seccomp.AllowValue(syscall.SOL_SOCKET),
 			seccomp.AllowValue(syscall.SO_REUSEADDR),
 		},
+		// Used by host unix sockets to report their peer's credentials.
+		{
+			seccomp.AllowAny{},
+			seccomp.AllowValue(syscall.SOL_SOCKET),
+			seccomp.AllowValue(syscall.SO_PEERCRED),
+		},
+		{
+			seccomp.AllowAny{},
+			seccomp.AllowValue(syscall.SOL_SOCKET),
+			seccomp.AllowValue(linux.SO_PEERGROUPS),
+		},
 	},
 	syscall.SYS_GETTID:       {},
 	syscall.SYS_GETTIMEOFDAY: {},
-	// SYS_IOCTL is needed for terminal support, but we only allow
-	// setting/getting termios and winsize.
+	// SYS_IOCTL is needed for terminal and block device support, but we
+	// only allow setting/getting termios and winsize, and getting block
+	// device sizes.
 	syscall.SYS_IOCTL: []seccomp.Rule{
 		{
 			seccomp.AllowAny{}, /* fd */
@@ -162,10 +182,29 @@ var allowedSyscalls = seccomp.SyscallRules{
 			seccomp.AllowValue(linux.TIOCGWINSZ),
 			seccomp.AllowAny{}, /* winsize struct */
 		},
+		// Block device ioctls are needed for host block devices.
+		{
+			seccomp.AllowAny{}, /* fd */
+			seccomp.AllowValue(linux.BLKGETSIZE64),
+			seccomp.AllowAny{}, /* u64 */
+		},
+		{
+			seccomp.AllowAny{}, /* fd */
+			seccomp.AllowValue(linux.BLKSSZGET),
+			seccomp.AllowAny{}, /* int */
+		},
+		{
+			seccomp.AllowAny{}, /* fd */
+			seccomp.AllowValue(linux.BLKPBSZGET),
+			seccomp.AllowAny{}, /* unsigned int */
+		},
 	},
-	syscall.SYS_LSEEK:   {},
-	syscall.SYS_MADVISE: {},
-	syscall.SYS_MINCORE: {},
+	syscall.SYS_IO_GETEVENTS: {},
+	syscall.SYS_IO_SETUP:     {},
+	syscall.SYS_IO_SUBMIT:    {},
+	syscall.SYS_LSEEK:        {},
+	syscall.SYS_MADVISE:      {},
+	syscall.SYS_MINCORE:      {},
 	syscall.SYS_MMAP: []seccomp.Rule{
 		{
 			seccomp.AllowAny{},
@@ -209,7 +248,9 @@ var allowedSyscalls = seccomp.SyscallRules{
 	syscall.SYS_NANOSLEEP: {},
 	syscall.SYS_POLL:      {},
 	syscall.SYS_PREAD64:   {},
+	syscall.SYS_PREADV:    {},
 	syscall.SYS_PWRITE64:  {},
+	syscall.SYS_PWRITEV:   {},
 	syscall.SYS_READ:      {},
 	syscall.SYS_RECVMSG: []seccomp.Rule{
 		{
@@ -245,6 +286,16 @@ var allowedSyscalls = seccomp.SyscallRules{
 		},
 	},
 	syscall.SYS_SETITIMER: {},
+	// Used by host unix sockets to receive credentials.
+	syscall.SYS_SETSOCKOPT: []seccomp.Rule{
+		{
+			seccomp.AllowAny{},
+			seccomp.AllowValue(syscall.SOL_SOCKET),
+			seccomp.AllowValue(syscall.SO_PASSCRED),
+			seccomp.AllowAny{},
+			seccomp.AllowValue(4),
+		},
+	},
 	syscall.SYS_SHUTDOWN: []seccomp.Rule{
 		{seccomp.AllowAny{}, seccomp.AllowValue(syscall.SHUT_RDWR)},
 	},
@@ -275,7 +326,7 @@ var allowedSyscalls = seccomp.SyscallRules{
 
 // hostInetFilters contains syscalls that are needed by sentry/socket/hostinet.
 func hostInetFilters() seccomp.SyscallRules {
-	return seccomp.SyscallRules{
+	rules := seccomp.SyscallRules{
 		syscall.SYS_ACCEPT4: []seccomp.Rule{
 			{
 				seccomp.AllowAny{},
@@ -288,111 +339,82 @@ func hostInetFilters() seccomp.SyscallRules {
 		syscall.SYS_CONNECT:     {},
 		syscall.SYS_GETPEERNAME: {},
 		syscall.SYS_GETSOCKNAME: {},
-		syscall.SYS_GETSOCKOPT: []seccomp.Rule{
+		syscall.SYS_IOCTL: []seccomp.Rule{
 			{
 				seccomp.AllowAny{},
-				seccomp.AllowValue(syscall.SOL_IPV6),
-				seccomp.AllowValue(syscall.IPV6_V6ONLY),
+				seccomp.AllowValue(syscall.TIOCOUTQ),
 			},
 			{
 				seccomp.AllowAny{},
-				seccomp.AllowValue(syscall.SOL_SOCKET),
-				seccomp.AllowValue(syscall.SO_ERROR),
+				seccomp.AllowValue(syscall.TIOCINQ),
 			},
 			{
 				seccomp.AllowAny{},
-				seccomp.AllowValue(syscall.SOL_SOCKET),
-				seccomp.AllowValue(syscall.SO_KEEPALIVE),
+				seccomp.AllowValue(syscall.SIOCATMARK),
 			},
 			{
 				seccomp.AllowAny{},
-				seccomp.AllowValue(syscall.SOL_SOCKET),
-				seccomp.AllowValue(syscall.SO_SNDBUF),
+				seccomp.AllowValue(syscall.SIOCGSTAMP),
 			},
 			{
 				seccomp.AllowAny{},
-				seccomp.AllowValue(syscall.SOL_SOCKET),
-				seccomp.AllowValue(syscall.SO_RCVBUF),
+				seccomp.AllowValue(syscall.SIOCGIFCONF),
 			},
 			{
 				seccomp.AllowAny{},
-				seccomp.AllowValue(syscall.SOL_SOCKET),
-				seccomp.AllowValue(syscall.SO_REUSEADDR),
+				seccomp.AllowValue(syscall.SIOCGIFFLAGS),
 			},
 			{
 				seccomp.AllowAny{},
-				seccomp.AllowValue(syscall.SOL_SOCKET),
-				seccomp.AllowValue(syscall.SO_TYPE),
+				seccomp.AllowValue(syscall.SIOCGIFADDR),
 			},
 			{
 				seccomp.AllowAny{},
-				seccomp.AllowValue(syscall.SOL_SOCKET),
-				seccomp.AllowValue(syscall.SO_LINGER),
+				seccomp.AllowValue(syscall.SIOCGIFBRDADDR),
 			},
 			{
 				seccomp.AllowAny{},
-				seccomp.AllowValue(syscall.SOL_TCP),
-				seccomp.AllowValue(syscall.TCP_NODELAY),
+				seccomp.AllowValue(syscall.SIOCGIFDSTADDR),
 			},
 			{
 				seccomp.AllowAny{},
-				seccomp.AllowValue(syscall.SOL_TCP),
-				seccomp.AllowValue(syscall.TCP_INFO),
+				seccomp.AllowValue(syscall.SIOCGIFHWADDR),
 			},
-		},
-		syscall.SYS_IOCTL: []seccomp.Rule{
 			{
 				seccomp.AllowAny{},
-				seccomp.AllowValue(syscall.TIOCOUTQ),
+				seccomp.AllowValue(syscall.SIOCGIFINDEX),
 			},
 			{
 				seccomp.AllowAny{},
-				seccomp.AllowValue(syscall.TIOCINQ),
+				seccomp.AllowValue(syscall.SIOCGIFMAP),
 			},
-		},
-		syscall.SYS_LISTEN:   {},
-		syscall.SYS_READV:    {},
-		syscall.SYS_RECVFROM: {},
-		syscall.SYS_RECVMSG:  {},
-		syscall.SYS_SENDMSG:  {},
-		syscall.SYS_SENDTO:   {},
-		syscall.SYS_SETSOCKOPT: []seccomp.Rule{
 			{
 				seccomp.AllowAny{},
-				seccomp.AllowValue(syscall.SOL_IPV6),
-				seccomp.AllowValue(syscall.IPV6_V6ONLY),
-				seccomp.AllowAny{},
-				seccomp.AllowValue(4),
+				seccomp.AllowValue(syscall.SIOCGIFMETRIC),
 			},
 			{
 				seccomp.AllowAny{},
-				seccomp.AllowValue(syscall.SOL_SOCKET),
-				seccomp.AllowValue(syscall.SO_SNDBUF),
-				seccomp.AllowAny{},
-				seccomp.AllowValue(4),
+				seccomp.AllowValue(syscall.SIOCGIFMTU),
 			},
 			{
 				seccomp.AllowAny{},
-				seccomp.AllowValue(syscall.SOL_SOCKET),
-				seccomp.AllowValue(syscall.SO_RCVBUF),
-				seccomp.AllowAny{},
-				seccomp.AllowValue(4),
+				seccomp.AllowValue(syscall.SIOCGIFNAME),
 			},
 			{
 				seccomp.AllowAny{},
-				seccomp.AllowValue(syscall.SOL_SOCKET),
-				seccomp.AllowValue(syscall.SO_REUSEADDR),
-				seccomp.AllowAny{},
-				seccomp.AllowValue(4),
+				seccomp.AllowValue(syscall.SIOCGIFNETMASK),
 			},
 			{
 				seccomp.AllowAny{},
-				seccomp.AllowValue(syscall.SOL_TCP),
-				seccomp.AllowValue(syscall.TCP_NODELAY),
-				seccomp.AllowAny{},
-				seccomp.AllowValue(4),
+				seccomp.AllowValue(syscall.SIOCGIFTXQLEN),
 			},
 		},
+		syscall.SYS_LISTEN:   {},
+		syscall.SYS_READV:    {},
+		syscall.SYS_RECVFROM: {},
+		syscall.SYS_RECVMSG:  {},
+		syscall.SYS_SENDMSG:  {},
+		syscall.SYS_SENDTO:   {},
 		syscall.SYS_SHUTDOWN: []seccomp.Rule{
 			{
 				seccomp.AllowAny{},
@@ -431,6 +453,31 @@ func hostInetFilters() seccomp.SyscallRules {
 		},
 		syscall.SYS_WRITEV: {},
 	}
+
+	// Socket options are passed through to the host as listed by hostinet.
+	for _, opt := range hostinet.SockOpts {
+		if opt.AllowGet {
+			rules.AddRule(syscall.SYS_GETSOCKOPT, seccomp.Rule{
+				seccomp.AllowAny{},
+				seccomp.AllowValue(opt.Level),
+				seccomp.AllowValue(opt.Name),
+			})
+		}
+		if opt.AllowSet {
+			var optlen interface{} = seccomp.AllowValue(opt.Size)
+			if opt.Variable {
+				optlen = seccomp.AllowAny{}
+			}
+			rules.AddRule(syscall.SYS_SETSOCKOPT, seccomp.Rule{
+				seccomp.AllowAny{},
+				seccomp.AllowValue(opt.Level),
+				seccomp.AllowValue(opt.Name),
+				seccomp.AllowAny{},
+				optlen,
+			})
+		}
+	}
+	return rules
 }
 
 // ptraceFilters returns syscalls made exclusively by the ptrace platform.
@@ -456,6 +503,18 @@ func kvmFilters() seccomp.SyscallRules {
 	}
 }
 
+// kvmHostCPUPinningFilters returns syscalls made by the KVM platform when host
+// CPU pinning is enabled.
+func kvmHostCPUPinningFilters() seccomp.SyscallRules {
+	return seccomp.SyscallRules{
+		unix.SYS_SCHED_SETAFFINITY: []seccomp.Rule{
+			{
+				seccomp.AllowValue(0),
+			},
+		},
+	}
+}
+
 func controlServerFilters(fd int) seccomp.SyscallRules {
 	return seccomp.SyscallRules{
 		syscall.SYS_ACCEPT: []seccomp.Rule{
@@ -479,6 +538,48 @@ func controlServerFilters(fd int) seccomp.SyscallRules {
 	}
 }
 
+// watchdogDumpFilters returns syscall filters that allow the watchdog to
+// create files in the dump directory.
+func watchdogDumpFilters(fd int) seccomp.SyscallRules {
+	return seccomp.SyscallRules{
+		syscall.SYS_OPENAT: []seccomp.Rule{
+			{
+				seccomp.AllowValue(fd),
+				seccomp.AllowAny{},
+				seccomp.AllowValue(watchdog.DumpFileFlags),
+			},
+		},
+	}
+}
+
+// hostUDSSendFDsFilters returns syscall filters that allow copying sealed
+// memfds to host memfds, to send them to host unix domain sockets.
+func hostUDSSendFDsFilters() seccomp.SyscallRules {
+	return seccomp.SyscallRules{
+		unix.SYS_MEMFD_CREATE: []seccomp.Rule{
+			{
+				seccomp.AllowAny{},
+				seccomp.AllowValue(linux.MFD_CLOEXEC | linux.MFD_ALLOW_SEALING),
+			},
+		},
+		syscall.SYS_FCNTL: []seccomp.Rule{
+			{
+				seccomp.AllowAny{},
+				seccomp.AllowValue(linux.F_ADD_SEALS),
+			},
+		},
+	}
+}
+
+// hostMLockFilters returns syscalls used to lock application memory into host
+// memory.
+func hostMLockFilters() seccomp.SyscallRules {
+	return seccomp.SyscallRules{
+		syscall.SYS_MLOCK:   {},
+		syscall.SYS_MUNLOCK: {},
+	}
+}
+
 // profileFilters returns extra syscalls made by runtime/pprof package.
 func profileFilters() seccomp.SyscallRules {
 	return seccomp.SyscallRules{
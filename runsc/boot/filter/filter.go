@@ -19,7 +19,9 @@ package filter
 
 import (
 	"fmt"
+	"syscall"
 
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/log"
 	"gvisor.googlesource.com/gvisor/pkg/seccomp"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
@@ -33,24 +35,54 @@ type Options struct {
 	HostNetwork   bool
 	ProfileEnable bool
 	ControllerFD  int
+
+	// WatchdogDumpFD is the directory where the watchdog writes
+	// diagnostics, or 0 if unset.
+	WatchdogDumpFD int
+
+	// HostUDSSendFDs is true if applications may send file descriptors to
+	// host unix domain sockets.
+	HostUDSSendFDs bool
+
+	// HostMLock is true if application memory may be locked into host
+	// memory.
+	HostMLock bool
 }
 
 // Install installs seccomp filters for based on the given platform.
 func Install(opt Options) error {
 	s := allowedSyscalls
 	s.Merge(controlServerFilters(opt.ControllerFD))
+	if opt.WatchdogDumpFD > 0 {
+		s.Merge(watchdogDumpFilters(opt.WatchdogDumpFD))
+	}
 
 	// Set of additional filters used by -race and -msan. Returns empty
 	// when not enabled.
 	s.Merge(instrumentationFilters())
 
+	if opt.HostUDSSendFDs {
+		s.Merge(hostUDSSendFDsFilters())
+	}
+
+	if opt.HostMLock {
+		s.Merge(hostMLockFilters())
+	}
+
 	if opt.HostNetwork {
 		Report("host networking enabled: syscall filters less restrictive!")
 		s.Merge(hostInetFilters())
 	}
+	// Profiles can always be collected, but only include memory mappings,
+	// which the Go runtime reads from /proc/self/maps, if profiling is
+	// enabled. Otherwise opening the file fails instead of killing the
+	// sandbox.
+	denied := seccomp.SyscallRules{}
 	if opt.ProfileEnable {
 		Report("profile enabled: syscall filters less restrictive!")
 		s.Merge(profileFilters())
+	} else {
+		denied.Merge(profileFilters())
 	}
 
 	switch p := opt.Platform.(type) {
@@ -58,11 +90,23 @@ func Install(opt Options) error {
 		s.Merge(ptraceFilters())
 	case *kvm.KVM:
 		s.Merge(kvmFilters())
+		if p.HostCPUPinning() {
+			s.Merge(kvmHostCPUPinningFilters())
+		}
 	default:
 		return fmt.Errorf("unknown platform type %T", p)
 	}
 
-	return seccomp.Install(s)
+	return seccomp.InstallRuleSets([]seccomp.RuleSet{
+		{
+			Rules:  s,
+			Action: linux.SECCOMP_RET_ALLOW,
+		},
+		{
+			Rules:  denied,
+			Action: linux.SECCOMP_RET_ERRNO | linux.BPFAction(syscall.EPERM),
+		},
+	})
 }
 
 // Report writes a warning message to the log.
@@ -22,9 +22,9 @@ import (
 	"strings"
 
 	// Include filesystem types that OCI spec might mount.
+	_ "gvisor.googlesource.com/gvisor/pkg/sentry/fs/binfmtmisc"
 	_ "gvisor.googlesource.com/gvisor/pkg/sentry/fs/dev"
 	_ "gvisor.googlesource.com/gvisor/pkg/sentry/fs/gofer"
-	_ "gvisor.googlesource.com/gvisor/pkg/sentry/fs/host"
 	_ "gvisor.googlesource.com/gvisor/pkg/sentry/fs/proc"
 	_ "gvisor.googlesource.com/gvisor/pkg/sentry/fs/sys"
 	_ "gvisor.googlesource.com/gvisor/pkg/sentry/fs/tmpfs"
@@ -38,6 +38,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/log"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/host"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/ramfs"
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
 	"gvisor.googlesource.com/gvisor/runsc/specutils"
@@ -55,13 +56,14 @@ const (
 	ChildContainersDir = "/__runsc_containers__"
 
 	// Filesystems that runsc supports.
-	bind     = "bind"
-	devpts   = "devpts"
-	devtmpfs = "devtmpfs"
-	proc     = "proc"
-	sysfs    = "sysfs"
-	tmpfs    = "tmpfs"
-	nonefs   = "none"
+	bind      = "bind"
+	devpts    = "devpts"
+	devtmpfs  = "devtmpfs"
+	hugetlbfs = "hugetlbfs"
+	proc      = "proc"
+	sysfs     = "sysfs"
+	tmpfs     = "tmpfs"
+	nonefs    = "none"
 )
 
 type fdDispenser struct {
@@ -85,8 +87,12 @@ func (f *fdDispenser) empty() bool {
 // and all mounts. 'rootCtx' is used to walk directories to find mount points.
 // 'setMountNS' is called after namespace is created. It must set the mount NS
 // to 'rootCtx'.
-func setupRootContainerFS(userCtx context.Context, rootCtx context.Context, spec *specs.Spec, conf *Config, goferFDs []int, setMountNS func(*fs.MountNamespace)) error {
+func setupRootContainerFS(userCtx context.Context, rootCtx context.Context, spec *specs.Spec, conf *Config, goferFDs, blockDeviceFDs []int, setMountNS func(*fs.MountNamespace)) error {
 	mounts := compileMounts(spec)
+	blockDevs, err := blockDevices(spec, blockDeviceFDs)
+	if err != nil {
+		return err
+	}
 
 	// Create a tmpfs mount where we create and mount a root filesystem for
 	// each child container.
@@ -108,7 +114,7 @@ func setupRootContainerFS(userCtx context.Context, rootCtx context.Context, spec
 
 	root := mns.Root()
 	defer root.DecRef()
-	return mountSubmounts(rootCtx, conf, mns, root, mounts, fds)
+	return mountSubmounts(rootCtx, conf, mns, root, mounts, fds, blockDevs)
 }
 
 // compileMounts returns the supported mounts from the mount spec, adding any
@@ -180,7 +186,7 @@ func createRootMount(ctx context.Context, spec *specs.Spec, conf *Config, fds *f
 	fd := fds.remove()
 	log.Infof("Mounting root over 9P, ioFD: %d", fd)
 	p9FS := mustFindFilesystem("9p")
-	opts := p9MountOptions(fd, conf.FileAccess)
+	opts := p9MountOptions(fd, conf.FileAccess, conf)
 	rootInode, err = p9FS.Mount(ctx, rootDevice, mf, strings.Join(opts, ","), nil)
 	if err != nil {
 		return nil, fmt.Errorf("creating root mount point: %v", err)
@@ -246,13 +252,20 @@ func getMountNameAndOptions(conf *Config, m specs.Mount, fds *fdDispenser) (stri
 		fsName = m.Type
 
 		// tmpfs has some extra supported options that we must pass through.
-		opts, err = parseAndFilterOptions(m.Options, "mode", "uid", "gid")
+		opts, err = parseAndFilterOptions(m.Options, "mode", "uid", "gid", "size")
+
+	case hugetlbfs:
+		fsName = m.Type
+
+		// hugetlbfs additionally accepts the page size, which must be the
+		// only huge page size we support.
+		opts, err = parseAndFilterOptions(m.Options, "mode", "uid", "gid", "pagesize")
 
 	case bind:
 		fd := fds.remove()
 		fsName = "9p"
 		// Non-root bind mounts are always shared.
-		opts = p9MountOptions(fd, FileAccessShared)
+		opts = p9MountOptions(fd, FileAccessShared, conf)
 		// If configured, add overlay to all writable mounts.
 		useOverlay = conf.Overlay && !mountFlags(m.Options).ReadOnly
 
@@ -266,9 +279,9 @@ func getMountNameAndOptions(conf *Config, m specs.Mount, fds *fdDispenser) (stri
 	return fsName, opts, useOverlay, err
 }
 
-func mountSubmounts(ctx context.Context, conf *Config, mns *fs.MountNamespace, root *fs.Dirent, mounts []specs.Mount, fds *fdDispenser) error {
+func mountSubmounts(ctx context.Context, conf *Config, mns *fs.MountNamespace, root *fs.Dirent, mounts []specs.Mount, fds *fdDispenser, blockDevs []host.BlockDevice) error {
 	for _, m := range mounts {
-		if err := mountSubmount(ctx, conf, mns, root, fds, m, mounts); err != nil {
+		if err := mountSubmount(ctx, conf, mns, root, fds, m, mounts, blockDevs); err != nil {
 			return fmt.Errorf("mount submount %q: %v", m.Destination, err)
 		}
 	}
@@ -287,7 +300,8 @@ func mountSubmounts(ctx context.Context, conf *Config, mns *fs.MountNamespace, r
 // be readonly, a lower ramfs overlay is added to create the mount point dir.
 // Another overlay is added with tmpfs on top if Config.Overlay is true.
 // 'm.Destination' must be an absolute path with '..' and symlinks resolved.
-func mountSubmount(ctx context.Context, conf *Config, mns *fs.MountNamespace, root *fs.Dirent, fds *fdDispenser, m specs.Mount, mounts []specs.Mount) error {
+// 'blockDevs' are added to the mount if it is a devtmpfs or sysfs.
+func mountSubmount(ctx context.Context, conf *Config, mns *fs.MountNamespace, root *fs.Dirent, fds *fdDispenser, m specs.Mount, mounts []specs.Mount, blockDevs []host.BlockDevice) error {
 	// Map mount type to filesystem name, and parse out the options that we are
 	// capable of dealing with.
 	fsName, opts, useOverlay, err := getMountNameAndOptions(conf, m, fds)
@@ -309,7 +323,12 @@ func mountSubmount(ctx context.Context, conf *Config, mns *fs.MountNamespace, ro
 		mf.ReadOnly = true
 	}
 
-	inode, err := filesystem.Mount(ctx, mountDevice(m), mf, strings.Join(opts, ","), nil)
+	var dataObj interface{}
+	if (m.Type == devtmpfs || m.Type == sysfs) && len(blockDevs) > 0 {
+		dataObj = blockDevs
+	}
+
+	inode, err := filesystem.Mount(ctx, mountDevice(m), mf, strings.Join(opts, ","), dataObj)
 	if err != nil {
 		return fmt.Errorf("creating mount with source %q: %v", m.Source, err)
 	}
@@ -347,8 +366,42 @@ func mountSubmount(ctx context.Context, conf *Config, mns *fs.MountNamespace, ro
 	return nil
 }
 
+// blockDevices returns the block devices passed into the sandbox by the spec,
+// backed by 'fds'. 'fds' contains two FDs for each device returned by
+// specutils.BlockDevices: one for buffered I/O, then one opened with O_DIRECT.
+func blockDevices(spec *specs.Spec, fds []int) ([]host.BlockDevice, error) {
+	specDevs := specutils.BlockDevices(spec)
+	if len(fds) != 2*len(specDevs) {
+		return nil, fmt.Errorf("got %d block device FDs for %d block devices", len(fds), len(specDevs))
+	}
+	var devs []host.BlockDevice
+	for i, d := range specDevs {
+		dev := host.BlockDevice{
+			Name:     filepath.Base(d.Path),
+			FD:       fds[2*i],
+			DirectFD: fds[2*i+1],
+			Major:    uint16(d.Major),
+			Minor:    uint32(d.Minor),
+			Owner:    fs.RootOwner,
+			Perms:    fs.FilePermsFromMode(0660),
+		}
+		if d.FileMode != nil {
+			dev.Perms = fs.FilePermsFromMode(linux.FileMode(d.FileMode.Perm()))
+		}
+		if d.UID != nil {
+			dev.Owner.UID = auth.KUID(*d.UID)
+		}
+		if d.GID != nil {
+			dev.Owner.GID = auth.KGID(*d.GID)
+		}
+		log.Infof("Adding block device %q (%d:%d)", d.Path, d.Major, d.Minor)
+		devs = append(devs, dev)
+	}
+	return devs, nil
+}
+
 // p9MountOptions creates a slice of options for a p9 mount.
-func p9MountOptions(fd int, fa FileAccessType) []string {
+func p9MountOptions(fd int, fa FileAccessType, conf *Config) []string {
 	opts := []string{
 		"trans=fd",
 		"rfdno=" + strconv.Itoa(fd),
@@ -358,6 +411,15 @@ func p9MountOptions(fd int, fa FileAccessType) []string {
 	if fa == FileAccessShared {
 		opts = append(opts, "cache=remote_revalidating")
 	}
+	if conf.FSGoferHostUDSFDs {
+		opts = append(opts, "hostunixsocketfds=true")
+	}
+	if conf.FSGoferHostUDSSendFDs {
+		opts = append(opts, "hostunixsocketsendfds=true")
+	}
+	if conf.FSGoferCoalesceSync {
+		opts = append(opts, "coalescesync=true")
+	}
 	return opts
 }
 
@@ -433,7 +495,7 @@ func createRestoreEnvironment(spec *specs.Spec, conf *Config, fds *fdDispenser)
 
 	// Add root mount.
 	fd := fds.remove()
-	opts := p9MountOptions(fd, conf.FileAccess)
+	opts := p9MountOptions(fd, conf.FileAccess, conf)
 
 	mf := fs.MountSourceFlags{}
 	if spec.Root.Readonly {
@@ -528,13 +590,13 @@ func subtargets(root string, mnts []specs.Mount) []string {
 
 // setupContainerFS is used to set up the file system and amend the procArgs accordingly.
 // procArgs are passed by reference and the FDMap field is modified. It dups stdioFDs.
-func setupContainerFS(procArgs *kernel.CreateProcessArgs, spec *specs.Spec, conf *Config, stdioFDs, goferFDs []int, console bool, creds *auth.Credentials, ls *limits.LimitSet, k *kernel.Kernel, cid string) error {
+func setupContainerFS(procArgs *kernel.CreateProcessArgs, spec *specs.Spec, conf *Config, stdioFDs, goferFDs, blockDeviceFDs []int, console bool, creds *auth.Credentials, ls *limits.LimitSet, k *kernel.Kernel, cid string) error {
 	ctx := procArgs.NewContext(k)
 
 	// Create the FD map, which will set stdin, stdout, and stderr.  If
 	// console is true, then ioctl calls will be passed through to the host
 	// fd.
-	fdm, err := createFDMap(ctx, k, ls, console, stdioFDs)
+	fdm, err := createFDMap(ctx, k, ls, console, stdioFDs, cid)
 	if err != nil {
 		return fmt.Errorf("importing fds: %v", err)
 	}
@@ -558,7 +620,7 @@ func setupContainerFS(procArgs *kernel.CreateProcessArgs, spec *specs.Spec, conf
 	mns := k.RootMountNamespace()
 	if mns == nil {
 		// Setup the root container.
-		return setupRootContainerFS(ctx, rootCtx, spec, conf, goferFDs, func(mns *fs.MountNamespace) {
+		return setupRootContainerFS(ctx, rootCtx, spec, conf, goferFDs, blockDeviceFDs, func(mns *fs.MountNamespace) {
 			k.SetRootMountNamespace(mns)
 		})
 	}
@@ -611,7 +673,7 @@ func setupContainerFS(procArgs *kernel.CreateProcessArgs, spec *specs.Spec, conf
 
 	// Mount all submounts.
 	mounts := compileMounts(spec)
-	if err := mountSubmounts(rootCtx, conf, mns, containerRoot, mounts, fds); err != nil {
+	if err := mountSubmounts(rootCtx, conf, mns, containerRoot, mounts, fds, nil /* blockDevs */); err != nil {
 		return err
 	}
 	cu.Release()
@@ -750,7 +812,7 @@ func mountTmp(ctx context.Context, conf *Config, mns *fs.MountNamespace, root *f
 			Type:        tmpfs,
 			Destination: "/tmp",
 		}
-		return mountSubmount(ctx, conf, mns, root, fds, tmpMount, mounts)
+		return mountSubmount(ctx, conf, mns, root, fds, tmpMount, mounts, nil /* blockDevs */)
 
 	default:
 		return err
@@ -53,7 +53,10 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv4"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv6"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/gre"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/icmp"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/mptcp"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/sctp"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/tcp"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/udp"
 	"gvisor.googlesource.com/gvisor/runsc/boot/filter"
@@ -63,7 +66,11 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/epsocket"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/hostinet"
 	_ "gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink"
+	_ "gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink/genetlink"
+	_ "gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink/netfilter"
 	_ "gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink/route"
+	_ "gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink/sockdiag"
+	_ "gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink/uevent"
 	_ "gvisor.googlesource.com/gvisor/pkg/sentry/socket/unix"
 )
 
@@ -88,6 +95,9 @@ type Loader struct {
 	// goferFDs are the FDs that attach the sandbox to the gofers.
 	goferFDs []int
 
+	// blockDeviceFDs are the FDs for the root container's block devices.
+	blockDeviceFDs []int
+
 	// spec is the base configuration for the root container.
 	spec *specs.Spec
 
@@ -158,6 +168,9 @@ type Args struct {
 	GoferFDs []int
 	// StdioFDs is the stdio for the application.
 	StdioFDs []int
+	// BlockDeviceFDs are FDs for the block devices in the spec, two per
+	// device: one for buffered I/O, then one opened with O_DIRECT.
+	BlockDeviceFDs []int
 	// Console is set to true if using TTY.
 	Console bool
 	// NumCPU is the number of CPUs to create inside the sandbox.
@@ -167,6 +180,9 @@ type Args struct {
 	TotalMem uint64
 	// UserLogFD is the file descriptor to write user logs to.
 	UserLogFD int
+	// WatchdogDumpFD is the directory where the watchdog writes diagnostics.
+	// 0 means unset.
+	WatchdogDumpFD int
 }
 
 // New initializes a new kernel loader configured by spec.
@@ -216,6 +232,9 @@ func New(args Args) (*Loader, error) {
 	if err := enableStrace(args.Conf); err != nil {
 		return nil, fmt.Errorf("enabling strace: %v", err)
 	}
+	if args.Conf.SyscallMetrics {
+		kernel.EnableSyscallMetrics()
+	}
 
 	// Create an empty network stack because the network namespace may be empty at
 	// this point. Netns is configured before Run() is called. Netstack is
@@ -258,15 +277,27 @@ func New(args Args) (*Loader, error) {
 		log.Infof("Setting total memory to %.2f GB", float64(args.TotalMem)/(2^30))
 	}
 
+	featureSet := cpuid.HostFeatureSet()
+	if err := featureSet.ApplySpec(args.Conf.CPUFeatures, cpuid.HostFeatureSet()); err != nil {
+		return nil, fmt.Errorf("applying CPU features %q: %v", args.Conf.CPUFeatures, err)
+	}
+	if args.Conf.CPUFeatures != "" {
+		log.Infof("CPU features: %s", featureSet.FlagsString(false))
+	}
+
 	// Initiate the Kernel object, which is required by the Context passed
 	// to createVFS in order to mount (among other things) procfs.
 	if err = k.Init(kernel.InitKernelArgs{
-		FeatureSet:                  cpuid.HostFeatureSet(),
+		FeatureSet:                  featureSet,
 		Timekeeper:                  tk,
 		RootUserNamespace:           creds.UserNamespace,
 		NetworkStack:                networkStack,
 		ApplicationCores:            uint(args.NumCPU),
 		Vdso:                        vdso,
+		DisableVsyscall:             args.Conf.Vsyscall == VsyscallNone,
+		HostMLock:                   args.Conf.HostMLock,
+		MmapRandBits:                args.Conf.MmapRandBits,
+		LegacyMmapLayout:            args.Conf.MmapLayout == MmapLayoutLegacy,
 		RootUTSNamespace:            kernel.NewUTSNamespace(args.Spec.Hostname, args.Spec.Hostname, creds.UserNamespace),
 		RootIPCNamespace:            kernel.NewIPCNamespace(creds.UserNamespace),
 		RootAbstractSocketNamespace: kernel.NewAbstractSocketNamespace(),
@@ -284,7 +315,11 @@ func New(args Args) (*Loader, error) {
 	}
 
 	// Create a watchdog.
-	watchdog := watchdog.New(k, watchdog.DefaultTimeout, args.Conf.WatchdogAction)
+	watchdog := watchdog.New(k, watchdog.Opts{
+		TaskTimeout:       args.Conf.WatchdogTimeout,
+		TaskTimeoutAction: args.Conf.WatchdogAction,
+		DumpDirFD:         args.WatchdogDumpFD,
+	})
 
 	procArgs, err := newProcess(args.ID, args.Spec, creds, k)
 	if err != nil {
@@ -297,16 +332,17 @@ func New(args Args) (*Loader, error) {
 
 	eid := execID{cid: args.ID}
 	l := &Loader{
-		k:            k,
-		conf:         args.Conf,
-		console:      args.Console,
-		watchdog:     watchdog,
-		spec:         args.Spec,
-		goferFDs:     args.GoferFDs,
-		stdioFDs:     args.StdioFDs,
-		rootProcArgs: procArgs,
-		sandboxID:    args.ID,
-		processes:    map[execID]*execProcess{eid: {}},
+		k:              k,
+		conf:           args.Conf,
+		console:        args.Console,
+		watchdog:       watchdog,
+		spec:           args.Spec,
+		goferFDs:       args.GoferFDs,
+		stdioFDs:       args.StdioFDs,
+		blockDeviceFDs: args.BlockDeviceFDs,
+		rootProcArgs:   procArgs,
+		sandboxID:      args.ID,
+		processes:      map[execID]*execProcess{eid: {}},
 	}
 
 	// We don't care about child signals; some platforms can generate a
@@ -407,7 +443,17 @@ func createPlatform(conf *Config, deviceFD int) (platform.Platform, error) {
 		if deviceFD < 0 {
 			return nil, fmt.Errorf("kvm device FD must be provided")
 		}
-		return kvm.New(os.NewFile(uintptr(deviceFD), "kvm device"))
+		k, err := kvm.New(os.NewFile(uintptr(deviceFD), "kvm device"))
+		if err != nil {
+			return nil, err
+		}
+		if conf.KVMPinCPUs {
+			log.Infof("Platform: kvm host CPU pinning enabled")
+			if err := k.EnableHostCPUPinning(); err != nil {
+				return nil, err
+			}
+		}
+		return k, nil
 	default:
 		return nil, fmt.Errorf("invalid platform %v", conf.Platform)
 	}
@@ -469,10 +515,13 @@ func (l *Loader) run() error {
 		filter.Report("syscall filter is DISABLED. Running in less secure mode.")
 	} else {
 		opts := filter.Options{
-			Platform:      l.k.Platform,
-			HostNetwork:   l.conf.Network == NetworkHost,
-			ProfileEnable: l.conf.ProfileEnable,
-			ControllerFD:  l.ctrl.srv.FD(),
+			Platform:       l.k.Platform,
+			HostNetwork:    l.conf.Network == NetworkHost,
+			ProfileEnable:  l.conf.ProfileEnable,
+			ControllerFD:   l.ctrl.srv.FD(),
+			WatchdogDumpFD: l.watchdog.Opts().DumpDirFD,
+			HostUDSSendFDs: l.conf.FSGoferHostUDSSendFDs,
+			HostMLock:      l.conf.HostMLock,
 		}
 		if err := filter.Install(opts); err != nil {
 			return fmt.Errorf("installing seccomp filters: %v", err)
@@ -488,11 +537,12 @@ func (l *Loader) run() error {
 			l.conf,
 			l.stdioFDs,
 			l.goferFDs,
+			l.blockDeviceFDs,
 			l.console,
 			l.rootProcArgs.Credentials,
 			l.rootProcArgs.Limits,
 			l.k,
-			"" /* CID, which isn't needed for the root container */); err != nil {
+			"" /* CID, empty for the root container in the keys of its stdio FDs */); err != nil {
 			return err
 		}
 
@@ -604,6 +654,7 @@ func (l *Loader) startContainer(k *kernel.Kernel, spec *specs.Spec, conf *Config
 		conf,
 		stdioFDs,
 		goferFDs,
+		nil, /* blockDeviceFDs */
 		false,
 		creds,
 		procArgs.Limits,
@@ -791,11 +842,17 @@ func newEmptyNetworkStack(conf *Config, clock tcpip.Clock) (inet.Stack, error) {
 	case NetworkNone, NetworkSandbox:
 		// NetworkNone sets up loopback using netstack.
 		netProtos := []string{ipv4.ProtocolName, ipv6.ProtocolName, arp.ProtocolName}
-		protoNames := []string{tcp.ProtocolName, udp.ProtocolName, icmp.ProtocolName4}
-		s := epsocket.Stack{stack.New(netProtos, protoNames, stack.Options{
+		protoNames := []string{tcp.ProtocolName, udp.ProtocolName, sctp.ProtocolName, mptcp.ProtocolName, icmp.ProtocolName4, gre.ProtocolName}
+		s := epsocket.Stack{Stack: stack.New(netProtos, protoNames, stack.Options{
 			Clock:       clock,
 			Stats:       epsocket.Metrics,
 			HandleLocal: true,
+			// Report multicast group memberships to routers, as
+			// Linux does.
+			MulticastGroupConfigs: stack.DefaultMulticastGroupConfigurations(),
+			// Track connections for /proc/net/nf_conntrack and
+			// ctnetlink.
+			ConnTrack: true,
 		})}
 		if err := s.Stack.SetTransportProtocolOption(tcp.ProtocolNumber, tcp.SACKEnabled(true)); err != nil {
 			return nil, fmt.Errorf("failed to enable SACK: %v", err)
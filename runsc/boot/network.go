@@ -16,12 +16,17 @@ package boot
 
 import (
 	"fmt"
+	"math/bits"
 	"math/rand"
 	"net"
+	"os"
+	"sync"
 	"syscall"
+	"time"
 
 	"gvisor.googlesource.com/gvisor/pkg/log"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/fdbased"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/loopback"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/sniffer"
@@ -35,6 +40,19 @@ import (
 // Network exposes methods that can be used to configure a network stack.
 type Network struct {
 	Stack *stack.Stack
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// lastNICID is the highest NIC ID used so far. NIC IDs are never
+	// reused, as the endpoint of a removed NIC may still deliver packets
+	// while it is being closed, and applications may still refer to the
+	// interface index of a removed link.
+	lastNICID tcpip.NICID
+
+	// linkFDs are the FDs of the fd-based links, by NIC ID. They are closed
+	// when the links are removed.
+	linkFDs map[tcpip.NICID][]int
 }
 
 // Route represents a route in the network stack.
@@ -57,6 +75,22 @@ type FDBasedLink struct {
 	Addresses  []net.IP
 	Routes     []Route
 	GSOMaxSize uint32
+
+	// NDP enables IPv6 neighbor discovery on the link. The link is then
+	// also assigned a link-local address derived from its MAC address.
+	NDP bool
+
+	// BusyPoll is the time for which the link busy-polls its FD after
+	// receiving a packet. See fdbased.Options.BusyPoll.
+	BusyPoll time.Duration
+
+	// NumChannels is the number of FDs of the link, each of which receives
+	// the packets of a subset of the flows.
+	NumChannels int
+
+	// SaveRestore indicates that connections through the link may be saved
+	// and restored, the network environment of the link being preserved.
+	SaveRestore bool
 }
 
 // LoopbackLink configures a loopback li nk.
@@ -68,8 +102,8 @@ type LoopbackLink struct {
 
 // CreateLinksAndRoutesArgs are arguments to CreateLinkAndRoutes.
 type CreateLinksAndRoutesArgs struct {
-	// FilePayload contains the fds associated with the FDBasedLinks.  The
-	// two slices must have the same length.
+	// FilePayload contains the fds associated with the FDBasedLinks: the
+	// NumChannels fds of each link, in the order of the links.
 	urpc.FilePayload
 
 	LoopbackLinks []LoopbackLink
@@ -95,8 +129,12 @@ func (r *Route) toTcpipRoute(id tcpip.NICID) tcpip.Route {
 // CreateLinksAndRoutes creates links and routes in a network stack.  It should
 // only be called once.
 func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct{}) error {
-	if len(args.FilePayload.Files) != len(args.FDBasedLinks) {
-		return fmt.Errorf("FilePayload must be same length at FDBasedLinks")
+	wantFDs := 0
+	for _, l := range args.FDBasedLinks {
+		wantFDs += l.NumChannels
+	}
+	if len(args.FilePayload.Files) != wantFDs {
+		return fmt.Errorf("FilePayload must have %d FDs, one per channel of FDBasedLinks, got %d", wantFDs, len(args.FilePayload.Files))
 	}
 
 	var nicID tcpip.NICID
@@ -123,31 +161,15 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 		}
 	}
 
-	for i, link := range args.FDBasedLinks {
+	fdOffset := 0
+	for _, link := range args.FDBasedLinks {
 		nicID++
 		nicids[link.Name] = nicID
 
-		// Copy the underlying FD.
-		oldFD := args.FilePayload.Files[i].Fd()
-		newFD, err := syscall.Dup(int(oldFD))
-		if err != nil {
-			return fmt.Errorf("failed to dup FD %v: %v", oldFD, err)
-		}
-
-		mac := tcpip.LinkAddress(generateRndMac())
-		linkEP := fdbased.New(&fdbased.Options{
-			FD:                 newFD,
-			MTU:                uint32(link.MTU),
-			EthernetHeader:     true,
-			Address:            mac,
-			PacketDispatchMode: fdbased.PacketMMap,
-			GSOMaxSize:         link.GSOMaxSize,
-		})
-
-		log.Infof("Enabling interface %q with id %d on addresses %+v (%v)", link.Name, nicID, link.Addresses, mac)
-		if err := n.createNICWithAddrs(nicID, link.Name, linkEP, link.Addresses, false /* loopback */); err != nil {
+		if err := n.createFDBasedLink(nicID, link, args.FilePayload.Files[fdOffset:fdOffset+link.NumChannels]); err != nil {
 			return err
 		}
+		fdOffset += link.NumChannels
 
 		// Collect the routes from this link.
 		for _, r := range link.Routes {
@@ -165,6 +187,174 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 
 	log.Infof("Setting routes %+v", routes)
 	n.Stack.SetRouteTable(routes)
+
+	n.mu.Lock()
+	if nicID > n.lastNICID {
+		n.lastNICID = nicID
+	}
+	n.mu.Unlock()
+	return nil
+}
+
+// AddLinkArgs are arguments to AddLink.
+type AddLinkArgs struct {
+	// FilePayload contains the NumChannels fds of Link.
+	urpc.FilePayload
+
+	Link FDBasedLink
+
+	// DefaultGateway, if not empty, is the default route through Link.
+	DefaultGateway Route
+}
+
+// AddLink adds an fd-based link, with its addresses and routes, to a network
+// stack whose links and routes were already created.
+func (n *Network) AddLink(args *AddLinkArgs, _ *struct{}) error {
+	link := args.Link
+	if len(args.FilePayload.Files) != link.NumChannels {
+		return fmt.Errorf("FilePayload must have %d FDs, one per channel of the link, got %d", link.NumChannels, len(args.FilePayload.Files))
+	}
+	if n.Stack.FindNICByName(link.Name) != 0 {
+		return fmt.Errorf("interface %q already exists", link.Name)
+	}
+
+	// Use an ID above all those used so far, including by NICs that were
+	// removed since.
+	n.mu.Lock()
+	for id := range n.Stack.NICInfo() {
+		if id > n.lastNICID {
+			n.lastNICID = id
+		}
+	}
+	n.lastNICID++
+	nicID := n.lastNICID
+	n.mu.Unlock()
+
+	if err := n.createFDBasedLink(nicID, link, args.FilePayload.Files); err != nil {
+		return err
+	}
+
+	var routes []tcpip.Route
+	for _, r := range link.Routes {
+		routes = append(routes, r.toTcpipRoute(nicID))
+	}
+	if !args.DefaultGateway.Empty() {
+		routes = append(routes, args.DefaultGateway.toTcpipRoute(nicID))
+	}
+	table := n.Stack.GetRouteTable()
+	for _, r := range routes {
+		table = insertRoute(table, r)
+	}
+	log.Infof("Setting routes %+v", table)
+	n.Stack.SetRouteTable(table)
+	return nil
+}
+
+// RemoveLinkArgs are arguments to RemoveLink.
+type RemoveLinkArgs struct {
+	Name string
+}
+
+// RemoveLink removes a link, with its addresses and the routes through it, from
+// a network stack. The FDs of fd-based links are closed.
+func (n *Network) RemoveLink(args *RemoveLinkArgs, _ *struct{}) error {
+	nicID := n.Stack.FindNICByName(args.Name)
+	if nicID == 0 {
+		return fmt.Errorf("interface %q doesn't exist", args.Name)
+	}
+	log.Infof("Removing interface %q with id %d", args.Name, nicID)
+	if err := n.Stack.RemoveNIC(nicID); err != nil {
+		return fmt.Errorf("RemoveNIC(%v) failed: %v", nicID, err)
+	}
+
+	// RemoveNIC closed the link endpoint, so its FDs are no longer used.
+	n.mu.Lock()
+	fds := n.linkFDs[nicID]
+	delete(n.linkFDs, nicID)
+	n.mu.Unlock()
+	closeFDs(fds)
+	return nil
+}
+
+// closeFDs closes all fds.
+func closeFDs(fds []int) {
+	for _, fd := range fds {
+		syscall.Close(fd)
+	}
+}
+
+// insertRoute inserts r in the route table before the first route with a
+// shorter prefix, so that the longest matching prefix is still found first.
+func insertRoute(table []tcpip.Route, r tcpip.Route) []tcpip.Route {
+	i := 0
+	for ; i < len(table); i++ {
+		if prefixLen(table[i].Mask) < prefixLen(r.Mask) {
+			break
+		}
+	}
+	table = append(table, tcpip.Route{})
+	copy(table[i+1:], table[i:])
+	table[i] = r
+	return table
+}
+
+// prefixLen returns the number of bits set in mask.
+func prefixLen(mask tcpip.AddressMask) int {
+	n := 0
+	for i := 0; i < len(mask); i++ {
+		n += bits.OnesCount8(mask[i])
+	}
+	return n
+}
+
+// createFDBasedLink creates the NIC with the given id of an fd-based link,
+// whose FDs are duplicated from files.
+func (n *Network) createFDBasedLink(nicID tcpip.NICID, link FDBasedLink, files []*os.File) error {
+	// Copy the underlying FDs.
+	fds := make([]int, 0, len(files))
+	for _, f := range files {
+		oldFD := f.Fd()
+		newFD, err := syscall.Dup(int(oldFD))
+		if err != nil {
+			closeFDs(fds)
+			return fmt.Errorf("failed to dup FD %v: %v", oldFD, err)
+		}
+		fds = append(fds, newFD)
+	}
+
+	mac := tcpip.LinkAddress(generateRndMac())
+	linkEP := fdbased.New(&fdbased.Options{
+		FDs:                fds,
+		MTU:                uint32(link.MTU),
+		EthernetHeader:     true,
+		Address:            mac,
+		PacketDispatchMode: fdbased.PacketMMap,
+		GSOMaxSize:         link.GSOMaxSize,
+		BusyPoll:           link.BusyPoll,
+		SaveRestore:        link.SaveRestore,
+	})
+
+	log.Infof("Enabling interface %q with id %d on addresses %+v (%v)", link.Name, nicID, link.Addresses, mac)
+	err := n.createNICWithAddrs(nicID, link.Name, linkEP, link.Addresses, false /* loopback */)
+	if err == nil && link.NDP {
+		err = n.enableNDP(nicID, mac)
+	}
+	if err != nil {
+		// Release the endpoint, through its NIC if it was created, before
+		// closing the FDs it uses.
+		if n.Stack.RemoveNIC(nicID) != nil {
+			stack.FindLinkEndpoint(linkEP).(stack.ClosableEndpoint).Close()
+		}
+		closeFDs(fds)
+		return err
+	}
+
+	n.mu.Lock()
+	if n.linkFDs == nil {
+		n.linkFDs = make(map[tcpip.NICID][]int)
+	}
+	n.linkFDs[nicID] = fds
+	n.mu.Unlock()
 	return nil
 }
 
@@ -195,6 +385,22 @@ func (n *Network) createNICWithAddrs(id tcpip.NICID, name string, linkEP tcpip.L
 	return nil
 }
 
+// enableNDP enables NDP on the given NIC and assigns it the link-local address
+// derived from linkAddr, which is checked for uniqueness by DAD. Addresses
+// already assigned to the NIC aren't checked.
+func (n *Network) enableNDP(id tcpip.NICID, linkAddr tcpip.LinkAddress) error {
+	if err := n.Stack.SetNDPConfigurations(id, stack.DefaultNDPConfigurations()); err != nil {
+		return fmt.Errorf("SetNDPConfigurations(%v, _) failed: %v", id, err)
+	}
+
+	lladdr := header.LinkLocalAddr(linkAddr)
+	log.Infof("Enabling NDP on interface with id %d, link-local address %v", id, lladdr)
+	if err := n.Stack.AddAddress(id, ipv6.ProtocolNumber, lladdr); err != nil {
+		return fmt.Errorf("AddAddress(%v, %v, %v) failed: %v", id, ipv6.ProtocolNumber, lladdr, err)
+	}
+	return nil
+}
+
 // ipToAddressAndProto converts IP to tcpip.Address and a protocol number.
 //
 // Note: don't use 'len(ip)' to determine IP version because length is always 16.
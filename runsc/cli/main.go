@@ -0,0 +1,444 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cli implements the runsc command line. It is shared by the runsc
+// binary and by programs embedding runsc, which re-execute themselves as the
+// sandbox and gofer processes.
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"flag"
+
+	"github.com/google/subcommands"
+	"gvisor.googlesource.com/gvisor/pkg/cpuid"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/watchdog"
+	"gvisor.googlesource.com/gvisor/runsc/boot"
+	"gvisor.googlesource.com/gvisor/runsc/cmd"
+	"gvisor.googlesource.com/gvisor/runsc/specutils"
+)
+
+// flags are the runsc flags, which configure the sandbox, logging, and the
+// runsc command itself.
+type flags struct {
+	// Although these flags are not part of the OCI spec, they are used by
+	// Docker, and thus should not be changed.
+	rootDir     *string
+	logFilename *string
+	logFormat   *string
+	debug       *bool
+	showVersion *bool
+
+	// These flags are unique to runsc, and are used to configure parts of the
+	// system that are not covered by the runtime spec.
+
+	// Debugging flags.
+	debugLog       *string
+	logPackets     *bool
+	logFD          *int
+	debugLogFD     *int
+	debugLogFormat *string
+
+	// Debugging flags: strace related
+	strace         *bool
+	straceSyscalls *string
+	straceLogSize  *uint
+
+	// Flags that control sandbox runtime behavior.
+	platform        *string
+	kvmPinCPUs      *bool
+	cpuFeatures     *string
+	vsyscall        *string
+	mmapRndBits     *string
+	mmapLayout      *string
+	hostMLock       *bool
+	network         *string
+	gso             *bool
+	ndp             *bool
+	netChannels     *int
+	netBusyPoll     *time.Duration
+	netRestore      *bool
+	fileAccess      *string
+	overlay         *bool
+	hostUDS         *bool
+	hostUDSFDs      *bool
+	hostUDSSendFDs  *bool
+	coalesceSync    *bool
+	watchdogAction  *string
+	watchdogTimeout *time.Duration
+	watchdogDumpDir *string
+	panicSignal     *int
+	pauseMonotonic  *bool
+	syscallMetrics  *bool
+	profile         *bool
+
+	allowFlagOverride *bool
+
+	testOnlyAllowRunAsCurrentUserWithoutChroot *bool
+}
+
+// newFlags registers the runsc flags in fs.
+func newFlags(fs *flag.FlagSet) *flags {
+	f := &flags{
+		rootDir:     fs.String("root", "", "root directory for storage of container state"),
+		logFilename: fs.String("log", "", "file path where internal debug information is written, default is stdout"),
+		logFormat:   fs.String("log-format", "text", "log format: text (default), json, or json-k8s"),
+		debug:       fs.Bool("debug", false, "enable debug logging"),
+		showVersion: fs.Bool("version", false, "show version and exit"),
+
+		debugLog:       fs.String("debug-log", "", "additional location for logs. If it ends with '/', log files are created inside the directory with default names. The following variables are available: %TIMESTAMP%, %COMMAND%."),
+		logPackets:     fs.Bool("log-packets", false, "enable network packet logging"),
+		logFD:          fs.Int("log-fd", -1, "file descriptor to log to.  If set, the 'log' flag is ignored."),
+		debugLogFD:     fs.Int("debug-log-fd", -1, "file descriptor to write debug logs to.  If set, the 'debug-log-dir' flag is ignored."),
+		debugLogFormat: fs.String("debug-log-format", "text", "log format: text (default), json, or json-k8s"),
+
+		strace:         fs.Bool("strace", false, "enable strace"),
+		straceSyscalls: fs.String("strace-syscalls", "", "comma-separated list of syscalls to trace. If --strace is true and this list is empty, then all syscalls will be traced."),
+		straceLogSize:  fs.Uint("strace-log-size", 1024, "default size (in bytes) to log data argument blobs"),
+
+		platform:        fs.String("platform", "ptrace", "specifies which platform to use: ptrace (default), kvm"),
+		kvmPinCPUs:      fs.Bool("kvm-pin-cpus", false, "pin the host threads running application code to the host CPUs corresponding to each task's CPU affinity (see sched_setaffinity(2)). Only supported with --platform=kvm."),
+		cpuFeatures:     fs.String("cpu-features", "", "comma-separated list of CPU features, as named in /proc/cpuinfo, to hide from (\"-avx512f\") or expose to (\"+avx\") the sandbox relative to the host. Added features must be supported by the host."),
+		vsyscall:        fs.String("vsyscall", "emulate", "specifies how calls to the legacy vsyscall page are handled: emulate (default) services them as the corresponding system calls, none makes them fault with SIGSEGV."),
+		mmapRndBits:     fs.String("mmap-rnd-bits", "28", "number of bits of randomization applied to the address space layout of applications, between 28 and 32 (see vm.mmap_rnd_bits in Linux)."),
+		mmapLayout:      fs.String("mmap-layout", "modern", "specifies the default address space layout of applications: modern (default) allocates mappings top-down from below the stack, legacy allocates them bottom-up (see vm.legacy_va_layout in Linux)."),
+		hostMLock:       fs.Bool("host-mlock", false, "lock application memory locked by mlock(2), mlockall(2), or MAP_LOCKED into host memory. Requires that the sandbox's RLIMIT_MEMLOCK on the host, or CAP_IPC_LOCK, permits it; memory that can't be locked is only locked within the sandbox."),
+		network:         fs.String("network", "sandbox", "specifies which network to use: sandbox (default), host, none. Using network inside the sandbox is more secure because it's isolated from the host network."),
+		gso:             fs.Bool("gso", true, "enable generic segmenation offload"),
+		ndp:             fs.Bool("ndp", false, "enable IPv6 router discovery, stateless address autoconfiguration and duplicate address detection on sandbox interfaces"),
+		netChannels:     fs.Int("num-network-channels", 1, "number of underlying channels (FDs) of each sandbox interface, among which flows are spread for packets to be processed on several CPUs."),
+		netBusyPoll:     fs.Duration("net-busy-poll", 0, "time for which sandbox interfaces busy-poll for packets after receiving one, trading CPU for lower latency. 0 (default) disables busy-polling."),
+		netRestore:      fs.Bool("net-restore", false, "save TCP connections through sandbox interfaces at checkpoint and restore them, assuming that the container is restored into the same network environment (addresses and routes). Otherwise, checkpoints of sandboxes with such connections are rejected."),
+		fileAccess:      fs.String("file-access", "exclusive", "specifies which filesystem to use for the root mount: exclusive (default), shared. Volume mounts are always shared."),
+		overlay:         fs.Bool("overlay", false, "wrap filesystem mounts with writable overlay. All modifications are stored in memory inside the sandbox."),
+		hostUDS:         fs.Bool("fsgofer-host-uds", false, "allow applications to connect to host unix domain sockets, e.g. bind mounted into the container, through the gofer."),
+		hostUDSFDs:      fs.Bool("fsgofer-host-uds-fds", false, "allow applications to receive file descriptors over host unix domain sockets connected through the gofer. Otherwise, they are closed upon receipt. Requires --fsgofer-host-uds."),
+		hostUDSSendFDs:  fs.Bool("fsgofer-host-uds-send-fds", false, "allow applications to send file descriptors over host unix domain sockets connected through the gofer. Only regular files backed by host files and sealed memfds can be sent. Requires --fsgofer-host-uds."),
+		coalesceSync:    fs.Bool("fsgofer-coalesce-sync", false, "coalesce concurrent syncs of the same file through the gofer into a single sync of the host file, improving throughput of sync-heavy workloads at the cost of sync latency."),
+		watchdogAction:  fs.String("watchdog-action", "log", "sets what action the watchdog takes when triggered: log (default), panic, dump. dump also writes the stack dump and a heap profile to --watchdog-dump-dir."),
+		watchdogTimeout: fs.Duration("watchdog-timeout", watchdog.DefaultTimeout, "time a task may run the same syscall without blocking before the watchdog considers it stuck. 0 disables the watchdog."),
+		watchdogDumpDir: fs.String("watchdog-dump-dir", "", "directory where the dump watchdog action writes diagnostics. Required by --watchdog-action=dump."),
+		panicSignal:     fs.Int("panic-signal", -1, "register signal handling that panics. Usually set to SIGUSR2(12) to troubleshoot hangs. -1 disables it."),
+		pauseMonotonic:  fs.Bool("pause-stops-monotonic", false, "stop CLOCK_MONOTONIC while the container is paused, as if the sandbox were suspended, so that timers and timeouts based on it don't all expire at once on resume. CLOCK_REALTIME keeps advancing."),
+		syscallMetrics:  fs.Bool("syscall-metrics", false, "record the number and latency of the syscalls invoked by the application, reported by 'runsc events'. This slows down every syscall."),
+		profile:         fs.Bool("profile", false, "allows profiles collected with 'runsc debug' to include memory mappings. Note that this loosens the seccomp protection added to the sandbox (DO NOT USE IN PRODUCTION)."),
+
+		allowFlagOverride: fs.Bool("allow-flag-override", false, "allow flags to be overridden per sandbox with io.gvisor.* annotations in the OCI spec. Supported flags: cpu-features, debug, file-access, network, overlay, platform."),
+
+		testOnlyAllowRunAsCurrentUserWithoutChroot: fs.Bool("TESTONLY-unsafe-nonroot", false, "TEST ONLY; do not ever use! This skips many security measures that isolate the host from the sandbox."),
+	}
+
+	// Set default root dir to something (hopefully) user-writeable.
+	*f.rootDir = "/var/run/runsc"
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		*f.rootDir = filepath.Join(runtimeDir, "runsc")
+	}
+	return f
+}
+
+// config validates the flags and returns the configuration they describe.
+func (f *flags) config() (*boot.Config, error) {
+	platformType, err := boot.MakePlatformType(*f.platform)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cpuid.HostFeatureSet().ApplySpec(*f.cpuFeatures, cpuid.HostFeatureSet()); err != nil {
+		return nil, fmt.Errorf("invalid --cpu-features: %v", err)
+	}
+
+	fsAccess, err := boot.MakeFileAccessType(*f.fileAccess)
+	if err != nil {
+		return nil, err
+	}
+
+	if fsAccess == boot.FileAccessShared && *f.overlay {
+		return nil, fmt.Errorf("overlay flag is incompatible with shared file access")
+	}
+
+	netType, err := boot.MakeNetworkType(*f.network)
+	if err != nil {
+		return nil, err
+	}
+
+	vsyscallMode, err := boot.MakeVsyscallMode(*f.vsyscall)
+	if err != nil {
+		return nil, err
+	}
+
+	mmapRandBits, err := boot.MakeMmapRandBits(*f.mmapRndBits)
+	if err != nil {
+		return nil, err
+	}
+
+	mmapLayoutMode, err := boot.MakeMmapLayoutMode(*f.mmapLayout)
+	if err != nil {
+		return nil, err
+	}
+
+	wa, err := boot.MakeWatchdogAction(*f.watchdogAction)
+	if err != nil {
+		return nil, err
+	}
+	if wa == watchdog.Dump && *f.watchdogDumpDir == "" {
+		return nil, fmt.Errorf("--watchdog-action=dump requires --watchdog-dump-dir")
+	}
+	if *f.kvmPinCPUs && platformType != boot.PlatformKVM {
+		return nil, fmt.Errorf("--kvm-pin-cpus requires --platform=kvm")
+	}
+	if *f.netChannels < 1 {
+		return nil, fmt.Errorf("--num-network-channels must be at least 1, got %d", *f.netChannels)
+	}
+	if *f.hostUDSFDs && !*f.hostUDS {
+		return nil, fmt.Errorf("--fsgofer-host-uds-fds requires --fsgofer-host-uds")
+	}
+	if *f.hostUDSSendFDs && !*f.hostUDS {
+		return nil, fmt.Errorf("--fsgofer-host-uds-send-fds requires --fsgofer-host-uds")
+	}
+
+	conf := &boot.Config{
+		RootDir:               *f.rootDir,
+		Debug:                 *f.debug,
+		LogFilename:           *f.logFilename,
+		LogFormat:             *f.logFormat,
+		DebugLog:              *f.debugLog,
+		DebugLogFormat:        *f.debugLogFormat,
+		FileAccess:            fsAccess,
+		Overlay:               *f.overlay,
+		FSGoferHostUDS:        *f.hostUDS,
+		FSGoferHostUDSFDs:     *f.hostUDSFDs,
+		FSGoferHostUDSSendFDs: *f.hostUDSSendFDs,
+		FSGoferCoalesceSync:   *f.coalesceSync,
+		Network:               netType,
+		GSO:                   *f.gso,
+		NDP:                   *f.ndp,
+		NetBusyPoll:           *f.netBusyPoll,
+		NumNetworkChannels:    *f.netChannels,
+		NetRestore:            *f.netRestore,
+		LogPackets:            *f.logPackets,
+		Platform:              platformType,
+		KVMPinCPUs:            *f.kvmPinCPUs,
+		CPUFeatures:           *f.cpuFeatures,
+		Vsyscall:              vsyscallMode,
+		MmapRandBits:          mmapRandBits,
+		MmapLayout:            mmapLayoutMode,
+		HostMLock:             *f.hostMLock,
+		Strace:                *f.strace,
+		StraceLogSize:         *f.straceLogSize,
+		WatchdogAction:        wa,
+		WatchdogTimeout:       *f.watchdogTimeout,
+		WatchdogDumpDir:       *f.watchdogDumpDir,
+		PanicSignal:           *f.panicSignal,
+		ProfileEnable:         *f.profile,
+		PauseStopsMonotonic:   *f.pauseMonotonic,
+		SyscallMetrics:        *f.syscallMetrics,
+		AllowFlagOverride:     *f.allowFlagOverride,
+		TestOnlyAllowRunAsCurrentUserWithoutChroot: *f.testOnlyAllowRunAsCurrentUserWithoutChroot,
+	}
+	if len(*f.straceSyscalls) != 0 {
+		conf.StraceSyscalls = strings.Split(*f.straceSyscalls, ",")
+	}
+	return conf, nil
+}
+
+// DefaultConfig returns the configuration given by the default values of the
+// runsc flags.
+func DefaultConfig() (*boot.Config, error) {
+	return newFlags(flag.NewFlagSet("runsc", flag.ContinueOnError)).config()
+}
+
+// Subcommand returns the runsc subcommand that args, the arguments of runsc
+// without the program name, run. It returns "" if args don't start with valid
+// runsc flags followed by a subcommand.
+func Subcommand(args []string) string {
+	fs := flag.NewFlagSet("runsc", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	newFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return ""
+	}
+	return fs.Arg(0)
+}
+
+// Main runs the runsc command given by os.Args and exits with its status.
+// version is reported by --version and in the logs.
+//
+// The flags are parsed with a flag set of their own, so that Main doesn't
+// conflict with the flags of the program calling it.
+func Main(version string) {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	f := newFlags(fs)
+
+	commander := subcommands.NewCommander(fs, filepath.Base(os.Args[0]))
+
+	// Help and flags commands are generated automatically.
+	commander.Register(commander.HelpCommand(), "")
+	commander.Register(commander.FlagsCommand(), "")
+
+	// Register user-facing runsc commands.
+	commander.Register(new(cmd.Checkpoint), "")
+	commander.Register(new(cmd.Create), "")
+	commander.Register(new(cmd.Delete), "")
+	commander.Register(new(cmd.Do), "")
+	commander.Register(new(cmd.Events), "")
+	commander.Register(new(cmd.Exec), "")
+	commander.Register(new(cmd.Interface), "")
+	commander.Register(new(cmd.Kill), "")
+	commander.Register(new(cmd.Lint), "")
+	commander.Register(new(cmd.List), "")
+	commander.Register(new(cmd.Pause), "")
+	commander.Register(new(cmd.PS), "")
+	commander.Register(new(cmd.Resolver), "")
+	commander.Register(new(cmd.Restore), "")
+	commander.Register(new(cmd.Resume), "")
+	commander.Register(new(cmd.Run), "")
+	commander.Register(new(cmd.Spec), "")
+	commander.Register(new(cmd.Start), "")
+	commander.Register(new(cmd.State), "")
+	commander.Register(new(cmd.Wait), "")
+
+	// Register internal commands with the internal group name. This causes
+	// them to be sorted below the user-facing commands with empty group.
+	// The string below will be printed above the commands.
+	const internalGroup = "internal use only"
+	commander.Register(new(cmd.Boot), internalGroup)
+	commander.Register(new(cmd.Debug), internalGroup)
+	commander.Register(new(cmd.Gofer), internalGroup)
+
+	// All subcommands must be registered before flag parsing.
+	fs.Parse(os.Args[1:])
+
+	// Are we showing the version?
+	if *f.showVersion {
+		// The format here is the same as runc.
+		fmt.Fprintf(os.Stdout, "runsc version %s\n", version)
+		fmt.Fprintf(os.Stdout, "spec: %s\n", specutils.Version)
+		os.Exit(0)
+	}
+
+	// Create a new Config from the flags.
+	conf, err := f.config()
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+
+	// Set up logging.
+	if *f.debug {
+		log.SetLevel(log.Debug)
+	}
+
+	var logFile io.Writer = os.Stderr
+	if *f.logFD > -1 {
+		logFile = os.NewFile(uintptr(*f.logFD), "log file")
+	} else if *f.logFilename != "" {
+		// We must set O_APPEND and not O_TRUNC because Docker passes
+		// the same log file for all commands (and also parses these
+		// log files), so we can't destroy them on each command.
+		lf, err := os.OpenFile(*f.logFilename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			cmd.Fatalf("error opening log file %q: %v", *f.logFilename, err)
+		}
+		logFile = lf
+	}
+
+	e := newEmitter(*f.logFormat, logFile)
+
+	subcommand := fs.Arg(0)
+	if *f.debugLogFD > -1 {
+		df := os.NewFile(uintptr(*f.debugLogFD), "debug log file")
+
+		// Quick sanity check to make sure no other commands get passed
+		// a log fd (they should use log dir instead).
+		if subcommand != "boot" && subcommand != "gofer" {
+			cmd.Fatalf("flag --debug-log-fd should only be passed to 'boot' and 'gofer' command, but was passed to %q", subcommand)
+		}
+
+		// If we are the boot process, then we own our stdio FDs and
+		// can do what we want with them. Since Docker and Containerd
+		// both eat boot's stderr, we dup our stderr to the provided
+		// log FD so that panics will appear in the logs, rather than
+		// just disappear.
+		if err := syscall.Dup2(int(df.Fd()), int(os.Stderr.Fd())); err != nil {
+			cmd.Fatalf("error dup'ing fd %d to stderr: %v", df.Fd(), err)
+		}
+
+		if logFile == os.Stderr {
+			// Suppress logging to stderr when debug log is enabled. Otherwise all
+			// messages will be duplicated in the debug log (see Dup2() call above).
+			e = newEmitter(*f.debugLogFormat, df)
+		} else {
+			e = log.MultiEmitter{e, newEmitter(*f.debugLogFormat, df)}
+		}
+	} else if *f.debugLog != "" {
+		df, err := specutils.DebugLogFile(*f.debugLog, subcommand)
+		if err != nil {
+			cmd.Fatalf("error opening debug log file in %q: %v", *f.debugLog, err)
+		}
+		e = log.MultiEmitter{e, newEmitter(*f.debugLogFormat, df)}
+	}
+
+	log.SetTarget(e)
+
+	log.Infof("***************************")
+	log.Infof("Args: %s", os.Args)
+	log.Infof("Version %s", version)
+	log.Infof("PID: %d", os.Getpid())
+	log.Infof("UID: %d, GID: %d", os.Getuid(), os.Getgid())
+	log.Infof("Configuration:")
+	log.Infof("\t\tRootDir: %s", conf.RootDir)
+	log.Infof("\t\tPlatform: %v", conf.Platform)
+	log.Infof("\t\tFileAccess: %v, overlay: %t", conf.FileAccess, conf.Overlay)
+	log.Infof("\t\tNetwork: %v, logging: %t", conf.Network, conf.LogPackets)
+	log.Infof("\t\tStrace: %t, max size: %d, syscalls: %s", conf.Strace, conf.StraceLogSize, conf.StraceSyscalls)
+	log.Infof("***************************")
+
+	// Call the subcommand and pass in the configuration.
+	var ws syscall.WaitStatus
+	subcmdCode := commander.Execute(context.Background(), conf, &ws)
+	if subcmdCode == subcommands.ExitSuccess {
+		log.Infof("Exiting with status: %v", ws)
+		if ws.Signaled() {
+			// No good way to return it, emulate what the shell does. Maybe raise
+			// signall to self?
+			os.Exit(128 + int(ws.Signal()))
+		}
+		os.Exit(ws.ExitStatus())
+	}
+	// Return an error that is unlikely to be used by the application.
+	log.Warningf("Failure to execute command, err: %v", subcmdCode)
+	os.Exit(128)
+}
+
+func newEmitter(format string, logFile io.Writer) log.Emitter {
+	switch format {
+	case "text":
+		return &log.GoogleEmitter{&log.Writer{Next: logFile}}
+	case "json":
+		return &log.JSONEmitter{log.Writer{Next: logFile}}
+	case "json-k8s":
+		return &log.K8sJSONEmitter{log.Writer{Next: logFile}}
+	}
+	cmd.Fatalf("invalid log format %q, must be 'text', 'json', or 'json-k8s'", format)
+	panic("unreachable")
+}
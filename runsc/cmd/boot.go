@@ -52,6 +52,10 @@ type Boot struct {
 	// provided in that order.
 	stdioFDs intFlags
 
+	// blockDeviceFDs are the fds for the block devices in the spec. Each
+	// device has two fds: one for buffered I/O, then one for O_DIRECT.
+	blockDeviceFDs intFlags
+
 	// console is set to true if the sandbox should allow terminal ioctl(2)
 	// syscalls.
 	console bool
@@ -81,6 +85,10 @@ type Boot struct {
 	// sandbox (e.g. gofer) and sent through this FD.
 	mountsFD int
 
+	// watchdogDumpFD is the file descriptor of the directory where the
+	// watchdog writes diagnostics.
+	watchdogDumpFD int
+
 	// pidns is set if the sanadbox is in its own pid namespace.
 	pidns bool
 }
@@ -108,6 +116,7 @@ func (b *Boot) SetFlags(f *flag.FlagSet) {
 	f.IntVar(&b.deviceFD, "device-fd", -1, "FD for the platform device file")
 	f.Var(&b.ioFDs, "io-fds", "list of FDs to connect 9P clients. They must follow this order: root first, then mounts as defined in the spec")
 	f.Var(&b.stdioFDs, "stdio-fds", "list of FDs containing sandbox stdin, stdout, and stderr in that order")
+	f.Var(&b.blockDeviceFDs, "block-device-fds", "list of FDs for block devices in the spec, two per device: buffered, then O_DIRECT")
 	f.BoolVar(&b.console, "console", false, "set to true if the sandbox should allow terminal ioctl(2) syscalls")
 	f.BoolVar(&b.applyCaps, "apply-caps", false, "if true, apply capabilities defined in the spec to the process")
 	f.BoolVar(&b.setUpRoot, "setup-root", false, "if true, set up an empty root for the process")
@@ -117,6 +126,7 @@ func (b *Boot) SetFlags(f *flag.FlagSet) {
 	f.IntVar(&b.userLogFD, "user-log-fd", 0, "file descriptor to write user logs to. 0 means no logging.")
 	f.IntVar(&b.startSyncFD, "start-sync-fd", -1, "required FD to used to synchronize sandbox startup")
 	f.IntVar(&b.mountsFD, "mounts-fd", -1, "mountsFD is the file descriptor to read list of mounts after they have been resolved (direct paths, no symlinks).")
+	f.IntVar(&b.watchdogDumpFD, "watchdog-dump-fd", 0, "FD of the directory where the watchdog writes diagnostics. 0 means none.")
 }
 
 // Execute implements subcommands.Command.Execute.  It starts a sandbox in a
@@ -209,17 +219,19 @@ func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 
 	// Create the loader.
 	bootArgs := boot.Args{
-		ID:           f.Arg(0),
-		Spec:         spec,
-		Conf:         conf,
-		ControllerFD: b.controllerFD,
-		DeviceFD:     b.deviceFD,
-		GoferFDs:     b.ioFDs.GetArray(),
-		StdioFDs:     b.stdioFDs.GetArray(),
-		Console:      b.console,
-		NumCPU:       b.cpuNum,
-		TotalMem:     b.totalMem,
-		UserLogFD:    b.userLogFD,
+		ID:             f.Arg(0),
+		Spec:           spec,
+		Conf:           conf,
+		ControllerFD:   b.controllerFD,
+		DeviceFD:       b.deviceFD,
+		GoferFDs:       b.ioFDs.GetArray(),
+		StdioFDs:       b.stdioFDs.GetArray(),
+		BlockDeviceFDs: b.blockDeviceFDs.GetArray(),
+		Console:        b.console,
+		NumCPU:         b.cpuNum,
+		TotalMem:       b.totalMem,
+		UserLogFD:      b.userLogFD,
+		WatchdogDumpFD: b.watchdogDumpFD,
 	}
 	l, err := boot.New(bootArgs)
 	if err != nil {
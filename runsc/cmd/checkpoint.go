@@ -35,6 +35,7 @@ const checkpointFileName = "checkpoint.img"
 type Checkpoint struct {
 	imagePath    string
 	leaveRunning bool
+	compression  string
 }
 
 // Name implements subcommands.Command.Name.
@@ -57,6 +58,7 @@ func (*Checkpoint) Usage() string {
 func (c *Checkpoint) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&c.imagePath, "image-path", "", "directory path to saved container image")
 	f.BoolVar(&c.leaveRunning, "leave-running", false, "restart the container after checkpointing")
+	f.StringVar(&c.compression, "compression", "flate", "compression algorithm of the checkpoint image: flate (default), zstd")
 
 	// Unimplemented flags necessary for compatibility with docker.
 	var wp string
@@ -97,7 +99,7 @@ func (c *Checkpoint) Execute(_ context.Context, f *flag.FlagSet, args ...interfa
 	}
 	defer file.Close()
 
-	if err := cont.Checkpoint(file); err != nil {
+	if err := cont.Checkpoint(file, c.compression); err != nil {
 		Fatalf("checkpoint failed: %v", err)
 	}
 
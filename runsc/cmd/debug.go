@@ -16,13 +16,21 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"flag"
 	"github.com/google/subcommands"
 	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/control"
+	"gvisor.googlesource.com/gvisor/pkg/urpc"
 	"gvisor.googlesource.com/gvisor/runsc/boot"
 	"gvisor.googlesource.com/gvisor/runsc/container"
 )
@@ -34,7 +42,17 @@ type Debug struct {
 	signal       int
 	profileHeap  string
 	profileCPU   string
+	profileBlock string
+	profileMutex string
 	profileDelay int
+	strace       string
+	straceOff    bool
+	stracePIDs   string
+	straceJSON   bool
+	straceOutput string
+	exportFS     string
+	exportFSPath string
+	exportNet    string
 }
 
 // Name implements subcommands.Command.
@@ -58,8 +76,18 @@ func (d *Debug) SetFlags(f *flag.FlagSet) {
 	f.BoolVar(&d.stacks, "stacks", false, "if true, dumps all sandbox stacks to the log")
 	f.StringVar(&d.profileHeap, "profile-heap", "", "writes heap profile to the given file.")
 	f.StringVar(&d.profileCPU, "profile-cpu", "", "writes CPU profile to the given file.")
-	f.IntVar(&d.profileDelay, "profile-delay", 5, "amount of time to wait before stoping CPU profile")
+	f.StringVar(&d.profileBlock, "profile-block", "", "writes goroutine blocking profile to the given file.")
+	f.StringVar(&d.profileMutex, "profile-mutex", "", "writes mutex contention profile to the given file.")
+	f.IntVar(&d.profileDelay, "profile-delay", 5, "duration in seconds of the CPU, block and mutex profiles, which are collected concurrently")
 	f.IntVar(&d.signal, "signal", -1, "sends signal to the sandbox")
+	f.StringVar(&d.strace, "strace", "", `enables strace in the sandbox for a comma-separated list of syscalls, or "all"`)
+	f.BoolVar(&d.straceOff, "strace-disable", false, "disables strace in the sandbox")
+	f.StringVar(&d.stracePIDs, "strace-pids", "", "comma-separated list of PIDs, in the sandbox's root PID namespace, to restrict strace to")
+	f.BoolVar(&d.straceJSON, "strace-json", false, "emits straces as JSON lines")
+	f.StringVar(&d.straceOutput, "strace-output", "", "writes JSON straces to the given file instead of the sandbox log. Requires --strace-json")
+	f.StringVar(&d.exportFS, "export-fs", "", "writes a tar archive of the sandbox tmpfs and overlay upper layer contents to the given file.")
+	f.StringVar(&d.exportFSPath, "export-fs-path", "/", "directory in the sandbox exported by --export-fs")
+	f.StringVar(&d.exportNet, "export-netstack", "", "writes the sandbox network stack state as JSON to the given file.")
 }
 
 // Execute implements subcommands.Command.Execute.
@@ -114,6 +142,11 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 			Fatalf("failed to send signal %d to processs %d", d.signal, c.Sandbox.Pid)
 		}
 	}
+	if d.strace != "" || d.straceOff {
+		if err := d.configureStrace(c); err != nil {
+			Fatalf("configuring strace: %v", err)
+		}
+	}
 	if d.stacks {
 		log.Infof("Retrieving sandbox stacks")
 		stacks, err := c.Sandbox.Stacks()
@@ -122,35 +155,119 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		}
 		log.Infof("     *** Stack dump ***\n%s", stacks)
 	}
-	if d.profileCPU != "" {
-		f, err := os.Create(d.profileCPU)
+	// Profiles that sample events over time are collected concurrently,
+	// so that they cover the same period.
+	duration := time.Duration(d.profileDelay) * time.Second
+	var wg sync.WaitGroup
+	for _, p := range []struct {
+		name    string
+		file    string
+		collect func(*os.File, time.Duration) error
+	}{
+		{"CPU", d.profileCPU, c.Sandbox.CPUProfile},
+		{"Block", d.profileBlock, c.Sandbox.BlockProfile},
+		{"Mutex", d.profileMutex, c.Sandbox.MutexProfile},
+	} {
+		if p.file == "" {
+			continue
+		}
+		f, err := os.Create(p.file)
 		if err != nil {
 			Fatalf(err.Error())
 		}
 		defer f.Close()
 
-		if err := c.Sandbox.StartCPUProfile(f); err != nil {
+		log.Infof("%s profile started for %d sec, writing to %q", p.name, d.profileDelay, p.file)
+		wg.Add(1)
+		go func(name, file string, collect func(*os.File, time.Duration) error) {
+			defer wg.Done()
+			if err := collect(f, duration); err != nil {
+				Fatalf(err.Error())
+			}
+			log.Infof("%s profile written to %q", name, file)
+		}(p.name, p.file, p.collect)
+	}
+	wg.Wait()
+
+	if d.profileHeap != "" {
+		f, err := os.Create(d.profileHeap)
+		if err != nil {
 			Fatalf(err.Error())
 		}
-		log.Infof("CPU profile started for %d sec, writing to %q", d.profileDelay, d.profileCPU)
-		time.Sleep(time.Duration(d.profileDelay) * time.Second)
+		defer f.Close()
 
-		if err := c.Sandbox.StopCPUProfile(); err != nil {
+		if err := c.Sandbox.HeapProfile(f); err != nil {
 			Fatalf(err.Error())
 		}
-		log.Infof("CPU profile written to %q", d.profileCPU)
+		log.Infof("Heap profile written to %q", d.profileHeap)
 	}
-	if d.profileHeap != "" {
-		f, err := os.Create(d.profileHeap)
+	if d.exportFS != "" {
+		f, err := os.Create(d.exportFS)
 		if err != nil {
 			Fatalf(err.Error())
 		}
 		defer f.Close()
 
-		if err := c.Sandbox.HeapProfile(f); err != nil {
+		if err := c.Sandbox.ExportFilesystem(d.exportFSPath, f); err != nil {
 			Fatalf(err.Error())
 		}
-		log.Infof("Heap profile written to %q", d.profileHeap)
+		log.Infof("Filesystem %q exported to %q", d.exportFSPath, d.exportFS)
+	}
+	if d.exportNet != "" {
+		state, err := c.Sandbox.ExportNetstack()
+		if err != nil {
+			Fatalf(err.Error())
+		}
+		b, err := json.MarshalIndent(state, "", "  ")
+		if err != nil {
+			Fatalf(err.Error())
+		}
+		if err := ioutil.WriteFile(d.exportNet, append(b, '\n'), 0644); err != nil {
+			Fatalf(err.Error())
+		}
+		log.Infof("Netstack state exported to %q", d.exportNet)
 	}
 	return subcommands.ExitSuccess
 }
+
+// configureStrace enables or disables strace in the sandbox according to the
+// strace flags.
+func (d *Debug) configureStrace(c *container.Container) error {
+	if d.straceOff {
+		if d.strace != "" {
+			return fmt.Errorf("--strace and --strace-disable are mutually exclusive")
+		}
+		log.Infof("Disabling strace")
+		return c.Sandbox.Strace(&control.StraceArgs{})
+	}
+
+	args := &control.StraceArgs{
+		Enable: true,
+		JSON:   d.straceJSON,
+	}
+	if d.strace != "all" {
+		args.Syscalls = strings.Split(d.strace, ",")
+	}
+	if d.stracePIDs != "" {
+		for _, p := range strings.Split(d.stracePIDs, ",") {
+			pid, err := strconv.ParseInt(p, 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid PID %q: %v", p, err)
+			}
+			args.PIDs = append(args.PIDs, int32(pid))
+		}
+	}
+	if d.straceOutput != "" {
+		if !d.straceJSON {
+			return fmt.Errorf("--strace-output requires --strace-json")
+		}
+		f, err := os.OpenFile(d.straceOutput, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		args.FilePayload = urpc.FilePayload{Files: []*os.File{f}}
+	}
+	log.Infof("Enabling strace, syscalls: %s", d.strace)
+	return c.Sandbox.Strace(args)
+}
@@ -0,0 +1,391 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"flag"
+	"github.com/google/subcommands"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/runsc/boot"
+	"gvisor.googlesource.com/gvisor/runsc/container"
+	"gvisor.googlesource.com/gvisor/runsc/specutils"
+)
+
+// Do implements subcommands.Command for the "do" command. It sets up a simple
+// sandbox and executes the command inside it. See Usage() for more details.
+type Do struct {
+	root    string
+	cwd     string
+	ip      string
+	volumes stringSlice
+}
+
+// Name implements subcommands.Command.Name.
+func (*Do) Name() string {
+	return "do"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Do) Synopsis() string {
+	return "simple way to execute a command inside a sandbox without an OCI bundle"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Do) Usage() string {
+	return `do [flags] <cmd> - runs a command.
+
+This command starts a sandbox with host filesystem mounted inside as readonly,
+with a writable tmpfs overlay on top of it. The given command is executed inside
+the sandbox. It's to be used to quickly run applications, e.g. during
+development or in CI, without having to write an OCI bundle or install docker.
+
+The network is set up according to --network:
+  sandbox: the sandbox gets a veth device with address --ip in a new network
+           namespace. Traffic is NAT'd to the host's default route device.
+           If --ip isn't set, a 192.168.x.0/24 subnet not used by the host
+           is picked for each run.
+  host:    the sandbox uses the host network, including host loopback.
+  none:    the sandbox only has a loopback device.
+
+--network=sandbox requires root, as well as the ip, iptables and sysctl tools.
+
+Host directories can be mapped into the sandbox with --volume, e.g.
+  runsc do --volume=$PWD:/src make -C /src
+Volumes are read-only: writes to them would only reach the tmpfs overlay and
+never the host, so writable volumes are rejected.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (d *Do) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&d.root, "root", "/", `path to the root directory, defaults to "/"`)
+	f.StringVar(&d.cwd, "cwd", ".", "path to the current directory, defaults to the current directory")
+	f.StringVar(&d.ip, "ip", "", "IPv4 address for the sandbox with --network=sandbox, in a /24 subnet not used by the host. Picked for each run if empty")
+	f.Var(&d.volumes, "volume", "host directory to map read-only into the sandbox, as <host path>:<sandbox path>[:ro]. Can be repeated")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (d *Do) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if len(f.Args()) == 0 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	conf := args[0].(*boot.Config)
+	waitStatus := args[1].(*syscall.WaitStatus)
+
+	// Map the entire host file system, but make it readonly with a writable
+	// overlay on top (ignore --overlay option).
+	conf.Overlay = true
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		Fatalf("Error to retrieve hostname: %v", err)
+	}
+
+	absRoot, err := resolvePath(d.root)
+	if err != nil {
+		Fatalf("Error resolving root: %v", err)
+	}
+	absCwd, err := resolvePath(d.cwd)
+	if err != nil {
+		Fatalf("Error resolving current directory: %v", err)
+	}
+
+	spec := &specs.Spec{
+		Root: &specs.Root{
+			Path: absRoot,
+		},
+		Process: &specs.Process{
+			Cwd:          absCwd,
+			Args:         f.Args(),
+			Env:          os.Environ(),
+			Capabilities: specutils.AllCapabilities(),
+		},
+		Hostname: hostname,
+	}
+	for _, v := range d.volumes {
+		m, err := parseVolume(v)
+		if err != nil {
+			Fatalf("Error parsing volume %q: %v", v, err)
+		}
+		spec.Mounts = append(spec.Mounts, m)
+	}
+
+	cid := fmt.Sprintf("runsc-%06d", os.Getpid())
+	switch conf.Network {
+	case boot.NetworkNone:
+		spec.Linux = &specs.Linux{
+			Namespaces: []specs.LinuxNamespace{{Type: specs.NetworkNamespace}},
+		}
+	case boot.NetworkSandbox:
+		clean, err := d.setupNetwork(cid, spec)
+		if err != nil {
+			Fatalf("Error setting up network: %v", err)
+		}
+		defer clean()
+	}
+	specutils.LogSpec(spec)
+
+	out, err := json.Marshal(spec)
+	if err != nil {
+		Fatalf("Error to marshal spec: %v", err)
+	}
+	tmpDir, err := ioutil.TempDir("", "runsc-do")
+	if err != nil {
+		Fatalf("Error to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	log.Infof("Changing configuration RootDir to %q", tmpDir)
+	conf.RootDir = tmpDir
+
+	cfgPath := filepath.Join(tmpDir, "config.json")
+	if err := ioutil.WriteFile(cfgPath, out, 0755); err != nil {
+		Fatalf("Error write spec: %v", err)
+	}
+
+	ws, err := container.Run(cid, spec, conf, tmpDir, "", "", "")
+	if err != nil {
+		Fatalf("running container: %v", err)
+	}
+
+	*waitStatus = ws
+	return subcommands.ExitSuccess
+}
+
+// resolvePath returns the absolute path of p with symlinks resolved.
+func resolvePath(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// parseVolume parses a --volume flag value, <host path>:<sandbox path>[:ro],
+// into a read-only bind mount. Writable volumes are rejected, since the
+// overlay forced by do would keep their changes from reaching the host.
+func parseVolume(v string) (specs.Mount, error) {
+	parts := strings.Split(v, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return specs.Mount{}, fmt.Errorf("volume must be <host path>:<sandbox path>[:ro]")
+	}
+	src, err := resolvePath(parts[0])
+	if err != nil {
+		return specs.Mount{}, err
+	}
+	if !filepath.IsAbs(parts[1]) {
+		return specs.Mount{}, fmt.Errorf("sandbox path %q is not absolute", parts[1])
+	}
+	m := specs.Mount{
+		Type:        "bind",
+		Source:      src,
+		Destination: filepath.Clean(parts[1]),
+		Options:     []string{"rbind", "ro"},
+	}
+	if len(parts) == 3 {
+		switch parts[2] {
+		case "ro":
+		case "rw":
+			return specs.Mount{}, fmt.Errorf("writable volumes are not supported: writes would go to the sandbox's tmpfs overlay and never reach the host")
+		default:
+			return specs.Mount{}, fmt.Errorf("unknown volume option %q", parts[2])
+		}
+	}
+	return m, nil
+}
+
+// setupNetwork creates a network namespace named after cid with a veth device
+// for the sandbox, whose peer on the host is NAT'd to the host's default route
+// device. The spec is changed to use the new namespace. The returned function
+// undoes the changes.
+func (d *Do) setupNetwork(cid string, spec *specs.Spec) (func(), error) {
+	ip, err := d.sandboxIP()
+	if err != nil {
+		return nil, err
+	}
+	peerIP := make(net.IP, len(ip))
+	copy(peerIP, ip)
+	if peerIP[3] == 1 {
+		peerIP[3] = 2
+	} else {
+		peerIP[3] = 1
+	}
+
+	dev, err := defaultDevice()
+	if err != nil {
+		return nil, err
+	}
+
+	// Device names are limited to 15 characters.
+	suffix := strings.TrimPrefix(cid, "runsc-")
+	veth, peer := "ve-"+suffix, "vp-"+suffix
+
+	cmds := []string{
+		fmt.Sprintf("ip netns add %s", cid),
+		fmt.Sprintf("ip link add %s type veth peer name %s", veth, peer),
+
+		// Setup device outside the namespace.
+		fmt.Sprintf("ip addr add %s/24 dev %s", peerIP, peer),
+		fmt.Sprintf("ip link set %s up", peer),
+
+		// Setup device inside the namespace.
+		fmt.Sprintf("ip link set %s netns %s", veth, cid),
+		fmt.Sprintf("ip netns exec %s ip addr add %s/24 dev %s", cid, ip, veth),
+		fmt.Sprintf("ip netns exec %s ip link set %s up", cid, veth),
+		fmt.Sprintf("ip netns exec %s ip link set lo up", cid),
+		fmt.Sprintf("ip netns exec %s ip route add default via %s", cid, peerIP),
+
+		// Enable network access.
+		"sysctl -w net.ipv4.ip_forward=1",
+		fmt.Sprintf("iptables -t nat -A POSTROUTING -s %s -o %s -j MASQUERADE", ip, dev),
+		fmt.Sprintf("iptables -A FORWARD -i %s -o %s -j ACCEPT", dev, peer),
+		fmt.Sprintf("iptables -A FORWARD -o %s -i %s -j ACCEPT", dev, peer),
+	}
+	clean := func() {
+		cleanCmds := []string{
+			fmt.Sprintf("iptables -D FORWARD -o %s -i %s -j ACCEPT", dev, peer),
+			fmt.Sprintf("iptables -D FORWARD -i %s -o %s -j ACCEPT", dev, peer),
+			fmt.Sprintf("iptables -t nat -D POSTROUTING -s %s -o %s -j MASQUERADE", ip, dev),
+			// Deleting the peer deletes the veth device as well.
+			fmt.Sprintf("ip link delete %s", peer),
+			fmt.Sprintf("ip netns delete %s", cid),
+		}
+		for _, cmd := range cleanCmds {
+			if err := runCommand(cmd); err != nil {
+				log.Warningf("Error cleaning up network: %v", err)
+			}
+		}
+	}
+	for _, cmd := range cmds {
+		if err := runCommand(cmd); err != nil {
+			clean()
+			return nil, err
+		}
+	}
+
+	spec.Linux = &specs.Linux{
+		Namespaces: []specs.LinuxNamespace{
+			{
+				Type: specs.NetworkNamespace,
+				Path: filepath.Join("/var/run/netns", cid),
+			},
+		},
+	}
+	return clean, nil
+}
+
+// sandboxIP returns the address of the sandbox's veth device: --ip if set, or
+// else .2 in the first 192.168.x.0/24 subnet not used by the host. The search
+// starts at a subnet derived from the PID, so that concurrent runs are
+// unlikely to pick the same one.
+func (d *Do) sandboxIP() (net.IP, error) {
+	if d.ip != "" {
+		ip := net.ParseIP(d.ip).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IPv4 address %q", d.ip)
+		}
+		used, err := subnetInUse(ip)
+		if err != nil {
+			return nil, err
+		}
+		if used {
+			return nil, fmt.Errorf("subnet %s/24 of --ip is already used by the host, possibly by another sandbox", ip)
+		}
+		return ip, nil
+	}
+
+	start := os.Getpid()
+	for i := 0; i < 256; i++ {
+		ip := net.IPv4(192, 168, byte(start+i), 2).To4()
+		used, err := subnetInUse(ip)
+		if err != nil {
+			return nil, err
+		}
+		if !used {
+			return ip, nil
+		}
+	}
+	return nil, fmt.Errorf("no free 192.168.x.0/24 subnet for the sandbox, set one with --ip")
+}
+
+// subnetInUse returns true if the /24 subnet of ip overlaps with the network
+// of an address of a host interface.
+func subnetInUse(ip net.IP) (bool, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false, fmt.Errorf("listing host addresses: %v", err)
+	}
+	mask := net.CIDRMask(24, 32)
+	subnet := &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+	for _, a := range addrs {
+		n, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if subnet.Contains(n.IP) || n.Contains(ip) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// defaultDevice returns the name of the device of the host's IPv4 default
+// route.
+func defaultDevice() (string, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// Lines are: Iface Destination Gateway Flags ..., with a header line.
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) >= 2 && fields[1] == "00000000" {
+			return fields[0], nil
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no default route found in /proc/net/route")
+}
+
+// runCommand executes the command line cmd, e.g. "ip link set lo up".
+func runCommand(cmd string) error {
+	log.Debugf("Run %q", cmd)
+	args := strings.Split(cmd, " ")
+	c := exec.Command(args[0], args[1:]...)
+	if out, err := c.CombinedOutput(); err != nil {
+		return fmt.Errorf("command %q failed: %v, output: %s", cmd, err, out)
+	}
+	return nil
+}
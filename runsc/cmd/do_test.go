@@ -0,0 +1,92 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestParseVolume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "do_test")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	src, err := resolvePath(dir)
+	if err != nil {
+		t.Fatalf("resolvePath(%q) failed: %v", dir, err)
+	}
+
+	testCases := []struct {
+		input   string
+		want    specs.Mount
+		wantErr bool
+	}{
+		{
+			input: dir + ":/src",
+			want:  specs.Mount{Type: "bind", Source: src, Destination: "/src", Options: []string{"rbind", "ro"}},
+		},
+		{
+			input: dir + ":/src/:ro",
+			want:  specs.Mount{Type: "bind", Source: src, Destination: "/src", Options: []string{"rbind", "ro"}},
+		},
+		{input: dir, wantErr: true},
+		{input: dir + ":src", wantErr: true},
+		{input: dir + ":/src:rw", wantErr: true},
+		{input: dir + ":/src:foo", wantErr: true},
+		{input: dir + ":/src:ro:rw", wantErr: true},
+		{input: dir + "/nonexistent:/src", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		got, err := parseVolume(tc.input)
+		if err != nil && tc.wantErr {
+			// We got an error and wanted one.
+			continue
+		} else if err == nil && tc.wantErr {
+			t.Errorf("parseVolume(%s): got no error, but wanted one", tc.input)
+		} else if err != nil && !tc.wantErr {
+			t.Errorf("parseVolume(%s): got error %v, but wanted none", tc.input, err)
+		} else if !cmp.Equal(got, tc.want) {
+			t.Errorf("parseVolume(%s): got %+v, but wanted %+v", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestSubnetInUse(t *testing.T) {
+	// Loopback is always up in the test's network namespace.
+	used, err := subnetInUse(net.ParseIP("127.0.0.5").To4())
+	if err != nil {
+		t.Fatalf("subnetInUse() failed: %v", err)
+	}
+	if !used {
+		t.Errorf("subnetInUse(127.0.0.5): got false, wanted true")
+	}
+
+	// 192.0.2.0/24 is reserved for documentation.
+	used, err = subnetInUse(net.ParseIP("192.0.2.2").To4())
+	if err != nil {
+		t.Fatalf("subnetInUse() failed: %v", err)
+	}
+	if used {
+		t.Errorf("subnetInUse(192.0.2.2): got true, wanted false")
+	}
+}
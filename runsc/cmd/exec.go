@@ -18,12 +18,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -58,8 +61,20 @@ type Exec struct {
 	// file descriptor referencing the master end of the console's
 	// pseudoterminal.
 	consoleSocket string
+
+	// tty indicates that the process should be run on a new
+	// pseudoterminal, which is connected to the stdio of runsc.
+	tty bool
+
+	// detachKeys is the key sequence which detaches runsc from a process
+	// started with tty.
+	detachKeys string
 }
 
+// ttyDrainTimeout is the time to wait for remaining output from a process's
+// pseudoterminal after the process exits.
+const ttyDrainTimeout = time.Second
+
 // Name implements subcommands.Command.Name.
 func (*Exec) Name() string {
 	return "exec"
@@ -101,6 +116,8 @@ func (ex *Exec) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&ex.pidFile, "pid-file", "", "filename that the container pid will be written to")
 	f.StringVar(&ex.internalPidFile, "internal-pid-file", "", "filename that the container-internal pid will be written to")
 	f.StringVar(&ex.consoleSocket, "console-socket", "", "path to an AF_UNIX socket which will receive a file descriptor referencing the master end of the console's pseudoterminal")
+	f.BoolVar(&ex.tty, "tty", false, "allocate a pseudoterminal for the process and connect it to stdio")
+	f.StringVar(&ex.detachKeys, "detach-keys", console.DefaultDetachKeys, "key sequence which detaches from a process started with --tty, leaving it running without a terminal; empty to disable")
 
 	// clear-status is expected to only be set when we fork due to --detach being set.
 	f.BoolVar(&ex.clearStatus, "clear-status", true, "clear the status of the exec'd process upon completion")
@@ -143,16 +160,51 @@ func (ex *Exec) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 	// write the child's PID to the pid file. So when the container returns, the
 	// child process will also return and signal containerd.
 	if ex.detach {
+		if ex.tty {
+			Fatalf("--tty cannot be used with --detach, use --console-socket instead")
+		}
 		return ex.execAndWait(waitStatus)
 	}
 
+	var master, slave *os.File
+	if ex.tty {
+		if ex.consoleSocket != "" {
+			Fatalf("--tty cannot be used with --console-socket")
+		}
+		master, slave, err = console.NewPair()
+		if err != nil {
+			Fatalf("creating pseudoterminal: %v", err)
+		}
+		defer master.Close()
+		e.StdioIsPty = true
+		e.FilePayload = urpc.FilePayload{Files: []*os.File{slave, slave, slave}}
+	}
+
 	// Start the new process and get it pid.
 	pid, err := c.Execute(e)
 	if err != nil {
 		Fatalf("getting processes for container: %v", err)
 	}
 
-	if e.StdioIsPty {
+	var proxy *ttyProxy
+	if master != nil {
+		// The sandbox has its own copy of the slave, and closes it when
+		// the process exits.
+		slave.Close()
+
+		var keys []byte
+		if ex.detachKeys != "" {
+			keys, err = console.ParseDetachKeys(ex.detachKeys)
+			if err != nil {
+				Fatalf("parsing detach keys: %v", err)
+			}
+		}
+		proxy, err = startTTYProxy(c, pid, master, keys)
+		if err != nil {
+			Fatalf("connecting to pseudoterminal: %v", err)
+		}
+		defer proxy.stop()
+	} else if e.StdioIsPty {
 		// Forward signals sent to this process to the foreground
 		// process in the sandbox.
 		stopForwarding := c.ForwardSignals(pid, true /* fgProcess */)
@@ -177,6 +229,18 @@ func (ex *Exec) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 	}
 
 	// Wait for the process to exit.
+	if proxy != nil {
+		ws, detached, err := proxy.wait(pid, ex.clearStatus)
+		if err != nil {
+			proxy.stop()
+			Fatalf("waiting on pid %d: %v", pid, err)
+		}
+		if detached {
+			log.Infof("Detached from container %q PID %d", c.ID, pid)
+		}
+		*waitStatus = ws
+		return subcommands.ExitSuccess
+	}
 	ws, err := c.WaitPID(pid, ex.clearStatus)
 	if err != nil {
 		Fatalf("waiting on pid %d: %v", pid, err)
@@ -185,6 +249,126 @@ func (ex *Exec) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 	return subcommands.ExitSuccess
 }
 
+// ttyProxy connects the stdio of runsc to the master end of the pseudoterminal
+// of a process started with --tty, in the same way as runc.
+type ttyProxy struct {
+	c      *container.Container
+	master *os.File
+
+	// restore restores the terminal state of stdin. It is nil if stdin is
+	// not a terminal.
+	restore func() error
+
+	// sigCh receives signals to be forwarded to the process.
+	sigCh chan os.Signal
+
+	// detached is closed when the detach key sequence is read from stdin.
+	detached chan struct{}
+
+	// outputDone is closed once all output from the process has been
+	// copied to stdout.
+	outputDone chan struct{}
+
+	stopOnce sync.Once
+}
+
+// startTTYProxy starts copying data between stdio and master, which is the
+// pseudoterminal of the process pid, and forwards signals to the process. If
+// stdin is a terminal, it is put into raw mode and its window size is
+// propagated to master.
+func startTTYProxy(c *container.Container, pid int32, master *os.File, detachKeys []byte) (*ttyProxy, error) {
+	p := &ttyProxy{
+		c:          c,
+		master:     master,
+		sigCh:      make(chan os.Signal, 1),
+		detached:   make(chan struct{}),
+		outputDone: make(chan struct{}),
+	}
+	if console.IsTerminal(os.Stdin) {
+		restore, err := console.MakeRaw(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		p.restore = restore
+		if err := console.InheritSize(os.Stdin, master); err != nil {
+			log.Warningf("error setting pseudoterminal size: %v", err)
+		}
+	}
+
+	// Forward signals to the foreground process group. SIGWINCH is only
+	// forwarded after the new window size has been applied to master, so
+	// that the process observes the new size.
+	signal.Notify(p.sigCh)
+	go func() {
+		for s := range p.sigCh {
+			if s == syscall.SIGWINCH && p.restore != nil {
+				if err := console.InheritSize(os.Stdin, master); err != nil {
+					log.Warningf("error resizing pseudoterminal: %v", err)
+				}
+			}
+			if err := c.Sandbox.SignalProcess(c.ID, pid, s.(syscall.Signal), true /* fgProcess */); err != nil {
+				log.Warningf("error forwarding signal %d to container %q: %v", s, c.ID, err)
+			}
+		}
+	}()
+
+	go func() {
+		_, err := io.Copy(master, console.NewDetachReader(os.Stdin, detachKeys))
+		if err == console.ErrDetached {
+			close(p.detached)
+		}
+	}()
+	go func() {
+		// The copy ends with EIO once the sandbox closes the slave.
+		io.Copy(os.Stdout, master)
+		close(p.outputDone)
+	}()
+	return p, nil
+}
+
+// wait waits for the process pid to exit, or for the user to detach from it.
+// It returns the process's wait status, and whether the user detached.
+func (p *ttyProxy) wait(pid int32, clearStatus bool) (syscall.WaitStatus, bool, error) {
+	type result struct {
+		ws  syscall.WaitStatus
+		err error
+	}
+	waitCh := make(chan result, 1)
+	go func() {
+		ws, err := p.c.WaitPID(pid, clearStatus)
+		waitCh <- result{ws, err}
+	}()
+
+	select {
+	case <-p.detached:
+		return 0, true, nil
+	case r := <-waitCh:
+		if r.err != nil {
+			return 0, false, r.err
+		}
+		// Let remaining output reach stdout before returning the
+		// exit status.
+		select {
+		case <-p.outputDone:
+		case <-time.After(ttyDrainTimeout):
+		}
+		return r.ws, false, nil
+	}
+}
+
+// stop stops forwarding signals and restores the state of stdin.
+func (p *ttyProxy) stop() {
+	p.stopOnce.Do(func() {
+		signal.Stop(p.sigCh)
+		close(p.sigCh)
+		if p.restore != nil {
+			if err := p.restore(); err != nil {
+				log.Warningf("error restoring terminal: %v", err)
+			}
+		}
+	})
+}
+
 func (ex *Exec) execAndWait(waitStatus *syscall.WaitStatus) subcommands.ExitStatus {
 	binPath := specutils.ExePath
 	var args []string
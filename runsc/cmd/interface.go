@@ -0,0 +1,88 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	"flag"
+	"github.com/google/subcommands"
+	"gvisor.googlesource.com/gvisor/runsc/boot"
+	"gvisor.googlesource.com/gvisor/runsc/container"
+)
+
+// Interface implements subcommands.Command for the "interface" command.
+type Interface struct{}
+
+// Name implements subcommands.Command.Name.
+func (*Interface) Name() string {
+	return "interface"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Interface) Synopsis() string {
+	return "add or remove network interfaces of a running container"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Interface) Usage() string {
+	return `interface add|remove <container id> <interface> - add or remove a network interface of a container.
+
+add moves the interface, with its IPv4 addresses and routes, from the network
+namespace of the container's sandbox into the sandbox, as is done for the
+interfaces of the namespace when the sandbox is created. Requires
+--network=sandbox.
+
+remove removes the interface from the sandbox. The host interface, e.g. a veth
+device, should then be deleted.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (*Interface) SetFlags(f *flag.FlagSet) {
+}
+
+// Execute implements subcommands.Command.Execute.
+func (*Interface) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 3 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	op := f.Arg(0)
+	id := f.Arg(1)
+	name := f.Arg(2)
+	conf := args[0].(*boot.Config)
+
+	cont, err := container.Load(conf.RootDir, id)
+	if err != nil {
+		Fatalf("loading container: %v", err)
+	}
+
+	switch op {
+	case "add":
+		if err := cont.AddInterface(conf, name); err != nil {
+			Fatalf("adding interface: %v", err)
+		}
+	case "remove":
+		if err := cont.RemoveInterface(name); err != nil {
+			Fatalf("removing interface: %v", err)
+		}
+	default:
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	return subcommands.ExitSuccess
+}
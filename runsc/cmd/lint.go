@@ -0,0 +1,137 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"flag"
+	"github.com/google/subcommands"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.googlesource.com/gvisor/runsc/lint"
+	"gvisor.googlesource.com/gvisor/runsc/specutils"
+)
+
+// Lint implements subcommands.Command for the "lint" command.
+type Lint struct {
+	bundleDir string
+	all       bool
+	format    string
+}
+
+// Name implements subcommands.Command.Name.
+func (*Lint) Name() string {
+	return "lint"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Lint) Synopsis() string {
+	return "report compatibility concerns of a bundle before running it"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Lint) Usage() string {
+	return `lint [flags] - report compatibility concerns of an OCI bundle.
+
+Checks the spec for features that are unsupported or ignored, e.g. devices,
+mount types and sysctls. Checks the binary of the container process, and with
+--all every ELF executable in the root filesystem, for unsupported
+architectures, missing dynamic loaders, required kernel versions and syscalls
+that are not implemented. Syscalls are found by static heuristics, so not all
+syscalls used by a binary are reported.
+
+Exits with failure if any finding is an error.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (l *Lint) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&l.bundleDir, "bundle", "", "path to the root of the bundle directory, defaults to the current directory")
+	f.BoolVar(&l.all, "all", false, "check all ELF executables in the root filesystem, not just the container process")
+	f.StringVar(&l.format, "format", "text", "output format: 'text' (default) or 'json'")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (l *Lint) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 0 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	bundleDir := l.bundleDir
+	if bundleDir == "" {
+		bundleDir = getwdOrDie()
+	}
+	// Don't use specutils.ReadSpec, invalid specs are reported as findings.
+	specFile, err := specutils.OpenSpec(bundleDir)
+	if err != nil {
+		Fatalf("opening spec: %v", err)
+	}
+	var spec specs.Spec
+	err = json.NewDecoder(specFile).Decode(&spec)
+	specFile.Close()
+	if err != nil {
+		Fatalf("reading spec: %v", err)
+	}
+
+	findings := lint.CheckSpec(&spec)
+	if spec.Root != nil && spec.Root.Path != "" {
+		root := spec.Root.Path
+		if !filepath.IsAbs(root) {
+			root = filepath.Join(bundleDir, root)
+		}
+		var env []string
+		if spec.Process != nil {
+			env = spec.Process.Env
+		}
+		c, err := lint.NewChecker(root, env)
+		if err != nil {
+			Fatalf("creating checker: %v", err)
+		}
+		if l.all {
+			fs, err := c.CheckAll()
+			if err != nil {
+				Fatalf("checking root filesystem %q: %v", root, err)
+			}
+			findings = append(findings, fs...)
+		} else {
+			findings = append(findings, c.CheckProcess(spec.Process)...)
+		}
+	}
+
+	switch l.format {
+	case "text":
+		for _, finding := range findings {
+			fmt.Println(finding)
+		}
+	case "json":
+		if err := json.NewEncoder(os.Stdout).Encode(findings); err != nil {
+			Fatalf("marshaling findings: %v", err)
+		}
+	default:
+		Fatalf("unknown lint format %q", l.format)
+	}
+
+	for _, finding := range findings {
+		if finding.Severity == lint.Error {
+			return subcommands.ExitFailure
+		}
+	}
+	return subcommands.ExitSuccess
+}
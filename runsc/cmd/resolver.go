@@ -0,0 +1,91 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+
+	"flag"
+	"github.com/google/subcommands"
+	"gvisor.googlesource.com/gvisor/runsc/boot"
+	"gvisor.googlesource.com/gvisor/runsc/container"
+)
+
+// Resolver implements subcommands.Command for the "resolver" command.
+type Resolver struct {
+	hosts      string
+	resolvConf string
+}
+
+// Name implements subcommands.Command.Name.
+func (*Resolver) Name() string {
+	return "resolver"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Resolver) Synopsis() string {
+	return "replace /etc/hosts and /etc/resolv.conf of a running container"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Resolver) Usage() string {
+	return `resolver [flags] <container id> - replace /etc/hosts and /etc/resolv.conf of a container.
+
+The files are rewritten in place inside the sandbox, so processes in the
+container see the new contents without restarting. Files that are not given
+are left unchanged.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (r *Resolver) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&r.hosts, "hosts", "", "host file with the new contents of /etc/hosts.")
+	f.StringVar(&r.resolvConf, "resolv-conf", "", "host file with the new contents of /etc/resolv.conf.")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (r *Resolver) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 || (r.hosts == "" && r.resolvConf == "") {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*boot.Config)
+
+	var hosts, resolvConf []byte
+	if r.hosts != "" {
+		var err error
+		if hosts, err = ioutil.ReadFile(r.hosts); err != nil {
+			Fatalf("reading hosts file: %v", err)
+		}
+	}
+	if r.resolvConf != "" {
+		var err error
+		if resolvConf, err = ioutil.ReadFile(r.resolvConf); err != nil {
+			Fatalf("reading resolv.conf file: %v", err)
+		}
+	}
+
+	cont, err := container.Load(conf.RootDir, id)
+	if err != nil {
+		Fatalf("loading container: %v", err)
+	}
+	if err := cont.UpdateResolver(hosts, resolvConf); err != nil {
+		Fatalf("updating resolver files: %v", err)
+	}
+	return subcommands.ExitSuccess
+}
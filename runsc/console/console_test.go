@@ -0,0 +1,75 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package console
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestParseDetachKeys(t *testing.T) {
+	for _, tc := range []struct {
+		input   string
+		want    []byte
+		wantErr bool
+	}{
+		{input: DefaultDetachKeys, want: []byte{0x10, 0x11}},
+		{input: "a,ctrl-A,ctrl-@,ctrl-_", want: []byte{'a', 0x01, 0x00, 0x1f}},
+		{input: "ctrl-1", wantErr: true},
+		{input: "ab", wantErr: true},
+		{input: "", wantErr: true},
+	} {
+		got, err := ParseDetachKeys(tc.input)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseDetachKeys(%q) succeeded, want error", tc.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseDetachKeys(%q) failed: %v", tc.input, err)
+			continue
+		}
+		if !bytes.Equal(got, tc.want) {
+			t.Errorf("ParseDetachKeys(%q) = %v, want %v", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestDetachReader(t *testing.T) {
+	keys := []byte{0x10, 0x11}
+	for _, tc := range []struct {
+		input    string
+		want     string
+		detached bool
+	}{
+		{input: "hello", want: "hello"},
+		{input: "ab\x10\x11cd", want: "ab", detached: true},
+		{input: "a\x10b\x10\x10\x11", want: "a\x10b\x10", detached: true},
+		{input: "a\x10", want: "a\x10"},
+	} {
+		r := NewDetachReader(bytes.NewBufferString(tc.input), keys)
+		got, err := ioutil.ReadAll(r)
+		if detached := err == ErrDetached; detached != tc.detached {
+			t.Errorf("reading %q: got err %v, want detached %t", tc.input, err, tc.detached)
+		} else if !tc.detached && err != nil {
+			t.Errorf("reading %q: %v", tc.input, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("reading %q: got %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
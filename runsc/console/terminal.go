@@ -0,0 +1,182 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package console
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/kr/pty"
+	"golang.org/x/sys/unix"
+)
+
+// DefaultDetachKeys is the default key sequence used to detach from a
+// terminal, matching Docker.
+const DefaultDetachKeys = "ctrl-p,ctrl-q"
+
+// ErrDetached is returned by a reader created with NewDetachReader once the
+// detach key sequence has been read.
+var ErrDetached = errors.New("detached from terminal")
+
+// NewPair creates a new pty master/slave pair.
+func NewPair() (master, slave *os.File, err error) {
+	master, slave, err = pty.Open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening pty: %v", err)
+	}
+	return master, slave, nil
+}
+
+// IsTerminal returns true if f refers to a terminal.
+func IsTerminal(f *os.File) bool {
+	_, err := unix.IoctlGetTermios(int(f.Fd()), unix.TCGETS)
+	return err == nil
+}
+
+// MakeRaw puts the terminal f into raw mode, as by cfmakeraw(3). It returns a
+// function that restores the previous terminal state.
+func MakeRaw(f *os.File) (func() error, error) {
+	fd := int(f.Fd())
+	old, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return nil, fmt.Errorf("getting termios: %v", err)
+	}
+
+	raw := *old
+	raw.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	raw.Oflag &^= unix.OPOST
+	raw.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Cflag &^= unix.CSIZE | unix.PARENB
+	raw.Cflag |= unix.CS8
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, &raw); err != nil {
+		return nil, fmt.Errorf("setting termios: %v", err)
+	}
+	return func() error {
+		return unix.IoctlSetTermios(fd, unix.TCSETS, old)
+	}, nil
+}
+
+// InheritSize sets the window size of the terminal dst to that of src.
+func InheritSize(src, dst *os.File) error {
+	return pty.InheritSize(src, dst)
+}
+
+// ParseDetachKeys parses a detach key sequence in Docker's format: a comma
+// separated list of either single characters or "ctrl-<value>", where <value>
+// is a letter or one of "@", "[", "\", "]", "^" or "_".
+func ParseDetachKeys(s string) ([]byte, error) {
+	var keys []byte
+	for _, k := range strings.Split(s, ",") {
+		if len(k) == 1 {
+			keys = append(keys, k[0])
+			continue
+		}
+		if !strings.HasPrefix(k, "ctrl-") || len(k) != len("ctrl-")+1 {
+			return nil, fmt.Errorf("invalid detach key %q", k)
+		}
+		c := k[len("ctrl-")]
+		switch {
+		case 'a' <= c && c <= 'z':
+			keys = append(keys, c-'a'+1)
+		case 'A' <= c && c <= 'Z':
+			keys = append(keys, c-'A'+1)
+		case strings.IndexByte("@[\\]^_", c) >= 0:
+			keys = append(keys, c-'@')
+		default:
+			return nil, fmt.Errorf("invalid detach key %q", k)
+		}
+	}
+	return keys, nil
+}
+
+// detachReader passes through data from an underlying reader until a detach
+// key sequence is seen.
+type detachReader struct {
+	r    io.Reader
+	keys []byte
+
+	// matched is the number of bytes of keys that have been read, but not
+	// yet returned, since they may be part of the detach sequence.
+	matched int
+
+	// pending holds data that has been read from r but not yet returned.
+	pending []byte
+
+	// err is returned once pending is drained.
+	err error
+}
+
+// NewDetachReader returns a reader which reads from r until the sequence keys
+// is seen, at which point it returns ErrDetached. Bytes that turn out not to
+// be part of the sequence are passed through unmodified. If keys is empty,
+// the returned reader never detaches.
+func NewDetachReader(r io.Reader, keys []byte) io.Reader {
+	if len(keys) == 0 {
+		return r
+	}
+	return &detachReader{r: r, keys: keys}
+}
+
+// Read implements io.Reader.Read.
+func (d *detachReader) Read(p []byte) (int, error) {
+	for len(d.pending) == 0 && d.err == nil {
+		buf := make([]byte, len(p))
+		n, err := d.r.Read(buf)
+		d.scan(buf[:n])
+		if err != nil && d.err == nil {
+			// Anything held back was not a detach sequence.
+			d.pending = append(d.pending, d.keys[:d.matched]...)
+			d.matched = 0
+			d.err = err
+		}
+	}
+	if len(d.pending) == 0 {
+		return 0, d.err
+	}
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+// scan appends buf to d.pending, holding back a possible prefix of the detach
+// sequence. If the whole sequence is seen, d.err is set to ErrDetached and the
+// remainder of buf is discarded.
+func (d *detachReader) scan(buf []byte) {
+	for _, c := range buf {
+		if c == d.keys[d.matched] {
+			d.matched++
+			if d.matched == len(d.keys) {
+				d.matched = 0
+				d.err = ErrDetached
+				return
+			}
+			continue
+		}
+		// The held prefix was not part of the sequence after all,
+		// though c itself may start a new one.
+		d.pending = append(d.pending, d.keys[:d.matched]...)
+		d.matched = 0
+		if c == d.keys[0] {
+			d.matched = 1
+			continue
+		}
+		d.pending = append(d.pending, c)
+	}
+}
@@ -119,6 +119,12 @@ type Container struct {
 	// be 0 if the gofer has been killed.
 	GoferPid int `json:"goferPid"`
 
+	// hostIO are the host files the container is connected to.
+	//
+	// This field isn't saved to json, because the files are only valid in
+	// the process that created the container.
+	hostIO IO
+
 	// goferIsChild is set if a gofer process is a child of the current process.
 	//
 	// This field isn't saved to json, because only a creator of a gofer
@@ -238,6 +244,31 @@ func List(rootDir string) ([]string, error) {
 // indicates that an existing Sandbox should be used. The caller must call
 // Destroy() on the container.
 func Create(id string, spec *specs.Spec, conf *boot.Config, bundleDir, consoleSocket, pidFile, userLog string) (*Container, error) {
+	return CreateWithIO(id, spec, conf, bundleDir, consoleSocket, pidFile, userLog, IO{})
+}
+
+// IO are host files, other than those of the gofer, that a container is
+// connected to.
+type IO struct {
+	// Stdios are the stdin, stdout and stderr of the container. If nil,
+	// those of the current process are used. Stdios is ignored if the
+	// container has a console.
+	Stdios []*os.File
+
+	// Links are network interfaces added to the sandbox before the root
+	// container starts, in addition to those set up for conf.Network.
+	Links []sandbox.Link
+}
+
+// CreateWithIO is like Create, but connects the container to hostIO. The
+// container must be started by the same process for hostIO to apply.
+func CreateWithIO(id string, spec *specs.Spec, conf *boot.Config, bundleDir, consoleSocket, pidFile, userLog string, hostIO IO) (*Container, error) {
+	if hostIO.Stdios != nil && len(hostIO.Stdios) != 3 {
+		return nil, fmt.Errorf("stdios must have 3 files, got %d", len(hostIO.Stdios))
+	}
+	if len(hostIO.Links) > 0 && !specutils.ShouldCreateSandbox(spec) {
+		return nil, fmt.Errorf("links can only be added by the root container of a sandbox")
+	}
 	log.Debugf("Create container %q in root dir: %s", id, conf.RootDir)
 	if err := validateID(id); err != nil {
 		return nil, err
@@ -269,6 +300,7 @@ func Create(id string, spec *specs.Spec, conf *boot.Config, bundleDir, consoleSo
 		Status:        Creating,
 		CreatedAt:     time.Now(),
 		Owner:         os.Getenv("USER"),
+		hostIO:        hostIO,
 	}
 	// The Cleanup object cleans up partially created containers when an error occurs.
 	// Any errors occuring during cleanup itself are ignored.
@@ -282,6 +314,13 @@ func Create(id string, spec *specs.Spec, conf *boot.Config, bundleDir, consoleSo
 	if specutils.ShouldCreateSandbox(spec) {
 		log.Debugf("Creating new sandbox for container %q", id)
 
+		// Annotations of the root container may override flags for the
+		// whole sandbox, including its gofers.
+		conf, err := conf.Override(spec.Annotations)
+		if err != nil {
+			return nil, err
+		}
+
 		// Create and join cgroup before processes are created to ensure they are
 		// part of the cgroup from the start (and all tneir children processes).
 		cg, err := cgroup.New(spec)
@@ -302,7 +341,7 @@ func Create(id string, spec *specs.Spec, conf *boot.Config, bundleDir, consoleSo
 
 			// Start a new sandbox for this container. Any errors after this point
 			// must destroy the container.
-			c.Sandbox, err = sandbox.New(id, spec, conf, bundleDir, consoleSocket, userLog, ioFiles, specFile, cg)
+			c.Sandbox, err = sandbox.New(id, spec, conf, bundleDir, consoleSocket, userLog, c.stdio(), ioFiles, specFile, cg)
 			return err
 		}); err != nil {
 			return nil, err
@@ -332,6 +371,15 @@ func Create(id string, spec *specs.Spec, conf *boot.Config, bundleDir, consoleSo
 			return nil, err
 		}
 	}
+
+	// "If any prestart or createRuntime hook fails, the runtime MUST
+	// generate an error, stop and destroy the container" -OCI spec. They
+	// run in the runtime namespace once the sandbox exists, so that hooks
+	// such as CNI plugins can configure the sandbox's network namespace
+	// through the state's pid.
+	if err := c.executeCreateHooks(); err != nil {
+		return nil, err
+	}
 	c.changeStatus(Created)
 
 	// Save the metadata file.
@@ -362,17 +410,12 @@ func (c *Container) Start(conf *boot.Config) error {
 	if err := c.requireStatus("start", Created); err != nil {
 		return err
 	}
-
-	// "If any prestart hook fails, the runtime MUST generate an error,
-	// stop and destroy the container" -OCI spec.
-	if c.Spec.Hooks != nil {
-		if err := executeHooks(c.Spec.Hooks.Prestart, c.State()); err != nil {
-			return err
-		}
+	if conf, err = c.Sandbox.Config(conf); err != nil {
+		return err
 	}
 
 	if specutils.ShouldCreateSandbox(c.Spec) {
-		if err := c.Sandbox.StartRoot(c.Spec, conf); err != nil {
+		if err := c.Sandbox.StartRoot(c.Spec, conf, c.hostIO.Links); err != nil {
 			return err
 		}
 	} else {
@@ -392,21 +435,19 @@ func (c *Container) Start(conf *boot.Config) error {
 			}
 			c.Spec.Mounts = cleanMounts
 
-			return c.Sandbox.StartContainer(c.Spec, conf, c.ID, ioFiles)
+			return c.Sandbox.StartContainer(c.Spec, conf, c.ID, c.stdio(), ioFiles)
 		}); err != nil {
 			return err
 		}
 	}
 
-	// "If any poststart hook fails, the runtime MUST log a warning, but
-	// the remaining hooks and lifecycle continue as if the hook had
-	// succeeded" -OCI spec.
-	if c.Spec.Hooks != nil {
-		executeHooksBestEffort(c.Spec.Hooks.Poststart, c.State())
+	c.changeStatus(Running)
+	if err := c.save(); err != nil {
+		return err
 	}
 
-	c.changeStatus(Running)
-	return c.save()
+	c.executePoststartHooks()
+	return nil
 }
 
 // Restore takes a container and replaces its kernel and file system
@@ -421,12 +462,20 @@ func (c *Container) Restore(spec *specs.Spec, conf *boot.Config, restoreFile str
 	if err := c.requireStatus("restore", Created); err != nil {
 		return err
 	}
+	if conf, err = c.Sandbox.Config(conf); err != nil {
+		return err
+	}
 
 	if err := c.Sandbox.Restore(c.ID, spec, conf, restoreFile); err != nil {
 		return err
 	}
 	c.changeStatus(Running)
-	return c.save()
+	if err := c.save(); err != nil {
+		return err
+	}
+
+	c.executePoststartHooks()
+	return nil
 }
 
 // Run is a helper that calls Create + Start + Wait.
@@ -559,13 +608,14 @@ func (c *Container) ForwardSignals(pid int32, fgProcess bool) func() {
 }
 
 // Checkpoint sends the checkpoint call to the container.
-// The statefile will be written to f, the file at the specified image-path.
-func (c *Container) Checkpoint(f *os.File) error {
+// The statefile will be written to f, the file at the specified image-path,
+// compressed with the given algorithm, or the default if empty.
+func (c *Container) Checkpoint(f *os.File, compression string) error {
 	log.Debugf("Checkpoint container %q", c.ID)
 	if err := c.requireStatus("checkpoint", Created, Running, Paused); err != nil {
 		return err
 	}
-	return c.Sandbox.Checkpoint(c.ID, f)
+	return c.Sandbox.Checkpoint(c.ID, f, compression)
 }
 
 // Pause suspends the container and its kernel.
@@ -609,14 +659,45 @@ func (c *Container) Resume() error {
 	return c.save()
 }
 
+// AddInterface moves the network interface name of the network namespace of
+// the container's sandbox into the sandbox.
+func (c *Container) AddInterface(conf *boot.Config, name string) error {
+	log.Debugf("Adding interface %q to container %q", name, c.ID)
+	if err := c.requireStatus("add interface to", Created, Running, Paused); err != nil {
+		return err
+	}
+	return c.Sandbox.AddInterface(conf, name)
+}
+
+// RemoveInterface removes the network interface name from the container's
+// sandbox.
+func (c *Container) RemoveInterface(name string) error {
+	log.Debugf("Removing interface %q from container %q", name, c.ID)
+	if err := c.requireStatus("remove interface from", Created, Running, Paused); err != nil {
+		return err
+	}
+	return c.Sandbox.RemoveInterface(name)
+}
+
+// UpdateResolver replaces the container's /etc/hosts and /etc/resolv.conf.
+// Nil contents leave the corresponding file unchanged.
+func (c *Container) UpdateResolver(hosts, resolvConf []byte) error {
+	log.Debugf("Updating resolver files of container %q", c.ID)
+	if err := c.requireStatus("update resolver files of", Created, Running, Paused); err != nil {
+		return err
+	}
+	return c.Sandbox.UpdateResolver(c.ID, hosts, resolvConf)
+}
+
 // State returns the metadata of the container.
 func (c *Container) State() specs.State {
 	return specs.State{
-		Version: specs.Version,
-		ID:      c.ID,
-		Status:  c.Status.String(),
-		Pid:     c.SandboxPid(),
-		Bundle:  c.BundleDir,
+		Version:     specs.Version,
+		ID:          c.ID,
+		Status:      c.Status.String(),
+		Pid:         c.SandboxPid(),
+		Bundle:      c.BundleDir,
+		Annotations: c.Spec.Annotations,
 	}
 }
 
@@ -927,6 +1008,14 @@ func (c *Container) isSandboxRunning() bool {
 	return c.Sandbox != nil && c.Sandbox.IsRunning()
 }
 
+// stdio returns the stdin, stdout and stderr of the container.
+func (c *Container) stdio() []*os.File {
+	if c.hostIO.Stdios != nil {
+		return c.hostIO.Stdios
+	}
+	return []*os.File{os.Stdin, os.Stdout, os.Stderr}
+}
+
 func (c *Container) requireStatus(action string, statuses ...Status) error {
 	for _, s := range statuses {
 		if c.Status == s {
@@ -15,10 +15,14 @@
 package container
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
 	"reflect"
@@ -680,7 +684,7 @@ func TestCheckpointRestore(t *testing.T) {
 		}
 
 		// Checkpoint running container; save state into new file.
-		if err := cont.Checkpoint(file); err != nil {
+		if err := cont.Checkpoint(file, ""); err != nil {
 			t.Fatalf("error checkpointing container to empty file: %v", err)
 		}
 		defer os.RemoveAll(imagePath)
@@ -845,7 +849,7 @@ func TestUnixDomainSockets(t *testing.T) {
 		}
 
 		// Checkpoint running container; save state into new file.
-		if err := cont.Checkpoint(file); err != nil {
+		if err := cont.Checkpoint(file, ""); err != nil {
 			t.Fatalf("error checkpointing container to empty file: %v", err)
 		}
 
@@ -895,6 +899,125 @@ func TestUnixDomainSockets(t *testing.T) {
 	}
 }
 
+// TestCheckpointRestoreTCP checks that a TCP connection through a sandbox
+// interface survives checkpoint and restore with --net-restore, the container
+// being restored into the same network namespace.
+func TestCheckpointRestoreTCP(t *testing.T) {
+	conf := testutil.TestConfig()
+	conf.Network = boot.NetworkSandbox
+	conf.NetRestore = true
+
+	// The container's network namespace has one end of a veth pair, the
+	// other end being in the test's namespace.
+	ns := fmt.Sprintf("runsc-test-%d", os.Getpid())
+	veth, peer := fmt.Sprintf("vt-%d", os.Getpid()), fmt.Sprintf("vh-%d", os.Getpid())
+	const hostAddr, sandboxAddr = "192.0.2.1", "192.0.2.2"
+	ip := func(args ...string) {
+		if out, err := exec.Command("ip", args...).CombinedOutput(); err != nil {
+			t.Fatalf("ip %s failed: %v, output: %s", strings.Join(args, " "), err, out)
+		}
+	}
+	ip("netns", "add", ns)
+	defer exec.Command("ip", "netns", "delete", ns).Run()
+	ip("link", "add", veth, "type", "veth", "peer", "name", peer)
+	defer exec.Command("ip", "link", "delete", peer).Run()
+	ip("addr", "add", hostAddr+"/24", "dev", peer)
+	ip("link", "set", peer, "up")
+	ip("link", "set", veth, "netns", ns)
+	ip("netns", "exec", ns, "ip", "addr", "add", sandboxAddr+"/24", "dev", veth)
+	ip("netns", "exec", ns, "ip", "link", "set", veth, "up")
+	ip("netns", "exec", ns, "ip", "link", "set", "lo", "up")
+
+	l, err := net.Listen("tcp", hostAddr+":0")
+	if err != nil {
+		t.Fatalf("net.Listen() failed: %v", err)
+	}
+	defer l.Close()
+	port := l.Addr().(*net.TCPAddr).Port
+
+	// The application connects to the test and echoes the lines it reads.
+	script := fmt.Sprintf("exec 3<>/dev/tcp/%s/%d; while read -r l <&3; do echo \"$l\" >&3; done", hostAddr, port)
+	spec := testutil.NewSpecWithArgs("bash", "-c", script)
+	spec.Linux = &specs.Linux{
+		Namespaces: []specs.LinuxNamespace{{
+			Type: specs.NetworkNamespace,
+			Path: filepath.Join("/var/run/netns", ns),
+		}},
+	}
+	rootDir, bundleDir, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer os.RemoveAll(rootDir)
+	defer os.RemoveAll(bundleDir)
+
+	cont, err := Create(testutil.UniqueContainerID(), spec, conf, bundleDir, "", "", "")
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("Accept() failed: %v", err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	echo := func(msg string) {
+		if err := conn.SetDeadline(time.Now().Add(10 * time.Second)); err != nil {
+			t.Fatalf("SetDeadline() failed: %v", err)
+		}
+		if _, err := conn.Write([]byte(msg + "\n")); err != nil {
+			t.Fatalf("error writing %q: %v", msg, err)
+		}
+		got, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("error reading echo of %q: %v", msg, err)
+		}
+		if want := msg + "\n"; got != want {
+			t.Errorf("echo: got %q, want %q", got, want)
+		}
+	}
+	echo("before checkpoint")
+
+	dir, err := ioutil.TempDir(testutil.TmpDir(), "checkpoint-tcp-test")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	imagePath := filepath.Join(dir, "test-image-file")
+	file, err := os.OpenFile(imagePath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("error opening new file at imagePath: %v", err)
+	}
+	defer file.Close()
+
+	if err := cont.Checkpoint(file, ""); err != nil {
+		t.Fatalf("error checkpointing container: %v", err)
+	}
+	if err := cont.Destroy(); err != nil {
+		t.Fatalf("error destroying container: %v", err)
+	}
+
+	// The sandbox took the address of its interface from the namespace, so
+	// it must be put back for the restored sandbox to find it.
+	ip("netns", "exec", ns, "ip", "addr", "add", sandboxAddr+"/24", "dev", veth)
+
+	contRestore, err := Create(testutil.UniqueContainerID(), spec, conf, bundleDir, "", "", "")
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer contRestore.Destroy()
+	if err := contRestore.Restore(spec, conf, imagePath); err != nil {
+		t.Fatalf("error restoring container: %v", err)
+	}
+
+	echo("after restore")
+}
+
 // TestPauseResume tests that we can successfully pause and resume a container.
 // It checks starts running sleep and executes another sleep. It pauses and checks
 // that both processes are still running: sleep will be paused and still exist.
@@ -1759,6 +1882,111 @@ func TestMountSymlink(t *testing.T) {
 	}
 }
 
+// TestHooks checks that OCI hooks are executed at the right points of the
+// container lifecycle, with the container state on stdin.
+func TestHooks(t *testing.T) {
+	dir, err := ioutil.TempDir(testutil.TmpDir(), "hooks")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Each hook saves its state under a file named after the hook.
+	hook := func(name string) []specs.Hook {
+		return []specs.Hook{{
+			Path: "/bin/sh",
+			Args: []string{"sh", "-c", fmt.Sprintf("cat > %q", filepath.Join(dir, name))},
+		}}
+	}
+	readState := func(name string) (specs.State, error) {
+		var s specs.State
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return s, err
+		}
+		err = json.Unmarshal(b, &s)
+		return s, err
+	}
+
+	spec := testutil.NewSpecWithArgs("/bin/sleep", "10000")
+	spec.Annotations = map[string]string{"hook-test": "true"}
+	spec.Hooks = &specs.Hooks{
+		Prestart:      hook("prestart"),
+		CreateRuntime: hook("createRuntime"),
+		Poststart:     hook("poststart"),
+		Poststop:      hook("poststop"),
+	}
+	conf := testutil.TestConfig()
+	rootDir, bundleDir, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer os.RemoveAll(rootDir)
+	defer os.RemoveAll(bundleDir)
+
+	id := testutil.UniqueContainerID()
+	c, err := Create(id, spec, conf, bundleDir, "", "", "")
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer c.Destroy()
+
+	for _, name := range []string{"prestart", "createRuntime"} {
+		s, err := readState(name)
+		if err != nil {
+			t.Fatalf("reading %s state: %v", name, err)
+		}
+		if s.ID != id || s.Status != Creating.String() || s.Pid != c.SandboxPid() || s.Bundle != bundleDir {
+			t.Errorf("%s got state %+v, want id %q, status %q, pid %d, bundle %q", name, s, id, Creating, c.SandboxPid(), bundleDir)
+		}
+		if s.Annotations["hook-test"] != "true" {
+			t.Errorf("%s got annotations %v, want %v", name, s.Annotations, spec.Annotations)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "poststart")); !os.IsNotExist(err) {
+		t.Errorf("poststart hook executed before start, stat err: %v", err)
+	}
+
+	if err := c.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+	if s, err := readState("poststart"); err != nil {
+		t.Fatalf("reading poststart state: %v", err)
+	} else if s.Status != Running.String() {
+		t.Errorf("poststart got status %q, want %q", s.Status, Running)
+	}
+
+	if err := c.Destroy(); err != nil {
+		t.Fatalf("error destroying container: %v", err)
+	}
+	if s, err := readState("poststop"); err != nil {
+		t.Fatalf("reading poststop state: %v", err)
+	} else if s.Status != Stopped.String() {
+		t.Errorf("poststop got status %q, want %q", s.Status, Stopped)
+	}
+}
+
+// TestPrestartHookFailure checks that a failing prestart hook fails the create
+// operation.
+func TestPrestartHookFailure(t *testing.T) {
+	spec := testutil.NewSpecWithArgs("/bin/sleep", "10000")
+	spec.Hooks = &specs.Hooks{
+		Prestart: []specs.Hook{{Path: "/bin/false"}},
+	}
+	conf := testutil.TestConfig()
+	rootDir, bundleDir, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer os.RemoveAll(rootDir)
+	defer os.RemoveAll(bundleDir)
+
+	if c, err := Create(testutil.UniqueContainerID(), spec, conf, bundleDir, "", "", ""); err == nil {
+		c.Destroy()
+		t.Fatalf("Create() succeeded with failing prestart hook")
+	}
+}
+
 // executeSync synchronously executes a new process.
 func (cont *Container) executeSync(args *control.ExecArgs) (syscall.WaitStatus, error) {
 	pid, err := cont.Execute(args)
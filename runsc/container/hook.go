@@ -39,6 +39,42 @@ import (
 // 		}]
 // },
 
+// executeCreateHooks executes the prestart and createRuntime hooks of the
+// container, which must be called during the create operation after the
+// sandbox has been created.
+//
+// createContainer and startContainer hooks are meant to run in the container
+// namespace, which is implemented by the sandbox and cannot execute host
+// binaries, so they are not supported and are ignored with a warning.
+func (c *Container) executeCreateHooks() error {
+	hooks := c.Spec.Hooks
+	if hooks == nil {
+		return nil
+	}
+	if len(hooks.CreateContainer) > 0 || len(hooks.StartContainer) > 0 {
+		log.Warningf("createContainer and startContainer hooks are not supported, ignoring them")
+	}
+	if err := executeHooks(hooks.Prestart, c.State()); err != nil {
+		return fmt.Errorf("executing prestart hooks: %v", err)
+	}
+	if err := executeHooks(hooks.CreateRuntime, c.State()); err != nil {
+		return fmt.Errorf("executing createRuntime hooks: %v", err)
+	}
+	return nil
+}
+
+// executePoststartHooks executes the poststart hooks of the container, once
+// the container is running.
+//
+// "If any poststart hook fails, the runtime MUST log a warning, but the
+// remaining hooks and lifecycle continue as if the hook had succeeded" -OCI
+// spec.
+func (c *Container) executePoststartHooks() {
+	if c.Spec.Hooks != nil {
+		executeHooksBestEffort(c.Spec.Hooks.Poststart, c.State())
+	}
+}
+
 // executeHooksBestEffort executes hooks and logs warning in case they fail.
 // Runs all hooks, always.
 func executeHooksBestEffort(hooks []specs.Hook, s specs.State) {
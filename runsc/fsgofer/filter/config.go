@@ -78,6 +78,7 @@ var allowedSyscalls = seccomp.SyscallRules{
 			seccomp.AllowValue(syscall.F_GETFD),
 		},
 	},
+	syscall.SYS_FDATASYNC: {},
 	syscall.SYS_FSTAT:     {},
 	syscall.SYS_FSTATFS:   {},
 	syscall.SYS_FSYNC:     {},
@@ -174,3 +175,26 @@ var allowedSyscalls = seccomp.SyscallRules{
 	syscall.SYS_UTIMENSAT: {},
 	syscall.SYS_WRITE:     {},
 }
+
+// udsSyscalls is the set of syscalls executed by the gofer to connect to host
+// unix domain sockets. See fsgofer.Config.HostUDS.
+var udsSyscalls = seccomp.SyscallRules{
+	syscall.SYS_SOCKET: []seccomp.Rule{
+		{
+			seccomp.AllowValue(syscall.AF_UNIX),
+			seccomp.AllowValue(syscall.SOCK_STREAM | syscall.SOCK_NONBLOCK | syscall.SOCK_CLOEXEC),
+			seccomp.AllowValue(0),
+		},
+		{
+			seccomp.AllowValue(syscall.AF_UNIX),
+			seccomp.AllowValue(syscall.SOCK_DGRAM | syscall.SOCK_NONBLOCK | syscall.SOCK_CLOEXEC),
+			seccomp.AllowValue(0),
+		},
+		{
+			seccomp.AllowValue(syscall.AF_UNIX),
+			seccomp.AllowValue(syscall.SOCK_SEQPACKET | syscall.SOCK_NONBLOCK | syscall.SOCK_CLOEXEC),
+			seccomp.AllowValue(0),
+		},
+	},
+	syscall.SYS_CONNECT: {},
+}
@@ -21,9 +21,13 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/seccomp"
 )
 
-// Install installs seccomp filters.
-func Install() error {
+// Install installs seccomp filters. If hostUDS is true, the gofer is also
+// allowed to connect to host unix domain sockets.
+func Install(hostUDS bool) error {
 	s := allowedSyscalls
+	if hostUDS {
+		s.Merge(udsSyscalls)
+	}
 
 	// Set of additional filters used by -race and -msan. Returns empty
 	// when not enabled.
@@ -52,6 +52,7 @@ const (
 	regular fileType = iota
 	directory
 	symlink
+	socket
 	unknown
 )
 
@@ -64,6 +65,8 @@ func (f fileType) String() string {
 		return "directory"
 	case symlink:
 		return "symlink"
+	case socket:
+		return "socket"
 	}
 	return "unknown"
 }
@@ -80,6 +83,11 @@ type Config struct {
 
 	// PanicOnWrite panics on attempts to write to RO mounts.
 	PanicOnWrite bool
+
+	// HostUDS allows the sandbox to connect to host unix domain sockets,
+	// e.g. bind mounted into the container. Otherwise, sockets can't be
+	// walked to.
+	HostUDS bool
 }
 
 type attachPoint struct {
@@ -126,6 +134,10 @@ func (a *attachPoint) Attach() (p9.File, error) {
 	if a.conf.ROMount || stat.Mode&syscall.S_IFDIR != 0 {
 		mode = os.O_RDONLY
 	}
+	if stat.Mode&syscall.S_IFMT == syscall.S_IFSOCK {
+		// Sockets can't be opened, O_PATH is enough to connect to them.
+		mode = unix.O_PATH
+	}
 
 	// Open the root directory.
 	f, err := os.OpenFile(a.prefix, mode|openFlags, 0)
@@ -235,7 +247,7 @@ func openAnyFile(path string, fn func(mode int) (*os.File, error)) (*os.File, er
 	//   1. RDONLY | NONBLOCK: for all files, works for directories and ro mounts too.
 	//      Use non-blocking to prevent getting stuck inside open(2) for FIFOs. This option
 	//      has no effect on regular files.
-	//   2. PATH: for symlinks
+	//   2. PATH: for symlinks and sockets
 	modes := []int{syscall.O_RDONLY | syscall.O_NONBLOCK, unix.O_PATH}
 
 	var err error
@@ -264,7 +276,7 @@ func openAnyFile(path string, fn func(mode int) (*os.File, error)) (*os.File, er
 	return file, nil
 }
 
-func getSupportedFileType(stat syscall.Stat_t) (fileType, error) {
+func getSupportedFileType(stat syscall.Stat_t, permitSocket bool) (fileType, error) {
 	var ft fileType
 	switch stat.Mode & syscall.S_IFMT {
 	case syscall.S_IFREG:
@@ -273,6 +285,11 @@ func getSupportedFileType(stat syscall.Stat_t) (fileType, error) {
 		ft = directory
 	case syscall.S_IFLNK:
 		ft = symlink
+	case syscall.S_IFSOCK:
+		if !permitSocket {
+			return unknown, syscall.EPERM
+		}
+		ft = socket
 	default:
 		return unknown, syscall.EPERM
 	}
@@ -280,7 +297,7 @@ func getSupportedFileType(stat syscall.Stat_t) (fileType, error) {
 }
 
 func newLocalFile(a *attachPoint, file *os.File, path string, stat syscall.Stat_t) (*localFile, error) {
-	ft, err := getSupportedFileType(stat)
+	ft, err := getSupportedFileType(stat, a.conf.HostUDS)
 	if err != nil {
 		return nil, err
 	}
@@ -332,6 +349,10 @@ func (l *localFile) Open(mode p9.OpenFlags) (*fd.FD, p9.QID, uint32, error) {
 	if l.isOpen() {
 		panic(fmt.Sprintf("attempting to open already opened file: %q", l.file.Name()))
 	}
+	if l.ft == socket {
+		// As in Linux, sockets can't be opened, only connected to.
+		return nil, p9.QID{}, 0, syscall.ENXIO
+	}
 
 	// Check if control file can be used or if a new open must be created.
 	var newFile *os.File
@@ -563,6 +584,17 @@ func (l *localFile) FSync() error {
 	return nil
 }
 
+// FDataSync implements p9.File.
+func (l *localFile) FDataSync() error {
+	if !l.isOpen() {
+		return syscall.EBADF
+	}
+	if err := syscall.Fdatasync(l.fd()); err != nil {
+		return extractErrno(err)
+	}
+	return nil
+}
+
 // GetAttr implements p9.File.
 func (l *localFile) GetAttr(_ p9.AttrMask) (p9.QID, p9.AttrMask, p9.Attr, error) {
 	stat, err := stat(l.fd())
@@ -938,8 +970,41 @@ func (l *localFile) Flush() error {
 }
 
 // Connect implements p9.File.
-func (l *localFile) Connect(p9.ConnectFlags) (*fd.FD, error) {
-	return nil, syscall.ECONNREFUSED
+func (l *localFile) Connect(flags p9.ConnectFlags) (*fd.FD, error) {
+	if !l.attachPoint.conf.HostUDS || l.ft != socket {
+		return nil, syscall.ECONNREFUSED
+	}
+
+	// The path must fit in sockaddr_un, including the terminating NUL. The
+	// sandbox path may fit while the host one, relative to the chroot,
+	// doesn't.
+	if len(l.hostPath) >= linux.UnixPathMax {
+		return nil, syscall.ECONNREFUSED
+	}
+
+	var stype int
+	switch flags {
+	case p9.StreamSocket:
+		stype = syscall.SOCK_STREAM
+	case p9.DgramSocket:
+		stype = syscall.SOCK_DGRAM
+	case p9.SeqpacketSocket:
+		stype = syscall.SOCK_SEQPACKET
+	default:
+		return nil, syscall.ENXIO
+	}
+
+	// The socket is non-blocking so that a peer with a full backlog can't
+	// block the gofer; the sentry sees a refused connection instead.
+	f, err := syscall.Socket(syscall.AF_UNIX, stype|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Connect(f, &syscall.SockaddrUnix{Name: l.hostPath}); err != nil {
+		syscall.Close(f)
+		return nil, err
+	}
+	return fd.New(f), nil
 }
 
 // Close implements p9.File.
@@ -636,3 +636,112 @@ func TestDoubleAttachError(t *testing.T) {
 		t.Fatalf("Attach should have failed, got %v want non-nil", err)
 	}
 }
+
+// setupSocket creates a directory with a listening unix socket named "sock" in
+// it, and returns the directory and the socket's FD.
+func setupSocket(t *testing.T) (string, int) {
+	dir, err := ioutil.TempDir("", "root-")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir() failed, err: %v", err)
+	}
+	s, err := syscall.Socket(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("socket() failed, err: %v", err)
+	}
+	if err := syscall.Bind(s, &syscall.SockaddrUnix{Name: path.Join(dir, "sock")}); err != nil {
+		syscall.Close(s)
+		os.RemoveAll(dir)
+		t.Fatalf("bind() failed, err: %v", err)
+	}
+	if err := syscall.Listen(s, 1); err != nil {
+		syscall.Close(s)
+		os.RemoveAll(dir)
+		t.Fatalf("listen() failed, err: %v", err)
+	}
+	return dir, s
+}
+
+func TestConnect(t *testing.T) {
+	dir, s := setupSocket(t)
+	defer os.RemoveAll(dir)
+	defer syscall.Close(s)
+
+	a, err := NewAttachPoint(dir, Config{HostUDS: true})
+	if err != nil {
+		t.Fatalf("NewAttachPoint failed: %v", err)
+	}
+	root, err := a.Attach()
+	if err != nil {
+		t.Fatalf("Attach failed, err: %v", err)
+	}
+	defer root.Close()
+
+	_, file, err := root.Walk([]string{"sock"})
+	if err != nil {
+		t.Fatalf("root.Walk({%q}) failed, err: %v", "sock", err)
+	}
+	defer file.Close()
+
+	if _, _, _, err := file.Open(p9.ReadOnly); err != syscall.ENXIO {
+		t.Errorf("Open() got %v, want %v", err, syscall.ENXIO)
+	}
+	if _, err := file.Connect(p9.DgramSocket); err == nil {
+		t.Errorf("Connect(DgramSocket) to a stream socket should have failed")
+	}
+
+	f, err := file.Connect(p9.StreamSocket)
+	if err != nil {
+		t.Fatalf("Connect(StreamSocket) failed, err: %v", err)
+	}
+	defer f.Close()
+
+	nfd, _, err := syscall.Accept(s)
+	if err != nil {
+		t.Fatalf("accept() failed, err: %v", err)
+	}
+	syscall.Close(nfd)
+}
+
+func TestConnectAttachSocket(t *testing.T) {
+	dir, s := setupSocket(t)
+	defer os.RemoveAll(dir)
+	defer syscall.Close(s)
+
+	// The socket itself is mounted, e.g. /var/run/docker.sock.
+	a, err := NewAttachPoint(path.Join(dir, "sock"), Config{HostUDS: true})
+	if err != nil {
+		t.Fatalf("NewAttachPoint failed: %v", err)
+	}
+	root, err := a.Attach()
+	if err != nil {
+		t.Fatalf("Attach failed, err: %v", err)
+	}
+	defer root.Close()
+
+	f, err := root.Connect(p9.StreamSocket)
+	if err != nil {
+		t.Fatalf("Connect(StreamSocket) failed, err: %v", err)
+	}
+	f.Close()
+}
+
+func TestConnectDisabled(t *testing.T) {
+	dir, s := setupSocket(t)
+	defer os.RemoveAll(dir)
+	defer syscall.Close(s)
+
+	a, err := NewAttachPoint(dir, Config{})
+	if err != nil {
+		t.Fatalf("NewAttachPoint failed: %v", err)
+	}
+	root, err := a.Attach()
+	if err != nil {
+		t.Fatalf("Attach failed, err: %v", err)
+	}
+	defer root.Close()
+
+	if _, _, err := root.Walk([]string{"sock"}); err != syscall.EPERM {
+		t.Errorf("root.Walk({%q}) got %v, want %v", "sock", err, syscall.EPERM)
+	}
+}
@@ -0,0 +1,393 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gvisor runs applications in gVisor sandboxes from Go programs,
+// without going through the runsc command line.
+//
+// Like runsc, the sandbox and gofer processes are started by re-executing the
+// current binary, which must call Init first thing in main:
+//
+//	func main() {
+//		gvisor.Init()
+//
+//		s, err := gvisor.Create(gvisor.Options{...})
+//		...
+//	}
+package gvisor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/runsc/boot"
+	"gvisor.googlesource.com/gvisor/runsc/cli"
+	"gvisor.googlesource.com/gvisor/runsc/container"
+	"gvisor.googlesource.com/gvisor/runsc/sandbox"
+	"gvisor.googlesource.com/gvisor/runsc/specutils"
+)
+
+// Version is reported in the logs of the sandbox and gofer processes.
+var Version = ""
+
+// Init runs the sandbox or gofer process and exits if the current process was
+// started as one. Otherwise, it returns immediately.
+//
+// Init must be called before flags are parsed, since the sandbox and gofer
+// processes are configured by flags of their own.
+func Init() {
+	if isInternalCommand(os.Args[1:]) {
+		cli.Main(Version)
+	}
+}
+
+// isInternalCommand returns true if args are those of a sandbox or gofer
+// process, i.e. runsc flags followed by the boot or gofer command.
+func isInternalCommand(args []string) bool {
+	switch cli.Subcommand(args) {
+	case "boot", "gofer":
+		return true
+	default:
+		return false
+	}
+}
+
+// Mount is a host file or directory bind mounted in the sandbox.
+type Mount struct {
+	// Source is the host path of the mount.
+	Source string
+
+	// Destination is the absolute path of the mount in the sandbox.
+	Destination string
+
+	// ReadOnly makes the mount read-only.
+	ReadOnly bool
+}
+
+// Route is a route through a Link.
+type Route struct {
+	// Destination is the network reached through the route.
+	Destination net.IPNet
+
+	// Gateway is the next hop, if any.
+	Gateway net.IP
+}
+
+// Link is a network interface of the sandbox whose packets are exchanged over
+// AF_PACKET sockets provided by the caller, typically bound to a host
+// interface set up by the caller for the sandbox.
+type Link struct {
+	// Name is the name of the interface in the sandbox.
+	Name string
+
+	// MTU is the MTU of the interface, 1500 if 0.
+	MTU int
+
+	// Addresses are the IPv4 addresses of the interface.
+	Addresses []net.IP
+
+	// Routes are the routes through the interface.
+	Routes []Route
+
+	// Gateway, if not nil, is the default gateway, reached through the
+	// interface.
+	Gateway net.IP
+
+	// Files are the AF_PACKET sockets of the interface, among which the
+	// sandbox spreads the processing of packets. There must be at least one.
+	Files []*os.File
+}
+
+// Options configure a sandbox.
+type Options struct {
+	// ID identifies the sandbox among those whose state is in RootDir.
+	ID string
+
+	// RootDir is the directory where the state of sandboxes is stored.
+	RootDir string
+
+	// Root is the host directory used as root filesystem of the sandbox.
+	Root string
+
+	// ReadOnlyRoot makes the root filesystem read-only.
+	ReadOnlyRoot bool
+
+	// Mounts are mounted in the sandbox, on top of Root.
+	Mounts []Mount
+
+	// Hostname is the hostname of the sandbox.
+	Hostname string
+
+	// Args are the command line of the application, whose first element is
+	// looked up in the PATH of Env if it isn't a path.
+	Args []string
+
+	// Env is the environment of the application.
+	Env []string
+
+	// Cwd is the working directory of the application, / if empty.
+	Cwd string
+
+	// Stdin, Stdout and Stderr are the stdio of the application. Those that
+	// are nil are connected to /dev/null.
+	Stdin  *os.File
+	Stdout *os.File
+	Stderr *os.File
+
+	// Links are the network interfaces of the sandbox, in addition to
+	// loopback. The sandbox has no access to the host network otherwise.
+	Links []Link
+
+	// Platform is the platform running the application: ptrace (default) or
+	// kvm.
+	Platform string
+
+	// Overlay wraps the filesystem mounts with a writable overlay, keeping
+	// all modifications in memory inside the sandbox.
+	Overlay bool
+
+	// DebugLog, if not empty, enables debug logging to this location, as
+	// the runsc --debug-log flag.
+	DebugLog string
+
+	// Strace enables logging of the system calls of the application to the
+	// debug log.
+	Strace bool
+}
+
+// Sandbox is a sandbox running a single application.
+type Sandbox struct {
+	c         *container.Container
+	conf      *boot.Config
+	bundleDir string
+}
+
+// Create creates a sandbox. The application doesn't run until Start is
+// called. The caller must call Destroy on the sandbox.
+func Create(o Options) (*Sandbox, error) {
+	if o.RootDir == "" {
+		return nil, fmt.Errorf("Options.RootDir must be set")
+	}
+	conf, err := o.config()
+	if err != nil {
+		return nil, err
+	}
+	spec := o.spec()
+	if err := specutils.ValidateSpec(spec); err != nil {
+		return nil, err
+	}
+	links, err := o.links()
+	if err != nil {
+		return nil, err
+	}
+
+	// The sandbox and gofer processes read the spec from the bundle.
+	bundleDir, err := ioutil.TempDir("", "runsc-bundle")
+	if err != nil {
+		return nil, fmt.Errorf("creating bundle directory: %v", err)
+	}
+	cu := specutils.MakeCleanup(func() { os.RemoveAll(bundleDir) })
+	defer cu.Clean()
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling spec: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(bundleDir, "config.json"), b, 0644); err != nil {
+		return nil, fmt.Errorf("writing spec: %v", err)
+	}
+
+	stdios, closeStdios, err := o.stdios()
+	if err != nil {
+		return nil, err
+	}
+	// The sandbox process has its own copy of the files once created.
+	defer closeStdios()
+
+	hostIO := container.IO{
+		Stdios: stdios,
+		Links:  links,
+	}
+	c, err := container.CreateWithIO(o.ID, spec, conf, bundleDir, "" /* consoleSocket */, "" /* pidFile */, "" /* userLog */, hostIO)
+	if err != nil {
+		return nil, err
+	}
+
+	cu.Release()
+	return &Sandbox{
+		c:         c,
+		conf:      conf,
+		bundleDir: bundleDir,
+	}, nil
+}
+
+// Start sets up the network of the sandbox and starts the application.
+func (s *Sandbox) Start() error {
+	return s.c.Start(s.conf)
+}
+
+// Wait waits for the application to exit and returns its status.
+func (s *Sandbox) Wait() (syscall.WaitStatus, error) {
+	return s.c.Wait()
+}
+
+// Signal sends sig to the application.
+func (s *Sandbox) Signal(sig syscall.Signal) error {
+	return s.c.SignalContainer(sig, false /* all */)
+}
+
+// Pid returns the host PID of the sandbox process.
+func (s *Sandbox) Pid() int {
+	return s.c.SandboxPid()
+}
+
+// Destroy kills the sandbox and frees its resources, including its state in
+// RootDir.
+func (s *Sandbox) Destroy() error {
+	err := s.c.Destroy()
+	if rerr := os.RemoveAll(s.bundleDir); rerr != nil {
+		log.Warningf("Failed to remove bundle directory %q: %v", s.bundleDir, rerr)
+	}
+	return err
+}
+
+// config returns the runsc configuration of the sandbox, which matches the
+// runsc flag defaults except where o says otherwise.
+func (o *Options) config() (*boot.Config, error) {
+	conf, err := cli.DefaultConfig()
+	if err != nil {
+		return nil, err
+	}
+	if o.Platform != "" {
+		conf.Platform, err = boot.MakePlatformType(o.Platform)
+		if err != nil {
+			return nil, err
+		}
+	}
+	conf.RootDir = o.RootDir
+	conf.Debug = o.DebugLog != ""
+	conf.DebugLog = o.DebugLog
+	conf.Overlay = o.Overlay
+	conf.Network = boot.NetworkNone
+	conf.Strace = o.Strace
+	return conf, nil
+}
+
+// spec returns the OCI spec of the sandbox.
+func (o *Options) spec() *specs.Spec {
+	cwd := o.Cwd
+	if cwd == "" {
+		cwd = "/"
+	}
+	spec := &specs.Spec{
+		Version: specutils.Version,
+		Root: &specs.Root{
+			Path:     o.Root,
+			Readonly: o.ReadOnlyRoot,
+		},
+		Process: &specs.Process{
+			Args:         o.Args,
+			Env:          o.Env,
+			Cwd:          cwd,
+			Capabilities: specutils.AllCapabilities(),
+		},
+		Hostname: o.Hostname,
+	}
+	for _, m := range o.Mounts {
+		opt := "rw"
+		if m.ReadOnly {
+			opt = "ro"
+		}
+		spec.Mounts = append(spec.Mounts, specs.Mount{
+			Type:        "bind",
+			Source:      m.Source,
+			Destination: m.Destination,
+			Options:     []string{"rbind", opt},
+		})
+	}
+	return spec
+}
+
+// links returns the links of the sandbox.
+func (o *Options) links() ([]sandbox.Link, error) {
+	var links []sandbox.Link
+	for _, l := range o.Links {
+		if len(l.Files) == 0 {
+			return nil, fmt.Errorf("link %q has no files", l.Name)
+		}
+		mtu := l.MTU
+		if mtu == 0 {
+			mtu = 1500
+		}
+		link := sandbox.Link{
+			FDBasedLink: boot.FDBasedLink{
+				Name:        l.Name,
+				MTU:         mtu,
+				Addresses:   l.Addresses,
+				NumChannels: len(l.Files),
+			},
+			Files: l.Files,
+		}
+		for _, r := range l.Routes {
+			link.Routes = append(link.Routes, boot.Route{
+				Destination: r.Destination.IP.Mask(r.Destination.Mask),
+				Mask:        r.Destination.Mask,
+				Gateway:     r.Gateway,
+			})
+		}
+		if l.Gateway != nil {
+			link.DefaultGateway = boot.Route{
+				Destination: net.IPv4zero,
+				Mask:        net.IPMask(net.IPv4zero),
+				Gateway:     l.Gateway,
+			}
+		}
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+// stdios returns the stdio files of the application, opening /dev/null for
+// those not given by o, and a function closing the files it opened.
+func (o *Options) stdios() ([]*os.File, func(), error) {
+	var opened []*os.File
+	closeOpened := func() {
+		for _, f := range opened {
+			f.Close()
+		}
+	}
+	stdios := []*os.File{o.Stdin, o.Stdout, o.Stderr}
+	for i, f := range stdios {
+		if f != nil {
+			continue
+		}
+		flags := os.O_WRONLY
+		if i == 0 {
+			flags = os.O_RDONLY
+		}
+		f, err := os.OpenFile(os.DevNull, flags, 0)
+		if err != nil {
+			closeOpened()
+			return nil, nil, fmt.Errorf("opening %s: %v", os.DevNull, err)
+		}
+		opened = append(opened, f)
+		stdios[i] = f
+	}
+	return stdios, closeOpened, nil
+}
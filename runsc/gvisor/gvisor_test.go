@@ -0,0 +1,114 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gvisor
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.googlesource.com/gvisor/runsc/boot"
+)
+
+func TestIsInternalCommand(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want bool
+	}{
+		{args: nil, want: false},
+		{args: []string{"boot"}, want: true},
+		{args: []string{"--debug", "gofer"}, want: true},
+		{args: []string{"--root=/var/run/runsc", "--debug=false", "boot", "--bundle=/tmp"}, want: true},
+		{args: []string{"--root=/var/run/runsc", "--log-fd=3", "gofer", "--bundle", "/tmp"}, want: true},
+		{args: []string{"--root=/var/run/runsc", "run", "foo"}, want: false},
+		{args: []string{"--root=/var/run/runsc", "--debug=false"}, want: false},
+		{args: []string{"--root", "boot"}, want: false},
+		{args: []string{"--verbose", "boot"}, want: false},
+	} {
+		if got := isInternalCommand(tc.args); got != tc.want {
+			t.Errorf("isInternalCommand(%q): got %t, want %t", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestSpecMounts(t *testing.T) {
+	o := Options{
+		Root: "/",
+		Args: []string{"true"},
+		Mounts: []Mount{
+			{Source: "/src", Destination: "/dst"},
+			{Source: "/src", Destination: "/ro", ReadOnly: true},
+		},
+	}
+	spec := o.spec()
+	if spec.Process.Cwd != "/" {
+		t.Errorf("spec.Process.Cwd: got %q, want %q", spec.Process.Cwd, "/")
+	}
+	if len(spec.Mounts) != 2 {
+		t.Fatalf("spec.Mounts: got %+v, want 2 mounts", spec.Mounts)
+	}
+	for i, want := range [][]string{{"rbind", "rw"}, {"rbind", "ro"}} {
+		if got := spec.Mounts[i].Options; !cmp.Equal(got, want) {
+			t.Errorf("spec.Mounts[%d].Options: got %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestLinks(t *testing.T) {
+	_, subnet, err := net.ParseCIDR("10.0.0.5/24")
+	if err != nil {
+		t.Fatalf("net.ParseCIDR() failed: %v", err)
+	}
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatalf("os.Open() failed: %v", err)
+	}
+	defer f.Close()
+	o := Options{
+		Links: []Link{
+			{
+				Name:      "eth0",
+				Addresses: []net.IP{net.ParseIP("10.0.0.5")},
+				Routes:    []Route{{Destination: *subnet}},
+				Gateway:   net.ParseIP("10.0.0.1"),
+				Files:     []*os.File{f, f},
+			},
+		},
+	}
+	links, err := o.links()
+	if err != nil {
+		t.Fatalf("links() failed: %v", err)
+	}
+	if len(links) != 1 {
+		t.Fatalf("links(): got %+v, want 1 link", links)
+	}
+	l := links[0]
+	if l.MTU != 1500 || l.NumChannels != 2 {
+		t.Errorf("links(): got MTU %d and %d channels, want 1500 and 2", l.MTU, l.NumChannels)
+	}
+	wantRoutes := []boot.Route{{Destination: subnet.IP, Mask: subnet.Mask}}
+	if !cmp.Equal(l.Routes, wantRoutes) {
+		t.Errorf("links(): got routes %+v, want %+v", l.Routes, wantRoutes)
+	}
+	if l.DefaultGateway.Empty() || !l.DefaultGateway.Gateway.Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("links(): got default gateway %+v, want via 10.0.0.1", l.DefaultGateway)
+	}
+
+	o.Links[0].Files = nil
+	if _, err := o.links(); err == nil {
+		t.Errorf("links() with no files: got no error, want one")
+	}
+}
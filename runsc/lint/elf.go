@@ -0,0 +1,388 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+)
+
+const (
+	// defaultPath is used to find binaries when the spec doesn't set PATH.
+	defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+	// maxInterpreters is the maximum number of nested script interpreters,
+	// the same as Linux's BINPRM_MAX_RECURSION.
+	maxInterpreters = 4
+
+	// maxSyscallDistance is the maximum number of bytes between the
+	// instruction loading the syscall number and the syscall instruction
+	// for the syscall to be detected.
+	maxSyscallDistance = 16
+
+	// maxSysno is an upper bound for syscall numbers, larger immediates
+	// are ignored.
+	maxSysno = 1024
+
+	// ntGNUABITag is the type of the GNU note holding the minimum kernel
+	// version required by a binary.
+	ntGNUABITag = 1
+)
+
+// Checker checks binaries in the root filesystem of a container.
+type Checker struct {
+	// root is the host path of the root filesystem.
+	root string
+
+	// path is the list of directories searched for binaries.
+	path []string
+
+	syscalls *syscallTable
+}
+
+// NewChecker returns a Checker for the root filesystem at host path root.
+// Binaries are searched using PATH in env, like the sandbox does.
+func NewChecker(root string, env []string) (*Checker, error) {
+	st, err := newSyscallTable()
+	if err != nil {
+		return nil, err
+	}
+	p := defaultPath
+	for _, e := range env {
+		if strings.HasPrefix(e, "PATH=") {
+			p = strings.TrimPrefix(e, "PATH=")
+		}
+	}
+	return &Checker{
+		root:     root,
+		path:     strings.Split(p, ":"),
+		syscalls: st,
+	}, nil
+}
+
+// CheckProcess reports concerns with the binary executed by process p.
+func (c *Checker) CheckProcess(p *specs.Process) []Finding {
+	if p == nil || len(p.Args) == 0 {
+		return nil
+	}
+	name := p.Args[0]
+	if !strings.Contains(name, "/") {
+		found, err := c.lookPath(name)
+		if err != nil {
+			return []Finding{{Severity: Error, Subject: name, Message: err.Error()}}
+		}
+		name = found
+	} else if !path.IsAbs(name) {
+		name = path.Join("/", p.Cwd, name)
+	}
+	return c.CheckBinary(name)
+}
+
+// CheckBinary reports concerns with the binary at name in the container. If
+// it is a script, its interpreter is checked as well.
+func (c *Checker) CheckBinary(name string) []Finding {
+	return c.checkBinary(name, 0)
+}
+
+// CheckAll reports concerns with all ELF executables in the root filesystem.
+func (c *Checker) CheckAll() ([]Finding, error) {
+	var findings []Finding
+	err := filepath.Walk(c.root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+			return nil
+		}
+		if ok, err := isELF(p); err != nil || !ok {
+			return nil
+		}
+		rel, err := filepath.Rel(c.root, p)
+		if err != nil {
+			return err
+		}
+		findings = append(findings, c.CheckBinary(path.Join("/", filepath.ToSlash(rel)))...)
+		return nil
+	})
+	return findings, err
+}
+
+func (c *Checker) checkBinary(name string, depth int) []Finding {
+	var findings []Finding
+	add := func(sev Severity, format string, args ...interface{}) {
+		findings = append(findings, Finding{Severity: sev, Subject: name, Message: fmt.Sprintf(format, args...)})
+	}
+
+	hostPath, err := c.resolve(name)
+	if err != nil {
+		add(Error, "failed to find binary: %v", err)
+		return findings
+	}
+	f, err := os.Open(hostPath)
+	if err != nil {
+		add(Error, "failed to open binary: %v", err)
+		return findings
+	}
+	defer f.Close()
+
+	var magic [2]byte
+	if _, err := io.ReadFull(f, magic[:]); err == nil && string(magic[:]) == "#!" {
+		interp, err := readInterpreter(f)
+		if err != nil {
+			add(Error, "failed to read script interpreter: %v", err)
+			return findings
+		}
+		if depth >= maxInterpreters {
+			add(Error, "too many levels of script interpreters")
+			return findings
+		}
+		if path.Base(interp[0]) == "env" && len(interp) > 1 && !strings.Contains(interp[1], "/") {
+			found, err := c.lookPath(interp[1])
+			if err != nil {
+				add(Error, "failed to find script interpreter: %v", err)
+				return findings
+			}
+			return c.checkBinary(found, depth+1)
+		}
+		return c.checkBinary(interp[0], depth+1)
+	}
+
+	e, err := elf.NewFile(f)
+	if err != nil {
+		add(Warning, "not an ELF binary: %v", err)
+		return findings
+	}
+	defer e.Close()
+
+	if e.Class != elf.ELFCLASS64 || e.Machine != elf.EM_X86_64 {
+		add(Error, "%v %v binaries are not supported, only %v %v", e.Class, e.Machine, elf.ELFCLASS64, elf.EM_X86_64)
+		return findings
+	}
+
+	for _, p := range e.Progs {
+		switch p.Type {
+		case elf.PT_INTERP:
+			interp, err := ioutil.ReadAll(p.Open())
+			if err != nil {
+				add(Warning, "failed to read dynamic loader: %v", err)
+				continue
+			}
+			loader := string(bytes.TrimRight(interp, "\x00"))
+			if _, err := c.resolve(loader); err != nil {
+				add(Error, "dynamic loader %q not found: %v", loader, err)
+			}
+		case elf.PT_NOTE:
+			notes, err := ioutil.ReadAll(p.Open())
+			if err != nil {
+				add(Warning, "failed to read notes: %v", err)
+				continue
+			}
+			if major, minor, ok := abiTag(notes, e.ByteOrder); ok {
+				kmajor, kminor := c.syscalls.kernelVersion()
+				if major > kmajor || (major == kmajor && minor > kminor) {
+					add(Warning, "requires Linux %d.%d, the sandbox reports Linux %d.%d", major, minor, kmajor, kminor)
+				}
+			}
+		}
+	}
+
+	used := make(map[uintptr]bool)
+	if syms, err := e.ImportedSymbols(); err == nil {
+		// Calls to libc wrappers of syscalls.
+		for _, s := range syms {
+			if sysno, ok := c.syscalls.lookup(s.Name); ok {
+				used[sysno] = true
+			}
+		}
+	}
+	for _, s := range e.Sections {
+		if s.Type != elf.SHT_PROGBITS || s.Flags&elf.SHF_EXECINSTR == 0 {
+			continue
+		}
+		text, err := s.Data()
+		if err != nil {
+			add(Warning, "failed to read section %s: %v", s.Name, err)
+			continue
+		}
+		scanSyscalls(text, used)
+	}
+
+	var sysnos []int
+	for sysno := range used {
+		sysnos = append(sysnos, int(sysno))
+	}
+	sort.Ints(sysnos)
+	for _, sysno := range sysnos {
+		if desc, ok := c.syscalls.unsupported(uintptr(sysno)); ok {
+			add(Warning, "may use syscall %s (%d), which %s", c.syscalls.name(uintptr(sysno)), sysno, desc)
+		}
+	}
+	return findings
+}
+
+// lookPath finds name in the search path, like the sandbox does when starting
+// a process.
+func (c *Checker) lookPath(name string) (string, error) {
+	for _, dir := range c.path {
+		p := path.Join("/", dir, name)
+		hostPath, err := c.resolve(p)
+		if err != nil {
+			continue
+		}
+		if info, err := os.Stat(hostPath); err == nil && info.Mode().IsRegular() {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("%q not found in %s", name, strings.Join(c.path, ":"))
+}
+
+// resolve returns the host path of the file at name in the container,
+// following symlinks relative to the root filesystem.
+func (c *Checker) resolve(name string) (string, error) {
+	resolved := "/"
+	parts := strings.Split(name, "/")
+	links := 0
+	for len(parts) > 0 {
+		part := parts[0]
+		parts = parts[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			resolved = path.Dir(resolved)
+			continue
+		}
+
+		next := path.Join(resolved, part)
+		hostPath := filepath.Join(c.root, filepath.FromSlash(next))
+		info, err := os.Lstat(hostPath)
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		links++
+		if links > linux.MaxSymlinkTraversals {
+			return "", &os.PathError{Op: "resolve", Path: name, Err: syscall.ELOOP}
+		}
+		target, err := os.Readlink(hostPath)
+		if err != nil {
+			return "", err
+		}
+		if path.IsAbs(target) {
+			resolved = "/"
+		}
+		parts = append(strings.Split(target, "/"), parts...)
+	}
+	return filepath.Join(c.root, filepath.FromSlash(resolved)), nil
+}
+
+// readInterpreter returns the interpreter and its optional argument from the
+// "#!" line of a script. r must be positioned after the "#!".
+func readInterpreter(r io.Reader) ([]string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	// Like Linux, everything after the interpreter is a single argument.
+	fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+	if fields[0] == "" {
+		return nil, fmt.Errorf("no interpreter")
+	}
+	if len(fields) > 1 {
+		fields[1] = strings.TrimSpace(fields[1])
+	}
+	return fields, nil
+}
+
+// isELF returns true if the file at host path p starts with the ELF magic.
+func isELF(p string) (bool, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	var magic [len(elf.ELFMAG)]byte
+	if _, err := io.ReadFull(f, magic[:]); err != nil {
+		return false, nil
+	}
+	return string(magic[:]) == elf.ELFMAG, nil
+}
+
+// abiTag returns the minimum kernel version from the GNU ABI tag note in
+// notes, the contents of a PT_NOTE segment.
+func abiTag(notes []byte, order binary.ByteOrder) (int, int, bool) {
+	align4 := func(n uint32) uint32 { return (n + 3) &^ 3 }
+	for len(notes) >= 12 {
+		namesz := order.Uint32(notes[0:])
+		descsz := order.Uint32(notes[4:])
+		typ := order.Uint32(notes[8:])
+		notes = notes[12:]
+		if uint64(align4(namesz))+uint64(align4(descsz)) > uint64(len(notes)) {
+			return 0, 0, false
+		}
+		name := notes[:namesz]
+		desc := notes[align4(namesz) : align4(namesz)+descsz]
+		notes = notes[align4(namesz)+align4(descsz):]
+
+		// The descriptor is the OS (0 for Linux) and the major, minor
+		// and patch version.
+		if string(name) == "GNU\x00" && typ == ntGNUABITag && len(desc) >= 16 && order.Uint32(desc) == 0 {
+			return int(order.Uint32(desc[4:])), int(order.Uint32(desc[8:])), true
+		}
+	}
+	return 0, 0, false
+}
+
+// scanSyscalls adds the numbers of syscalls made by the x86-64 machine code in
+// text to used. Only syscall instructions shortly preceded by a load of an
+// immediate into eax or rax are detected, which is how libc and most
+// assembly make syscalls with constant numbers.
+func scanSyscalls(text []byte, used map[uintptr]bool) {
+	for i := 0; i+1 < len(text); i++ {
+		// syscall is 0f 05.
+		if text[i] != 0x0f || text[i+1] != 0x05 {
+			continue
+		}
+		// Find the closest load of the syscall number, i.e. "mov $imm32,
+		// %eax" (b8 imm32) or "mov $imm32, %rax" (48 c7 c0 imm32).
+		for j := i - 5; j >= 0 && j >= i-maxSyscallDistance; j-- {
+			if text[j] != 0xb8 && !(j >= 2 && text[j-2] == 0x48 && text[j-1] == 0xc7 && text[j] == 0xc0) {
+				continue
+			}
+			if n := binary.LittleEndian.Uint32(text[j+1:]); n < maxSysno {
+				used[uintptr(n)] = true
+			}
+			break
+		}
+	}
+}
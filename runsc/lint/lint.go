@@ -0,0 +1,159 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lint reports potential compatibility problems of an OCI spec, and of
+// the binaries in its root filesystem, when run with runsc.
+//
+// Checks are heuristics: the absence of findings doesn't guarantee that an
+// application works, and findings don't necessarily mean that it doesn't.
+package lint
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.googlesource.com/gvisor/runsc/specutils"
+)
+
+// Severity is the severity of a Finding.
+type Severity int
+
+const (
+	// Info findings describe differences that rarely affect applications.
+	Info Severity = iota
+
+	// Warning findings describe features that are ignored or unsupported,
+	// which may break applications that depend on them.
+	Warning
+
+	// Error findings describe problems that prevent the container from
+	// running.
+	Error
+)
+
+// String implements fmt.Stringer.
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Finding is a single compatibility concern.
+type Finding struct {
+	// Severity is the severity of the finding.
+	Severity Severity `json:"severity"`
+
+	// Subject is what the finding is about, e.g. "spec", "mount /data" or
+	// the path of a binary in the container.
+	Subject string `json:"subject"`
+
+	// Message describes the concern.
+	Message string `json:"message"`
+}
+
+// String implements fmt.Stringer.
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s", f.Severity, f.Subject, f.Message)
+}
+
+// supportedMountTypes are the mount types that runsc mounts in the sandbox.
+// Mounts of other types are ignored. See runsc/boot/fs.go.
+var supportedMountTypes = map[string]bool{
+	"bind":      true,
+	"devpts":    true,
+	"devtmpfs":  true,
+	"hugetlbfs": true,
+	"none":      true,
+	"proc":      true,
+	"sysfs":     true,
+	"tmpfs":     true,
+}
+
+// sandboxDevices are the character devices provided by the sandbox's /dev. See
+// pkg/sentry/fs/dev/dev.go.
+var sandboxDevices = map[string]bool{
+	"/dev/full":    true,
+	"/dev/kmsg":    true,
+	"/dev/null":    true,
+	"/dev/ptmx":    true,
+	"/dev/random":  true,
+	"/dev/urandom": true,
+	"/dev/zero":    true,
+}
+
+// CheckSpec reports features of spec that runsc doesn't support or ignores.
+func CheckSpec(spec *specs.Spec) []Finding {
+	var findings []Finding
+	add := func(sev Severity, subject, format string, args ...interface{}) {
+		findings = append(findings, Finding{Severity: sev, Subject: subject, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if err := specutils.ValidateSpec(spec); err != nil {
+		add(Error, "spec", "%v", err)
+	}
+	if spec.Process != nil && spec.Process.ApparmorProfile != "" {
+		add(Info, "process", "AppArmor profile %q is ignored", spec.Process.ApparmorProfile)
+	}
+
+	for _, m := range spec.Mounts {
+		subject := "mount " + m.Destination
+		dst := filepath.Clean(m.Destination)
+		switch {
+		case !supportedMountTypes[m.Type]:
+			add(Warning, subject, "mount type %q is not supported, the mount is ignored", m.Type)
+		case (dst == "/dev" || strings.HasPrefix(dst, "/dev/")) && !specutils.IsSupportedDevMount(m):
+			add(Info, subject, "the sandbox provides its own /dev, the mount is ignored")
+		case m.Type == "bind" && strings.HasPrefix(filepath.Clean(m.Source), "/dev/"):
+			add(Warning, subject, "host device %q can't be accessed from the sandbox", m.Source)
+		}
+	}
+
+	if spec.Linux == nil {
+		return findings
+	}
+	if spec.Linux.Seccomp != nil {
+		add(Warning, "linux.seccomp", "seccomp filters are not applied to the application")
+	}
+	for k := range spec.Linux.Sysctl {
+		add(Warning, "linux.sysctl", "sysctl %q is ignored", k)
+	}
+	for _, d := range spec.Linux.Devices {
+		subject := "device " + d.Path
+		p := path.Clean(d.Path)
+		switch {
+		case d.Type == "b" && path.Dir(p) != "/dev":
+			add(Warning, subject, "only block devices directly in /dev are supported, the device is ignored")
+		case d.Type == "b":
+			// Passed into the sandbox, see specutils.BlockDevices.
+		case !sandboxDevices[p]:
+			add(Warning, subject, "the device is not available in the sandbox")
+		}
+	}
+	return findings
+}
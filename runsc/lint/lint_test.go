@@ -0,0 +1,211 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func validSpec() *specs.Spec {
+	return &specs.Spec{
+		Root:    &specs.Root{Path: "/"},
+		Process: &specs.Process{Args: []string{"/bin/true"}},
+	}
+}
+
+func TestCheckSpec(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		modify func(*specs.Spec)
+		want   []Severity
+	}{
+		{
+			name:   "valid",
+			modify: func(*specs.Spec) {},
+		},
+		{
+			name:   "no process",
+			modify: func(s *specs.Spec) { s.Process = nil },
+			want:   []Severity{Error},
+		},
+		{
+			name: "supported mounts",
+			modify: func(s *specs.Spec) {
+				s.Mounts = []specs.Mount{
+					{Type: "proc", Destination: "/proc"},
+					{Type: "tmpfs", Destination: "/dev/shm"},
+					{Type: "bind", Source: "/data", Destination: "/data"},
+				}
+			},
+		},
+		{
+			name: "unsupported mounts",
+			modify: func(s *specs.Spec) {
+				s.Mounts = []specs.Mount{
+					{Type: "cgroup", Destination: "/sys/fs/cgroup"},
+					{Type: "bind", Source: "/dev/fuse", Destination: "/fuse"},
+					{Type: "bind", Source: "/dev/null", Destination: "/dev/null"},
+				}
+			},
+			want: []Severity{Warning, Warning, Info},
+		},
+		{
+			name: "linux",
+			modify: func(s *specs.Spec) {
+				s.Linux = &specs.Linux{
+					Seccomp: &specs.LinuxSeccomp{},
+					Sysctl:  map[string]string{"net.core.somaxconn": "1024"},
+					Devices: []specs.LinuxDevice{
+						{Path: "/dev/null", Type: "c"},
+						{Path: "/dev/sda", Type: "b"},
+						{Path: "/dev/disk/sdb", Type: "b"},
+						{Path: "/dev/fuse", Type: "c"},
+					},
+				}
+			},
+			want: []Severity{Warning, Warning, Warning, Warning},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := validSpec()
+			tc.modify(spec)
+			var got []Severity
+			for _, f := range CheckSpec(spec) {
+				got = append(got, f.Severity)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("CheckSpec() severities got: %v, want: %v, findings: %v", got, tc.want, CheckSpec(spec))
+			}
+		})
+	}
+}
+
+func TestScanSyscalls(t *testing.T) {
+	text := []byte{
+		0xb8, 0x3c, 0x00, 0x00, 0x00, // mov $60, %eax
+		0x0f, 0x05, // syscall
+		0x48, 0xc7, 0xc0, 0x9d, 0x00, 0x00, 0x00, // mov $157, %rax
+		0x48, 0x89, 0xdf, // mov %rbx, %rdi
+		0x0f, 0x05, // syscall
+		0xb8, 0xff, 0xff, 0x00, 0x00, // mov $65535, %eax
+		0x0f, 0x05, // syscall
+		0x90, 0x0f, 0x05, // nop; syscall
+	}
+	got := make(map[uintptr]bool)
+	scanSyscalls(text, got)
+	want := map[uintptr]bool{60: true, 157: true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("scanSyscalls() got: %v, want: %v", got, want)
+	}
+}
+
+func TestABITag(t *testing.T) {
+	var notes []byte
+	note := func(name string, typ uint32, desc ...uint32) {
+		var b [4]byte
+		for _, v := range []uint32{uint32(len(name)), uint32(4 * len(desc)), typ} {
+			binary.LittleEndian.PutUint32(b[:], v)
+			notes = append(notes, b[:]...)
+		}
+		notes = append(notes, name...)
+		for len(notes)%4 != 0 {
+			notes = append(notes, 0)
+		}
+		for _, v := range desc {
+			binary.LittleEndian.PutUint32(b[:], v)
+			notes = append(notes, b[:]...)
+		}
+	}
+	note("Go\x00", 4, 1, 2)
+	note("GNU\x00", ntGNUABITag, 0, 3, 2, 0)
+
+	major, minor, ok := abiTag(notes, binary.LittleEndian)
+	if !ok || major != 3 || minor != 2 {
+		t.Errorf("abiTag() got: %d, %d, %t, want: 3, 2, true", major, minor, ok)
+	}
+	if _, _, ok := abiTag(notes[:len(notes)-4], binary.LittleEndian); ok {
+		t.Errorf("abiTag() on truncated notes got: ok, want: !ok")
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	for _, tc := range []struct {
+		release      string
+		major, minor int
+	}{
+		{"4.4", 4, 4},
+		{"4.19.0-6-amd64", 4, 19},
+		{"5.4+", 5, 4},
+		{"3", 3, 0},
+		{"", 0, 0},
+	} {
+		major, minor := parseVersion(tc.release)
+		if major != tc.major || minor != tc.minor {
+			t.Errorf("parseVersion(%q) got: %d.%d, want: %d.%d", tc.release, major, minor, tc.major, tc.minor)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	root, err := ioutil.TempDir("", "lint_test")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	// Layout of a merged /usr image.
+	if err := os.MkdirAll(filepath.Join(root, "usr/bin"), 0755); err != nil {
+		t.Fatalf("os.MkdirAll() failed: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "usr/bin/busybox"), nil, 0755); err != nil {
+		t.Fatalf("ioutil.WriteFile() failed: %v", err)
+	}
+	for _, l := range []struct{ target, name string }{
+		{"usr/bin", "bin"},
+		{"/bin/busybox", "usr/bin/sh"},
+		{"../../loop", "loop"},
+	} {
+		if err := os.Symlink(l.target, filepath.Join(root, l.name)); err != nil {
+			t.Fatalf("os.Symlink() failed: %v", err)
+		}
+	}
+
+	c, err := NewChecker(root, []string{"PATH=/bin"})
+	if err != nil {
+		t.Fatalf("NewChecker() failed: %v", err)
+	}
+	want := filepath.Join(root, "usr/bin/busybox")
+	for _, name := range []string{"/bin/sh", "/usr/bin/sh", "/../bin/busybox"} {
+		got, err := c.resolve(name)
+		if err != nil || got != want {
+			t.Errorf("resolve(%q) got: %q, %v, want: %q", name, got, err, want)
+		}
+	}
+	for _, name := range []string{"/bin/bash", "/loop"} {
+		if got, err := c.resolve(name); err == nil {
+			t.Errorf("resolve(%q) got: %q, want: error", name, got)
+		}
+	}
+	if got, err := c.lookPath("sh"); err != nil || got != "/bin/sh" {
+		t.Errorf("lookPath(sh) got: %q, %v, want: /bin/sh", got, err)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/strace"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/syscalls"
+	slinux "gvisor.googlesource.com/gvisor/pkg/sentry/syscalls/linux"
+)
+
+// Closures returned by the syscalls helpers share the code of the function
+// literal in the helper, which identifies table entries that only return an
+// error.
+var (
+	errorFn          = reflect.ValueOf(syscalls.Error(nil)).Pointer()
+	errorWithEventFn = reflect.ValueOf(syscalls.ErrorWithEvent(nil)).Pointer()
+	capErrorFn       = reflect.ValueOf(syscalls.CapError(0)).Pointer()
+)
+
+// syscallTable describes the syscalls supported by the sandbox.
+type syscallTable struct {
+	table *kernel.SyscallTable
+	names strace.SyscallMap
+
+	// numbers maps syscall names to numbers.
+	numbers map[string]uintptr
+}
+
+// newSyscallTable returns the amd64 Linux syscall table of the sandbox.
+func newSyscallTable() (*syscallTable, error) {
+	names, ok := strace.Lookup(abi.Linux, arch.AMD64)
+	if !ok {
+		return nil, fmt.Errorf("amd64 Linux syscall names not found")
+	}
+	st := &syscallTable{
+		table:   slinux.AMD64,
+		names:   names,
+		numbers: make(map[string]uintptr),
+	}
+	for sysno := range names {
+		st.numbers[names.Name(sysno)] = sysno
+	}
+	return st, nil
+}
+
+// unsupported returns a description and true if syscall sysno is not
+// supported by the sandbox.
+func (st *syscallTable) unsupported(sysno uintptr) (string, bool) {
+	fn, ok := st.table.Table[sysno]
+	if !ok || fn == nil {
+		return "is not implemented, it fails with ENOSYS", true
+	}
+	switch reflect.ValueOf(fn).Pointer() {
+	case errorFn, errorWithEventFn:
+		return "is not implemented, it always fails", true
+	case capErrorFn:
+		return "is not implemented, it fails with EPERM or ENOSYS", true
+	}
+	return "", false
+}
+
+// lookup returns the number of the syscall named name.
+func (st *syscallTable) lookup(name string) (uintptr, bool) {
+	sysno, ok := st.numbers[name]
+	return sysno, ok
+}
+
+// name returns the name of syscall sysno.
+func (st *syscallTable) name(sysno uintptr) string {
+	return st.names.Name(sysno)
+}
+
+// kernelVersion returns the major and minor version of the kernel reported
+// by the sandbox.
+func (st *syscallTable) kernelVersion() (int, int) {
+	return parseVersion(st.table.Version.Release)
+}
+
+// parseVersion parses the major and minor version of a kernel release string,
+// e.g. "4.4.0-foo". Missing or malformed components are 0.
+func parseVersion(release string) (int, int) {
+	parts := strings.SplitN(release, ".", 3)
+	major, _ := strconv.Atoi(parts[0])
+	var minor int
+	if len(parts) > 1 {
+		minor, _ = strconv.Atoi(strings.TrimRightFunc(parts[1], func(r rune) bool {
+			return r < '0' || r > '9'
+		}))
+	}
+	return major, minor
+}
@@ -68,7 +68,7 @@ func setupNetwork(conn *urpc.Client, pid int, spec *specs.Spec, conf *boot.Confi
 		// Build the path to the net namespace of the sandbox process.
 		// This is what we will copy.
 		nsPath := filepath.Join("/proc", strconv.Itoa(pid), "ns/net")
-		if err := createInterfacesAndRoutesFromNS(conn, nsPath, conf.GSO); err != nil {
+		if err := createInterfacesAndRoutesFromNS(conn, nsPath, conf); err != nil {
 			return fmt.Errorf("creating interfaces from net namespace %q: %v", nsPath, err)
 		}
 	case boot.NetworkHost:
@@ -79,6 +79,40 @@ func setupNetwork(conn *urpc.Client, pid int, spec *specs.Spec, conf *boot.Confi
 	return nil
 }
 
+// Link is a network interface of the sandbox backed by host files provided by
+// the caller, rather than by an interface of the net namespace of the sandbox.
+type Link struct {
+	boot.FDBasedLink
+
+	// Files are the AF_PACKET sockets exchanging the packets of the link,
+	// one per channel of the link.
+	Files []*os.File
+
+	// DefaultGateway, if not empty, is the default route through the link.
+	DefaultGateway boot.Route
+}
+
+// addLinks adds links to a network stack whose links and routes were already
+// created.
+func addLinks(conn *urpc.Client, conf *boot.Config, links []Link) error {
+	if len(links) > 0 && conf.Network == boot.NetworkHost {
+		return fmt.Errorf("links can't be added with --network=%v", boot.NetworkHost)
+	}
+	for _, l := range links {
+		args := boot.AddLinkArgs{
+			Link:           l.FDBasedLink,
+			DefaultGateway: l.DefaultGateway,
+		}
+		args.FilePayload.Files = l.Files
+
+		log.Debugf("Adding link, config: %+v", args)
+		if err := conn.Call(boot.NetworkAddLink, &args, nil); err != nil {
+			return fmt.Errorf("adding link %q: %v", l.Name, err)
+		}
+	}
+	return nil
+}
+
 func createDefaultLoopbackInterface(conn *urpc.Client) error {
 	link := boot.LoopbackLink{
 		Name: "lo",
@@ -138,7 +172,7 @@ func isRootNS() (bool, error) {
 // createInterfacesAndRoutesFromNS scrapes the interface and routes from the
 // net namespace with the given path, creates them in the sandbox, and removes
 // them from the host.
-func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, enableGSO bool) error {
+func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *boot.Config) error {
 	// Join the network namespace that we will be copying.
 	restore, err := joinNetNS(nsPath)
 	if err != nil {
@@ -184,49 +218,14 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, enableGSO
 			continue
 		}
 
-		// Keep only IPv4 addresses.
-		var ip4addrs []*net.IPNet
-		for _, ifaddr := range allAddrs {
-			ipNet, ok := ifaddr.(*net.IPNet)
-			if !ok {
-				return fmt.Errorf("address is not IPNet: %+v", ifaddr)
-			}
-			if ipNet.IP.To4() == nil {
-				log.Warningf("IPv6 is not supported, skipping: %v", ipNet)
-				continue
-			}
-			ip4addrs = append(ip4addrs, ipNet)
+		link, deviceFiles, def, err := createFDBasedLink(iface, allAddrs, conf)
+		if err != nil {
+			return err
 		}
-		if len(ip4addrs) == 0 {
+		if link == nil {
 			log.Warningf("No IPv4 address found for interface %q, skipping", iface.Name)
 			continue
 		}
-
-		// Create the socket.
-		const protocol = 0x0300 // htons(ETH_P_ALL)
-		fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, protocol)
-		if err != nil {
-			return fmt.Errorf("unable to create raw socket: %v", err)
-		}
-		deviceFile := os.NewFile(uintptr(fd), "raw-device-fd")
-
-		// Bind to the appropriate device.
-		ll := syscall.SockaddrLinklayer{
-			Protocol: protocol,
-			Ifindex:  iface.Index,
-			Hatype:   0, // No ARP type.
-			Pkttype:  syscall.PACKET_OTHERHOST,
-		}
-		if err := syscall.Bind(fd, &ll); err != nil {
-			return fmt.Errorf("unable to bind to %q: %v", iface.Name, err)
-		}
-
-		// Scrape the routes before removing the address, since that
-		// will remove the routes as well.
-		routes, def, err := routesForIface(iface)
-		if err != nil {
-			return fmt.Errorf("getting routes for interface %q: %v", iface.Name, err)
-		}
 		if def != nil {
 			if !args.DefaultGateway.Route.Empty() {
 				return fmt.Errorf("more than one default route found, interface: %v, route: %v, default route: %+v", iface.Name, def, args.DefaultGateway)
@@ -235,51 +234,177 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, enableGSO
 			args.DefaultGateway.Name = iface.Name
 		}
 
-		link := boot.FDBasedLink{
-			Name:   iface.Name,
-			MTU:    iface.MTU,
-			Routes: routes,
+		args.FilePayload.Files = append(args.FilePayload.Files, deviceFiles...)
+		args.FDBasedLinks = append(args.FDBasedLinks, *link)
+	}
+
+	log.Debugf("Setting up network, config: %+v", args)
+	if err := conn.Call(boot.NetworkCreateLinksAndRoutes, &args, nil); err != nil {
+		return fmt.Errorf("creating links and routes: %v", err)
+	}
+	return nil
+}
+
+// addInterfaceFromNS moves the interface name of the net namespace with the
+// given path, with its IPv4 addresses and routes, to the running sandbox.
+func addInterfaceFromNS(conn *urpc.Client, nsPath, name string, conf *boot.Config) error {
+	restore, err := joinNetNS(nsPath)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return fmt.Errorf("querying interface %q: %v", name, err)
+	}
+	if iface.Flags&net.FlagUp == 0 {
+		return fmt.Errorf("interface %q is down", name)
+	}
+	if iface.Flags&net.FlagLoopback != 0 {
+		return fmt.Errorf("interface %q is a loopback interface", name)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return fmt.Errorf("fetching interface addresses for %q: %v", name, err)
+	}
+
+	link, deviceFiles, def, err := createFDBasedLink(*iface, addrs, conf)
+	if err != nil {
+		return err
+	}
+	if link == nil {
+		return fmt.Errorf("no IPv4 address found for interface %q", name)
+	}
+	args := boot.AddLinkArgs{Link: *link}
+	args.FilePayload.Files = deviceFiles
+	if def != nil {
+		args.DefaultGateway = *def
+	}
+
+	log.Debugf("Adding interface, config: %+v", args)
+	if err := conn.Call(boot.NetworkAddLink, &args, nil); err != nil {
+		return fmt.Errorf("adding link: %v", err)
+	}
+	return nil
+}
+
+// createFDBasedLink creates the sockets of the link of iface, whose addresses
+// are addrs, and moves the IPv4 addresses of iface from the host to the link.
+// It returns the link, its sockets, and the default route through iface, if
+// any. The link is nil if iface has no IPv4 address.
+func createFDBasedLink(iface net.Interface, addrs []net.Addr, conf *boot.Config) (*boot.FDBasedLink, []*os.File, *boot.Route, error) {
+	// Keep only IPv4 addresses.
+	var ip4addrs []*net.IPNet
+	for _, ifaddr := range addrs {
+		ipNet, ok := ifaddr.(*net.IPNet)
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("address is not IPNet: %+v", ifaddr)
+		}
+		if ipNet.IP.To4() == nil {
+			log.Warningf("IPv6 is not supported, skipping: %v", ipNet)
+			continue
 		}
+		ip4addrs = append(ip4addrs, ipNet)
+	}
+	if len(ip4addrs) == 0 {
+		return nil, nil, nil, nil
+	}
 
-		// Get the link for the interface.
-		ifaceLink, err := netlink.LinkByName(iface.Name)
+	// Create the sockets, one per channel.
+	var deviceFiles []*os.File
+	for i := 0; i < conf.NumNetworkChannels; i++ {
+		deviceFile, err := createSocket(iface, conf.NumNetworkChannels > 1)
 		if err != nil {
-			return fmt.Errorf("getting link for interface %q: %v", iface.Name, err)
+			return nil, nil, nil, err
 		}
+		deviceFiles = append(deviceFiles, deviceFile)
+	}
 
-		if enableGSO {
-			gso, err := isGSOEnabled(fd, iface.Name)
-			if err != nil {
-				return fmt.Errorf("getting GSO for interface %q: %v", iface.Name, err)
-			}
-			if gso {
-				if err := syscall.SetsockoptInt(fd, syscall.SOL_PACKET, unix.PACKET_VNET_HDR, 1); err != nil {
-					return fmt.Errorf("unable to enable the PACKET_VNET_HDR option: %v", err)
+	// Scrape the routes before removing the address, since that
+	// will remove the routes as well.
+	routes, def, err := routesForIface(iface)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("getting routes for interface %q: %v", iface.Name, err)
+	}
+
+	link := boot.FDBasedLink{
+		Name:        iface.Name,
+		MTU:         iface.MTU,
+		Routes:      routes,
+		NDP:         conf.NDP,
+		BusyPoll:    conf.NetBusyPoll,
+		NumChannels: conf.NumNetworkChannels,
+		SaveRestore: conf.NetRestore,
+	}
+
+	// Get the link for the interface.
+	ifaceLink, err := netlink.LinkByName(iface.Name)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("getting link for interface %q: %v", iface.Name, err)
+	}
+
+	if conf.GSO {
+		gso, err := isGSOEnabled(int(deviceFiles[0].Fd()), iface.Name)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("getting GSO for interface %q: %v", iface.Name, err)
+		}
+		if gso {
+			for _, deviceFile := range deviceFiles {
+				if err := syscall.SetsockoptInt(int(deviceFile.Fd()), syscall.SOL_PACKET, unix.PACKET_VNET_HDR, 1); err != nil {
+					return nil, nil, nil, fmt.Errorf("unable to enable the PACKET_VNET_HDR option: %v", err)
 				}
-				link.GSOMaxSize = ifaceLink.Attrs().GSOMaxSize
 			}
+			link.GSOMaxSize = ifaceLink.Attrs().GSOMaxSize
 		}
+	}
 
-		// Collect the addresses for the interface, enable forwarding,
-		// and remove them from the host.
-		for _, addr := range ip4addrs {
-			link.Addresses = append(link.Addresses, addr.IP)
+	// Collect the addresses for the interface, enable forwarding,
+	// and remove them from the host.
+	for _, addr := range ip4addrs {
+		link.Addresses = append(link.Addresses, addr.IP)
 
-			// Steal IP address from NIC.
-			if err := removeAddress(ifaceLink, addr.String()); err != nil {
-				return fmt.Errorf("removing address %v from device %q: %v", iface.Name, addr, err)
-			}
+		// Steal IP address from NIC.
+		if err := removeAddress(ifaceLink, addr.String()); err != nil {
+			return nil, nil, nil, fmt.Errorf("removing address %v from device %q: %v", iface.Name, addr, err)
 		}
+	}
+	return &link, deviceFiles, def, nil
+}
 
-		args.FilePayload.Files = append(args.FilePayload.Files, deviceFile)
-		args.FDBasedLinks = append(args.FDBasedLinks, link)
+// createSocket creates an AF_PACKET socket bound to iface. If fanout is true,
+// the socket joins the fanout group of iface, among whose sockets the host
+// spreads the packets received by iface, keeping each flow on one socket.
+func createSocket(iface net.Interface, fanout bool) (*os.File, error) {
+	const protocol = 0x0300 // htons(ETH_P_ALL)
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, protocol)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create raw socket: %v", err)
 	}
+	deviceFile := os.NewFile(uintptr(fd), "raw-device-fd")
 
-	log.Debugf("Setting up network, config: %+v", args)
-	if err := conn.Call(boot.NetworkCreateLinksAndRoutes, &args, nil); err != nil {
-		return fmt.Errorf("creating links and routes: %v", err)
+	// Bind to the appropriate device.
+	ll := syscall.SockaddrLinklayer{
+		Protocol: protocol,
+		Ifindex:  iface.Index,
+		Hatype:   0, // No ARP type.
+		Pkttype:  syscall.PACKET_OTHERHOST,
 	}
-	return nil
+	if err := syscall.Bind(fd, &ll); err != nil {
+		deviceFile.Close()
+		return nil, fmt.Errorf("unable to bind to %q: %v", iface.Name, err)
+	}
+
+	if fanout {
+		// The interface index, which is unique in the namespace, is used as
+		// the ID of the fanout group.
+		val := iface.Index&0xffff | (unix.PACKET_FANOUT_HASH|unix.PACKET_FANOUT_FLAG_DEFRAG)<<16
+		if err := syscall.SetsockoptInt(fd, syscall.SOL_PACKET, unix.PACKET_FANOUT, val); err != nil {
+			deviceFile.Close()
+			return nil, fmt.Errorf("unable to join the fanout group of %q: %v", iface.Name, err)
+		}
+	}
+	return deviceFile, nil
 }
 
 // loopbackLinks collects the links for a loopback interface.
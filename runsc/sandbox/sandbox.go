@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"syscall"
@@ -60,6 +61,11 @@ type Sandbox struct {
 	// Cgroup has the cgroup configuration for the sandbox.
 	Cgroup *cgroup.Cgroup `json:"cgroup"`
 
+	// ConfigOverrides are the annotations of the root container that
+	// override runsc flags for the sandbox (immutable). They must be applied
+	// to the configuration of every operation on the sandbox with Config.
+	ConfigOverrides map[string]string `json:"configOverrides,omitempty"`
+
 	// child is set if a sandbox process is a child of the current process.
 	//
 	// This field isn't saved to json, because only a creator of sandbox
@@ -73,10 +79,11 @@ type Sandbox struct {
 	statusMu sync.Mutex
 }
 
-// New creates the sandbox process. The caller must call Destroy() on the
-// sandbox.
-func New(id string, spec *specs.Spec, conf *boot.Config, bundleDir, consoleSocket, userLog string, ioFiles []*os.File, specFile *os.File, cg *cgroup.Cgroup) (*Sandbox, error) {
-	s := &Sandbox{ID: id, Cgroup: cg}
+// New creates the sandbox process. stdios are the stdin, stdout and stderr of
+// the root container, unless consoleSocket is set. The caller must call
+// Destroy() on the sandbox.
+func New(id string, spec *specs.Spec, conf *boot.Config, bundleDir, consoleSocket, userLog string, stdios, ioFiles []*os.File, specFile *os.File, cg *cgroup.Cgroup) (*Sandbox, error) {
+	s := &Sandbox{ID: id, Cgroup: cg, ConfigOverrides: boot.ConfigOverrides(spec.Annotations)}
 	// The Cleanup object cleans up partially created sandboxes when an error
 	// occurs. Any errors occurring during cleanup itself are ignored.
 	c := specutils.MakeCleanup(func() {
@@ -93,7 +100,7 @@ func New(id string, spec *specs.Spec, conf *boot.Config, bundleDir, consoleSocke
 	defer clientSyncFile.Close()
 
 	// Create the sandbox process.
-	err = s.createSandboxProcess(spec, conf, bundleDir, consoleSocket, userLog, ioFiles, specFile, sandboxSyncFile)
+	err = s.createSandboxProcess(spec, conf, bundleDir, consoleSocket, userLog, stdios, ioFiles, specFile, sandboxSyncFile)
 	// sandboxSyncFile has to be closed to be able to detect when the sandbox
 	// process exits unexpectedly.
 	sandboxSyncFile.Close()
@@ -111,6 +118,11 @@ func New(id string, spec *specs.Spec, conf *boot.Config, bundleDir, consoleSocke
 	return s, nil
 }
 
+// Config returns conf with the sandbox's flag overrides applied.
+func (s *Sandbox) Config(conf *boot.Config) (*boot.Config, error) {
+	return conf.Override(s.ConfigOverrides)
+}
+
 // CreateContainer creates a non-root container inside the sandbox.
 func (s *Sandbox) CreateContainer(cid string) error {
 	log.Debugf("Create non-root container %q in sandbox %q, PID: %d", cid, s.ID, s.Pid)
@@ -126,8 +138,9 @@ func (s *Sandbox) CreateContainer(cid string) error {
 	return nil
 }
 
-// StartRoot starts running the root container process inside the sandbox.
-func (s *Sandbox) StartRoot(spec *specs.Spec, conf *boot.Config) error {
+// StartRoot starts running the root container process inside the sandbox,
+// after adding links to its network.
+func (s *Sandbox) StartRoot(spec *specs.Spec, conf *boot.Config, links []Link) error {
 	log.Debugf("Start root sandbox %q, PID: %d", s.ID, s.Pid)
 	conn, err := s.sandboxConnect()
 	if err != nil {
@@ -139,6 +152,9 @@ func (s *Sandbox) StartRoot(spec *specs.Spec, conf *boot.Config) error {
 	if err := setupNetwork(conn, s.Pid, spec, conf); err != nil {
 		return fmt.Errorf("setting up network: %v", err)
 	}
+	if err := addLinks(conn, conf, links); err != nil {
+		return fmt.Errorf("setting up network: %v", err)
+	}
 
 	// Send a message to the sandbox control server to start the root
 	// container.
@@ -149,8 +165,9 @@ func (s *Sandbox) StartRoot(spec *specs.Spec, conf *boot.Config) error {
 	return nil
 }
 
-// StartContainer starts running a non-root container inside the sandbox.
-func (s *Sandbox) StartContainer(spec *specs.Spec, conf *boot.Config, cid string, goferFiles []*os.File) error {
+// StartContainer starts running a non-root container inside the sandbox, with
+// stdios as its stdin, stdout and stderr.
+func (s *Sandbox) StartContainer(spec *specs.Spec, conf *boot.Config, cid string, stdios, goferFiles []*os.File) error {
 	for _, f := range goferFiles {
 		defer f.Close()
 	}
@@ -164,7 +181,7 @@ func (s *Sandbox) StartContainer(spec *specs.Spec, conf *boot.Config, cid string
 
 	// The payload must container stdin/stdout/stderr followed by gofer
 	// files.
-	files := append([]*os.File{os.Stdin, os.Stdout, os.Stderr}, goferFiles...)
+	files := append(append([]*os.File(nil), stdios...), goferFiles...)
 	// Start running the container.
 	args := boot.StartArgs{
 		Spec:        spec,
@@ -267,9 +284,9 @@ func (s *Sandbox) Event(cid string) (*boot.Event, error) {
 	defer conn.Close()
 
 	var e boot.Event
-	// TODO: Pass in the container id (cid) here. The sandbox
-	// should return events only for that container.
-	if err := conn.Call(boot.ContainerEvent, nil, &e); err != nil {
+	// TODO: The sandbox should return all events only for the
+	// container, currently only unimplemented syscalls are per container.
+	if err := conn.Call(boot.ContainerEvent, &cid, &e); err != nil {
 		return nil, fmt.Errorf("retrieving event data from sandbox: %v", err)
 	}
 	e.ID = cid
@@ -291,7 +308,7 @@ func (s *Sandbox) connError(err error) error {
 
 // createSandboxProcess starts the sandbox as a subprocess by running the "boot"
 // command, passing in the bundle dir.
-func (s *Sandbox) createSandboxProcess(spec *specs.Spec, conf *boot.Config, bundleDir, consoleSocket, userLog string, ioFiles []*os.File, mountsFile, startSyncFile *os.File) error {
+func (s *Sandbox) createSandboxProcess(spec *specs.Spec, conf *boot.Config, bundleDir, consoleSocket, userLog string, stdios, ioFiles []*os.File, mountsFile, startSyncFile *os.File) error {
 	// nextFD is used to get unused FDs that we can pass to the sandbox.  It
 	// starts at 3 because 0, 1, and 2 are taken by stdin/out/err.
 	nextFD := 3
@@ -368,6 +385,24 @@ func (s *Sandbox) createSandboxProcess(spec *specs.Spec, conf *boot.Config, bund
 		nextFD++
 	}
 
+	// Pass block devices from the spec to the sandbox. Each device is
+	// donated twice: once for buffered I/O, then for O_DIRECT.
+	for _, d := range specutils.BlockDevices(spec) {
+		f, direct, err := specutils.OpenBlockDevice(d.Major, d.Minor)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if direct != f {
+			defer direct.Close()
+		}
+		for _, df := range []*os.File{f, direct} {
+			cmd.ExtraFiles = append(cmd.ExtraFiles, df)
+			cmd.Args = append(cmd.Args, "--block-device-fds="+strconv.Itoa(nextFD))
+			nextFD++
+		}
+	}
+
 	// If the platform needs a device FD we must pass it in.
 	if deviceFile, err := deviceFileForPlatform(conf.Platform); err != nil {
 		return err
@@ -423,9 +458,9 @@ func (s *Sandbox) createSandboxProcess(spec *specs.Spec, conf *boot.Config, bund
 			cmd.Stderr = tty
 		}
 	} else {
-		// If not using a console, pass our current stdio as the
-		// container stdio via flags.
-		for _, f := range []*os.File{os.Stdin, os.Stdout, os.Stderr} {
+		// If not using a console, pass stdios as the container stdio
+		// via flags.
+		for _, f := range stdios {
 			cmd.ExtraFiles = append(cmd.ExtraFiles, f)
 			cmd.Args = append(cmd.Args, "--stdio-fds="+strconv.Itoa(nextFD))
 			nextFD++
@@ -433,10 +468,10 @@ func (s *Sandbox) createSandboxProcess(spec *specs.Spec, conf *boot.Config, bund
 
 		if conf.Debug {
 			// If debugging, send the boot process stdio to the
-			// this process' stdio, so that is is easier to find.
-			cmd.Stdin = os.Stdin
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
+			// container stdio, so that is is easier to find.
+			cmd.Stdin = stdios[0]
+			cmd.Stdout = stdios[1]
+			cmd.Stderr = stdios[2]
 		}
 	}
 
@@ -590,6 +625,18 @@ func (s *Sandbox) createSandboxProcess(spec *specs.Spec, conf *boot.Config, bund
 		nextFD++
 	}
 
+	if conf.WatchdogDumpDir != "" {
+		f, err := os.OpenFile(conf.WatchdogDumpDir, os.O_RDONLY|syscall.O_DIRECTORY, 0)
+		if err != nil {
+			return fmt.Errorf("opening watchdog dump directory: %v", err)
+		}
+		defer f.Close()
+
+		cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+		cmd.Args = append(cmd.Args, "--watchdog-dump-fd", strconv.Itoa(nextFD))
+		nextFD++
+	}
+
 	// Add container as the last argument.
 	cmd.Args = append(cmd.Args, s.ID)
 
@@ -748,7 +795,7 @@ func (s *Sandbox) SignalProcess(cid string, pid int32, sig syscall.Signal, fgPro
 
 // Checkpoint sends the checkpoint call for a container in the sandbox.
 // The statefile will be written to f.
-func (s *Sandbox) Checkpoint(cid string, f *os.File) error {
+func (s *Sandbox) Checkpoint(cid string, f *os.File, compression string) error {
 	log.Debugf("Checkpoint sandbox %q", s.ID)
 	conn, err := s.sandboxConnect()
 	if err != nil {
@@ -757,6 +804,7 @@ func (s *Sandbox) Checkpoint(cid string, f *os.File) error {
 	defer conn.Close()
 
 	opt := control.SaveOpts{
+		Compression: compression,
 		FilePayload: urpc.FilePayload{
 			Files: []*os.File{f},
 		},
@@ -768,6 +816,44 @@ func (s *Sandbox) Checkpoint(cid string, f *os.File) error {
 	return nil
 }
 
+// ExportFilesystem writes a tar archive of the memory-backed filesystems under
+// path in the sandbox to f.
+func (s *Sandbox) ExportFilesystem(path string, f *os.File) error {
+	log.Debugf("Export filesystem %q of sandbox %q", path, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	opts := control.ExportFilesystemOpts{
+		Path: path,
+		FilePayload: urpc.FilePayload{
+			Files: []*os.File{f},
+		},
+	}
+	if err := conn.Call(boot.ContainerExportFilesystem, &opts, nil); err != nil {
+		return fmt.Errorf("exporting filesystem of sandbox %q: %v", s.ID, err)
+	}
+	return nil
+}
+
+// ExportNetstack returns the state of the sandbox network stack.
+func (s *Sandbox) ExportNetstack() (*control.NetstackState, error) {
+	log.Debugf("Export netstack of sandbox %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var state control.NetstackState
+	if err := conn.Call(boot.ContainerExportNetstack, nil, &state); err != nil {
+		return nil, fmt.Errorf("exporting netstack of sandbox %q: %v", s.ID, err)
+	}
+	return &state, nil
+}
+
 // Pause sends the pause call for a container in the sandbox.
 func (s *Sandbox) Pause(cid string) error {
 	log.Debugf("Pause sandbox %q", s.ID)
@@ -798,6 +884,63 @@ func (s *Sandbox) Resume(cid string) error {
 	return nil
 }
 
+// AddInterface moves the network interface name of the net namespace of the
+// sandbox, with its IPv4 addresses and routes, into the sandbox.
+func (s *Sandbox) AddInterface(conf *boot.Config, name string) error {
+	log.Debugf("Add interface %q to sandbox %q", name, s.ID)
+	if conf.Network != boot.NetworkSandbox {
+		return fmt.Errorf("interfaces can only be added with --network=%v", boot.NetworkSandbox)
+	}
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	nsPath := filepath.Join("/proc", strconv.Itoa(s.Pid), "ns/net")
+	if err := addInterfaceFromNS(conn, nsPath, name, conf); err != nil {
+		return fmt.Errorf("adding interface %q to sandbox %q: %v", name, s.ID, err)
+	}
+	return nil
+}
+
+// RemoveInterface removes the network interface name from the sandbox. The
+// host interface is left as is.
+func (s *Sandbox) RemoveInterface(name string) error {
+	log.Debugf("Remove interface %q from sandbox %q", name, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.Call(boot.NetworkRemoveLink, &boot.RemoveLinkArgs{Name: name}, nil); err != nil {
+		return fmt.Errorf("removing interface %q from sandbox %q: %v", name, s.ID, err)
+	}
+	return nil
+}
+
+// UpdateResolver replaces /etc/hosts and /etc/resolv.conf of a container in
+// the sandbox. Nil contents leave the corresponding file unchanged.
+func (s *Sandbox) UpdateResolver(cid string, hosts, resolvConf []byte) error {
+	log.Debugf("Update resolver files of container %q in sandbox %q", cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.UpdateResolverArgs{
+		CID:        cid,
+		Hosts:      hosts,
+		ResolvConf: resolvConf,
+	}
+	if err := conn.Call(boot.ContainerUpdateResolver, &args, nil); err != nil {
+		return fmt.Errorf("updating resolver files of container %q: %v", cid, err)
+	}
+	return nil
+}
+
 // IsRunning returns true if the sandbox or gofer process is running.
 func (s *Sandbox) IsRunning() bool {
 	if s.Pid != 0 {
@@ -829,26 +972,39 @@ func (s *Sandbox) Stacks() (string, error) {
 // HeapProfile writes a heap profile to the given file.
 func (s *Sandbox) HeapProfile(f *os.File) error {
 	log.Debugf("Heap profile %q", s.ID)
-	conn, err := s.sandboxConnect()
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
+	return s.profile(boot.HeapProfile, f, 0)
+}
 
-	opts := control.ProfileOpts{
-		FilePayload: urpc.FilePayload{
-			Files: []*os.File{f},
-		},
-	}
-	if err := conn.Call(boot.HeapProfile, &opts, nil); err != nil {
-		return fmt.Errorf("getting sandbox %q heap profile: %v", s.ID, err)
-	}
-	return nil
+// CPUProfile collects a CPU profile for the given duration and writes it to
+// the given file.
+func (s *Sandbox) CPUProfile(f *os.File, duration time.Duration) error {
+	log.Debugf("CPU profile %q", s.ID)
+	return s.profile(boot.CPUProfile, f, duration)
+}
+
+// BlockProfile collects a profile of blocking events for the given duration
+// and writes it to the given file.
+func (s *Sandbox) BlockProfile(f *os.File, duration time.Duration) error {
+	log.Debugf("Block profile %q", s.ID)
+	return s.profile(boot.BlockProfile, f, duration)
+}
+
+// MutexProfile collects a profile of mutex contention for the given duration
+// and writes it to the given file.
+func (s *Sandbox) MutexProfile(f *os.File, duration time.Duration) error {
+	log.Debugf("Mutex profile %q", s.ID)
+	return s.profile(boot.MutexProfile, f, duration)
+}
+
+// GoroutineProfile writes the stacks of all sentry goroutines to the given
+// file.
+func (s *Sandbox) GoroutineProfile(f *os.File) error {
+	log.Debugf("Goroutine profile %q", s.ID)
+	return s.profile(boot.Goroutines, f, 0)
 }
 
-// StartCPUProfile start CPU profile writing to the given file.
-func (s *Sandbox) StartCPUProfile(f *os.File) error {
-	log.Debugf("CPU profile start %q", s.ID)
+// profile calls the given profile RPC with f as the output file.
+func (s *Sandbox) profile(method string, f *os.File, duration time.Duration) error {
 	conn, err := s.sandboxConnect()
 	if err != nil {
 		return err
@@ -856,27 +1012,28 @@ func (s *Sandbox) StartCPUProfile(f *os.File) error {
 	defer conn.Close()
 
 	opts := control.ProfileOpts{
+		Duration: duration,
 		FilePayload: urpc.FilePayload{
 			Files: []*os.File{f},
 		},
 	}
-	if err := conn.Call(boot.StartCPUProfile, &opts, nil); err != nil {
-		return fmt.Errorf("starting sandbox %q CPU profile: %v", s.ID, err)
+	if err := conn.Call(method, &opts, nil); err != nil {
+		return fmt.Errorf("getting sandbox %q profile %s: %v", s.ID, method, err)
 	}
 	return nil
 }
 
-// StopCPUProfile stops a previously started CPU profile.
-func (s *Sandbox) StopCPUProfile() error {
-	log.Debugf("CPU profile stop %q", s.ID)
+// Strace enables, reconfigures or disables strace in the sandbox.
+func (s *Sandbox) Strace(args *control.StraceArgs) error {
+	log.Debugf("Strace %q: %+v", s.ID, args)
 	conn, err := s.sandboxConnect()
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	if err := conn.Call(boot.StopCPUProfile, nil, nil); err != nil {
-		return fmt.Errorf("stopping sandbox %q CPU profile: %v", s.ID, err)
+	if err := conn.Call(boot.StraceConfigure, args, nil); err != nil {
+		return fmt.Errorf("configuring sandbox %q strace: %v", s.ID, err)
 	}
 	return nil
 }
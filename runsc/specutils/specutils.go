@@ -294,7 +294,7 @@ func Is9PMount(m specs.Mount) bool {
 
 // IsSupportedDevMount returns true if the mount is a supported /dev mount.
 // Only mount that does not conflict with runsc default /dev mount is
-// supported.
+// supported, except for tmpfs mounts at /dev/shm, which configure its size.
 func IsSupportedDevMount(m specs.Mount) bool {
 	// These are devices exist inside sentry. See pkg/sentry/fs/dev/dev.go
 	var existingDevices = []string{
@@ -309,6 +309,9 @@ func IsSupportedDevMount(m specs.Mount) bool {
 		// whether it was asked for, as the spec says we SHOULD.
 		return false
 	}
+	if dst == "/dev/shm" && m.Type == "tmpfs" {
+		return true
+	}
 	for _, dev := range existingDevices {
 		if dst == dev || strings.HasPrefix(dst, dev+"/") {
 			return false
@@ -317,6 +320,50 @@ func IsSupportedDevMount(m specs.Mount) bool {
 	return true
 }
 
+// BlockDevices returns the block devices in the spec that are passed into the
+// sandbox. Only devices directly in /dev are supported.
+func BlockDevices(spec *specs.Spec) []specs.LinuxDevice {
+	if spec.Linux == nil {
+		return nil
+	}
+	var devs []specs.LinuxDevice
+	for _, d := range spec.Linux.Devices {
+		if d.Type != "b" {
+			continue
+		}
+		if filepath.Dir(filepath.Clean(d.Path)) != "/dev" {
+			log.Warningf("ignoring block device at %q: only devices in /dev are supported", d.Path)
+			continue
+		}
+		devs = append(devs, d)
+	}
+	return devs
+}
+
+// OpenBlockDevice opens the host block device with the given device numbers
+// for passing into the sandbox. It returns a file opened for buffered I/O and
+// a file opened with O_DIRECT, which is the same file if the device does not
+// support O_DIRECT.
+func OpenBlockDevice(major, minor int64) (*os.File, *os.File, error) {
+	path := fmt.Sprintf("/dev/block/%d:%d", major, minor)
+	flags := os.O_RDWR
+	f, err := os.OpenFile(path, flags, 0)
+	if err != nil {
+		// The device may be read-only.
+		flags = os.O_RDONLY
+		f, err = os.OpenFile(path, flags, 0)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening block device %q: %v", path, err)
+	}
+	direct, err := os.OpenFile(path, flags|syscall.O_DIRECT, 0)
+	if err != nil {
+		log.Warningf("Block device %q does not support O_DIRECT: %v", path, err)
+		return f, f, nil
+	}
+	return f, direct, nil
+}
+
 const (
 	// ContainerdContainerTypeAnnotation is the OCI annotation set by
 	// containerd to indicate whether the container to create should have
@@ -263,3 +263,28 @@ func TestSpecInvalid(t *testing.T) {
 		}
 	}
 }
+
+func TestBlockDevices(t *testing.T) {
+	spec := specs.Spec{
+		Linux: &specs.Linux{
+			Devices: []specs.LinuxDevice{
+				{Path: "/dev/sdb", Type: "b", Major: 8, Minor: 16},
+				{Path: "/dev/ttyS0", Type: "c", Major: 4, Minor: 64},
+				{Path: "/dev/disk/data", Type: "b", Major: 8, Minor: 32},
+				{Path: "/dev/nvme0n1", Type: "b", Major: 259, Minor: 0},
+			},
+		},
+	}
+	var got []string
+	for _, d := range BlockDevices(&spec) {
+		got = append(got, d.Path)
+	}
+	want := []string{"/dev/sdb", "/dev/nvme0n1"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("BlockDevices() = %v, want %v", got, want)
+	}
+
+	if devs := BlockDevices(&specs.Spec{}); len(devs) != 0 {
+		t.Errorf("BlockDevices() with no Linux spec = %v, want none", devs)
+	}
+}
@@ -39,6 +39,7 @@ import (
 	"github.com/cenkalti/backoff"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/syndtr/gocapability/capability"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/watchdog"
 	"gvisor.googlesource.com/gvisor/runsc/boot"
 	"gvisor.googlesource.com/gvisor/runsc/specutils"
 )
@@ -128,12 +129,13 @@ func FindFile(path string) (string, error) {
 // 'RootDir' must be set by caller if required.
 func TestConfig() *boot.Config {
 	return &boot.Config{
-		Debug:      true,
-		LogFormat:  "text",
-		LogPackets: true,
-		Network:    boot.NetworkNone,
-		Strace:     true,
-		FileAccess: boot.FileAccessExclusive,
+		Debug:           true,
+		LogFormat:       "text",
+		LogPackets:      true,
+		Network:         boot.NetworkNone,
+		Strace:          true,
+		FileAccess:      boot.FileAccessExclusive,
+		WatchdogTimeout: watchdog.DefaultTimeout,
 		TestOnlyAllowRunAsCurrentUserWithoutChroot: true,
 	}
 }
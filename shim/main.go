@@ -0,0 +1,27 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Binary containerd-shim-runsc-v1 is the containerd shim for runsc. It is
+// selected in containerd with the runtime type "io.containerd.runsc.v1", and
+// must be installed in $PATH along with runsc.
+package main
+
+import (
+	"github.com/containerd/containerd/runtime/v2/shim"
+	runscshim "gvisor.googlesource.com/gvisor/pkg/shim"
+)
+
+func main() {
+	shim.Run(runscshim.RuntimeName, runscshim.New)
+}
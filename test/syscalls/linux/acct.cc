@@ -0,0 +1,134 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <signal.h>
+#include <string.h>
+#include <sys/acct.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include <string>
+
+#include "gtest/gtest.h"
+#include "absl/strings/str_cat.h"
+#include "test/util/capability_util.h"
+#include "test/util/cleanup.h"
+#include "test/util/fs_util.h"
+#include "test/util/temp_path.h"
+#include "test/util/test_util.h"
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+// ForkAndWait forks a child that runs fn, and returns its pid once it has
+// exited.
+template <typename F>
+pid_t ForkAndWait(F fn) {
+  pid_t const child = fork();
+  if (child == 0) {
+    fn();
+    _exit(0);
+  }
+  TEST_PCHECK(child > 0);
+  int status;
+  TEST_PCHECK(waitpid(child, &status, 0) == child);
+  return child;
+}
+
+// FindRecord returns the accounting record for pid in contents.
+PosixErrorOr<struct acct_v3> FindRecord(const std::string& contents,
+                                        pid_t pid) {
+  if (contents.size() % sizeof(struct acct_v3) != 0) {
+    return PosixError(EINVAL, absl::StrCat("bad accounting file size ",
+                                           contents.size()));
+  }
+  for (size_t off = 0; off < contents.size(); off += sizeof(struct acct_v3)) {
+    struct acct_v3 rec;
+    memcpy(&rec, contents.data() + off, sizeof(rec));
+    if (rec.ac_pid == static_cast<uint32_t>(pid)) {
+      return rec;
+    }
+  }
+  return PosixError(ENOENT, absl::StrCat("no record for pid ", pid));
+}
+
+TEST(AcctTest, RequiresCapability) {
+  if (ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_PACCT))) {
+    ASSERT_NO_ERRNO(SetCapability(CAP_SYS_PACCT, false));
+  }
+  EXPECT_THAT(acct(nullptr), SyscallFailsWithErrno(EPERM));
+}
+
+TEST(AcctTest, NotRegularFile) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_PACCT)));
+
+  auto dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  EXPECT_THAT(acct(dir.path().c_str()), SyscallFailsWithErrno(EISDIR));
+  EXPECT_THAT(acct("/dev/null"), SyscallFailsWithErrno(EACCES));
+  EXPECT_THAT(acct(JoinPath(dir.path(), "nonexistent").c_str()),
+              SyscallFailsWithErrno(ENOENT));
+}
+
+TEST(AcctTest, RecordOnExit) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_PACCT)));
+
+  auto file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  ASSERT_THAT(acct(file.path().c_str()), SyscallSucceeds());
+  Cleanup disable([] { EXPECT_THAT(acct(nullptr), SyscallSucceeds()); });
+
+  pid_t const exited = ForkAndWait([] { _exit(42); });
+  pid_t const killed = ForkAndWait([] {
+    TEST_PCHECK(execl("/bin/sh", "sh", "-c", "kill -9 $$", nullptr) == 0);
+  });
+  disable.Release()();
+
+  std::string const contents =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents(file.path()));
+
+  struct acct_v3 const rec =
+      ASSERT_NO_ERRNO_AND_VALUE(FindRecord(contents, exited));
+  EXPECT_EQ(rec.ac_version & 0x7f, ACCT_VERSION);
+  EXPECT_EQ(rec.ac_exitcode, 42 << 8);
+  EXPECT_EQ(rec.ac_ppid, static_cast<uint32_t>(getpid()));
+  EXPECT_EQ(rec.ac_uid, getuid());
+  EXPECT_EQ(rec.ac_gid, getgid());
+  EXPECT_TRUE(rec.ac_flag & AFORK);
+  EXPECT_FALSE(rec.ac_flag & AXSIG);
+
+  struct acct_v3 const killed_rec =
+      ASSERT_NO_ERRNO_AND_VALUE(FindRecord(contents, killed));
+  EXPECT_EQ(killed_rec.ac_exitcode, SIGKILL);
+  EXPECT_FALSE(killed_rec.ac_flag & AFORK);
+  EXPECT_TRUE(killed_rec.ac_flag & AXSIG);
+  EXPECT_STREQ(killed_rec.ac_comm, "sh");
+}
+
+TEST(AcctTest, Disabled) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_PACCT)));
+
+  auto file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  ASSERT_THAT(acct(file.path().c_str()), SyscallSucceeds());
+  ASSERT_THAT(acct(nullptr), SyscallSucceeds());
+
+  ForkAndWait([] {});
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetContents(file.path())), "");
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
@@ -0,0 +1,205 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <errno.h>
+#include <sys/stat.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include <string>
+
+#include "gtest/gtest.h"
+#include "test/util/capability_util.h"
+#include "test/util/cleanup.h"
+#include "test/util/fs_util.h"
+#include "test/util/mount_util.h"
+#include "test/util/multiprocess_util.h"
+#include "test/util/posix_error.h"
+#include "test/util/temp_path.h"
+#include "test/util/test_util.h"
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+// BinfmtMiscTest mounts a binfmt_misc filesystem for the duration of a test.
+class BinfmtMiscTest : public ::testing::Test {
+ protected:
+  void SetUp() override {
+    SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+    dir_ = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+    mount_ = ASSERT_NO_ERRNO_AND_VALUE(
+        Mount("", dir_.path(), "binfmt_misc", 0, "", 0));
+  }
+
+  // Path returns the path of name in the binfmt_misc mount.
+  std::string Path(const std::string& name) const {
+    return JoinPath(dir_.path(), name);
+  }
+
+  // Register registers entry, and returns a Cleanup that removes the entry
+  // named name.
+  PosixErrorOr<Cleanup> Register(const std::string& name,
+                                 const std::string& entry) {
+    RETURN_IF_ERRNO(SetContents(Path("register"), entry));
+    std::string path = Path(name);
+    return Cleanup([path] {
+      // The test may have removed the entry already.
+      SetContents(path, "-1").IgnoreError();
+    });
+  }
+
+  TempPath dir_;
+  Cleanup mount_;
+};
+
+// Exec executes path and returns its wait status.
+PosixErrorOr<int> Exec(const std::string& path) {
+  pid_t child;
+  int execve_errno;
+  ASSIGN_OR_RETURN_ERRNO(
+      auto kill, ForkAndExec(path, {path, "arg"}, {}, &child, &execve_errno));
+  if (execve_errno != 0) {
+    return PosixError(execve_errno, "execve");
+  }
+  int status;
+  if (RetryEINTR(waitpid)(child, &status, 0) != child) {
+    return PosixError(errno, "waitpid");
+  }
+  kill.Release();
+  return status;
+}
+
+// CreateScript creates an executable file at path with contents, and returns
+// a TempPath that removes it.
+PosixErrorOr<TempPath> CreateScript(const std::string& path,
+                                    const std::string& contents) {
+  RETURN_IF_ERRNO(CreateWithContents(path, contents, 0755));
+  return TempPath(path);
+}
+
+TEST(BinfmtMiscProcTest, MountPointExists) {
+  struct stat st;
+  ASSERT_THAT(stat("/proc/sys/fs/binfmt_misc", &st), SyscallSucceeds());
+  EXPECT_TRUE(S_ISDIR(st.st_mode));
+}
+
+TEST_F(BinfmtMiscTest, Status) {
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetContents(Path("status"))),
+            "enabled\n");
+
+  struct stat st;
+  ASSERT_THAT(stat(Path("register").c_str(), &st), SyscallSucceeds());
+  EXPECT_EQ(st.st_mode & 0777, 0200);
+}
+
+TEST_F(BinfmtMiscTest, RegisterExtension) {
+  auto script = ASSERT_NO_ERRNO_AND_VALUE(
+      CreateScript(NewTempAbsPath() + ".gvtest", "exit 42\n"));
+  auto entry = ASSERT_NO_ERRNO_AND_VALUE(
+      Register("gvisor_test_ext", ":gvisor_test_ext:E::gvtest::/bin/sh:\n"));
+
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetContents(Path("gvisor_test_ext"))),
+            "enabled\n"
+            "interpreter /bin/sh\n"
+            "flags: \n"
+            "extension .gvtest\n");
+
+  int status = ASSERT_NO_ERRNO_AND_VALUE(Exec(script.path()));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 42) << status;
+}
+
+TEST_F(BinfmtMiscTest, RegisterMagic) {
+  // The magic is a valid shell assignment, so that the interpreter can run
+  // the binary.
+  auto script = ASSERT_NO_ERRNO_AND_VALUE(
+      CreateScript(NewTempAbsPath(), "GVMAGIC=1\nexit 43\n"));
+  auto entry = ASSERT_NO_ERRNO_AND_VALUE(
+      Register("gvisor_test_magic",
+               ":gvisor_test_magic:M:2:\\x4d\\x41G:\\xdf\\xffG:/bin/sh:P\n"));
+
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetContents(Path("gvisor_test_magic"))),
+            "enabled\n"
+            "interpreter /bin/sh\n"
+            "flags: P\n"
+            "offset 2\n"
+            "magic 4d4147\n"
+            "mask dfff47\n");
+
+  int status = ASSERT_NO_ERRNO_AND_VALUE(Exec(script.path()));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 43) << status;
+}
+
+TEST_F(BinfmtMiscTest, DisableEntry) {
+  auto script = ASSERT_NO_ERRNO_AND_VALUE(
+      CreateScript(NewTempAbsPath() + ".gvtest", "exit 42\n"));
+  auto entry = ASSERT_NO_ERRNO_AND_VALUE(
+      Register("gvisor_test_ext", ":gvisor_test_ext:E::gvtest::/bin/sh:\n"));
+
+  ASSERT_NO_ERRNO(SetContents(Path("gvisor_test_ext"), "0"));
+  EXPECT_THAT(Exec(script.path()), PosixErrorIs(ENOEXEC, ::testing::_));
+  std::string contents =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents(Path("gvisor_test_ext")));
+  EXPECT_EQ(contents.substr(0, contents.find('\n')), "disabled");
+
+  ASSERT_NO_ERRNO(SetContents(Path("gvisor_test_ext"), "1"));
+  int status = ASSERT_NO_ERRNO_AND_VALUE(Exec(script.path()));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 42) << status;
+}
+
+TEST_F(BinfmtMiscTest, RemoveEntry) {
+  auto entry = ASSERT_NO_ERRNO_AND_VALUE(
+      Register("gvisor_test_ext", ":gvisor_test_ext:E::gvtest::/bin/sh:\n"));
+  ASSERT_NO_ERRNO(SetContents(Path("gvisor_test_ext"), "-1"));
+
+  struct stat st;
+  EXPECT_THAT(stat(Path("gvisor_test_ext").c_str(), &st),
+              SyscallFailsWithErrno(ENOENT));
+}
+
+TEST_F(BinfmtMiscTest, RegisterDuplicate) {
+  auto entry = ASSERT_NO_ERRNO_AND_VALUE(
+      Register("gvisor_test_ext", ":gvisor_test_ext:E::gvtest::/bin/sh:\n"));
+  EXPECT_THAT(
+      SetContents(Path("register"), ":gvisor_test_ext:E::other::/bin/sh:\n"),
+      PosixErrorIs(EEXIST, ::testing::_));
+}
+
+TEST_F(BinfmtMiscTest, RegisterInvalid) {
+  for (const char* entry : {
+           // Unknown type.
+           ":gvisor_test_bad:X::gvtest::/bin/sh:\n",
+           // Missing interpreter.
+           ":gvisor_test_bad:E::gvtest:::\n",
+           // Extension entries have no offset.
+           ":gvisor_test_bad:E:1:gvtest::/bin/sh:\n",
+           // Mask and magic lengths differ.
+           ":gvisor_test_bad:M::GV:\\xff:/bin/sh:\n",
+           // Unknown flag.
+           ":gvisor_test_bad:E::gvtest::/bin/sh:Z\n",
+           // Invalid name.
+           ":..:E::gvtest::/bin/sh:\n",
+       }) {
+    EXPECT_THAT(SetContents(Path("register"), entry),
+                PosixErrorIs(EINVAL, ::testing::_))
+        << entry;
+  }
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
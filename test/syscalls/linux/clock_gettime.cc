@@ -127,6 +127,8 @@ std::string PrintClockId(::testing::TestParamInfo<clockid_t> info) {
       return "CLOCK_MONOTONIC_COARSE";
     case CLOCK_MONOTONIC_RAW:
       return "CLOCK_MONOTONIC_RAW";
+    case CLOCK_BOOTTIME:
+      return "CLOCK_BOOTTIME";
     default:
       return absl::StrCat(info.param);
   }
@@ -135,15 +137,35 @@ std::string PrintClockId(::testing::TestParamInfo<clockid_t> info) {
 INSTANTIATE_TEST_CASE_P(ClockGettime, MonotonicClockTest,
                         ::testing::Values(CLOCK_MONOTONIC,
                                           CLOCK_MONOTONIC_COARSE,
-                                          CLOCK_MONOTONIC_RAW),
+                                          CLOCK_MONOTONIC_RAW,
+                                          CLOCK_BOOTTIME),
                         PrintClockId);
 
+// CLOCK_BOOTTIME includes time spent suspended, so it is never behind
+// CLOCK_MONOTONIC.
+TEST(ClockGettime, BoottimeNotBehindMonotonic) {
+  struct timespec mono, boot;
+  ASSERT_THAT(clock_gettime(CLOCK_MONOTONIC, &mono), SyscallSucceeds());
+  ASSERT_THAT(clock_gettime(CLOCK_BOOTTIME, &boot), SyscallSucceeds());
+  EXPECT_GE(absl::TimeFromTimespec(boot), absl::TimeFromTimespec(mono));
+}
+
+// CLOCK_TAI differs from CLOCK_REALTIME by a constant offset of at most a few
+// minutes (leap seconds), which is 0 unless set by adjtimex(2).
+TEST(ClockGettime, TaiNearRealtime) {
+  struct timespec real, tai;
+  ASSERT_THAT(clock_gettime(CLOCK_REALTIME, &real), SyscallSucceeds());
+  ASSERT_THAT(clock_gettime(CLOCK_TAI, &tai), SyscallSucceeds());
+  absl::Duration offset =
+      absl::TimeFromTimespec(tai) - absl::TimeFromTimespec(real);
+  EXPECT_GE(offset, absl::ZeroDuration());
+  EXPECT_LT(offset, absl::Minutes(5));
+}
+
 TEST(ClockGettime, UnimplementedReturnsEINVAL) {
   SKIP_IF(!IsRunningOnGvisor());
 
   struct timespec tp;
-  EXPECT_THAT(clock_gettime(CLOCK_BOOTTIME, &tp),
-              SyscallFailsWithErrno(EINVAL));
   EXPECT_THAT(clock_gettime(CLOCK_REALTIME_ALARM, &tp),
               SyscallFailsWithErrno(EINVAL));
   EXPECT_THAT(clock_gettime(CLOCK_BOOTTIME_ALARM, &tp),
@@ -0,0 +1,130 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <errno.h>
+#include <fcntl.h>
+#include <sys/syscall.h>
+#include <unistd.h>
+
+#include <vector>
+
+#include "gtest/gtest.h"
+#include "test/util/multiprocess_util.h"
+#include "test/util/temp_path.h"
+#include "test/util/test_util.h"
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+#ifndef SYS_close_range
+#define SYS_close_range 436
+#endif
+
+constexpr unsigned int kCloseRangeUnshare = 1 << 1;
+constexpr unsigned int kCloseRangeCloexec = 1 << 2;
+
+int CloseRange(unsigned int first, unsigned int last, unsigned int flags) {
+  return syscall(SYS_close_range, first, last, flags);
+}
+
+class CloseRangeTest : public ::testing::Test {
+ protected:
+  void SetUp() override {
+    // Skip on hosts that predate close_range.
+    SKIP_IF(CloseRange(~0U, ~0U, 0) < 0 && errno == ENOSYS);
+
+    file_ = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+    for (int i = 0; i < 5; i++) {
+      // Don't use FileDescriptor, since these FDs are closed by the tests.
+      int fd;
+      ASSERT_THAT(fd = open(file_.path().c_str(), O_RDONLY),
+                  SyscallSucceeds());
+      fds_.push_back(fd);
+    }
+  }
+
+  void TearDown() override {
+    for (int fd : fds_) {
+      close(fd);
+    }
+  }
+
+  // Returns true if fd is open.
+  bool IsOpen(int fd) { return fcntl(fd, F_GETFD) >= 0; }
+
+  TempPath file_;
+  std::vector<int> fds_;
+};
+
+TEST_F(CloseRangeTest, Basic) {
+  // The FDs aren't necessarily contiguous, so close a range containing only
+  // the first one.
+  ASSERT_THAT(CloseRange(fds_[0], fds_[0], 0), SyscallSucceeds());
+  EXPECT_FALSE(IsOpen(fds_[0]));
+  for (size_t i = 1; i < fds_.size(); i++) {
+    EXPECT_TRUE(IsOpen(fds_[i]));
+  }
+}
+
+TEST_F(CloseRangeTest, ToEnd) {
+  const auto rest = [&] {
+    TEST_PCHECK(CloseRange(fds_[0], ~0U, 0) == 0);
+    for (int fd : fds_) {
+      TEST_CHECK(!IsOpen(fd));
+    }
+    // FDs below the range are unaffected.
+    TEST_CHECK(IsOpen(STDERR_FILENO));
+  };
+  EXPECT_THAT(InForkedProcess(rest), IsPosixErrorOkAndHolds(0));
+}
+
+TEST_F(CloseRangeTest, Cloexec) {
+  ASSERT_THAT(CloseRange(fds_[0], fds_[0], kCloseRangeCloexec),
+              SyscallSucceeds());
+  EXPECT_THAT(fcntl(fds_[0], F_GETFD), SyscallSucceedsWithValue(FD_CLOEXEC));
+  for (size_t i = 1; i < fds_.size(); i++) {
+    EXPECT_THAT(fcntl(fds_[i], F_GETFD), SyscallSucceedsWithValue(0));
+  }
+}
+
+TEST_F(CloseRangeTest, Unshare) {
+  const auto rest = [&] {
+    TEST_PCHECK(CloseRange(fds_[0], ~0U, kCloseRangeUnshare) == 0);
+    for (int fd : fds_) {
+      TEST_CHECK(!IsOpen(fd));
+    }
+  };
+  EXPECT_THAT(InForkedProcess(rest), IsPosixErrorOkAndHolds(0));
+}
+
+TEST_F(CloseRangeTest, EmptyRange) {
+  EXPECT_THAT(CloseRange(~0U - 1, ~0U, 0), SyscallSucceeds());
+  for (int fd : fds_) {
+    EXPECT_TRUE(IsOpen(fd));
+  }
+}
+
+TEST_F(CloseRangeTest, InvalidArguments) {
+  EXPECT_THAT(CloseRange(fds_[1], fds_[0], 0), SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(CloseRange(fds_[0], fds_[0], 1 << 10),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_TRUE(IsOpen(fds_[0]));
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
@@ -18,6 +18,7 @@
 #include <fcntl.h>
 #include <sys/eventfd.h>
 #include <sys/resource.h>
+#include <sys/syscall.h>
 #include <sys/time.h>
 #include <unistd.h>
 
@@ -32,6 +33,8 @@
 #include "absl/strings/str_split.h"
 #include "absl/strings/string_view.h"
 #include "absl/synchronization/mutex.h"
+#include "absl/types/optional.h"
+#include "test/util/cleanup.h"
 #include "test/util/file_descriptor.h"
 #include "test/util/fs_util.h"
 #include "test/util/multiprocess_util.h"
@@ -67,11 +70,13 @@ constexpr char kExit42[] = "--exec_exit_42";
 constexpr char kExecWithThread[] = "--exec_exec_with_thread";
 constexpr char kExecFromThread[] = "--exec_exec_from_thread";
 
-// Runs filename with argv and checks that the exit status is expect_status and
-// that stderr contains expect_stderr.
-void CheckOutput(const std::string& filename, const ExecveArray& argv,
-                 const ExecveArray& envv, int expect_status,
-                 const std::string& expect_stderr) {
+// Runs path with argv and checks that the exit status is expect_status and
+// that stderr contains expect_stderr. If dirfd is set, path is executed with
+// execveat(dirfd, path, ..., flags), otherwise with execve.
+void CheckExecHelper(const absl::optional<int> dirfd, const std::string& path,
+                     const ExecveArray& argv, const ExecveArray& envv,
+                     const int flags, int expect_status,
+                     const std::string& expect_stderr) {
   int pipe_fds[2];
   ASSERT_THAT(pipe2(pipe_fds, O_CLOEXEC), SyscallSucceeds());
 
@@ -109,8 +114,15 @@ void CheckOutput(const std::string& filename, const ExecveArray& argv,
     // CloexecEventfd depend on that not happening.
   };
 
-  auto kill = ASSERT_NO_ERRNO_AND_VALUE(
-      ForkAndExec(filename, argv, envv, remap_stderr, &child, &execve_errno));
+  Cleanup kill;
+  if (dirfd.has_value()) {
+    kill = ASSERT_NO_ERRNO_AND_VALUE(ForkAndExecveat(*dirfd, path, argv, envv,
+                                                     flags, remap_stderr,
+                                                     &child, &execve_errno));
+  } else {
+    kill = ASSERT_NO_ERRNO_AND_VALUE(
+        ForkAndExec(path, argv, envv, remap_stderr, &child, &execve_errno));
+  }
 
   ASSERT_EQ(0, execve_errno);
 
@@ -139,6 +151,21 @@ void CheckOutput(const std::string& filename, const ExecveArray& argv,
   EXPECT_TRUE(absl::StrContains(output, expect_stderr)) << output;
 }
 
+void CheckOutput(const std::string& filename, const ExecveArray& argv,
+                 const ExecveArray& envv, int expect_status,
+                 const std::string& expect_stderr) {
+  CheckExecHelper(absl::nullopt, filename, argv, envv, /*flags=*/0,
+                  expect_status, expect_stderr);
+}
+
+void CheckExecveat(const int dirfd, const std::string& pathname,
+                   const ExecveArray& argv, const ExecveArray& envv,
+                   const int flags, int expect_status,
+                   const std::string& expect_stderr) {
+  CheckExecHelper(absl::optional<int>(dirfd), pathname, argv, envv, flags,
+                  expect_status, expect_stderr);
+}
+
 TEST(ExecDeathTest, EmptyPath) {
   int execve_errno;
   ASSERT_NO_ERRNO_AND_VALUE(ForkAndExec("", {}, {}, nullptr, &execve_errno));
@@ -525,6 +552,177 @@ TEST(GetpriorityTest, ExecveMaintainsPriority) {
               W_EXITCODE(expected_exit_code, 0), "");
 }
 
+TEST(ExecveatTest, BasicWithFDCWD) {
+  auto cwd = ASSERT_NO_ERRNO_AND_VALUE(GetCWD());
+  std::string path = ASSERT_NO_ERRNO_AND_VALUE(
+      GetRelativePath(cwd, WorkloadPath(kBasicWorkload)));
+  CheckExecveat(AT_FDCWD, path, {path}, {}, /*flags=*/0, ArgEnvExitStatus(0, 0),
+                absl::StrCat(path, "\n"));
+}
+
+TEST(ExecveatTest, Basic) {
+  std::string absolute_path = WorkloadPath(kBasicWorkload);
+  std::string parent_dir = std::string(Dirname(absolute_path));
+  std::string base = std::string(Basename(absolute_path));
+  const FileDescriptor dirfd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(parent_dir, O_DIRECTORY));
+
+  CheckExecveat(dirfd.get(), base, {absolute_path}, {}, /*flags=*/0,
+                ArgEnvExitStatus(0, 0), absl::StrCat(absolute_path, "\n"));
+}
+
+TEST(ExecveatTest, AbsolutePathWithFDCWD) {
+  std::string path = WorkloadPath(kBasicWorkload);
+  CheckExecveat(AT_FDCWD, path, {path}, {}, /*flags=*/0, ArgEnvExitStatus(0, 0),
+                absl::StrCat(path, "\n"));
+}
+
+TEST(ExecveatTest, AbsolutePath) {
+  std::string path = WorkloadPath(kBasicWorkload);
+  // File descriptor should be ignored when an absolute path is given.
+  const int badFD = -1;
+  CheckExecveat(badFD, path, {path}, {}, /*flags=*/0, ArgEnvExitStatus(0, 0),
+                absl::StrCat(path, "\n"));
+}
+
+TEST(ExecveatTest, EmptyPathBasic) {
+  std::string path = WorkloadPath(kBasicWorkload);
+  const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open(path, O_RDONLY));
+
+  CheckExecveat(fd.get(), "", {path}, {}, AT_EMPTY_PATH, ArgEnvExitStatus(0, 0),
+                absl::StrCat(path, "\n"));
+}
+
+TEST(ExecveatTest, EmptyPathWithDirFD) {
+  std::string path = WorkloadPath(kBasicWorkload);
+  std::string parent_dir = std::string(Dirname(path));
+  const FileDescriptor dirfd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(parent_dir, O_DIRECTORY));
+
+  int execve_errno;
+  ASSERT_NO_ERRNO_AND_VALUE(ForkAndExecveat(dirfd.get(), "", {path}, {},
+                                            AT_EMPTY_PATH, /*child=*/nullptr,
+                                            &execve_errno));
+  EXPECT_EQ(execve_errno, EACCES);
+}
+
+TEST(ExecveatTest, EmptyPathWithoutEmptyPathFlag) {
+  std::string path = WorkloadPath(kBasicWorkload);
+  const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open(path, O_RDONLY));
+
+  int execve_errno;
+  ASSERT_NO_ERRNO_AND_VALUE(ForkAndExecveat(fd.get(), "", {path}, {},
+                                            /*flags=*/0, /*child=*/nullptr,
+                                            &execve_errno));
+  EXPECT_EQ(execve_errno, ENOENT);
+}
+
+TEST(ExecveatTest, RelativePathWithNonDirFD) {
+  std::string path = WorkloadPath(kBasicWorkload);
+  std::string base = std::string(Basename(path));
+  const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open(path, O_RDONLY));
+
+  int execve_errno;
+  ASSERT_NO_ERRNO_AND_VALUE(ForkAndExecveat(fd.get(), base, {path}, {},
+                                            /*flags=*/0, /*child=*/nullptr,
+                                            &execve_errno));
+  EXPECT_EQ(execve_errno, ENOTDIR);
+}
+
+TEST(ExecveatTest, BadFD) {
+  std::string path = WorkloadPath(kBasicWorkload);
+  std::string base = std::string(Basename(path));
+
+  int execve_errno;
+  ASSERT_NO_ERRNO_AND_VALUE(ForkAndExecveat(-1, base, {path}, {}, /*flags=*/0,
+                                            /*child=*/nullptr, &execve_errno));
+  EXPECT_EQ(execve_errno, EBADF);
+}
+
+TEST(ExecveatTest, InvalidFlags) {
+  std::string path = WorkloadPath(kBasicWorkload);
+
+  int execve_errno;
+  ASSERT_NO_ERRNO_AND_VALUE(ForkAndExecveat(AT_FDCWD, path, {path}, {},
+                                            /*flags=*/0xFFFF, /*child=*/nullptr,
+                                            &execve_errno));
+  EXPECT_EQ(execve_errno, EINVAL);
+}
+
+TEST(ExecveatTest, SymlinkNoFollow) {
+  std::string path = WorkloadPath(kBasicWorkload);
+  const TempPath link = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateSymlinkTo(GetAbsoluteTestTmpdir(), path));
+
+  int execve_errno;
+  ASSERT_NO_ERRNO_AND_VALUE(ForkAndExecveat(
+      AT_FDCWD, link.path(), {link.path()}, {}, AT_SYMLINK_NOFOLLOW,
+      /*child=*/nullptr, &execve_errno));
+  EXPECT_EQ(execve_errno, ELOOP);
+}
+
+TEST(ExecveatTest, SymlinkNoFollowWithNormalFile) {
+  std::string path = WorkloadPath(kBasicWorkload);
+  CheckExecveat(AT_FDCWD, path, {path}, {}, AT_SYMLINK_NOFOLLOW,
+                ArgEnvExitStatus(0, 0), absl::StrCat(path, "\n"));
+}
+
+TEST(ExecveatTest, SymlinkFollow) {
+  std::string path = WorkloadPath(kBasicWorkload);
+  const TempPath link = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateSymlinkTo(GetAbsoluteTestTmpdir(), path));
+
+  CheckExecveat(AT_FDCWD, link.path(), {link.path()}, {}, /*flags=*/0,
+                ArgEnvExitStatus(0, 0), absl::StrCat(link.path(), "\n"));
+}
+
+TEST(ExecveatTest, CloexecScript) {
+  const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(
+      Open(WorkloadPath(kExitScript), O_RDONLY | O_CLOEXEC));
+
+  // The script interpreter would need to reopen the script by path, which
+  // doesn't exist once fd is closed on exec.
+  int execve_errno;
+  ASSERT_NO_ERRNO_AND_VALUE(ForkAndExecveat(fd.get(), "", {"exit_script"}, {},
+                                            AT_EMPTY_PATH, /*child=*/nullptr,
+                                            &execve_errno));
+  EXPECT_EQ(execve_errno, ENOENT);
+}
+
+// Copies the workload named binary into a new memfd.
+PosixErrorOr<FileDescriptor> CopyToMemfd(absl::string_view binary) {
+  std::string contents;
+  ASSIGN_OR_RETURN_ERRNO(contents, GetContents(WorkloadPath(binary)));
+  int fd = syscall(__NR_memfd_create, "exec_test", 0);
+  if (fd < 0) {
+    return PosixError(errno, "memfd_create");
+  }
+  FileDescriptor memfd(fd);
+  if (WriteFd(memfd.get(), contents.data(), contents.size()) !=
+      static_cast<ssize_t>(contents.size())) {
+    return PosixError(errno, "write");
+  }
+  return std::move(memfd);
+}
+
+TEST(ExecveatTest, Memfd) {
+  const FileDescriptor memfd =
+      ASSERT_NO_ERRNO_AND_VALUE(CopyToMemfd(kBasicWorkload));
+
+  CheckExecveat(memfd.get(), "", {"memfd_workload"}, {}, AT_EMPTY_PATH,
+                ArgEnvExitStatus(0, 0), "memfd_workload\n");
+}
+
+TEST(ProcSelfExe, ChangesAcrossExecveat) {
+  const FileDescriptor memfd =
+      ASSERT_NO_ERRNO_AND_VALUE(CopyToMemfd(kProcExeWorkload));
+
+  CheckExecveat(memfd.get(), "",
+                {"memfd_workload",
+                 ASSERT_NO_ERRNO_AND_VALUE(ProcessExePath(getpid()))},
+                {}, AT_EMPTY_PATH, W_EXITCODE(0, 0), "");
+}
+
 void ExecWithThread() {
   // Used to ensure that the thread has actually started.
   absl::Mutex mu;
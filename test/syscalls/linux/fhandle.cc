@@ -0,0 +1,287 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <errno.h>
+#include <fcntl.h>
+#include <stdio.h>
+#include <string.h>
+#include <unistd.h>
+
+#include <string>
+
+#include "gtest/gtest.h"
+#include "absl/strings/str_cat.h"
+#include "test/util/capability_util.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/fs_util.h"
+#include "test/util/temp_path.h"
+#include "test/util/test_util.h"
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+constexpr char kContents[] = "foobar";
+
+// Handle is a struct file_handle with room for the largest possible handle.
+struct Handle {
+  unsigned int handle_bytes;
+  int handle_type;
+  unsigned char f_handle[MAX_HANDLE_SZ];
+
+  struct file_handle* get() {
+    return reinterpret_cast<struct file_handle*>(this);
+  }
+};
+
+bool SameHandle(const Handle& a, const Handle& b) {
+  return a.handle_type == b.handle_type && a.handle_bytes == b.handle_bytes &&
+         memcmp(a.f_handle, b.f_handle, a.handle_bytes) == 0;
+}
+
+PosixErrorOr<Handle> NameToHandle(int dirfd, const std::string& path,
+                                  int flags) {
+  Handle handle = {};
+  handle.handle_bytes = MAX_HANDLE_SZ;
+  int mount_id;
+  if (name_to_handle_at(dirfd, path.c_str(), handle.get(), &mount_id, flags) <
+      0) {
+    return PosixError(errno, absl::StrCat("name_to_handle_at ", path));
+  }
+  return handle;
+}
+
+// Returns true if the filesystem containing the test temporary directory
+// supports file handles.
+PosixErrorOr<bool> TmpdirSupportsHandles() {
+  auto handle = NameToHandle(AT_FDCWD, GetAbsoluteTestTmpdir(), 0);
+  if (!handle.ok() && handle.error().errno_value() == EOPNOTSUPP) {
+    return false;
+  }
+  RETURN_IF_ERRNO(handle);
+  return true;
+}
+
+TEST(NameToHandleAtTest, SameFile) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(TmpdirSupportsHandles()));
+
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(GetAbsoluteTestTmpdir(), kContents, 0644));
+  const TempPath other = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(GetAbsoluteTestTmpdir(), kContents, 0644));
+
+  const Handle handle =
+      ASSERT_NO_ERRNO_AND_VALUE(NameToHandle(AT_FDCWD, file.path(), 0));
+  EXPECT_GT(handle.handle_bytes, 0u);
+  EXPECT_TRUE(SameHandle(
+      handle,
+      ASSERT_NO_ERRNO_AND_VALUE(NameToHandle(AT_FDCWD, file.path(), 0))));
+  EXPECT_FALSE(SameHandle(
+      handle,
+      ASSERT_NO_ERRNO_AND_VALUE(NameToHandle(AT_FDCWD, other.path(), 0))));
+
+  // Hard links refer to the same file.
+  const std::string link_path = NewTempAbsPath();
+  ASSERT_THAT(link(file.path().c_str(), link_path.c_str()), SyscallSucceeds());
+  EXPECT_TRUE(SameHandle(
+      handle,
+      ASSERT_NO_ERRNO_AND_VALUE(NameToHandle(AT_FDCWD, link_path, 0))));
+  ASSERT_THAT(unlink(link_path.c_str()), SyscallSucceeds());
+}
+
+TEST(NameToHandleAtTest, EmptyPath) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(TmpdirSupportsHandles()));
+
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(GetAbsoluteTestTmpdir(), kContents, 0644));
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_RDONLY));
+
+  EXPECT_THAT(NameToHandle(fd.get(), "", 0),
+              PosixErrorIs(ENOENT, ::testing::_));
+  EXPECT_TRUE(SameHandle(
+      ASSERT_NO_ERRNO_AND_VALUE(NameToHandle(AT_FDCWD, file.path(), 0)),
+      ASSERT_NO_ERRNO_AND_VALUE(NameToHandle(fd.get(), "", AT_EMPTY_PATH))));
+}
+
+TEST(NameToHandleAtTest, Symlink) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(TmpdirSupportsHandles()));
+
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(GetAbsoluteTestTmpdir(), kContents, 0644));
+  const TempPath link = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateSymlinkTo(GetAbsoluteTestTmpdir(), file.path()));
+
+  const Handle file_handle =
+      ASSERT_NO_ERRNO_AND_VALUE(NameToHandle(AT_FDCWD, file.path(), 0));
+  EXPECT_FALSE(SameHandle(
+      file_handle,
+      ASSERT_NO_ERRNO_AND_VALUE(NameToHandle(AT_FDCWD, link.path(), 0))));
+  EXPECT_TRUE(SameHandle(file_handle,
+                         ASSERT_NO_ERRNO_AND_VALUE(NameToHandle(
+                             AT_FDCWD, link.path(), AT_SYMLINK_FOLLOW))));
+}
+
+TEST(NameToHandleAtTest, Overflow) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(TmpdirSupportsHandles()));
+
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(GetAbsoluteTestTmpdir(), kContents, 0644));
+  const Handle expected =
+      ASSERT_NO_ERRNO_AND_VALUE(NameToHandle(AT_FDCWD, file.path(), 0));
+
+  // The required size is returned in handle_bytes.
+  Handle handle = {};
+  int mount_id;
+  EXPECT_THAT(name_to_handle_at(AT_FDCWD, file.path().c_str(), handle.get(),
+                                &mount_id, 0),
+              SyscallFailsWithErrno(EOVERFLOW));
+  EXPECT_EQ(handle.handle_bytes, expected.handle_bytes);
+
+  EXPECT_THAT(name_to_handle_at(AT_FDCWD, file.path().c_str(), handle.get(),
+                                &mount_id, 0),
+              SyscallSucceeds());
+  EXPECT_TRUE(SameHandle(handle, expected));
+}
+
+TEST(NameToHandleAtTest, InvalidArguments) {
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(GetAbsoluteTestTmpdir(), kContents, 0644));
+
+  Handle handle = {};
+  int mount_id;
+  handle.handle_bytes = MAX_HANDLE_SZ + 1;
+  EXPECT_THAT(name_to_handle_at(AT_FDCWD, file.path().c_str(), handle.get(),
+                                &mount_id, 0),
+              SyscallFailsWithErrno(EINVAL));
+
+  handle.handle_bytes = MAX_HANDLE_SZ;
+  EXPECT_THAT(name_to_handle_at(AT_FDCWD, file.path().c_str(), handle.get(),
+                                &mount_id, AT_SYMLINK_NOFOLLOW),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(NameToHandleAtTest, Unsupported) {
+  // procfs files can't be encoded as file handles.
+  EXPECT_THAT(NameToHandle(AT_FDCWD, "/proc/self/status", 0),
+              PosixErrorIs(EOPNOTSUPP, ::testing::_));
+}
+
+TEST(OpenByHandleAtTest, Basic) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(TmpdirSupportsHandles()));
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_DAC_READ_SEARCH)));
+
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(GetAbsoluteTestTmpdir(), kContents, 0644));
+  Handle handle =
+      ASSERT_NO_ERRNO_AND_VALUE(NameToHandle(AT_FDCWD, file.path(), 0));
+  const FileDescriptor mount_fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(GetAbsoluteTestTmpdir(), O_RDONLY));
+
+  int fd;
+  ASSERT_THAT(fd = open_by_handle_at(mount_fd.get(), handle.get(), O_RDONLY),
+              SyscallSucceeds());
+  const FileDescriptor file_fd(fd);
+
+  char buf[sizeof(kContents)] = {};
+  EXPECT_THAT(ReadFd(file_fd.get(), buf, sizeof(buf) - 1),
+              SyscallSucceedsWithValue(sizeof(kContents) - 1));
+  EXPECT_STREQ(buf, kContents);
+
+  // Renaming the file doesn't invalidate the handle.
+  const std::string new_path = NewTempAbsPath();
+  ASSERT_THAT(rename(file.path().c_str(), new_path.c_str()), SyscallSucceeds());
+  ASSERT_THAT(fd = open_by_handle_at(mount_fd.get(), handle.get(), O_RDONLY),
+              SyscallSucceeds());
+  ASSERT_THAT(close(fd), SyscallSucceeds());
+  ASSERT_THAT(rename(new_path.c_str(), file.path().c_str()), SyscallSucceeds());
+}
+
+TEST(OpenByHandleAtTest, Symlink) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(TmpdirSupportsHandles()));
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_DAC_READ_SEARCH)));
+
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(GetAbsoluteTestTmpdir(), kContents, 0644));
+  const TempPath link = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateSymlinkTo(GetAbsoluteTestTmpdir(), file.path()));
+  Handle handle =
+      ASSERT_NO_ERRNO_AND_VALUE(NameToHandle(AT_FDCWD, link.path(), 0));
+  const FileDescriptor mount_fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(GetAbsoluteTestTmpdir(), O_RDONLY));
+
+  EXPECT_THAT(open_by_handle_at(mount_fd.get(), handle.get(), O_RDONLY),
+              SyscallFailsWithErrno(ELOOP));
+
+  int fd;
+  ASSERT_THAT(fd = open_by_handle_at(mount_fd.get(), handle.get(), O_PATH),
+              SyscallSucceeds());
+  const FileDescriptor link_fd(fd);
+
+  char buf[1024] = {};
+  ASSERT_THAT(readlinkat(link_fd.get(), "", buf, sizeof(buf)),
+              SyscallSucceedsWithValue(file.path().size()));
+  EXPECT_EQ(std::string(buf), file.path());
+}
+
+TEST(OpenByHandleAtTest, Stale) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(TmpdirSupportsHandles()));
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_DAC_READ_SEARCH)));
+
+  TempPath file = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(GetAbsoluteTestTmpdir(), kContents, 0644));
+  Handle handle =
+      ASSERT_NO_ERRNO_AND_VALUE(NameToHandle(AT_FDCWD, file.path(), 0));
+  const FileDescriptor mount_fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(GetAbsoluteTestTmpdir(), O_RDONLY));
+
+  // Once the file is deleted, the handle no longer refers to anything.
+  ASSERT_THAT(unlink(file.release().c_str()), SyscallSucceeds());
+  EXPECT_THAT(open_by_handle_at(mount_fd.get(), handle.get(), O_RDONLY),
+              SyscallFailsWithErrno(ESTALE));
+}
+
+TEST(OpenByHandleAtTest, InvalidHandle) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_DAC_READ_SEARCH)));
+
+  Handle handle = {};
+  EXPECT_THAT(open_by_handle_at(AT_FDCWD, handle.get(), O_RDONLY),
+              SyscallFailsWithErrno(EINVAL));
+
+  handle.handle_bytes = MAX_HANDLE_SZ + 1;
+  EXPECT_THAT(open_by_handle_at(AT_FDCWD, handle.get(), O_RDONLY),
+              SyscallFailsWithErrno(EINVAL));
+
+  EXPECT_THAT(open_by_handle_at(-1, handle.get(), O_RDONLY),
+              SyscallFailsWithErrno(EBADF));
+}
+
+TEST(OpenByHandleAtTest, NoCapability) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(TmpdirSupportsHandles()));
+
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(GetAbsoluteTestTmpdir(), kContents, 0644));
+  Handle handle =
+      ASSERT_NO_ERRNO_AND_VALUE(NameToHandle(AT_FDCWD, file.path(), 0));
+
+  ASSERT_NO_ERRNO(SetCapability(CAP_DAC_READ_SEARCH, false));
+  EXPECT_THAT(open_by_handle_at(AT_FDCWD, handle.get(), O_RDONLY),
+              SyscallFailsWithErrno(EPERM));
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
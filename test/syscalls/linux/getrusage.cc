@@ -171,6 +171,42 @@ TEST(GetrusageTest, Wait4) {
   EXPECT_GT(rusage_children.ru_maxrss, 0);
 }
 
+// Touching fresh anonymous memory causes minor faults, which are accounted to
+// the faulting process and, once it has been waited for, to its parent.
+TEST(GetrusageTest, MinorFaults) {
+  constexpr int kPages = 64;
+
+  auto touch = [] {
+    auto const mapping = MmapAnon(kPages * kPageSize, PROT_READ | PROT_WRITE,
+                                  MAP_PRIVATE)
+                             .ValueOrDie();
+    for (int i = 0; i < kPages; i++) {
+      static_cast<volatile char*>(mapping.ptr())[i * kPageSize] = 1;
+    }
+  };
+
+  struct rusage before;
+  ASSERT_THAT(getrusage(RUSAGE_SELF, &before), SyscallSucceeds());
+  touch();
+  struct rusage after;
+  ASSERT_THAT(getrusage(RUSAGE_SELF, &after), SyscallSucceeds());
+  EXPECT_GT(after.ru_minflt, before.ru_minflt);
+
+  struct rusage children_before;
+  ASSERT_THAT(getrusage(RUSAGE_CHILDREN, &children_before), SyscallSucceeds());
+  pid_t pid = fork();
+  if (pid == 0) {
+    touch();
+    _exit(0);
+  }
+  ASSERT_THAT(pid, SyscallSucceeds());
+  int status;
+  ASSERT_THAT(RetryEINTR(waitpid)(pid, &status, 0), SyscallSucceeds());
+  struct rusage children_after;
+  ASSERT_THAT(getrusage(RUSAGE_CHILDREN, &children_after), SyscallSucceeds());
+  EXPECT_GT(children_after.ru_minflt, children_before.ru_minflt);
+}
+
 }  // namespace
 
 }  // namespace testing
@@ -0,0 +1,124 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <sys/syscall.h>
+#include <unistd.h>
+
+#include "gtest/gtest.h"
+#include "test/util/capability_util.h"
+#include "test/util/multiprocess_util.h"
+#include "test/util/test_util.h"
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+// From include/linux/ioprio.h, which is not exported to userspace.
+constexpr int kIoprioClassShift = 13;
+constexpr int kIoprioClassRT = 1;
+constexpr int kIoprioClassBE = 2;
+constexpr int kIoprioClassIdle = 3;
+constexpr int kIoprioWhoProcess = 1;
+constexpr int kIoprioWhoPgrp = 2;
+constexpr int kIoprioWhoUser = 3;
+
+int IoprioValue(int cls, int data) {
+  return (cls << kIoprioClassShift) | data;
+}
+
+int IoprioSet(int which, int who, int ioprio) {
+  return syscall(SYS_ioprio_set, which, who, ioprio);
+}
+
+int IoprioGet(int which, int who) {
+  return syscall(SYS_ioprio_get, which, who);
+}
+
+TEST(IoprioTest, SetGetSelf) {
+  int const ioprio = IoprioValue(kIoprioClassBE, 7);
+  ASSERT_THAT(IoprioSet(kIoprioWhoProcess, 0, ioprio), SyscallSucceeds());
+  EXPECT_THAT(IoprioGet(kIoprioWhoProcess, 0),
+              SyscallSucceedsWithValue(ioprio));
+  EXPECT_THAT(IoprioGet(kIoprioWhoProcess, gettid()),
+              SyscallSucceedsWithValue(ioprio));
+
+  ASSERT_THAT(IoprioSet(kIoprioWhoProcess, 0, IoprioValue(kIoprioClassIdle, 0)),
+              SyscallSucceeds());
+  EXPECT_THAT(IoprioGet(kIoprioWhoProcess, 0),
+              SyscallSucceedsWithValue(IoprioValue(kIoprioClassIdle, 0)));
+}
+
+TEST(IoprioTest, PgrpAndUser) {
+  int const ioprio = IoprioValue(kIoprioClassBE, 1);
+  ASSERT_THAT(IoprioSet(kIoprioWhoProcess, 0, ioprio), SyscallSucceeds());
+
+  // The priority of a group of tasks is the highest among them, so it can't
+  // be lower than ours.
+  int const pgrp_ioprio = IoprioGet(kIoprioWhoPgrp, 0);
+  ASSERT_THAT(pgrp_ioprio, SyscallSucceeds());
+  EXPECT_LE(pgrp_ioprio, ioprio);
+  int const user_ioprio = IoprioGet(kIoprioWhoUser, getuid());
+  ASSERT_THAT(user_ioprio, SyscallSucceeds());
+  EXPECT_LE(user_ioprio, ioprio);
+}
+
+TEST(IoprioTest, InheritedOnFork) {
+  int const ioprio = IoprioValue(kIoprioClassBE, 6);
+  ASSERT_THAT(IoprioSet(kIoprioWhoProcess, 0, ioprio), SyscallSucceeds());
+  EXPECT_THAT(InForkedProcess([&] {
+                TEST_CHECK(IoprioGet(kIoprioWhoProcess, 0) == ioprio);
+              }),
+              IsPosixErrorOkAndHolds(0));
+}
+
+TEST(IoprioTest, InvalidPriority) {
+  // Data beyond the last best-effort level.
+  EXPECT_THAT(IoprioSet(kIoprioWhoProcess, 0, IoprioValue(kIoprioClassBE, 8)),
+              SyscallFailsWithErrno(EINVAL));
+  // Unknown class.
+  EXPECT_THAT(IoprioSet(kIoprioWhoProcess, 0, IoprioValue(4, 0)),
+              SyscallFailsWithErrno(EINVAL));
+  // No class, but data.
+  EXPECT_THAT(IoprioSet(kIoprioWhoProcess, 0, IoprioValue(0, 1)),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(IoprioTest, InvalidWhich) {
+  EXPECT_THAT(IoprioGet(0, 0), SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(IoprioSet(4, 0, IoprioValue(kIoprioClassBE, 0)),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(IoprioTest, NoSuchProcess) {
+  // Thread IDs are at most PID_MAX_LIMIT (4M).
+  EXPECT_THAT(IoprioGet(kIoprioWhoProcess, 1 << 23),
+              SyscallFailsWithErrno(ESRCH));
+  EXPECT_THAT(
+      IoprioSet(kIoprioWhoProcess, 1 << 23, IoprioValue(kIoprioClassBE, 0)),
+      SyscallFailsWithErrno(ESRCH));
+}
+
+TEST(IoprioTest, RealTimeRequiresCapability) {
+  if (ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN))) {
+    ASSERT_NO_ERRNO(SetCapability(CAP_SYS_ADMIN, false));
+  }
+  EXPECT_THAT(IoprioSet(kIoprioWhoProcess, 0, IoprioValue(kIoprioClassRT, 0)),
+              SyscallFailsWithErrno(EPERM));
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
@@ -0,0 +1,112 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <fcntl.h>
+#include <linux/kcmp.h>
+#include <sys/syscall.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "gtest/gtest.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/test_util.h"
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+int kcmp(pid_t pid1, pid_t pid2, int type, unsigned long idx1,
+         unsigned long idx2) {
+  return syscall(SYS_kcmp, pid1, pid2, type, idx1, idx2);
+}
+
+TEST(KcmpTest, File) {
+  SKIP_IF(!IsRunningOnGvisor() &&
+          kcmp(getpid(), getpid(), KCMP_VM, 0, 0) < 0 && errno == ENOSYS);
+
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open("/dev/null", O_RDONLY));
+  const FileDescriptor dup_fd = ASSERT_NO_ERRNO_AND_VALUE(fd.Dup());
+  const FileDescriptor other_fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open("/dev/null", O_RDONLY));
+
+  // Duplicated descriptors refer to the same open file description.
+  EXPECT_THAT(kcmp(getpid(), getpid(), KCMP_FILE, fd.get(), dup_fd.get()),
+              SyscallSucceedsWithValue(0));
+
+  // Separately opened files are ordered consistently.
+  int r;
+  ASSERT_THAT(
+      r = kcmp(getpid(), getpid(), KCMP_FILE, fd.get(), other_fd.get()),
+      SyscallSucceeds());
+  EXPECT_TRUE(r == 1 || r == 2) << r;
+  EXPECT_THAT(kcmp(getpid(), getpid(), KCMP_FILE, other_fd.get(), fd.get()),
+              SyscallSucceedsWithValue(3 - r));
+
+  EXPECT_THAT(kcmp(getpid(), getpid(), KCMP_FILE, fd.get(), -1),
+              SyscallFailsWithErrno(EBADF));
+}
+
+TEST(KcmpTest, ChildResources) {
+  SKIP_IF(!IsRunningOnGvisor() &&
+          kcmp(getpid(), getpid(), KCMP_VM, 0, 0) < 0 && errno == ENOSYS);
+
+  // Keep the child alive until it's compared.
+  int fds[2];
+  ASSERT_THAT(pipe(fds), SyscallSucceeds());
+  pid_t child = fork();
+  if (child == 0) {
+    close(fds[1]);
+    char c;
+    read(fds[0], &c, 1);
+    _exit(0);
+  }
+  ASSERT_THAT(child, SyscallSucceeds());
+  close(fds[0]);
+
+  for (int type : {KCMP_VM, KCMP_FILES, KCMP_FS, KCMP_SIGHAND}) {
+    EXPECT_THAT(kcmp(getpid(), getpid(), type, 0, 0),
+                SyscallSucceedsWithValue(0))
+        << type;
+
+    // fork(2) copies all of these resources.
+    int r;
+    ASSERT_THAT(r = kcmp(getpid(), child, type, 0, 0), SyscallSucceeds())
+        << type;
+    EXPECT_TRUE(r == 1 || r == 2) << type << ": " << r;
+  }
+
+  close(fds[1]);
+  int status;
+  ASSERT_THAT(RetryEINTR(waitpid)(child, &status, 0),
+              SyscallSucceedsWithValue(child));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0) << status;
+}
+
+TEST(KcmpTest, InvalidArguments) {
+  SKIP_IF(!IsRunningOnGvisor() &&
+          kcmp(getpid(), getpid(), KCMP_VM, 0, 0) < 0 && errno == ENOSYS);
+
+  EXPECT_THAT(kcmp(getpid(), getpid(), -1, 0, 0),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(kcmp(getpid(), -1, KCMP_VM, 0, 0),
+              SyscallFailsWithErrno(ESRCH));
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
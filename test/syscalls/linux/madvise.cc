@@ -136,6 +136,54 @@ TEST(MadviseDontneedTest, IgnoresPermissions) {
   EXPECT_THAT(madvise(m.ptr(), m.len(), MADV_DONTNEED), SyscallSucceeds());
 }
 
+#ifndef MADV_FREE
+#define MADV_FREE 8
+#endif
+
+TEST(MadviseFreeTest, PrivateAnonPageRetainedOrZeroed) {
+  auto m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  memset(m.ptr(), 8, m.len());
+  ASSERT_THAT(madvise(m.ptr(), m.len(), MADV_FREE), SyscallSucceeds());
+
+  // The kernel may discard the page's contents at any time, but must do so
+  // for the whole page.
+  char const c = m.view()[0];
+  ASSERT_TRUE(c == 8 || c == 0) << "page contains " << static_cast<int>(c);
+  ExpectAllMappingBytes(m, c);
+}
+
+TEST(MadviseFreeTest, WriteAfterFreeIsRetained) {
+  auto m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  memset(m.ptr(), 8, m.len());
+  ASSERT_THAT(madvise(m.ptr(), m.len(), MADV_FREE), SyscallSucceeds());
+  memset(m.ptr(), 9, m.len());
+  ExpectAllMappingBytes(m, 9);
+}
+
+TEST(MadviseFreeTest, SharedAnonPageFails) {
+  auto m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPageSize, PROT_READ | PROT_WRITE, MAP_SHARED));
+  memset(m.ptr(), 10, m.len());
+  EXPECT_THAT(madvise(m.ptr(), m.len(), MADV_FREE),
+              SyscallFailsWithErrno(EINVAL));
+  ExpectAllMappingBytes(m, 10);
+}
+
+TEST(MadviseFreeTest, PrivateFilePageFails) {
+  TempPath f = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileWith(
+      /* parent = */ GetAbsoluteTestTmpdir(),
+      /* content = */ std::string(kPageSize, 11), TempPath::kDefaultFileMode));
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open(f.path(), O_RDWR));
+
+  Mapping m = ASSERT_NO_ERRNO_AND_VALUE(Mmap(
+      nullptr, kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE, fd.get(), 0));
+  EXPECT_THAT(madvise(m.ptr(), m.len(), MADV_FREE),
+              SyscallFailsWithErrno(EINVAL));
+  ExpectAllMappingBytes(m, 11);
+}
+
 }  // namespace
 
 }  // namespace testing
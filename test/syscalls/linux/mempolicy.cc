@@ -13,11 +13,13 @@
 // limitations under the License.
 
 #include <errno.h>
+#include <sys/mman.h>
 #include <sys/syscall.h>
 
 #include "gtest/gtest.h"
 #include "absl/memory/memory.h"
 #include "test/util/cleanup.h"
+#include "test/util/memory_util.h"
 #include "test/util/test_util.h"
 #include "test/util/thread_util.h"
 
@@ -51,6 +53,11 @@ int set_mempolicy(int mode, uint64_t *nmask, uint64_t maxnode) {
   return syscall(__NR_set_mempolicy, mode, nmask, maxnode);
 }
 
+int mbind(void *addr, uint64_t len, int mode, uint64_t *nmask,
+          uint64_t maxnode, int flags) {
+  return syscall(__NR_mbind, addr, len, mode, nmask, maxnode, flags);
+}
+
 // Creates a cleanup object that resets the calling thread's mempolicy to the
 // system default when the calling scope ends.
 Cleanup ScopedMempolicy() {
@@ -252,6 +259,65 @@ TEST(MempolicyTest, GetMempolicyNextInterleaveNode) {
   EXPECT_EQ(0, mode);
 }
 
+TEST(MempolicyTest, MbindPolicyReportedForAddress) {
+  const Mapping m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(3 * kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  void *middle = reinterpret_cast<void *>(m.addr() + kPageSize);
+
+  uint64_t nodemask = 0x1;
+  ASSERT_THAT(mbind(middle, kPageSize, MPOL_BIND, &nodemask,
+                    sizeof(nodemask) * BITS_PER_BYTE, MPOL_MF_STRICT),
+              SyscallSucceeds());
+
+  int mode = -1;
+  nodemask = 0;
+  ASSERT_THAT(get_mempolicy(&mode, &nodemask, sizeof(nodemask) * BITS_PER_BYTE,
+                            middle, MPOL_F_ADDR),
+              SyscallSucceeds());
+  EXPECT_EQ(MPOL_BIND, mode);
+  EXPECT_EQ(0x1, nodemask);
+
+  // The rest of the mapping keeps the default policy.
+  mode = -1;
+  ASSERT_THAT(get_mempolicy(&mode, nullptr, 0, m.ptr(), MPOL_F_ADDR),
+              SyscallSucceeds());
+  EXPECT_EQ(MPOL_DEFAULT, mode);
+}
+
+TEST(MempolicyTest, MbindRejectsInvalidInputs) {
+  const Mapping m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  uint64_t nodemask = 0x1;
+
+  // Unaligned address.
+  EXPECT_THAT(mbind(reinterpret_cast<void *>(m.addr() + 1), kPageSize,
+                    MPOL_BIND, &nodemask, sizeof(nodemask) * BITS_PER_BYTE, 0),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Invalid flags.
+  EXPECT_THAT(mbind(m.ptr(), kPageSize, MPOL_BIND, &nodemask,
+                    sizeof(nodemask) * BITS_PER_BYTE, 1 << 3),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Nonexistent node.
+  nodemask = 0x2;
+  EXPECT_THAT(mbind(m.ptr(), kPageSize, MPOL_BIND, &nodemask,
+                    sizeof(nodemask) * BITS_PER_BYTE, 0),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(MempolicyTest, MbindFailsOnUnmappedRange) {
+  Mapping m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  void *addr = m.ptr();
+  ASSERT_THAT(munmap(m.release(), kPageSize), SyscallSucceeds());
+
+  uint64_t nodemask = 0x1;
+  EXPECT_THAT(mbind(addr, kPageSize, MPOL_BIND, &nodemask,
+                    sizeof(nodemask) * BITS_PER_BYTE, 0),
+              SyscallFailsWithErrno(EFAULT));
+}
+
 }  // namespace
 
 }  // namespace testing
@@ -13,18 +13,22 @@
 // limitations under the License.
 
 #include <errno.h>
+#include <fcntl.h>
 #include <stdint.h>
 #include <string.h>
 #include <sys/mman.h>
 #include <unistd.h>
 
 #include <algorithm>
+#include <string>
 #include <vector>
 
 #include "gmock/gmock.h"
 #include "gtest/gtest.h"
+#include "test/util/file_descriptor.h"
 #include "test/util/memory_util.h"
 #include "test/util/posix_error.h"
+#include "test/util/temp_path.h"
 #include "test/util/test_util.h"
 
 namespace gvisor {
@@ -50,6 +54,64 @@ TEST(MincoreTest, DirtyAnonPagesAreResident) {
   EXPECT_EQ(kTestPageCount, CountSetLSBs(vec));
 }
 
+TEST(MincoreTest, UntouchedAnonPagesAreNotResident) {
+  constexpr size_t kTestPageCount = 10;
+  auto const kTestMappingBytes = kTestPageCount * kPageSize;
+  auto m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kTestMappingBytes, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+
+  std::vector<unsigned char> vec(kTestPageCount, 0);
+  ASSERT_THAT(mincore(m.ptr(), kTestMappingBytes, vec.data()),
+              SyscallSucceeds());
+  EXPECT_EQ(0u, CountSetLSBs(vec));
+}
+
+TEST(MincoreTest, OnlyTouchedAnonPagesAreResident) {
+  constexpr size_t kTestPageCount = 10;
+  auto const kTestMappingBytes = kTestPageCount * kPageSize;
+  auto m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kTestMappingBytes, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  // Touch every other page.
+  for (size_t i = 0; i < kTestPageCount; i += 2) {
+    reinterpret_cast<char*>(m.ptr())[i * kPageSize] = 1;
+  }
+
+  std::vector<unsigned char> vec(kTestPageCount, 0);
+  ASSERT_THAT(mincore(m.ptr(), kTestMappingBytes, vec.data()),
+              SyscallSucceeds());
+  for (size_t i = 0; i < kTestPageCount; i++) {
+    EXPECT_EQ(i % 2 == 0, (vec[i] & 1) != 0) << "page " << i;
+  }
+}
+
+TEST(MincoreTest, CachedFilePagesAreResident) {
+  constexpr size_t kTestPageCount = 4;
+  auto const kTestMappingBytes = kTestPageCount * kPageSize;
+  // Writing the file's contents leaves them in the page cache.
+  TempPath f = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileWith(
+      GetAbsoluteTestTmpdir(), std::string(kTestMappingBytes, 'a'),
+      TempPath::kDefaultFileMode));
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open(f.path(), O_RDONLY));
+  Mapping m = ASSERT_NO_ERRNO_AND_VALUE(
+      Mmap(nullptr, kTestMappingBytes, PROT_READ, MAP_SHARED, fd.get(), 0));
+
+  std::vector<unsigned char> vec(kTestPageCount, 0);
+  ASSERT_THAT(mincore(m.ptr(), kTestMappingBytes, vec.data()),
+              SyscallSucceeds());
+  EXPECT_EQ(kTestPageCount, CountSetLSBs(vec));
+}
+
+TEST(MincoreTest, UnmappedRangeFails) {
+  auto m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(2 * kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  ASSERT_THAT(munmap(reinterpret_cast<void*>(m.addr() + kPageSize), kPageSize),
+              SyscallSucceeds());
+
+  std::vector<unsigned char> vec(2, 0);
+  EXPECT_THAT(mincore(m.ptr(), 2 * kPageSize, vec.data()),
+              SyscallFailsWithErrno(ENOMEM));
+}
+
 TEST(MincoreTest, UnalignedAddressFails) {
   // Map and touch two pages, then try to mincore the second half of the first
   // page + the first half of the second page. Both pages are mapped, but
@@ -18,10 +18,18 @@
 #include <unistd.h>
 #include <cerrno>
 #include <cstring>
+#include <string>
 
 #include "gmock/gmock.h"
+#include "absl/strings/ascii.h"
+#include "absl/strings/match.h"
+#include "absl/strings/numbers.h"
+#include "absl/strings/str_cat.h"
+#include "absl/strings/str_split.h"
+#include "absl/strings/string_view.h"
 #include "test/util/capability_util.h"
 #include "test/util/cleanup.h"
+#include "test/util/fs_util.h"
 #include "test/util/memory_util.h"
 #include "test/util/multiprocess_util.h"
 #include "test/util/rlimit_util.h"
@@ -113,6 +121,36 @@ TEST(MlockTest, Fork) {
       IsPosixErrorOkAndHolds(0));
 }
 
+// Returns the value of VmLck in /proc/self/status, in kB.
+PosixErrorOr<uint64_t> LockedKB() {
+  ASSIGN_OR_RETURN_ERRNO(std::string const status,
+                         GetContents("/proc/self/status"));
+  for (absl::string_view line : absl::StrSplit(status, '\n')) {
+    if (!absl::ConsumePrefix(&line, "VmLck:")) {
+      continue;
+    }
+    line = absl::StripLeadingAsciiWhitespace(line);
+    uint64_t kb;
+    if (!absl::ConsumeSuffix(&line, " kB") || !absl::SimpleAtoi(line, &kb)) {
+      return PosixError(EINVAL, absl::StrCat("bad VmLck value: ", line));
+    }
+    return kb;
+  }
+  return PosixError(ENOENT, "VmLck not found in /proc/self/status");
+}
+
+TEST(MlockTest, ProcStatusVmLck) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(CanMlock()));
+  auto const mapping = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  uint64_t const before = ASSERT_NO_ERRNO_AND_VALUE(LockedKB());
+  ASSERT_THAT(mlock(mapping.ptr(), mapping.len()), SyscallSucceeds());
+  EXPECT_THAT(LockedKB(),
+              IsPosixErrorOkAndHolds(before + kPageSize / 1024));
+  ASSERT_THAT(munlock(mapping.ptr(), mapping.len()), SyscallSucceeds());
+  EXPECT_THAT(LockedKB(), IsPosixErrorOkAndHolds(before));
+}
+
 TEST(MlockTest, RlimitMemlockZero) {
   if (ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_IPC_LOCK))) {
     ASSERT_NO_ERRNO(SetCapability(CAP_IPC_LOCK, false));
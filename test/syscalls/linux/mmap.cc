@@ -28,10 +28,13 @@
 #include <sys/types.h>
 #include <sys/wait.h>
 #include <unistd.h>
+#include <atomic>
+#include <memory>
 #include <vector>
 
 #include "gmock/gmock.h"
 #include "gtest/gtest.h"
+#include "absl/memory/memory.h"
 #include "absl/strings/escaping.h"
 #include "absl/strings/str_split.h"
 #include "test/util/cleanup.h"
@@ -41,6 +44,7 @@
 #include "test/util/multiprocess_util.h"
 #include "test/util/temp_path.h"
 #include "test/util/test_util.h"
+#include "test/util/thread_util.h"
 
 using ::testing::Gt;
 
@@ -368,6 +372,33 @@ TEST_F(MMapTest, MapFixed64) {
 }
 #endif
 
+#ifndef MAP_FIXED_NOREPLACE
+#define MAP_FIXED_NOREPLACE 0x100000
+#endif
+
+// MAP_FIXED_NOREPLACE gives us exactly the requested address if it is free.
+TEST_F(MMapTest, MapFixedNoReplace) {
+  EXPECT_THAT(Map(0x30000000, kPageSize, PROT_NONE,
+                  MAP_PRIVATE | MAP_ANONYMOUS | MAP_FIXED_NOREPLACE, -1, 0),
+              SyscallSucceedsWithValue(0x30000000));
+}
+
+// MAP_FIXED_NOREPLACE fails if any part of the requested range is mapped, and
+// leaves the existing mapping intact.
+TEST(MMapNoFixtureTest, MapFixedNoReplaceExisting) {
+  Mapping const m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(2 * kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  char* const second = reinterpret_cast<char*>(m.addr() + kPageSize);
+  *second = 'a';
+  ASSERT_THAT(munmap(m.ptr(), kPageSize), SyscallSucceeds());
+
+  EXPECT_THAT(reinterpret_cast<intptr_t>(mmap(
+                  m.ptr(), 2 * kPageSize, PROT_NONE,
+                  MAP_PRIVATE | MAP_ANONYMOUS | MAP_FIXED_NOREPLACE, -1, 0)),
+              SyscallFailsWithErrno(EEXIST));
+  EXPECT_EQ(*second, 'a');
+}
+
 // MAP_STACK allowed.
 // There isn't a good way to verify it did anything.
 TEST_F(MMapTest, MapStack) {
@@ -397,6 +428,46 @@ TEST_F(MMapTest, PrivateAndShared) {
               SyscallFailsWithErrno(EINVAL));
 }
 
+#ifndef MAP_DROPPABLE
+#define MAP_DROPPABLE 0x08
+#endif
+
+// MAP_DROPPABLE mappings must be anonymous.
+TEST_F(MMapTest, DroppableNotAnonymous) {
+  const FileDescriptor dev_zero =
+      ASSERT_NO_ERRNO_AND_VALUE(Open("/dev/zero", O_RDWR));
+  EXPECT_THAT(Map(0, kPageSize, PROT_READ, MAP_DROPPABLE, dev_zero.get(), 0),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+// The contents of MAP_DROPPABLE mappings are zeroed in the child of a fork,
+// while those of neighboring private mappings are copied.
+TEST_F(MMapTest, DroppableWipedOnFork) {
+  uintptr_t addr = Map(0, 3 * kPageSize, PROT_READ | PROT_WRITE,
+                       MAP_PRIVATE | MAP_ANONYMOUS, -1, 0);
+  ASSERT_NE(addr, reinterpret_cast<uintptr_t>(MAP_FAILED));
+  void* droppable = mmap(reinterpret_cast<void*>(addr + kPageSize), kPageSize,
+                         PROT_READ | PROT_WRITE,
+                         MAP_DROPPABLE | MAP_ANONYMOUS | MAP_FIXED, -1, 0);
+  // Skip on kernels without MAP_DROPPABLE.
+  SKIP_IF(droppable == MAP_FAILED && errno == EINVAL);
+  ASSERT_EQ(droppable, reinterpret_cast<void*>(addr + kPageSize));
+
+  char* p = reinterpret_cast<char*>(addr);
+  memset(p, 'a', 3 * kPageSize);
+
+  const auto rest = [&] {
+    TEST_CHECK(p[0] == 'a');
+    TEST_CHECK(p[kPageSize] == 0);
+    TEST_CHECK(p[2 * kPageSize - 1] == 0);
+    TEST_CHECK(p[2 * kPageSize] == 'a');
+  };
+  EXPECT_THAT(InForkedProcess(rest), IsPosixErrorOkAndHolds(0));
+
+  // The parent's copy is unaffected.
+  EXPECT_EQ(p[kPageSize], 'a');
+}
+
 TEST_F(MMapTest, FixedAlignment) {
   // Addr must be page aligned (MAP_FIXED)
   EXPECT_THAT(Map(0x30000001, kPageSize, PROT_NONE,
@@ -1092,6 +1163,84 @@ TEST_F(MMapFileTest, WriteShared) {
               EqualsMemory(std::string(kFileContents)));
 }
 
+// Writes through a shared mapping are visible to read(2) on a different file
+// description after msync, and write(2) is visible through the mapping.
+TEST_F(MMapFileTest, WriteSharedCoherentWithOtherFd) {
+  uintptr_t addr;
+  ASSERT_THAT(addr = Map(0, kPageSize, PROT_READ | PROT_WRITE, MAP_SHARED,
+                         fd_.get(), 0),
+              SyscallSucceeds());
+
+  size_t len = strlen(kFileContents);
+  memcpy(reinterpret_cast<void*>(addr), kFileContents, len);
+  ASSERT_THAT(Msync(), SyscallSucceeds());
+
+  const FileDescriptor fd2 = ASSERT_NO_ERRNO_AND_VALUE(Open(filename_, O_RDWR));
+  std::vector<char> buf(len);
+  ASSERT_THAT(pread(fd2.get(), buf.data(), buf.size(), 0),
+              SyscallSucceedsWithValue(buf.size()));
+  EXPECT_THAT(reinterpret_cast<void*>(buf.data()),
+              EqualsMemory(std::string(kFileContents)));
+
+  const std::string overwrite(len, 'x');
+  ASSERT_THAT(pwrite(fd2.get(), overwrite.data(), overwrite.size(), 0),
+              SyscallSucceedsWithValue(overwrite.size()));
+  EXPECT_THAT(reinterpret_cast<void*>(addr), EqualsMemory(overwrite));
+}
+
+// msync of part of a shared mapping writes back the dirtied pages in that
+// range, regardless of MS_INVALIDATE.
+TEST_F(MMapFileTest, MsyncPartialSharedMapping) {
+  ASSERT_THAT(ftruncate(fd_.get(), 3 * kPageSize), SyscallSucceeds());
+  uintptr_t addr;
+  ASSERT_THAT(addr = Map(0, 3 * kPageSize, PROT_READ | PROT_WRITE, MAP_SHARED,
+                         fd_.get(), 0),
+              SyscallSucceeds());
+
+  const std::string contents(kPageSize, 'm');
+  for (int i = 0; i < 3; i++) {
+    memcpy(reinterpret_cast<void*>(addr + i * kPageSize), contents.data(),
+           contents.size());
+  }
+  ASSERT_THAT(msync(reinterpret_cast<void*>(addr + kPageSize), kPageSize,
+                    MS_SYNC | MS_INVALIDATE),
+              SyscallSucceeds());
+  ASSERT_THAT(msync(reinterpret_cast<void*>(addr), 3 * kPageSize, MS_ASYNC),
+              SyscallSucceeds());
+  ASSERT_THAT(msync(reinterpret_cast<void*>(addr), 3 * kPageSize, MS_SYNC),
+              SyscallSucceeds());
+
+  const FileDescriptor fd2 = ASSERT_NO_ERRNO_AND_VALUE(Open(filename_, O_RDWR));
+  std::vector<char> buf(3 * kPageSize);
+  ASSERT_THAT(pread(fd2.get(), buf.data(), buf.size(), 0),
+              SyscallSucceedsWithValue(buf.size()));
+  for (int i = 0; i < 3; i++) {
+    EXPECT_EQ(0, memcmp(buf.data() + i * kPageSize, contents.data(),
+                        contents.size()));
+  }
+}
+
+// Writes by a child process through a shared mapping inherited across fork
+// are visible to read(2) in the parent.
+TEST_F(MMapFileTest, WriteSharedInChildVisibleToRead) {
+  uintptr_t addr;
+  ASSERT_THAT(addr = Map(0, kPageSize, PROT_READ | PROT_WRITE, MAP_SHARED,
+                         fd_.get(), 0),
+              SyscallSucceeds());
+
+  size_t len = strlen(kFileContents);
+  const auto rest = [&] {
+    memcpy(reinterpret_cast<void*>(addr), kFileContents, len);
+  };
+  EXPECT_THAT(InForkedProcess(rest), IsPosixErrorOkAndHolds(0));
+
+  std::vector<char> buf(len);
+  ASSERT_THAT(pread(fd_.get(), buf.data(), buf.size(), 0),
+              SyscallSucceedsWithValue(buf.size()));
+  EXPECT_THAT(reinterpret_cast<void*>(buf.data()),
+              EqualsMemory(std::string(kFileContents)));
+}
+
 // Write data to portion of mapped page beyond the end of the file.
 // These writes are not reflected in the file.
 TEST_F(MMapFileTest, WriteSharedBeyondEnd) {
@@ -1719,6 +1868,122 @@ TEST(MMapNoFixtureTest, MapReadOnlyAfterCreateWriteOnly) {
             static_cast<char*>(mapping.endptr()), buf.data());
 }
 
+// Threads faulting on the same pages concurrently must all see the same
+// memory.
+TEST(MMapNoFixtureTest, ConcurrentFaultsOnSamePages) {
+  constexpr int kThreads = 8;
+  // Large enough that the mapping is not populated by mmap.
+  constexpr size_t kPages = 1024;
+  auto const mapping = ASSERT_NO_ERRNO_AND_VALUE(MmapAnon(
+      kPages * kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  char* const p = static_cast<char*>(mapping.ptr());
+
+  {
+    std::vector<std::unique_ptr<ScopedThread>> threads;
+    for (int t = 0; t < kThreads; t++) {
+      threads.emplace_back(absl::make_unique<ScopedThread>([p, t] {
+        for (size_t i = 0; i < kPages; i++) {
+          p[i * kPageSize + t] = t + 1;
+        }
+      }));
+    }
+  }
+
+  for (size_t i = 0; i < kPages; i++) {
+    for (int t = 0; t < kThreads; t++) {
+      ASSERT_EQ(p[i * kPageSize + t], t + 1) << "page " << i;
+    }
+  }
+}
+
+// Threads faulting on a file mapping concurrently must all see the file's
+// contents.
+TEST(MMapNoFixtureTest, ConcurrentFileFaults) {
+  constexpr int kThreads = 8;
+  constexpr size_t kPages = 64;
+  std::string contents(kPages * kPageSize, '\0');
+  for (size_t i = 0; i < kPages; i++) {
+    contents[i * kPageSize] = static_cast<char>(i + 1);
+  }
+  auto const file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileWith(
+      GetAbsoluteTestTmpdir(), contents, TempPath::kDefaultFileMode));
+  auto const fd = ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_RDONLY));
+  auto const mapping = ASSERT_NO_ERRNO_AND_VALUE(
+      Mmap(nullptr, contents.size(), PROT_READ, MAP_SHARED, fd.get(), 0));
+  char const* const p = static_cast<char const*>(mapping.ptr());
+
+  std::atomic<int> mismatches(0);
+  {
+    std::vector<std::unique_ptr<ScopedThread>> threads;
+    for (int t = 0; t < kThreads; t++) {
+      threads.emplace_back(absl::make_unique<ScopedThread>([&, t] {
+        // Start each thread at a different page so that faults interleave.
+        for (size_t n = 0; n < kPages; n++) {
+          size_t const i = (n + t * kPages / kThreads) % kPages;
+          if (p[i * kPageSize] != static_cast<char>(i + 1)) {
+            mismatches++;
+          }
+        }
+      }));
+    }
+  }
+  EXPECT_EQ(mismatches.load(), 0);
+}
+
+constexpr size_t kHugePageSize = 2 << 20;
+
+// Maps length bytes of anonymous huge page memory. Linux only succeeds if
+// enough huge pages are reserved on the host, so callers skip on ENOMEM
+// outside of gVisor.
+PosixErrorOr<Mapping> MmapHugetlbAnon(size_t length) {
+  return MmapAnon(length, PROT_READ | PROT_WRITE, MAP_PRIVATE | MAP_HUGETLB);
+}
+
+TEST(MMapHugetlbTest, AnonymousMappingIsHugeAligned) {
+  auto const mapping = MmapHugetlbAnon(kHugePageSize);
+  SKIP_IF(!IsRunningOnGvisor() && mapping.errno_value() == ENOMEM);
+  ASSERT_NO_ERRNO(mapping);
+
+  EXPECT_EQ(mapping.ValueOrDie().addr() % kHugePageSize, 0u);
+  char* const p = static_cast<char*>(mapping.ValueOrDie().ptr());
+  p[0] = 1;
+  p[kHugePageSize - 1] = 2;
+  EXPECT_EQ(p[0], 1);
+  EXPECT_EQ(p[kHugePageSize - 1], 2);
+}
+
+TEST(MMapHugetlbTest, LengthRoundedUpToHugePage) {
+  auto const mapping = MmapHugetlbAnon(kPageSize);
+  SKIP_IF(!IsRunningOnGvisor() && mapping.errno_value() == ENOMEM);
+  ASSERT_NO_ERRNO(mapping);
+
+  // The whole huge page is accessible.
+  char* const p = static_cast<char*>(mapping.ValueOrDie().ptr());
+  p[kHugePageSize - 1] = 1;
+  EXPECT_EQ(p[kHugePageSize - 1], 1);
+}
+
+TEST(MMapHugetlbTest, UnalignedMunmapFails) {
+  auto const mapping = MmapHugetlbAnon(kHugePageSize);
+  SKIP_IF(!IsRunningOnGvisor() && mapping.errno_value() == ENOMEM);
+  ASSERT_NO_ERRNO(mapping);
+
+  char* const p = static_cast<char*>(mapping.ValueOrDie().ptr());
+  EXPECT_THAT(munmap(p + kPageSize, kPageSize), SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(mprotect(p + kPageSize, kPageSize, PROT_READ),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(MMapHugetlbTest, RegularFileFails) {
+  auto const file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  auto const fd = ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_RDWR));
+  ASSERT_THAT(ftruncate(fd.get(), kHugePageSize), SyscallSucceeds());
+
+  EXPECT_THAT(mmap(nullptr, kHugePageSize, PROT_READ,
+                   MAP_SHARED | MAP_HUGETLB, fd.get(), 0),
+              SyscallFailsWithErrno(EINVAL));
+}
+
 // Conditional on MAP_32BIT.
 #ifdef __x86_64__
 
@@ -0,0 +1,216 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <asm/ldt.h>
+#include <errno.h>
+#include <string.h>
+#include <sys/syscall.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include <cstdint>
+
+#include "gtest/gtest.h"
+#include "test/util/logging.h"
+#include "test/util/multiprocess_util.h"
+#include "test/util/test_util.h"
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+constexpr int kRead = 0;
+constexpr int kWriteOld = 1;
+constexpr int kReadDefault = 2;
+constexpr int kWrite = 0x11;
+
+// A flat, writable, 32-bit user data segment in hardware format.
+constexpr uint64_t kFlatDataDescriptor = 0x00cff3000000ffffULL;
+
+int ModifyLDT(int func, void* ptr, unsigned long bytecount) {
+  return syscall(SYS_modify_ldt, func, ptr, bytecount);
+}
+
+struct user_desc FlatDataDesc(unsigned int entry) {
+  struct user_desc desc = {};
+  desc.entry_number = entry;
+  desc.base_addr = 0;
+  desc.limit = 0xfffff;
+  desc.seg_32bit = 1;
+  desc.contents = 0;
+  desc.read_exec_only = 0;
+  desc.limit_in_pages = 1;
+  desc.seg_not_present = 0;
+  desc.useable = 0;
+  return desc;
+}
+
+// Returns true if modify_ldt writes are supported. Some platforms and hosts
+// do not support modify_ldt at all, in which case it fails with ENOSYS.
+bool LDTWriteSupported() {
+  // Write in a child to avoid mutating the test's LDT.
+  const auto status_or = InForkedProcess([] {
+    struct user_desc desc = FlatDataDesc(0);
+    int ret = ModifyLDT(kWrite, &desc, sizeof(desc));
+    _exit(ret < 0 && errno == ENOSYS ? 1 : 0);
+  });
+  TEST_CHECK(status_or.ok());
+  const int status = status_or.ValueOrDie();
+  return !(WIFEXITED(status) && WEXITSTATUS(status) == 1);
+}
+
+TEST(ModifyLDTTest, ReadEmpty) {
+  EXPECT_THAT(InForkedProcess([] {
+                char buf[LDT_ENTRY_SIZE * 4];
+                TEST_CHECK(ModifyLDT(kRead, buf, sizeof(buf)) == 0);
+              }),
+              IsPosixErrorOkAndHolds(0));
+}
+
+TEST(ModifyLDTTest, ReadDefault) {
+  char buf[256];
+  memset(buf, 0xff, sizeof(buf));
+  EXPECT_THAT(ModifyLDT(kReadDefault, buf, sizeof(buf)),
+              SyscallSucceedsWithValue(128));
+  for (int i = 0; i < 128; i++) {
+    EXPECT_EQ(buf[i], 0) << "byte " << i;
+  }
+  EXPECT_EQ(static_cast<unsigned char>(buf[128]), 0xff);
+}
+
+TEST(ModifyLDTTest, InvalidFunction) {
+  char buf[16];
+  EXPECT_THAT(ModifyLDT(3, buf, sizeof(buf)), SyscallFailsWithErrno(ENOSYS));
+}
+
+TEST(ModifyLDTTest, WriteInvalidSize) {
+  struct user_desc desc = FlatDataDesc(0);
+  EXPECT_THAT(ModifyLDT(kWrite, &desc, sizeof(desc) - 1),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(ModifyLDTTest, WriteInvalidEntry) {
+  SKIP_IF(!LDTWriteSupported());
+  struct user_desc desc = FlatDataDesc(LDT_ENTRIES);
+  EXPECT_THAT(ModifyLDT(kWrite, &desc, sizeof(desc)),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(ModifyLDTTest, WriteRead) {
+  SKIP_IF(!LDTWriteSupported());
+  EXPECT_THAT(InForkedProcess([] {
+                struct user_desc desc = FlatDataDesc(1);
+                TEST_PCHECK(ModifyLDT(kWrite, &desc, sizeof(desc)) == 0);
+
+                // The table covers entries 0 and 1; reads are zero-padded to
+                // the requested size.
+                uint64_t ents[4];
+                memset(ents, 0xff, sizeof(ents));
+                TEST_CHECK(ModifyLDT(kRead, ents, sizeof(ents)) ==
+                           sizeof(ents));
+                TEST_CHECK(ents[0] == 0);
+                TEST_CHECK(ents[1] == kFlatDataDescriptor);
+                TEST_CHECK(ents[2] == 0);
+                TEST_CHECK(ents[3] == 0);
+
+                // Short reads are truncated.
+                uint64_t first;
+                TEST_CHECK(ModifyLDT(kRead, &first, sizeof(first)) ==
+                           sizeof(first));
+                TEST_CHECK(first == 0);
+              }),
+              IsPosixErrorOkAndHolds(0));
+}
+
+TEST(ModifyLDTTest, WriteOldClearsEntry) {
+  SKIP_IF(!LDTWriteSupported());
+  EXPECT_THAT(InForkedProcess([] {
+                struct user_desc desc = FlatDataDesc(0);
+                TEST_PCHECK(ModifyLDT(kWrite, &desc, sizeof(desc)) == 0);
+
+                // In old mode, a zero base and limit clears the entry.
+                struct user_desc clear = {};
+                clear.entry_number = 0;
+                TEST_PCHECK(ModifyLDT(kWriteOld, &clear, sizeof(clear)) == 0);
+
+                uint64_t ent;
+                TEST_CHECK(ModifyLDT(kRead, &ent, sizeof(ent)) == sizeof(ent));
+                TEST_CHECK(ent == 0);
+              }),
+              IsPosixErrorOkAndHolds(0));
+}
+
+TEST(ModifyLDTTest, WriteInheritedByFork) {
+  SKIP_IF(!LDTWriteSupported());
+  EXPECT_THAT(InForkedProcess([] {
+                struct user_desc desc = FlatDataDesc(0);
+                TEST_PCHECK(ModifyLDT(kWrite, &desc, sizeof(desc)) == 0);
+
+                pid_t pid = fork();
+                if (pid == 0) {
+                  uint64_t ent;
+                  TEST_CHECK(ModifyLDT(kRead, &ent, sizeof(ent)) ==
+                             sizeof(ent));
+                  TEST_CHECK(ent == kFlatDataDescriptor);
+                  _exit(0);
+                }
+                int status;
+                TEST_PCHECK(waitpid(pid, &status, 0) == pid);
+                TEST_CHECK(WIFEXITED(status) && WEXITSTATUS(status) == 0);
+              }),
+              IsPosixErrorOkAndHolds(0));
+}
+
+#ifdef __x86_64__
+
+uint32_t ldt_test_value = 0xdeadbeef;
+
+TEST(ModifyLDTTest, LoadSegment) {
+  SKIP_IF(!LDTWriteSupported());
+  // Segment bases are only 32 bits.
+  SKIP_IF(reinterpret_cast<uintptr_t>(&ldt_test_value) > UINT32_MAX);
+  EXPECT_THAT(
+      InForkedProcess([] {
+        constexpr unsigned int kEntry = 2;
+        struct user_desc desc = {};
+        desc.entry_number = kEntry;
+        desc.base_addr =
+            static_cast<unsigned int>(reinterpret_cast<uintptr_t>(
+                &ldt_test_value));
+        desc.limit = sizeof(ldt_test_value) - 1;
+        desc.seg_32bit = 1;
+        desc.read_exec_only = 0;
+        TEST_PCHECK(ModifyLDT(kWrite, &desc, sizeof(desc)) == 0);
+
+        // Selector: index, TI=1 (LDT), RPL=3.
+        uint16_t sel = (kEntry << 3) | 0x4 | 0x3;
+        uint32_t val;
+        asm volatile(
+            "mov %1, %%gs\n"
+            "movl %%gs:0, %0\n"
+            : "=r"(val)
+            : "r"(sel)
+            : "memory");
+        TEST_CHECK(val == 0xdeadbeef);
+      }),
+      IsPosixErrorOkAndHolds(0));
+}
+
+#endif  // __x86_64__
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
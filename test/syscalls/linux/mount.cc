@@ -17,14 +17,17 @@
 #include <stdio.h>
 #include <sys/mount.h>
 #include <sys/stat.h>
+#include <sys/statfs.h>
 #include <unistd.h>
 #include <functional>
 #include <memory>
 #include <string>
+#include <utility>
 #include <vector>
 
 #include "gmock/gmock.h"
 #include "gtest/gtest.h"
+#include "absl/strings/str_cat.h"
 #include "absl/strings/string_view.h"
 #include "absl/time/time.h"
 #include "test/util/capability_util.h"
@@ -295,6 +298,94 @@ TEST(MountTest, MountNoExec) {
   EXPECT_EQ(execve_errno, EACCES);
 }
 
+// Writes to the file at path until it fails, and returns the number of bytes
+// written and the errno of the failure.
+PosixErrorOr<std::pair<size_t, int>> FillFile(std::string const& path,
+                                             size_t max) {
+  ASSIGN_OR_RETURN_ERRNO(auto fd, Open(path, O_WRONLY | O_CREAT | O_APPEND,
+                                       0666));
+  std::vector<char> buf(kPageSize, 'a');
+  size_t total = 0;
+  while (total < max) {
+    int ret = write(fd.get(), buf.data(), buf.size());
+    if (ret < 0) {
+      return std::make_pair(total, errno);
+    }
+    total += ret;
+  }
+  return std::make_pair(total, 0);
+}
+
+TEST(MountTest, MountTmpfsSizeLimit) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  constexpr int kPages = 16;
+  auto const dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const mount = ASSERT_NO_ERRNO_AND_VALUE(Mount(
+      "", dir.path(), "tmpfs", 0, absl::StrCat("size=", kPages * kPageSize),
+      0));
+
+  struct statfs st;
+  ASSERT_THAT(statfs(dir.path().c_str(), &st), SyscallSucceeds());
+  EXPECT_EQ(st.f_blocks, kPages);
+  EXPECT_EQ(st.f_bfree, kPages);
+
+  auto const result = ASSERT_NO_ERRNO_AND_VALUE(
+      FillFile(JoinPath(dir.path(), "foo"), 2 * kPages * kPageSize));
+  EXPECT_EQ(result.second, ENOSPC);
+  EXPECT_LE(result.first, kPages * kPageSize);
+
+  ASSERT_THAT(statfs(dir.path().c_str(), &st), SyscallSucceeds());
+  EXPECT_EQ(st.f_bfree, kPages - result.first / kPageSize);
+}
+
+TEST(MountTest, RemountTmpfsSize) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  constexpr int kPages = 16;
+  auto const dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const mount = ASSERT_NO_ERRNO_AND_VALUE(Mount(
+      "", dir.path(), "tmpfs", 0, absl::StrCat("size=", kPages * kPageSize),
+      0));
+
+  std::string const file = JoinPath(dir.path(), "foo");
+  auto result =
+      ASSERT_NO_ERRNO_AND_VALUE(FillFile(file, 2 * kPages * kPageSize));
+  EXPECT_EQ(result.second, ENOSPC);
+
+  // The limit can't be reduced below the memory in use.
+  std::string const small = absl::StrCat("size=", kPageSize);
+  EXPECT_THAT(
+      mount("", dir.path().c_str(), "tmpfs", MS_REMOUNT, small.c_str()),
+      SyscallFailsWithErrno(EINVAL));
+
+  // Growing the limit allows further writes.
+  std::string const big = absl::StrCat("size=", 2 * kPages * kPageSize);
+  ASSERT_THAT(mount("", dir.path().c_str(), "tmpfs", MS_REMOUNT, big.c_str()),
+              SyscallSucceeds());
+
+  struct statfs st;
+  ASSERT_THAT(statfs(dir.path().c_str(), &st), SyscallSucceeds());
+  EXPECT_EQ(st.f_blocks, 2 * kPages);
+
+  result = ASSERT_NO_ERRNO_AND_VALUE(FillFile(file, kPages * kPageSize));
+  EXPECT_EQ(result.second, 0);
+  EXPECT_EQ(result.first, kPages * kPageSize);
+}
+
+TEST(MountTest, RemountTmpfsCannotLimitUnlimited) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  auto const dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const mount =
+      ASSERT_NO_ERRNO_AND_VALUE(Mount("", dir.path(), "tmpfs", 0, "", 0));
+
+  std::string const data = absl::StrCat("size=", kPageSize);
+  EXPECT_THAT(
+      mount("", dir.path().c_str(), "tmpfs", MS_REMOUNT, data.c_str()),
+      SyscallFailsWithErrno(EINVAL));
+}
+
 TEST(MountTest, RenameRemoveMountPoint) {
   SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
 
@@ -428,6 +428,102 @@ TEST(MremapTest, MustMove_Copy) {
   EXPECT_THAT(InForkedProcess(rest), IsPosixErrorOkAndHolds(0));
 }
 
+#ifndef MREMAP_DONTUNMAP
+#define MREMAP_DONTUNMAP 4
+#endif
+
+TEST(MremapTest, DontUnmap_RequiresMayMove) {
+  Mapping const m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  EXPECT_THAT(Mremap(m.ptr(), kPageSize, kPageSize, MREMAP_DONTUNMAP, nullptr),
+              PosixErrorIs(EINVAL, _));
+}
+
+TEST(MremapTest, DontUnmap_CannotResize) {
+  Mapping const m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(2 * kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  EXPECT_THAT(Mremap(m.ptr(), kPageSize, 2 * kPageSize,
+                     MREMAP_MAYMOVE | MREMAP_DONTUNMAP, nullptr),
+              PosixErrorIs(EINVAL, _));
+}
+
+TEST(MremapTest, DontUnmap_PrivateAnon) {
+  Mapping const m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  memset(m.ptr(), 'a', kPageSize);
+
+  // Remainder of this test executes in a subprocess to ensure that the moved
+  // mapping can be unmapped without racing with other threads.
+  const auto rest = [&] {
+    void* ptr = mremap(m.ptr(), kPageSize, kPageSize,
+                       MREMAP_MAYMOVE | MREMAP_DONTUNMAP, nullptr);
+    TEST_PCHECK_MSG(ptr != MAP_FAILED, "mremap failed");
+    MaybeSave();
+    TEST_CHECK(ptr != m.ptr());
+
+    // The data moved to the new mapping.
+    char* const dst = reinterpret_cast<char*>(ptr);
+    TEST_CHECK(dst[0] == 'a' && dst[kPageSize - 1] == 'a');
+
+    // The old mapping remains, but its pages are gone.
+    TEST_CHECK(IsMapped(m.addr()));
+    char* const src = reinterpret_cast<char*>(m.ptr());
+    TEST_CHECK(src[0] == 0 && src[kPageSize - 1] == 0);
+
+    // Both mappings are independent.
+    src[0] = 'b';
+    TEST_CHECK(dst[0] == 'a');
+  };
+  EXPECT_THAT(InForkedProcess(rest), IsPosixErrorOkAndHolds(0));
+}
+
+TEST(MremapTest, DontUnmap_Fixed) {
+  Mapping const src = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  Mapping const dst =
+      ASSERT_NO_ERRNO_AND_VALUE(MmapAnon(kPageSize, PROT_NONE, MAP_PRIVATE));
+  memset(src.ptr(), 'a', kPageSize);
+
+  const auto rest = [&] {
+    void* ptr =
+        mremap(src.ptr(), kPageSize, kPageSize,
+               MREMAP_MAYMOVE | MREMAP_FIXED | MREMAP_DONTUNMAP, dst.ptr());
+    TEST_PCHECK_MSG(ptr != MAP_FAILED, "mremap failed");
+    MaybeSave();
+    TEST_CHECK(ptr == dst.ptr());
+    TEST_CHECK(*reinterpret_cast<char*>(dst.ptr()) == 'a');
+    TEST_CHECK(IsMapped(src.addr()));
+    TEST_CHECK(*reinterpret_cast<char*>(src.ptr()) == 0);
+  };
+  EXPECT_THAT(InForkedProcess(rest), IsPosixErrorOkAndHolds(0));
+}
+
+TEST(MremapTest, DontUnmap_SharedFile) {
+  TempPath const file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  FileDescriptor const fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_RDWR));
+  ASSERT_THAT(ftruncate(fd.get(), kPageSize), SyscallSucceeds());
+  Mapping const m = ASSERT_NO_ERRNO_AND_VALUE(Mmap(
+      nullptr, kPageSize, PROT_READ | PROT_WRITE, MAP_SHARED, fd.get(), 0));
+  memset(m.ptr(), 'a', kPageSize);
+
+  const auto rest = [&] {
+    void* ptr = mremap(m.ptr(), kPageSize, kPageSize,
+                       MREMAP_MAYMOVE | MREMAP_DONTUNMAP, nullptr);
+    TEST_PCHECK_MSG(ptr != MAP_FAILED, "mremap failed");
+    MaybeSave();
+
+    // Both mappings continue to map the file.
+    char* const src = reinterpret_cast<char*>(m.ptr());
+    char* const dst = reinterpret_cast<char*>(ptr);
+    TEST_CHECK(src[0] == 'a');
+    TEST_CHECK(dst[0] == 'a');
+    dst[0] = 'b';
+    TEST_CHECK(src[0] == 'b');
+  };
+  EXPECT_THAT(InForkedProcess(rest), IsPosixErrorOkAndHolds(0));
+}
+
 void ExpectAllBytesAre(absl::string_view v, char c) {
   for (size_t i = 0; i < v.size(); i++) {
     ASSERT_EQ(v[i], c) << "at offset " << i;
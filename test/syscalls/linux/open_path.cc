@@ -0,0 +1,221 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <errno.h>
+#include <fcntl.h>
+#include <sys/ioctl.h>
+#include <sys/mman.h>
+#include <sys/stat.h>
+#include <sys/syscall.h>
+#include <unistd.h>
+
+#include <string>
+
+#include "gtest/gtest.h"
+#include "absl/strings/str_cat.h"
+#include "test/util/capability_util.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/fs_util.h"
+#include "test/util/multiprocess_util.h"
+#include "test/util/temp_path.h"
+#include "test/util/test_util.h"
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+constexpr char kContents[] = "foobar";
+
+TEST(OpenPathTest, NoIO) {
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(GetAbsoluteTestTmpdir(), kContents, 0644));
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_PATH | O_RDWR));
+
+  char buf[sizeof(kContents)];
+  EXPECT_THAT(read(fd.get(), buf, sizeof(buf)), SyscallFailsWithErrno(EBADF));
+  EXPECT_THAT(write(fd.get(), buf, sizeof(buf)),
+              SyscallFailsWithErrno(EBADF));
+  EXPECT_THAT(lseek(fd.get(), 0, SEEK_SET), SyscallFailsWithErrno(EBADF));
+  EXPECT_THAT(ftruncate(fd.get(), 0), SyscallFailsWithErrno(EBADF));
+  EXPECT_THAT(fsync(fd.get()), SyscallFailsWithErrno(EBADF));
+  EXPECT_THAT(fchmod(fd.get(), 0600), SyscallFailsWithErrno(EBADF));
+
+  int n;
+  EXPECT_THAT(ioctl(fd.get(), FIONREAD, &n), SyscallFailsWithErrno(EBADF));
+  EXPECT_THAT(reinterpret_cast<intptr_t>(mmap(nullptr, kPageSize, PROT_READ,
+                                               MAP_PRIVATE, fd.get(), 0)),
+              SyscallFailsWithErrno(EBADF));
+}
+
+TEST(OpenPathTest, Fstat) {
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(GetAbsoluteTestTmpdir(), kContents, 0644));
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_PATH));
+
+  struct stat path_st;
+  ASSERT_THAT(stat(file.path().c_str(), &path_st), SyscallSucceeds());
+
+  struct stat st;
+  ASSERT_THAT(fstat(fd.get(), &st), SyscallSucceeds());
+  EXPECT_EQ(st.st_ino, path_st.st_ino);
+  EXPECT_EQ(st.st_size, static_cast<off_t>(sizeof(kContents) - 1));
+
+  ASSERT_THAT(fstatat(fd.get(), "", &st, AT_EMPTY_PATH), SyscallSucceeds());
+  EXPECT_EQ(st.st_ino, path_st.st_ino);
+}
+
+TEST(OpenPathTest, NoPermissionsRequired) {
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(GetAbsoluteTestTmpdir(), kContents, 0));
+  EXPECT_NO_ERRNO(Open(file.path(), O_PATH));
+}
+
+TEST(OpenPathTest, CreateIgnored) {
+  const std::string path = NewTempAbsPath();
+  EXPECT_THAT(open(path.c_str(), O_PATH | O_CREAT, 0644),
+              SyscallFailsWithErrno(ENOENT));
+}
+
+TEST(OpenPathTest, Directory) {
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(GetAbsoluteTestTmpdir(), kContents, 0644));
+  EXPECT_THAT(open(file.path().c_str(), O_PATH | O_DIRECTORY),
+              SyscallFailsWithErrno(ENOTDIR));
+
+  const TempPath dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(dir.path(), O_PATH | O_DIRECTORY));
+
+  char buf[1024];
+  EXPECT_THAT(syscall(SYS_getdents64, fd.get(), buf, sizeof(buf)),
+              SyscallFailsWithErrno(EBADF));
+}
+
+TEST(OpenPathTest, Fcntl) {
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(GetAbsoluteTestTmpdir(), kContents, 0644));
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_PATH | O_CLOEXEC));
+
+  EXPECT_THAT(fcntl(fd.get(), F_GETFD), SyscallSucceedsWithValue(FD_CLOEXEC));
+  int flags;
+  ASSERT_THAT(flags = fcntl(fd.get(), F_GETFL), SyscallSucceeds());
+  EXPECT_EQ(flags & O_PATH, O_PATH);
+  EXPECT_EQ(flags & O_ACCMODE, O_RDONLY);
+  EXPECT_THAT(fcntl(fd.get(), F_SETFL, O_NONBLOCK),
+              SyscallFailsWithErrno(EBADF));
+
+  const FileDescriptor dup_fd = ASSERT_NO_ERRNO_AND_VALUE(fd.Dup());
+  ASSERT_THAT(flags = fcntl(dup_fd.get(), F_GETFL), SyscallSucceeds());
+  EXPECT_EQ(flags & O_PATH, O_PATH);
+}
+
+TEST(OpenPathTest, Openat) {
+  const TempPath dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(dir.path(), kContents, 0644));
+  const FileDescriptor dirfd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(dir.path(), O_PATH));
+
+  const std::string name = std::string(Basename(file.path()));
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(OpenAt(dirfd.get(), name, O_RDONLY));
+  char buf[sizeof(kContents)] = {};
+  EXPECT_THAT(ReadFd(fd.get(), buf, sizeof(buf) - 1),
+              SyscallSucceedsWithValue(sizeof(kContents) - 1));
+  EXPECT_STREQ(buf, kContents);
+
+  struct stat st;
+  EXPECT_THAT(fstatat(dirfd.get(), name.c_str(), &st, 0), SyscallSucceeds());
+}
+
+TEST(OpenPathTest, Symlink) {
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(GetAbsoluteTestTmpdir(), kContents, 0644));
+  const TempPath link = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateSymlinkTo(GetAbsoluteTestTmpdir(), file.path()));
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(link.path(), O_PATH | O_NOFOLLOW));
+
+  struct stat st;
+  ASSERT_THAT(fstat(fd.get(), &st), SyscallSucceeds());
+  EXPECT_TRUE(S_ISLNK(st.st_mode));
+
+  char buf[1024] = {};
+  ASSERT_THAT(readlinkat(fd.get(), "", buf, sizeof(buf)),
+              SyscallSucceedsWithValue(file.path().size()));
+  EXPECT_EQ(std::string(buf), file.path());
+}
+
+TEST(OpenPathTest, ReadlinkatEmptyPathNotSymlink) {
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(GetAbsoluteTestTmpdir(), kContents, 0644));
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_PATH));
+
+  char buf[1024];
+  EXPECT_THAT(readlinkat(fd.get(), "", buf, sizeof(buf)),
+              SyscallFailsWithErrno(ENOENT));
+  EXPECT_THAT(readlinkat(AT_FDCWD, "", buf, sizeof(buf)),
+              SyscallFailsWithErrno(ENOENT));
+}
+
+TEST(OpenPathTest, ReopenViaProc) {
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(GetAbsoluteTestTmpdir(), kContents, 0644));
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_PATH));
+
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(
+                GetContents(absl::StrCat("/proc/self/fd/", fd.get()))),
+            kContents);
+}
+
+TEST(OpenPathTest, Fchdir) {
+  const TempPath dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(dir.path(), O_PATH | O_DIRECTORY));
+
+  // Change directory in a subprocess, so as not to affect other tests.
+  const auto rest = [&] {
+    TEST_PCHECK(fchdir(fd.get()) == 0);
+    char buf[1024];
+    TEST_PCHECK(getcwd(buf, sizeof(buf)) != nullptr);
+    TEST_CHECK(dir.path() == buf);
+  };
+  EXPECT_THAT(InForkedProcess(rest), IsPosixErrorOkAndHolds(0));
+}
+
+TEST(OpenPathTest, Linkat) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_DAC_READ_SEARCH)));
+
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(GetAbsoluteTestTmpdir(), kContents, 0644));
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_PATH));
+
+  const std::string new_path = NewTempAbsPath();
+  ASSERT_THAT(linkat(fd.get(), "", AT_FDCWD, new_path.c_str(), AT_EMPTY_PATH),
+              SyscallSucceeds());
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetContents(new_path)), kContents);
+  EXPECT_THAT(unlink(new_path.c_str()), SyscallSucceeds());
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
@@ -0,0 +1,290 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <errno.h>
+#include <fcntl.h>
+#include <stdint.h>
+#include <sys/stat.h>
+#include <sys/syscall.h>
+#include <unistd.h>
+
+#include <string>
+#include <utility>
+#include <vector>
+
+#include "gtest/gtest.h"
+#include "absl/strings/str_cat.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/fs_util.h"
+#include "test/util/temp_path.h"
+#include "test/util/test_util.h"
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+#ifndef SYS_openat2
+#define SYS_openat2 437
+#endif
+
+// struct open_how, from linux/openat2.h.
+struct OpenHow {
+  uint64_t flags;
+  uint64_t mode;
+  uint64_t resolve;
+};
+
+constexpr uint64_t kResolveNoXdev = 0x01;
+constexpr uint64_t kResolveNoMagicLinks = 0x02;
+constexpr uint64_t kResolveNoSymlinks = 0x04;
+constexpr uint64_t kResolveBeneath = 0x08;
+constexpr uint64_t kResolveInRoot = 0x10;
+constexpr uint64_t kResolveCached = 0x20;
+
+int Openat2(int dirfd, const std::string& path, const OpenHow& how) {
+  return syscall(SYS_openat2, dirfd, path.c_str(), &how, sizeof(how));
+}
+
+PosixErrorOr<FileDescriptor> Openat2FD(int dirfd, const std::string& path,
+                                       const OpenHow& how) {
+  int fd = Openat2(dirfd, path, how);
+  if (fd < 0) {
+    return PosixError(errno, absl::StrCat("openat2 ", path));
+  }
+  return FileDescriptor(fd);
+}
+
+// Openat2Test creates a directory for resolution to start from, containing:
+//
+//   file
+//   subdir/
+//   relative_link -> subdir/../file
+//   escape_link -> ../escape
+//   absolute_link -> /file
+class Openat2Test : public ::testing::Test {
+ protected:
+  void SetUp() override {
+    // Skip on hosts that predate openat2.
+    OpenHow how = {};
+    int fd = Openat2(AT_FDCWD, "/", how);
+    SKIP_IF(fd < 0 && errno == ENOSYS);
+    ASSERT_THAT(fd, SyscallSucceeds());
+    ASSERT_THAT(close(fd), SyscallSucceeds());
+
+    dir_ = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+    ASSERT_NO_ERRNO(CreateWithContents(JoinPath(dir_.path(), "file"), "foo"));
+    ASSERT_NO_ERRNO(Mkdir(JoinPath(dir_.path(), "subdir")));
+    for (const auto& link : std::vector<std::pair<std::string, std::string>>{
+             {"relative_link", "subdir/../file"},
+             {"escape_link", "../escape"},
+             {"absolute_link", "/file"},
+         }) {
+      ASSERT_THAT(symlink(link.second.c_str(),
+                          JoinPath(dir_.path(), link.first).c_str()),
+                  SyscallSucceeds());
+    }
+    dirfd_ = ASSERT_NO_ERRNO_AND_VALUE(Open(dir_.path(), O_RDONLY));
+  }
+
+  TempPath dir_;
+  FileDescriptor dirfd_;
+};
+
+TEST_F(Openat2Test, Basic) {
+  OpenHow how = {};
+  how.flags = O_RDONLY;
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Openat2FD(dirfd_.get(), "file", how));
+
+  char buf[4] = {};
+  EXPECT_THAT(ReadFd(fd.get(), buf, 3), SyscallSucceedsWithValue(3));
+  EXPECT_STREQ(buf, "foo");
+}
+
+TEST_F(Openat2Test, Create) {
+  OpenHow how = {};
+  how.flags = O_CREAT | O_EXCL | O_WRONLY;
+  how.mode = 0640;
+  ASSERT_NO_ERRNO(Openat2FD(dirfd_.get(), "created", how));
+
+  struct stat st;
+  ASSERT_THAT(stat(JoinPath(dir_.path(), "created").c_str(), &st),
+              SyscallSucceeds());
+  EXPECT_TRUE(S_ISREG(st.st_mode));
+}
+
+TEST_F(Openat2Test, Size) {
+  OpenHow how = {};
+  for (size_t size : {size_t{0}, sizeof(how) - 1}) {
+    EXPECT_THAT(syscall(SYS_openat2, dirfd_.get(), "file", &how, size),
+                SyscallFailsWithErrno(EINVAL));
+  }
+
+  std::vector<char> buf(kPageSize + 1);
+  EXPECT_THAT(
+      syscall(SYS_openat2, dirfd_.get(), "file", buf.data(), buf.size()),
+      SyscallFailsWithErrno(E2BIG));
+
+  // Trailing bytes beyond struct open_how must be zero.
+  struct {
+    OpenHow how;
+    uint64_t extension;
+  } extended = {};
+  int fd;
+  ASSERT_THAT(fd = syscall(SYS_openat2, dirfd_.get(), "file", &extended,
+                           sizeof(extended)),
+              SyscallSucceeds());
+  ASSERT_THAT(close(fd), SyscallSucceeds());
+
+  extended.extension = 1;
+  EXPECT_THAT(syscall(SYS_openat2, dirfd_.get(), "file", &extended,
+                      sizeof(extended)),
+              SyscallFailsWithErrno(E2BIG));
+}
+
+TEST_F(Openat2Test, InvalidArguments) {
+  OpenHow how = {};
+
+  // Unknown flags.
+  how.flags = 1ULL << 40;
+  EXPECT_THAT(Openat2(dirfd_.get(), "file", how),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Unknown resolve flags.
+  how = {};
+  how.resolve = 1ULL << 20;
+  EXPECT_THAT(Openat2(dirfd_.get(), "file", how),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Mode without O_CREAT.
+  how = {};
+  how.mode = 0644;
+  EXPECT_THAT(Openat2(dirfd_.get(), "file", how),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Invalid mode with O_CREAT.
+  how = {};
+  how.flags = O_CREAT;
+  how.mode = 010000;
+  EXPECT_THAT(Openat2(dirfd_.get(), "file", how),
+              SyscallFailsWithErrno(EINVAL));
+
+  // RESOLVE_BENEATH and RESOLVE_IN_ROOT are mutually exclusive.
+  how = {};
+  how.resolve = kResolveBeneath | kResolveInRoot;
+  EXPECT_THAT(Openat2(dirfd_.get(), "file", how),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST_F(Openat2Test, NoSymlinks) {
+  OpenHow how = {};
+  how.resolve = kResolveNoSymlinks;
+  EXPECT_NO_ERRNO(Openat2FD(dirfd_.get(), "file", how));
+  EXPECT_THAT(Openat2(dirfd_.get(), "relative_link", how),
+              SyscallFailsWithErrno(ELOOP));
+
+  // The symlink itself can still be opened with O_PATH | O_NOFOLLOW.
+  how.flags = O_PATH | O_NOFOLLOW;
+  EXPECT_NO_ERRNO(Openat2FD(dirfd_.get(), "relative_link", how));
+}
+
+TEST_F(Openat2Test, NoMagicLinks) {
+  const std::string magic_link = absl::StrCat("/proc/self/fd/", dirfd_.get());
+
+  OpenHow how = {};
+  EXPECT_NO_ERRNO(Openat2FD(AT_FDCWD, magic_link, how));
+
+  how.resolve = kResolveNoMagicLinks;
+  EXPECT_THAT(Openat2(AT_FDCWD, magic_link, how),
+              SyscallFailsWithErrno(ELOOP));
+
+  // Regular symlinks can still be followed.
+  EXPECT_NO_ERRNO(Openat2FD(dirfd_.get(), "relative_link", how));
+}
+
+TEST_F(Openat2Test, Beneath) {
+  OpenHow how = {};
+  how.resolve = kResolveBeneath;
+  EXPECT_NO_ERRNO(Openat2FD(dirfd_.get(), "subdir/../file", how));
+  EXPECT_NO_ERRNO(Openat2FD(dirfd_.get(), "relative_link", how));
+
+  for (const std::string& path : std::vector<std::string>{
+           "..", "../file", "subdir/../../file", "escape_link",
+           "absolute_link", dir_.path()}) {
+    EXPECT_THAT(Openat2(dirfd_.get(), path, how),
+                SyscallFailsWithErrno(EXDEV))
+        << path;
+  }
+}
+
+TEST_F(Openat2Test, InRoot) {
+  OpenHow how = {};
+  how.resolve = kResolveInRoot;
+
+  // All of these resolve to the file in the root.
+  for (const std::string& path : std::vector<std::string>{
+           "file", "/file", "../file", "subdir/../../file", "absolute_link",
+           "relative_link"}) {
+    const FileDescriptor fd =
+        ASSERT_NO_ERRNO_AND_VALUE(Openat2FD(dirfd_.get(), path, how));
+    char buf[4] = {};
+    EXPECT_THAT(ReadFd(fd.get(), buf, 3), SyscallSucceedsWithValue(3));
+    EXPECT_STREQ(buf, "foo") << path;
+  }
+
+  // escape_link resolves to "/escape" within the root, which doesn't exist.
+  EXPECT_THAT(Openat2(dirfd_.get(), "escape_link", how),
+              SyscallFailsWithErrno(ENOENT));
+}
+
+TEST_F(Openat2Test, ScopedMagicLinks) {
+  const FileDescriptor proc_fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open("/proc/self/fd", O_RDONLY | O_DIRECTORY));
+
+  // Magic links may point anywhere, so they can't be followed by scoped
+  // lookups.
+  OpenHow how = {};
+  for (uint64_t resolve : {kResolveBeneath, kResolveInRoot}) {
+    how.resolve = resolve;
+    EXPECT_THAT(Openat2(proc_fd.get(), absl::StrCat(dirfd_.get()), how),
+                SyscallFailsWithErrno(EXDEV));
+  }
+}
+
+TEST_F(Openat2Test, NoXdev) {
+  OpenHow how = {};
+  how.resolve = kResolveNoXdev;
+  EXPECT_NO_ERRNO(Openat2FD(dirfd_.get(), "file", how));
+
+  // /proc is always a different mount from /.
+  const FileDescriptor root =
+      ASSERT_NO_ERRNO_AND_VALUE(Open("/", O_RDONLY | O_DIRECTORY));
+  EXPECT_THAT(Openat2(root.get(), "proc/self/status", how),
+              SyscallFailsWithErrno(EXDEV));
+}
+
+TEST_F(Openat2Test, CachedCreate) {
+  OpenHow how = {};
+  how.flags = O_CREAT | O_WRONLY;
+  how.mode = 0644;
+  how.resolve = kResolveCached;
+  EXPECT_THAT(Openat2(dirfd_.get(), "created", how),
+              SyscallFailsWithErrno(EAGAIN));
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
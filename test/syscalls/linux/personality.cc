@@ -0,0 +1,118 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <signal.h>
+#include <sys/personality.h>
+#include <sys/ptrace.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include <string>
+
+#include "gtest/gtest.h"
+#include "absl/strings/str_cat.h"
+#include "test/util/fs_util.h"
+#include "test/util/logging.h"
+#include "test/util/multiprocess_util.h"
+#include "test/util/posix_error.h"
+#include "test/util/test_util.h"
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+constexpr unsigned long kQuery = 0xffffffff;
+
+TEST(PersonalityTest, Query) {
+  int persona;
+  ASSERT_THAT(persona = personality(kQuery), SyscallSucceeds());
+  EXPECT_THAT(personality(kQuery), SyscallSucceedsWithValue(persona));
+}
+
+TEST(PersonalityTest, SetReturnsOld) {
+  EXPECT_THAT(InForkedProcess([] {
+                const int old = personality(kQuery);
+                TEST_PCHECK(old >= 0);
+                TEST_CHECK(personality(PER_LINUX | ADDR_NO_RANDOMIZE) == old);
+                TEST_CHECK(personality(kQuery) ==
+                           (PER_LINUX | ADDR_NO_RANDOMIZE));
+                TEST_CHECK(personality(old) ==
+                           (PER_LINUX | ADDR_NO_RANDOMIZE));
+                TEST_CHECK(personality(kQuery) == old);
+              }),
+              IsPosixErrorOkAndHolds(0));
+}
+
+TEST(PersonalityTest, InheritedByFork) {
+  EXPECT_THAT(InForkedProcess([] {
+                TEST_PCHECK(personality(PER_LINUX | ADDR_NO_RANDOMIZE) >= 0);
+                pid_t pid = fork();
+                if (pid == 0) {
+                  _exit(personality(kQuery) == (PER_LINUX | ADDR_NO_RANDOMIZE)
+                            ? 0
+                            : 1);
+                }
+                int status;
+                TEST_PCHECK(waitpid(pid, &status, 0) == pid);
+                TEST_CHECK(WIFEXITED(status) && WEXITSTATUS(status) == 0);
+              }),
+              IsPosixErrorOkAndHolds(0));
+}
+
+// Execs this binary with the given personality in a traced child, and returns
+// the contents of its /proc/[pid]/maps as of the post-exec ptrace stop.
+PosixErrorOr<std::string> MapsAfterExec(unsigned long persona) {
+  char* const argv[] = {const_cast<char*>("/proc/self/exe"), nullptr};
+  char* const envp[] = {nullptr};
+
+  pid_t pid = fork();
+  if (pid == 0) {
+    TEST_PCHECK(personality(persona) >= 0);
+    TEST_PCHECK(ptrace(PTRACE_TRACEME, 0, 0, 0) == 0);
+    execve(argv[0], argv, envp);
+    TEST_PCHECK_MSG(false, "execve failed");
+  }
+  if (pid < 0) {
+    return PosixError(errno, "fork failed");
+  }
+
+  int status;
+  if (waitpid(pid, &status, 0) != pid) {
+    return PosixError(errno, "waitpid failed");
+  }
+  if (!WIFSTOPPED(status) || WSTOPSIG(status) != SIGTRAP) {
+    return PosixError(EINVAL, absl::StrCat("unexpected status ", status));
+  }
+
+  auto maps = GetContents(absl::StrCat("/proc/", pid, "/maps"));
+
+  kill(pid, SIGKILL);
+  waitpid(pid, &status, 0);
+  return maps;
+}
+
+TEST(PersonalityTest, AddrNoRandomizeDisablesRandomization) {
+  const std::string first =
+      ASSERT_NO_ERRNO_AND_VALUE(MapsAfterExec(PER_LINUX | ADDR_NO_RANDOMIZE));
+  const std::string second =
+      ASSERT_NO_ERRNO_AND_VALUE(MapsAfterExec(PER_LINUX | ADDR_NO_RANDOMIZE));
+  EXPECT_EQ(first, second);
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
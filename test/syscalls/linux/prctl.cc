@@ -12,8 +12,10 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+#include <sched.h>
 #include <sys/prctl.h>
 #include <sys/ptrace.h>
+#include <sys/resource.h>
 #include <sys/types.h>
 #include <sys/wait.h>
 #include <unistd.h>
@@ -168,6 +170,65 @@ TEST(PrctlTest, PDeathSig) {
       << "status = " << status;
 }
 
+int64_t UserTimeUsec(const struct rusage& ru) {
+  return ru.ru_utime.tv_sec * 1000000 + ru.ru_utime.tv_usec;
+}
+
+// Orphans are reparented to the closest child subreaper ancestor, which can
+// then wait for them and account for their resource usage.
+TEST(PrctlTest, ChildSubreaper) {
+  int is_subreaper = 1;
+  ASSERT_THAT(prctl(PR_GET_CHILD_SUBREAPER, &is_subreaper), SyscallSucceeds());
+  EXPECT_EQ(is_subreaper, 0);
+
+  EXPECT_THAT(InForkedProcess([] {
+                TEST_PCHECK(prctl(PR_SET_CHILD_SUBREAPER, 1) == 0);
+                int is_subreaper = 0;
+                TEST_PCHECK(prctl(PR_GET_CHILD_SUBREAPER, &is_subreaper) == 0);
+                TEST_CHECK(is_subreaper == 1);
+
+                constexpr int kGrandchildExitCode = 42;
+                constexpr long kGrandchildUsec = 100 * 1000;
+                pid_t const subreaper = getpid();
+                pid_t grandchild = -1;
+                int pipe_fds[2];
+                TEST_PCHECK(pipe(pipe_fds) == 0);
+                pid_t const child = fork();
+                if (child == 0) {
+                  grandchild = fork();
+                  if (grandchild == 0) {
+                    // Wait to be reparented, then use some CPU time.
+                    while (getppid() != subreaper) {
+                      sched_yield();
+                    }
+                    struct rusage ru;
+                    do {
+                      TEST_PCHECK(getrusage(RUSAGE_SELF, &ru) == 0);
+                    } while (UserTimeUsec(ru) < kGrandchildUsec);
+                    _exit(kGrandchildExitCode);
+                  }
+                  TEST_PCHECK(write(pipe_fds[1], &grandchild,
+                                    sizeof(grandchild)) == sizeof(grandchild));
+                  _exit(0);
+                }
+                TEST_PCHECK(child > 0);
+                TEST_PCHECK(read(pipe_fds[0], &grandchild,
+                                 sizeof(grandchild)) == sizeof(grandchild));
+
+                int status;
+                TEST_PCHECK(waitpid(child, &status, 0) == child);
+                TEST_CHECK(WIFEXITED(status) && WEXITSTATUS(status) == 0);
+                TEST_PCHECK(waitpid(grandchild, &status, 0) == grandchild);
+                TEST_CHECK(WIFEXITED(status) &&
+                           WEXITSTATUS(status) == kGrandchildExitCode);
+
+                struct rusage ru;
+                TEST_PCHECK(getrusage(RUSAGE_CHILDREN, &ru) == 0);
+                TEST_CHECK(UserTimeUsec(ru) >= kGrandchildUsec);
+              }),
+              IsPosixErrorOkAndHolds(0));
+}
+
 // This test is to validate that calling prctl with PR_SET_MM without the
 // CAP_SYS_RESOURCE returns EPERM.
 TEST(PrctlTest, InvalidPrSetMM) {
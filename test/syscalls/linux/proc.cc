@@ -23,9 +23,13 @@
 #include <stdio.h>
 #include <stdlib.h>
 #include <string.h>
+#include <sys/epoll.h>
+#include <sys/eventfd.h>
+#include <sys/inotify.h>
 #include <sys/mman.h>
 #include <sys/prctl.h>
 #include <sys/stat.h>
+#include <sys/timerfd.h>
 #include <sys/utsname.h>
 #include <syscall.h>
 #include <unistd.h>
@@ -52,6 +56,8 @@
 #include "absl/time/time.h"
 #include "test/util/capability_util.h"
 #include "test/util/cleanup.h"
+#include "test/util/epoll_util.h"
+#include "test/util/eventfd_util.h"
 #include "test/util/file_descriptor.h"
 #include "test/util/fs_util.h"
 #include "test/util/memory_util.h"
@@ -681,6 +687,78 @@ TEST(ProcSelfFdInfo, Flags) {
   EXPECT_THAT(fd_info, HasSubstr(absl::StrFormat("flags:\t%#o", flags)));
 }
 
+TEST(ProcSelfFdInfo, Pos) {
+  auto f = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileWith(
+      GetAbsoluteTestTmpdir(), "hello", TempPath::kDefaultFileMode));
+  const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open(f.path(), O_RDONLY));
+  ASSERT_THAT(lseek(fd.get(), 3, SEEK_SET), SyscallSucceedsWithValue(3));
+
+  auto fd_info = ASSERT_NO_ERRNO_AND_VALUE(
+      GetContents(absl::StrCat("/proc/self/fdinfo/", fd.get())));
+  EXPECT_THAT(fd_info, HasSubstr("pos:\t3\n"));
+}
+
+TEST(ProcSelfFdInfo, Eventfd) {
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(NewEventFD(0x2a, 0));
+
+  auto fd_info = ASSERT_NO_ERRNO_AND_VALUE(
+      GetContents(absl::StrCat("/proc/self/fdinfo/", fd.get())));
+  EXPECT_THAT(fd_info, ContainsRegex("eventfd-count: +2a\n"));
+}
+
+TEST(ProcSelfFdInfo, Epoll) {
+  FileDescriptor epfd = ASSERT_NO_ERRNO_AND_VALUE(NewEpollFD());
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(NewEventFD(0, 0));
+
+  struct epoll_event event = {};
+  event.events = EPOLLIN | EPOLLET;
+  event.data.u64 = 0x1234;
+  ASSERT_THAT(epoll_ctl(epfd.get(), EPOLL_CTL_ADD, fd.get(), &event),
+              SyscallSucceeds());
+
+  auto fd_info = ASSERT_NO_ERRNO_AND_VALUE(
+      GetContents(absl::StrCat("/proc/self/fdinfo/", epfd.get())));
+  EXPECT_THAT(fd_info,
+              ContainsRegex(absl::StrFormat(
+                  "tfd: +%d events: +%x data: +1234 ", fd.get(),
+                  EPOLLIN | EPOLLET | EPOLLERR | EPOLLHUP)));
+}
+
+TEST(ProcSelfFdInfo, Inotify) {
+  const TempPath dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  int inotify_fd;
+  ASSERT_THAT(inotify_fd = inotify_init1(0), SyscallSucceeds());
+  FileDescriptor fd(inotify_fd);
+  int wd;
+  ASSERT_THAT(wd = inotify_add_watch(fd.get(), dir.path().c_str(), IN_CREATE),
+              SyscallSucceeds());
+
+  struct stat st;
+  ASSERT_THAT(stat(dir.path().c_str(), &st), SyscallSucceeds());
+
+  auto fd_info = ASSERT_NO_ERRNO_AND_VALUE(
+      GetContents(absl::StrCat("/proc/self/fdinfo/", fd.get())));
+  EXPECT_THAT(fd_info, HasSubstr(absl::StrFormat("inotify wd:%x ino:%x ", wd,
+                                                 st.st_ino)));
+}
+
+TEST(ProcSelfFdInfo, Timerfd) {
+  int timer_fd;
+  ASSERT_THAT(timer_fd = timerfd_create(CLOCK_MONOTONIC, 0), SyscallSucceeds());
+  FileDescriptor fd(timer_fd);
+  struct itimerspec its = {};
+  its.it_value.tv_sec = 100;
+  its.it_interval.tv_sec = 5;
+  ASSERT_THAT(timerfd_settime(fd.get(), 0, &its, nullptr), SyscallSucceeds());
+
+  auto fd_info = ASSERT_NO_ERRNO_AND_VALUE(
+      GetContents(absl::StrCat("/proc/self/fdinfo/", fd.get())));
+  EXPECT_THAT(fd_info, HasSubstr(absl::StrFormat("clockid: %d\nticks: 0\n"
+                                                 "settime flags: 00\n",
+                                                 CLOCK_MONOTONIC)));
+  EXPECT_THAT(fd_info, HasSubstr("it_interval: (5, 0)\n"));
+}
+
 TEST(ProcSelfExe, Absolute) {
   auto exe = ASSERT_NO_ERRNO_AND_VALUE(
       ReadLink(absl::StrCat("/proc/", getpid(), "/exe")));
@@ -1765,6 +1843,27 @@ TEST(ProcSysVmOvercommitMemory, HasNumericValue) {
       << overcommit_memory;
 }
 
+TEST(ProcSysVmMmapRndBits, InRange) {
+  const std::string mmap_rnd_bits_str =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/sys/vm/mmap_rnd_bits"));
+  int mmap_rnd_bits;
+  ASSERT_TRUE(absl::SimpleAtoi(mmap_rnd_bits_str, &mmap_rnd_bits))
+      << "/proc/sys/vm/mmap_rnd_bits does not contain a numeric value: "
+      << mmap_rnd_bits_str;
+  // CONFIG_ARCH_MMAP_RND_BITS_{MIN,MAX} on x86_64.
+  EXPECT_GE(mmap_rnd_bits, 28);
+  EXPECT_LE(mmap_rnd_bits, 32);
+}
+
+TEST(ProcSysVmLegacyVaLayout, HasNumericValue) {
+  const std::string legacy_va_layout_str =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/sys/vm/legacy_va_layout"));
+  int legacy_va_layout;
+  EXPECT_TRUE(absl::SimpleAtoi(legacy_va_layout_str, &legacy_va_layout))
+      << "/proc/sys/vm/legacy_va_layout does not contain a numeric value: "
+      << legacy_va_layout_str;
+}
+
 // Check that link for proc fd entries point the target node, not the
 // symlink itself.
 TEST(ProcTaskFd, FstatatFollowsSymlink) {
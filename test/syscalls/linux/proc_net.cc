@@ -12,8 +12,18 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+#include <netinet/in.h>
+#include <sys/socket.h>
+#include <sys/stat.h>
+
+#include <string>
+#include <vector>
+
 #include "gtest/gtest.h"
 #include "gtest/gtest.h"
+#include "absl/strings/str_format.h"
+#include "absl/strings/str_split.h"
+#include "test/syscalls/linux/socket_test_util.h"
 #include "test/util/file_descriptor.h"
 #include "test/util/fs_util.h"
 #include "test/util/test_util.h"
@@ -30,6 +40,100 @@ TEST(ProcNetIfInet6, Format) {
                   "^([a-f\\d]{32}( [a-f\\d]{2}){4} +[a-z][a-z\\d]*\\n)+$"));
 }
 
+TEST(ProcNetSockstat, Format) {
+  auto sockstat = ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/net/sockstat"));
+  EXPECT_THAT(sockstat,
+              ::testing::ContainsRegex("^sockets: used \\d+\n"
+                                       "TCP: inuse \\d+ orphan \\d+ tw \\d+ "
+                                       "alloc \\d+ mem \\d+\n"
+                                       "UDP: inuse \\d+ mem \\d+\n"));
+}
+
+TEST(ProcNetSockstat, CountsSockets) {
+  // Sockets of other processes may be created or closed concurrently on
+  // Linux, so only check that some UDP socket is reported.
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_INET, SOCK_DGRAM, 0));
+
+  auto const sockstat =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/net/sockstat"));
+  EXPECT_THAT(sockstat, ::testing::ContainsRegex("UDP: inuse [1-9]\\d* "));
+}
+
+// Returns the fields of the entry of the table at path whose local address is
+// local_address.
+PosixErrorOr<std::vector<std::string>> FindProcNetEntry(
+    const std::string& path, const std::string& local_address) {
+  ASSIGN_OR_RETURN_ERRNO(std::string contents, GetContents(path));
+  for (absl::string_view line : absl::StrSplit(contents, '\n')) {
+    std::vector<std::string> fields =
+        absl::StrSplit(line, ' ', absl::SkipEmpty());
+    if (fields.size() > 9 && fields[1] == local_address) {
+      return fields;
+    }
+  }
+  return PosixError(ENOENT, absl::StrCat("no entry for ", local_address));
+}
+
+// Checks that inode, as shown in /proc/net, is the inode of fd and the one
+// its /proc/self/fd symlink refers to.
+void ExpectSocketInode(int fd, const std::string& inode) {
+  struct stat st;
+  ASSERT_THAT(fstat(fd, &st), SyscallSucceeds());
+  EXPECT_EQ(inode, absl::StrCat(st.st_ino));
+
+  std::string link = ASSERT_NO_ERRNO_AND_VALUE(
+      ReadLink(absl::StrCat("/proc/self/fd/", fd)));
+  EXPECT_EQ(link, absl::StrCat("socket:[", inode, "]"));
+}
+
+TEST(ProcNetTCP, ListeningSocket) {
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_INET, SOCK_STREAM, 0));
+  struct sockaddr_in addr = {};
+  addr.sin_family = AF_INET;
+  addr.sin_addr.s_addr = htonl(INADDR_LOOPBACK);
+  socklen_t addrlen = sizeof(addr);
+  ASSERT_THAT(bind(fd.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                   sizeof(addr)),
+              SyscallSucceeds());
+  ASSERT_THAT(listen(fd.get(), 1), SyscallSucceeds());
+  ASSERT_THAT(getsockname(fd.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                          &addrlen),
+              SyscallSucceeds());
+
+  // Addresses are shown in host byte order, ports in hexadecimal.
+  std::vector<std::string> fields = ASSERT_NO_ERRNO_AND_VALUE(FindProcNetEntry(
+      "/proc/net/tcp", absl::StrFormat("%08X:%04X", addr.sin_addr.s_addr,
+                                       ntohs(addr.sin_port))));
+  EXPECT_EQ(fields[2], "00000000:0000");
+  EXPECT_EQ(fields[3], "0A");  // TCP_LISTEN
+  ExpectSocketInode(fd.get(), fields[9]);
+}
+
+TEST(ProcNetUDP, ConnectedSocket) {
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_INET, SOCK_DGRAM, 0));
+  struct sockaddr_in addr = {};
+  addr.sin_family = AF_INET;
+  addr.sin_addr.s_addr = htonl(INADDR_LOOPBACK);
+  addr.sin_port = htons(53);
+  socklen_t addrlen = sizeof(addr);
+  ASSERT_THAT(connect(fd.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                      sizeof(addr)),
+              SyscallSucceeds());
+  ASSERT_THAT(getsockname(fd.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                          &addrlen),
+              SyscallSucceeds());
+
+  std::vector<std::string> fields = ASSERT_NO_ERRNO_AND_VALUE(FindProcNetEntry(
+      "/proc/net/udp", absl::StrFormat("%08X:%04X", addr.sin_addr.s_addr,
+                                       ntohs(addr.sin_port))));
+  EXPECT_EQ(fields[2], absl::StrFormat("%08X:0035", htonl(INADDR_LOOPBACK)));
+  EXPECT_EQ(fields[3], "01");  // TCP_ESTABLISHED
+  ExpectSocketInode(fd.get(), fields[9]);
+}
+
 TEST(ProcSysNetIpv4Sack, Exists) {
   EXPECT_THAT(open("/proc/sys/net/ipv4/tcp_sack", O_RDONLY), SyscallSucceeds());
 }
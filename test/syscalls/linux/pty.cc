@@ -15,6 +15,7 @@
 #include <fcntl.h>
 #include <linux/major.h>
 #include <poll.h>
+#include <signal.h>
 #include <sys/ioctl.h>
 #include <sys/mman.h>
 #include <sys/stat.h>
@@ -30,6 +31,8 @@
 #include "absl/time/clock.h"
 #include "absl/time/time.h"
 #include "test/util/file_descriptor.h"
+#include "test/util/logging.h"
+#include "test/util/multiprocess_util.h"
 #include "test/util/posix_error.h"
 #include "test/util/test_util.h"
 #include "test/util/thread_util.h"
@@ -1231,6 +1234,104 @@ TEST_F(PtyTest, SetMasterWindowSize) {
   EXPECT_EQ(retrieved_ws.ws_col, kCols);
 }
 
+class JobControlTest : public ::testing::Test {
+ protected:
+  void SetUp() override {
+    // The slaves are opened here, as opening them from a session leader
+    // without a controlling terminal would make them its controlling
+    // terminal on Linux.
+    master_ = ASSERT_NO_ERRNO_AND_VALUE(Open("/dev/ptmx", O_RDWR | O_NONBLOCK));
+    slave_ = ASSERT_NO_ERRNO_AND_VALUE(OpenSlave(master_));
+  }
+
+  // Master and slave ends of the PTY. Non-blocking.
+  FileDescriptor master_;
+  FileDescriptor slave_;
+};
+
+TEST_F(JobControlTest, SetTTYNonLeader) {
+  // A forked process is not a session leader.
+  auto rest = [&] {
+    TEST_CHECK(ioctl(slave_.get(), TIOCSCTTY, 0) == -1);
+    TEST_PCHECK(errno == EPERM);
+  };
+  EXPECT_THAT(InForkedProcess(rest), IsPosixErrorOkAndHolds(0));
+}
+
+TEST_F(JobControlTest, SetTTY) {
+  auto rest = [&] {
+    TEST_PCHECK(setsid() >= 0);
+    TEST_PCHECK(ioctl(slave_.get(), TIOCSCTTY, 0) == 0);
+
+    pid_t sid;
+    TEST_PCHECK(ioctl(slave_.get(), TIOCGSID, &sid) == 0);
+    TEST_CHECK(sid == getpid());
+
+    // Setting the same terminal again is a no-op.
+    TEST_PCHECK(ioctl(slave_.get(), TIOCSCTTY, 0) == 0);
+  };
+  EXPECT_THAT(InForkedProcess(rest), IsPosixErrorOkAndHolds(0));
+}
+
+TEST_F(JobControlTest, SetTTYSessionHasTTY) {
+  FileDescriptor master2 =
+      ASSERT_NO_ERRNO_AND_VALUE(Open("/dev/ptmx", O_RDWR | O_NONBLOCK));
+  FileDescriptor slave2 = ASSERT_NO_ERRNO_AND_VALUE(OpenSlave(master2));
+
+  auto rest = [&] {
+    TEST_PCHECK(setsid() >= 0);
+    TEST_PCHECK(ioctl(slave_.get(), TIOCSCTTY, 0) == 0);
+
+    // The session already has a controlling terminal.
+    TEST_CHECK(ioctl(slave2.get(), TIOCSCTTY, 0) == -1);
+    TEST_PCHECK(errno == EPERM);
+  };
+  EXPECT_THAT(InForkedProcess(rest), IsPosixErrorOkAndHolds(0));
+}
+
+TEST_F(JobControlTest, ReleaseTTYOnLeaderExit) {
+  int pipe_fds[2];
+  ASSERT_THAT(pipe(pipe_fds), SyscallSucceeds());
+  FileDescriptor rfd(pipe_fds[0]);
+  FileDescriptor wfd(pipe_fds[1]);
+
+  // The session leader acquires the terminal, and forks a process in its
+  // (foreground) process group before exiting.
+  auto leader = [&] {
+    TEST_PCHECK(setsid() >= 0);
+    TEST_PCHECK(ioctl(slave_.get(), TIOCSCTTY, 0) == 0);
+
+    // Block SIGHUP and SIGCONT in the child so that it can wait for the
+    // former, and isn't killed by it.
+    sigset_t set;
+    sigemptyset(&set);
+    sigaddset(&set, SIGHUP);
+    sigaddset(&set, SIGCONT);
+    TEST_PCHECK(sigprocmask(SIG_BLOCK, &set, nullptr) == 0);
+
+    pid_t child = fork();
+    if (child == 0) {
+      struct timespec timeout = {.tv_sec = 20};
+      char ok = sigtimedwait(&set, nullptr, &timeout) == SIGHUP;
+
+      // The terminal is no longer the controlling terminal of any session.
+      pid_t sid;
+      ok = ok && ioctl(master_.get(), TIOCGSID, &sid) == -1 && errno == ENOTTY;
+
+      TEST_PCHECK(write(wfd.get(), &ok, 1) == 1);
+      _exit(0);
+    }
+    TEST_PCHECK(child > 0);
+  };
+  ASSERT_THAT(InForkedProcess(leader), IsPosixErrorOkAndHolds(0));
+
+  // Only the child of the leader is left to write to the pipe.
+  wfd.reset();
+  char ok = 0;
+  ASSERT_THAT(ReadFd(rfd.get(), &ok, 1), SyscallSucceedsWithValue(1));
+  EXPECT_TRUE(ok);
+}
+
 }  // namespace
 }  // namespace testing
 }  // namespace gvisor
@@ -15,19 +15,30 @@
 #include <sys/ipc.h>
 #include <sys/sem.h>
 #include <sys/types.h>
+#include <sys/wait.h>
 #include <atomic>
 #include <cerrno>
 #include <ctime>
+#include <string>
+#include <vector>
 
 #include "gmock/gmock.h"
 #include "gtest/gtest.h"
 #include "absl/base/macros.h"
+#include "absl/strings/str_cat.h"
 #include "absl/synchronization/mutex.h"
 #include "absl/time/clock.h"
 #include "test/util/capability_util.h"
+#include "test/util/cleanup.h"
+#include "test/util/fs_util.h"
 #include "test/util/test_util.h"
 #include "test/util/thread_util.h"
 
+// Not all versions of glibc define SEM_STAT_ANY.
+#ifndef SEM_STAT_ANY
+#define SEM_STAT_ANY 20
+#endif
+
 namespace gvisor {
 namespace testing {
 namespace {
@@ -485,6 +496,198 @@ TEST(SemaphoreTest, SemIpcSet) {
   ASSERT_THAT(semop(sem.get(), &buf, 1), SyscallFailsWithErrno(EACCES));
 }
 
+TEST(SemaphoreTest, SemTimedOpTimeout) {
+  AutoSem sem(semget(IPC_PRIVATE, 1, 0600 | IPC_CREAT));
+  ASSERT_THAT(sem.get(), SyscallSucceeds());
+
+  struct sembuf buf = {};
+  buf.sem_op = -1;
+  struct timespec timeout = absl::ToTimespec(absl::Milliseconds(10));
+  EXPECT_THAT(semtimedop(sem.get(), &buf, 1, &timeout),
+              SyscallFailsWithErrno(EAGAIN));
+
+  // Operations that don't block succeed.
+  buf.sem_op = 1;
+  EXPECT_THAT(semtimedop(sem.get(), &buf, 1, &timeout), SyscallSucceeds());
+
+  // Invalid timeouts are rejected.
+  buf.sem_op = -2;
+  timeout.tv_nsec = -1;
+  EXPECT_THAT(semtimedop(sem.get(), &buf, 1, &timeout),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(SemaphoreTest, SemTimedOpWakeup) {
+  AutoSem sem(semget(IPC_PRIVATE, 1, 0600 | IPC_CREAT));
+  ASSERT_THAT(sem.get(), SyscallSucceeds());
+
+  ScopedThread th([&sem] {
+    absl::SleepFor(absl::Milliseconds(100));
+    struct sembuf buf = {};
+    buf.sem_op = 1;
+    ASSERT_THAT(semop(sem.get(), &buf, 1), SyscallSucceeds());
+  });
+
+  struct sembuf buf = {};
+  buf.sem_op = -1;
+  struct timespec timeout = absl::ToTimespec(absl::Seconds(60));
+  EXPECT_THAT(semtimedop(sem.get(), &buf, 1, &timeout), SyscallSucceeds());
+}
+
+// Runs the given operation in a child process, which then exits.
+void SemOpInChild(int semid, short op, short flags) {
+  const pid_t child_pid = fork();
+  if (child_pid == 0) {
+    struct sembuf buf = {};
+    buf.sem_op = op;
+    buf.sem_flg = flags;
+    TEST_PCHECK(semop(semid, &buf, 1) == 0);
+    _exit(0);
+  }
+  ASSERT_THAT(child_pid, SyscallSucceeds());
+
+  int status;
+  ASSERT_THAT(RetryEINTR(waitpid)(child_pid, &status, 0),
+              SyscallSucceedsWithValue(child_pid));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0)
+      << " status " << status;
+}
+
+TEST(SemaphoreTest, SemUndoOnExit) {
+  AutoSem sem(semget(IPC_PRIVATE, 1, 0600 | IPC_CREAT));
+  ASSERT_THAT(sem.get(), SyscallSucceeds());
+
+  // Without SEM_UNDO, changes persist after exit.
+  SemOpInChild(sem.get(), 2, 0);
+  EXPECT_THAT(semctl(sem.get(), 0, GETVAL), SyscallSucceedsWithValue(2));
+
+  // With SEM_UNDO, changes are reverted on exit.
+  SemOpInChild(sem.get(), 3, SEM_UNDO);
+  EXPECT_THAT(semctl(sem.get(), 0, GETVAL), SyscallSucceedsWithValue(2));
+  SemOpInChild(sem.get(), -1, SEM_UNDO);
+  EXPECT_THAT(semctl(sem.get(), 0, GETVAL), SyscallSucceedsWithValue(2));
+}
+
+TEST(SemaphoreTest, SemUndoClearedBySetVal) {
+  AutoSem sem(semget(IPC_PRIVATE, 1, 0600 | IPC_CREAT));
+  ASSERT_THAT(sem.get(), SyscallSucceeds());
+
+  const pid_t child_pid = fork();
+  if (child_pid == 0) {
+    struct sembuf buf = {};
+    buf.sem_op = 3;
+    buf.sem_flg = SEM_UNDO;
+    TEST_PCHECK(semop(sem.get(), &buf, 1) == 0);
+    // Clears the adjustment made above.
+    TEST_PCHECK(semctl(sem.get(), 0, SETVAL, 5) == 0);
+    _exit(0);
+  }
+  ASSERT_THAT(child_pid, SyscallSucceeds());
+
+  int status;
+  ASSERT_THAT(RetryEINTR(waitpid)(child_pid, &status, 0),
+              SyscallSucceedsWithValue(child_pid));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0)
+      << " status " << status;
+  EXPECT_THAT(semctl(sem.get(), 0, GETVAL), SyscallSucceedsWithValue(5));
+}
+
+TEST(SemaphoreTest, SemCtlNcntZcnt) {
+  AutoSem sem(semget(IPC_PRIVATE, 1, 0600 | IPC_CREAT));
+  ASSERT_THAT(sem.get(), SyscallSucceeds());
+  ASSERT_THAT(semctl(sem.get(), 0, SETVAL, 1), SyscallSucceeds());
+
+  // Wait for the value to become zero.
+  ScopedThread th([&sem] {
+    struct sembuf buf = {};
+    buf.sem_op = 0;
+    ASSERT_THAT(semop(sem.get(), &buf, 1), SyscallSucceeds());
+  });
+
+  // Wait until the thread blocks.
+  while (semctl(sem.get(), 0, GETZCNT) == 0) {
+    absl::SleepFor(absl::Milliseconds(10));
+  }
+  EXPECT_THAT(semctl(sem.get(), 0, GETZCNT), SyscallSucceedsWithValue(1));
+  EXPECT_THAT(semctl(sem.get(), 0, GETNCNT), SyscallSucceedsWithValue(0));
+
+  ASSERT_THAT(semctl(sem.get(), 0, SETVAL, 0), SyscallSucceeds());
+  th.Join();
+  EXPECT_THAT(semctl(sem.get(), 0, GETZCNT), SyscallSucceedsWithValue(0));
+}
+
+TEST(SemaphoreTest, SemCtlIpcStat) {
+  AutoSem sem(semget(IPC_PRIVATE, 3, 0600 | IPC_CREAT));
+  ASSERT_THAT(sem.get(), SyscallSucceeds());
+
+  struct semid_ds ds = {};
+  ASSERT_THAT(semctl(sem.get(), 0, IPC_STAT, &ds), SyscallSucceeds());
+  EXPECT_EQ(ds.sem_nsems, 3);
+  EXPECT_EQ(ds.sem_perm.mode, 0600);
+  EXPECT_EQ(ds.sem_perm.uid, geteuid());
+
+  // SEM_STAT_ANY finds the set by index.
+  struct seminfo info = {};
+  int max_index;
+  ASSERT_THAT(max_index = semctl(0, 0, SEM_INFO, &info), SyscallSucceeds());
+  bool found = false;
+  for (int i = 0; i <= max_index; i++) {
+    if (semctl(i, 0, SEM_STAT_ANY, &ds) == sem.get()) {
+      EXPECT_EQ(ds.sem_nsems, 3);
+      found = true;
+    }
+  }
+  EXPECT_TRUE(found);
+}
+
+// Reads the limits in /proc/sys/kernel/sem.
+PosixErrorOr<std::vector<int>> SemLimits() {
+  ASSIGN_OR_RETURN_ERRNO(std::string contents,
+                         GetContents("/proc/sys/kernel/sem"));
+  std::vector<int> limits(4);
+  if (sscanf(contents.c_str(), "%d %d %d %d", &limits[0], &limits[1],
+             &limits[2], &limits[3]) != 4) {
+    return PosixError(EINVAL, absl::StrCat("bad limits: ", contents));
+  }
+  return limits;
+}
+
+TEST(SemaphoreTest, SemCtlIpcInfo) {
+  const std::vector<int> limits = ASSERT_NO_ERRNO_AND_VALUE(SemLimits());
+
+  struct seminfo info = {};
+  ASSERT_THAT(semctl(0, 0, IPC_INFO, &info), SyscallSucceeds());
+  EXPECT_EQ(info.semmsl, limits[0]);
+  EXPECT_EQ(info.semmns, limits[1]);
+  EXPECT_EQ(info.semopm, limits[2]);
+  EXPECT_EQ(info.semmni, limits[3]);
+  EXPECT_EQ(info.semvmx, 32767);
+}
+
+TEST(SemaphoreTest, ProcSysKernelSemLimits) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  const std::vector<int> limits = ASSERT_NO_ERRNO_AND_VALUE(SemLimits());
+  Cleanup restore([&limits] {
+    EXPECT_NO_ERRNO(SetContents(
+        "/proc/sys/kernel/sem", absl::StrCat(limits[0], " ", limits[1], " ",
+                                             limits[2], " ", limits[3])));
+  });
+
+  // Limit semop(2) to 2 operations.
+  ASSERT_NO_ERRNO(SetContents(
+      "/proc/sys/kernel/sem",
+      absl::StrCat(limits[0], " ", limits[1], " 2 ", limits[3])));
+  EXPECT_THAT(SemLimits(), IsPosixErrorOkAndHolds(std::vector<int>{
+                               limits[0], limits[1], 2, limits[3]}));
+
+  AutoSem sem(semget(IPC_PRIVATE, 1, 0600 | IPC_CREAT));
+  ASSERT_THAT(sem.get(), SyscallSucceeds());
+  struct sembuf bufs[3] = {};
+  EXPECT_THAT(semop(sem.get(), bufs, 2), SyscallSucceeds());
+  EXPECT_THAT(semop(sem.get(), bufs, 3), SyscallFailsWithErrno(E2BIG));
+}
+
 }  // namespace
 }  // namespace testing
 }  // namespace gvisor
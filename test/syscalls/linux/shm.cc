@@ -19,12 +19,26 @@
 #include <sys/shm.h>
 #include <sys/types.h>
 
+#include <string>
+#include <vector>
+
+#include "absl/strings/numbers.h"
+#include "absl/strings/str_split.h"
 #include "absl/time/clock.h"
+#include "test/util/capability_util.h"
+#include "test/util/cleanup.h"
+#include "test/util/fs_util.h"
 #include "test/util/multiprocess_util.h"
 #include "test/util/posix_error.h"
+#include "test/util/rlimit_util.h"
 #include "test/util/temp_path.h"
 #include "test/util/test_util.h"
 
+// Not all versions of glibc define SHM_STAT_ANY.
+#ifndef SHM_STAT_ANY
+#define SHM_STAT_ANY 15
+#endif
+
 namespace gvisor {
 namespace testing {
 namespace {
@@ -238,9 +252,87 @@ TEST(ShmTest, ShmStat) {
   const ShmSegment shm = ASSERT_NO_ERRNO_AND_VALUE(
       Shmget(IPC_PRIVATE, kAllocSize, IPC_CREAT | 0777));
   struct shmid_ds attr;
-  ASSERT_NO_ERRNO(Shmctl(1, SHM_STAT, &attr));
-  // This does the same thing as IPC_STAT, so only test that the syscall
-  // succeeds here.
+  // SHM_STAT returns the shmid of the segment at the given index.
+  EXPECT_THAT(Shmctl(1, SHM_STAT, &attr), IsPosixErrorOkAndHolds(shm.id()));
+  EXPECT_EQ(attr.shm_segsz, kAllocSize);
+}
+
+TEST(ShmTest, ShmStatAnyFindsSegment) {
+  // Segments without read permission are only visible to SHM_STAT_ANY.
+  const ShmSegment shm = ASSERT_NO_ERRNO_AND_VALUE(
+      Shmget(IPC_PRIVATE, kAllocSize, IPC_CREAT | 0));
+
+  // IPC_INFO and SHM_INFO return the highest used index.
+  struct shm_info info;
+  const int max_index = ASSERT_NO_ERRNO_AND_VALUE(Shmctl(0, SHM_INFO, &info));
+  struct shminfo params;
+  EXPECT_THAT(Shmctl(0, IPC_INFO, &params),
+              IsPosixErrorOkAndHolds(max_index));
+
+  bool found = false;
+  for (int i = 0; i <= max_index; i++) {
+    struct shmid_ds attr;
+    auto id = Shmctl(i, SHM_STAT_ANY, &attr);
+    if (id.ok() && id.ValueOrDie() == shm.id()) {
+      EXPECT_EQ(attr.shm_segsz, kAllocSize);
+      found = true;
+    }
+  }
+  EXPECT_TRUE(found);
+}
+
+TEST(ShmTest, ShmLock) {
+  const ShmSegment shm = ASSERT_NO_ERRNO_AND_VALUE(
+      Shmget(IPC_PRIVATE, kAllocSize, IPC_CREAT | 0777));
+
+  struct shmid_ds attr;
+  ASSERT_NO_ERRNO(Shmctl<void>(shm.id(), SHM_LOCK, nullptr));
+  ASSERT_NO_ERRNO(Shmctl(shm.id(), IPC_STAT, &attr));
+  EXPECT_NE(attr.shm_perm.mode & SHM_LOCKED, 0);
+
+  ASSERT_NO_ERRNO(Shmctl<void>(shm.id(), SHM_UNLOCK, nullptr));
+  ASSERT_NO_ERRNO(Shmctl(shm.id(), IPC_STAT, &attr));
+  EXPECT_EQ(attr.shm_perm.mode & SHM_LOCKED, 0);
+}
+
+TEST(ShmTest, ShmLockRlimitMemlockZero) {
+  const ShmSegment shm = ASSERT_NO_ERRNO_AND_VALUE(
+      Shmget(IPC_PRIVATE, kAllocSize, IPC_CREAT | 0777));
+
+  if (ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_IPC_LOCK))) {
+    ASSERT_NO_ERRNO(SetCapability(CAP_IPC_LOCK, false));
+  }
+  Cleanup reset_rlimit =
+      ASSERT_NO_ERRNO_AND_VALUE(ScopedSetSoftRlimit(RLIMIT_MEMLOCK, 0));
+  EXPECT_THAT(Shmctl<void>(shm.id(), SHM_LOCK, nullptr),
+              PosixErrorIs(EPERM, _));
+}
+
+TEST(ShmTest, ProcSysvipcShm) {
+  const ShmSegment shm = ASSERT_NO_ERRNO_AND_VALUE(
+      Shmget(IPC_PRIVATE, kAllocSize, IPC_CREAT | 0640));
+
+  const std::string contents =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/sysvipc/shm"));
+  std::vector<std::string> lines = absl::StrSplit(contents, '\n');
+  ASSERT_GT(lines.size(), 1);
+  EXPECT_THAT(lines[0], ::testing::StartsWith("       key      shmid perms"));
+
+  bool found = false;
+  for (size_t i = 1; i < lines.size(); i++) {
+    std::vector<std::string> fields =
+        absl::StrSplit(lines[i], ' ', absl::SkipEmpty());
+    int id;
+    if (fields.size() < 4 || !absl::SimpleAtoi(fields[1], &id) ||
+        id != shm.id()) {
+      continue;
+    }
+    EXPECT_EQ(fields[0], "0");  // IPC_PRIVATE
+    EXPECT_EQ(fields[2], "640");
+    EXPECT_EQ(fields[3], std::to_string(kAllocSize));
+    found = true;
+  }
+  EXPECT_TRUE(found);
 }
 
 TEST(ShmTest, IpcInfo) {
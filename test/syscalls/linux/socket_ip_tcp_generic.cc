@@ -14,6 +14,7 @@
 
 #include "test/syscalls/linux/socket_ip_tcp_generic.h"
 
+#include <linux/sock_diag.h>
 #include <netinet/in.h>
 #include <netinet/tcp.h>
 #include <stdio.h>
@@ -87,6 +88,69 @@ TEST_P(TCPSocketPairTest, RSTSentOnCloseWithUnreadData) {
               SyscallFailsWithErrno(ECONNRESET));
 }
 
+TEST_P(TCPSocketPairTest, QueueSizeIoctls) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(NewSocketPair());
+
+  int size = -1;
+  EXPECT_THAT(ioctl(sockets->first_fd(), TIOCOUTQ, &size), SyscallSucceeds());
+  EXPECT_EQ(size, 0);
+  EXPECT_THAT(ioctl(sockets->second_fd(), TIOCINQ, &size), SyscallSucceeds());
+  EXPECT_EQ(size, 0);
+
+  char buf[10] = {};
+  ASSERT_THAT(RetryEINTR(write)(sockets->first_fd(), buf, sizeof(buf)),
+              SyscallSucceedsWithValue(sizeof(buf)));
+
+  // Wait until second sees the data on its side but don't read it.
+  struct pollfd poll_fd = {sockets->second_fd(), POLLIN, 0};
+  constexpr int kPollTimeoutMs = 20000;  // Wait up to 20 seconds for the data.
+  ASSERT_THAT(RetryEINTR(poll)(&poll_fd, 1, kPollTimeoutMs),
+              SyscallSucceedsWithValue(1));
+
+  EXPECT_THAT(ioctl(sockets->second_fd(), TIOCINQ, &size), SyscallSucceeds());
+  EXPECT_EQ(size, sizeof(buf));
+
+  // The data written is counted until it's acknowledged, so it may still be
+  // reported.
+  EXPECT_THAT(ioctl(sockets->first_fd(), TIOCOUTQ, &size), SyscallSucceeds());
+  EXPECT_GE(size, 0);
+  EXPECT_LE(size, sizeof(buf));
+}
+
+TEST_P(TCPSocketPairTest, MemInfo) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(NewSocketPair());
+
+  char buf[10] = {};
+  ASSERT_THAT(RetryEINTR(write)(sockets->first_fd(), buf, sizeof(buf)),
+              SyscallSucceedsWithValue(sizeof(buf)));
+
+  // Wait until second sees the data on its side but don't read it.
+  struct pollfd poll_fd = {sockets->second_fd(), POLLIN, 0};
+  constexpr int kPollTimeoutMs = 20000;  // Wait up to 20 seconds for the data.
+  ASSERT_THAT(RetryEINTR(poll)(&poll_fd, 1, kPollTimeoutMs),
+              SyscallSucceedsWithValue(1));
+
+  uint32_t mem[SK_MEMINFO_VARS] = {};
+  socklen_t mem_len = sizeof(mem);
+  ASSERT_THAT(getsockopt(sockets->second_fd(), SOL_SOCKET, SO_MEMINFO, mem,
+                         &mem_len),
+              SyscallSucceeds());
+  EXPECT_EQ(mem_len, sizeof(mem));
+
+  // Linux accounts for the overhead of the buffers holding the data, so
+  // more than the data may be reported.
+  EXPECT_GE(mem[SK_MEMINFO_RMEM_ALLOC], sizeof(buf));
+  EXPECT_GT(mem[SK_MEMINFO_RCVBUF], 0);
+  EXPECT_GT(mem[SK_MEMINFO_SNDBUF], 0);
+
+  // The output is truncated to the length requested.
+  mem_len = sizeof(mem[0]);
+  ASSERT_THAT(getsockopt(sockets->second_fd(), SOL_SOCKET, SO_MEMINFO, mem,
+                         &mem_len),
+              SyscallSucceeds());
+  EXPECT_EQ(mem_len, sizeof(mem[0]));
+}
+
 // This test will validate that a RST will cause POLLHUP to trigger.
 TEST_P(TCPSocketPairTest, RSTCausesPollHUP) {
   auto sockets = ASSERT_NO_ERRNO_AND_VALUE(NewSocketPair());
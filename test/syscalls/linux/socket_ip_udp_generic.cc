@@ -14,9 +14,12 @@
 
 #include "test/syscalls/linux/socket_ip_udp_generic.h"
 
+#include <linux/filter.h>
+#include <net/if.h>
 #include <netinet/in.h>
 #include <netinet/tcp.h>
 #include <stdio.h>
+#include <string.h>
 #include <sys/ioctl.h>
 #include <sys/poll.h>
 #include <sys/socket.h>
@@ -26,6 +29,7 @@
 #include "gtest/gtest.h"
 #include "gtest/gtest.h"
 #include "test/syscalls/linux/socket_test_util.h"
+#include "test/util/capability_util.h"
 #include "test/util/test_util.h"
 
 namespace gvisor {
@@ -210,5 +214,150 @@ TEST_P(UDPSocketPairTest, SetMulticastLoopChar) {
   EXPECT_EQ(get, kSockOptOn);
 }
 
+TEST_P(UDPSocketPairTest, BindToDevice) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_RAW)));
+
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(NewSocketPair());
+
+  constexpr char kDevice[] = "lo";
+  ASSERT_THAT(setsockopt(sockets->first_fd(), SOL_SOCKET, SO_BINDTODEVICE,
+                         kDevice, sizeof(kDevice)),
+              SyscallSucceeds());
+
+  char get[IFNAMSIZ] = {};
+  socklen_t get_len = sizeof(get);
+  EXPECT_THAT(getsockopt(sockets->first_fd(), SOL_SOCKET, SO_BINDTODEVICE,
+                         get, &get_len),
+              SyscallSucceedsWithValue(0));
+  EXPECT_EQ(get_len, sizeof(kDevice));
+  EXPECT_STREQ(get, kDevice);
+
+  // An empty name removes the binding.
+  ASSERT_THAT(
+      setsockopt(sockets->first_fd(), SOL_SOCKET, SO_BINDTODEVICE, "", 0),
+      SyscallSucceeds());
+  get_len = sizeof(get);
+  EXPECT_THAT(getsockopt(sockets->first_fd(), SOL_SOCKET, SO_BINDTODEVICE,
+                         get, &get_len),
+              SyscallSucceedsWithValue(0));
+  EXPECT_EQ(get_len, 0);
+}
+
+TEST_P(UDPSocketPairTest, BindToUnknownDevice) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_RAW)));
+
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(NewSocketPair());
+
+  constexpr char kDevice[] = "nonexistent0";
+  EXPECT_THAT(setsockopt(sockets->first_fd(), SOL_SOCKET, SO_BINDTODEVICE,
+                         kDevice, sizeof(kDevice)),
+              SyscallFailsWithErrno(ENODEV));
+}
+
+TEST_P(UDPSocketPairTest, GetBindToDeviceTooSmall) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(NewSocketPair());
+
+  char get[IFNAMSIZ - 1] = {};
+  socklen_t get_len = sizeof(get);
+  EXPECT_THAT(getsockopt(sockets->first_fd(), SOL_SOCKET, SO_BINDTODEVICE,
+                         get, &get_len),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST_P(UDPSocketPairTest, AttachFilter) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(NewSocketPair());
+
+  // The filter drops the datagrams whose first byte is 0, and truncates the
+  // others to their first 4 bytes.
+  struct sock_filter code[] = {
+      // ldb [8]: the first byte after the UDP header.
+      BPF_STMT(BPF_LD | BPF_B | BPF_ABS, 8),
+      BPF_JUMP(BPF_JMP | BPF_JEQ | BPF_K, 0, 0, 1),
+      BPF_STMT(BPF_RET | BPF_K, 0),
+      BPF_STMT(BPF_RET | BPF_K, 8 + 4),
+  };
+  struct sock_fprog prog = {};
+  prog.len = sizeof(code) / sizeof(code[0]);
+  prog.filter = code;
+  ASSERT_THAT(setsockopt(sockets->second_fd(), SOL_SOCKET, SO_ATTACH_FILTER,
+                         &prog, sizeof(prog)),
+              SyscallSucceeds());
+
+  char dropped[] = {0, 1, 2, 3, 4, 5};
+  ASSERT_THAT(
+      RetryEINTR(send)(sockets->first_fd(), dropped, sizeof(dropped), 0),
+      SyscallSucceedsWithValue(sizeof(dropped)));
+  char delivered[] = {1, 2, 3, 4, 5, 6};
+  ASSERT_THAT(
+      RetryEINTR(send)(sockets->first_fd(), delivered, sizeof(delivered), 0),
+      SyscallSucceedsWithValue(sizeof(delivered)));
+
+  char received[sizeof(delivered)] = {};
+  ASSERT_THAT(RetryEINTR(recv)(sockets->second_fd(), received,
+                               sizeof(received), 0),
+              SyscallSucceedsWithValue(4));
+  EXPECT_EQ(0, memcmp(delivered, received, 4));
+  EXPECT_THAT(RetryEINTR(recv)(sockets->second_fd(), received,
+                               sizeof(received), MSG_DONTWAIT),
+              SyscallFailsWithErrno(EAGAIN));
+
+  ASSERT_THAT(
+      setsockopt(sockets->second_fd(), SOL_SOCKET, SO_DETACH_FILTER, nullptr, 0),
+      SyscallSucceeds());
+  EXPECT_THAT(
+      setsockopt(sockets->second_fd(), SOL_SOCKET, SO_DETACH_FILTER, nullptr, 0),
+      SyscallFailsWithErrno(ENOENT));
+}
+
+TEST_P(UDPSocketPairTest, AttachInvalidFilter) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(NewSocketPair());
+
+  // The program doesn't end with a return.
+  struct sock_filter code[] = {
+      BPF_STMT(BPF_LD | BPF_B | BPF_ABS, 0),
+  };
+  struct sock_fprog prog = {};
+  prog.len = sizeof(code) / sizeof(code[0]);
+  prog.filter = code;
+  EXPECT_THAT(setsockopt(sockets->first_fd(), SOL_SOCKET, SO_ATTACH_FILTER,
+                         &prog, sizeof(prog)),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST_P(UDPSocketPairTest, LockFilter) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(NewSocketPair());
+
+  struct sock_filter code[] = {
+      BPF_STMT(BPF_RET | BPF_K, 0xffffffff),
+  };
+  struct sock_fprog prog = {};
+  prog.len = sizeof(code) / sizeof(code[0]);
+  prog.filter = code;
+  ASSERT_THAT(setsockopt(sockets->first_fd(), SOL_SOCKET, SO_ATTACH_FILTER,
+                         &prog, sizeof(prog)),
+              SyscallSucceeds());
+  ASSERT_THAT(setsockopt(sockets->first_fd(), SOL_SOCKET, SO_LOCK_FILTER,
+                         &kSockOptOn, sizeof(kSockOptOn)),
+              SyscallSucceeds());
+
+  int get = -1;
+  socklen_t get_len = sizeof(get);
+  EXPECT_THAT(getsockopt(sockets->first_fd(), SOL_SOCKET, SO_LOCK_FILTER,
+                         &get, &get_len),
+              SyscallSucceedsWithValue(0));
+  EXPECT_EQ(get_len, sizeof(get));
+  EXPECT_EQ(get, kSockOptOn);
+
+  EXPECT_THAT(setsockopt(sockets->first_fd(), SOL_SOCKET, SO_ATTACH_FILTER,
+                         &prog, sizeof(prog)),
+              SyscallFailsWithErrno(EPERM));
+  EXPECT_THAT(
+      setsockopt(sockets->first_fd(), SOL_SOCKET, SO_DETACH_FILTER, nullptr, 0),
+      SyscallFailsWithErrno(EPERM));
+  EXPECT_THAT(setsockopt(sockets->first_fd(), SOL_SOCKET, SO_LOCK_FILTER,
+                         &kSockOptOff, sizeof(kSockOptOff)),
+              SyscallFailsWithErrno(EPERM));
+}
+
 }  // namespace testing
 }  // namespace gvisor
@@ -14,7 +14,9 @@
 
 #include <ifaddrs.h>
 #include <linux/netlink.h>
+#include <linux/pkt_sched.h>
 #include <linux/rtnetlink.h>
+#include <string.h>
 #include <sys/socket.h>
 #include <sys/types.h>
 #include <unistd.h>
@@ -23,6 +25,7 @@
 #include "gtest/gtest.h"
 #include "test/syscalls/linux/socket_netlink_util.h"
 #include "test/syscalls/linux/socket_test_util.h"
+#include "test/util/capability_util.h"
 #include "test/util/cleanup.h"
 #include "test/util/file_descriptor.h"
 #include "test/util/test_util.h"
@@ -292,6 +295,101 @@ TEST(NetlinkRouteTest, GetAddrDump) {
       }));
 }
 
+TEST(NetlinkRouteTest, GetQdiscDump) {
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket());
+  uint32_t port = ASSERT_NO_ERRNO_AND_VALUE(NetlinkPortID(fd.get()));
+
+  struct request {
+    struct nlmsghdr hdr;
+    struct tcmsg tcm;
+  };
+
+  constexpr uint32_t kSeq = 12345;
+
+  struct request req = {};
+  req.hdr.nlmsg_len = sizeof(req);
+  req.hdr.nlmsg_type = RTM_GETQDISC;
+  req.hdr.nlmsg_flags = NLM_F_REQUEST | NLM_F_DUMP;
+  req.hdr.nlmsg_seq = kSeq;
+  req.tcm.tcm_family = AF_UNSPEC;
+
+  ASSERT_NO_ERRNO(NetlinkRequestResponse(
+      fd, &req, sizeof(req), [&](const struct nlmsghdr* hdr) {
+        EXPECT_THAT(hdr->nlmsg_type, AnyOf(Eq(RTM_NEWQDISC), Eq(NLMSG_DONE)));
+
+        EXPECT_TRUE((hdr->nlmsg_flags & NLM_F_MULTI) == NLM_F_MULTI)
+            << std::hex << hdr->nlmsg_flags;
+
+        EXPECT_EQ(hdr->nlmsg_seq, kSeq);
+        EXPECT_EQ(hdr->nlmsg_pid, port);
+
+        if (hdr->nlmsg_type != RTM_NEWQDISC) {
+          return;
+        }
+
+        // RTM_NEWQDISC contains at least the header and tcmsg.
+        EXPECT_GE(hdr->nlmsg_len, sizeof(*hdr) + sizeof(struct tcmsg));
+
+        // Every interface reports a queueing discipline kind.
+        bool has_kind = false;
+        const struct tcmsg* msg =
+            reinterpret_cast<const struct tcmsg*>(NLMSG_DATA(hdr));
+        int len = hdr->nlmsg_len - NLMSG_LENGTH(sizeof(*msg));
+        for (const struct rtattr* rta = TCA_RTA(msg); RTA_OK(rta, len);
+             rta = RTA_NEXT(rta, len)) {
+          if (rta->rta_type == TCA_KIND) {
+            has_kind = true;
+          }
+        }
+        EXPECT_TRUE(has_kind);
+      }));
+}
+
+TEST(NetlinkRouteTest, NewQdiscUnknownInterfaceAck) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket());
+
+  struct request {
+    struct nlmsghdr hdr;
+    struct tcmsg tcm;
+    char attrs[RTA_SPACE(sizeof("netem"))];
+  };
+
+  constexpr uint32_t kSeq = 12346;
+
+  struct request req = {};
+  req.hdr.nlmsg_len = sizeof(req);
+  req.hdr.nlmsg_type = RTM_NEWQDISC;
+  req.hdr.nlmsg_flags = NLM_F_REQUEST | NLM_F_ACK | NLM_F_CREATE | NLM_F_EXCL;
+  req.hdr.nlmsg_seq = kSeq;
+  req.tcm.tcm_family = AF_UNSPEC;
+  req.tcm.tcm_ifindex = 0x7fffffff;
+  req.tcm.tcm_parent = TC_H_ROOT;
+  struct rtattr* rta = reinterpret_cast<struct rtattr*>(req.attrs);
+  rta->rta_type = TCA_KIND;
+  rta->rta_len = RTA_LENGTH(sizeof("netem"));
+  memcpy(RTA_DATA(rta), "netem", sizeof("netem"));
+
+  ASSERT_THAT(RetryEINTR(send)(fd.get(), &req, sizeof(req), 0),
+              SyscallSucceedsWithValue(sizeof(req)));
+
+  // The error is reported in the acknowledgement.
+  char buf[4096];
+  int len;
+  ASSERT_THAT(len = RetryEINTR(recv)(fd.get(), buf, sizeof(buf), 0),
+              SyscallSucceeds());
+  const struct nlmsghdr* hdr = reinterpret_cast<const struct nlmsghdr*>(buf);
+  ASSERT_TRUE(NLMSG_OK(hdr, len));
+  EXPECT_EQ(hdr->nlmsg_type, NLMSG_ERROR);
+  EXPECT_EQ(hdr->nlmsg_seq, kSeq);
+  ASSERT_GE(hdr->nlmsg_len, NLMSG_LENGTH(sizeof(struct nlmsgerr)));
+  const struct nlmsgerr* err =
+      reinterpret_cast<const struct nlmsgerr*>(NLMSG_DATA(hdr));
+  EXPECT_EQ(err->error, -ENODEV);
+  EXPECT_EQ(err->msg.nlmsg_seq, kSeq);
+}
+
 TEST(NetlinkRouteTest, LookupAll) {
   struct ifaddrs* if_addr_list = nullptr;
   auto cleanup = Cleanup([&if_addr_list]() { freeifaddrs(if_addr_list); });
@@ -0,0 +1,170 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <linux/inet_diag.h>
+#include <linux/netlink.h>
+#include <linux/rtnetlink.h>
+#include <linux/sock_diag.h>
+#include <linux/unix_diag.h>
+#include <netinet/in.h>
+#include <netinet/tcp.h>
+#include <string.h>
+#include <sys/socket.h>
+#include <sys/stat.h>
+#include <sys/types.h>
+
+#include "gtest/gtest.h"
+#include "test/syscalls/linux/socket_netlink_util.h"
+#include "test/syscalls/linux/socket_test_util.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/test_util.h"
+
+// Tests for NETLINK_SOCK_DIAG sockets.
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+using ::testing::AnyOf;
+using ::testing::Eq;
+
+// Returns the inode number of the socket fd.
+ino_t SocketInode(int fd) {
+  struct stat st;
+  EXPECT_THAT(fstat(fd, &st), SyscallSucceeds());
+  return st.st_ino;
+}
+
+TEST(NetlinkSockDiagTest, UnixPeers) {
+  int sv[2];
+  ASSERT_THAT(socketpair(AF_UNIX, SOCK_STREAM, 0, sv), SyscallSucceeds());
+  FileDescriptor first(sv[0]);
+  FileDescriptor second(sv[1]);
+  const uint32_t first_ino = SocketInode(first.get());
+  const uint32_t second_ino = SocketInode(second.get());
+
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(
+      Socket(AF_NETLINK, SOCK_RAW, NETLINK_SOCK_DIAG));
+
+  struct request {
+    struct nlmsghdr hdr;
+    struct unix_diag_req req;
+  };
+
+  struct request req = {};
+  req.hdr.nlmsg_len = sizeof(req);
+  req.hdr.nlmsg_type = SOCK_DIAG_BY_FAMILY;
+  req.hdr.nlmsg_flags = NLM_F_REQUEST | NLM_F_DUMP;
+  req.req.sdiag_family = AF_UNIX;
+  req.req.udiag_states = ~0;
+  req.req.udiag_show = UDIAG_SHOW_PEER;
+
+  uint32_t first_peer = 0;
+  uint32_t second_peer = 0;
+  ASSERT_NO_ERRNO(NetlinkRequestResponse(
+      fd, &req, sizeof(req), [&](const struct nlmsghdr* hdr) {
+        EXPECT_THAT(hdr->nlmsg_type,
+                    AnyOf(Eq(SOCK_DIAG_BY_FAMILY), Eq(NLMSG_DONE)));
+        if (hdr->nlmsg_type != SOCK_DIAG_BY_FAMILY) {
+          return;
+        }
+        const struct unix_diag_msg* msg =
+            reinterpret_cast<const struct unix_diag_msg*>(NLMSG_DATA(hdr));
+        if (msg->udiag_ino != first_ino && msg->udiag_ino != second_ino) {
+          return;
+        }
+        EXPECT_EQ(msg->udiag_type, SOCK_STREAM);
+        EXPECT_EQ(msg->udiag_state, TCP_ESTABLISHED);
+
+        int len = hdr->nlmsg_len - NLMSG_LENGTH(sizeof(*msg));
+        for (const struct rtattr* attr = reinterpret_cast<const struct rtattr*>(
+                 reinterpret_cast<const char*>(msg) + sizeof(*msg));
+             RTA_OK(attr, len); attr = RTA_NEXT(attr, len)) {
+          if (attr->rta_type != UNIX_DIAG_PEER) {
+            continue;
+          }
+          uint32_t peer;
+          memcpy(&peer, RTA_DATA(attr), sizeof(peer));
+          if (msg->udiag_ino == first_ino) {
+            first_peer = peer;
+          } else {
+            second_peer = peer;
+          }
+        }
+      }));
+
+  EXPECT_EQ(first_peer, second_ino);
+  EXPECT_EQ(second_peer, first_ino);
+}
+
+TEST(NetlinkSockDiagTest, TCPListen) {
+  FileDescriptor listener =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_INET, SOCK_STREAM, IPPROTO_TCP));
+  struct sockaddr_in addr = {};
+  addr.sin_family = AF_INET;
+  addr.sin_addr.s_addr = htonl(INADDR_LOOPBACK);
+  ASSERT_THAT(bind(listener.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                   sizeof(addr)),
+              SyscallSucceeds());
+  ASSERT_THAT(listen(listener.get(), SOMAXCONN), SyscallSucceeds());
+  socklen_t addrlen = sizeof(addr);
+  ASSERT_THAT(getsockname(listener.get(),
+                          reinterpret_cast<struct sockaddr*>(&addr), &addrlen),
+              SyscallSucceeds());
+  const uint32_t ino = SocketInode(listener.get());
+
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(
+      Socket(AF_NETLINK, SOCK_RAW, NETLINK_SOCK_DIAG));
+
+  struct request {
+    struct nlmsghdr hdr;
+    struct inet_diag_req_v2 req;
+  };
+
+  struct request req = {};
+  req.hdr.nlmsg_len = sizeof(req);
+  req.hdr.nlmsg_type = SOCK_DIAG_BY_FAMILY;
+  req.hdr.nlmsg_flags = NLM_F_REQUEST | NLM_F_DUMP;
+  req.req.sdiag_family = AF_INET;
+  req.req.sdiag_protocol = IPPROTO_TCP;
+  req.req.idiag_states = 1 << TCP_LISTEN;
+
+  bool found = false;
+  ASSERT_NO_ERRNO(NetlinkRequestResponse(
+      fd, &req, sizeof(req), [&](const struct nlmsghdr* hdr) {
+        EXPECT_THAT(hdr->nlmsg_type,
+                    AnyOf(Eq(SOCK_DIAG_BY_FAMILY), Eq(NLMSG_DONE)));
+        if (hdr->nlmsg_type != SOCK_DIAG_BY_FAMILY) {
+          return;
+        }
+        const struct inet_diag_msg* msg =
+            reinterpret_cast<const struct inet_diag_msg*>(NLMSG_DATA(hdr));
+        EXPECT_EQ(msg->idiag_family, AF_INET);
+        EXPECT_EQ(msg->idiag_state, TCP_LISTEN);
+        if (msg->idiag_inode != ino) {
+          return;
+        }
+        found = true;
+        EXPECT_EQ(msg->id.idiag_sport, addr.sin_port);
+        EXPECT_EQ(msg->id.idiag_src[0], addr.sin_addr.s_addr);
+      }));
+
+  EXPECT_TRUE(found);
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
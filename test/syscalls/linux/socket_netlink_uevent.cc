@@ -0,0 +1,132 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <linux/netlink.h>
+#include <string.h>
+#include <sys/socket.h>
+#include <sys/types.h>
+#include <string>
+#include <vector>
+
+#include "gtest/gtest.h"
+#include "test/syscalls/linux/socket_test_util.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/test_util.h"
+
+// Tests for NETLINK_KOBJECT_UEVENT sockets.
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+// Returns a NETLINK_KOBJECT_UEVENT socket bound to the kernel's multicast
+// group.
+PosixErrorOr<FileDescriptor> UeventSocket() {
+  FileDescriptor fd;
+  ASSIGN_OR_RETURN_ERRNO(
+      fd, Socket(AF_NETLINK, SOCK_RAW | SOCK_NONBLOCK, NETLINK_KOBJECT_UEVENT));
+
+  struct sockaddr_nl addr = {};
+  addr.nl_family = AF_NETLINK;
+  addr.nl_groups = 1;
+  RETURN_ERROR_IF_SYSCALL_FAIL(
+      bind(fd.get(), reinterpret_cast<struct sockaddr*>(&addr), sizeof(addr)));
+
+  return std::move(fd);
+}
+
+TEST(NetlinkUeventTest, BindGroups) {
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(UeventSocket());
+
+  struct sockaddr_nl addr;
+  socklen_t addrlen = sizeof(addr);
+  ASSERT_THAT(getsockname(fd.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                          &addrlen),
+              SyscallSucceeds());
+  EXPECT_EQ(addrlen, sizeof(addr));
+  EXPECT_EQ(addr.nl_family, AF_NETLINK);
+  EXPECT_EQ(addr.nl_groups, 1);
+}
+
+TEST(NetlinkUeventTest, AddMembership) {
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(
+      Socket(AF_NETLINK, SOCK_RAW, NETLINK_KOBJECT_UEVENT));
+
+  int group = 2;
+  ASSERT_THAT(setsockopt(fd.get(), SOL_NETLINK, NETLINK_ADD_MEMBERSHIP, &group,
+                         sizeof(group)),
+              SyscallSucceeds());
+
+  struct sockaddr_nl addr;
+  socklen_t addrlen = sizeof(addr);
+  ASSERT_THAT(getsockname(fd.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                          &addrlen),
+              SyscallSucceeds());
+  EXPECT_EQ(addr.nl_groups, 1 << (group - 1));
+
+  ASSERT_THAT(setsockopt(fd.get(), SOL_NETLINK, NETLINK_DROP_MEMBERSHIP,
+                         &group, sizeof(group)),
+              SyscallSucceeds());
+  ASSERT_THAT(getsockname(fd.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                          &addrlen),
+              SyscallSucceeds());
+  EXPECT_EQ(addr.nl_groups, 0);
+}
+
+TEST(NetlinkUeventTest, PassCred) {
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(UeventSocket());
+
+  int one = 1;
+  ASSERT_THAT(
+      setsockopt(fd.get(), SOL_SOCKET, SO_PASSCRED, &one, sizeof(one)),
+      SyscallSucceeds());
+
+  int val = 0;
+  socklen_t len = sizeof(val);
+  ASSERT_THAT(getsockopt(fd.get(), SOL_SOCKET, SO_PASSCRED, &val, &len),
+              SyscallSucceeds());
+  EXPECT_EQ(val, 1);
+}
+
+// The sentry announces its devices to sockets joining the kernel's group.
+TEST(NetlinkUeventTest, Coldplug) {
+  SKIP_IF(!IsRunningOnGvisor());
+
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(UeventSocket());
+
+  bool found = false;
+  std::vector<char> buf(4096);
+  int n;
+  while ((n = recv(fd.get(), buf.data(), buf.size(), 0)) > 0) {
+    std::string event(buf.data(), n);
+    if (strcmp(event.c_str(), "add@/devices/virtual/mem/null") != 0) {
+      continue;
+    }
+    found = true;
+    EXPECT_NE(event.find(std::string("\0ACTION=add\0", 12)),
+              std::string::npos);
+    EXPECT_NE(event.find(std::string("\0SUBSYSTEM=mem\0", 15)),
+              std::string::npos);
+    EXPECT_NE(event.find(std::string("\0MAJOR=1\0MINOR=3\0", 17)),
+              std::string::npos);
+  }
+  EXPECT_THAT(n, SyscallFailsWithErrno(EAGAIN));
+  EXPECT_TRUE(found);
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
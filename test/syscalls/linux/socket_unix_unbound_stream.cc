@@ -13,6 +13,7 @@
 // limitations under the License.
 
 #include <stdio.h>
+#include <sys/ioctl.h>
 #include <sys/un.h>
 #include "gtest/gtest.h"
 #include "gtest/gtest.h"
@@ -715,6 +716,26 @@ TEST_P(UnboundUnixStreamSocketPairTest, SendtoWithoutConnectIgnoresAddr) {
       SyscallFailsWithErrno(EOPNOTSUPP));
 }
 
+TEST_P(UnboundUnixStreamSocketPairTest, QueueSizeIoctls) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(NewSocketPair());
+
+  // Nothing is queued on an unconnected socket.
+  int size = -1;
+  EXPECT_THAT(ioctl(sockets->first_fd(), TIOCINQ, &size), SyscallSucceeds());
+  EXPECT_EQ(size, 0);
+  size = -1;
+  EXPECT_THAT(ioctl(sockets->first_fd(), TIOCOUTQ, &size), SyscallSucceeds());
+  EXPECT_EQ(size, 0);
+
+  // A listening socket has no receive queue.
+  ASSERT_THAT(bind(sockets->first_fd(), sockets->first_addr(),
+                   sockets->first_addr_size()),
+              SyscallSucceeds());
+  ASSERT_THAT(listen(sockets->first_fd(), 5), SyscallSucceeds());
+  EXPECT_THAT(ioctl(sockets->first_fd(), TIOCINQ, &size),
+              SyscallFailsWithErrno(EINVAL));
+}
+
 INSTANTIATE_TEST_CASE_P(
     AllUnixDomainSockets, UnboundUnixStreamSocketPairTest,
     ::testing::ValuesIn(IncludeReversals(VecCat<SocketPairKind>(
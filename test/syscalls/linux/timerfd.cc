@@ -28,6 +28,10 @@ namespace testing {
 
 namespace {
 
+#ifndef TFD_TIMER_CANCEL_ON_SET
+#define TFD_TIMER_CANCEL_ON_SET (1 << 1)
+#endif
+
 // Wrapper around timerfd_create(2) that returns a FileDescriptor.
 PosixErrorOr<FileDescriptor> TimerfdCreate(int clockid, int flags) {
   int fd = timerfd_create(clockid, flags);
@@ -220,6 +224,63 @@ TEST(TimerfdTest, ClockRealtime) {
   EXPECT_EQ(1, val);
 }
 
+TEST(TimerfdTest, ClockBoottime) {
+  constexpr absl::Duration kDelay = absl::Seconds(1);
+
+  auto const tfd = ASSERT_NO_ERRNO_AND_VALUE(TimerfdCreate(CLOCK_BOOTTIME, 0));
+  struct itimerspec its = {};
+  its.it_value = absl::ToTimespec(kDelay);
+  ASSERT_THAT(timerfd_settime(tfd.get(), /* flags = */ 0, &its, nullptr),
+              SyscallSucceeds());
+
+  uint64_t val = 0;
+  ASSERT_THAT(ReadFd(tfd.get(), &val, sizeof(uint64_t)),
+              SyscallSucceedsWithValue(sizeof(uint64_t)));
+  EXPECT_EQ(1, val);
+}
+
+// A cancelable timer expires normally if the clock is not set.
+TEST(TimerfdTest, CancelOnSetExpires) {
+  constexpr int kDelaySecs = 1;
+
+  auto const tfd = ASSERT_NO_ERRNO_AND_VALUE(TimerfdCreate(CLOCK_REALTIME, 0));
+  struct itimerspec its = {};
+  ASSERT_THAT(clock_gettime(CLOCK_REALTIME, &its.it_value), SyscallSucceeds());
+  its.it_value.tv_sec += kDelaySecs;
+  ASSERT_THAT(timerfd_settime(tfd.get(),
+                              TFD_TIMER_ABSTIME | TFD_TIMER_CANCEL_ON_SET, &its,
+                              nullptr),
+              SyscallSucceeds());
+
+  uint64_t val = 0;
+  ASSERT_THAT(ReadFd(tfd.get(), &val, sizeof(uint64_t)),
+              SyscallSucceedsWithValue(sizeof(uint64_t)));
+  EXPECT_EQ(1, val);
+}
+
+// TFD_TIMER_CANCEL_ON_SET is ignored for relative timers and other clocks.
+TEST(TimerfdTest, CancelOnSetIgnored) {
+  auto const tfd =
+      ASSERT_NO_ERRNO_AND_VALUE(TimerfdCreate(CLOCK_MONOTONIC, TFD_NONBLOCK));
+  struct itimerspec its = {};
+  its.it_value.tv_sec = 1;
+  EXPECT_THAT(
+      timerfd_settime(tfd.get(), TFD_TIMER_CANCEL_ON_SET, &its, nullptr),
+      SyscallSucceeds());
+  EXPECT_THAT(timerfd_settime(tfd.get(),
+                              TFD_TIMER_ABSTIME | TFD_TIMER_CANCEL_ON_SET, &its,
+                              nullptr),
+              SyscallSucceeds());
+}
+
+TEST(TimerfdTest, SettimeInvalidFlags) {
+  auto const tfd =
+      ASSERT_NO_ERRNO_AND_VALUE(TimerfdCreate(CLOCK_MONOTONIC, TFD_NONBLOCK));
+  struct itimerspec its = {};
+  EXPECT_THAT(timerfd_settime(tfd.get(), 0x4, &its, nullptr),
+              SyscallFailsWithErrno(EINVAL));
+}
+
 TEST(TimerfdTest, IllegalReadWrite) {
   auto const tfd =
       ASSERT_NO_ERRNO_AND_VALUE(TimerfdCreate(CLOCK_MONOTONIC, TFD_NONBLOCK));
@@ -446,6 +446,86 @@ TEST(IntervalTimerTest, PeriodicThreadDirectedSignal) {
   sigtimedwait(&mask, &si, &zero_ts);
 }
 
+// Consumes CPU time on the calling thread until its CPU clock has advanced by
+// at least d.
+void SpinForThreadCPUTime(absl::Duration d) {
+  struct timespec ts;
+  TEST_PCHECK(clock_gettime(CLOCK_THREAD_CPUTIME_ID, &ts) == 0);
+  const absl::Duration end = absl::DurationFromTimespec(ts) + d;
+  do {
+    TEST_PCHECK(clock_gettime(CLOCK_THREAD_CPUTIME_ID, &ts) == 0);
+  } while (absl::DurationFromTimespec(ts) < end);
+}
+
+TEST(IntervalTimerTest, ThreadCPUClockThreadDirectedSignal) {
+  constexpr int kSigno = SIGPROF;
+  constexpr int kSigvalue = 42;
+
+  // Block kSigno so that we can accumulate overruns.
+  sigset_t mask;
+  sigemptyset(&mask);
+  sigaddset(&mask, kSigno);
+  const auto scoped_sigmask =
+      ASSERT_NO_ERRNO_AND_VALUE(ScopedSignalMask(SIG_BLOCK, mask));
+
+  struct sigevent sev = {};
+  sev.sigev_notify = SIGEV_THREAD_ID;
+  sev.sigev_signo = kSigno;
+  sev.sigev_value.sival_int = kSigvalue;
+  sev.sigev_notify_thread_id = gettid();
+  auto timer =
+      ASSERT_NO_ERRNO_AND_VALUE(TimerCreate(CLOCK_THREAD_CPUTIME_ID, sev));
+
+  constexpr absl::Duration kPeriod = absl::Milliseconds(100);
+  constexpr int kCycles = 3;
+  struct itimerspec its = {};
+  its.it_value = its.it_interval = absl::ToTimespec(kPeriod);
+  ASSERT_NO_ERRNO(timer.Set(0, its));
+  SpinForThreadCPUTime(kPeriod * kCycles);
+
+  // The timer measures this thread's CPU time, so at least kCycles
+  // expirations have occurred by now, resulting in at least kCycles-1
+  // overruns.
+  siginfo_t si;
+  struct timespec zero_ts = absl::ToTimespec(absl::ZeroDuration());
+  ASSERT_THAT(sigtimedwait(&mask, &si, &zero_ts),
+              SyscallSucceedsWithValue(kSigno));
+  EXPECT_EQ(si.si_signo, kSigno);
+  EXPECT_EQ(si.si_code, SI_TIMER);
+  EXPECT_EQ(si.si_timerid, timer.get());
+  EXPECT_GE(si.si_overrun, kCycles - 1);
+  EXPECT_EQ(si.si_int, kSigvalue);
+
+  // timer_getoverrun reports the overrun count of the dequeued signal.
+  EXPECT_THAT(timer.Overruns(), IsPosixErrorOkAndHolds(si.si_overrun));
+
+  timer.reset();
+  sigtimedwait(&mask, &si, &zero_ts);
+}
+
+TEST(IntervalTimerTest, ThreadCPUClockTimerDisarmedOnThreadExit) {
+  // Create and arm a timer on another thread's CPU clock, then let that
+  // thread exit.
+  int id = -1;
+  ScopedThread([&] {
+    struct sigevent sev = {};
+    sev.sigev_notify = SIGEV_NONE;
+    auto timer = TimerCreate(CLOCK_THREAD_CPUTIME_ID, sev);
+    TEST_CHECK(timer.ok());
+    struct itimerspec its = {};
+    its.it_value = its.it_interval = absl::ToTimespec(absl::Seconds(1));
+    TEST_CHECK(timer.ValueOrDie().Set(0, its).ok());
+    id = timer.ValueOrDie().release();
+  }).Join();
+
+  // The timer still exists, but its clock can no longer advance, so it has
+  // been disarmed.
+  IntervalTimer timer(id);
+  const struct itimerspec its = ASSERT_NO_ERRNO_AND_VALUE(timer.Get());
+  EXPECT_EQ(0, its.it_value.tv_sec);
+  EXPECT_EQ(0, its.it_value.tv_nsec);
+}
+
 TEST(IntervalTimerTest, OtherThreadGroup) {
   constexpr int kSigno = SIGUSR1;
 
@@ -821,6 +821,27 @@ TEST_P(UdpSocketTest, FIONREAD) {
   }
 }
 
+TEST_P(UdpSocketTest, TIOCOUTQ) {
+  // Datagrams are never queued for sending.
+  int n = -1;
+  EXPECT_THAT(ioctl(t_, TIOCOUTQ, &n), SyscallSucceedsWithValue(0));
+  EXPECT_EQ(n, 0);
+
+  ASSERT_THAT(bind(s_, addr_[0], addrlen_), SyscallSucceeds());
+  char buf[100];
+  RandomizeBuffer(buf, sizeof(buf));
+  ASSERT_THAT(sendto(t_, buf, sizeof(buf), 0, addr_[0], addrlen_),
+              SyscallSucceedsWithValue(sizeof(buf)));
+
+  SKIP_IF(!IsRunningOnGvisor());
+
+  // Linux reports the memory used by datagrams that have not been freed by
+  // the device yet.
+  n = -1;
+  EXPECT_THAT(ioctl(t_, TIOCOUTQ, &n), SyscallSucceedsWithValue(0));
+  EXPECT_EQ(n, 0);
+}
+
 TEST_P(UdpSocketTest, FIONREADZeroLengthPacket) {
   // Bind s_ to loopback:TestPort.
   ASSERT_THAT(bind(s_, addr_[0], addrlen_), SyscallSucceeds());
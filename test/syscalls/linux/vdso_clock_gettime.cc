@@ -39,6 +39,10 @@ std::string PrintClockId(::testing::TestParamInfo<clockid_t> info) {
       return "CLOCK_MONOTONIC";
     case CLOCK_REALTIME:
       return "CLOCK_REALTIME";
+    case CLOCK_MONOTONIC_COARSE:
+      return "CLOCK_MONOTONIC_COARSE";
+    case CLOCK_MONOTONIC_RAW:
+      return "CLOCK_MONOTONIC_RAW";
     default:
       return absl::StrCat(info.param);
   }
@@ -98,6 +102,33 @@ INSTANTIATE_TEST_CASE_P(ClockGettime, CorrectVDSOClockTest,
                         ::testing::Values(CLOCK_MONOTONIC, CLOCK_REALTIME),
                         PrintClockId);
 
+// The VDSO time for clocks that share parameters with CLOCK_MONOTONIC must be
+// between the system times read immediately before and after it.
+class OrderedVDSOClockTest : public ::testing::TestWithParam<clockid_t> {};
+
+TEST_P(OrderedVDSOClockTest, IsOrdered) {
+  for (int i = 0; i < 1000; i++) {
+    struct timespec tbefore, tvdso, tafter;
+    ASSERT_THAT(syscall(__NR_clock_gettime, CLOCK_MONOTONIC, &tbefore),
+                SyscallSucceeds());
+    ASSERT_THAT(clock_gettime(GetParam(), &tvdso), SyscallSucceeds());
+    ASSERT_THAT(syscall(__NR_clock_gettime, CLOCK_MONOTONIC, &tafter),
+                SyscallSucceeds());
+
+    // Allow for the same skew tolerated by CorrectVDSOClockTest.
+    absl::Time vdso_time = absl::TimeFromTimespec(tvdso);
+    EXPECT_GE(vdso_time,
+              absl::TimeFromTimespec(tbefore) - absl::Milliseconds(1));
+    EXPECT_LE(vdso_time,
+              absl::TimeFromTimespec(tafter) + absl::Milliseconds(1));
+  }
+}
+
+INSTANTIATE_TEST_CASE_P(ClockGettime, OrderedVDSOClockTest,
+                        ::testing::Values(CLOCK_MONOTONIC_COARSE,
+                                          CLOCK_MONOTONIC_RAW),
+                        PrintClockId);
+
 }  // namespace
 
 }  // namespace testing
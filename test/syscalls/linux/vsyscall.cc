@@ -13,6 +13,7 @@
 // limitations under the License.
 
 #include <errno.h>
+#include <signal.h>
 #include <time.h>
 
 #include "gtest/gtest.h"
@@ -31,13 +32,20 @@ time_t vsyscall_time(time_t* t) {
 
 TEST(VsyscallTest, VsyscallAlwaysAvailableOnGvisor) {
   SKIP_IF(!IsRunningOnGvisor());
-  // Vsyscall is always advertised by gvisor.
+  // Vsyscall is advertised by gvisor unless disabled with --vsyscall=none,
+  // which tests don't use.
   EXPECT_TRUE(ASSERT_NO_ERRNO_AND_VALUE(IsVsyscallEnabled()));
   // Vsyscall should always works on gvisor.
   time_t t;
   EXPECT_THAT(vsyscall_time(&t), SyscallSucceeds());
 }
 
+TEST(VsyscallTest, VsyscallFaultsIfNotAdvertised) {
+  SKIP_IF(ASSERT_NO_ERRNO_AND_VALUE(IsVsyscallEnabled()));
+  // Without a vsyscall page (vsyscall=none), calls to it fault.
+  EXPECT_EXIT(vsyscall_time(nullptr), ::testing::KilledBySignal(SIGSEGV), "");
+}
+
 }  // namespace
 
 }  // namespace testing
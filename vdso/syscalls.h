@@ -39,6 +39,24 @@ static inline int sys_clock_gettime(clockid_t clock, struct timespec* ts) {
   return num;
 }
 
+static inline int sys_clock_getres(clockid_t clock, struct timespec* res) {
+  int num = __NR_clock_getres;
+  asm volatile("syscall\n"
+               : "+a"(num)
+               : "D"(clock), "S"(res)
+               : "rcx", "r11", "memory");
+  return num;
+}
+
+static inline long sys_getrandom(void* buf, size_t len, unsigned int flags) {
+  long num = __NR_getrandom;
+  asm volatile("syscall\n"
+               : "+a"(num)
+               : "D"(buf), "S"(len), "d"(flags)
+               : "rcx", "r11", "memory");
+  return num;
+}
+
 static inline int sys_getcpu(unsigned* cpu, unsigned* node,
                              struct getcpu_cache* cache) {
   int num = __NR_getcpu;
@@ -20,6 +20,7 @@
 #include <time.h>
 
 #include "vdso/syscalls.h"
+#include "vdso/vdso_getrandom.h"
 #include "vdso/vdso_time.h"
 
 namespace vdso {
@@ -29,11 +30,21 @@ extern "C" int __vdso_clock_gettime(clockid_t clock, struct timespec* ts) {
   int ret;
 
   switch (clock) {
+    // The sandbox kernel does not distinguish the coarse clocks from their
+    // precise counterparts, and approximates CLOCK_MONOTONIC_RAW with
+    // CLOCK_MONOTONIC. CLOCK_TAI has a zero offset from CLOCK_REALTIME, and
+    // CLOCK_BOOTTIME is identical to CLOCK_MONOTONIC since the sandbox is
+    // never suspended.
     case CLOCK_REALTIME:
+    case CLOCK_REALTIME_COARSE:
+    case CLOCK_TAI:
       ret = ClockRealtime(ts);
       break;
 
     case CLOCK_MONOTONIC:
+    case CLOCK_MONOTONIC_COARSE:
+    case CLOCK_MONOTONIC_RAW:
+    case CLOCK_BOOTTIME:
       ret = ClockMonotonic(ts);
       break;
 
@@ -47,6 +58,30 @@ extern "C" int __vdso_clock_gettime(clockid_t clock, struct timespec* ts) {
 extern "C" int clock_gettime(clockid_t clock, struct timespec* ts)
     __attribute__((weak, alias("__vdso_clock_gettime")));
 
+// __vdso_clock_getres() implements clock_getres()
+extern "C" int __vdso_clock_getres(clockid_t clock, struct timespec* res) {
+  switch (clock) {
+    case CLOCK_REALTIME:
+    case CLOCK_REALTIME_COARSE:
+    case CLOCK_MONOTONIC:
+    case CLOCK_MONOTONIC_COARSE:
+    case CLOCK_MONOTONIC_RAW:
+    case CLOCK_BOOTTIME:
+    case CLOCK_TAI:
+      // All clocks have 1ns resolution, as in the sandbox kernel.
+      if (res) {
+        res->tv_sec = 0;
+        res->tv_nsec = 1;
+      }
+      return 0;
+
+    default:
+      return sys_clock_getres(clock, res);
+  }
+}
+extern "C" int clock_getres(clockid_t clock, struct timespec* res)
+    __attribute__((weak, alias("__vdso_clock_getres")));
+
 // __vdso_gettimeofday() implements gettimeofday()
 extern "C" int __vdso_gettimeofday(struct timeval* tv, struct timezone* tz) {
   if (tv) {
@@ -92,4 +127,11 @@ extern "C" long getcpu(unsigned* cpu, unsigned* node,
                        struct getcpu_cache* cache)
     __attribute__((weak, alias("__vdso_getcpu")));
 
+// __vdso_getrandom() implements getrandom()
+extern "C" ssize_t __vdso_getrandom(void* buffer, size_t len,
+                                    unsigned int flags, void* opaque_state,
+                                    size_t opaque_len) {
+  return GetRandom(buffer, len, flags, opaque_state, opaque_len);
+}
+
 }  // namespace vdso
@@ -0,0 +1,264 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include "vdso/vdso_getrandom.h"
+
+#include <stddef.h>
+#include <stdint.h>
+#include <sys/mman.h>
+#include <sys/types.h>
+
+#include "vdso/barrier.h"
+#include "vdso/compiler.h"
+#include "vdso/params.h"
+#include "vdso/seqlock.h"
+#include "vdso/syscalls.h"
+
+namespace vdso {
+
+namespace {
+
+// Flags for getrandom(2).
+const unsigned int kGrndNonblock = 0x1;
+
+// mmap(2) flags for the opaque states. MAP_DROPPABLE mappings are wiped on
+// fork, so a child never reuses its parent's keys. It is defined here since
+// older libc headers lack it.
+const unsigned int kMapDroppable = 0x08;
+
+const size_t kChaChaBlockSize = 64;
+const size_t kChaChaKeySize = 32;
+
+// Each refill generates kRefillBlocks blocks of ChaCha20 output, the first
+// kChaChaKeySize bytes of which replace the key ("fast key erasure"), while
+// the remainder are returned to the caller.
+const size_t kRefillBlocks = 4;
+const size_t kBatchSize = kRefillBlocks * kChaChaBlockSize - kChaChaKeySize;
+
+// state is the opaque per-thread state passed to __vdso_getrandom by libc.
+struct state {
+  // batch holds random bytes. Bytes before pos have already been returned
+  // and are zeroed.
+  uint8_t batch[kBatchSize];
+
+  // key is the ChaCha20 key used for the next refill.
+  uint32_t key[kChaChaKeySize / 4];
+
+  // generation is the value of params.rng_generation when key was
+  // obtained from the kernel.
+  uint64_t generation;
+
+  // pos is the offset of the next unused byte in batch.
+  uint32_t pos;
+
+  // keyed is non-zero if key is valid. Zeroed (i.e. new or wiped on fork)
+  // states are not keyed.
+  uint8_t keyed;
+
+  // in_use is non-zero while the state is being used, so that a signal
+  // handler reentering __vdso_getrandom with the same state falls back to
+  // the system call.
+  uint8_t in_use;
+};
+
+// opaque_params is returned to libc to describe how to allocate states. It
+// must match struct vgetrandom_opaque_params in Linux.
+struct opaque_params {
+  uint32_t size_of_opaque_state;
+  uint32_t mmap_prot;
+  uint32_t mmap_flags;
+  uint32_t reserved[13];
+};
+
+inline uint32_t rotl32(uint32_t v, int c) { return (v << c) | (v >> (32 - c)); }
+
+inline void quarter_round(uint32_t* x, int a, int b, int c, int d) {
+  x[a] += x[b];
+  x[d] = rotl32(x[d] ^ x[a], 16);
+  x[c] += x[d];
+  x[b] = rotl32(x[b] ^ x[c], 12);
+  x[a] += x[b];
+  x[d] = rotl32(x[d] ^ x[a], 8);
+  x[c] += x[d];
+  x[b] = rotl32(x[b] ^ x[c], 7);
+}
+
+// chacha20_block writes the ChaCha20 block for key and counter, with a zero
+// nonce, to out.
+void chacha20_block(const uint32_t* key, uint32_t counter, uint8_t* out) {
+  uint32_t in[16];
+  in[0] = 0x61707865;  // "expand 32-byte k"
+  in[1] = 0x3320646e;
+  in[2] = 0x79622d32;
+  in[3] = 0x6b206574;
+  for (int i = 0; i < 8; i++) {
+    in[4 + i] = key[i];
+  }
+  in[12] = counter;
+  in[13] = 0;
+  in[14] = 0;
+  in[15] = 0;
+
+  uint32_t x[16];
+  for (int i = 0; i < 16; i++) {
+    x[i] = in[i];
+  }
+  for (int i = 0; i < 10; i++) {
+    quarter_round(x, 0, 4, 8, 12);
+    quarter_round(x, 1, 5, 9, 13);
+    quarter_round(x, 2, 6, 10, 14);
+    quarter_round(x, 3, 7, 11, 15);
+    quarter_round(x, 0, 5, 10, 15);
+    quarter_round(x, 1, 6, 11, 12);
+    quarter_round(x, 2, 7, 8, 13);
+    quarter_round(x, 3, 4, 9, 14);
+  }
+  for (int i = 0; i < 16; i++) {
+    uint32_t v = x[i] + in[i];
+    out[4 * i + 0] = v;
+    out[4 * i + 1] = v >> 8;
+    out[4 * i + 2] = v >> 16;
+    out[4 * i + 3] = v >> 24;
+  }
+}
+
+// zero clears n bytes at p. Writes are volatile so that they are neither
+// elided nor turned into a call to memset, which is unavailable in the VDSO.
+inline void zero(void* p, size_t n) {
+  volatile uint8_t* b = static_cast<volatile uint8_t*>(p);
+  for (size_t i = 0; i < n; i++) {
+    b[i] = 0;
+  }
+}
+
+// refill replaces the key and batch of s with new ChaCha20 output.
+void refill(struct state* s) {
+  uint8_t out[kRefillBlocks * kChaChaBlockSize];
+  for (uint32_t i = 0; i < kRefillBlocks; i++) {
+    chacha20_block(s->key, i, &out[i * kChaChaBlockSize]);
+  }
+  for (size_t i = 0; i < kChaChaKeySize / 4; i++) {
+    s->key[i] = out[4 * i] | (out[4 * i + 1] << 8) | (out[4 * i + 2] << 16) |
+                (static_cast<uint32_t>(out[4 * i + 3]) << 24);
+  }
+  volatile uint8_t* batch = s->batch;
+  for (size_t i = 0; i < kBatchSize; i++) {
+    batch[i] = out[kChaChaKeySize + i];
+  }
+  zero(out, sizeof(out));
+  s->pos = 0;
+}
+
+// rekey obtains a new key for s from the kernel. It returns false if the
+// kernel could not provide one without blocking.
+bool rekey(struct state* s, uint64_t generation) {
+  uint32_t key[kChaChaKeySize / 4];
+  if (sys_getrandom(key, sizeof(key), kGrndNonblock) != sizeof(key)) {
+    return false;
+  }
+  for (size_t i = 0; i < kChaChaKeySize / 4; i++) {
+    s->key[i] = key[i];
+  }
+  zero(key, sizeof(key));
+  zero(s->batch, sizeof(s->batch));
+  s->pos = kBatchSize;
+  s->generation = generation;
+  s->keyed = 1;
+  return true;
+}
+
+// rng_generation returns the current generation of the kernel random number
+// generator.
+uint64_t rng_generation() {
+  struct params* params = get_params();
+  uint64_t seq;
+  uint64_t generation;
+  do {
+    seq = read_seqcount_begin(&params->seq_count);
+    generation = params->rng_generation;
+  } while (read_seqcount_retry(&params->seq_count, seq));
+  return generation;
+}
+
+}  // namespace
+
+// GetRandom() is the VDSO implementation of getrandom(), using the interface
+// of Linux's vgetrandom.
+//
+// Random bytes are generated in userspace by ChaCha20 keyed by the kernel.
+// Keys are replaced after every refill, and are obtained anew from the kernel
+// whenever the kernel's generation changes (e.g. after restore).
+ssize_t GetRandom(void* buffer, size_t len, unsigned int flags,
+                  void* opaque_state, size_t opaque_len) {
+  // A call with these arguments is a request for the allocation parameters.
+  if (!buffer && !len && !flags && opaque_len == ~0UL) {
+    struct opaque_params* p = static_cast<struct opaque_params*>(opaque_state);
+    p->size_of_opaque_state = sizeof(struct state);
+    p->mmap_prot = PROT_READ | PROT_WRITE;
+    p->mmap_flags = MAP_ANONYMOUS | kMapDroppable;
+    for (int i = 0; i < 13; i++) {
+      p->reserved[i] = 0;
+    }
+    return 0;
+  }
+
+  struct state* s = static_cast<struct state*>(opaque_state);
+  if (unlikely(opaque_len != sizeof(*s) || (flags & ~kGrndNonblock) != 0 ||
+               s->in_use)) {
+    // Let the kernel handle invalid arguments and GRND_RANDOM, or reentrant
+    // use from a signal handler.
+    return sys_getrandom(buffer, len, flags);
+  }
+
+  if (len > 0x7fffffff) {
+    len = 0x7fffffff;  // Consistent with the system call.
+  }
+
+  s->in_use = 1;
+  barrier();
+
+  uint64_t generation = rng_generation();
+  if (unlikely(!s->keyed || s->generation != generation)) {
+    if (!rekey(s, generation)) {
+      barrier();
+      s->in_use = 0;
+      return sys_getrandom(buffer, len, flags);
+    }
+  }
+
+  uint8_t* out = static_cast<uint8_t*>(buffer);
+  volatile uint8_t* batch = s->batch;
+  size_t done = 0;
+  while (done < len) {
+    if (s->pos == kBatchSize) {
+      refill(s);
+    }
+    size_t n = kBatchSize - s->pos;
+    if (n > len - done) {
+      n = len - done;
+    }
+    for (size_t i = 0; i < n; i++) {
+      out[done + i] = batch[s->pos + i];
+      batch[s->pos + i] = 0;
+    }
+    s->pos += n;
+    done += n;
+  }
+
+  barrier();
+  s->in_use = 0;
+  return len;
+}
+
+}  // namespace vdso
@@ -19,48 +19,10 @@
 #include <time.h>
 
 #include "vdso/cycle_clock.h"
+#include "vdso/params.h"
 #include "vdso/seqlock.h"
 #include "vdso/syscalls.h"
 
-// struct params defines the layout of the parameter page maintained by the
-// kernel (i.e., sentry).
-//
-// This is similar to the VVAR page maintained by the normal Linux kernel for
-// its VDSO, but it has a different layout.
-//
-// It must be kept in sync with VDSOParamPage in pkg/sentry/kernel/vdso.go.
-struct params {
-  uint64_t seq_count;
-
-  uint64_t monotonic_ready;
-  int64_t monotonic_base_cycles;
-  int64_t monotonic_base_ref;
-  uint64_t monotonic_frequency;
-
-  uint64_t realtime_ready;
-  int64_t realtime_base_cycles;
-  int64_t realtime_base_ref;
-  uint64_t realtime_frequency;
-};
-
-// Returns a pointer to the global parameter page.
-//
-// This page lives in the page just before the VDSO binary itself. The linker
-// defines _params as the page before the VDSO.
-//
-// Ideally, we'd simply declare _params as an extern struct params.
-// Unfortunately various combinations of old/new versions of gcc/clang and
-// gold/bfd struggle to generate references to such a global without generating
-// relocations.
-//
-// So instead, we use inline assembly with a construct that seems to have wide
-// compatibility across many toolchains.
-inline struct params* get_params() {
-  struct params* p = nullptr;
-  asm volatile("leaq _params(%%rip), %0" : "=r"(p) : :);
-  return p;
-}
-
 namespace vdso {
 
 const uint64_t kNsecsPerSec = 1000000000UL;